@@ -0,0 +1,370 @@
+-- Deploy civic_os:v0-100-0-notify-job-triggers to pg
+-- requires: v0-99-0-source-lint-findings
+--
+-- v0.100.0 — Triggers announce work with NOTIFY; the worker enqueues jobs:
+--   1. insert_thumbnail_job() notifies file_uploaded with the file ID
+--   2. enqueue_notification_job() notifies notification_created with the
+--      notification ID
+--   3. time_slot_series.expansion_requested_until and
+--      metadata.request_series_expansion(), which notifies series_changed
+--      with the series ID
+--   4. create_recurring_series(), update_series_schedule() and
+--      expand_series_instances() request expansion instead of inserting jobs
+--   5. Record schema decision
+--
+-- These triggers and RPCs wrote rows into metadata.river_job by hand, so
+-- every River upgrade that touched the job table risked breaking uploads,
+-- notifications and recurring schedules. The consolidated worker's
+-- NotifyListener now inserts the jobs through the River client. NOTIFY is
+-- not durable, so after every (re)connect the listener also enqueues work
+-- still pending in these tables (see notify_listener.go).
+
+BEGIN;
+
+-- ============================================================================
+-- 1. FILE UPLOADS
+-- ============================================================================
+-- Pending thumbnails are resynced from metadata.files.thumbnail_status.
+
+CREATE OR REPLACE FUNCTION insert_thumbnail_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Only announce files that still need thumbnails
+    IF NEW.thumbnail_status = 'pending' THEN
+        PERFORM pg_notify('file_uploaded', NEW.id::TEXT);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON FUNCTION insert_thumbnail_job() IS
+    'Trigger function announcing a file that needs thumbnails on the file_uploaded channel (payload: file ID). The consolidated worker queues thumbnail_generate. Added in v0.10.0, NOTIFY instead of a river_job insert in v0.100.0.';
+
+
+-- ============================================================================
+-- 2. NOTIFICATIONS
+-- ============================================================================
+-- The worker reads the job args from the notification row, and resyncs
+-- notifications still pending.
+
+CREATE OR REPLACE FUNCTION public.enqueue_notification_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    PERFORM pg_notify('notification_created', NEW.id::TEXT);
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION public.enqueue_notification_job() IS
+    'Trigger function announcing a new notification on the notification_created channel (payload: notification ID). The consolidated worker queues send_notification from the row. NOTIFY instead of a river_job insert since v0.100.0.';
+
+
+-- ============================================================================
+-- 3. SERIES EXPANSION REQUESTS
+-- ============================================================================
+-- The requested horizon used to live only in the job args. It is recorded on
+-- the series so the worker can read it when notified and resync series
+-- whose expansion never ran.
+
+ALTER TABLE metadata.time_slot_series
+    ADD COLUMN expansion_requested_until DATE;
+
+COMMENT ON COLUMN metadata.time_slot_series.expansion_requested_until IS
+    'Horizon of the latest expansion request. The worker expands series whose expanded_until is NULL or earlier. Added in v0.100.0.';
+
+CREATE INDEX idx_time_slot_series_expansion_requested
+    ON metadata.time_slot_series(id)
+    WHERE expansion_requested_until IS NOT NULL AND status = 'active';
+
+CREATE OR REPLACE FUNCTION metadata.request_series_expansion(
+    p_series_id BIGINT,
+    p_expand_until DATE
+)
+RETURNS VOID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    UPDATE metadata.time_slot_series
+    SET expansion_requested_until = p_expand_until
+    WHERE id = p_series_id;
+
+    PERFORM pg_notify('series_changed', p_series_id::TEXT);
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.request_series_expansion(BIGINT, DATE) IS
+    'Records an expansion request for a series up to p_expand_until and announces it on the series_changed channel (payload: series ID). The consolidated worker queues expand_recurring_series. Added in v0.100.0.';
+
+REVOKE EXECUTE ON FUNCTION metadata.request_series_expansion(BIGINT, DATE) FROM PUBLIC;
+
+
+-- ============================================================================
+-- 4. SERIES RPCs
+-- ============================================================================
+-- Same as before except for the expansion request.
+
+CREATE OR REPLACE FUNCTION public.create_recurring_series(
+    p_group_name TEXT,
+    p_group_description TEXT DEFAULT NULL,
+    p_group_color TEXT DEFAULT NULL,
+    p_entity_table NAME DEFAULT NULL,
+    p_entity_template JSONB DEFAULT '{}',
+    p_rrule TEXT DEFAULT NULL,
+    p_dtstart TIMESTAMP DEFAULT NULL,
+    p_duration INTERVAL DEFAULT NULL,
+    p_timezone TEXT DEFAULT NULL,
+    p_time_slot_property NAME DEFAULT 'time_slot',
+    p_expand_now BOOLEAN DEFAULT FALSE,
+    p_skip_conflicts BOOLEAN DEFAULT FALSE,
+    p_expand_horizon_days INTEGER DEFAULT 90
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_group_id BIGINT;
+    v_series_id BIGINT;
+    v_user_id UUID;
+BEGIN
+    -- Get current user
+    v_user_id := public.current_user_id();
+
+    -- Validate required fields
+    IF p_entity_table IS NULL THEN
+        RAISE EXCEPTION 'entity_table is required';
+    END IF;
+    IF p_rrule IS NULL THEN
+        RAISE EXCEPTION 'rrule is required';
+    END IF;
+    IF p_dtstart IS NULL THEN
+        RAISE EXCEPTION 'dtstart is required';
+    END IF;
+    IF p_duration IS NULL THEN
+        RAISE EXCEPTION 'duration is required';
+    END IF;
+
+    -- Validate RRULE (will raise exception if invalid)
+    PERFORM metadata.validate_rrule(p_rrule);
+
+    -- Validate entity template
+    PERFORM metadata.validate_entity_template(p_entity_table, p_entity_template);
+
+    -- Create group
+    INSERT INTO metadata.time_slot_series_groups (
+        display_name, description, color, created_by
+    ) VALUES (
+        p_group_name, p_group_description, p_group_color, v_user_id
+    ) RETURNING id INTO v_group_id;
+
+    -- Create series (dtstart is now local wall-clock time, effective_from is just the date)
+    INSERT INTO metadata.time_slot_series (
+        group_id, version_number, effective_from, entity_table,
+        entity_template, rrule, dtstart, duration, timezone,
+        time_slot_property, status, created_by
+    ) VALUES (
+        v_group_id, 1, p_dtstart::DATE, p_entity_table,
+        p_entity_template, p_rrule, p_dtstart, p_duration, p_timezone,
+        p_time_slot_property, 'active', v_user_id
+    ) RETURNING id INTO v_series_id;
+
+    -- If expand_now is true, request expansion
+    IF p_expand_now THEN
+        -- Request expansion (p_expand_horizon_days from TODAY)
+        PERFORM metadata.request_series_expansion(
+            v_series_id, (NOW() + (p_expand_horizon_days || ' days')::INTERVAL)::DATE
+        );
+    END IF;
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'group_id', v_group_id,
+        'series_id', v_series_id,
+        'message', 'Recurring series created successfully'
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.update_series_schedule(
+    p_series_id BIGINT,
+    p_dtstart TIMESTAMP,
+    p_duration INTERVAL,
+    p_rrule TEXT,
+    p_expand_horizon_days INTEGER DEFAULT 90
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_series RECORD;
+    v_user_id UUID;
+    v_entity_ids BIGINT[];
+    v_kept_ids BIGINT[] := '{}';
+    v_entity_id BIGINT;
+    v_deleted_count INT := 0;
+    v_expand_until DATE;
+BEGIN
+    v_user_id := public.current_user_id();
+
+    -- Get series
+    SELECT * INTO v_series
+    FROM metadata.time_slot_series
+    WHERE id = p_series_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series not found');
+    END IF;
+
+    -- Check permissions (creator or has update permission or admin)
+    IF NOT (
+        v_series.created_by = v_user_id
+        OR public.has_permission('time_slot_series', 'update')
+        OR public.is_admin()
+    ) THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Permission denied');
+    END IF;
+
+    -- Validate RRULE (will raise exception if invalid)
+    PERFORM metadata.validate_rrule(p_rrule);
+
+    -- Wait for any expansion transaction on this series to finish
+    IF NOT metadata.try_lock_entity('time_slot_series', p_series_id::TEXT, INTERVAL '30 seconds') THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series is being expanded; try again shortly');
+    END IF;
+
+    -- Step 1: Collect entity IDs from non-exception instances, keeping rows
+    -- someone else is editing
+    FOR v_entity_id IN
+        SELECT entity_id
+        FROM metadata.time_slot_instances
+        WHERE series_id = p_series_id
+          AND entity_id IS NOT NULL
+          AND is_exception = FALSE
+    LOOP
+        IF metadata.try_lock_entity(v_series.entity_table, v_entity_id::TEXT, INTERVAL '0', v_user_id) THEN
+            v_entity_ids := array_append(v_entity_ids, v_entity_id);
+        ELSE
+            PERFORM metadata.record_entity_lock_conflict(
+                v_series.entity_table, v_entity_id::TEXT,
+                'update_series_schedule', 'skip', NULL, v_user_id);
+            v_kept_ids := v_kept_ids || v_entity_id;
+        END IF;
+    END LOOP;
+
+    IF cardinality(v_kept_ids) > 0 THEN
+        UPDATE metadata.time_slot_instances
+        SET
+            is_exception = TRUE,
+            exception_type = 'modified',
+            exception_reason = 'Kept during schedule change: being edited',
+            exception_at = NOW(),
+            exception_by = v_user_id
+        WHERE series_id = p_series_id
+          AND entity_id = ANY(v_kept_ids);
+    END IF;
+
+    -- Step 2: Delete entity records
+    IF v_entity_ids IS NOT NULL AND array_length(v_entity_ids, 1) > 0 THEN
+        EXECUTE format(
+            'DELETE FROM public.%I WHERE id = ANY($1)',
+            v_series.entity_table
+        ) USING v_entity_ids;
+        GET DIAGNOSTICS v_deleted_count = ROW_COUNT;
+    END IF;
+
+    -- Step 3: Delete non-exception instances
+    DELETE FROM metadata.time_slot_instances
+    WHERE series_id = p_series_id AND is_exception = FALSE;
+
+    -- Step 4: Update series schedule and reset expansion tracking
+    UPDATE metadata.time_slot_series
+    SET
+        dtstart = p_dtstart,
+        duration = p_duration,
+        rrule = p_rrule,
+        expanded_until = NULL,  -- Reset to trigger fresh expansion
+        effective_from = p_dtstart::DATE
+    WHERE id = p_series_id;
+
+    -- Step 5: Calculate expansion horizon (p_expand_horizon_days from TODAY)
+    v_expand_until := (NOW() + (p_expand_horizon_days || ' days')::INTERVAL)::DATE;
+
+    -- Step 6: Request expansion
+    PERFORM metadata.request_series_expansion(p_series_id, v_expand_until);
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', CASE WHEN cardinality(v_kept_ids) > 0
+            THEN format('Schedule updated. Deleted %s old records; kept %s being edited by someone else. Expansion queued.', v_deleted_count, cardinality(v_kept_ids))
+            ELSE format('Schedule updated. Deleted %s old records. Expansion queued.', v_deleted_count)
+        END,
+        'series_id', p_series_id,
+        'entities_deleted', v_deleted_count,
+        'entities_kept', cardinality(v_kept_ids),
+        'kept_entity_ids', to_jsonb(v_kept_ids),
+        'expand_until', v_expand_until
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.expand_series_instances(
+    p_series_id BIGINT,
+    p_expand_until DATE
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_series RECORD;
+BEGIN
+    -- Get series
+    SELECT * INTO v_series
+    FROM metadata.time_slot_series
+    WHERE id = p_series_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series not found');
+    END IF;
+
+    -- The worker records expanded_until once the instances exist
+    PERFORM metadata.request_series_expansion(p_series_id, p_expand_until);
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', 'Expansion queued',
+        'series_id', p_series_id,
+        'expand_until', p_expand_until
+    );
+END;
+$$;
+
+
+-- ============================================================================
+-- 5. RECORD SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{files,notifications,time_slot_series}',
+   '{expansion_requested_until}',
+   'v0-100-0-notify-job-triggers',
+   'Triggers announce work with NOTIFY instead of inserting River jobs',
+   'accepted',
+   'The thumbnail and notification triggers and the recurring series RPCs inserted rows into metadata.river_job directly, copying River''s column layout, state names and defaults into SQL. River schema upgrades could silently break them, and job options (attempts, uniqueness) differed from the ones the Go job args declare.',
+   'The triggers and RPCs pg_notify() file_uploaded, notification_created and series_changed with the row''s ID. The consolidated worker LISTENs on those channels (and pgrst) through one NotifyListener, with a per-channel debounce, and inserts the jobs with the River client. After every (re)connect each channel resyncs from its table: pending thumbnails and notifications from the last day, and active series whose expansion_requested_until is past expanded_until.',
+   'NOTIFY is delivered on commit like the old inserts, and keeps SQL unaware of River. Storing the requested horizon on the series keeps it when no worker is listening. Thumbnail and notification jobs are unique by file and notification ID, so several worker replicas, or a resync overlapping live notifications, do not duplicate them; series expansion is idempotent.',
+   'Work announced while no worker is connected waits for the next resync instead of sitting in river_job, and pending thumbnails or notifications older than a day are not resynced. Jobs now use the Go InsertOpts (expand_recurring_series gets 10 attempts instead of 3). expand_series_instances() no longer sets expanded_until itself; the worker does once the instances exist.');
+
+COMMIT;
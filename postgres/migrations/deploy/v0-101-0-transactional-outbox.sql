@@ -0,0 +1,382 @@
+-- Deploy civic_os:v0-101-0-transactional-outbox to pg
+-- requires: v0-100-0-notify-job-triggers
+--
+-- v0.101.0 — Transactional outbox for calls to external systems:
+--   1. metadata.outbox_messages: one row per call, written in the same
+--      transaction as the change that causes it
+--   2. metadata.enqueue_outbox_message(), which stamps the audit context and
+--      notifies outbox_message with the destination
+--   3. Keycloak role and group sync triggers write outbox messages instead of
+--      River jobs
+--   4. public.outbox_messages view and public.retry_outbox_message() for admins
+--   5. Record schema decision
+--
+-- The consolidated worker's outbox_dispatch job delivers a destination's
+-- messages one at a time in ID order and marks each delivered in the
+-- transaction that holds its row lock (see outbox.go).
+
+BEGIN;
+
+-- ============================================================================
+-- 1. OUTBOX TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.outbox_messages (
+    id BIGSERIAL PRIMARY KEY,
+    destination TEXT NOT NULL,           -- external system, e.g. 'keycloak'
+    kind TEXT NOT NULL,                  -- call to make, e.g. 'assign_keycloak_role'
+    payload JSONB NOT NULL DEFAULT '{}'::JSONB,
+    audit JSONB,                         -- job_audit_context() of the writer, plus db_user
+
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ,
+
+    CONSTRAINT outbox_messages_status_check CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+COMMENT ON TABLE metadata.outbox_messages IS
+    'Calls to external systems (Keycloak, email, ...) written in the same transaction as the change that causes them. The consolidated worker delivers each destination''s pending messages in ID order, retrying with backoff; a message still failing after its last attempt is marked failed and the destination moves on. Added in v0.101.0.';
+COMMENT ON COLUMN metadata.outbox_messages.kind IS
+    'Handler the worker runs for the message. Keycloak kinds reuse the River job kinds they replace (assign_keycloak_role, sync_keycloak_group, ...) and their args as payload.';
+
+-- Finding the head of each destination's queue
+CREATE INDEX idx_outbox_messages_pending
+    ON metadata.outbox_messages(destination, id)
+    WHERE status = 'pending';
+CREATE INDEX idx_outbox_messages_created_at ON metadata.outbox_messages(created_at);
+
+-- No policies: writers go through enqueue_outbox_message(), admins read the view
+ALTER TABLE metadata.outbox_messages ENABLE ROW LEVEL SECURITY;
+REVOKE ALL ON metadata.outbox_messages FROM PUBLIC;
+
+
+-- ============================================================================
+-- 2. ENQUEUE FUNCTION AND NOTIFY TRIGGER
+-- ============================================================================
+-- Like stamp_job_audit_context() for user_provisioning jobs, every message
+-- records the requesting user (when there is a JWT) and the login role.
+
+CREATE OR REPLACE FUNCTION metadata.enqueue_outbox_message(
+    p_destination TEXT,
+    p_kind TEXT,
+    p_payload JSONB DEFAULT '{}'::JSONB
+)
+RETURNS BIGINT
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_id BIGINT;
+BEGIN
+    INSERT INTO metadata.outbox_messages (destination, kind, payload, audit)
+    VALUES (
+        p_destination,
+        p_kind,
+        COALESCE(p_payload, '{}'::JSONB),
+        COALESCE(metadata.job_audit_context(), '{}'::JSONB) || jsonb_build_object('db_user', session_user)
+    )
+    RETURNING id INTO v_id;
+
+    RETURN v_id;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.enqueue_outbox_message(TEXT, TEXT, JSONB) IS
+    'Writes an outbox message for the consolidated worker to deliver once the calling transaction commits. Returns the message ID, which handlers use as an idempotency key. Added in v0.101.0.';
+
+REVOKE EXECUTE ON FUNCTION metadata.enqueue_outbox_message(TEXT, TEXT, JSONB) FROM PUBLIC;
+
+
+CREATE OR REPLACE FUNCTION metadata.notify_outbox_message()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Identical notifications in one transaction are folded into one, so a
+    -- bulk change wakes the destination's dispatcher once
+    PERFORM pg_notify('outbox_message', NEW.destination);
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.notify_outbox_message() IS
+    'AFTER INSERT/UPDATE trigger on metadata.outbox_messages announcing pending messages on the outbox_message channel (payload: destination). Added in v0.101.0.';
+
+CREATE TRIGGER notify_outbox_message_trigger
+    AFTER INSERT OR UPDATE OF status ON metadata.outbox_messages
+    FOR EACH ROW
+    WHEN (NEW.status = 'pending')
+    EXECUTE FUNCTION metadata.notify_outbox_message();
+
+
+-- ============================================================================
+-- 3. KEYCLOAK SYNC THROUGH THE OUTBOX
+-- ============================================================================
+-- Each change used to queue its own River job, and the user_provisioning
+-- queue runs five at a time, so a role assigned and revoked in quick
+-- succession could reach Keycloak in the wrong order (or an assignment could
+-- run before the role existed). Messages to 'keycloak' are delivered in order.
+-- Payloads are the args of the jobs they replace.
+
+CREATE OR REPLACE FUNCTION metadata.trg_roles_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    -- Skip built-in roles — these exist in Keycloak realm config already
+    IF NEW.role_key IN ('anonymous', 'user', 'admin', 'editor', 'manager') THEN
+      RETURN NEW;
+    END IF;
+
+    PERFORM metadata.enqueue_outbox_message('keycloak', 'sync_keycloak_role', jsonb_build_object(
+      'role_name', NEW.role_key,
+      'description', COALESCE(NEW.description, ''),
+      'action', 'create'
+    ));
+    RETURN NEW;
+  END IF;
+
+  IF TG_OP = 'DELETE' THEN
+    PERFORM metadata.enqueue_outbox_message('keycloak', 'sync_keycloak_role', jsonb_build_object(
+      'role_name', OLD.role_key,
+      'description', '',
+      'action', 'delete'
+    ));
+    RETURN OLD;
+  END IF;
+
+  RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_roles_sync_keycloak() IS
+  'AFTER INSERT/DELETE trigger on metadata.roles. Writes a sync_keycloak_role
+   outbox message to create/delete the role in Keycloak. Skips built-in roles
+   (anonymous, user, admin, editor, manager) on INSERT. Added in v0.36.0,
+   outbox instead of a River job in v0.101.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.trg_user_roles_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+  v_role_key TEXT;
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    SELECT role_key INTO v_role_key
+    FROM metadata.roles
+    WHERE id = NEW.role_id;
+
+    -- If role not found (shouldn't happen due to FK), skip
+    IF v_role_key IS NULL THEN
+      RETURN NEW;
+    END IF;
+
+    PERFORM metadata.enqueue_outbox_message('keycloak', 'assign_keycloak_role', jsonb_build_object(
+      'user_id', NEW.user_id::text,
+      'role_name', v_role_key
+    ));
+    RETURN NEW;
+  END IF;
+
+  IF TG_OP = 'DELETE' THEN
+    SELECT role_key INTO v_role_key
+    FROM metadata.roles
+    WHERE id = OLD.role_id;
+
+    -- If role not found (CASCADE deleted), skip — the roles trigger already
+    -- wrote the role deletion
+    IF v_role_key IS NULL THEN
+      RETURN OLD;
+    END IF;
+
+    PERFORM metadata.enqueue_outbox_message('keycloak', 'revoke_keycloak_role', jsonb_build_object(
+      'user_id', OLD.user_id::text,
+      'role_name', v_role_key
+    ));
+    RETURN OLD;
+  END IF;
+
+  RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_user_roles_sync_keycloak() IS
+  'AFTER INSERT/DELETE trigger on metadata.user_roles. Writes assign/revoke
+   Keycloak role outbox messages. On DELETE, skips if role not found (CASCADE
+   from role deletion — the roles trigger handles that case). Added in v0.36.0,
+   outbox instead of River jobs in v0.101.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.trg_groups_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM metadata.enqueue_outbox_message('keycloak', 'sync_keycloak_group', jsonb_build_object(
+            'group_name', NEW.group_key,
+            'description', COALESCE(NEW.description, ''),
+            'action', 'create'
+        ));
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        PERFORM metadata.enqueue_outbox_message('keycloak', 'sync_keycloak_group', jsonb_build_object(
+            'group_name', OLD.group_key,
+            'description', '',
+            'action', 'delete'
+        ));
+        RETURN OLD;
+    END IF;
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_groups_sync_keycloak() IS
+    'AFTER INSERT/DELETE trigger on metadata.groups. Writes a sync_keycloak_group outbox message to create/delete the group in Keycloak. Added in v0.95.0, outbox instead of a River job in v0.101.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.trg_user_groups_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group_key TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        SELECT group_key INTO v_group_key FROM metadata.groups WHERE id = NEW.group_id;
+        IF v_group_key IS NULL THEN
+            RETURN NEW;
+        END IF;
+
+        PERFORM metadata.enqueue_outbox_message('keycloak', 'assign_keycloak_group',
+            jsonb_build_object('user_id', NEW.user_id::text, 'group_name', v_group_key));
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        -- A CASCADE from a group deletion finds no group: deleting the group
+        -- in Keycloak drops its memberships, so no revoke is needed
+        SELECT group_key INTO v_group_key FROM metadata.groups WHERE id = OLD.group_id;
+        IF v_group_key IS NULL THEN
+            RETURN OLD;
+        END IF;
+
+        PERFORM metadata.enqueue_outbox_message('keycloak', 'revoke_keycloak_group',
+            jsonb_build_object('user_id', OLD.user_id::text, 'group_name', v_group_key));
+        RETURN OLD;
+    END IF;
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_user_groups_sync_keycloak() IS
+    'AFTER INSERT/DELETE trigger on metadata.user_groups. Writes assign/revoke Keycloak group outbox messages. On DELETE, skips if the group is gone (CASCADE from a group deletion). Added in v0.95.0, outbox instead of River jobs in v0.101.0.';
+
+
+-- ============================================================================
+-- 4. ADMIN VIEW AND RETRY
+-- ============================================================================
+
+-- Runs as the view owner, since authenticated has no access to the table
+CREATE VIEW public.outbox_messages AS
+SELECT m.id, m.destination, m.kind, m.payload, m.status, m.attempts, m.last_error,
+       m.next_attempt_at, m.created_at, m.delivered_at
+FROM metadata.outbox_messages m
+WHERE metadata.is_admin();
+
+COMMENT ON VIEW public.outbox_messages IS
+    'Outbox messages and their delivery state, admin-only. Added in v0.101.0.';
+
+GRANT SELECT ON public.outbox_messages TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.retry_outbox_message(p_id BIGINT)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_destination TEXT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can retry outbox messages';
+    END IF;
+
+    -- The status change fires notify_outbox_message_trigger
+    UPDATE metadata.outbox_messages
+    SET status = 'pending', attempts = 0, last_error = NULL, next_attempt_at = NOW()
+    WHERE id = p_id AND status = 'failed'
+    RETURNING destination INTO v_destination;
+
+    IF v_destination IS NULL THEN
+        RETURN jsonb_build_object(
+            'success', false,
+            'message', format('Outbox message %s is not failed', p_id)
+        );
+    END IF;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'outbox_retry_requested',
+        jsonb_build_object('outbox_message_id', p_id, 'destination', v_destination)
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'message', format('Outbox message %s queued for delivery to %s', p_id, v_destination)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.retry_outbox_message(BIGINT) IS
+    'Admin-only. Makes a failed outbox message pending again. Its ID is lower than anything written since, so it is delivered next for its destination. Added in v0.101.0.';
+
+REVOKE EXECUTE ON FUNCTION public.retry_outbox_message(BIGINT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.retry_outbox_message(BIGINT) TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{outbox_messages,user_roles,roles,user_groups,groups}',
+   '{}',
+   'v0-101-0-transactional-outbox',
+   'Transactional outbox for external side effects',
+   'accepted',
+   'Calls to Keycloak were queued as independent River jobs on a queue that runs five at a time, so role and group changes could reach Keycloak out of order, and workers that changed the database and then queued a follow-up in a separate statement could commit one without the other.',
+   'Side effects on external systems are written to metadata.outbox_messages in the same transaction as the change, through metadata.enqueue_outbox_message() in SQL or writeOutboxMessage() in Go. A trigger notifies outbox_message with the destination; the consolidated worker queues an outbox_dispatch job that locks the oldest pending message of the destination, runs the handler for its kind and marks it delivered in the same transaction. Failures are retried with backoff while the message holds the head of the queue; after the last attempt it is marked failed and later messages proceed. The Keycloak role and group triggers are the first writers.',
+   'Only one message per destination is in flight, so calls arrive in the order their transactions wrote them. A message is marked delivered only if the delivery succeeded, and the row lock keeps two dispatchers from delivering it at once; a crash between the call and the commit redelivers it, so handlers must be idempotent (Keycloak role and group operations are) or pass the message ID as an idempotency key.',
+   'One slow or failing Keycloak call delays the calls behind it until it succeeds or is given up. Failed messages need an admin retry (retry_outbox_message), which delivers them after newer messages already delivered. Role and group jobs queued before this migration still run through the River workers. Delivered and failed messages are purged after 30 days by the outbox_cleanup maintenance task.');
+
+COMMIT;
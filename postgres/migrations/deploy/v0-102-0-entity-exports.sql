@@ -0,0 +1,242 @@
+-- Deploy civic_os:v0-102-0-entity-exports to pg
+-- requires: v0-101-0-transactional-outbox
+--
+-- v0.102.0 — Entity list exports generated in the background:
+--   1. metadata.entity_exports: one row per requested export, with the list
+--      view's filters, the file's S3 key once generated, and its expiry
+--   2. entity_export_ready notification template, sent to the requester
+--   3. public.request_entity_export(): checks read permission, records the
+--      export and notifies export_requested
+--   4. public.get_entity_exports() RPC: the caller's recent exports
+--   5. Record schema decision
+--
+-- The export_generate job (consolidated worker, exports queue) runs the list
+-- query as the requester (role authenticated with claims rebuilt from their
+-- ID and the roles captured at request time, so grants and RLS apply),
+-- streams it to CSV, XLSX or PDF, uploads the file to S3 and sends
+-- entity_export_ready with a presigned download link. Private
+-- columns (metadata.column_privacy) are withheld, and every export writes a
+-- data_export row to metadata.admin_audit_log like the browser export does.
+--
+-- The browser Excel export is unchanged; this path is for lists too large to
+-- fetch through PostgREST in one request.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. EXPORTS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.entity_exports (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES metadata.civic_os_users(id) ON DELETE CASCADE,
+    table_name NAME NOT NULL,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'xlsx', 'pdf')),
+
+    -- The list view's state when the export was requested
+    filters JSONB NOT NULL DEFAULT '[]'::JSONB
+        CHECK (jsonb_typeof(filters) = 'array'),
+    columns TEXT[],
+    order_by TEXT,
+
+    -- The requester's roles at request time. The worker has no JWT, so the
+    -- query runs with claims rebuilt from this snapshot.
+    roles TEXT[] NOT NULL DEFAULT '{}',
+
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'running', 'completed', 'failed', 'expired')),
+    row_count INT,
+    withheld_columns TEXT[] NOT NULL DEFAULT '{}',
+    file_name TEXT,
+    s3_key TEXT,
+    byte_size BIGINT,
+    error_message TEXT,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_entity_exports_user
+    ON metadata.entity_exports(user_id, created_at DESC);
+
+CREATE INDEX idx_entity_exports_expiry
+    ON metadata.entity_exports(expires_at)
+    WHERE status = 'completed';
+
+COMMENT ON TABLE metadata.entity_exports IS
+    'One entity list export requested through request_entity_export() and generated by the export_generate job. Added in v0.102.0.';
+COMMENT ON COLUMN metadata.entity_exports.filters IS
+    'List filters as [{column, operator, value}], operators as in PostgREST: eq, neq, gt, gte, lt, lte, like, ilike, is, in.';
+COMMENT ON COLUMN metadata.entity_exports.columns IS
+    'Columns to export in order; NULL exports every column of the list.';
+COMMENT ON COLUMN metadata.entity_exports.order_by IS
+    'Sort column, with an optional " desc" suffix; NULL sorts by id.';
+COMMENT ON COLUMN metadata.entity_exports.roles IS
+    'get_user_roles() when the export was requested (impersonated roles for an impersonating admin); the export query runs with these roles in its JWT claims.';
+COMMENT ON COLUMN metadata.entity_exports.status IS
+    'pending: queued. running: being generated. completed: file in S3 until expires_at. failed: see error_message. expired: the file was deleted by the export_cleanup maintenance task.';
+
+-- Requesters see their own exports; rows are written by the RPC and worker
+ALTER TABLE metadata.entity_exports ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY entity_exports_select ON metadata.entity_exports
+    FOR SELECT TO authenticated
+    USING (user_id = public.current_user_id() OR public.is_admin());
+
+GRANT SELECT ON metadata.entity_exports TO authenticated;
+
+
+-- ============================================================================
+-- 2. NOTIFICATION TEMPLATE
+-- ============================================================================
+
+INSERT INTO metadata.notification_templates (
+    name,
+    description,
+    entity_type,
+    subject_template,
+    html_template,
+    text_template
+) VALUES (
+    'entity_export_ready',
+    'Sent to the requester when a background export finishes. Template variables: Entity.status (completed or failed), Entity.display_name, Entity.format, Entity.row_count, Entity.file_name, Entity.download_url, Entity.expires_at, Entity.withheld_columns, Entity.error_message; Metadata.site_url, Metadata.site_name.',
+    'entity_exports',
+    -- Subject
+    '[{{.Metadata.site_name}}] {{if eq .Entity.status "failed"}}Export failed{{else}}Your export is ready{{end}}: {{.Entity.display_name}}',
+    -- HTML Template
+    '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        {{if eq .Entity.status "failed"}}
+        <h2 style="color: #dc2626;">Export failed</h2>
+        <p>Your export of <strong>{{.Entity.display_name}}</strong> could not be generated.</p>
+        {{if .Entity.error_message}}<p style="color: #dc2626;">{{.Entity.error_message}}</p>{{end}}
+        {{else}}
+        <h2>Your export is ready</h2>
+        <p>Your {{.Entity.format}} export of <strong>{{.Entity.display_name}}</strong> ({{.Entity.row_count}} rows) is ready to download.</p>
+        <p style="margin: 24px 0;"><a href="{{.Entity.download_url}}" style="background: #2563eb; color: #ffffff; padding: 10px 18px; border-radius: 6px; text-decoration: none;">Download {{.Entity.file_name}}</a></p>
+        <p style="color: #6b7280; font-size: 14px;">The link expires {{.Entity.expires_at}}.</p>
+        {{if .Entity.withheld_columns}}<p style="color: #6b7280; font-size: 14px;">Private columns were left out: {{.Entity.withheld_columns}}.</p>{{end}}
+        {{end}}
+    </div>',
+    -- Text Template
+    '{{if eq .Entity.status "failed"}}Export failed
+
+Your export of {{.Entity.display_name}} could not be generated.
+{{if .Entity.error_message}}{{.Entity.error_message}}
+{{end}}{{else}}Your export is ready
+
+Your {{.Entity.format}} export of {{.Entity.display_name}} ({{.Entity.row_count}} rows) is ready to download:
+{{.Entity.download_url}}
+
+The link expires {{.Entity.expires_at}}.
+{{if .Entity.withheld_columns}}Private columns were left out: {{.Entity.withheld_columns}}.
+{{end}}{{end}}'
+)
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    entity_type = EXCLUDED.entity_type,
+    subject_template = EXCLUDED.subject_template,
+    html_template = EXCLUDED.html_template,
+    text_template = EXCLUDED.text_template;
+
+
+-- ============================================================================
+-- 3. REQUEST RPC
+-- ============================================================================
+-- Filters and columns are checked by the worker against the table's actual
+-- columns; this only rejects requests that can never succeed.
+
+CREATE OR REPLACE FUNCTION public.request_entity_export(
+    p_table_name NAME,
+    p_format TEXT DEFAULT 'csv',
+    p_filters JSONB DEFAULT '[]'::JSONB,
+    p_columns TEXT[] DEFAULT NULL,
+    p_order_by TEXT DEFAULT NULL
+)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_user_id UUID := public.current_user_id();
+    v_export_id BIGINT;
+BEGIN
+    IF v_user_id IS NULL THEN
+        RETURN json_build_object('success', false, 'error', 'Authentication required');
+    END IF;
+
+    IF NOT metadata.has_permission(p_table_name, 'read') THEN
+        RETURN json_build_object('success', false, 'error', 'Permission denied');
+    END IF;
+
+    IF lower(p_format) NOT IN ('csv', 'xlsx', 'pdf') THEN
+        RETURN json_build_object('success', false, 'error', 'Export format must be csv, xlsx or pdf');
+    END IF;
+
+    IF jsonb_typeof(COALESCE(p_filters, '[]'::JSONB)) <> 'array' THEN
+        RETURN json_build_object('success', false, 'error', 'Filters must be an array');
+    END IF;
+
+    INSERT INTO metadata.entity_exports (user_id, table_name, format, filters, columns, order_by, roles)
+    VALUES (v_user_id, p_table_name, lower(p_format), COALESCE(p_filters, '[]'::JSONB),
+            NULLIF(p_columns, '{}'), NULLIF(trim(p_order_by), ''), metadata.get_user_roles())
+    RETURNING id INTO v_export_id;
+
+    -- The worker queues export_generate (see notify_listener.go)
+    PERFORM pg_notify('export_requested', v_export_id::TEXT);
+
+    RETURN json_build_object('success', true, 'export_id', v_export_id);
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_entity_export(NAME, TEXT, JSONB, TEXT[], TEXT) IS
+    'Queues a background export of an entity list (csv, xlsx or pdf) with the list view''s filters, columns and sort. The requester is notified with entity_export_ready and a download link. Requires read permission on the table. Added in v0.102.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_entity_export(NAME, TEXT, JSONB, TEXT[], TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_entity_export(NAME, TEXT, JSONB, TEXT[], TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 4. STATUS RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_entity_exports(p_limit INT DEFAULT 20)
+RETURNS SETOF metadata.entity_exports
+LANGUAGE sql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+    SELECT * FROM metadata.entity_exports e
+    WHERE e.user_id = public.current_user_id()
+    ORDER BY e.created_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 200);
+$$;
+
+COMMENT ON FUNCTION public.get_entity_exports(INT) IS
+    'The caller''s recent background exports, newest first. Added in v0.102.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_entity_exports(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_exports(INT) TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{entity_exports,notifications}',
+   '{}',
+   'v0-102-0-entity-exports',
+   'Background entity exports to CSV, XLSX and PDF',
+   'accepted',
+   'The Excel export fetches the whole filtered list through PostgREST in the browser and builds the workbook there. Lists of more than a few tens of thousands of rows time out or exhaust the tab, and the browser export is capped at 50,000 rows.',
+   'request_entity_export() records the list view''s filters, columns and sort in metadata.entity_exports and notifies export_requested. The export_generate job runs the query in a read-only transaction as role authenticated with JWT claims rebuilt from the requester''s ID and the roles captured at request time, streams rows to a temporary file in the requested format, uploads it to S3 under exports/ and sends entity_export_ready with a presigned GET link. Private columns from metadata.column_privacy are left out and listed in withheld_columns; each export writes a data_export row to admin_audit_log. The export_cleanup maintenance task deletes files whose link has expired.',
+   'Running as the requester means an export can never contain rows or columns the requester could not read through the API, without reimplementing permission checks in Go. Filters are translated from the same column/operator/value triples the list view sends to PostgREST, with values always passed as parameters.',
+   'Foreign keys are exported as IDs rather than display names, and geography columns as WKT. PDF exports are meant for printing and are limited to EXPORT_PDF_MAX_ROWS rows. Download links stop working after EXPORT_LINK_HOURS; the request row stays as a record.');
+
+COMMIT;
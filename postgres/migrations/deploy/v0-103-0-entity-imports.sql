@@ -0,0 +1,370 @@
+-- Deploy civic_os:v0-103-0-entity-imports to pg
+-- requires: v0-102-0-entity-exports
+--
+-- v0.103.0 — Entity imports from an uploaded CSV or XLSX, validated first:
+--   1. metadata.entity_imports: one row per uploaded file and target table,
+--      with progress counters; metadata.entity_import_errors: the row-level
+--      error report
+--   2. entity_import_summary notification template, sent to the importer
+--   3. public.request_entity_import(): checks create permission and the file,
+--      records the import (a dry run by default) and notifies import_requested
+--   4. public.start_entity_import(): runs the real import after a dry run
+--   5. public.get_entity_imports() / public.get_entity_import_errors() RPCs
+--   6. Record schema decision
+--
+-- The entity_import job (consolidated worker, imports queue) reads the file
+-- from S3, maps its headers to columns the way the browser import does, and
+-- inserts every row as the importer (role authenticated with claims rebuilt
+-- from their ID and the roles captured at request time, so grants, RLS,
+-- constraints and triggers apply). A dry run does this in one transaction
+-- that is rolled back, leaving only the error report; the real import
+-- commits in batches and records its progress with each batch.
+--
+-- The browser import modal is unchanged; this path is for files too large to
+-- validate and submit from the browser.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. IMPORT TABLES
+-- ============================================================================
+
+CREATE TABLE metadata.entity_imports (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES metadata.civic_os_users(id) ON DELETE CASCADE,
+    table_name NAME NOT NULL,
+    file_id UUID NOT NULL REFERENCES metadata.files(id),
+    file_name TEXT NOT NULL,
+
+    -- File header -> column overrides; a null column ignores the header
+    column_map JSONB NOT NULL DEFAULT '{}'::JSONB
+        CHECK (jsonb_typeof(column_map) = 'object'),
+    dry_run BOOLEAN NOT NULL DEFAULT TRUE,
+
+    -- The importer's roles at request time. The worker has no JWT, so rows
+    -- are inserted with claims rebuilt from this snapshot.
+    roles TEXT[] NOT NULL DEFAULT '{}',
+
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'validating', 'validated', 'importing', 'completed', 'failed')),
+    columns TEXT[] NOT NULL DEFAULT '{}',
+    ignored_headers TEXT[] NOT NULL DEFAULT '{}',
+    total_rows INT NOT NULL DEFAULT 0,
+    processed_rows INT NOT NULL DEFAULT 0,
+    valid_rows INT NOT NULL DEFAULT 0,
+    invalid_rows INT NOT NULL DEFAULT 0,
+    imported_rows INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    validated_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_entity_imports_user
+    ON metadata.entity_imports(user_id, created_at DESC);
+
+COMMENT ON TABLE metadata.entity_imports IS
+    'One entity import requested through request_entity_import() and processed by the entity_import job. Added in v0.103.0.';
+COMMENT ON COLUMN metadata.entity_imports.column_map IS
+    'Header overrides as {"File Header": "column_name"}. Headers not listed are matched to column names and display names as in the browser import; a null column ignores the header.';
+COMMENT ON COLUMN metadata.entity_imports.dry_run IS
+    'True until start_entity_import(): the job validates every row in a transaction that is rolled back.';
+COMMENT ON COLUMN metadata.entity_imports.roles IS
+    'get_user_roles() when the import was requested; rows are inserted with these roles in the JWT claims.';
+COMMENT ON COLUMN metadata.entity_imports.status IS
+    'pending: queued. validating: dry run in progress. validated: dry run finished, see invalid_rows and the error report. importing: rows being inserted, processed_rows of total_rows done. completed: every row processed; invalid rows were skipped. failed: see error_message.';
+COMMENT ON COLUMN metadata.entity_imports.processed_rows IS
+    'Data rows validated (dry run) or committed (import) so far. An interrupted import resumes after this row.';
+
+
+CREATE TABLE metadata.entity_import_errors (
+    id BIGSERIAL PRIMARY KEY,
+    import_id BIGINT NOT NULL REFERENCES metadata.entity_imports(id) ON DELETE CASCADE,
+    row_number INT NOT NULL,
+    column_name NAME,
+    value TEXT,
+    message TEXT NOT NULL
+);
+
+CREATE INDEX idx_entity_import_errors_import
+    ON metadata.entity_import_errors(import_id, row_number);
+
+COMMENT ON TABLE metadata.entity_import_errors IS
+    'Row-level error report of an entity import: one row per problem, at most 1,000 per import (invalid_rows counts them all). Replaced on every run. Added in v0.103.0.';
+COMMENT ON COLUMN metadata.entity_import_errors.row_number IS
+    'Row number in the uploaded file (spreadsheet row or CSV line), so importers can find it.';
+COMMENT ON COLUMN metadata.entity_import_errors.column_name IS
+    'Column the problem is in; NULL for problems with the row as a whole (RLS, multi-column constraints).';
+
+-- Importers see their own imports; rows are written by the RPCs and worker
+ALTER TABLE metadata.entity_imports ENABLE ROW LEVEL SECURITY;
+ALTER TABLE metadata.entity_import_errors ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY entity_imports_select ON metadata.entity_imports
+    FOR SELECT TO authenticated
+    USING (user_id = public.current_user_id() OR public.is_admin());
+
+CREATE POLICY entity_import_errors_select ON metadata.entity_import_errors
+    FOR SELECT TO authenticated
+    USING (EXISTS (
+        SELECT 1 FROM metadata.entity_imports i
+        WHERE i.id = import_id AND (i.user_id = public.current_user_id() OR public.is_admin())
+    ));
+
+GRANT SELECT ON metadata.entity_imports TO authenticated;
+GRANT SELECT ON metadata.entity_import_errors TO authenticated;
+
+
+-- ============================================================================
+-- 2. NOTIFICATION TEMPLATE
+-- ============================================================================
+
+INSERT INTO metadata.notification_templates (
+    name,
+    description,
+    entity_type,
+    subject_template,
+    html_template,
+    text_template
+) VALUES (
+    'entity_import_summary',
+    'Sent to the importer when an entity import finishes its dry run or its import. Template variables: Entity.status (validated, completed or failed), Entity.display_name, Entity.table_name, Entity.file_name, Entity.error_message, Entity.total_rows, Entity.valid_rows, Entity.invalid_rows, Entity.imported_rows, Entity.ignored_headers, Entity.problems (up to 25 of {row_number, column, value, message}), Entity.more_problems; Metadata.site_url, Metadata.site_name.',
+    'entity_imports',
+    -- Subject
+    '[{{.Metadata.site_name}}] {{if eq .Entity.status "validated"}}Import checked{{else if eq .Entity.status "failed"}}Import failed{{else}}Import finished{{end}}: {{.Entity.file_name}}',
+    -- HTML Template
+    '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        {{if eq .Entity.status "validated"}}
+        <h2>Import checked</h2>
+        <p>We checked <strong>{{.Entity.file_name}}</strong> against {{.Entity.display_name}}. Nothing has been imported yet.</p>
+        {{else if eq .Entity.status "failed"}}
+        <h2 style="color: #dc2626;">Import failed</h2>
+        <p>Your import of <strong>{{.Entity.file_name}}</strong> into {{.Entity.display_name}} has stopped.</p>
+        {{if .Entity.error_message}}<p style="color: #dc2626;">{{.Entity.error_message}}</p>{{end}}
+        {{else}}
+        <h2>Import finished</h2>
+        <p>Your import of <strong>{{.Entity.file_name}}</strong> into {{.Entity.display_name}} has been processed.</p>
+        {{end}}
+        <table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Rows read:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.total_rows}}</td></tr>
+            {{if eq .Entity.status "validated"}}
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Ready to import:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.valid_rows}}</td></tr>
+            {{else}}
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Imported:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.imported_rows}}</td></tr>
+            {{end}}
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Rows with problems:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.invalid_rows}}</td></tr>
+        </table>
+        {{if .Entity.ignored_headers}}<p style="color: #6b7280; font-size: 14px;">Columns not imported: {{.Entity.ignored_headers}}.</p>{{end}}
+        {{if .Entity.problems}}
+        <h3>Rows that need attention</h3>
+        <table style="width: 100%; border-collapse: collapse; font-size: 13px;">
+            <tr><th style="text-align: left; padding: 4px;">Row</th><th style="text-align: left; padding: 4px;">Column</th><th style="text-align: left; padding: 4px;">Problem</th></tr>
+            {{range .Entity.problems}}<tr>
+                <td style="padding: 4px; border-bottom: 1px solid #e5e7eb;">{{.row_number}}</td>
+                <td style="padding: 4px; border-bottom: 1px solid #e5e7eb;">{{.column}}</td>
+                <td style="padding: 4px; border-bottom: 1px solid #e5e7eb;">{{.message}}</td>
+            </tr>{{end}}
+        </table>
+        {{if .Entity.more_problems}}<p style="color: #6b7280;">...and {{.Entity.more_problems}} more.</p>{{end}}
+        {{end}}
+        {{if eq .Entity.status "validated"}}<p>Fix the file and import it again, or start the import to add the {{.Entity.valid_rows}} valid rows and skip the rest.</p>{{end}}
+        <p><a href="{{.Metadata.site_url}}/view/{{.Entity.table_name}}">{{.Metadata.site_url}}/view/{{.Entity.table_name}}</a></p>
+    </div>',
+    -- Text Template
+    '{{if eq .Entity.status "validated"}}Import checked{{else if eq .Entity.status "failed"}}Import failed{{else}}Import finished{{end}}: {{.Entity.file_name}} into {{.Entity.display_name}}
+{{if .Entity.error_message}}
+{{.Entity.error_message}}
+{{end}}
+Rows read: {{.Entity.total_rows}}
+{{if eq .Entity.status "validated"}}Ready to import: {{.Entity.valid_rows}}{{else}}Imported: {{.Entity.imported_rows}}{{end}}
+Rows with problems: {{.Entity.invalid_rows}}
+{{if .Entity.ignored_headers}}Columns not imported: {{.Entity.ignored_headers}}
+{{end}}{{if .Entity.problems}}
+Rows that need attention:
+{{range .Entity.problems}}- Row {{.row_number}}{{if .column}} ({{.column}}){{end}}: {{.message}}
+{{end}}{{if .Entity.more_problems}}...and {{.Entity.more_problems}} more.
+{{end}}{{end}}{{if eq .Entity.status "validated"}}
+Nothing has been imported yet. Fix the file and import it again, or start the import to add the valid rows and skip the rest.
+{{end}}
+{{.Metadata.site_url}}/view/{{.Entity.table_name}}'
+)
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    entity_type = EXCLUDED.entity_type,
+    subject_template = EXCLUDED.subject_template,
+    html_template = EXCLUDED.html_template,
+    text_template = EXCLUDED.text_template;
+
+
+-- ============================================================================
+-- 3. REQUEST RPC
+-- ============================================================================
+-- Headers and values are checked by the worker against the table's actual
+-- columns; this only rejects requests that can never succeed.
+
+CREATE OR REPLACE FUNCTION public.request_entity_import(
+    p_table_name NAME,
+    p_file_id UUID,
+    p_column_map JSONB DEFAULT NULL,
+    p_dry_run BOOLEAN DEFAULT TRUE
+)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_user_id UUID := public.current_user_id();
+    v_file RECORD;
+    v_import_id BIGINT;
+BEGIN
+    IF v_user_id IS NULL THEN
+        RETURN json_build_object('success', false, 'error', 'Authentication required');
+    END IF;
+
+    IF NOT metadata.has_permission(p_table_name, 'create') THEN
+        RETURN json_build_object('success', false, 'error', 'Permission denied');
+    END IF;
+
+    SELECT id, file_name, file_type INTO v_file
+    FROM metadata.files WHERE id = p_file_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('success', false, 'error', 'File not found');
+    END IF;
+
+    IF lower(v_file.file_name) NOT LIKE '%.csv' AND lower(v_file.file_name) NOT LIKE '%.xlsx'
+       AND v_file.file_type NOT IN ('text/csv', 'application/csv', 'text/plain',
+                                    'application/vnd.openxmlformats-officedocument.spreadsheetml.sheet') THEN
+        RETURN json_build_object('success', false, 'error', 'Imports must be CSV or XLSX files');
+    END IF;
+
+    IF p_column_map IS NOT NULL AND jsonb_typeof(p_column_map) <> 'object' THEN
+        RETURN json_build_object('success', false, 'error', 'Column map must be an object of header to column');
+    END IF;
+
+    INSERT INTO metadata.entity_imports (user_id, table_name, file_id, file_name, column_map, dry_run, roles)
+    VALUES (v_user_id, p_table_name, v_file.id, v_file.file_name, COALESCE(p_column_map, '{}'::JSONB),
+            COALESCE(p_dry_run, TRUE), metadata.get_user_roles())
+    RETURNING id INTO v_import_id;
+
+    -- The worker queues entity_import (see notify_listener.go)
+    PERFORM pg_notify('import_requested', v_import_id::TEXT);
+
+    RETURN json_build_object('success', true, 'import_id', v_import_id);
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_entity_import(NAME, UUID, JSONB, BOOLEAN) IS
+    'Queues an import of an uploaded CSV or XLSX (metadata.files id) into an entity table. By default only a dry run: every row is validated and the report is sent with entity_import_summary; call start_entity_import() to import. Requires create permission on the table. Added in v0.103.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_entity_import(NAME, UUID, JSONB, BOOLEAN) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_entity_import(NAME, UUID, JSONB, BOOLEAN) TO authenticated;
+
+
+-- ============================================================================
+-- 4. START RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.start_entity_import(p_import_id BIGINT)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_table_name NAME;
+BEGIN
+    UPDATE metadata.entity_imports
+    SET dry_run = FALSE, status = 'pending', roles = metadata.get_user_roles(), error_message = NULL
+    WHERE id = p_import_id
+      AND user_id = public.current_user_id()
+      AND status = 'validated'
+    RETURNING table_name INTO v_table_name;
+
+    IF v_table_name IS NULL THEN
+        RETURN json_build_object('success', false, 'error', 'Import not found or not checked yet');
+    END IF;
+
+    IF NOT metadata.has_permission(v_table_name, 'create') THEN
+        RAISE EXCEPTION 'Permission denied';
+    END IF;
+
+    PERFORM pg_notify('import_requested', p_import_id::TEXT);
+
+    RETURN json_build_object('success', true, 'import_id', p_import_id);
+END;
+$$;
+
+COMMENT ON FUNCTION public.start_entity_import(BIGINT) IS
+    'Imports the valid rows of a checked (validated) import, skipping the rows its dry run reported. Only the importer can start it. Added in v0.103.0.';
+
+REVOKE EXECUTE ON FUNCTION public.start_entity_import(BIGINT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.start_entity_import(BIGINT) TO authenticated;
+
+
+-- ============================================================================
+-- 5. STATUS RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_entity_imports(p_limit INT DEFAULT 20)
+RETURNS SETOF metadata.entity_imports
+LANGUAGE sql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+    SELECT * FROM metadata.entity_imports i
+    WHERE i.user_id = public.current_user_id()
+    ORDER BY i.created_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 200);
+$$;
+
+COMMENT ON FUNCTION public.get_entity_imports(INT) IS
+    'The caller''s recent entity imports with their progress, newest first. Added in v0.103.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_entity_imports(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_imports(INT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_entity_import_errors(p_import_id BIGINT)
+RETURNS SETOF metadata.entity_import_errors
+LANGUAGE sql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+    SELECT e.* FROM metadata.entity_import_errors e
+    JOIN metadata.entity_imports i ON i.id = e.import_id
+    WHERE e.import_id = p_import_id
+      AND (i.user_id = public.current_user_id() OR public.is_admin())
+    ORDER BY e.row_number, e.id;
+$$;
+
+COMMENT ON FUNCTION public.get_entity_import_errors(BIGINT) IS
+    'Error report of one entity import in file order. Importer or admin only. Added in v0.103.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_entity_import_errors(BIGINT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_import_errors(BIGINT) TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{entity_imports,entity_import_errors,notifications}',
+   '{}',
+   'v0-103-0-entity-imports',
+   'Background entity imports with a dry run',
+   'accepted',
+   'The import modal parses the spreadsheet and validates every row in the browser, then posts the rows to PostgREST. Files over 10 MB are refused, and rows the browser accepts can still be rejected by constraints or RLS halfway through the insert.',
+   'request_entity_import() records the uploaded file and target table and notifies import_requested. The entity_import job maps the headers like the browser import (column or display name, "(Name)" columns resolved through the referenced table''s display_name, "(Start)"/"(End)" pairs for time slots), checks every value with pg_input_error_info() against its column type, and inserts each row under a savepoint as role authenticated with JWT claims rebuilt from the importer''s ID and roles. A dry run does this in one transaction that is rolled back and stores the problems in metadata.entity_import_errors; start_entity_import() then inserts the valid rows in batches of IMPORT_BATCH_SIZE, committing each batch with the import''s progress counters.',
+   'Inserting for real is the only validation that covers foreign keys, unique and check constraints, triggers and RLS exactly as they will apply; rolling back turns it into a dry run without a second set of rules in Go. Committing in batches keeps transactions short on large files and lets a retried job resume after the last committed batch.',
+   'An import is not all-or-nothing: rows that fail are skipped and reported, and a failed import leaves its committed batches in place (imported_rows says how many). Rows can still fail at import time if the data changed after the dry run. Dry runs consume sequence values. Many-to-many columns are not imported by the worker.');
+
+COMMIT;
@@ -0,0 +1,136 @@
+-- Deploy civic_os:v0-104-0-webhook-signing to pg
+-- requires: v0-103-0-entity-imports
+--
+-- v0.104.0 — Signed entity webhooks and automatic disable:
+--   1. metadata.entity_webhook_subscriptions.signing_secret_name: the worker
+--      signs every request body with HMAC-SHA256 under this secret
+--   2. Failure tracking: consecutive_failures, disable_after_failures,
+--      disabled_at, disabled_reason
+--   3. Re-enabling a subscription clears its failure state
+--   4. public.get_entity_webhook_subscriptions() admin RPC
+--   5. Record schema decision
+--
+-- Partners that poll PostgREST for changes can subscribe instead, but they
+-- need to know a request really came from Civic OS, and an endpoint that is
+-- gone for good shouldn't keep collecting retries forever.
+
+BEGIN;
+
+-- ============================================================================
+-- 1-2. SUBSCRIPTION COLUMNS
+-- ============================================================================
+
+ALTER TABLE metadata.entity_webhook_subscriptions
+    ADD COLUMN signing_secret_name VARCHAR(100)
+        CHECK (signing_secret_name ~ '^[A-Z0-9_]+$'),
+    ADD COLUMN consecutive_failures INT NOT NULL DEFAULT 0,
+    ADD COLUMN disable_after_failures INT DEFAULT 20
+        CHECK (disable_after_failures IS NULL OR disable_after_failures >= 1),
+    ADD COLUMN disabled_at TIMESTAMPTZ,
+    ADD COLUMN disabled_reason TEXT;
+
+COMMENT ON COLUMN metadata.entity_webhook_subscriptions.signing_secret_name IS
+    'Name of the signing secret (worker env var ENTITY_WEBHOOK_SECRET_NAME). When set, requests carry X-CivicOS-Timestamp and X-CivicOS-Signature: sha256=HMAC-SHA256(secret, timestamp + "." + body). Added in v0.104.0.';
+COMMENT ON COLUMN metadata.entity_webhook_subscriptions.consecutive_failures IS
+    'Deliveries failed in a row (after all their attempts). Reset by a delivered webhook or by re-enabling. Added in v0.104.0.';
+COMMENT ON COLUMN metadata.entity_webhook_subscriptions.disable_after_failures IS
+    'The worker disables the subscription when consecutive_failures reaches this. NULL never disables. Added in v0.104.0.';
+COMMENT ON COLUMN metadata.entity_webhook_subscriptions.disabled_reason IS
+    'Why the worker disabled the subscription (last error). NULL when an admin disabled it. Added in v0.104.0.';
+
+
+-- ============================================================================
+-- 3. RE-ENABLE RESETS FAILURE STATE
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.reset_entity_webhook_failures()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.enabled AND NOT OLD.enabled THEN
+        NEW.consecutive_failures := 0;
+        NEW.disabled_at := NULL;
+        NEW.disabled_reason := NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER reset_entity_webhook_failures_trigger
+    BEFORE UPDATE OF enabled ON metadata.entity_webhook_subscriptions
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.reset_entity_webhook_failures();
+
+COMMENT ON FUNCTION metadata.reset_entity_webhook_failures() IS
+    'Clears consecutive_failures and the disable reason when a subscription is enabled again. Added in v0.104.0.';
+
+
+-- ============================================================================
+-- 4. ADMIN RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_entity_webhook_subscriptions()
+RETURNS TABLE (
+    id INT,
+    name VARCHAR(100),
+    entity_type NAME,
+    events TEXT[],
+    url TEXT,
+    enabled BOOLEAN,
+    signed BOOLEAN,
+    consecutive_failures INT,
+    disable_after_failures INT,
+    disabled_at TIMESTAMPTZ,
+    disabled_reason TEXT,
+    last_delivered_at TIMESTAMPTZ,
+    open_deliveries BIGINT
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can view webhook subscriptions';
+    END IF;
+
+    RETURN QUERY
+    SELECT s.id, s.name, s.entity_type, s.events, s.url, s.enabled,
+           s.signing_secret_name IS NOT NULL,
+           s.consecutive_failures, s.disable_after_failures, s.disabled_at, s.disabled_reason,
+           (SELECT max(d.delivered_at) FROM metadata.entity_webhook_deliveries d
+            WHERE d.subscription_id = s.id),
+           (SELECT count(*) FROM metadata.entity_webhook_deliveries d
+            WHERE d.subscription_id = s.id AND d.status IN ('pending', 'retrying'))
+    FROM metadata.entity_webhook_subscriptions s
+    ORDER BY s.name;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_entity_webhook_subscriptions() IS
+    'Admin-only. Entity webhook subscriptions with their health: failures in a row, why the worker disabled them, last delivery and deliveries in flight. Added in v0.104.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_entity_webhook_subscriptions() FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_webhook_subscriptions() TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{entity_webhook_subscriptions}',
+   '{signing_secret_name,consecutive_failures,disable_after_failures,disabled_at,disabled_reason}',
+   'v0-104-0-webhook-signing',
+   'Signed entity webhooks and automatic disable after repeated failures',
+   'accepted',
+   'Partner systems poll PostgREST for changes because a webhook endpoint cannot tell a Civic OS request from a forged one unless every subscription is set up with a bearer token header. Subscriptions to endpoints that are gone keep queueing deliveries that retry for hours and then fail, with nobody noticing.',
+   'A subscription may name a signing secret. The worker adds X-CivicOS-Timestamp and X-CivicOS-Signature (sha256= hex HMAC-SHA256 of timestamp "." body) to each attempt, plus X-CivicOS-Delivery and X-CivicOS-Event. Each delivery that fails after its last attempt increments consecutive_failures and a delivered one resets it; at disable_after_failures (default 20) the worker disables the subscription and records why. Retries back off exponentially from 30 seconds, capped at 6 hours.',
+   'Signing the timestamp with the body lets partners reject replays without keeping state, the same scheme as Stripe''s webhooks that integrators already verify. The secret stays in the worker environment like the other webhook secrets, so it is not in database dumps. Counting failed deliveries rather than attempts means a short partner outage retried to success never counts.',
+   'The delivery ID header is the same on every attempt, so partners can drop duplicates. Deliveries already queued when a subscription is disabled fail with "Subscription disabled" and do not count as failures. Re-enabling (UPDATE ... SET enabled = true) clears the failure state; failed deliveries are not resent.');
+
+COMMIT;
@@ -0,0 +1,289 @@
+-- Deploy civic_os:v0-105-0-entity-audit-log to pg
+-- requires: v0-104-0-webhook-signing
+--
+-- v0.105.0 — Change history for entity tables:
+--   1. metadata.entity_changes: raw change rows written by the capture
+--      trigger in the changing transaction
+--   2. metadata.entity_audit_log: the normalized history (who, what, which
+--      columns before and after, when) the worker builds from them
+--   3. metadata.entity_audit_retention: per-table retention policies
+--   4. metadata.capture_entity_changes() trigger function and
+--      enable_entity_audit() / disable_entity_audit() helpers
+--   5. public.get_entity_audit_log() for real admins
+--   6. Record schema decision
+--
+-- Records of permits, licenses and council actions must keep their change
+-- history, and the platform only kept updated_at. The trigger does the
+-- least it can in the user's transaction (one insert and a NOTIFY); the
+-- consolidated worker's entity_audit_capture job diffs the rows and writes
+-- the audit log.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. RAW CHANGES
+-- ============================================================================
+
+CREATE TABLE metadata.entity_changes (
+    id BIGSERIAL PRIMARY KEY,
+    table_name NAME NOT NULL,
+    entity_id TEXT,
+    operation TEXT NOT NULL CHECK (operation IN ('insert', 'update', 'delete')),
+    old_row JSONB,
+    new_row JSONB,
+    audit JSONB NOT NULL,                -- job_audit_context() of the writer, plus db_user
+    txid BIGINT NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.entity_changes IS
+    'Row changes captured by metadata.capture_entity_changes(), waiting for the consolidated worker to write them to entity_audit_log. Rows are deleted as they are processed. Added in v0.105.0.';
+
+-- No policies: only the trigger writes and only the worker reads
+ALTER TABLE metadata.entity_changes ENABLE ROW LEVEL SECURITY;
+REVOKE ALL ON metadata.entity_changes FROM PUBLIC;
+
+
+-- ============================================================================
+-- 2. AUDIT LOG
+-- ============================================================================
+
+CREATE TABLE metadata.entity_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    change_id BIGINT NOT NULL UNIQUE,    -- entity_changes.id it was built from
+    occurred_at TIMESTAMPTZ NOT NULL,
+    txid BIGINT NOT NULL,
+
+    -- What changed
+    table_name NAME NOT NULL,
+    entity_id TEXT,
+    operation TEXT NOT NULL CHECK (operation IN ('insert', 'update', 'delete')),
+    changed_columns TEXT[] NOT NULL DEFAULT '{}',
+    before_values JSONB,
+    after_values JSONB,
+
+    -- Who changed it
+    actor_id UUID,
+    on_behalf_of UUID,
+    impersonated_roles TEXT[],
+    request_id TEXT,
+    db_user TEXT,
+
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.entity_audit_log IS
+    'Change history of entity tables with auditing enabled (see enable_entity_audit). Read via get_entity_audit_log(). Kept forever unless entity_audit_retention has a policy for the table. Added in v0.105.0.';
+COMMENT ON COLUMN metadata.entity_audit_log.before_values IS
+    'Updates: the changed columns before the change. Deletes: the whole row. NULL for inserts.';
+COMMENT ON COLUMN metadata.entity_audit_log.after_values IS
+    'Updates: the changed columns after the change. Inserts: the whole row. NULL for deletes.';
+COMMENT ON COLUMN metadata.entity_audit_log.actor_id IS
+    'The JWT user whose request made the change; with on_behalf_of and impersonated_roles it tells an admin acting as someone else apart from that user. NULL for changes made without a JWT (migrations, scripts, workers); db_user then names the login role.';
+COMMENT ON COLUMN metadata.entity_audit_log.txid IS
+    'Transaction that made the change. Changes with the same txid were committed together.';
+
+CREATE INDEX idx_entity_audit_log_entity ON metadata.entity_audit_log(table_name, entity_id, occurred_at DESC);
+CREATE INDEX idx_entity_audit_log_occurred_at ON metadata.entity_audit_log(occurred_at DESC);
+CREATE INDEX idx_entity_audit_log_actor ON metadata.entity_audit_log(actor_id, occurred_at DESC)
+    WHERE actor_id IS NOT NULL;
+
+-- No policies: only the worker writes and only get_entity_audit_log() reads
+ALTER TABLE metadata.entity_audit_log ENABLE ROW LEVEL SECURITY;
+REVOKE ALL ON metadata.entity_audit_log FROM PUBLIC;
+
+
+-- ============================================================================
+-- 3. RETENTION POLICIES
+-- ============================================================================
+-- Records schedules differ by record type, so retention is per table. A
+-- table without a policy keeps its history forever.
+
+CREATE TABLE metadata.entity_audit_retention (
+    table_name NAME PRIMARY KEY,
+    retain_days INT NOT NULL CHECK (retain_days >= 1),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER set_updated_at_trigger
+    BEFORE UPDATE ON metadata.entity_audit_retention
+    FOR EACH ROW
+    EXECUTE FUNCTION public.set_updated_at();
+
+COMMENT ON TABLE metadata.entity_audit_retention IS
+    'How long entity_audit_log keeps a table''s history. The entity_audit_retention maintenance task deletes older rows daily. Tables without a row are kept forever. Added in v0.105.0.';
+
+
+-- ============================================================================
+-- 4. CAPTURE TRIGGER
+-- ============================================================================
+-- NOTIFYs with the same payload in one transaction are delivered once, so a
+-- bulk update announces itself once.
+
+CREATE OR REPLACE FUNCTION metadata.capture_entity_changes()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_old JSONB;
+    v_new JSONB;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        v_old := to_jsonb(OLD);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        v_new := to_jsonb(NEW);
+    END IF;
+    IF TG_OP = 'UPDATE' AND v_old = v_new THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO metadata.entity_changes (table_name, entity_id, operation, old_row, new_row, audit, txid)
+    VALUES (
+        TG_TABLE_NAME,
+        COALESCE(v_new, v_old)->>'id',
+        lower(TG_OP),
+        v_old,
+        v_new,
+        COALESCE(metadata.job_audit_context(), '{}'::JSONB) || jsonb_build_object('db_user', session_user),
+        txid_current()
+    );
+
+    PERFORM pg_notify('entity_changed', '');
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.capture_entity_changes() IS
+    'AFTER INSERT/UPDATE/DELETE row trigger: records the change in entity_changes with the request''s audit context and notifies entity_changed. Attach with enable_entity_audit(). Added in v0.105.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.enable_entity_audit(
+    p_table_name NAME,
+    p_retain_days INT DEFAULT NULL
+)
+RETURNS VOID
+LANGUAGE plpgsql
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF to_regclass(format('public.%I', p_table_name)) IS NULL THEN
+        RAISE EXCEPTION 'Table public.% does not exist', p_table_name;
+    END IF;
+
+    EXECUTE format('DROP TRIGGER IF EXISTS entity_audit_capture ON public.%I', p_table_name);
+    EXECUTE format(
+        'CREATE TRIGGER entity_audit_capture AFTER INSERT OR UPDATE OR DELETE ON public.%I '
+        'FOR EACH ROW EXECUTE FUNCTION metadata.capture_entity_changes()',
+        p_table_name);
+
+    IF p_retain_days IS NOT NULL THEN
+        INSERT INTO metadata.entity_audit_retention (table_name, retain_days)
+        VALUES (p_table_name, p_retain_days)
+        ON CONFLICT (table_name) DO UPDATE SET retain_days = EXCLUDED.retain_days;
+    END IF;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.enable_entity_audit(NAME, INT) IS
+    'Starts recording the change history of public.<table> (entity_audit_capture trigger), optionally with a retention policy in days. Safe to run again. Added in v0.105.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.disable_entity_audit(p_table_name NAME)
+RETURNS VOID
+LANGUAGE plpgsql
+SET search_path = metadata, public
+AS $$
+BEGIN
+    EXECUTE format('DROP TRIGGER IF EXISTS entity_audit_capture ON public.%I', p_table_name);
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.disable_entity_audit(NAME) IS
+    'Stops recording the change history of public.<table>. The history already recorded is kept. Added in v0.105.0.';
+
+
+-- ============================================================================
+-- 5. READ RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_entity_audit_log(
+    p_table_name NAME DEFAULT NULL,
+    p_entity_id TEXT DEFAULT NULL,
+    p_actor_id UUID DEFAULT NULL,
+    p_limit INT DEFAULT 100,
+    p_offset INT DEFAULT 0
+)
+RETURNS TABLE (
+    id BIGINT,
+    occurred_at TIMESTAMPTZ,
+    table_name NAME,
+    entity_id TEXT,
+    operation TEXT,
+    changed_columns TEXT[],
+    before_values JSONB,
+    after_values JSONB,
+    actor_id UUID,
+    actor_email TEXT,
+    on_behalf_of UUID,
+    impersonated_roles TEXT[],
+    request_id TEXT,
+    db_user TEXT,
+    txid BIGINT
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.is_real_admin() THEN
+        RAISE EXCEPTION 'Only admins can view the entity audit log'
+            USING ERRCODE = '42501';
+    END IF;
+
+    RETURN QUERY
+    SELECT l.id, l.occurred_at, l.table_name, l.entity_id, l.operation, l.changed_columns,
+           l.before_values, l.after_values, l.actor_id, p.email::TEXT, l.on_behalf_of,
+           l.impersonated_roles, l.request_id, l.db_user, l.txid
+    FROM metadata.entity_audit_log l
+    LEFT JOIN metadata.civic_os_users_private p ON p.id = l.actor_id
+    WHERE (p_table_name IS NULL OR l.table_name = p_table_name)
+      AND (p_entity_id IS NULL OR l.entity_id = p_entity_id)
+      AND (p_actor_id IS NULL OR l.actor_id = p_actor_id OR l.on_behalf_of = p_actor_id)
+    ORDER BY l.occurred_at DESC, l.id DESC
+    LIMIT LEAST(GREATEST(COALESCE(p_limit, 100), 1), 1000)
+    OFFSET GREATEST(COALESCE(p_offset, 0), 0);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_entity_audit_log(NAME, TEXT, UUID, INT, INT) IS
+    'Entity change history, newest first. Filter by table, record ID and/or actor (matches actor_id or on_behalf_of). Real admins only. Added in v0.105.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_entity_audit_log(NAME, TEXT, UUID, INT, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_audit_log(NAME, TEXT, UUID, INT, INT) TO authenticated;
+
+
+-- ============================================================================
+-- 6. RECORD SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{entity_changes,entity_audit_log,entity_audit_retention}',
+   '{}',
+   'v0-105-0-entity-audit-log',
+   'Change history for entity tables',
+   'accepted',
+   'Many municipal workflows are legally required to keep the change history of their records: who changed what, from which value to which, and when. Civic OS kept only updated_at and, for some entities, status notes written by hand-made triggers. admin_audit_log and identity_audit_log cover admin actions and identity provider changes, not entity data.',
+   'Integrators run metadata.enable_entity_audit(table) to attach metadata.capture_entity_changes(), an AFTER row trigger that writes the old and new row, the request''s audit context and the transaction ID to metadata.entity_changes and notifies entity_changed. The consolidated worker''s entity_audit_capture job diffs each change (updates keep only the changed columns, and updates that only touch updated_at are dropped), writes metadata.entity_audit_log and deletes the change in one transaction. Per-table retention lives in metadata.entity_audit_retention and is applied daily by the entity_audit_retention maintenance task. get_entity_audit_log() is limited to real admins.',
+   'A trigger captures exactly the committed changes, with the JWT of the request that made them, without logical replication slots, which need wal_level = logical and a slot that holds WAL while the worker is down. Keeping the trigger to one insert keeps the cost in the user''s transaction small; diffing in the worker keeps the log compact. Recording actor_id, on_behalf_of and impersonated_roles separately, as identity_audit_log does, keeps admin impersonation from being mistaken for the impersonated user.',
+   'History starts when auditing is enabled for a table; earlier changes are not reconstructed. Changes made with triggers disabled (session_replication_role = replica) or by TRUNCATE are not recorded. Values are stored as the row had them, including private columns, so the log is limited to real admins. The log lags commits by the worker''s processing time, and captured changes wait in entity_changes while the worker is down.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
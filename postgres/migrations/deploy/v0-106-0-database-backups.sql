@@ -0,0 +1,192 @@
+-- Deploy civic_os:v0-106-0-database-backups to pg
+-- requires: v0-105-0-entity-audit-log
+--
+-- v0.106.0 — Scheduled database backups:
+--   1. scheduled_jobs gains target_type 'backup' with the schemas to dump
+--      and how many backups to keep
+--   2. trigger_scheduled_job() queues backup targets for the worker
+--   3. Record schema decision
+--
+-- The consolidated worker's db_backup job runs pg_dump, checks the archive
+-- with pg_restore --list, encrypts it (age or GPG), uploads it to the
+-- backups bucket, confirms the upload and deletes the oldest backups beyond
+-- backup_keep. Small deployments run the worker as their only always-on
+-- process, so it is where a backup schedule can live.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. BACKUP TARGET COLUMNS ON scheduled_jobs
+-- ============================================================================
+-- Where the backups go and the encryption keys are worker settings
+-- (BACKUP_S3_BUCKET, BACKUP_AGE_RECIPIENTS, ...), not columns: anyone who
+-- can edit scheduled_jobs could otherwise send the database elsewhere.
+
+ALTER TABLE metadata.scheduled_jobs
+    ADD COLUMN backup_schemas TEXT[],
+    ADD COLUMN backup_keep INT NOT NULL DEFAULT 14;
+
+ALTER TABLE metadata.scheduled_jobs
+    DROP CONSTRAINT scheduled_jobs_valid_target_type,
+    DROP CONSTRAINT scheduled_jobs_target_config;
+
+ALTER TABLE metadata.scheduled_jobs
+    ADD CONSTRAINT scheduled_jobs_valid_target_type CHECK (target_type IN ('sql', 'http', 'backup')),
+    ADD CONSTRAINT scheduled_jobs_target_config CHECK (
+        (target_type = 'sql' AND function_name IS NOT NULL)
+        OR (target_type = 'http' AND http_url ~ '^https?://')
+        OR target_type = 'backup'
+    ),
+    ADD CONSTRAINT scheduled_jobs_backup_keep_range CHECK (backup_keep BETWEEN 1 AND 1000),
+    ADD CONSTRAINT scheduled_jobs_backup_schemas_not_empty CHECK (
+        backup_schemas IS NULL OR cardinality(backup_schemas) > 0
+    );
+
+COMMENT ON COLUMN metadata.scheduled_jobs.target_type IS
+    'What the job runs: ''sql'' calls function_name, ''http'' sends the configured HTTP request, ''backup'' dumps the database to the backups bucket. Added in v0.70.0, backup in v0.106.0.';
+COMMENT ON COLUMN metadata.scheduled_jobs.backup_schemas IS
+    'Schemas a backup target dumps (pg_dump --schema). NULL dumps the whole database. Added in v0.106.0.';
+COMMENT ON COLUMN metadata.scheduled_jobs.backup_keep IS
+    'How many of this job''s backups to keep; older ones are deleted after each successful backup. Added in v0.106.0.';
+
+
+-- ============================================================================
+-- 2. trigger_scheduled_job() QUEUES BACKUP TARGETS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.trigger_scheduled_job(p_job_name VARCHAR(100))
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_job RECORD;
+    v_run_id BIGINT;
+    v_result JSONB;
+    v_start_time TIMESTAMPTZ;
+    v_end_time TIMESTAMPTZ;
+    v_duration_ms INT;
+BEGIN
+    -- Permission check
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can trigger scheduled jobs'
+            USING HINT = 'Contact an administrator to run this job';
+    END IF;
+
+    -- Find the job
+    SELECT * INTO v_job
+    FROM metadata.scheduled_jobs
+    WHERE name = p_job_name;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Scheduled job not found: %', p_job_name;
+    END IF;
+
+    -- HTTP and backup targets can't run inside the database: hand off to the
+    -- worker. The result lands in scheduled_job_runs.
+    IF v_job.target_type IN ('http', 'backup') THEN
+        INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+        VALUES (
+            'available',
+            'scheduled_jobs',
+            CASE v_job.target_type WHEN 'http' THEN 'scheduled_job_http' ELSE 'db_backup' END,
+            jsonb_build_object(
+                'job_id', v_job.id,
+                'job_name', v_job.name,
+                'scheduled_for', NOW(),
+                'triggered_by', 'manual'
+            ),
+            2,
+            3,
+            NOW()
+        );
+
+        RETURN jsonb_build_object(
+            'success', true,
+            'queued', true,
+            'job_name', v_job.name,
+            'message', CASE v_job.target_type
+                WHEN 'http' THEN 'HTTP job queued; see run history for the response'
+                ELSE 'Backup queued; see run history for the result'
+            END
+        );
+    END IF;
+
+    -- Create run record
+    v_start_time := NOW();
+    INSERT INTO metadata.scheduled_job_runs (job_id, started_at, triggered_by)
+    VALUES (v_job.id, v_start_time, 'manual')
+    RETURNING id INTO v_run_id;
+
+    -- Execute the function dynamically
+    BEGIN
+        EXECUTE format('SELECT %I()', v_job.function_name) INTO v_result;
+        v_end_time := NOW();
+        v_duration_ms := EXTRACT(EPOCH FROM (v_end_time - v_start_time)) * 1000;
+
+        -- Update run record with result
+        UPDATE metadata.scheduled_job_runs
+        SET completed_at = v_end_time,
+            duration_ms = v_duration_ms,
+            success = COALESCE((v_result->>'success')::boolean, true),
+            message = v_result->>'message',
+            details = v_result
+        WHERE id = v_run_id;
+
+        -- Update last_run_at on job
+        UPDATE metadata.scheduled_jobs
+        SET last_run_at = v_start_time,
+            updated_at = NOW()
+        WHERE id = v_job.id;
+
+        RETURN jsonb_build_object(
+            'success', true,
+            'run_id', v_run_id,
+            'job_name', v_job.name,
+            'result', v_result,
+            'duration_ms', v_duration_ms
+        );
+
+    EXCEPTION WHEN OTHERS THEN
+        v_end_time := NOW();
+        v_duration_ms := EXTRACT(EPOCH FROM (v_end_time - v_start_time)) * 1000;
+
+        -- Update run record with error
+        UPDATE metadata.scheduled_job_runs
+        SET completed_at = v_end_time,
+            duration_ms = v_duration_ms,
+            success = false,
+            message = SQLERRM
+        WHERE id = v_run_id;
+
+        RETURN jsonb_build_object(
+            'success', false,
+            'run_id', v_run_id,
+            'job_name', v_job.name,
+            'error', SQLERRM,
+            'duration_ms', v_duration_ms
+        );
+    END;
+END;
+$$;
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{scheduled_jobs}',
+   '{target_type,backup_schemas,backup_keep}',
+   'v0-106-0-database-backups',
+   'Scheduled database backups run by the worker',
+   'accepted',
+   'Small deployments run Postgres, PostgREST and the consolidated worker on one VPS with no backup process. A cron container or host crontab is one more thing to set up and monitor, and failures go unnoticed.',
+   'Scheduled jobs gain target_type ''backup''. The scheduler queues db_backup River jobs. The worker runs pg_dump in custom format, checks the archive with pg_restore --list, encrypts it to age recipients or a GPG public key, and uploads it to BACKUP_S3_BUCKET. It then compares the stored object''s size with the local file and deletes the job''s oldest backups beyond backup_keep. Every outcome is a scheduled_job_runs row, with the key, sizes, SHA-256 and deleted keys in details.',
+   'Reusing scheduled jobs gives backups a cron schedule, run history, manual triggering and the consecutive-failure alert that admins already know. pg_dump and pg_restore are the supported tools for logical backups, and the custom format is compressed and restores selectively. Encrypting to public keys means the worker can write backups but not read them, so a leaked bucket or worker environment does not expose the data.',
+   'The worker image now includes postgresql17-client, age and gnupg. pg_dump needs a role that can read every table despite RLS (BACKUP_DATABASE_URL, by default DATABASE_URL). The dump is staged in the worker''s temp directory, which needs room for it twice (plain and encrypted). Rotation only deletes keys written by the same job. Restores are manual: download, decrypt, pg_restore.');
+
+COMMIT;
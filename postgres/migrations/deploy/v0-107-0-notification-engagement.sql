@@ -0,0 +1,196 @@
+-- Deploy civic_os:v0-107-0-notification-engagement to pg
+-- requires: v0-106-0-database-backups
+--
+-- v0.107.0 — Email open and click tracking:
+--   1. notification_templates.track_engagement: per-template opt-in
+--   2. metadata.notification_engagement: opens and clicks recorded by the
+--      worker's tracking endpoint
+--   3. public.get_notification_engagement_stats() and
+--      public.get_notification_link_clicks() for template owners
+--   4. Record schema decision
+--
+-- When a tracked template is rendered for email, the worker rewrites its
+-- HTML links through signed redirect URLs and adds a 1x1 pixel. The tracking
+-- server (TRACKING_PORT, public at TRACKING_BASE_URL) checks the signature,
+-- records the event and redirects or returns the pixel.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. PER-TEMPLATE OPT-IN
+-- ============================================================================
+
+ALTER TABLE metadata.notification_templates
+    ADD COLUMN track_engagement BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN metadata.notification_templates.track_engagement IS
+    'Rewrite the HTML email''s links through the tracking redirect and add an open pixel. Needs TRACKING_BASE_URL and TRACKING_SECRET on the worker; without them emails go out untracked. Text and SMS parts are never rewritten. Added in v0.107.0.';
+
+
+-- ============================================================================
+-- 2. ENGAGEMENT EVENTS
+-- ============================================================================
+-- No IP addresses or user agents: the question is whether a notice was
+-- read, not who read it where. Clicked URLs are stored without their query
+-- string, so tokens in links (password resets) never land here.
+
+CREATE TABLE metadata.notification_engagement (
+    id BIGSERIAL PRIMARY KEY,
+    notification_id BIGINT NOT NULL REFERENCES metadata.notifications(id) ON DELETE CASCADE,
+    template_name VARCHAR(100) NOT NULL,  -- Copied from the notification for per-template stats
+    event_type VARCHAR(10) NOT NULL CHECK (event_type IN ('open', 'click')),
+    url TEXT,                             -- Link target without query or fragment (clicks only)
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT notification_engagement_click_url CHECK ((event_type = 'click') = (url IS NOT NULL))
+);
+
+CREATE INDEX idx_notification_engagement_template
+    ON metadata.notification_engagement(template_name, occurred_at DESC);
+CREATE INDEX idx_notification_engagement_notification
+    ON metadata.notification_engagement(notification_id);
+
+COMMENT ON TABLE metadata.notification_engagement IS
+    'Email opens (tracking pixel loaded) and link clicks, one row per event; repeat opens are kept and counted once per notification in stats. Written by the consolidated worker''s tracking server. Read through get_notification_engagement_stats() and get_notification_link_clicks(). Added in v0.107.0.';
+
+ALTER TABLE metadata.notification_engagement ENABLE ROW LEVEL SECURITY;
+-- No policies: only SECURITY DEFINER functions and the worker read it
+
+
+-- ============================================================================
+-- 3. STATS RPCs
+-- ============================================================================
+-- Opens are a lower bound (clients that block images never load the pixel)
+-- and can be inflated (mail privacy proxies load every image). A click also
+-- counts as an open.
+
+CREATE OR REPLACE FUNCTION public.get_notification_engagement_stats(
+    p_template_name VARCHAR(100) DEFAULT NULL,
+    p_since TIMESTAMPTZ DEFAULT NULL,
+    p_until TIMESTAMPTZ DEFAULT NULL
+)
+RETURNS TABLE (
+    template_name VARCHAR(100),
+    track_engagement BOOLEAN,
+    emails_sent BIGINT,
+    opened BIGINT,
+    clicked BIGINT,
+    open_rate NUMERIC,
+    click_rate NUMERIC,
+    total_opens BIGINT,
+    total_clicks BIGINT,
+    last_engagement_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.has_permission('notification_log', 'read') THEN
+        RAISE EXCEPTION 'Missing notification_log:read permission'
+            USING HINT = 'Contact administrator to grant notification search permissions';
+    END IF;
+
+    RETURN QUERY
+    WITH sent AS (
+        SELECT n.id, n.template_name
+        FROM metadata.notifications n
+        WHERE 'email' = ANY(n.channels_sent)
+          AND (p_template_name IS NULL OR n.template_name = p_template_name)
+          AND n.created_at >= COALESCE(p_since, NOW() - INTERVAL '30 days')
+          AND (p_until IS NULL OR n.created_at < p_until)
+    ),
+    per_notification AS (
+        SELECT s.id, s.template_name,
+               COUNT(e.id) FILTER (WHERE e.event_type = 'open') AS opens,
+               COUNT(e.id) FILTER (WHERE e.event_type = 'click') AS clicks,
+               MAX(e.occurred_at) AS last_at
+        FROM sent s
+        LEFT JOIN metadata.notification_engagement e ON e.notification_id = s.id
+        GROUP BY s.id, s.template_name
+    )
+    SELECT p.template_name,
+           t.track_engagement,
+           COUNT(*),
+           COUNT(*) FILTER (WHERE p.opens > 0 OR p.clicks > 0),
+           COUNT(*) FILTER (WHERE p.clicks > 0),
+           ROUND(COUNT(*) FILTER (WHERE p.opens > 0 OR p.clicks > 0)::NUMERIC / COUNT(*), 4),
+           ROUND(COUNT(*) FILTER (WHERE p.clicks > 0)::NUMERIC / COUNT(*), 4),
+           SUM(p.opens)::BIGINT,
+           SUM(p.clicks)::BIGINT,
+           MAX(p.last_at)
+    FROM per_notification p
+    JOIN metadata.notification_templates t ON t.name = p.template_name
+    GROUP BY p.template_name, t.track_engagement
+    ORDER BY p.template_name;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_notification_engagement_stats IS
+    'Per-template email engagement for notifications created in [p_since, p_until) (default: the last 30 days): emails sent, notifications opened or clicked, rates and event totals. Rates are only meaningful where track_engagement is true. Requires notification_log:read. Added in v0.107.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_notification_engagement_stats FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_notification_engagement_stats TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_notification_link_clicks(
+    p_template_name VARCHAR(100),
+    p_since TIMESTAMPTZ DEFAULT NULL,
+    p_until TIMESTAMPTZ DEFAULT NULL
+)
+RETURNS TABLE (
+    url TEXT,
+    clicks BIGINT,
+    notifications BIGINT,
+    last_clicked_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.has_permission('notification_log', 'read') THEN
+        RAISE EXCEPTION 'Missing notification_log:read permission'
+            USING HINT = 'Contact administrator to grant notification search permissions';
+    END IF;
+
+    RETURN QUERY
+    SELECT e.url, COUNT(*), COUNT(DISTINCT e.notification_id), MAX(e.occurred_at)
+    FROM metadata.notification_engagement e
+    WHERE e.template_name = p_template_name
+      AND e.event_type = 'click'
+      AND e.occurred_at >= COALESCE(p_since, NOW() - INTERVAL '30 days')
+      AND (p_until IS NULL OR e.occurred_at < p_until)
+    GROUP BY e.url
+    ORDER BY COUNT(*) DESC, e.url;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_notification_link_clicks IS
+    'Clicks per link target for one template in [p_since, p_until) (default: the last 30 days), most clicked first. Requires notification_log:read. Added in v0.107.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_notification_link_clicks FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_notification_link_clicks TO authenticated;
+
+NOTIFY pgrst, 'reload schema';
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notification_templates,notification_engagement}',
+   '{track_engagement}',
+   'v0-107-0-notification-engagement',
+   'Opt-in email open and click tracking',
+   'accepted',
+   'Template owners send notices with no way to tell whether anyone reads them. notification_log shows what was sent, not what happened after.',
+   'Templates opt in with track_engagement. For those, the worker rewrites every http(s) link in the rendered HTML to TRACKING_BASE_URL/c/<notification>/<signature>?u=<target> and appends a pixel at TRACKING_BASE_URL/o/<notification>/<signature>.gif. Signatures are HMACs with TRACKING_SECRET over the notification ID (and target URL for clicks). The worker''s tracking server verifies them, records the event in metadata.notification_engagement and redirects or returns the pixel. Stats are computed on read by get_notification_engagement_stats() and get_notification_link_clicks().',
+   'Signing the target URL keeps the redirect from being an open redirect, and signing the notification ID stops anyone from inflating another template''s numbers. Opt-in per template leaves transactional mail (password resets, receipts) untouched unless an owner chooses otherwise. Events carry no IP address or user agent, and clicked URLs are stored without their query string so link tokens are never kept. Raw events plus on-read aggregation keep the worker''s write path to one INSERT and allow any date range.',
+   'The tracking endpoint must be reachable from the internet. The VPS Caddyfile proxies /_/t/* to the worker''s TRACKING_PORT. Rotating TRACKING_SECRET breaks links in emails already sent, which then return 404 instead of redirecting. Open counts are approximate in both directions: image blocking hides opens and privacy proxies add them. Events are deleted with their notification.');
+
+COMMIT;
@@ -0,0 +1,147 @@
+-- Deploy civic_os:v0-108-0-live-entity-preview to pg
+-- requires: v0-107-0-notification-engagement
+--
+-- v0.108.0 — Template previews against a real record:
+--   1. preview_template_parts() gains p_entity_type and p_entity_id; the job
+--      carries the caller's ID and roles instead of sample data
+--   2. Record schema decision
+--
+-- The preview worker reads the row itself, in a read-only transaction as
+-- role authenticated with the caller's claims, so grants and RLS decide
+-- what the preview may show. Private columns (metadata.column_privacy) and
+-- columns the role can't select are left out, and <name>_id foreign keys
+-- are embedded as <name>: {id, display_name} the way notification triggers
+-- usually build entity_data.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. preview_template_parts() WITH A LIVE ENTITY
+-- ============================================================================
+-- New trailing parameters change the signature, so the v0.11.0 function is
+-- dropped. Callers passing named arguments (PostgREST) are unaffected.
+
+DROP FUNCTION IF EXISTS public.preview_template_parts(UUID, TEXT, TEXT, TEXT, TEXT, JSONB);
+
+CREATE OR REPLACE FUNCTION public.preview_template_parts(
+    p_validation_id UUID DEFAULT gen_random_uuid(),
+    p_subject_template TEXT DEFAULT NULL,
+    p_html_template TEXT DEFAULT NULL,
+    p_text_template TEXT DEFAULT NULL,
+    p_sms_template TEXT DEFAULT NULL,
+    p_sample_entity_data JSONB DEFAULT NULL,
+    p_entity_type NAME DEFAULT NULL,
+    p_entity_id TEXT DEFAULT NULL
+)
+RETURNS TABLE(
+    validation_id UUID
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_live BOOLEAN := p_entity_type IS NOT NULL OR p_entity_id IS NOT NULL;
+BEGIN
+    -- Validate that at least one template part was provided
+    IF p_subject_template IS NULL
+        AND p_html_template IS NULL
+        AND p_text_template IS NULL
+        AND p_sms_template IS NULL
+    THEN
+        RAISE EXCEPTION 'At least one template part must be provided for preview';
+    END IF;
+
+    IF v_live THEN
+        IF p_entity_type IS NULL OR p_entity_id IS NULL OR p_entity_id = '' THEN
+            RAISE EXCEPTION 'A live preview needs both p_entity_type and p_entity_id';
+        END IF;
+        IF p_sample_entity_data IS NOT NULL THEN
+            RAISE EXCEPTION 'Pass either p_sample_entity_data or p_entity_type and p_entity_id, not both';
+        END IF;
+        IF to_regclass(format('public.%I', p_entity_type)) IS NULL THEN
+            RAISE EXCEPTION 'Unknown entity type: %', p_entity_type;
+        END IF;
+        -- Row access is checked again by RLS when the worker reads the row
+        IF NOT metadata.has_permission(p_entity_type, 'read') THEN
+            RAISE EXCEPTION 'Permission denied to read %', p_entity_type;
+        END IF;
+    ELSIF p_sample_entity_data IS NULL THEN
+        -- Default sample data if none provided
+        p_sample_entity_data := '{"display_name": "Example Entity", "id": 1}'::jsonb;
+    END IF;
+
+    -- Insert validation request (reuse same table)
+    INSERT INTO metadata.template_validation_results (
+        id,
+        subject_template,
+        html_template,
+        text_template,
+        sms_template,
+        status
+    )
+    VALUES (
+        p_validation_id,
+        p_subject_template,
+        p_html_template,
+        p_text_template,
+        p_sms_template,
+        'pending'
+    );
+
+    -- Enqueue high-priority preview job. A live preview carries who asked
+    -- (the worker has no JWT) instead of data.
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'preview_template_parts',
+        jsonb_build_object(
+            'validation_id', p_validation_id::text,
+            'subject_template', p_subject_template,
+            'html_template', p_html_template,
+            'text_template', p_text_template,
+            'sms_template', p_sms_template,
+            'sample_entity_data', p_sample_entity_data
+        ) || CASE WHEN v_live THEN jsonb_build_object(
+            'entity_type', p_entity_type,
+            'entity_id', p_entity_id,
+            'user_id', public.current_user_id()::text,
+            'roles', to_jsonb(metadata.get_user_roles())
+        ) ELSE '{}'::jsonb END,
+        'notifications',
+        4,  -- HIGH PRIORITY (4 = highest)
+        3,
+        NOW(),
+        'available'
+    );
+
+    -- Return validation_id immediately (non-blocking)
+    RETURN QUERY SELECT p_validation_id;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION public.preview_template_parts TO authenticated;
+
+COMMENT ON FUNCTION public.preview_template_parts IS
+    'Enqueues a preview job and returns validation_id immediately. Renders against p_sample_entity_data, or against the live row p_entity_type/p_entity_id read with the caller''s permissions (v0.108.0). Use get_preview_results() to poll for results.';
+
+
+-- ============================================================================
+-- 2. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{template_validation_results}',
+   NULL,
+   'v0-108-0-live-entity-preview',
+   'Template previews against a real record',
+   'accepted',
+   'Template previews only render hand-written sample JSON, so admins find out about missing fields, odd values and formatting problems when the first real notification goes out.',
+   'preview_template_parts() accepts p_entity_type and p_entity_id instead of sample data and records the caller''s user ID and roles in the job. The worker reads the row in a read-only transaction as role authenticated with those claims. It selects only columns that authenticated may read and that are not in metadata.column_privacy, and embeds <name>_id foreign keys to tables with a display_name as <name>: {id, display_name}. A row that is missing or hidden by RLS becomes an error on each previewed part.',
+   'Reading as the caller means a preview can never show more than the caller could already see through the API. Excluding private columns matches exports: templates should not be tested against data that the column privacy settings keep out of files and emails. The embedding follows the convention in the notification trigger examples, so most templates render the way they will in production.',
+   'Entity data built by a custom trigger (computed values, other embedded shapes) can differ from the live row. The preview then shows blanks where the trigger would add values. The preview RPC''s signature changed; positional callers must add the two new arguments or switch to named ones.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
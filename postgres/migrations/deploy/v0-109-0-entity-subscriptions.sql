@@ -0,0 +1,378 @@
+-- Deploy civic_os:v0-109-0-entity-subscriptions to pg
+-- requires: v0-108-0-live-entity-preview
+--
+-- v0.109.0 — Per-entity notification subscriptions ("watch this issue"):
+--   1. metadata.entity_subscriptions: a user follows one record, or every
+--      record of a table matching list filters
+--   2. entity_subscription_update notification template
+--   3. metadata.queue_entity_subscription_fanout() trigger function and
+--      enable_entity_subscriptions() / disable_entity_subscriptions()
+--   4. RPCs: subscribe_to_entity(), unsubscribe_from_entity(),
+--      get_my_entity_subscriptions()
+--   5. Record schema decision
+--
+-- Until now every "tell me when this changes" feature needed its own
+-- trigger calling create_notification(). The fan-out trigger only queues a
+-- fan_out_notification job when some subscription could match; the
+-- consolidated worker then reads the row as each subscriber (so RLS and
+-- column privacy apply), checks their filters and creates one notification
+-- per subscriber, which queues send_notification as usual.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SUBSCRIPTIONS
+-- ============================================================================
+
+CREATE TABLE metadata.entity_subscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES metadata.civic_os_users(id) ON DELETE CASCADE,
+    entity_type NAME NOT NULL,
+    entity_id TEXT,                      -- NULL: every row matching filters
+    filters JSONB NOT NULL DEFAULT '[]'::JSONB
+        CHECK (jsonb_typeof(filters) = 'array'),
+    events TEXT[] NOT NULL DEFAULT '{update,delete}',
+    channels TEXT[] NOT NULL DEFAULT '{email}',
+    template_name VARCHAR(100) NOT NULL DEFAULT 'entity_subscription_update'
+        REFERENCES metadata.notification_templates(name),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT entity_subscriptions_valid_events CHECK (
+        events <@ ARRAY['insert', 'update', 'delete'] AND cardinality(events) > 0
+    ),
+    CONSTRAINT entity_subscriptions_valid_channels CHECK (
+        channels <@ ARRAY['email', 'sms'] AND cardinality(channels) > 0
+    )
+);
+
+-- One watch per user and record; filtered subscriptions can repeat
+CREATE UNIQUE INDEX idx_entity_subscriptions_watch
+    ON metadata.entity_subscriptions(user_id, entity_type, entity_id)
+    WHERE entity_id IS NOT NULL;
+CREATE INDEX idx_entity_subscriptions_entity
+    ON metadata.entity_subscriptions(entity_type, entity_id);
+
+COMMENT ON TABLE metadata.entity_subscriptions IS
+    'Users following changes to entity rows. The table needs the entity_subscription_fanout trigger (enable_entity_subscriptions). Managed with subscribe_to_entity() and unsubscribe_from_entity(). Added in v0.109.0.';
+COMMENT ON COLUMN metadata.entity_subscriptions.filters IS
+    'Conditions on the row as [{column, operator, value}], operators as in PostgREST: eq, neq, gt, gte, lt, lte, like, ilike, is, in. Checked by the worker against the row as the subscriber can read it; all must match.';
+COMMENT ON COLUMN metadata.entity_subscriptions.events IS
+    'Which changes notify: insert, update, delete. Deletes only notify subscriptions to a single record (entity_id set).';
+
+-- Subscribers see their own subscriptions; rows are written by the RPCs
+ALTER TABLE metadata.entity_subscriptions ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY entity_subscriptions_select ON metadata.entity_subscriptions
+    FOR SELECT TO authenticated
+    USING (user_id = public.current_user_id() OR public.is_admin());
+
+GRANT SELECT ON metadata.entity_subscriptions TO authenticated;
+
+
+-- ============================================================================
+-- 2. NOTIFICATION TEMPLATE
+-- ============================================================================
+
+INSERT INTO metadata.notification_templates (
+    name,
+    description,
+    entity_type,
+    subject_template,
+    html_template,
+    text_template,
+    sms_template
+) VALUES (
+    'entity_subscription_update',
+    'Default template for entity subscriptions. Template variables: Entity.event (insert, update or delete), Entity.entity_type, Entity.entity_label, Entity.entity_id, Entity.display_name, Entity.changed_columns, Entity.changed_labels, Entity.record (the row as the subscriber can read it), Entity.previous (changed columns before an update); Metadata.site_url, Metadata.site_name.',
+    NULL,
+    -- Subject
+    '[{{.Metadata.site_name}}] {{.Entity.entity_label}} {{if .Entity.display_name}}"{{.Entity.display_name}}"{{else}}#{{.Entity.entity_id}}{{end}} {{if eq .Entity.event "insert"}}was created{{else if eq .Entity.event "delete"}}was deleted{{else}}was updated{{end}}',
+    -- HTML Template
+    '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        <h2>{{.Entity.entity_label}} {{if eq .Entity.event "insert"}}created{{else if eq .Entity.event "delete"}}deleted{{else}}updated{{end}}</h2>
+        <p><strong>{{if .Entity.display_name}}{{.Entity.display_name}}{{else}}#{{.Entity.entity_id}}{{end}}</strong></p>
+        {{if .Entity.changed_labels}}<p>Changed: {{.Entity.changed_labels}}</p>{{end}}
+        {{if ne .Entity.event "delete"}}<p style="margin: 24px 0;"><a href="{{.Metadata.site_url}}/view/{{.Entity.entity_type}}/{{.Entity.entity_id}}" style="background: #2563eb; color: #ffffff; padding: 10px 18px; border-radius: 6px; text-decoration: none;">View {{.Entity.entity_label}}</a></p>{{end}}
+        <p style="color: #6b7280; font-size: 14px;">You are receiving this because you follow this {{if eq .Entity.event "insert"}}list{{else}}record{{end}}. Unfollow it in {{.Metadata.site_name}} to stop these emails.</p>
+    </div>',
+    -- Text Template
+    '{{.Entity.entity_label}} {{if eq .Entity.event "insert"}}created{{else if eq .Entity.event "delete"}}deleted{{else}}updated{{end}}: {{if .Entity.display_name}}{{.Entity.display_name}}{{else}}#{{.Entity.entity_id}}{{end}}
+{{if .Entity.changed_labels}}
+Changed: {{.Entity.changed_labels}}
+{{end}}{{if ne .Entity.event "delete"}}
+{{.Metadata.site_url}}/view/{{.Entity.entity_type}}/{{.Entity.entity_id}}
+{{end}}
+You are receiving this because you follow this {{if eq .Entity.event "insert"}}list{{else}}record{{end}}.',
+    -- SMS Template
+    '{{.Entity.entity_label}} {{if .Entity.display_name}}"{{.Entity.display_name}}"{{else}}#{{.Entity.entity_id}}{{end}} {{if eq .Entity.event "insert"}}created{{else if eq .Entity.event "delete"}}deleted{{else}}updated{{end}}{{if ne .Entity.event "delete"}}: {{.Metadata.site_url}}/view/{{.Entity.entity_type}}/{{.Entity.entity_id}}{{end}}'
+)
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    entity_type = EXCLUDED.entity_type,
+    subject_template = EXCLUDED.subject_template,
+    html_template = EXCLUDED.html_template,
+    text_template = EXCLUDED.text_template,
+    sms_template = EXCLUDED.sms_template;
+
+
+-- ============================================================================
+-- 3. FAN-OUT TRIGGER
+-- ============================================================================
+-- Runs in the writer's transaction, so it only checks whether a
+-- subscription could match and queues one job with the row snapshots.
+-- Filters, RLS and column privacy are the worker's job.
+
+CREATE OR REPLACE FUNCTION metadata.queue_entity_subscription_fanout()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_event TEXT := lower(TG_OP);
+    v_old JSONB;
+    v_new JSONB;
+    v_entity_id TEXT;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        v_old := to_jsonb(OLD);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        v_new := to_jsonb(NEW);
+    END IF;
+    IF TG_OP = 'UPDATE' AND v_old = v_new THEN
+        RETURN NULL;
+    END IF;
+    v_entity_id := COALESCE(v_new, v_old)->>'id';
+
+    IF NOT EXISTS (
+        SELECT 1 FROM metadata.entity_subscriptions
+        WHERE entity_type = TG_TABLE_NAME
+          AND v_event = ANY(events)
+          AND (entity_id IS NULL OR entity_id = v_entity_id)
+    ) THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+    VALUES (
+        'available',
+        'notifications',
+        'fan_out_notification',
+        jsonb_build_object(
+            'entity_type', TG_TABLE_NAME,
+            'entity_id', v_entity_id,
+            'event', v_event,
+            'old_row', v_old,
+            'new_row', v_new,
+            'actor_id', public.current_user_id()
+        ),
+        2,
+        5,
+        NOW()
+    );
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.queue_entity_subscription_fanout() IS
+    'AFTER INSERT/UPDATE/DELETE row trigger: queues a fan_out_notification job when a subscription in entity_subscriptions could match the change. Attach with enable_entity_subscriptions(). Added in v0.109.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.enable_entity_subscriptions(p_table_name NAME)
+RETURNS VOID
+LANGUAGE plpgsql
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF to_regclass(format('public.%I', p_table_name)) IS NULL THEN
+        RAISE EXCEPTION 'Table public.% does not exist', p_table_name;
+    END IF;
+
+    EXECUTE format('DROP TRIGGER IF EXISTS entity_subscription_fanout ON public.%I', p_table_name);
+    EXECUTE format(
+        'CREATE TRIGGER entity_subscription_fanout AFTER INSERT OR UPDATE OR DELETE ON public.%I '
+        'FOR EACH ROW EXECUTE FUNCTION metadata.queue_entity_subscription_fanout()',
+        p_table_name);
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.enable_entity_subscriptions(NAME) IS
+    'Lets users subscribe to rows of public.<table> (entity_subscription_fanout trigger). The table needs an id column. Safe to run again. Added in v0.109.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.disable_entity_subscriptions(p_table_name NAME)
+RETURNS VOID
+LANGUAGE plpgsql
+SET search_path = metadata, public
+AS $$
+BEGIN
+    EXECUTE format('DROP TRIGGER IF EXISTS entity_subscription_fanout ON public.%I', p_table_name);
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.disable_entity_subscriptions(NAME) IS
+    'Stops subscription notifications for public.<table>. Existing subscriptions are kept and resume when re-enabled. Added in v0.109.0.';
+
+
+-- ============================================================================
+-- 4. RPCs
+-- ============================================================================
+-- Filter columns are checked here so a typo fails when subscribing rather
+-- than silently never matching.
+
+CREATE OR REPLACE FUNCTION public.subscribe_to_entity(
+    p_entity_type NAME,
+    p_entity_id TEXT DEFAULT NULL,
+    p_filters JSONB DEFAULT '[]'::JSONB,
+    p_events TEXT[] DEFAULT NULL,
+    p_channels TEXT[] DEFAULT '{email}'
+)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_user_id UUID := public.current_user_id();
+    v_filters JSONB := COALESCE(p_filters, '[]'::JSONB);
+    v_filter JSONB;
+    v_events TEXT[];
+    v_subscription_id BIGINT;
+BEGIN
+    IF v_user_id IS NULL THEN
+        RETURN json_build_object('success', false, 'error', 'Authentication required');
+    END IF;
+
+    IF to_regclass(format('public.%I', p_entity_type)) IS NULL THEN
+        RETURN json_build_object('success', false, 'error', format('Unknown entity type: %s', p_entity_type));
+    END IF;
+
+    IF NOT metadata.has_permission(p_entity_type, 'read') THEN
+        RETURN json_build_object('success', false, 'error', 'Permission denied');
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_trigger
+        WHERE tgrelid = to_regclass(format('public.%I', p_entity_type))
+          AND tgname = 'entity_subscription_fanout'
+    ) THEN
+        RETURN json_build_object('success', false, 'error',
+            format('Subscriptions are not enabled for %s', p_entity_type));
+    END IF;
+
+    IF jsonb_typeof(v_filters) <> 'array' THEN
+        RETURN json_build_object('success', false, 'error', 'Filters must be an array');
+    END IF;
+    FOR v_filter IN SELECT * FROM jsonb_array_elements(v_filters) LOOP
+        IF NOT COALESCE(v_filter->>'operator' IN ('eq', 'neq', 'gt', 'gte', 'lt', 'lte', 'like', 'ilike', 'is', 'in'), FALSE) THEN
+            RETURN json_build_object('success', false, 'error',
+                format('Unsupported filter operator: %s', v_filter->>'operator'));
+        END IF;
+        IF NOT EXISTS (
+            SELECT 1 FROM pg_attribute
+            WHERE attrelid = to_regclass(format('public.%I', p_entity_type))
+              AND attname = v_filter->>'column'
+              AND attnum > 0 AND NOT attisdropped
+        ) OR metadata.is_column_private(p_entity_type, v_filter->>'column') THEN
+            RETURN json_build_object('success', false, 'error',
+                format('Unknown filter column: %s', v_filter->>'column'));
+        END IF;
+    END LOOP;
+
+    -- A record is watched for changes; a list for new rows and changes
+    v_events := COALESCE(NULLIF(p_events, '{}'),
+        CASE WHEN p_entity_id IS NULL THEN '{insert,update}'::TEXT[] ELSE '{update,delete}'::TEXT[] END);
+    IF NOT v_events <@ ARRAY['insert', 'update', 'delete'] THEN
+        RETURN json_build_object('success', false, 'error', 'Events must be insert, update or delete');
+    END IF;
+    IF p_channels IS NULL OR cardinality(p_channels) = 0 OR NOT p_channels <@ ARRAY['email', 'sms'] THEN
+        RETURN json_build_object('success', false, 'error', 'Channels must be email and/or sms');
+    END IF;
+
+    INSERT INTO metadata.entity_subscriptions (user_id, entity_type, entity_id, filters, events, channels)
+    VALUES (v_user_id, p_entity_type, NULLIF(p_entity_id, ''), v_filters, v_events, p_channels)
+    ON CONFLICT (user_id, entity_type, entity_id) WHERE entity_id IS NOT NULL
+    DO UPDATE SET filters = EXCLUDED.filters, events = EXCLUDED.events, channels = EXCLUDED.channels
+    RETURNING id INTO v_subscription_id;
+
+    RETURN json_build_object('success', true, 'subscription_id', v_subscription_id);
+END;
+$$;
+
+COMMENT ON FUNCTION public.subscribe_to_entity(NAME, TEXT, JSONB, TEXT[], TEXT[]) IS
+    'Follows one record (p_entity_id) or every row of p_entity_type matching p_filters. Events default to update and delete for a record, insert and update for a list. Subscribing to the same record again updates the subscription. Requires read permission on the table. Added in v0.109.0.';
+
+REVOKE EXECUTE ON FUNCTION public.subscribe_to_entity(NAME, TEXT, JSONB, TEXT[], TEXT[]) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.subscribe_to_entity(NAME, TEXT, JSONB, TEXT[], TEXT[]) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.unsubscribe_from_entity(p_subscription_id BIGINT)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    DELETE FROM metadata.entity_subscriptions
+    WHERE id = p_subscription_id AND user_id = public.current_user_id();
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('success', false, 'error', 'Subscription not found');
+    END IF;
+    RETURN json_build_object('success', true);
+END;
+$$;
+
+COMMENT ON FUNCTION public.unsubscribe_from_entity(BIGINT) IS
+    'Deletes one of the caller''s entity subscriptions. Added in v0.109.0.';
+
+REVOKE EXECUTE ON FUNCTION public.unsubscribe_from_entity(BIGINT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.unsubscribe_from_entity(BIGINT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_my_entity_subscriptions(
+    p_entity_type NAME DEFAULT NULL,
+    p_entity_id TEXT DEFAULT NULL
+)
+RETURNS SETOF metadata.entity_subscriptions
+LANGUAGE sql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+    SELECT * FROM metadata.entity_subscriptions s
+    WHERE s.user_id = public.current_user_id()
+      AND (p_entity_type IS NULL OR s.entity_type = p_entity_type)
+      AND (p_entity_id IS NULL OR s.entity_id = p_entity_id)
+    ORDER BY s.created_at DESC;
+$$;
+
+COMMENT ON FUNCTION public.get_my_entity_subscriptions(NAME, TEXT) IS
+    'The caller''s entity subscriptions, newest first, optionally for one table or record (e.g. to show a Watching state on a detail page). Added in v0.109.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_my_entity_subscriptions(NAME, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_my_entity_subscriptions(NAME, TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{entity_subscriptions}',
+   NULL,
+   'v0-109-0-entity-subscriptions',
+   'Per-entity notification subscriptions',
+   'accepted',
+   'Residents and staff want to follow a record ("watch this issue") or a slice of a list (new permits in my district). Each such feature needed a hand-written trigger per table that decided who to notify and called create_notification().',
+   'Users subscribe with subscribe_to_entity() to one record or to a table with PostgREST-style filters; subscriptions live in metadata.entity_subscriptions. Integrators run metadata.enable_entity_subscriptions(table) to attach queue_entity_subscription_fanout(), which queues a fan_out_notification job with the old and new row when any subscription could match. The worker reads the row as each subscriber (role authenticated with their ID and roles), drops subscribers who can''t see it or whose filters don''t match, skips the user who made the change and inserts one metadata.notifications row per remaining subscriber, which queues send_notification. Subscriptions default to the entity_subscription_update template.',
+   'Checking in the worker as the subscriber means a subscription can never reveal a row or column the subscriber couldn''t read through the API, even after their roles change. Keeping the trigger to an EXISTS check and one job insert keeps writes cheap when nobody is subscribed. Creating notifications rather than send_notification jobs directly keeps delivery, preferences, notification_log and engagement tracking the same as every other notification.',
+   'Notifications show the row as it is when the worker runs, not the snapshot that triggered them; several quick edits can produce several notifications with the same content. Deletes only reach subscribers to that record, since the row can''t be re-read, and carry the old row minus private columns. Updates that only touch updated_at or private columns notify nobody. A bulk update queues one job per row.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,319 @@
+-- Deploy civic_os:v0-110-0-notification-broadcasts to pg
+-- requires: v0-109-0-entity-subscriptions
+--
+-- v0.110.0 — Notification broadcasts to roles or lists of users:
+--   1. metadata.notification_broadcasts: one row per broadcast with its
+--      recipient filter, progress cursor and summary counts
+--   2. metadata.notifications.broadcast_id links each notification to its
+--      broadcast
+--   3. Permissions: notification_broadcasts:create and :read (admin)
+--   4. notification_broadcast_summary template, sent to the requester
+--   5. public.request_notification_broadcast(): validates the request,
+--      records the broadcast and queues a broadcast_notification job
+--   6. public.get_notification_broadcasts() status RPC
+--   7. Record schema decision
+--
+-- The broadcast_notification job (consolidated worker, notifications queue)
+-- resolves recipients in batches of BROADCAST_BATCH_SIZE, ordered by user ID
+-- so a retried job resumes after the last batch it recorded. Users whose
+-- preferences leave none of the broadcast's channels are counted as skipped.
+-- The others get a regular notification, and their send_notification jobs are
+-- scheduled BROADCAST_RATE_PER_MINUTE apart across all broadcasts, so an
+-- announcement to every resident doesn't exceed the SMTP or SMS provider's
+-- rate limits. When delivery has settled the job totals sent and failed
+-- notifications and sends the requester notification_broadcast_summary.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. BROADCASTS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.notification_broadcasts (
+    id BIGSERIAL PRIMARY KEY,
+    template_name VARCHAR(100) NOT NULL REFERENCES metadata.notification_templates(name),
+    entity_data JSONB NOT NULL DEFAULT '{}',
+    channels TEXT[] NOT NULL DEFAULT '{email}',
+
+    -- Recipients: users holding any of role_keys, listed in user_ids, or
+    -- everyone when all_users. A user matching more than once gets one copy.
+    role_keys TEXT[] NOT NULL DEFAULT '{}',
+    user_ids UUID[] NOT NULL DEFAULT '{}',
+    all_users BOOLEAN NOT NULL DEFAULT false,
+
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'sending', 'delivering', 'completed', 'failed')),
+
+    -- Highest user ID already handled; batches resume after it
+    last_user_id UUID,
+    -- When the last send_notification job of this broadcast is scheduled
+    scheduled_until TIMESTAMPTZ,
+
+    recipients INT NOT NULL DEFAULT 0,
+    queued INT NOT NULL DEFAULT 0,
+    skipped INT NOT NULL DEFAULT 0,
+    sent INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+
+    requested_by UUID,
+    river_job_id BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+
+    CONSTRAINT notification_broadcasts_recipients CHECK (
+        all_users OR cardinality(role_keys) > 0 OR cardinality(user_ids) > 0
+    ),
+    CONSTRAINT notification_broadcasts_channels CHECK (
+        channels <> '{}' AND channels <@ ARRAY['email', 'sms']::TEXT[]
+    )
+);
+
+CREATE INDEX idx_notification_broadcasts_created
+    ON metadata.notification_broadcasts(created_at DESC);
+
+-- Workers look up the send schedule of broadcasts still queuing or delivering
+CREATE INDEX idx_notification_broadcasts_active
+    ON metadata.notification_broadcasts(scheduled_until)
+    WHERE status IN ('sending', 'delivering');
+
+COMMENT ON TABLE metadata.notification_broadcasts IS
+    'One notification sent to every user in a set of roles, a list of users, or all users, requested through request_notification_broadcast() and processed by the broadcast_notification job. Added in v0.110.0.';
+COMMENT ON COLUMN metadata.notification_broadcasts.status IS
+    'pending: queued, no recipient resolved yet. sending: notifications being created in batches. delivering: every recipient handled, send jobs still running. completed: sent and failed counts are final. failed: the broadcast stopped with error_message.';
+COMMENT ON COLUMN metadata.notification_broadcasts.skipped IS
+    'Recipients with none of the broadcast''s channels enabled in their notification preferences (or no email address / phone number). No notification is created for them.';
+COMMENT ON COLUMN metadata.notification_broadcasts.scheduled_until IS
+    'Scheduled time of the broadcast''s last send job. New broadcasts queue behind the latest one so BROADCAST_RATE_PER_MINUTE holds across all broadcasts.';
+
+ALTER TABLE metadata.notification_broadcasts ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY notification_broadcasts_select ON metadata.notification_broadcasts
+    FOR SELECT TO authenticated
+    USING (metadata.has_permission('notification_broadcasts', 'read'));
+
+GRANT SELECT ON metadata.notification_broadcasts TO authenticated;
+
+
+-- ============================================================================
+-- 2. NOTIFICATIONS.BROADCAST_ID
+-- ============================================================================
+
+ALTER TABLE metadata.notifications
+    ADD COLUMN broadcast_id BIGINT REFERENCES metadata.notification_broadcasts(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_notifications_broadcast
+    ON metadata.notifications(broadcast_id, status)
+    WHERE broadcast_id IS NOT NULL;
+
+COMMENT ON COLUMN metadata.notifications.broadcast_id IS
+    'Broadcast this notification was created for, if any. Added in v0.110.0.';
+
+
+-- ============================================================================
+-- 3. PERMISSIONS
+-- ============================================================================
+
+INSERT INTO metadata.permissions (table_name, permission)
+VALUES
+    ('notification_broadcasts', 'create'),  -- Send a broadcast
+    ('notification_broadcasts', 'read')      -- See broadcasts and their counts
+ON CONFLICT (table_name, permission) DO NOTHING;
+
+INSERT INTO metadata.permission_roles (role_id, permission_id)
+SELECT r.id, p.id
+FROM metadata.roles r
+CROSS JOIN metadata.permissions p
+WHERE r.display_name = 'admin'
+  AND p.table_name = 'notification_broadcasts'
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+
+
+-- ============================================================================
+-- 4. NOTIFICATION TEMPLATE
+-- ============================================================================
+
+INSERT INTO metadata.notification_templates (
+    name,
+    description,
+    entity_type,
+    subject_template,
+    html_template,
+    text_template
+) VALUES (
+    'notification_broadcast_summary',
+    'Sent to the requester when a notification broadcast finishes. Template variables: Entity.broadcast_id, Entity.template_name, Entity.status, Entity.error_message, Entity.recipients, Entity.skipped, Entity.sent, Entity.failed; Metadata.site_url, Metadata.site_name.',
+    'notification_broadcasts',
+    -- Subject
+    '[{{.Metadata.site_name}}] Broadcast {{if eq .Entity.status "failed"}}failed{{else}}finished{{end}}: {{.Entity.template_name}}',
+    -- HTML Template
+    '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        <h2>Broadcast {{if eq .Entity.status "failed"}}failed{{else}}finished{{end}}</h2>
+        <p>Your <strong>{{.Entity.template_name}}</strong> broadcast has {{if eq .Entity.status "failed"}}stopped.{{else}}been delivered.{{end}}</p>
+        {{if .Entity.error_message}}<p style="color: #dc2626;">{{.Entity.error_message}}</p>{{end}}
+        <table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Recipients:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.recipients}}</td></tr>
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Sent:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.sent}}</td></tr>
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Skipped (preferences):</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.skipped}}</td></tr>
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Failed:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.failed}}</td></tr>
+        </table>
+        <p><a href="{{.Metadata.site_url}}/admin/notifications">{{.Metadata.site_url}}/admin/notifications</a></p>
+    </div>',
+    -- Text Template
+    'Broadcast {{if eq .Entity.status "failed"}}failed{{else}}finished{{end}}: {{.Entity.template_name}}
+{{if .Entity.error_message}}
+{{.Entity.error_message}}
+{{end}}
+Recipients: {{.Entity.recipients}}
+Sent: {{.Entity.sent}}
+Skipped (preferences): {{.Entity.skipped}}
+Failed: {{.Entity.failed}}
+
+{{.Metadata.site_url}}/admin/notifications'
+)
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    entity_type = EXCLUDED.entity_type,
+    subject_template = EXCLUDED.subject_template,
+    html_template = EXCLUDED.html_template,
+    text_template = EXCLUDED.text_template;
+
+
+-- ============================================================================
+-- 5. REQUEST RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.request_notification_broadcast(
+    p_template_name VARCHAR,
+    p_role_keys TEXT[] DEFAULT '{}',
+    p_user_ids UUID[] DEFAULT '{}',
+    p_all_users BOOLEAN DEFAULT false,
+    p_entity_data JSONB DEFAULT '{}',
+    p_channels TEXT[] DEFAULT ARRAY['email']
+)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_role_keys TEXT[] := COALESCE(p_role_keys, '{}');
+    v_user_ids UUID[] := COALESCE(p_user_ids, '{}');
+    v_all_users BOOLEAN := COALESCE(p_all_users, false);
+    v_channels TEXT[] := COALESCE(p_channels, ARRAY['email']);
+    v_unknown TEXT;
+    v_broadcast_id BIGINT;
+    v_job_id BIGINT;
+BEGIN
+    IF NOT metadata.has_permission('notification_broadcasts', 'create') THEN
+        RETURN json_build_object('success', false, 'error', 'Permission denied');
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM metadata.notification_templates WHERE name = p_template_name) THEN
+        RETURN json_build_object('success', false, 'error', format('Template "%s" does not exist', p_template_name));
+    END IF;
+
+    IF NOT v_all_users AND cardinality(v_role_keys) = 0 AND cardinality(v_user_ids) = 0 THEN
+        RETURN json_build_object('success', false, 'error', 'Choose roles, users or all users');
+    END IF;
+
+    IF cardinality(v_channels) = 0 OR NOT v_channels <@ ARRAY['email', 'sms'] THEN
+        RETURN json_build_object('success', false, 'error', 'Channels must be email and/or sms');
+    END IF;
+
+    SELECT k INTO v_unknown
+    FROM unnest(v_role_keys) AS k
+    WHERE NOT EXISTS (SELECT 1 FROM metadata.roles r WHERE r.role_key = k)
+    LIMIT 1;
+    IF v_unknown IS NOT NULL THEN
+        RETURN json_build_object('success', false, 'error', format('Role "%s" does not exist', v_unknown));
+    END IF;
+
+    IF p_entity_data IS NOT NULL AND jsonb_typeof(p_entity_data) <> 'object' THEN
+        RETURN json_build_object('success', false, 'error', 'Entity data must be a JSON object');
+    END IF;
+
+    INSERT INTO metadata.notification_broadcasts (
+        template_name, entity_data, channels, role_keys, user_ids, all_users, requested_by
+    ) VALUES (
+        p_template_name, COALESCE(p_entity_data, '{}'), v_channels, v_role_keys, v_user_ids, v_all_users,
+        current_user_id()
+    )
+    RETURNING id INTO v_broadcast_id;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'broadcast_notification',
+        jsonb_build_object('broadcast_id', v_broadcast_id),
+        'notifications',
+        3,
+        5,
+        NOW(),
+        'available'
+    )
+    RETURNING id INTO v_job_id;
+
+    UPDATE metadata.notification_broadcasts SET river_job_id = v_job_id WHERE id = v_broadcast_id;
+
+    RETURN json_build_object('success', true, 'broadcast_id', v_broadcast_id);
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_notification_broadcast(VARCHAR, TEXT[], UUID[], BOOLEAN, JSONB, TEXT[]) IS
+    'Queues a broadcast_notification job sending p_template_name to users holding any of p_role_keys, listed in p_user_ids, or everyone when p_all_users; p_entity_data is the template''s .Entity. Requires notification_broadcasts create permission. Added in v0.110.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_notification_broadcast(VARCHAR, TEXT[], UUID[], BOOLEAN, JSONB, TEXT[]) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_notification_broadcast(VARCHAR, TEXT[], UUID[], BOOLEAN, JSONB, TEXT[]) TO authenticated;
+
+
+-- ============================================================================
+-- 6. STATUS RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_notification_broadcasts(p_limit INT DEFAULT 20)
+RETURNS SETOF metadata.notification_broadcasts
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.has_permission('notification_broadcasts', 'read') THEN
+        RAISE EXCEPTION 'Permission denied';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.notification_broadcasts b
+    ORDER BY b.created_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 200);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_notification_broadcasts(INT) IS
+    'Recent notification broadcasts with their progress and counts, newest first. Requires notification_broadcasts read permission. Added in v0.110.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_notification_broadcasts(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_notification_broadcasts(INT) TO authenticated;
+
+
+-- ============================================================================
+-- 7. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notification_broadcasts,notifications}',
+   '{broadcast_id}',
+   'v0-110-0-notification-broadcasts',
+   'Server-side notification broadcasts with a global send rate',
+   'accepted',
+   'City-wide announcements (boil-water notices, office closures) had to be sent with external mailing tools, or by calling send_notification_to_role(), which creates every notification in one transaction and lets the listener queue every send job at once. Thousands of simultaneous sends trip SMTP and SMS provider rate limits, and nothing records how many people were reached.',
+   'request_notification_broadcast() records a metadata.notification_broadcasts row and queues a broadcast_notification job. The job resolves recipients in batches ordered by user ID (one row per user however many roles match), skips users whose preferences leave none of the requested channels, and creates regular notifications with broadcast_id set. In the same transaction it inserts their send_notification jobs, scheduled BROADCAST_RATE_PER_MINUTE apart after the latest scheduled send of any active broadcast; an advisory lock serialises that reservation. Once every recipient is handled the job snoozes until the sends have settled, totals sent and failed notifications and sends notification_broadcast_summary to the requester.',
+   'Batches and a cursor keep each transaction small and let a retried job resume without duplicates. Scheduling the send jobs up front, rather than throttling in the send worker, leaves individual notifications unaffected by a broadcast in progress. The listener''s own send job for each notification is skipped as a duplicate because send_notification jobs are unique by notification ID while scheduled.',
+   'Sent and failed counts are taken when the last scheduled send is done and nothing is pending, or an hour later at most; a notification that succeeds on a later retry is not counted afterwards. A broadcast to all users reaches users created while it is running only if their IDs sort after the cursor. Skipped users get no notification row, so they do not appear in notification search.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,69 @@
+-- Deploy civic_os:v0-111-0-file-placeholders to pg
+-- requires: v0-110-0-notification-broadcasts
+--
+-- v0.111.0 — Instant placeholders for file thumbnails:
+--   1. metadata.files.blurhash and placeholder_color, written by the
+--      thumbnail worker alongside the thumbnails
+--   2. public.files exposes both columns
+--   3. Record schema decision
+--
+-- Existing files have NULL placeholders; public.queue_thumbnail_backfill()
+-- fills them in without regenerating thumbnails that are already current.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. PLACEHOLDER COLUMNS
+-- ============================================================================
+
+ALTER TABLE metadata.files
+    ADD COLUMN blurhash TEXT,
+    ADD COLUMN placeholder_color VARCHAR(7)
+        CONSTRAINT files_placeholder_color_format CHECK (placeholder_color ~ '^#[0-9a-f]{6}$');
+
+COMMENT ON COLUMN metadata.files.blurhash IS
+    'BlurHash (https://blurha.sh) of the image or PDF first page, about 30 characters. Decoded by the frontend into a blurred preview shown until the thumbnail loads. Written by the thumbnail worker; NULL until thumbnails are processed or for files that could not be decoded. Added in v0.111.0.';
+
+COMMENT ON COLUMN metadata.files.placeholder_color IS
+    'Average colour of the image or PDF first page as #rrggbb, for use as a background colour where decoding a blurhash is not worth it. Added in v0.111.0.';
+
+
+-- ============================================================================
+-- 2. PUBLIC VIEW
+-- ============================================================================
+-- public.files is SELECT * but its column list was fixed when it was created
+-- (v0.39.0). CREATE OR REPLACE can only append columns, so the existing ones
+-- are listed in their original order; thumbnail_params, previous_version_id,
+-- archive_status and hot_bucket stay internal.
+
+CREATE OR REPLACE VIEW public.files
+  WITH (security_invoker = true)
+  AS SELECT id, entity_type, entity_id, file_name, file_type, file_size,
+            s3_key_prefix, s3_original_key,
+            s3_thumbnail_small_key, s3_thumbnail_medium_key, s3_thumbnail_large_key,
+            thumbnail_status, thumbnail_error, created_by, created_at, updated_at,
+            s3_bucket, property_name,
+            blurhash, placeholder_color
+     FROM metadata.files;
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{files}',
+   '{blurhash,placeholder_color}',
+   'v0-111-0-file-placeholders',
+   'Blurhash and average colour placeholders for file thumbnails',
+   'accepted',
+   'File-heavy lists and galleries showed empty grey boxes or spinners until each thumbnail downloaded, which on slow connections made pages look broken and caused layout flicker as images arrived.',
+   'While generating thumbnails the worker scales the original (or the rendered PDF first page) to at most 32x32, flattens it on white like the JPEG thumbnails, and stores a BlurHash with up to 4x4 components and the average colour in metadata.files. Both are exposed through public.files. The backfill queues completed files without a blurhash; the worker then only computes the placeholder and leaves current thumbnails alone.',
+   'A blurhash is about 30 characters, so it travels with the file row and needs no extra request, and it is an established format with small decoders for the browser. The average colour is derived from the same pixels and suits places where a flat colour is enough.',
+   'Placeholders for existing files appear only after a backfill. Files whose type the image backend cannot decode keep NULL placeholders and the frontend falls back to its current loading state. A failure to compute a placeholder is logged and does not fail thumbnail generation.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
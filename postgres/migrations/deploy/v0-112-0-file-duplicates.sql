@@ -0,0 +1,160 @@
+-- Deploy civic_os:v0-112-0-file-duplicates to pg
+-- requires: v0-111-0-file-placeholders
+--
+-- v0.112.0 — Near-duplicate image detection:
+--   1. metadata.files.perceptual_hash: 64-bit difference hash (dHash) of
+--      each image, written by the thumbnail worker
+--   2. metadata.file_duplicates: images flagged as near-copies of an
+--      earlier upload to the same record
+--   3. public.get_file_duplicates() and public.dismiss_file_duplicate()
+--   4. Record schema decision
+--
+-- After storing a hash the thumbnail worker queues a find_duplicate_files
+-- job for the file's record (entity_type, entity_id); the job compares the
+-- record's image hashes and flags pairs within DUPLICATE_HASH_DISTANCE bits.
+-- Existing images are hashed by public.queue_thumbnail_backfill().
+
+BEGIN;
+
+-- ============================================================================
+-- 1. PERCEPTUAL HASH
+-- ============================================================================
+
+ALTER TABLE metadata.files
+    ADD COLUMN perceptual_hash BIGINT;
+
+COMMENT ON COLUMN metadata.files.perceptual_hash IS
+    '64-bit difference hash (dHash) of the image, stored as signed BIGINT. Images whose hashes differ in few bits look alike. NULL for PDFs, non-image files and files not yet processed. Written by the thumbnail worker; internal, so not exposed through public.files. Added in v0.112.0.';
+
+CREATE INDEX idx_files_entity_hashed ON metadata.files (entity_type, entity_id)
+    WHERE perceptual_hash IS NOT NULL;
+
+
+-- ============================================================================
+-- 2. DUPLICATE FLAGS
+-- ============================================================================
+
+CREATE TABLE metadata.file_duplicates (
+    file_id       UUID NOT NULL REFERENCES metadata.files(id) ON DELETE CASCADE,
+    duplicate_of  UUID NOT NULL REFERENCES metadata.files(id) ON DELETE CASCADE,
+    distance      SMALLINT NOT NULL CHECK (distance BETWEEN 0 AND 64),
+    detected_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    dismissed_at  TIMESTAMPTZ,
+    dismissed_by  UUID REFERENCES metadata.civic_os_users(id) ON DELETE SET NULL,
+    PRIMARY KEY (file_id, duplicate_of),
+    CHECK (file_id <> duplicate_of)
+);
+
+CREATE INDEX idx_file_duplicates_duplicate_of ON metadata.file_duplicates (duplicate_of);
+
+COMMENT ON TABLE metadata.file_duplicates IS
+    'Images flagged by the find_duplicate_files job as near-copies (perceptual hashes within DUPLICATE_HASH_DISTANCE bits) of an earlier upload to the same record. Each file points at the earliest similar file. Dismissed flags are kept so later scans do not raise them again. Added in v0.112.0.';
+
+-- Visible when the flagged file is; the subquery applies metadata.files RLS
+ALTER TABLE metadata.file_duplicates ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "File duplicates follow file visibility" ON metadata.file_duplicates FOR SELECT
+USING (EXISTS (SELECT 1 FROM metadata.files f WHERE f.id = file_id));
+
+GRANT SELECT ON metadata.file_duplicates TO authenticated;
+
+
+-- ============================================================================
+-- 3. RPCS
+-- ============================================================================
+
+-- SECURITY INVOKER: only duplicates of files the caller can see are returned
+CREATE OR REPLACE FUNCTION public.get_file_duplicates(
+    p_entity_type TEXT,
+    p_entity_id TEXT,
+    p_include_dismissed BOOLEAN DEFAULT FALSE
+)
+RETURNS TABLE (
+    file_id UUID,
+    file_name TEXT,
+    duplicate_of UUID,
+    duplicate_of_name TEXT,
+    distance SMALLINT,
+    detected_at TIMESTAMPTZ,
+    dismissed_at TIMESTAMPTZ
+)
+LANGUAGE sql
+STABLE
+SECURITY INVOKER
+SET search_path = metadata, public
+AS $$
+    SELECT d.file_id, f.file_name, d.duplicate_of, o.file_name,
+           d.distance, d.detected_at, d.dismissed_at
+    FROM metadata.file_duplicates d
+    JOIN metadata.files f ON f.id = d.file_id
+    JOIN metadata.files o ON o.id = d.duplicate_of
+    WHERE f.entity_type = p_entity_type
+      AND f.entity_id = p_entity_id
+      AND (p_include_dismissed OR d.dismissed_at IS NULL)
+    ORDER BY d.detected_at, f.created_at;
+$$;
+
+COMMENT ON FUNCTION public.get_file_duplicates(TEXT, TEXT, BOOLEAN) IS
+    'Near-duplicate images attached to one record, with the earlier file each one copies. Dismissed flags are left out unless p_include_dismissed. Added in v0.112.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_file_duplicates(TEXT, TEXT, BOOLEAN) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_file_duplicates(TEXT, TEXT, BOOLEAN) TO authenticated;
+
+-- Same rule as delete_file_record(): the uploader of the flagged file or an admin
+CREATE OR REPLACE FUNCTION public.dismiss_file_duplicate(p_file_id UUID, p_duplicate_of UUID)
+RETURNS void
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_dismissed BOOLEAN;
+BEGIN
+    WITH dismissed AS (
+        UPDATE metadata.file_duplicates d
+        SET dismissed_at = NOW(),
+            dismissed_by = current_user_id()
+        FROM metadata.files f
+        WHERE d.file_id = p_file_id
+          AND d.duplicate_of = p_duplicate_of
+          AND f.id = d.file_id
+          AND (f.created_by = current_user_id() OR is_admin())
+        RETURNING d.file_id
+    )
+    SELECT EXISTS(SELECT 1 FROM dismissed) INTO v_dismissed;
+
+    IF NOT v_dismissed THEN
+        RAISE EXCEPTION 'Not authorized to dismiss this duplicate or duplicate not found'
+            USING ERRCODE = '42501';
+    END IF;
+END;
+$$;
+
+COMMENT ON FUNCTION public.dismiss_file_duplicate(UUID, UUID) IS
+    'Mark a duplicate flag as reviewed so it is no longer listed. Only the uploader of the flagged file or an admin can dismiss. Added in v0.112.0.';
+
+REVOKE EXECUTE ON FUNCTION public.dismiss_file_duplicate(UUID, UUID) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.dismiss_file_duplicate(UUID, UUID) TO authenticated;
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{files}',
+   '{perceptual_hash}',
+   'v0-112-0-file-duplicates',
+   'Perceptual hashing to flag near-duplicate image uploads',
+   'accepted',
+   'Residents often upload the same photo several times to one report, from retries on poor connections or from both the camera and the gallery, which wastes storage and clutters record pages and galleries. Byte-level checksums miss these copies because phones and browsers re-encode and resize images.',
+   'The thumbnail worker computes a 64-bit difference hash (dHash) from the same 32-pixel copy it uses for the blurhash and stores it in metadata.files.perceptual_hash, then queues find_duplicate_files for the file''s record 30 seconds later so a burst of uploads is scanned once. The job compares the record''s image hashes and records each image within DUPLICATE_HASH_DISTANCE bits (default 5) of an earlier one in metadata.file_duplicates. get_file_duplicates() lists flags for a record; dismiss_file_duplicate() hides one.',
+   'A dHash is cheap to compute from pixels the worker already has and survives re-encoding and resizing, and comparing within one record keeps each scan small without an index over Hamming distance. Flags are advisory: deleting a file remains a user decision.',
+   'Images are only compared with other files on the same record. PDFs are not hashed because forms and letters share first pages. Crops, rotations and heavy edits are not detected, and very similar but distinct photos (two shots of the same pothole) may be flagged; dismissed flags are not raised again.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
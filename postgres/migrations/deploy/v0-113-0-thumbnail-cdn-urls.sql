@@ -0,0 +1,86 @@
+-- Deploy civic_os:v0-113-0-thumbnail-cdn-urls to pg
+-- requires: v0-112-0-file-duplicates
+--
+-- v0.113.0 — Signed CDN URLs for thumbnails:
+--   1. metadata.file_cdn_urls: CloudFront or Cloudflare signed thumbnail
+--      URLs, written by the thumbnail worker and the cdn_url_refresh task
+--   2. public.files exposes the URLs and their expiry
+--   3. Record schema decision
+--
+-- The table stays empty unless the worker runs with CDN_URL_SIGNER set. The
+-- worker then stops uploading thumbnails with the public-read ACL and signs
+-- URLs for the CDN_S3_BUCKET bucket; cdn_url_refresh re-signs them before
+-- they expire and signs thumbnails that existed before signing was enabled.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SIGNED URL TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.file_cdn_urls (
+    file_id               UUID PRIMARY KEY REFERENCES metadata.files(id) ON DELETE CASCADE,
+    thumbnail_small_url   TEXT,
+    thumbnail_medium_url  TEXT,
+    thumbnail_large_url   TEXT,
+    signed_at             TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at            TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_file_cdn_urls_expires_at ON metadata.file_cdn_urls (expires_at);
+
+COMMENT ON TABLE metadata.file_cdn_urls IS
+    'Signed CDN URLs for each file''s thumbnails, valid until expires_at. Written by the thumbnail worker when CDN_URL_SIGNER is set and re-signed by the cdn_url_refresh maintenance task before half the TTL remains. Exposed through public.files. Added in v0.113.0.';
+
+-- Visible when the file is; the subquery applies metadata.files RLS
+ALTER TABLE metadata.file_cdn_urls ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "File CDN URLs follow file visibility" ON metadata.file_cdn_urls FOR SELECT
+USING (EXISTS (SELECT 1 FROM metadata.files f WHERE f.id = file_id));
+
+-- public.files is security_invoker, so readers of the view need SELECT here
+GRANT SELECT ON metadata.file_cdn_urls TO web_anon, authenticated;
+
+
+-- ============================================================================
+-- 2. PUBLIC VIEW
+-- ============================================================================
+-- CREATE OR REPLACE can only append columns, so the existing ones are listed
+-- in the order v0.111.0 left them.
+
+CREATE OR REPLACE VIEW public.files
+  WITH (security_invoker = true)
+  AS SELECT f.id, f.entity_type, f.entity_id, f.file_name, f.file_type, f.file_size,
+            f.s3_key_prefix, f.s3_original_key,
+            f.s3_thumbnail_small_key, f.s3_thumbnail_medium_key, f.s3_thumbnail_large_key,
+            f.thumbnail_status, f.thumbnail_error, f.created_by, f.created_at, f.updated_at,
+            f.s3_bucket, f.property_name,
+            f.blurhash, f.placeholder_color,
+            c.thumbnail_small_url AS cdn_thumbnail_small_url,
+            c.thumbnail_medium_url AS cdn_thumbnail_medium_url,
+            c.thumbnail_large_url AS cdn_thumbnail_large_url,
+            c.expires_at AS cdn_urls_expire_at
+     FROM metadata.files f
+     LEFT JOIN metadata.file_cdn_urls c ON c.file_id = f.id;
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{files}',
+   '{cdn_thumbnail_small_url,cdn_thumbnail_medium_url,cdn_thumbnail_large_url,cdn_urls_expire_at}',
+   'v0-113-0-thumbnail-cdn-urls',
+   'Signed CDN URLs for thumbnails instead of public-read objects',
+   'accepted',
+   'Thumbnails are uploaded with the public-read ACL so the browser can load them straight from S3. Deployments that front the bucket with CloudFront or Cloudflare want the bucket private and every request to pass through the CDN, which public objects defeat.',
+   'With CDN_URL_SIGNER=cloudfront or cloudflare the thumbnail worker uploads thumbnails without the public-read ACL, signs a URL per size under CDN_BASE_URL that is valid for CDN_URL_TTL_HOURS (CloudFront canned policy, or a Cloudflare HMAC token checked by a WAF rule) and stores them in metadata.file_cdn_urls. public.files joins the table in, and the cdn_url_refresh maintenance task re-signs URLs once half their lifetime has passed. The frontend uses a CDN URL when one is present and unexpired and otherwise builds the S3 URL as before.',
+   'Signing in the worker keeps CDN keys out of PostgREST and the browser, and storing finished URLs means the frontend needs no signing logic and readers only ever see URLs for files RLS lets them see. Refreshing at half the TTL means a page loaded just before a refresh still has URLs valid for at least half the TTL.',
+   'Thumbnails uploaded before signing was enabled keep their public-read ACL until the bucket policy or object ACLs are changed. A URL shared outside the app works until it expires. Only thumbnails are signed: originals and PDFs are still loaded from S3 URLs as before.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,133 @@
+-- Deploy civic_os:v0-114-0-upload-request-expiry to pg
+-- requires: v0-113-0-thumbnail-cdn-urls
+--
+-- v0.114.0 — Expiry of abandoned upload requests:
+--   1. metadata.file_upload_requests: 'expired' status, expired_at, and
+--      uploaded_at stamped when the request's file row is created
+--   2. public.get_abandoned_upload_summary(): abandoned uploads per entity type
+--   3. Record schema decision
+--
+-- The worker's upload_request_cleanup task expires requests still not
+-- uploaded an hour after they were made, deletes any object their PUT left
+-- in S3 and purges requests after UPLOAD_REQUEST_RETENTION_DAYS (default 30).
+
+BEGIN;
+
+-- ============================================================================
+-- 1. REQUEST LIFECYCLE
+-- ============================================================================
+
+ALTER TABLE metadata.file_upload_requests
+    DROP CONSTRAINT IF EXISTS file_upload_requests_status_check,
+    ADD CONSTRAINT file_upload_requests_status_check CHECK (
+        status IN ('pending', 'processing', 'completed', 'failed', 'expired')
+    ),
+    ADD COLUMN uploaded_at TIMESTAMPTZ,
+    ADD COLUMN expired_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN metadata.file_upload_requests.uploaded_at IS
+    'When the file row with this request''s file_id was created, i.e. the upload was used. Set by the files_mark_upload_request_used trigger. Added in v0.114.0.';
+
+COMMENT ON COLUMN metadata.file_upload_requests.expired_at IS
+    'When the upload_request_cleanup task expired the request because it was never uploaded. s3_key is cleared once any object at it has been deleted. Added in v0.114.0.';
+
+COMMENT ON TABLE metadata.file_upload_requests IS
+    'Presigned upload URL requests. Requests not uploaded within an hour are expired by the upload_request_cleanup maintenance task, which deletes any object they left and purges requests after UPLOAD_REQUEST_RETENTION_DAYS.';
+
+-- Requests made before v0.114.0 that were used
+UPDATE metadata.file_upload_requests r
+SET uploaded_at = f.created_at
+FROM metadata.files f
+WHERE f.id = r.file_id;
+
+-- SECURITY DEFINER: uploaders can't update requests directly
+CREATE OR REPLACE FUNCTION metadata.mark_upload_request_used()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    UPDATE metadata.file_upload_requests
+    SET uploaded_at = NOW()
+    WHERE file_id = NEW.id
+      AND uploaded_at IS NULL;
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.mark_upload_request_used() IS
+    'AFTER INSERT trigger on metadata.files: stamps uploaded_at on the upload request that issued the file''s ID. Added in v0.114.0.';
+
+CREATE TRIGGER files_mark_upload_request_used
+    AFTER INSERT ON metadata.files
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.mark_upload_request_used();
+
+-- The cleanup task looks for unused requests by age
+CREATE INDEX idx_upload_requests_unused ON metadata.file_upload_requests(created_at)
+    WHERE uploaded_at IS NULL AND status IN ('pending', 'processing', 'completed');
+
+
+-- ============================================================================
+-- 2. ABANDONED UPLOAD SUMMARY RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_abandoned_upload_summary(p_days INT DEFAULT 30)
+RETURNS TABLE (
+    entity_type TEXT,
+    uploaded_requests BIGINT,
+    abandoned_requests BIGINT,
+    unsigned_requests BIGINT,
+    last_abandoned_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can view upload requests';
+    END IF;
+
+    RETURN QUERY
+    SELECT r.entity_type,
+           COUNT(*) FILTER (WHERE r.uploaded_at IS NOT NULL),
+           COUNT(*) FILTER (WHERE r.status = 'expired' AND r.presigned_url IS NOT NULL),
+           COUNT(*) FILTER (WHERE r.status = 'expired' AND r.presigned_url IS NULL),
+           MAX(r.created_at) FILTER (WHERE r.status = 'expired')
+    FROM metadata.file_upload_requests r
+    WHERE r.created_at >= NOW() - make_interval(days => p_days)
+    GROUP BY r.entity_type
+    ORDER BY r.entity_type;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_abandoned_upload_summary(INT) IS
+    'Admin-only. Upload requests per entity type made in the last p_days: used (uploaded_requests), signed but never uploaded (abandoned_requests) and expired before the worker signed them (unsigned_requests). Covers at most UPLOAD_REQUEST_RETENTION_DAYS. Added in v0.114.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_abandoned_upload_summary(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_abandoned_upload_summary(INT) TO authenticated;
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{file_upload_requests}',
+   '{status,uploaded_at,expired_at}',
+   'v0-114-0-upload-request-expiry',
+   'Expire abandoned upload requests and delete their objects',
+   'accepted',
+   'Every upload starts with a file_upload_requests row that the presign job marks completed once it has signed a URL. Rows stayed completed whether or not the browser ever used the URL, so the table grew forever, uploads that reached S3 but never got a file row left orphaned objects, and there was no way to see how often uploads were abandoned.',
+   'A trigger on metadata.files stamps uploaded_at on the request that issued the file''s ID. The upload_request_cleanup maintenance task marks requests still not uploaded an hour after they were made (the 15 minute URL lifetime plus a grace period for uploads in flight) as expired, deletes the object at their s3_key and clears it, and deletes requests older than UPLOAD_REQUEST_RETENTION_DAYS. public.get_abandoned_upload_summary() counts used, abandoned and never-signed requests per entity type.',
+   'Stamping the request when its file row appears distinguishes an abandoned upload from a file that was uploaded and later deleted, which the absence of a file row cannot. Keeping expired rows until the retention period gives admins per-entity counts without a separate statistics table.',
+   'Requests from before v0.114.0 whose file was since deleted look unused and are expired on the first run; deleting their objects only removes originals whose file rows are already gone. Counts only cover the retention period.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,222 @@
+-- Deploy civic_os:v0-115-0-storage-quotas to pg
+-- requires: v0-114-0-upload-request-expiry
+--
+-- v0.115.0 — Storage quotas per entity type:
+--   1. metadata.storage_quotas: byte limit on the files attached to one
+--      entity type
+--   2. metadata.storage_usage: file count and bytes per entity type,
+--      refreshed by the worker's storage_usage maintenance task
+--   3. request_upload_url() records the file size so the s3_presign job can
+--      refuse uploads that would exceed the quota
+--   4. Public RPCs: set_storage_quota(), get_storage_usage()
+--   5. Record schema decision
+
+BEGIN;
+
+-- ============================================================================
+-- 1. QUOTAS
+-- ============================================================================
+
+CREATE TABLE metadata.storage_quotas (
+    entity_type TEXT PRIMARY KEY,
+    max_bytes   BIGINT NOT NULL CHECK (max_bytes > 0),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.storage_quotas IS
+    'Most bytes of files that may be attached to records of one entity type (metadata.files.entity_type). The s3_presign job fails upload requests that would take usage past max_bytes. Entity types without a row are unlimited. Managed with public.set_storage_quota(). Added in v0.115.0.';
+
+
+-- ============================================================================
+-- 2. USAGE
+-- ============================================================================
+
+CREATE TABLE metadata.storage_usage (
+    entity_type TEXT PRIMARY KEY,
+    file_count  BIGINT NOT NULL,
+    total_bytes BIGINT NOT NULL,
+    computed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.storage_usage IS
+    'File count and total size per entity type as of computed_at, for dashboards. Refreshed by the storage_usage maintenance task; quota checks count metadata.files directly. Added in v0.115.0.';
+
+CREATE OR REPLACE FUNCTION metadata.refresh_storage_usage()
+RETURNS INT
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_count INT;
+BEGIN
+    INSERT INTO metadata.storage_usage (entity_type, file_count, total_bytes, computed_at)
+    SELECT f.entity_type, COUNT(*), COALESCE(SUM(f.file_size), 0), NOW()
+    FROM metadata.files f
+    GROUP BY f.entity_type
+    ON CONFLICT (entity_type) DO UPDATE
+        SET file_count = EXCLUDED.file_count,
+            total_bytes = EXCLUDED.total_bytes,
+            computed_at = EXCLUDED.computed_at;
+    GET DIAGNOSTICS v_count = ROW_COUNT;
+
+    -- Entity types whose last file was deleted
+    DELETE FROM metadata.storage_usage u
+    WHERE NOT EXISTS (SELECT 1 FROM metadata.files f WHERE f.entity_type = u.entity_type);
+
+    RETURN v_count;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.refresh_storage_usage() IS
+    'Recompute metadata.storage_usage from metadata.files. Returns the number of entity types with files. Called by the storage_usage maintenance task. Added in v0.115.0.';
+
+
+-- ============================================================================
+-- 3. FILE SIZE ON UPLOAD REQUESTS
+-- ============================================================================
+
+ALTER TABLE metadata.file_upload_requests ADD COLUMN file_size BIGINT
+    CHECK (file_size >= 0);
+
+COMMENT ON COLUMN metadata.file_upload_requests.file_size IS
+    'Size in bytes the uploader declared, checked against metadata.storage_quotas by the s3_presign job. NULL from clients older than v0.115.0, which are only refused once the quota is already used up. Added in v0.115.0.';
+
+-- A new parameter with a default would leave two overloads that PostgREST
+-- can't choose between
+DROP FUNCTION IF EXISTS public.request_upload_url(TEXT, TEXT, TEXT, TEXT);
+
+-- The s3_presign job is queued by the insert_s3_presign_job trigger
+CREATE OR REPLACE FUNCTION public.request_upload_url(
+    p_entity_type TEXT,
+    p_entity_id TEXT,
+    p_file_name TEXT,
+    p_file_type TEXT,
+    p_file_size BIGINT DEFAULT NULL
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_request_id UUID;
+BEGIN
+    INSERT INTO metadata.file_upload_requests (entity_type, entity_id, file_name, file_type, file_size)
+    VALUES (p_entity_type, p_entity_id, p_file_name, p_file_type, p_file_size)
+    RETURNING id INTO v_request_id;
+
+    RETURN v_request_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_upload_url(TEXT, TEXT, TEXT, TEXT, BIGINT) IS
+    'Request presigned S3 upload URL. Returns request ID for polling with get_upload_url(). p_file_size is checked against the entity type''s storage quota (v0.115.0).';
+
+GRANT EXECUTE ON FUNCTION public.request_upload_url(TEXT, TEXT, TEXT, TEXT, BIGINT) TO authenticated;
+
+
+-- ============================================================================
+-- 4. RPCS
+-- ============================================================================
+
+-- NULL p_max_bytes removes the quota
+CREATE OR REPLACE FUNCTION public.set_storage_quota(p_entity_type TEXT, p_max_bytes BIGINT)
+RETURNS VOID
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    IF p_max_bytes IS NULL THEN
+        DELETE FROM metadata.storage_quotas WHERE entity_type = p_entity_type;
+    ELSE
+        INSERT INTO metadata.storage_quotas (entity_type, max_bytes)
+        VALUES (p_entity_type, p_max_bytes)
+        ON CONFLICT (entity_type) DO UPDATE
+            SET max_bytes = EXCLUDED.max_bytes,
+                updated_at = NOW();
+    END IF;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'storage_quota_change',
+        jsonb_build_object('entity_type', p_entity_type, 'max_bytes', p_max_bytes)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_storage_quota(TEXT, BIGINT) IS
+    'Set the most bytes of files that records of an entity type may hold, or remove the limit with NULL. Files already stored are kept. Admin only; logged to admin_audit_log. Added in v0.115.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_storage_quota(TEXT, BIGINT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_storage_quota(TEXT, BIGINT) TO authenticated;
+
+CREATE OR REPLACE FUNCTION public.get_storage_usage()
+RETURNS TABLE (
+    entity_type TEXT,
+    file_count BIGINT,
+    total_bytes BIGINT,
+    max_bytes BIGINT,
+    used_percent NUMERIC,
+    computed_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    RETURN QUERY
+    SELECT COALESCE(u.entity_type, q.entity_type),
+           COALESCE(u.file_count, 0),
+           COALESCE(u.total_bytes, 0),
+           q.max_bytes,
+           ROUND(100.0 * COALESCE(u.total_bytes, 0) / q.max_bytes, 1),
+           u.computed_at
+    FROM metadata.storage_usage u
+    FULL JOIN metadata.storage_quotas q ON q.entity_type = u.entity_type
+    ORDER BY 1;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_storage_usage() IS
+    'Admin-only. Files and bytes per entity type from the last storage_usage run, with the quota and share used where one is set. Added in v0.115.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_storage_usage() FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_storage_usage() TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{files,file_upload_requests}',
+   '{file_size}',
+   'v0-115-0-storage-quotas',
+   'Per-entity-type storage quotas enforced when upload URLs are signed',
+   'accepted',
+   'Storage is billed per byte, and one busy intake form can fill a bucket that several departments share. Deployments had no way to cap the space a form''s attachments use, and no summary of usage short of querying metadata.files.',
+   'Admins set a byte limit per entity type with set_storage_quota(). request_upload_url() now takes the file size, and the s3_presign job fails the request with a quota message instead of signing a URL when the entity type''s files, plus uploads signed in the last hour but not yet attached, plus the new file would pass the limit. The storage_usage maintenance task writes per-entity-type totals to metadata.storage_usage for get_storage_usage() and dashboards.',
+   'The presign job is the one point every browser upload passes before any bytes reach S3, and it already fails requests the frontend reports to the user. Checking live totals keeps the limit exact between usage refreshes, and the entity_type index keeps the sum cheap. The deployment is the only tenant in Civic OS, so the entity type is the natural unit to budget.',
+   'The size is declared by the client and only checked for browser uploads: files created by imports, the worker or API scripts are counted but not refused. Lowering a quota below current usage blocks new uploads and keeps existing files. Concurrent uploads checked at the same moment can each pass and overshoot by up to their combined size.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,214 @@
+-- Deploy civic_os:v0-116-0-sms-segments to pg
+-- requires: v0-115-0-storage-quotas
+--
+-- v0.116.0 — SMS segment counts in template validation:
+--   1. sms_length, sms_segments and sms_encoding on
+--      template_part_validation_results
+--   2. validate_template_parts() gains p_sample_entity_data, which the worker
+--      renders the SMS part with
+--   3. get_validation_results() returns the SMS columns
+--   4. Record schema decision
+--
+-- Carriers bill per segment: 160 GSM-7 characters, or 70 once a single
+-- character (a curly quote, an emoji) forces UCS-2, and fewer per part once
+-- the message is split. A template that looks short can cost four segments
+-- per recipient.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SMS COLUMNS
+-- ============================================================================
+
+ALTER TABLE metadata.template_part_validation_results
+    ADD COLUMN sms_length INTEGER,
+    ADD COLUMN sms_segments INTEGER,
+    ADD COLUMN sms_encoding TEXT CHECK (sms_encoding IN ('GSM-7', 'UCS-2'));
+
+COMMENT ON COLUMN metadata.template_part_validation_results.sms_length IS
+    'SMS part rendered with the sample data: length in GSM-7 septets or UCS-2 code units. NULL for other parts, or when the sample data does not render. Added in v0.116.0.';
+COMMENT ON COLUMN metadata.template_part_validation_results.sms_segments IS
+    'SMS part rendered with the sample data: segments the message is billed as. Added in v0.116.0.';
+COMMENT ON COLUMN metadata.template_part_validation_results.sms_encoding IS
+    'SMS part rendered with the sample data: GSM-7, or UCS-2 when any character is outside the GSM alphabet. Added in v0.116.0.';
+
+
+-- ============================================================================
+-- 2. validate_template_parts() WITH SAMPLE DATA
+-- ============================================================================
+-- A new trailing parameter changes the signature, so the v0.11.0 function is
+-- dropped. Callers passing named arguments (PostgREST) are unaffected.
+
+DROP FUNCTION IF EXISTS public.validate_template_parts(UUID, TEXT, TEXT, TEXT, TEXT);
+
+CREATE OR REPLACE FUNCTION public.validate_template_parts(
+    p_validation_id UUID DEFAULT gen_random_uuid(),
+    p_subject_template TEXT DEFAULT NULL,
+    p_html_template TEXT DEFAULT NULL,
+    p_text_template TEXT DEFAULT NULL,
+    p_sms_template TEXT DEFAULT NULL,
+    p_sample_entity_data JSONB DEFAULT NULL
+)
+RETURNS TABLE(
+    validation_id UUID
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Validate that at least one template part was provided
+    IF p_subject_template IS NULL
+        AND p_html_template IS NULL
+        AND p_text_template IS NULL
+        AND p_sms_template IS NULL
+    THEN
+        RAISE EXCEPTION 'At least one template part must be provided for validation';
+    END IF;
+
+    -- Same default sample data as preview_template_parts()
+    IF p_sample_entity_data IS NULL THEN
+        p_sample_entity_data := '{"display_name": "Example Entity", "id": 1}'::jsonb;
+    END IF;
+
+    -- Insert validation request
+    INSERT INTO metadata.template_validation_results (
+        id,
+        subject_template,
+        html_template,
+        text_template,
+        sms_template,
+        status
+    )
+    VALUES (
+        p_validation_id,
+        p_subject_template,
+        p_html_template,
+        p_text_template,
+        p_sms_template,
+        'pending'
+    );
+
+    -- Enqueue high-priority validation job
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'validate_template_parts',
+        jsonb_build_object(
+            'validation_id', p_validation_id::text,
+            'subject_template', p_subject_template,
+            'html_template', p_html_template,
+            'text_template', p_text_template,
+            'sms_template', p_sms_template,
+            'sample_entity_data', p_sample_entity_data
+        ),
+        'notifications',
+        4,  -- HIGH PRIORITY (4 = highest, normal notifications are priority 1)
+        3,
+        NOW(),
+        'available'
+    );
+
+    -- Return validation_id immediately (non-blocking)
+    RETURN QUERY SELECT p_validation_id;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION public.validate_template_parts TO authenticated;
+
+COMMENT ON FUNCTION public.validate_template_parts IS
+    'Enqueues a validation job and returns validation_id immediately. The SMS part is rendered with p_sample_entity_data to count its segments (v0.116.0). Use get_validation_results() to poll for results.';
+
+
+-- ============================================================================
+-- 3. get_validation_results() WITH SMS COLUMNS
+-- ============================================================================
+-- The result columns change, so the function is dropped and recreated.
+
+DROP FUNCTION IF EXISTS public.get_validation_results(UUID);
+
+CREATE OR REPLACE FUNCTION public.get_validation_results(
+    p_validation_id UUID
+)
+RETURNS TABLE(
+    status TEXT,
+    part_name TEXT,
+    valid BOOLEAN,
+    error_message TEXT,
+    sms_length INTEGER,
+    sms_segments INTEGER,
+    sms_encoding TEXT
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_status TEXT;
+BEGIN
+    -- Check validation status
+    SELECT tvr.status
+    INTO v_status
+    FROM metadata.template_validation_results tvr
+    WHERE tvr.id = p_validation_id;
+
+    IF v_status IS NULL THEN
+        RAISE EXCEPTION 'Validation ID not found: %', p_validation_id;
+    END IF;
+
+    -- Return status and results (if completed)
+    IF v_status = 'completed' THEN
+        RETURN QUERY
+        SELECT
+            v_status,
+            pvr.part_name::TEXT,
+            pvr.valid,
+            pvr.error_message,
+            pvr.sms_length,
+            pvr.sms_segments,
+            pvr.sms_encoding
+        FROM metadata.template_part_validation_results pvr
+        WHERE pvr.validation_id = p_validation_id
+        ORDER BY
+            CASE pvr.part_name
+                WHEN 'subject' THEN 1
+                WHEN 'html' THEN 2
+                WHEN 'text' THEN 3
+                WHEN 'sms' THEN 4
+            END;
+
+        -- Mark consumed; the worker's cleanup cron purges consumed results
+        -- shortly after instead of waiting for the retention TTL
+        UPDATE metadata.template_validation_results tvr
+        SET consumed_at = COALESCE(tvr.consumed_at, NOW())
+        WHERE tvr.id = p_validation_id;
+    ELSE
+        -- Return just status (pending/processing)
+        RETURN QUERY SELECT v_status, NULL::TEXT, NULL::BOOLEAN, NULL::TEXT, NULL::INTEGER, NULL::INTEGER, NULL::TEXT;
+    END IF;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION public.get_validation_results TO authenticated;
+
+COMMENT ON FUNCTION public.get_validation_results IS
+    'Retrieves validation results for a given validation_id. Returns status (pending/completed) and results if available, with the rendered SMS length, segment count and encoding for the sms part (v0.116.0). Completed results are marked consumed and purged by the worker shortly after.';
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{template_part_validation_results}',
+   '{sms_length,sms_segments,sms_encoding}',
+   'v0-116-0-sms-segments',
+   'Report SMS segment counts when validating templates',
+   'accepted',
+   'Template authors see whether an SMS template parses, but not what it costs. A single curly quote or emoji switches a message from GSM-7 (160 characters) to UCS-2 (70), and split messages carry fewer characters per part, so a template that looks short can be billed as four segments per recipient.',
+   'The validation worker renders the SMS part with sample data (p_sample_entity_data, or the same default sample as previews) and stores the length, segment count and encoding on the part''s result. get_validation_results() returns them and the template editor shows them under the SMS field.',
+   'Counting in the worker keeps one implementation of the GSM 03.38 rules next to the code that sends SMS. Rendering with sample data measures what recipients get rather than the template source, where {{ }} expressions change the length.',
+   'The count is an estimate: real entity data can be longer than the sample, or contain characters that force UCS-2. get_validation_results() has three more result columns; positional readers of its result set must allow for them.');
+
+COMMIT;
@@ -0,0 +1,122 @@
+-- Deploy civic_os:v0-117-0-template-warnings to pg
+-- requires: v0-116-0-sms-segments
+--
+-- v0.117.0 — Warnings from template validation:
+--   1. warnings on template_part_validation_results
+--   2. get_validation_results() returns them
+--   3. Record schema decision
+--
+-- A template can parse and still be wrong. For example, an HTML email might
+-- carry a <script> tag that clients strip, an image without alt text or
+-- served over http, a link that leaves the site, or a {{.Entity.x}} field
+-- the entity doesn't have, which renders as nothing. The validation worker
+-- reports these as warnings. They don't make the part invalid.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. WARNINGS COLUMN
+-- ============================================================================
+
+ALTER TABLE metadata.template_part_validation_results
+    ADD COLUMN warnings TEXT[] NOT NULL DEFAULT '{}';
+
+COMMENT ON COLUMN metadata.template_part_validation_results.warnings IS
+    'Likely mistakes in a part that parsed: entity references missing from the sample data and, for HTML, script tags, javascript: links, images without alt text or over http, and links outside SITE_URL. Do not affect valid. Added in v0.117.0.';
+
+
+-- ============================================================================
+-- 2. get_validation_results() WITH WARNINGS
+-- ============================================================================
+-- The result columns change, so the function is dropped and recreated.
+
+DROP FUNCTION IF EXISTS public.get_validation_results(UUID);
+
+CREATE OR REPLACE FUNCTION public.get_validation_results(
+    p_validation_id UUID
+)
+RETURNS TABLE(
+    status TEXT,
+    part_name TEXT,
+    valid BOOLEAN,
+    error_message TEXT,
+    warnings TEXT[],
+    sms_length INTEGER,
+    sms_segments INTEGER,
+    sms_encoding TEXT
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_status TEXT;
+BEGIN
+    -- Check validation status
+    SELECT tvr.status
+    INTO v_status
+    FROM metadata.template_validation_results tvr
+    WHERE tvr.id = p_validation_id;
+
+    IF v_status IS NULL THEN
+        RAISE EXCEPTION 'Validation ID not found: %', p_validation_id;
+    END IF;
+
+    -- Return status and results (if completed)
+    IF v_status = 'completed' THEN
+        RETURN QUERY
+        SELECT
+            v_status,
+            pvr.part_name::TEXT,
+            pvr.valid,
+            pvr.error_message,
+            pvr.warnings,
+            pvr.sms_length,
+            pvr.sms_segments,
+            pvr.sms_encoding
+        FROM metadata.template_part_validation_results pvr
+        WHERE pvr.validation_id = p_validation_id
+        ORDER BY
+            CASE pvr.part_name
+                WHEN 'subject' THEN 1
+                WHEN 'html' THEN 2
+                WHEN 'text' THEN 3
+                WHEN 'sms' THEN 4
+            END;
+
+        -- Mark consumed; the worker's cleanup cron purges consumed results
+        -- shortly after instead of waiting for the retention TTL
+        UPDATE metadata.template_validation_results tvr
+        SET consumed_at = COALESCE(tvr.consumed_at, NOW())
+        WHERE tvr.id = p_validation_id;
+    ELSE
+        -- Return just status (pending/processing)
+        RETURN QUERY SELECT v_status, NULL::TEXT, NULL::BOOLEAN, NULL::TEXT, NULL::TEXT[], NULL::INTEGER, NULL::INTEGER, NULL::TEXT;
+    END IF;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION public.get_validation_results TO authenticated;
+
+COMMENT ON FUNCTION public.get_validation_results IS
+    'Retrieves validation results for a given validation_id. Returns status (pending/completed) and results if available, with warnings for parts that parsed (v0.117.0) and the rendered SMS length, segment count and encoding for the sms part (v0.116.0). Completed results are marked consumed and purged by the worker shortly after.';
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{template_part_validation_results}',
+   '{warnings}',
+   'v0-117-0-template-warnings',
+   'Report template warnings separately from syntax errors',
+   'accepted',
+   'Template validation only reported syntax errors. Templates that parse but render badly went out unnoticed. Examples: a misspelt {{.Entity.x}} that renders empty, a <script> tag that email clients strip, images without alt text or loaded over http, and links pointing away from the instance.',
+   'The validation worker checks every part that parses against the sample data for entity references it lacks. It renders the HTML part and scans it for script tags, javascript: links, images without alt or with http sources, and absolute links outside SITE_URL. The findings are stored in a warnings array on the part''s result, and valid is unchanged.',
+   'Warnings rather than errors because each check has legitimate exceptions: links to a city website, decorative images, fields that are sometimes absent. Authors can still save what they meant to send. The HTML is scanned with the same regexp approach as engagement tracking, which avoids adding an HTML parser dependency to the worker.',
+   'Reference warnings depend on the sample data. With the default sample, most fields are reported missing, so the template editor sends the sample it loaded for the entity type. get_validation_results() has another result column.');
+
+COMMIT;
@@ -0,0 +1,161 @@
+-- Deploy civic_os:v0-118-0-notification-archive to pg
+-- requires: v0-117-0-template-warnings
+--
+-- v0.118.0 — Rendered notification archive for records requests:
+--   1. notification_templates.archive_rendered: per-template opt-in
+--   2. metadata.notification_archive: what was sent, kept independently of
+--      the notification and never updated
+--   3. public.search_notification_archive() (notification_content:read)
+--   4. Record schema decision
+--
+-- notification_log keeps the subject and text of the latest attempt for
+-- support, but not the HTML, and it is deleted with the notification. FOIA
+-- and records requests need the exact message, including HTML and emails
+-- sent through send_email jobs, which have no notification row.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. PER-TEMPLATE OPT-IN
+-- ============================================================================
+
+ALTER TABLE metadata.notification_templates
+    ADD COLUMN archive_rendered BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN metadata.notification_templates.archive_rendered IS
+    'Copy every sent message''s rendered subject, HTML, text and SMS body into metadata.notification_archive. Added in v0.118.0.';
+
+
+-- ============================================================================
+-- 2. ARCHIVE TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.notification_archive (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- No foreign key: the archive outlives notification cleanup.
+    -- NULL for send_email jobs.
+    notification_id BIGINT,
+    river_job_id BIGINT,
+    template_name VARCHAR(100) NOT NULL,
+    entity_type VARCHAR(100),
+    entity_id VARCHAR(100),
+
+    -- Addresses as sent (users change their email)
+    recipients TEXT[] NOT NULL DEFAULT '{}',
+    cc TEXT[] NOT NULL DEFAULT '{}',
+    channels_sent TEXT[] NOT NULL DEFAULT '{}',
+    attachment_names TEXT[] NOT NULL DEFAULT '{}',
+
+    -- Rendered content; NULL for channels that didn't go out
+    subject TEXT,
+    html_body TEXT,
+    text_body TEXT,
+    sms_body TEXT,
+
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One archive row per notification, whichever attempt delivered it first
+CREATE UNIQUE INDEX idx_notification_archive_notification
+    ON metadata.notification_archive(notification_id)
+    WHERE notification_id IS NOT NULL;
+CREATE INDEX idx_notification_archive_sent_at
+    ON metadata.notification_archive(sent_at DESC);
+CREATE INDEX idx_notification_archive_entity
+    ON metadata.notification_archive(entity_type, entity_id);
+CREATE INDEX idx_notification_archive_recipients
+    ON metadata.notification_archive USING gin (recipients);
+
+COMMENT ON TABLE metadata.notification_archive IS
+    'Exact rendered content of messages sent from templates with archive_rendered, for public records requests. Written by the notification and send_email workers, never updated. Read through search_notification_archive(). Added in v0.118.0.';
+COMMENT ON COLUMN metadata.notification_archive.html_body IS
+    'HTML as delivered, including engagement-tracking links and pixel when the template tracks engagement.';
+
+ALTER TABLE metadata.notification_archive ENABLE ROW LEVEL SECURITY;
+-- No policies: only SECURITY DEFINER functions and the worker read it
+
+-- Records must not change after the fact. Deletes stay possible for
+-- retention schedules.
+CREATE OR REPLACE FUNCTION metadata.prevent_notification_archive_update()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    RAISE EXCEPTION 'notification_archive rows cannot be modified';
+END;
+$$;
+
+CREATE TRIGGER notification_archive_no_update
+    BEFORE UPDATE ON metadata.notification_archive
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.prevent_notification_archive_update();
+
+
+-- ============================================================================
+-- 3. SEARCH RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.search_notification_archive(
+    p_recipient TEXT DEFAULT NULL,
+    p_template_name VARCHAR(100) DEFAULT NULL,
+    p_entity_type VARCHAR(100) DEFAULT NULL,
+    p_entity_id VARCHAR(100) DEFAULT NULL,
+    p_since TIMESTAMPTZ DEFAULT NULL,
+    p_until TIMESTAMPTZ DEFAULT NULL,
+    p_limit INT DEFAULT 100,
+    p_offset INT DEFAULT 0
+)
+RETURNS SETOF metadata.notification_archive
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.has_permission('notification_content', 'read') THEN
+        RAISE EXCEPTION 'Missing notification_content:read permission'
+            USING HINT = 'Contact administrator to grant notification content permissions';
+    END IF;
+
+    RETURN QUERY
+    SELECT a.*
+    FROM metadata.notification_archive a
+    WHERE (p_recipient IS NULL OR p_recipient = ''
+           OR lower(p_recipient) = ANY (SELECT lower(r) FROM unnest(a.recipients || a.cc) r))
+      AND (p_template_name IS NULL OR a.template_name = p_template_name)
+      AND (p_entity_type IS NULL OR a.entity_type = p_entity_type)
+      AND (p_entity_id IS NULL OR a.entity_id = p_entity_id)
+      AND (p_since IS NULL OR a.sent_at >= p_since)
+      AND (p_until IS NULL OR a.sent_at < p_until)
+    ORDER BY a.sent_at DESC, a.id DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000)
+    OFFSET GREATEST(p_offset, 0);
+END;
+$$;
+
+COMMENT ON FUNCTION public.search_notification_archive IS
+    'Archived messages by recipient address (exact, case-insensitive, TO or CC), template, entity and date range, newest first, with their full rendered content. Requires notification_content:read. Added in v0.118.0.';
+
+REVOKE EXECUTE ON FUNCTION public.search_notification_archive FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.search_notification_archive TO authenticated;
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notification_templates,notification_archive}',
+   '{archive_rendered}',
+   'v0-118-0-notification-archive',
+   'Archive rendered notifications for records requests',
+   'accepted',
+   'Public records (FOIA) requests ask for the messages an agency sent. metadata.notifications holds the template name and entity data, and re-rendering them later gives a different message once the template or the formatting code changes. notification_log (v0.84.0) keeps the subject and text but not the HTML, is overwritten on retries and is deleted with the notification; send_email jobs have no notification at all.',
+   'Templates opt in with archive_rendered. After a successful send, the notification and send_email workers insert the rendered subject, HTML, text and SMS body as delivered into metadata.notification_archive, with recipients, CC, channels and attachment names. Rows have no foreign key to notifications, a unique index keeps one row per notification, and a trigger rejects updates. search_notification_archive() requires notification_content:read.',
+   'Storing the rendered output is the only way to reproduce exactly what was sent. Keeping it in Postgres rather than S3 puts it in the same backups and permission model as the rest of the records and makes it searchable; rendered emails are small next to their attachments, which are already stored files and are referenced by name.',
+   'Archiving is off by default and not retroactive. Messages accumulate until an administrator deletes them per the retention schedule. An archive write that fails is logged and not retried, since retrying the job would send the message again.');
+
+COMMIT;
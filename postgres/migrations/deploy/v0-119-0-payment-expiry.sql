@@ -0,0 +1,111 @@
+-- Deploy civic_os:v0-119-0-payment-expiry to pg
+-- requires: v0-118-0-notification-archive
+--
+-- v0.119.0 — Expire abandoned payments:
+--   1. New 'expired' status for payments left pending at checkout
+--   2. check_existing_payment treats 'expired' like 'canceled' (retryable)
+--   3. Partial index for the payment worker's expiry sweep
+--   4. Record schema decision
+--
+-- A payer who closes the checkout form leaves the transaction pending, and
+-- the entity keeps reusing it. The payment worker's expire_abandoned_payments
+-- job cancels the provider payment after PAYMENT_EXPIRY_HOURS and moves the
+-- row to 'expired'. Flow: pending_intent/pending → expired, or → succeeded
+-- if the payer completes checkout after all.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. EXPIRED STATUS
+-- ============================================================================
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_status;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_status CHECK (status IN (
+    'pending_intent',    -- Initial state, waiting for worker to create provider intent
+    'pending',           -- Intent created, waiting for customer confirmation
+    'processing',        -- Customer confirmed, funds not yet settled (ACH debits)
+    'requires_capture',  -- Card authorized, waiting for staff to capture or void (manual capture)
+    'succeeded',         -- Payment succeeded
+    'failed',            -- Payment failed
+    'canceled',          -- Payment canceled (includes voided authorizations)
+    'expired'            -- Checkout abandoned; expired by the payment worker
+));
+
+
+-- ============================================================================
+-- 2. check_existing_payment: EXPIRED IS RETRYABLE
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION payments.check_existing_payment(
+    p_payment_id UUID
+)
+RETURNS TEXT
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+    v_payment_status TEXT;
+BEGIN
+    -- No existing payment - create new
+    IF p_payment_id IS NULL THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Get status of existing payment
+    SELECT status INTO v_payment_status
+    FROM payments.transactions
+    WHERE id = p_payment_id;
+
+    -- Payment not found (shouldn't happen if FK constraint exists, but be defensive)
+    IF NOT FOUND THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment in progress - reuse existing PaymentIntent
+    IF v_payment_status IN ('pending_intent', 'pending') THEN
+        RETURN 'reuse';
+    END IF;
+
+    -- Payment failed, canceled or expired - allow retry with NEW transaction
+    -- Important: Don't modify old transaction, it stays as audit trail
+    IF v_payment_status IN ('failed', 'canceled', 'expired') THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment succeeded, settling, or authorized - prevent duplicate charge
+    IF v_payment_status IN ('succeeded', 'processing', 'requires_capture') THEN
+        RETURN 'duplicate';
+    END IF;
+
+    -- Unknown status - fail safe
+    RAISE EXCEPTION 'Unexpected payment status: %', v_payment_status;
+END;
+$$;
+
+
+-- ============================================================================
+-- 3. SWEEP INDEX
+-- ============================================================================
+
+CREATE INDEX idx_payments_transactions_pending_updated ON payments.transactions(updated_at)
+    WHERE status IN ('pending_intent', 'pending');
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{transactions}',
+   '{status}',
+   'v0-119-0-payment-expiry',
+   'Expire payments abandoned at checkout',
+   'accepted',
+   'A payer who closes the Stripe Elements form leaves the transaction pending with a live PaymentIntent. Nothing ever moved these rows on: they accumulated forever, cluttered payment reports, and check_existing_payment kept returning reuse for an intent the payer had walked away from.',
+   'The payment worker enqueues expire_abandoned_payments every PAYMENT_EXPIRY_INTERVAL_MINUTES. It selects one-off payments in pending_intent or pending whose row has not changed for PAYMENT_EXPIRY_HOURS and that have no create_payment_intent job in flight. For Stripe it cancels the PaymentIntent, then moves the row to a new expired status, guarded on the row still being pending. check_existing_payment returns create_new for expired. The webhook handler keeps an expired row expired on payment_intent.canceled, but still applies a late succeeded (the payer was charged) and notes a possible duplicate in error_message.',
+   'Running the sweep in the payment worker keeps provider calls out of database transactions, as for capture and void. A status separate from canceled tells staff the payer never finished rather than that someone canceled. Stripe refuses to cancel a PaymentIntent that has already succeeded, which closes the race with a payer finishing at the last moment.',
+   'Square payment links and PayPal orders are only marked expired: those providers lapse them on their own, and a late success webhook still marks the row succeeded. Subscription invoices are never expired; Stripe handles incomplete subscriptions. The generated display_name shows EXPIRED for these rows.');
+
+COMMIT;
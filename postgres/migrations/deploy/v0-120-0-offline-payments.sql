@@ -0,0 +1,264 @@
+-- Deploy civic_os:v0-120-0-offline-payments to pg
+-- requires: v0-119-0-payment-expiry
+--
+-- v0.120.0 — Cash, check and money order payments taken at a counter:
+--   1. 'offline' provider with cash, check and money_order payment methods
+--   2. offline_reference, received_at and recorded_by columns
+--   3. payment_transactions:create permission (granted to admin)
+--   4. public.record_offline_payment() inserts a pending offline payment and
+--      enqueues a record_offline_payment job for the payment worker
+--   5. payment_transactions view exposes the payment method and offline
+--      columns
+--   6. Record schema decision
+--
+-- Counter payments were kept in a separate spreadsheet, so payments.
+-- transactions only held card and bank payments. Recording them as
+-- transactions gives them receipt numbers, the PDF receipt and the
+-- payment_succeeded email, and one ledger for reporting. Flow: pending →
+-- succeeded once the worker validates and links the payment, or failed.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. OFFLINE PROVIDER AND METHODS
+-- ============================================================================
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_provider;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_provider
+    CHECK (provider IN ('stripe', 'square', 'paypal', 'offline'));
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_payment_method;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_payment_method
+    CHECK ((provider = 'offline' AND payment_method IN ('cash', 'check', 'money_order'))
+           OR (provider != 'offline' AND payment_method IN ('card', 'us_bank_account')
+               AND (payment_method = 'card' OR provider = 'stripe')));
+
+COMMENT ON COLUMN payments.transactions.provider IS
+    'Payment processor for this transaction (stripe, square, paypal), or offline for cash, check and money order payments recorded by staff (v0.120.0). The payment worker routes intent creation, refunds and webhooks by this value; the provider must be configured in the worker environment.';
+COMMENT ON COLUMN payments.transactions.payment_method IS
+    'Payment method: card (default) or us_bank_account (ACH debit, Stripe only) at checkout; cash, check or money_order for offline payments. Bank debits pass through the processing status while they settle.';
+
+
+-- ============================================================================
+-- 2. OFFLINE PAYMENT COLUMNS
+-- ============================================================================
+
+ALTER TABLE payments.transactions
+    ADD COLUMN offline_reference TEXT CHECK (length(offline_reference) <= 100),
+    ADD COLUMN received_at TIMESTAMPTZ,
+    ADD COLUMN recorded_by UUID REFERENCES metadata.civic_os_users(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN payments.transactions.offline_reference IS
+    'Check number or money order serial of an offline payment; optional for cash. Added in v0.120.0.';
+COMMENT ON COLUMN payments.transactions.received_at IS
+    'When staff took an offline payment; shown as the payment date on its receipt. Added in v0.120.0.';
+COMMENT ON COLUMN payments.transactions.recorded_by IS
+    'Staff member who recorded an offline payment. Added in v0.120.0.';
+
+
+-- ============================================================================
+-- 3. PERMISSION
+-- ============================================================================
+
+INSERT INTO metadata.permissions (table_name, permission)
+VALUES ('payment_transactions', 'create')  -- Record offline payments
+ON CONFLICT (table_name, permission) DO NOTHING;
+
+INSERT INTO metadata.permission_roles (role_id, permission_id)
+SELECT r.id, p.id
+FROM metadata.roles r
+CROSS JOIN metadata.permissions p
+WHERE r.display_name = 'admin'
+  AND p.table_name = 'payment_transactions'
+  AND p.permission = 'create'
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+
+
+-- ============================================================================
+-- 4. record_offline_payment() RPC
+-- ============================================================================
+-- The payment row is inserted as pending so it shows up at once. The
+-- record_offline_payment job checks the reference, links the payment to the
+-- entity and moves it to succeeded, which numbers the receipt and enqueues
+-- generate_receipt like any other payment.
+
+CREATE OR REPLACE FUNCTION public.record_offline_payment(
+    p_user_id UUID,
+    p_amount NUMERIC(10,2),
+    p_payment_method TEXT,
+    p_reference TEXT DEFAULT NULL,
+    p_description TEXT DEFAULT NULL,
+    p_entity_type NAME DEFAULT NULL,
+    p_entity_id TEXT DEFAULT NULL,
+    p_payment_column NAME DEFAULT NULL,
+    p_received_at TIMESTAMPTZ DEFAULT NOW()
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment_id UUID;
+BEGIN
+    IF current_user_id() IS NULL THEN
+        RAISE EXCEPTION 'Authentication required';
+    END IF;
+
+    IF NOT public.has_permission('payment_transactions', 'create') THEN
+        RAISE EXCEPTION 'Missing payment_transactions:create permission'
+            USING HINT = 'Contact administrator to grant offline payment permissions';
+    END IF;
+
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid payment amount: %. Amount must be greater than zero.', p_amount;
+    END IF;
+
+    IF p_payment_method IS NULL OR p_payment_method NOT IN ('cash', 'check', 'money_order') THEN
+        RAISE EXCEPTION 'Offline payment method must be cash, check or money_order (got: %)', p_payment_method;
+    END IF;
+
+    IF (p_entity_type IS NULL) != (p_entity_id IS NULL) THEN
+        RAISE EXCEPTION 'p_entity_type and p_entity_id must be given together';
+    END IF;
+
+    IF p_payment_column IS NOT NULL AND p_entity_type IS NULL THEN
+        RAISE EXCEPTION 'p_payment_column needs p_entity_type and p_entity_id';
+    END IF;
+
+    -- Not pending_intent, so no create_payment_intent job is enqueued
+    INSERT INTO payments.transactions (
+        user_id,
+        amount,
+        currency,
+        status,
+        description,
+        provider,
+        payment_method,
+        offline_reference,
+        received_at,
+        recorded_by,
+        entity_type,
+        entity_id
+    ) VALUES (
+        p_user_id,
+        p_amount,
+        'USD',
+        'pending',
+        p_description,
+        'offline',
+        p_payment_method,
+        NULLIF(TRIM(p_reference), ''),
+        COALESCE(p_received_at, NOW()),
+        current_user_id(),
+        p_entity_type::TEXT,
+        p_entity_id
+    ) RETURNING id INTO v_payment_id;
+
+    INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+    VALUES (
+        'available',
+        'default',
+        'record_offline_payment',
+        jsonb_build_object('payment_id', v_payment_id, 'payment_column', p_payment_column),
+        1,
+        3,
+        NOW()
+    );
+
+    RETURN v_payment_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.record_offline_payment IS
+    'Record a cash, check or money order payment taken by staff. Requires payment_transactions:create permission. Inserts a pending offline payment and enqueues a record_offline_payment job, which validates it, links it to p_payment_column on the entity (optional) and marks it succeeded, generating the receipt and payment_succeeded email. Returns the payment ID. Added in v0.120.0.';
+
+REVOKE EXECUTE ON FUNCTION public.record_offline_payment FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.record_offline_payment TO authenticated;
+
+
+-- ============================================================================
+-- 5. EXPOSE OFFLINE COLUMNS IN payment_transactions VIEW
+-- ============================================================================
+-- Same definition as v0-78-0-subscriptions.sql with the payment method and
+-- offline columns appended (CREATE OR REPLACE VIEW can only add columns at
+-- the end).
+
+CREATE OR REPLACE VIEW public.payment_transactions AS
+SELECT
+    t.id,
+    t.user_id,
+    u.display_name AS user_display_name,
+    u.full_name AS user_full_name,
+    u.email AS user_email,
+    t.amount,
+    t.processing_fee,
+    t.total_amount,
+    t.max_refundable,
+    t.fee_percent,
+    t.fee_flat_cents,
+    t.fee_refundable,
+    t.currency,
+    t.status,
+    t.provider_payment_id,
+    COALESCE(r_agg.total_refunded, 0) AS total_refunded,
+    COALESCE(r_agg.refund_count, 0) AS refund_count,
+    COALESCE(r_agg.pending_count, 0) AS pending_refund_count,
+    CASE
+        WHEN r_agg.total_refunded >= t.max_refundable THEN 'refunded'
+        WHEN r_agg.total_refunded > 0 THEN 'partially_refunded'
+        WHEN r_agg.pending_count > 0 THEN 'refund_pending'
+        ELSE COALESCE(t.status, 'unpaid')
+    END AS effective_status,
+    t.error_message,
+    t.provider,
+    t.provider_client_secret,
+    t.description,
+    t.display_name,
+    t.created_at,
+    t.updated_at,
+    t.entity_type,
+    t.entity_id,
+    COALESCE(e.display_name, t.entity_type) AS entity_display_name,
+    t.capture_method,
+    t.authorized_at,
+    t.capture_before,
+    t.captured_at,
+    t.subscription_id,
+    t.payment_method,
+    t.offline_reference,
+    t.received_at,
+    t.recorded_by
+FROM payments.transactions t
+LEFT JOIN public.civic_os_users u ON t.user_id = u.id
+LEFT JOIN metadata.entities e ON t.entity_type = e.table_name
+LEFT JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(amount) FILTER (WHERE status = 'succeeded'), 0) AS total_refunded,
+        COUNT(*) FILTER (WHERE status = 'succeeded') AS refund_count,
+        COUNT(*) FILTER (WHERE status = 'pending') AS pending_count
+    FROM payments.refunds
+    WHERE transaction_id = t.id
+) r_agg ON true;
+
+GRANT SELECT ON public.payment_transactions TO authenticated, web_anon;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{transactions}',
+   '{provider,payment_method,offline_reference,received_at,recorded_by}',
+   'v0-120-0-offline-payments',
+   'Record cash, check and money order payments as transactions',
+   'accepted',
+   'Residents who pay at the counter were tracked outside Civic OS. Their records stayed unpaid, they got no receipt, and revenue reports had to merge two ledgers.',
+   'Offline payments are payments.transactions rows with provider offline and payment method cash, check or money_order, plus the check or money order number, when the payment was received and the staff member who recorded it. record_offline_payment() (payment_transactions:create) inserts the row as pending and enqueues a record_offline_payment job. The payment worker requires a reference for checks and money orders and rejects future or stale dates. If asked, it links the payment to the entity''s payment column, refusing records that are already paid or have an online payment in progress. It then moves the row to succeeded.',
+   'Going through succeeded like an online payment reuses the receipt number trigger, the generate_receipt job and the payment_succeeded email unchanged. Validation and linking run in the payment worker so every payment channel settles in one place, and an invalid entry ends as a failed transaction with the reason instead of an RPC error lost at the counter.',
+   'Offline payments have no processing fee and no provider to refund through: refunds must be paid out by hand. A bounced check is not modeled; staff mark the record unpaid themselves. Only USD is supported, as for other payments.');
+
+COMMIT;
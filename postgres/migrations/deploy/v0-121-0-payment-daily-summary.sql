@@ -0,0 +1,281 @@
+-- Deploy civic_os:v0-121-0-payment-daily-summary to pg
+-- requires: v0-120-0-offline-payments
+--
+-- v0.121.0 — Daily financial summary:
+--   1. payments.transactions.succeeded_at, stamped by a trigger when a
+--      payment succeeds
+--   2. payments.disputes, recorded from Stripe charge.dispute.* webhooks
+--   3. payments.daily_summaries (one row per day and payment category) and
+--      payments.daily_summary_runs (one row per day summarized)
+--   4. payment_daily_summary notification template
+--   5. public.payment_daily_summaries view
+--   6. Record schema decision
+--
+-- The payment worker's payment_daily_summary job totals the previous day
+-- (in PAYMENT_SUMMARY_TIMEZONE) once the day is over, stores the rollup and
+-- emails it to PAYMENT_SUMMARY_NOTIFY_ROLES. Finance staff reconciled the
+-- bank deposit against an export of payment_transactions by hand; updated_at
+-- moves with every refund, so the export couldn't say when a payment was
+-- actually taken.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SUCCEEDED TIMESTAMP
+-- ============================================================================
+
+ALTER TABLE payments.transactions
+    ADD COLUMN succeeded_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN payments.transactions.succeeded_at IS
+    'When the payment moved to succeeded, set by the stamp_succeeded_at trigger. Payments that succeeded before v0.121.0 carry their best earlier timestamp. Added in v0.121.0.';
+
+-- Best available time for existing payments
+UPDATE payments.transactions
+SET succeeded_at = COALESCE(captured_at, received_at, receipt_generated_at, updated_at)
+WHERE status = 'succeeded';
+
+CREATE INDEX idx_transactions_succeeded_at
+    ON payments.transactions(succeeded_at)
+    WHERE succeeded_at IS NOT NULL;
+
+-- Subscription renewals are inserted already succeeded, so this fires on
+-- INSERT as well as on status updates
+CREATE OR REPLACE FUNCTION payments.stamp_succeeded_at()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SET search_path = payments, public
+AS $$
+BEGIN
+    IF NEW.status = 'succeeded' AND NEW.succeeded_at IS NULL
+       AND (TG_OP = 'INSERT' OR OLD.status IS DISTINCT FROM 'succeeded') THEN
+        NEW.succeeded_at := NOW();
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.stamp_succeeded_at() IS
+    'Trigger function setting succeeded_at when a payment is inserted as, or moves to, succeeded. Added in v0.121.0.';
+
+CREATE TRIGGER stamp_succeeded_at
+    BEFORE INSERT OR UPDATE OF status ON payments.transactions
+    FOR EACH ROW
+    EXECUTE FUNCTION payments.stamp_succeeded_at();
+
+
+-- ============================================================================
+-- 2. DISPUTES
+-- ============================================================================
+
+CREATE TABLE payments.disputes (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id UUID REFERENCES payments.transactions(id) ON DELETE RESTRICT,
+    provider TEXT NOT NULL,
+    provider_dispute_id TEXT NOT NULL,
+    provider_payment_id TEXT,
+    amount_cents BIGINT NOT NULL,
+    currency TEXT NOT NULL,
+    reason TEXT,
+    status TEXT NOT NULL,  -- Stripe dispute status: warning_needs_response, needs_response, under_review, won, lost, ...
+    opened_at TIMESTAMPTZ NOT NULL,
+    closed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, provider_dispute_id)
+);
+
+CREATE INDEX idx_disputes_transaction ON payments.disputes(transaction_id);
+CREATE INDEX idx_disputes_opened_at ON payments.disputes(opened_at);
+
+COMMENT ON TABLE payments.disputes IS
+    'Chargebacks and inquiries raised by payers'' banks, recorded from charge.dispute.* webhooks. transaction_id is NULL for disputes on payments Civic OS did not create. Added in v0.121.0.';
+COMMENT ON COLUMN payments.disputes.closed_at IS
+    'When the dispute reached won or lost.';
+
+ALTER TABLE payments.disputes ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 3. DAILY SUMMARIES
+-- ============================================================================
+
+CREATE TABLE payments.daily_summaries (
+    summary_date DATE NOT NULL,
+    category TEXT NOT NULL,
+    payment_count INT NOT NULL DEFAULT 0,
+    gross_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    processing_fees NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    refund_count INT NOT NULL DEFAULT 0,
+    refunded_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    dispute_count INT NOT NULL DEFAULT 0,
+    disputed_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    net_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (summary_date, category)
+);
+
+COMMENT ON TABLE payments.daily_summaries IS
+    'Payments, refunds and disputes per day and payment category (fee_category, then entity_type, else uncategorized), written by the payment_daily_summary job. Days are calendar days in PAYMENT_SUMMARY_TIMEZONE. Added in v0.121.0.';
+COMMENT ON COLUMN payments.daily_summaries.gross_amount IS
+    'Base amount of payments that succeeded that day, before processing fees.';
+COMMENT ON COLUMN payments.daily_summaries.processing_fees IS
+    'Processing fees charged to payers on those payments. Fees the provider keeps are not known to Civic OS.';
+COMMENT ON COLUMN payments.daily_summaries.disputed_amount IS
+    'Amount under disputes opened that day, whatever their outcome.';
+COMMENT ON COLUMN payments.daily_summaries.net_amount IS
+    'gross_amount + processing_fees - refunded_amount. Disputes are reported separately because most are still open.';
+
+ALTER TABLE payments.daily_summaries ENABLE ROW LEVEL SECURITY;
+
+CREATE TABLE payments.daily_summary_runs (
+    summary_date DATE PRIMARY KEY,
+    timezone TEXT NOT NULL,
+    generated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    recipient_count INT NOT NULL DEFAULT 0
+);
+
+COMMENT ON TABLE payments.daily_summary_runs IS
+    'Days the payment_daily_summary job has summarized, including days without activity, so each day is summarized and emailed once. Delete a row (or enqueue the job with {"date": "YYYY-MM-DD"}) to summarize a day again. Added in v0.121.0.';
+
+ALTER TABLE payments.daily_summary_runs ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 4. NOTIFICATION TEMPLATE
+-- ============================================================================
+
+INSERT INTO metadata.notification_templates (
+    name,
+    description,
+    entity_type,
+    subject_template,
+    html_template,
+    text_template
+) VALUES (
+    'payment_daily_summary',
+    'Sent to PAYMENT_SUMMARY_NOTIFY_ROLES each morning with the previous day''s payments. Template variables: Entity.summary_date, Entity.currency, Entity.payment_count, Entity.gross_amount, Entity.processing_fees, Entity.refund_count, Entity.refunded_amount, Entity.dispute_count, Entity.disputed_amount, Entity.net_amount, and Entity.categories (a list with the same fields plus category); Metadata.site_url, Metadata.site_name.',
+    NULL,  -- report, not entity-specific
+    -- Subject
+    '[{{.Metadata.site_name}}] Payments for {{.Entity.summary_date}}: {{.Entity.net_amount}} {{.Entity.currency}} net',
+    -- HTML Template
+    '<div style="font-family: sans-serif; max-width: 640px; margin: 0 auto;">
+        <h2>Payments for {{.Entity.summary_date}}</h2>
+        <table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Payments:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Entity.payment_count}}</td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Entity.gross_amount}} {{.Entity.currency}}</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Processing fees:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Entity.processing_fees}} {{.Entity.currency}}</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Refunds:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Entity.refund_count}}</td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; text-align: right;">-{{.Entity.refunded_amount}} {{.Entity.currency}}</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Net:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; text-align: right;"><strong>{{.Entity.net_amount}} {{.Entity.currency}}</strong></td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>New disputes:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Entity.dispute_count}}</td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Entity.disputed_amount}} {{.Entity.currency}}</td>
+            </tr>
+        </table>
+        {{if .Entity.categories}}
+        <h3>By category</h3>
+        <table style="width: 100%; border-collapse: collapse; font-size: 14px;">
+            <tr>
+                <th style="padding: 6px; border-bottom: 2px solid #e5e7eb; text-align: left;">Category</th>
+                <th style="padding: 6px; border-bottom: 2px solid #e5e7eb; text-align: right;">Payments</th>
+                <th style="padding: 6px; border-bottom: 2px solid #e5e7eb; text-align: right;">Fees</th>
+                <th style="padding: 6px; border-bottom: 2px solid #e5e7eb; text-align: right;">Refunds</th>
+                <th style="padding: 6px; border-bottom: 2px solid #e5e7eb; text-align: right;">Disputes</th>
+                <th style="padding: 6px; border-bottom: 2px solid #e5e7eb; text-align: right;">Net</th>
+            </tr>
+            {{range .Entity.categories}}
+            <tr>
+                <td style="padding: 6px; border-bottom: 1px solid #e5e7eb;">{{.category}}</td>
+                <td style="padding: 6px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.payment_count}} / {{.gross_amount}}</td>
+                <td style="padding: 6px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.processing_fees}}</td>
+                <td style="padding: 6px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.refund_count}} / {{.refunded_amount}}</td>
+                <td style="padding: 6px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.dispute_count}} / {{.disputed_amount}}</td>
+                <td style="padding: 6px; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.net_amount}}</td>
+            </tr>
+            {{end}}
+        </table>
+        {{else}}
+        <p>No payments, refunds or disputes.</p>
+        {{end}}
+        <p><a href="{{.Metadata.site_url}}/admin/payments">{{.Metadata.site_url}}/admin/payments</a></p>
+    </div>',
+    -- Text Template
+    'Payments for {{.Entity.summary_date}}
+
+Payments:        {{.Entity.payment_count}}  {{.Entity.gross_amount}} {{.Entity.currency}}
+Processing fees:     {{.Entity.processing_fees}} {{.Entity.currency}}
+Refunds:         {{.Entity.refund_count}}  -{{.Entity.refunded_amount}} {{.Entity.currency}}
+Net:                 {{.Entity.net_amount}} {{.Entity.currency}}
+New disputes:    {{.Entity.dispute_count}}  {{.Entity.disputed_amount}} {{.Entity.currency}}
+{{range .Entity.categories}}
+{{.category}}: {{.payment_count}} payments {{.gross_amount}}, fees {{.processing_fees}}, {{.refund_count}} refunds {{.refunded_amount}}, {{.dispute_count}} disputes {{.disputed_amount}}, net {{.net_amount}}{{end}}
+
+{{.Metadata.site_url}}/admin/payments'
+)
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    subject_template = EXCLUDED.subject_template,
+    html_template = EXCLUDED.html_template,
+    text_template = EXCLUDED.text_template;
+
+
+-- ============================================================================
+-- 5. PUBLIC VIEW
+-- ============================================================================
+
+CREATE OR REPLACE VIEW public.payment_daily_summaries AS
+SELECT
+    s.summary_date,
+    s.category,
+    COALESCE(e.display_name, s.category) AS category_display_name,
+    s.payment_count,
+    s.gross_amount,
+    s.processing_fees,
+    s.refund_count,
+    s.refunded_amount,
+    s.dispute_count,
+    s.disputed_amount,
+    s.net_amount
+FROM payments.daily_summaries s
+LEFT JOIN metadata.entities e ON e.table_name = s.category
+WHERE public.has_permission('payment_transactions', 'read');
+
+COMMENT ON VIEW public.payment_daily_summaries IS
+    'Daily payment rollups per category. Requires payment_transactions:read. Added in v0.121.0.';
+
+GRANT SELECT ON public.payment_daily_summaries TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{transactions,disputes,daily_summaries}',
+   '{succeeded_at}',
+   'v0-121-0-payment-daily-summary',
+   'Summarize each day''s payments for finance in the payment worker',
+   'accepted',
+   'Finance reconciles each day''s deposits against Civic OS by exporting payment_transactions and totalling by hand. Refunds and fees have to be matched up separately, updated_at moves whenever a payment is refunded, and disputes were not recorded at all.',
+   'A payment_daily_summary job in the payment worker, enqueued hourly like the other payment jobs, totals the previous calendar day in PAYMENT_SUMMARY_TIMEZONE: payments by succeeded_at, refunds by processed_at and disputes by opened_at, per payment category. It writes payments.daily_summaries, records the day in daily_summary_runs and sends payment_daily_summary to PAYMENT_SUMMARY_NOTIFY_ROLES. Stripe charge.dispute.* webhooks now fill payments.disputes.',
+   'The category is the one fee schedules and payout routes already use (fee_category, then entity_type), so the summary lines up with how money is split. Storing the rollup lets finance look back at what was reported on a given morning, even after later refunds. The run table makes the job idempotent across restarts and replicas without relying on River job retention.',
+   'Reports are in the single PAYMENT_CURRENCY. Provider fees are not included, because the provider reports them only in its own balance transactions. A day is summarized once: refunds or disputes recorded late count on the day they are processed, not the day of the payment. Payments that succeeded before v0.121.0 use captured_at, received_at, receipt_generated_at or updated_at as their succeeded_at.');
+
+COMMIT;
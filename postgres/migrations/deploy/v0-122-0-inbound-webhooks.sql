@@ -0,0 +1,98 @@
+-- Deploy civic_os:v0-122-0-inbound-webhooks to pg
+-- requires: v0-121-0-payment-daily-summary
+--
+-- v0.122.0 — Inbound webhook receiver in the consolidated worker:
+--   1. metadata.webhooks holds events from every inbound source, not only
+--      payment providers
+--   2. metadata.delivery_events: email and SMS delivery reports from
+--      SendGrid and Telnyx
+--   3. public.delivery_events admin view
+--   4. Record schema decision
+--
+-- Provider callbacks (Telnyx delivery receipts, SendGrid events, DocuSign
+-- Connect) were never received: SMS and email delivery stopped at "handed to
+-- the provider", and signed envelopes waited for the next signature poll.
+-- The consolidated worker now serves POST /webhooks/{source} on
+-- WEBHOOK_RECEIVER_PORT, verifies each source's signature, stores the event
+-- here and queues a job to process it.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. WEBHOOK STORE
+-- ============================================================================
+
+COMMENT ON TABLE metadata.webhooks IS
+    'Webhook events from external providers (payments, SMS, email, e-signature). Deduplicated by (provider, provider_event_id). Payment providers post to the payment worker; the consolidated worker''s receiver takes every source and queues a job per stored event. Receiver added in v0.122.0.';
+
+
+-- ============================================================================
+-- 2. DELIVERY EVENTS
+-- ============================================================================
+
+CREATE TABLE metadata.delivery_events (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id UUID REFERENCES metadata.webhooks(id) ON DELETE SET NULL,
+    channel VARCHAR(10) NOT NULL CHECK (channel IN ('email', 'sms')),
+    provider TEXT NOT NULL,
+    provider_message_id TEXT,           -- SendGrid sg_message_id, Telnyx message ID
+    recipient TEXT NOT NULL,            -- Email address or E.164 phone number
+    event TEXT NOT NULL,                -- Provider's name: 'delivered', 'bounce', 'delivery_failed', ...
+    reason TEXT,                        -- Bounce reason or carrier error, when given
+    occurred_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A reprocessed webhook records each recipient once
+CREATE UNIQUE INDEX idx_delivery_events_webhook_recipient
+    ON metadata.delivery_events(webhook_id, recipient)
+    WHERE webhook_id IS NOT NULL;
+CREATE INDEX idx_delivery_events_recipient
+    ON metadata.delivery_events(recipient, occurred_at DESC);
+CREATE INDEX idx_delivery_events_occurred_at
+    ON metadata.delivery_events(occurred_at DESC);
+
+COMMENT ON TABLE metadata.delivery_events IS
+    'Delivery reports for sent email (SendGrid Event Webhook) and SMS (Telnyx message webhooks), written by the consolidated worker''s email_event_webhook and sms_delivery_webhook jobs. Added in v0.122.0.';
+COMMENT ON COLUMN metadata.delivery_events.event IS
+    'Event or status as the provider names it, e.g. delivered, bounce, dropped, spamreport (SendGrid) or delivered, delivery_failed, sending_failed (Telnyx).';
+
+ALTER TABLE metadata.delivery_events ENABLE ROW LEVEL SECURITY;
+-- No policies: the worker writes it, admins read it through the view
+
+
+-- ============================================================================
+-- 3. ADMIN VIEW
+-- ============================================================================
+
+-- Runs as the view owner, since authenticated has no access to the table
+CREATE VIEW public.delivery_events AS
+SELECT e.id, e.channel, e.provider, e.provider_message_id, e.recipient, e.event,
+       e.reason, e.occurred_at, e.created_at
+FROM metadata.delivery_events e
+WHERE metadata.is_admin();
+
+COMMENT ON VIEW public.delivery_events IS
+    'Email and SMS delivery reports from the providers, admin-only. Added in v0.122.0.';
+
+GRANT SELECT ON public.delivery_events TO authenticated;
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{webhooks,delivery_events,signature_requests}',
+   NULL,
+   'v0-122-0-inbound-webhooks',
+   'Receive provider webhooks in the consolidated worker',
+   'accepted',
+   'Only the payment worker accepted webhooks, with one hand-written endpoint per payment provider. SMS and email providers report delivery, bounces and failures only through callbacks, so Civic OS knew a message was handed off but not whether it arrived. DocuSign completions were found by polling every few minutes.',
+   'The consolidated worker serves POST /webhooks/{source} on WEBHOOK_RECEIVER_PORT. Each source (stripe, telnyx, sendgrid, docusign) verifies its provider''s signature, splits the body into events, and names the job that processes one. The receiver stores each new event in metadata.webhooks and queues its job in the same transaction: reprocess_webhook in the payment worker for Stripe, sms_delivery_webhook and email_event_webhook writing metadata.delivery_events, and signature_webhook applying the envelope state the way the signature poll does.',
+   'metadata.webhooks already deduplicates by provider event ID and records processing errors, and the payment worker''s reprocess_webhook job already processes a stored Stripe event, so Stripe can move without changing payment handling. Answering the provider once the event is stored keeps responses fast and lets River retry processing without the provider redelivering.',
+   'A source is enabled by its verification key; without one its path returns 404. The payment worker''s own webhook endpoints stay for Square and PayPal and for deployments that keep Stripe there; both store into the same table, so an event received by both is processed once. Delivery events are not yet tied to a notification: the providers report their own message IDs, which the senders do not record.');
+
+COMMIT;
@@ -0,0 +1,42 @@
+-- Deploy civic_os:v0-123-0-scheduler-leader to pg
+-- requires: v0-122-0-inbound-webhooks
+--
+-- v0.123.0 — Scheduled jobs are queued once, by one leading replica:
+--   1. metadata.scheduled_jobs.last_queued_at: the scheduler's claim on a run
+--   2. Record schema decision
+--
+-- Every consolidated-worker replica ran the scheduled-job ticker and relied on
+-- River's unique insert to drop the duplicates. Replicas now elect a leader
+-- with a session advisory lock, and the leader claims each run by moving
+-- last_queued_at forward in the transaction that queues it.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. RUN CLAIM
+-- ============================================================================
+
+ALTER TABLE metadata.scheduled_jobs ADD COLUMN last_queued_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN metadata.scheduled_jobs.last_queued_at IS
+    'When the scheduler last queued a run. Set only if unchanged since the scheduler read it, in the same transaction as the job insert, so a due time is queued once. The next run is due after the later of this and last_run_at. Added in v0.123.0.';
+
+
+-- ============================================================================
+-- 2. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{scheduled_jobs}',
+   '{last_queued_at}',
+   'v0-123-0-scheduler-leader',
+   'Queue each scheduled job run once, from one leading replica',
+   'accepted',
+   'Every consolidated-worker replica checked metadata.scheduled_jobs each minute and queued due runs. Duplicates were dropped only by River''s unique insert on (job_id, scheduled_for), which depends on both replicas computing the same due time and on the earlier job still being retained. River periodic jobs were not an option: River elects one leader per database, and the payment worker can win that election.',
+   'Consolidated-worker replicas elect their own scheduler leader with pg_try_advisory_lock on a dedicated connection; only the leader checks for due jobs, and closing or losing the connection hands the lead to another replica. The leader claims a run with UPDATE ... SET last_queued_at = now() WHERE last_queued_at IS NOT DISTINCT FROM the value it read, and inserts the job in the same transaction.',
+   'The advisory lock needs nothing beyond Postgres and is released by the server when a replica dies. Leadership alone leaves a window where an old leader finishes a tick after a new one starts; the compare-and-set claim closes it, so single execution no longer depends on River''s uniqueness window.',
+   'A run queued but not yet started is not due again, because the next due time counts from last_queued_at. River''s unique options stay on the executor jobs as a backstop. Replicas that are not leading log nothing each minute.');
+
+COMMIT;
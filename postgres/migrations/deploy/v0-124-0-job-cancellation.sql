@@ -0,0 +1,218 @@
+-- Deploy civic_os:v0-124-0-job-cancellation to pg
+-- requires: v0-123-0-scheduler-leader
+--
+-- v0.124.0 — Cooperative cancellation of long-running jobs:
+--   1. metadata.job_cancellation_requests: one request per River job, polled
+--      by the job's worker between batches
+--   2. public.request_job_cancellation() admin RPC
+--   3. public.cancel_entity_import(): the importer or an admin stops an import
+--   4. entity_imports status 'cancelled' and the summary template's wording
+--   5. Record schema decision
+--
+-- request_cancel_stuck_jobs() cancels through River, which cancels the job's
+-- context wherever it runs: the batch in flight is rolled back mid-statement
+-- and the job's own record (e.g. an entity import) is left 'importing'. A
+-- cancellation request instead asks the worker to stop at its next batch
+-- boundary; it keeps what it committed, marks its record cancelled, records
+-- what it got done on the request and ends the job as cancelled.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. CANCELLATION REQUESTS
+-- ============================================================================
+
+CREATE TABLE metadata.job_cancellation_requests (
+    id BIGSERIAL PRIMARY KEY,
+    river_job_id BIGINT NOT NULL UNIQUE,  -- no FK: river_job rows are purged
+    kind TEXT NOT NULL,
+    reason TEXT,
+    requested_by UUID,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    acknowledged_at TIMESTAMPTZ,          -- when the worker stopped
+    result JSONB                          -- what the job got done before it stopped
+);
+
+CREATE INDEX idx_job_cancellation_requests_open
+    ON metadata.job_cancellation_requests(river_job_id) WHERE acknowledged_at IS NULL;
+
+COMMENT ON TABLE metadata.job_cancellation_requests IS
+    'Requests to stop a running or queued job at its next batch boundary. The worker polls for an open request between batches, keeps what it has committed, and sets acknowledged_at and result when it stops. A request for a job that finished first stays open. Added in v0.124.0.';
+COMMENT ON COLUMN metadata.job_cancellation_requests.result IS
+    'Set by the worker when it stops, e.g. {"processed_rows": 4000, "imported_rows": 3990} for an entity import.';
+
+ALTER TABLE metadata.job_cancellation_requests ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 2. REQUEST RPC
+-- ============================================================================
+
+-- Kinds whose workers poll for requests; others must go through
+-- request_cancel_stuck_jobs()
+CREATE OR REPLACE FUNCTION public.request_job_cancellation(
+    p_job_id BIGINT,
+    p_reason TEXT DEFAULT NULL
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_kind TEXT;
+    v_state TEXT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can cancel jobs';
+    END IF;
+
+    SELECT kind, state::TEXT INTO v_kind, v_state
+    FROM metadata.river_job WHERE id = p_job_id;
+
+    IF v_kind IS NULL THEN
+        RETURN jsonb_build_object('success', false, 'message', format('Job %s not found', p_job_id));
+    END IF;
+    IF v_state NOT IN ('available', 'pending', 'retryable', 'running', 'scheduled') THEN
+        RETURN jsonb_build_object('success', false, 'message', format('Job %s is already %s', p_job_id, v_state));
+    END IF;
+    IF v_kind NOT IN ('entity_import') THEN
+        RETURN jsonb_build_object(
+            'success', false,
+            'message', format('%s jobs can''t stop between batches; use request_cancel_stuck_jobs()', v_kind)
+        );
+    END IF;
+
+    INSERT INTO metadata.job_cancellation_requests (river_job_id, kind, reason, requested_by)
+    VALUES (p_job_id, v_kind, NULLIF(TRIM(p_reason), ''), public.current_user_id())
+    ON CONFLICT (river_job_id) DO NOTHING;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'job_cancel_requested',
+        jsonb_strip_nulls(jsonb_build_object('job_id', p_job_id, 'kind', v_kind, 'reason', p_reason))
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'job_id', p_job_id,
+        'message', format('%s job %s will stop after its current batch', v_kind, p_job_id)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_job_cancellation(BIGINT, TEXT) IS
+    'Asks a queued or running job to stop at its next batch boundary, keeping what it has done. Only kinds whose workers poll metadata.job_cancellation_requests are accepted (entity_import). Admin only. Added in v0.124.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_job_cancellation(BIGINT, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_job_cancellation(BIGINT, TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 3. ENTITY IMPORT CANCELLATION
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.cancel_entity_import(
+    p_import_id BIGINT,
+    p_reason TEXT DEFAULT NULL
+)
+RETURNS JSON
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_job_id BIGINT;
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM metadata.entity_imports
+        WHERE id = p_import_id
+          AND (user_id = public.current_user_id() OR public.is_admin())
+          AND status IN ('pending', 'validating', 'importing')
+    ) THEN
+        RETURN json_build_object('success', false, 'error', 'Import not found or not running');
+    END IF;
+
+    SELECT id INTO v_job_id
+    FROM metadata.river_job
+    WHERE kind = 'entity_import'
+      AND args->>'import_id' = p_import_id::TEXT
+      AND state IN ('available', 'pending', 'retryable', 'running', 'scheduled')
+    ORDER BY id DESC
+    LIMIT 1;
+
+    IF v_job_id IS NULL THEN
+        -- Not queued yet (the listener queues it on import_requested); the
+        -- job would find the import cancelled and skip it
+        UPDATE metadata.entity_imports
+        SET status = 'cancelled', error_message = NULLIF(TRIM(p_reason), ''), completed_at = NOW()
+        WHERE id = p_import_id AND status IN ('pending', 'validating', 'importing');
+        RETURN json_build_object('success', true, 'import_id', p_import_id);
+    END IF;
+
+    INSERT INTO metadata.job_cancellation_requests (river_job_id, kind, reason, requested_by)
+    VALUES (v_job_id, 'entity_import', NULLIF(TRIM(p_reason), ''), public.current_user_id())
+    ON CONFLICT (river_job_id) DO NOTHING;
+
+    RETURN json_build_object('success', true, 'import_id', p_import_id, 'job_id', v_job_id);
+END;
+$$;
+
+COMMENT ON FUNCTION public.cancel_entity_import(BIGINT, TEXT) IS
+    'Stops an entity import after its current batch. Committed batches are kept; the import ends as cancelled with imported_rows of total_rows done and the importer gets the summary. Importer or admin only. Added in v0.124.0.';
+
+REVOKE EXECUTE ON FUNCTION public.cancel_entity_import(BIGINT, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.cancel_entity_import(BIGINT, TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 4. CANCELLED IMPORTS
+-- ============================================================================
+
+ALTER TABLE metadata.entity_imports DROP CONSTRAINT entity_imports_status_check;
+ALTER TABLE metadata.entity_imports ADD CONSTRAINT entity_imports_status_check
+    CHECK (status IN ('pending', 'validating', 'validated', 'importing', 'completed', 'failed', 'cancelled'));
+
+COMMENT ON COLUMN metadata.entity_imports.status IS
+    'pending: queued. validating: dry run in progress. validated: dry run finished, see invalid_rows and the error report. importing: rows being inserted, processed_rows of total_rows done. completed: every row processed; invalid rows were skipped. failed: see error_message. cancelled: stopped by cancel_entity_import() after processed_rows; committed rows were kept (v0.124.0).';
+
+-- "Import stopped" alongside "Import failed"; the counters already show
+-- imported_rows for anything but a finished dry run
+UPDATE metadata.notification_templates
+SET subject_template = replace(subject_template,
+        '{{else if eq .Entity.status "failed"}}Import failed',
+        '{{else if eq .Entity.status "failed"}}Import failed{{else if eq .Entity.status "cancelled"}}Import stopped'),
+    text_template = replace(text_template,
+        '{{else if eq .Entity.status "failed"}}Import failed',
+        '{{else if eq .Entity.status "failed"}}Import failed{{else if eq .Entity.status "cancelled"}}Import stopped'),
+    html_template = replace(replace(html_template,
+        '{{else if eq .Entity.status "failed"}}',
+        '{{else if or (eq .Entity.status "failed") (eq .Entity.status "cancelled")}}'),
+        '<h2 style="color: #dc2626;">Import failed</h2>',
+        '<h2 style="color: #dc2626;">{{if eq .Entity.status "cancelled"}}Import stopped{{else}}Import failed{{end}}</h2>'),
+    description = replace(description, '(validated, completed or failed)', '(validated, completed, failed or cancelled)')
+WHERE name = 'entity_import_summary';
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{job_cancellation_requests,entity_imports}',
+   '{status}',
+   'v0-124-0-job-cancellation',
+   'Stop long-running jobs between batches on request',
+   'accepted',
+   'A mistaken 10,000-row entity import could only be stopped with request_cancel_stuck_jobs(), which cancels the job''s context through River. The batch in flight was rolled back at an arbitrary statement, the import stayed ''importing'' forever, and nothing recorded how far it had got.',
+   'metadata.job_cancellation_requests holds one request per River job, made with request_job_cancellation() (admin) or cancel_entity_import() (importer or admin). Workers of cooperative kinds check for an open request before each batch. On finding one they finish their own record (an entity import becomes ''cancelled'' and the importer is told), set acknowledged_at and result on the request, and return river.JobCancel so the job is not retried.',
+   'Polling a table between batches costs one indexed query per batch and needs no change to River. Stopping at a batch boundary means everything committed is consistent and counted, which a context cancellation can''t promise.',
+   'Only kinds listed in request_job_cancellation() accept requests; entity_import is the first. A job stops only at its next batch, so a request can take up to one batch to take effect, and a request for a job that finishes first stays unacknowledged. A cancelled import''s committed rows are not removed.');
+
+COMMIT;
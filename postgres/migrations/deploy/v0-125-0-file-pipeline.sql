@@ -0,0 +1,125 @@
+-- Deploy civic_os:v0-125-0-file-pipeline to pg
+-- requires: v0-124-0-job-cancellation
+--
+-- v0.125.0 — One pipeline per uploaded file, in order:
+--   1. metadata.files step columns: upload_status, scan_status,
+--      metadata_status (thumbnail_status already exists), plus what the
+--      steps found
+--   2. insert_thumbnail_job() announces every new file on file_uploaded;
+--      the worker queues file_pipeline instead of thumbnail_generate
+--   3. public.files exposes the step statuses
+--   4. Record schema decision
+--
+-- Thumbnails were queued the moment the file row appeared, and duplicate
+-- scans from the thumbnail job, each on its own trigger or job. Nothing
+-- checked that the object had landed or scanned it before thumbnails were
+-- cut from it. The file_pipeline job (consolidated worker, s3_signer queue)
+-- now runs the steps in order: verify the upload, virus-scan and extract
+-- metadata in one read, then queue thumbnails.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. STEP COLUMNS
+-- ============================================================================
+
+-- Existing files count as verified and not scanned; new ones start pending
+ALTER TABLE metadata.files
+    ADD COLUMN upload_status TEXT NOT NULL DEFAULT 'verified'
+        CHECK (upload_status IN ('pending', 'verified', 'missing')),
+    ADD COLUMN scan_status TEXT NOT NULL DEFAULT 'skipped'
+        CHECK (scan_status IN ('pending', 'clean', 'infected', 'skipped', 'failed')),
+    ADD COLUMN scan_signature TEXT,
+    ADD COLUMN metadata_status TEXT NOT NULL DEFAULT 'skipped'
+        CHECK (metadata_status IN ('pending', 'completed', 'skipped', 'failed')),
+    ADD COLUMN content_sha256 TEXT,
+    ADD COLUMN detected_type TEXT,
+    ADD COLUMN pipeline_error TEXT;
+
+ALTER TABLE metadata.files
+    ALTER COLUMN upload_status SET DEFAULT 'pending',
+    ALTER COLUMN scan_status SET DEFAULT 'pending',
+    ALTER COLUMN metadata_status SET DEFAULT 'pending';
+
+CREATE INDEX idx_files_pipeline_pending ON metadata.files(created_at)
+    WHERE upload_status = 'pending' OR scan_status = 'pending' OR metadata_status = 'pending';
+
+COMMENT ON COLUMN metadata.files.upload_status IS
+    'Pipeline step 1. pending: not checked yet. verified: the object is in S3. missing: no object at s3_original_key; later steps are skipped. Added in v0.125.0.';
+COMMENT ON COLUMN metadata.files.scan_status IS
+    'Pipeline step 2, virus scan through clamd (CLAMAV_ADDRESS). clean, infected (the original was moved to a private quarantine/ key and s3_original_key points there), skipped (no scanner configured, the file exceeds the scanner''s limit, or uploaded before v0.125.0) or failed (the scanner was unreachable on every attempt). Added in v0.125.0.';
+COMMENT ON COLUMN metadata.files.scan_signature IS
+    'Signature name clamd reported for an infected file. Added in v0.125.0.';
+COMMENT ON COLUMN metadata.files.metadata_status IS
+    'Pipeline step 3, read in the same pass as the scan: content_sha256, detected_type and the actual file_size. Added in v0.125.0.';
+COMMENT ON COLUMN metadata.files.content_sha256 IS
+    'Hex SHA-256 of the original as stored. Added in v0.125.0.';
+COMMENT ON COLUMN metadata.files.detected_type IS
+    'MIME type sniffed from the first 512 bytes; file_type is what the browser declared. Added in v0.125.0.';
+COMMENT ON COLUMN metadata.files.pipeline_error IS
+    'Why the last pipeline step that failed or stopped the pipeline did so. Added in v0.125.0.';
+
+
+-- ============================================================================
+-- 2. PIPELINE TRIGGER
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION insert_thumbnail_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Every new file goes through the pipeline; thumbnails are its last step
+    IF NEW.upload_status = 'pending' THEN
+        PERFORM pg_notify('file_uploaded', NEW.id::TEXT);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON FUNCTION insert_thumbnail_job() IS
+    'Trigger function announcing a new file on the file_uploaded channel (payload: file ID). The consolidated worker queues file_pipeline, which verifies, scans and hashes the file and then queues thumbnail_generate. Added in v0.10.0, NOTIFY instead of a river_job insert in v0.100.0, pipeline in v0.125.0.';
+
+
+-- ============================================================================
+-- 3. PUBLIC VIEW
+-- ============================================================================
+
+CREATE OR REPLACE VIEW public.files
+  WITH (security_invoker = true)
+  AS SELECT f.id, f.entity_type, f.entity_id, f.file_name, f.file_type, f.file_size,
+            f.s3_key_prefix, f.s3_original_key,
+            f.s3_thumbnail_small_key, f.s3_thumbnail_medium_key, f.s3_thumbnail_large_key,
+            f.thumbnail_status, f.thumbnail_error, f.created_by, f.created_at, f.updated_at,
+            f.s3_bucket, f.property_name,
+            f.blurhash, f.placeholder_color,
+            c.thumbnail_small_url AS cdn_thumbnail_small_url,
+            c.thumbnail_medium_url AS cdn_thumbnail_medium_url,
+            c.thumbnail_large_url AS cdn_thumbnail_large_url,
+            c.expires_at AS cdn_urls_expire_at,
+            f.upload_status, f.scan_status, f.metadata_status
+     FROM metadata.files f
+     LEFT JOIN metadata.file_cdn_urls c ON c.file_id = f.id;
+
+NOTIFY pgrst, 'reload schema';
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{files}',
+   '{upload_status,scan_status,scan_signature,metadata_status,content_sha256,detected_type,pipeline_error}',
+   'v0-125-0-file-pipeline',
+   'Process each upload through one ordered pipeline job',
+   'accepted',
+   'A new file row notified file_uploaded and the worker queued thumbnail_generate straight away; duplicate scans were queued by the thumbnail job. No step checked that the object had arrived, files were never virus-scanned, and adding a step meant another trigger whose order relative to the others was not guaranteed.',
+   'The file_uploaded listener queues one file_pipeline job per file. It runs the steps in order and records each on its own status column: HeadObject verifies the upload (snoozing briefly if the object isn''t visible yet), one read of the original streams it to clamd when CLAMAV_ADDRESS is set while hashing it and sniffing its type, and the last step queues thumbnail_generate in the transaction that records the earlier steps. An infected original is moved to a private quarantine/ key and gets no thumbnails.',
+   'One job owning the order means a step never runs on a file an earlier step rejected, and a retried job skips the steps already recorded. Columns per step show where a file stopped without reading job history. clamd''s INSTREAM protocol needs no local file and no ClamAV libraries in the worker image.',
+   'Thumbnails start a few seconds later, after the scan. Without CLAMAV_ADDRESS scan_status is skipped and the pipeline still verifies and hashes. Files uploaded before v0.125.0 are marked verified and skipped. A scanner that stays unreachable marks scan_status failed and the pipeline continues, since the original is already readable.');
+
+COMMIT;
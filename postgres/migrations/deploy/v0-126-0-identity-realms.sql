@@ -0,0 +1,67 @@
+-- Deploy civic_os:v0-126-0-identity-realms to pg
+-- requires: v0-125-0-file-pipeline
+--
+-- v0.126.0 — One worker for several Keycloak realms:
+--   1. metadata.civic_os_users.identity_realm: the realm each user lives in
+--   2. metadata.user_provisioning.realm: the realm a new user is created in
+--   3. metadata.keycloak_user_sync_runs.realm: the realm a sync run is on
+--   4. Record schema decision
+--
+-- Some installs keep staff and residents in separate realms. The
+-- consolidated worker serves the realms in KEYCLOAK_REALMS besides
+-- KEYCLOAK_REALM; NULL in each column below means that default realm, so
+-- single-realm installs are unchanged.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. USER REALM
+-- ============================================================================
+
+ALTER TABLE metadata.civic_os_users
+    ADD COLUMN identity_realm TEXT CHECK (identity_realm <> '');
+
+COMMENT ON COLUMN metadata.civic_os_users.identity_realm IS
+    'Keycloak realm the user lives in; NULL is the worker''s default realm (KEYCLOAK_REALM). Set when the user is provisioned or synced, and read by the role, group, profile and deprovisioning jobs for the user. Added in v0.126.0.';
+
+
+-- ============================================================================
+-- 2. PROVISIONING REALM
+-- ============================================================================
+
+ALTER TABLE metadata.user_provisioning
+    ADD COLUMN realm TEXT CHECK (realm <> '');
+
+COMMENT ON COLUMN metadata.user_provisioning.realm IS
+    'Keycloak realm to create the user in; NULL is the default realm. Set it from a BEFORE INSERT trigger (e.g. by email domain) or pass realm in the provision_keycloak_user job args, which take precedence. Added in v0.126.0.';
+
+
+-- ============================================================================
+-- 3. SYNC RUN REALM
+-- ============================================================================
+
+ALTER TABLE metadata.keycloak_user_sync_runs
+    ADD COLUMN realm TEXT;
+
+COMMENT ON COLUMN metadata.keycloak_user_sync_runs.realm IS
+    'Realm the run is paging through, next_offset being its offset there; NULL is the default realm. A run covers every realm in turn. Added in v0.126.0.';
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{civic_os_users,user_provisioning}',
+   '{identity_realm,realm}',
+   'v0-126-0-identity-realms',
+   'Serve several Keycloak realms from one worker',
+   'accepted',
+   'Installs that separate staff and resident identities run two Keycloak realms, but the worker administered exactly one (KEYCLOAK_REALM). Serving the second population meant a second worker deployment pointed at the other realm, both consuming the same user_provisioning queue with no way to tell whose job a row was.',
+   'The worker keeps one admin client per realm listed in KEYCLOAK_REALMS, sharing one service account token (from KEYCLOAK_AUTH_REALM, e.g. master) with role and group ID caches per realm. Each user records identity_realm; jobs for an existing user look it up, provisioning takes the realm from its job args or user_provisioning.realm, role and group definitions are created and deleted in every realm, and the hourly user sync pages through each realm in turn within one run.',
+   'Recording the realm on the user keeps the database triggers that queue role, group and profile jobs unchanged: they still send a user ID and the worker resolves the realm. NULL for the default realm leaves single-realm installs and existing rows as they were.',
+   'A realm missing from KEYCLOAK_REALMS fails the jobs for its users until it is added. Moving a user between realms is not automated. A user found in two realms is recorded under the one synced last.');
+
+COMMIT;
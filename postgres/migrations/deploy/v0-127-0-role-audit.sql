@@ -0,0 +1,179 @@
+-- Deploy civic_os:v0-127-0-role-audit to pg
+-- requires: v0-126-0-identity-realms
+--
+-- v0.127.0 — Role drift between metadata.user_roles and Keycloak:
+--   1. metadata.role_audit_runs: one row per role_audit job
+--   2. metadata.role_drift: role mappings one side has and the other lacks,
+--      open until healed or no longer seen
+--   3. public.get_role_audit_runs() / public.get_role_drift()
+--   4. Record schema decision
+--
+-- Roles granted or taken away in the Keycloak admin console never reached
+-- the database except through the hourly keycloak_user_sync, which copied
+-- them over without a trace, and a failed assign or revoke job left the two
+-- sides apart until someone noticed. The daily role_audit job compares every
+-- user's effective realm roles with their user_roles rows, records each
+-- difference and, when ROLE_AUDIT_HEAL is set, heals it in that direction.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. AUDIT RUNS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.role_audit_runs (
+    id BIGSERIAL PRIMARY KEY,
+    river_job_id BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'completed', 'failed')),
+    heal_direction TEXT NOT NULL DEFAULT 'off'
+        CHECK (heal_direction IN ('off', 'to_database', 'to_keycloak')),
+    last_user_id UUID,
+    users_checked INT NOT NULL DEFAULT 0,
+    users_skipped INT NOT NULL DEFAULT 0,
+    drift_found INT NOT NULL DEFAULT 0,
+    drift_healed INT NOT NULL DEFAULT 0,
+    open_drift INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_role_audit_runs_started ON metadata.role_audit_runs(started_at DESC);
+CREATE INDEX idx_role_audit_runs_job ON metadata.role_audit_runs(river_job_id);
+
+COMMENT ON TABLE metadata.role_audit_runs IS
+    'One row per role_audit job. The job works through civic_os_users in ID order and snoozes between batches; last_user_id carries its progress across snoozes and retries. Added in v0.127.0.';
+COMMENT ON COLUMN metadata.role_audit_runs.heal_direction IS
+    'ROLE_AUDIT_HEAL when the run started: off only records drift, to_database makes user_roles match Keycloak, to_keycloak makes Keycloak match user_roles.';
+COMMENT ON COLUMN metadata.role_audit_runs.users_skipped IS
+    'Users left alone this run: users with Keycloak jobs still pending from Civic OS, deprovisioned users, and users missing from their realm.';
+
+ALTER TABLE metadata.role_audit_runs ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 2. ROLE DRIFT TABLE
+-- ============================================================================
+-- role_key is a Civic OS role. Keycloak roles with no metadata.roles row are
+-- the user sync's unknown_role conflicts, and Keycloak system roles are never
+-- compared.
+
+CREATE TABLE metadata.role_drift (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES metadata.civic_os_users(id) ON DELETE CASCADE,
+    role_key TEXT NOT NULL,
+    drift_type TEXT NOT NULL
+        CHECK (drift_type IN ('missing_in_keycloak', 'missing_in_database')),
+    realm TEXT,  -- the user's identity_realm; NULL is the default realm
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    resolution TEXT
+        CHECK (resolution IN ('healed_database', 'healed_keycloak', 'converged')),
+    heal_error TEXT,
+    UNIQUE (user_id, role_key, drift_type)
+);
+
+CREATE INDEX idx_role_drift_open
+    ON metadata.role_drift(last_seen_at DESC)
+    WHERE resolved_at IS NULL;
+
+COMMENT ON TABLE metadata.role_drift IS
+    'Role mappings Keycloak and metadata.user_roles disagree on. missing_in_keycloak: user_roles has the role, the user''s effective Keycloak roles do not. missing_in_database: the reverse. resolution says how a row closed: healed_database (user_roles was changed, by the role_audit job or the Keycloak user sync), healed_keycloak (an assign or revoke job was queued) or converged (a complete audit no longer saw it). Added in v0.127.0.';
+COMMENT ON COLUMN metadata.role_drift.heal_error IS
+    'Why the last heal attempt did not happen, e.g. a role inherited through a Keycloak group that no revoke can remove. The row stays open.';
+
+ALTER TABLE metadata.role_drift ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 3. ADMIN RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_role_audit_runs(p_limit INT DEFAULT 20)
+RETURNS TABLE (
+    id BIGINT,
+    status TEXT,
+    heal_direction TEXT,
+    users_checked INT,
+    users_skipped INT,
+    drift_found INT,
+    drift_healed INT,
+    open_drift INT,
+    error_message TEXT,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'read') THEN
+        RAISE EXCEPTION 'Permission denied: you do not have permission to view users';
+    END IF;
+
+    RETURN QUERY
+    SELECT r.id, r.status, r.heal_direction, r.users_checked, r.users_skipped,
+           r.drift_found, r.drift_healed, r.open_drift, r.error_message,
+           r.started_at, r.finished_at
+    FROM metadata.role_audit_runs r
+    ORDER BY r.started_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 200);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_role_audit_runs(INT) IS
+    'Recent role audit runs, newest first. Requires civic_os_users_private read permission. Added in v0.127.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_role_audit_runs(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_role_audit_runs(INT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_role_drift(p_include_resolved BOOLEAN DEFAULT FALSE)
+RETURNS SETOF metadata.role_drift
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'read') THEN
+        RAISE EXCEPTION 'Permission denied: you do not have permission to view users';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.role_drift d
+    WHERE p_include_resolved OR d.resolved_at IS NULL
+    ORDER BY d.resolved_at IS NOT NULL, d.last_seen_at DESC
+    LIMIT 1000;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_role_drift(BOOLEAN) IS
+    'Open role drift (and resolved drift when p_include_resolved), most recently seen first. Requires civic_os_users_private read permission. Added in v0.127.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_role_drift(BOOLEAN) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_role_drift(BOOLEAN) TO authenticated;
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{role_audit_runs,role_drift,user_roles}',
+   '{}',
+   'v0-127-0-role-audit',
+   'Role drift audit between user_roles and Keycloak',
+   'accepted',
+   'Civic OS pushes user_roles changes to Keycloak through assign and revoke jobs, and the hourly Keycloak user sync pulls Keycloak roles back. Neither recorded a disagreement: roles changed in the Keycloak admin console were copied into user_roles without a trace, and a failed assign or revoke job left the two sides apart with nothing to show for it.',
+   'A daily role_audit maintenance task queues a role_audit job that walks civic_os_users in ID order, compares each user''s effective realm roles (system roles and roles unknown to Civic OS left out) with their user_roles, and records each difference in role_drift. ROLE_AUDIT_HEAL picks what happens next: off (the default) only records, to_database makes user_roles match Keycloak, to_keycloak queues assign and revoke jobs so Keycloak matches user_roles. With to_keycloak the user sync stops copying roles for users Civic OS already has. Role changes the user sync makes are recorded as drift healed to the database.',
+   'Recording drift before (or instead of) fixing it gives administrators a view of console changes they did not make through Civic OS. Healing through the existing assign and revoke jobs keeps their retries and identity audit rows. Turning the sync''s role copy off under to_keycloak keeps the two features from undoing each other every hour.',
+   'A role inherited in Keycloak through a group or composite role cannot be revoked for one user; the drift stays open with heal_error. Users with Keycloak jobs still pending are skipped for the run, as in the user sync. to_database changes fire the user_roles trigger, whose assign and revoke jobs find Keycloak already matching.');
+
+COMMIT;
@@ -0,0 +1,93 @@
+-- Deploy civic_os:v0-128-0-dry-run to pg
+-- requires: v0-127-0-role-audit
+--
+-- v0.128.0 — Dry-run mode for the workers:
+--   1. metadata.simulated_operations: side effects a worker skipped under DRY_RUN
+--   2. public.get_simulated_operations()
+--   3. Record schema decision
+--
+-- Staging installs are often restored from a production backup, and a worker
+-- pointed at one would email and text real residents, change their Keycloak
+-- accounts, delete their files and refund their payments. With DRY_RUN set
+-- the workers skip those calls and record each one here instead.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SIMULATED OPERATIONS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.simulated_operations (
+    id BIGSERIAL PRIMARY KEY,
+    service TEXT NOT NULL
+        CHECK (service IN ('consolidated-worker', 'payment-worker')),
+    category TEXT NOT NULL
+        CHECK (category IN ('email', 'sms', 'identity', 'storage', 'payments')),
+    operation TEXT NOT NULL,
+    target TEXT,
+    details JSONB NOT NULL DEFAULT '{}',
+    river_job_id BIGINT,
+    job_kind TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_simulated_operations_created ON metadata.simulated_operations(created_at DESC);
+
+COMMENT ON TABLE metadata.simulated_operations IS
+    'Side effects a worker skipped because DRY_RUN (or DRY_RUN_<CATEGORY>) was set: the email, SMS, identity provider change, S3 delete or payment provider call it would have made. Nothing here reached the outside world. Added in v0.128.0.';
+COMMENT ON COLUMN metadata.simulated_operations.operation IS
+    'What was skipped, e.g. email.send, keycloak.assign_roles, s3.delete_object, stripe.create_refund.';
+COMMENT ON COLUMN metadata.simulated_operations.target IS
+    'Who or what the operation was aimed at: recipients, an identity user ID, bucket/key, a provider payment ID.';
+
+ALTER TABLE metadata.simulated_operations ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 2. ADMIN RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_simulated_operations(p_limit INT DEFAULT 100)
+RETURNS SETOF metadata.simulated_operations
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.simulated_operations s
+    ORDER BY s.created_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_simulated_operations(INT) IS
+    'Recent simulated operations, newest first. Admin only. Added in v0.128.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_simulated_operations(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_simulated_operations(INT) TO authenticated;
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{simulated_operations}',
+   '{}',
+   'v0-128-0-dry-run',
+   'Dry-run mode for worker side effects',
+   'accepted',
+   'Staging environments are restored from production data to test upgrades and imports. Their workers then email and text the residents in that data, push changes to Keycloak, delete files from shared buckets and call the payment providers, with nothing but convention to stop them.',
+   'DRY_RUN=true makes both workers skip their side effects and record each skipped call in metadata.simulated_operations. The consolidated worker simulates four categories (email, sms, identity, storage), each overridable with DRY_RUN_<CATEGORY>; its jobs carry on as if the call succeeded, and a simulated Keycloak user gets a random ID. The payment worker''s DRY_RUN_PAYMENTS skips refunds, captures, voids and cancels and cancels the job, leaving the payment as it was; checkout intents are still created.',
+   'Wrapping the clients the workers already hold (SMTP, the identity provider, the S3 client) keeps the switch out of individual workers, and a table is easier to review after a staging run than worker logs. Payments are not faked because a made-up refund or capture would be recorded as money that moved.',
+   'Reads still reach Keycloak and S3, and uploads still write objects. A staging database marks simulated emails as sent and simulated users as provisioned; those users cannot sign in. The table is not pruned; truncate it when a staging run is over.');
+
+COMMIT;
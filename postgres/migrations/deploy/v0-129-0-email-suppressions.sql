@@ -0,0 +1,166 @@
+-- Deploy civic_os:v0-129-0-email-suppressions to pg
+-- requires: v0-128-0-dry-run
+--
+-- v0.129.0 — Email suppression list:
+--   1. metadata.email_suppressions: addresses the workers won't email
+--   2. public.email_suppressions admin view
+--   3. public.suppress_email() / public.unsuppress_email()
+--   4. Record schema decision
+--
+-- A hard bounce was recorded in metadata.delivery_events and then ignored:
+-- the next notification to the address was sent, bounced and retried like
+-- any other failure, months after the mailbox was gone, which hurts the
+-- sender's reputation with every provider. The consolidated worker now adds
+-- bounced and complaining addresses here, admins can add or remove any
+-- address, and every send checks the list first.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SUPPRESSIONS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.email_suppressions (
+    id BIGSERIAL PRIMARY KEY,
+    email_address TEXT NOT NULL UNIQUE
+        CHECK (email_address = lower(email_address)),
+    reason TEXT NOT NULL
+        CHECK (reason IN ('hard_bounce', 'soft_bounce', 'complaint', 'manual')),
+    source TEXT NOT NULL,               -- 'sendgrid', 'smtp' or 'admin'
+    detail TEXT,                        -- Bounce reason, SMTP reply or admin note
+    expires_at TIMESTAMPTZ,             -- NULL = until removed
+    event_count INT NOT NULL DEFAULT 1,
+    created_by UUID,                    -- Admin who added it; NULL for the worker
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_event_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_email_suppressions_expires
+    ON metadata.email_suppressions(expires_at)
+    WHERE expires_at IS NOT NULL;
+
+COMMENT ON TABLE metadata.email_suppressions IS
+    'Addresses the consolidated worker will not email. Hard bounces and spam complaints (SendGrid events, SMTP 5.1.x rejections) are suppressed until removed; soft bounces for EMAIL_SOFT_BOUNCE_SUPPRESSION_DAYS. Admins manage the list with suppress_email() and unsuppress_email(). The email_suppression_expiry maintenance task deletes expired rows. Added in v0.129.0.';
+COMMENT ON COLUMN metadata.email_suppressions.expires_at IS
+    'When a temporary suppression ends. A later soft bounce extends it; a hard bounce or complaint makes it permanent. A permanent suppression is never shortened by a soft bounce.';
+COMMENT ON COLUMN metadata.email_suppressions.event_count IS
+    'Bounces and complaints recorded for the address while suppressed, including the first.';
+
+ALTER TABLE metadata.email_suppressions ENABLE ROW LEVEL SECURITY;
+-- No policies: the worker writes it, admins use the view and RPCs
+
+
+-- ============================================================================
+-- 2. ADMIN VIEW
+-- ============================================================================
+
+-- Runs as the view owner, since authenticated has no access to the table
+CREATE VIEW public.email_suppressions AS
+SELECT s.id, s.email_address, s.reason, s.source, s.detail, s.expires_at,
+       s.event_count, s.created_by, s.created_at, s.last_event_at,
+       (s.expires_at IS NULL OR s.expires_at > NOW()) AS active
+FROM metadata.email_suppressions s
+WHERE metadata.is_admin();
+
+COMMENT ON VIEW public.email_suppressions IS
+    'Suppressed email addresses, admin-only. active is false for a temporary suppression that has ended but not yet been deleted. Added in v0.129.0.';
+
+GRANT SELECT ON public.email_suppressions TO authenticated;
+
+
+-- ============================================================================
+-- 3. ADMIN RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.suppress_email(
+    p_email TEXT,
+    p_expires_at TIMESTAMPTZ DEFAULT NULL,
+    p_detail TEXT DEFAULT NULL
+)
+RETURNS BIGINT
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_email TEXT := lower(trim(p_email));
+    v_id BIGINT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+    IF v_email IS NULL OR v_email !~ '^[^@\s]+@[^@\s]+$' THEN
+        RAISE EXCEPTION 'Invalid email address: %', p_email;
+    END IF;
+    IF p_expires_at IS NOT NULL AND p_expires_at <= NOW() THEN
+        RAISE EXCEPTION 'Expiry must be in the future';
+    END IF;
+
+    -- An admin's entry replaces whatever the worker recorded
+    INSERT INTO metadata.email_suppressions
+        (email_address, reason, source, detail, expires_at, created_by)
+    VALUES (v_email, 'manual', 'admin', NULLIF(trim(p_detail), ''), p_expires_at, public.current_user_id())
+    ON CONFLICT (email_address) DO UPDATE SET
+        reason = 'manual',
+        source = 'admin',
+        detail = EXCLUDED.detail,
+        expires_at = EXCLUDED.expires_at,
+        created_by = EXCLUDED.created_by,
+        last_event_at = NOW()
+    RETURNING id INTO v_id;
+
+    RETURN v_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.suppress_email(TEXT, TIMESTAMPTZ, TEXT) IS
+    'Stop emailing an address, until p_expires_at or until removed. Replaces an automatic suppression of the same address. Admin only. Added in v0.129.0.';
+
+REVOKE EXECUTE ON FUNCTION public.suppress_email(TEXT, TIMESTAMPTZ, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.suppress_email(TEXT, TIMESTAMPTZ, TEXT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.unsuppress_email(p_email TEXT)
+RETURNS BOOLEAN
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    DELETE FROM metadata.email_suppressions
+    WHERE email_address = lower(trim(p_email));
+    RETURN FOUND;
+END;
+$$;
+
+COMMENT ON FUNCTION public.unsuppress_email(TEXT) IS
+    'Remove an address from the suppression list, e.g. after a resident fixes their mailbox. Returns false if it was not suppressed. Admin only. Added in v0.129.0.';
+
+REVOKE EXECUTE ON FUNCTION public.unsuppress_email(TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.unsuppress_email(TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{email_suppressions,delivery_events}',
+   NULL,
+   'v0-129-0-email-suppressions',
+   'Email suppression list',
+   'accepted',
+   'Bounces and spam complaints reached metadata.delivery_events (v0.122.0) but nothing acted on them. Notifications to addresses that hard-bounced months earlier were still sent, and an SMTP rejection of an unknown mailbox was treated as transient and retried until River gave up.',
+   'metadata.email_suppressions holds one row per address. The consolidated worker adds SendGrid bounce and spamreport events and SMTP RCPT TO rejections with a 5.1.x (bad mailbox) code: hard bounces and complaints until removed, SendGrid blocked bounces for EMAIL_SOFT_BOUNCE_SUPPRESSION_DAYS. Admins add and remove addresses with suppress_email() and unsuppress_email(). send_notification and send_email check the list before every send; a suppressed address is failed without a retry, and the email_suppression_expiry maintenance task deletes expired rows hourly.',
+   'One row per address keeps the check a single indexed lookup per send and makes the admin view a plain list. Checking in the workers rather than where notifications are created also covers send_email jobs inserted by integrator functions. Expired rows are ignored by the check, so the hourly task only keeps the table tidy.',
+   'A notification whose only channel was a suppressed email is marked failed with a message naming the suppression list. send_email drops suppressed recipients and sends to the rest. Deliveries through providers other than SendGrid only suppress on SMTP rejections, since their bounce reports are not received.');
+
+COMMIT;
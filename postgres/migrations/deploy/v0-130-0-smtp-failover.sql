@@ -0,0 +1,51 @@
+-- Deploy civic_os:v0-130-0-smtp-failover to pg
+-- requires: v0-129-0-email-suppressions
+--
+-- v0.130.0 — SMTP failover:
+--   1. notification_log.email_provider / notification_archive.email_provider:
+--      the SMTP server that accepted each email
+--   2. Record schema decision
+--
+-- The consolidated worker sent every email through one SMTP server. When the
+-- provider had an outage, notifications failed and retried against it until
+-- River gave up. With SMTP_SECONDARY_HOST set the worker now sends through a
+-- second provider when the first fails, and records which one took each
+-- message so bounces and complaints can be traced to the right account.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. DELIVERING SERVER
+-- ============================================================================
+
+ALTER TABLE metadata.notification_log
+    ADD COLUMN email_provider TEXT;
+
+COMMENT ON COLUMN metadata.notification_log.email_provider IS
+    'Host of the SMTP server that accepted the email (SMTP_HOST or SMTP_SECONDARY_HOST). NULL when no email went out. Added in v0.130.0.';
+
+ALTER TABLE metadata.notification_archive
+    ADD COLUMN email_provider TEXT;
+
+COMMENT ON COLUMN metadata.notification_archive.email_provider IS
+    'Host of the SMTP server that accepted the email. NULL for SMS-only messages and rows archived before v0.130.0. Added in v0.130.0.';
+
+
+-- ============================================================================
+-- 2. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notification_log,notification_archive}',
+   '{email_provider}',
+   'v0-130-0-smtp-failover',
+   'Fail over to a secondary SMTP server',
+   'accepted',
+   'All email went through SMTP_HOST. A provider outage, an expired credential or a sending-quota suspension failed every notification, and River retried each against the same server until it gave up, so residents missed time-sensitive messages while a second provider account sat unused.',
+   'SMTP_SECONDARY_HOST (with its own port and credentials) names a second server. A message the primary fails to take for a server reason (connection, TLS, authentication, MAIL FROM, DATA, or a 4xx reply to RCPT TO) is sent through the secondary at once; a 5xx reply to RCPT TO is about the address and is not retried elsewhere. After SMTP_FAILOVER_THRESHOLD server failures in a row the primary is skipped for SMTP_FAILOVER_COOLDOWN_SECONDS, then tried again. The host that accepted each email is stored in notification_log.email_provider and notification_archive.email_provider, and in the output of send_email jobs.',
+   'Failing over per message keeps notifications flowing from the first failure, while the cooldown stops every message from first waiting on a dead server''s connect timeout. API-based providers all expose SMTP endpoints, so two SMTP configurations cover them without a second sending code path. The failure count lives in each worker process; replicas trip independently, which is enough for an outage that affects them all.',
+   'Two providers must both be set up for the sending domain (SPF, DKIM) or failed-over mail will land in spam. Bounces from the secondary only reach the suppression list through SMTP rejections unless its event webhook is configured too. notification_search does not show the provider; query notification_log directly.');
+
+COMMIT;
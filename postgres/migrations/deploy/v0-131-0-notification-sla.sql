@@ -0,0 +1,337 @@
+-- Deploy civic_os:v0-131-0-notification-sla to pg
+-- requires: v0-130-0-smtp-failover
+--
+-- v0.131.0 — Notification send-time SLA:
+--   1. notification_log.queue_latency: time from creating a notification to
+--      the attempt that first sent it
+--   2. notification_templates.latency_sla_seconds: per-template SLA override
+--   3. metadata.notification_latency_stats: hourly p50/p95 per template,
+--      kept by metadata.rollup_notification_latency()
+--   4. public.notification_latency_stats admin view
+--   5. notification_sla_breach template, metadata.notification_sla_alerts and
+--      metadata.notify_notification_sla_breaches()
+--   6. Record schema decision
+--
+-- Reservation confirmations sometimes arrived an hour after they were
+-- created and nobody noticed until a resident complained. The consolidated
+-- worker's notification_sla maintenance task now rolls latency up every five
+-- minutes and alerts the roles in NOTIFICATION_SLA_NOTIFY_ROLES when
+-- notifications are sent later than their SLA, or are still waiting past it.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. PER-NOTIFICATION LATENCY
+-- ============================================================================
+
+ALTER TABLE metadata.notification_log
+    ADD COLUMN queue_latency INTERVAL;
+
+COMMENT ON COLUMN metadata.notification_log.queue_latency IS
+    'Time from notifications.created_at to the attempt that first sent it on any channel; kept on later attempts. NULL while nothing has been sent, and for rows written before v0.131.0. Added in v0.131.0.';
+
+
+-- ============================================================================
+-- 2. PER-TEMPLATE SLA
+-- ============================================================================
+
+ALTER TABLE metadata.notification_templates
+    ADD COLUMN latency_sla_seconds INT CHECK (latency_sla_seconds > 0);
+
+COMMENT ON COLUMN metadata.notification_templates.latency_sla_seconds IS
+    'Longest acceptable time from creating a notification to sending it. NULL uses the worker''s NOTIFICATION_SLA_SECONDS. Added in v0.131.0.';
+
+
+-- ============================================================================
+-- 3. HOURLY STATS
+-- ============================================================================
+
+CREATE TABLE metadata.notification_latency_stats (
+    template_name VARCHAR(100) NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,  -- Hour the notifications were sent in
+    sent_count INT NOT NULL,
+    p50_seconds NUMERIC(12,1) NOT NULL,
+    p95_seconds NUMERIC(12,1) NOT NULL,
+    max_seconds NUMERIC(12,1) NOT NULL,
+    sla_seconds INT NOT NULL,           -- SLA in effect at rollup
+    over_sla_count INT NOT NULL,
+    rolled_up_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (template_name, period_start)
+);
+
+CREATE INDEX idx_notification_latency_stats_period
+    ON metadata.notification_latency_stats(period_start DESC);
+
+COMMENT ON TABLE metadata.notification_latency_stats IS
+    'Queue latency of sent notifications per template and hour: count, p50, p95, max and how many exceeded the SLA. Rebuilt for the current and previous hour by rollup_notification_latency(); kept 90 days. Added in v0.131.0.';
+
+ALTER TABLE metadata.notification_latency_stats ENABLE ROW LEVEL SECURITY;
+-- No policies: the worker writes it, admins use the view
+
+
+CREATE OR REPLACE FUNCTION metadata.rollup_notification_latency(
+    p_since TIMESTAMPTZ,
+    p_default_sla INTERVAL DEFAULT '15 minutes'
+)
+RETURNS INT  -- number of template-hours written
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_from TIMESTAMPTZ := date_trunc('hour', p_since);
+    v_rows INT;
+BEGIN
+    INSERT INTO metadata.notification_latency_stats AS s
+        (template_name, period_start, sent_count, p50_seconds, p95_seconds, max_seconds,
+         sla_seconds, over_sla_count, rolled_up_at)
+    SELECT n.template_name,
+           date_trunc('hour', n.created_at + l.queue_latency),
+           COUNT(*),
+           round(percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM l.queue_latency))::NUMERIC, 1),
+           round(percentile_cont(0.95) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM l.queue_latency))::NUMERIC, 1),
+           round(MAX(EXTRACT(EPOCH FROM l.queue_latency)), 1),
+           MAX(COALESCE(t.latency_sla_seconds, EXTRACT(EPOCH FROM p_default_sla)::INT)),
+           COUNT(*) FILTER (WHERE EXTRACT(EPOCH FROM l.queue_latency)
+                                  > COALESCE(t.latency_sla_seconds, EXTRACT(EPOCH FROM p_default_sla))),
+           NOW()
+    FROM metadata.notification_log l
+    JOIN metadata.notifications n ON n.id = l.notification_id
+    LEFT JOIN metadata.notification_templates t ON t.name = n.template_name
+    -- delivered_at is the latest attempt, never before the first send
+    WHERE l.delivered_at >= v_from
+      AND l.queue_latency IS NOT NULL
+      AND n.created_at + l.queue_latency >= v_from
+    GROUP BY n.template_name, date_trunc('hour', n.created_at + l.queue_latency)
+    ON CONFLICT (template_name, period_start) DO UPDATE SET
+        sent_count = EXCLUDED.sent_count,
+        p50_seconds = EXCLUDED.p50_seconds,
+        p95_seconds = EXCLUDED.p95_seconds,
+        max_seconds = EXCLUDED.max_seconds,
+        sla_seconds = EXCLUDED.sla_seconds,
+        over_sla_count = EXCLUDED.over_sla_count,
+        rolled_up_at = EXCLUDED.rolled_up_at;
+
+    GET DIAGNOSTICS v_rows = ROW_COUNT;
+
+    DELETE FROM metadata.notification_latency_stats
+    WHERE period_start < NOW() - INTERVAL '90 days';
+
+    RETURN v_rows;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.rollup_notification_latency(TIMESTAMPTZ, INTERVAL) IS
+    'Recomputes notification_latency_stats for every hour from p_since''s hour on; templates without latency_sla_seconds use p_default_sla. Deletes stats older than 90 days. Run by the notification_sla maintenance task. Added in v0.131.0.';
+
+
+-- ============================================================================
+-- 4. ADMIN VIEW
+-- ============================================================================
+
+-- Runs as the view owner, since authenticated has no access to the table
+CREATE VIEW public.notification_latency_stats AS
+SELECT s.template_name, t.description AS template_description, s.period_start,
+       s.sent_count, s.p50_seconds, s.p95_seconds, s.max_seconds,
+       s.sla_seconds, s.over_sla_count, s.p95_seconds > s.sla_seconds AS p95_over_sla,
+       s.rolled_up_at
+FROM metadata.notification_latency_stats s
+LEFT JOIN metadata.notification_templates t ON t.name = s.template_name
+WHERE metadata.is_admin();
+
+COMMENT ON VIEW public.notification_latency_stats IS
+    'Notification queue latency (created to first sent) per template and hour, admin-only. Filter on period_start; the current hour is updated every few minutes. Added in v0.131.0.';
+
+GRANT SELECT ON public.notification_latency_stats TO authenticated;
+
+
+-- ============================================================================
+-- 5. ALERTS
+-- ============================================================================
+
+CREATE TABLE metadata.notification_sla_alerts (
+    id BIGSERIAL PRIMARY KEY,
+    template_name VARCHAR(100) NOT NULL,
+    late_count INT NOT NULL,            -- Sent in the last hour after the SLA
+    pending_count INT NOT NULL,         -- Still pending past the SLA
+    worst_seconds INT NOT NULL,
+    sla_seconds INT NOT NULL,
+    alerted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_notification_sla_alerts_template
+    ON metadata.notification_sla_alerts(template_name, alerted_at DESC);
+
+COMMENT ON TABLE metadata.notification_sla_alerts IS
+    'One row per notification_sla_breach alert sent, at most one per template per hour. Added in v0.131.0.';
+
+ALTER TABLE metadata.notification_sla_alerts ENABLE ROW LEVEL SECURITY;
+
+
+INSERT INTO metadata.notification_templates (
+    name,
+    description,
+    entity_type,
+    subject_template,
+    html_template,
+    text_template
+) VALUES (
+    'notification_sla_breach',
+    'Sent to NOTIFICATION_SLA_NOTIFY_ROLES when notifications of a template go out later than its SLA or wait past it, at most once per template per hour. Template variables: Entity.template_name, Entity.late_count, Entity.pending_count, Entity.worst_minutes, Entity.sla_minutes; Metadata.site_url, Metadata.site_name.',
+    NULL,  -- operational alert, not entity-specific
+    -- Subject
+    '[{{.Metadata.site_name}}] {{.Entity.template_name}} notifications are late',
+    -- HTML Template
+    '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        <h2 style="color: #dc2626;">Notifications are late</h2>
+        <p><strong>{{.Entity.template_name}}</strong> notifications should go out within {{.Entity.sla_minutes}} minutes of being created.</p>
+        <table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Sent late in the last hour:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.late_count}}</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Still waiting past the SLA:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.pending_count}}</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Longest wait:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.worst_minutes}} minutes</td>
+            </tr>
+        </table>
+        <p>Check the notifications queue under Admin &rarr; Job Queues:</p>
+        <p><a href="{{.Metadata.site_url}}/system/queues">{{.Metadata.site_url}}/system/queues</a></p>
+        <p style="color: #6b7280; font-size: 12px;">You will be alerted about this template at most once an hour.</p>
+    </div>',
+    -- Text Template
+    'Notifications are late
+
+{{.Entity.template_name}} notifications should go out within {{.Entity.sla_minutes}} minutes of being created.
+
+Sent late in the last hour: {{.Entity.late_count}}
+Still waiting past the SLA: {{.Entity.pending_count}}
+Longest wait: {{.Entity.worst_minutes}} minutes
+
+Check the notifications queue under Admin > Job Queues:
+{{.Metadata.site_url}}/system/queues
+
+You will be alerted about this template at most once an hour.'
+)
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    subject_template = EXCLUDED.subject_template,
+    html_template = EXCLUDED.html_template,
+    text_template = EXCLUDED.text_template;
+
+
+-- A template breaches when a notification sent in the last hour waited
+-- longer than its SLA, or one created in the last day is still pending past
+-- it. notification_sla_breach itself is never alerted on: when the queue is
+-- backed up, the alert would be late too and alert again.
+CREATE OR REPLACE FUNCTION metadata.notify_notification_sla_breaches(
+    p_role_keys TEXT[],
+    p_default_sla INTERVAL DEFAULT '15 minutes'
+)
+RETURNS INT  -- number of templates alerted
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_breach RECORD;
+    v_alert_id BIGINT;
+    v_alerted INT := 0;
+BEGIN
+    IF p_role_keys IS NULL OR cardinality(p_role_keys) = 0 THEN
+        RETURN 0;
+    END IF;
+
+    -- One alert per template at a time, even with two schedulers
+    PERFORM pg_advisory_xact_lock(hashtext('metadata.notify_notification_sla_breaches'));
+
+    FOR v_breach IN
+        WITH slas AS (
+            SELECT t.name AS template_name,
+                   COALESCE(make_interval(secs => t.latency_sla_seconds), p_default_sla) AS sla
+            FROM metadata.notification_templates t
+            WHERE t.name <> 'notification_sla_breach'
+        ),
+        late AS (
+            SELECT n.template_name, COUNT(*) AS late_count, MAX(l.queue_latency) AS worst
+            FROM metadata.notification_log l
+            JOIN metadata.notifications n ON n.id = l.notification_id
+            JOIN slas s ON s.template_name = n.template_name
+            WHERE l.delivered_at > NOW() - INTERVAL '1 hour'
+              AND l.queue_latency > s.sla
+            GROUP BY n.template_name
+        ),
+        stuck AS (
+            SELECT n.template_name, COUNT(*) AS pending_count, NOW() - MIN(n.created_at) AS worst
+            FROM metadata.notifications n
+            JOIN slas s ON s.template_name = n.template_name
+            WHERE n.status = 'pending'
+              AND n.created_at < NOW() - s.sla
+              AND n.created_at > NOW() - INTERVAL '1 day'
+            GROUP BY n.template_name
+        )
+        SELECT s.template_name, s.sla,
+               COALESCE(late.late_count, 0) AS late_count,
+               COALESCE(stuck.pending_count, 0) AS pending_count,
+               GREATEST(late.worst, stuck.worst) AS worst
+        FROM slas s
+        LEFT JOIN late ON late.template_name = s.template_name
+        LEFT JOIN stuck ON stuck.template_name = s.template_name
+        WHERE (late.template_name IS NOT NULL OR stuck.template_name IS NOT NULL)
+          AND NOT EXISTS (
+              SELECT 1 FROM metadata.notification_sla_alerts a
+              WHERE a.template_name = s.template_name AND a.alerted_at > NOW() - INTERVAL '1 hour'
+          )
+    LOOP
+        INSERT INTO metadata.notification_sla_alerts
+            (template_name, late_count, pending_count, worst_seconds, sla_seconds)
+        VALUES (v_breach.template_name, v_breach.late_count, v_breach.pending_count,
+                EXTRACT(EPOCH FROM v_breach.worst)::INT, EXTRACT(EPOCH FROM v_breach.sla)::INT)
+        RETURNING id INTO v_alert_id;
+
+        PERFORM metadata.send_notification_to_role(
+            p_role_keys,
+            'notification_sla_breach',
+            'notification_sla_alerts',
+            v_alert_id::TEXT,
+            jsonb_build_object(
+                'template_name', v_breach.template_name,
+                'late_count', v_breach.late_count,
+                'pending_count', v_breach.pending_count,
+                'worst_minutes', ceil(EXTRACT(EPOCH FROM v_breach.worst) / 60)::INT,
+                'sla_minutes', round(EXTRACT(EPOCH FROM v_breach.sla) / 60, 1))
+        );
+
+        v_alerted := v_alerted + 1;
+    END LOOP;
+
+    RETURN v_alerted;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.notify_notification_sla_breaches(TEXT[], INTERVAL) IS
+    'Sends one notification_sla_breach notification per template with late or overdue pending notifications to users holding any of p_role_keys, unless that template was alerted in the last hour. Templates without latency_sla_seconds use p_default_sla. Run by the notification_sla maintenance task. Added in v0.131.0.';
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notification_log,notification_templates,notification_latency_stats,notification_sla_alerts}',
+   '{queue_latency,latency_sla_seconds}',
+   'v0-131-0-notification-sla',
+   'Track notification send latency against an SLA',
+   'accepted',
+   'Time-critical notifications such as reservation confirmations sometimes went out an hour after they were created, behind a backed-up queue or a slow SMTP provider. notifications.sent_at was recorded, but nothing compared it to created_at, so the delay was only noticed when residents complained.',
+   'The notification worker stores the time from creation to first send in notification_log.queue_latency. The notification_sla maintenance task rolls it up every five minutes into hourly p50, p95 and max per template (notification_latency_stats, admin view public.notification_latency_stats), and alerts NOTIFICATION_SLA_NOTIFY_ROLES through the notification_sla_breach template when notifications of a template are sent later than its SLA or are still pending past it. The SLA is NOTIFICATION_SLA_SECONDS, overridable per template with notification_templates.latency_sla_seconds.',
+   'Storing latency on notification_log avoids rewriting the large notifications table, and measures to the moment the worker sent the message rather than to the batched status update. Hourly buckets keep percentiles exact without storing every sample twice. Checking pending notifications catches a stalled queue before anything is sent late, which a latency-only check would miss.',
+   'Percentiles cannot be combined across hours; the view shows each hour separately. Alerts go through the notification queue they report on, so a fully stopped worker still needs dead-letter or external monitoring. Notifications deleted before the rollup are not counted.');
+
+COMMIT;
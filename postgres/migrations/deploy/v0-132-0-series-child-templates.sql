@@ -0,0 +1,241 @@
+-- Deploy civic_os:v0-132-0-series-child-templates to pg
+-- requires: v0-131-0-notification-sla
+--
+-- v0.132.0 — Child records for recurring series occurrences:
+--   1. metadata.series_child_templates: rows to create with each occurrence
+--      (staffing assignments, seats), per series group
+--   2. Validation trigger: the child table must reference the series' entity
+--      table with ON DELETE CASCADE
+--   3. public.series_child_templates view and
+--      public.set_series_child_templates() RPC
+--   4. Record schema decision
+--
+-- Expansion created one entity row per occurrence. Anything hanging off it,
+-- such as the two lifeguards assigned to every open swim or one seat per
+-- unit of capacity, was entered by hand for each of 52 occurrences. The
+-- expand_recurring_series worker now inserts the child rows defined here in
+-- the same transaction as the occurrence, so an occurrence exists with all
+-- of its children or not at all.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. CHILD TEMPLATES TABLE
+-- ============================================================================
+-- Keyed by group, not series, so "this and future" splits keep them.
+
+CREATE TABLE metadata.series_child_templates (
+    id BIGSERIAL PRIMARY KEY,
+    group_id BIGINT NOT NULL REFERENCES metadata.time_slot_series_groups(id) ON DELETE CASCADE,
+    child_table NAME NOT NULL,
+    parent_column NAME NOT NULL,        -- Child FK column set to the occurrence's ID
+    child_template JSONB NOT NULL DEFAULT '{}'::JSONB
+        CHECK (jsonb_typeof(child_template) = 'object'),
+    copies INT NOT NULL DEFAULT 1 CHECK (copies BETWEEN 0 AND 100),
+    copies_property NAME,               -- Occurrence column holding the count instead (e.g. capacity)
+    sort_order INT NOT NULL DEFAULT 0,
+    created_by UUID DEFAULT public.current_user_id(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_series_child_templates_group
+    ON metadata.series_child_templates(group_id, sort_order);
+
+COMMENT ON TABLE metadata.series_child_templates IS
+    'Rows the expand_recurring_series worker inserts with every occurrence of a series group, in the occurrence''s transaction: copies rows of child_table with child_template''s values and parent_column set to the occurrence ID. Applies to occurrences expanded after the row is added. Managed with set_series_child_templates(). Added in v0.132.0.';
+COMMENT ON COLUMN metadata.series_child_templates.copies_property IS
+    'Column of the series'' entity table whose value on each occurrence is the number of rows to create (NULL counts as 0, capped at 100). Overrides copies.';
+
+ALTER TABLE metadata.series_child_templates ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY series_child_templates_select ON metadata.series_child_templates
+    FOR SELECT TO PUBLIC USING (true);
+-- No write policies: set_series_child_templates() checks permissions
+
+
+-- ============================================================================
+-- 2. VALIDATION
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.validate_series_child_template()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_entity_table NAME;
+    v_child REGCLASS;
+    v_delete_action "char";
+    v_issues TEXT;
+BEGIN
+    SELECT s.entity_table INTO v_entity_table
+    FROM metadata.time_slot_series s
+    WHERE s.group_id = NEW.group_id
+    ORDER BY s.version_number DESC
+    LIMIT 1;
+
+    IF v_entity_table IS NULL THEN
+        RAISE EXCEPTION 'Series group % has no series', NEW.group_id;
+    END IF;
+
+    v_child := to_regclass(format('public.%I', NEW.child_table));
+    IF v_child IS NULL THEN
+        RAISE EXCEPTION 'Child table "%" does not exist', NEW.child_table;
+    END IF;
+
+    -- parent_column must be a single-column FK to the occurrence table.
+    -- Schedule changes delete future occurrences, so it must cascade.
+    SELECT con.confdeltype INTO v_delete_action
+    FROM pg_constraint con
+    JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = con.conkey[1]
+    WHERE con.contype = 'f'
+      AND con.conrelid = v_child
+      AND con.confrelid = format('public.%I', v_entity_table)::REGCLASS
+      AND cardinality(con.conkey) = 1
+      AND a.attname = NEW.parent_column;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION '%.% is not a foreign key to %', NEW.child_table, NEW.parent_column, v_entity_table;
+    END IF;
+    IF v_delete_action <> 'c' THEN
+        RAISE EXCEPTION '%.% must be ON DELETE CASCADE so schedule changes and deletes can remove occurrences',
+            NEW.child_table, NEW.parent_column;
+    END IF;
+
+    IF NEW.child_template ? NEW.parent_column THEN
+        RAISE EXCEPTION 'child_template must not set "%"; expansion sets it to the occurrence ID', NEW.parent_column;
+    END IF;
+    IF NEW.child_template ?| ARRAY['id', 'created_at', 'created_by', 'updated_at', 'updated_by'] THEN
+        RAISE EXCEPTION 'child_template must not set id or audit columns';
+    END IF;
+
+    -- Same drift check the worker runs, ignoring JWT-default warnings
+    SELECT string_agg(v.field || ': ' || v.issue, '; ') INTO v_issues
+    FROM metadata.validate_template_against_schema(
+        NEW.child_table, NEW.child_template || jsonb_build_object(NEW.parent_column, 0)) v
+    WHERE v.issue NOT LIKE '%current_user_id()%';
+
+    IF v_issues IS NOT NULL THEN
+        RAISE EXCEPTION 'Invalid child template for %: %', NEW.child_table, v_issues;
+    END IF;
+
+    IF NEW.copies_property IS NOT NULL AND NOT EXISTS (
+        SELECT 1 FROM information_schema.columns c
+        WHERE c.table_schema = 'public' AND c.table_name = v_entity_table
+          AND c.column_name = NEW.copies_property
+          AND c.data_type IN ('smallint', 'integer', 'bigint', 'numeric')
+    ) THEN
+        RAISE EXCEPTION 'copies_property "%" is not a numeric column of %', NEW.copies_property, v_entity_table;
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER series_child_templates_validate
+    BEFORE INSERT OR UPDATE ON metadata.series_child_templates
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.validate_series_child_template();
+
+
+-- ============================================================================
+-- 3. VIEW AND RPC
+-- ============================================================================
+
+CREATE OR REPLACE VIEW public.series_child_templates
+WITH (security_invoker = true)
+AS
+SELECT id, group_id, child_table, parent_column, child_template, copies, copies_property,
+       sort_order, created_by, created_at
+FROM metadata.series_child_templates;
+
+COMMENT ON VIEW public.series_child_templates IS
+    'Child rows created with every occurrence of a series group. Change them with set_series_child_templates(). Added in v0.132.0.';
+
+GRANT SELECT ON metadata.series_child_templates TO web_anon, authenticated;
+GRANT SELECT ON public.series_child_templates TO web_anon, authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.set_series_child_templates(
+    p_group_id BIGINT,
+    p_children JSONB
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group RECORD;
+    v_count INT;
+BEGIN
+    SELECT * INTO v_group
+    FROM metadata.time_slot_series_groups
+    WHERE id = p_group_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series group not found');
+    END IF;
+
+    -- Same rule as the series_groups_update policy
+    IF NOT (v_group.created_by = public.current_user_id()
+            OR public.has_permission('time_slot_series_groups', 'update')
+            OR public.is_admin()) THEN
+        RAISE EXCEPTION 'Permission denied to change series group %', p_group_id;
+    END IF;
+
+    IF jsonb_typeof(COALESCE(p_children, '[]'::JSONB)) <> 'array' THEN
+        RAISE EXCEPTION 'p_children must be a JSON array';
+    END IF;
+
+    DELETE FROM metadata.series_child_templates WHERE group_id = p_group_id;
+
+    INSERT INTO metadata.series_child_templates
+        (group_id, child_table, parent_column, child_template, copies, copies_property, sort_order)
+    SELECT p_group_id,
+           c.value->>'child_table',
+           c.value->>'parent_column',
+           COALESCE(c.value->'child_template', '{}'::JSONB),
+           COALESCE((c.value->>'copies')::INT, 1),
+           NULLIF(c.value->>'copies_property', ''),
+           c.ordinality::INT
+    FROM jsonb_array_elements(COALESCE(p_children, '[]'::JSONB)) WITH ORDINALITY AS c(value, ordinality);
+
+    GET DIAGNOSTICS v_count = ROW_COUNT;
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', format('Occurrences expanded from now on get %s child template(s)', v_count),
+        'group_id', p_group_id,
+        'child_templates', v_count
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_series_child_templates(BIGINT, JSONB) IS
+    'Replaces a series group''s child templates with p_children: [{"child_table", "parent_column", "child_template", "copies", "copies_property"}], created in order. Existing occurrences are not changed. Requires owning the group, time_slot_series_groups:update or admin. Added in v0.132.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_series_child_templates(BIGINT, JSONB) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_series_child_templates(BIGINT, JSONB) TO authenticated;
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{series_child_templates,time_slot_series_groups}',
+   '{child_table,parent_column,child_template,copies,copies_property}',
+   'v0-132-0-series-child-templates',
+   'Create child records with each recurring series occurrence',
+   'accepted',
+   'Recurring series expanded into one entity row per occurrence. Records that belong to each occurrence, such as staff assignments or one seat per unit of capacity, had to be added by hand for every occurrence, and were missing whenever expansion ran ahead of staff.',
+   'metadata.series_child_templates lists, per series group, rows of other tables to create with each occurrence: copies rows (or as many as the occurrence''s copies_property column holds) with child_template''s values and parent_column set to the occurrence ID. The expand_recurring_series worker inserts them in the occurrence''s transaction. A trigger requires parent_column to be a foreign key to the series'' entity table with ON DELETE CASCADE. set_series_child_templates() replaces a group''s list.',
+   'Inserting children in the occurrence''s transaction means a failed child (a staff member double-booked by an exclusion constraint) skips the whole occurrence and records it as an exception, instead of leaving an understaffed occurrence that looks complete. Keying by group keeps the list across splits. Requiring ON DELETE CASCADE keeps schedule changes and series deletes, which delete occurrences, working.',
+   'Changing the list does not touch occurrences already expanded. The copy count is capped at 100 per child template and occurrence. Children are created with the series creator as the acting user, like the occurrence.');
+
+COMMIT;
@@ -0,0 +1,208 @@
+-- Deploy civic_os:v0-133-0-holiday-calendars to pg
+-- requires: v0-132-0-series-child-templates
+--
+-- v0.133.0 — Holiday calendars for recurring series and scheduled jobs:
+--   1. metadata.holiday_calendars / metadata.holiday_calendar_dates, with
+--      public views for the API (admins write)
+--   2. time_slot_series_groups.holiday_calendar_id / holiday_policy: skip an
+--      occurrence on a holiday, or move it to the next or previous open day
+--   3. 'holiday_skipped' instance exception type
+--   4. scheduled_jobs.holiday_calendar_id: no run on a holiday
+--   5. public.set_series_holiday_calendar()
+--   6. Record schema decision
+--
+-- Township facilities close on holidays, yet recurring series expanded
+-- bookings for those days and scheduled jobs sent reminders for them. The
+-- expand_recurring_series worker and the scheduled job scheduler now check
+-- the calendar chosen for the series or job.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. CALENDARS
+-- ============================================================================
+
+CREATE TABLE metadata.holiday_calendars (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.holiday_calendars IS
+    'Named sets of holiday dates (e.g. "Township offices"). Chosen per recurring series group and per scheduled job. Added in v0.133.0.';
+
+CREATE TABLE metadata.holiday_calendar_dates (
+    id BIGSERIAL PRIMARY KEY,
+    calendar_id INT NOT NULL REFERENCES metadata.holiday_calendars(id) ON DELETE CASCADE,
+    holiday_date DATE NOT NULL,
+    name VARCHAR(200) NOT NULL,
+    UNIQUE (calendar_id, holiday_date)
+);
+
+COMMENT ON TABLE metadata.holiday_calendar_dates IS
+    'One row per holiday in a calendar. Dates are local to whatever uses the calendar: the series'' timezone, or the scheduled job''s. Added in v0.133.0.';
+
+ALTER TABLE metadata.holiday_calendars ENABLE ROW LEVEL SECURITY;
+ALTER TABLE metadata.holiday_calendar_dates ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY holiday_calendars_select ON metadata.holiday_calendars
+    FOR SELECT TO PUBLIC USING (true);
+CREATE POLICY holiday_calendars_admin ON metadata.holiday_calendars
+    FOR ALL TO authenticated
+    USING (public.is_admin())
+    WITH CHECK (public.is_admin());
+
+CREATE POLICY holiday_calendar_dates_select ON metadata.holiday_calendar_dates
+    FOR SELECT TO PUBLIC USING (true);
+CREATE POLICY holiday_calendar_dates_admin ON metadata.holiday_calendar_dates
+    FOR ALL TO authenticated
+    USING (public.is_admin())
+    WITH CHECK (public.is_admin());
+
+GRANT SELECT ON metadata.holiday_calendars, metadata.holiday_calendar_dates TO web_anon, authenticated;
+GRANT INSERT, UPDATE, DELETE ON metadata.holiday_calendars, metadata.holiday_calendar_dates TO authenticated;
+GRANT USAGE, SELECT ON SEQUENCE metadata.holiday_calendars_id_seq TO authenticated;
+GRANT USAGE, SELECT ON SEQUENCE metadata.holiday_calendar_dates_id_seq TO authenticated;
+
+CREATE OR REPLACE VIEW public.holiday_calendars
+WITH (security_invoker = true)
+AS
+SELECT id, name, description, created_at
+FROM metadata.holiday_calendars;
+
+CREATE OR REPLACE VIEW public.holiday_calendar_dates
+WITH (security_invoker = true)
+AS
+SELECT id, calendar_id, holiday_date, name
+FROM metadata.holiday_calendar_dates;
+
+COMMENT ON VIEW public.holiday_calendars IS
+    'Holiday calendars; admins can insert, update and delete through this view. Added in v0.133.0.';
+COMMENT ON VIEW public.holiday_calendar_dates IS
+    'Holidays per calendar; admins can insert, update and delete through this view. Added in v0.133.0.';
+
+GRANT SELECT ON public.holiday_calendars, public.holiday_calendar_dates TO web_anon, authenticated;
+GRANT INSERT, UPDATE, DELETE ON public.holiday_calendars, public.holiday_calendar_dates TO authenticated;
+
+
+-- ============================================================================
+-- 2. RECURRING SERIES
+-- ============================================================================
+-- On the group, not the series, so "this and future" splits keep it.
+
+ALTER TABLE metadata.time_slot_series_groups
+    ADD COLUMN holiday_calendar_id INT REFERENCES metadata.holiday_calendars(id) ON DELETE SET NULL,
+    ADD COLUMN holiday_policy VARCHAR(20) NOT NULL DEFAULT 'skip'
+        CHECK (holiday_policy IN ('skip', 'shift_forward', 'shift_back'));
+
+COMMENT ON COLUMN metadata.time_slot_series_groups.holiday_calendar_id IS
+    'Calendar whose holidays the expand_recurring_series worker avoids for this group. NULL = none. Added in v0.133.0.';
+COMMENT ON COLUMN metadata.time_slot_series_groups.holiday_policy IS
+    'What happens to an occurrence on a holiday: skip (recorded as a holiday_skipped exception), shift_forward or shift_back (same time on the nearest day that is not a holiday, within 14 days). Applies to occurrences expanded after it is set. Added in v0.133.0.';
+
+
+-- ============================================================================
+-- 3. HOLIDAY EXCEPTION TYPE
+-- ============================================================================
+
+ALTER TABLE metadata.time_slot_instances
+    DROP CONSTRAINT IF EXISTS time_slot_instances_exception_type_check;
+
+ALTER TABLE metadata.time_slot_instances
+    ADD CONSTRAINT time_slot_instances_exception_type_check
+    CHECK (exception_type IS NULL OR exception_type IN (
+        'modified',
+        'rescheduled',
+        'cancelled',
+        'conflict_skipped',
+        'insert_failed',
+        'holiday_skipped'
+    ));
+
+
+-- ============================================================================
+-- 4. SCHEDULED JOBS
+-- ============================================================================
+
+ALTER TABLE metadata.scheduled_jobs
+    ADD COLUMN holiday_calendar_id INT REFERENCES metadata.holiday_calendars(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN metadata.scheduled_jobs.holiday_calendar_id IS
+    'Calendar whose holidays the scheduler skips: a run due on a holiday (in the job''s timezone) is not queued. Manual triggers still run. NULL = none. Added in v0.133.0.';
+
+
+-- ============================================================================
+-- 5. SERIES RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.set_series_holiday_calendar(
+    p_group_id BIGINT,
+    p_calendar_id INT,
+    p_policy VARCHAR(20) DEFAULT 'skip'
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group RECORD;
+BEGIN
+    SELECT * INTO v_group
+    FROM metadata.time_slot_series_groups
+    WHERE id = p_group_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series group not found');
+    END IF;
+
+    -- Same rule as the series_groups_update policy
+    IF NOT (v_group.created_by = public.current_user_id()
+            OR public.has_permission('time_slot_series_groups', 'update')
+            OR public.is_admin()) THEN
+        RAISE EXCEPTION 'Permission denied to change series group %', p_group_id;
+    END IF;
+
+    UPDATE metadata.time_slot_series_groups
+    SET holiday_calendar_id = p_calendar_id,
+        holiday_policy = COALESCE(p_policy, 'skip')
+    WHERE id = p_group_id;
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', CASE WHEN p_calendar_id IS NULL
+            THEN 'Holidays no longer affect this series'
+            ELSE 'Occurrences expanded from now on avoid the calendar''s holidays'
+        END,
+        'group_id', p_group_id
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_series_holiday_calendar(BIGINT, INT, VARCHAR) IS
+    'Sets the holiday calendar (NULL for none) and holiday policy (skip, shift_forward, shift_back) of a series group. Existing occurrences are not changed. Requires owning the group, time_slot_series_groups:update or admin. Added in v0.133.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_series_holiday_calendar(BIGINT, INT, VARCHAR) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_series_holiday_calendar(BIGINT, INT, VARCHAR) TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{holiday_calendars,holiday_calendar_dates,time_slot_series_groups,time_slot_instances,scheduled_jobs}',
+   '{holiday_calendar_id,holiday_policy,exception_type}',
+   'v0-133-0-holiday-calendars',
+   'Holiday calendars for recurring series and scheduled jobs',
+   'accepted',
+   'Facilities close on holidays, but recurring series expanded bookings for those days and scheduled jobs ran as usual, so staff cancelled each holiday occurrence by hand and residents received reminders for closed days.',
+   'Admins keep named calendars of holiday dates. A series group can pick a calendar and a policy: skip an occurrence on a holiday (recorded as a holiday_skipped instance, so expansion does not retry it) or shift it to the same time on the next or previous day that is not a holiday. A scheduled job can pick a calendar; a run due on a holiday is claimed without being queued. Dates are compared in the series'' or job''s timezone.',
+   'Calendars are shared, so one list of township holidays serves every facility and job. Choosing on the series group keeps the choice across splits. Shifted occurrences keep their original occurrence_date, which is how expansion recognises occurrences it already created.',
+   'Setting or changing a calendar does not revisit occurrences already expanded; cancel those by hand. A shifted occurrence can land on a day that has its own occurrence, so shifting suits weekly and rarer series. Holidays added after a run was skipped do not bring the run back.');
+
+COMMIT;
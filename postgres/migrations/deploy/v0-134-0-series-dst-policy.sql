@@ -0,0 +1,98 @@
+-- Deploy civic_os:v0-134-0-series-dst-policy to pg
+-- requires: v0-133-0-holiday-calendars
+--
+-- v0.134.0 — DST transition policy for recurring series:
+--   1. time_slot_series_groups.dst_policy
+--   2. public.set_series_dst_policy()
+--   3. Record schema decision
+--
+-- Series expand in wall-clock time. An occurrence at 2:30 AM has no local
+-- time on spring-forward day, and one at 1:30 AM happens twice on fall-back
+-- day. The expand_recurring_series worker used to leave the choice to Go's
+-- time package, which moved 2:30 AM in New York back to 1:30 AM without a
+-- log line. It now applies the group's policy and logs every occurrence it
+-- moves or skips.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. POLICY COLUMN
+-- ============================================================================
+
+ALTER TABLE metadata.time_slot_series_groups
+    ADD COLUMN dst_policy VARCHAR(20) NOT NULL DEFAULT 'pick_first'
+        CHECK (dst_policy IN ('pick_first', 'shift_forward', 'skip'));
+
+COMMENT ON COLUMN metadata.time_slot_series_groups.dst_policy IS
+    'How the expand_recurring_series worker handles occurrences at a local time that DST skips or repeats. pick_first: a skipped time moves forward by the gap, a repeated time uses the first. shift_forward: moved forward, the second. skip: a skipped time is not created, a repeated time uses the first. Added in v0.134.0.';
+
+
+-- ============================================================================
+-- 2. RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.set_series_dst_policy(
+    p_group_id BIGINT,
+    p_policy VARCHAR(20)
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group RECORD;
+BEGIN
+    SELECT * INTO v_group
+    FROM metadata.time_slot_series_groups
+    WHERE id = p_group_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series group not found');
+    END IF;
+
+    -- Same rule as the series_groups_update policy
+    IF NOT (v_group.created_by = public.current_user_id()
+            OR public.has_permission('time_slot_series_groups', 'update')
+            OR public.is_admin()) THEN
+        RAISE EXCEPTION 'Permission denied to change series group %', p_group_id;
+    END IF;
+
+    UPDATE metadata.time_slot_series_groups
+    SET dst_policy = COALESCE(p_policy, 'pick_first')
+    WHERE id = p_group_id;
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', 'Occurrences expanded from now on use the new DST policy',
+        'group_id', p_group_id
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_series_dst_policy(BIGINT, VARCHAR) IS
+    'Sets the DST policy (pick_first, shift_forward, skip) of a series group. Existing occurrences are not changed. Requires owning the group, time_slot_series_groups:update or admin. Added in v0.134.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_series_dst_policy(BIGINT, VARCHAR) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_series_dst_policy(BIGINT, VARCHAR) TO authenticated;
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{time_slot_series_groups}',
+   '{dst_policy}',
+   'v0-134-0-series-dst-policy',
+   'DST transition policy for recurring series',
+   'accepted',
+   'Recurring series expand in the series timezone''s wall-clock time. On spring-forward day a 2:30 AM occurrence has no local time, and on fall-back day a 1:30 AM occurrence happens twice. Go''s time.Date picked an answer silently; in New York it moved 2:30 AM back to 1:30 AM.',
+   'Each series group has a dst_policy: pick_first (default: a skipped time moves forward by the gap, a repeated time uses the first instant), shift_forward (moved forward, and the second instant), or skip (a skipped time is not created, a repeated time uses the first instant). The worker logs every occurrence a policy moves or skips.',
+   'Moving forward by the gap keeps the occurrence on its day and as close to its time as the clock allows. The first instant of a repeated time matches what earlier releases stored, so the default changes only the spring-forward case. The policy sits on the group with the holiday policy so splits keep it.',
+   'Occurrences expanded before this release keep their times. A skipped occurrence is not recorded as an exception; it just never exists, as the local time does not.');
+
+COMMIT;
@@ -0,0 +1,55 @@
+-- Deploy civic_os:v0-135-0-thumbnail-unsupported to pg
+-- requires: v0-134-0-series-dst-policy
+--
+-- v0.135.0 — Stop retrying thumbnails of files that can't be rendered:
+--   1. thumbnail_status 'unsupported'
+--   2. Record schema decision
+--
+-- A thumbnail_generate job retried every error, so a corrupt or truncated
+-- upload spent all 25 attempts over several days before it was marked
+-- 'failed'. The worker now tells decode errors (image decoder, libvips
+-- loader, pdftoppm unable to open the PDF) from transient ones (S3, network,
+-- database), records the first as 'unsupported' and cancels the job.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. STATUS
+-- ============================================================================
+
+ALTER TABLE metadata.files
+    DROP CONSTRAINT IF EXISTS files_thumbnail_status_check;
+
+ALTER TABLE metadata.files
+    ADD CONSTRAINT files_thumbnail_status_check
+    CHECK (thumbnail_status IN (
+        'pending',
+        'processing',
+        'completed',
+        'failed',
+        'not_applicable',
+        'unsupported'
+    ));
+
+COMMENT ON COLUMN metadata.files.thumbnail_status IS
+    'Thumbnail generation status. pending=queued, processing=in progress, completed=done, failed=error, not_applicable=non-image file, unsupported=original cannot be decoded (not retried; thumbnail_error says why). unsupported added in v0.135.0.';
+
+
+-- ============================================================================
+-- 2. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{files}',
+   '{thumbnail_status}',
+   'v0-135-0-thumbnail-unsupported',
+   'Permanent thumbnail failures for files that cannot be decoded',
+   'accepted',
+   'The thumbnail worker returned every error to River, which retried it 25 times with growing backoff. A corrupt upload failed the same way each time, kept a worker slot busy for days, and its file showed as failed only after the last attempt.',
+   'Decode errors are wrapped as unsupported where they occur: any image decoder error in the Go backend, libvips load errors in the vips backend, and pdftoppm exit codes 1 (cannot open the PDF) and 3 (encrypted). The job then sets thumbnail_status = ''unsupported'' with the error in thumbnail_error and cancels itself. S3, network and database errors, and a pdftoppm killed by a signal, are retried as before.',
+   'Retrying reads the same bytes from S3, so a decode error cannot pass on a later attempt. A separate status keeps these files apart from failures worth retrying, and River records the cancelled job with its error.',
+   'libvips reports errors as text, so its classification matches message fragments; an unrecognised load error is still retried. Files already marked failed are not reclassified. Regenerating thumbnails of a completed file that turns out to be undecodable keeps the old thumbnails.');
+
+COMMIT;
@@ -0,0 +1,317 @@
+-- Deploy civic_os:v0-136-0-notification-template-versions to pg
+-- requires: v0-135-0-thumbnail-unsupported
+--
+-- v0.136.0 — Notification template versions and rollback:
+--   1. metadata.notification_template_versions: every saved revision of a
+--      template's subject, HTML, text and SMS parts
+--   2. notification_templates.active_version and a trigger that records a
+--      new version whenever the parts change
+--   3. notification_log.template_version: the version each send rendered
+--   4. metadata.activate_notification_template_version(): puts a version's
+--      parts back on the template
+--   5. public.get_notification_template_versions() and
+--      public.request_template_version_activation() for admins
+--   6. Record schema decision
+--
+-- A bad template edit (a misspelled field, a broken {{if}}) failed every
+-- send after it, and the previous text was gone. Edits now keep the old
+-- version, and an admin can ask the consolidated worker to re-activate one:
+-- the activate_template_version job parses the version with the worker's
+-- template functions before putting it live.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. VERSIONS
+-- ============================================================================
+
+CREATE TABLE metadata.notification_template_versions (
+    id BIGSERIAL PRIMARY KEY,
+    template_id INT NOT NULL REFERENCES metadata.notification_templates(id) ON DELETE CASCADE,
+    version INT NOT NULL CHECK (version > 0),
+    subject_template TEXT NOT NULL,
+    html_template TEXT NOT NULL,
+    text_template TEXT NOT NULL,
+    sms_template TEXT,
+    created_by UUID,                    -- NULL for migrations and the backfill
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (template_id, version)
+);
+
+COMMENT ON TABLE metadata.notification_template_versions IS
+    'Every saved revision of a notification template''s parts, numbered from 1 per template. Written by the notification_templates trigger; never edited. Templates that existed before v0.136.0 start with their text at that time as version 1. Added in v0.136.0.';
+
+ALTER TABLE metadata.notification_template_versions ENABLE ROW LEVEL SECURITY;
+-- No policies: admins read it through get_notification_template_versions()
+
+
+-- ============================================================================
+-- 2. ACTIVE VERSION
+-- ============================================================================
+
+ALTER TABLE metadata.notification_templates
+    ADD COLUMN active_version INT;
+
+COMMENT ON COLUMN metadata.notification_templates.active_version IS
+    'Version in metadata.notification_template_versions whose parts the template currently holds. Set by the version trigger on every edit and by activate_notification_template_version(). Added in v0.136.0.';
+
+INSERT INTO metadata.notification_template_versions
+    (template_id, version, subject_template, html_template, text_template, sms_template, created_at)
+SELECT id, 1, subject_template, html_template, text_template, sms_template, updated_at
+FROM metadata.notification_templates;
+
+UPDATE metadata.notification_templates SET active_version = 1;
+
+
+CREATE OR REPLACE FUNCTION metadata.record_notification_template_version()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_version INT;
+BEGIN
+    -- An activation sets the parts and active_version together
+    IF EXISTS (
+        SELECT 1 FROM metadata.notification_template_versions v
+        WHERE v.template_id = NEW.id
+          AND v.version = NEW.active_version
+          AND v.subject_template = NEW.subject_template
+          AND v.html_template = NEW.html_template
+          AND v.text_template = NEW.text_template
+          AND v.sms_template IS NOT DISTINCT FROM NEW.sms_template
+    ) THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT COALESCE(MAX(version), 0) + 1 INTO v_version
+    FROM metadata.notification_template_versions
+    WHERE template_id = NEW.id;
+
+    INSERT INTO metadata.notification_template_versions
+        (template_id, version, subject_template, html_template, text_template, sms_template, created_by)
+    VALUES
+        (NEW.id, v_version, NEW.subject_template, NEW.html_template, NEW.text_template, NEW.sms_template,
+         public.current_user_id());
+
+    -- Doesn't touch the parts, so the trigger doesn't fire again
+    UPDATE metadata.notification_templates SET active_version = v_version WHERE id = NEW.id;
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.record_notification_template_version() IS
+    'Trigger function: records a template''s parts as a new version when they differ from its active version, and makes that version active. Added in v0.136.0.';
+
+CREATE TRIGGER notification_template_versions_trigger
+    AFTER INSERT OR UPDATE OF subject_template, html_template, text_template, sms_template
+    ON metadata.notification_templates
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.record_notification_template_version();
+
+
+-- ============================================================================
+-- 3. VERSION PER SEND
+-- ============================================================================
+
+ALTER TABLE metadata.notification_log
+    ADD COLUMN template_version INT;
+
+COMMENT ON COLUMN metadata.notification_log.template_version IS
+    'Template version the latest attempt rendered (notification_templates.active_version at the time). NULL for rows written before v0.136.0. Added in v0.136.0.';
+
+
+-- ============================================================================
+-- 4. ACTIVATION
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.activate_notification_template_version(
+    p_template_name VARCHAR(100),
+    p_version INT
+)
+RETURNS BOOLEAN  -- false when the version was already active
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_template_id INT;
+    v_active INT;
+BEGIN
+    SELECT id, active_version INTO v_template_id, v_active
+    FROM metadata.notification_templates
+    WHERE name = p_template_name
+    FOR UPDATE;
+
+    IF v_template_id IS NULL THEN
+        RAISE EXCEPTION 'Template "%" does not exist', p_template_name;
+    END IF;
+    IF NOT EXISTS (
+        SELECT 1 FROM metadata.notification_template_versions
+        WHERE template_id = v_template_id AND version = p_version
+    ) THEN
+        RAISE EXCEPTION 'Template "%" has no version %', p_template_name, p_version;
+    END IF;
+    IF v_active = p_version THEN
+        RETURN FALSE;
+    END IF;
+
+    UPDATE metadata.notification_templates t
+    SET subject_template = v.subject_template,
+        html_template = v.html_template,
+        text_template = v.text_template,
+        sms_template = v.sms_template,
+        active_version = v.version,
+        updated_at = NOW()
+    FROM metadata.notification_template_versions v
+    WHERE t.id = v_template_id
+      AND v.template_id = v_template_id
+      AND v.version = p_version;
+
+    RETURN TRUE;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.activate_notification_template_version(VARCHAR, INT) IS
+    'Copies version p_version''s parts back onto the template and makes it the active version; no new version is recorded. Returns false when it was already active. Called by the consolidated worker''s activate_template_version job once the version parses. Added in v0.136.0.';
+
+
+-- ============================================================================
+-- 5. ADMIN RPCS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_notification_template_versions(p_template_name VARCHAR(100))
+RETURNS TABLE (
+    version INT,
+    active BOOLEAN,
+    subject_template TEXT,
+    html_template TEXT,
+    text_template TEXT,
+    sms_template TEXT,
+    created_by UUID,
+    created_by_name TEXT,
+    created_at TIMESTAMPTZ,
+    sent_count BIGINT,
+    failed_count BIGINT
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can view template versions';
+    END IF;
+
+    RETURN QUERY
+    SELECT v.version, v.version = t.active_version,
+           v.subject_template, v.html_template, v.text_template, v.sms_template,
+           v.created_by, u.display_name::TEXT, v.created_at,
+           COUNT(l.notification_id) FILTER (WHERE cardinality(l.channels_sent) > 0),
+           COUNT(l.notification_id) FILTER (WHERE cardinality(l.channels_sent) = 0)
+    FROM metadata.notification_templates t
+    JOIN metadata.notification_template_versions v ON v.template_id = t.id
+    LEFT JOIN metadata.civic_os_users u ON u.id = v.created_by
+    LEFT JOIN metadata.notifications n ON n.template_name = t.name
+    LEFT JOIN metadata.notification_log l ON l.notification_id = n.id AND l.template_version = v.version
+    WHERE t.name = p_template_name
+    GROUP BY v.id, t.active_version, u.display_name
+    ORDER BY v.version DESC;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_notification_template_versions(VARCHAR) IS
+    'Versions of a notification template, newest first, with which one is active and how many notifications each version sent or failed to send. Admin only. Added in v0.136.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_notification_template_versions(VARCHAR) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_notification_template_versions(VARCHAR) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.request_template_version_activation(
+    p_template_name VARCHAR(100),
+    p_version INT
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_active INT;
+    v_job_id BIGINT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can activate template versions';
+    END IF;
+
+    SELECT t.active_version INTO v_active
+    FROM metadata.notification_templates t
+    JOIN metadata.notification_template_versions v ON v.template_id = t.id AND v.version = p_version
+    WHERE t.name = p_template_name;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', false,
+            'message', format('Template "%s" has no version %s', p_template_name, p_version));
+    END IF;
+    IF v_active = p_version THEN
+        RETURN jsonb_build_object('success', false,
+            'message', format('Version %s of "%s" is already active', p_version, p_template_name));
+    END IF;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'activate_template_version',
+        jsonb_build_object('template_name', p_template_name, 'version', p_version),
+        'notifications',
+        4,  -- Ahead of sends, which may be failing on the bad version
+        3,
+        NOW(),
+        'available'
+    )
+    RETURNING id INTO v_job_id;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'template_version_activation_requested',
+        jsonb_build_object('template_name', p_template_name, 'version', p_version,
+                           'active_version', v_active, 'job_id', v_job_id)
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'job_id', v_job_id,
+        'message', format('Version %s of "%s" will be activated once it parses', p_version, p_template_name)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_template_version_activation(VARCHAR, INT) IS
+    'Queues an activate_template_version job that re-activates an earlier (or later) version of a notification template. The worker parses every part first; a version that no longer parses is not activated and the job is cancelled with the error. Admin only. Added in v0.136.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_template_version_activation(VARCHAR, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_template_version_activation(VARCHAR, INT) TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notification_templates,notification_template_versions,notification_log}',
+   '{active_version,template_version}',
+   'v0-136-0-notification-template-versions',
+   'Version notification templates and roll back through the worker',
+   'accepted',
+   'Templates were edited in place. An edit that rendered badly (a renamed entity field, an unclosed {{if}}) failed or garbled every later send, nothing recorded which text a notification had used, and the previous text could only be recovered from a backup.',
+   'A trigger on notification_templates records the parts as a new row in notification_template_versions whenever they change, and points active_version at it. The worker stores the active version it rendered in notification_log.template_version. request_template_version_activation() queues an activate_template_version job; the worker parses each part with its own template functions and only then calls activate_notification_template_version(), which copies the parts back and sets active_version without recording a new version.',
+   'Keeping the live parts on notification_templates leaves every reader (the worker, send_email, the template editor) unchanged. Only the worker knows the template functions, so only it can tell whether an old version still parses; the database can''t.',
+   'Versions are never pruned; templates change rarely and are small. Re-activating keeps history linear: editing after a rollback records the next number, not a branch. Deleting a template deletes its versions.');
+
+COMMIT;
@@ -0,0 +1,139 @@
+-- Deploy civic_os:v0-137-0-template-test-send to pg
+-- requires: v0-136-0-notification-template-versions
+--
+-- v0.137.0 — Send a test of a notification template to yourself:
+--   1. public.send_test_notification() queues a test_send_notification job
+--      that renders a template with sample data or a real record and emails
+--      it to the calling admin only
+--   2. Record schema decision
+--
+-- Previews show the rendered HTML in the browser, but Outlook, Gmail and
+-- phone mail apps each mangle it differently. Template authors had to
+-- create a real notification for themselves to see what residents would
+-- get, and that went through their preferences and the usual dedup. The
+-- test send goes straight to the caller's account address with "[TEST]" in
+-- front of the subject, and writes no notification, log or archive row.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. send_test_notification()
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.send_test_notification(
+    p_template_name VARCHAR(100),
+    p_sample_entity_data JSONB DEFAULT NULL,
+    p_entity_type NAME DEFAULT NULL,
+    p_entity_id TEXT DEFAULT NULL
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_live BOOLEAN := p_entity_type IS NOT NULL OR p_entity_id IS NOT NULL;
+    v_email TEXT;
+    v_job_id BIGINT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can send test notifications';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM metadata.notification_templates WHERE name = p_template_name) THEN
+        RETURN jsonb_build_object('success', false,
+            'message', format('Template "%s" does not exist', p_template_name));
+    END IF;
+
+    -- The worker reads the address again when it sends
+    SELECT NULLIF(email, '') INTO v_email
+    FROM metadata.civic_os_users_private
+    WHERE id = public.current_user_id();
+
+    IF v_email IS NULL THEN
+        RETURN jsonb_build_object('success', false,
+            'message', 'Your account has no email address to send the test to');
+    END IF;
+
+    -- Same rules as preview_template_parts()
+    IF v_live THEN
+        IF p_entity_type IS NULL OR p_entity_id IS NULL OR p_entity_id = '' THEN
+            RAISE EXCEPTION 'A test against a record needs both p_entity_type and p_entity_id';
+        END IF;
+        IF p_sample_entity_data IS NOT NULL THEN
+            RAISE EXCEPTION 'Pass either p_sample_entity_data or p_entity_type and p_entity_id, not both';
+        END IF;
+        IF to_regclass(format('public.%I', p_entity_type)) IS NULL THEN
+            RAISE EXCEPTION 'Unknown entity type: %', p_entity_type;
+        END IF;
+        IF NOT metadata.has_permission(p_entity_type, 'read') THEN
+            RAISE EXCEPTION 'Permission denied to read %', p_entity_type;
+        END IF;
+    ELSIF p_sample_entity_data IS NULL THEN
+        p_sample_entity_data := '{"display_name": "Example Entity", "id": 1}'::jsonb;
+    END IF;
+
+    -- The job carries who asked, not an address: it can only mail the caller
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'test_send_notification',
+        jsonb_build_object(
+            'template_name', p_template_name,
+            'user_id', public.current_user_id()::text,
+            'sample_entity_data', p_sample_entity_data
+        ) || CASE WHEN v_live THEN jsonb_build_object(
+            'entity_type', p_entity_type,
+            'entity_id', p_entity_id,
+            'roles', to_jsonb(metadata.get_user_roles())
+        ) ELSE '{}'::jsonb END,
+        'notifications',
+        4,  -- The author is waiting for it
+        3,
+        NOW(),
+        'available'
+    )
+    RETURNING id INTO v_job_id;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'template_test_send_requested',
+        jsonb_build_object('template_name', p_template_name, 'entity_type', p_entity_type,
+                           'entity_id', p_entity_id, 'job_id', v_job_id)
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'job_id', v_job_id,
+        'message', format('A test of "%s" will be sent to %s', p_template_name, v_email)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.send_test_notification(VARCHAR, JSONB, NAME, TEXT) IS
+    'Queues a test_send_notification job that renders a template with p_sample_entity_data (or the live row p_entity_type/p_entity_id, read with the caller''s permissions) and emails it to the caller''s own address with a [TEST] subject prefix. Skips notification preferences and dedup, and records no notification, log or archive row. Admin only. Added in v0.137.0.';
+
+REVOKE EXECUTE ON FUNCTION public.send_test_notification(VARCHAR, JSONB, NAME, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.send_test_notification(VARCHAR, JSONB, NAME, TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 2. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notification_templates}',
+   NULL,
+   'v0-137-0-template-test-send',
+   'Send a test of a notification template to yourself',
+   'accepted',
+   'A template preview renders in the browser, not in the mail clients residents use, and they each change HTML and CSS in their own way. The only way to see a real delivery was to create a notification for yourself, which depends on your preferences, is deduplicated, and shows up in notification search and the archive as if a resident had been sent it.',
+   'send_test_notification() queues a test_send_notification job with the template name, the caller''s user ID and either sample data or a record (with the caller''s roles, as in live previews). The worker renders the saved template, adds "[TEST] " to the subject, and emails the address on the caller''s account. It skips preferences, dedup, engagement tracking, notification_log and the archive. Suppressed addresses are still skipped. Template and rendering errors cancel the job with the reason.',
+   'Sending only to the caller''s own address (looked up by the worker from the user ID in the job) means the RPC can''t be used to send templated mail to anyone else. Using the saved template, not a draft, tests exactly what will go out; drafts can already be previewed.',
+   'Only email is sent; the SMS part is checked with the preview and segment count. Each test is a real send and counts against the SMTP provider''s limits. The result is on the job: a cancelled job has the rendering or suppression error.');
+
+COMMIT;
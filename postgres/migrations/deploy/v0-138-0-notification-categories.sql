@@ -0,0 +1,199 @@
+-- Deploy civic_os:v0-138-0-notification-categories to pg
+-- requires: v0-137-0-template-test-send
+--
+-- v0.138.0 — Notification preferences per category and channel:
+--   1. metadata.notification_categories (reservations, billing, system
+--      alerts, announcements) and notification_templates.category
+--   2. metadata.notification_category_preferences: one row per user,
+--      category and channel, kept in step with notification_preferences and
+--      the category list by a trigger, and backfilled for existing users
+--   3. RLS, grants and public views for PostgREST
+--   4. Record schema decision
+--
+-- Preferences were one switch per channel, so a resident who wanted
+-- booking emails but not announcements could only turn email off. The
+-- channel switch stays (and still holds the address and the SMS opt-out);
+-- within an enabled channel, the notification worker now also skips
+-- templates whose category the user turned off for that channel.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. CATEGORIES
+-- ============================================================================
+
+CREATE TABLE metadata.notification_categories (
+    name VARCHAR(50) PRIMARY KEY,
+    display_name VARCHAR(100) NOT NULL,
+    description TEXT,
+    default_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    sort_order INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.notification_categories IS
+    'Kinds of notification users can turn off per channel (notification_category_preferences). Integrators add their own. Added in v0.138.0.';
+COMMENT ON COLUMN metadata.notification_categories.default_enabled IS
+    'Whether the category is on for users who have not chosen; copied into their preference rows when they are created.';
+
+INSERT INTO metadata.notification_categories (name, display_name, description, sort_order) VALUES
+    ('reservations', 'Reservations', 'Booking requests, approvals, reminders and cancellations', 10),
+    ('billing', 'Billing', 'Payments, receipts and refunds', 20),
+    ('system_alerts', 'System alerts', 'Your account, and reports for staff such as failed jobs', 30),
+    ('announcements', 'Announcements', 'News and updates sent to many residents at once', 40);
+
+ALTER TABLE metadata.notification_templates
+    ADD COLUMN category VARCHAR(50)
+        REFERENCES metadata.notification_categories(name) ON UPDATE CASCADE ON DELETE SET NULL;
+
+COMMENT ON COLUMN metadata.notification_templates.category IS
+    'Category users can turn off per channel. NULL = only the channel switch in notification_preferences applies. Added in v0.138.0.';
+
+-- Framework templates; integrator templates are left for the integrator
+UPDATE metadata.notification_templates SET category = 'billing'
+WHERE name IN ('payment_succeeded', 'payment_refunded', 'payment_daily_summary');
+
+UPDATE metadata.notification_templates SET category = 'system_alerts'
+WHERE name IN ('user_welcome', 'job_dead_letter', 'notification_sla_breach');
+
+
+-- ============================================================================
+-- 2. CATEGORY × CHANNEL PREFERENCES
+-- ============================================================================
+
+CREATE TABLE metadata.notification_category_preferences (
+    user_id UUID NOT NULL,
+    category VARCHAR(50) NOT NULL
+        REFERENCES metadata.notification_categories(name) ON UPDATE CASCADE ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, category, channel),
+    -- Only for channels the user has; goes with the channel row
+    FOREIGN KEY (user_id, channel)
+        REFERENCES metadata.notification_preferences(user_id, channel) ON DELETE CASCADE
+);
+
+COMMENT ON TABLE metadata.notification_category_preferences IS
+    'Per-user switch for each notification category on each channel. A notification goes out on a channel only if the channel is enabled in notification_preferences and, when its template has a category, that category is enabled here. Rows are created with the category default for every channel row the user has. Added in v0.138.0.';
+
+CREATE TRIGGER set_updated_at_trigger
+    BEFORE UPDATE ON metadata.notification_category_preferences
+    FOR EACH ROW
+    EXECUTE FUNCTION public.set_updated_at();
+
+
+CREATE OR REPLACE FUNCTION metadata.sync_notification_category_preferences()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF TG_TABLE_NAME = 'notification_preferences' THEN
+        -- New channel row: every category at its default
+        INSERT INTO metadata.notification_category_preferences (user_id, category, channel, enabled)
+        SELECT NEW.user_id, c.name, NEW.channel, c.default_enabled
+        FROM metadata.notification_categories c
+        ON CONFLICT DO NOTHING;
+    ELSE
+        -- New category: a row for every channel row of every user
+        INSERT INTO metadata.notification_category_preferences (user_id, category, channel, enabled)
+        SELECT np.user_id, NEW.name, np.channel, NEW.default_enabled
+        FROM metadata.notification_preferences np
+        ON CONFLICT DO NOTHING;
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.sync_notification_category_preferences() IS
+    'Trigger function: creates notification_category_preferences rows at the category default when a user gets a channel row or a category is added. Added in v0.138.0.';
+
+CREATE TRIGGER sync_notification_category_preferences_trigger
+    AFTER INSERT ON metadata.notification_preferences
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.sync_notification_category_preferences();
+
+CREATE TRIGGER sync_notification_category_preferences_trigger
+    AFTER INSERT ON metadata.notification_categories
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.sync_notification_category_preferences();
+
+-- Existing users: every category on for each channel they have. Their
+-- channel switches are unchanged and still apply on top.
+INSERT INTO metadata.notification_category_preferences (user_id, category, channel, enabled)
+SELECT np.user_id, c.name, np.channel, c.default_enabled
+FROM metadata.notification_preferences np
+CROSS JOIN metadata.notification_categories c;
+
+
+-- ============================================================================
+-- 3. ACCESS
+-- ============================================================================
+
+ALTER TABLE metadata.notification_categories ENABLE ROW LEVEL SECURITY;
+ALTER TABLE metadata.notification_category_preferences ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "All can view categories" ON metadata.notification_categories
+    FOR SELECT TO authenticated USING (TRUE);
+
+CREATE POLICY "Admins manage categories" ON metadata.notification_categories
+    FOR ALL TO authenticated USING (is_admin());
+
+CREATE POLICY "Users manage own category preferences" ON metadata.notification_category_preferences
+    FOR ALL TO authenticated USING (user_id = current_user_id());
+
+-- Same permissions as the channel preferences (v0.35.0)
+CREATE POLICY "Admin read all category preferences" ON metadata.notification_category_preferences
+    FOR SELECT TO authenticated
+    USING (public.has_permission('civic_os_users_private', 'read'));
+
+CREATE POLICY "Admin update all category preferences" ON metadata.notification_category_preferences
+    FOR UPDATE TO authenticated
+    USING (public.has_permission('civic_os_users_private', 'update'));
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON metadata.notification_categories TO authenticated;
+GRANT SELECT, UPDATE ON metadata.notification_category_preferences TO authenticated;
+
+CREATE VIEW public.notification_categories
+WITH (security_invoker = true) AS
+    SELECT * FROM metadata.notification_categories;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON public.notification_categories TO authenticated;
+
+COMMENT ON VIEW public.notification_categories IS
+    'Public view of notification categories. Exposes metadata.notification_categories to PostgREST. Added in v0.138.0.';
+
+-- Rows are created by the sync trigger, so users only update them
+CREATE VIEW public.notification_category_preferences
+WITH (security_invoker = true) AS
+    SELECT * FROM metadata.notification_category_preferences;
+
+GRANT SELECT, UPDATE ON public.notification_category_preferences TO authenticated;
+
+COMMENT ON VIEW public.notification_category_preferences IS
+    'Public view of notification category preferences. Exposes metadata.notification_category_preferences to PostgREST. Added in v0.138.0.';
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notification_categories,notification_category_preferences,notification_templates}',
+   '{category}',
+   'v0-138-0-notification-categories',
+   'Notification preferences per category and channel',
+   'accepted',
+   'Notification preferences were a single on/off switch per channel. Residents who wanted booking confirmations but not announcements had to choose between getting everything by email and getting nothing.',
+   'Templates get an optional category from metadata.notification_categories. notification_category_preferences holds one row per user, category and channel. A trigger creates the rows at the category default whenever a user gets a channel row or a category is added, and existing users were backfilled. The notification worker sends on a channel only if the channel switch is on and, for a template with a category, the user has not turned that category off for the channel.',
+   'Keeping the channel switch as a master switch leaves the address, the SMS opt-out and every existing reader of notification_preferences unchanged. Creating the rows up front lets the preferences page read and PATCH a complete matrix through PostgREST, the same way it already updates channel rows. Categories are data, so integrators can add their own without a migration.',
+   'A template without a category is governed by the channel switch only; framework templates were categorised, integrator templates must be. A disabled category is skipped the same way a disabled channel is. Deleting a category deletes its preference rows and leaves its templates uncategorised.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,143 @@
+-- Deploy civic_os:v0-69-0-job-audit-context
+-- Requires: v0-68-0-a11y-translations
+--
+-- v0.69.0 — Carry "who did this" audit context through background jobs:
+--   1. metadata.job_audit_context() builds {actor_id, on_behalf_of, request_id,
+--      impersonated_roles} from the current PostgREST request
+--   2. BEFORE INSERT trigger on metadata.river_job stamps args.audit on every
+--      job enqueued from a user request (all SQL enqueue helpers, no rewrites)
+--   3. scheduled_job_runs.audit_context records who triggered a run
+--   4. Record schema decision
+
+BEGIN;
+
+-- ============================================================================
+-- 1. JOB_AUDIT_CONTEXT() FUNCTION
+-- ============================================================================
+-- Returns NULL outside a user request (worker/scheduler inserts, psql), so
+-- system-originated jobs carry no audit object.
+--
+-- on_behalf_of comes from the X-On-Behalf-Of header and, like
+-- X-Impersonate-Roles, is only honored for real admins. A non-admin cannot
+-- attribute their actions to someone else.
+
+CREATE OR REPLACE FUNCTION metadata.job_audit_context()
+RETURNS JSONB
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_actor_id UUID;
+    v_headers JSON;
+    v_on_behalf_of UUID;
+    v_impersonated_roles TEXT[];
+BEGIN
+    v_actor_id := metadata.current_user_id();
+    IF v_actor_id IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    BEGIN
+        v_headers := current_setting('request.headers', true)::JSON;
+    EXCEPTION WHEN OTHERS THEN
+        v_headers := NULL;
+    END;
+
+    IF v_headers IS NOT NULL AND metadata.is_real_admin() THEN
+        -- PostgREST lowercases header names
+        BEGIN
+            v_on_behalf_of := NULLIF(trim(v_headers->>'x-on-behalf-of'), '')::UUID;
+        EXCEPTION WHEN invalid_text_representation THEN
+            v_on_behalf_of := NULL;
+        END;
+
+        IF NULLIF(trim(v_headers->>'x-impersonate-roles'), '') IS NOT NULL THEN
+            SELECT ARRAY(
+                SELECT trim(unnest(string_to_array(v_headers->>'x-impersonate-roles', ',')))
+            ) INTO v_impersonated_roles;
+        END IF;
+    END IF;
+
+    RETURN jsonb_strip_nulls(jsonb_build_object(
+        'actor_id', v_actor_id,
+        'on_behalf_of', v_on_behalf_of,
+        'request_id', NULLIF(v_headers->>'x-request-id', ''),
+        'impersonated_roles', to_jsonb(v_impersonated_roles)
+    ));
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.job_audit_context() IS
+    'Audit context for the current request: actor_id (JWT sub), on_behalf_of (X-On-Behalf-Of header, real admins only), request_id (X-Request-Id header), impersonated_roles. NULL when there is no authenticated user. Added in v0.69.0.';
+
+
+-- ============================================================================
+-- 2. STAMP AUDIT CONTEXT ON ENQUEUED JOBS
+-- ============================================================================
+-- Every SQL helper that enqueues work inserts into metadata.river_job inside
+-- the user's transaction, so one trigger covers all of them. Helpers that
+-- build their own audit object (args already has 'audit') are left alone.
+
+CREATE OR REPLACE FUNCTION metadata.stamp_job_audit_context()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_audit JSONB;
+BEGIN
+    IF NEW.args ? 'audit' THEN
+        RETURN NEW;
+    END IF;
+
+    v_audit := metadata.job_audit_context();
+    IF v_audit IS NOT NULL THEN
+        NEW.args := NEW.args || jsonb_build_object('audit', v_audit);
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER stamp_job_audit_context_trigger
+    BEFORE INSERT ON metadata.river_job
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.stamp_job_audit_context();
+
+COMMENT ON FUNCTION metadata.stamp_job_audit_context() IS
+    'Adds args.audit (see job_audit_context) to River jobs enqueued from a user request so workers can attribute the records they create. Added in v0.69.0.';
+
+
+-- ============================================================================
+-- 3. ADD audit_context TO scheduled_job_runs
+-- ============================================================================
+-- The DEFAULT covers trigger_scheduled_job() (synchronous manual runs);
+-- the executor worker writes args.audit explicitly.
+
+ALTER TABLE metadata.scheduled_job_runs
+    ADD COLUMN audit_context JSONB DEFAULT metadata.job_audit_context();
+
+COMMENT ON COLUMN metadata.scheduled_job_runs.audit_context IS
+    'Who triggered this run (actor_id, on_behalf_of, request_id). NULL for scheduler and catch-up runs. Added in v0.69.0.';
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{river_job,scheduled_job_runs,admin_audit_log}',
+   '{args,audit_context}',
+   'v0-69-0-job-audit-context',
+   'Propagate audit context through background jobs',
+   'accepted',
+   'Background jobs lost the identity of the user who caused them. When an admin acted on behalf of a user (role changes, profile edits, provisioning), the resulting Keycloak changes and run records had no attribution, and admin-triggered work was indistinguishable from system work.',
+   'A BEFORE INSERT trigger on metadata.river_job merges an "audit" object (actor_id, on_behalf_of, request_id, impersonated_roles) into job args whenever a JWT is present. on_behalf_of is read from the X-On-Behalf-Of header and honored only for real admins, mirroring X-Impersonate-Roles. Workers record the context in metadata.admin_audit_log rows and in scheduled_job_runs.audit_context.',
+   'A single trigger covers every existing and future SQL enqueue helper without rewriting each one, and keeps the args shape identical across job kinds. Reusing admin_audit_log avoids a second audit table.',
+   'Adds a small per-row cost to River job inserts (one STABLE function call). Jobs inserted by workers carry no audit object, so workers must treat it as optional. Helpers can pre-populate args.audit to override the stamped value.');
+
+COMMIT;
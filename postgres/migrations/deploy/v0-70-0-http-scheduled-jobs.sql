@@ -0,0 +1,293 @@
+-- Deploy civic_os:v0-70-0-http-scheduled-jobs
+-- Requires: v0-69-0-job-audit-context
+--
+-- v0.70.0 — HTTP-target scheduled jobs:
+--   1. scheduled_jobs gains target_type ('sql' | 'http') and HTTP request
+--      configuration; function_name becomes optional for HTTP targets
+--   2. scheduled_job_runs.http_status captures the response status
+--   3. trigger_scheduled_job() queues HTTP targets for the worker
+--   4. scheduled_job_status VIEW exposes target columns
+--   5. schema_scheduled_functions VIEW lists SQL targets only
+--   6. Record schema decision
+
+BEGIN;
+
+-- ============================================================================
+-- 1. HTTP TARGET COLUMNS ON scheduled_jobs
+-- ============================================================================
+-- Header values and the body are Go text/templates rendered by the worker.
+-- Secrets are never stored here: reference them as {{secret "NAME"}}, which
+-- the worker resolves from its SCHEDULED_JOB_SECRET_NAME environment variable.
+
+ALTER TABLE metadata.scheduled_jobs
+    ADD COLUMN target_type VARCHAR(20) NOT NULL DEFAULT 'sql',
+    ADD COLUMN http_url TEXT,
+    ADD COLUMN http_method VARCHAR(10) NOT NULL DEFAULT 'POST',
+    ADD COLUMN http_headers JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN http_body_template TEXT,
+    ADD COLUMN http_timeout_seconds INT NOT NULL DEFAULT 30;
+
+ALTER TABLE metadata.scheduled_jobs
+    ALTER COLUMN function_name DROP NOT NULL;
+
+ALTER TABLE metadata.scheduled_jobs
+    ADD CONSTRAINT scheduled_jobs_valid_target_type CHECK (target_type IN ('sql', 'http')),
+    ADD CONSTRAINT scheduled_jobs_target_config CHECK (
+        (target_type = 'sql' AND function_name IS NOT NULL)
+        OR (target_type = 'http' AND http_url ~ '^https?://')
+    ),
+    ADD CONSTRAINT scheduled_jobs_valid_http_method CHECK (
+        http_method IN ('GET', 'POST', 'PUT', 'PATCH', 'DELETE', 'HEAD')
+    ),
+    ADD CONSTRAINT scheduled_jobs_http_headers_object CHECK (jsonb_typeof(http_headers) = 'object'),
+    ADD CONSTRAINT scheduled_jobs_http_timeout_range CHECK (http_timeout_seconds BETWEEN 1 AND 300);
+
+COMMENT ON COLUMN metadata.scheduled_jobs.target_type IS
+    'What the job runs: ''sql'' calls function_name, ''http'' sends the configured HTTP request. Added in v0.70.0.';
+COMMENT ON COLUMN metadata.scheduled_jobs.http_url IS
+    'Request URL for HTTP targets (http:// or https://).';
+COMMENT ON COLUMN metadata.scheduled_jobs.http_headers IS
+    'Request headers as a JSON object. Values are templates; use {{secret "NAME"}} for credentials (resolved from the worker env var SCHEDULED_JOB_SECRET_NAME).';
+COMMENT ON COLUMN metadata.scheduled_jobs.http_body_template IS
+    'Optional request body template. Available fields: .JobID, .JobName, .ScheduledFor, .TriggeredBy, .RunID.';
+COMMENT ON COLUMN metadata.scheduled_jobs.http_timeout_seconds IS
+    'Per-request timeout for HTTP targets (1-300 seconds).';
+
+
+-- ============================================================================
+-- 2. RESPONSE CAPTURE ON scheduled_job_runs
+-- ============================================================================
+-- The full capture (status, content type, body up to 64 KB) goes in details;
+-- http_status is split out for filtering.
+
+ALTER TABLE metadata.scheduled_job_runs
+    ADD COLUMN http_status INT;
+
+COMMENT ON COLUMN metadata.scheduled_job_runs.http_status IS
+    'HTTP response status for HTTP-target runs. NULL for SQL runs or when no response was received. Added in v0.70.0.';
+
+
+-- ============================================================================
+-- 3. trigger_scheduled_job() QUEUES HTTP TARGETS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.trigger_scheduled_job(p_job_name VARCHAR(100))
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_job RECORD;
+    v_run_id BIGINT;
+    v_result JSONB;
+    v_start_time TIMESTAMPTZ;
+    v_end_time TIMESTAMPTZ;
+    v_duration_ms INT;
+BEGIN
+    -- Permission check
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can trigger scheduled jobs'
+            USING HINT = 'Contact an administrator to run this job';
+    END IF;
+
+    -- Find the job
+    SELECT * INTO v_job
+    FROM metadata.scheduled_jobs
+    WHERE name = p_job_name;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Scheduled job not found: %', p_job_name;
+    END IF;
+
+    -- HTTP targets can't run inside the database: hand off to the worker.
+    -- The result (status code, response body) lands in scheduled_job_runs.
+    IF v_job.target_type = 'http' THEN
+        INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+        VALUES (
+            'available',
+            'scheduled_jobs',
+            'scheduled_job_http',
+            jsonb_build_object(
+                'job_id', v_job.id,
+                'job_name', v_job.name,
+                'scheduled_for', NOW(),
+                'triggered_by', 'manual'
+            ),
+            2,
+            3,
+            NOW()
+        );
+
+        RETURN jsonb_build_object(
+            'success', true,
+            'queued', true,
+            'job_name', v_job.name,
+            'message', 'HTTP job queued; see run history for the response'
+        );
+    END IF;
+
+    -- Create run record
+    v_start_time := NOW();
+    INSERT INTO metadata.scheduled_job_runs (job_id, started_at, triggered_by)
+    VALUES (v_job.id, v_start_time, 'manual')
+    RETURNING id INTO v_run_id;
+
+    -- Execute the function dynamically
+    BEGIN
+        EXECUTE format('SELECT %I()', v_job.function_name) INTO v_result;
+        v_end_time := NOW();
+        v_duration_ms := EXTRACT(EPOCH FROM (v_end_time - v_start_time)) * 1000;
+
+        -- Update run record with result
+        UPDATE metadata.scheduled_job_runs
+        SET completed_at = v_end_time,
+            duration_ms = v_duration_ms,
+            success = COALESCE((v_result->>'success')::boolean, true),
+            message = v_result->>'message',
+            details = v_result
+        WHERE id = v_run_id;
+
+        -- Update last_run_at on job
+        UPDATE metadata.scheduled_jobs
+        SET last_run_at = v_start_time,
+            updated_at = NOW()
+        WHERE id = v_job.id;
+
+        RETURN jsonb_build_object(
+            'success', true,
+            'run_id', v_run_id,
+            'job_name', v_job.name,
+            'result', v_result,
+            'duration_ms', v_duration_ms
+        );
+
+    EXCEPTION WHEN OTHERS THEN
+        v_end_time := NOW();
+        v_duration_ms := EXTRACT(EPOCH FROM (v_end_time - v_start_time)) * 1000;
+
+        -- Update run record with error
+        UPDATE metadata.scheduled_job_runs
+        SET completed_at = v_end_time,
+            duration_ms = v_duration_ms,
+            success = false,
+            message = SQLERRM
+        WHERE id = v_run_id;
+
+        RETURN jsonb_build_object(
+            'success', false,
+            'run_id', v_run_id,
+            'job_name', v_job.name,
+            'error', SQLERRM,
+            'duration_ms', v_duration_ms
+        );
+    END;
+END;
+$$;
+
+
+-- ============================================================================
+-- 4. EXPOSE TARGET COLUMNS IN scheduled_job_status
+-- ============================================================================
+
+CREATE OR REPLACE VIEW public.scheduled_job_status AS
+SELECT
+    sj.id,
+    sj.name,
+    sj.description,
+    sj.function_name,
+    sj.schedule,
+    sj.timezone,
+    sj.enabled,
+    sj.last_run_at,
+    sj.created_at,
+    sj.updated_at,
+    -- Latest run info (denormalized for convenience)
+    lr.id AS last_run_id,
+    lr.success AS last_run_success,
+    lr.message AS last_run_message,
+    lr.duration_ms AS last_run_duration_ms,
+    lr.triggered_by AS last_run_triggered_by,
+    -- Run statistics
+    stats.total_runs,
+    stats.successful_runs,
+    stats.failed_runs,
+    CASE
+        WHEN stats.total_runs > 0
+        THEN ROUND((stats.successful_runs::numeric / stats.total_runs) * 100, 1)
+        ELSE NULL
+    END AS success_rate_percent,
+    -- HTTP targets (v0.70.0) - appended so dependent views are unaffected
+    sj.target_type,
+    sj.http_url,
+    sj.http_method,
+    lr.http_status AS last_run_http_status
+FROM metadata.scheduled_jobs sj
+LEFT JOIN LATERAL (
+    SELECT *
+    FROM metadata.scheduled_job_runs
+    WHERE job_id = sj.id
+    ORDER BY started_at DESC
+    LIMIT 1
+) lr ON true
+LEFT JOIN LATERAL (
+    SELECT
+        COUNT(*) AS total_runs,
+        COUNT(*) FILTER (WHERE success = true) AS successful_runs,
+        COUNT(*) FILTER (WHERE success = false) AS failed_runs
+    FROM metadata.scheduled_job_runs
+    WHERE job_id = sj.id
+) stats ON true;
+
+
+-- ============================================================================
+-- 5. schema_scheduled_functions: SQL TARGETS ONLY
+-- ============================================================================
+-- This introspection view documents scheduled *functions*; HTTP targets have
+-- a NULL function_name and would show up as blank rows.
+
+CREATE OR REPLACE VIEW public.schema_scheduled_functions
+WITH (security_invoker = true) AS
+SELECT
+    sj.function_name,
+    -- Overlay from rpc_functions or use smart default
+    COALESCE(rf.display_name, initcap(replace(sj.function_name, '_', ' '))) AS display_name,
+    rf.description,
+    rf.category,
+    sj.name AS job_name,
+    sj.schedule AS cron_schedule,
+    sj.timezone,
+    sj.enabled AS schedule_enabled,
+    sj.last_run_at,
+    sjs.last_run_success,
+    sjs.success_rate_percent,
+    -- Whether the underlying function is registered
+    rf.function_name IS NOT NULL AS is_registered
+FROM metadata.scheduled_jobs sj
+LEFT JOIN metadata.rpc_functions rf ON rf.function_name = sj.function_name::NAME
+LEFT JOIN public.scheduled_job_status sjs ON sjs.id = sj.id
+WHERE metadata.is_admin()  -- Admin-only for schedule details
+  AND sj.target_type = 'sql';  -- HTTP targets have no function to document
+
+COMMENT ON VIEW public.schema_scheduled_functions IS
+    'Admin-only view showing scheduled jobs with optional RPC metadata overlay.';
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{scheduled_jobs,scheduled_job_runs}',
+   '{target_type,http_url,http_method,http_headers,http_body_template,http_timeout_seconds,http_status}',
+   'v0-70-0-http-scheduled-jobs',
+   'HTTP-target scheduled jobs',
+   'accepted',
+   'Scheduled jobs could only call SQL functions. Deployments that needed to ping external services on a schedule (cache warmers, partner APIs) had to run a separate cron container.',
+   'Added target_type (sql | http) with URL, method, templated headers/body and timeout columns on metadata.scheduled_jobs. The scheduler queues HTTP targets as scheduled_job_http River jobs; the worker sends the request and writes status and response body into scheduled_job_runs. Secrets are referenced as {{secret "NAME"}} and resolved from SCHEDULED_JOB_SECRET_* environment variables in the worker.',
+   'Reusing scheduled_jobs keeps one scheduler, one run history and one failure-alert path for both kinds of target. Keeping secrets in the worker environment means database readers (including schema_decisions and introspection) never see credentials, and the env prefix stops a job editor from reading unrelated worker secrets.',
+   'function_name is now nullable; a CHECK constraint enforces it for SQL targets. 2xx responses are successes; 5xx/429 and network errors are retried by River, other 4xx are recorded as failures without retry.');
+
+COMMIT;
@@ -0,0 +1,137 @@
+-- Deploy civic_os:v0-71-0-payment-providers to pg
+-- requires: v0-70-0-http-scheduled-jobs
+--
+-- v0.71.0 — Multiple payment providers:
+--   1. Allow 'square' and 'paypal' in payments.transactions.provider
+--   2. create_and_link_payment gains p_provider (defaults to 'stripe')
+--   3. Record schema decision
+--
+-- The payment worker picks the provider implementation from each
+-- transaction row, so existing Stripe payments and RPCs are unaffected.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. PROVIDER CONSTRAINT
+-- ============================================================================
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_provider;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_provider
+    CHECK (provider IN ('stripe', 'square', 'paypal'));
+
+COMMENT ON COLUMN payments.transactions.provider IS
+    'Payment processor for this transaction (stripe, square, paypal). The payment worker routes intent creation, refunds and webhooks by this value; the provider must be configured in the worker environment.';
+COMMENT ON COLUMN payments.transactions.provider_payment_id IS
+    'Provider payment ID: Stripe PaymentIntent (pi_...), Square order ID, or PayPal order ID. Created by worker after INSERT.';
+COMMENT ON COLUMN payments.transactions.provider_client_secret IS
+    'Value the frontend needs to complete checkout: Stripe client_secret, Square payment link URL, or PayPal order ID.';
+
+
+-- ============================================================================
+-- 2. create_and_link_payment WITH PROVIDER
+-- ============================================================================
+-- Adding a parameter changes the signature, so drop the old overload first.
+-- The new parameter is last and defaulted, so existing domain RPCs keep working.
+
+DROP FUNCTION payments.create_and_link_payment(NAME, NAME, ANYELEMENT, NAME, NUMERIC, TEXT, UUID, TEXT);
+
+CREATE OR REPLACE FUNCTION payments.create_and_link_payment(
+    p_entity_table_name NAME,
+    p_entity_id_column_name NAME,
+    p_entity_id_value ANYELEMENT,
+    p_payment_column_name NAME,
+    p_amount NUMERIC(10,2),
+    p_description TEXT,
+    p_user_id UUID DEFAULT current_user_id(),
+    p_currency TEXT DEFAULT 'USD',
+    p_provider TEXT DEFAULT 'stripe'
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment_id UUID;
+    v_sql TEXT;
+BEGIN
+    -- Validate inputs
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid payment amount: %. Amount must be greater than zero.', p_amount;
+    END IF;
+
+    IF p_user_id IS NULL THEN
+        RAISE EXCEPTION 'User ID required for payment creation';
+    END IF;
+
+    -- Validate currency (POC only supports USD)
+    IF p_currency != 'USD' THEN
+        RAISE EXCEPTION 'Only USD currency supported in POC (got: %)', p_currency;
+    END IF;
+
+    -- Create payment record with entity reference
+    -- Trigger will automatically enqueue River job; the worker routes it to p_provider
+    INSERT INTO payments.transactions (
+        user_id,
+        amount,
+        currency,
+        status,
+        description,
+        provider,
+        entity_type,
+        entity_id
+    ) VALUES (
+        p_user_id,
+        p_amount,
+        p_currency,
+        'pending_intent',  -- Worker will update to 'pending' after creating provider intent
+        p_description,
+        p_provider,
+        p_entity_table_name::TEXT,
+        p_entity_id_value::TEXT
+    ) RETURNING id INTO v_payment_id;
+
+    -- Link payment to entity using dynamic SQL
+    -- Use format() with %I (identifier) to prevent SQL injection
+    v_sql := format(
+        'UPDATE %I SET %I = $1 WHERE %I = $2',
+        p_entity_table_name,
+        p_payment_column_name,
+        p_entity_id_column_name
+    );
+
+    EXECUTE v_sql USING v_payment_id, p_entity_id_value;
+
+    -- Verify the entity was updated
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Entity not found: %.% = %', p_entity_table_name, p_entity_id_column_name, p_entity_id_value;
+    END IF;
+
+    RETURN v_payment_id;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.create_and_link_payment IS
+    'Create payment record and atomically link to entity. Stores entity_type and entity_id for reverse lookup. p_provider selects the payment processor (stripe, square, paypal). Prevents common errors: wrong status, missing entity link, incorrect currency. Uses format() with %I for safe dynamic SQL.';
+
+GRANT EXECUTE ON FUNCTION payments.create_and_link_payment TO authenticated;
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{transactions}',
+   '{provider}',
+   'v0-71-0-payment-providers',
+   'Per-transaction payment provider selection',
+   'accepted',
+   'The payment subsystem only supported Stripe. Municipalities under contract with Square or PayPal could not use it.',
+   'payments.transactions.provider accepts stripe, square and paypal. The payment worker implements each behind one PaymentProvider interface (create intent, refund, webhook verification) and serves a webhook endpoint per configured provider at /webhooks/<provider>. create_and_link_payment takes an optional p_provider.',
+   'Keeping the provider on the row (rather than a global setting) lets a deployment migrate processors without touching in-flight payments, and lets refunds and webhooks always reach the processor that took the payment.',
+   'Square checkouts use hosted payment links: provider_payment_id is the order ID and provider_client_secret the link URL. PayPal orders are captured by the worker when the CHECKOUT.ORDER.APPROVED webhook arrives. Only providers with credentials in the worker environment can process payments; rows naming an unconfigured provider fail with an error.');
+
+COMMIT;
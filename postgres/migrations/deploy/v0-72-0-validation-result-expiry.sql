@@ -0,0 +1,233 @@
+-- Deploy civic_os:v0-72-0-validation-result-expiry to pg
+-- requires: v0-71-0-payment-providers
+--
+-- v0.72.0 — Expire template validation/preview results:
+--   1. consumed_at on template_validation_results, stamped when the UI reads
+--      completed results
+--   2. get_validation_results() / get_preview_results() stamp consumed_at
+--   3. metadata.purge_validation_results() for the worker's cleanup cron
+--      (consumed results after a short grace, everything past retention)
+--   4. cleanup_old_validation_results() delegates to the purge function
+--   5. Record schema decision
+--
+-- Preview results hold templates rendered with sample (often real) entity
+-- data; nothing deleted them, so they accumulated indefinitely.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. CONSUMED_AT COLUMN
+-- ============================================================================
+
+ALTER TABLE metadata.template_validation_results
+    ADD COLUMN consumed_at TIMESTAMPTZ;
+
+CREATE INDEX idx_template_validation_results_created_at
+    ON metadata.template_validation_results(created_at);
+CREATE INDEX idx_template_validation_results_consumed_at
+    ON metadata.template_validation_results(consumed_at)
+    WHERE consumed_at IS NOT NULL;
+
+COMMENT ON COLUMN metadata.template_validation_results.consumed_at IS
+    'When the UI first read completed results. Consumed rows are purged by the consolidated worker after a short grace period.';
+COMMENT ON TABLE metadata.template_validation_results IS
+    'Temporary storage for template validation requests. Purged once consumed, or after VALIDATION_RESULT_RETENTION_MINUTES (default 60) by the consolidated worker.';
+
+
+-- ============================================================================
+-- 2. STAMP CONSUMED_AT ON READ
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION get_validation_results(
+    p_validation_id UUID
+)
+RETURNS TABLE(
+    status TEXT,
+    part_name TEXT,
+    valid BOOLEAN,
+    error_message TEXT
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_status TEXT;
+BEGIN
+    -- Check validation status
+    SELECT tvr.status
+    INTO v_status
+    FROM metadata.template_validation_results tvr
+    WHERE tvr.id = p_validation_id;
+
+    IF v_status IS NULL THEN
+        RAISE EXCEPTION 'Validation ID not found: %', p_validation_id;
+    END IF;
+
+    -- Return status and results (if completed)
+    IF v_status = 'completed' THEN
+        RETURN QUERY
+        SELECT
+            v_status,
+            pvr.part_name::TEXT,
+            pvr.valid,
+            pvr.error_message
+        FROM metadata.template_part_validation_results pvr
+        WHERE pvr.validation_id = p_validation_id
+        ORDER BY
+            CASE pvr.part_name
+                WHEN 'subject' THEN 1
+                WHEN 'html' THEN 2
+                WHEN 'text' THEN 3
+                WHEN 'sms' THEN 4
+            END;
+
+        -- Mark consumed; the worker's cleanup cron purges consumed results
+        -- shortly after instead of waiting for the retention TTL
+        UPDATE metadata.template_validation_results tvr
+        SET consumed_at = COALESCE(tvr.consumed_at, NOW())
+        WHERE tvr.id = p_validation_id;
+    ELSE
+        -- Return just status (pending/processing)
+        RETURN QUERY SELECT v_status, NULL::TEXT, NULL::BOOLEAN, NULL::TEXT;
+    END IF;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION get_validation_results TO authenticated;
+
+COMMENT ON FUNCTION get_validation_results IS
+    'Retrieves validation results for a given validation_id. Returns status (pending/completed) and results if available. Completed results are marked consumed and purged by the worker shortly after.';
+
+
+CREATE OR REPLACE FUNCTION get_preview_results(
+    p_validation_id UUID
+)
+RETURNS TABLE(
+    status TEXT,
+    part_name TEXT,
+    rendered_output TEXT,
+    error_message TEXT
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_status TEXT;
+BEGIN
+    -- Check validation status
+    SELECT tvr.status
+    INTO v_status
+    FROM metadata.template_validation_results tvr
+    WHERE tvr.id = p_validation_id;
+
+    IF v_status IS NULL THEN
+        RAISE EXCEPTION 'Validation ID not found: %', p_validation_id;
+    END IF;
+
+    -- Return status and results (if completed)
+    IF v_status = 'completed' THEN
+        RETURN QUERY
+        SELECT
+            v_status,
+            pvr.part_name::TEXT,
+            CASE WHEN pvr.valid THEN pvr.error_message ELSE NULL END AS rendered_output,
+            CASE WHEN NOT pvr.valid THEN pvr.error_message ELSE NULL END AS error_message
+        FROM metadata.template_part_validation_results pvr
+        WHERE pvr.validation_id = p_validation_id
+        ORDER BY
+            CASE pvr.part_name
+                WHEN 'subject' THEN 1
+                WHEN 'html' THEN 2
+                WHEN 'text' THEN 3
+                WHEN 'sms' THEN 4
+            END;
+
+        -- Mark consumed; the worker's cleanup cron purges consumed results
+        -- shortly after instead of waiting for the retention TTL
+        UPDATE metadata.template_validation_results tvr
+        SET consumed_at = COALESCE(tvr.consumed_at, NOW())
+        WHERE tvr.id = p_validation_id;
+    ELSE
+        -- Return just status (pending/processing)
+        RETURN QUERY SELECT v_status, NULL::TEXT, NULL::TEXT, NULL::TEXT;
+    END IF;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION get_preview_results TO authenticated;
+
+COMMENT ON FUNCTION get_preview_results IS
+    'Retrieves preview results for a given validation_id. Returns status (pending/completed) and rendered output or errors. Completed results are marked consumed and purged by the worker shortly after.';
+
+
+-- ============================================================================
+-- 3. PURGE FUNCTION (worker only)
+-- ============================================================================
+-- The grace period covers overlapping UI polls that are still in flight when
+-- the first completed response arrives.
+
+CREATE OR REPLACE FUNCTION metadata.purge_validation_results(
+    p_retention INTERVAL,
+    p_consumed_grace INTERVAL DEFAULT INTERVAL '1 minute'
+)
+RETURNS INTEGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_deleted INTEGER;
+BEGIN
+    -- Part results cascade
+    DELETE FROM metadata.template_validation_results
+    WHERE created_at < NOW() - p_retention
+       OR consumed_at < NOW() - p_consumed_grace;
+
+    GET DIAGNOSTICS v_deleted = ROW_COUNT;
+    RETURN v_deleted;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.purge_validation_results IS
+    'Deletes template validation/preview results consumed more than p_consumed_grace ago or created more than p_retention ago. Called by the consolidated worker. Returns deleted request count.';
+
+
+-- ============================================================================
+-- 4. LEGACY CLEANUP RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION cleanup_old_validation_results()
+RETURNS void
+SECURITY DEFINER
+SET search_path = metadata, public
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    PERFORM metadata.purge_validation_results(INTERVAL '1 hour');
+END;
+$$;
+
+COMMENT ON FUNCTION cleanup_old_validation_results IS
+    'Deletes validation results older than 1 hour or already consumed. The consolidated worker now runs this automatically; kept for manual use.';
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{template_validation_results,template_part_validation_results}',
+   '{consumed_at}',
+   'v0-72-0-validation-result-expiry',
+   'Expire template validation and preview results',
+   'accepted',
+   'Validation and preview results were documented as expiring after an hour, but cleanup_old_validation_results() was never scheduled. Preview rows store templates rendered with sample entity data, so they accumulated indefinitely with potentially sensitive content.',
+   'get_validation_results() and get_preview_results() stamp consumed_at when they return completed results. A consolidated-worker cron calls metadata.purge_validation_results() every minute, deleting consumed rows after a one-minute grace and all rows past VALIDATION_RESULT_RETENTION_MINUTES. The preview worker caps stored rendered output at PREVIEW_MAX_OUTPUT_BYTES with a truncation marker.',
+   'Marking instead of deleting on read keeps overlapping UI polls working. Running the purge in the worker (like gallery cleanup) avoids depending on pg_cron.',
+   'A validation_id can no longer be re-read more than about a minute after its results were first returned. Previews of very large HTML templates show a truncation marker instead of the full output.');
+
+COMMIT;
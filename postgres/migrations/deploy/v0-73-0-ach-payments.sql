@@ -0,0 +1,217 @@
+-- Deploy civic_os:v0-73-0-ach-payments to pg
+-- requires: v0-72-0-validation-result-expiry
+--
+-- v0.73.0 — ACH debit (us_bank_account) payments:
+--   1. payments.transactions.payment_method ('card' or 'us_bank_account')
+--      and mandate_id (Stripe mandate accepted by the payer)
+--   2. New 'processing' status for debits awaiting settlement
+--   3. check_existing_payment treats 'processing' as already paid
+--   4. create_and_link_payment gains p_payment_method (defaults to 'card')
+--   5. Record schema decision
+--
+-- ACH debits confirm immediately but settle 3-5 business days later, so the
+-- webhook flow becomes pending → processing → succeeded/failed.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. PAYMENT METHOD AND MANDATE COLUMNS
+-- ============================================================================
+
+ALTER TABLE payments.transactions
+    ADD COLUMN payment_method TEXT NOT NULL DEFAULT 'card',
+    ADD COLUMN mandate_id TEXT;
+
+-- Only Stripe supports bank debits today
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_payment_method
+    CHECK (payment_method IN ('card', 'us_bank_account')
+           AND (payment_method = 'card' OR provider = 'stripe'));
+
+COMMENT ON COLUMN payments.transactions.payment_method IS
+    'Payment method offered at checkout: card (default) or us_bank_account (ACH debit, Stripe only). Bank debits pass through the processing status while they settle.';
+COMMENT ON COLUMN payments.transactions.mandate_id IS
+    'Stripe mandate (mandate_...) the payer accepted to authorize an ACH debit. Recorded from webhooks; retained as proof of authorization.';
+
+
+-- ============================================================================
+-- 2. PROCESSING STATUS
+-- ============================================================================
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_status;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_status CHECK (status IN (
+    'pending_intent',  -- Initial state, waiting for worker to create provider intent
+    'pending',         -- Intent created, waiting for customer confirmation
+    'processing',      -- Customer confirmed, funds not yet settled (ACH debits)
+    'succeeded',       -- Payment succeeded
+    'failed',          -- Payment failed
+    'canceled'         -- Payment canceled
+));
+
+
+-- ============================================================================
+-- 3. check_existing_payment: PROCESSING IS NOT RETRYABLE
+-- ============================================================================
+-- A debit that is still settling must not be charged again, so 'processing'
+-- returns 'duplicate' like 'succeeded'. If the debit later fails, the row
+-- moves to 'failed' and a retry is allowed.
+
+CREATE OR REPLACE FUNCTION payments.check_existing_payment(
+    p_payment_id UUID
+)
+RETURNS TEXT
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+    v_payment_status TEXT;
+BEGIN
+    -- No existing payment - create new
+    IF p_payment_id IS NULL THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Get status of existing payment
+    SELECT status INTO v_payment_status
+    FROM payments.transactions
+    WHERE id = p_payment_id;
+
+    -- Payment not found (shouldn't happen if FK constraint exists, but be defensive)
+    IF NOT FOUND THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment in progress - reuse existing PaymentIntent
+    IF v_payment_status IN ('pending_intent', 'pending') THEN
+        RETURN 'reuse';
+    END IF;
+
+    -- Payment failed or canceled - allow retry with NEW transaction
+    -- Important: Don't modify old transaction, it stays as audit trail
+    IF v_payment_status IN ('failed', 'canceled') THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment succeeded or settling - prevent duplicate charge
+    IF v_payment_status IN ('succeeded', 'processing') THEN
+        RETURN 'duplicate';
+    END IF;
+
+    -- Unknown status - fail safe
+    RAISE EXCEPTION 'Unexpected payment status: %', v_payment_status;
+END;
+$$;
+
+
+-- ============================================================================
+-- 4. create_and_link_payment WITH PAYMENT METHOD
+-- ============================================================================
+
+DROP FUNCTION payments.create_and_link_payment(NAME, NAME, ANYELEMENT, NAME, NUMERIC, TEXT, UUID, TEXT, TEXT);
+
+CREATE OR REPLACE FUNCTION payments.create_and_link_payment(
+    p_entity_table_name NAME,
+    p_entity_id_column_name NAME,
+    p_entity_id_value ANYELEMENT,
+    p_payment_column_name NAME,
+    p_amount NUMERIC(10,2),
+    p_description TEXT,
+    p_user_id UUID DEFAULT current_user_id(),
+    p_currency TEXT DEFAULT 'USD',
+    p_provider TEXT DEFAULT 'stripe',
+    p_payment_method TEXT DEFAULT 'card'
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment_id UUID;
+    v_sql TEXT;
+BEGIN
+    -- Validate inputs
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid payment amount: %. Amount must be greater than zero.', p_amount;
+    END IF;
+
+    IF p_user_id IS NULL THEN
+        RAISE EXCEPTION 'User ID required for payment creation';
+    END IF;
+
+    -- Validate currency (POC only supports USD)
+    IF p_currency != 'USD' THEN
+        RAISE EXCEPTION 'Only USD currency supported in POC (got: %)', p_currency;
+    END IF;
+
+    IF p_payment_method = 'us_bank_account' AND p_provider != 'stripe' THEN
+        RAISE EXCEPTION 'Bank account payments are only supported with Stripe (got: %)', p_provider;
+    END IF;
+
+    -- Create payment record with entity reference
+    -- Trigger will automatically enqueue River job; the worker routes it to p_provider
+    INSERT INTO payments.transactions (
+        user_id,
+        amount,
+        currency,
+        status,
+        description,
+        provider,
+        payment_method,
+        entity_type,
+        entity_id
+    ) VALUES (
+        p_user_id,
+        p_amount,
+        p_currency,
+        'pending_intent',  -- Worker will update to 'pending' after creating provider intent
+        p_description,
+        p_provider,
+        p_payment_method,
+        p_entity_table_name::TEXT,
+        p_entity_id_value::TEXT
+    ) RETURNING id INTO v_payment_id;
+
+    -- Link payment to entity using dynamic SQL
+    -- Use format() with %I (identifier) to prevent SQL injection
+    v_sql := format(
+        'UPDATE %I SET %I = $1 WHERE %I = $2',
+        p_entity_table_name,
+        p_payment_column_name,
+        p_entity_id_column_name
+    );
+
+    EXECUTE v_sql USING v_payment_id, p_entity_id_value;
+
+    -- Verify the entity was updated
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Entity not found: %.% = %', p_entity_table_name, p_entity_id_column_name, p_entity_id_value;
+    END IF;
+
+    RETURN v_payment_id;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.create_and_link_payment IS
+    'Create payment record and atomically link to entity. Stores entity_type and entity_id for reverse lookup. p_provider selects the payment processor (stripe, square, paypal); p_payment_method selects card or us_bank_account (ACH, Stripe only). Prevents common errors: wrong status, missing entity link, incorrect currency. Uses format() with %I for safe dynamic SQL.';
+
+GRANT EXECUTE ON FUNCTION payments.create_and_link_payment TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{transactions}',
+   '{payment_method,mandate_id,status}',
+   'v0-73-0-ach-payments',
+   'ACH debit payments with a processing status',
+   'accepted',
+   'Large permit fees are commonly paid by bank transfer rather than card, where card processing fees are a significant cost. ACH debits confirm at checkout but settle days later and can still fail.',
+   'payments.transactions.payment_method selects card or us_bank_account per transaction. The worker creates Stripe PaymentIntents restricted to us_bank_account with instant Financial Connections verification. A new processing status covers the settlement window: payment_intent.processing moves pending → processing, then payment_intent.succeeded or payment_failed finalizes it. The accepted mandate ID is stored on the row.',
+   'A distinct status keeps "confirmed but unsettled" payments out of both the paid and the retryable states, so payment-succeeded notifications only fire once funds settle and the payer cannot start a second debit while the first is in flight.',
+   'check_existing_payment returns duplicate for processing payments. Integrations that test status = ''succeeded'' are unaffected; UIs should show processing as in-progress. Bank debits are rejected for Square and PayPal.');
+
+COMMIT;
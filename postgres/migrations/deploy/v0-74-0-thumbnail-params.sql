@@ -0,0 +1,96 @@
+-- Deploy civic_os:v0-74-0-thumbnail-params to pg
+-- requires: v0-73-0-ach-payments
+--
+-- v0.74.0 — Differential thumbnail regeneration:
+--   1. metadata.files.thumbnail_params records the size/quality/format each
+--      thumbnail was generated with
+--   2. public.queue_thumbnail_backfill() queues a worker pass that
+--      regenerates only thumbnails whose parameters differ from the current
+--      profile
+--   3. Record schema decision
+--
+-- Existing files have NULL params, so the first backfill after upgrading
+-- regenerates everything once; later profile changes only touch the sizes
+-- that changed.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. THUMBNAIL PARAMETERS
+-- ============================================================================
+
+ALTER TABLE metadata.files
+    ADD COLUMN thumbnail_params JSONB;
+
+COMMENT ON COLUMN metadata.files.thumbnail_params IS
+    'Parameters each thumbnail was generated with, keyed by size: {"small": {"width": 150, "height": 150, "quality": 80, "format": "jpeg"}, ...}. Written by the thumbnail worker; a size whose entry differs from the worker profile is regenerated by the backfill. Added in v0.74.0.';
+
+-- public.files is SELECT * but was created before this column; it is an
+-- internal worker detail, so the view is intentionally not recreated.
+
+
+-- ============================================================================
+-- 2. BACKFILL TRIGGER RPC
+-- ============================================================================
+-- The worker owns the thumbnail profile (it comes from its environment), so
+-- the comparison happens there. This only queues the first batch; each batch
+-- queues the next until all files have been checked.
+
+CREATE OR REPLACE FUNCTION public.queue_thumbnail_backfill()
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_job_id BIGINT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can regenerate thumbnails';
+    END IF;
+
+    INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+    VALUES (
+        'available',
+        'thumbnails',
+        'thumbnail_backfill',
+        '{}'::jsonb,
+        4,  -- Below new uploads (1) so the backfill never delays them
+        5,
+        NOW()
+    )
+    RETURNING id INTO v_job_id;
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'job_id', v_job_id,
+        'message', 'Thumbnail backfill queued; only files with outdated thumbnail parameters are regenerated'
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.queue_thumbnail_backfill() IS
+    'Admin-only. Queues a thumbnail_backfill job that compares each completed file''s thumbnail_params with the worker''s current profile and regenerates only outdated sizes. Added in v0.74.0.';
+
+REVOKE EXECUTE ON FUNCTION public.queue_thumbnail_backfill() FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.queue_thumbnail_backfill() TO authenticated;
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{files}',
+   '{thumbnail_params}',
+   'v0-74-0-thumbnail-params',
+   'Per-thumbnail processing parameters for differential regeneration',
+   'accepted',
+   'Thumbnail sizes and JPEG quality were hard-coded, and changing them meant re-downloading every original from S3 and regenerating every size, even when only one size''s quality changed.',
+   'The thumbnail worker stores the width, height, quality and format used for each size in metadata.files.thumbnail_params. A thumbnail_backfill job pages through completed files, compares the stored parameters with the worker''s profile, and queues thumbnail_generate only for files with differences; the worker then regenerates only the differing sizes. Originals are read through a size-bounded local disk cache when one is configured.',
+   'Storing what was actually produced (rather than a profile version number) lets the comparison be per size and survive profile edits in any order.',
+   'Files uploaded before v0.74.0 have NULL params and are fully regenerated on the first backfill. Regenerated thumbnails overwrite the same S3 keys, so CDN or browser caches may serve the previous image until they expire.');
+
+COMMIT;
@@ -0,0 +1,356 @@
+-- Deploy civic_os:v0-75-0-signature-requests to pg
+-- requires: v0-74-0-thumbnail-params
+--
+-- v0.75.0 — Document signing requests:
+--   1. metadata.files.previous_version_id links a file to the file it
+--      supersedes (signed copies point at the unsigned document)
+--   2. metadata.signature_requests tracks one document sent to one signer
+--   3. Trigger enqueues signature_send jobs for new requests
+--   4. public.request_signature() RPC for integrators and entity actions
+--   5. metadata.apply_signature_outcome() records the result and advances
+--      the entity's status column (worker-only)
+--   6. public.get_signature_requests() lists requests for an entity
+--   7. Record schema decision
+--
+-- Flow: request_signature → signature_send (worker uploads the PDF to the
+-- provider) → poll sees completion → signature_complete (worker downloads the
+-- signed PDF, stores it as a new file version, advances status).
+
+BEGIN;
+
+-- ============================================================================
+-- 1. FILE VERSIONS
+-- ============================================================================
+
+ALTER TABLE metadata.files
+    ADD COLUMN previous_version_id UUID REFERENCES metadata.files(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_files_previous_version ON metadata.files(previous_version_id)
+    WHERE previous_version_id IS NOT NULL;
+
+COMMENT ON COLUMN metadata.files.previous_version_id IS
+    'File this one supersedes (e.g., the unsigned document a signed copy was produced from). NULL for original uploads. Added in v0.75.0.';
+
+
+-- ============================================================================
+-- 2. SIGNATURE REQUESTS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.signature_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+
+    -- Entity the document belongs to (same polymorphic shape as metadata.files)
+    entity_type NAME NOT NULL,
+    entity_id TEXT NOT NULL,
+
+    source_file_id UUID NOT NULL REFERENCES metadata.files(id) ON DELETE RESTRICT,
+    signed_file_id UUID REFERENCES metadata.files(id) ON DELETE SET NULL,
+
+    signer_email TEXT NOT NULL,
+    signer_name TEXT NOT NULL,
+    email_subject TEXT,
+
+    -- Provider tracking (set by the worker)
+    provider TEXT,
+    envelope_id TEXT,
+
+    status TEXT NOT NULL DEFAULT 'pending',
+    error_message TEXT,
+
+    -- Optional workflow advancement on the entity
+    status_column NAME,
+    completed_status_key TEXT,
+    declined_status_key TEXT,
+
+    requested_by UUID REFERENCES metadata.civic_os_users(id) DEFAULT current_user_id(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMPTZ,
+    last_checked_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+
+    CONSTRAINT valid_signature_status CHECK (status IN (
+        'pending',    -- Created, waiting for worker to send to provider
+        'sent',       -- Envelope sent, waiting for signer
+        'signed',     -- Provider reports signed, worker storing the signed copy
+        'completed',  -- Signed copy stored as a new file version
+        'declined',   -- Signer declined
+        'voided',     -- Envelope voided at the provider
+        'failed'      -- Sending or storing failed permanently
+    )),
+    CONSTRAINT status_keys_need_column CHECK (
+        status_column IS NOT NULL OR (completed_status_key IS NULL AND declined_status_key IS NULL)
+    )
+);
+
+CREATE INDEX idx_signature_requests_entity ON metadata.signature_requests(entity_type, entity_id);
+CREATE INDEX idx_signature_requests_open ON metadata.signature_requests(last_checked_at NULLS FIRST)
+    WHERE status = 'sent';
+CREATE UNIQUE INDEX idx_signature_requests_envelope ON metadata.signature_requests(provider, envelope_id)
+    WHERE envelope_id IS NOT NULL;
+
+CREATE TRIGGER set_updated_at_trigger
+    BEFORE UPDATE ON metadata.signature_requests
+    FOR EACH ROW
+    EXECUTE FUNCTION public.set_updated_at();
+
+COMMENT ON TABLE metadata.signature_requests IS
+    'E-signature requests: one PDF from metadata.files sent to one signer through the configured provider. Managed by request_signature() and the consolidated worker. Added in v0.75.0.';
+COMMENT ON COLUMN metadata.signature_requests.status IS
+    'Lifecycle: pending → sent → signed → completed, or sent → declined/voided. failed when sending or storing gives up.';
+COMMENT ON COLUMN metadata.signature_requests.envelope_id IS
+    'Provider envelope/document ID. Set once by the signature_send job.';
+COMMENT ON COLUMN metadata.signature_requests.status_column IS
+    'Status column on the entity table to advance when the request completes or is declined. Its status type comes from metadata.properties.status_entity_type.';
+
+
+-- ============================================================================
+-- 3. ENQUEUE SEND JOB
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.enqueue_signature_send_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+    VALUES (
+        'available',
+        'signatures',
+        'signature_send',
+        jsonb_build_object('request_id', NEW.id),
+        1,
+        5,
+        NOW()
+    );
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER enqueue_signature_send_job_trigger
+    AFTER INSERT ON metadata.signature_requests
+    FOR EACH ROW
+    WHEN (NEW.status = 'pending')
+    EXECUTE FUNCTION metadata.enqueue_signature_send_job();
+
+
+-- ============================================================================
+-- 4. REQUEST SIGNATURE RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.request_signature(
+    p_entity_type NAME,
+    p_entity_id TEXT,
+    p_file_id UUID,
+    p_signer_email TEXT,
+    p_signer_name TEXT,
+    p_status_column NAME DEFAULT NULL,
+    p_completed_status_key TEXT DEFAULT NULL,
+    p_declined_status_key TEXT DEFAULT NULL,
+    p_email_subject TEXT DEFAULT NULL
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_file_type TEXT;
+    v_status_type TEXT;
+    v_key TEXT;
+    v_request_id UUID;
+BEGIN
+    IF NOT public.has_permission(p_entity_type, 'update') THEN
+        RAISE EXCEPTION 'Permission denied: update on %', p_entity_type;
+    END IF;
+
+    IF p_signer_email IS NULL OR p_signer_email !~ '^[^@\s]+@[^@\s]+\.[^@\s]+$' THEN
+        RAISE EXCEPTION 'Invalid signer email: %', p_signer_email;
+    END IF;
+
+    IF COALESCE(TRIM(p_signer_name), '') = '' THEN
+        RAISE EXCEPTION 'Signer name is required';
+    END IF;
+
+    -- The document must be a PDF attached to this entity
+    SELECT file_type INTO v_file_type
+    FROM metadata.files
+    WHERE id = p_file_id
+      AND entity_type = p_entity_type
+      AND entity_id = p_entity_id;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'File % is not attached to %.%', p_file_id, p_entity_type, p_entity_id;
+    END IF;
+
+    IF lower(v_file_type) NOT IN ('application/pdf', 'application/x-pdf', 'pdf') THEN
+        RAISE EXCEPTION 'Only PDF documents can be sent for signature (got: %)', v_file_type;
+    END IF;
+
+    -- Resolve status keys now so a typo fails here, not after signing
+    IF p_status_column IS NOT NULL THEN
+        SELECT status_entity_type INTO v_status_type
+        FROM metadata.properties
+        WHERE table_name = p_entity_type AND column_name = p_status_column;
+
+        IF v_status_type IS NULL THEN
+            RAISE EXCEPTION 'Column %.% is not a status column', p_entity_type, p_status_column;
+        END IF;
+
+        FOREACH v_key IN ARRAY ARRAY_REMOVE(ARRAY[p_completed_status_key, p_declined_status_key], NULL) LOOP
+            IF public.get_status_id(v_status_type, v_key) IS NULL THEN
+                RAISE EXCEPTION 'Unknown status key % for status type %', v_key, v_status_type;
+            END IF;
+        END LOOP;
+    END IF;
+
+    INSERT INTO metadata.signature_requests (
+        entity_type, entity_id, source_file_id,
+        signer_email, signer_name, email_subject,
+        status_column, completed_status_key, declined_status_key
+    ) VALUES (
+        p_entity_type, p_entity_id, p_file_id,
+        lower(TRIM(p_signer_email)), TRIM(p_signer_name), p_email_subject,
+        p_status_column, p_completed_status_key, p_declined_status_key
+    ) RETURNING id INTO v_request_id;
+
+    RETURN v_request_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_signature IS
+    'Send a PDF attached to an entity for e-signature. Requires update permission on the entity type. When p_status_column is given, the entity''s status is set to p_completed_status_key once signed (or p_declined_status_key if declined/voided). Returns the signature request ID. Added in v0.75.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_signature FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_signature TO authenticated;
+
+
+-- ============================================================================
+-- 5. APPLY OUTCOME (WORKER-ONLY)
+-- ============================================================================
+-- Lives in metadata (hidden from PostgREST). Records the final state and
+-- advances the entity status column using format() with %I for safe dynamic
+-- SQL, like payments.create_and_link_payment.
+
+CREATE OR REPLACE FUNCTION metadata.apply_signature_outcome(
+    p_request_id UUID,
+    p_status TEXT,
+    p_signed_file_id UUID DEFAULT NULL,
+    p_error TEXT DEFAULT NULL
+)
+RETURNS VOID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_request metadata.signature_requests%ROWTYPE;
+    v_status_type TEXT;
+    v_status_key TEXT;
+BEGIN
+    IF p_status NOT IN ('completed', 'declined', 'voided', 'failed') THEN
+        RAISE EXCEPTION 'Not a final signature status: %', p_status;
+    END IF;
+
+    UPDATE metadata.signature_requests
+    SET status = p_status,
+        signed_file_id = COALESCE(p_signed_file_id, signed_file_id),
+        error_message = p_error,
+        completed_at = CASE WHEN p_status = 'completed' THEN NOW() ELSE completed_at END
+    WHERE id = p_request_id
+    RETURNING * INTO v_request;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Signature request not found: %', p_request_id;
+    END IF;
+
+    v_status_key := CASE p_status
+        WHEN 'completed' THEN v_request.completed_status_key
+        WHEN 'declined' THEN v_request.declined_status_key
+        WHEN 'voided' THEN v_request.declined_status_key
+    END;
+
+    IF v_request.status_column IS NULL OR v_status_key IS NULL THEN
+        RETURN;
+    END IF;
+
+    SELECT status_entity_type INTO v_status_type
+    FROM metadata.properties
+    WHERE table_name = v_request.entity_type AND column_name = v_request.status_column;
+
+    EXECUTE format('UPDATE public.%I SET %I = $1 WHERE id::text = $2',
+                   v_request.entity_type, v_request.status_column)
+    USING public.get_status_id(v_status_type, v_status_key), v_request.entity_id;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.apply_signature_outcome IS
+    'Worker-only. Moves a signature request to a final status and, when configured, advances the entity''s status column. Added in v0.75.0.';
+
+
+-- ============================================================================
+-- 6. LIST REQUESTS FOR AN ENTITY
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_signature_requests(
+    p_entity_type NAME,
+    p_entity_id TEXT
+)
+RETURNS TABLE (
+    id UUID,
+    source_file_id UUID,
+    signed_file_id UUID,
+    signer_email TEXT,
+    signer_name TEXT,
+    status TEXT,
+    error_message TEXT,
+    created_at TIMESTAMPTZ,
+    sent_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.has_permission(p_entity_type, 'read') THEN
+        RAISE EXCEPTION 'Permission denied: read on %', p_entity_type;
+    END IF;
+
+    RETURN QUERY
+    SELECT r.id, r.source_file_id, r.signed_file_id, r.signer_email, r.signer_name,
+           r.status, r.error_message, r.created_at, r.sent_at, r.completed_at
+    FROM metadata.signature_requests r
+    WHERE r.entity_type = p_entity_type AND r.entity_id = p_entity_id
+    ORDER BY r.created_at DESC;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_signature_requests IS
+    'Signature requests for one entity, newest first. Requires read permission on the entity type. Added in v0.75.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_signature_requests FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_signature_requests TO authenticated;
+
+
+-- ============================================================================
+-- 7. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{signature_requests,files}',
+   '{previous_version_id}',
+   'v0-75-0-signature-requests',
+   'E-signature requests with signed copies stored as file versions',
+   'accepted',
+   'Permits often require resident signatures. Staff were downloading generated PDFs, collecting signatures outside Civic OS, re-uploading them and changing the status by hand.',
+   'request_signature() records a signature request for a PDF attached to an entity; the consolidated worker sends it to the configured provider (DocuSign, or a fake provider for development), polls open envelopes, and on completion uploads the signed PDF as a new metadata.files row whose previous_version_id points at the unsigned document. The request may name a status column and status keys to apply on completion or decline.',
+   'Polling needs no public webhook endpoint on the consolidated worker, and signing turnaround is measured in hours, so a few minutes of latency is acceptable. A new file row (instead of overwriting the original) keeps the unsigned document for audit and reuses the existing thumbnail and download pipeline.',
+   'The signed copy is attached to the entity but not linked into any file column; integrators who want it in a column can read signed_file_id. Status advancement writes the column directly and does not run status_transitions RPCs.');
+
+COMMIT;
@@ -0,0 +1,504 @@
+-- Deploy civic_os:v0-76-0-manual-capture to pg
+-- requires: v0-75-0-signature-requests
+--
+-- v0.76.0 — Authorize-then-capture payments:
+--   1. payments.transactions.capture_method ('automatic' or 'manual') and
+--      authorization timestamps (authorized_at, capture_before, captured_at)
+--   2. New 'requires_capture' status for authorized, uncaptured payments
+--   3. check_existing_payment treats 'requires_capture' as already paid
+--   4. create_and_link_payment gains p_capture_method (defaults to 'automatic')
+--   5. public.capture_payment() and public.void_payment() RPCs enqueue
+--      capture_payment / cancel_payment_intent jobs
+--   6. payments.expire_uncaptured_authorizations() scheduled job voids
+--      authorizations that reached capture_before
+--   7. payment_transactions view exposes the capture columns
+--   8. Record schema decision
+--
+-- Manual capture places a hold on the card at checkout and only charges it
+-- when staff capture the payment (e.g., a reservation deposit charged only if
+-- the resident doesn't show up). Flow: pending → requires_capture →
+-- succeeded (captured) or canceled (voided or expired).
+
+BEGIN;
+
+-- ============================================================================
+-- 1. CAPTURE METHOD AND AUTHORIZATION COLUMNS
+-- ============================================================================
+
+ALTER TABLE payments.transactions
+    ADD COLUMN capture_method TEXT NOT NULL DEFAULT 'automatic',
+    ADD COLUMN authorized_at TIMESTAMPTZ,
+    ADD COLUMN capture_before TIMESTAMPTZ,
+    ADD COLUMN captured_at TIMESTAMPTZ;
+
+-- Only Stripe card payments support manual capture today
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_capture_method
+    CHECK (capture_method IN ('automatic', 'manual')
+           AND (capture_method = 'automatic' OR (provider = 'stripe' AND payment_method = 'card')));
+
+CREATE INDEX idx_payments_transactions_capture_before ON payments.transactions(capture_before)
+    WHERE status = 'requires_capture';
+
+COMMENT ON COLUMN payments.transactions.capture_method IS
+    'automatic (default) charges at checkout. manual only authorizes the card; staff capture or void it later (Stripe cards only). Added in v0.76.0.';
+COMMENT ON COLUMN payments.transactions.authorized_at IS
+    'When the provider reported the authorization (status became requires_capture).';
+COMMENT ON COLUMN payments.transactions.capture_before IS
+    'Deadline for capturing the authorization. Card networks release holds after about 7 days; expire_uncaptured_authorizations() voids anything still uncaptured at this time.';
+COMMENT ON COLUMN payments.transactions.captured_at IS
+    'When a manual-capture payment was captured by the capture_payment job.';
+
+
+-- ============================================================================
+-- 2. REQUIRES_CAPTURE STATUS
+-- ============================================================================
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_status;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_status CHECK (status IN (
+    'pending_intent',    -- Initial state, waiting for worker to create provider intent
+    'pending',           -- Intent created, waiting for customer confirmation
+    'processing',        -- Customer confirmed, funds not yet settled (ACH debits)
+    'requires_capture',  -- Card authorized, waiting for staff to capture or void (manual capture)
+    'succeeded',         -- Payment succeeded
+    'failed',            -- Payment failed
+    'canceled'           -- Payment canceled (includes voided authorizations)
+));
+
+
+-- ============================================================================
+-- 3. check_existing_payment: AUTHORIZED IS NOT RETRYABLE
+-- ============================================================================
+-- An authorization already holds the payer's funds, so a second checkout
+-- would place a second hold. Voided or expired authorizations move to
+-- 'canceled' and allow a retry.
+
+CREATE OR REPLACE FUNCTION payments.check_existing_payment(
+    p_payment_id UUID
+)
+RETURNS TEXT
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+    v_payment_status TEXT;
+BEGIN
+    -- No existing payment - create new
+    IF p_payment_id IS NULL THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Get status of existing payment
+    SELECT status INTO v_payment_status
+    FROM payments.transactions
+    WHERE id = p_payment_id;
+
+    -- Payment not found (shouldn't happen if FK constraint exists, but be defensive)
+    IF NOT FOUND THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment in progress - reuse existing PaymentIntent
+    IF v_payment_status IN ('pending_intent', 'pending') THEN
+        RETURN 'reuse';
+    END IF;
+
+    -- Payment failed or canceled - allow retry with NEW transaction
+    -- Important: Don't modify old transaction, it stays as audit trail
+    IF v_payment_status IN ('failed', 'canceled') THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment succeeded, settling, or authorized - prevent duplicate charge
+    IF v_payment_status IN ('succeeded', 'processing', 'requires_capture') THEN
+        RETURN 'duplicate';
+    END IF;
+
+    -- Unknown status - fail safe
+    RAISE EXCEPTION 'Unexpected payment status: %', v_payment_status;
+END;
+$$;
+
+
+-- ============================================================================
+-- 4. create_and_link_payment WITH CAPTURE METHOD
+-- ============================================================================
+
+DROP FUNCTION payments.create_and_link_payment(NAME, NAME, ANYELEMENT, NAME, NUMERIC, TEXT, UUID, TEXT, TEXT, TEXT);
+
+CREATE OR REPLACE FUNCTION payments.create_and_link_payment(
+    p_entity_table_name NAME,
+    p_entity_id_column_name NAME,
+    p_entity_id_value ANYELEMENT,
+    p_payment_column_name NAME,
+    p_amount NUMERIC(10,2),
+    p_description TEXT,
+    p_user_id UUID DEFAULT current_user_id(),
+    p_currency TEXT DEFAULT 'USD',
+    p_provider TEXT DEFAULT 'stripe',
+    p_payment_method TEXT DEFAULT 'card',
+    p_capture_method TEXT DEFAULT 'automatic'
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment_id UUID;
+    v_sql TEXT;
+BEGIN
+    -- Validate inputs
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid payment amount: %. Amount must be greater than zero.', p_amount;
+    END IF;
+
+    IF p_user_id IS NULL THEN
+        RAISE EXCEPTION 'User ID required for payment creation';
+    END IF;
+
+    -- Validate currency (POC only supports USD)
+    IF p_currency != 'USD' THEN
+        RAISE EXCEPTION 'Only USD currency supported in POC (got: %)', p_currency;
+    END IF;
+
+    IF p_payment_method = 'us_bank_account' AND p_provider != 'stripe' THEN
+        RAISE EXCEPTION 'Bank account payments are only supported with Stripe (got: %)', p_provider;
+    END IF;
+
+    IF p_capture_method = 'manual' AND (p_provider != 'stripe' OR p_payment_method != 'card') THEN
+        RAISE EXCEPTION 'Manual capture is only supported for Stripe card payments (got: % %)', p_provider, p_payment_method;
+    END IF;
+
+    -- Create payment record with entity reference
+    -- Trigger will automatically enqueue River job; the worker routes it to p_provider
+    INSERT INTO payments.transactions (
+        user_id,
+        amount,
+        currency,
+        status,
+        description,
+        provider,
+        payment_method,
+        capture_method,
+        entity_type,
+        entity_id
+    ) VALUES (
+        p_user_id,
+        p_amount,
+        p_currency,
+        'pending_intent',  -- Worker will update to 'pending' after creating provider intent
+        p_description,
+        p_provider,
+        p_payment_method,
+        p_capture_method,
+        p_entity_table_name::TEXT,
+        p_entity_id_value::TEXT
+    ) RETURNING id INTO v_payment_id;
+
+    -- Link payment to entity using dynamic SQL
+    -- Use format() with %I (identifier) to prevent SQL injection
+    v_sql := format(
+        'UPDATE %I SET %I = $1 WHERE %I = $2',
+        p_entity_table_name,
+        p_payment_column_name,
+        p_entity_id_column_name
+    );
+
+    EXECUTE v_sql USING v_payment_id, p_entity_id_value;
+
+    -- Verify the entity was updated
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Entity not found: %.% = %', p_entity_table_name, p_entity_id_column_name, p_entity_id_value;
+    END IF;
+
+    RETURN v_payment_id;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.create_and_link_payment IS
+    'Create payment record and atomically link to entity. Stores entity_type and entity_id for reverse lookup. p_provider selects the payment processor (stripe, square, paypal); p_payment_method selects card or us_bank_account (ACH, Stripe only); p_capture_method ''manual'' only authorizes the card until capture_payment() is called (Stripe cards only). Prevents common errors: wrong status, missing entity link, incorrect currency. Uses format() with %I for safe dynamic SQL.';
+
+GRANT EXECUTE ON FUNCTION payments.create_and_link_payment TO authenticated;
+
+
+-- ============================================================================
+-- 5. CAPTURE AND VOID RPCs
+-- ============================================================================
+-- Both require payment_transactions:update (granted to admin by default).
+-- The jobs run in the payment worker, which calls the provider and moves the
+-- row to succeeded or canceled.
+
+INSERT INTO metadata.permissions (table_name, permission)
+VALUES ('payment_transactions', 'update')  -- Capture or void authorized payments
+ON CONFLICT (table_name, permission) DO NOTHING;
+
+INSERT INTO metadata.permission_roles (role_id, permission_id)
+SELECT r.id, p.id
+FROM metadata.roles r
+CROSS JOIN metadata.permissions p
+WHERE r.display_name = 'admin'
+  AND p.table_name = 'payment_transactions'
+  AND p.permission = 'update'
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+
+CREATE OR REPLACE FUNCTION public.capture_payment(
+    p_payment_id UUID
+)
+RETURNS VOID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment RECORD;
+BEGIN
+    IF current_user_id() IS NULL THEN
+        RAISE EXCEPTION 'Authentication required';
+    END IF;
+
+    IF NOT public.has_permission('payment_transactions', 'update') THEN
+        RAISE EXCEPTION 'Missing payment_transactions:update permission'
+            USING HINT = 'Contact administrator to grant payment capture permissions';
+    END IF;
+
+    SELECT * INTO v_payment
+    FROM payments.transactions
+    WHERE id = p_payment_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Payment not found: %', p_payment_id;
+    END IF;
+
+    IF v_payment.status != 'requires_capture' THEN
+        RAISE EXCEPTION 'Can only capture authorized payments (current status: %)', v_payment.status;
+    END IF;
+
+    IF v_payment.capture_before IS NOT NULL AND v_payment.capture_before <= NOW() THEN
+        RAISE EXCEPTION 'Authorization expired at %', v_payment.capture_before
+            USING HINT = 'The hold has been released; collect a new payment instead';
+    END IF;
+
+    INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+    VALUES (
+        'available',
+        'default',
+        'capture_payment',
+        jsonb_build_object('payment_id', p_payment_id),
+        1,
+        3,
+        NOW()
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.capture_payment IS
+    'Charge an authorized (requires_capture) payment. Requires payment_transactions:update permission. Enqueues a capture_payment job; the row moves to succeeded once the provider confirms. Added in v0.76.0.';
+
+REVOKE EXECUTE ON FUNCTION public.capture_payment FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.capture_payment TO authenticated;
+
+CREATE OR REPLACE FUNCTION public.void_payment(
+    p_payment_id UUID,
+    p_reason TEXT DEFAULT NULL
+)
+RETURNS VOID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment RECORD;
+BEGIN
+    IF current_user_id() IS NULL THEN
+        RAISE EXCEPTION 'Authentication required';
+    END IF;
+
+    IF NOT public.has_permission('payment_transactions', 'update') THEN
+        RAISE EXCEPTION 'Missing payment_transactions:update permission'
+            USING HINT = 'Contact administrator to grant payment capture permissions';
+    END IF;
+
+    SELECT * INTO v_payment
+    FROM payments.transactions
+    WHERE id = p_payment_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Payment not found: %', p_payment_id;
+    END IF;
+
+    IF v_payment.status != 'requires_capture' THEN
+        RAISE EXCEPTION 'Can only void authorized payments (current status: %)', v_payment.status
+            USING HINT = 'Use a refund for payments that have already been charged';
+    END IF;
+
+    PERFORM payments.enqueue_cancel_payment_intent(p_payment_id, COALESCE(NULLIF(TRIM(p_reason), ''), 'voided'));
+END;
+$$;
+
+COMMENT ON FUNCTION public.void_payment IS
+    'Release an authorized (requires_capture) payment without charging it. Requires payment_transactions:update permission. Enqueues a cancel_payment_intent job; the row moves to canceled once the provider confirms. Added in v0.76.0.';
+
+REVOKE EXECUTE ON FUNCTION public.void_payment FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.void_payment TO authenticated;
+
+
+-- ============================================================================
+-- 6. EXPIRE UNCAPTURED AUTHORIZATIONS
+-- ============================================================================
+-- Stripe cancels uncaptured card PaymentIntents on its own after the
+-- authorization window, but voiding them ourselves releases the payer's hold
+-- promptly and keeps the row in step even if that webhook is missed.
+
+-- Shared by void_payment() and the expiry job (not exposed to PostgREST)
+CREATE OR REPLACE FUNCTION payments.enqueue_cancel_payment_intent(
+    p_payment_id UUID,
+    p_reason TEXT
+)
+RETURNS VOID
+LANGUAGE sql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+    INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+    VALUES (
+        'available',
+        'default',
+        'cancel_payment_intent',
+        jsonb_build_object('payment_id', p_payment_id, 'reason', p_reason),
+        1,
+        3,
+        NOW()
+    );
+$$;
+
+CREATE OR REPLACE FUNCTION payments.expire_uncaptured_authorizations()
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment_id UUID;
+    v_count INTEGER := 0;
+BEGIN
+    FOR v_payment_id IN
+        SELECT t.id
+        FROM payments.transactions t
+        WHERE t.status = 'requires_capture'
+          AND t.capture_before <= NOW()
+          -- Skip payments that already have a cancel job in flight
+          AND NOT EXISTS (
+              SELECT 1 FROM metadata.river_job j
+              WHERE j.kind = 'cancel_payment_intent'
+                AND j.args->>'payment_id' = t.id::TEXT
+                AND j.state IN ('available', 'scheduled', 'running', 'retryable')
+          )
+        FOR UPDATE OF t SKIP LOCKED
+    LOOP
+        PERFORM payments.enqueue_cancel_payment_intent(v_payment_id, 'expired');
+        v_count := v_count + 1;
+    END LOOP;
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'message', format('Queued %s expired authorization(s) for void', v_count),
+        'details', jsonb_build_object('expired_count', v_count)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION payments.expire_uncaptured_authorizations IS
+    'Scheduled job: voids manual-capture payments still uncaptured at capture_before by enqueuing cancel_payment_intent jobs. Added in v0.76.0.';
+
+INSERT INTO metadata.scheduled_jobs (name, function_name, schedule, timezone, description)
+VALUES (
+    'expire_uncaptured_authorizations',
+    'payments.expire_uncaptured_authorizations',
+    '0 * * * *',
+    'UTC',
+    'Voids authorized (manual capture) payments that reached capture_before so the payer''s hold is released.'
+)
+ON CONFLICT (name) DO NOTHING;
+
+
+-- ============================================================================
+-- 7. EXPOSE CAPTURE COLUMNS IN payment_transactions VIEW
+-- ============================================================================
+-- Same definition as v0-65-0-cup-phone-domain.sql with the capture columns
+-- appended (CREATE OR REPLACE VIEW can only add columns at the end).
+
+CREATE OR REPLACE VIEW public.payment_transactions AS
+SELECT
+    t.id,
+    t.user_id,
+    u.display_name AS user_display_name,
+    u.full_name AS user_full_name,
+    u.email AS user_email,
+    t.amount,
+    t.processing_fee,
+    t.total_amount,
+    t.max_refundable,
+    t.fee_percent,
+    t.fee_flat_cents,
+    t.fee_refundable,
+    t.currency,
+    t.status,
+    t.provider_payment_id,
+    COALESCE(r_agg.total_refunded, 0) AS total_refunded,
+    COALESCE(r_agg.refund_count, 0) AS refund_count,
+    COALESCE(r_agg.pending_count, 0) AS pending_refund_count,
+    CASE
+        WHEN r_agg.total_refunded >= t.max_refundable THEN 'refunded'
+        WHEN r_agg.total_refunded > 0 THEN 'partially_refunded'
+        WHEN r_agg.pending_count > 0 THEN 'refund_pending'
+        ELSE COALESCE(t.status, 'unpaid')
+    END AS effective_status,
+    t.error_message,
+    t.provider,
+    t.provider_client_secret,
+    t.description,
+    t.display_name,
+    t.created_at,
+    t.updated_at,
+    t.entity_type,
+    t.entity_id,
+    COALESCE(e.display_name, t.entity_type) AS entity_display_name,
+    t.capture_method,
+    t.authorized_at,
+    t.capture_before,
+    t.captured_at
+FROM payments.transactions t
+LEFT JOIN public.civic_os_users u ON t.user_id = u.id
+LEFT JOIN metadata.entities e ON t.entity_type = e.table_name
+LEFT JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(amount) FILTER (WHERE status = 'succeeded'), 0) AS total_refunded,
+        COUNT(*) FILTER (WHERE status = 'succeeded') AS refund_count,
+        COUNT(*) FILTER (WHERE status = 'pending') AS pending_count
+    FROM payments.refunds
+    WHERE transaction_id = t.id
+) r_agg ON true;
+
+GRANT SELECT ON public.payment_transactions TO authenticated, web_anon;
+
+
+-- ============================================================================
+-- 8. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{transactions}',
+   '{capture_method,authorized_at,capture_before,captured_at,status}',
+   'v0-76-0-manual-capture',
+   'Authorize-then-capture payments with capture, void and expiry',
+   'accepted',
+   'Reservation deposits should only be charged if the resident does not show up. Charging up front and refunding most deposits costs non-refundable processing fees and ties up residents'' money; the Stripe integration hard-coded automatic capture.',
+   'payments.transactions.capture_method selects automatic or manual capture per transaction (manual: Stripe cards only). Manual payments are created with capture_method=manual; the amount_capturable_updated webhook moves them to a new requires_capture status and records authorized_at and capture_before. capture_payment() and void_payment() enqueue capture_payment and cancel_payment_intent jobs for the payment worker. An hourly scheduled job voids authorizations that reach capture_before.',
+   'A distinct status keeps held-but-uncharged payments out of both the paid and retryable states. Capturing and voiding through River jobs matches refunds: the RPC validates and locks the row, and provider calls happen outside the database transaction with retries.',
+   'requires_capture payments are not succeeded: payment-succeeded notifications fire when the payment is captured. check_existing_payment returns duplicate for authorized payments. Capture is all-or-nothing; partial captures are not supported. Card holds are assumed to last 7 days.');
+
+COMMIT;
@@ -0,0 +1,247 @@
+-- Deploy civic_os:v0-77-0-maintenance-tasks to pg
+-- requires: v0-76-0-manual-capture
+--
+-- v0.77.0 — Declarative schedule for built-in maintenance tasks:
+--   1. metadata.maintenance_tasks: one row per worker-internal task with
+--      enabled flag, interval, jitter, next run and last-run outcome
+--   2. public.get_maintenance_tasks() admin RPC
+--   3. public.update_maintenance_task() admin RPC (enable, interval, jitter)
+--   4. public.run_maintenance_task_now() admin RPC
+--   5. Record schema decision
+--
+-- Maintenance tasks (draft gallery cleanup, validation result purge,
+-- signature polling, ...) are declared in the consolidated worker. On startup
+-- the worker inserts a row for each declared task with its default schedule;
+-- after that the row is authoritative, so admins can retune or disable a task
+-- without a redeploy. Unlike metadata.scheduled_jobs (cron expressions for
+-- integrator SQL functions), these are fixed intervals for code that lives in
+-- the worker.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. MAINTENANCE TASKS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.maintenance_tasks (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT,
+
+    -- Schedule (defaults come from the worker on first registration)
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    interval_seconds INT NOT NULL CHECK (interval_seconds > 0),
+    jitter_seconds INT NOT NULL DEFAULT 0 CHECK (jitter_seconds >= 0),
+    next_run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- Last run
+    last_started_at TIMESTAMPTZ,
+    last_finished_at TIMESTAMPTZ,
+    last_duration_ms INT,
+    last_success BOOLEAN,
+    last_message TEXT,
+    run_count INT NOT NULL DEFAULT 0,
+    failure_count INT NOT NULL DEFAULT 0,
+
+    -- Last time a running worker declared this task
+    registered_at TIMESTAMPTZ,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_maintenance_tasks_due ON metadata.maintenance_tasks(next_run_at)
+    WHERE enabled;
+
+CREATE TRIGGER set_updated_at_trigger
+    BEFORE UPDATE ON metadata.maintenance_tasks
+    FOR EACH ROW
+    EXECUTE FUNCTION public.set_updated_at();
+
+COMMENT ON TABLE metadata.maintenance_tasks IS
+    'Schedule and last-run status of built-in maintenance tasks run by the consolidated worker. Rows are created by the worker with default schedules; admins tune them with update_maintenance_task(). Added in v0.77.0.';
+COMMENT ON COLUMN metadata.maintenance_tasks.jitter_seconds IS
+    'Up to this many random seconds are added to each interval so tasks on many instances do not fire together.';
+COMMENT ON COLUMN metadata.maintenance_tasks.registered_at IS
+    'Last worker startup that declared this task. Tasks not declared by the running worker (e.g., signature polling without SIGNATURE_PROVIDER) keep their row but are not run.';
+
+
+-- ============================================================================
+-- 2. LIST RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_maintenance_tasks()
+RETURNS TABLE (
+    name VARCHAR(100),
+    description TEXT,
+    enabled BOOLEAN,
+    interval_seconds INT,
+    jitter_seconds INT,
+    next_run_at TIMESTAMPTZ,
+    last_started_at TIMESTAMPTZ,
+    last_finished_at TIMESTAMPTZ,
+    last_duration_ms INT,
+    last_success BOOLEAN,
+    last_message TEXT,
+    run_count INT,
+    failure_count INT,
+    registered_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can view maintenance tasks';
+    END IF;
+
+    RETURN QUERY
+    SELECT t.name, t.description, t.enabled, t.interval_seconds, t.jitter_seconds,
+           t.next_run_at, t.last_started_at, t.last_finished_at, t.last_duration_ms,
+           t.last_success, t.last_message, t.run_count, t.failure_count, t.registered_at
+    FROM metadata.maintenance_tasks t
+    ORDER BY t.name;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_maintenance_tasks() IS
+    'Admin-only. Lists built-in maintenance tasks with their schedule and last run. Added in v0.77.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_maintenance_tasks() FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_maintenance_tasks() TO authenticated;
+
+
+-- ============================================================================
+-- 3. UPDATE RPC
+-- ============================================================================
+-- NULL arguments leave the current value. Changing the interval reschedules
+-- the next run from the last start so a shorter interval takes effect now.
+
+CREATE OR REPLACE FUNCTION public.update_maintenance_task(
+    p_name VARCHAR(100),
+    p_enabled BOOLEAN DEFAULT NULL,
+    p_interval_seconds INT DEFAULT NULL,
+    p_jitter_seconds INT DEFAULT NULL
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_task metadata.maintenance_tasks%ROWTYPE;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can change maintenance tasks';
+    END IF;
+
+    IF p_interval_seconds IS NOT NULL AND p_interval_seconds <= 0 THEN
+        RAISE EXCEPTION 'Interval must be positive';
+    END IF;
+    IF p_jitter_seconds IS NOT NULL AND p_jitter_seconds < 0 THEN
+        RAISE EXCEPTION 'Jitter cannot be negative';
+    END IF;
+
+    UPDATE metadata.maintenance_tasks t
+    SET
+        enabled = COALESCE(p_enabled, t.enabled),
+        interval_seconds = COALESCE(p_interval_seconds, t.interval_seconds),
+        jitter_seconds = COALESCE(p_jitter_seconds, t.jitter_seconds),
+        next_run_at = CASE
+            WHEN p_interval_seconds IS NOT NULL AND p_interval_seconds <> t.interval_seconds
+                THEN LEAST(t.next_run_at, COALESCE(t.last_started_at, NOW()) + make_interval(secs => p_interval_seconds))
+            ELSE t.next_run_at
+        END
+    WHERE t.name = p_name
+    RETURNING * INTO v_task;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Maintenance task not found: %', p_name;
+    END IF;
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'name', v_task.name,
+        'enabled', v_task.enabled,
+        'interval_seconds', v_task.interval_seconds,
+        'jitter_seconds', v_task.jitter_seconds,
+        'next_run_at', v_task.next_run_at
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.update_maintenance_task IS
+    'Admin-only. Enables/disables a maintenance task or changes its interval and jitter; NULL arguments keep the current value. Added in v0.77.0.';
+
+REVOKE EXECUTE ON FUNCTION public.update_maintenance_task FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.update_maintenance_task TO authenticated;
+
+
+-- ============================================================================
+-- 4. RUN-NOW RPC
+-- ============================================================================
+-- The task runs in the worker, so this only makes it due; the worker picks it
+-- up on its next check (within 15 seconds). Disabled tasks stay disabled.
+
+CREATE OR REPLACE FUNCTION public.run_maintenance_task_now(p_name VARCHAR(100))
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_enabled BOOLEAN;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can run maintenance tasks';
+    END IF;
+
+    UPDATE metadata.maintenance_tasks
+    SET next_run_at = NOW()
+    WHERE name = p_name
+    RETURNING enabled INTO v_enabled;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Maintenance task not found: %', p_name;
+    END IF;
+
+    IF NOT v_enabled THEN
+        RETURN jsonb_build_object(
+            'success', false,
+            'message', 'Task is disabled; enable it to run'
+        );
+    END IF;
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'message', 'Task queued; it runs within 15 seconds'
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.run_maintenance_task_now(VARCHAR) IS
+    'Admin-only. Makes a maintenance task due immediately. Added in v0.77.0.';
+
+REVOKE EXECUTE ON FUNCTION public.run_maintenance_task_now(VARCHAR) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.run_maintenance_task_now(VARCHAR) TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{maintenance_tasks}',
+   '{}',
+   'v0-77-0-maintenance-tasks',
+   'Declarative schedule for built-in maintenance tasks',
+   'accepted',
+   'Each internal maintenance job (draft gallery cleanup, validation result purge, signature polling) had its own Go ticker with a hard-coded or env-configured period. More are coming (retention sweeps, reconciliation, matview refresh), and admins had no way to see whether they ran or to pause one.',
+   'The consolidated worker declares its maintenance tasks in one list with a default interval and jitter. A single MaintenanceScheduler registers them in metadata.maintenance_tasks on startup (insert-if-missing), then every 15 seconds claims due, enabled tasks with an UPDATE ... RETURNING that also sets the next run (interval plus random jitter) and records each outcome. Admin RPCs list tasks, change enabled/interval/jitter, and make a task due now.',
+   'Keeping the schedule in a table rather than River periodic jobs keeps these tasks in consolidated-worker only (as with ScheduledJobScheduler), survives restarts, and lets the atomic claim stop two worker replicas from running the same task. Fixed intervals fit these tasks better than cron expressions; integrator SQL functions keep using metadata.scheduled_jobs.',
+   'Worker defaults apply only when a row is first created; changing a default in code does not change existing installs. Draft gallery cleanup now runs every 24 hours from first registration instead of at 3 AM. SIGNATURE_POLL_INTERVAL_MINUTES only seeds the signature poll interval.');
+
+COMMIT;
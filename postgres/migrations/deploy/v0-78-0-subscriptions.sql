@@ -0,0 +1,439 @@
+-- Deploy civic_os:v0-78-0-subscriptions to pg
+-- requires: v0-77-0-maintenance-tasks
+--
+-- v0.78.0 — Recurring payments (subscriptions):
+--   1. payments.subscriptions table with RLS and a create_subscription job trigger
+--   2. payments.transactions.subscription_id and provider_invoice_id link each
+--      invoice payment to its subscription
+--   3. create_payment_intent trigger skips subscription invoice payments (the
+--      provider creates their intents)
+--   4. payments.create_and_link_subscription() helper for domain RPCs
+--   5. public.cancel_subscription() RPC
+--   6. public.payment_subscriptions view; payment_transactions exposes
+--      subscription_id
+--   7. Record schema decision
+--
+-- Stripe Billing owns the schedule: the payment worker creates a Stripe
+-- Subscription whose first invoice is paid through the normal checkout (the
+-- first invoice payment is a regular transaction linked to the entity), and
+-- invoice webhooks record every renewal as a new succeeded or failed
+-- transaction. Subscription status: pending_setup → incomplete → active ⇄
+-- past_due → canceled (or failed / incomplete_expired / unpaid).
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SUBSCRIPTIONS TABLE
+-- ============================================================================
+
+CREATE TABLE payments.subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES metadata.civic_os_users(id) ON DELETE RESTRICT,
+
+    -- Price per billing period
+    amount NUMERIC(10, 2) NOT NULL CHECK (amount > 0),
+    currency TEXT NOT NULL DEFAULT 'USD',
+    billing_interval TEXT NOT NULL DEFAULT 'month',
+    interval_count INT NOT NULL DEFAULT 1 CHECK (interval_count > 0),
+    description TEXT,
+
+    -- Lifecycle
+    status TEXT NOT NULL DEFAULT 'pending_setup',
+    error_message TEXT,
+    current_period_end TIMESTAMPTZ,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    canceled_at TIMESTAMPTZ,
+    last_payment_at TIMESTAMPTZ,
+
+    -- Provider
+    provider TEXT NOT NULL DEFAULT 'stripe',
+    provider_subscription_id TEXT,
+    provider_customer_id TEXT,
+
+    -- Entity reference (e.g., a facility membership row)
+    entity_type TEXT,
+    entity_id TEXT,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_subscription_status CHECK (status IN (
+        'pending_setup',       -- Waiting for the worker to create the provider subscription
+        'incomplete',          -- Created; first invoice awaiting payment
+        'incomplete_expired',  -- First invoice was never paid (provider gave up after 23 hours)
+        'active',              -- Paid through current_period_end
+        'past_due',            -- A renewal failed; the provider is retrying
+        'unpaid',              -- Retries exhausted; subscription kept but not billed
+        'canceled',            -- Ended
+        'failed'               -- The worker could not create the provider subscription
+    )),
+    CONSTRAINT valid_billing_interval CHECK (billing_interval IN ('day', 'week', 'month', 'year')),
+    CONSTRAINT valid_subscription_currency CHECK (currency = 'USD'),
+    CONSTRAINT valid_subscription_provider CHECK (provider = 'stripe')  -- Stripe Billing only
+);
+
+CREATE INDEX idx_payments_subscriptions_user_id ON payments.subscriptions(user_id);
+CREATE INDEX idx_payments_subscriptions_status ON payments.subscriptions(status);
+CREATE INDEX idx_payments_subscriptions_entity ON payments.subscriptions(entity_type, entity_id);
+CREATE UNIQUE INDEX idx_payments_subscriptions_provider_id ON payments.subscriptions(provider, provider_subscription_id)
+    WHERE provider_subscription_id IS NOT NULL;
+
+CREATE TRIGGER set_updated_at_trigger
+    BEFORE UPDATE ON payments.subscriptions
+    FOR EACH ROW
+    EXECUTE FUNCTION public.set_updated_at();
+
+COMMENT ON TABLE payments.subscriptions IS
+    'Recurring payments billed by the provider (Stripe Billing). Each invoice payment is a payments.transactions row with subscription_id set. Added in v0.78.0.';
+COMMENT ON COLUMN payments.subscriptions.status IS
+    'Lifecycle: pending_setup → incomplete → active ⇄ past_due → canceled. Provider-driven states follow customer.subscription.* webhooks.';
+COMMENT ON COLUMN payments.subscriptions.cancel_at_period_end IS
+    'TRUE when cancel_subscription() asked the provider to stop renewing; the subscription stays active until current_period_end.';
+
+ALTER TABLE payments.subscriptions ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Users see own subscriptions"
+    ON payments.subscriptions
+    FOR SELECT
+    TO authenticated
+    USING (user_id = current_user_id());
+
+CREATE POLICY "Payment managers see all subscriptions"
+    ON payments.subscriptions
+    FOR SELECT
+    TO authenticated
+    USING (public.has_permission('payment_transactions', 'read'));
+
+-- Enqueue the worker job that creates the provider subscription
+CREATE OR REPLACE FUNCTION payments.enqueue_create_subscription_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+    VALUES (
+        'available',
+        'default',
+        'create_subscription',
+        jsonb_build_object('subscription_id', NEW.id),
+        1,
+        5,
+        NOW()
+    );
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER enqueue_create_subscription_job_trigger
+    AFTER INSERT ON payments.subscriptions
+    FOR EACH ROW
+    WHEN (NEW.status = 'pending_setup')
+    EXECUTE FUNCTION payments.enqueue_create_subscription_job();
+
+
+-- ============================================================================
+-- 2. LINK INVOICE PAYMENTS TO SUBSCRIPTIONS
+-- ============================================================================
+
+ALTER TABLE payments.transactions
+    ADD COLUMN subscription_id UUID REFERENCES payments.subscriptions(id) ON DELETE RESTRICT,
+    ADD COLUMN provider_invoice_id TEXT;
+
+CREATE INDEX idx_payments_transactions_subscription_id ON payments.transactions(subscription_id)
+    WHERE subscription_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_payments_transactions_provider_invoice_id ON payments.transactions(provider, provider_invoice_id)
+    WHERE provider_invoice_id IS NOT NULL;
+
+COMMENT ON COLUMN payments.transactions.subscription_id IS
+    'Subscription this payment bills. The first invoice payment is created with the subscription; renewals are inserted by the payment worker from invoice webhooks. Added in v0.78.0.';
+COMMENT ON COLUMN payments.transactions.provider_invoice_id IS
+    'Provider invoice (Stripe in_...) this payment settles. One transaction per invoice.';
+
+
+-- ============================================================================
+-- 3. SUBSCRIPTION PAYMENTS DON'T GET THEIR OWN PAYMENT INTENT
+-- ============================================================================
+-- The first invoice payment is inserted as pending_intent so checkout waits
+-- for it like any payment, but create_subscription fills in the invoice's
+-- PaymentIntent instead of create_payment_intent making a separate one.
+
+DROP TRIGGER enqueue_create_intent_job_trigger ON payments.transactions;
+
+CREATE TRIGGER enqueue_create_intent_job_trigger
+    AFTER INSERT ON payments.transactions
+    FOR EACH ROW
+    WHEN (NEW.status = 'pending_intent' AND NEW.subscription_id IS NULL)
+    EXECUTE FUNCTION payments.enqueue_create_intent_job();
+
+
+-- ============================================================================
+-- 4. create_and_link_subscription HELPER
+-- ============================================================================
+-- Mirrors create_and_link_payment: call it from a domain RPC (e.g.,
+-- start_membership) after checking permissions. Links both the subscription
+-- and its first invoice payment to the entity so the existing payment column
+-- drives checkout.
+
+CREATE OR REPLACE FUNCTION payments.create_and_link_subscription(
+    p_entity_table_name NAME,
+    p_entity_id_column_name NAME,
+    p_entity_id_value ANYELEMENT,
+    p_subscription_column_name NAME,
+    p_payment_column_name NAME,
+    p_amount NUMERIC(10,2),
+    p_description TEXT,
+    p_billing_interval TEXT DEFAULT 'month',
+    p_interval_count INT DEFAULT 1,
+    p_user_id UUID DEFAULT current_user_id(),
+    p_currency TEXT DEFAULT 'USD'
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_subscription_id UUID;
+    v_payment_id UUID;
+    v_sql TEXT;
+BEGIN
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid subscription amount: %. Amount must be greater than zero.', p_amount;
+    END IF;
+
+    IF p_user_id IS NULL THEN
+        RAISE EXCEPTION 'User ID required for subscription creation';
+    END IF;
+
+    IF p_currency != 'USD' THEN
+        RAISE EXCEPTION 'Only USD currency supported (got: %)', p_currency;
+    END IF;
+
+    IF p_billing_interval NOT IN ('day', 'week', 'month', 'year') THEN
+        RAISE EXCEPTION 'Invalid billing interval: % (expected day, week, month or year)', p_billing_interval;
+    END IF;
+
+    -- Trigger enqueues create_subscription
+    INSERT INTO payments.subscriptions (
+        user_id, amount, currency, billing_interval, interval_count, description,
+        entity_type, entity_id
+    ) VALUES (
+        p_user_id, p_amount, p_currency, p_billing_interval, p_interval_count, p_description,
+        p_entity_table_name::TEXT, p_entity_id_value::TEXT
+    ) RETURNING id INTO v_subscription_id;
+
+    -- First invoice payment; the worker fills in the provider intent
+    INSERT INTO payments.transactions (
+        user_id, amount, currency, status, description, provider,
+        entity_type, entity_id, subscription_id
+    ) VALUES (
+        p_user_id, p_amount, p_currency, 'pending_intent', p_description, 'stripe',
+        p_entity_table_name::TEXT, p_entity_id_value::TEXT, v_subscription_id
+    ) RETURNING id INTO v_payment_id;
+
+    v_sql := format(
+        'UPDATE %I SET %I = $1, %I = $2 WHERE %I = $3',
+        p_entity_table_name,
+        p_subscription_column_name,
+        p_payment_column_name,
+        p_entity_id_column_name
+    );
+
+    EXECUTE v_sql USING v_subscription_id, v_payment_id, p_entity_id_value;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Entity not found: %.% = %', p_entity_table_name, p_entity_id_column_name, p_entity_id_value;
+    END IF;
+
+    RETURN v_subscription_id;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.create_and_link_subscription IS
+    'Create a recurring subscription (Stripe only) and link it and its first invoice payment to an entity. The payment column drives checkout for the first invoice like any payment; renewals are charged to the saved card automatically. Added in v0.78.0.';
+
+GRANT EXECUTE ON FUNCTION payments.create_and_link_subscription TO authenticated;
+
+
+-- ============================================================================
+-- 5. CANCEL RPC
+-- ============================================================================
+-- The subscriber or a payment manager (payment_transactions:update) may
+-- cancel. By default the subscription runs to the end of the paid period.
+
+CREATE OR REPLACE FUNCTION public.cancel_subscription(
+    p_subscription_id UUID,
+    p_at_period_end BOOLEAN DEFAULT TRUE
+)
+RETURNS VOID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_subscription RECORD;
+BEGIN
+    IF current_user_id() IS NULL THEN
+        RAISE EXCEPTION 'Authentication required';
+    END IF;
+
+    SELECT * INTO v_subscription
+    FROM payments.subscriptions
+    WHERE id = p_subscription_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Subscription not found: %', p_subscription_id;
+    END IF;
+
+    IF v_subscription.user_id != current_user_id()
+       AND NOT public.has_permission('payment_transactions', 'update') THEN
+        RAISE EXCEPTION 'Permission denied: not your subscription'
+            USING HINT = 'Payment managers need payment_transactions:update to cancel other users'' subscriptions';
+    END IF;
+
+    IF v_subscription.status IN ('canceled', 'incomplete_expired', 'failed') THEN
+        RAISE EXCEPTION 'Subscription already ended (status: %)', v_subscription.status;
+    END IF;
+
+    -- Nothing to cancel at the provider yet; the create job skips canceled rows
+    IF v_subscription.provider_subscription_id IS NULL THEN
+        UPDATE payments.subscriptions
+        SET status = 'canceled', canceled_at = NOW()
+        WHERE id = p_subscription_id;
+        RETURN;
+    END IF;
+
+    INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+    VALUES (
+        'available',
+        'default',
+        'cancel_subscription',
+        jsonb_build_object('subscription_id', p_subscription_id, 'at_period_end', p_at_period_end),
+        1,
+        5,
+        NOW()
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.cancel_subscription IS
+    'Cancel a subscription, by default at the end of the paid period (p_at_period_end := false ends it now without a refund). Allowed for the subscriber or users with payment_transactions:update. Enqueues a cancel_subscription job. Added in v0.78.0.';
+
+REVOKE EXECUTE ON FUNCTION public.cancel_subscription FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.cancel_subscription TO authenticated;
+
+
+-- ============================================================================
+-- 6. PUBLIC VIEWS
+-- ============================================================================
+
+CREATE OR REPLACE VIEW public.payment_subscriptions AS
+SELECT
+    s.id,
+    s.user_id,
+    u.display_name AS user_display_name,
+    s.amount,
+    s.currency,
+    s.billing_interval,
+    s.interval_count,
+    s.description,
+    s.status,
+    s.error_message,
+    s.current_period_end,
+    s.cancel_at_period_end,
+    s.canceled_at,
+    s.last_payment_at,
+    s.provider,
+    s.provider_subscription_id,
+    s.entity_type,
+    s.entity_id,
+    COALESCE(e.display_name, s.entity_type) AS entity_display_name,
+    s.created_at,
+    s.updated_at
+FROM payments.subscriptions s
+LEFT JOIN public.civic_os_users u ON s.user_id = u.id
+LEFT JOIN metadata.entities e ON s.entity_type = e.table_name;
+
+COMMENT ON VIEW public.payment_subscriptions IS
+    'Public API view for recurring subscriptions. Row visibility follows payments.subscriptions RLS. Added in v0.78.0.';
+
+GRANT SELECT ON public.payment_subscriptions TO authenticated;
+
+-- Same definition as v0-76-0-manual-capture.sql with subscription_id appended
+CREATE OR REPLACE VIEW public.payment_transactions AS
+SELECT
+    t.id,
+    t.user_id,
+    u.display_name AS user_display_name,
+    u.full_name AS user_full_name,
+    u.email AS user_email,
+    t.amount,
+    t.processing_fee,
+    t.total_amount,
+    t.max_refundable,
+    t.fee_percent,
+    t.fee_flat_cents,
+    t.fee_refundable,
+    t.currency,
+    t.status,
+    t.provider_payment_id,
+    COALESCE(r_agg.total_refunded, 0) AS total_refunded,
+    COALESCE(r_agg.refund_count, 0) AS refund_count,
+    COALESCE(r_agg.pending_count, 0) AS pending_refund_count,
+    CASE
+        WHEN r_agg.total_refunded >= t.max_refundable THEN 'refunded'
+        WHEN r_agg.total_refunded > 0 THEN 'partially_refunded'
+        WHEN r_agg.pending_count > 0 THEN 'refund_pending'
+        ELSE COALESCE(t.status, 'unpaid')
+    END AS effective_status,
+    t.error_message,
+    t.provider,
+    t.provider_client_secret,
+    t.description,
+    t.display_name,
+    t.created_at,
+    t.updated_at,
+    t.entity_type,
+    t.entity_id,
+    COALESCE(e.display_name, t.entity_type) AS entity_display_name,
+    t.capture_method,
+    t.authorized_at,
+    t.capture_before,
+    t.captured_at,
+    t.subscription_id
+FROM payments.transactions t
+LEFT JOIN public.civic_os_users u ON t.user_id = u.id
+LEFT JOIN metadata.entities e ON t.entity_type = e.table_name
+LEFT JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(amount) FILTER (WHERE status = 'succeeded'), 0) AS total_refunded,
+        COUNT(*) FILTER (WHERE status = 'succeeded') AS refund_count,
+        COUNT(*) FILTER (WHERE status = 'pending') AS pending_count
+    FROM payments.refunds
+    WHERE transaction_id = t.id
+) r_agg ON true;
+
+GRANT SELECT ON public.payment_transactions TO authenticated, web_anon;
+
+
+-- ============================================================================
+-- 7. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{subscriptions,transactions}',
+   '{subscription_id,provider_invoice_id}',
+   'v0-78-0-subscriptions',
+   'Recurring payments through Stripe Subscriptions',
+   'accepted',
+   'Monthly facility memberships had to be re-billed by hand: staff created a new payment every period and residents had to check out again.',
+   'payments.subscriptions records a recurring price per user and entity. create_and_link_subscription() inserts the subscription and its first invoice payment; the payment worker creates a Stripe Customer, Product and Subscription (payment_behavior=default_incomplete) and stores the first invoice''s PaymentIntent on that payment so the normal checkout confirms it and saves the card. invoice.paid and invoice.payment_failed webhooks record each renewal as a transaction with subscription_id; customer.subscription.updated/deleted sync status and the current period. cancel_subscription() enqueues a cancel_subscription job.',
+   'Letting Stripe Billing run the schedule gives card retries (Smart Retries), proration and card-expiry handling for free, where internally scheduled PaymentIntents would need off-session charging, retry policy and dunning of our own. Recording renewals as ordinary transactions keeps refunds, the admin payments page and reporting working unchanged.',
+   'Stripe only; Square and PayPal subscriptions are not supported. Processing fees are not added to subscription charges. Changing the price of an existing subscription is not supported: cancel and create a new one.');
+
+COMMIT;
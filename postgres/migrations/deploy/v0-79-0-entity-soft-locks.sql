@@ -0,0 +1,599 @@
+-- Deploy civic_os:v0-79-0-entity-soft-locks to pg
+-- requires: v0-78-0-subscriptions
+--
+-- v0.79.0 — Entity soft locks for batch operations:
+--   1. metadata.entity_soft_locks: short-lived "user is editing this row"
+--      leases held by the Edit page
+--   2. metadata.entity_lock_conflicts: rows a batch operation skipped (or
+--      gave up waiting on) because someone held them
+--   3. Lock helpers for batch code: entity_lock_key(), entity_lock_holder(),
+--      try_lock_entity() (wait or skip), record_entity_lock_conflict()
+--   4. public.acquire_entity_lock() / release_entity_lock() RPCs
+--   5. public.get_entity_lock_conflicts() RPC
+--   6. update_series_template(): skip rows being edited, report them
+--   7. update_series_schedule(): serialize with series expansion, keep rows
+--      being edited as exceptions
+--   8. Record schema decision
+--
+-- A batch operation locks a row with a transaction-scoped advisory lock
+-- keyed on (entity_type, entity_id), so two batch operations never touch the
+-- same row at once, and treats a live user lease as held. Leases are "soft":
+-- they don't stop a user's own save, only batch code that checks them.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SOFT LOCK LEASES
+-- ============================================================================
+
+CREATE TABLE metadata.entity_soft_locks (
+    entity_type NAME NOT NULL,
+    entity_id TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES metadata.civic_os_users(id) ON DELETE CASCADE,
+    acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (entity_type, entity_id)
+);
+
+CREATE INDEX idx_entity_soft_locks_expires_at ON metadata.entity_soft_locks(expires_at);
+
+COMMENT ON TABLE metadata.entity_soft_locks IS
+    'Leases taken while a user has a record open for editing. Renewed by the Edit page; a lease past expires_at is free. Batch operations skip or wait on leased rows. Added in v0.79.0.';
+
+
+-- ============================================================================
+-- 2. CONFLICT LOG
+-- ============================================================================
+
+CREATE TABLE metadata.entity_lock_conflicts (
+    id BIGSERIAL PRIMARY KEY,
+    entity_type NAME NOT NULL,
+    entity_id TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    policy TEXT NOT NULL CHECK (policy IN ('wait', 'skip')),
+    held_by UUID REFERENCES metadata.civic_os_users(id) ON DELETE SET NULL,
+    job_id BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_entity_lock_conflicts_entity ON metadata.entity_lock_conflicts(entity_type, entity_id);
+CREATE INDEX idx_entity_lock_conflicts_created_at ON metadata.entity_lock_conflicts(created_at);
+
+COMMENT ON TABLE metadata.entity_lock_conflicts IS
+    'Rows a batch operation did not process because they were locked. held_by is the user whose lease blocked it; NULL means another batch operation held the row. Purged after 30 days by the entity_lock_cleanup maintenance task. Added in v0.79.0.';
+COMMENT ON COLUMN metadata.entity_lock_conflicts.operation IS
+    'The batch operation that was blocked, e.g. update_series_template or expand_recurring_series';
+COMMENT ON COLUMN metadata.entity_lock_conflicts.job_id IS
+    'metadata.river_job id when the operation ran in a worker';
+
+
+-- ============================================================================
+-- 3. LOCK HELPERS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.entity_lock_key(p_entity_type NAME, p_entity_id TEXT)
+RETURNS BIGINT
+LANGUAGE sql
+IMMUTABLE
+AS $$
+    SELECT hashtextextended(p_entity_type || ':' || p_entity_id, 0);
+$$;
+
+COMMENT ON FUNCTION metadata.entity_lock_key(NAME, TEXT) IS
+    'Advisory lock key for one entity row. Added in v0.79.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.entity_lock_holder(
+    p_entity_type NAME,
+    p_entity_id TEXT,
+    p_ignore_user UUID DEFAULT NULL
+)
+RETURNS UUID
+LANGUAGE sql
+STABLE
+AS $$
+    SELECT user_id
+    FROM metadata.entity_soft_locks
+    WHERE entity_type = p_entity_type
+      AND entity_id = p_entity_id
+      AND expires_at > NOW()
+      AND user_id IS DISTINCT FROM p_ignore_user;
+$$;
+
+COMMENT ON FUNCTION metadata.entity_lock_holder(NAME, TEXT, UUID) IS
+    'User holding a live lease on the row, other than p_ignore_user; NULL if none. Added in v0.79.0.';
+
+
+-- Locks one row for the rest of the current transaction. Returns FALSE when
+-- the row is still leased by a user or locked by another batch operation
+-- after p_wait. p_wait = 0 is the skip policy; a positive p_wait polls every
+-- 100 ms (wait policy). p_ignore_user lets the user running a batch operation
+-- through an RPC pass over their own lease.
+CREATE OR REPLACE FUNCTION metadata.try_lock_entity(
+    p_entity_type NAME,
+    p_entity_id TEXT,
+    p_wait INTERVAL DEFAULT INTERVAL '0',
+    p_ignore_user UUID DEFAULT NULL
+)
+RETURNS BOOLEAN
+LANGUAGE plpgsql
+VOLATILE
+AS $$
+DECLARE
+    v_deadline TIMESTAMPTZ := clock_timestamp() + p_wait;
+BEGIN
+    LOOP
+        IF metadata.entity_lock_holder(p_entity_type, p_entity_id, p_ignore_user) IS NULL
+           AND pg_try_advisory_xact_lock(metadata.entity_lock_key(p_entity_type, p_entity_id)) THEN
+            RETURN TRUE;
+        END IF;
+
+        IF clock_timestamp() >= v_deadline THEN
+            RETURN FALSE;
+        END IF;
+
+        PERFORM pg_sleep(0.1);
+    END LOOP;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.try_lock_entity(NAME, TEXT, INTERVAL, UUID) IS
+    'Takes a transaction-scoped advisory lock on one entity row unless a user lease or another batch operation holds it. Waits up to p_wait (0 = skip immediately). Added in v0.79.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.record_entity_lock_conflict(
+    p_entity_type NAME,
+    p_entity_id TEXT,
+    p_operation TEXT,
+    p_policy TEXT,
+    p_job_id BIGINT DEFAULT NULL,
+    p_ignore_user UUID DEFAULT NULL
+)
+RETURNS UUID
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    v_held_by UUID := metadata.entity_lock_holder(p_entity_type, p_entity_id, p_ignore_user);
+BEGIN
+    INSERT INTO metadata.entity_lock_conflicts (entity_type, entity_id, operation, policy, held_by, job_id)
+    VALUES (p_entity_type, p_entity_id, p_operation, p_policy, v_held_by, p_job_id);
+
+    RETURN v_held_by;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.record_entity_lock_conflict(NAME, TEXT, TEXT, TEXT, BIGINT, UUID) IS
+    'Logs a row a batch operation could not lock and returns the user holding it (NULL = another batch operation). Added in v0.79.0.';
+
+
+-- ============================================================================
+-- 4. LEASE RPCS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.acquire_entity_lock(
+    p_entity_type NAME,
+    p_entity_id TEXT,
+    p_ttl_seconds INT DEFAULT 120
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_user_id UUID := public.current_user_id();
+    v_lock metadata.entity_soft_locks%ROWTYPE;
+BEGIN
+    IF v_user_id IS NULL THEN
+        RAISE EXCEPTION 'Authentication required';
+    END IF;
+
+    IF NOT (public.has_permission(p_entity_type, 'update') OR public.is_admin()) THEN
+        RAISE EXCEPTION 'Permission denied: cannot edit %', p_entity_type;
+    END IF;
+
+    IF p_ttl_seconds NOT BETWEEN 10 AND 900 THEN
+        RAISE EXCEPTION 'Lease must be between 10 and 900 seconds';
+    END IF;
+
+    -- Take or renew the lease unless another user's lease is live
+    INSERT INTO metadata.entity_soft_locks (entity_type, entity_id, user_id, expires_at)
+    VALUES (p_entity_type, p_entity_id, v_user_id, NOW() + make_interval(secs => p_ttl_seconds))
+    ON CONFLICT (entity_type, entity_id) DO UPDATE
+    SET
+        user_id = EXCLUDED.user_id,
+        acquired_at = CASE WHEN entity_soft_locks.user_id = EXCLUDED.user_id
+                           THEN entity_soft_locks.acquired_at ELSE NOW() END,
+        expires_at = EXCLUDED.expires_at
+    WHERE entity_soft_locks.user_id = EXCLUDED.user_id
+       OR entity_soft_locks.expires_at <= NOW()
+    RETURNING * INTO v_lock;
+
+    IF NOT FOUND THEN
+        SELECT * INTO v_lock
+        FROM metadata.entity_soft_locks
+        WHERE entity_type = p_entity_type AND entity_id = p_entity_id;
+
+        RETURN jsonb_build_object(
+            'success', false,
+            'locked_by', v_lock.user_id,
+            'locked_by_display_name', (SELECT display_name FROM metadata.civic_os_users WHERE id = v_lock.user_id),
+            'expires_at', v_lock.expires_at
+        );
+    END IF;
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'expires_at', v_lock.expires_at,
+        -- A batch operation is working on the row right now
+        'batch_in_progress', NOT pg_try_advisory_xact_lock(metadata.entity_lock_key(p_entity_type, p_entity_id))
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.acquire_entity_lock(NAME, TEXT, INT) IS
+    'Takes or renews the caller''s soft lock on a row for p_ttl_seconds (10-900). Returns success=false with locked_by when another user holds it. Requires update permission on the entity. Added in v0.79.0.';
+
+REVOKE EXECUTE ON FUNCTION public.acquire_entity_lock(NAME, TEXT, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.acquire_entity_lock(NAME, TEXT, INT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.release_entity_lock(
+    p_entity_type NAME,
+    p_entity_id TEXT
+)
+RETURNS VOID
+LANGUAGE sql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+    DELETE FROM metadata.entity_soft_locks
+    WHERE entity_type = p_entity_type
+      AND entity_id = p_entity_id
+      AND user_id = public.current_user_id();
+$$;
+
+COMMENT ON FUNCTION public.release_entity_lock(NAME, TEXT) IS
+    'Releases the caller''s soft lock on a row, if they hold it. Added in v0.79.0.';
+
+REVOKE EXECUTE ON FUNCTION public.release_entity_lock(NAME, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.release_entity_lock(NAME, TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 5. CONFLICT REPORT RPC
+-- ============================================================================
+-- Admins see everything; other users see conflicts on entities they can read.
+
+CREATE OR REPLACE FUNCTION public.get_entity_lock_conflicts(
+    p_entity_type NAME DEFAULT NULL,
+    p_entity_id TEXT DEFAULT NULL,
+    p_limit INT DEFAULT 100
+)
+RETURNS TABLE (
+    id BIGINT,
+    entity_type NAME,
+    entity_id TEXT,
+    operation TEXT,
+    policy TEXT,
+    held_by UUID,
+    held_by_display_name TEXT,
+    job_id BIGINT,
+    created_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        IF p_entity_type IS NULL THEN
+            RAISE EXCEPTION 'Only administrators can list conflicts across all entities';
+        END IF;
+        IF NOT public.has_permission(p_entity_type, 'read') THEN
+            RAISE EXCEPTION 'Permission denied: cannot read %', p_entity_type;
+        END IF;
+    END IF;
+
+    RETURN QUERY
+    SELECT c.id, c.entity_type, c.entity_id, c.operation, c.policy,
+           c.held_by, u.display_name::TEXT, c.job_id, c.created_at
+    FROM metadata.entity_lock_conflicts c
+    LEFT JOIN metadata.civic_os_users u ON u.id = c.held_by
+    WHERE (p_entity_type IS NULL OR c.entity_type = p_entity_type)
+      AND (p_entity_id IS NULL OR c.entity_id = p_entity_id)
+    ORDER BY c.created_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_entity_lock_conflicts(NAME, TEXT, INT) IS
+    'Recent rows skipped by batch operations because they were locked, newest first. Admins may omit p_entity_type; others need read permission on it. Added in v0.79.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_entity_lock_conflicts(NAME, TEXT, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_lock_conflicts(NAME, TEXT, INT) TO authenticated;
+
+
+-- ============================================================================
+-- 6. UPDATE_SERIES_TEMPLATE: SKIP ROWS BEING EDITED
+-- ============================================================================
+-- Same as v0.19.0 except each instance row is locked with the skip policy.
+-- The caller's own lease doesn't count, so "edit all occurrences" from the
+-- Edit page still updates the row being edited.
+
+CREATE OR REPLACE FUNCTION public.update_series_template(
+    p_series_id BIGINT,
+    p_new_template JSONB,
+    p_skip_exceptions BOOLEAN DEFAULT TRUE
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_series RECORD;
+    v_user_id UUID;
+    v_updated_count INT := 0;
+    v_skipped_ids BIGINT[] := '{}';
+    v_instance RECORD;
+    v_set_clause TEXT;
+    v_key TEXT;
+    v_value JSONB;
+BEGIN
+    v_user_id := public.current_user_id();
+
+    -- Get series
+    SELECT * INTO v_series
+    FROM metadata.time_slot_series
+    WHERE id = p_series_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series not found');
+    END IF;
+
+    -- Merge new template with original (preserves required fields like resource_id)
+    -- JSONB || operator: right side takes precedence for duplicate keys
+    p_new_template := v_series.entity_template || p_new_template;
+
+    -- Validate merged template
+    PERFORM metadata.validate_entity_template(v_series.entity_table, p_new_template);
+
+    -- Update series template
+    UPDATE metadata.time_slot_series
+    SET
+        entity_template = p_new_template,
+        template_updated_at = NOW(),
+        template_updated_by = v_user_id
+    WHERE id = p_series_id;
+
+    -- Build dynamic SET clause for entity updates
+    v_set_clause := '';
+    FOR v_key, v_value IN SELECT * FROM jsonb_each(p_new_template)
+    LOOP
+        IF v_key != 'time_slot' THEN
+            IF v_set_clause != '' THEN
+                v_set_clause := v_set_clause || ', ';
+            END IF;
+            v_set_clause := v_set_clause || format('%I = %L', v_key, v_value #>> '{}');
+        END IF;
+    END LOOP;
+
+    -- Update non-exception entity records
+    IF v_set_clause != '' THEN
+        FOR v_instance IN
+            SELECT entity_id
+            FROM metadata.time_slot_instances
+            WHERE series_id = p_series_id
+              AND entity_id IS NOT NULL
+              AND (NOT p_skip_exceptions OR NOT is_exception)
+        LOOP
+            IF NOT metadata.try_lock_entity(v_series.entity_table, v_instance.entity_id::TEXT, INTERVAL '0', v_user_id) THEN
+                PERFORM metadata.record_entity_lock_conflict(
+                    v_series.entity_table, v_instance.entity_id::TEXT,
+                    'update_series_template', 'skip', NULL, v_user_id);
+                v_skipped_ids := v_skipped_ids || v_instance.entity_id;
+                CONTINUE;
+            END IF;
+
+            EXECUTE format(
+                'UPDATE public.%I SET %s WHERE id = $1',
+                v_series.entity_table,
+                v_set_clause
+            ) USING v_instance.entity_id;
+            v_updated_count := v_updated_count + 1;
+        END LOOP;
+    END IF;
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', CASE WHEN cardinality(v_skipped_ids) > 0
+            THEN format('Updated %s instances; skipped %s being edited by someone else', v_updated_count, cardinality(v_skipped_ids))
+            ELSE format('Updated %s instances', v_updated_count)
+        END,
+        'series_id', p_series_id,
+        'instances_updated', v_updated_count,
+        'instances_skipped', cardinality(v_skipped_ids),
+        'skipped_entity_ids', to_jsonb(v_skipped_ids)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.update_series_template(BIGINT, JSONB, BOOLEAN) IS
+    'Updates series template and propagates to non-exception instances.
+     Use for "edit all occurrences" operations.
+     Instances another user is editing are skipped and reported (v0.79.0).
+     Added in v0.19.0.';
+
+
+-- ============================================================================
+-- 7. UPDATE_SERIES_SCHEDULE: SERIALIZE WITH EXPANSION
+-- ============================================================================
+-- Same as v0.38.5 plus:
+--   - Waits for the series lock, which the expand_recurring_series worker
+--     takes per occurrence, so an expansion in flight can't insert
+--     occurrences of the old schedule after this commits.
+--   - Instances another user is editing are kept as 'modified' exceptions
+--     instead of being deleted out from under them, and reported.
+
+CREATE OR REPLACE FUNCTION public.update_series_schedule(
+    p_series_id BIGINT,
+    p_dtstart TIMESTAMP,
+    p_duration INTERVAL,
+    p_rrule TEXT,
+    p_expand_horizon_days INTEGER DEFAULT 90
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_series RECORD;
+    v_user_id UUID;
+    v_entity_ids BIGINT[];
+    v_kept_ids BIGINT[] := '{}';
+    v_entity_id BIGINT;
+    v_deleted_count INT := 0;
+    v_expand_until DATE;
+BEGIN
+    v_user_id := public.current_user_id();
+
+    -- Get series
+    SELECT * INTO v_series
+    FROM metadata.time_slot_series
+    WHERE id = p_series_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series not found');
+    END IF;
+
+    -- Check permissions (creator or has update permission or admin)
+    IF NOT (
+        v_series.created_by = v_user_id
+        OR public.has_permission('time_slot_series', 'update')
+        OR public.is_admin()
+    ) THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Permission denied');
+    END IF;
+
+    -- Validate RRULE (will raise exception if invalid)
+    PERFORM metadata.validate_rrule(p_rrule);
+
+    -- Wait for any expansion transaction on this series to finish
+    IF NOT metadata.try_lock_entity('time_slot_series', p_series_id::TEXT, INTERVAL '30 seconds') THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series is being expanded; try again shortly');
+    END IF;
+
+    -- Step 1: Collect entity IDs from non-exception instances, keeping rows
+    -- someone else is editing
+    FOR v_entity_id IN
+        SELECT entity_id
+        FROM metadata.time_slot_instances
+        WHERE series_id = p_series_id
+          AND entity_id IS NOT NULL
+          AND is_exception = FALSE
+    LOOP
+        IF metadata.try_lock_entity(v_series.entity_table, v_entity_id::TEXT, INTERVAL '0', v_user_id) THEN
+            v_entity_ids := array_append(v_entity_ids, v_entity_id);
+        ELSE
+            PERFORM metadata.record_entity_lock_conflict(
+                v_series.entity_table, v_entity_id::TEXT,
+                'update_series_schedule', 'skip', NULL, v_user_id);
+            v_kept_ids := v_kept_ids || v_entity_id;
+        END IF;
+    END LOOP;
+
+    IF cardinality(v_kept_ids) > 0 THEN
+        UPDATE metadata.time_slot_instances
+        SET
+            is_exception = TRUE,
+            exception_type = 'modified',
+            exception_reason = 'Kept during schedule change: being edited',
+            exception_at = NOW(),
+            exception_by = v_user_id
+        WHERE series_id = p_series_id
+          AND entity_id = ANY(v_kept_ids);
+    END IF;
+
+    -- Step 2: Delete entity records
+    IF v_entity_ids IS NOT NULL AND array_length(v_entity_ids, 1) > 0 THEN
+        EXECUTE format(
+            'DELETE FROM public.%I WHERE id = ANY($1)',
+            v_series.entity_table
+        ) USING v_entity_ids;
+        GET DIAGNOSTICS v_deleted_count = ROW_COUNT;
+    END IF;
+
+    -- Step 3: Delete non-exception instances
+    DELETE FROM metadata.time_slot_instances
+    WHERE series_id = p_series_id AND is_exception = FALSE;
+
+    -- Step 4: Update series schedule and reset expansion tracking
+    UPDATE metadata.time_slot_series
+    SET
+        dtstart = p_dtstart,
+        duration = p_duration,
+        rrule = p_rrule,
+        expanded_until = NULL,  -- Reset to trigger fresh expansion
+        effective_from = p_dtstart::DATE
+    WHERE id = p_series_id;
+
+    -- Step 5: Calculate expansion horizon (p_expand_horizon_days from TODAY)
+    v_expand_until := (NOW() + (p_expand_horizon_days || ' days')::INTERVAL)::DATE;
+
+    -- Step 6: Queue River job for expansion
+    INSERT INTO metadata.river_job (state, queue, kind, args, max_attempts, created_at, scheduled_at)
+    VALUES (
+        'available',
+        'recurring',
+        'expand_recurring_series',
+        jsonb_build_object(
+            'series_id', p_series_id,
+            'expand_until', to_char(v_expand_until::TIMESTAMPTZ, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+        ),
+        3,
+        NOW(),
+        NOW()
+    );
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', CASE WHEN cardinality(v_kept_ids) > 0
+            THEN format('Schedule updated. Deleted %s old records; kept %s being edited by someone else. Expansion queued.', v_deleted_count, cardinality(v_kept_ids))
+            ELSE format('Schedule updated. Deleted %s old records. Expansion queued.', v_deleted_count)
+        END,
+        'series_id', p_series_id,
+        'entities_deleted', v_deleted_count,
+        'entities_kept', cardinality(v_kept_ids),
+        'kept_entity_ids', to_jsonb(v_kept_ids),
+        'expand_until', v_expand_until
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.update_series_schedule(BIGINT, TIMESTAMP, INTERVAL, TEXT, INTEGER) IS
+    'Updates series schedule (dtstart, duration, rrule) and regenerates instances.
+     Deletes existing non-exception instances and entity records, then queues expansion.
+     p_expand_horizon_days controls how far into the future to generate instances (default 90).
+     Instances another user is editing are kept as exceptions and reported (v0.79.0).
+     Requires creator, update permission, or admin.';
+
+
+-- ============================================================================
+-- 8. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{entity_soft_locks,entity_lock_conflicts}',
+   '{}',
+   'v0-79-0-entity-soft-locks',
+   'Soft locks for batch operations on entity rows',
+   'accepted',
+   'Bulk operations (series template propagation, schedule regeneration, series expansion) rewrote rows while users had them open in the Edit page, so the user''s save silently overwrote the batch change or failed on a deleted row. Two batch operations on the same series could also interleave, e.g. an expansion in flight inserting occurrences of a schedule that had just been replaced.',
+   'Batch code locks each row it touches with metadata.try_lock_entity(): a transaction-scoped advisory lock keyed on hash(entity_type:entity_id), refused while another user holds a live lease in metadata.entity_soft_locks. Callers pick a policy per call: skip (wait 0) or wait up to a timeout. Rows not locked are logged to metadata.entity_lock_conflicts and reported back to the caller. The Edit page takes a 2-minute lease through acquire_entity_lock() and renews it every minute. The consolidated worker wraps the same function in lockEntity().',
+   'Advisory locks need no row in the target table, work for any entity type and are released with the transaction, so a crashed worker can''t leave a row locked. Leases are a table, not session advisory locks, because PostgREST requests don''t keep a connection between calls. Keeping leases advisory (users'' saves never check them) avoids blocking people on a stale lease.',
+   'Only batch code that calls try_lock_entity() honors leases; direct UPDATEs from integrator functions do not. Lock keys are 64-bit hashes, so unrelated rows can rarely collide and wait on each other. The lease holder''s own batch RPCs pass over their lease. Expired leases and conflicts older than 30 days are purged by the entity_lock_cleanup maintenance task.');
+
+COMMIT;
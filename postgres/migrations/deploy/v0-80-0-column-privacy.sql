@@ -0,0 +1,240 @@
+-- Deploy civic_os:v0-80-0-column-privacy to pg
+-- requires: v0-79-0-entity-soft-locks
+--
+-- v0.80.0 — Column privacy registry for exports:
+--   1. metadata.column_privacy: columns that must never leave the system in
+--      a bulk export, seeded with the contact columns that
+--      civic_os_users_private already keeps out of the public user view
+--   2. Helpers for server code: metadata.is_column_private(),
+--      metadata.private_columns()
+--   3. public.set_column_privacy() admin RPC
+--   4. public.get_export_redactions() RPC: columns an export must withhold
+--   5. public.log_data_export() RPC: audit row for every export, listing the
+--      withheld columns
+--   6. Record schema decision
+--
+-- Being readable on screen and being exportable are separate questions: a
+-- clerk may need to see a requester's phone number on the Detail page while
+-- a spreadsheet of every requester's phone number must not exist. Privacy
+-- flags only apply to bulk export paths; they don't change RLS or grants.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. COLUMN PRIVACY REGISTRY
+-- ============================================================================
+
+CREATE TABLE metadata.column_privacy (
+    table_name NAME NOT NULL,
+    column_name NAME NOT NULL,
+    reason TEXT,
+    created_by UUID REFERENCES metadata.civic_os_users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (table_name, column_name)
+);
+
+COMMENT ON TABLE metadata.column_privacy IS
+    'Columns withheld from every bulk export (Excel export, import template reference sheets, worker exports). A row means the column is private; delete it to make the column exportable again. Managed through set_column_privacy(). Added in v0.80.0.';
+
+-- Contact details follow the civic_os_users_private convention: visible to
+-- the user and to user managers, never bulk-exported
+INSERT INTO metadata.column_privacy (table_name, column_name, reason) VALUES
+    ('civic_os_users', 'email', 'User contact details (civic_os_users_private)'),
+    ('civic_os_users', 'phone', 'User contact details (civic_os_users_private)'),
+    ('civic_os_users_private', 'email', 'User contact details'),
+    ('civic_os_users_private', 'phone', 'User contact details');
+
+
+-- ============================================================================
+-- 2. HELPERS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.is_column_private(p_table_name NAME, p_column_name NAME)
+RETURNS BOOLEAN
+LANGUAGE sql
+STABLE
+AS $$
+    SELECT EXISTS (
+        SELECT 1 FROM metadata.column_privacy
+        WHERE table_name = p_table_name AND column_name = p_column_name
+    );
+$$;
+
+COMMENT ON FUNCTION metadata.is_column_private(NAME, NAME) IS
+    'TRUE when the column is registered in metadata.column_privacy. Added in v0.80.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.private_columns(p_table_name NAME)
+RETURNS NAME[]
+LANGUAGE sql
+STABLE
+AS $$
+    SELECT COALESCE(array_agg(column_name ORDER BY column_name), '{}')
+    FROM metadata.column_privacy
+    WHERE table_name = p_table_name;
+$$;
+
+COMMENT ON FUNCTION metadata.private_columns(NAME) IS
+    'Private columns of one table, for server-side export code. Added in v0.80.0.';
+
+
+-- ============================================================================
+-- 3. ADMIN RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.set_column_privacy(
+    p_table_name NAME,
+    p_column_name NAME,
+    p_is_private BOOLEAN,
+    p_reason TEXT DEFAULT NULL
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can change column privacy';
+    END IF;
+
+    IF p_is_private THEN
+        INSERT INTO metadata.column_privacy (table_name, column_name, reason, created_by)
+        VALUES (p_table_name, p_column_name, p_reason, public.current_user_id())
+        ON CONFLICT (table_name, column_name)
+        DO UPDATE SET reason = COALESCE(EXCLUDED.reason, column_privacy.reason);
+    ELSE
+        DELETE FROM metadata.column_privacy
+        WHERE table_name = p_table_name AND column_name = p_column_name;
+    END IF;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'column_privacy_change',
+        jsonb_build_object(
+            'table_name', p_table_name,
+            'column_name', p_column_name,
+            'is_private', p_is_private,
+            'reason', p_reason
+        )
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'table_name', p_table_name,
+        'column_name', p_column_name,
+        'is_private', p_is_private
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_column_privacy(NAME, NAME, BOOLEAN, TEXT) IS
+    'Admin-only. Marks a column private (withheld from exports) or exportable again. Audited as column_privacy_change. Added in v0.80.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_column_privacy(NAME, NAME, BOOLEAN, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_column_privacy(NAME, NAME, BOOLEAN, TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 4. EXPORT REDACTIONS RPC
+-- ============================================================================
+-- Takes several tables because one export reads more than one: the entity
+-- itself plus embedded users and foreign key targets. There is deliberately
+-- no admin bypass; an admin's export can end up in a records request too.
+
+CREATE OR REPLACE FUNCTION public.get_export_redactions(p_table_names NAME[])
+RETURNS TABLE (table_name NAME, column_name NAME)
+LANGUAGE sql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+    SELECT cp.table_name, cp.column_name
+    FROM metadata.column_privacy cp
+    WHERE cp.table_name = ANY(p_table_names)
+    ORDER BY cp.table_name, cp.column_name;
+$$;
+
+COMMENT ON FUNCTION public.get_export_redactions(NAME[]) IS
+    'Private columns of the given tables, which exports must withhold. Added in v0.80.0.';
+
+GRANT EXECUTE ON FUNCTION public.get_export_redactions(NAME[]) TO authenticated;
+
+
+-- ============================================================================
+-- 5. EXPORT AUDIT RPC
+-- ============================================================================
+-- Called by the client before it writes the file. The withheld list in the
+-- audit row is the client's report; private_columns_exported is computed
+-- here so a client that skipped redaction still shows up in the log.
+
+CREATE OR REPLACE FUNCTION public.log_data_export(
+    p_table_name NAME,
+    p_row_count INT,
+    p_columns TEXT[],
+    p_withheld_columns TEXT[] DEFAULT '{}',
+    p_export_type TEXT DEFAULT 'excel'
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_user_id UUID := public.current_user_id();
+    v_leaked TEXT[];
+BEGIN
+    IF v_user_id IS NULL THEN
+        RAISE EXCEPTION 'Authentication required';
+    END IF;
+
+    SELECT COALESCE(array_agg(c), '{}') INTO v_leaked
+    FROM unnest(p_columns) AS c
+    WHERE metadata.is_column_private(p_table_name, c);
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        v_user_id,
+        public.current_user_email(),
+        'data_export',
+        jsonb_build_object(
+            'table_name', p_table_name,
+            'export_type', p_export_type,
+            'row_count', p_row_count,
+            'columns', to_jsonb(COALESCE(p_columns, '{}')),
+            'withheld_columns', to_jsonb(COALESCE(p_withheld_columns, '{}')),
+            'private_columns_exported', to_jsonb(v_leaked)
+        )
+    );
+
+    RETURN jsonb_build_object('success', true);
+END;
+$$;
+
+COMMENT ON FUNCTION public.log_data_export(NAME, INT, TEXT[], TEXT[], TEXT) IS
+    'Writes a data_export row to metadata.admin_audit_log with the exported and withheld columns. Added in v0.80.0.';
+
+REVOKE EXECUTE ON FUNCTION public.log_data_export(NAME, INT, TEXT[], TEXT[], TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.log_data_export(NAME, INT, TEXT[], TEXT[], TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{column_privacy}',
+   '{}',
+   'v0-80-0-column-privacy',
+   'Column privacy registry for bulk exports',
+   'accepted',
+   'Excel export writes every column the user can read, including embedded user contact details. Records requests and bulk exports are the main way data leaves the system, and there was no way to say "staff can see this, but it never goes in a spreadsheet", nor a record of who exported what.',
+   'metadata.column_privacy lists private (table, column) pairs, seeded with user email and phone. Export code asks get_export_redactions() for the tables it reads and drops those columns; ImportExportService does this centrally for entity exports and import template reference sheets, and refuses to export when the registry can''t be read. Every export writes a data_export row to metadata.admin_audit_log through log_data_export(), listing exported and withheld columns. Server code uses metadata.private_columns().',
+   'A registry separate from RLS and column grants keeps on-screen access unchanged while closing the bulk path. There is no role bypass, because an admin''s export is as likely to end up in a records request as anyone''s. Recomputing private columns in log_data_export() makes a client that skipped redaction visible in the audit log.',
+   'Redaction happens in the export code path, so direct PostgREST reads are still governed only by RLS and grants. Columns stay private until an admin removes the row. Audit rows grow with export volume.');
+
+COMMIT;
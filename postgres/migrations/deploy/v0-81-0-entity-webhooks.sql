@@ -0,0 +1,322 @@
+-- Deploy civic_os:v0-81-0-entity-webhooks to pg
+-- requires: v0-80-0-column-privacy
+--
+-- v0.81.0 — Outbound entity webhooks with field mapping:
+--   1. metadata.entity_webhook_subscriptions: per-entity outbound endpoints
+--      with templated headers and a payload mapping template
+--   2. metadata.entity_webhook_deliveries: one row per event per
+--      subscription, with delivery status
+--   3. metadata.entity_webhook_attempts: request/response transcript of every
+--      attempt, for support escalations
+--   4. metadata.queue_entity_webhooks() trigger function integrators attach
+--      to entity tables
+--   5. Admin RPCs: get_entity_webhook_deliveries(),
+--      get_entity_webhook_transcript()
+--   6. Record schema decision
+--
+-- Partners (Open311 endpoints, CRMs) expect their own field names and
+-- shapes, so each subscription carries a payload template rendered by the
+-- worker's notification Renderer (.Entity, .Previous, .Event, toJSON, ...).
+-- Delivery runs as entity_webhook_delivery River jobs in the consolidated
+-- worker, which retries 5xx/429/network failures with River's backoff.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SUBSCRIPTIONS
+-- ============================================================================
+-- Like HTTP scheduled jobs, header values and the payload are Go templates
+-- and secrets are referenced as {{secret "NAME"}}, resolved by the worker
+-- from ENTITY_WEBHOOK_SECRET_NAME environment variables.
+
+CREATE TABLE metadata.entity_webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    entity_type NAME NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{insert,update,delete}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+
+    -- Request
+    url TEXT NOT NULL CHECK (url ~ '^https?://'),
+    http_method VARCHAR(10) NOT NULL DEFAULT 'POST'
+        CHECK (http_method IN ('POST', 'PUT', 'PATCH', 'DELETE')),
+    headers JSONB NOT NULL DEFAULT '{}' CHECK (jsonb_typeof(headers) = 'object'),
+    payload_template TEXT,
+    timeout_seconds INT NOT NULL DEFAULT 30 CHECK (timeout_seconds BETWEEN 1 AND 300),
+    max_attempts INT NOT NULL DEFAULT 8 CHECK (max_attempts BETWEEN 1 AND 25),
+
+    -- Private columns (metadata.column_privacy) are dropped from .Entity and
+    -- .Previous unless the partner contract needs them
+    include_private_columns BOOLEAN NOT NULL DEFAULT FALSE,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT entity_webhook_subscriptions_valid_events CHECK (
+        events <@ ARRAY['insert', 'update', 'delete'] AND cardinality(events) > 0
+    )
+);
+
+CREATE INDEX idx_entity_webhook_subscriptions_entity ON metadata.entity_webhook_subscriptions(entity_type)
+    WHERE enabled;
+
+CREATE TRIGGER set_updated_at_trigger
+    BEFORE UPDATE ON metadata.entity_webhook_subscriptions
+    FOR EACH ROW
+    EXECUTE FUNCTION public.set_updated_at();
+
+COMMENT ON TABLE metadata.entity_webhook_subscriptions IS
+    'Outbound webhooks sent when rows of entity_type change. The table needs the metadata.queue_entity_webhooks() trigger. Added in v0.81.0.';
+COMMENT ON COLUMN metadata.entity_webhook_subscriptions.headers IS
+    'Request headers as a JSON object. Values are templates; use {{secret "NAME"}} for credentials (worker env var ENTITY_WEBHOOK_SECRET_NAME).';
+COMMENT ON COLUMN metadata.entity_webhook_subscriptions.payload_template IS
+    'Request body template (notification template syntax plus toJSON and secret). Fields: .Entity, .Previous, .Event, .EntityType, .EntityID, .DeliveryID, .OccurredAt, .Metadata. NULL sends the default JSON envelope.';
+COMMENT ON COLUMN metadata.entity_webhook_subscriptions.max_attempts IS
+    'Delivery attempts before the delivery is marked failed. Retries follow River''s exponential backoff.';
+
+
+-- ============================================================================
+-- 2. DELIVERIES
+-- ============================================================================
+
+CREATE TABLE metadata.entity_webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id INT NOT NULL REFERENCES metadata.entity_webhook_subscriptions(id) ON DELETE CASCADE,
+    entity_type NAME NOT NULL,
+    entity_id TEXT NOT NULL,
+    event TEXT NOT NULL CHECK (event IN ('insert', 'update', 'delete')),
+    entity_data JSONB NOT NULL,
+    previous_data JSONB,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'retrying', 'delivered', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_http_status INT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_entity_webhook_deliveries_subscription ON metadata.entity_webhook_deliveries(subscription_id, created_at DESC);
+CREATE INDEX idx_entity_webhook_deliveries_entity ON metadata.entity_webhook_deliveries(entity_type, entity_id);
+CREATE INDEX idx_entity_webhook_deliveries_open ON metadata.entity_webhook_deliveries(status)
+    WHERE status IN ('pending', 'retrying', 'failed');
+
+COMMENT ON TABLE metadata.entity_webhook_deliveries IS
+    'One outbound webhook per entity change per subscription. entity_data/previous_data are snapshots taken when the row changed. Added in v0.81.0.';
+
+
+-- ============================================================================
+-- 3. ATTEMPT TRANSCRIPTS
+-- ============================================================================
+-- Secret values are replaced with [REDACTED] in stored headers and bodies.
+
+CREATE TABLE metadata.entity_webhook_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL REFERENCES metadata.entity_webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    request_method TEXT NOT NULL,
+    request_url TEXT NOT NULL,
+    request_headers JSONB NOT NULL DEFAULT '{}',
+    request_body TEXT,
+    response_status INT,
+    response_headers JSONB,
+    response_body TEXT,
+    response_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    error TEXT,
+    duration_ms INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_entity_webhook_attempts_delivery ON metadata.entity_webhook_attempts(delivery_id, attempt);
+
+COMMENT ON TABLE metadata.entity_webhook_attempts IS
+    'Request and response of every delivery attempt (response body capped at 64 KB, secrets redacted). Added in v0.81.0.';
+
+
+-- ============================================================================
+-- 4. TRIGGER FUNCTION
+-- ============================================================================
+-- Attach to any entity table with an id column:
+--   CREATE TRIGGER entity_webhooks AFTER INSERT OR UPDATE OR DELETE ON public.requests
+--       FOR EACH ROW EXECUTE FUNCTION metadata.queue_entity_webhooks();
+-- Updates that change nothing are skipped.
+
+CREATE OR REPLACE FUNCTION metadata.queue_entity_webhooks()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_event TEXT := lower(TG_OP);
+    v_row JSONB;
+    v_previous JSONB;
+    v_private TEXT[];
+    v_sub metadata.entity_webhook_subscriptions%ROWTYPE;
+    v_delivery_id BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        v_row := to_jsonb(OLD);
+    ELSE
+        v_row := to_jsonb(NEW);
+    END IF;
+    IF TG_OP = 'UPDATE' THEN
+        v_previous := to_jsonb(OLD);
+        IF v_previous = v_row THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    v_private := metadata.private_columns(TG_TABLE_NAME)::TEXT[];
+
+    FOR v_sub IN
+        SELECT * FROM metadata.entity_webhook_subscriptions
+        WHERE entity_type = TG_TABLE_NAME
+          AND enabled
+          AND v_event = ANY(events)
+    LOOP
+        INSERT INTO metadata.entity_webhook_deliveries
+            (subscription_id, entity_type, entity_id, event, entity_data, previous_data)
+        VALUES (
+            v_sub.id,
+            TG_TABLE_NAME,
+            v_row->>'id',
+            v_event,
+            CASE WHEN v_sub.include_private_columns THEN v_row ELSE v_row - v_private END,
+            CASE WHEN v_sub.include_private_columns THEN v_previous ELSE v_previous - v_private END
+        )
+        RETURNING id INTO v_delivery_id;
+
+        INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+        VALUES (
+            'available',
+            'webhooks',
+            'entity_webhook_delivery',
+            jsonb_build_object('delivery_id', v_delivery_id),
+            2,
+            v_sub.max_attempts,
+            NOW()
+        );
+    END LOOP;
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.queue_entity_webhooks() IS
+    'AFTER INSERT/UPDATE/DELETE row trigger: queues a delivery for each enabled subscription on the table. Added in v0.81.0.';
+
+
+-- ============================================================================
+-- 5. ADMIN RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_entity_webhook_deliveries(
+    p_subscription_name VARCHAR(100) DEFAULT NULL,
+    p_status TEXT DEFAULT NULL,
+    p_limit INT DEFAULT 100
+)
+RETURNS TABLE (
+    id BIGINT,
+    subscription_name VARCHAR(100),
+    entity_type NAME,
+    entity_id TEXT,
+    event TEXT,
+    status TEXT,
+    attempts INT,
+    last_http_status INT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can view webhook deliveries';
+    END IF;
+
+    RETURN QUERY
+    SELECT d.id, s.name, d.entity_type, d.entity_id, d.event, d.status, d.attempts,
+           d.last_http_status, d.last_error, d.created_at, d.delivered_at
+    FROM metadata.entity_webhook_deliveries d
+    JOIN metadata.entity_webhook_subscriptions s ON s.id = d.subscription_id
+    WHERE (p_subscription_name IS NULL OR s.name = p_subscription_name)
+      AND (p_status IS NULL OR d.status = p_status)
+    ORDER BY d.created_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_entity_webhook_deliveries(VARCHAR, TEXT, INT) IS
+    'Admin-only. Recent outbound entity webhook deliveries, optionally by subscription and status. Added in v0.81.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_entity_webhook_deliveries(VARCHAR, TEXT, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_webhook_deliveries(VARCHAR, TEXT, INT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_entity_webhook_transcript(p_delivery_id BIGINT)
+RETURNS JSONB
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_result JSONB;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can view webhook transcripts';
+    END IF;
+
+    SELECT jsonb_build_object(
+        'delivery', to_jsonb(d) - 'entity_data' - 'previous_data',
+        'subscription', jsonb_build_object('id', s.id, 'name', s.name, 'url', s.url),
+        'attempts', COALESCE((
+            SELECT jsonb_agg(to_jsonb(a) ORDER BY a.attempt, a.id)
+            FROM metadata.entity_webhook_attempts a
+            WHERE a.delivery_id = d.id
+        ), '[]'::jsonb)
+    )
+    INTO v_result
+    FROM metadata.entity_webhook_deliveries d
+    JOIN metadata.entity_webhook_subscriptions s ON s.id = d.subscription_id
+    WHERE d.id = p_delivery_id;
+
+    IF v_result IS NULL THEN
+        RAISE EXCEPTION 'Webhook delivery not found: %', p_delivery_id;
+    END IF;
+
+    RETURN v_result;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_entity_webhook_transcript(BIGINT) IS
+    'Admin-only. A delivery with every attempt''s request and response, for support escalations. Added in v0.81.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_entity_webhook_transcript(BIGINT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_webhook_transcript(BIGINT) TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{entity_webhook_subscriptions,entity_webhook_deliveries,entity_webhook_attempts}',
+   '{}',
+   'v0-81-0-entity-webhooks',
+   'Outbound entity webhooks with payload mapping templates',
+   'accepted',
+   'Integrations with municipal 311 systems and CRMs need Civic OS to push record changes in the partner''s schema and terminology. The only outbound HTTP was HTTP-target scheduled jobs, which run on a clock, not on data changes, and keep only the last response.',
+   'Integrators attach metadata.queue_entity_webhooks() to an entity table. For each enabled subscription on that table, a change inserts a delivery snapshot and an entity_webhook_delivery River job. The consolidated worker renders the subscription''s payload template with the notification Renderer (plus toJSON and secret), sends it, and stores each attempt''s request and response in entity_webhook_attempts.',
+   'Snapshotting the row in the trigger sends what changed even if the row changes again before delivery. Reusing the Renderer gives integrators one template language for notifications and webhooks. Per-attempt transcripts answer "what exactly did we send and what did they say" without logging into the partner''s system.',
+   'Delivery order between events on the same row is not guaranteed once retries are involved; partners should treat payloads as state snapshots. Private columns are dropped from snapshots unless include_private_columns is set. Delivered and failed deliveries (with their transcripts) are purged after 30 days by the entity_webhook_cleanup maintenance task.');
+
+COMMIT;
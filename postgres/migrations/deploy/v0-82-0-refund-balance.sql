@@ -0,0 +1,243 @@
+-- Deploy civic_os:v0-82-0-refund-balance to pg
+-- requires: v0-81-0-entity-webhooks
+--
+-- v0.82.0 — Multiple partial refunds with a running refund balance:
+--   1. payments.transactions.refunded_amount_cents: succeeded refunds,
+--      kept in step with payments.refunds by trigger
+--   2. Index refunds by provider_refund_id (refund webhooks match on it)
+--   3. initiate_payment_refund() allows several pending refunds, counting
+--      them against max_refundable
+--   4. Record schema decision
+--
+-- The payment worker re-checks the balance before calling the provider and
+-- marks a refund failed when the provider reports it failed after the fact
+-- (Stripe charge.refund.updated, e.g. an ACH refund the bank returned).
+
+BEGIN;
+
+-- ============================================================================
+-- 1. RUNNING REFUND BALANCE
+-- ============================================================================
+
+ALTER TABLE payments.transactions
+    ADD COLUMN refunded_amount_cents BIGINT NOT NULL DEFAULT 0
+        CHECK (refunded_amount_cents >= 0);
+
+COMMENT ON COLUMN payments.transactions.refunded_amount_cents IS
+    'Sum of succeeded refunds in cents. Maintained by the refund_balance trigger on payments.refunds; a refund that later fails is taken back out. Added in v0.82.0.';
+
+UPDATE payments.transactions t
+SET refunded_amount_cents = r.total_cents
+FROM (
+    SELECT transaction_id, SUM(amount * 100)::BIGINT AS total_cents
+    FROM payments.refunds
+    WHERE status = 'succeeded'
+    GROUP BY transaction_id
+) r
+WHERE r.transaction_id = t.id;
+
+-- Recomputes rather than adds, so redelivered webhooks and worker retries
+-- can't count a refund twice
+CREATE OR REPLACE FUNCTION payments.sync_refunded_amount()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, public
+AS $$
+DECLARE
+    v_transaction_id UUID;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        v_transaction_id := OLD.transaction_id;
+    ELSE
+        v_transaction_id := NEW.transaction_id;
+    END IF;
+
+    UPDATE payments.transactions t
+    SET refunded_amount_cents = r.total_cents
+    FROM (
+        SELECT COALESCE(SUM(amount * 100), 0)::BIGINT AS total_cents
+        FROM payments.refunds
+        WHERE transaction_id = v_transaction_id AND status = 'succeeded'
+    ) r
+    WHERE t.id = v_transaction_id
+    AND t.refunded_amount_cents IS DISTINCT FROM r.total_cents;
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.sync_refunded_amount() IS
+    'Trigger function keeping payments.transactions.refunded_amount_cents equal to the transaction''s succeeded refunds. Added in v0.82.0.';
+
+CREATE TRIGGER refund_balance
+    AFTER INSERT OR DELETE OR UPDATE OF status, amount ON payments.refunds
+    FOR EACH ROW
+    EXECUTE FUNCTION payments.sync_refunded_amount();
+
+
+-- ============================================================================
+-- 2. PROVIDER REFUND ID INDEX
+-- ============================================================================
+
+CREATE INDEX idx_refunds_provider_refund_id
+    ON payments.refunds(provider_refund_id)
+    WHERE provider_refund_id IS NOT NULL;
+
+
+-- ============================================================================
+-- 3. CONCURRENT PARTIAL REFUNDS
+-- ============================================================================
+-- Pending refunds used to block new ones. They now count against
+-- max_refundable alongside succeeded ones, so several can be in flight
+-- without the total ever exceeding what was charged.
+
+CREATE OR REPLACE FUNCTION public.initiate_payment_refund(
+    p_payment_id UUID,
+    p_amount NUMERIC(10, 2),
+    p_reason TEXT
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment RECORD;
+    v_refund_id UUID;
+    v_user_id UUID;
+    v_total_refunded NUMERIC(10, 2);
+    v_total_pending NUMERIC(10, 2);
+    v_committed NUMERIC(10, 2);
+    v_remaining NUMERIC(10, 2);
+BEGIN
+    -- Get current user
+    v_user_id := current_user_id();
+    IF v_user_id IS NULL THEN
+        RAISE EXCEPTION 'Authentication required';
+    END IF;
+
+    -- Permission check (not isAdmin - allows flexible role configuration)
+    IF NOT public.has_permission('payment_refunds', 'create') THEN
+        RAISE EXCEPTION 'Missing payment_refunds:create permission'
+            USING HINT = 'Contact administrator to grant payment refund permissions';
+    END IF;
+
+    -- Validate reason length (enforced by CHECK constraint, but provide better error)
+    IF p_reason IS NULL OR LENGTH(TRIM(p_reason)) < 10 THEN
+        RAISE EXCEPTION 'Refund reason must be at least 10 characters'
+            USING HINT = 'Provide a detailed reason for the refund';
+    END IF;
+
+    -- Lock and fetch payment (serializes concurrent refund requests)
+    SELECT * INTO v_payment
+    FROM payments.transactions
+    WHERE id = p_payment_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Payment not found: %', p_payment_id;
+    END IF;
+
+    -- Validate payment can be refunded
+    IF v_payment.status != 'succeeded' THEN
+        RAISE EXCEPTION 'Can only refund succeeded payments (current status: %)', v_payment.status
+            USING HINT = 'Payment must have succeeded before it can be refunded';
+    END IF;
+
+    -- Validate refund amount
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid refund amount: %', p_amount
+            USING HINT = 'Refund amount must be greater than zero';
+    END IF;
+
+    -- Succeeded and in-flight refunds both count against max_refundable
+    SELECT
+        COALESCE(SUM(amount) FILTER (WHERE status = 'succeeded'), 0),
+        COALESCE(SUM(amount) FILTER (WHERE status = 'pending'), 0)
+    INTO v_total_refunded, v_total_pending
+    FROM payments.refunds
+    WHERE transaction_id = p_payment_id;
+
+    v_committed := v_total_refunded + v_total_pending;
+    v_remaining := v_payment.max_refundable - v_committed;
+
+    IF v_committed + p_amount > v_payment.max_refundable THEN
+        IF v_payment.fee_refundable THEN
+            RAISE EXCEPTION 'Total refunds ($%) would exceed payment amount ($%). Already refunded: $%, pending: $%',
+                v_committed + p_amount, v_payment.max_refundable, v_total_refunded, v_total_pending
+                USING HINT = format('Maximum additional refund allowed: $%s', v_remaining);
+        ELSE
+            RAISE EXCEPTION 'Total refunds ($%) would exceed base amount ($%). Processing fee ($%) is non-refundable. Already refunded: $%, pending: $%',
+                v_committed + p_amount, v_payment.max_refundable, v_payment.processing_fee, v_total_refunded, v_total_pending
+                USING HINT = format('Maximum additional refund allowed: $%s (processing fee retained)', v_remaining);
+        END IF;
+    END IF;
+
+    -- Create refund record
+    INSERT INTO payments.refunds (
+        transaction_id,
+        amount,
+        reason,
+        initiated_by,
+        status
+    ) VALUES (
+        p_payment_id,
+        p_amount,
+        TRIM(p_reason),
+        v_user_id,
+        'pending'
+    ) RETURNING id INTO v_refund_id;
+
+    -- Enqueue River job for provider refund processing
+    INSERT INTO metadata.river_job (
+        kind,
+        args,
+        priority,
+        queue,
+        max_attempts,
+        scheduled_at,
+        state
+    ) VALUES (
+        'process_refund',
+        jsonb_build_object(
+            'refund_id', v_refund_id,
+            'payment_intent_id', v_payment.provider_payment_id,
+            'amount_cents', (p_amount * 100)::INTEGER
+        ),
+        1,  -- Normal priority
+        'default',
+        3,  -- Retry up to 3 times
+        NOW(),
+        'available'
+    );
+
+    RAISE NOTICE 'Created refund % for payment % (amount: $%, committed after: $%, max refundable: $%)',
+        v_refund_id, p_payment_id, p_amount, v_committed + p_amount, v_payment.max_refundable;
+
+    RETURN v_refund_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.initiate_payment_refund IS
+    'Initiate a (partial) refund. Several refunds may be pending at once; succeeded and pending refunds together may not exceed max_refundable, which respects fee_refundable. Updated in v0.82.0.';
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{transactions,refunds}',
+   '{refunded_amount_cents}',
+   'v0-82-0-refund-balance',
+   'Multiple partial refunds with a running refund balance',
+   'accepted',
+   'initiate_payment_refund() refused new refunds while one was pending, so staff refunding several line items had to wait for each to finish. The worker trusted the job''s amount, and a refund the provider failed after accepting it (an ACH refund returned by the bank) stayed succeeded.',
+   'payments.transactions.refunded_amount_cents holds the sum of succeeded refunds, recomputed by a trigger whenever a refund changes. The RPC allows several pending refunds as long as succeeded plus pending stays within max_refundable. The payment worker locks the transaction and re-checks that balance before calling the provider, and Stripe charge.refund.updated (Square refund.updated) events with a failed or canceled refund mark it failed.',
+   'Recomputing from payments.refunds in a trigger keeps the balance correct however the refund row changes (worker, webhook, reprocessed webhook) without each writer doing arithmetic. Counting pending refunds at creation keeps concurrent refunds from over-committing; the worker check catches jobs that bypassed the RPC.',
+   'A refund can move from succeeded to failed, which lowers refunded_amount_cents and the effective status; the payment_refunded email has already been sent by then. Stripe charge.refunded no longer marks pending refunds succeeded by payment ID, since with several in flight it cannot tell them apart; refunds are confirmed by the worker or by refund-level events.');
+
+COMMIT;
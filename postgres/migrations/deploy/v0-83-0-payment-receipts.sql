@@ -0,0 +1,182 @@
+-- Deploy civic_os:v0-83-0-payment-receipts to pg
+-- requires: v0-82-0-refund-balance
+--
+-- v0.83.0 — PDF payment receipts:
+--   1. Receipt columns on payments.transactions (number, S3 key, timestamp)
+--      and a BEFORE UPDATE trigger numbering receipts as payments succeed
+--   2. metadata.notifications.attachments: files the worker attaches to the
+--      email, passed through to the send_notification job
+--   3. A succeeded payment enqueues generate_receipt instead of creating the
+--      payment_succeeded notification directly; the worker renders the PDF,
+--      stores it in S3 and creates the notification with the PDF attached
+--   4. payment_succeeded template mentions the attached receipt
+--   5. Record schema decision
+
+BEGIN;
+
+-- ============================================================================
+-- 1. RECEIPT COLUMNS
+-- ============================================================================
+
+CREATE SEQUENCE payments.receipt_number_seq;
+
+ALTER TABLE payments.transactions
+    ADD COLUMN receipt_number BIGINT UNIQUE,
+    ADD COLUMN receipt_s3_key TEXT,
+    ADD COLUMN receipt_generated_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN payments.transactions.receipt_number IS
+    'Sequential receipt number, assigned when the payment succeeds. Payments that succeeded before v0.83.0 have none. Added in v0.83.0.';
+COMMENT ON COLUMN payments.transactions.receipt_s3_key IS
+    'S3 key of the PDF receipt (payments.transactions/<id>/receipt-<number>.pdf), written by the generate_receipt job. Added in v0.83.0.';
+COMMENT ON COLUMN payments.transactions.receipt_generated_at IS
+    'When the generate_receipt job stored the receipt and queued the payment_succeeded email. Added in v0.83.0.';
+
+CREATE OR REPLACE FUNCTION payments.assign_receipt_number()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, public
+AS $$
+BEGIN
+    IF NEW.status = 'succeeded' AND OLD.status IS DISTINCT FROM 'succeeded'
+       AND NEW.receipt_number IS NULL THEN
+        NEW.receipt_number := nextval('payments.receipt_number_seq');
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.assign_receipt_number() IS
+    'Trigger function numbering a payment''s receipt when it moves to succeeded. Added in v0.83.0.';
+
+CREATE TRIGGER assign_receipt_number
+    BEFORE UPDATE OF status ON payments.transactions
+    FOR EACH ROW
+    EXECUTE FUNCTION payments.assign_receipt_number();
+
+
+-- ============================================================================
+-- 2. NOTIFICATION ATTACHMENTS
+-- ============================================================================
+
+ALTER TABLE metadata.notifications
+    ADD COLUMN attachments JSONB NOT NULL DEFAULT '[]'::jsonb
+        CHECK (jsonb_typeof(attachments) = 'array');
+
+COMMENT ON COLUMN metadata.notifications.attachments IS
+    'Files attached to the email: [{"file_name", "content_type", "s3_bucket", "s3_key"}]. Ignored by SMS. Added in v0.83.0.';
+
+CREATE OR REPLACE FUNCTION public.enqueue_notification_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'send_notification',
+        jsonb_build_object(
+            'notification_id', NEW.id::text,
+            'user_id', NEW.user_id::text,
+            'template_name', NEW.template_name,
+            'entity_type', NEW.entity_type,
+            'entity_id', NEW.entity_id,
+            'entity_data', NEW.entity_data,
+            'channels', NEW.channels,
+            'attachments', NEW.attachments
+        ),
+        'notifications',  -- Queue name
+        1,                -- Priority (higher = more urgent)
+        5,                -- Max attempts (fewer than file jobs - emails are idempotent)
+        NOW(),            -- Schedule immediately
+        'available'       -- Job state
+    );
+    RETURN NEW;
+END;
+$$;
+
+
+-- ============================================================================
+-- 3. RECEIPT JOB ON PAYMENT SUCCESS
+-- ============================================================================
+-- The worker creates the payment_succeeded notification once the receipt is
+-- stored. If rendering keeps failing, its last attempt sends the email
+-- without the attachment so the payer still hears about the payment.
+
+CREATE OR REPLACE FUNCTION payments.notify_payment_succeeded()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Only trigger on status change to 'succeeded'
+    IF NEW.status = 'succeeded' AND (OLD.status IS NULL OR OLD.status != 'succeeded') THEN
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'generate_receipt',
+            jsonb_build_object('transaction_id', NEW.id),
+            'notifications',
+            1,
+            5,
+            NOW(),
+            'available'
+        );
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+
+-- ============================================================================
+-- 4. PAYMENT SUCCEEDED TEMPLATE
+-- ============================================================================
+
+UPDATE metadata.notification_templates
+SET html_template = '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        <h2 style="color: #16a34a;">Payment Confirmed</h2>
+        <p>Thank you! Your payment has been successfully processed.</p>
+        <table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Description:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.description}}</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Amount Paid:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.display_name}}</td>
+            </tr>
+            {{if .Entity.receipt_number}}<tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Receipt No.:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.receipt_number}}</td>
+            </tr>{{end}}
+        </table>
+        {{if .Entity.receipt_attached}}<p style="color: #6b7280; font-size: 14px;">Your receipt is attached as a PDF. Please keep it for your records.</p>{{else}}<p style="color: #6b7280; font-size: 14px;">This email serves as your receipt. Please keep it for your records.</p>{{end}}
+    </div>',
+    text_template = 'Payment Confirmed
+
+Thank you! Your payment has been successfully processed.
+
+Description: {{.Entity.description}}
+Amount Paid: {{.Entity.display_name}}
+{{if .Entity.receipt_number}}Receipt No.: {{.Entity.receipt_number}}
+{{end}}
+{{if .Entity.receipt_attached}}Your receipt is attached as a PDF. Please keep it for your records.{{else}}This email serves as your receipt. Please keep it for your records.{{end}}'
+WHERE name = 'payment_succeeded';
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{transactions,notifications}',
+   '{receipt_number,receipt_s3_key,receipt_generated_at,attachments}',
+   'v0-83-0-payment-receipts',
+   'PDF payment receipts attached to the payment confirmation email',
+   'accepted',
+   'The payment_succeeded email was the only receipt. Payers asked for a document they could file or forward for reimbursement, and staff had nothing to point to when a payer lost the email.',
+   'A receipt number is assigned when a payment succeeds. The success trigger enqueues a generate_receipt job; the consolidated worker renders a one-page PDF (municipality header, itemized amount and processing fee, entity reference), stores it in S3 under payments.transactions/<id>/ and creates the payment_succeeded notification with the PDF in the new notifications.attachments column. The notification worker sends emails with attachments as multipart/mixed.',
+   'Generating the PDF before creating the notification keeps one email per payment instead of a confirmation followed by a receipt. Attachments are S3 references rather than bytes in the job args, so River job rows stay small and other notifications can attach stored files the same way.',
+   'The confirmation email now waits for the receipt job (normally seconds). If the receipt cannot be rendered or stored after every retry, the email is sent without it and receipt_s3_key stays NULL. Payments that succeeded before v0.83.0 have no receipt number or PDF.');
+
+COMMIT;
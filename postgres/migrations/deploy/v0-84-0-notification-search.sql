@@ -0,0 +1,290 @@
+-- Deploy civic_os:v0-84-0-notification-search to pg
+-- requires: v0-83-0-payment-receipts
+--
+-- v0.84.0 — Notification search for support staff:
+--   1. metadata.notification_log: per-notification delivery snapshot written
+--      by the notification worker (recipient address used, rendered subject
+--      and text, channel results)
+--   2. metadata.notification_search view: notifications joined to their
+--      recipient, template and delivery snapshot
+--   3. Permissions: notification_log:read (search, subjects, outcomes) and
+--      notification_content:read (recipient addresses, rendered bodies),
+--      both granted to admin
+--   4. public.search_notifications() and public.get_notification_content()
+--   5. Record schema decision
+--
+-- Answers "what emails did resident X get last month?" without reading
+-- worker logs. Rendered content is private: a clerk who can search sees
+-- which templates went out and when, not what they said.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. DELIVERY SNAPSHOTS
+-- ============================================================================
+
+CREATE TABLE metadata.notification_log (
+    notification_id BIGINT PRIMARY KEY REFERENCES metadata.notifications(id) ON DELETE CASCADE,
+
+    -- Recipient as addressed at send time (users change their email)
+    recipient_name TEXT,
+    recipient_email TEXT,
+    recipient_phone TEXT,
+
+    -- Rendered content
+    subject TEXT,
+    body_text TEXT,
+    sms_text TEXT,
+    attachment_names TEXT[] NOT NULL DEFAULT '{}',
+
+    -- Outcome of the latest attempt
+    channels_sent TEXT[] NOT NULL DEFAULT '{}',
+    channels_failed TEXT[] NOT NULL DEFAULT '{}',
+    error_message TEXT,
+    attempts INT NOT NULL DEFAULT 1,
+    delivered_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_notification_log_recipient_email
+    ON metadata.notification_log USING gin (lower(recipient_email) gin_trgm_ops);
+CREATE INDEX idx_notification_log_subject
+    ON metadata.notification_log USING gin (subject gin_trgm_ops);
+CREATE INDEX idx_notification_log_delivered_at
+    ON metadata.notification_log(delivered_at DESC);
+
+-- Search by recipient and date range goes through metadata.notifications
+CREATE INDEX idx_notifications_user_created
+    ON metadata.notifications(user_id, created_at DESC);
+
+COMMENT ON TABLE metadata.notification_log IS
+    'What the notification worker sent: recipient address, rendered subject/text and channel results, one row per notification (updated on retries). Notifications that never rendered (template errors) have no row. Read through search_notifications(). Added in v0.84.0.';
+COMMENT ON COLUMN metadata.notification_log.body_text IS
+    'Rendered plain-text body. Private: returned only with notification_content:read.';
+
+ALTER TABLE metadata.notification_log ENABLE ROW LEVEL SECURITY;
+-- No policies: only SECURITY DEFINER functions and the worker read it
+
+
+-- ============================================================================
+-- 2. SEARCH VIEW
+-- ============================================================================
+
+CREATE VIEW metadata.notification_search AS
+SELECT
+    n.id,
+    n.created_at,
+    n.user_id,
+    COALESCE(l.recipient_name, u.display_name) AS recipient_name,
+    l.recipient_email,
+    l.recipient_phone,
+    n.template_name,
+    t.description AS template_description,
+    n.entity_type,
+    n.entity_id,
+    n.status,
+    n.channels,
+    COALESCE(l.channels_sent, n.channels_sent) AS channels_sent,
+    COALESCE(l.channels_failed, n.channels_failed) AS channels_failed,
+    COALESCE(l.error_message, n.error_message) AS error_message,
+    l.subject,
+    l.attachment_names,
+    l.attempts,
+    n.sent_at,
+    l.delivered_at
+FROM metadata.notifications n
+LEFT JOIN metadata.notification_log l ON l.notification_id = n.id
+LEFT JOIN metadata.civic_os_users u ON u.id = n.user_id
+LEFT JOIN metadata.notification_templates t ON t.name = n.template_name;
+
+COMMENT ON VIEW metadata.notification_search IS
+    'Notifications with recipient, template and delivery snapshot. Not exposed through the API; search_notifications() applies permissions and redaction. Added in v0.84.0.';
+
+
+-- ============================================================================
+-- 3. PERMISSIONS
+-- ============================================================================
+
+INSERT INTO metadata.permissions (table_name, permission)
+VALUES
+    ('notification_log', 'read'),       -- Search notifications, see subjects and outcomes
+    ('notification_content', 'read')    -- See recipient addresses and rendered bodies
+ON CONFLICT (table_name, permission) DO NOTHING;
+
+INSERT INTO metadata.permission_roles (role_id, permission_id)
+SELECT r.id, p.id
+FROM metadata.roles r
+CROSS JOIN metadata.permissions p
+WHERE r.display_name = 'admin'
+  AND p.table_name IN ('notification_log', 'notification_content')
+  AND p.permission = 'read'
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+
+
+-- ============================================================================
+-- 4. SEARCH RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.search_notifications(
+    p_recipient TEXT DEFAULT NULL,
+    p_template_name VARCHAR(100) DEFAULT NULL,
+    p_entity_type VARCHAR(100) DEFAULT NULL,
+    p_entity_id VARCHAR(100) DEFAULT NULL,
+    p_subject TEXT DEFAULT NULL,
+    p_status VARCHAR(20) DEFAULT NULL,
+    p_since TIMESTAMPTZ DEFAULT NULL,
+    p_until TIMESTAMPTZ DEFAULT NULL,
+    p_limit INT DEFAULT 100,
+    p_offset INT DEFAULT 0
+)
+RETURNS TABLE (
+    id BIGINT,
+    created_at TIMESTAMPTZ,
+    user_id UUID,
+    recipient_name TEXT,
+    recipient_email TEXT,
+    recipient_phone TEXT,
+    template_name VARCHAR(100),
+    template_description TEXT,
+    entity_type VARCHAR(100),
+    entity_id VARCHAR(100),
+    status VARCHAR(20),
+    channels TEXT[],
+    channels_sent TEXT[],
+    channels_failed TEXT[],
+    error_message TEXT,
+    subject TEXT,
+    attachment_names TEXT[],
+    attempts INT,
+    sent_at TIMESTAMPTZ,
+    content_redacted BOOLEAN
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_show_content BOOLEAN;
+    v_recipient_id UUID;
+BEGIN
+    IF NOT public.has_permission('notification_log', 'read') THEN
+        RAISE EXCEPTION 'Missing notification_log:read permission'
+            USING HINT = 'Contact administrator to grant notification search permissions';
+    END IF;
+
+    v_show_content := public.has_permission('notification_content', 'read');
+
+    -- A recipient that parses as a UUID is a user ID; anything else matches
+    -- the name or the address the notification went to
+    IF p_recipient ~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$' THEN
+        v_recipient_id := p_recipient::UUID;
+    END IF;
+
+    RETURN QUERY
+    SELECT s.id, s.created_at, s.user_id, s.recipient_name,
+           CASE WHEN v_show_content THEN s.recipient_email END,
+           CASE WHEN v_show_content THEN s.recipient_phone END,
+           s.template_name, s.template_description, s.entity_type, s.entity_id,
+           s.status, s.channels, s.channels_sent, s.channels_failed, s.error_message,
+           s.subject, s.attachment_names, s.attempts, s.sent_at,
+           NOT v_show_content
+    FROM metadata.notification_search s
+    WHERE (p_recipient IS NULL OR p_recipient = ''
+           OR s.user_id = v_recipient_id
+           OR (v_recipient_id IS NULL AND (
+                lower(s.recipient_email) LIKE '%' || lower(p_recipient) || '%'
+                OR s.recipient_name ILIKE '%' || p_recipient || '%')))
+      AND (p_template_name IS NULL OR s.template_name = p_template_name)
+      AND (p_entity_type IS NULL OR s.entity_type = p_entity_type)
+      AND (p_entity_id IS NULL OR s.entity_id = p_entity_id)
+      AND (p_subject IS NULL OR s.subject ILIKE '%' || p_subject || '%')
+      AND (p_status IS NULL OR s.status = p_status)
+      AND (p_since IS NULL OR s.created_at >= p_since)
+      AND (p_until IS NULL OR s.created_at < p_until)
+    ORDER BY s.created_at DESC, s.id DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000)
+    OFFSET GREATEST(p_offset, 0);
+END;
+$$;
+
+COMMENT ON FUNCTION public.search_notifications IS
+    'Search notifications by recipient (user ID, name or address), template, entity, subject, status and date range, newest first. Requires notification_log:read; recipient addresses are NULL and content_redacted is true without notification_content:read. Added in v0.84.0.';
+
+REVOKE EXECUTE ON FUNCTION public.search_notifications FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.search_notifications TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_notification_content(p_notification_id BIGINT)
+RETURNS JSONB
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_result JSONB;
+BEGIN
+    IF NOT public.has_permission('notification_content', 'read') THEN
+        RAISE EXCEPTION 'Missing notification_content:read permission'
+            USING HINT = 'Contact administrator to grant notification content permissions';
+    END IF;
+
+    SELECT jsonb_build_object(
+        'id', n.id,
+        'template_name', n.template_name,
+        'entity_type', n.entity_type,
+        'entity_id', n.entity_id,
+        'entity_data', n.entity_data,
+        'status', n.status,
+        'recipient_name', l.recipient_name,
+        'recipient_email', l.recipient_email,
+        'recipient_phone', l.recipient_phone,
+        'subject', l.subject,
+        'body_text', l.body_text,
+        'sms_text', l.sms_text,
+        'attachment_names', COALESCE(l.attachment_names, '{}'),
+        'channels_sent', l.channels_sent,
+        'channels_failed', l.channels_failed,
+        'error_message', COALESCE(l.error_message, n.error_message),
+        'attempts', l.attempts,
+        'created_at', n.created_at,
+        'delivered_at', l.delivered_at
+    )
+    INTO v_result
+    FROM metadata.notifications n
+    LEFT JOIN metadata.notification_log l ON l.notification_id = n.id
+    WHERE n.id = p_notification_id;
+
+    IF v_result IS NULL THEN
+        RAISE EXCEPTION 'Notification not found: %', p_notification_id;
+    END IF;
+
+    RETURN v_result;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_notification_content(BIGINT) IS
+    'A notification''s rendered subject, text and SMS bodies, recipient addresses and template data, for support answers. Requires notification_content:read. Added in v0.84.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_notification_content(BIGINT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_notification_content(BIGINT) TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{notifications,notification_log}',
+   '{}',
+   'v0-84-0-notification-search',
+   'Notification search for support staff',
+   'accepted',
+   'Support staff answering "what emails did resident X get last month?" had to ask an administrator to query metadata.notifications, which only holds template data and a status: not the address used or what the email said. Row-level security limits the table to each user''s own notifications.',
+   'The notification worker writes a metadata.notification_log row per notification with the address it sent to, the rendered subject, text and SMS bodies, attachment names and the channel results (updated on retries). metadata.notification_search joins it to notifications, users and templates. search_notifications() filters by recipient, template, entity, subject, status and date and requires notification_log:read; addresses and bodies need notification_content:read, also returned by get_notification_content().',
+   'Snapshotting at send time records what the resident actually received, which re-rendering the template later could not (templates and entity data change). Two permissions let a clerk confirm that an email went out without being able to read every resident''s mail.',
+   'Notifications sent before v0.84.0, and those that failed to render, have no snapshot: they appear with a NULL subject. Rendered bodies are kept as long as the notification row. Search by recipient name or address is a substring match on trigram indexes, so single-character searches scan.');
+
+COMMIT;
@@ -0,0 +1,712 @@
+-- Deploy civic_os:v0-85-0-entity-archival to pg
+-- requires: v0-84-0-notification-search
+--
+-- v0.85.0 — Entity archival to cold storage tables:
+--   1. archive schema: one mirror table per archived entity (same columns,
+--      no constraints, plus archived_at/archive_run_id), kept in step with
+--      the hot table by metadata.sync_archive_table()
+--   2. metadata.archive_policies: which tables archive, after how long, and
+--      optionally only in a terminal status
+--   3. metadata.archived_entities: a stub per archived row (display name,
+--      search vector, file count) so archived records can still be found
+--   4. metadata.archive_runs: one row per archive or unarchive job
+--   5. metadata.files.archive_status/hot_bucket: attachments the worker moves
+--      to the archive bucket and back
+--   6. Archive/unarchive functions called by the consolidated worker
+--   7. Public RPCs: set_archive_policy(), search_archived_entities(),
+--      get_archived_entity(), request_unarchive(), get_archive_runs()
+--   8. Record schema decision
+--
+-- The consolidated worker's entity_archival maintenance task enqueues an
+-- archive_entities job per enabled policy daily; unarchive_entity jobs come
+-- from request_unarchive().
+
+BEGIN;
+
+-- ============================================================================
+-- 1. ARCHIVE SCHEMA
+-- ============================================================================
+-- Not in PostgREST's db-schemas, and no grants: archived rows are read only
+-- through the SECURITY DEFINER functions below.
+
+CREATE SCHEMA IF NOT EXISTS archive;
+REVOKE ALL ON SCHEMA archive FROM PUBLIC;
+
+COMMENT ON SCHEMA archive IS
+    'Mirror tables holding archived entity rows (archive.<table_name>). Managed by metadata.sync_archive_table(); not exposed through the API. Added in v0.85.0.';
+
+
+-- Single-column primary key of a public table, as (column, type). Archival
+-- keys stubs and attachments by entity_id, so composite keys are rejected.
+CREATE OR REPLACE FUNCTION metadata.archive_primary_key(
+    p_entity_type NAME,
+    OUT pk_column NAME,
+    OUT pk_type TEXT
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_count INT;
+BEGIN
+    SELECT COUNT(*), MIN(a.attname::TEXT), MIN(format_type(a.atttypid, a.atttypmod))
+    INTO v_count, pk_column, pk_type
+    FROM pg_index i
+    JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+    WHERE i.indrelid = format('public.%I', p_entity_type)::regclass
+      AND i.indisprimary;
+
+    IF v_count <> 1 THEN
+        RAISE EXCEPTION 'Table % needs a single-column primary key to be archived', p_entity_type;
+    END IF;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.archive_primary_key(NAME) IS
+    'Primary key column and type of public.<entity_type>. Raises unless the key is a single column. Added in v0.85.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.sync_archive_table(p_entity_type NAME)
+RETURNS VOID
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_source REGCLASS := format('public.%I', p_entity_type)::regclass;
+    v_archive REGCLASS := to_regclass(format('archive.%I', p_entity_type));
+    v_pk NAME;
+    v_col RECORD;
+BEGIN
+    IF v_archive IS NULL THEN
+        SELECT pk_column INTO v_pk FROM metadata.archive_primary_key(p_entity_type);
+
+        -- LIKE copies columns, types and NOT NULL only: no defaults, identity,
+        -- foreign keys or triggers. Generated columns become plain columns so
+        -- the archived row keeps its search vector.
+        EXECUTE format('CREATE TABLE archive.%1$I (LIKE public.%1$I)', p_entity_type);
+        EXECUTE format(
+            'ALTER TABLE archive.%I
+                 ADD COLUMN archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                 ADD COLUMN archive_run_id BIGINT',
+            p_entity_type);
+        EXECUTE format('ALTER TABLE archive.%1$I ADD PRIMARY KEY (%2$I)', p_entity_type, v_pk);
+        EXECUTE format('ALTER TABLE archive.%I ENABLE ROW LEVEL SECURITY', p_entity_type);
+        EXECUTE format('COMMENT ON TABLE archive.%1$I IS %2$L', p_entity_type,
+            format('Archived rows of public.%s. See metadata.archive_policies.', p_entity_type));
+        RETURN;
+    END IF;
+
+    -- Columns added to the hot table since the mirror was created
+    FOR v_col IN
+        SELECT a.attname, format_type(a.atttypid, a.atttypmod) AS type_name
+        FROM pg_attribute a
+        WHERE a.attrelid = v_source
+          AND a.attnum > 0
+          AND NOT a.attisdropped
+          AND NOT EXISTS (
+              SELECT 1 FROM pg_attribute b
+              WHERE b.attrelid = v_archive
+                AND b.attname = a.attname
+                AND NOT b.attisdropped
+          )
+        ORDER BY a.attnum
+    LOOP
+        EXECUTE format('ALTER TABLE archive.%I ADD COLUMN %I %s',
+            p_entity_type, v_col.attname, v_col.type_name);
+    END LOOP;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.sync_archive_table(NAME) IS
+    'Create archive.<entity_type> from public.<entity_type>, or add columns the hot table gained since. Columns dropped from the hot table stay in the archive. Added in v0.85.0.';
+
+
+-- ============================================================================
+-- 2. ARCHIVE POLICIES
+-- ============================================================================
+
+CREATE TABLE metadata.archive_policies (
+    entity_type NAME PRIMARY KEY,
+
+    -- Rows whose age_column is older than archive_after are archived
+    age_column NAME NOT NULL DEFAULT 'updated_at',
+    archive_after INTERVAL NOT NULL CHECK (archive_after >= INTERVAL '1 day'),
+
+    -- Optional: only rows whose status (a metadata.statuses FK) is terminal
+    status_column NAME,
+
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    batch_size INT NOT NULL DEFAULT 500 CHECK (batch_size BETWEEN 1 AND 10000),
+
+    last_archived_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.archive_policies IS
+    'Per-table archival rules, managed with set_archive_policy(). Added in v0.85.0.';
+COMMENT ON COLUMN metadata.archive_policies.status_column IS
+    'Status column (FK to metadata.statuses). When set, only rows in a terminal status (is_terminal) are archived, however old.';
+
+ALTER TABLE metadata.archive_policies ENABLE ROW LEVEL SECURITY;
+-- No policies: read and written through SECURITY DEFINER functions
+
+
+-- ============================================================================
+-- 3. ARCHIVE STUBS
+-- ============================================================================
+-- The hot row is gone, so lookups, links and search results for an archived
+-- record resolve through its stub.
+
+CREATE TABLE metadata.archived_entities (
+    entity_type NAME NOT NULL,
+    entity_id TEXT NOT NULL,
+    display_name TEXT,
+    search_vector TSVECTOR,
+    file_count INT NOT NULL DEFAULT 0,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    archive_run_id BIGINT,
+    PRIMARY KEY (entity_type, entity_id)
+);
+
+CREATE INDEX idx_archived_entities_search
+    ON metadata.archived_entities USING gin (search_vector);
+CREATE INDEX idx_archived_entities_display_name
+    ON metadata.archived_entities USING gin (display_name gin_trgm_ops);
+
+COMMENT ON TABLE metadata.archived_entities IS
+    'One stub per archived row: display name, search vector (the row''s civic_os_text_search, or its display name) and attachment count. Read through search_archived_entities(). Added in v0.85.0.';
+
+ALTER TABLE metadata.archived_entities ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 4. ARCHIVE RUNS
+-- ============================================================================
+
+CREATE TABLE metadata.archive_runs (
+    id BIGSERIAL PRIMARY KEY,
+    entity_type NAME NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('archive', 'unarchive')),
+    entity_id TEXT,  -- unarchive only
+    status TEXT NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'completed', 'failed')),
+    rows_moved INT NOT NULL DEFAULT 0,
+    rows_skipped INT NOT NULL DEFAULT 0,
+    files_moved INT NOT NULL DEFAULT 0,
+    files_failed INT NOT NULL DEFAULT 0,
+    requested_by UUID,
+    river_job_id BIGINT,
+    error_message TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_archive_runs_entity_started
+    ON metadata.archive_runs(entity_type, started_at DESC);
+
+COMMENT ON TABLE metadata.archive_runs IS
+    'One row per archive_entities or unarchive_entity job: rows and attachments moved, rows skipped (still referenced by foreign keys), who asked. Added in v0.85.0.';
+
+ALTER TABLE metadata.archive_runs ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 5. ATTACHMENT RELOCATION
+-- ============================================================================
+
+ALTER TABLE metadata.files
+    ADD COLUMN archive_status TEXT
+        CHECK (archive_status IN ('pending_archive', 'archived', 'pending_restore')),
+    ADD COLUMN hot_bucket VARCHAR(255);
+
+CREATE INDEX idx_files_archive_pending
+    ON metadata.files(entity_type, archive_status)
+    WHERE archive_status IN ('pending_archive', 'pending_restore');
+
+COMMENT ON COLUMN metadata.files.archive_status IS
+    'NULL for live files. pending_archive/pending_restore: the worker still has to move the objects; archived: objects are in the archive bucket (s3_bucket) and hot_bucket is where they return on unarchive. Added in v0.85.0.';
+COMMENT ON COLUMN metadata.files.hot_bucket IS
+    'Bucket an archived file came from. Added in v0.85.0.';
+
+
+-- ============================================================================
+-- 6. ARCHIVE AND UNARCHIVE
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.archive_entity_batch(
+    p_entity_type NAME,
+    p_run_id BIGINT,
+    p_offset INT DEFAULT 0
+)
+RETURNS TABLE (archived INT, skipped INT)
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_policy metadata.archive_policies%ROWTYPE;
+    v_pk NAME;
+    v_pk_type TEXT;
+    v_columns TEXT;
+    v_search TEXT;
+    v_filter TEXT;
+    v_id TEXT;
+    v_archived INT := 0;
+    v_skipped INT := 0;
+BEGIN
+    SELECT * INTO v_policy FROM metadata.archive_policies WHERE entity_type = p_entity_type;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'No archive policy for %', p_entity_type;
+    END IF;
+
+    SELECT pk_column, pk_type INTO v_pk, v_pk_type
+    FROM metadata.archive_primary_key(p_entity_type);
+    PERFORM metadata.sync_archive_table(p_entity_type);
+
+    SELECT string_agg(quote_ident(a.attname), ', ' ORDER BY a.attnum)
+    INTO v_columns
+    FROM pg_attribute a
+    WHERE a.attrelid = format('public.%I', p_entity_type)::regclass
+      AND a.attnum > 0
+      AND NOT a.attisdropped;
+
+    IF EXISTS (
+        SELECT 1 FROM pg_attribute a
+        WHERE a.attrelid = format('public.%I', p_entity_type)::regclass
+          AND a.attname = 'civic_os_text_search'
+          AND NOT a.attisdropped
+    ) THEN
+        v_search := 't.civic_os_text_search';
+    ELSE
+        v_search := 'to_tsvector(''english'', COALESCE(to_jsonb(t)->>''display_name'', ''''))';
+    END IF;
+
+    v_filter := format('%I < NOW() - %L::INTERVAL', v_policy.age_column, v_policy.archive_after);
+    IF v_policy.status_column IS NOT NULL THEN
+        v_filter := v_filter || format(
+            ' AND %I IN (SELECT id FROM metadata.statuses WHERE is_terminal)',
+            v_policy.status_column);
+    END IF;
+
+    -- Lets DELETE triggers on the hot table tell archival from deletion
+    PERFORM set_config('civic_os.archiving', 'on', true);
+
+    FOR v_id IN EXECUTE format(
+        'SELECT %1$I::TEXT FROM public.%2$I WHERE %3$s ORDER BY %4$I, %1$I LIMIT %5$s OFFSET %6$s FOR UPDATE SKIP LOCKED',
+        v_pk, p_entity_type, v_filter, v_policy.age_column, v_policy.batch_size, GREATEST(p_offset, 0))
+    LOOP
+        -- One subtransaction per row: a row still referenced by another
+        -- table's foreign key stays hot and is counted as skipped
+        BEGIN
+            EXECUTE format(
+                'INSERT INTO archive.%1$I (%2$s, archived_at, archive_run_id)
+                 SELECT %2$s, NOW(), $2 FROM public.%1$I WHERE %3$I = $1::%4$s',
+                p_entity_type, v_columns, v_pk, v_pk_type)
+            USING v_id, p_run_id;
+
+            EXECUTE format(
+                'INSERT INTO metadata.archived_entities
+                     (entity_type, entity_id, display_name, search_vector, file_count, archive_run_id)
+                 SELECT $3, $1, to_jsonb(t)->>''display_name'', %1$s,
+                        (SELECT COUNT(*) FROM metadata.files f WHERE f.entity_type = $3 AND f.entity_id = $1),
+                        $2
+                 FROM public.%2$I t WHERE t.%3$I = $1::%4$s
+                 ON CONFLICT (entity_type, entity_id) DO UPDATE
+                     SET display_name = EXCLUDED.display_name,
+                         search_vector = EXCLUDED.search_vector,
+                         file_count = EXCLUDED.file_count,
+                         archived_at = NOW(),
+                         archive_run_id = EXCLUDED.archive_run_id',
+                v_search, p_entity_type, v_pk, v_pk_type)
+            USING v_id, p_run_id, p_entity_type::TEXT;
+
+            EXECUTE format('DELETE FROM public.%1$I WHERE %2$I = $1::%3$s',
+                p_entity_type, v_pk, v_pk_type)
+            USING v_id;
+
+            UPDATE metadata.files
+            SET archive_status = 'pending_archive'
+            WHERE entity_type = p_entity_type
+              AND entity_id = v_id
+              AND archive_status IS NULL;
+
+            v_archived := v_archived + 1;
+        EXCEPTION WHEN foreign_key_violation OR restrict_violation THEN
+            v_skipped := v_skipped + 1;
+        END;
+    END LOOP;
+
+    UPDATE metadata.archive_policies
+    SET last_archived_at = NOW()
+    WHERE entity_type = p_entity_type AND v_archived > 0;
+
+    RETURN QUERY SELECT v_archived, v_skipped;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.archive_entity_batch(NAME, BIGINT, INT) IS
+    'Move up to batch_size rows matching the table''s archive policy into archive.<entity_type>, writing a stub and marking attachments pending_archive. p_offset skips rows earlier batches could not move. Returns rows archived and skipped (still referenced). Called by the archive_entities job. Added in v0.85.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.unarchive_entity(p_entity_type NAME, p_entity_id TEXT)
+RETURNS BOOLEAN
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_pk NAME;
+    v_pk_type TEXT;
+    v_columns TEXT;
+    v_count INT;
+BEGIN
+    IF to_regclass(format('archive.%I', p_entity_type)) IS NULL THEN
+        RETURN FALSE;
+    END IF;
+
+    SELECT pk_column, pk_type INTO v_pk, v_pk_type
+    FROM metadata.archive_primary_key(p_entity_type);
+    PERFORM metadata.sync_archive_table(p_entity_type);
+
+    -- Generated columns are recomputed by the hot table
+    SELECT string_agg(quote_ident(a.attname), ', ' ORDER BY a.attnum)
+    INTO v_columns
+    FROM pg_attribute a
+    WHERE a.attrelid = format('public.%I', p_entity_type)::regclass
+      AND a.attnum > 0
+      AND NOT a.attisdropped
+      AND a.attgenerated = '';
+
+    EXECUTE format(
+        'INSERT INTO public.%1$I (%2$s) OVERRIDING SYSTEM VALUE
+         SELECT %2$s FROM archive.%1$I WHERE %3$I = $1::%4$s',
+        p_entity_type, v_columns, v_pk, v_pk_type)
+    USING p_entity_id;
+    GET DIAGNOSTICS v_count = ROW_COUNT;
+
+    IF v_count = 0 THEN
+        RETURN FALSE;
+    END IF;
+
+    EXECUTE format('DELETE FROM archive.%1$I WHERE %2$I = $1::%3$s',
+        p_entity_type, v_pk, v_pk_type)
+    USING p_entity_id;
+
+    DELETE FROM metadata.archived_entities
+    WHERE entity_type = p_entity_type AND entity_id = p_entity_id;
+
+    UPDATE metadata.files
+    SET archive_status = CASE archive_status WHEN 'archived' THEN 'pending_restore' END
+    WHERE entity_type = p_entity_type
+      AND entity_id = p_entity_id
+      AND archive_status IN ('archived', 'pending_archive');
+
+    RETURN TRUE;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.unarchive_entity(NAME, TEXT) IS
+    'Move an archived row back to public.<entity_type> (same primary key), drop its stub and mark its archived attachments pending_restore. Returns false when the row is not archived. Called by the unarchive_entity job. Added in v0.85.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.enqueue_entity_archival()
+RETURNS INT
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_count INT;
+BEGIN
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    SELECT 'archive_entities',
+           jsonb_build_object('entity_type', p.entity_type),
+           'archival', 4, 3, NOW(), 'available'
+    FROM metadata.archive_policies p
+    WHERE p.enabled
+      AND NOT EXISTS (
+          SELECT 1 FROM metadata.river_job j
+          WHERE j.kind = 'archive_entities'
+            AND j.args->>'entity_type' = p.entity_type
+            AND j.state IN ('available', 'scheduled', 'running', 'retryable')
+      );
+    GET DIAGNOSTICS v_count = ROW_COUNT;
+    RETURN v_count;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.enqueue_entity_archival() IS
+    'Enqueue an archive_entities job for each enabled archive policy without one pending. Called daily by the entity_archival maintenance task. Added in v0.85.0.';
+
+
+-- ============================================================================
+-- 7. PUBLIC RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.set_archive_policy(
+    p_entity_type NAME,
+    p_archive_after INTERVAL,
+    p_age_column NAME DEFAULT 'updated_at',
+    p_status_column NAME DEFAULT NULL,
+    p_enabled BOOLEAN DEFAULT TRUE,
+    p_batch_size INT DEFAULT 500
+)
+RETURNS VOID
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_table REGCLASS;
+    v_age_type REGTYPE;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    v_table := to_regclass(format('public.%I', p_entity_type));
+    IF v_table IS NULL OR (SELECT relkind FROM pg_class WHERE oid = v_table) NOT IN ('r', 'p') THEN
+        RAISE EXCEPTION 'Table not found: public.%', p_entity_type;
+    END IF;
+
+    SELECT a.atttypid::regtype INTO v_age_type
+    FROM pg_attribute a
+    WHERE a.attrelid = v_table AND a.attname = p_age_column AND NOT a.attisdropped;
+    IF v_age_type IS NULL OR v_age_type NOT IN ('timestamptz'::regtype, 'timestamp'::regtype, 'date'::regtype) THEN
+        RAISE EXCEPTION 'Column %.% must be a date or timestamp', p_entity_type, p_age_column;
+    END IF;
+
+    IF p_status_column IS NOT NULL AND NOT EXISTS (
+        SELECT 1 FROM pg_attribute a
+        WHERE a.attrelid = v_table AND a.attname = p_status_column AND NOT a.attisdropped
+    ) THEN
+        RAISE EXCEPTION 'Column not found: %.%', p_entity_type, p_status_column;
+    END IF;
+
+    PERFORM metadata.archive_primary_key(p_entity_type);
+
+    INSERT INTO metadata.archive_policies
+        (entity_type, age_column, archive_after, status_column, enabled, batch_size)
+    VALUES (p_entity_type, p_age_column, p_archive_after, p_status_column, p_enabled, p_batch_size)
+    ON CONFLICT (entity_type) DO UPDATE
+        SET age_column = EXCLUDED.age_column,
+            archive_after = EXCLUDED.archive_after,
+            status_column = EXCLUDED.status_column,
+            enabled = EXCLUDED.enabled,
+            batch_size = EXCLUDED.batch_size,
+            updated_at = NOW();
+
+    PERFORM metadata.sync_archive_table(p_entity_type);
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'archive_policy_change',
+        jsonb_build_object(
+            'table_name', p_entity_type,
+            'age_column', p_age_column,
+            'archive_after', p_archive_after::TEXT,
+            'status_column', p_status_column,
+            'enabled', p_enabled,
+            'batch_size', p_batch_size
+        )
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_archive_policy IS
+    'Create or update the archive policy for a table: archive rows whose age_column is older than archive_after (and, with status_column, in a terminal status). Creates archive.<table>. Admin only; logged to admin_audit_log. Added in v0.85.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_archive_policy FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_archive_policy TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.search_archived_entities(
+    p_entity_type NAME,
+    p_query TEXT DEFAULT NULL,
+    p_limit INT DEFAULT 50,
+    p_offset INT DEFAULT 0
+)
+RETURNS TABLE (
+    entity_type NAME,
+    entity_id TEXT,
+    display_name TEXT,
+    file_count INT,
+    archived_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.has_permission(p_entity_type, 'read') THEN
+        RAISE EXCEPTION 'Missing %:read permission', p_entity_type;
+    END IF;
+
+    RETURN QUERY
+    SELECT a.entity_type, a.entity_id, a.display_name, a.file_count, a.archived_at
+    FROM metadata.archived_entities a
+    WHERE a.entity_type = p_entity_type
+      AND (p_query IS NULL OR p_query = ''
+           OR a.search_vector @@ websearch_to_tsquery('english', p_query)
+           OR a.display_name ILIKE '%' || p_query || '%')
+    ORDER BY a.archived_at DESC, a.entity_id
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000)
+    OFFSET GREATEST(p_offset, 0);
+END;
+$$;
+
+COMMENT ON FUNCTION public.search_archived_entities IS
+    'Search a table''s archived records by full text or display name, newest archive first. Requires read permission on the table. Added in v0.85.0.';
+
+REVOKE EXECUTE ON FUNCTION public.search_archived_entities FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.search_archived_entities TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_archived_entity(p_entity_type NAME, p_entity_id TEXT)
+RETURNS JSONB
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_pk NAME;
+    v_pk_type TEXT;
+    v_row JSONB;
+BEGIN
+    IF NOT public.has_permission(p_entity_type, 'read') THEN
+        RAISE EXCEPTION 'Missing %:read permission', p_entity_type;
+    END IF;
+
+    IF to_regclass(format('archive.%I', p_entity_type)) IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT pk_column, pk_type INTO v_pk, v_pk_type
+    FROM metadata.archive_primary_key(p_entity_type);
+
+    EXECUTE format('SELECT to_jsonb(t) - ''civic_os_text_search'' FROM archive.%1$I t WHERE %2$I = $1::%3$s',
+        p_entity_type, v_pk, v_pk_type)
+    INTO v_row
+    USING p_entity_id;
+
+    RETURN v_row;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_archived_entity(NAME, TEXT) IS
+    'An archived row as JSON (with archived_at), or NULL when the row is not archived. Requires read permission on the table. Added in v0.85.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_archived_entity(NAME, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_archived_entity(NAME, TEXT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.request_unarchive(p_entity_type NAME, p_entity_id TEXT)
+RETURNS BIGINT
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_job_id BIGINT;
+BEGIN
+    IF NOT public.has_permission(p_entity_type, 'update') THEN
+        RAISE EXCEPTION 'Missing %:update permission', p_entity_type;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM metadata.archived_entities
+        WHERE entity_type = p_entity_type AND entity_id = p_entity_id
+    ) THEN
+        RAISE EXCEPTION 'Not archived: % %', p_entity_type, p_entity_id;
+    END IF;
+
+    -- The river_job trigger stamps args.audit with the requesting user
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'unarchive_entity',
+        jsonb_build_object('entity_type', p_entity_type, 'entity_id', p_entity_id),
+        'archival', 1, 5, NOW(), 'available'
+    )
+    RETURNING id INTO v_job_id;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'entity_unarchive_requested',
+        jsonb_build_object('table_name', p_entity_type, 'entity_id', p_entity_id, 'job_id', v_job_id)
+    );
+
+    RETURN v_job_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_unarchive(NAME, TEXT) IS
+    'Queue an unarchive_entity job restoring an archived record and its attachments. Requires update permission on the table. Returns the job ID. Added in v0.85.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_unarchive(NAME, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_unarchive(NAME, TEXT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_archive_runs(
+    p_entity_type NAME DEFAULT NULL,
+    p_limit INT DEFAULT 50
+)
+RETURNS SETOF metadata.archive_runs
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.archive_runs r
+    WHERE p_entity_type IS NULL OR r.entity_type = p_entity_type
+    ORDER BY r.started_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_archive_runs IS
+    'Recent archive and unarchive runs, newest first. Admin only. Added in v0.85.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_archive_runs FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_archive_runs TO authenticated;
+
+
+-- ============================================================================
+-- 8. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{archive_policies,archived_entities,archive_runs,files}',
+   '{archive_status,hot_bucket}',
+   'v0-85-0-entity-archival',
+   'Archive closed records to mirror tables and cold storage',
+   'accepted',
+   'Deployments running for years carry every closed permit, request and inspection in their hot tables. List views, search and indexes slow down with rows nobody opens, and their attachments sit in the primary bucket at full storage price.',
+   'Admins set a per-table policy (age column, threshold, optional terminal-status requirement). A daily archive_entities job per policy moves matching rows into archive.<table>, a constraint-free mirror created with LIKE and extended as the hot table gains columns, leaves a searchable stub in metadata.archived_entities and marks the row''s files pending_archive. The worker copies those objects to ARCHIVE_S3_BUCKET (with ARCHIVE_S3_STORAGE_CLASS) and repoints metadata.files.s3_bucket. request_unarchive() queues an unarchive_entity job that moves the row back under the same primary key and restores the files. Every job writes metadata.archive_runs; user requests are also in admin_audit_log.',
+   'Mirror tables keep archived rows queryable with plain SQL and need no partitioning of existing tables, which would have changed their primary keys. Stubs carry the row''s own civic_os_text_search vector, so search over archived records uses the same stemming as live search. Rows still referenced by a foreign key are skipped rather than cascading, so archival never deletes data.',
+   'Only tables with a single-column primary key can be archived. Archival deletes the hot row, so DELETE triggers fire; they can check current_setting(''civic_os.archiving'', true) to tell archival from deletion. Polymorphic rows (notes, notifications, payments) keyed by entity_id stay where they are and reattach on unarchive. Unarchive fails if the hot table gained a NOT NULL column without a default since archival. Objects in a storage class that needs a restore request (Glacier Flexible Retrieval, Deep Archive) cannot be copied back by the worker.');
+
+COMMIT;
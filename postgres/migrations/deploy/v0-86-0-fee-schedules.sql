@@ -0,0 +1,209 @@
+-- Deploy civic_os:v0-86-0-fee-schedules to pg
+-- requires: v0-85-0-entity-archival
+--
+-- v0.86.0 — Processing fee schedules per payment category:
+--   1. payments.fee_schedules: card and ACH rates, min/max fee, refundability
+--      and effective dates, per category (NULL = default for all payments)
+--   2. payments.transactions.fee_category (optional, set by the initiation
+--      RPC) and fee_schedule_id (the schedule the worker applied)
+--   3. public.payment_fee_schedules view and public.set_fee_schedule()
+--   4. Record schema decision
+--
+-- The payment worker resolves a payment's schedule by fee_category, then
+-- entity_type, then the default schedule, and falls back to the
+-- PROCESSING_FEE_* environment variables when no schedule applies.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. FEE SCHEDULES
+-- ============================================================================
+
+CREATE TABLE payments.fee_schedules (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- Matched against transactions.fee_category, then entity_type.
+    -- NULL is the default schedule for payments no other schedule matches.
+    category TEXT,
+    description TEXT,
+
+    -- FALSE charges no processing fee in this category
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+
+    -- Card fee: grossed-up percent + flat, then clamped to min/max
+    percent NUMERIC(5, 3) NOT NULL DEFAULT 0 CHECK (percent >= 0 AND percent < 100),
+    flat_cents INTEGER NOT NULL DEFAULT 0 CHECK (flat_cents >= 0),
+    min_fee_cents INTEGER CHECK (min_fee_cents >= 0),
+    max_fee_cents INTEGER CHECK (max_fee_cents >= 0),
+
+    -- ACH debit fee: grossed-up percent, capped
+    ach_percent NUMERIC(5, 3) NOT NULL DEFAULT 0 CHECK (ach_percent >= 0 AND ach_percent < 100),
+    ach_cap_cents INTEGER CHECK (ach_cap_cents >= 0),
+
+    refundable BOOLEAN NOT NULL DEFAULT FALSE,
+
+    effective_from TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    effective_until TIMESTAMPTZ,
+
+    created_by UUID DEFAULT current_user_id(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_fee_bounds CHECK (
+        min_fee_cents IS NULL OR max_fee_cents IS NULL OR max_fee_cents >= min_fee_cents),
+    CONSTRAINT valid_effective_range CHECK (
+        effective_until IS NULL OR effective_until > effective_from)
+);
+
+CREATE INDEX idx_fee_schedules_category
+    ON payments.fee_schedules(category, effective_from DESC);
+
+COMMENT ON TABLE payments.fee_schedules IS
+    'Processing fee rules per payment category, with effective dates. Where schedules for a category overlap, the one that took effect last wins. Managed with set_fee_schedule(); cached by the payment worker for FEE_SCHEDULE_CACHE_SECONDS. Added in v0.86.0.';
+COMMENT ON COLUMN payments.fee_schedules.category IS
+    'Payment category matched against transactions.fee_category, then transactions.entity_type (e.g. ''park_reservations''). NULL = default schedule.';
+COMMENT ON COLUMN payments.fee_schedules.min_fee_cents IS
+    'Lower bound on the computed fee (card and ACH). NULL = none.';
+COMMENT ON COLUMN payments.fee_schedules.max_fee_cents IS
+    'Upper bound on the computed fee (card and ACH). NULL = none.';
+
+ALTER TABLE payments.fee_schedules ENABLE ROW LEVEL SECURITY;
+-- No policies: read through public.payment_fee_schedules, written by set_fee_schedule()
+
+
+-- ============================================================================
+-- 2. TRANSACTION COLUMNS
+-- ============================================================================
+
+ALTER TABLE payments.transactions
+    ADD COLUMN fee_category TEXT,
+    ADD COLUMN fee_schedule_id BIGINT REFERENCES payments.fee_schedules(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN payments.transactions.fee_category IS
+    'Fee schedule category for this payment. Set by the payment initiation RPC before it returns; NULL uses the schedule for entity_type. Added in v0.86.0.';
+COMMENT ON COLUMN payments.transactions.fee_schedule_id IS
+    'Fee schedule the payment worker applied. NULL when no schedule matched and PROCESSING_FEE_* applied. Added in v0.86.0.';
+
+
+-- ============================================================================
+-- 3. PUBLIC VIEW AND RPC
+-- ============================================================================
+
+-- Fee rates are shown at checkout, so every signed-in user can read them
+CREATE OR REPLACE VIEW public.payment_fee_schedules AS
+SELECT
+    s.id,
+    s.category,
+    s.description,
+    s.enabled,
+    s.percent,
+    s.flat_cents,
+    s.min_fee_cents,
+    s.max_fee_cents,
+    s.ach_percent,
+    s.ach_cap_cents,
+    s.refundable,
+    s.effective_from,
+    s.effective_until,
+    (s.effective_from <= NOW() AND (s.effective_until IS NULL OR s.effective_until > NOW())) AS is_current,
+    s.created_at
+FROM payments.fee_schedules s;
+
+COMMENT ON VIEW public.payment_fee_schedules IS
+    'Processing fee schedules with is_current for the ones in effect now. Added in v0.86.0.';
+
+GRANT SELECT ON public.payment_fee_schedules TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.set_fee_schedule(
+    p_category TEXT,
+    p_percent NUMERIC,
+    p_flat_cents INTEGER DEFAULT 0,
+    p_refundable BOOLEAN DEFAULT FALSE,
+    p_min_fee_cents INTEGER DEFAULT NULL,
+    p_max_fee_cents INTEGER DEFAULT NULL,
+    p_ach_percent NUMERIC DEFAULT 0,
+    p_ach_cap_cents INTEGER DEFAULT NULL,
+    p_enabled BOOLEAN DEFAULT TRUE,
+    p_effective_from TIMESTAMPTZ DEFAULT NOW(),
+    p_description TEXT DEFAULT NULL
+)
+RETURNS BIGINT
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_schedule_id BIGINT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    -- The new schedule supersedes the category's schedule in effect at
+    -- p_effective_from; schedules starting later are left alone
+    UPDATE payments.fee_schedules
+    SET effective_until = p_effective_from, updated_at = NOW()
+    WHERE category IS NOT DISTINCT FROM NULLIF(p_category, '')
+      AND effective_from < p_effective_from
+      AND (effective_until IS NULL OR effective_until > p_effective_from);
+
+    INSERT INTO payments.fee_schedules (
+        category, description, enabled, percent, flat_cents, min_fee_cents, max_fee_cents,
+        ach_percent, ach_cap_cents, refundable, effective_from
+    ) VALUES (
+        NULLIF(p_category, ''), p_description, p_enabled, p_percent, p_flat_cents, p_min_fee_cents, p_max_fee_cents,
+        p_ach_percent, p_ach_cap_cents, p_refundable, p_effective_from
+    )
+    RETURNING id INTO v_schedule_id;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'fee_schedule_change',
+        jsonb_build_object(
+            'schedule_id', v_schedule_id,
+            'category', NULLIF(p_category, ''),
+            'enabled', p_enabled,
+            'percent', p_percent,
+            'flat_cents', p_flat_cents,
+            'min_fee_cents', p_min_fee_cents,
+            'max_fee_cents', p_max_fee_cents,
+            'ach_percent', p_ach_percent,
+            'ach_cap_cents', p_ach_cap_cents,
+            'refundable', p_refundable,
+            'effective_from', p_effective_from
+        )
+    );
+
+    RETURN v_schedule_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_fee_schedule IS
+    'Add a fee schedule for a category (NULL or '''' = default) taking effect at p_effective_from, ending the schedule it replaces. Admin only; logged to admin_audit_log. Added in v0.86.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_fee_schedule FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_fee_schedule TO authenticated;
+
+
+-- ============================================================================
+-- 4. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{fee_schedules,transactions}',
+   '{fee_category,fee_schedule_id}',
+   'v0-86-0-fee-schedules',
+   'Processing fee schedules per payment category',
+   'accepted',
+   'Processing fees came from PROCESSING_FEE_* environment variables, one policy for the whole deployment. A city that passes card fees on for permit payments but absorbs them for park reservations could not express that, and every rate change needed a redeploy of the payment worker.',
+   'payments.fee_schedules holds card percent and flat fee, min/max fee, ACH percent and cap, refundability and effective dates per category. The payment worker resolves a payment''s schedule by transactions.fee_category, then entity_type, then the default (NULL category) schedule, caching schedules for FEE_SCHEDULE_CACHE_SECONDS, and records the schedule in transactions.fee_schedule_id next to the rates it already stored. set_fee_schedule() adds a schedule and ends the one it replaces.',
+   'Keying by entity type needs no integrator changes for the common case (one fee policy per payable table); fee_category covers tables that take several kinds of payment. Effective dates let finance schedule a rate change ahead of a processor''s price change and keep the history. Keeping the environment variables as the fallback means existing deployments behave the same until a schedule is added.',
+   'A schedule change reaches the worker within the cache period, so payments created in that window may use the old rates. Rates already applied to a payment are never recomputed. Subscriptions still carry no processing fee.');
+
+COMMIT;
@@ -0,0 +1,290 @@
+-- Deploy civic_os:v0-87-0-connected-accounts to pg
+-- requires: v0-86-0-fee-schedules
+--
+-- v0.87.0 — Stripe Connect destination charges per payment category:
+--   1. payments.connected_accounts: Stripe connected accounts (acct_...) a
+--      department is paid out to, with capabilities from account.updated
+--   2. payments.payout_routes: payment category → connected account
+--   3. payments.transactions.connected_account_id and transfer columns
+--   4. payments.payouts: payouts to connected accounts, from payout.* webhooks
+--   5. Public views and RPCs (admin only)
+--   6. Record schema decision
+--
+-- The payment worker resolves a payment's route like its fee schedule
+-- (fee_category, then entity_type, then the default route) and creates a
+-- destination charge; payments with no route settle to the platform account
+-- as before.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. CONNECTED ACCOUNTS
+-- ============================================================================
+
+CREATE TABLE payments.connected_accounts (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+
+    -- Stripe connected account ID
+    provider_account_id TEXT NOT NULL UNIQUE CHECK (provider_account_id LIKE 'acct\_%'),
+
+    -- Updated from account.updated webhooks (NULL until the first one arrives)
+    charges_enabled BOOLEAN,
+    payouts_enabled BOOLEAN,
+
+    created_by UUID DEFAULT current_user_id(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE payments.connected_accounts IS
+    'Stripe Connect accounts that receive destination charges (e.g. parks department, clerk''s office). Managed with set_connected_account(). Added in v0.87.0.';
+COMMENT ON COLUMN payments.connected_accounts.charges_enabled IS
+    'From the latest account.updated webhook. Stripe rejects destination charges to an account without the transfers capability.';
+
+ALTER TABLE payments.connected_accounts ENABLE ROW LEVEL SECURITY;
+-- No policies: read through public.payment_connected_accounts
+
+
+-- ============================================================================
+-- 2. PAYOUT ROUTES
+-- ============================================================================
+
+CREATE TABLE payments.payout_routes (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- Matched against transactions.fee_category, then entity_type, like
+    -- payments.fee_schedules.category. NULL is the default route.
+    category TEXT,
+    connected_account_id BIGINT NOT NULL REFERENCES payments.connected_accounts(id) ON DELETE CASCADE,
+
+    created_by UUID DEFAULT current_user_id(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One route per category, including a single default
+CREATE UNIQUE INDEX idx_payout_routes_category
+    ON payments.payout_routes(COALESCE(category, ''));
+
+COMMENT ON TABLE payments.payout_routes IS
+    'Routes a payment category to the connected account its payments are paid out to. Categories without a route (and no default) settle to the platform account. Managed with set_payout_route(). Added in v0.87.0.';
+
+ALTER TABLE payments.payout_routes ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 3. TRANSACTION COLUMNS
+-- ============================================================================
+
+ALTER TABLE payments.transactions
+    ADD COLUMN connected_account_id BIGINT REFERENCES payments.connected_accounts(id) ON DELETE RESTRICT,
+    ADD COLUMN provider_transfer_id TEXT,
+    ADD COLUMN transfer_reversed_cents BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_transactions_connected_account
+    ON payments.transactions(connected_account_id)
+    WHERE connected_account_id IS NOT NULL;
+
+COMMENT ON COLUMN payments.transactions.connected_account_id IS
+    'Connected account the payment was a destination charge for, set by the payment worker from payout_routes. NULL = platform account. Added in v0.87.0.';
+COMMENT ON COLUMN payments.transactions.provider_transfer_id IS
+    'Transfer (tr_...) Stripe created to the connected account, from transfer.* webhooks. Added in v0.87.0.';
+COMMENT ON COLUMN payments.transactions.transfer_reversed_cents IS
+    'Amount of the transfer pulled back from the connected account, by refunds. Added in v0.87.0.';
+
+
+-- ============================================================================
+-- 4. PAYOUTS
+-- ============================================================================
+
+CREATE TABLE payments.payouts (
+    id BIGSERIAL PRIMARY KEY,
+    connected_account_id BIGINT REFERENCES payments.connected_accounts(id) ON DELETE SET NULL,
+    provider_account_id TEXT NOT NULL,
+    provider_payout_id TEXT NOT NULL UNIQUE,
+    amount_cents BIGINT NOT NULL,
+    currency TEXT NOT NULL,
+    status TEXT NOT NULL,  -- Stripe payout status: pending, in_transit, paid, failed, canceled
+    arrival_date TIMESTAMPTZ,
+    failure_message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_payouts_account
+    ON payments.payouts(connected_account_id, created_at DESC);
+
+COMMENT ON TABLE payments.payouts IS
+    'Payouts from connected accounts to their bank accounts, recorded from payout.* webhooks on the Connect endpoint. Added in v0.87.0.';
+
+ALTER TABLE payments.payouts ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 5. PUBLIC VIEWS AND RPCs
+-- ============================================================================
+
+CREATE OR REPLACE VIEW public.payment_connected_accounts AS
+SELECT
+    a.id,
+    a.name,
+    a.description,
+    a.provider_account_id,
+    a.charges_enabled,
+    a.payouts_enabled,
+    COALESCE(
+        (SELECT array_agg(COALESCE(r.category, '(default)') ORDER BY r.category NULLS FIRST)
+         FROM payments.payout_routes r
+         WHERE r.connected_account_id = a.id),
+        '{}'
+    ) AS categories,
+    a.created_at,
+    a.updated_at
+FROM payments.connected_accounts a
+WHERE public.is_admin();  -- Admin-only
+
+COMMENT ON VIEW public.payment_connected_accounts IS
+    'Connected accounts with the payment categories routed to them. Admin only. Added in v0.87.0.';
+
+GRANT SELECT ON public.payment_connected_accounts TO authenticated;
+
+
+CREATE OR REPLACE VIEW public.payment_payouts AS
+SELECT
+    p.id,
+    p.connected_account_id,
+    a.name AS connected_account_name,
+    p.provider_account_id,
+    p.provider_payout_id,
+    p.amount_cents,
+    p.currency,
+    p.status,
+    p.arrival_date,
+    p.failure_message,
+    p.created_at,
+    p.updated_at
+FROM payments.payouts p
+LEFT JOIN payments.connected_accounts a ON a.id = p.connected_account_id
+WHERE public.is_admin();  -- Admin-only
+
+COMMENT ON VIEW public.payment_payouts IS
+    'Payouts from connected accounts to their banks. Admin only. Added in v0.87.0.';
+
+GRANT SELECT ON public.payment_payouts TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.set_connected_account(
+    p_name TEXT,
+    p_provider_account_id TEXT,
+    p_description TEXT DEFAULT NULL
+)
+RETURNS BIGINT
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_account_id BIGINT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    INSERT INTO payments.connected_accounts (name, provider_account_id, description)
+    VALUES (p_name, p_provider_account_id, p_description)
+    ON CONFLICT (name) DO UPDATE
+        SET provider_account_id = EXCLUDED.provider_account_id,
+            description = EXCLUDED.description,
+            updated_at = NOW()
+    RETURNING id INTO v_account_id;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'connected_account_change',
+        jsonb_build_object(
+            'connected_account_id', v_account_id,
+            'name', p_name,
+            'provider_account_id', p_provider_account_id
+        )
+    );
+
+    RETURN v_account_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_connected_account IS
+    'Add a Stripe connected account, or update the one with this name. Admin only; logged to admin_audit_log. Added in v0.87.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_connected_account FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_connected_account TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.set_payout_route(
+    p_category TEXT,
+    p_connected_account_id BIGINT
+)
+RETURNS VOID
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    IF p_connected_account_id IS NULL THEN
+        DELETE FROM payments.payout_routes
+        WHERE COALESCE(category, '') = COALESCE(p_category, '');
+    ELSE
+        INSERT INTO payments.payout_routes (category, connected_account_id)
+        VALUES (NULLIF(p_category, ''), p_connected_account_id)
+        ON CONFLICT (COALESCE(category, '')) DO UPDATE
+            SET connected_account_id = EXCLUDED.connected_account_id,
+                updated_at = NOW();
+    END IF;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'payout_route_change',
+        jsonb_build_object(
+            'category', NULLIF(p_category, ''),
+            'connected_account_id', p_connected_account_id
+        )
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_payout_route IS
+    'Route a payment category (NULL or '''' = default) to a connected account; NULL account removes the route. Applies to payments created afterwards. Admin only; logged to admin_audit_log. Added in v0.87.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_payout_route FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_payout_route TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{connected_accounts,payout_routes,payouts,transactions}',
+   '{connected_account_id,provider_transfer_id,transfer_reversed_cents}',
+   'v0-87-0-connected-accounts',
+   'Stripe Connect destination charges per payment category',
+   'accepted',
+   'Every payment settled to the one Stripe account configured for the install. Cities where departments keep separate bank accounts (parks department, clerk''s office) had to run separate installs or move money by hand.',
+   'Connected accounts and payout routes are configured per payment category, resolved like fee schedules (fee_category, then entity_type, then a default route). The payment worker creates Stripe destination charges with transfer_data.destination, takes the processing fee as the application fee and tags the transfer with the payment ID as transfer_group. Refunds of routed payments reverse the transfer. transfer.* webhooks record the transfer on the transaction; payout.* and account.updated webhooks from the Connect endpoint fill payments.payouts and account capabilities.',
+   'Destination charges keep the platform as merchant of record, so checkout, refunds, disputes and the existing webhook handling are unchanged; only the funds move. Using the processing fee as the application fee leaves the platform whole for the Stripe fees it pays. Resolving routes the same way as fee schedules keeps one notion of payment category.',
+   'Only Stripe supports routing; Square and PayPal payments fail if their category has a route. Subscriptions are not routed. Route changes apply to payments created afterwards. Connect webhooks are signed with a separate secret (STRIPE_CONNECT_WEBHOOK_SECRET), and the Stripe event backfill does not list connected-account events.');
+
+COMMIT;
@@ -0,0 +1,101 @@
+-- Deploy civic_os:v0-88-0-job-trace-context to pg
+-- requires: v0-87-0-connected-accounts
+--
+-- v0.88.0 — Trace context for River jobs enqueued from SQL:
+--   1. metadata.file_upload_requests.traceparent: the presign job's span, so
+--      the file's thumbnail job joins the same trace
+--   2. metadata.stamp_job_traceparent(): BEFORE INSERT trigger on river_job
+--      that copies a W3C traceparent into the job's metadata
+--   3. Record schema decision
+--
+-- Workers start each job's span as a child of metadata->>'traceparent'.
+-- Jobs inserted from Go carry it already (the workers' insert middleware);
+-- this covers the triggers and RPCs that insert jobs directly.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. UPLOAD REQUEST TRACE CONTEXT
+-- ============================================================================
+
+ALTER TABLE metadata.file_upload_requests ADD COLUMN traceparent TEXT;
+
+COMMENT ON COLUMN metadata.file_upload_requests.traceparent IS
+    'W3C traceparent of the s3_presign job that signed this upload. Jobs later enqueued for the file (thumbnails) continue its trace. Added in v0.88.0.';
+
+-- The trigger looks requests up by file_id for every job with a file_id arg
+CREATE INDEX idx_upload_requests_file_id ON metadata.file_upload_requests(file_id)
+    WHERE file_id IS NOT NULL;
+
+
+-- ============================================================================
+-- 2. STAMP TRACEPARENT ON JOB INSERT
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.stamp_job_traceparent()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_traceparent TEXT;
+BEGIN
+    -- Inserted from Go with a trace context already
+    IF NEW.metadata ? 'traceparent' THEN
+        RETURN NEW;
+    END IF;
+
+    -- Traceparent header of the PostgREST request that enqueued the job
+    BEGIN
+        v_traceparent := NULLIF(current_setting('request.headers', true), '')::JSON->>'traceparent';
+    EXCEPTION WHEN OTHERS THEN
+        v_traceparent := NULL;
+    END;
+
+    -- Otherwise continue the trace of the upload that created the file
+    IF v_traceparent IS NULL AND NEW.args ? 'file_id' THEN
+        SELECT r.traceparent INTO v_traceparent
+        FROM metadata.file_upload_requests r
+        WHERE r.file_id::TEXT = NEW.args->>'file_id'
+          AND r.traceparent IS NOT NULL
+        ORDER BY r.created_at DESC
+        LIMIT 1;
+    END IF;
+
+    -- version-traceid-spanid-flags; anything else is ignored
+    IF v_traceparent ~ '^00-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$' THEN
+        NEW.metadata := NEW.metadata || jsonb_build_object('traceparent', v_traceparent);
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.stamp_job_traceparent IS
+    'BEFORE INSERT on river_job: copies the request''s W3C traceparent header (or the file upload''s, for jobs with a file_id) into metadata so workers continue the trace. Added in v0.88.0.';
+
+CREATE TRIGGER stamp_job_traceparent
+    BEFORE INSERT ON metadata.river_job
+    FOR EACH ROW
+    EXECUTE FUNCTION metadata.stamp_job_traceparent();
+
+
+-- ============================================================================
+-- 3. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{river_job,file_upload_requests}',
+   '{metadata,traceparent}',
+   'v0-88-0-job-trace-context',
+   'Propagate trace context into River jobs enqueued from SQL',
+   'accepted',
+   'The workers export OpenTelemetry spans per job, but most jobs are inserted by triggers and RPCs, so each job started a new trace. A file upload (presign job, browser upload, thumbnail job) showed up as unrelated traces.',
+   'A BEFORE INSERT trigger on metadata.river_job copies a W3C traceparent into the job''s metadata: the PostgREST request''s traceparent header if there is one, otherwise for jobs with a file_id the traceparent the presign job saved on its upload request. Workers start the job span as a child of that context.',
+   'River already stores free-form job metadata, so no worker API changes are needed and jobs inserted by older code simply start new traces. Keying the upload link on file_id covers thumbnails without changing the file triggers.',
+   'The trigger runs for every job insert; it is a JSON lookup unless the job has a file_id, which adds one indexed lookup. Header values that are not a valid version-00 traceparent are ignored.');
+
+COMMIT;
@@ -0,0 +1,531 @@
+-- Deploy civic_os:v0-89-0-queue-controls to pg
+-- requires: v0-88-0-job-trace-context
+--
+-- v0.89.0 — Pause controls and circuit breakers for River queues:
+--   1. metadata.queue_controls: who paused a queue and why, auto-resume time,
+--      and per-queue circuit breaker settings and state
+--   2. metadata.set_river_queue_paused() internal helper (pause/resume +
+--      River control notification)
+--   3. public.get_queue_controls() admin RPC
+--   4. public.pause_queue() / public.resume_queue() admin RPCs
+--   5. public.update_queue_circuit_breaker() admin RPC
+--   6. metadata.evaluate_queue_circuit_breakers() (run by the worker's
+--      queue_circuit_breakers maintenance task)
+--   7. Record schema decision
+--
+-- Pausing uses River's own mechanism: metadata.river_queue.paused_at plus a
+-- pause/resume message on the <schema>.river_control channel. Every River
+-- client (consolidated worker and payment worker, all replicas) stops fetching
+-- from a paused queue within a second and keeps it paused across restarts.
+-- Running jobs finish; queued jobs wait.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. QUEUE CONTROLS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.queue_controls (
+    queue_name VARCHAR(100) PRIMARY KEY,
+
+    -- Pause state set through these RPCs (river_queue.paused_at is authoritative)
+    paused_by VARCHAR(20) CHECK (paused_by IN ('admin', 'circuit_breaker')),
+    pause_reason TEXT,
+    resume_at TIMESTAMPTZ,
+    last_resumed_at TIMESTAMPTZ,
+
+    -- Circuit breaker: pause when failed attempts / all attempts over the
+    -- window reach error_rate, with at least min_attempts; resume after cooldown
+    breaker_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    breaker_error_rate NUMERIC(4,3) NOT NULL DEFAULT 0.5
+        CHECK (breaker_error_rate > 0 AND breaker_error_rate <= 1),
+    breaker_min_attempts INT NOT NULL DEFAULT 20 CHECK (breaker_min_attempts > 0),
+    breaker_window_seconds INT NOT NULL DEFAULT 300 CHECK (breaker_window_seconds > 0),
+    breaker_cooldown_seconds INT NOT NULL DEFAULT 600 CHECK (breaker_cooldown_seconds > 0),
+
+    -- Circuit breaker state
+    last_error_rate NUMERIC(4,3),
+    last_attempts INT,
+    last_evaluated_at TIMESTAMPTZ,
+    last_tripped_at TIMESTAMPTZ,
+    trip_count INT NOT NULL DEFAULT 0,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER set_updated_at_trigger
+    BEFORE UPDATE ON metadata.queue_controls
+    FOR EACH ROW
+    EXECUTE FUNCTION public.set_updated_at();
+
+-- Breaker evaluation counts recent attempts per queue
+CREATE INDEX idx_river_job_queue_attempted_at ON metadata.river_job(queue, attempted_at)
+    WHERE attempted_at IS NOT NULL;
+
+COMMENT ON TABLE metadata.queue_controls IS
+    'Pause reason, auto-resume and circuit breaker settings per River queue. Rows are created on first pause or breaker change. Whether a queue is paused is metadata.river_queue.paused_at. Added in v0.89.0.';
+COMMENT ON COLUMN metadata.queue_controls.paused_by IS
+    'admin (pause_queue) or circuit_breaker; NULL when the queue was not paused through these controls.';
+COMMENT ON COLUMN metadata.queue_controls.resume_at IS
+    'When the queue_circuit_breakers maintenance task resumes the queue: the end of a breaker cooldown or a timed admin pause.';
+COMMENT ON COLUMN metadata.queue_controls.last_resumed_at IS
+    'The breaker only counts attempts after this, so a resumed queue needs min_attempts new attempts before it can trip again.';
+
+
+-- ============================================================================
+-- 2. PAUSE/RESUME HELPER
+-- ============================================================================
+-- Same effect as River's Client.QueuePause/QueueResume. The row is created if
+-- no client has reported the queue yet; River keeps paused_at when a client
+-- later reports it. Returns whether the state changed.
+
+CREATE OR REPLACE FUNCTION metadata.set_river_queue_paused(p_queue VARCHAR(100), p_paused BOOLEAN)
+RETURNS BOOLEAN
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_was_paused BOOLEAN;
+BEGIN
+    SELECT paused_at IS NOT NULL INTO v_was_paused
+    FROM metadata.river_queue
+    WHERE name = p_queue
+    FOR UPDATE;
+
+    IF FOUND AND v_was_paused = p_paused THEN
+        RETURN FALSE;
+    END IF;
+
+    IF FOUND THEN
+        UPDATE metadata.river_queue
+        SET paused_at = CASE WHEN p_paused THEN NOW() END, updated_at = NOW()
+        WHERE name = p_queue;
+    ELSIF p_paused THEN
+        INSERT INTO metadata.river_queue (name, paused_at, updated_at)
+        VALUES (p_queue, NOW(), NOW());
+    ELSE
+        RETURN FALSE;
+    END IF;
+
+    PERFORM pg_notify('metadata.river_control', jsonb_build_object(
+        'action', CASE WHEN p_paused THEN 'pause' ELSE 'resume' END,
+        'queue', p_queue
+    )::TEXT);
+    RETURN TRUE;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.set_river_queue_paused(VARCHAR, BOOLEAN) IS
+    'Internal. Pauses or resumes a River queue for all clients (river_queue.paused_at + river_control notification). Added in v0.89.0.';
+
+REVOKE EXECUTE ON FUNCTION metadata.set_river_queue_paused(VARCHAR, BOOLEAN) FROM PUBLIC;
+
+
+-- ============================================================================
+-- 3. LIST RPC
+-- ============================================================================
+-- Lists every queue a River client has reported plus any with a controls row
+
+CREATE OR REPLACE FUNCTION public.get_queue_controls()
+RETURNS TABLE (
+    queue_name VARCHAR(100),
+    paused_at TIMESTAMPTZ,
+    paused_by VARCHAR(20),
+    pause_reason TEXT,
+    resume_at TIMESTAMPTZ,
+    breaker_enabled BOOLEAN,
+    breaker_error_rate NUMERIC(4,3),
+    breaker_min_attempts INT,
+    breaker_window_seconds INT,
+    breaker_cooldown_seconds INT,
+    last_error_rate NUMERIC(4,3),
+    last_attempts INT,
+    last_evaluated_at TIMESTAMPTZ,
+    last_tripped_at TIMESTAMPTZ,
+    trip_count INT,
+    available_jobs BIGINT,
+    running_jobs BIGINT
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can view queue controls';
+    END IF;
+
+    RETURN QUERY
+    WITH queues AS (
+        SELECT rq.name::VARCHAR(100) AS name FROM metadata.river_queue rq
+        UNION
+        SELECT qc.queue_name FROM metadata.queue_controls qc
+    ),
+    depth AS (
+        SELECT j.queue,
+               COUNT(*) FILTER (WHERE j.state IN ('available', 'retryable', 'scheduled')) AS available,
+               COUNT(*) FILTER (WHERE j.state = 'running') AS running
+        FROM metadata.river_job j
+        WHERE j.state IN ('available', 'retryable', 'scheduled', 'running')
+        GROUP BY j.queue
+    )
+    SELECT q.name, rq.paused_at,
+           CASE WHEN rq.paused_at IS NOT NULL THEN qc.paused_by END,
+           CASE WHEN rq.paused_at IS NOT NULL THEN qc.pause_reason END,
+           CASE WHEN rq.paused_at IS NOT NULL THEN qc.resume_at END,
+           COALESCE(qc.breaker_enabled, FALSE),
+           COALESCE(qc.breaker_error_rate, 0.5),
+           COALESCE(qc.breaker_min_attempts, 20),
+           COALESCE(qc.breaker_window_seconds, 300),
+           COALESCE(qc.breaker_cooldown_seconds, 600),
+           qc.last_error_rate, qc.last_attempts, qc.last_evaluated_at, qc.last_tripped_at,
+           COALESCE(qc.trip_count, 0),
+           COALESCE(d.available, 0), COALESCE(d.running, 0)
+    FROM queues q
+    LEFT JOIN metadata.river_queue rq ON rq.name = q.name
+    LEFT JOIN metadata.queue_controls qc ON qc.queue_name = q.name
+    LEFT JOIN depth d ON d.queue = q.name
+    ORDER BY q.name;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_queue_controls() IS
+    'Admin-only. Lists River queues with pause state, circuit breaker settings and queued/running job counts. Added in v0.89.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_queue_controls() FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_queue_controls() TO authenticated;
+
+
+-- ============================================================================
+-- 4. PAUSE / RESUME RPCS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.pause_queue(
+    p_queue VARCHAR(100),
+    p_reason TEXT DEFAULT NULL,
+    p_resume_after_minutes INT DEFAULT NULL
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_resume_at TIMESTAMPTZ;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can pause queues';
+    END IF;
+
+    IF p_queue IS NULL OR btrim(p_queue) = '' THEN
+        RAISE EXCEPTION 'Queue name is required';
+    END IF;
+    IF p_resume_after_minutes IS NOT NULL AND p_resume_after_minutes <= 0 THEN
+        RAISE EXCEPTION 'Resume delay must be positive';
+    END IF;
+
+    v_resume_at := NOW() + make_interval(mins => p_resume_after_minutes);
+
+    PERFORM metadata.set_river_queue_paused(p_queue, TRUE);
+
+    -- An admin pause replaces a breaker pause, so the cooldown no longer resumes it
+    INSERT INTO metadata.queue_controls (queue_name, paused_by, pause_reason, resume_at)
+    VALUES (p_queue, 'admin', NULLIF(btrim(p_reason), ''), v_resume_at)
+    ON CONFLICT (queue_name) DO UPDATE
+    SET paused_by = 'admin',
+        pause_reason = EXCLUDED.pause_reason,
+        resume_at = EXCLUDED.resume_at;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'queue_pause',
+        jsonb_build_object('queue', p_queue, 'reason', NULLIF(btrim(p_reason), ''), 'resume_at', v_resume_at)
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'queue', p_queue,
+        'resume_at', v_resume_at,
+        'message', CASE
+            WHEN v_resume_at IS NULL THEN format('Queue %s paused', p_queue)
+            ELSE format('Queue %s paused until %s', p_queue, to_char(v_resume_at, 'YYYY-MM-DD HH24:MI TZ'))
+        END
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.pause_queue(VARCHAR, TEXT, INT) IS
+    'Admin-only. Pauses a River queue on every worker: running jobs finish, queued jobs wait. With p_resume_after_minutes the queue resumes automatically. Added in v0.89.0.';
+
+REVOKE EXECUTE ON FUNCTION public.pause_queue(VARCHAR, TEXT, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.pause_queue(VARCHAR, TEXT, INT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.resume_queue(p_queue VARCHAR(100))
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_changed BOOLEAN;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can resume queues';
+    END IF;
+
+    v_changed := metadata.set_river_queue_paused(p_queue, FALSE);
+
+    UPDATE metadata.queue_controls
+    SET paused_by = NULL, pause_reason = NULL, resume_at = NULL, last_resumed_at = NOW()
+    WHERE queue_name = p_queue;
+
+    IF NOT v_changed THEN
+        RETURN jsonb_build_object(
+            'success', false,
+            'message', format('Queue %s is not paused', p_queue)
+        );
+    END IF;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'queue_resume',
+        jsonb_build_object('queue', p_queue)
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'queue', p_queue,
+        'message', format('Queue %s resumed', p_queue)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.resume_queue(VARCHAR) IS
+    'Admin-only. Resumes a paused River queue, whether paused by an admin or the circuit breaker. Added in v0.89.0.';
+
+REVOKE EXECUTE ON FUNCTION public.resume_queue(VARCHAR) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.resume_queue(VARCHAR) TO authenticated;
+
+
+-- ============================================================================
+-- 5. CIRCUIT BREAKER SETTINGS RPC
+-- ============================================================================
+-- NULL arguments leave the current value (or the default for a new row)
+
+CREATE OR REPLACE FUNCTION public.update_queue_circuit_breaker(
+    p_queue VARCHAR(100),
+    p_enabled BOOLEAN DEFAULT NULL,
+    p_error_rate NUMERIC DEFAULT NULL,
+    p_min_attempts INT DEFAULT NULL,
+    p_window_seconds INT DEFAULT NULL,
+    p_cooldown_seconds INT DEFAULT NULL
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_control metadata.queue_controls%ROWTYPE;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can change circuit breakers';
+    END IF;
+
+    IF p_queue IS NULL OR btrim(p_queue) = '' THEN
+        RAISE EXCEPTION 'Queue name is required';
+    END IF;
+    IF p_error_rate IS NOT NULL AND (p_error_rate <= 0 OR p_error_rate > 1) THEN
+        RAISE EXCEPTION 'Error rate must be greater than 0 and at most 1';
+    END IF;
+    IF p_min_attempts IS NOT NULL AND p_min_attempts <= 0 THEN
+        RAISE EXCEPTION 'Minimum attempts must be positive';
+    END IF;
+    IF p_window_seconds IS NOT NULL AND p_window_seconds <= 0 THEN
+        RAISE EXCEPTION 'Window must be positive';
+    END IF;
+    IF p_cooldown_seconds IS NOT NULL AND p_cooldown_seconds <= 0 THEN
+        RAISE EXCEPTION 'Cooldown must be positive';
+    END IF;
+
+    INSERT INTO metadata.queue_controls (queue_name)
+    VALUES (p_queue)
+    ON CONFLICT (queue_name) DO NOTHING;
+
+    UPDATE metadata.queue_controls qc
+    SET
+        breaker_enabled = COALESCE(p_enabled, qc.breaker_enabled),
+        breaker_error_rate = COALESCE(p_error_rate, qc.breaker_error_rate),
+        breaker_min_attempts = COALESCE(p_min_attempts, qc.breaker_min_attempts),
+        breaker_window_seconds = COALESCE(p_window_seconds, qc.breaker_window_seconds),
+        breaker_cooldown_seconds = COALESCE(p_cooldown_seconds, qc.breaker_cooldown_seconds)
+    WHERE qc.queue_name = p_queue
+    RETURNING * INTO v_control;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'queue_circuit_breaker_change',
+        jsonb_build_object(
+            'queue', p_queue,
+            'enabled', v_control.breaker_enabled,
+            'error_rate', v_control.breaker_error_rate,
+            'min_attempts', v_control.breaker_min_attempts,
+            'window_seconds', v_control.breaker_window_seconds,
+            'cooldown_seconds', v_control.breaker_cooldown_seconds
+        )
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'queue', v_control.queue_name,
+        'enabled', v_control.breaker_enabled,
+        'error_rate', v_control.breaker_error_rate,
+        'min_attempts', v_control.breaker_min_attempts,
+        'window_seconds', v_control.breaker_window_seconds,
+        'cooldown_seconds', v_control.breaker_cooldown_seconds
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.update_queue_circuit_breaker IS
+    'Admin-only. Enables/disables a queue''s circuit breaker or changes its error rate threshold, minimum attempts, window and cooldown; NULL arguments keep the current value. Added in v0.89.0.';
+
+REVOKE EXECUTE ON FUNCTION public.update_queue_circuit_breaker FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.update_queue_circuit_breaker TO authenticated;
+
+
+-- ============================================================================
+-- 6. CIRCUIT BREAKER EVALUATION
+-- ============================================================================
+-- Called every minute by the worker's queue_circuit_breakers maintenance task
+-- (claimed by one replica at a time). First resumes queues whose resume_at has
+-- passed, then trips enabled breakers on running queues.
+--
+-- An attempt is a failed attempt (an entry in river_job.errors) or a
+-- completion in the window. Snoozes and cancellations are neither. Counting
+-- starts at the last resume, so a queue coming out of cooldown runs until it
+-- has min_attempts new attempts (half-open) before it can trip again.
+
+CREATE OR REPLACE FUNCTION metadata.evaluate_queue_circuit_breakers()
+RETURNS TABLE (queue_name VARCHAR(100), action TEXT, error_rate NUMERIC(4,3), attempts INT)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_control metadata.queue_controls%ROWTYPE;
+    v_window_start TIMESTAMPTZ;
+    v_failures INT;
+    v_completions INT;
+    v_rate NUMERIC(4,3);
+BEGIN
+    -- 1. Timed pauses and breaker cooldowns that have ended
+    FOR v_control IN
+        SELECT * FROM metadata.queue_controls qc
+        WHERE qc.resume_at <= NOW()
+        FOR UPDATE
+    LOOP
+        PERFORM metadata.set_river_queue_paused(v_control.queue_name, FALSE);
+        UPDATE metadata.queue_controls qc
+        SET paused_by = NULL, pause_reason = NULL, resume_at = NULL, last_resumed_at = NOW()
+        WHERE qc.queue_name = v_control.queue_name;
+
+        queue_name := v_control.queue_name;
+        action := 'resumed';
+        error_rate := NULL;
+        attempts := NULL;
+        RETURN NEXT;
+    END LOOP;
+
+    -- 2. Breakers on queues that are running
+    FOR v_control IN
+        SELECT qc.* FROM metadata.queue_controls qc
+        LEFT JOIN metadata.river_queue rq ON rq.name = qc.queue_name
+        WHERE qc.breaker_enabled AND rq.paused_at IS NULL
+        FOR UPDATE OF qc
+    LOOP
+        v_window_start := GREATEST(
+            NOW() - make_interval(secs => v_control.breaker_window_seconds),
+            v_control.last_resumed_at
+        );
+
+        SELECT
+            COALESCE(SUM((
+                SELECT COUNT(*) FROM unnest(j.errors) e
+                WHERE (e->>'at')::TIMESTAMPTZ > v_window_start
+            )), 0),
+            COUNT(*) FILTER (WHERE j.state = 'completed' AND j.finalized_at > v_window_start)
+        INTO v_failures, v_completions
+        FROM metadata.river_job j
+        WHERE j.queue = v_control.queue_name
+          AND j.attempted_at > v_window_start;
+
+        v_rate := CASE WHEN v_failures + v_completions > 0
+            THEN round(v_failures::NUMERIC / (v_failures + v_completions), 3) END;
+
+        IF v_failures + v_completions >= v_control.breaker_min_attempts
+           AND v_rate >= v_control.breaker_error_rate THEN
+            PERFORM metadata.set_river_queue_paused(v_control.queue_name, TRUE);
+            UPDATE metadata.queue_controls qc
+            SET paused_by = 'circuit_breaker',
+                pause_reason = format('Circuit breaker: %s of %s attempts failed in the last %s seconds',
+                    v_failures, v_failures + v_completions,
+                    EXTRACT(EPOCH FROM NOW() - v_window_start)::INT),
+                resume_at = NOW() + make_interval(secs => v_control.breaker_cooldown_seconds),
+                last_error_rate = v_rate,
+                last_attempts = v_failures + v_completions,
+                last_evaluated_at = NOW(),
+                last_tripped_at = NOW(),
+                trip_count = qc.trip_count + 1
+            WHERE qc.queue_name = v_control.queue_name;
+
+            queue_name := v_control.queue_name;
+            action := 'tripped';
+            error_rate := v_rate;
+            attempts := v_failures + v_completions;
+            RETURN NEXT;
+        ELSE
+            UPDATE metadata.queue_controls qc
+            SET last_error_rate = v_rate,
+                last_attempts = v_failures + v_completions,
+                last_evaluated_at = NOW()
+            WHERE qc.queue_name = v_control.queue_name;
+        END IF;
+    END LOOP;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.evaluate_queue_circuit_breakers() IS
+    'Internal. Resumes queues whose timed pause or breaker cooldown ended, then pauses queues whose error rate reached their breaker threshold. Run by the queue_circuit_breakers maintenance task. Added in v0.89.0.';
+
+REVOKE EXECUTE ON FUNCTION metadata.evaluate_queue_circuit_breakers() FROM PUBLIC;
+
+
+-- ============================================================================
+-- 7. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{queue_controls,river_queue}',
+   '{}',
+   'v0-89-0-queue-controls',
+   'Queue pause controls and circuit breakers',
+   'accepted',
+   'During an incident (an SMTP provider rejecting mail, a payment provider outage) the only way to stop a class of jobs was to stop a whole worker. Jobs kept failing and burning retries against a dependency that was down, and notification retries could deliver late bursts once it recovered.',
+   'Admins pause and resume individual River queues with pause_queue()/resume_queue(), optionally with an automatic resume time. Pausing sets metadata.river_queue.paused_at and sends River''s pause/resume control message, so all River clients (both workers, every replica) stop fetching from the queue. Per-queue circuit breakers (off by default) are evaluated every minute by the consolidated worker''s queue_circuit_breakers maintenance task: when failed attempts reach breaker_error_rate of at least breaker_min_attempts attempts in the window, the queue is paused for breaker_cooldown_seconds and then resumed.',
+   'River already supports pausing queues across clients and survives restarts, so the controls reuse its table and notification channel rather than adding a polled flag in each worker. Evaluating breakers in SQL from river_job.errors counts attempts from all replicas and both workers, which an in-process counter per replica would not. Running evaluation as a maintenance task gives one evaluator at a time and admin visibility for free.',
+   'A tripped breaker delays all jobs in the queue, including ones that would have succeeded; queues are coarse (all notifications share one). Breakers react within about a minute plus the window, so they limit damage rather than prevent it. Pausing a queue River has never seen creates its river_queue row, which River prunes if no client reports the queue within 24 hours. The new river_job (queue, attempted_at) index adds a little write overhead per attempt.');
+
+COMMIT;
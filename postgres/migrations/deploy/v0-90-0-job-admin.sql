@@ -0,0 +1,287 @@
+-- Deploy civic_os:v0-90-0-job-admin to pg
+-- requires: v0-89-0-queue-controls
+--
+-- v0.90.0 — River job administration:
+--   1. metadata.job_admin_runs: one row per purge, bulk retry or bulk cancel
+--   2. public.get_job_kind_summary() admin RPC (discarded and running jobs per kind)
+--   3. public.request_retry_discarded_jobs() / public.request_cancel_stuck_jobs()
+--      admin RPCs, each queueing a job_admin job
+--   4. public.get_job_admin_runs() admin RPC
+--   5. Record schema decision
+--
+-- The consolidated worker's job_purge maintenance task deletes completed and
+-- cancelled river_job rows past JOB_RETENTION_COMPLETED_HOURS /
+-- JOB_RETENTION_CANCELLED_HOURS; both workers turn River's own cleaner off
+-- for those states. Retries and cancellations run as job_admin_retry_discarded
+-- and job_admin_cancel_stuck jobs in the job_admin queue, which go through
+-- River's JobRetry/JobCancel so running jobs are cancelled on the worker that
+-- holds them.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. JOB ADMIN RUNS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.job_admin_runs (
+    id BIGSERIAL PRIMARY KEY,
+    action TEXT NOT NULL CHECK (action IN ('purge', 'retry_discarded', 'cancel_stuck')),
+    job_kind TEXT,  -- NULL for purges and for cancellations across all kinds
+    parameters JSONB NOT NULL DEFAULT '{}'::JSONB,
+    status TEXT NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'completed', 'failed')),
+    jobs_affected INT NOT NULL DEFAULT 0,
+    jobs_remaining INT NOT NULL DEFAULT 0,
+    requested_by UUID,  -- NULL for the scheduled purge
+    river_job_id BIGINT,
+    error_message TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_job_admin_runs_started ON metadata.job_admin_runs(started_at DESC);
+
+COMMENT ON TABLE metadata.job_admin_runs IS
+    'One row per River job purge, bulk retry of discarded jobs or bulk cancellation of stuck jobs: what was asked, how many jobs it touched, who asked. Purges that delete nothing are not recorded. Added in v0.90.0.';
+COMMENT ON COLUMN metadata.job_admin_runs.jobs_remaining IS
+    'Matching jobs left untouched because the run hit its per-run limit; request the action again to continue.';
+
+ALTER TABLE metadata.job_admin_runs ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 2. JOB KIND SUMMARY RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_job_kind_summary(p_stuck_minutes INT DEFAULT 60)
+RETURNS TABLE (
+    kind TEXT,
+    queue TEXT,
+    discarded_jobs BIGINT,
+    last_discarded_at TIMESTAMPTZ,
+    running_jobs BIGINT,
+    stuck_jobs BIGINT,
+    oldest_attempted_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can view jobs';
+    END IF;
+
+    RETURN QUERY
+    SELECT j.kind, j.queue,
+           COUNT(*) FILTER (WHERE j.state = 'discarded'),
+           MAX(j.finalized_at) FILTER (WHERE j.state = 'discarded'),
+           COUNT(*) FILTER (WHERE j.state = 'running'),
+           COUNT(*) FILTER (WHERE j.state = 'running'
+                              AND j.attempted_at < NOW() - make_interval(mins => p_stuck_minutes)),
+           MIN(j.attempted_at) FILTER (WHERE j.state = 'running')
+    FROM metadata.river_job j
+    WHERE j.state IN ('discarded', 'running')
+    GROUP BY j.kind, j.queue
+    ORDER BY j.kind, j.queue;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_job_kind_summary(INT) IS
+    'Admin-only. Discarded and running River jobs per kind and queue; stuck_jobs counts jobs running longer than p_stuck_minutes. Added in v0.90.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_job_kind_summary(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_job_kind_summary(INT) TO authenticated;
+
+
+-- ============================================================================
+-- 3. RETRY AND CANCEL RPCs
+-- ============================================================================
+-- Both queue a job_admin job rather than changing river_job here: the worker
+-- goes through River's client, which cancels running jobs on the worker that
+-- holds them. The river_job trigger stamps args.audit with the requesting
+-- admin, which the worker records as requested_by.
+
+CREATE OR REPLACE FUNCTION public.request_retry_discarded_jobs(
+    p_kind TEXT,
+    p_discarded_since TIMESTAMPTZ DEFAULT NULL
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_matching BIGINT;
+    v_job_id BIGINT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can retry jobs';
+    END IF;
+
+    IF p_kind IS NULL OR p_kind = '' THEN
+        RAISE EXCEPTION 'Job kind is required';
+    END IF;
+
+    SELECT COUNT(*) INTO v_matching
+    FROM metadata.river_job
+    WHERE state = 'discarded' AND kind = p_kind
+      AND (p_discarded_since IS NULL OR finalized_at >= p_discarded_since);
+
+    IF v_matching = 0 THEN
+        RETURN jsonb_build_object(
+            'success', false,
+            'message', format('No discarded %s jobs to retry', p_kind)
+        );
+    END IF;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'job_admin_retry_discarded',
+        jsonb_strip_nulls(jsonb_build_object('kind', p_kind, 'discarded_since', p_discarded_since)),
+        'job_admin', 1, 3, NOW(), 'available'
+    )
+    RETURNING id INTO v_job_id;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'jobs_retry_requested',
+        jsonb_build_object('kind', p_kind, 'discarded_since', p_discarded_since,
+                           'matching_jobs', v_matching, 'job_id', v_job_id)
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'job_id', v_job_id,
+        'message', format('Retrying %s discarded %s job(s)', v_matching, p_kind)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_retry_discarded_jobs(TEXT, TIMESTAMPTZ) IS
+    'Admin-only. Queues a job_admin_retry_discarded job that makes discarded jobs of a kind (optionally only those discarded since a time) available again. Added in v0.90.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_retry_discarded_jobs(TEXT, TIMESTAMPTZ) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_retry_discarded_jobs(TEXT, TIMESTAMPTZ) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.request_cancel_stuck_jobs(
+    p_running_minutes INT DEFAULT 60,
+    p_kind TEXT DEFAULT NULL
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_matching BIGINT;
+    v_job_id BIGINT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can cancel jobs';
+    END IF;
+
+    IF p_running_minutes IS NULL OR p_running_minutes <= 0 THEN
+        RAISE EXCEPTION 'Running time must be a positive number of minutes';
+    END IF;
+
+    SELECT COUNT(*) INTO v_matching
+    FROM metadata.river_job
+    WHERE state = 'running'
+      AND attempted_at < NOW() - make_interval(mins => p_running_minutes)
+      AND (p_kind IS NULL OR kind = p_kind)
+      AND kind NOT LIKE 'job_admin_%';
+
+    IF v_matching = 0 THEN
+        RETURN jsonb_build_object(
+            'success', false,
+            'message', format('No jobs running longer than %s minutes', p_running_minutes)
+        );
+    END IF;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'job_admin_cancel_stuck',
+        jsonb_strip_nulls(jsonb_build_object('running_minutes', p_running_minutes, 'kind', p_kind)),
+        'job_admin', 1, 3, NOW(), 'available'
+    )
+    RETURNING id INTO v_job_id;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'jobs_cancel_requested',
+        jsonb_build_object('kind', p_kind, 'running_minutes', p_running_minutes,
+                           'matching_jobs', v_matching, 'job_id', v_job_id)
+    );
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'job_id', v_job_id,
+        'message', format('Cancelling %s stuck job(s)', v_matching)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_cancel_stuck_jobs(INT, TEXT) IS
+    'Admin-only. Queues a job_admin_cancel_stuck job that cancels jobs running longer than p_running_minutes, optionally of one kind. Job admin jobs themselves are never cancelled. Added in v0.90.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_cancel_stuck_jobs(INT, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_cancel_stuck_jobs(INT, TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 4. RUN HISTORY RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_job_admin_runs(p_limit INT DEFAULT 50)
+RETURNS SETOF metadata.job_admin_runs
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.job_admin_runs r
+    ORDER BY r.started_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_job_admin_runs(INT) IS
+    'Recent job purges, retries and cancellations, newest first. Admin only. Added in v0.90.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_job_admin_runs(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_job_admin_runs(INT) TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{job_admin_runs}',
+   '{}',
+   'v0-90-0-job-admin',
+   'Job retention, bulk retry and bulk cancel for River jobs',
+   'accepted',
+   'River deleted finished jobs after fixed periods set in code, so how long job history was kept could not be tuned and deletions left no trace. Recovering from an outage meant hand-written UPDATEs on river_job to retry discarded jobs, and jobs hung on a dead provider could only be cleared by restarting the worker.',
+   'Both workers disable River''s cleaner for completed and cancelled jobs. A job_purge maintenance task in the consolidated worker deletes them in batches past JOB_RETENTION_COMPLETED_HOURS and JOB_RETENTION_CANCELLED_HOURS (discarded jobs keep River''s 7 days). request_retry_discarded_jobs() and request_cancel_stuck_jobs() queue job_admin jobs that call River''s JobRetry and JobCancel for up to 1000 matching jobs. Every purge that deletes rows, and every retry or cancel run, writes metadata.job_admin_runs; admin requests are also in admin_audit_log.',
+   'Going through River''s client rather than updating river_job keeps its state rules (attempt limits, finalized_at, unique keys) and cancels a running job on the worker that holds it instead of only flipping its row. Running the purge as a maintenance task lets admins see, retune or pause it like the other housekeeping.',
+   'If the job_purge task is disabled, completed and cancelled jobs are kept until it is enabled again. An older payment worker image still running River''s cleaner deletes completed jobs after 24 hours regardless of the configured retention. Cancelling a job that ignores context cancellation leaves it running until River''s rescuer marks it cancelled.');
+
+COMMIT;
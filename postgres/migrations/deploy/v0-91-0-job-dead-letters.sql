@@ -0,0 +1,355 @@
+-- Deploy civic_os:v0-91-0-job-dead-letters to pg
+-- requires: v0-90-0-job-admin
+--
+-- v0.91.0 — Dead-letter capture for discarded River jobs:
+--   1. metadata.job_dead_letters: a copy of every discarded job (kind, args,
+--      errors, timestamps) that outlives River's own retention
+--   2. job_dead_letter notification template
+--   3. metadata.notify_job_dead_letters(): alerts ops roles, at most once per
+--      job kind per 15 minutes
+--   4. metadata.capture_job_dead_letter() / metadata.capture_missed_dead_letters(),
+--      called by the workers
+--   5. public.get_job_dead_letters() / public.dismiss_job_dead_letters() admin RPCs
+--   6. Record schema decision
+--
+-- Both workers subscribe to River's job events and call
+-- capture_job_dead_letter() as soon as a job is discarded. The consolidated
+-- worker's dead_letter_sweep maintenance task calls
+-- capture_missed_dead_letters() to pick up jobs discarded while no
+-- subscriber was listening (a crash, River's rescuer) and to send alerts held
+-- back by the cooldown. Recipients are the roles in DEAD_LETTER_NOTIFY_ROLES.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. DEAD LETTERS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.job_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    river_job_id BIGINT NOT NULL UNIQUE,
+    kind TEXT NOT NULL,
+    queue TEXT NOT NULL,
+    args JSONB NOT NULL,
+    errors JSONB NOT NULL DEFAULT '[]'::JSONB,
+    last_error TEXT,
+    attempt SMALLINT NOT NULL,
+    max_attempts SMALLINT NOT NULL,
+    job_created_at TIMESTAMPTZ NOT NULL,
+    last_attempted_at TIMESTAMPTZ,
+    discarded_at TIMESTAMPTZ NOT NULL,
+    captured_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    notified_at TIMESTAMPTZ,
+    resolved_at TIMESTAMPTZ,
+    resolution TEXT CHECK (resolution IN ('retried', 'dismissed')),
+    resolved_by UUID,
+    CHECK ((resolved_at IS NULL) = (resolution IS NULL))
+);
+
+CREATE INDEX idx_job_dead_letters_unresolved
+    ON metadata.job_dead_letters(kind, captured_at DESC)
+    WHERE resolved_at IS NULL;
+CREATE INDEX idx_job_dead_letters_unnotified
+    ON metadata.job_dead_letters(kind)
+    WHERE notified_at IS NULL;
+
+COMMENT ON TABLE metadata.job_dead_letters IS
+    'Copy of every River job discarded after using up its attempts, kept after River deletes the job. Ops roles are alerted through the job_dead_letter notification. Added in v0.91.0.';
+COMMENT ON COLUMN metadata.job_dead_letters.notified_at IS
+    'When an alert covering this job was sent. NULL while held back by the per-kind cooldown, and for kinds that never alert (send_notification).';
+COMMENT ON COLUMN metadata.job_dead_letters.resolution IS
+    'retried: made available again by a job_admin_retry_discarded run. dismissed: acknowledged with dismiss_job_dead_letters().';
+
+ALTER TABLE metadata.job_dead_letters ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 2. NOTIFICATION TEMPLATE
+-- ============================================================================
+
+INSERT INTO metadata.notification_templates (
+    name,
+    description,
+    entity_type,
+    subject_template,
+    html_template,
+    text_template
+) VALUES (
+    'job_dead_letter',
+    'Sent to DEAD_LETTER_NOTIFY_ROLES when background jobs fail permanently, at most once per job kind per 15 minutes. Template variables: Entity.kind, Entity.queue, Entity.count, Entity.job_id, Entity.attempt, Entity.last_error, Entity.discarded_at; Metadata.site_url, Metadata.site_name.',
+    NULL,  -- operational alert, not entity-specific
+    -- Subject
+    '[{{.Metadata.site_name}}] {{.Entity.count}} {{.Entity.kind}} job(s) failed permanently',
+    -- HTML Template
+    '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        <h2 style="color: #dc2626;">Background jobs failed</h2>
+        <p>{{.Entity.count}} <strong>{{.Entity.kind}}</strong> job(s) in the <strong>{{.Entity.queue}}</strong> queue used up their attempts and were discarded.</p>
+        <table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Latest job:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">#{{.Entity.job_id}} (attempt {{.Entity.attempt}})</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Last error:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb; font-family: monospace;">{{.Entity.last_error}}</td>
+            </tr>
+        </table>
+        <p>Review and retry them under Admin &rarr; Job Queues:</p>
+        <p><a href="{{.Metadata.site_url}}/system/queues">{{.Metadata.site_url}}/system/queues</a></p>
+        <p style="color: #6b7280; font-size: 12px;">Further failures of this kind in the next 15 minutes are summarized in one alert.</p>
+    </div>',
+    -- Text Template
+    'Background jobs failed
+
+{{.Entity.count}} {{.Entity.kind}} job(s) in the {{.Entity.queue}} queue used up their attempts and were discarded.
+
+Latest job: #{{.Entity.job_id}} (attempt {{.Entity.attempt}})
+Last error: {{.Entity.last_error}}
+
+Review and retry them under Admin > Job Queues:
+{{.Metadata.site_url}}/system/queues
+
+Further failures of this kind in the next 15 minutes are summarized in one alert.'
+)
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    subject_template = EXCLUDED.subject_template,
+    html_template = EXCLUDED.html_template,
+    text_template = EXCLUDED.text_template;
+
+
+-- ============================================================================
+-- 3. ALERTS
+-- ============================================================================
+-- One alert per kind covers every dead letter not yet notified, so an outage
+-- discarding hundreds of jobs sends one email per recipient per 15 minutes.
+-- send_notification is never alerted on: when mail is down, the alert itself
+-- would be discarded and alert again.
+
+CREATE OR REPLACE FUNCTION metadata.notify_job_dead_letters(p_role_keys TEXT[])
+RETURNS INT  -- number of kinds alerted
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_kind RECORD;
+    v_alerted INT := 0;
+BEGIN
+    IF p_role_keys IS NULL OR cardinality(p_role_keys) = 0 THEN
+        RETURN 0;
+    END IF;
+
+    -- Workers capture concurrently; one alert per kind at a time
+    PERFORM pg_advisory_xact_lock(hashtext('metadata.notify_job_dead_letters'));
+
+    FOR v_kind IN
+        SELECT d.kind, COUNT(*) AS pending, MAX(d.id) AS latest_id
+        FROM metadata.job_dead_letters d
+        WHERE d.notified_at IS NULL
+          AND d.kind <> 'send_notification'
+          AND NOT EXISTS (
+              SELECT 1 FROM metadata.job_dead_letters n
+              WHERE n.kind = d.kind AND n.notified_at > NOW() - INTERVAL '15 minutes'
+          )
+        GROUP BY d.kind
+    LOOP
+        PERFORM metadata.send_notification_to_role(
+            p_role_keys,
+            'job_dead_letter',
+            'job_dead_letters',
+            v_kind.latest_id::TEXT,
+            (SELECT jsonb_build_object(
+                        'kind', d.kind,
+                        'queue', d.queue,
+                        'count', v_kind.pending,
+                        'job_id', d.river_job_id,
+                        'attempt', d.attempt,
+                        'last_error', left(COALESCE(d.last_error, ''), 500),
+                        'discarded_at', d.discarded_at)
+             FROM metadata.job_dead_letters d WHERE d.id = v_kind.latest_id)
+        );
+
+        UPDATE metadata.job_dead_letters
+        SET notified_at = NOW()
+        WHERE kind = v_kind.kind AND notified_at IS NULL;
+
+        v_alerted := v_alerted + 1;
+    END LOOP;
+
+    RETURN v_alerted;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.notify_job_dead_letters(TEXT[]) IS
+    'Sends one job_dead_letter notification per job kind with unnotified dead letters to users holding any of p_role_keys, unless that kind was alerted in the last 15 minutes. Never alerts on send_notification. Added in v0.91.0.';
+
+
+-- ============================================================================
+-- 4. CAPTURE FUNCTIONS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.capture_job_dead_letter(
+    p_job_id BIGINT,
+    p_notify_roles TEXT[] DEFAULT '{admin}'
+)
+RETURNS BOOLEAN  -- true when newly captured
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    INSERT INTO metadata.job_dead_letters
+        (river_job_id, kind, queue, args, errors, last_error, attempt, max_attempts,
+         job_created_at, last_attempted_at, discarded_at)
+    SELECT j.id, j.kind, j.queue, j.args, COALESCE(to_jsonb(j.errors), '[]'::JSONB),
+           j.errors[array_length(j.errors, 1)]->>'error',
+           j.attempt, j.max_attempts, j.created_at, j.attempted_at, COALESCE(j.finalized_at, NOW())
+    FROM metadata.river_job j
+    WHERE j.id = p_job_id AND j.state = 'discarded'
+    ON CONFLICT (river_job_id) DO NOTHING;
+
+    IF NOT FOUND THEN
+        RETURN FALSE;
+    END IF;
+
+    PERFORM metadata.notify_job_dead_letters(p_notify_roles);
+    RETURN TRUE;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.capture_job_dead_letter(BIGINT, TEXT[]) IS
+    'Copies a discarded River job into job_dead_letters and alerts p_notify_roles (subject to the per-kind cooldown). No-op for jobs already captured or not discarded. Called by the workers on job events. Added in v0.91.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.capture_missed_dead_letters(
+    p_notify_roles TEXT[] DEFAULT '{admin}',
+    p_lookback INTERVAL DEFAULT '7 days'
+)
+RETURNS INT  -- number newly captured
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_captured INT;
+BEGIN
+    INSERT INTO metadata.job_dead_letters
+        (river_job_id, kind, queue, args, errors, last_error, attempt, max_attempts,
+         job_created_at, last_attempted_at, discarded_at)
+    SELECT j.id, j.kind, j.queue, j.args, COALESCE(to_jsonb(j.errors), '[]'::JSONB),
+           j.errors[array_length(j.errors, 1)]->>'error',
+           j.attempt, j.max_attempts, j.created_at, j.attempted_at, j.finalized_at
+    FROM metadata.river_job j
+    WHERE j.state = 'discarded' AND j.finalized_at > NOW() - p_lookback
+    ON CONFLICT (river_job_id) DO NOTHING;
+
+    GET DIAGNOSTICS v_captured = ROW_COUNT;
+
+    -- Also sends alerts held back by the cooldown
+    PERFORM metadata.notify_job_dead_letters(p_notify_roles);
+    RETURN v_captured;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.capture_missed_dead_letters(TEXT[], INTERVAL) IS
+    'Captures discarded River jobs finalized within p_lookback that no worker captured, then sends pending alerts. Run by the dead_letter_sweep maintenance task. Added in v0.91.0.';
+
+
+-- ============================================================================
+-- 5. ADMIN RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_job_dead_letters(
+    p_include_resolved BOOLEAN DEFAULT FALSE,
+    p_limit INT DEFAULT 100
+)
+RETURNS SETOF metadata.job_dead_letters
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.job_dead_letters d
+    WHERE p_include_resolved OR d.resolved_at IS NULL
+    ORDER BY d.captured_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 1000);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_job_dead_letters(BOOLEAN, INT) IS
+    'Discarded jobs captured as dead letters, newest first; unresolved only unless p_include_resolved. Admin only. Added in v0.91.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_job_dead_letters(BOOLEAN, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_job_dead_letters(BOOLEAN, INT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.dismiss_job_dead_letters(p_ids BIGINT[])
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_dismissed INT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can dismiss dead letters';
+    END IF;
+
+    UPDATE metadata.job_dead_letters
+    SET resolved_at = NOW(), resolution = 'dismissed', resolved_by = public.current_user_id()
+    WHERE id = ANY(p_ids) AND resolved_at IS NULL;
+
+    GET DIAGNOSTICS v_dismissed = ROW_COUNT;
+
+    IF v_dismissed > 0 THEN
+        INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+        VALUES (
+            public.current_user_id(),
+            public.current_user_email(),
+            'job_dead_letters_dismissed',
+            jsonb_build_object('dead_letter_ids', to_jsonb(p_ids), 'dismissed', v_dismissed)
+        );
+    END IF;
+
+    RETURN jsonb_build_object(
+        'success', true,
+        'dismissed', v_dismissed,
+        'message', format('Dismissed %s dead letter(s)', v_dismissed)
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.dismiss_job_dead_letters(BIGINT[]) IS
+    'Admin-only. Marks dead letters as dismissed (acknowledged without a retry). Added in v0.91.0.';
+
+REVOKE EXECUTE ON FUNCTION public.dismiss_job_dead_letters(BIGINT[]) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.dismiss_job_dead_letters(BIGINT[]) TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{job_dead_letters}',
+   '{}',
+   'v0-91-0-job-dead-letters',
+   'Dead-letter capture and ops alerts for discarded jobs',
+   'accepted',
+   'A job that used up its attempts was marked discarded in river_job and deleted by River a week later. Nobody was told: a broken webhook endpoint or provider credential could drop every job of a kind for days before a user noticed.',
+   'Both workers subscribe to River job events and call metadata.capture_job_dead_letter() when a job is discarded; it copies kind, args, errors and timestamps into metadata.job_dead_letters and notifies the roles in DEAD_LETTER_NOTIFY_ROLES (default admin) through the regular notification pipeline. A dead_letter_sweep maintenance task captures discarded jobs the subscribers missed. Alerts are grouped per job kind with a 15-minute cooldown. Retrying a job through request_retry_discarded_jobs() resolves its dead letter; admins can dismiss the rest.',
+   'Event subscriptions capture within a second without touching River''s completer or adding a trigger to river_job, which River updates in bulk. The sweep makes capture complete even for jobs the rescuer discards or that finish while a worker is shutting down. Keeping the rows outside river_job lets the evidence outlive River''s retention.',
+   'send_notification jobs are captured but never alerted on, since alerts travel through the same queue; watch civic_os_jobs_total{kind="send_notification",result="failed"} for mail outages. Dead letters are kept until deleted; resolved ones are purged by job_purge after 90 days.');
+
+COMMIT;
@@ -0,0 +1,358 @@
+-- Deploy civic_os:v0-92-0-bulk-user-import to pg
+-- requires: v0-91-0-job-dead-letters
+--
+-- v0.92.0 — Bulk user provisioning from an uploaded CSV:
+--   1. metadata.user_import_batches / metadata.user_import_rows: one batch per
+--      uploaded file, one row per CSV line with its own status
+--   2. user_import_summary notification template, sent to the importer
+--   3. public.request_user_import(): validates the file and default roles,
+--      records the batch and queues a bulk_provision_users job
+--   4. public.get_user_import_batches() / public.get_user_import_rows() RPCs
+--   5. Record schema decision
+--
+-- The bulk_provision_users job (consolidated worker, user_provisioning queue)
+-- downloads the CSV from S3, validates every row and records it, then feeds
+-- valid rows to provision_keycloak_user a few at a time
+-- (BULK_PROVISION_CONCURRENCY) so a 500-row file doesn't flood Keycloak. It
+-- snoozes between waves and sends user_import_summary when every row is done.
+--
+-- The browser-side bulk_provision_users() RPC used by the Import Users modal is
+-- unchanged; this path is for files too large to validate and submit in one
+-- request.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. IMPORT TABLES
+-- ============================================================================
+
+CREATE TABLE metadata.user_import_batches (
+    id BIGSERIAL PRIMARY KEY,
+    file_id UUID NOT NULL REFERENCES metadata.files(id),
+    file_name TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'provisioning', 'completed', 'failed')),
+
+    -- Options applied to rows that leave the column blank
+    default_roles TEXT[] NOT NULL DEFAULT '{user}',
+    send_welcome_email BOOLEAN NOT NULL DEFAULT true,
+    send_welcome_sms BOOLEAN NOT NULL DEFAULT false,
+
+    -- Role keys the importer could assign when the import was requested. The
+    -- worker has no JWT, so per-row roles are checked against this snapshot.
+    allowed_roles TEXT[] NOT NULL DEFAULT '{}',
+
+    total_rows INT NOT NULL DEFAULT 0,
+    invalid_rows INT NOT NULL DEFAULT 0,
+    skipped_rows INT NOT NULL DEFAULT 0,
+    completed_rows INT NOT NULL DEFAULT 0,
+    failed_rows INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+
+    requested_by UUID,
+    river_job_id BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_user_import_batches_created
+    ON metadata.user_import_batches(created_at DESC);
+
+COMMENT ON TABLE metadata.user_import_batches IS
+    'One CSV user import requested through request_user_import() and processed by the bulk_provision_users job. Added in v0.92.0.';
+COMMENT ON COLUMN metadata.user_import_batches.status IS
+    'pending: queued, file not read yet. provisioning: rows recorded, provision jobs in flight. completed: every row finished (some may have failed). failed: the file could not be read or parsed.';
+COMMENT ON COLUMN metadata.user_import_batches.allowed_roles IS
+    'Role keys from get_manageable_roles() at request time; rows naming any other role are rejected.';
+
+
+CREATE TABLE metadata.user_import_rows (
+    id BIGSERIAL PRIMARY KEY,
+    batch_id BIGINT NOT NULL REFERENCES metadata.user_import_batches(id) ON DELETE CASCADE,
+    row_number INT NOT NULL,
+    email TEXT,
+    first_name TEXT,
+    last_name TEXT,
+    phone TEXT,
+    roles TEXT[],
+    send_welcome_email BOOLEAN,
+    send_welcome_sms BOOLEAN,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('invalid', 'skipped', 'pending', 'queued', 'completed', 'failed')),
+    error_message TEXT,
+    provision_id BIGINT REFERENCES metadata.user_provisioning(id) ON DELETE SET NULL,
+    provision_job_id BIGINT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (batch_id, row_number)
+);
+
+CREATE INDEX idx_user_import_rows_status
+    ON metadata.user_import_rows(batch_id, status);
+
+COMMENT ON TABLE metadata.user_import_rows IS
+    'One line of an imported CSV. Valid rows move pending -> queued -> completed/failed as their provision_keycloak_user job runs. Added in v0.92.0.';
+COMMENT ON COLUMN metadata.user_import_rows.row_number IS
+    'Line number in the uploaded file, so importers can find the row in their spreadsheet.';
+COMMENT ON COLUMN metadata.user_import_rows.provision_job_id IS
+    'River job provisioning this row. A queued row is final once its user_provisioning record is completed, or failed with this job no longer pending or retrying.';
+COMMENT ON COLUMN metadata.user_import_rows.status IS
+    'invalid: failed validation. skipped: a user with this email already exists or is being provisioned. pending: waiting for a provisioning slot. queued: provision job in flight. completed / failed: final provisioning result.';
+
+-- Read access mirrors user_provisioning: anyone who can read private user data
+ALTER TABLE metadata.user_import_batches ENABLE ROW LEVEL SECURITY;
+ALTER TABLE metadata.user_import_rows ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY user_import_batches_select ON metadata.user_import_batches
+    FOR SELECT TO authenticated
+    USING (metadata.has_permission('civic_os_users_private', 'read'));
+
+CREATE POLICY user_import_rows_select ON metadata.user_import_rows
+    FOR SELECT TO authenticated
+    USING (metadata.has_permission('civic_os_users_private', 'read'));
+
+GRANT SELECT ON metadata.user_import_batches TO authenticated;
+GRANT SELECT ON metadata.user_import_rows TO authenticated;
+
+
+-- ============================================================================
+-- 2. NOTIFICATION TEMPLATE
+-- ============================================================================
+
+INSERT INTO metadata.notification_templates (
+    name,
+    description,
+    entity_type,
+    subject_template,
+    html_template,
+    text_template
+) VALUES (
+    'user_import_summary',
+    'Sent to the importer when a CSV user import finishes. Template variables: Entity.file_name, Entity.status, Entity.error_message, Entity.total_rows, Entity.completed_rows, Entity.failed_rows, Entity.invalid_rows, Entity.skipped_rows, Entity.problems (up to 25 of {row_number, email, status, error}), Entity.more_problems; Metadata.site_url, Metadata.site_name.',
+    'user_import_batches',
+    -- Subject
+    '[{{.Metadata.site_name}}] User import {{if eq .Entity.status "failed"}}failed{{else}}finished{{end}}: {{.Entity.file_name}}',
+    -- HTML Template
+    '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        <h2>User import {{if eq .Entity.status "failed"}}failed{{else}}finished{{end}}</h2>
+        <p>Your import of <strong>{{.Entity.file_name}}</strong> has {{if eq .Entity.status "failed"}}stopped.{{else}}been processed.{{end}}</p>
+        {{if .Entity.error_message}}<p style="color: #dc2626;">{{.Entity.error_message}}</p>{{end}}
+        <table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Rows read:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.total_rows}}</td></tr>
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Users created:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.completed_rows}}</td></tr>
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Already existed:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.skipped_rows}}</td></tr>
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Invalid rows:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.invalid_rows}}</td></tr>
+            <tr><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Provisioning failed:</strong></td><td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.failed_rows}}</td></tr>
+        </table>
+        {{if .Entity.problems}}
+        <h3>Rows that need attention</h3>
+        <table style="width: 100%; border-collapse: collapse; font-size: 13px;">
+            <tr><th style="text-align: left; padding: 4px;">Row</th><th style="text-align: left; padding: 4px;">Email</th><th style="text-align: left; padding: 4px;">Problem</th></tr>
+            {{range .Entity.problems}}<tr>
+                <td style="padding: 4px; border-bottom: 1px solid #e5e7eb;">{{.row_number}}</td>
+                <td style="padding: 4px; border-bottom: 1px solid #e5e7eb;">{{.email}}</td>
+                <td style="padding: 4px; border-bottom: 1px solid #e5e7eb;">{{.error}}</td>
+            </tr>{{end}}
+        </table>
+        {{if .Entity.more_problems}}<p style="color: #6b7280;">...and {{.Entity.more_problems}} more.</p>{{end}}
+        {{end}}
+        <p><a href="{{.Metadata.site_url}}/admin/users">{{.Metadata.site_url}}/admin/users</a></p>
+    </div>',
+    -- Text Template
+    'User import {{if eq .Entity.status "failed"}}failed{{else}}finished{{end}}: {{.Entity.file_name}}
+{{if .Entity.error_message}}
+{{.Entity.error_message}}
+{{end}}
+Rows read: {{.Entity.total_rows}}
+Users created: {{.Entity.completed_rows}}
+Already existed: {{.Entity.skipped_rows}}
+Invalid rows: {{.Entity.invalid_rows}}
+Provisioning failed: {{.Entity.failed_rows}}
+{{if .Entity.problems}}
+Rows that need attention:
+{{range .Entity.problems}}- Row {{.row_number}} ({{.email}}): {{.error}}
+{{end}}{{if .Entity.more_problems}}...and {{.Entity.more_problems}} more.
+{{end}}{{end}}
+{{.Metadata.site_url}}/admin/users'
+)
+ON CONFLICT (name) DO UPDATE SET
+    description = EXCLUDED.description,
+    entity_type = EXCLUDED.entity_type,
+    subject_template = EXCLUDED.subject_template,
+    html_template = EXCLUDED.html_template,
+    text_template = EXCLUDED.text_template;
+
+
+-- ============================================================================
+-- 3. REQUEST RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.request_user_import(
+    p_file_id UUID,
+    p_default_roles TEXT[] DEFAULT ARRAY['user'],
+    p_send_welcome_email BOOLEAN DEFAULT true,
+    p_send_welcome_sms BOOLEAN DEFAULT false
+)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_file RECORD;
+    v_input_role TEXT;
+    v_role_name TEXT;
+    v_default_roles TEXT[];
+    v_resolved_roles TEXT[] := ARRAY[]::TEXT[];
+    v_allowed_roles TEXT[];
+    v_batch_id BIGINT;
+    v_job_id BIGINT;
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'create') THEN
+        RETURN json_build_object('success', false, 'error', 'Permission denied');
+    END IF;
+
+    SELECT id, file_name, file_type INTO v_file
+    FROM metadata.files WHERE id = p_file_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('success', false, 'error', 'File not found');
+    END IF;
+
+    IF lower(v_file.file_name) NOT LIKE '%.csv'
+       AND v_file.file_type NOT IN ('text/csv', 'application/csv', 'text/plain') THEN
+        RETURN json_build_object('success', false, 'error', 'User imports must be CSV files');
+    END IF;
+
+    v_default_roles := COALESCE(p_default_roles, ARRAY['user']);
+    IF array_length(v_default_roles, 1) IS NULL THEN
+        v_default_roles := ARRAY['user'];
+    END IF;
+
+    FOREACH v_input_role IN ARRAY v_default_roles LOOP
+        v_role_name := resolve_role_key(v_input_role);
+        IF v_role_name IS NULL THEN
+            RETURN json_build_object('success', false, 'error', format('Role "%s" does not exist', v_input_role));
+        END IF;
+        IF NOT can_manage_role(v_role_name) THEN
+            RETURN json_build_object('success', false, 'error', format('Your role cannot assign the "%s" role', v_input_role));
+        END IF;
+        v_resolved_roles := array_append(v_resolved_roles, v_role_name);
+    END LOOP;
+
+    SELECT COALESCE(array_agg(role_key), ARRAY[]::TEXT[]) INTO v_allowed_roles
+    FROM get_manageable_roles();
+
+    INSERT INTO metadata.user_import_batches (
+        file_id, file_name, default_roles, send_welcome_email, send_welcome_sms,
+        allowed_roles, requested_by
+    ) VALUES (
+        v_file.id, v_file.file_name, v_resolved_roles,
+        COALESCE(p_send_welcome_email, true), COALESCE(p_send_welcome_sms, false),
+        v_allowed_roles, current_user_id()
+    )
+    RETURNING id INTO v_batch_id;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'bulk_provision_users',
+        jsonb_build_object('batch_id', v_batch_id),
+        'user_provisioning',
+        2,
+        5,
+        NOW(),
+        'available'
+    )
+    RETURNING id INTO v_job_id;
+
+    UPDATE metadata.user_import_batches SET river_job_id = v_job_id WHERE id = v_batch_id;
+
+    RETURN json_build_object('success', true, 'batch_id', v_batch_id);
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_user_import(UUID, TEXT[], BOOLEAN, BOOLEAN) IS
+    'Queues a bulk_provision_users job for an uploaded CSV (metadata.files id). Default roles are checked with can_manage_role(); the importer''s manageable roles are recorded for per-row checks. Requires civic_os_users_private create permission. Added in v0.92.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_user_import(UUID, TEXT[], BOOLEAN, BOOLEAN) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_user_import(UUID, TEXT[], BOOLEAN, BOOLEAN) TO authenticated;
+
+
+-- ============================================================================
+-- 4. STATUS RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_user_import_batches(p_limit INT DEFAULT 20)
+RETURNS SETOF metadata.user_import_batches
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'read') THEN
+        RAISE EXCEPTION 'Permission denied';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.user_import_batches b
+    ORDER BY b.created_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 200);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_user_import_batches(INT) IS
+    'Recent CSV user imports, newest first. Requires civic_os_users_private read permission. Added in v0.92.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_user_import_batches(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_user_import_batches(INT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_user_import_rows(
+    p_batch_id BIGINT,
+    p_problems_only BOOLEAN DEFAULT FALSE
+)
+RETURNS SETOF metadata.user_import_rows
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'read') THEN
+        RAISE EXCEPTION 'Permission denied';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.user_import_rows r
+    WHERE r.batch_id = p_batch_id
+      AND (NOT p_problems_only OR r.status IN ('invalid', 'skipped', 'failed'))
+    ORDER BY r.row_number;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_user_import_rows(BIGINT, BOOLEAN) IS
+    'Rows of one CSV user import in file order; only invalid, skipped and failed rows when p_problems_only. Requires civic_os_users_private read permission. Added in v0.92.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_user_import_rows(BIGINT, BOOLEAN) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_user_import_rows(BIGINT, BOOLEAN) TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{user_import_batches,user_import_rows,user_provisioning}',
+   '{}',
+   'v0-92-0-bulk-user-import',
+   'Background CSV user import with per-row status',
+   'accepted',
+   'The Import Users modal parses a spreadsheet in the browser and sends every row to bulk_provision_users() in one request, which queues one provision_keycloak_user job per row at once. Onboarding a 500-person department meant splitting the file by hand, watching a single long request, and hitting Keycloak with hundreds of concurrent user creations.',
+   'Importers upload the CSV as a regular file and call request_user_import(). A bulk_provision_users job reads it from S3, records every line in metadata.user_import_rows (invalid and already-existing rows are marked, not dropped), then creates user_provisioning records and provision_keycloak_user jobs for at most BULK_PROVISION_CONCURRENCY rows at a time, snoozing between waves. When no row is pending or in flight it totals the batch and notifies the importer with user_import_summary.',
+   'Snoozing keeps the batch job off a worker slot while provision jobs run, and does not use up its attempts. Per-row roles are checked against the importer''s manageable roles captured at request time because the worker has no JWT to call can_manage_role() with. Reusing user_provisioning and provision_keycloak_user keeps one code path for creating users.',
+   'A row counts as failed once its provision job has no attempts left; it can still be retried from the user list, but the batch totals are not updated afterwards. The uploaded CSV stays in metadata.files like any other upload.');
+
+COMMIT;
@@ -0,0 +1,209 @@
+-- Deploy civic_os:v0-93-0-keycloak-user-sync to pg
+-- requires: v0-92-0-bulk-user-import
+--
+-- v0.93.0 — Keycloak → Civic OS user sync:
+--   1. metadata.keycloak_user_sync_runs: one row per keycloak_user_sync job
+--   2. metadata.keycloak_user_sync_conflicts: users the sync could not
+--      reconcile, open until a later complete run no longer sees the problem
+--   3. metadata.enqueue_keycloak_user_sync(), called by the consolidated
+--      worker's keycloak_user_sync maintenance task
+--   4. public.get_keycloak_user_sync_runs() / public.get_keycloak_user_sync_conflicts()
+--   5. Record schema decision
+--
+-- Users created or changed directly in Keycloak (identity provider
+-- federation, the admin console) only reached civic_os_users when they next
+-- logged in through refresh_current_user(). The keycloak_user_sync job pages
+-- through the realm's users, upserts civic_os_users / civic_os_users_private
+-- and reconciles user_roles with each user's effective realm roles, the same
+-- way refresh_current_user() does from the JWT. Phone stays database-owned
+-- (v0.65.0) and is never synced from Keycloak.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. SYNC RUNS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.keycloak_user_sync_runs (
+    id BIGSERIAL PRIMARY KEY,
+    river_job_id BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'completed', 'failed')),
+    next_offset INT NOT NULL DEFAULT 0,
+    seen_user_ids UUID[] NOT NULL DEFAULT '{}',
+    users_seen INT NOT NULL DEFAULT 0,
+    users_created INT NOT NULL DEFAULT 0,
+    users_updated INT NOT NULL DEFAULT 0,
+    users_skipped INT NOT NULL DEFAULT 0,
+    roles_added INT NOT NULL DEFAULT 0,
+    roles_removed INT NOT NULL DEFAULT 0,
+    open_conflicts INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_keycloak_user_sync_runs_started ON metadata.keycloak_user_sync_runs(started_at DESC);
+CREATE INDEX idx_keycloak_user_sync_runs_job ON metadata.keycloak_user_sync_runs(river_job_id);
+
+COMMENT ON TABLE metadata.keycloak_user_sync_runs IS
+    'One row per keycloak_user_sync job. The job works through the realm a page at a time and snoozes between batches; next_offset and seen_user_ids carry its progress across snoozes and retries. Added in v0.93.0.';
+COMMENT ON COLUMN metadata.keycloak_user_sync_runs.seen_user_ids IS
+    'Keycloak user IDs listed so far. Used at the end of the run to find Civic OS users missing from Keycloak, then cleared.';
+COMMENT ON COLUMN metadata.keycloak_user_sync_runs.users_skipped IS
+    'Users left alone this run: service accounts, users with a conflict, and users with Keycloak jobs still pending from Civic OS.';
+
+ALTER TABLE metadata.keycloak_user_sync_runs ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 2. SYNC CONFLICTS TABLE
+-- ============================================================================
+-- Keycloak and Civic OS share user IDs (provisioning uses the Keycloak ID), so
+-- user_id identifies the user on both sides. subject distinguishes several
+-- conflicts of one type for a user (the role name for unknown_role).
+
+CREATE TABLE metadata.keycloak_user_sync_conflicts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    conflict_type TEXT NOT NULL
+        CHECK (conflict_type IN ('email_in_use', 'invalid_profile', 'unknown_role', 'missing_in_keycloak')),
+    subject TEXT NOT NULL DEFAULT '',
+    username TEXT,
+    email TEXT,
+    other_user_id UUID,  -- email_in_use: the Civic OS user that already has the email
+    message TEXT NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    UNIQUE (user_id, conflict_type, subject)
+);
+
+CREATE INDEX idx_keycloak_user_sync_conflicts_open
+    ON metadata.keycloak_user_sync_conflicts(last_seen_at DESC)
+    WHERE resolved_at IS NULL;
+
+COMMENT ON TABLE metadata.keycloak_user_sync_conflicts IS
+    'Users the Keycloak user sync could not reconcile. email_in_use: another Civic OS user has the email, so the user is not synced. invalid_profile: the Keycloak profile fails a Civic OS check (e.g. the email_address domain). unknown_role: a realm role with no metadata.roles row, left unassigned. missing_in_keycloak: a Civic OS user the realm does not list; nothing is deleted. A conflict a complete run no longer sees gets resolved_at. Added in v0.93.0.';
+
+ALTER TABLE metadata.keycloak_user_sync_conflicts ENABLE ROW LEVEL SECURITY;
+
+
+-- ============================================================================
+-- 3. ENQUEUE FUNCTION
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.enqueue_keycloak_user_sync()
+RETURNS BOOLEAN
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    SELECT 'keycloak_user_sync', '{}'::JSONB, 'user_provisioning', 3, 5, NOW(), 'available'
+    WHERE NOT EXISTS (
+        SELECT 1 FROM metadata.river_job j
+        WHERE j.kind = 'keycloak_user_sync'
+          AND j.state IN ('available', 'scheduled', 'running', 'retryable')
+    );
+    RETURN FOUND;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.enqueue_keycloak_user_sync() IS
+    'Enqueue a keycloak_user_sync job unless one is already pending. Returns whether a job was queued. Called hourly by the keycloak_user_sync maintenance task. Added in v0.93.0.';
+
+
+-- ============================================================================
+-- 4. ADMIN RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_keycloak_user_sync_runs(p_limit INT DEFAULT 20)
+RETURNS TABLE (
+    id BIGINT,
+    status TEXT,
+    users_seen INT,
+    users_created INT,
+    users_updated INT,
+    users_skipped INT,
+    roles_added INT,
+    roles_removed INT,
+    open_conflicts INT,
+    error_message TEXT,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'read') THEN
+        RAISE EXCEPTION 'Permission denied: you do not have permission to view users';
+    END IF;
+
+    RETURN QUERY
+    SELECT r.id, r.status, r.users_seen, r.users_created, r.users_updated, r.users_skipped,
+           r.roles_added, r.roles_removed, r.open_conflicts, r.error_message,
+           r.started_at, r.finished_at
+    FROM metadata.keycloak_user_sync_runs r
+    ORDER BY r.started_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 200);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_keycloak_user_sync_runs(INT) IS
+    'Recent Keycloak user sync runs, newest first. Requires civic_os_users_private read permission. Added in v0.93.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_keycloak_user_sync_runs(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_keycloak_user_sync_runs(INT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_keycloak_user_sync_conflicts(p_include_resolved BOOLEAN DEFAULT FALSE)
+RETURNS SETOF metadata.keycloak_user_sync_conflicts
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'read') THEN
+        RAISE EXCEPTION 'Permission denied: you do not have permission to view users';
+    END IF;
+
+    RETURN QUERY
+    SELECT * FROM metadata.keycloak_user_sync_conflicts c
+    WHERE p_include_resolved OR c.resolved_at IS NULL
+    ORDER BY c.resolved_at IS NOT NULL, c.last_seen_at DESC
+    LIMIT 1000;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_keycloak_user_sync_conflicts(BOOLEAN) IS
+    'Open Keycloak user sync conflicts (and resolved ones when p_include_resolved), most recently seen first. Requires civic_os_users_private read permission. Added in v0.93.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_keycloak_user_sync_conflicts(BOOLEAN) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_keycloak_user_sync_conflicts(BOOLEAN) TO authenticated;
+
+
+-- ============================================================================
+-- 5. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{keycloak_user_sync_runs,keycloak_user_sync_conflicts,civic_os_users,user_roles}',
+   '{}',
+   'v0-93-0-keycloak-user-sync',
+   'Periodic Keycloak to Civic OS user sync',
+   'accepted',
+   'Civic OS only learned about a Keycloak user when that user logged in (refresh_current_user) or was provisioned from Civic OS. Users federated from an identity provider or created in the Keycloak admin console were invisible to user pickers, role queries and notifications until their first login, and role changes made in Keycloak waited for the next login.',
+   'An hourly keycloak_user_sync maintenance task queues a keycloak_user_sync job. The job lists realm users 100 at a time, upserts civic_os_users and civic_os_users_private (name and email, never phone) and reconciles user_roles with the effective realm roles, skipping Keycloak system roles. Users with Keycloak jobs still pending from Civic OS are skipped for the run. Problems are recorded in keycloak_user_sync_conflicts instead of being forced: a duplicate email or a profile the domains reject skips the user, an unknown role is left unassigned, and a Civic OS user missing from Keycloak is only flagged.',
+   'Mirroring refresh_current_user keeps one definition of what a user row and its roles look like, whichever side the change came from. Not auto-creating unknown roles (as login does) keeps a realm full of unrelated roles from flooding metadata.roles. Skipping users with pending Civic OS changes avoids undoing an admin''s edit before the worker has pushed it to Keycloak.',
+   'Role rows the sync adds or removes fire the user_roles trigger, so each change also queues an assign or revoke job that is a no-op in Keycloak. Offset paging can miss a user when the realm changes mid-run; the next run picks them up, and a missed user may be flagged missing_in_keycloak for one run. Deleting a user in Keycloak does not delete them from Civic OS.');
+
+COMMIT;
@@ -0,0 +1,559 @@
+-- Deploy civic_os:v0-94-0-user-deprovisioning to pg
+-- requires: v0-93-0-keycloak-user-sync
+--
+-- v0.94.0 — User deprovisioning (offboarding):
+--   1. metadata.user_deprovisioning: one row per offboarding request
+--   2. metadata.user_deprovisioning_records: records owned by the user,
+--      reassigned or flagged per table column
+--   3. metadata.user_reassignable_columns + public.set_user_reassignable_column():
+--      which user columns hand over to a successor
+--   4. metadata.deprovisioned_user_pii: PII kept under the 'lock' policy,
+--      readable by admins through public.get_deprovisioned_user_pii()
+--   5. metadata.user_owned_record_columns() / metadata.complete_user_deprovisioning()
+--   6. public.request_user_deprovisioning() / public.get_user_deprovisioning()
+--   7. Record schema decision
+--
+-- The inverse of create_provisioned_user(): request_user_deprovisioning()
+-- queues a deprovision_user job. The worker disables the Keycloak account,
+-- ends its sessions and removes its realm role mappings, then calls
+-- complete_user_deprovisioning(), which does the database side in one
+-- transaction. The civic_os_users row is never deleted, so foreign keys and
+-- history keep pointing at it.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. DEPROVISIONING REQUESTS
+-- ============================================================================
+
+CREATE TABLE metadata.user_deprovisioning (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES metadata.civic_os_users(id),
+
+    -- Configuration
+    pii_policy TEXT NOT NULL DEFAULT 'lock'
+        CHECK (pii_policy IN ('lock', 'anonymize')),
+    reassign_to UUID REFERENCES metadata.civic_os_users(id),
+    reason TEXT,
+
+    -- Lifecycle
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'processing', 'completed', 'failed')),
+    keycloak_disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    roles_revoked TEXT[] NOT NULL DEFAULT '{}',
+    records_reassigned INT NOT NULL DEFAULT 0,
+    records_flagged INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+    requested_by UUID REFERENCES metadata.civic_os_users(id),
+    river_job_id BIGINT,
+
+    -- Timestamps
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+
+    CONSTRAINT reassign_to_other_user CHECK (reassign_to IS DISTINCT FROM user_id)
+);
+
+-- A user has at most one request in flight or done; failed ones can be re-requested
+CREATE UNIQUE INDEX idx_user_deprovisioning_user
+    ON metadata.user_deprovisioning(user_id)
+    WHERE status <> 'failed';
+CREATE INDEX idx_user_deprovisioning_created ON metadata.user_deprovisioning(created_at DESC);
+
+COMMENT ON TABLE metadata.user_deprovisioning IS
+    'User offboarding requests. pii_policy lock keeps the user''s private details in deprovisioned_user_pii for admins; anonymize discards them and replaces the public display name. keycloak_disabled is false when the account was already gone from Keycloak. Added in v0.94.0.';
+
+ALTER TABLE metadata.user_deprovisioning ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "User managers see deprovisioning" ON metadata.user_deprovisioning
+    FOR SELECT TO authenticated
+    USING (metadata.has_permission('civic_os_users_private', 'read'));
+
+GRANT SELECT ON metadata.user_deprovisioning TO authenticated;
+
+
+-- ============================================================================
+-- 2. OWNED RECORDS
+-- ============================================================================
+
+CREATE TABLE metadata.user_deprovisioning_records (
+    id BIGSERIAL PRIMARY KEY,
+    deprovision_id BIGINT NOT NULL REFERENCES metadata.user_deprovisioning(id) ON DELETE CASCADE,
+    table_name NAME NOT NULL,
+    column_name NAME NOT NULL,
+    record_count INT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('reassigned', 'flagged')),
+    UNIQUE (deprovision_id, table_name, column_name)
+);
+
+COMMENT ON TABLE metadata.user_deprovisioning_records IS
+    'Per table column, how many records referenced the deprovisioned user and what happened to them: reassigned to the successor, or flagged for someone to review (the reference is left as it is). Added in v0.94.0.';
+
+ALTER TABLE metadata.user_deprovisioning_records ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "User managers see deprovisioning records" ON metadata.user_deprovisioning_records
+    FOR SELECT TO authenticated
+    USING (metadata.has_permission('civic_os_users_private', 'read'));
+
+GRANT SELECT ON metadata.user_deprovisioning_records TO authenticated;
+
+
+-- ============================================================================
+-- 3. REASSIGNABLE COLUMNS
+-- ============================================================================
+-- Most user columns record who did something (reviewed_by, cancelled_by) and
+-- must keep pointing at that person. Only the columns listed here mean
+-- "currently responsible" and move to the successor.
+
+CREATE TABLE metadata.user_reassignable_columns (
+    table_name NAME NOT NULL,
+    column_name NAME NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (table_name, column_name)
+);
+
+COMMENT ON TABLE metadata.user_reassignable_columns IS
+    'public table columns (foreign keys to civic_os_users) whose records move to reassign_to when a user is deprovisioned. References in other columns are flagged, not changed. Added in v0.94.0.';
+
+ALTER TABLE metadata.user_reassignable_columns ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Everyone reads reassignable columns" ON metadata.user_reassignable_columns
+    FOR SELECT TO authenticated
+    USING (true);
+
+GRANT SELECT ON metadata.user_reassignable_columns TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION metadata.user_owned_record_columns()
+RETURNS TABLE (table_name NAME, column_name NAME)
+LANGUAGE sql
+STABLE
+SET search_path = metadata, public
+AS $$
+    SELECT c.relname, a.attname
+    FROM pg_constraint fk
+    JOIN pg_class c ON c.oid = fk.conrelid
+    JOIN pg_namespace n ON n.oid = c.relnamespace
+    JOIN pg_attribute a ON a.attrelid = fk.conrelid AND a.attnum = fk.conkey[1]
+    WHERE fk.contype = 'f'
+      AND fk.confrelid = 'metadata.civic_os_users'::regclass
+      AND array_length(fk.conkey, 1) = 1
+      AND n.nspname = 'public'
+      AND c.relkind IN ('r', 'p')
+    ORDER BY c.relname, a.attname;
+$$;
+
+COMMENT ON FUNCTION metadata.user_owned_record_columns() IS
+    'Single-column foreign keys from public tables to metadata.civic_os_users: the columns checked for records when a user is deprovisioned. Added in v0.94.0.';
+
+
+CREATE OR REPLACE FUNCTION public.set_user_reassignable_column(
+    p_table_name NAME,
+    p_column_name NAME,
+    p_enabled BOOLEAN DEFAULT TRUE
+)
+RETURNS VOID
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    IF NOT p_enabled THEN
+        DELETE FROM metadata.user_reassignable_columns
+        WHERE table_name = p_table_name AND column_name = p_column_name;
+        RETURN;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM metadata.user_owned_record_columns() o
+        WHERE o.table_name = p_table_name AND o.column_name = p_column_name
+    ) THEN
+        RAISE EXCEPTION '%.% is not a foreign key to civic_os_users', p_table_name, p_column_name;
+    END IF;
+
+    INSERT INTO metadata.user_reassignable_columns (table_name, column_name)
+    VALUES (p_table_name, p_column_name)
+    ON CONFLICT DO NOTHING;
+END;
+$$;
+
+COMMENT ON FUNCTION public.set_user_reassignable_column(NAME, NAME, BOOLEAN) IS
+    'Admin-only. Marks (or unmarks) a user column whose records move to the successor when a user is deprovisioned. Added in v0.94.0.';
+
+REVOKE EXECUTE ON FUNCTION public.set_user_reassignable_column(NAME, NAME, BOOLEAN) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.set_user_reassignable_column(NAME, NAME, BOOLEAN) TO authenticated;
+
+
+-- ============================================================================
+-- 4. LOCKED PII
+-- ============================================================================
+
+CREATE TABLE metadata.deprovisioned_user_pii (
+    user_id UUID PRIMARY KEY REFERENCES metadata.civic_os_users(id),
+    deprovision_id BIGINT NOT NULL REFERENCES metadata.user_deprovisioning(id),
+    display_name TEXT,
+    email TEXT,
+    phone TEXT,
+    first_name TEXT,
+    last_name TEXT,
+    locked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.deprovisioned_user_pii IS
+    'Private details of users deprovisioned with the lock policy, moved out of civic_os_users_private so only admins can read them (get_deprovisioned_user_pii). No grants. Added in v0.94.0.';
+
+ALTER TABLE metadata.deprovisioned_user_pii ENABLE ROW LEVEL SECURITY;
+
+
+CREATE OR REPLACE FUNCTION public.get_deprovisioned_user_pii(p_user_id UUID)
+RETURNS TABLE (
+    user_id UUID,
+    display_name TEXT,
+    email TEXT,
+    phone TEXT,
+    first_name TEXT,
+    last_name TEXT,
+    locked_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Admin access required';
+    END IF;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'deprovisioned_pii_viewed',
+        jsonb_build_object('target_user_id', p_user_id)
+    );
+
+    RETURN QUERY
+    SELECT d.user_id, d.display_name, d.email, d.phone, d.first_name, d.last_name, d.locked_at
+    FROM metadata.deprovisioned_user_pii d
+    WHERE d.user_id = p_user_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_deprovisioned_user_pii(UUID) IS
+    'Admin-only. The locked private details of a deprovisioned user. Every call is logged in admin_audit_log (deprovisioned_pii_viewed). Added in v0.94.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_deprovisioned_user_pii(UUID) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_deprovisioned_user_pii(UUID) TO authenticated;
+
+
+-- ============================================================================
+-- 5. DATABASE SIDE OF DEPROVISIONING
+-- ============================================================================
+-- Called by the deprovision_user worker once Keycloak is done. Idempotent: a
+-- completed request returns its totals without doing anything again.
+
+CREATE OR REPLACE FUNCTION metadata.complete_user_deprovisioning(
+    p_deprovision_id BIGINT,
+    p_keycloak_disabled BOOLEAN,
+    p_roles_revoked TEXT[]
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_request metadata.user_deprovisioning;
+    v_column RECORD;
+    v_count INT;
+    v_reassigned INT := 0;
+    v_flagged INT := 0;
+BEGIN
+    SELECT * INTO v_request
+    FROM metadata.user_deprovisioning
+    WHERE id = p_deprovision_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Deprovisioning request % not found', p_deprovision_id;
+    END IF;
+
+    IF v_request.status = 'completed' THEN
+        RETURN jsonb_build_object(
+            'records_reassigned', v_request.records_reassigned,
+            'records_flagged', v_request.records_flagged
+        );
+    END IF;
+
+    -- Records referencing the user: reassign the configured columns, flag the rest
+    DELETE FROM metadata.user_deprovisioning_records WHERE deprovision_id = p_deprovision_id;
+
+    FOR v_column IN
+        SELECT o.table_name, o.column_name,
+               r.table_name IS NOT NULL AS reassignable
+        FROM metadata.user_owned_record_columns() o
+        LEFT JOIN metadata.user_reassignable_columns r
+          ON r.table_name = o.table_name AND r.column_name = o.column_name
+    LOOP
+        EXECUTE format('SELECT COUNT(*) FROM public.%I WHERE %I = $1',
+                       v_column.table_name, v_column.column_name)
+        INTO v_count
+        USING v_request.user_id;
+
+        CONTINUE WHEN v_count = 0;
+
+        IF v_column.reassignable AND v_request.reassign_to IS NOT NULL THEN
+            EXECUTE format('UPDATE public.%I SET %I = $2 WHERE %I = $1',
+                           v_column.table_name, v_column.column_name, v_column.column_name)
+            USING v_request.user_id, v_request.reassign_to;
+            v_reassigned := v_reassigned + v_count;
+        ELSE
+            v_flagged := v_flagged + v_count;
+        END IF;
+
+        INSERT INTO metadata.user_deprovisioning_records
+            (deprovision_id, table_name, column_name, record_count, action)
+        VALUES (
+            p_deprovision_id, v_column.table_name, v_column.column_name, v_count,
+            CASE WHEN v_column.reassignable AND v_request.reassign_to IS NOT NULL
+                 THEN 'reassigned' ELSE 'flagged' END
+        );
+    END LOOP;
+
+    -- PII: lock keeps a copy for admins; both policies clear the private row
+    IF v_request.pii_policy = 'lock' THEN
+        INSERT INTO metadata.deprovisioned_user_pii
+            (user_id, deprovision_id, display_name, email, phone, first_name, last_name)
+        SELECT p.id, p_deprovision_id, p.display_name, p.email, p.phone, p.first_name, p.last_name
+        FROM metadata.civic_os_users_private p
+        WHERE p.id = v_request.user_id
+        ON CONFLICT (user_id) DO UPDATE SET
+            deprovision_id = EXCLUDED.deprovision_id,
+            display_name = EXCLUDED.display_name,
+            email = EXCLUDED.email,
+            phone = EXCLUDED.phone,
+            first_name = EXCLUDED.first_name,
+            last_name = EXCLUDED.last_name,
+            locked_at = NOW();
+    ELSE
+        UPDATE metadata.civic_os_users
+        SET display_name = 'Former User', updated_at = NOW()
+        WHERE id = v_request.user_id;
+    END IF;
+
+    UPDATE metadata.civic_os_users_private
+    SET display_name = 'Former User', email = NULL, phone = NULL,
+        first_name = NULL, last_name = NULL, updated_at = NOW()
+    WHERE id = v_request.user_id;
+
+    UPDATE metadata.notification_preferences
+    SET enabled = FALSE, email_address = NULL, phone_number = NULL, updated_at = NOW()
+    WHERE user_id = v_request.user_id;
+
+    -- The worker has already removed the Keycloak mappings; the revoke jobs
+    -- the user_roles trigger queues find nothing left to do
+    DELETE FROM metadata.user_roles WHERE user_id = v_request.user_id;
+
+    UPDATE metadata.user_deprovisioning
+    SET status = 'completed',
+        keycloak_disabled = p_keycloak_disabled,
+        roles_revoked = COALESCE(p_roles_revoked, '{}'),
+        records_reassigned = v_reassigned,
+        records_flagged = v_flagged,
+        error_message = NULL,
+        completed_at = NOW()
+    WHERE id = p_deprovision_id;
+
+    RETURN jsonb_build_object(
+        'records_reassigned', v_reassigned,
+        'records_flagged', v_flagged
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.complete_user_deprovisioning(BIGINT, BOOLEAN, TEXT[]) IS
+    'Database side of deprovisioning, called by the deprovision_user worker after Keycloak: reassigns or flags records, locks or anonymizes PII, disables notifications, removes user_roles and marks the request completed. Added in v0.94.0.';
+
+
+-- ============================================================================
+-- 6. PUBLIC RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.request_user_deprovisioning(
+    p_user_id UUID,
+    p_pii_policy TEXT DEFAULT 'lock',
+    p_reassign_to UUID DEFAULT NULL,
+    p_reason TEXT DEFAULT NULL
+)
+RETURNS JSON
+LANGUAGE plpgsql
+VOLATILE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_role_key TEXT;
+    v_deprovision_id BIGINT;
+    v_job_id BIGINT;
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'update') THEN
+        RETURN json_build_object('success', false, 'error', 'Permission denied');
+    END IF;
+
+    IF p_user_id IS NULL OR NOT EXISTS (SELECT 1 FROM metadata.civic_os_users WHERE id = p_user_id) THEN
+        RETURN json_build_object('success', false, 'error', 'User not found');
+    END IF;
+
+    IF p_user_id = public.current_user_id() THEN
+        RETURN json_build_object('success', false, 'error', 'You cannot deprovision your own account');
+    END IF;
+
+    IF COALESCE(p_pii_policy, '') NOT IN ('lock', 'anonymize') THEN
+        RETURN json_build_object('success', false, 'error', 'PII policy must be lock or anonymize');
+    END IF;
+
+    IF p_reassign_to IS NOT NULL THEN
+        IF p_reassign_to = p_user_id
+           OR NOT EXISTS (SELECT 1 FROM metadata.civic_os_users WHERE id = p_reassign_to)
+           OR EXISTS (SELECT 1 FROM metadata.user_deprovisioning
+                      WHERE user_id = p_reassign_to AND status <> 'failed') THEN
+            RETURN json_build_object('success', false, 'error', 'Records can only be reassigned to another active user');
+        END IF;
+    END IF;
+
+    -- Managers can only offboard users whose every role they could assign
+    FOR v_role_key IN
+        SELECT r.role_key FROM metadata.user_roles ur
+        JOIN metadata.roles r ON r.id = ur.role_id
+        WHERE ur.user_id = p_user_id
+    LOOP
+        IF NOT can_manage_role(v_role_key) THEN
+            RETURN json_build_object('success', false,
+                'error', format('Your role cannot manage users with the "%s" role', v_role_key));
+        END IF;
+    END LOOP;
+
+    IF EXISTS (SELECT 1 FROM metadata.user_deprovisioning
+               WHERE user_id = p_user_id AND status <> 'failed') THEN
+        RETURN json_build_object('success', false, 'error', 'User is already deprovisioned or being deprovisioned');
+    END IF;
+
+    INSERT INTO metadata.user_deprovisioning (user_id, pii_policy, reassign_to, reason, requested_by)
+    VALUES (p_user_id, p_pii_policy, p_reassign_to, NULLIF(TRIM(p_reason), ''), public.current_user_id())
+    RETURNING id INTO v_deprovision_id;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'deprovision_user',
+        jsonb_build_object('deprovision_id', v_deprovision_id),
+        'user_provisioning',
+        1,
+        5,
+        NOW(),
+        'available'
+    )
+    RETURNING id INTO v_job_id;
+
+    UPDATE metadata.user_deprovisioning SET river_job_id = v_job_id WHERE id = v_deprovision_id;
+
+    INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+    VALUES (
+        public.current_user_id(),
+        public.current_user_email(),
+        'user_deprovision_requested',
+        jsonb_build_object('target_user_id', p_user_id, 'deprovision_id', v_deprovision_id,
+                           'pii_policy', p_pii_policy, 'reassign_to', p_reassign_to,
+                           'reason', NULLIF(TRIM(p_reason), ''))
+    );
+
+    RETURN json_build_object('success', true, 'deprovision_id', v_deprovision_id);
+END;
+$$;
+
+COMMENT ON FUNCTION public.request_user_deprovisioning(UUID, TEXT, UUID, TEXT) IS
+    'Offboard a user: records the request and queues a deprovision_user job. Requires civic_os_users_private update permission and the right to manage each of the user''s roles; users cannot offboard themselves. Returns JSON {success, deprovision_id} or {success, error}. Added in v0.94.0.';
+
+REVOKE EXECUTE ON FUNCTION public.request_user_deprovisioning(UUID, TEXT, UUID, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.request_user_deprovisioning(UUID, TEXT, UUID, TEXT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.get_user_deprovisioning(p_limit INT DEFAULT 50)
+RETURNS TABLE (
+    id BIGINT,
+    user_id UUID,
+    user_display_name TEXT,
+    pii_policy TEXT,
+    reassign_to UUID,
+    reason TEXT,
+    status TEXT,
+    keycloak_disabled BOOLEAN,
+    roles_revoked TEXT[],
+    records_reassigned INT,
+    records_flagged INT,
+    records JSONB,
+    error_message TEXT,
+    requested_by UUID,
+    created_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'read') THEN
+        RAISE EXCEPTION 'Permission denied: you do not have permission to view users';
+    END IF;
+
+    RETURN QUERY
+    SELECT d.id, d.user_id, u.display_name, d.pii_policy, d.reassign_to, d.reason, d.status,
+           d.keycloak_disabled, d.roles_revoked, d.records_reassigned, d.records_flagged,
+           COALESCE((
+               SELECT jsonb_agg(jsonb_build_object(
+                          'table_name', r.table_name, 'column_name', r.column_name,
+                          'record_count', r.record_count, 'action', r.action)
+                      ORDER BY r.table_name, r.column_name)
+               FROM metadata.user_deprovisioning_records r
+               WHERE r.deprovision_id = d.id
+           ), '[]'::JSONB),
+           d.error_message, d.requested_by, d.created_at, d.completed_at
+    FROM metadata.user_deprovisioning d
+    JOIN metadata.civic_os_users u ON u.id = d.user_id
+    ORDER BY d.created_at DESC
+    LIMIT LEAST(GREATEST(p_limit, 1), 500);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_user_deprovisioning(INT) IS
+    'Recent deprovisioning requests with their per-column record counts, newest first. Requires civic_os_users_private read permission. Added in v0.94.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_user_deprovisioning(INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_user_deprovisioning(INT) TO authenticated;
+
+
+-- ============================================================================
+-- 7. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{user_deprovisioning,user_deprovisioning_records,user_reassignable_columns,deprovisioned_user_pii,civic_os_users_private}',
+   '{}',
+   'v0-94-0-user-deprovisioning',
+   'Automated user deprovisioning',
+   'accepted',
+   'Users could be provisioned from Civic OS but not offboarded. Removing someone meant disabling them in the Keycloak console, revoking roles one by one, editing their private row by hand and hunting for records they owned, with nothing recording that it had happened.',
+   'request_user_deprovisioning() queues a deprovision_user job in the user_provisioning queue. The worker disables the Keycloak account, logs out its sessions and removes its direct realm role mappings, then complete_user_deprovisioning() does the database side in one transaction: references from public tables are reassigned to a successor for the columns in user_reassignable_columns and flagged (counted per column) for the rest, private details are cleared (kept in deprovisioned_user_pii under the lock policy, discarded and the public name replaced under anonymize), notification preferences are disabled and user_roles removed. The civic_os_users row stays.',
+   'Keeping the user row means no foreign key has to cascade and history still resolves to "Former User" or the original public name. Reassignment is opt-in per column because most user columns record who did something, and rewriting them would falsify history. Locked PII lives in a table with no grants so it drops out of every view that joins civic_os_users_private, without redefining those views.',
+   'Records in flagged columns still reference the departed user until someone acts on them. Under the lock policy the Keycloak account keeps its name and email (disabled); under anonymize they are cleared there too. The Keycloak user sync skips deprovisioned users. Reactivating a user is not automated.');
+
+COMMIT;
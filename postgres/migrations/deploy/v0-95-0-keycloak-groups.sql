@@ -0,0 +1,374 @@
+-- Deploy civic_os:v0-95-0-keycloak-groups to pg
+-- requires: v0-94-0-user-deprovisioning
+--
+-- v0.95.0 — Keycloak group sync alongside realm roles:
+--   1. metadata.groups: groups (e.g. departments) mirrored to Keycloak
+--   2. metadata.user_groups: group membership, like metadata.user_roles
+--   3. Triggers that enqueue sync_keycloak_group / assign_keycloak_group /
+--      revoke_keycloak_group River jobs, mirroring the v0.36.0 role triggers
+--   4. Deprovisioning clears the user's group memberships
+--   5. public.create_group() / delete_group() / assign_user_group() / revoke_user_group()
+--   6. Record schema decision
+--
+-- Groups are top-level Keycloak groups named by group_key, the same way
+-- realm roles are named by role_key. Membership changes flow from Civic OS
+-- to Keycloak only; the Keycloak user sync (v0.93.0) does not read groups.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. GROUPS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.groups (
+    id SMALLSERIAL PRIMARY KEY,
+    group_key TEXT NOT NULL UNIQUE,
+    display_name TEXT NOT NULL,
+    description TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE metadata.groups IS
+    'Groups mirrored to Keycloak as top-level groups, typically departments. Unlike roles, groups grant no permissions in Civic OS. Added in v0.95.0.';
+COMMENT ON COLUMN metadata.groups.group_key IS
+    'Keycloak group name. Defaults to a snake_case form of display_name; pass one to create_group() to adopt an existing Keycloak group.';
+
+ALTER TABLE metadata.groups ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Authenticated users can read groups" ON metadata.groups
+    FOR SELECT
+    TO authenticated
+    USING (true);
+
+GRANT SELECT ON metadata.groups TO authenticated;
+
+
+-- ============================================================================
+-- 2. USER GROUPS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.user_groups (
+    user_id UUID NOT NULL REFERENCES metadata.civic_os_users(id) ON DELETE CASCADE,
+    group_id SMALLINT NOT NULL REFERENCES metadata.groups(id) ON DELETE CASCADE,
+    synced_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, group_id)
+);
+
+CREATE INDEX idx_user_groups_group_id ON metadata.user_groups(group_id);
+
+COMMENT ON TABLE metadata.user_groups IS
+    'Maps users to groups. Inserts and deletes enqueue Keycloak membership jobs. Added in v0.95.0.';
+
+ALTER TABLE metadata.user_groups ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "Users see own groups" ON metadata.user_groups
+    FOR SELECT
+    USING (user_id = public.current_user_id());
+
+CREATE POLICY "User managers see all groups" ON metadata.user_groups
+    FOR SELECT
+    USING (metadata.has_permission('civic_os_users_private', 'read'));
+
+GRANT SELECT ON metadata.user_groups TO authenticated;
+
+
+-- ============================================================================
+-- 3. KEYCLOAK SYNC TRIGGERS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.trg_groups_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'sync_keycloak_group',
+            jsonb_build_object(
+                'group_name', NEW.group_key,
+                'description', COALESCE(NEW.description, ''),
+                'action', 'create'
+            ),
+            'user_provisioning', 1, 5, NOW(), 'available'
+        );
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'sync_keycloak_group',
+            jsonb_build_object(
+                'group_name', OLD.group_key,
+                'description', '',
+                'action', 'delete'
+            ),
+            'user_provisioning', 1, 5, NOW(), 'available'
+        );
+        RETURN OLD;
+    END IF;
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_groups_sync_keycloak() IS
+    'AFTER INSERT/DELETE trigger on metadata.groups. Enqueues a sync_keycloak_group River job to create/delete the group in Keycloak. Added in v0.95.0.';
+
+
+CREATE OR REPLACE FUNCTION metadata.trg_user_groups_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group_key TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        SELECT group_key INTO v_group_key FROM metadata.groups WHERE id = NEW.group_id;
+        IF v_group_key IS NULL THEN
+            RETURN NEW;
+        END IF;
+
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'assign_keycloak_group',
+            jsonb_build_object('user_id', NEW.user_id::text, 'group_name', v_group_key),
+            'user_provisioning', 1, 5, NOW(), 'available'
+        );
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        -- A CASCADE from a group deletion finds no group: deleting the group
+        -- in Keycloak drops its memberships, so no revoke job is needed
+        SELECT group_key INTO v_group_key FROM metadata.groups WHERE id = OLD.group_id;
+        IF v_group_key IS NULL THEN
+            RETURN OLD;
+        END IF;
+
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'revoke_keycloak_group',
+            jsonb_build_object('user_id', OLD.user_id::text, 'group_name', v_group_key),
+            'user_provisioning', 1, 5, NOW(), 'available'
+        );
+        RETURN OLD;
+    END IF;
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_user_groups_sync_keycloak() IS
+    'AFTER INSERT/DELETE trigger on metadata.user_groups. Enqueues assign/revoke Keycloak group River jobs. On DELETE, skips if the group is gone (CASCADE from a group deletion). Added in v0.95.0.';
+
+CREATE TRIGGER trg_groups_sync_keycloak
+    AFTER INSERT OR DELETE ON metadata.groups
+    FOR EACH ROW EXECUTE FUNCTION metadata.trg_groups_sync_keycloak();
+
+CREATE TRIGGER trg_user_groups_sync_keycloak
+    AFTER INSERT OR DELETE ON metadata.user_groups
+    FOR EACH ROW EXECUTE FUNCTION metadata.trg_user_groups_sync_keycloak();
+
+
+-- ============================================================================
+-- 4. DEPROVISIONING CLEARS GROUP MEMBERSHIP
+-- ============================================================================
+-- complete_user_deprovisioning() (v0.94.0) deletes user_roles; this trigger
+-- does the same for user_groups when a request completes, so the revoke jobs
+-- also remove the Keycloak memberships.
+
+CREATE OR REPLACE FUNCTION metadata.trg_user_deprovisioning_clear_groups()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    DELETE FROM metadata.user_groups WHERE user_id = NEW.user_id;
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_user_deprovisioning_clear_groups() IS
+    'AFTER UPDATE trigger on metadata.user_deprovisioning. Deletes the user''s group memberships when the request is completed. Added in v0.95.0.';
+
+CREATE TRIGGER trg_user_deprovisioning_clear_groups
+    AFTER UPDATE OF status ON metadata.user_deprovisioning
+    FOR EACH ROW
+    WHEN (NEW.status = 'completed' AND OLD.status IS DISTINCT FROM 'completed')
+    EXECUTE FUNCTION metadata.trg_user_deprovisioning_clear_groups();
+
+
+-- ============================================================================
+-- 5. RPCs
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.create_group(
+    p_display_name TEXT,
+    p_description TEXT DEFAULT NULL,
+    p_group_key TEXT DEFAULT NULL
+)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group_id SMALLINT;
+    v_group_key TEXT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RETURN json_build_object('success', false, 'error', 'Admin access required');
+    END IF;
+
+    IF p_display_name IS NULL OR TRIM(p_display_name) = '' THEN
+        RETURN json_build_object('success', false, 'error', 'Group name cannot be empty');
+    END IF;
+
+    v_group_key := COALESCE(
+        NULLIF(TRIM(p_group_key), ''),
+        LOWER(REGEXP_REPLACE(TRIM(p_display_name), '[^a-zA-Z0-9]+', '_', 'g'))
+    );
+    IF v_group_key LIKE '%/%' THEN
+        RETURN json_build_object('success', false, 'error', 'Group key cannot contain "/"');
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM metadata.groups WHERE group_key = v_group_key) THEN
+        RETURN json_build_object('success', false, 'error', format('Group with key "%s" already exists', v_group_key));
+    END IF;
+
+    -- trg_groups_sync_keycloak enqueues the Keycloak sync
+    INSERT INTO metadata.groups (group_key, display_name, description)
+    VALUES (v_group_key, TRIM(p_display_name), NULLIF(TRIM(p_description), ''))
+    RETURNING id INTO v_group_id;
+
+    RETURN json_build_object('success', true, 'group_id', v_group_id, 'group_key', v_group_key);
+END;
+$$;
+
+COMMENT ON FUNCTION public.create_group(TEXT, TEXT, TEXT) IS
+    'Create a group and its Keycloak group. Admin-only. group_key defaults to a snake_case form of the display name. Added in v0.95.0.';
+
+REVOKE EXECUTE ON FUNCTION public.create_group(TEXT, TEXT, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.create_group(TEXT, TEXT, TEXT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.delete_group(p_group_id SMALLINT)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_display_name TEXT;
+BEGIN
+    IF NOT public.is_admin() THEN
+        RETURN json_build_object('success', false, 'error', 'Admin access required');
+    END IF;
+
+    DELETE FROM metadata.groups WHERE id = p_group_id
+    RETURNING display_name INTO v_display_name;
+
+    IF v_display_name IS NULL THEN
+        RETURN json_build_object('success', false, 'error', 'Group not found');
+    END IF;
+
+    RETURN json_build_object('success', true, 'message', format('Group "%s" deleted', v_display_name));
+END;
+$$;
+
+COMMENT ON FUNCTION public.delete_group(SMALLINT) IS
+    'Delete a group and its Keycloak group. Admin-only. Added in v0.95.0.';
+
+REVOKE EXECUTE ON FUNCTION public.delete_group(SMALLINT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.delete_group(SMALLINT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.assign_user_group(p_user_id UUID, p_group_key TEXT)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group_id SMALLINT;
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'update') THEN
+        RETURN json_build_object('success', false, 'error', 'Permission denied: you do not have permission to manage users');
+    END IF;
+
+    SELECT id INTO v_group_id FROM metadata.groups WHERE group_key = p_group_key;
+    IF v_group_id IS NULL THEN
+        RETURN json_build_object('success', false, 'error', format('Group "%s" not found', p_group_key));
+    END IF;
+
+    INSERT INTO metadata.user_groups (user_id, group_id, synced_at)
+    VALUES (p_user_id, v_group_id, NOW())
+    ON CONFLICT (user_id, group_id) DO UPDATE SET synced_at = NOW();
+
+    RETURN json_build_object('success', true, 'message', format('Group "%s" assigned', p_group_key));
+END;
+$$;
+
+COMMENT ON FUNCTION public.assign_user_group(UUID, TEXT) IS
+    'Add a user to a group. Requires civic_os_users_private update permission. Added in v0.95.0.';
+
+REVOKE EXECUTE ON FUNCTION public.assign_user_group(UUID, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.assign_user_group(UUID, TEXT) TO authenticated;
+
+
+CREATE OR REPLACE FUNCTION public.revoke_user_group(p_user_id UUID, p_group_key TEXT)
+RETURNS JSON
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group_id SMALLINT;
+BEGIN
+    IF NOT metadata.has_permission('civic_os_users_private', 'update') THEN
+        RETURN json_build_object('success', false, 'error', 'Permission denied: you do not have permission to manage users');
+    END IF;
+
+    SELECT id INTO v_group_id FROM metadata.groups WHERE group_key = p_group_key;
+    IF v_group_id IS NULL THEN
+        RETURN json_build_object('success', false, 'error', format('Group "%s" not found', p_group_key));
+    END IF;
+
+    DELETE FROM metadata.user_groups WHERE user_id = p_user_id AND group_id = v_group_id;
+
+    RETURN json_build_object('success', true, 'message', format('Group "%s" revoked', p_group_key));
+END;
+$$;
+
+COMMENT ON FUNCTION public.revoke_user_group(UUID, TEXT) IS
+    'Remove a user from a group. Requires civic_os_users_private update permission. Added in v0.95.0.';
+
+REVOKE EXECUTE ON FUNCTION public.revoke_user_group(UUID, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.revoke_user_group(UUID, TEXT) TO authenticated;
+
+
+-- ============================================================================
+-- 6. SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{groups,user_groups,user_deprovisioning}',
+   '{}',
+   'v0-95-0-keycloak-groups',
+   'Keycloak group sync alongside realm roles',
+   'accepted',
+   'Deployments model departments as Keycloak groups, which other applications in the realm read from the token or the Admin API. Civic OS only synced realm roles, so department membership had to be maintained by hand in the Keycloak admin console.',
+   'metadata.groups and metadata.user_groups mirror metadata.roles and metadata.user_roles. AFTER INSERT/DELETE triggers enqueue sync_keycloak_group, assign_keycloak_group and revoke_keycloak_group jobs on the user_provisioning queue, the same trio as for roles. Groups are top-level Keycloak groups named by group_key. Completing a deprovisioning request deletes the user''s memberships.',
+   'Reusing the trigger-driven design from v0.36.0 means any path that changes membership (RPCs, migrations, init scripts) reaches Keycloak. Groups are kept apart from roles because they carry no Civic OS permissions; folding departments into roles would make every department a permission role.',
+   'Sync is one-way: groups or memberships changed in Keycloak are not brought back, and the Keycloak user sync ignores groups. Nested groups are not supported. Deleting a group in Civic OS deletes the Keycloak group of the same name, including one that existed before it was adopted.');
+
+COMMIT;
@@ -0,0 +1,100 @@
+-- Deploy civic_os:v0-96-0-welcome-delivery-status to pg
+-- requires: v0-95-0-keycloak-groups
+--
+-- v0.96.0 — Welcome notification delivery status on provisioning requests:
+--   1. metadata.user_provisioning.welcome_* columns
+--   2. Trigger that copies the welcome notification's status onto the
+--      provisioning request as the notification worker updates it
+--   3. Record schema decision
+--
+-- Since v0.43.0 the welcome message goes through the Civic OS notification
+-- system (template user_welcome) rather than Keycloak's execute-actions-email,
+-- but whether it was delivered was only visible in metadata.notifications.
+-- The provision worker now records which notification it queued and retries
+-- the job when queueing fails; this migration keeps the outcome next to the
+-- request.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. WELCOME COLUMNS
+-- ============================================================================
+
+ALTER TABLE metadata.user_provisioning
+    ADD COLUMN welcome_notification_id BIGINT REFERENCES metadata.notifications(id) ON DELETE SET NULL,
+    ADD COLUMN welcome_status VARCHAR(20),
+    ADD COLUMN welcome_error TEXT,
+    ADD COLUMN welcome_sent_at TIMESTAMPTZ,
+    ADD CONSTRAINT valid_welcome_status CHECK (
+        welcome_status IS NULL OR welcome_status IN ('queued', 'sent', 'failed')
+    );
+
+COMMENT ON COLUMN metadata.user_provisioning.welcome_notification_id IS
+    'The user_welcome notification the provision worker queued. Set once, so a retried job does not send a second welcome. Added in v0.96.0.';
+COMMENT ON COLUMN metadata.user_provisioning.welcome_status IS
+    'NULL when no welcome was requested or it has not been queued yet; queued, then sent or failed as the notification worker delivers it. failed with no welcome_notification_id means the notification could not be queued. Added in v0.96.0.';
+COMMENT ON COLUMN metadata.user_provisioning.welcome_error IS
+    'Why queueing or delivering the welcome notification failed. Added in v0.96.0.';
+
+CREATE INDEX idx_user_provisioning_welcome_notification
+    ON metadata.user_provisioning(welcome_notification_id)
+    WHERE welcome_notification_id IS NOT NULL;
+
+
+-- ============================================================================
+-- 2. COPY NOTIFICATION STATUS ONTO THE REQUEST
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION metadata.trg_notifications_welcome_status()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    UPDATE metadata.user_provisioning
+    SET welcome_status = NEW.status,
+        welcome_error = CASE WHEN NEW.status = 'failed' THEN NEW.error_message END,
+        welcome_sent_at = NEW.sent_at
+    WHERE welcome_notification_id = NEW.id;
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_notifications_welcome_status() IS
+    'AFTER UPDATE trigger on metadata.notifications. Copies a user_welcome notification''s sent/failed status onto the user_provisioning request that queued it. Added in v0.96.0.';
+
+CREATE TRIGGER trg_notifications_welcome_status
+    AFTER UPDATE OF status ON metadata.notifications
+    FOR EACH ROW
+    WHEN (NEW.template_name = 'user_welcome' AND NEW.status <> 'pending'
+          AND OLD.status IS DISTINCT FROM NEW.status)
+    EXECUTE FUNCTION metadata.trg_notifications_welcome_status();
+
+COMMENT ON COLUMN metadata.user_provisioning.send_welcome_email IS
+    'When true, the Go worker sends a Civic OS welcome notification (template: user_welcome) '
+    'instead of the Keycloak "set password" email. The notification links to the site login page '
+    'where users can sign in via social login or password. Delivery is tracked in welcome_status '
+    '(v0.96.0). Changed in v0.43.0.';
+
+
+-- ============================================================================
+-- 3. RECORD SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{user_provisioning,notifications}',
+   '{welcome_notification_id,welcome_status,welcome_error,welcome_sent_at}',
+   'v0-96-0-welcome-delivery-status',
+   'Track welcome notification delivery on provisioning requests',
+   'accepted',
+   'Admins asked for invitations to come from Civic OS with its branding rather than from Keycloak, and to see whether they arrived. The welcome has used the user_welcome notification template since v0.43.0, but the provision worker only logged a failure to queue it, and delivery status lived on a notification row nothing linked back to. Sending a Keycloak "set password" link through our own templates was also requested.',
+   'The provision worker queues the welcome before completing the request and stores the notification id in welcome_notification_id. If queueing fails it records welcome_status = failed and returns an error so River retries the job; on the last attempt the request completes anyway with the failure recorded. An AFTER UPDATE trigger on metadata.notifications copies sent/failed, the error and sent_at onto the request.',
+   'Keycloak''s Admin API has no endpoint that returns an action token or set-password link; execute-actions-email mints and mails it in one step. Short of a Keycloak extension, the only way to put such a link in our own template is to let Keycloak send it, so the welcome keeps linking to the sign-in page, where the login form offers social login and "Forgot password?".',
+   'Delivery retries remain the notification worker''s (transient SMTP and SMS errors); the provision job only retries queueing. A welcome re-sent by hand as a new notification is not tracked on the request. Users without a social login still set their first password through Keycloak''s own reset email.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
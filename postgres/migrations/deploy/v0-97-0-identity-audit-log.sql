@@ -0,0 +1,185 @@
+-- Deploy civic_os:v0-97-0-identity-audit-log to pg
+-- requires: v0-96-0-welcome-delivery-status
+--
+-- v0.97.0 — Audit trail for identity provider changes:
+--   1. metadata.identity_audit_log: one row per change the workers make in
+--      Keycloak (or authentik), with before/after state, job and actor
+--   2. Stamp the enqueuing database user on user_provisioning queue jobs
+--   3. public.get_identity_audit_log() for real admins
+--   4. Record schema decision
+--
+-- admin_audit_log only gets a row when a JWT user triggered the job, and its
+-- event_data is a free-form summary. A security review needs every change to
+-- the identity provider, including ones caused by migrations, init scripts
+-- or psql sessions, with the state it replaced.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. IDENTITY AUDIT LOG TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.identity_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- What changed
+    provider TEXT NOT NULL,              -- 'keycloak' or 'authentik'
+    operation TEXT NOT NULL,             -- e.g. 'user.create', 'role.assign', 'group.delete'
+    target_type TEXT NOT NULL,
+    target_id TEXT NOT NULL,             -- user ID, or role/group name
+    before_state JSONB,
+    after_state JSONB,
+
+    -- Which job changed it
+    job_id BIGINT NOT NULL,
+    job_kind TEXT NOT NULL,
+    job_attempt INT NOT NULL,
+
+    -- Who caused the job (args.audit, see v0-69-0-job-audit-context)
+    actor_id UUID,
+    on_behalf_of UUID,
+    impersonated_roles TEXT[],
+    request_id TEXT,
+    db_user TEXT,
+
+    CONSTRAINT valid_identity_audit_target_type CHECK (target_type IN ('user', 'role', 'group'))
+);
+
+COMMENT ON TABLE metadata.identity_audit_log IS
+    'Append-only log of every change the consolidated worker makes at the identity provider: user create/update/disable/anonymize/logout, role and group membership, role and group create/delete. Read via get_identity_audit_log(). Added in v0.97.0.';
+COMMENT ON COLUMN metadata.identity_audit_log.before_state IS
+    'State the change replaced: the user''s profile or direct roles. NULL when the target did not exist before, for group memberships (providers do not list them), or when the worker could not read it.';
+COMMENT ON COLUMN metadata.identity_audit_log.actor_id IS
+    'The JWT user whose request enqueued the job; with on_behalf_of and impersonated_roles it tells an admin acting as someone else apart from that user. NULL for jobs enqueued without a JWT.';
+COMMENT ON COLUMN metadata.identity_audit_log.db_user IS
+    'session_user of the connection that enqueued the job: authenticator for PostgREST requests, otherwise the role a migration, script or psql session logged in as.';
+
+CREATE INDEX idx_identity_audit_log_occurred_at ON metadata.identity_audit_log(occurred_at DESC);
+CREATE INDEX idx_identity_audit_log_target ON metadata.identity_audit_log(target_id, occurred_at DESC);
+CREATE INDEX idx_identity_audit_log_actor ON metadata.identity_audit_log(actor_id, occurred_at DESC)
+    WHERE actor_id IS NOT NULL;
+
+-- No policies: only the worker writes and only get_identity_audit_log() reads
+ALTER TABLE metadata.identity_audit_log ENABLE ROW LEVEL SECURITY;
+REVOKE ALL ON metadata.identity_audit_log FROM PUBLIC;
+
+
+-- ============================================================================
+-- 2. STAMP db_user ON IDENTITY JOBS
+-- ============================================================================
+-- Every identity job runs on the user_provisioning queue. Those jobs get an
+-- audit object with db_user even when there is no JWT (other queues keep
+-- the v0.69.0 behavior, so scheduler runs still have a NULL audit_context).
+
+CREATE OR REPLACE FUNCTION metadata.stamp_job_audit_context()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_audit JSONB;
+BEGIN
+    IF NEW.args ? 'audit' THEN
+        RETURN NEW;
+    END IF;
+
+    v_audit := metadata.job_audit_context();
+    IF NEW.queue = 'user_provisioning' THEN
+        v_audit := COALESCE(v_audit, '{}'::JSONB) || jsonb_build_object('db_user', session_user);
+    END IF;
+    IF v_audit IS NOT NULL THEN
+        NEW.args := NEW.args || jsonb_build_object('audit', v_audit);
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.stamp_job_audit_context() IS
+    'Adds args.audit (see job_audit_context) to River jobs enqueued from a user request so workers can attribute the records they create. user_provisioning queue jobs also get args.audit.db_user (session_user), with or without a JWT, for the identity audit log. Added in v0.69.0, db_user in v0.97.0.';
+
+
+-- ============================================================================
+-- 3. READ RPC
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.get_identity_audit_log(
+    p_target_id TEXT DEFAULT NULL,
+    p_actor_id UUID DEFAULT NULL,
+    p_limit INT DEFAULT 100,
+    p_offset INT DEFAULT 0
+)
+RETURNS TABLE (
+    id BIGINT,
+    occurred_at TIMESTAMPTZ,
+    provider TEXT,
+    operation TEXT,
+    target_type TEXT,
+    target_id TEXT,
+    before_state JSONB,
+    after_state JSONB,
+    job_id BIGINT,
+    job_kind TEXT,
+    job_attempt INT,
+    actor_id UUID,
+    actor_email TEXT,
+    on_behalf_of UUID,
+    impersonated_roles TEXT[],
+    request_id TEXT,
+    db_user TEXT
+)
+LANGUAGE plpgsql
+STABLE
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Real admins only: an admin impersonating a lesser role still qualifies,
+    -- a user impersonated by an admin does not
+    IF NOT metadata.is_real_admin() THEN
+        RAISE EXCEPTION 'Only admins can view the identity audit log'
+            USING ERRCODE = '42501';
+    END IF;
+
+    RETURN QUERY
+    SELECT l.id, l.occurred_at, l.provider, l.operation, l.target_type, l.target_id,
+           l.before_state, l.after_state, l.job_id, l.job_kind, l.job_attempt,
+           l.actor_id, p.email::TEXT, l.on_behalf_of, l.impersonated_roles, l.request_id, l.db_user
+    FROM metadata.identity_audit_log l
+    LEFT JOIN metadata.civic_os_users_private p ON p.id = l.actor_id
+    WHERE (p_target_id IS NULL OR l.target_id = p_target_id)
+      AND (p_actor_id IS NULL OR l.actor_id = p_actor_id OR l.on_behalf_of = p_actor_id)
+    ORDER BY l.occurred_at DESC, l.id DESC
+    LIMIT LEAST(GREATEST(COALESCE(p_limit, 100), 1), 1000)
+    OFFSET GREATEST(COALESCE(p_offset, 0), 0);
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_identity_audit_log(TEXT, UUID, INT, INT) IS
+    'Identity provider changes, newest first. Filter by target (user ID or role/group name) and/or actor (matches actor_id or on_behalf_of). Real admins only. Added in v0.97.0.';
+
+REVOKE EXECUTE ON FUNCTION public.get_identity_audit_log(TEXT, UUID, INT, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_identity_audit_log(TEXT, UUID, INT, INT) TO authenticated;
+
+
+-- ============================================================================
+-- 4. RECORD SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{identity_audit_log,river_job}',
+   '{}',
+   'v0-97-0-identity-audit-log',
+   'Audit trail for identity provider changes',
+   'accepted',
+   'Security reviews need to reconstruct who changed which account, role or group at the identity provider and when. admin_audit_log only records jobs triggered by a JWT user, carries a free-form summary without the prior state, and role and group create/delete jobs wrote nothing at all. Changes made by migrations or psql sessions were untraceable.',
+   'A dedicated metadata.identity_audit_log gets one row per change from every worker that writes to the provider (provision, update, deprovision, role and group sync). Rows carry the operation, target, before/after state, job id, kind and attempt, and the job''s audit context. stamp_job_audit_context() adds db_user (session_user) to user_provisioning queue jobs even without a JWT. get_identity_audit_log() is limited to real admins.',
+   'A typed table can be indexed by target and actor and kept apart from the mixed admin_audit_log. Recording actor_id, on_behalf_of and impersonated_roles separately keeps admin impersonation from being mistaken for the impersonated user. Writing from the worker after each call means the log shows what happened at the provider, not what was requested.',
+   'States are read back from the provider, adding one or two GETs per change; unreadable states are stored as NULL. Writing the log is best-effort like admin_audit_log, so a database failure right after a provider change leaves that change unlogged. Rows keep the profile as it was, including email and name, after a user is anonymized; the table has no retention policy yet.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,99 @@
+-- Deploy civic_os:v0-99-0-source-lint-findings to pg
+-- requires: v0-98-0-source-parser-coverage
+--
+-- v0.99.0 — Lint pass over parsed source code:
+--   1. metadata.source_lint_findings: problems ParseAllSourceCodeWorker
+--      finds in each parsed object, with a severity
+--   2. public.source_lint_findings view for the admin UI
+--   3. Clear stored source hashes so the next parse run lints every object
+--   4. Record schema decision
+--
+-- The worker replaces an object's findings whenever it re-parses the object,
+-- in the same transaction as the AST upsert.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. LINT FINDINGS TABLE
+-- ============================================================================
+
+CREATE TABLE metadata.source_lint_findings (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- The object, as keyed in parsed_source_code
+    schema_name NAME NOT NULL,
+    object_name NAME NOT NULL,
+    object_type TEXT NOT NULL,
+    table_name NAME NOT NULL DEFAULT '',
+
+    rule TEXT NOT NULL,                  -- e.g. 'security_definer_search_path'
+    severity TEXT NOT NULL,
+    message TEXT NOT NULL,
+    detail TEXT,                         -- offending code, e.g. 'line 12: ''DELETE FROM '' || t'
+    found_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT source_lint_findings_severity_check CHECK (severity IN ('error', 'warning', 'info')),
+    CONSTRAINT source_lint_findings_object_fkey
+        FOREIGN KEY (schema_name, object_name, object_type, table_name)
+        REFERENCES metadata.parsed_source_code (schema_name, object_name, object_type, table_name)
+        ON DELETE CASCADE
+);
+
+COMMENT ON TABLE metadata.source_lint_findings IS
+    'Static analysis findings for parsed functions, views and policies: SECURITY DEFINER without search_path, concatenated dynamic SQL, SELECT *, functions left VOLATILE. Written by the Go consolidated worker when it re-parses an object; removed with the parsed_source_code row. Added in v0.99.0.';
+COMMENT ON COLUMN metadata.source_lint_findings.rule IS
+    'security_definer_search_path, dynamic_sql_concat, select_star or missing_volatility. See docs/notes/CODE_BLOCK_SYSTEM_DESIGN.md.';
+
+CREATE INDEX idx_source_lint_findings_object
+    ON metadata.source_lint_findings(schema_name, object_name, object_type, table_name);
+CREATE INDEX idx_source_lint_findings_severity ON metadata.source_lint_findings(severity, rule);
+
+GRANT SELECT ON metadata.source_lint_findings TO authenticated;
+
+
+-- ============================================================================
+-- 2. ADMIN VIEW
+-- ============================================================================
+
+CREATE VIEW public.source_lint_findings
+WITH (security_invoker = true) AS
+SELECT f.id, f.schema_name, f.object_name, f.object_type, f.table_name,
+       f.rule, f.severity, f.message, f.detail, f.found_at
+FROM metadata.source_lint_findings f
+WHERE metadata.is_admin();
+
+COMMENT ON VIEW public.source_lint_findings IS
+    'Lint findings for parsed source code, admin-only like schema_rls_policies. Added in v0.99.0.';
+
+GRANT SELECT ON public.source_lint_findings TO authenticated;
+
+
+-- ============================================================================
+-- 3. FORCE A FULL RE-PARSE
+-- ============================================================================
+-- The worker skips objects whose hash is unchanged, so existing rows would
+-- never be linted. The NOTIFY below makes the listener enqueue the parse.
+
+UPDATE metadata.parsed_source_code SET source_hash = '';
+
+
+-- ============================================================================
+-- 4. RECORD SCHEMA DECISION
+-- ============================================================================
+
+INSERT INTO metadata.schema_decisions
+  (entity_types, property_names, migration_id, title, status, context, decision, rationale, consequences)
+VALUES
+  ('{source_lint_findings,parsed_source_code}',
+   '{}',
+   'v0-99-0-source-lint-findings',
+   'Lint pass over parsed source code',
+   'accepted',
+   'Integrator schemas accumulate functions and views with common problems: SECURITY DEFINER functions without a fixed search_path (a privilege escalation risk), EXECUTE with concatenated strings (SQL injection), SELECT * that silently changes with the underlying table, and functions left VOLATILE that the planner cannot cache. Nothing surfaced these; the parser already had every AST in hand.',
+   'ParseAllSourceCodeWorker lints each object right after parsing it and replaces the object''s rows in metadata.source_lint_findings in the same transaction as the AST upsert. Catalog rules use pg_proc (prosecdef, proconfig, provolatile); AST rules walk the pg_query JSON, re-parsing SQL embedded in plpgsql statements. Admins read findings through public.source_lint_findings.',
+   'Linting where objects are parsed reuses the hash-based skip, so unchanged objects cost nothing, and the Go AST walk avoids a second parser in the database. A foreign key with ON DELETE CASCADE removes findings with their object without extra cleanup code.',
+   'Findings only refresh when an object''s source changes, so new or changed rules need another hash reset to apply to existing objects. missing_volatility cannot tell an explicit VOLATILE from the default and is only informational. PostgreSQL expands a top-level * in stored view definitions, so select_star mostly catches function bodies and subqueries.');
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,343 @@
+-- Revert civic_os:v0-100-0-notify-job-triggers from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-100-0-notify-job-triggers';
+
+-- Restore the river_job inserts
+CREATE OR REPLACE FUNCTION public.create_recurring_series(
+    p_group_name TEXT,
+    p_group_description TEXT DEFAULT NULL,
+    p_group_color TEXT DEFAULT NULL,
+    p_entity_table NAME DEFAULT NULL,
+    p_entity_template JSONB DEFAULT '{}',
+    p_rrule TEXT DEFAULT NULL,
+    p_dtstart TIMESTAMP DEFAULT NULL,
+    p_duration INTERVAL DEFAULT NULL,
+    p_timezone TEXT DEFAULT NULL,
+    p_time_slot_property NAME DEFAULT 'time_slot',
+    p_expand_now BOOLEAN DEFAULT FALSE,
+    p_skip_conflicts BOOLEAN DEFAULT FALSE,
+    p_expand_horizon_days INTEGER DEFAULT 90
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_group_id BIGINT;
+    v_series_id BIGINT;
+    v_user_id UUID;
+BEGIN
+    -- Get current user
+    v_user_id := public.current_user_id();
+
+    -- Validate required fields
+    IF p_entity_table IS NULL THEN
+        RAISE EXCEPTION 'entity_table is required';
+    END IF;
+    IF p_rrule IS NULL THEN
+        RAISE EXCEPTION 'rrule is required';
+    END IF;
+    IF p_dtstart IS NULL THEN
+        RAISE EXCEPTION 'dtstart is required';
+    END IF;
+    IF p_duration IS NULL THEN
+        RAISE EXCEPTION 'duration is required';
+    END IF;
+
+    -- Validate RRULE (will raise exception if invalid)
+    PERFORM metadata.validate_rrule(p_rrule);
+
+    -- Validate entity template
+    PERFORM metadata.validate_entity_template(p_entity_table, p_entity_template);
+
+    -- Create group
+    INSERT INTO metadata.time_slot_series_groups (
+        display_name, description, color, created_by
+    ) VALUES (
+        p_group_name, p_group_description, p_group_color, v_user_id
+    ) RETURNING id INTO v_group_id;
+
+    -- Create series (dtstart is now local wall-clock time, effective_from is just the date)
+    INSERT INTO metadata.time_slot_series (
+        group_id, version_number, effective_from, entity_table,
+        entity_template, rrule, dtstart, duration, timezone,
+        time_slot_property, status, created_by
+    ) VALUES (
+        v_group_id, 1, p_dtstart::DATE, p_entity_table,
+        p_entity_template, p_rrule, p_dtstart, p_duration, p_timezone,
+        p_time_slot_property, 'active', v_user_id
+    ) RETURNING id INTO v_series_id;
+
+    -- If expand_now is true, queue expansion job
+    IF p_expand_now THEN
+        -- Queue River job for expansion (p_expand_horizon_days from TODAY)
+        INSERT INTO metadata.river_job (state, queue, kind, args, max_attempts, created_at, scheduled_at)
+        VALUES (
+            'available',
+            'recurring',
+            'expand_recurring_series',
+            jsonb_build_object(
+                'series_id', v_series_id,
+                'expand_until', to_char((NOW() + (p_expand_horizon_days || ' days')::INTERVAL)::TIMESTAMPTZ, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+            ),
+            3,
+            NOW(),
+            NOW()
+        );
+    END IF;
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'group_id', v_group_id,
+        'series_id', v_series_id,
+        'message', 'Recurring series created successfully'
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.update_series_schedule(
+    p_series_id BIGINT,
+    p_dtstart TIMESTAMP,
+    p_duration INTERVAL,
+    p_rrule TEXT,
+    p_expand_horizon_days INTEGER DEFAULT 90
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_series RECORD;
+    v_user_id UUID;
+    v_entity_ids BIGINT[];
+    v_kept_ids BIGINT[] := '{}';
+    v_entity_id BIGINT;
+    v_deleted_count INT := 0;
+    v_expand_until DATE;
+BEGIN
+    v_user_id := public.current_user_id();
+
+    -- Get series
+    SELECT * INTO v_series
+    FROM metadata.time_slot_series
+    WHERE id = p_series_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series not found');
+    END IF;
+
+    -- Check permissions (creator or has update permission or admin)
+    IF NOT (
+        v_series.created_by = v_user_id
+        OR public.has_permission('time_slot_series', 'update')
+        OR public.is_admin()
+    ) THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Permission denied');
+    END IF;
+
+    -- Validate RRULE (will raise exception if invalid)
+    PERFORM metadata.validate_rrule(p_rrule);
+
+    -- Wait for any expansion transaction on this series to finish
+    IF NOT metadata.try_lock_entity('time_slot_series', p_series_id::TEXT, INTERVAL '30 seconds') THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series is being expanded; try again shortly');
+    END IF;
+
+    -- Step 1: Collect entity IDs from non-exception instances, keeping rows
+    -- someone else is editing
+    FOR v_entity_id IN
+        SELECT entity_id
+        FROM metadata.time_slot_instances
+        WHERE series_id = p_series_id
+          AND entity_id IS NOT NULL
+          AND is_exception = FALSE
+    LOOP
+        IF metadata.try_lock_entity(v_series.entity_table, v_entity_id::TEXT, INTERVAL '0', v_user_id) THEN
+            v_entity_ids := array_append(v_entity_ids, v_entity_id);
+        ELSE
+            PERFORM metadata.record_entity_lock_conflict(
+                v_series.entity_table, v_entity_id::TEXT,
+                'update_series_schedule', 'skip', NULL, v_user_id);
+            v_kept_ids := v_kept_ids || v_entity_id;
+        END IF;
+    END LOOP;
+
+    IF cardinality(v_kept_ids) > 0 THEN
+        UPDATE metadata.time_slot_instances
+        SET
+            is_exception = TRUE,
+            exception_type = 'modified',
+            exception_reason = 'Kept during schedule change: being edited',
+            exception_at = NOW(),
+            exception_by = v_user_id
+        WHERE series_id = p_series_id
+          AND entity_id = ANY(v_kept_ids);
+    END IF;
+
+    -- Step 2: Delete entity records
+    IF v_entity_ids IS NOT NULL AND array_length(v_entity_ids, 1) > 0 THEN
+        EXECUTE format(
+            'DELETE FROM public.%I WHERE id = ANY($1)',
+            v_series.entity_table
+        ) USING v_entity_ids;
+        GET DIAGNOSTICS v_deleted_count = ROW_COUNT;
+    END IF;
+
+    -- Step 3: Delete non-exception instances
+    DELETE FROM metadata.time_slot_instances
+    WHERE series_id = p_series_id AND is_exception = FALSE;
+
+    -- Step 4: Update series schedule and reset expansion tracking
+    UPDATE metadata.time_slot_series
+    SET
+        dtstart = p_dtstart,
+        duration = p_duration,
+        rrule = p_rrule,
+        expanded_until = NULL,  -- Reset to trigger fresh expansion
+        effective_from = p_dtstart::DATE
+    WHERE id = p_series_id;
+
+    -- Step 5: Calculate expansion horizon (p_expand_horizon_days from TODAY)
+    v_expand_until := (NOW() + (p_expand_horizon_days || ' days')::INTERVAL)::DATE;
+
+    -- Step 6: Queue River job for expansion
+    INSERT INTO metadata.river_job (state, queue, kind, args, max_attempts, created_at, scheduled_at)
+    VALUES (
+        'available',
+        'recurring',
+        'expand_recurring_series',
+        jsonb_build_object(
+            'series_id', p_series_id,
+            'expand_until', to_char(v_expand_until::TIMESTAMPTZ, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+        ),
+        3,
+        NOW(),
+        NOW()
+    );
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', CASE WHEN cardinality(v_kept_ids) > 0
+            THEN format('Schedule updated. Deleted %s old records; kept %s being edited by someone else. Expansion queued.', v_deleted_count, cardinality(v_kept_ids))
+            ELSE format('Schedule updated. Deleted %s old records. Expansion queued.', v_deleted_count)
+        END,
+        'series_id', p_series_id,
+        'entities_deleted', v_deleted_count,
+        'entities_kept', cardinality(v_kept_ids),
+        'kept_entity_ids', to_jsonb(v_kept_ids),
+        'expand_until', v_expand_until
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.expand_series_instances(
+    p_series_id BIGINT,
+    p_expand_until DATE
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_series RECORD;
+BEGIN
+    -- Get series
+    SELECT * INTO v_series
+    FROM metadata.time_slot_series
+    WHERE id = p_series_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series not found');
+    END IF;
+
+    -- Update expanded_until to signal worker
+    UPDATE metadata.time_slot_series
+    SET expanded_until = GREATEST(COALESCE(expanded_until, '1970-01-01'::DATE), p_expand_until)
+    WHERE id = p_series_id;
+
+    -- Queue River job (Go worker picks up and processes)
+    -- Note: expand_until must be ISO8601 timestamp for Go parsing
+    INSERT INTO metadata.river_job (state, queue, kind, args, max_attempts, created_at, scheduled_at)
+    VALUES (
+        'available',
+        'recurring',
+        'expand_recurring_series',
+        jsonb_build_object('series_id', p_series_id, 'expand_until', to_char(p_expand_until::TIMESTAMPTZ, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')),
+        3,
+        NOW(),
+        NOW()
+    );
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', 'Expansion queued',
+        'series_id', p_series_id,
+        'expand_until', p_expand_until
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION insert_thumbnail_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Only create job if thumbnail_status is 'pending'
+    IF NEW.thumbnail_status = 'pending' THEN
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts)
+        VALUES (
+            'thumbnail_generate',
+            jsonb_build_object('file_id', NEW.id::text),
+            'thumbnails',
+            1,
+            25
+        );
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON FUNCTION insert_thumbnail_job() IS
+  'Trigger function to create River job for thumbnail generation. Passes only file_id; worker queries metadata.files for all file details.';
+
+CREATE OR REPLACE FUNCTION public.enqueue_notification_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'send_notification',
+        jsonb_build_object(
+            'notification_id', NEW.id::text,
+            'user_id', NEW.user_id::text,
+            'template_name', NEW.template_name,
+            'entity_type', NEW.entity_type,
+            'entity_id', NEW.entity_id,
+            'entity_data', NEW.entity_data,
+            'channels', NEW.channels,
+            'attachments', NEW.attachments
+        ),
+        'notifications',  -- Queue name
+        1,                -- Priority (higher = more urgent)
+        5,                -- Max attempts (fewer than file jobs - emails are idempotent)
+        NOW(),            -- Schedule immediately
+        'available'       -- Job state
+    );
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION public.enqueue_notification_job() IS NULL;
+
+DROP FUNCTION IF EXISTS metadata.request_series_expansion(BIGINT, DATE);
+
+ALTER TABLE metadata.time_slot_series
+    DROP COLUMN IF EXISTS expansion_requested_until;
+
+COMMIT;
@@ -0,0 +1,239 @@
+-- Revert civic_os:v0-101-0-transactional-outbox from pg
+-- Pending outbox messages are dropped; re-save the roles or memberships
+-- involved to queue their Keycloak sync again.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-101-0-transactional-outbox';
+
+-- Restore the v0.36.0 / v0.95.0 trigger functions that queue River jobs
+CREATE OR REPLACE FUNCTION metadata.trg_roles_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    -- Skip built-in roles — these exist in Keycloak realm config already
+    IF NEW.role_key IN ('anonymous', 'user', 'admin', 'editor', 'manager') THEN
+      RETURN NEW;
+    END IF;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+      'sync_keycloak_role',
+      jsonb_build_object(
+        'role_name', NEW.role_key,
+        'description', COALESCE(NEW.description, ''),
+        'action', 'create'
+      ),
+      'user_provisioning',
+      1,
+      5,
+      NOW(),
+      'available'
+    );
+
+    RETURN NEW;
+  END IF;
+
+  IF TG_OP = 'DELETE' THEN
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+      'sync_keycloak_role',
+      jsonb_build_object(
+        'role_name', OLD.role_key,
+        'description', '',
+        'action', 'delete'
+      ),
+      'user_provisioning',
+      1,
+      5,
+      NOW(),
+      'available'
+    );
+
+    RETURN OLD;
+  END IF;
+
+  RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_roles_sync_keycloak() IS
+  'AFTER INSERT/DELETE trigger on metadata.roles. Enqueues sync_keycloak_role
+   River job to create/delete the role in Keycloak. Skips built-in roles
+   (anonymous, user, admin, editor, manager) on INSERT. Added in v0.36.0.';
+
+CREATE OR REPLACE FUNCTION metadata.trg_user_roles_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+  v_role_key TEXT;
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    SELECT role_key INTO v_role_key
+    FROM metadata.roles
+    WHERE id = NEW.role_id;
+
+    -- If role not found (shouldn't happen due to FK), skip
+    IF v_role_key IS NULL THEN
+      RETURN NEW;
+    END IF;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+      'assign_keycloak_role',
+      jsonb_build_object(
+        'user_id', NEW.user_id::text,
+        'role_name', v_role_key
+      ),
+      'user_provisioning',
+      1,
+      5,
+      NOW(),
+      'available'
+    );
+
+    RETURN NEW;
+  END IF;
+
+  IF TG_OP = 'DELETE' THEN
+    -- Use LEFT JOIN to handle CASCADE deletes where role may already be gone
+    SELECT role_key INTO v_role_key
+    FROM metadata.roles
+    WHERE id = OLD.role_id;
+
+    -- If role not found (CASCADE deleted), skip — the roles trigger already
+    -- enqueued the role deletion job
+    IF v_role_key IS NULL THEN
+      RETURN OLD;
+    END IF;
+
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+      'revoke_keycloak_role',
+      jsonb_build_object(
+        'user_id', OLD.user_id::text,
+        'role_name', v_role_key
+      ),
+      'user_provisioning',
+      1,
+      5,
+      NOW(),
+      'available'
+    );
+
+    RETURN OLD;
+  END IF;
+
+  RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_user_roles_sync_keycloak() IS
+  'AFTER INSERT/DELETE trigger on metadata.user_roles. Enqueues assign/revoke
+   Keycloak role River jobs. On DELETE, skips if role not found (CASCADE from
+   role deletion — the roles trigger handles that case). Added in v0.36.0.';
+
+CREATE OR REPLACE FUNCTION metadata.trg_groups_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'sync_keycloak_group',
+            jsonb_build_object(
+                'group_name', NEW.group_key,
+                'description', COALESCE(NEW.description, ''),
+                'action', 'create'
+            ),
+            'user_provisioning', 1, 5, NOW(), 'available'
+        );
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'sync_keycloak_group',
+            jsonb_build_object(
+                'group_name', OLD.group_key,
+                'description', '',
+                'action', 'delete'
+            ),
+            'user_provisioning', 1, 5, NOW(), 'available'
+        );
+        RETURN OLD;
+    END IF;
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_groups_sync_keycloak() IS
+    'AFTER INSERT/DELETE trigger on metadata.groups. Enqueues a sync_keycloak_group River job to create/delete the group in Keycloak. Added in v0.95.0.';
+
+CREATE OR REPLACE FUNCTION metadata.trg_user_groups_sync_keycloak()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_group_key TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        SELECT group_key INTO v_group_key FROM metadata.groups WHERE id = NEW.group_id;
+        IF v_group_key IS NULL THEN
+            RETURN NEW;
+        END IF;
+
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'assign_keycloak_group',
+            jsonb_build_object('user_id', NEW.user_id::text, 'group_name', v_group_key),
+            'user_provisioning', 1, 5, NOW(), 'available'
+        );
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        -- A CASCADE from a group deletion finds no group: deleting the group
+        -- in Keycloak drops its memberships, so no revoke job is needed
+        SELECT group_key INTO v_group_key FROM metadata.groups WHERE id = OLD.group_id;
+        IF v_group_key IS NULL THEN
+            RETURN OLD;
+        END IF;
+
+        INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+        VALUES (
+            'revoke_keycloak_group',
+            jsonb_build_object('user_id', OLD.user_id::text, 'group_name', v_group_key),
+            'user_provisioning', 1, 5, NOW(), 'available'
+        );
+        RETURN OLD;
+    END IF;
+
+    RETURN NULL;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.trg_user_groups_sync_keycloak() IS
+    'AFTER INSERT/DELETE trigger on metadata.user_groups. Enqueues assign/revoke Keycloak group River jobs. On DELETE, skips if the group is gone (CASCADE from a group deletion). Added in v0.95.0.';
+
+DROP FUNCTION IF EXISTS public.retry_outbox_message(BIGINT);
+DROP VIEW IF EXISTS public.outbox_messages;
+DROP FUNCTION IF EXISTS metadata.enqueue_outbox_message(TEXT, TEXT, JSONB);
+DROP TABLE IF EXISTS metadata.outbox_messages;
+DROP FUNCTION IF EXISTS metadata.notify_outbox_message();
+
+COMMIT;
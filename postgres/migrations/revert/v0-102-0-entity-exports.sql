@@ -0,0 +1,17 @@
+-- Revert civic_os:v0-102-0-entity-exports from pg
+-- Generated files under exports/ stay in S3; delete them separately if needed.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-102-0-entity-exports';
+
+DROP FUNCTION IF EXISTS public.get_entity_exports(INT);
+DROP FUNCTION IF EXISTS public.request_entity_export(NAME, TEXT, JSONB, TEXT[], TEXT);
+
+DELETE FROM metadata.notification_templates
+WHERE name = 'entity_export_ready'
+  AND NOT EXISTS (SELECT 1 FROM metadata.notifications WHERE template_name = 'entity_export_ready');
+
+DROP TABLE IF EXISTS metadata.entity_exports;
+
+COMMIT;
@@ -0,0 +1,20 @@
+-- Revert civic_os:v0-103-0-entity-imports from pg
+-- Rows already imported stay in their tables.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-103-0-entity-imports';
+
+DROP FUNCTION IF EXISTS public.get_entity_import_errors(BIGINT);
+DROP FUNCTION IF EXISTS public.get_entity_imports(INT);
+DROP FUNCTION IF EXISTS public.start_entity_import(BIGINT);
+DROP FUNCTION IF EXISTS public.request_entity_import(NAME, UUID, JSONB, BOOLEAN);
+
+DELETE FROM metadata.notification_templates
+WHERE name = 'entity_import_summary'
+  AND NOT EXISTS (SELECT 1 FROM metadata.notifications WHERE template_name = 'entity_import_summary');
+
+DROP TABLE IF EXISTS metadata.entity_import_errors;
+DROP TABLE IF EXISTS metadata.entity_imports;
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- Revert civic_os:v0-104-0-webhook-signing from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.get_entity_webhook_subscriptions();
+
+DROP TRIGGER IF EXISTS reset_entity_webhook_failures_trigger ON metadata.entity_webhook_subscriptions;
+DROP FUNCTION IF EXISTS metadata.reset_entity_webhook_failures();
+
+ALTER TABLE metadata.entity_webhook_subscriptions
+    DROP COLUMN IF EXISTS disabled_reason,
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS disable_after_failures,
+    DROP COLUMN IF EXISTS consecutive_failures,
+    DROP COLUMN IF EXISTS signing_secret_name;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-104-0-webhook-signing';
+
+COMMIT;
@@ -0,0 +1,22 @@
+-- Revert civic_os:v0-105-0-entity-audit-log from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.get_entity_audit_log(NAME, TEXT, UUID, INT, INT);
+DROP FUNCTION IF EXISTS metadata.disable_entity_audit(NAME);
+DROP FUNCTION IF EXISTS metadata.enable_entity_audit(NAME, INT);
+
+-- Drops the entity_audit_capture triggers that use it
+DROP FUNCTION IF EXISTS metadata.capture_entity_changes() CASCADE;
+
+DROP TABLE IF EXISTS metadata.entity_audit_retention;
+DROP TABLE IF EXISTS metadata.entity_audit_log;
+DROP TABLE IF EXISTS metadata.entity_changes;
+
+DELETE FROM metadata.river_job WHERE kind = 'entity_audit_capture' AND state NOT IN ('completed', 'discarded', 'cancelled');
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-105-0-entity-audit-log';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
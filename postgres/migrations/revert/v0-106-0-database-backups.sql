@@ -0,0 +1,144 @@
+-- Revert civic_os:v0-106-0-database-backups from pg
+
+BEGIN;
+
+CREATE OR REPLACE FUNCTION public.trigger_scheduled_job(p_job_name VARCHAR(100))
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_job RECORD;
+    v_run_id BIGINT;
+    v_result JSONB;
+    v_start_time TIMESTAMPTZ;
+    v_end_time TIMESTAMPTZ;
+    v_duration_ms INT;
+BEGIN
+    -- Permission check
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can trigger scheduled jobs'
+            USING HINT = 'Contact an administrator to run this job';
+    END IF;
+
+    -- Find the job
+    SELECT * INTO v_job
+    FROM metadata.scheduled_jobs
+    WHERE name = p_job_name;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Scheduled job not found: %', p_job_name;
+    END IF;
+
+    -- HTTP targets can't run inside the database: hand off to the worker.
+    -- The result (status code, response body) lands in scheduled_job_runs.
+    IF v_job.target_type = 'http' THEN
+        INSERT INTO metadata.river_job (state, queue, kind, args, priority, max_attempts, scheduled_at)
+        VALUES (
+            'available',
+            'scheduled_jobs',
+            'scheduled_job_http',
+            jsonb_build_object(
+                'job_id', v_job.id,
+                'job_name', v_job.name,
+                'scheduled_for', NOW(),
+                'triggered_by', 'manual'
+            ),
+            2,
+            3,
+            NOW()
+        );
+
+        RETURN jsonb_build_object(
+            'success', true,
+            'queued', true,
+            'job_name', v_job.name,
+            'message', 'HTTP job queued; see run history for the response'
+        );
+    END IF;
+
+    -- Create run record
+    v_start_time := NOW();
+    INSERT INTO metadata.scheduled_job_runs (job_id, started_at, triggered_by)
+    VALUES (v_job.id, v_start_time, 'manual')
+    RETURNING id INTO v_run_id;
+
+    -- Execute the function dynamically
+    BEGIN
+        EXECUTE format('SELECT %I()', v_job.function_name) INTO v_result;
+        v_end_time := NOW();
+        v_duration_ms := EXTRACT(EPOCH FROM (v_end_time - v_start_time)) * 1000;
+
+        -- Update run record with result
+        UPDATE metadata.scheduled_job_runs
+        SET completed_at = v_end_time,
+            duration_ms = v_duration_ms,
+            success = COALESCE((v_result->>'success')::boolean, true),
+            message = v_result->>'message',
+            details = v_result
+        WHERE id = v_run_id;
+
+        -- Update last_run_at on job
+        UPDATE metadata.scheduled_jobs
+        SET last_run_at = v_start_time,
+            updated_at = NOW()
+        WHERE id = v_job.id;
+
+        RETURN jsonb_build_object(
+            'success', true,
+            'run_id', v_run_id,
+            'job_name', v_job.name,
+            'result', v_result,
+            'duration_ms', v_duration_ms
+        );
+
+    EXCEPTION WHEN OTHERS THEN
+        v_end_time := NOW();
+        v_duration_ms := EXTRACT(EPOCH FROM (v_end_time - v_start_time)) * 1000;
+
+        -- Update run record with error
+        UPDATE metadata.scheduled_job_runs
+        SET completed_at = v_end_time,
+            duration_ms = v_duration_ms,
+            success = false,
+            message = SQLERRM
+        WHERE id = v_run_id;
+
+        RETURN jsonb_build_object(
+            'success', false,
+            'run_id', v_run_id,
+            'job_name', v_job.name,
+            'error', SQLERRM,
+            'duration_ms', v_duration_ms
+        );
+    END;
+END;
+$$;
+
+DELETE FROM metadata.river_job WHERE kind = 'db_backup' AND state NOT IN ('completed', 'discarded', 'cancelled');
+DELETE FROM metadata.scheduled_jobs WHERE target_type = 'backup';
+
+ALTER TABLE metadata.scheduled_jobs
+    DROP CONSTRAINT scheduled_jobs_backup_schemas_not_empty,
+    DROP CONSTRAINT scheduled_jobs_backup_keep_range,
+    DROP CONSTRAINT scheduled_jobs_valid_target_type,
+    DROP CONSTRAINT scheduled_jobs_target_config;
+
+ALTER TABLE metadata.scheduled_jobs
+    ADD CONSTRAINT scheduled_jobs_valid_target_type CHECK (target_type IN ('sql', 'http')),
+    ADD CONSTRAINT scheduled_jobs_target_config CHECK (
+        (target_type = 'sql' AND function_name IS NOT NULL)
+        OR (target_type = 'http' AND http_url ~ '^https?://')
+    );
+
+ALTER TABLE metadata.scheduled_jobs
+    DROP COLUMN backup_keep,
+    DROP COLUMN backup_schemas;
+
+COMMENT ON COLUMN metadata.scheduled_jobs.target_type IS
+    'What the job runs: ''sql'' calls function_name, ''http'' sends the configured HTTP request. Added in v0.70.0.';
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-106-0-database-backups';
+
+COMMIT;
@@ -0,0 +1,16 @@
+-- Revert civic_os:v0-107-0-notification-engagement from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.get_notification_link_clicks(VARCHAR, TIMESTAMPTZ, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS public.get_notification_engagement_stats(VARCHAR, TIMESTAMPTZ, TIMESTAMPTZ);
+
+DROP TABLE IF EXISTS metadata.notification_engagement;
+
+ALTER TABLE metadata.notification_templates DROP COLUMN IF EXISTS track_engagement;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-107-0-notification-engagement';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,89 @@
+-- Revert civic_os:v0-108-0-live-entity-preview from pg
+
+BEGIN;
+
+-- Restore the v0.11.0 preview RPC (sample data only)
+DROP FUNCTION IF EXISTS public.preview_template_parts(UUID, TEXT, TEXT, TEXT, TEXT, JSONB, NAME, TEXT);
+
+CREATE OR REPLACE FUNCTION public.preview_template_parts(
+    p_validation_id UUID DEFAULT gen_random_uuid(),
+    p_subject_template TEXT DEFAULT NULL,
+    p_html_template TEXT DEFAULT NULL,
+    p_text_template TEXT DEFAULT NULL,
+    p_sms_template TEXT DEFAULT NULL,
+    p_sample_entity_data JSONB DEFAULT NULL
+)
+RETURNS TABLE(
+    validation_id UUID
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Validate that at least one template part was provided
+    IF p_subject_template IS NULL
+        AND p_html_template IS NULL
+        AND p_text_template IS NULL
+        AND p_sms_template IS NULL
+    THEN
+        RAISE EXCEPTION 'At least one template part must be provided for preview';
+    END IF;
+
+    -- Default sample data if none provided
+    IF p_sample_entity_data IS NULL THEN
+        p_sample_entity_data := '{"display_name": "Example Entity", "id": 1}'::jsonb;
+    END IF;
+
+    -- Insert validation request (reuse same table)
+    INSERT INTO metadata.template_validation_results (
+        id,
+        subject_template,
+        html_template,
+        text_template,
+        sms_template,
+        status
+    )
+    VALUES (
+        p_validation_id,
+        p_subject_template,
+        p_html_template,
+        p_text_template,
+        p_sms_template,
+        'pending'
+    );
+
+    -- Enqueue high-priority preview job
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'preview_template_parts',
+        jsonb_build_object(
+            'validation_id', p_validation_id::text,
+            'subject_template', p_subject_template,
+            'html_template', p_html_template,
+            'text_template', p_text_template,
+            'sms_template', p_sms_template,
+            'sample_entity_data', p_sample_entity_data
+        ),
+        'notifications',
+        4,  -- HIGH PRIORITY (4 = highest)
+        3,
+        NOW(),
+        'available'
+    );
+
+    -- Return validation_id immediately (non-blocking)
+    RETURN QUERY SELECT p_validation_id;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION public.preview_template_parts TO authenticated;
+
+COMMENT ON FUNCTION public.preview_template_parts IS
+    'Enqueues a preview job and returns validation_id immediately. Use get_preview_results() to poll for results.';
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-108-0-live-entity-preview';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- Revert civic_os:v0-109-0-entity-subscriptions from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.get_my_entity_subscriptions(NAME, TEXT);
+DROP FUNCTION IF EXISTS public.unsubscribe_from_entity(BIGINT);
+DROP FUNCTION IF EXISTS public.subscribe_to_entity(NAME, TEXT, JSONB, TEXT[], TEXT[]);
+DROP FUNCTION IF EXISTS metadata.disable_entity_subscriptions(NAME);
+DROP FUNCTION IF EXISTS metadata.enable_entity_subscriptions(NAME);
+
+-- Drops the entity_subscription_fanout triggers that use it
+DROP FUNCTION IF EXISTS metadata.queue_entity_subscription_fanout() CASCADE;
+
+DROP TABLE IF EXISTS metadata.entity_subscriptions;
+
+DELETE FROM metadata.river_job WHERE kind = 'fan_out_notification' AND state NOT IN ('completed', 'discarded', 'cancelled');
+
+-- Notifications already sent keep the template
+DELETE FROM metadata.notification_templates t
+WHERE t.name = 'entity_subscription_update'
+  AND NOT EXISTS (SELECT 1 FROM metadata.notifications n WHERE n.template_name = t.name);
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-109-0-entity-subscriptions';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
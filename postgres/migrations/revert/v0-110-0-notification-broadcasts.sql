@@ -0,0 +1,30 @@
+-- Revert civic_os:v0-110-0-notification-broadcasts from pg
+-- Notifications already created by broadcasts are kept without their broadcast link.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-110-0-notification-broadcasts';
+
+DROP FUNCTION IF EXISTS public.get_notification_broadcasts(INT);
+DROP FUNCTION IF EXISTS public.request_notification_broadcast(VARCHAR, TEXT[], UUID[], BOOLEAN, JSONB, TEXT[]);
+
+DELETE FROM metadata.river_job WHERE kind = 'broadcast_notification' AND state NOT IN ('completed', 'discarded', 'cancelled');
+
+DELETE FROM metadata.notification_templates t
+WHERE t.name = 'notification_broadcast_summary'
+  AND NOT EXISTS (SELECT 1 FROM metadata.notifications n WHERE n.template_name = t.name);
+
+DELETE FROM metadata.permission_roles
+WHERE permission_id IN (
+    SELECT id FROM metadata.permissions WHERE table_name = 'notification_broadcasts'
+);
+DELETE FROM metadata.permissions WHERE table_name = 'notification_broadcasts';
+
+DROP INDEX IF EXISTS metadata.idx_notifications_broadcast;
+ALTER TABLE metadata.notifications DROP COLUMN IF EXISTS broadcast_id;
+
+DROP TABLE IF EXISTS metadata.notification_broadcasts;
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- Revert civic_os:v0-111-0-file-placeholders from pg
+
+BEGIN;
+
+-- Columns can't be removed with CREATE OR REPLACE, so rebuild the view as
+-- v0.39.0 left it
+DROP VIEW IF EXISTS public.files;
+CREATE VIEW public.files
+  WITH (security_invoker = true)
+  AS SELECT id, entity_type, entity_id, file_name, file_type, file_size,
+            s3_key_prefix, s3_original_key,
+            s3_thumbnail_small_key, s3_thumbnail_medium_key, s3_thumbnail_large_key,
+            thumbnail_status, thumbnail_error, created_by, created_at, updated_at,
+            s3_bucket, property_name
+     FROM metadata.files;
+
+GRANT SELECT ON public.files TO web_anon, authenticated;
+
+ALTER TABLE metadata.files
+    DROP COLUMN IF EXISTS placeholder_color,
+    DROP COLUMN IF EXISTS blurhash;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-111-0-file-placeholders';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- Revert civic_os:v0-112-0-file-duplicates from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.dismiss_file_duplicate(UUID, UUID);
+DROP FUNCTION IF EXISTS public.get_file_duplicates(TEXT, TEXT, BOOLEAN);
+
+DROP TABLE IF EXISTS metadata.file_duplicates;
+
+DROP INDEX IF EXISTS metadata.idx_files_entity_hashed;
+ALTER TABLE metadata.files
+    DROP COLUMN IF EXISTS perceptual_hash;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-112-0-file-duplicates';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- Revert civic_os:v0-113-0-thumbnail-cdn-urls from pg
+
+BEGIN;
+
+-- Columns can't be removed with CREATE OR REPLACE, so rebuild the view as
+-- v0.111.0 left it
+DROP VIEW IF EXISTS public.files;
+CREATE VIEW public.files
+  WITH (security_invoker = true)
+  AS SELECT id, entity_type, entity_id, file_name, file_type, file_size,
+            s3_key_prefix, s3_original_key,
+            s3_thumbnail_small_key, s3_thumbnail_medium_key, s3_thumbnail_large_key,
+            thumbnail_status, thumbnail_error, created_by, created_at, updated_at,
+            s3_bucket, property_name,
+            blurhash, placeholder_color
+     FROM metadata.files;
+
+GRANT SELECT ON public.files TO web_anon, authenticated;
+
+DROP TABLE IF EXISTS metadata.file_cdn_urls;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-113-0-thumbnail-cdn-urls';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,31 @@
+-- Revert civic_os:v0-114-0-upload-request-expiry from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.get_abandoned_upload_summary(INT);
+
+DROP TRIGGER IF EXISTS files_mark_upload_request_used ON metadata.files;
+DROP FUNCTION IF EXISTS metadata.mark_upload_request_used();
+
+DROP INDEX IF EXISTS metadata.idx_upload_requests_unused;
+
+-- The original status set has no room for expired requests
+DELETE FROM metadata.file_upload_requests WHERE status = 'expired';
+
+ALTER TABLE metadata.file_upload_requests
+    DROP CONSTRAINT IF EXISTS file_upload_requests_status_check,
+    ADD CONSTRAINT file_upload_requests_status_check CHECK (
+        status IN ('pending', 'processing', 'completed', 'failed')
+    ),
+    DROP COLUMN IF EXISTS expired_at,
+    DROP COLUMN IF EXISTS uploaded_at;
+
+COMMENT ON TABLE metadata.file_upload_requests IS
+  'Temporary table for presigned URL generation workflow. Entries cleaned up after 24 hours.';
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-114-0-upload-request-expiry';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,56 @@
+-- Revert civic_os:v0-115-0-storage-quotas from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.get_storage_usage();
+DROP FUNCTION IF EXISTS public.set_storage_quota(TEXT, BIGINT);
+
+-- Restore request_upload_url() as v0.5.0 defined it
+DROP FUNCTION IF EXISTS public.request_upload_url(TEXT, TEXT, TEXT, TEXT, BIGINT);
+CREATE OR REPLACE FUNCTION public.request_upload_url(
+  p_entity_type TEXT,
+  p_entity_id TEXT,
+  p_file_name TEXT,
+  p_file_type TEXT
+) RETURNS UUID AS $$
+DECLARE
+  v_request_id UUID;
+BEGIN
+  -- Create tracking record
+  INSERT INTO metadata.file_upload_requests (entity_type, entity_id, file_name, file_type)
+  VALUES (p_entity_type, p_entity_id, p_file_name, p_file_type)
+  RETURNING id INTO v_request_id;
+
+  -- Notify S3 signer service to generate presigned URL
+  PERFORM pg_notify(
+    'upload_url_request',
+    json_build_object(
+      'requestId', v_request_id,
+      'fileName', p_file_name,
+      'fileType', p_file_type,
+      'entityType', p_entity_type,
+      'entityId', p_entity_id
+    )::text
+  );
+
+  RETURN v_request_id;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+COMMENT ON FUNCTION public.request_upload_url(TEXT, TEXT, TEXT, TEXT) IS
+  'Request presigned S3 upload URL. Returns request ID for polling.';
+
+GRANT EXECUTE ON FUNCTION public.request_upload_url(TEXT, TEXT, TEXT, TEXT) TO authenticated;
+
+ALTER TABLE metadata.file_upload_requests DROP COLUMN IF EXISTS file_size;
+
+DROP FUNCTION IF EXISTS metadata.refresh_storage_usage();
+DROP TABLE IF EXISTS metadata.storage_usage;
+DROP TABLE IF EXISTS metadata.storage_quotas;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-115-0-storage-quotas';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
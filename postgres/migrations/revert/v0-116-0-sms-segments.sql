@@ -0,0 +1,149 @@
+-- Revert civic_os:v0-116-0-sms-segments from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-116-0-sms-segments';
+
+-- Restore get_validation_results() as v0.72.0 defined it
+DROP FUNCTION IF EXISTS public.get_validation_results(UUID);
+CREATE OR REPLACE FUNCTION public.get_validation_results(
+    p_validation_id UUID
+)
+RETURNS TABLE(
+    status TEXT,
+    part_name TEXT,
+    valid BOOLEAN,
+    error_message TEXT
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_status TEXT;
+BEGIN
+    -- Check validation status
+    SELECT tvr.status
+    INTO v_status
+    FROM metadata.template_validation_results tvr
+    WHERE tvr.id = p_validation_id;
+
+    IF v_status IS NULL THEN
+        RAISE EXCEPTION 'Validation ID not found: %', p_validation_id;
+    END IF;
+
+    -- Return status and results (if completed)
+    IF v_status = 'completed' THEN
+        RETURN QUERY
+        SELECT
+            v_status,
+            pvr.part_name::TEXT,
+            pvr.valid,
+            pvr.error_message
+        FROM metadata.template_part_validation_results pvr
+        WHERE pvr.validation_id = p_validation_id
+        ORDER BY
+            CASE pvr.part_name
+                WHEN 'subject' THEN 1
+                WHEN 'html' THEN 2
+                WHEN 'text' THEN 3
+                WHEN 'sms' THEN 4
+            END;
+
+        -- Mark consumed; the worker's cleanup cron purges consumed results
+        -- shortly after instead of waiting for the retention TTL
+        UPDATE metadata.template_validation_results tvr
+        SET consumed_at = COALESCE(tvr.consumed_at, NOW())
+        WHERE tvr.id = p_validation_id;
+    ELSE
+        -- Return just status (pending/processing)
+        RETURN QUERY SELECT v_status, NULL::TEXT, NULL::BOOLEAN, NULL::TEXT;
+    END IF;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION public.get_validation_results TO authenticated;
+
+COMMENT ON FUNCTION public.get_validation_results IS
+    'Retrieves validation results for a given validation_id. Returns status (pending/completed) and results if available. Completed results are marked consumed and purged by the worker shortly after.';
+
+
+-- Restore validate_template_parts() as v0.11.0 defined it
+DROP FUNCTION IF EXISTS public.validate_template_parts(UUID, TEXT, TEXT, TEXT, TEXT, JSONB);
+CREATE OR REPLACE FUNCTION public.validate_template_parts(
+    p_validation_id UUID DEFAULT gen_random_uuid(),
+    p_subject_template TEXT DEFAULT NULL,
+    p_html_template TEXT DEFAULT NULL,
+    p_text_template TEXT DEFAULT NULL,
+    p_sms_template TEXT DEFAULT NULL
+)
+RETURNS TABLE(
+    validation_id UUID
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Validate that at least one template part was provided
+    IF p_subject_template IS NULL
+        AND p_html_template IS NULL
+        AND p_text_template IS NULL
+        AND p_sms_template IS NULL
+    THEN
+        RAISE EXCEPTION 'At least one template part must be provided for validation';
+    END IF;
+
+    -- Insert validation request
+    INSERT INTO metadata.template_validation_results (
+        id,
+        subject_template,
+        html_template,
+        text_template,
+        sms_template,
+        status
+    )
+    VALUES (
+        p_validation_id,
+        p_subject_template,
+        p_html_template,
+        p_text_template,
+        p_sms_template,
+        'pending'
+    );
+
+    -- Enqueue high-priority validation job
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'validate_template_parts',
+        jsonb_build_object(
+            'validation_id', p_validation_id::text,
+            'subject_template', p_subject_template,
+            'html_template', p_html_template,
+            'text_template', p_text_template,
+            'sms_template', p_sms_template
+        ),
+        'notifications',
+        4,  -- HIGH PRIORITY (4 = highest, normal notifications are priority 1)
+        3,
+        NOW(),
+        'available'
+    );
+
+    -- Return validation_id immediately (non-blocking)
+    RETURN QUERY SELECT p_validation_id;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION public.validate_template_parts TO authenticated;
+
+COMMENT ON FUNCTION public.validate_template_parts IS
+    'Enqueues a validation job and returns validation_id immediately. Use get_validation_results() to poll for results.';
+
+
+ALTER TABLE metadata.template_part_validation_results
+    DROP COLUMN IF EXISTS sms_encoding,
+    DROP COLUMN IF EXISTS sms_segments,
+    DROP COLUMN IF EXISTS sms_length;
+
+COMMIT;
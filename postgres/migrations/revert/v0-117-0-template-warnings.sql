@@ -0,0 +1,80 @@
+-- Revert civic_os:v0-117-0-template-warnings from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-117-0-template-warnings';
+
+-- Restore get_validation_results() as v0.116.0 defined it
+DROP FUNCTION IF EXISTS public.get_validation_results(UUID);
+
+CREATE OR REPLACE FUNCTION public.get_validation_results(
+    p_validation_id UUID
+)
+RETURNS TABLE(
+    status TEXT,
+    part_name TEXT,
+    valid BOOLEAN,
+    error_message TEXT,
+    sms_length INTEGER,
+    sms_segments INTEGER,
+    sms_encoding TEXT
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_status TEXT;
+BEGIN
+    -- Check validation status
+    SELECT tvr.status
+    INTO v_status
+    FROM metadata.template_validation_results tvr
+    WHERE tvr.id = p_validation_id;
+
+    IF v_status IS NULL THEN
+        RAISE EXCEPTION 'Validation ID not found: %', p_validation_id;
+    END IF;
+
+    -- Return status and results (if completed)
+    IF v_status = 'completed' THEN
+        RETURN QUERY
+        SELECT
+            v_status,
+            pvr.part_name::TEXT,
+            pvr.valid,
+            pvr.error_message,
+            pvr.sms_length,
+            pvr.sms_segments,
+            pvr.sms_encoding
+        FROM metadata.template_part_validation_results pvr
+        WHERE pvr.validation_id = p_validation_id
+        ORDER BY
+            CASE pvr.part_name
+                WHEN 'subject' THEN 1
+                WHEN 'html' THEN 2
+                WHEN 'text' THEN 3
+                WHEN 'sms' THEN 4
+            END;
+
+        -- Mark consumed; the worker's cleanup cron purges consumed results
+        -- shortly after instead of waiting for the retention TTL
+        UPDATE metadata.template_validation_results tvr
+        SET consumed_at = COALESCE(tvr.consumed_at, NOW())
+        WHERE tvr.id = p_validation_id;
+    ELSE
+        -- Return just status (pending/processing)
+        RETURN QUERY SELECT v_status, NULL::TEXT, NULL::BOOLEAN, NULL::TEXT, NULL::INTEGER, NULL::INTEGER, NULL::TEXT;
+    END IF;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION public.get_validation_results TO authenticated;
+
+COMMENT ON FUNCTION public.get_validation_results IS
+    'Retrieves validation results for a given validation_id. Returns status (pending/completed) and results if available, with the rendered SMS length, segment count and encoding for the sms part (v0.116.0). Completed results are marked consumed and purged by the worker shortly after.';
+
+ALTER TABLE metadata.template_part_validation_results
+    DROP COLUMN IF EXISTS warnings;
+
+COMMIT;
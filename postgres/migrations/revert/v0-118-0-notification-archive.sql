@@ -0,0 +1,14 @@
+-- Revert civic_os:v0-118-0-notification-archive from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-118-0-notification-archive';
+
+DROP FUNCTION IF EXISTS public.search_notification_archive(TEXT, VARCHAR, VARCHAR, VARCHAR, TIMESTAMPTZ, TIMESTAMPTZ, INT, INT);
+DROP TABLE IF EXISTS metadata.notification_archive;
+DROP FUNCTION IF EXISTS metadata.prevent_notification_archive_update();
+
+ALTER TABLE metadata.notification_templates
+    DROP COLUMN IF EXISTS archive_rendered;
+
+COMMIT;
@@ -0,0 +1,70 @@
+-- Revert civic_os:v0-119-0-payment-expiry from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-119-0-payment-expiry';
+
+DROP INDEX IF EXISTS payments.idx_payments_transactions_pending_updated;
+
+-- Restore check_existing_payment() as v0.76.0 defined it
+CREATE OR REPLACE FUNCTION payments.check_existing_payment(
+    p_payment_id UUID
+)
+RETURNS TEXT
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+    v_payment_status TEXT;
+BEGIN
+    -- No existing payment - create new
+    IF p_payment_id IS NULL THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Get status of existing payment
+    SELECT status INTO v_payment_status
+    FROM payments.transactions
+    WHERE id = p_payment_id;
+
+    -- Payment not found (shouldn't happen if FK constraint exists, but be defensive)
+    IF NOT FOUND THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment in progress - reuse existing PaymentIntent
+    IF v_payment_status IN ('pending_intent', 'pending') THEN
+        RETURN 'reuse';
+    END IF;
+
+    -- Payment failed or canceled - allow retry with NEW transaction
+    -- Important: Don't modify old transaction, it stays as audit trail
+    IF v_payment_status IN ('failed', 'canceled') THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment succeeded, settling, or authorized - prevent duplicate charge
+    IF v_payment_status IN ('succeeded', 'processing', 'requires_capture') THEN
+        RETURN 'duplicate';
+    END IF;
+
+    -- Unknown status - fail safe
+    RAISE EXCEPTION 'Unexpected payment status: %', v_payment_status;
+END;
+$$;
+
+-- Expired payments become canceled, the closest earlier status
+UPDATE payments.transactions SET status = 'canceled' WHERE status = 'expired';
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_status;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_status CHECK (status IN (
+    'pending_intent',    -- Initial state, waiting for worker to create provider intent
+    'pending',           -- Intent created, waiting for customer confirmation
+    'processing',        -- Customer confirmed, funds not yet settled (ACH debits)
+    'requires_capture',  -- Card authorized, waiting for staff to capture or void (manual capture)
+    'succeeded',         -- Payment succeeded
+    'failed',            -- Payment failed
+    'canceled'           -- Payment canceled (includes voided authorizations)
+));
+
+COMMIT;
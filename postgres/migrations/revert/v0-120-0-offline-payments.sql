@@ -0,0 +1,97 @@
+-- Revert civic_os:v0-120-0-offline-payments from pg
+--
+-- Fails if any offline payment exists (the restored constraints reject it);
+-- delete or export them first.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-120-0-offline-payments';
+
+-- Restore the v0-78-0 payment_transactions view (without the offline columns)
+DROP VIEW IF EXISTS public.payment_transactions;
+
+CREATE VIEW public.payment_transactions AS
+SELECT
+    t.id,
+    t.user_id,
+    u.display_name AS user_display_name,
+    u.full_name AS user_full_name,
+    u.email AS user_email,
+    t.amount,
+    t.processing_fee,
+    t.total_amount,
+    t.max_refundable,
+    t.fee_percent,
+    t.fee_flat_cents,
+    t.fee_refundable,
+    t.currency,
+    t.status,
+    t.provider_payment_id,
+    COALESCE(r_agg.total_refunded, 0) AS total_refunded,
+    COALESCE(r_agg.refund_count, 0) AS refund_count,
+    COALESCE(r_agg.pending_count, 0) AS pending_refund_count,
+    CASE
+        WHEN r_agg.total_refunded >= t.max_refundable THEN 'refunded'
+        WHEN r_agg.total_refunded > 0 THEN 'partially_refunded'
+        WHEN r_agg.pending_count > 0 THEN 'refund_pending'
+        ELSE COALESCE(t.status, 'unpaid')
+    END AS effective_status,
+    t.error_message,
+    t.provider,
+    t.provider_client_secret,
+    t.description,
+    t.display_name,
+    t.created_at,
+    t.updated_at,
+    t.entity_type,
+    t.entity_id,
+    COALESCE(e.display_name, t.entity_type) AS entity_display_name,
+    t.capture_method,
+    t.authorized_at,
+    t.capture_before,
+    t.captured_at,
+    t.subscription_id
+FROM payments.transactions t
+LEFT JOIN public.civic_os_users u ON t.user_id = u.id
+LEFT JOIN metadata.entities e ON t.entity_type = e.table_name
+LEFT JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(amount) FILTER (WHERE status = 'succeeded'), 0) AS total_refunded,
+        COUNT(*) FILTER (WHERE status = 'succeeded') AS refund_count,
+        COUNT(*) FILTER (WHERE status = 'pending') AS pending_count
+    FROM payments.refunds
+    WHERE transaction_id = t.id
+) r_agg ON true;
+
+GRANT SELECT ON public.payment_transactions TO authenticated, web_anon;
+
+DROP FUNCTION IF EXISTS public.record_offline_payment(UUID, NUMERIC, TEXT, TEXT, TEXT, NAME, TEXT, NAME, TIMESTAMPTZ);
+
+DELETE FROM metadata.permission_roles
+WHERE permission_id IN (
+    SELECT id FROM metadata.permissions
+    WHERE table_name = 'payment_transactions' AND permission = 'create'
+);
+DELETE FROM metadata.permissions
+WHERE table_name = 'payment_transactions' AND permission = 'create';
+
+ALTER TABLE payments.transactions
+    DROP COLUMN IF EXISTS offline_reference,
+    DROP COLUMN IF EXISTS received_at,
+    DROP COLUMN IF EXISTS recorded_by;
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_payment_method;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_payment_method
+    CHECK (payment_method IN ('card', 'us_bank_account')
+           AND (payment_method = 'card' OR provider = 'stripe'));
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_provider;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_provider
+    CHECK (provider IN ('stripe', 'square', 'paypal'));
+
+COMMENT ON COLUMN payments.transactions.provider IS
+    'Payment processor for this transaction (stripe, square, paypal). The payment worker routes intent creation, refunds and webhooks by this value; the provider must be configured in the worker environment.';
+COMMENT ON COLUMN payments.transactions.payment_method IS
+    'Payment method offered at checkout: card (default) or us_bank_account (ACH debit, Stripe only). Bank debits pass through the processing status while they settle.';
+
+COMMIT;
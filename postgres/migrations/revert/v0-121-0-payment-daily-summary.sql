@@ -0,0 +1,20 @@
+-- Revert civic_os:v0-121-0-payment-daily-summary from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-121-0-payment-daily-summary';
+
+DROP VIEW IF EXISTS public.payment_daily_summaries;
+
+DELETE FROM metadata.notification_templates WHERE name = 'payment_daily_summary';
+
+DROP TABLE IF EXISTS payments.daily_summary_runs;
+DROP TABLE IF EXISTS payments.daily_summaries;
+DROP TABLE IF EXISTS payments.disputes;
+
+DROP TRIGGER IF EXISTS stamp_succeeded_at ON payments.transactions;
+DROP FUNCTION IF EXISTS payments.stamp_succeeded_at();
+DROP INDEX IF EXISTS payments.idx_transactions_succeeded_at;
+ALTER TABLE payments.transactions DROP COLUMN IF EXISTS succeeded_at;
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Revert civic_os:v0-122-0-inbound-webhooks from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-122-0-inbound-webhooks';
+
+DROP VIEW IF EXISTS public.delivery_events;
+DROP TABLE IF EXISTS metadata.delivery_events;
+
+COMMENT ON TABLE metadata.webhooks IS
+    'Webhook events from payment providers. Deduplicated by (provider, provider_event_id). Processed by HTTP webhook server (payment-worker) not PostgREST RPC.';
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Revert civic_os:v0-123-0-scheduler-leader from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-123-0-scheduler-leader';
+
+ALTER TABLE metadata.scheduled_jobs DROP COLUMN IF EXISTS last_queued_at;
+
+COMMIT;
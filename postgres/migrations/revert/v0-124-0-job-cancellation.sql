@@ -0,0 +1,32 @@
+-- Revert civic_os:v0-124-0-job-cancellation from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-124-0-job-cancellation';
+
+UPDATE metadata.notification_templates
+SET subject_template = replace(subject_template,
+        '{{else if eq .Entity.status "cancelled"}}Import stopped', ''),
+    text_template = replace(text_template,
+        '{{else if eq .Entity.status "cancelled"}}Import stopped', ''),
+    html_template = replace(replace(html_template,
+        '{{else if or (eq .Entity.status "failed") (eq .Entity.status "cancelled")}}',
+        '{{else if eq .Entity.status "failed"}}'),
+        '<h2 style="color: #dc2626;">{{if eq .Entity.status "cancelled"}}Import stopped{{else}}Import failed{{end}}</h2>',
+        '<h2 style="color: #dc2626;">Import failed</h2>'),
+    description = replace(description, '(validated, completed, failed or cancelled)', '(validated, completed or failed)')
+WHERE name = 'entity_import_summary';
+
+UPDATE metadata.entity_imports SET status = 'failed' WHERE status = 'cancelled';
+ALTER TABLE metadata.entity_imports DROP CONSTRAINT entity_imports_status_check;
+ALTER TABLE metadata.entity_imports ADD CONSTRAINT entity_imports_status_check
+    CHECK (status IN ('pending', 'validating', 'validated', 'importing', 'completed', 'failed'));
+
+COMMENT ON COLUMN metadata.entity_imports.status IS
+    'pending: queued. validating: dry run in progress. validated: dry run finished, see invalid_rows and the error report. importing: rows being inserted, processed_rows of total_rows done. completed: every row processed; invalid rows were skipped. failed: see error_message.';
+
+DROP FUNCTION IF EXISTS public.cancel_entity_import(BIGINT, TEXT);
+DROP FUNCTION IF EXISTS public.request_job_cancellation(BIGINT, TEXT);
+DROP TABLE IF EXISTS metadata.job_cancellation_requests;
+
+COMMIT;
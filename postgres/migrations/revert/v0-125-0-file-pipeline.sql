@@ -0,0 +1,56 @@
+-- Revert civic_os:v0-125-0-file-pipeline from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-125-0-file-pipeline';
+
+-- Columns can't be removed with CREATE OR REPLACE, so rebuild the view as
+-- v0.113.0 left it
+DROP VIEW IF EXISTS public.files;
+CREATE VIEW public.files
+  WITH (security_invoker = true)
+  AS SELECT f.id, f.entity_type, f.entity_id, f.file_name, f.file_type, f.file_size,
+            f.s3_key_prefix, f.s3_original_key,
+            f.s3_thumbnail_small_key, f.s3_thumbnail_medium_key, f.s3_thumbnail_large_key,
+            f.thumbnail_status, f.thumbnail_error, f.created_by, f.created_at, f.updated_at,
+            f.s3_bucket, f.property_name,
+            f.blurhash, f.placeholder_color,
+            c.thumbnail_small_url AS cdn_thumbnail_small_url,
+            c.thumbnail_medium_url AS cdn_thumbnail_medium_url,
+            c.thumbnail_large_url AS cdn_thumbnail_large_url,
+            c.expires_at AS cdn_urls_expire_at
+     FROM metadata.files f
+     LEFT JOIN metadata.file_cdn_urls c ON c.file_id = f.id;
+
+GRANT SELECT ON public.files TO web_anon, authenticated;
+
+CREATE OR REPLACE FUNCTION insert_thumbnail_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+BEGIN
+    -- Only announce files that still need thumbnails
+    IF NEW.thumbnail_status = 'pending' THEN
+        PERFORM pg_notify('file_uploaded', NEW.id::TEXT);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON FUNCTION insert_thumbnail_job() IS
+    'Trigger function announcing a file that needs thumbnails on the file_uploaded channel (payload: file ID). The consolidated worker queues thumbnail_generate. Added in v0.10.0, NOTIFY instead of a river_job insert in v0.100.0.';
+
+DROP INDEX IF EXISTS metadata.idx_files_pipeline_pending;
+ALTER TABLE metadata.files
+    DROP COLUMN IF EXISTS upload_status,
+    DROP COLUMN IF EXISTS scan_status,
+    DROP COLUMN IF EXISTS scan_signature,
+    DROP COLUMN IF EXISTS metadata_status,
+    DROP COLUMN IF EXISTS content_sha256,
+    DROP COLUMN IF EXISTS detected_type,
+    DROP COLUMN IF EXISTS pipeline_error;
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Revert civic_os:v0-126-0-identity-realms from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-126-0-identity-realms';
+
+ALTER TABLE metadata.keycloak_user_sync_runs DROP COLUMN IF EXISTS realm;
+ALTER TABLE metadata.user_provisioning DROP COLUMN IF EXISTS realm;
+ALTER TABLE metadata.civic_os_users DROP COLUMN IF EXISTS identity_realm;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Revert civic_os:v0-127-0-role-audit from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-127-0-role-audit';
+
+DROP FUNCTION IF EXISTS public.get_role_drift(BOOLEAN);
+DROP FUNCTION IF EXISTS public.get_role_audit_runs(INT);
+DROP TABLE IF EXISTS metadata.role_drift;
+DROP TABLE IF EXISTS metadata.role_audit_runs;
+
+COMMIT;
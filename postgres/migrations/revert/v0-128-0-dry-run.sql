@@ -0,0 +1,10 @@
+-- Revert civic_os:v0-128-0-dry-run from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-128-0-dry-run';
+
+DROP FUNCTION IF EXISTS public.get_simulated_operations(INT);
+DROP TABLE IF EXISTS metadata.simulated_operations;
+
+COMMIT;
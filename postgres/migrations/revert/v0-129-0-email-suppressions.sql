@@ -0,0 +1,12 @@
+-- Revert civic_os:v0-129-0-email-suppressions from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-129-0-email-suppressions';
+
+DROP FUNCTION IF EXISTS public.unsuppress_email(TEXT);
+DROP FUNCTION IF EXISTS public.suppress_email(TEXT, TIMESTAMPTZ, TEXT);
+DROP VIEW IF EXISTS public.email_suppressions;
+DROP TABLE IF EXISTS metadata.email_suppressions;
+
+COMMIT;
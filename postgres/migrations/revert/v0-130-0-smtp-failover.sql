@@ -0,0 +1,10 @@
+-- Revert civic_os:v0-130-0-smtp-failover from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-130-0-smtp-failover';
+
+ALTER TABLE metadata.notification_archive DROP COLUMN IF EXISTS email_provider;
+ALTER TABLE metadata.notification_log DROP COLUMN IF EXISTS email_provider;
+
+COMMIT;
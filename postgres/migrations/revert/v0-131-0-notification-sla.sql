@@ -0,0 +1,19 @@
+-- Revert civic_os:v0-131-0-notification-sla from pg
+-- Notifications already created from notification_sla_breach keep their rows.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-131-0-notification-sla';
+
+DROP FUNCTION IF EXISTS metadata.notify_notification_sla_breaches(TEXT[], INTERVAL);
+DELETE FROM metadata.notification_templates
+WHERE name = 'notification_sla_breach'
+  AND NOT EXISTS (SELECT 1 FROM metadata.notifications WHERE template_name = 'notification_sla_breach');
+DROP TABLE IF EXISTS metadata.notification_sla_alerts;
+DROP VIEW IF EXISTS public.notification_latency_stats;
+DROP FUNCTION IF EXISTS metadata.rollup_notification_latency(TIMESTAMPTZ, INTERVAL);
+DROP TABLE IF EXISTS metadata.notification_latency_stats;
+ALTER TABLE metadata.notification_templates DROP COLUMN IF EXISTS latency_sla_seconds;
+ALTER TABLE metadata.notification_log DROP COLUMN IF EXISTS queue_latency;
+
+COMMIT;
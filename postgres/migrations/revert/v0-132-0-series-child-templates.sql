@@ -0,0 +1,13 @@
+-- Revert civic_os:v0-132-0-series-child-templates from pg
+-- Child rows already created with occurrences are kept.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-132-0-series-child-templates';
+
+DROP FUNCTION IF EXISTS public.set_series_child_templates(BIGINT, JSONB);
+DROP VIEW IF EXISTS public.series_child_templates;
+DROP TABLE IF EXISTS metadata.series_child_templates;
+DROP FUNCTION IF EXISTS metadata.validate_series_child_template();
+
+COMMIT;
@@ -0,0 +1,38 @@
+-- Revert civic_os:v0-133-0-holiday-calendars from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-133-0-holiday-calendars';
+
+DROP FUNCTION IF EXISTS public.set_series_holiday_calendar(BIGINT, INT, VARCHAR);
+
+ALTER TABLE metadata.scheduled_jobs DROP COLUMN IF EXISTS holiday_calendar_id;
+
+-- Holiday skips become plain cancellations
+UPDATE metadata.time_slot_instances
+SET exception_type = 'cancelled'
+WHERE exception_type = 'holiday_skipped';
+
+ALTER TABLE metadata.time_slot_instances
+    DROP CONSTRAINT IF EXISTS time_slot_instances_exception_type_check;
+
+ALTER TABLE metadata.time_slot_instances
+    ADD CONSTRAINT time_slot_instances_exception_type_check
+    CHECK (exception_type IS NULL OR exception_type IN (
+        'modified',
+        'rescheduled',
+        'cancelled',
+        'conflict_skipped',
+        'insert_failed'
+    ));
+
+ALTER TABLE metadata.time_slot_series_groups
+    DROP COLUMN IF EXISTS holiday_policy,
+    DROP COLUMN IF EXISTS holiday_calendar_id;
+
+DROP VIEW IF EXISTS public.holiday_calendar_dates;
+DROP VIEW IF EXISTS public.holiday_calendars;
+DROP TABLE IF EXISTS metadata.holiday_calendar_dates;
+DROP TABLE IF EXISTS metadata.holiday_calendars;
+
+COMMIT;
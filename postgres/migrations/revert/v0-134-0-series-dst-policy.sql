@@ -0,0 +1,11 @@
+-- Revert civic_os:v0-134-0-series-dst-policy from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-134-0-series-dst-policy';
+
+DROP FUNCTION IF EXISTS public.set_series_dst_policy(BIGINT, VARCHAR);
+
+ALTER TABLE metadata.time_slot_series_groups DROP COLUMN IF EXISTS dst_policy;
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Revert civic_os:v0-135-0-thumbnail-unsupported from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-135-0-thumbnail-unsupported';
+
+UPDATE metadata.files
+SET thumbnail_status = 'failed'
+WHERE thumbnail_status = 'unsupported';
+
+ALTER TABLE metadata.files
+    DROP CONSTRAINT IF EXISTS files_thumbnail_status_check;
+
+ALTER TABLE metadata.files
+    ADD CONSTRAINT files_thumbnail_status_check
+    CHECK (thumbnail_status IN ('pending', 'processing', 'completed', 'failed', 'not_applicable'));
+
+COMMENT ON COLUMN metadata.files.thumbnail_status IS
+    'Thumbnail generation status. pending=queued, processing=in progress, completed=done, failed=error, not_applicable=non-image file';
+
+COMMIT;
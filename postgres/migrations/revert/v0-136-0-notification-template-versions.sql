@@ -0,0 +1,19 @@
+-- Revert civic_os:v0-136-0-notification-template-versions from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-136-0-notification-template-versions';
+
+DROP FUNCTION IF EXISTS public.request_template_version_activation(VARCHAR, INT);
+DROP FUNCTION IF EXISTS public.get_notification_template_versions(VARCHAR);
+DROP FUNCTION IF EXISTS metadata.activate_notification_template_version(VARCHAR, INT);
+
+ALTER TABLE metadata.notification_log DROP COLUMN IF EXISTS template_version;
+
+DROP TRIGGER IF EXISTS notification_template_versions_trigger ON metadata.notification_templates;
+DROP FUNCTION IF EXISTS metadata.record_notification_template_version();
+ALTER TABLE metadata.notification_templates DROP COLUMN IF EXISTS active_version;
+
+DROP TABLE IF EXISTS metadata.notification_template_versions;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Revert civic_os:v0-137-0-template-test-send from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-137-0-template-test-send';
+
+DROP FUNCTION IF EXISTS public.send_test_notification(VARCHAR, JSONB, NAME, TEXT);
+
+COMMIT;
@@ -0,0 +1,20 @@
+-- Revert civic_os:v0-138-0-notification-categories from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-138-0-notification-categories';
+
+DROP VIEW IF EXISTS public.notification_category_preferences;
+DROP VIEW IF EXISTS public.notification_categories;
+
+DROP TRIGGER IF EXISTS sync_notification_category_preferences_trigger ON metadata.notification_preferences;
+DROP TRIGGER IF EXISTS sync_notification_category_preferences_trigger ON metadata.notification_categories;
+DROP FUNCTION IF EXISTS metadata.sync_notification_category_preferences();
+
+DROP TABLE IF EXISTS metadata.notification_category_preferences;
+ALTER TABLE metadata.notification_templates DROP COLUMN IF EXISTS category;
+DROP TABLE IF EXISTS metadata.notification_categories;
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
@@ -0,0 +1,35 @@
+-- Revert civic_os:v0-69-0-job-audit-context from pg
+
+BEGIN;
+
+-- ============================================================================
+-- 1. DROP audit_context COLUMN
+-- ============================================================================
+
+ALTER TABLE metadata.scheduled_job_runs
+    DROP COLUMN IF EXISTS audit_context;
+
+
+-- ============================================================================
+-- 2. DROP river_job TRIGGER
+-- ============================================================================
+
+DROP TRIGGER IF EXISTS stamp_job_audit_context_trigger ON metadata.river_job;
+DROP FUNCTION IF EXISTS metadata.stamp_job_audit_context();
+
+
+-- ============================================================================
+-- 3. DROP job_audit_context()
+-- ============================================================================
+
+DROP FUNCTION IF EXISTS metadata.job_audit_context();
+
+
+-- ============================================================================
+-- 4. REMOVE SCHEMA DECISION
+-- ============================================================================
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-69-0-job-audit-context';
+
+COMMIT;
@@ -0,0 +1,234 @@
+-- Revert civic_os:v0-70-0-http-scheduled-jobs from pg
+
+BEGIN;
+
+-- ============================================================================
+-- 1. DROP VIEWS THAT REFERENCE THE NEW COLUMNS
+-- ============================================================================
+-- scheduled_job_status gained appended columns, which CREATE OR REPLACE can't
+-- remove; drop it together with its one dependent and rebuild both below.
+
+DROP VIEW IF EXISTS public.schema_scheduled_functions;
+DROP VIEW IF EXISTS public.scheduled_job_status;
+
+
+-- ============================================================================
+-- 2. REMOVE HTTP-TARGET JOBS
+-- ============================================================================
+-- function_name becomes NOT NULL again; HTTP jobs can't be represented.
+
+DELETE FROM metadata.scheduled_jobs WHERE target_type = 'http';
+
+
+-- ============================================================================
+-- 3. DROP COLUMNS AND CONSTRAINTS
+-- ============================================================================
+
+ALTER TABLE metadata.scheduled_job_runs
+    DROP COLUMN IF EXISTS http_status;
+
+ALTER TABLE metadata.scheduled_jobs
+    DROP CONSTRAINT IF EXISTS scheduled_jobs_valid_target_type,
+    DROP CONSTRAINT IF EXISTS scheduled_jobs_target_config,
+    DROP CONSTRAINT IF EXISTS scheduled_jobs_valid_http_method,
+    DROP CONSTRAINT IF EXISTS scheduled_jobs_http_headers_object,
+    DROP CONSTRAINT IF EXISTS scheduled_jobs_http_timeout_range;
+
+ALTER TABLE metadata.scheduled_jobs
+    DROP COLUMN IF EXISTS target_type,
+    DROP COLUMN IF EXISTS http_url,
+    DROP COLUMN IF EXISTS http_method,
+    DROP COLUMN IF EXISTS http_headers,
+    DROP COLUMN IF EXISTS http_body_template,
+    DROP COLUMN IF EXISTS http_timeout_seconds;
+
+ALTER TABLE metadata.scheduled_jobs
+    ALTER COLUMN function_name SET NOT NULL;
+
+
+-- ============================================================================
+-- 4. RESTORE scheduled_job_status VIEW (from v0-22-0-add-scheduled-jobs)
+-- ============================================================================
+
+CREATE OR REPLACE VIEW public.scheduled_job_status AS
+SELECT
+    sj.id,
+    sj.name,
+    sj.description,
+    sj.function_name,
+    sj.schedule,
+    sj.timezone,
+    sj.enabled,
+    sj.last_run_at,
+    sj.created_at,
+    sj.updated_at,
+    -- Latest run info (denormalized for convenience)
+    lr.id AS last_run_id,
+    lr.success AS last_run_success,
+    lr.message AS last_run_message,
+    lr.duration_ms AS last_run_duration_ms,
+    lr.triggered_by AS last_run_triggered_by,
+    -- Run statistics
+    stats.total_runs,
+    stats.successful_runs,
+    stats.failed_runs,
+    CASE
+        WHEN stats.total_runs > 0
+        THEN ROUND((stats.successful_runs::numeric / stats.total_runs) * 100, 1)
+        ELSE NULL
+    END AS success_rate_percent
+FROM metadata.scheduled_jobs sj
+LEFT JOIN LATERAL (
+    SELECT *
+    FROM metadata.scheduled_job_runs
+    WHERE job_id = sj.id
+    ORDER BY started_at DESC
+    LIMIT 1
+) lr ON true
+LEFT JOIN LATERAL (
+    SELECT
+        COUNT(*) AS total_runs,
+        COUNT(*) FILTER (WHERE success = true) AS successful_runs,
+        COUNT(*) FILTER (WHERE success = false) AS failed_runs
+    FROM metadata.scheduled_job_runs
+    WHERE job_id = sj.id
+) stats ON true;
+
+COMMENT ON VIEW public.scheduled_job_status IS
+    'View combining scheduled job configuration with latest run status and statistics.';
+
+GRANT SELECT ON public.scheduled_job_status TO authenticated;
+
+
+-- ============================================================================
+-- 5. RESTORE schema_scheduled_functions VIEW (from v0-24-0-schema-reorganization)
+-- ============================================================================
+
+CREATE VIEW public.schema_scheduled_functions
+WITH (security_invoker = true) AS
+SELECT
+    sj.function_name,
+    -- Overlay from rpc_functions or use smart default
+    COALESCE(rf.display_name, initcap(replace(sj.function_name, '_', ' '))) AS display_name,
+    rf.description,
+    rf.category,
+    sj.name AS job_name,
+    sj.schedule AS cron_schedule,
+    sj.timezone,
+    sj.enabled AS schedule_enabled,
+    sj.last_run_at,
+    sjs.last_run_success,
+    sjs.success_rate_percent,
+    -- Whether the underlying function is registered
+    rf.function_name IS NOT NULL AS is_registered
+FROM metadata.scheduled_jobs sj
+LEFT JOIN metadata.rpc_functions rf ON rf.function_name = sj.function_name::NAME
+LEFT JOIN public.scheduled_job_status sjs ON sjs.id = sj.id
+WHERE metadata.is_admin();  -- Admin-only for schedule details
+
+COMMENT ON VIEW public.schema_scheduled_functions IS
+    'Admin-only view showing scheduled jobs with optional RPC metadata overlay.';
+
+GRANT SELECT ON public.schema_scheduled_functions TO authenticated;  -- Admin check in view
+
+
+-- ============================================================================
+-- 6. RESTORE trigger_scheduled_job() (from v0-22-0-add-scheduled-jobs)
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION public.trigger_scheduled_job(p_job_name VARCHAR(100))
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_job RECORD;
+    v_run_id BIGINT;
+    v_result JSONB;
+    v_start_time TIMESTAMPTZ;
+    v_end_time TIMESTAMPTZ;
+    v_duration_ms INT;
+BEGIN
+    -- Permission check
+    IF NOT public.is_admin() THEN
+        RAISE EXCEPTION 'Only administrators can trigger scheduled jobs'
+            USING HINT = 'Contact an administrator to run this job';
+    END IF;
+
+    -- Find the job
+    SELECT * INTO v_job
+    FROM metadata.scheduled_jobs
+    WHERE name = p_job_name;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Scheduled job not found: %', p_job_name;
+    END IF;
+
+    -- Create run record
+    v_start_time := NOW();
+    INSERT INTO metadata.scheduled_job_runs (job_id, started_at, triggered_by)
+    VALUES (v_job.id, v_start_time, 'manual')
+    RETURNING id INTO v_run_id;
+
+    -- Execute the function dynamically
+    BEGIN
+        EXECUTE format('SELECT %I()', v_job.function_name) INTO v_result;
+        v_end_time := NOW();
+        v_duration_ms := EXTRACT(EPOCH FROM (v_end_time - v_start_time)) * 1000;
+
+        -- Update run record with result
+        UPDATE metadata.scheduled_job_runs
+        SET completed_at = v_end_time,
+            duration_ms = v_duration_ms,
+            success = COALESCE((v_result->>'success')::boolean, true),
+            message = v_result->>'message',
+            details = v_result
+        WHERE id = v_run_id;
+
+        -- Update last_run_at on job
+        UPDATE metadata.scheduled_jobs
+        SET last_run_at = v_start_time,
+            updated_at = NOW()
+        WHERE id = v_job.id;
+
+        RETURN jsonb_build_object(
+            'success', true,
+            'run_id', v_run_id,
+            'job_name', v_job.name,
+            'result', v_result,
+            'duration_ms', v_duration_ms
+        );
+
+    EXCEPTION WHEN OTHERS THEN
+        v_end_time := NOW();
+        v_duration_ms := EXTRACT(EPOCH FROM (v_end_time - v_start_time)) * 1000;
+
+        -- Update run record with error
+        UPDATE metadata.scheduled_job_runs
+        SET completed_at = v_end_time,
+            duration_ms = v_duration_ms,
+            success = false,
+            message = SQLERRM
+        WHERE id = v_run_id;
+
+        RETURN jsonb_build_object(
+            'success', false,
+            'run_id', v_run_id,
+            'job_name', v_job.name,
+            'error', SQLERRM,
+            'duration_ms', v_duration_ms
+        );
+    END;
+END;
+$$;
+
+
+-- ============================================================================
+-- 7. REMOVE SCHEMA DECISION
+-- ============================================================================
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-70-0-http-scheduled-jobs';
+
+COMMIT;
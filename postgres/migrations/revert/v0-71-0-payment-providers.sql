@@ -0,0 +1,110 @@
+-- Revert civic_os:v0-71-0-payment-providers from pg
+--
+-- Fails if non-Stripe transactions exist; resolve or remove them first.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. RESTORE create_and_link_payment WITHOUT PROVIDER
+-- ============================================================================
+
+DROP FUNCTION payments.create_and_link_payment(NAME, NAME, ANYELEMENT, NAME, NUMERIC, TEXT, UUID, TEXT, TEXT);
+
+CREATE OR REPLACE FUNCTION payments.create_and_link_payment(
+    p_entity_table_name NAME,
+    p_entity_id_column_name NAME,
+    p_entity_id_value ANYELEMENT,
+    p_payment_column_name NAME,
+    p_amount NUMERIC(10,2),
+    p_description TEXT,
+    p_user_id UUID DEFAULT current_user_id(),
+    p_currency TEXT DEFAULT 'USD'
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment_id UUID;
+    v_sql TEXT;
+BEGIN
+    -- Validate inputs
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid payment amount: %. Amount must be greater than zero.', p_amount;
+    END IF;
+
+    IF p_user_id IS NULL THEN
+        RAISE EXCEPTION 'User ID required for payment creation';
+    END IF;
+
+    -- Validate currency (POC only supports USD)
+    IF p_currency != 'USD' THEN
+        RAISE EXCEPTION 'Only USD currency supported in POC (got: %)', p_currency;
+    END IF;
+
+    -- Create payment record with entity reference
+    -- Trigger will automatically enqueue River job for Stripe intent creation
+    INSERT INTO payments.transactions (
+        user_id,
+        amount,
+        currency,
+        status,
+        description,
+        provider,
+        entity_type,
+        entity_id
+    ) VALUES (
+        p_user_id,
+        p_amount,
+        p_currency,
+        'pending_intent',  -- Worker will update to 'pending' after creating Stripe intent
+        p_description,
+        'stripe',
+        p_entity_table_name::TEXT,
+        p_entity_id_value::TEXT
+    ) RETURNING id INTO v_payment_id;
+
+    -- Link payment to entity using dynamic SQL
+    -- Use format() with %I (identifier) to prevent SQL injection
+    v_sql := format(
+        'UPDATE %I SET %I = $1 WHERE %I = $2',
+        p_entity_table_name,
+        p_payment_column_name,
+        p_entity_id_column_name
+    );
+
+    EXECUTE v_sql USING v_payment_id, p_entity_id_value;
+
+    -- Verify the entity was updated
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Entity not found: %.% = %', p_entity_table_name, p_entity_id_column_name, p_entity_id_value;
+    END IF;
+
+    RETURN v_payment_id;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.create_and_link_payment IS
+    'Create payment record and atomically link to entity. Stores entity_type and entity_id for reverse lookup. Prevents common errors: wrong status, missing entity link, incorrect currency. Uses format() with %I for safe dynamic SQL.';
+
+GRANT EXECUTE ON FUNCTION payments.create_and_link_payment TO authenticated;
+
+
+-- ============================================================================
+-- 2. RESTORE STRIPE-ONLY CONSTRAINT
+-- ============================================================================
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_provider;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_provider CHECK (provider = 'stripe');
+
+COMMENT ON COLUMN payments.transactions.provider IS NULL;
+COMMENT ON COLUMN payments.transactions.provider_payment_id IS
+    'Stripe PaymentIntent ID (pi_...). Created by worker after INSERT.';
+COMMENT ON COLUMN payments.transactions.provider_client_secret IS
+    'Stripe client_secret for Elements SDK. Created by worker, returned to frontend via RPC.';
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-71-0-payment-providers';
+
+COMMIT;
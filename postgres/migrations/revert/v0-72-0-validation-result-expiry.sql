@@ -0,0 +1,161 @@
+-- Revert civic_os:v0-72-0-validation-result-expiry from pg
+
+BEGIN;
+
+-- ============================================================================
+-- 1. RESTORE ORIGINAL FUNCTIONS
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION cleanup_old_validation_results()
+RETURNS void
+SECURITY DEFINER
+SET search_path = metadata, public
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    DELETE FROM metadata.template_validation_results
+    WHERE created_at < NOW() - INTERVAL '1 hour';
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION cleanup_old_validation_results TO authenticated;
+
+COMMENT ON FUNCTION cleanup_old_validation_results IS
+    'Deletes validation results older than 1 hour. Run periodically via cron or pg_cron.';
+
+
+CREATE OR REPLACE FUNCTION get_validation_results(
+    p_validation_id UUID
+)
+RETURNS TABLE(
+    status TEXT,
+    part_name TEXT,
+    valid BOOLEAN,
+    error_message TEXT
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_status TEXT;
+BEGIN
+    -- Check validation status
+    SELECT tvr.status
+    INTO v_status
+    FROM metadata.template_validation_results tvr
+    WHERE tvr.id = p_validation_id;
+
+    IF v_status IS NULL THEN
+        RAISE EXCEPTION 'Validation ID not found: %', p_validation_id;
+    END IF;
+
+    -- Return status and results (if completed)
+    IF v_status = 'completed' THEN
+        RETURN QUERY
+        SELECT
+            v_status,
+            pvr.part_name::TEXT,
+            pvr.valid,
+            pvr.error_message
+        FROM metadata.template_part_validation_results pvr
+        WHERE pvr.validation_id = p_validation_id
+        ORDER BY
+            CASE pvr.part_name
+                WHEN 'subject' THEN 1
+                WHEN 'html' THEN 2
+                WHEN 'text' THEN 3
+                WHEN 'sms' THEN 4
+            END;
+    ELSE
+        -- Return just status (pending/processing)
+        RETURN QUERY SELECT v_status, NULL::TEXT, NULL::BOOLEAN, NULL::TEXT;
+    END IF;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION get_validation_results TO authenticated;
+
+COMMENT ON FUNCTION get_validation_results IS
+    'Retrieves validation results for a given validation_id. Returns status (pending/completed) and results if available.';
+
+
+CREATE OR REPLACE FUNCTION get_preview_results(
+    p_validation_id UUID
+)
+RETURNS TABLE(
+    status TEXT,
+    part_name TEXT,
+    rendered_output TEXT,
+    error_message TEXT
+)
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_status TEXT;
+BEGIN
+    -- Check validation status
+    SELECT tvr.status
+    INTO v_status
+    FROM metadata.template_validation_results tvr
+    WHERE tvr.id = p_validation_id;
+
+    IF v_status IS NULL THEN
+        RAISE EXCEPTION 'Validation ID not found: %', p_validation_id;
+    END IF;
+
+    -- Return status and results (if completed)
+    IF v_status = 'completed' THEN
+        RETURN QUERY
+        SELECT
+            v_status,
+            pvr.part_name::TEXT,
+            CASE WHEN pvr.valid THEN pvr.error_message ELSE NULL END AS rendered_output,
+            CASE WHEN NOT pvr.valid THEN pvr.error_message ELSE NULL END AS error_message
+        FROM metadata.template_part_validation_results pvr
+        WHERE pvr.validation_id = p_validation_id
+        ORDER BY
+            CASE pvr.part_name
+                WHEN 'subject' THEN 1
+                WHEN 'html' THEN 2
+                WHEN 'text' THEN 3
+                WHEN 'sms' THEN 4
+            END;
+    ELSE
+        -- Return just status (pending/processing)
+        RETURN QUERY SELECT v_status, NULL::TEXT, NULL::TEXT, NULL::TEXT;
+    END IF;
+END;
+$$;
+
+GRANT EXECUTE ON FUNCTION get_preview_results TO authenticated;
+
+COMMENT ON FUNCTION get_preview_results IS
+    'Retrieves preview results for a given validation_id. Returns status (pending/completed) and rendered output or errors.';
+
+
+DROP FUNCTION IF EXISTS metadata.purge_validation_results(INTERVAL, INTERVAL);
+
+
+-- ============================================================================
+-- 2. DROP CONSUMED_AT
+-- ============================================================================
+
+DROP INDEX IF EXISTS metadata.idx_template_validation_results_consumed_at;
+DROP INDEX IF EXISTS metadata.idx_template_validation_results_created_at;
+ALTER TABLE metadata.template_validation_results DROP COLUMN IF EXISTS consumed_at;
+
+COMMENT ON TABLE metadata.template_validation_results IS
+    'Temporary storage for template validation requests. Results expire after 1 hour.';
+
+
+-- ============================================================================
+-- 3. REMOVE SCHEMA DECISION
+-- ============================================================================
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-72-0-validation-result-expiry';
+
+COMMIT;
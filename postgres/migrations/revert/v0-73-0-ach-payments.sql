@@ -0,0 +1,168 @@
+-- Revert civic_os:v0-73-0-ach-payments from pg
+--
+-- Fails if any transaction is still 'processing'; resolve it first.
+-- payment_method and mandate_id are dropped, so ACH history is lost.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. RESTORE create_and_link_payment WITHOUT PAYMENT METHOD
+-- ============================================================================
+
+DROP FUNCTION payments.create_and_link_payment(NAME, NAME, ANYELEMENT, NAME, NUMERIC, TEXT, UUID, TEXT, TEXT, TEXT);
+
+CREATE OR REPLACE FUNCTION payments.create_and_link_payment(
+    p_entity_table_name NAME,
+    p_entity_id_column_name NAME,
+    p_entity_id_value ANYELEMENT,
+    p_payment_column_name NAME,
+    p_amount NUMERIC(10,2),
+    p_description TEXT,
+    p_user_id UUID DEFAULT current_user_id(),
+    p_currency TEXT DEFAULT 'USD',
+    p_provider TEXT DEFAULT 'stripe'
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment_id UUID;
+    v_sql TEXT;
+BEGIN
+    -- Validate inputs
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid payment amount: %. Amount must be greater than zero.', p_amount;
+    END IF;
+
+    IF p_user_id IS NULL THEN
+        RAISE EXCEPTION 'User ID required for payment creation';
+    END IF;
+
+    -- Validate currency (POC only supports USD)
+    IF p_currency != 'USD' THEN
+        RAISE EXCEPTION 'Only USD currency supported in POC (got: %)', p_currency;
+    END IF;
+
+    -- Create payment record with entity reference
+    -- Trigger will automatically enqueue River job; the worker routes it to p_provider
+    INSERT INTO payments.transactions (
+        user_id,
+        amount,
+        currency,
+        status,
+        description,
+        provider,
+        entity_type,
+        entity_id
+    ) VALUES (
+        p_user_id,
+        p_amount,
+        p_currency,
+        'pending_intent',  -- Worker will update to 'pending' after creating provider intent
+        p_description,
+        p_provider,
+        p_entity_table_name::TEXT,
+        p_entity_id_value::TEXT
+    ) RETURNING id INTO v_payment_id;
+
+    -- Link payment to entity using dynamic SQL
+    -- Use format() with %I (identifier) to prevent SQL injection
+    v_sql := format(
+        'UPDATE %I SET %I = $1 WHERE %I = $2',
+        p_entity_table_name,
+        p_payment_column_name,
+        p_entity_id_column_name
+    );
+
+    EXECUTE v_sql USING v_payment_id, p_entity_id_value;
+
+    -- Verify the entity was updated
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Entity not found: %.% = %', p_entity_table_name, p_entity_id_column_name, p_entity_id_value;
+    END IF;
+
+    RETURN v_payment_id;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.create_and_link_payment IS
+    'Create payment record and atomically link to entity. Stores entity_type and entity_id for reverse lookup. p_provider selects the payment processor (stripe, square, paypal). Prevents common errors: wrong status, missing entity link, incorrect currency. Uses format() with %I for safe dynamic SQL.';
+
+GRANT EXECUTE ON FUNCTION payments.create_and_link_payment TO authenticated;
+
+
+-- ============================================================================
+-- 2. RESTORE check_existing_payment
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION payments.check_existing_payment(
+    p_payment_id UUID
+)
+RETURNS TEXT
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+    v_payment_status TEXT;
+BEGIN
+    -- No existing payment - create new
+    IF p_payment_id IS NULL THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Get status of existing payment
+    SELECT status INTO v_payment_status
+    FROM payments.transactions
+    WHERE id = p_payment_id;
+
+    -- Payment not found (shouldn't happen if FK constraint exists, but be defensive)
+    IF NOT FOUND THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment in progress - reuse existing PaymentIntent
+    IF v_payment_status IN ('pending_intent', 'pending') THEN
+        RETURN 'reuse';
+    END IF;
+
+    -- Payment failed or canceled - allow retry with NEW transaction
+    -- Important: Don't modify old transaction, it stays as audit trail
+    IF v_payment_status IN ('failed', 'canceled') THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment succeeded - prevent duplicate charge
+    IF v_payment_status = 'succeeded' THEN
+        RETURN 'duplicate';
+    END IF;
+
+    -- Unknown status - fail safe
+    RAISE EXCEPTION 'Unexpected payment status: %', v_payment_status;
+END;
+$$;
+
+
+-- ============================================================================
+-- 3. RESTORE STATUS CONSTRAINT AND DROP COLUMNS
+-- ============================================================================
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_status;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_status CHECK (status IN (
+    'pending_intent',
+    'pending',
+    'succeeded',
+    'failed',
+    'canceled'
+));
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_payment_method;
+ALTER TABLE payments.transactions
+    DROP COLUMN mandate_id,
+    DROP COLUMN payment_method;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-73-0-ach-payments';
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Revert civic_os:v0-74-0-thumbnail-params from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.queue_thumbnail_backfill();
+
+ALTER TABLE metadata.files
+    DROP COLUMN IF EXISTS thumbnail_params;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-74-0-thumbnail-params';
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- Revert civic_os:v0-75-0-signature-requests from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.get_signature_requests(NAME, TEXT);
+DROP FUNCTION IF EXISTS metadata.apply_signature_outcome(UUID, TEXT, UUID, TEXT);
+DROP FUNCTION IF EXISTS public.request_signature(NAME, TEXT, UUID, TEXT, TEXT, NAME, TEXT, TEXT, TEXT);
+
+DROP TABLE IF EXISTS metadata.signature_requests;
+DROP FUNCTION IF EXISTS metadata.enqueue_signature_send_job();
+
+DROP INDEX IF EXISTS metadata.idx_files_previous_version;
+ALTER TABLE metadata.files
+    DROP COLUMN IF EXISTS previous_version_id;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-75-0-signature-requests';
+
+COMMIT;
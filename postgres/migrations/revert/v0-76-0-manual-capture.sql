@@ -0,0 +1,257 @@
+-- Revert civic_os:v0-76-0-manual-capture from pg
+--
+-- Fails if any transaction is still 'requires_capture'; capture or void it
+-- first. capture_method and the authorization timestamps are dropped.
+
+BEGIN;
+
+-- ============================================================================
+-- 1. RESTORE payment_transactions VIEW
+-- ============================================================================
+-- Dropped and recreated: CREATE OR REPLACE VIEW cannot remove columns
+
+DROP VIEW public.payment_transactions;
+
+CREATE VIEW public.payment_transactions AS
+SELECT
+    t.id,
+    t.user_id,
+    u.display_name AS user_display_name,
+    u.full_name AS user_full_name,
+    u.email AS user_email,
+    t.amount,
+    t.processing_fee,
+    t.total_amount,
+    t.max_refundable,
+    t.fee_percent,
+    t.fee_flat_cents,
+    t.fee_refundable,
+    t.currency,
+    t.status,
+    t.provider_payment_id,
+    COALESCE(r_agg.total_refunded, 0) AS total_refunded,
+    COALESCE(r_agg.refund_count, 0) AS refund_count,
+    COALESCE(r_agg.pending_count, 0) AS pending_refund_count,
+    CASE
+        WHEN r_agg.total_refunded >= t.max_refundable THEN 'refunded'
+        WHEN r_agg.total_refunded > 0 THEN 'partially_refunded'
+        WHEN r_agg.pending_count > 0 THEN 'refund_pending'
+        ELSE COALESCE(t.status, 'unpaid')
+    END AS effective_status,
+    t.error_message,
+    t.provider,
+    t.provider_client_secret,
+    t.description,
+    t.display_name,
+    t.created_at,
+    t.updated_at,
+    t.entity_type,
+    t.entity_id,
+    COALESCE(e.display_name, t.entity_type) AS entity_display_name
+FROM payments.transactions t
+LEFT JOIN public.civic_os_users u ON t.user_id = u.id
+LEFT JOIN metadata.entities e ON t.entity_type = e.table_name
+LEFT JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(amount) FILTER (WHERE status = 'succeeded'), 0) AS total_refunded,
+        COUNT(*) FILTER (WHERE status = 'succeeded') AS refund_count,
+        COUNT(*) FILTER (WHERE status = 'pending') AS pending_count
+    FROM payments.refunds
+    WHERE transaction_id = t.id
+) r_agg ON true;
+
+GRANT SELECT ON public.payment_transactions TO authenticated, web_anon;
+
+
+-- ============================================================================
+-- 2. DROP CAPTURE RPCs AND EXPIRY JOB
+-- ============================================================================
+
+DELETE FROM metadata.scheduled_jobs WHERE name = 'expire_uncaptured_authorizations';
+
+DROP FUNCTION IF EXISTS payments.expire_uncaptured_authorizations();
+DROP FUNCTION IF EXISTS public.void_payment(UUID, TEXT);
+DROP FUNCTION IF EXISTS public.capture_payment(UUID);
+DROP FUNCTION IF EXISTS payments.enqueue_cancel_payment_intent(UUID, TEXT);
+
+DELETE FROM metadata.permission_roles
+WHERE permission_id IN (
+    SELECT id FROM metadata.permissions
+    WHERE table_name = 'payment_transactions' AND permission = 'update'
+);
+DELETE FROM metadata.permissions
+WHERE table_name = 'payment_transactions' AND permission = 'update';
+
+
+-- ============================================================================
+-- 3. RESTORE create_and_link_payment WITHOUT CAPTURE METHOD
+-- ============================================================================
+
+DROP FUNCTION payments.create_and_link_payment(NAME, NAME, ANYELEMENT, NAME, NUMERIC, TEXT, UUID, TEXT, TEXT, TEXT, TEXT);
+
+CREATE OR REPLACE FUNCTION payments.create_and_link_payment(
+    p_entity_table_name NAME,
+    p_entity_id_column_name NAME,
+    p_entity_id_value ANYELEMENT,
+    p_payment_column_name NAME,
+    p_amount NUMERIC(10,2),
+    p_description TEXT,
+    p_user_id UUID DEFAULT current_user_id(),
+    p_currency TEXT DEFAULT 'USD',
+    p_provider TEXT DEFAULT 'stripe',
+    p_payment_method TEXT DEFAULT 'card'
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment_id UUID;
+    v_sql TEXT;
+BEGIN
+    -- Validate inputs
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid payment amount: %. Amount must be greater than zero.', p_amount;
+    END IF;
+
+    IF p_user_id IS NULL THEN
+        RAISE EXCEPTION 'User ID required for payment creation';
+    END IF;
+
+    -- Validate currency (POC only supports USD)
+    IF p_currency != 'USD' THEN
+        RAISE EXCEPTION 'Only USD currency supported in POC (got: %)', p_currency;
+    END IF;
+
+    IF p_payment_method = 'us_bank_account' AND p_provider != 'stripe' THEN
+        RAISE EXCEPTION 'Bank account payments are only supported with Stripe (got: %)', p_provider;
+    END IF;
+
+    -- Create payment record with entity reference
+    -- Trigger will automatically enqueue River job; the worker routes it to p_provider
+    INSERT INTO payments.transactions (
+        user_id,
+        amount,
+        currency,
+        status,
+        description,
+        provider,
+        payment_method,
+        entity_type,
+        entity_id
+    ) VALUES (
+        p_user_id,
+        p_amount,
+        p_currency,
+        'pending_intent',  -- Worker will update to 'pending' after creating provider intent
+        p_description,
+        p_provider,
+        p_payment_method,
+        p_entity_table_name::TEXT,
+        p_entity_id_value::TEXT
+    ) RETURNING id INTO v_payment_id;
+
+    -- Link payment to entity using dynamic SQL
+    -- Use format() with %I (identifier) to prevent SQL injection
+    v_sql := format(
+        'UPDATE %I SET %I = $1 WHERE %I = $2',
+        p_entity_table_name,
+        p_payment_column_name,
+        p_entity_id_column_name
+    );
+
+    EXECUTE v_sql USING v_payment_id, p_entity_id_value;
+
+    -- Verify the entity was updated
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Entity not found: %.% = %', p_entity_table_name, p_entity_id_column_name, p_entity_id_value;
+    END IF;
+
+    RETURN v_payment_id;
+END;
+$$;
+
+COMMENT ON FUNCTION payments.create_and_link_payment IS
+    'Create payment record and atomically link to entity. Stores entity_type and entity_id for reverse lookup. p_provider selects the payment processor (stripe, square, paypal); p_payment_method selects card or us_bank_account (ACH, Stripe only). Prevents common errors: wrong status, missing entity link, incorrect currency. Uses format() with %I for safe dynamic SQL.';
+
+GRANT EXECUTE ON FUNCTION payments.create_and_link_payment TO authenticated;
+
+
+-- ============================================================================
+-- 4. RESTORE check_existing_payment
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION payments.check_existing_payment(
+    p_payment_id UUID
+)
+RETURNS TEXT
+LANGUAGE plpgsql
+STABLE
+AS $$
+DECLARE
+    v_payment_status TEXT;
+BEGIN
+    -- No existing payment - create new
+    IF p_payment_id IS NULL THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Get status of existing payment
+    SELECT status INTO v_payment_status
+    FROM payments.transactions
+    WHERE id = p_payment_id;
+
+    -- Payment not found (shouldn't happen if FK constraint exists, but be defensive)
+    IF NOT FOUND THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment in progress - reuse existing PaymentIntent
+    IF v_payment_status IN ('pending_intent', 'pending') THEN
+        RETURN 'reuse';
+    END IF;
+
+    -- Payment failed or canceled - allow retry with NEW transaction
+    -- Important: Don't modify old transaction, it stays as audit trail
+    IF v_payment_status IN ('failed', 'canceled') THEN
+        RETURN 'create_new';
+    END IF;
+
+    -- Payment succeeded or settling - prevent duplicate charge
+    IF v_payment_status IN ('succeeded', 'processing') THEN
+        RETURN 'duplicate';
+    END IF;
+
+    -- Unknown status - fail safe
+    RAISE EXCEPTION 'Unexpected payment status: %', v_payment_status;
+END;
+$$;
+
+
+-- ============================================================================
+-- 5. RESTORE STATUS CONSTRAINT AND DROP COLUMNS
+-- ============================================================================
+
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_status;
+ALTER TABLE payments.transactions ADD CONSTRAINT valid_status CHECK (status IN (
+    'pending_intent',
+    'pending',
+    'processing',
+    'succeeded',
+    'failed',
+    'canceled'
+));
+
+DROP INDEX IF EXISTS payments.idx_payments_transactions_capture_before;
+ALTER TABLE payments.transactions DROP CONSTRAINT valid_capture_method;
+ALTER TABLE payments.transactions
+    DROP COLUMN captured_at,
+    DROP COLUMN capture_before,
+    DROP COLUMN authorized_at,
+    DROP COLUMN capture_method;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-76-0-manual-capture';
+
+COMMIT;
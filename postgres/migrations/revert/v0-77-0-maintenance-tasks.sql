@@ -0,0 +1,14 @@
+-- Revert civic_os:v0-77-0-maintenance-tasks from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.run_maintenance_task_now(VARCHAR);
+DROP FUNCTION IF EXISTS public.update_maintenance_task(VARCHAR, BOOLEAN, INT, INT);
+DROP FUNCTION IF EXISTS public.get_maintenance_tasks();
+
+DROP TABLE IF EXISTS metadata.maintenance_tasks;
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-77-0-maintenance-tasks';
+
+COMMIT;
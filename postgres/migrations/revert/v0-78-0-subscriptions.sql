@@ -0,0 +1,87 @@
+-- Revert civic_os:v0-78-0-subscriptions from pg
+
+BEGIN;
+
+-- Restore the v0-76-0 payment_transactions view (without subscription_id)
+DROP VIEW IF EXISTS public.payment_transactions;
+
+CREATE VIEW public.payment_transactions AS
+SELECT
+    t.id,
+    t.user_id,
+    u.display_name AS user_display_name,
+    u.full_name AS user_full_name,
+    u.email AS user_email,
+    t.amount,
+    t.processing_fee,
+    t.total_amount,
+    t.max_refundable,
+    t.fee_percent,
+    t.fee_flat_cents,
+    t.fee_refundable,
+    t.currency,
+    t.status,
+    t.provider_payment_id,
+    COALESCE(r_agg.total_refunded, 0) AS total_refunded,
+    COALESCE(r_agg.refund_count, 0) AS refund_count,
+    COALESCE(r_agg.pending_count, 0) AS pending_refund_count,
+    CASE
+        WHEN r_agg.total_refunded >= t.max_refundable THEN 'refunded'
+        WHEN r_agg.total_refunded > 0 THEN 'partially_refunded'
+        WHEN r_agg.pending_count > 0 THEN 'refund_pending'
+        ELSE COALESCE(t.status, 'unpaid')
+    END AS effective_status,
+    t.error_message,
+    t.provider,
+    t.provider_client_secret,
+    t.description,
+    t.display_name,
+    t.created_at,
+    t.updated_at,
+    t.entity_type,
+    t.entity_id,
+    COALESCE(e.display_name, t.entity_type) AS entity_display_name,
+    t.capture_method,
+    t.authorized_at,
+    t.capture_before,
+    t.captured_at
+FROM payments.transactions t
+LEFT JOIN public.civic_os_users u ON t.user_id = u.id
+LEFT JOIN metadata.entities e ON t.entity_type = e.table_name
+LEFT JOIN LATERAL (
+    SELECT
+        COALESCE(SUM(amount) FILTER (WHERE status = 'succeeded'), 0) AS total_refunded,
+        COUNT(*) FILTER (WHERE status = 'succeeded') AS refund_count,
+        COUNT(*) FILTER (WHERE status = 'pending') AS pending_count
+    FROM payments.refunds
+    WHERE transaction_id = t.id
+) r_agg ON true;
+
+GRANT SELECT ON public.payment_transactions TO authenticated, web_anon;
+
+DROP VIEW IF EXISTS public.payment_subscriptions;
+
+DROP FUNCTION IF EXISTS public.cancel_subscription(UUID, BOOLEAN);
+DROP FUNCTION IF EXISTS payments.create_and_link_subscription(NAME, NAME, ANYELEMENT, NAME, NAME, NUMERIC, TEXT, TEXT, INT, UUID, TEXT);
+
+-- Restore the original create_payment_intent trigger condition
+DROP TRIGGER IF EXISTS enqueue_create_intent_job_trigger ON payments.transactions;
+CREATE TRIGGER enqueue_create_intent_job_trigger
+    AFTER INSERT ON payments.transactions
+    FOR EACH ROW
+    WHEN (NEW.status = 'pending_intent')
+    EXECUTE FUNCTION payments.enqueue_create_intent_job();
+
+DROP INDEX IF EXISTS payments.idx_payments_transactions_provider_invoice_id;
+DROP INDEX IF EXISTS payments.idx_payments_transactions_subscription_id;
+ALTER TABLE payments.transactions
+    DROP COLUMN IF EXISTS provider_invoice_id,
+    DROP COLUMN IF EXISTS subscription_id;
+
+DROP TABLE IF EXISTS payments.subscriptions;
+DROP FUNCTION IF EXISTS payments.enqueue_create_subscription_job();
+
+DELETE FROM metadata.schema_decisions
+WHERE migration_id = 'v0-78-0-subscriptions';
+
+COMMIT;
@@ -0,0 +1,215 @@
+-- Revert civic_os:v0-79-0-entity-soft-locks from pg
+
+BEGIN;
+
+-- Restore update_series_template() from v0-19-0 (no row locking)
+CREATE OR REPLACE FUNCTION public.update_series_template(
+    p_series_id BIGINT,
+    p_new_template JSONB,
+    p_skip_exceptions BOOLEAN DEFAULT TRUE
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_series RECORD;
+    v_user_id UUID;
+    v_updated_count INT := 0;
+    v_instance RECORD;
+    v_set_clause TEXT;
+    v_key TEXT;
+    v_value JSONB;
+BEGIN
+    v_user_id := public.current_user_id();
+
+    -- Get series
+    SELECT * INTO v_series
+    FROM metadata.time_slot_series
+    WHERE id = p_series_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series not found');
+    END IF;
+
+    -- Merge new template with original (preserves required fields like resource_id)
+    -- JSONB || operator: right side takes precedence for duplicate keys
+    p_new_template := v_series.entity_template || p_new_template;
+
+    -- Validate merged template
+    PERFORM metadata.validate_entity_template(v_series.entity_table, p_new_template);
+
+    -- Update series template
+    UPDATE metadata.time_slot_series
+    SET
+        entity_template = p_new_template,
+        template_updated_at = NOW(),
+        template_updated_by = v_user_id
+    WHERE id = p_series_id;
+
+    -- Build dynamic SET clause for entity updates
+    v_set_clause := '';
+    FOR v_key, v_value IN SELECT * FROM jsonb_each(p_new_template)
+    LOOP
+        IF v_key != 'time_slot' THEN
+            IF v_set_clause != '' THEN
+                v_set_clause := v_set_clause || ', ';
+            END IF;
+            v_set_clause := v_set_clause || format('%I = %L', v_key, v_value #>> '{}');
+        END IF;
+    END LOOP;
+
+    -- Update non-exception entity records
+    IF v_set_clause != '' THEN
+        FOR v_instance IN
+            SELECT entity_id
+            FROM metadata.time_slot_instances
+            WHERE series_id = p_series_id
+              AND entity_id IS NOT NULL
+              AND (NOT p_skip_exceptions OR NOT is_exception)
+        LOOP
+            EXECUTE format(
+                'UPDATE public.%I SET %s WHERE id = $1',
+                v_series.entity_table,
+                v_set_clause
+            ) USING v_instance.entity_id;
+            v_updated_count := v_updated_count + 1;
+        END LOOP;
+    END IF;
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', format('Updated %s instances', v_updated_count),
+        'series_id', p_series_id,
+        'instances_updated', v_updated_count
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.update_series_template(BIGINT, JSONB, BOOLEAN) IS
+    'Updates series template and propagates to non-exception instances.
+     Use for "edit all occurrences" operations.
+     Added in v0.19.0.';
+
+-- Restore update_series_schedule() from v0-38-5-configurable-expand-horizon
+CREATE OR REPLACE FUNCTION public.update_series_schedule(
+    p_series_id BIGINT,
+    p_dtstart TIMESTAMP,
+    p_duration INTERVAL,
+    p_rrule TEXT,
+    p_expand_horizon_days INTEGER DEFAULT 90
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+    v_series RECORD;
+    v_user_id UUID;
+    v_entity_ids BIGINT[];
+    v_deleted_count INT := 0;
+    v_expand_until DATE;
+BEGIN
+    v_user_id := public.current_user_id();
+
+    -- Get series
+    SELECT * INTO v_series
+    FROM metadata.time_slot_series
+    WHERE id = p_series_id;
+
+    IF NOT FOUND THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Series not found');
+    END IF;
+
+    -- Check permissions (creator or has update permission or admin)
+    IF NOT (
+        v_series.created_by = v_user_id
+        OR public.has_permission('time_slot_series', 'update')
+        OR public.is_admin()
+    ) THEN
+        RETURN jsonb_build_object('success', FALSE, 'message', 'Permission denied');
+    END IF;
+
+    -- Validate RRULE (will raise exception if invalid)
+    PERFORM metadata.validate_rrule(p_rrule);
+
+    -- Step 1: Collect entity IDs from non-exception instances
+    SELECT array_agg(entity_id) INTO v_entity_ids
+    FROM metadata.time_slot_instances
+    WHERE series_id = p_series_id
+      AND entity_id IS NOT NULL
+      AND is_exception = FALSE;
+
+    -- Step 2: Delete entity records
+    IF v_entity_ids IS NOT NULL AND array_length(v_entity_ids, 1) > 0 THEN
+        EXECUTE format(
+            'DELETE FROM public.%I WHERE id = ANY($1)',
+            v_series.entity_table
+        ) USING v_entity_ids;
+        GET DIAGNOSTICS v_deleted_count = ROW_COUNT;
+    END IF;
+
+    -- Step 3: Delete non-exception instances
+    DELETE FROM metadata.time_slot_instances
+    WHERE series_id = p_series_id AND is_exception = FALSE;
+
+    -- Step 4: Update series schedule and reset expansion tracking
+    UPDATE metadata.time_slot_series
+    SET
+        dtstart = p_dtstart,
+        duration = p_duration,
+        rrule = p_rrule,
+        expanded_until = NULL,  -- Reset to trigger fresh expansion
+        effective_from = p_dtstart::DATE
+    WHERE id = p_series_id;
+
+    -- Step 5: Calculate expansion horizon (p_expand_horizon_days from TODAY)
+    v_expand_until := (NOW() + (p_expand_horizon_days || ' days')::INTERVAL)::DATE;
+
+    -- Step 6: Queue River job for expansion
+    INSERT INTO metadata.river_job (state, queue, kind, args, max_attempts, created_at, scheduled_at)
+    VALUES (
+        'available',
+        'recurring',
+        'expand_recurring_series',
+        jsonb_build_object(
+            'series_id', p_series_id,
+            'expand_until', to_char(v_expand_until::TIMESTAMPTZ, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+        ),
+        3,
+        NOW(),
+        NOW()
+    );
+
+    RETURN jsonb_build_object(
+        'success', TRUE,
+        'message', format('Schedule updated. Deleted %s old records. Expansion queued.', v_deleted_count),
+        'series_id', p_series_id,
+        'entities_deleted', v_deleted_count,
+        'expand_until', v_expand_until
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.update_series_schedule(BIGINT, TIMESTAMP, INTERVAL, TEXT, INTEGER) IS
+    'Updates series schedule (dtstart, duration, rrule) and regenerates instances.
+     Deletes existing non-exception instances and entity records, then queues expansion.
+     p_expand_horizon_days controls how far into the future to generate instances (default 90).
+     Requires creator, update permission, or admin.';
+
+DROP FUNCTION IF EXISTS public.get_entity_lock_conflicts(NAME, TEXT, INT);
+DROP FUNCTION IF EXISTS public.release_entity_lock(NAME, TEXT);
+DROP FUNCTION IF EXISTS public.acquire_entity_lock(NAME, TEXT, INT);
+DROP FUNCTION IF EXISTS metadata.record_entity_lock_conflict(NAME, TEXT, TEXT, TEXT, BIGINT, UUID);
+DROP FUNCTION IF EXISTS metadata.try_lock_entity(NAME, TEXT, INTERVAL, UUID);
+DROP FUNCTION IF EXISTS metadata.entity_lock_holder(NAME, TEXT, UUID);
+DROP FUNCTION IF EXISTS metadata.entity_lock_key(NAME, TEXT);
+
+DROP TABLE IF EXISTS metadata.entity_lock_conflicts;
+DROP TABLE IF EXISTS metadata.entity_soft_locks;
+
+DELETE FROM metadata.maintenance_tasks WHERE name = 'entity_lock_cleanup';
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-79-0-entity-soft-locks';
+
+COMMIT;
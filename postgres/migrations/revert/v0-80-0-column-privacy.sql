@@ -0,0 +1,15 @@
+-- Revert civic_os:v0-80-0-column-privacy from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.log_data_export(NAME, INT, TEXT[], TEXT[], TEXT);
+DROP FUNCTION IF EXISTS public.get_export_redactions(NAME[]);
+DROP FUNCTION IF EXISTS public.set_column_privacy(NAME, NAME, BOOLEAN, TEXT);
+DROP FUNCTION IF EXISTS metadata.private_columns(NAME);
+DROP FUNCTION IF EXISTS metadata.is_column_private(NAME, NAME);
+
+DROP TABLE IF EXISTS metadata.column_privacy;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-80-0-column-privacy';
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- Revert civic_os:v0-81-0-entity-webhooks from pg
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS public.get_entity_webhook_transcript(BIGINT);
+DROP FUNCTION IF EXISTS public.get_entity_webhook_deliveries(VARCHAR, TEXT, INT);
+
+-- Drops integrator triggers that use it
+DROP FUNCTION IF EXISTS metadata.queue_entity_webhooks() CASCADE;
+
+DROP TABLE IF EXISTS metadata.entity_webhook_attempts;
+DROP TABLE IF EXISTS metadata.entity_webhook_deliveries;
+DROP TABLE IF EXISTS metadata.entity_webhook_subscriptions;
+
+DELETE FROM metadata.river_job WHERE kind = 'entity_webhook_delivery' AND state NOT IN ('completed', 'discarded', 'cancelled');
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-81-0-entity-webhooks';
+
+COMMIT;
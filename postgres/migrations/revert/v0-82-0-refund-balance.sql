@@ -0,0 +1,153 @@
+-- Revert civic_os:v0-82-0-refund-balance from pg
+
+BEGIN;
+
+-- Restore the v0.21.0 RPC (one pending refund at a time)
+CREATE OR REPLACE FUNCTION public.initiate_payment_refund(
+    p_payment_id UUID,
+    p_amount NUMERIC(10, 2),
+    p_reason TEXT
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = payments, metadata, public
+AS $$
+DECLARE
+    v_payment RECORD;
+    v_refund_id UUID;
+    v_user_id UUID;
+    v_total_refunded NUMERIC(10, 2);
+    v_pending_count INTEGER;
+    v_remaining NUMERIC(10, 2);
+BEGIN
+    -- Get current user
+    v_user_id := current_user_id();
+    IF v_user_id IS NULL THEN
+        RAISE EXCEPTION 'Authentication required';
+    END IF;
+
+    -- Permission check (not isAdmin - allows flexible role configuration)
+    IF NOT public.has_permission('payment_refunds', 'create') THEN
+        RAISE EXCEPTION 'Missing payment_refunds:create permission'
+            USING HINT = 'Contact administrator to grant payment refund permissions';
+    END IF;
+
+    -- Validate reason length (enforced by CHECK constraint, but provide better error)
+    IF p_reason IS NULL OR LENGTH(TRIM(p_reason)) < 10 THEN
+        RAISE EXCEPTION 'Refund reason must be at least 10 characters'
+            USING HINT = 'Provide a detailed reason for the refund';
+    END IF;
+
+    -- Lock and fetch payment
+    SELECT * INTO v_payment
+    FROM payments.transactions
+    WHERE id = p_payment_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Payment not found: %', p_payment_id;
+    END IF;
+
+    -- Validate payment can be refunded
+    IF v_payment.status != 'succeeded' THEN
+        RAISE EXCEPTION 'Can only refund succeeded payments (current status: %)', v_payment.status
+            USING HINT = 'Payment must have succeeded before it can be refunded';
+    END IF;
+
+    -- Check for pending refunds (block concurrent refunds to prevent race conditions)
+    SELECT COUNT(*) INTO v_pending_count
+    FROM payments.refunds
+    WHERE transaction_id = p_payment_id AND status = 'pending';
+
+    IF v_pending_count > 0 THEN
+        RAISE EXCEPTION 'Payment has % pending refund(s). Wait for them to complete before issuing another.', v_pending_count
+            USING HINT = 'Pending refunds must complete or fail before new refunds can be initiated';
+    END IF;
+
+    -- Calculate total already refunded (supports multiple partial refunds)
+    SELECT COALESCE(SUM(amount), 0) INTO v_total_refunded
+    FROM payments.refunds
+    WHERE transaction_id = p_payment_id AND status = 'succeeded';
+
+    -- Validate refund amount
+    IF p_amount IS NULL OR p_amount <= 0 THEN
+        RAISE EXCEPTION 'Invalid refund amount: %', p_amount
+            USING HINT = 'Refund amount must be greater than zero';
+    END IF;
+
+    -- Calculate remaining refundable amount
+    -- Uses max_refundable which respects fee_refundable setting
+    v_remaining := v_payment.max_refundable - v_total_refunded;
+
+    -- Check if total refunds would exceed max refundable amount
+    IF v_total_refunded + p_amount > v_payment.max_refundable THEN
+        IF v_payment.fee_refundable THEN
+            RAISE EXCEPTION 'Total refunds ($%) would exceed payment amount ($%). Already refunded: $%',
+                v_total_refunded + p_amount, v_payment.max_refundable, v_total_refunded
+                USING HINT = format('Maximum additional refund allowed: $%s', v_remaining);
+        ELSE
+            RAISE EXCEPTION 'Total refunds ($%) would exceed base amount ($%). Processing fee ($%) is non-refundable. Already refunded: $%',
+                v_total_refunded + p_amount, v_payment.max_refundable, v_payment.processing_fee, v_total_refunded
+                USING HINT = format('Maximum additional refund allowed: $%s (processing fee retained)', v_remaining);
+        END IF;
+    END IF;
+
+    -- Create refund record
+    INSERT INTO payments.refunds (
+        transaction_id,
+        amount,
+        reason,
+        initiated_by,
+        status
+    ) VALUES (
+        p_payment_id,
+        p_amount,
+        TRIM(p_reason),
+        v_user_id,
+        'pending'
+    ) RETURNING id INTO v_refund_id;
+
+    -- Enqueue River job for Stripe refund processing
+    INSERT INTO metadata.river_job (
+        kind,
+        args,
+        priority,
+        queue,
+        max_attempts,
+        scheduled_at,
+        state
+    ) VALUES (
+        'process_refund',
+        jsonb_build_object(
+            'refund_id', v_refund_id,
+            'payment_intent_id', v_payment.provider_payment_id,
+            'amount_cents', (p_amount * 100)::INTEGER
+        ),
+        1,  -- Normal priority
+        'default',
+        3,  -- Retry up to 3 times
+        NOW(),
+        'available'
+    );
+
+    RAISE NOTICE 'Created refund % for payment % (amount: $%, total refunded after: $%, max refundable: $%)',
+        v_refund_id, p_payment_id, p_amount, v_total_refunded + p_amount, v_payment.max_refundable;
+
+    RETURN v_refund_id;
+END;
+$$;
+
+COMMENT ON FUNCTION public.initiate_payment_refund IS
+    'Initiate payment refund. Updated in v0.21.0 to use max_refundable which respects fee_refundable setting. Non-refundable fees (default) mean max refund = base amount only.';
+
+DROP INDEX IF EXISTS payments.idx_refunds_provider_refund_id;
+
+DROP TRIGGER IF EXISTS refund_balance ON payments.refunds;
+DROP FUNCTION IF EXISTS payments.sync_refunded_amount();
+
+ALTER TABLE payments.transactions DROP COLUMN IF EXISTS refunded_amount_cents;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-82-0-refund-balance';
+
+COMMIT;
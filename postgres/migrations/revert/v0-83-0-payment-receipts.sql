@@ -0,0 +1,102 @@
+-- Revert civic_os:v0-83-0-payment-receipts from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-83-0-payment-receipts';
+
+-- Restore the v0.14.0 template ("This email serves as your receipt")
+UPDATE metadata.notification_templates
+SET html_template = '<div style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+        <h2 style="color: #16a34a;">Payment Confirmed</h2>
+        <p>Thank you! Your payment has been successfully processed.</p>
+        <table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Description:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.description}}</td>
+            </tr>
+            <tr>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;"><strong>Amount Paid:</strong></td>
+                <td style="padding: 8px; border-bottom: 1px solid #e5e7eb;">{{.Entity.display_name}}</td>
+            </tr>
+        </table>
+        <p style="color: #6b7280; font-size: 14px;">This email serves as your receipt. Please keep it for your records.</p>
+    </div>',
+    text_template = 'Payment Confirmed
+
+Thank you! Your payment has been successfully processed.
+
+Description: {{.Entity.description}}
+Amount Paid: {{.Entity.display_name}}
+
+This email serves as your receipt. Please keep it for your records.'
+WHERE name = 'payment_succeeded';
+
+-- Restore the v0.14.0 trigger function (notification without a receipt)
+CREATE OR REPLACE FUNCTION payments.notify_payment_succeeded()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Only trigger on status change to 'succeeded'
+    IF NEW.status = 'succeeded' AND (OLD.status IS NULL OR OLD.status != 'succeeded') THEN
+        -- Create notification for the user who made the payment
+        PERFORM public.create_notification(
+            p_user_id := NEW.user_id,
+            p_template_name := 'payment_succeeded',
+            p_entity_type := 'payments.transactions',
+            p_entity_id := NEW.id::text,
+            p_entity_data := jsonb_build_object(
+                'id', NEW.id,
+                'amount', NEW.amount,
+                'currency', NEW.currency,
+                'description', NEW.description,
+                'display_name', NEW.display_name
+            ),
+            p_channels := ARRAY['email']
+        );
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- Restore the v0.11.0 job trigger function (no attachments)
+CREATE OR REPLACE FUNCTION public.enqueue_notification_job()
+RETURNS TRIGGER
+SECURITY DEFINER
+SET search_path = metadata, public
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    INSERT INTO metadata.river_job (kind, args, queue, priority, max_attempts, scheduled_at, state)
+    VALUES (
+        'send_notification',
+        jsonb_build_object(
+            'notification_id', NEW.id::text,
+            'user_id', NEW.user_id::text,
+            'template_name', NEW.template_name,
+            'entity_type', NEW.entity_type,
+            'entity_id', NEW.entity_id,
+            'entity_data', NEW.entity_data,
+            'channels', NEW.channels
+        ),
+        'notifications',  -- Queue name
+        1,                -- Priority (higher = more urgent)
+        5,                -- Max attempts (fewer than file jobs - emails are idempotent)
+        NOW(),            -- Schedule immediately
+        'available'       -- Job state
+    );
+    RETURN NEW;
+END;
+$$;
+
+ALTER TABLE metadata.notifications DROP COLUMN attachments;
+
+DROP TRIGGER IF EXISTS assign_receipt_number ON payments.transactions;
+DROP FUNCTION IF EXISTS payments.assign_receipt_number();
+
+ALTER TABLE payments.transactions
+    DROP COLUMN receipt_number,
+    DROP COLUMN receipt_s3_key,
+    DROP COLUMN receipt_generated_at;
+
+DROP SEQUENCE payments.receipt_number_seq;
+
+COMMIT;
@@ -0,0 +1,22 @@
+-- Revert civic_os:v0-84-0-notification-search from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-84-0-notification-search';
+
+DROP FUNCTION IF EXISTS public.get_notification_content(BIGINT);
+DROP FUNCTION IF EXISTS public.search_notifications(TEXT, VARCHAR, VARCHAR, VARCHAR, TEXT, VARCHAR, TIMESTAMPTZ, TIMESTAMPTZ, INT, INT);
+
+DELETE FROM metadata.permission_roles
+WHERE permission_id IN (
+    SELECT id FROM metadata.permissions
+    WHERE table_name IN ('notification_log', 'notification_content')
+);
+DELETE FROM metadata.permissions
+WHERE table_name IN ('notification_log', 'notification_content');
+
+DROP VIEW IF EXISTS metadata.notification_search;
+DROP INDEX IF EXISTS metadata.idx_notifications_user_created;
+DROP TABLE IF EXISTS metadata.notification_log;
+
+COMMIT;
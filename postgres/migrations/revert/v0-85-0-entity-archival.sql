@@ -0,0 +1,32 @@
+-- Revert civic_os:v0-85-0-entity-archival from pg
+--
+-- Archived rows are dropped with the archive schema: unarchive them first.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-85-0-entity-archival';
+
+DROP FUNCTION IF EXISTS public.get_archive_runs(NAME, INT);
+DROP FUNCTION IF EXISTS public.request_unarchive(NAME, TEXT);
+DROP FUNCTION IF EXISTS public.get_archived_entity(NAME, TEXT);
+DROP FUNCTION IF EXISTS public.search_archived_entities(NAME, TEXT, INT, INT);
+DROP FUNCTION IF EXISTS public.set_archive_policy(NAME, INTERVAL, NAME, NAME, BOOLEAN, INT);
+
+DROP FUNCTION IF EXISTS metadata.enqueue_entity_archival();
+DROP FUNCTION IF EXISTS metadata.unarchive_entity(NAME, TEXT);
+DROP FUNCTION IF EXISTS metadata.archive_entity_batch(NAME, BIGINT, INT);
+DROP FUNCTION IF EXISTS metadata.sync_archive_table(NAME);
+DROP FUNCTION IF EXISTS metadata.archive_primary_key(NAME);
+
+DROP INDEX IF EXISTS metadata.idx_files_archive_pending;
+ALTER TABLE metadata.files
+    DROP COLUMN IF EXISTS hot_bucket,
+    DROP COLUMN IF EXISTS archive_status;
+
+DROP TABLE IF EXISTS metadata.archive_runs;
+DROP TABLE IF EXISTS metadata.archived_entities;
+DROP TABLE IF EXISTS metadata.archive_policies;
+
+DROP SCHEMA IF EXISTS archive CASCADE;
+
+COMMIT;
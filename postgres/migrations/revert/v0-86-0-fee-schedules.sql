@@ -0,0 +1,16 @@
+-- Revert civic_os:v0-86-0-fee-schedules from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-86-0-fee-schedules';
+
+DROP FUNCTION IF EXISTS public.set_fee_schedule(TEXT, NUMERIC, INTEGER, BOOLEAN, INTEGER, INTEGER, NUMERIC, INTEGER, BOOLEAN, TIMESTAMPTZ, TEXT);
+DROP VIEW IF EXISTS public.payment_fee_schedules;
+
+ALTER TABLE payments.transactions
+    DROP COLUMN IF EXISTS fee_schedule_id,
+    DROP COLUMN IF EXISTS fee_category;
+
+DROP TABLE IF EXISTS payments.fee_schedules;
+
+COMMIT;
@@ -0,0 +1,22 @@
+-- Revert civic_os:v0-87-0-connected-accounts from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-87-0-connected-accounts';
+
+DROP FUNCTION IF EXISTS public.set_payout_route(TEXT, BIGINT);
+DROP FUNCTION IF EXISTS public.set_connected_account(TEXT, TEXT, TEXT);
+DROP VIEW IF EXISTS public.payment_payouts;
+DROP VIEW IF EXISTS public.payment_connected_accounts;
+
+DROP TABLE IF EXISTS payments.payouts;
+
+ALTER TABLE payments.transactions
+    DROP COLUMN IF EXISTS transfer_reversed_cents,
+    DROP COLUMN IF EXISTS provider_transfer_id,
+    DROP COLUMN IF EXISTS connected_account_id;
+
+DROP TABLE IF EXISTS payments.payout_routes;
+DROP TABLE IF EXISTS payments.connected_accounts;
+
+COMMIT;
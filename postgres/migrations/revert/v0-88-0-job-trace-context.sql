@@ -0,0 +1,13 @@
+-- Revert civic_os:v0-88-0-job-trace-context from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-88-0-job-trace-context';
+
+DROP TRIGGER IF EXISTS stamp_job_traceparent ON metadata.river_job;
+DROP FUNCTION IF EXISTS metadata.stamp_job_traceparent();
+
+DROP INDEX IF EXISTS metadata.idx_upload_requests_file_id;
+ALTER TABLE metadata.file_upload_requests DROP COLUMN IF EXISTS traceparent;
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- Revert civic_os:v0-89-0-queue-controls from pg
+-- Queues paused through these controls stay paused (river_queue.paused_at).
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-89-0-queue-controls';
+
+DROP FUNCTION IF EXISTS metadata.evaluate_queue_circuit_breakers();
+DROP FUNCTION IF EXISTS public.update_queue_circuit_breaker(VARCHAR, BOOLEAN, NUMERIC, INT, INT, INT);
+DROP FUNCTION IF EXISTS public.resume_queue(VARCHAR);
+DROP FUNCTION IF EXISTS public.pause_queue(VARCHAR, TEXT, INT);
+DROP FUNCTION IF EXISTS public.get_queue_controls();
+DROP FUNCTION IF EXISTS metadata.set_river_queue_paused(VARCHAR, BOOLEAN);
+
+DROP INDEX IF EXISTS metadata.idx_river_job_queue_attempted_at;
+DROP TABLE IF EXISTS metadata.queue_controls;
+
+COMMIT;
@@ -0,0 +1,16 @@
+-- Revert civic_os:v0-90-0-job-admin from pg
+-- Queued job_admin jobs are left in river_job; without a worker for their
+-- kind they are discarded on their next attempt.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-90-0-job-admin';
+
+DROP FUNCTION IF EXISTS public.get_job_admin_runs(INT);
+DROP FUNCTION IF EXISTS public.request_cancel_stuck_jobs(INT, TEXT);
+DROP FUNCTION IF EXISTS public.request_retry_discarded_jobs(TEXT, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS public.get_job_kind_summary(INT);
+
+DROP TABLE IF EXISTS metadata.job_admin_runs;
+
+COMMIT;
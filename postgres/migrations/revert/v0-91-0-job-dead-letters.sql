@@ -0,0 +1,20 @@
+-- Revert civic_os:v0-91-0-job-dead-letters from pg
+-- Notifications already created from job_dead_letter keep their rows.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-91-0-job-dead-letters';
+
+DROP FUNCTION IF EXISTS public.dismiss_job_dead_letters(BIGINT[]);
+DROP FUNCTION IF EXISTS public.get_job_dead_letters(BOOLEAN, INT);
+DROP FUNCTION IF EXISTS metadata.capture_missed_dead_letters(TEXT[], INTERVAL);
+DROP FUNCTION IF EXISTS metadata.capture_job_dead_letter(BIGINT, TEXT[]);
+DROP FUNCTION IF EXISTS metadata.notify_job_dead_letters(TEXT[]);
+
+DELETE FROM metadata.notification_templates
+WHERE name = 'job_dead_letter'
+  AND NOT EXISTS (SELECT 1 FROM metadata.notifications WHERE template_name = 'job_dead_letter');
+
+DROP TABLE IF EXISTS metadata.job_dead_letters;
+
+COMMIT;
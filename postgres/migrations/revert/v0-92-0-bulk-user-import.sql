@@ -0,0 +1,19 @@
+-- Revert civic_os:v0-92-0-bulk-user-import from pg
+-- User provisioning records created by imports are kept; uploaded CSVs stay in metadata.files.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-92-0-bulk-user-import';
+
+DROP FUNCTION IF EXISTS public.get_user_import_rows(BIGINT, BOOLEAN);
+DROP FUNCTION IF EXISTS public.get_user_import_batches(INT);
+DROP FUNCTION IF EXISTS public.request_user_import(UUID, TEXT[], BOOLEAN, BOOLEAN);
+
+DELETE FROM metadata.notification_templates
+WHERE name = 'user_import_summary'
+  AND NOT EXISTS (SELECT 1 FROM metadata.notifications WHERE template_name = 'user_import_summary');
+
+DROP TABLE IF EXISTS metadata.user_import_rows;
+DROP TABLE IF EXISTS metadata.user_import_batches;
+
+COMMIT;
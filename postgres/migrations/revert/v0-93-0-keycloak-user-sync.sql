@@ -0,0 +1,16 @@
+-- Revert civic_os:v0-93-0-keycloak-user-sync from pg
+-- Queued keycloak_user_sync jobs are left in river_job; without a worker for
+-- their kind they are discarded on their next attempt.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-93-0-keycloak-user-sync';
+
+DROP FUNCTION IF EXISTS public.get_keycloak_user_sync_conflicts(BOOLEAN);
+DROP FUNCTION IF EXISTS public.get_keycloak_user_sync_runs(INT);
+DROP FUNCTION IF EXISTS metadata.enqueue_keycloak_user_sync();
+
+DROP TABLE IF EXISTS metadata.keycloak_user_sync_conflicts;
+DROP TABLE IF EXISTS metadata.keycloak_user_sync_runs;
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Revert civic_os:v0-94-0-user-deprovisioning from pg
+-- Users already deprovisioned stay disabled in Keycloak and keep their
+-- cleared private rows; locked PII is dropped with its table.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-94-0-user-deprovisioning';
+
+DROP FUNCTION IF EXISTS public.get_user_deprovisioning(INT);
+DROP FUNCTION IF EXISTS public.request_user_deprovisioning(UUID, TEXT, UUID, TEXT);
+DROP FUNCTION IF EXISTS metadata.complete_user_deprovisioning(BIGINT, BOOLEAN, TEXT[]);
+DROP FUNCTION IF EXISTS public.get_deprovisioned_user_pii(UUID);
+DROP FUNCTION IF EXISTS public.set_user_reassignable_column(NAME, NAME, BOOLEAN);
+DROP FUNCTION IF EXISTS metadata.user_owned_record_columns();
+
+DROP TABLE IF EXISTS metadata.deprovisioned_user_pii;
+DROP TABLE IF EXISTS metadata.user_reassignable_columns;
+DROP TABLE IF EXISTS metadata.user_deprovisioning_records;
+DROP TABLE IF EXISTS metadata.user_deprovisioning;
+
+COMMIT;
@@ -0,0 +1,22 @@
+-- Revert civic_os:v0-95-0-keycloak-groups from pg
+-- Groups already created in Keycloak are left there.
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-95-0-keycloak-groups';
+
+DROP FUNCTION IF EXISTS public.revoke_user_group(UUID, TEXT);
+DROP FUNCTION IF EXISTS public.assign_user_group(UUID, TEXT);
+DROP FUNCTION IF EXISTS public.delete_group(SMALLINT);
+DROP FUNCTION IF EXISTS public.create_group(TEXT, TEXT, TEXT);
+
+DROP TRIGGER IF EXISTS trg_user_deprovisioning_clear_groups ON metadata.user_deprovisioning;
+DROP FUNCTION IF EXISTS metadata.trg_user_deprovisioning_clear_groups();
+
+-- Drop the tables before their trigger functions; DROP TABLE takes the triggers with it
+DROP TABLE IF EXISTS metadata.user_groups;
+DROP TABLE IF EXISTS metadata.groups;
+DROP FUNCTION IF EXISTS metadata.trg_user_groups_sync_keycloak();
+DROP FUNCTION IF EXISTS metadata.trg_groups_sync_keycloak();
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Revert civic_os:v0-96-0-welcome-delivery-status from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-96-0-welcome-delivery-status';
+
+DROP TRIGGER IF EXISTS trg_notifications_welcome_status ON metadata.notifications;
+DROP FUNCTION IF EXISTS metadata.trg_notifications_welcome_status();
+
+COMMENT ON COLUMN metadata.user_provisioning.send_welcome_email IS
+    'When true, the Go worker sends a Civic OS welcome notification (template: user_welcome) '
+    'instead of the Keycloak "set password" email. The notification links to the site login page '
+    'where users can sign in via social login or password. Changed in v0.43.0.';
+
+DROP INDEX IF EXISTS metadata.idx_user_provisioning_welcome_notification;
+
+ALTER TABLE metadata.user_provisioning
+    DROP CONSTRAINT IF EXISTS valid_welcome_status,
+    DROP COLUMN IF EXISTS welcome_sent_at,
+    DROP COLUMN IF EXISTS welcome_error,
+    DROP COLUMN IF EXISTS welcome_status,
+    DROP COLUMN IF EXISTS welcome_notification_id;
+
+COMMIT;
@@ -0,0 +1,36 @@
+-- Revert civic_os:v0-97-0-identity-audit-log from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-97-0-identity-audit-log';
+
+DROP FUNCTION IF EXISTS public.get_identity_audit_log(TEXT, UUID, INT, INT);
+
+-- Restore the v0.69.0 stamp (no db_user)
+CREATE OR REPLACE FUNCTION metadata.stamp_job_audit_context()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+SET search_path = metadata, public
+AS $$
+DECLARE
+    v_audit JSONB;
+BEGIN
+    IF NEW.args ? 'audit' THEN
+        RETURN NEW;
+    END IF;
+
+    v_audit := metadata.job_audit_context();
+    IF v_audit IS NOT NULL THEN
+        NEW.args := NEW.args || jsonb_build_object('audit', v_audit);
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+COMMENT ON FUNCTION metadata.stamp_job_audit_context() IS
+    'Adds args.audit (see job_audit_context) to River jobs enqueued from a user request so workers can attribute the records they create. Added in v0.69.0.';
+
+DROP TABLE IF EXISTS metadata.identity_audit_log;
+
+COMMIT;
@@ -0,0 +1,408 @@
+-- Revert civic_os:v0-98-0-source-parser-coverage from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-98-0-source-parser-coverage';
+
+-- Restore the v0.29.0 get_entity_source_code()
+CREATE OR REPLACE FUNCTION public.get_entity_source_code(p_table_name NAME)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+STABLE
+AS $$
+DECLARE
+    v_result JSONB := '[]'::jsonb;
+    v_hidden_count INT := 0;
+    v_is_admin BOOLEAN;
+    v_has_read BOOLEAN;
+    v_is_view BOOLEAN;
+    v_oid OID;
+BEGIN
+    -- Permission check: user must be able to read the entity
+    v_has_read := metadata.has_permission(p_table_name::TEXT, 'read'::TEXT);
+    IF NOT v_has_read THEN
+        RETURN jsonb_build_object('code_objects', '[]'::jsonb, 'hidden_code_count', 0);
+    END IF;
+
+    v_is_admin := metadata.is_admin();
+
+    -- Check if entity is a VIEW
+    SELECT c.relkind = 'v', c.oid
+    INTO v_is_view, v_oid
+    FROM pg_class c
+    JOIN pg_namespace n ON c.relnamespace = n.oid
+    WHERE n.nspname = 'public' AND c.relname = p_table_name;
+
+    -- 1. VIEW DEFINITION (for virtual entities)
+    IF v_is_view AND v_oid IS NOT NULL THEN
+        v_result := v_result || jsonb_build_array(jsonb_build_object(
+            'object_type', 'view_definition',
+            'object_name', p_table_name,
+            'display_name', 'View Definition',
+            'description', 'SQL view that defines this virtual entity',
+            'source_code', 'CREATE OR REPLACE VIEW public.' || p_table_name || ' AS' || E'\n' || pg_get_viewdef(v_oid, true),
+            'language', 'sql',
+            'related_table', p_table_name,
+            'category', 'definition',
+            'ast_json', (SELECT psc.ast_json FROM metadata.parsed_source_code psc
+                         WHERE psc.object_name = p_table_name AND psc.object_type = 'view'),
+            'parse_error', (SELECT psc.parse_error FROM metadata.parsed_source_code psc
+                            WHERE psc.object_name = p_table_name AND psc.object_type = 'view')
+        ));
+    END IF;
+
+    -- 2. RPC FUNCTIONS (via rpc_entity_effects)
+    -- Use DISTINCT ON to deduplicate when a function has multiple effects
+    -- on the same entity (e.g., both 'read' and 'update' effects).
+    -- Includes pre-parsed AST from metadata.parsed_source_code.
+    SELECT v_result || COALESCE(jsonb_agg(row_to_json(sub)::jsonb), '[]'::jsonb)
+    INTO v_result
+    FROM (
+        SELECT DISTINCT ON (p.proname)
+            'function' AS object_type,
+            p.proname::TEXT AS object_name,
+            COALESCE(rf.display_name, initcap(replace(p.proname::TEXT, '_', ' '))) AS display_name,
+            COALESCE(rf.description, ree.description) AS description,
+            pg_get_functiondef(p.oid) AS source_code,
+            l.lanname AS language,
+            p_table_name::TEXT AS related_table,
+            COALESCE(rf.category, 'uncategorized') AS category,
+            psc.ast_json,
+            psc.parse_error
+        FROM metadata.rpc_entity_effects ree
+        JOIN pg_proc p ON p.proname = ree.function_name
+        JOIN pg_namespace n ON n.oid = p.pronamespace AND n.nspname = 'public'
+        JOIN pg_language l ON l.oid = p.prolang
+        LEFT JOIN metadata.rpc_functions rf ON rf.function_name = ree.function_name
+        LEFT JOIN metadata.parsed_source_code psc
+            ON psc.object_name = p.proname AND psc.object_type = 'function'
+        WHERE ree.entity_table = p_table_name
+        ORDER BY p.proname
+    ) sub;
+
+    -- 3. TRIGGERS (on this table)
+    -- AST is looked up by the trigger's function name (proc.proname), not the trigger name.
+    SELECT v_result || COALESCE(jsonb_agg(row_to_json(sub)::jsonb), '[]'::jsonb)
+    INTO v_result
+    FROM (
+        SELECT
+            'trigger_function' AS object_type,
+            t.tgname::TEXT AS object_name,
+            COALESCE(dt.display_name, initcap(replace(t.tgname::TEXT, '_', ' '))) AS display_name,
+            dt.description,
+            pg_get_functiondef(proc.oid) AS source_code,
+            'plpgsql' AS language,
+            p_table_name::TEXT AS related_table,
+            COALESCE(dt.purpose, 'trigger') AS category,
+            psc.ast_json,
+            psc.parse_error
+        FROM pg_trigger t
+        JOIN pg_class c ON c.oid = t.tgrelid
+        JOIN pg_namespace ns ON ns.oid = c.relnamespace
+        JOIN pg_proc proc ON proc.oid = t.tgfoid
+        LEFT JOIN metadata.database_triggers dt
+            ON dt.trigger_name = t.tgname AND dt.table_name = c.relname
+        LEFT JOIN metadata.parsed_source_code psc
+            ON psc.object_name = proc.proname AND psc.object_type = 'function'
+        WHERE ns.nspname = 'public'
+          AND c.relname = p_table_name
+          AND NOT t.tgisinternal
+    ) sub;
+
+    -- 4. INSTEAD OF TRIGGER DEFINITIONS (for views)
+    IF v_is_view THEN
+        SELECT v_result || COALESCE(jsonb_agg(row_to_json(sub)::jsonb), '[]'::jsonb)
+        INTO v_result
+        FROM (
+            SELECT
+                'trigger_definition' AS object_type,
+                t.tgname::TEXT AS object_name,
+                'Trigger: ' || t.tgname::TEXT AS display_name,
+                'INSTEAD OF trigger definition' AS description,
+                pg_get_triggerdef(t.oid) AS source_code,
+                'sql' AS language,
+                p_table_name::TEXT AS related_table,
+                'trigger' AS category
+            FROM pg_trigger t
+            JOIN pg_class c ON c.oid = t.tgrelid
+            JOIN pg_namespace ns ON ns.oid = c.relnamespace
+            WHERE ns.nspname = 'public'
+              AND c.relname = p_table_name
+              AND NOT t.tgisinternal
+              AND (t.tgtype::int & 64) != 0  -- INSTEAD OF triggers only
+        ) sub;
+    END IF;
+
+    -- 5. CHECK CONSTRAINTS
+    SELECT v_result || COALESCE(jsonb_agg(row_to_json(sub)::jsonb), '[]'::jsonb)
+    INTO v_result
+    FROM (
+        SELECT
+            'check_constraint' AS object_type,
+            con.conname::TEXT AS object_name,
+            'CHECK: ' || con.conname::TEXT AS display_name,
+            'Check constraint on ' || p_table_name::TEXT AS description,
+            pg_get_constraintdef(con.oid, true) AS source_code,
+            'sql' AS language,
+            p_table_name::TEXT AS related_table,
+            'constraint' AS category
+        FROM pg_constraint con
+        JOIN pg_class c ON con.conrelid = c.oid
+        JOIN pg_namespace n ON c.relnamespace = n.oid
+        WHERE n.nspname = 'public'
+          AND c.relname = p_table_name
+          AND con.contype = 'c'  -- CHECK constraints only
+    ) sub;
+
+    -- 6. COLUMN DEFAULTS (skip nextval sequences)
+    SELECT v_result || COALESCE(jsonb_agg(row_to_json(sub)::jsonb), '[]'::jsonb)
+    INTO v_result
+    FROM (
+        SELECT
+            'column_default' AS object_type,
+            a.attname::TEXT AS object_name,
+            'Default: ' || a.attname::TEXT AS display_name,
+            'Default value for column ' || a.attname::TEXT AS description,
+            pg_get_expr(d.adbin, d.adrelid) AS source_code,
+            'sql' AS language,
+            p_table_name::TEXT AS related_table,
+            'default' AS category
+        FROM pg_attrdef d
+        JOIN pg_attribute a ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+        JOIN pg_class c ON a.attrelid = c.oid
+        JOIN pg_namespace n ON c.relnamespace = n.oid
+        WHERE n.nspname = 'public'
+          AND c.relname = p_table_name
+          AND NOT a.attisdropped
+          AND pg_get_expr(d.adbin, d.adrelid) NOT LIKE 'nextval(%'
+    ) sub;
+
+    -- 7. RLS POLICIES (admin-only)
+    IF v_is_admin THEN
+        SELECT v_result || COALESCE(jsonb_agg(row_to_json(sub)::jsonb), '[]'::jsonb)
+        INTO v_result
+        FROM (
+            SELECT
+                'rls_policy' AS object_type,
+                pol.polname::TEXT AS object_name,
+                'Policy: ' || pol.polname::TEXT AS display_name,
+                CASE pol.polcmd
+                    WHEN 'r' THEN 'SELECT policy'
+                    WHEN 'a' THEN 'INSERT policy'
+                    WHEN 'w' THEN 'UPDATE policy'
+                    WHEN 'd' THEN 'DELETE policy'
+                    ELSE 'ALL policy'
+                END AS description,
+                'USING (' || COALESCE(pg_get_expr(pol.polqual, pol.polrelid), 'true') || ')' ||
+                CASE WHEN pol.polwithcheck IS NOT NULL
+                    THEN E'\nWITH CHECK (' || pg_get_expr(pol.polwithcheck, pol.polrelid) || ')'
+                    ELSE ''
+                END AS source_code,
+                'sql' AS language,
+                p_table_name::TEXT AS related_table,
+                'security' AS category
+            FROM pg_policy pol
+            JOIN pg_class c ON pol.polrelid = c.oid
+            JOIN pg_namespace n ON c.relnamespace = n.oid
+            WHERE n.nspname = 'public'
+              AND c.relname = p_table_name
+        ) sub;
+    ELSE
+        -- Count hidden RLS policies for non-admins
+        SELECT COUNT(*)
+        INTO v_hidden_count
+        FROM pg_policy pol
+        JOIN pg_class c ON pol.polrelid = c.oid
+        JOIN pg_namespace n ON c.relnamespace = n.oid
+        WHERE n.nspname = 'public'
+          AND c.relname = p_table_name;
+    END IF;
+
+    RETURN jsonb_build_object(
+        'code_objects', v_result,
+        'hidden_code_count', v_hidden_count
+    );
+END;
+$$;
+
+COMMENT ON FUNCTION public.get_entity_source_code(NAME) IS
+    'Returns all executable SQL code objects for an entity, permission-filtered.
+     Includes: view definitions, RPC functions, triggers, CHECK constraints,
+     column defaults, and RLS policies (admin-only).
+     Added in v0.29.0.';
+
+-- Revoke default PUBLIC execute, then grant to both authenticated and
+-- web_anon. Anonymous users can already see schema_functions/schema_triggers
+-- source code via the views; this RPC follows the same permission model
+-- (has_permission() filters results internally).
+REVOKE EXECUTE ON FUNCTION public.get_entity_source_code(NAME) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION public.get_entity_source_code(NAME) TO authenticated, web_anon;
+
+
+-- Restore the v0.36.0 views
+DROP VIEW IF EXISTS public.parsed_source_code;
+DROP VIEW IF EXISTS public.schema_functions;
+
+CREATE VIEW public.schema_functions
+WITH (security_invoker = true) AS
+WITH
+entity_effects AS (
+    SELECT
+        ree.function_name,
+        jsonb_agg(DISTINCT jsonb_build_object(
+            'table', ree.entity_table,
+            'effect', ree.effect_type,
+            'auto_detected', ree.is_auto_detected,
+            'description', ree.description
+        )) FILTER (
+            WHERE metadata.has_permission(ree.entity_table::TEXT, 'read'::TEXT)
+        ) AS visible_effects,
+        COUNT(*) FILTER (
+            WHERE NOT metadata.has_permission(ree.entity_table::TEXT, 'read'::TEXT)
+        )::INT AS hidden_count
+    FROM metadata.rpc_entity_effects ree
+    GROUP BY ree.function_name
+)
+SELECT
+    p.proname AS function_name,
+    n.nspname::NAME AS schema_name,
+    COALESCE(rf.display_name, initcap(replace(p.proname::text, '_', ' '))) AS display_name,
+    rf.description,
+    rf.category,
+    rf.parameters,
+    pg_get_function_result(p.oid) AS returns_type,
+    rf.returns_description,
+    COALESCE(rf.is_idempotent, false) AS is_idempotent,
+    rf.minimum_role,
+    COALESCE(ee.visible_effects, '[]'::jsonb) AS entity_effects,
+    COALESCE(ee.hidden_count, 0) AS hidden_effects_count,
+    rf.function_name IS NOT NULL AS is_registered,
+    EXISTS (
+        SELECT 1 FROM metadata.scheduled_jobs sj
+        WHERE sj.function_name = p.proname::TEXT
+          AND sj.enabled = true
+    ) AS has_active_schedule,
+    CASE
+        WHEN EXISTS (SELECT 1 FROM metadata.entity_actions ea WHERE ea.rpc_function = p.proname::NAME)
+        THEN EXISTS (
+            SELECT 1 FROM metadata.entity_actions ea
+            WHERE ea.rpc_function = p.proname::NAME
+              AND metadata.has_entity_action_permission(ea.id)
+        )
+        ELSE true
+    END AS can_execute,
+    pg_get_functiondef(p.oid) AS source_code,
+    l.lanname AS language,
+    psc.ast_json
+
+FROM pg_proc p
+JOIN pg_namespace n ON n.oid = p.pronamespace
+JOIN pg_language l ON l.oid = p.prolang
+LEFT JOIN metadata.rpc_functions rf ON rf.function_name = p.proname
+LEFT JOIN entity_effects ee ON ee.function_name = p.proname
+LEFT JOIN metadata.parsed_source_code psc
+    ON psc.object_name = p.proname AND psc.object_type = 'function'
+
+WHERE n.nspname = 'public'
+  AND p.prokind = 'f'
+  AND p.proname NOT IN (
+      'is_admin', 'has_permission', 'get_user_roles',
+      'current_user_id', 'current_user_email', 'current_user_name', 'current_user_phone',
+      'check_jwt', 'get_initial_status', 'get_statuses_for_entity', 'get_status_entity_types',
+      'has_role', 'has_entity_action_permission',
+      'refresh_current_user',
+      'grant_entity_action_permission', 'revoke_entity_action_permission', 'get_entity_action_roles',
+      'upsert_entity_metadata', 'upsert_property_metadata',
+      'update_entity_sort_order', 'update_property_sort_order',
+      'create_role', 'get_roles', 'get_role_permissions',
+      'set_role_permission', 'ensure_table_permissions', 'enable_entity_notes',
+      'get_dashboards', 'get_dashboard', 'get_user_default_dashboard',
+      'schema_relations_func', 'schema_view_relations_func', 'schema_view_validations_func',
+      'set_created_at', 'set_updated_at', 'set_file_created_by',
+      'add_status_change_note', 'add_payment_status_change_note',
+      'add_reservation_status_change_note', 'validate_status_entity_type',
+      'enqueue_notification_job', 'create_notification', 'create_default_notification_preferences',
+      'notify_new_reservation_request', 'notify_reservation_status_change',
+      'insert_s3_presign_job', 'insert_thumbnail_job', 'create_payment_intent_sync',
+      'cleanup_old_validation_results', 'get_validation_results',
+      'get_preview_results', 'preview_template_parts', 'validate_template_parts',
+      'get_upload_url', 'request_upload_url',
+      'format_public_display_name',
+      'get_entity_source_code',
+      'create_schema_decision',
+      'can_manage_role', 'get_manageable_roles',
+      'assign_user_role', 'revoke_user_role',
+      'delete_role', 'set_role_can_manage', 'get_role_can_manage',
+      'create_provisioned_user', 'retry_user_provisioning', 'bulk_provision_users',
+      -- v0.36.0: Exclude role helper
+      'get_role_id'
+  )
+  AND (
+      NOT EXISTS (SELECT 1 FROM metadata.entity_actions ea WHERE ea.rpc_function = p.proname::NAME)
+      OR EXISTS (
+          SELECT 1 FROM metadata.entity_actions ea
+          WHERE ea.rpc_function = p.proname::NAME
+            AND metadata.has_entity_action_permission(ea.id)
+      )
+      OR EXISTS (
+          SELECT 1 FROM metadata.rpc_entity_effects ree
+          WHERE ree.function_name = p.proname
+            AND metadata.has_permission(ree.entity_table::TEXT, 'read'::TEXT)
+      )
+  );
+
+COMMENT ON VIEW public.schema_functions IS
+    'Catalog-first view of public functions with source code. Updated in v0.36.0 to exclude get_role_id.';
+
+GRANT SELECT ON public.schema_functions TO authenticated, web_anon;
+
+
+CREATE VIEW public.parsed_source_code
+WITH (security_invoker = true) AS
+SELECT psc.schema_name, psc.object_name, psc.object_type, psc.language,
+       psc.ast_json, psc.parse_error, psc.parsed_at
+FROM metadata.parsed_source_code psc
+WHERE
+  (psc.object_type = 'function' AND (
+    EXISTS (
+      SELECT 1 FROM public.schema_functions sf
+      WHERE sf.function_name = psc.object_name
+    )
+    OR
+    EXISTS (
+      SELECT 1 FROM public.schema_triggers st
+      WHERE st.function_name = psc.object_name
+    )
+  ))
+  OR
+  (psc.object_type = 'view'
+    AND metadata.has_permission(psc.object_name::TEXT, 'read'::TEXT));
+
+COMMENT ON VIEW public.parsed_source_code IS
+    'Permission-filtered view of pre-parsed AST JSON. Delegates visibility to
+     schema_functions/schema_triggers for functions and has_permission for views.
+     Added in v0.29.0.';
+
+GRANT SELECT ON public.parsed_source_code TO authenticated, web_anon;
+
+
+-- Rows the old object_type CHECK and primary key can't hold
+DELETE FROM metadata.parsed_source_code
+WHERE object_type NOT IN ('function', 'view') OR schema_name <> 'public';
+
+ALTER TABLE metadata.parsed_source_code
+    DROP CONSTRAINT parsed_source_code_pkey,
+    ADD PRIMARY KEY (schema_name, object_name, object_type),
+    DROP CONSTRAINT parsed_source_code_object_type_check,
+    ADD CONSTRAINT parsed_source_code_object_type_check CHECK (object_type IN ('function', 'view')),
+    DROP COLUMN table_name;
+
+COMMENT ON TABLE metadata.parsed_source_code IS
+    'Pre-parsed AST JSON for public functions and views. Populated by the Go
+     consolidated worker using pg_query_go. Frontend fetches AST via the public
+     view to map PL/pgSQL nodes to Blockly blocks. Added in v0.29.0.';
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
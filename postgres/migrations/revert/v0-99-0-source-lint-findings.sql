@@ -0,0 +1,12 @@
+-- Revert civic_os:v0-99-0-source-lint-findings from pg
+
+BEGIN;
+
+DELETE FROM metadata.schema_decisions WHERE migration_id = 'v0-99-0-source-lint-findings';
+
+DROP VIEW IF EXISTS public.source_lint_findings;
+DROP TABLE IF EXISTS metadata.source_lint_findings;
+
+NOTIFY pgrst, 'reload schema';
+
+COMMIT;
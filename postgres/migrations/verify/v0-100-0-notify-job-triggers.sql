@@ -0,0 +1,9 @@
+-- Verify civic_os:v0-100-0-notify-job-triggers on pg
+
+-- 3. Expansion request column and helper
+SELECT expansion_requested_until FROM metadata.time_slot_series WHERE FALSE;
+SELECT 'metadata.request_series_expansion(bigint, date)'::regprocedure;
+
+-- 1, 2, 4. Functions notify instead of inserting jobs
+SELECT 1/(NOT (pg_get_functiondef('public.enqueue_notification_job()'::regprocedure) LIKE '%river_job%'))::INT;
+SELECT 1/(NOT (pg_get_functiondef('public.update_series_schedule(bigint, timestamp, interval, text, integer)'::regprocedure) LIKE '%river_job%'))::INT;
@@ -0,0 +1,17 @@
+-- Verify civic_os:v0-101-0-transactional-outbox on pg
+
+-- 1. Outbox table
+SELECT id, destination, kind, payload, audit, status, attempts, last_error,
+       next_attempt_at, created_at, delivered_at
+FROM metadata.outbox_messages WHERE FALSE;
+
+-- 2. Enqueue function
+SELECT 'metadata.enqueue_outbox_message(text, text, jsonb)'::regprocedure;
+
+-- 3. Keycloak sync triggers write to the outbox
+SELECT 1/(NOT (pg_get_functiondef('metadata.trg_user_roles_sync_keycloak()'::regprocedure) LIKE '%river_job%'))::INT;
+SELECT 1/(NOT (pg_get_functiondef('metadata.trg_user_groups_sync_keycloak()'::regprocedure) LIKE '%river_job%'))::INT;
+
+-- 4. Admin view and retry
+SELECT id FROM public.outbox_messages WHERE FALSE;
+SELECT 'public.retry_outbox_message(bigint)'::regprocedure;
@@ -0,0 +1,14 @@
+-- Verify civic_os:v0-102-0-entity-exports on pg
+
+-- 1. Exports table exists
+SELECT id, user_id, table_name, format, filters, columns, order_by, roles, status, row_count,
+       withheld_columns, file_name, s3_key, byte_size, error_message,
+       created_at, started_at, completed_at, expires_at
+FROM metadata.entity_exports WHERE FALSE;
+
+-- 2. Notification template exists
+SELECT 1/COUNT(*) FROM metadata.notification_templates WHERE name = 'entity_export_ready';
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.request_entity_export(name, text, jsonb, text[], text)', 'execute');
+SELECT has_function_privilege('public.get_entity_exports(int)', 'execute');
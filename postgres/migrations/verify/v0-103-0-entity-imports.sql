@@ -0,0 +1,19 @@
+-- Verify civic_os:v0-103-0-entity-imports on pg
+
+-- 1. Import tables exist
+SELECT id, user_id, table_name, file_id, file_name, column_map, dry_run, roles, status,
+       columns, ignored_headers, total_rows, processed_rows, valid_rows, invalid_rows,
+       imported_rows, error_message, created_at, started_at, validated_at, completed_at
+FROM metadata.entity_imports WHERE FALSE;
+
+SELECT id, import_id, row_number, column_name, value, message
+FROM metadata.entity_import_errors WHERE FALSE;
+
+-- 2. Notification template exists
+SELECT 1/COUNT(*) FROM metadata.notification_templates WHERE name = 'entity_import_summary';
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.request_entity_import(name, uuid, jsonb, boolean)', 'execute');
+SELECT has_function_privilege('public.start_entity_import(bigint)', 'execute');
+SELECT has_function_privilege('public.get_entity_imports(int)', 'execute');
+SELECT has_function_privilege('public.get_entity_import_errors(bigint)', 'execute');
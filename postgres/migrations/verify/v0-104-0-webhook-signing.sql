@@ -0,0 +1,11 @@
+-- Verify civic_os:v0-104-0-webhook-signing on pg
+
+-- 1. Columns exist
+SELECT signing_secret_name, consecutive_failures, disable_after_failures, disabled_at, disabled_reason
+FROM metadata.entity_webhook_subscriptions WHERE FALSE;
+
+-- 2. Trigger function exists
+SELECT has_function_privilege('metadata.reset_entity_webhook_failures()', 'execute');
+
+-- 3. RPC exists
+SELECT has_function_privilege('public.get_entity_webhook_subscriptions()', 'execute');
@@ -0,0 +1,18 @@
+-- Verify civic_os:v0-105-0-entity-audit-log on pg
+
+-- 1. Tables exist
+SELECT id, table_name, entity_id, operation, old_row, new_row, audit, txid, occurred_at
+FROM metadata.entity_changes WHERE FALSE;
+
+SELECT id, change_id, occurred_at, txid, table_name, entity_id, operation, changed_columns,
+       before_values, after_values, actor_id, on_behalf_of, impersonated_roles, request_id, db_user, recorded_at
+FROM metadata.entity_audit_log WHERE FALSE;
+
+SELECT table_name, retain_days, created_at, updated_at
+FROM metadata.entity_audit_retention WHERE FALSE;
+
+-- 2. Functions exist
+SELECT has_function_privilege('metadata.capture_entity_changes()', 'execute');
+SELECT has_function_privilege('metadata.enable_entity_audit(name, int)', 'execute');
+SELECT has_function_privilege('metadata.disable_entity_audit(name)', 'execute');
+SELECT has_function_privilege('public.get_entity_audit_log(name, text, uuid, int, int)', 'execute');
@@ -0,0 +1,13 @@
+-- Verify civic_os:v0-106-0-database-backups on pg
+
+-- 1. Columns exist
+SELECT backup_schemas, backup_keep FROM metadata.scheduled_jobs WHERE FALSE;
+
+-- 2. Backup targets are allowed
+SELECT 1 / COUNT(*)
+FROM pg_constraint
+WHERE conname = 'scheduled_jobs_valid_target_type'
+  AND pg_get_constraintdef(oid) LIKE '%backup%';
+
+-- 3. RPC exists
+SELECT has_function_privilege('public.trigger_scheduled_job(varchar)', 'execute');
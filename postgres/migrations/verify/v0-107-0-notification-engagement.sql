@@ -0,0 +1,12 @@
+-- Verify civic_os:v0-107-0-notification-engagement on pg
+
+-- 1. Template opt-in column exists
+SELECT track_engagement FROM metadata.notification_templates WHERE FALSE;
+
+-- 2. Events table exists
+SELECT id, notification_id, template_name, event_type, url, occurred_at
+FROM metadata.notification_engagement WHERE FALSE;
+
+-- 3. Functions exist
+SELECT has_function_privilege('public.get_notification_engagement_stats(varchar, timestamptz, timestamptz)', 'execute');
+SELECT has_function_privilege('public.get_notification_link_clicks(varchar, timestamptz, timestamptz)', 'execute');
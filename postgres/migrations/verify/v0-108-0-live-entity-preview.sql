@@ -0,0 +1,3 @@
+-- Verify civic_os:v0-108-0-live-entity-preview on pg
+
+SELECT has_function_privilege('public.preview_template_parts(uuid, text, text, text, text, jsonb, name, text)', 'execute');
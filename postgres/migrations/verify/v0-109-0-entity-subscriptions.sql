@@ -0,0 +1,16 @@
+-- Verify civic_os:v0-109-0-entity-subscriptions on pg
+
+-- 1. Table exists
+SELECT id, user_id, entity_type, entity_id, filters, events, channels, template_name, created_at
+FROM metadata.entity_subscriptions WHERE FALSE;
+
+-- 2. Template exists
+SELECT 1/COUNT(*) FROM metadata.notification_templates WHERE name = 'entity_subscription_update';
+
+-- 3. Functions exist
+SELECT has_function_privilege('metadata.queue_entity_subscription_fanout()', 'execute');
+SELECT has_function_privilege('metadata.enable_entity_subscriptions(name)', 'execute');
+SELECT has_function_privilege('metadata.disable_entity_subscriptions(name)', 'execute');
+SELECT has_function_privilege('public.subscribe_to_entity(name, text, jsonb, text[], text[])', 'execute');
+SELECT has_function_privilege('public.unsubscribe_from_entity(bigint)', 'execute');
+SELECT has_function_privilege('public.get_my_entity_subscriptions(name, text)', 'execute');
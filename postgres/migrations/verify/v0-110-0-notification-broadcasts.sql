@@ -0,0 +1,17 @@
+-- Verify civic_os:v0-110-0-notification-broadcasts on pg
+
+-- 1. Broadcasts table and notification link exist
+SELECT id, template_name, entity_data, channels, role_keys, user_ids, all_users, status,
+       last_user_id, scheduled_until, recipients, queued, skipped, sent, failed, error_message,
+       requested_by, river_job_id, created_at, started_at, completed_at
+FROM metadata.notification_broadcasts WHERE FALSE;
+
+SELECT broadcast_id FROM metadata.notifications WHERE FALSE;
+
+-- 2. Permissions and template exist
+SELECT 1/COUNT(*) FROM metadata.permissions WHERE table_name = 'notification_broadcasts' AND permission = 'create';
+SELECT 1/COUNT(*) FROM metadata.notification_templates WHERE name = 'notification_broadcast_summary';
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.request_notification_broadcast(varchar, text[], uuid[], boolean, jsonb, text[])', 'execute');
+SELECT has_function_privilege('public.get_notification_broadcasts(int)', 'execute');
@@ -0,0 +1,7 @@
+-- Verify civic_os:v0-111-0-file-placeholders on pg
+
+-- 1. Placeholder columns exist
+SELECT blurhash, placeholder_color FROM metadata.files WHERE FALSE;
+
+-- 2. Exposed through the public view
+SELECT blurhash, placeholder_color FROM public.files WHERE FALSE;
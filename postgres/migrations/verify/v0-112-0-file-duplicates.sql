@@ -0,0 +1,12 @@
+-- Verify civic_os:v0-112-0-file-duplicates on pg
+
+-- 1. Hash column exists
+SELECT perceptual_hash FROM metadata.files WHERE FALSE;
+
+-- 2. Duplicate flags table exists
+SELECT file_id, duplicate_of, distance, detected_at, dismissed_at, dismissed_by
+FROM metadata.file_duplicates WHERE FALSE;
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.get_file_duplicates(text, text, boolean)', 'execute');
+SELECT has_function_privilege('public.dismiss_file_duplicate(uuid, uuid)', 'execute');
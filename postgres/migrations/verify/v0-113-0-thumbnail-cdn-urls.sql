@@ -0,0 +1,9 @@
+-- Verify civic_os:v0-113-0-thumbnail-cdn-urls on pg
+
+-- 1. Signed URL table exists
+SELECT file_id, thumbnail_small_url, thumbnail_medium_url, thumbnail_large_url, signed_at, expires_at
+FROM metadata.file_cdn_urls WHERE FALSE;
+
+-- 2. View exposes the URLs
+SELECT cdn_thumbnail_small_url, cdn_thumbnail_medium_url, cdn_thumbnail_large_url, cdn_urls_expire_at
+FROM public.files WHERE FALSE;
@@ -0,0 +1,8 @@
+-- Verify civic_os:v0-114-0-upload-request-expiry on pg
+
+-- 1. Lifecycle columns exist
+SELECT uploaded_at, expired_at FROM metadata.file_upload_requests WHERE FALSE;
+
+-- 2. Trigger function and summary RPC exist
+SELECT has_function_privilege('metadata.mark_upload_request_used()', 'execute');
+SELECT has_function_privilege('public.get_abandoned_upload_summary(int)', 'execute');
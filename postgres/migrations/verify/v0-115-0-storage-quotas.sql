@@ -0,0 +1,14 @@
+-- Verify civic_os:v0-115-0-storage-quotas on pg
+
+-- 1. Quota and usage tables exist
+SELECT entity_type, max_bytes, created_at, updated_at FROM metadata.storage_quotas WHERE FALSE;
+SELECT entity_type, file_count, total_bytes, computed_at FROM metadata.storage_usage WHERE FALSE;
+
+-- 2. Upload requests record the file size
+SELECT file_size FROM metadata.file_upload_requests WHERE FALSE;
+
+-- 3. Functions exist
+SELECT has_function_privilege('metadata.refresh_storage_usage()', 'execute');
+SELECT has_function_privilege('public.request_upload_url(text, text, text, text, bigint)', 'execute');
+SELECT has_function_privilege('public.set_storage_quota(text, bigint)', 'execute');
+SELECT has_function_privilege('public.get_storage_usage()', 'execute');
@@ -0,0 +1,8 @@
+-- Verify civic_os:v0-116-0-sms-segments on pg
+
+-- 1. SMS columns exist
+SELECT sms_length, sms_segments, sms_encoding FROM metadata.template_part_validation_results WHERE FALSE;
+
+-- 2. Functions exist with the new signatures
+SELECT has_function_privilege('public.validate_template_parts(uuid, text, text, text, text, jsonb)', 'execute');
+SELECT 1 / (pg_get_function_result('public.get_validation_results(uuid)'::regprocedure) LIKE '%sms_encoding%')::INT;
@@ -0,0 +1,7 @@
+-- Verify civic_os:v0-117-0-template-warnings on pg
+
+-- 1. Warnings column exists
+SELECT warnings FROM metadata.template_part_validation_results WHERE FALSE;
+
+-- 2. get_validation_results() returns it
+SELECT 1 / (pg_get_function_result('public.get_validation_results(uuid)'::regprocedure) LIKE '%warnings%')::INT;
@@ -0,0 +1,13 @@
+-- Verify civic_os:v0-118-0-notification-archive on pg
+
+-- 1. Template opt-in
+SELECT archive_rendered FROM metadata.notification_templates WHERE FALSE;
+
+-- 2. Archive table
+SELECT id, notification_id, river_job_id, template_name, entity_type, entity_id,
+       recipients, cc, channels_sent, attachment_names,
+       subject, html_body, text_body, sms_body, sent_at
+FROM metadata.notification_archive WHERE FALSE;
+
+-- 3. Search RPC
+SELECT has_function_privilege('public.search_notification_archive(text, varchar, varchar, varchar, timestamptz, timestamptz, int, int)', 'execute');
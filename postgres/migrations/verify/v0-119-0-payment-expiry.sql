@@ -0,0 +1,10 @@
+-- Verify civic_os:v0-119-0-payment-expiry on pg
+
+-- 1. 'expired' is an allowed status
+SELECT 1 / (pg_get_constraintdef(oid) LIKE '%expired%')::INT
+FROM pg_constraint
+WHERE conname = 'valid_status' AND conrelid = 'payments.transactions'::regclass;
+
+-- 2. Sweep index
+SELECT 1 / COUNT(*)::INT FROM pg_indexes
+WHERE schemaname = 'payments' AND indexname = 'idx_payments_transactions_pending_updated';
@@ -0,0 +1,10 @@
+-- Verify civic_os:v0-120-0-offline-payments on pg
+
+-- 1. Offline columns
+SELECT offline_reference, received_at, recorded_by FROM payments.transactions WHERE FALSE;
+
+-- 2. View exposes them
+SELECT payment_method, offline_reference, received_at, recorded_by FROM public.payment_transactions WHERE FALSE;
+
+-- 3. RPC
+SELECT has_function_privilege('public.record_offline_payment(uuid, numeric, text, text, text, name, text, name, timestamptz)', 'execute');
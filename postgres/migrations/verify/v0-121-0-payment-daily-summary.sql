@@ -0,0 +1,22 @@
+-- Verify civic_os:v0-121-0-payment-daily-summary on pg
+
+-- 1. Succeeded timestamp and its trigger
+SELECT succeeded_at FROM payments.transactions WHERE FALSE;
+SELECT 1/COUNT(*)::INT FROM pg_trigger
+WHERE tgname = 'stamp_succeeded_at' AND tgrelid = 'payments.transactions'::regclass;
+
+-- 2. Disputes
+SELECT id, transaction_id, provider_dispute_id, amount_cents, status, opened_at, closed_at
+FROM payments.disputes WHERE FALSE;
+
+-- 3. Summary tables
+SELECT summary_date, category, payment_count, gross_amount, processing_fees, refund_count,
+       refunded_amount, dispute_count, disputed_amount, net_amount
+FROM payments.daily_summaries WHERE FALSE;
+SELECT summary_date, timezone, generated_at, recipient_count FROM payments.daily_summary_runs WHERE FALSE;
+
+-- 4. Template
+SELECT 1/COUNT(*)::INT FROM metadata.notification_templates WHERE name = 'payment_daily_summary';
+
+-- 5. View
+SELECT summary_date, category, category_display_name, net_amount FROM public.payment_daily_summaries WHERE FALSE;
@@ -0,0 +1,8 @@
+-- Verify civic_os:v0-122-0-inbound-webhooks on pg
+
+-- 2. Delivery events
+SELECT id, webhook_id, channel, provider, provider_message_id, recipient, event, reason, occurred_at
+FROM metadata.delivery_events WHERE FALSE;
+
+-- 3. View
+SELECT id, channel, recipient, event, reason, occurred_at FROM public.delivery_events WHERE FALSE;
@@ -0,0 +1,4 @@
+-- Verify civic_os:v0-123-0-scheduler-leader on pg
+
+-- 1. Run claim
+SELECT id, last_run_at, last_queued_at FROM metadata.scheduled_jobs WHERE FALSE;
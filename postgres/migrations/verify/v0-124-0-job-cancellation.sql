@@ -0,0 +1,14 @@
+-- Verify civic_os:v0-124-0-job-cancellation on pg
+
+-- 1. Cancellation requests
+SELECT id, river_job_id, kind, reason, requested_by, requested_at, acknowledged_at, result
+FROM metadata.job_cancellation_requests WHERE FALSE;
+
+-- 2-3. RPCs
+SELECT has_function_privilege('public.request_job_cancellation(bigint, text)', 'execute');
+SELECT has_function_privilege('public.cancel_entity_import(bigint, text)', 'execute');
+
+-- 4. Cancelled status
+SELECT 1/COUNT(*)::INT FROM pg_constraint
+WHERE conname = 'entity_imports_status_check'
+  AND pg_get_constraintdef(oid) LIKE '%cancelled%';
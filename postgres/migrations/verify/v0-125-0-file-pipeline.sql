@@ -0,0 +1,9 @@
+-- Verify civic_os:v0-125-0-file-pipeline on pg
+
+-- 1. Step columns
+SELECT upload_status, scan_status, scan_signature, metadata_status,
+       content_sha256, detected_type, pipeline_error
+FROM metadata.files WHERE FALSE;
+
+-- 3. View
+SELECT upload_status, scan_status, metadata_status FROM public.files WHERE FALSE;
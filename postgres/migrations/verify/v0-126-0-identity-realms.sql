@@ -0,0 +1,5 @@
+-- Verify civic_os:v0-126-0-identity-realms on pg
+
+SELECT identity_realm FROM metadata.civic_os_users WHERE FALSE;
+SELECT realm FROM metadata.user_provisioning WHERE FALSE;
+SELECT realm FROM metadata.keycloak_user_sync_runs WHERE FALSE;
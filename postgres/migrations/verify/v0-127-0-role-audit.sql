@@ -0,0 +1,15 @@
+-- Verify civic_os:v0-127-0-role-audit on pg
+
+-- 1. Audit runs table exists
+SELECT id, river_job_id, status, heal_direction, last_user_id, users_checked, users_skipped,
+       drift_found, drift_healed, open_drift, error_message, started_at, finished_at
+FROM metadata.role_audit_runs WHERE FALSE;
+
+-- 2. Drift table exists
+SELECT id, user_id, role_key, drift_type, realm, first_seen_at, last_seen_at,
+       resolved_at, resolution, heal_error
+FROM metadata.role_drift WHERE FALSE;
+
+-- 3. Admin RPCs exist
+SELECT has_function_privilege('public.get_role_audit_runs(int)', 'execute');
+SELECT has_function_privilege('public.get_role_drift(boolean)', 'execute');
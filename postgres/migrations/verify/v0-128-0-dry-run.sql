@@ -0,0 +1,8 @@
+-- Verify civic_os:v0-128-0-dry-run on pg
+
+-- 1. Simulated operations table exists
+SELECT id, service, category, operation, target, details, river_job_id, job_kind, created_at
+FROM metadata.simulated_operations WHERE FALSE;
+
+-- 2. Admin RPC exists
+SELECT has_function_privilege('public.get_simulated_operations(int)', 'execute');
@@ -0,0 +1,13 @@
+-- Verify civic_os:v0-129-0-email-suppressions on pg
+
+-- 1. Suppressions table exists
+SELECT id, email_address, reason, source, detail, expires_at, event_count,
+       created_by, created_at, last_event_at
+FROM metadata.email_suppressions WHERE FALSE;
+
+-- 2. Admin view exists
+SELECT id, email_address, reason, active FROM public.email_suppressions WHERE FALSE;
+
+-- 3. Admin RPCs exist
+SELECT has_function_privilege('public.suppress_email(text, timestamptz, text)', 'execute');
+SELECT has_function_privilege('public.unsuppress_email(text)', 'execute');
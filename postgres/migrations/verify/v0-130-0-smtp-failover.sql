@@ -0,0 +1,5 @@
+-- Verify civic_os:v0-130-0-smtp-failover on pg
+
+-- 1. Delivering server columns exist
+SELECT email_provider FROM metadata.notification_log WHERE FALSE;
+SELECT email_provider FROM metadata.notification_archive WHERE FALSE;
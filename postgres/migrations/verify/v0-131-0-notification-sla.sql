@@ -0,0 +1,19 @@
+-- Verify civic_os:v0-131-0-notification-sla on pg
+
+-- 1. Latency and SLA columns exist
+SELECT queue_latency FROM metadata.notification_log WHERE FALSE;
+SELECT latency_sla_seconds FROM metadata.notification_templates WHERE FALSE;
+
+-- 2. Stats table, view and rollup exist
+SELECT template_name, period_start, sent_count, p50_seconds, p95_seconds, max_seconds,
+       sla_seconds, over_sla_count, rolled_up_at
+FROM metadata.notification_latency_stats WHERE FALSE;
+SELECT template_name, period_start, p50_seconds, p95_seconds, p95_over_sla
+FROM public.notification_latency_stats WHERE FALSE;
+SELECT has_function_privilege('metadata.rollup_notification_latency(timestamptz, interval)', 'execute');
+
+-- 3. Alerts exist
+SELECT id, template_name, late_count, pending_count, worst_seconds, sla_seconds, alerted_at
+FROM metadata.notification_sla_alerts WHERE FALSE;
+SELECT 1/COUNT(*) FROM metadata.notification_templates WHERE name = 'notification_sla_breach';
+SELECT has_function_privilege('metadata.notify_notification_sla_breaches(text[], interval)', 'execute');
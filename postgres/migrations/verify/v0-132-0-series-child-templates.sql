@@ -0,0 +1,15 @@
+-- Verify civic_os:v0-132-0-series-child-templates on pg
+
+-- 1. Child templates table exists
+SELECT id, group_id, child_table, parent_column, child_template, copies, copies_property,
+       sort_order, created_by, created_at
+FROM metadata.series_child_templates WHERE FALSE;
+
+-- 2. Validation trigger exists
+SELECT 1/COUNT(*) FROM pg_trigger
+WHERE tgname = 'series_child_templates_validate'
+  AND tgrelid = 'metadata.series_child_templates'::regclass;
+
+-- 3. View and RPC exist
+SELECT id, group_id, child_table FROM public.series_child_templates WHERE FALSE;
+SELECT has_function_privilege('public.set_series_child_templates(bigint, jsonb)', 'execute');
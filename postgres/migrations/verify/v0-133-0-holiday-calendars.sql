@@ -0,0 +1,14 @@
+-- Verify civic_os:v0-133-0-holiday-calendars on pg
+
+-- 1. Calendars and their views exist
+SELECT id, name, description, created_at FROM metadata.holiday_calendars WHERE FALSE;
+SELECT id, calendar_id, holiday_date, name FROM metadata.holiday_calendar_dates WHERE FALSE;
+SELECT id, name FROM public.holiday_calendars WHERE FALSE;
+SELECT id, calendar_id, holiday_date FROM public.holiday_calendar_dates WHERE FALSE;
+
+-- 2. Series group and scheduled job columns exist
+SELECT holiday_calendar_id, holiday_policy FROM metadata.time_slot_series_groups WHERE FALSE;
+SELECT holiday_calendar_id FROM metadata.scheduled_jobs WHERE FALSE;
+
+-- 3. RPC exists
+SELECT has_function_privilege('public.set_series_holiday_calendar(bigint, integer, character varying)', 'execute');
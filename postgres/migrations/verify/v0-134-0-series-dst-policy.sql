@@ -0,0 +1,7 @@
+-- Verify civic_os:v0-134-0-series-dst-policy on pg
+
+-- 1. Policy column exists
+SELECT dst_policy FROM metadata.time_slot_series_groups WHERE FALSE;
+
+-- 2. RPC exists
+SELECT has_function_privilege('public.set_series_dst_policy(bigint, character varying)', 'execute');
@@ -0,0 +1,7 @@
+-- Verify civic_os:v0-135-0-thumbnail-unsupported on pg
+
+-- 1. Constraint allows 'unsupported'
+SELECT 1 / COUNT(*)
+FROM pg_constraint
+WHERE conname = 'files_thumbnail_status_check'
+  AND pg_get_constraintdef(oid) LIKE '%unsupported%';
@@ -0,0 +1,20 @@
+-- Verify civic_os:v0-136-0-notification-template-versions on pg
+
+-- 1. Versions
+SELECT id, template_id, version, subject_template, html_template, text_template, sms_template,
+       created_by, created_at
+FROM metadata.notification_template_versions WHERE FALSE;
+
+-- 2. Active version and its trigger
+SELECT active_version FROM metadata.notification_templates WHERE FALSE;
+SELECT 1/COUNT(*)::INT FROM pg_trigger
+WHERE tgname = 'notification_template_versions_trigger'
+  AND tgrelid = 'metadata.notification_templates'::regclass;
+
+-- 3. Version per send
+SELECT template_version FROM metadata.notification_log WHERE FALSE;
+
+-- 4-5. Activation and admin RPCs
+SELECT has_function_privilege('metadata.activate_notification_template_version(varchar, integer)', 'execute');
+SELECT has_function_privilege('public.get_notification_template_versions(varchar)', 'execute');
+SELECT has_function_privilege('public.request_template_version_activation(varchar, integer)', 'execute');
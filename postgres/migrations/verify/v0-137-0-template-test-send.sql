@@ -0,0 +1,4 @@
+-- Verify civic_os:v0-137-0-template-test-send on pg
+
+-- 1. Test send RPC
+SELECT has_function_privilege('public.send_test_notification(varchar, jsonb, name, text)', 'execute');
@@ -0,0 +1,16 @@
+-- Verify civic_os:v0-138-0-notification-categories on pg
+
+-- 1. Categories
+SELECT name, display_name, description, default_enabled, sort_order, created_at
+FROM metadata.notification_categories WHERE FALSE;
+SELECT category FROM metadata.notification_templates WHERE FALSE;
+
+-- 2. Category × channel preferences and their sync triggers
+SELECT user_id, category, channel, enabled, created_at, updated_at
+FROM metadata.notification_category_preferences WHERE FALSE;
+SELECT 1/(COUNT(*) = 2)::INT FROM pg_trigger
+WHERE tgname = 'sync_notification_category_preferences_trigger';
+
+-- 3. Public views
+SELECT name FROM public.notification_categories WHERE FALSE;
+SELECT user_id, category, channel, enabled FROM public.notification_category_preferences WHERE FALSE;
@@ -0,0 +1,12 @@
+-- Verify civic_os:v0-69-0-job-audit-context on pg
+
+-- 1. Audit context helper exists
+SELECT has_function_privilege('metadata.job_audit_context()', 'execute');
+
+-- 2. river_job trigger is installed
+SELECT 1/COUNT(*) FROM pg_trigger
+WHERE tgname = 'stamp_job_audit_context_trigger'
+  AND tgrelid = 'metadata.river_job'::regclass;
+
+-- 3. Column exists on run history
+SELECT audit_context FROM metadata.scheduled_job_runs WHERE FALSE;
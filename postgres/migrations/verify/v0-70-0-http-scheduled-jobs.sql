@@ -0,0 +1,12 @@
+-- Verify civic_os:v0-70-0-http-scheduled-jobs on pg
+
+-- 1. HTTP target columns on scheduled_jobs
+SELECT target_type, http_url, http_method, http_headers, http_body_template, http_timeout_seconds
+FROM metadata.scheduled_jobs WHERE FALSE;
+
+-- 2. Response status on run history
+SELECT http_status FROM metadata.scheduled_job_runs WHERE FALSE;
+
+-- 3. Status view exposes target columns
+SELECT target_type, http_url, http_method, last_run_http_status
+FROM public.scheduled_job_status WHERE FALSE;
@@ -0,0 +1,12 @@
+-- Verify civic_os:v0-71-0-payment-providers on pg
+
+-- 1. Provider-aware create_and_link_payment exists
+SELECT has_function_privilege(
+    'payments.create_and_link_payment(name, name, anyelement, name, numeric, text, uuid, text, text)',
+    'execute');
+
+-- 2. Constraint accepts the new providers
+SELECT 1/COUNT(*) FROM pg_constraint
+WHERE conname = 'valid_provider'
+  AND conrelid = 'payments.transactions'::regclass
+  AND pg_get_constraintdef(oid) LIKE '%paypal%';
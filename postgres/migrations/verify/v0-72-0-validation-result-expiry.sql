@@ -0,0 +1,7 @@
+-- Verify civic_os:v0-72-0-validation-result-expiry on pg
+
+-- 1. consumed_at column exists
+SELECT consumed_at FROM metadata.template_validation_results WHERE FALSE;
+
+-- 2. Purge function exists
+SELECT has_function_privilege('metadata.purge_validation_results(interval, interval)', 'execute');
@@ -0,0 +1,15 @@
+-- Verify civic_os:v0-73-0-ach-payments on pg
+
+-- 1. Payment method and mandate columns exist
+SELECT payment_method, mandate_id FROM payments.transactions WHERE FALSE;
+
+-- 2. Payment-method-aware create_and_link_payment exists
+SELECT has_function_privilege(
+    'payments.create_and_link_payment(name, name, anyelement, name, numeric, text, uuid, text, text, text)',
+    'execute');
+
+-- 3. Status constraint accepts 'processing'
+SELECT 1/COUNT(*) FROM pg_constraint
+WHERE conname = 'valid_status'
+  AND conrelid = 'payments.transactions'::regclass
+  AND pg_get_constraintdef(oid) LIKE '%processing%';
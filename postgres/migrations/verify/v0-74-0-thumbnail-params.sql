@@ -0,0 +1,7 @@
+-- Verify civic_os:v0-74-0-thumbnail-params on pg
+
+-- 1. Parameters column exists
+SELECT thumbnail_params FROM metadata.files WHERE FALSE;
+
+-- 2. Backfill RPC exists
+SELECT has_function_privilege('public.queue_thumbnail_backfill()', 'execute');
@@ -0,0 +1,15 @@
+-- Verify civic_os:v0-75-0-signature-requests on pg
+
+-- 1. File version column exists
+SELECT previous_version_id FROM metadata.files WHERE FALSE;
+
+-- 2. Signature requests table exists
+SELECT id, entity_type, entity_id, source_file_id, signed_file_id, signer_email,
+       signer_name, provider, envelope_id, status, status_column,
+       completed_status_key, declined_status_key, last_checked_at
+FROM metadata.signature_requests WHERE FALSE;
+
+-- 3. Functions exist
+SELECT has_function_privilege('public.request_signature(name, text, uuid, text, text, name, text, text, text)', 'execute');
+SELECT has_function_privilege('metadata.apply_signature_outcome(uuid, text, uuid, text)', 'execute');
+SELECT has_function_privilege('public.get_signature_requests(name, text)', 'execute');
@@ -0,0 +1,21 @@
+-- Verify civic_os:v0-76-0-manual-capture on pg
+
+-- 1. Capture columns exist (table and view)
+SELECT capture_method, authorized_at, capture_before, captured_at FROM payments.transactions WHERE FALSE;
+SELECT capture_method, authorized_at, capture_before, captured_at FROM public.payment_transactions WHERE FALSE;
+
+-- 2. Capture-method-aware create_and_link_payment exists
+SELECT has_function_privilege(
+    'payments.create_and_link_payment(name, name, anyelement, name, numeric, text, uuid, text, text, text, text)',
+    'execute');
+
+-- 3. Capture, void and expiry functions exist
+SELECT has_function_privilege('public.capture_payment(uuid)', 'execute');
+SELECT has_function_privilege('public.void_payment(uuid, text)', 'execute');
+SELECT has_function_privilege('payments.expire_uncaptured_authorizations()', 'execute');
+
+-- 4. Status constraint accepts 'requires_capture'
+SELECT 1/COUNT(*) FROM pg_constraint
+WHERE conname = 'valid_status'
+  AND conrelid = 'payments.transactions'::regclass
+  AND pg_get_constraintdef(oid) LIKE '%requires_capture%';
@@ -0,0 +1,12 @@
+-- Verify civic_os:v0-77-0-maintenance-tasks on pg
+
+-- 1. Maintenance tasks table exists
+SELECT name, enabled, interval_seconds, jitter_seconds, next_run_at,
+       last_started_at, last_finished_at, last_duration_ms, last_success,
+       last_message, run_count, failure_count, registered_at
+FROM metadata.maintenance_tasks WHERE FALSE;
+
+-- 2. Admin RPCs exist
+SELECT has_function_privilege('public.get_maintenance_tasks()', 'execute');
+SELECT has_function_privilege('public.update_maintenance_task(varchar, boolean, int, int)', 'execute');
+SELECT has_function_privilege('public.run_maintenance_task_now(varchar)', 'execute');
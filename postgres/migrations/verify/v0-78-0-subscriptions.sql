@@ -0,0 +1,17 @@
+-- Verify civic_os:v0-78-0-subscriptions on pg
+
+-- 1. Subscriptions table and view exist
+SELECT id, user_id, amount, billing_interval, interval_count, status, current_period_end,
+       cancel_at_period_end, provider_subscription_id, provider_customer_id
+FROM payments.subscriptions WHERE FALSE;
+SELECT id, status, current_period_end, entity_display_name FROM public.payment_subscriptions WHERE FALSE;
+
+-- 2. Transactions link to subscriptions (table and view)
+SELECT subscription_id, provider_invoice_id FROM payments.transactions WHERE FALSE;
+SELECT subscription_id FROM public.payment_transactions WHERE FALSE;
+
+-- 3. Helper and RPC exist
+SELECT has_function_privilege(
+    'payments.create_and_link_subscription(name, name, anyelement, name, name, numeric, text, text, int, uuid, text)',
+    'execute');
+SELECT has_function_privilege('public.cancel_subscription(uuid, boolean)', 'execute');
@@ -0,0 +1,19 @@
+-- Verify civic_os:v0-79-0-entity-soft-locks on pg
+
+-- 1. Lease and conflict tables exist
+SELECT entity_type, entity_id, user_id, acquired_at, expires_at
+FROM metadata.entity_soft_locks WHERE FALSE;
+
+SELECT id, entity_type, entity_id, operation, policy, held_by, job_id, created_at
+FROM metadata.entity_lock_conflicts WHERE FALSE;
+
+-- 2. Lock helpers exist
+SELECT has_function_privilege('metadata.entity_lock_key(name, text)', 'execute');
+SELECT has_function_privilege('metadata.entity_lock_holder(name, text, uuid)', 'execute');
+SELECT has_function_privilege('metadata.try_lock_entity(name, text, interval, uuid)', 'execute');
+SELECT has_function_privilege('metadata.record_entity_lock_conflict(name, text, text, text, bigint, uuid)', 'execute');
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.acquire_entity_lock(name, text, int)', 'execute');
+SELECT has_function_privilege('public.release_entity_lock(name, text)', 'execute');
+SELECT has_function_privilege('public.get_entity_lock_conflicts(name, text, int)', 'execute');
@@ -0,0 +1,14 @@
+-- Verify civic_os:v0-80-0-column-privacy on pg
+
+-- 1. Registry exists
+SELECT table_name, column_name, reason, created_by, created_at
+FROM metadata.column_privacy WHERE FALSE;
+
+-- 2. Helpers exist
+SELECT has_function_privilege('metadata.is_column_private(name, name)', 'execute');
+SELECT has_function_privilege('metadata.private_columns(name)', 'execute');
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.set_column_privacy(name, name, boolean, text)', 'execute');
+SELECT has_function_privilege('public.get_export_redactions(name[])', 'execute');
+SELECT has_function_privilege('public.log_data_export(name, int, text[], text[], text)', 'execute');
@@ -0,0 +1,21 @@
+-- Verify civic_os:v0-81-0-entity-webhooks on pg
+
+-- 1. Tables exist
+SELECT id, name, description, entity_type, events, enabled, url, http_method, headers,
+       payload_template, timeout_seconds, max_attempts, include_private_columns, created_at, updated_at
+FROM metadata.entity_webhook_subscriptions WHERE FALSE;
+
+SELECT id, subscription_id, entity_type, entity_id, event, entity_data, previous_data, status,
+       attempts, last_http_status, last_error, created_at, delivered_at
+FROM metadata.entity_webhook_deliveries WHERE FALSE;
+
+SELECT id, delivery_id, attempt, request_method, request_url, request_headers, request_body,
+       response_status, response_headers, response_body, response_truncated, error, duration_ms, created_at
+FROM metadata.entity_webhook_attempts WHERE FALSE;
+
+-- 2. Trigger function exists
+SELECT has_function_privilege('metadata.queue_entity_webhooks()', 'execute');
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.get_entity_webhook_deliveries(varchar, text, int)', 'execute');
+SELECT has_function_privilege('public.get_entity_webhook_transcript(bigint)', 'execute');
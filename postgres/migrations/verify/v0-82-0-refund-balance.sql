@@ -0,0 +1,13 @@
+-- Verify civic_os:v0-82-0-refund-balance on pg
+
+-- 1. Balance column exists
+SELECT refunded_amount_cents FROM payments.transactions WHERE FALSE;
+
+-- 2. Trigger function and trigger exist
+SELECT has_function_privilege('payments.sync_refunded_amount()', 'execute');
+
+SELECT 1/COUNT(*) FROM pg_trigger
+WHERE tgname = 'refund_balance' AND tgrelid = 'payments.refunds'::regclass;
+
+-- 3. RPC exists
+SELECT has_function_privilege('public.initiate_payment_refund(uuid, numeric, text)', 'execute');
@@ -0,0 +1,19 @@
+-- Verify civic_os:v0-83-0-payment-receipts on pg
+
+-- 1. Receipt columns, sequence and numbering trigger exist
+SELECT receipt_number, receipt_s3_key, receipt_generated_at FROM payments.transactions WHERE FALSE;
+
+SELECT 1/COUNT(*) FROM pg_class
+WHERE relname = 'receipt_number_seq' AND relkind = 'S';
+
+SELECT has_function_privilege('payments.assign_receipt_number()', 'execute');
+
+SELECT 1/COUNT(*) FROM pg_trigger
+WHERE tgname = 'assign_receipt_number' AND tgrelid = 'payments.transactions'::regclass;
+
+-- 2. Notification attachments column exists
+SELECT attachments FROM metadata.notifications WHERE FALSE;
+
+-- 3. Success trigger enqueues generate_receipt
+SELECT 1/COUNT(*) FROM pg_proc
+WHERE proname = 'notify_payment_succeeded' AND prosrc LIKE '%generate_receipt%';
@@ -0,0 +1,20 @@
+-- Verify civic_os:v0-84-0-notification-search on pg
+
+-- 1. Snapshot table and search view exist
+SELECT notification_id, recipient_email, subject, body_text, channels_sent, attempts
+FROM metadata.notification_log WHERE FALSE;
+
+SELECT id, recipient_name, subject, status FROM metadata.notification_search WHERE FALSE;
+
+-- 2. Permissions exist
+SELECT 1/COUNT(*) FROM metadata.permissions
+WHERE table_name = 'notification_log' AND permission = 'read';
+
+SELECT 1/COUNT(*) FROM metadata.permissions
+WHERE table_name = 'notification_content' AND permission = 'read';
+
+-- 3. RPCs exist
+SELECT has_function_privilege(
+    'public.search_notifications(text, varchar, varchar, varchar, text, varchar, timestamptz, timestamptz, int, int)',
+    'execute');
+SELECT has_function_privilege('public.get_notification_content(bigint)', 'execute');
@@ -0,0 +1,28 @@
+-- Verify civic_os:v0-85-0-entity-archival on pg
+
+-- 1. Archive schema and tables exist
+SELECT 1/COUNT(*) FROM pg_namespace WHERE nspname = 'archive';
+
+SELECT entity_type, age_column, archive_after, status_column, enabled, batch_size
+FROM metadata.archive_policies WHERE FALSE;
+
+SELECT entity_type, entity_id, display_name, search_vector, file_count, archived_at
+FROM metadata.archived_entities WHERE FALSE;
+
+SELECT id, entity_type, action, status, rows_moved, files_moved, requested_by
+FROM metadata.archive_runs WHERE FALSE;
+
+SELECT archive_status, hot_bucket FROM metadata.files WHERE FALSE;
+
+-- 2. Worker functions exist
+SELECT has_function_privilege('metadata.archive_entity_batch(name, bigint, int)', 'execute');
+SELECT has_function_privilege('metadata.unarchive_entity(name, text)', 'execute');
+SELECT has_function_privilege('metadata.enqueue_entity_archival()', 'execute');
+SELECT has_function_privilege('metadata.sync_archive_table(name)', 'execute');
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.set_archive_policy(name, interval, name, name, boolean, int)', 'execute');
+SELECT has_function_privilege('public.search_archived_entities(name, text, int, int)', 'execute');
+SELECT has_function_privilege('public.get_archived_entity(name, text)', 'execute');
+SELECT has_function_privilege('public.request_unarchive(name, text)', 'execute');
+SELECT has_function_privilege('public.get_archive_runs(name, int)', 'execute');
@@ -0,0 +1,15 @@
+-- Verify civic_os:v0-86-0-fee-schedules on pg
+
+-- 1. Fee schedules table and transaction columns exist
+SELECT id, category, enabled, percent, flat_cents, min_fee_cents, max_fee_cents,
+       ach_percent, ach_cap_cents, refundable, effective_from, effective_until
+FROM payments.fee_schedules WHERE FALSE;
+
+SELECT fee_category, fee_schedule_id FROM payments.transactions WHERE FALSE;
+
+-- 2. View and RPC exist
+SELECT id, category, is_current FROM public.payment_fee_schedules WHERE FALSE;
+
+SELECT has_function_privilege(
+    'public.set_fee_schedule(text, numeric, integer, boolean, integer, integer, numeric, integer, boolean, timestamptz, text)',
+    'execute');
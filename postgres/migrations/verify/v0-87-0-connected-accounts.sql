@@ -0,0 +1,21 @@
+-- Verify civic_os:v0-87-0-connected-accounts on pg
+
+-- 1. Tables and transaction columns exist
+SELECT id, name, provider_account_id, charges_enabled, payouts_enabled
+FROM payments.connected_accounts WHERE FALSE;
+
+SELECT id, category, connected_account_id FROM payments.payout_routes WHERE FALSE;
+
+SELECT id, connected_account_id, provider_account_id, provider_payout_id, amount_cents,
+       currency, status, arrival_date, failure_message
+FROM payments.payouts WHERE FALSE;
+
+SELECT connected_account_id, provider_transfer_id, transfer_reversed_cents
+FROM payments.transactions WHERE FALSE;
+
+-- 2. Views and RPCs exist
+SELECT id, name, categories FROM public.payment_connected_accounts WHERE FALSE;
+SELECT id, connected_account_name, status FROM public.payment_payouts WHERE FALSE;
+
+SELECT has_function_privilege('public.set_connected_account(text, text, text)', 'execute');
+SELECT has_function_privilege('public.set_payout_route(text, bigint)', 'execute');
@@ -0,0 +1,10 @@
+-- Verify civic_os:v0-88-0-job-trace-context on pg
+
+-- 1. Upload request column exists
+SELECT traceparent FROM metadata.file_upload_requests WHERE FALSE;
+
+-- 2. Trigger function and trigger exist
+SELECT 'metadata.stamp_job_traceparent()'::regprocedure;
+
+SELECT 1/COUNT(*) FROM pg_trigger
+WHERE tgname = 'stamp_job_traceparent' AND tgrelid = 'metadata.river_job'::regclass;
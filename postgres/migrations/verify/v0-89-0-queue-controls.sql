@@ -0,0 +1,18 @@
+-- Verify civic_os:v0-89-0-queue-controls on pg
+
+-- 1. Queue controls table exists
+SELECT queue_name, paused_by, pause_reason, resume_at, last_resumed_at,
+       breaker_enabled, breaker_error_rate, breaker_min_attempts,
+       breaker_window_seconds, breaker_cooldown_seconds,
+       last_error_rate, last_attempts, last_evaluated_at, last_tripped_at, trip_count
+FROM metadata.queue_controls WHERE FALSE;
+
+-- 2. Internal functions exist
+SELECT 'metadata.set_river_queue_paused(varchar, boolean)'::regprocedure;
+SELECT 'metadata.evaluate_queue_circuit_breakers()'::regprocedure;
+
+-- 3. Admin RPCs exist
+SELECT has_function_privilege('public.get_queue_controls()', 'execute');
+SELECT has_function_privilege('public.pause_queue(varchar, text, int)', 'execute');
+SELECT has_function_privilege('public.resume_queue(varchar)', 'execute');
+SELECT has_function_privilege('public.update_queue_circuit_breaker(varchar, boolean, numeric, int, int, int)', 'execute');
@@ -0,0 +1,12 @@
+-- Verify civic_os:v0-90-0-job-admin on pg
+
+-- 1. Job admin runs table exists
+SELECT id, action, job_kind, parameters, status, jobs_affected, jobs_remaining,
+       requested_by, river_job_id, error_message, started_at, finished_at
+FROM metadata.job_admin_runs WHERE FALSE;
+
+-- 2. Admin RPCs exist
+SELECT has_function_privilege('public.get_job_kind_summary(int)', 'execute');
+SELECT has_function_privilege('public.request_retry_discarded_jobs(text, timestamptz)', 'execute');
+SELECT has_function_privilege('public.request_cancel_stuck_jobs(int, text)', 'execute');
+SELECT has_function_privilege('public.get_job_admin_runs(int)', 'execute');
@@ -0,0 +1,19 @@
+-- Verify civic_os:v0-91-0-job-dead-letters on pg
+
+-- 1. Dead letters table exists
+SELECT id, river_job_id, kind, queue, args, errors, last_error, attempt, max_attempts,
+       job_created_at, last_attempted_at, discarded_at, captured_at, notified_at,
+       resolved_at, resolution, resolved_by
+FROM metadata.job_dead_letters WHERE FALSE;
+
+-- 2. Notification template exists
+SELECT 1/COUNT(*) FROM metadata.notification_templates WHERE name = 'job_dead_letter';
+
+-- 3. Internal functions exist
+SELECT 'metadata.notify_job_dead_letters(text[])'::regprocedure;
+SELECT 'metadata.capture_job_dead_letter(bigint, text[])'::regprocedure;
+SELECT 'metadata.capture_missed_dead_letters(text[], interval)'::regprocedure;
+
+-- 4. Admin RPCs exist
+SELECT has_function_privilege('public.get_job_dead_letters(boolean, int)', 'execute');
+SELECT has_function_privilege('public.dismiss_job_dead_letters(bigint[])', 'execute');
@@ -0,0 +1,19 @@
+-- Verify civic_os:v0-92-0-bulk-user-import on pg
+
+-- 1. Import tables exist
+SELECT id, file_id, file_name, status, default_roles, send_welcome_email, send_welcome_sms,
+       allowed_roles, total_rows, invalid_rows, skipped_rows, completed_rows, failed_rows,
+       error_message, requested_by, river_job_id, created_at, started_at, completed_at
+FROM metadata.user_import_batches WHERE FALSE;
+
+SELECT id, batch_id, row_number, email, first_name, last_name, phone, roles,
+       send_welcome_email, send_welcome_sms, status, error_message, provision_id, provision_job_id, updated_at
+FROM metadata.user_import_rows WHERE FALSE;
+
+-- 2. Notification template exists
+SELECT 1/COUNT(*) FROM metadata.notification_templates WHERE name = 'user_import_summary';
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.request_user_import(uuid, text[], boolean, boolean)', 'execute');
+SELECT has_function_privilege('public.get_user_import_batches(int)', 'execute');
+SELECT has_function_privilege('public.get_user_import_rows(bigint, boolean)', 'execute');
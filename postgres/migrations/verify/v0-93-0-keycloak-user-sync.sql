@@ -0,0 +1,19 @@
+-- Verify civic_os:v0-93-0-keycloak-user-sync on pg
+
+-- 1. Sync runs table exists
+SELECT id, river_job_id, status, next_offset, seen_user_ids, users_seen, users_created,
+       users_updated, users_skipped, roles_added, roles_removed, open_conflicts,
+       error_message, started_at, finished_at
+FROM metadata.keycloak_user_sync_runs WHERE FALSE;
+
+-- 2. Conflicts table exists
+SELECT id, user_id, conflict_type, subject, username, email, other_user_id, message,
+       first_seen_at, last_seen_at, resolved_at
+FROM metadata.keycloak_user_sync_conflicts WHERE FALSE;
+
+-- 3. Enqueue function exists
+SELECT 'metadata.enqueue_keycloak_user_sync()'::regprocedure;
+
+-- 4. Admin RPCs exist
+SELECT has_function_privilege('public.get_keycloak_user_sync_runs(int)', 'execute');
+SELECT has_function_privilege('public.get_keycloak_user_sync_conflicts(boolean)', 'execute');
@@ -0,0 +1,26 @@
+-- Verify civic_os:v0-94-0-user-deprovisioning on pg
+
+-- 1. Tables exist
+SELECT id, user_id, pii_policy, reassign_to, reason, status, keycloak_disabled, roles_revoked,
+       records_reassigned, records_flagged, error_message, requested_by, river_job_id,
+       created_at, completed_at
+FROM metadata.user_deprovisioning WHERE FALSE;
+
+SELECT id, deprovision_id, table_name, column_name, record_count, action
+FROM metadata.user_deprovisioning_records WHERE FALSE;
+
+SELECT table_name, column_name, created_at
+FROM metadata.user_reassignable_columns WHERE FALSE;
+
+SELECT user_id, deprovision_id, display_name, email, phone, first_name, last_name, locked_at
+FROM metadata.deprovisioned_user_pii WHERE FALSE;
+
+-- 2. Internal functions exist
+SELECT 'metadata.user_owned_record_columns()'::regprocedure;
+SELECT 'metadata.complete_user_deprovisioning(bigint, boolean, text[])'::regprocedure;
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.request_user_deprovisioning(uuid, text, uuid, text)', 'execute');
+SELECT has_function_privilege('public.get_user_deprovisioning(int)', 'execute');
+SELECT has_function_privilege('public.set_user_reassignable_column(name, name, boolean)', 'execute');
+SELECT has_function_privilege('public.get_deprovisioned_user_pii(uuid)', 'execute');
@@ -0,0 +1,19 @@
+-- Verify civic_os:v0-95-0-keycloak-groups on pg
+
+-- 1. Tables exist
+SELECT id, group_key, display_name, description, created_at
+FROM metadata.groups WHERE FALSE;
+
+SELECT user_id, group_id, synced_at
+FROM metadata.user_groups WHERE FALSE;
+
+-- 2. Trigger functions exist
+SELECT 'metadata.trg_groups_sync_keycloak()'::regprocedure;
+SELECT 'metadata.trg_user_groups_sync_keycloak()'::regprocedure;
+SELECT 'metadata.trg_user_deprovisioning_clear_groups()'::regprocedure;
+
+-- 3. RPCs exist
+SELECT has_function_privilege('public.create_group(text, text, text)', 'execute');
+SELECT has_function_privilege('public.delete_group(smallint)', 'execute');
+SELECT has_function_privilege('public.assign_user_group(uuid, text)', 'execute');
+SELECT has_function_privilege('public.revoke_user_group(uuid, text)', 'execute');
@@ -0,0 +1,8 @@
+-- Verify civic_os:v0-96-0-welcome-delivery-status on pg
+
+-- 1. Columns exist
+SELECT welcome_notification_id, welcome_status, welcome_error, welcome_sent_at
+FROM metadata.user_provisioning WHERE FALSE;
+
+-- 2. Trigger function exists
+SELECT 'metadata.trg_notifications_welcome_status()'::regprocedure;
@@ -0,0 +1,9 @@
+-- Verify civic_os:v0-97-0-identity-audit-log on pg
+
+-- 1. Table exists
+SELECT id, occurred_at, provider, operation, target_type, target_id, before_state, after_state,
+       job_id, job_kind, job_attempt, actor_id, on_behalf_of, impersonated_roles, request_id, db_user
+FROM metadata.identity_audit_log WHERE FALSE;
+
+-- 2. RPC exists
+SELECT has_function_privilege('public.get_identity_audit_log(text, uuid, integer, integer)', 'execute');
@@ -0,0 +1,13 @@
+-- Verify civic_os:v0-98-0-source-parser-coverage on pg
+
+-- 1. table_name column
+SELECT schema_name, object_name, object_type, table_name
+FROM metadata.parsed_source_code WHERE FALSE;
+
+-- 2. Views recreated
+SELECT schema_name, object_name, object_type, table_name, ast_json
+FROM public.parsed_source_code WHERE FALSE;
+SELECT function_name, ast_json FROM public.schema_functions WHERE FALSE;
+
+-- 3. RPC exists
+SELECT has_function_privilege('public.get_entity_source_code(name)', 'execute');
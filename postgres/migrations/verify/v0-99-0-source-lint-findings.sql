@@ -0,0 +1,8 @@
+-- Verify civic_os:v0-99-0-source-lint-findings on pg
+
+-- 1. Findings table
+SELECT id, schema_name, object_name, object_type, table_name, rule, severity, message, detail, found_at
+FROM metadata.source_lint_findings WHERE FALSE;
+
+-- 2. Admin view
+SELECT id, schema_name, object_name, rule, severity FROM public.source_lint_findings WHERE FALSE;
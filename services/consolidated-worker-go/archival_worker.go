@@ -0,0 +1,450 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Entity Archival
+//
+// Tables with a metadata.archive_policies row (see migration
+// v0-85-0-entity-archival) move old rows into archive.<table> mirror tables.
+// The SQL side moves rows, writes lookup stubs and marks the rows' files
+// pending_archive; this worker drives it in batches and moves the files'
+// objects to the archive bucket (ARCHIVE_S3_BUCKET, in
+// ARCHIVE_S3_STORAGE_CLASS), repointing metadata.files.s3_bucket so
+// presigned URLs keep working. unarchive_entity reverses both for one row.
+//
+// Objects are copied, the file row updated, then the source deleted, so a
+// crash leaves at worst an extra copy and never a file row pointing nowhere.
+// ============================================================================
+
+// ArchiveEntitiesArgs is inserted by metadata.enqueue_entity_archival(), one
+// job per enabled policy
+type ArchiveEntitiesArgs struct {
+	EntityType string `json:"entity_type"`
+}
+
+func (ArchiveEntitiesArgs) Kind() string { return "archive_entities" }
+
+func (ArchiveEntitiesArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "archival",
+		MaxAttempts: 3,
+		Priority:    4,
+	}
+}
+
+// UnarchiveEntityArgs is inserted by public.request_unarchive()
+type UnarchiveEntityArgs struct {
+	EntityType string           `json:"entity_type"`
+	EntityID   string           `json:"entity_id"`
+	Audit      *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger
+}
+
+func (UnarchiveEntityArgs) Kind() string { return "unarchive_entity" }
+
+func (UnarchiveEntityArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "archival",
+		MaxAttempts: 5,
+		Priority:    1,
+	}
+}
+
+const (
+	// Batches per archive_entities job; the rest waits for the next daily run
+	// so one large backlog can't hold the queue for hours
+	maxArchiveBatchesPerJob = 50
+
+	// File rows loaded per relocation query
+	archiveFilePageSize = 100
+)
+
+// archiveRunStats is what one archive or unarchive job did
+type archiveRunStats struct {
+	RowsMoved   int
+	RowsSkipped int
+	FilesMoved  int
+	FilesFailed int
+}
+
+// ============================================================================
+// Archive Worker
+// ============================================================================
+
+// ArchiveEntitiesWorker archives one table's eligible rows and their files
+type ArchiveEntitiesWorker struct {
+	river.WorkerDefaults[ArchiveEntitiesArgs]
+	dbPool *pgxpool.Pool
+	files  *ArchiveFileMover
+}
+
+func (w *ArchiveEntitiesWorker) Work(ctx context.Context, job *river.Job[ArchiveEntitiesArgs]) error {
+	entityType := job.Args.EntityType
+	log.Printf("[Job %d] Archiving %s (attempt %d/%d)", job.ID, entityType, job.Attempt, job.MaxAttempts)
+
+	runID, err := startArchiveRun(ctx, w.dbPool, "archive", entityType, "", "", job.ID)
+	if err != nil {
+		return err
+	}
+
+	var stats archiveRunStats
+	for batch := 0; batch < maxArchiveBatchesPerJob; batch++ {
+		var archived, skipped int
+		// Rows skipped (still referenced) stay at the front of the age
+		// ordering, so later batches start after them
+		err := w.dbPool.QueryRow(ctx,
+			`SELECT archived, skipped FROM metadata.archive_entity_batch($1, $2, $3)`,
+			entityType, runID, stats.RowsSkipped,
+		).Scan(&archived, &skipped)
+		if err != nil {
+			err = fmt.Errorf("archive_entity_batch(%s): %w", entityType, err)
+			finishArchiveRun(ctx, w.dbPool, runID, stats, err)
+			return err
+		}
+		stats.RowsMoved += archived
+		stats.RowsSkipped += skipped
+		if archived+skipped == 0 {
+			break
+		}
+	}
+
+	// Includes files left pending by earlier runs
+	stats.FilesMoved, stats.FilesFailed, err = w.files.MoveFiles(ctx, entityType, "", archiveStatusPendingArchive)
+	if err != nil {
+		finishArchiveRun(ctx, w.dbPool, runID, stats, err)
+		return err
+	}
+
+	finishArchiveRun(ctx, w.dbPool, runID, stats, nil)
+	log.Printf("[Job %d] ✓ Archived %d %s row(s), skipped %d still referenced; moved %d file(s), %d failed",
+		job.ID, stats.RowsMoved, entityType, stats.RowsSkipped, stats.FilesMoved, stats.FilesFailed)
+	return nil
+}
+
+// ============================================================================
+// Unarchive Worker
+// ============================================================================
+
+// UnarchiveEntityWorker restores one archived row and its files
+type UnarchiveEntityWorker struct {
+	river.WorkerDefaults[UnarchiveEntityArgs]
+	dbPool *pgxpool.Pool
+	files  *ArchiveFileMover
+}
+
+func (w *UnarchiveEntityWorker) Work(ctx context.Context, job *river.Job[UnarchiveEntityArgs]) error {
+	entityType, entityID := job.Args.EntityType, job.Args.EntityID
+	log.Printf("[Job %d] Unarchiving %s %s (attempt %d/%d)", job.ID, entityType, entityID, job.Attempt, job.MaxAttempts)
+
+	var requestedBy string
+	if job.Args.Audit.HasActor() {
+		requestedBy = job.Args.Audit.ActorID
+	}
+	runID, err := startArchiveRun(ctx, w.dbPool, "unarchive", entityType, entityID, requestedBy, job.ID)
+	if err != nil {
+		return err
+	}
+
+	var stats archiveRunStats
+	var restored bool
+	err = w.dbPool.QueryRow(ctx, `SELECT metadata.unarchive_entity($1, $2)`, entityType, entityID).Scan(&restored)
+	if err != nil {
+		err = fmt.Errorf("unarchive_entity(%s, %s): %w", entityType, entityID, err)
+		finishArchiveRun(ctx, w.dbPool, runID, stats, err)
+		return err
+	}
+	if restored {
+		stats.RowsMoved = 1
+		recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "entity_unarchived", map[string]interface{}{
+			"table_name": entityType,
+			"entity_id":  entityID,
+		})
+	} else {
+		// Already restored by an earlier attempt; its files may still be pending
+		log.Printf("[Job %d] %s %s is not archived, restoring any pending files", job.ID, entityType, entityID)
+	}
+
+	stats.FilesMoved, stats.FilesFailed, err = w.files.MoveFiles(ctx, entityType, entityID, archiveStatusPendingRestore)
+	if err == nil && stats.FilesFailed > 0 {
+		err = fmt.Errorf("%d file(s) could not be restored", stats.FilesFailed)
+	}
+	if err != nil {
+		finishArchiveRun(ctx, w.dbPool, runID, stats, err)
+		return err
+	}
+
+	finishArchiveRun(ctx, w.dbPool, runID, stats, nil)
+	log.Printf("[Job %d] ✓ Unarchived %s %s with %d file(s)", job.ID, entityType, entityID, stats.FilesMoved)
+	return nil
+}
+
+// startArchiveRun records the start of a job in metadata.archive_runs
+func startArchiveRun(ctx context.Context, dbPool *pgxpool.Pool, action, entityType, entityID, requestedBy string, jobID int64) (int64, error) {
+	var runID int64
+	err := dbPool.QueryRow(ctx, `
+		INSERT INTO metadata.archive_runs (entity_type, action, entity_id, requested_by, river_job_id)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, '')::UUID, $5)
+		RETURNING id
+	`, entityType, action, entityID, requestedBy, jobID).Scan(&runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record archive run: %w", err)
+	}
+	return runID, nil
+}
+
+// finishArchiveRun records the outcome. Failures are logged only: the run row
+// is bookkeeping and must not mask the job's own result.
+func finishArchiveRun(ctx context.Context, dbPool *pgxpool.Pool, runID int64, stats archiveRunStats, runErr error) {
+	status, errorMessage := "completed", ""
+	if runErr != nil {
+		status, errorMessage = "failed", runErr.Error()
+	}
+	_, err := dbPool.Exec(ctx, `
+		UPDATE metadata.archive_runs
+		SET status = $2, rows_moved = $3, rows_skipped = $4, files_moved = $5, files_failed = $6,
+		    error_message = NULLIF($7, ''), finished_at = NOW()
+		WHERE id = $1
+	`, runID, status, stats.RowsMoved, stats.RowsSkipped, stats.FilesMoved, stats.FilesFailed, errorMessage)
+	if err != nil {
+		log.Printf("[Archival] Failed to record outcome of run %d: %v", runID, err)
+	}
+}
+
+// ============================================================================
+// File Relocation
+// ============================================================================
+
+const (
+	archiveStatusPendingArchive = "pending_archive"
+	archiveStatusPendingRestore = "pending_restore"
+)
+
+// archiveObjectAPI is the subset of *s3.Client used to move objects
+type archiveObjectAPI interface {
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// ArchiveFileMover moves archived entities' files between the hot bucket and
+// the archive bucket
+type ArchiveFileMover struct {
+	dbPool       *pgxpool.Pool
+	s3Client     archiveObjectAPI
+	bucket       string             // ARCHIVE_S3_BUCKET; empty keeps objects in their bucket
+	storageClass types.StorageClass // ARCHIVE_S3_STORAGE_CLASS; empty keeps the bucket default
+}
+
+// archiveFile is a metadata.files row awaiting relocation
+type archiveFile struct {
+	ID        string
+	Bucket    string
+	HotBucket string
+	Keys      []string // original and thumbnails
+}
+
+// MoveFiles relocates the files of entityType (or one entity when entityID
+// is set) in the given pending status. Per-file failures are counted and
+// logged; those files stay pending for the next run.
+func (m *ArchiveFileMover) MoveFiles(ctx context.Context, entityType, entityID, status string) (moved, failed int, err error) {
+	var failedIDs []string
+	for {
+		files, err := m.loadPending(ctx, entityType, entityID, status, failedIDs)
+		if err != nil {
+			return moved, failed, err
+		}
+		if len(files) == 0 {
+			return moved, failed, nil
+		}
+		for _, f := range files {
+			if err := m.moveFile(ctx, f, status); err != nil {
+				log.Printf("[Archival] File %s (%s): %v", f.ID, status, err)
+				failedIDs = append(failedIDs, f.ID)
+				failed++
+				continue
+			}
+			moved++
+		}
+	}
+}
+
+func (m *ArchiveFileMover) loadPending(ctx context.Context, entityType, entityID, status string, exclude []string) ([]archiveFile, error) {
+	rows, err := m.dbPool.Query(ctx, `
+		SELECT id::text, s3_bucket, COALESCE(hot_bucket, ''),
+		       array_remove(ARRAY[s3_original_key, s3_thumbnail_small_key,
+		                          s3_thumbnail_medium_key, s3_thumbnail_large_key], NULL)
+		FROM metadata.files
+		WHERE entity_type = $1
+		  AND ($2 = '' OR entity_id = $2)
+		  AND archive_status = $3
+		  AND NOT (id::text = ANY($4))
+		ORDER BY id
+		LIMIT $5
+	`, entityType, entityID, status, nonNilStrings(exclude), archiveFilePageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []archiveFile
+	for rows.Next() {
+		var f archiveFile
+		if err := rows.Scan(&f.ID, &f.Bucket, &f.HotBucket, &f.Keys); err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// moveFile copies the objects, repoints the file row, then deletes the source
+func (m *ArchiveFileMover) moveFile(ctx context.Context, f archiveFile, status string) error {
+	var target string
+	var class types.StorageClass
+	if status == archiveStatusPendingArchive {
+		target, class = archiveTarget(f.Bucket, m.bucket), m.storageClass
+	} else {
+		target = restoreTarget(f.Bucket, f.HotBucket)
+		if target == f.Bucket && m.storageClass != "" {
+			class = types.StorageClassStandard // archived in place: only the class changes back
+		}
+	}
+
+	// Copying an object onto itself is only allowed when its class changes
+	inPlace := target == f.Bucket
+	if !inPlace || class != "" {
+		for _, key := range f.Keys {
+			if err := m.copyObject(ctx, f.Bucket, target, key, class); err != nil {
+				return err
+			}
+		}
+	}
+
+	var err error
+	if status == archiveStatusPendingArchive {
+		_, err = m.dbPool.Exec(ctx, `
+			UPDATE metadata.files
+			SET s3_bucket = $2, hot_bucket = $3, archive_status = 'archived', updated_at = NOW()
+			WHERE id = $1::UUID AND archive_status = 'pending_archive'
+		`, f.ID, target, f.Bucket)
+	} else {
+		_, err = m.dbPool.Exec(ctx, `
+			UPDATE metadata.files
+			SET s3_bucket = $2, hot_bucket = NULL, archive_status = NULL, updated_at = NOW()
+			WHERE id = $1::UUID AND archive_status = 'pending_restore'
+		`, f.ID, target)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update file: %w", err)
+	}
+
+	if !inPlace {
+		_, failed := deleteObjectsBatch(ctx, m.s3Client, f.Bucket, f.Keys)
+		for key, err := range failed {
+			// The file row already points at the copy; the leftover is only storage
+			log.Printf("[Archival] File %s: failed to delete s3://%s/%s after copy: %v", f.ID, f.Bucket, key, err)
+		}
+	}
+	return nil
+}
+
+func (m *ArchiveFileMover) copyObject(ctx context.Context, from, to, key string, class types.StorageClass) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(to),
+		Key:        aws.String(key),
+		CopySource: aws.String(copySource(from, key)),
+	}
+	if class != "" {
+		input.StorageClass = class
+	}
+	if _, err := m.s3Client.CopyObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to copy s3://%s/%s to %s: %w", from, key, to, err)
+	}
+	return nil
+}
+
+// archiveTarget is the bucket a file archives to: ARCHIVE_S3_BUCKET, or its
+// own bucket (storage class change only) when that is unset
+func archiveTarget(current, archiveBucket string) string {
+	if archiveBucket == "" {
+		return current
+	}
+	return archiveBucket
+}
+
+// restoreTarget is the bucket a file returns to. Files archived in place
+// have no hot_bucket.
+func restoreTarget(current, hotBucket string) string {
+	if hotBucket == "" {
+		return current
+	}
+	return hotBucket
+}
+
+// copySource builds CopyObjectInput.CopySource ("bucket/key", URL-encoded
+// per path segment so keys with spaces or unicode file names copy)
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// parseStorageClass validates ARCHIVE_S3_STORAGE_CLASS against the classes
+// the SDK knows. Empty means the archive bucket's default.
+func parseStorageClass(value string) (types.StorageClass, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return "", nil
+	}
+	for _, class := range types.StorageClass("").Values() {
+		if string(class) == value {
+			return class, nil
+		}
+	}
+	return "", fmt.Errorf("unknown S3 storage class %q", value)
+}
+
+// ============================================================================
+// Entity Archival Maintenance Task
+// ============================================================================
+
+// EntityArchivalTask enqueues the daily archive_entities jobs
+type EntityArchivalTask struct {
+	dbPool *pgxpool.Pool
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (e *EntityArchivalTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "entity_archival",
+		Description: "Enqueue an archive job for each enabled archive policy (metadata.archive_policies)",
+		Interval:    24 * time.Hour,
+		Jitter:      time.Hour,
+		Run:         e.runEnqueue,
+	}
+}
+
+// runEnqueue calls metadata.enqueue_entity_archival()
+func (e *EntityArchivalTask) runEnqueue(ctx context.Context) (string, error) {
+	var count int
+	if err := e.dbPool.QueryRow(ctx, "SELECT metadata.enqueue_entity_archival()").Scan(&count); err != nil {
+		return "", fmt.Errorf("enqueue_entity_archival(): %w", err)
+	}
+	return fmt.Sprintf("Enqueued %d archive job(s)", count), nil
+}
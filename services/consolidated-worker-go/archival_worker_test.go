@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestCopySource(t *testing.T) {
+	tests := []struct {
+		bucket, key, want string
+	}{
+		{"civic-os-files", "issues/42/0190/original.jpg", "civic-os-files/issues/42/0190/original.jpg"},
+		{"files", "issues/42/0190/site plan.pdf", "files/issues/42/0190/site%20plan.pdf"},
+		{"files", "issues/42/0190/café.png", "files/issues/42/0190/caf%C3%A9.png"},
+	}
+	for _, tt := range tests {
+		if got := copySource(tt.bucket, tt.key); got != tt.want {
+			t.Errorf("copySource(%q, %q) = %q, want %q", tt.bucket, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestArchiveTargets(t *testing.T) {
+	if got := archiveTarget("hot", "cold"); got != "cold" {
+		t.Errorf("archiveTarget with archive bucket = %q, want cold", got)
+	}
+	if got := archiveTarget("hot", ""); got != "hot" {
+		t.Errorf("archiveTarget without archive bucket = %q, want hot", got)
+	}
+	if got := restoreTarget("cold", "hot"); got != "hot" {
+		t.Errorf("restoreTarget = %q, want hot", got)
+	}
+	if got := restoreTarget("hot", ""); got != "hot" {
+		t.Errorf("restoreTarget of a file archived in place = %q, want hot", got)
+	}
+}
+
+func TestParseStorageClass(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    types.StorageClass
+		wantErr bool
+	}{
+		{"", "", false},
+		{"GLACIER_IR", types.StorageClassGlacierIr, false},
+		{" standard_ia ", types.StorageClassStandardIa, false},
+		{"COLD", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseStorageClass(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStorageClass(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseStorageClass(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// fakeCopyAPI records copies and fails the ones listed in fail
+type fakeCopyAPI struct {
+	copies []*s3.CopyObjectInput
+	fail   map[string]bool
+}
+
+func (f *fakeCopyAPI) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if f.fail[aws.ToString(params.Key)] {
+		return nil, errors.New("AccessDenied")
+	}
+	f.copies = append(f.copies, params)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeCopyAPI) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestArchiveCopyObject(t *testing.T) {
+	api := &fakeCopyAPI{fail: map[string]bool{"issues/1/x/bad.jpg": true}}
+	mover := &ArchiveFileMover{s3Client: api, bucket: "cold", storageClass: types.StorageClassGlacierIr}
+
+	if err := mover.copyObject(context.Background(), "hot", "cold", "issues/1/x/original.jpg", mover.storageClass); err != nil {
+		t.Fatalf("copyObject() error = %v", err)
+	}
+	if len(api.copies) != 1 {
+		t.Fatalf("copies = %d, want 1", len(api.copies))
+	}
+	c := api.copies[0]
+	if aws.ToString(c.Bucket) != "cold" || aws.ToString(c.CopySource) != "hot/issues/1/x/original.jpg" {
+		t.Errorf("copy = %s from %s", aws.ToString(c.Bucket), aws.ToString(c.CopySource))
+	}
+	if c.StorageClass != types.StorageClassGlacierIr {
+		t.Errorf("StorageClass = %q, want GLACIER_IR", c.StorageClass)
+	}
+
+	// No class: the destination bucket's default applies
+	if err := mover.copyObject(context.Background(), "cold", "hot", "issues/1/x/original.jpg", ""); err != nil {
+		t.Fatalf("copyObject() error = %v", err)
+	}
+	if got := api.copies[1].StorageClass; got != "" {
+		t.Errorf("restore StorageClass = %q, want empty", got)
+	}
+
+	if err := mover.copyObject(context.Background(), "hot", "cold", "issues/1/x/bad.jpg", ""); err == nil {
+		t.Error("copyObject() of a failing key returned nil error")
+	}
+}
+
+func TestEntityArchivalTaskDeclaration(t *testing.T) {
+	task := (&EntityArchivalTask{}).MaintenanceTask()
+	if task.Name != "entity_archival" || task.Run == nil || task.Interval <= 0 {
+		t.Errorf("MaintenanceTask() = %+v", task)
+	}
+}
@@ -0,0 +1,564 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// authentik Identity Provider
+// ============================================================================
+//
+// Implements IdentityProvider against the authentik API v3 with an API token
+// (Authorization: Bearer). authentik has no realm roles, so Civic OS roles and
+// groups are both authentik groups, matched by name. The OIDC provider must
+// use "Based on the User's UUID" as its subject mode so the JWT sub matches
+// the ID returned here, and a scope mapping must put the user's group names
+// where Civic OS reads roles from (see the integrator guide).
+//
+// Unlike the Keycloak client, calls are not retried here; River retries the job.
+
+// AuthentikConfig holds the authentik API settings
+type AuthentikConfig struct {
+	URL      string // e.g. https://auth.example.com
+	APIToken string // token of a service account that can manage users and groups
+}
+
+// AuthentikClient wraps the authentik API v3
+type AuthentikClient struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu     sync.RWMutex
+	token  string
+	groups map[string]string // group name -> group pk cache
+}
+
+// authentikError is returned for non-2xx responses
+type authentikError struct {
+	Method string
+	Path   string
+	Status int
+	Body   string
+}
+
+func (e *authentikError) Error() string {
+	return fmt.Sprintf("authentik %s %s returned %d: %s", e.Method, e.Path, e.Status, e.Body)
+}
+
+func isAuthentikStatus(err error, status int) bool {
+	var ae *authentikError
+	return errors.As(err, &ae) && ae.Status == status
+}
+
+type authentikUser struct {
+	PK         int                    `json:"pk"`
+	UUID       string                 `json:"uuid"`
+	Username   string                 `json:"username"`
+	Name       string                 `json:"name"`
+	Email      string                 `json:"email"`
+	IsActive   bool                   `json:"is_active"`
+	Type       string                 `json:"type"`
+	Attributes map[string]interface{} `json:"attributes"`
+	GroupsObj  []authentikGroup       `json:"groups_obj"`
+}
+
+type authentikGroup struct {
+	PK   string `json:"pk"`
+	Name string `json:"name"`
+}
+
+type authentikUserList struct {
+	Results []authentikUser `json:"results"`
+}
+
+type authentikGroupList struct {
+	Results []authentikGroup `json:"results"`
+}
+
+type authentikSessionList struct {
+	Results []struct {
+		UUID string `json:"uuid"`
+	} `json:"results"`
+}
+
+// NewAuthentikClient creates a new authentik API client
+func NewAuthentikClient(cfg AuthentikConfig) (*AuthentikClient, error) {
+	if cfg.URL == "" || cfg.APIToken == "" {
+		return nil, fmt.Errorf("IDENTITY_PROVIDER=authentik requires AUTHENTIK_URL and AUTHENTIK_API_TOKEN")
+	}
+	return &AuthentikClient{
+		baseURL:    strings.TrimRight(cfg.URL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: newTracingTransport(nil, "authentik")},
+		token:      cfg.APIToken,
+		groups:     make(map[string]string),
+	}, nil
+}
+
+// Name identifies the provider
+func (ac *AuthentikClient) Name() string { return "authentik" }
+
+// SetAPIToken swaps in a rotated API token (see secrets.go)
+func (ac *AuthentikClient) SetAPIToken(token string) {
+	ac.mu.Lock()
+	ac.token = token
+	ac.mu.Unlock()
+}
+
+// request sends a JSON request to /api/v3 and decodes a 2xx response into
+// out (when not nil). Other statuses return an *authentikError.
+func (ac *AuthentikClient) request(ctx context.Context, method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, ac.baseURL+"/api/v3"+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	ac.mu.RLock()
+	req.Header.Set("Authorization", "Bearer "+ac.token)
+	ac.mu.RUnlock()
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := ac.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("authentik %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &authentikError{Method: method, Path: path, Status: resp.StatusCode, Body: string(respBody)}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode authentik %s response: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Ping checks the API token by fetching its own user
+func (ac *AuthentikClient) Ping(ctx context.Context) error {
+	return ac.request(ctx, "GET", "/core/users/me/", nil, nil)
+}
+
+// ----------------------------------------------------------------------------
+// Users
+// ----------------------------------------------------------------------------
+
+// findUser returns the first user matching the filter, or nil
+func (ac *AuthentikClient) findUser(ctx context.Context, filter url.Values) (*authentikUser, error) {
+	filter.Set("include_groups", "true")
+	var list authentikUserList
+	if err := ac.request(ctx, "GET", "/core/users/?"+filter.Encode(), nil, &list); err != nil {
+		return nil, err
+	}
+	if len(list.Results) == 0 {
+		return nil, nil
+	}
+	return &list.Results[0], nil
+}
+
+// userByID looks a user up by UUID, the ID Civic OS knows them by
+func (ac *AuthentikClient) userByID(ctx context.Context, userID string) (*authentikUser, error) {
+	u, err := ac.findUser(ctx, url.Values{"uuid": {userID}})
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("user %s %w", userID, errIdentityUserNotFound)
+	}
+	return u, nil
+}
+
+// toIdentityUser maps an authentik user onto IdentityUser. authentik keeps a
+// single name, split here at the first space.
+func (u *authentikUser) toIdentityUser() IdentityUser {
+	first, last, _ := strings.Cut(strings.TrimSpace(u.Name), " ")
+	user := IdentityUser{
+		ID:        u.UUID,
+		Username:  u.Username,
+		Email:     u.Email,
+		FirstName: first,
+		LastName:  strings.TrimSpace(last),
+		Enabled:   u.IsActive,
+	}
+	if strings.Contains(u.Type, "service_account") {
+		user.ServiceAccountClientID = u.Type
+	}
+	for key, value := range u.Attributes {
+		if s, ok := value.(string); ok {
+			if user.Attributes == nil {
+				user.Attributes = make(map[string][]string)
+			}
+			user.Attributes[key] = []string{s}
+		}
+	}
+	return user
+}
+
+// GetUserByEmail finds a user by email (for idempotency checks)
+func (ac *AuthentikClient) GetUserByEmail(ctx context.Context, email string) (*IdentityUser, error) {
+	u, err := ac.findUser(ctx, url.Values{"email": {email}})
+	if err != nil || u == nil {
+		return nil, err
+	}
+	user := u.toIdentityUser()
+	return &user, nil
+}
+
+// GetUserByID fetches a user by UUID
+func (ac *AuthentikClient) GetUserByID(ctx context.Context, userID string) (*IdentityUser, error) {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user := u.toIdentityUser()
+	return &user, nil
+}
+
+// ListUsers returns one page of users ordered by pk. authentik paginates by
+// page number, so first must be a multiple of max.
+func (ac *AuthentikClient) ListUsers(ctx context.Context, first, max int) ([]IdentityUser, error) {
+	if max <= 0 || first%max != 0 {
+		return nil, fmt.Errorf("authentik pages users by number: offset %d is not a multiple of %d", first, max)
+	}
+	query := url.Values{}
+	query.Set("ordering", "pk")
+	query.Set("page", fmt.Sprint(first/max+1))
+	query.Set("page_size", fmt.Sprint(max))
+	query.Set("include_groups", "false")
+
+	var list authentikUserList
+	err := ac.request(ctx, "GET", "/core/users/?"+query.Encode(), nil, &list)
+	if isAuthentikStatus(err, http.StatusNotFound) {
+		return nil, nil // Past the last page
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]IdentityUser, 0, len(list.Results))
+	for i := range list.Results {
+		users = append(users, list.Results[i].toIdentityUser())
+	}
+	return users, nil
+}
+
+// CreateUser creates an active user with the email as username
+func (ac *AuthentikClient) CreateUser(ctx context.Context, email, firstName, lastName, phone string) (string, error) {
+	attributes := map[string]interface{}{}
+	if phone != "" {
+		attributes["phoneNumber"] = phone
+	}
+	payload := map[string]interface{}{
+		"username":   email,
+		"name":       strings.TrimSpace(firstName + " " + lastName),
+		"email":      email,
+		"is_active":  true,
+		"path":       "users",
+		"attributes": attributes,
+	}
+
+	var created authentikUser
+	err := ac.request(ctx, "POST", "/core/users/", payload, &created)
+	if isAuthentikStatus(err, http.StatusBadRequest) && strings.Contains(err.Error(), "already exists") {
+		return "", fmt.Errorf("user with email %s already exists in authentik", email)
+	}
+	if err != nil {
+		return "", fmt.Errorf("create user failed: %w", err)
+	}
+	if created.UUID == "" {
+		return "", fmt.Errorf("create user returned no uuid")
+	}
+	return created.UUID, nil
+}
+
+// patchUser sends a partial update for a user
+func (ac *AuthentikClient) patchUser(ctx context.Context, pk int, payload map[string]interface{}) error {
+	return ac.request(ctx, "PATCH", fmt.Sprintf("/core/users/%d/", pk), payload, nil)
+}
+
+// UpdateUser updates a user's email, name and phone attribute. PATCH only
+// replaces the fields sent, but attributes is replaced whole, so the current
+// attributes are merged first.
+func (ac *AuthentikClient) UpdateUser(ctx context.Context, userID, email, firstName, lastName, phone string) error {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("fetch current user failed: %w", err)
+	}
+
+	attributes := u.Attributes
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	if phone != "" {
+		attributes["phoneNumber"] = phone
+	} else {
+		delete(attributes, "phoneNumber")
+	}
+
+	if err := ac.patchUser(ctx, u.PK, map[string]interface{}{
+		"email":      email,
+		"name":       strings.TrimSpace(firstName + " " + lastName),
+		"attributes": attributes,
+	}); err != nil {
+		return fmt.Errorf("update user failed: %w", err)
+	}
+	return nil
+}
+
+// DisableUser deactivates a user
+func (ac *AuthentikClient) DisableUser(ctx context.Context, userID string) error {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("fetch current user for disable failed: %w", err)
+	}
+	if err := ac.patchUser(ctx, u.PK, map[string]interface{}{"is_active": false}); err != nil {
+		return fmt.Errorf("disable user failed: %w", err)
+	}
+	return nil
+}
+
+// AnonymizeUser deactivates a user and clears their profile. authentik
+// usernames are emails here, so the username is replaced too.
+func (ac *AuthentikClient) AnonymizeUser(ctx context.Context, userID string) error {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("fetch current user for anonymize failed: %w", err)
+	}
+	if err := ac.patchUser(ctx, u.PK, map[string]interface{}{
+		"username":   "former-user-" + u.UUID,
+		"name":       "Former User",
+		"email":      "",
+		"is_active":  false,
+		"attributes": map[string]interface{}{},
+	}); err != nil {
+		return fmt.Errorf("anonymize user failed: %w", err)
+	}
+	return nil
+}
+
+// LogoutUser deletes all of a user's authenticated sessions
+func (ac *AuthentikClient) LogoutUser(ctx context.Context, userID string) error {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	const pageSize = 100
+	query := url.Values{}
+	query.Set("user__username", u.Username)
+	query.Set("page_size", fmt.Sprint(pageSize))
+	for {
+		var sessions authentikSessionList
+		if err := ac.request(ctx, "GET", "/core/authenticated_sessions/?"+query.Encode(), nil, &sessions); err != nil {
+			return fmt.Errorf("list sessions failed: %w", err)
+		}
+		for _, s := range sessions.Results {
+			err := ac.request(ctx, "DELETE", "/core/authenticated_sessions/"+url.PathEscape(s.UUID)+"/", nil, nil)
+			if err != nil && !isAuthentikStatus(err, http.StatusNotFound) {
+				return fmt.Errorf("delete session failed: %w", err)
+			}
+		}
+		// Deleted sessions drop out of the list, so re-read the first page
+		if len(sessions.Results) < pageSize {
+			return nil
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Roles and groups (both authentik groups)
+// ----------------------------------------------------------------------------
+
+// groupPK returns the pk of the group with the given name
+func (ac *AuthentikClient) groupPK(ctx context.Context, name string) (string, error) {
+	ac.mu.RLock()
+	pk, ok := ac.groups[name]
+	ac.mu.RUnlock()
+	if ok {
+		return pk, nil
+	}
+
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("include_users", "false")
+	var list authentikGroupList
+	if err := ac.request(ctx, "GET", "/core/groups/?"+query.Encode(), nil, &list); err != nil {
+		return "", fmt.Errorf("fetch groups failed: %w", err)
+	}
+	for _, g := range list.Results {
+		if g.Name == name {
+			ac.mu.Lock()
+			ac.groups[name] = g.PK
+			ac.mu.Unlock()
+			return g.PK, nil
+		}
+	}
+	return "", fmt.Errorf("'%s': %w", name, errIdentityGroupNotFound)
+}
+
+// CreateGroup creates a group, keeping the description in its attributes
+func (ac *AuthentikClient) CreateGroup(ctx context.Context, name, description string) error {
+	_, err := ac.groupPK(ctx, name)
+	if err == nil {
+		log.Printf("[authentik] Group '%s' already exists (idempotent)", name)
+		return nil
+	}
+	if !errors.Is(err, errIdentityGroupNotFound) {
+		return err
+	}
+
+	payload := map[string]interface{}{"name": name}
+	if description != "" {
+		payload["attributes"] = map[string]interface{}{"description": description}
+	}
+	var created authentikGroup
+	if err := ac.request(ctx, "POST", "/core/groups/", payload, &created); err != nil {
+		return fmt.Errorf("create group failed: %w", err)
+	}
+
+	ac.mu.Lock()
+	ac.groups[name] = created.PK
+	ac.mu.Unlock()
+	return nil
+}
+
+// DeleteGroup deletes a group
+func (ac *AuthentikClient) DeleteGroup(ctx context.Context, name string) error {
+	pk, err := ac.groupPK(ctx, name)
+	if errors.Is(err, errIdentityGroupNotFound) {
+		log.Printf("[authentik] Group '%s' not found (already deleted)", name)
+		return nil // Idempotent
+	}
+	if err != nil {
+		return err
+	}
+
+	err = ac.request(ctx, "DELETE", "/core/groups/"+url.PathEscape(pk)+"/", nil, nil)
+
+	ac.mu.Lock()
+	delete(ac.groups, name)
+	ac.mu.Unlock()
+
+	if err != nil && !isAuthentikStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("delete group failed: %w", err)
+	}
+	return nil
+}
+
+// setMembership adds (add_user) or removes (remove_user) a user
+func (ac *AuthentikClient) setMembership(ctx context.Context, action string, userPK int, groupName string) error {
+	pk, err := ac.groupPK(ctx, groupName)
+	if err != nil {
+		return fmt.Errorf("group lookup failed: %w", err)
+	}
+	err = ac.request(ctx, "POST", "/core/groups/"+url.PathEscape(pk)+"/"+action+"/", map[string]int{"pk": userPK}, nil)
+	if isAuthentikStatus(err, http.StatusNotFound) {
+		// The cached group may have been deleted and recreated in authentik
+		ac.mu.Lock()
+		delete(ac.groups, groupName)
+		ac.mu.Unlock()
+	}
+	if err != nil {
+		return fmt.Errorf("group %s failed for '%s': %w", action, groupName, err)
+	}
+	return nil
+}
+
+// AddUserToGroup makes a user a member of a group
+func (ac *AuthentikClient) AddUserToGroup(ctx context.Context, userID, groupName string) error {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return ac.setMembership(ctx, "add_user", u.PK, groupName)
+}
+
+// RemoveUserFromGroup ends a user's membership of a group
+func (ac *AuthentikClient) RemoveUserFromGroup(ctx context.Context, userID, groupName string) error {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return ac.setMembership(ctx, "remove_user", u.PK, groupName)
+}
+
+// GetUserRoles returns the names of the user's groups
+func (ac *AuthentikClient) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(u.GroupsObj))
+	for _, g := range u.GroupsObj {
+		names = append(names, g.Name)
+	}
+	return names, nil
+}
+
+// GetUserDirectRoles is GetUserRoles: every authentik membership is direct
+func (ac *AuthentikClient) GetUserDirectRoles(ctx context.Context, userID string) ([]string, error) {
+	return ac.GetUserRoles(ctx, userID)
+}
+
+// AssignRoles adds the user to the role groups
+func (ac *AuthentikClient) AssignRoles(ctx context.Context, userID string, roleNames []string) error {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, name := range roleNames {
+		if err := ac.setMembership(ctx, "add_user", u.PK, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveRoles removes the user from the role groups
+func (ac *AuthentikClient) RemoveRoles(ctx context.Context, userID string, roleNames []string) error {
+	u, err := ac.userByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, name := range roleNames {
+		if err := ac.setMembership(ctx, "remove_user", u.PK, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateRole creates the group that stands for a role
+func (ac *AuthentikClient) CreateRole(ctx context.Context, name, description string) error {
+	return ac.CreateGroup(ctx, name, description)
+}
+
+// DeleteRole deletes the group that stands for a role
+func (ac *AuthentikClient) DeleteRole(ctx context.Context, name string) error {
+	return ac.DeleteGroup(ctx, name)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestAuthentik serves the authentik API from handler and records each
+// request as "METHOD path?query body"
+func newTestAuthentik(t *testing.T, handler http.HandlerFunc) (*AuthentikClient, *[]string) {
+	t.Helper()
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	ac, err := NewAuthentikClient(AuthentikConfig{URL: server.URL + "/", APIToken: "test-token"})
+	if err != nil {
+		t.Fatalf("NewAuthentikClient: %v", err)
+	}
+	return ac, &calls
+}
+
+const authentikJane = `{"pk":7,"uuid":"6f1c2b1e-0000-4000-8000-000000000007","username":"jane@example.com",
+	"name":"Jane van Doe","email":"jane@example.com","is_active":true,"type":"internal",
+	"attributes":{"phoneNumber":"5551234567","settings":{}},"groups_obj":[{"pk":"g-editor","name":"editor"}]}`
+
+func TestAuthentikClient_ProvisionFlow(t *testing.T) {
+	ac, calls := newTestAuthentik(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v3/core/users/" && r.URL.Query().Get("email") != "":
+			w.Write([]byte(`{"results":[]}`))
+		case r.Method == "POST" && r.URL.Path == "/api/v3/core/users/":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"pk":7,"uuid":"6f1c2b1e-0000-4000-8000-000000000007"}`))
+		case r.Method == "GET" && r.URL.Path == "/api/v3/core/users/":
+			fmt.Fprintf(w, `{"results":[%s]}`, authentikJane)
+		case r.Method == "GET" && r.URL.Path == "/api/v3/core/groups/":
+			fmt.Fprintf(w, `{"results":[{"pk":"g-%s","name":"%s"}]}`, r.URL.Query().Get("name"), r.URL.Query().Get("name"))
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/add_user/"):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.RequestURI())
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	ctx := context.Background()
+
+	existing, err := ac.GetUserByEmail(ctx, "jane@example.com")
+	if err != nil || existing != nil {
+		t.Fatalf("GetUserByEmail = %v, %v; want nil, nil", existing, err)
+	}
+	id, err := ac.CreateUser(ctx, "jane@example.com", "Jane", "van Doe", "5551234567")
+	if err != nil || id != "6f1c2b1e-0000-4000-8000-000000000007" {
+		t.Fatalf("CreateUser = %q, %v", id, err)
+	}
+	if err := ac.AssignRoles(ctx, id, []string{"user", "editor"}); err != nil {
+		t.Fatalf("AssignRoles: %v", err)
+	}
+
+	want := []string{
+		"GET /api/v3/core/users/?email=jane%40example.com&include_groups=true",
+		`POST /api/v3/core/users/ {"attributes":{"phoneNumber":"5551234567"},"email":"jane@example.com","is_active":true,"name":"Jane van Doe","path":"users","username":"jane@example.com"}`,
+		"GET /api/v3/core/users/?include_groups=true&uuid=6f1c2b1e-0000-4000-8000-000000000007",
+		"GET /api/v3/core/groups/?include_users=false&name=user",
+		`POST /api/v3/core/groups/g-user/add_user/ {"pk":7}`,
+		"GET /api/v3/core/groups/?include_users=false&name=editor",
+		`POST /api/v3/core/groups/g-editor/add_user/ {"pk":7}`,
+	}
+	if strings.Join(*calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(*calls, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAuthentikClient_UserMapping(t *testing.T) {
+	ac, _ := newTestAuthentik(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("uuid") == "missing" {
+			w.Write([]byte(`{"results":[]}`))
+			return
+		}
+		fmt.Fprintf(w, `{"results":[%s]}`, authentikJane)
+	})
+	ctx := context.Background()
+
+	user, err := ac.GetUserByID(ctx, "6f1c2b1e-0000-4000-8000-000000000007")
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.FirstName != "Jane" || user.LastName != "van Doe" || !user.Enabled ||
+		user.Attributes["phoneNumber"][0] != "5551234567" || user.ServiceAccountClientID != "" {
+		t.Errorf("user = %+v", user)
+	}
+
+	roles, err := ac.GetUserRoles(ctx, user.ID)
+	if err != nil || fmt.Sprint(roles) != "[editor]" {
+		t.Errorf("GetUserRoles = %v, %v", roles, err)
+	}
+
+	if _, err := ac.GetUserByID(ctx, "missing"); !errors.Is(err, errIdentityUserNotFound) {
+		t.Errorf("GetUserByID(missing) error = %v, want errIdentityUserNotFound", err)
+	}
+}
+
+func TestAuthentikClient_ListUsersPages(t *testing.T) {
+	ac, calls := newTestAuthentik(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "3" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"detail":"Invalid page."}`))
+			return
+		}
+		w.Write([]byte(`{"results":[{"pk":1,"uuid":"u1","username":"akadmin","type":"internal_service_account"}]}`))
+	})
+	ctx := context.Background()
+
+	users, err := ac.ListUsers(ctx, 100, 100)
+	if err != nil || len(users) != 1 || users[0].ServiceAccountClientID != "internal_service_account" {
+		t.Errorf("ListUsers(100, 100) = %+v, %v", users, err)
+	}
+	if want := "GET /api/v3/core/users/?include_groups=false&ordering=pk&page=2&page_size=100"; (*calls)[0] != want {
+		t.Errorf("list call = %s, want %s", (*calls)[0], want)
+	}
+
+	if users, err := ac.ListUsers(ctx, 200, 100); err != nil || len(users) != 0 {
+		t.Errorf("ListUsers past the last page = %v, %v; want an empty page", users, err)
+	}
+	if _, err := ac.ListUsers(ctx, 50, 100); err == nil {
+		t.Error("ListUsers with an offset that is not a page boundary should fail")
+	}
+}
+
+func TestAuthentikClient_AnonymizeAndLogout(t *testing.T) {
+	var patch map[string]interface{}
+	sessionsListed := 0
+	ac, calls := newTestAuthentik(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v3/core/users/":
+			fmt.Fprintf(w, `{"results":[%s]}`, authentikJane)
+		case r.Method == "PATCH":
+			json.NewDecoder(r.Body).Decode(&patch)
+			w.Write([]byte(`{}`))
+		case r.Method == "GET" && r.URL.Path == "/api/v3/core/authenticated_sessions/":
+			sessionsListed++
+			w.Write([]byte(`{"results":[{"uuid":"s1"},{"uuid":"s2"}]}`))
+		case r.Method == "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.RequestURI())
+		}
+	})
+	ctx := context.Background()
+	id := "6f1c2b1e-0000-4000-8000-000000000007"
+
+	if err := ac.AnonymizeUser(ctx, id); err != nil {
+		t.Fatalf("AnonymizeUser: %v", err)
+	}
+	if patch["username"] != "former-user-"+id || patch["email"] != "" || patch["is_active"] != false ||
+		len(patch["attributes"].(map[string]interface{})) != 0 {
+		t.Errorf("anonymize patch = %v", patch)
+	}
+
+	if err := ac.LogoutUser(ctx, id); err != nil {
+		t.Fatalf("LogoutUser: %v", err)
+	}
+	if sessionsListed != 1 {
+		t.Errorf("sessions listed %d times, want 1 (a short page is the last)", sessionsListed)
+	}
+	last := (*calls)[len(*calls)-2:]
+	if last[0] != "DELETE /api/v3/core/authenticated_sessions/s1/" || last[1] != "DELETE /api/v3/core/authenticated_sessions/s2/" {
+		t.Errorf("session deletes = %v", last)
+	}
+}
+
+func TestAuthentikClient_GroupCRUDIsIdempotent(t *testing.T) {
+	ac, calls := newTestAuthentik(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("name") {
+		case "public_works":
+			w.Write([]byte(`{"results":[{"pk":"g1","name":"public_works"}]}`))
+		default:
+			w.Write([]byte(`{"results":[{"pk":"g2","name":"parks_and_rec"}]}`)) // name filter is not exact
+		}
+	})
+	ctx := context.Background()
+
+	if err := ac.CreateGroup(ctx, "public_works", "Public Works"); err != nil {
+		t.Errorf("CreateGroup of an existing group: %v", err)
+	}
+	if err := ac.DeleteRole(ctx, "parks"); err != nil {
+		t.Errorf("DeleteRole of a missing group: %v", err)
+	}
+	for _, call := range *calls {
+		if !strings.HasPrefix(call, "GET ") {
+			t.Errorf("unexpected write %s", call)
+		}
+	}
+}
+
+func TestNewIdentityProvider(t *testing.T) {
+	keycloak := KeycloakConfig{AdminURL: "http://keycloak:8080", Realm: "civic-os"}
+	authentik := AuthentikConfig{URL: "http://authentik:9000", APIToken: "token"}
+
+	cases := []struct {
+		name     string
+		keycloak KeycloakConfig
+		want     string
+		wantErr  bool
+	}{
+		{"", KeycloakConfig{}, "", false},
+		{"", keycloak, "keycloak", false},
+		{"keycloak", KeycloakConfig{}, "", true},
+		{"authentik", keycloak, "authentik", false},
+		{"auth0", keycloak, "", true},
+	}
+	for _, c := range cases {
+		provider, err := NewIdentityProvider(c.name, c.keycloak, authentik)
+		if (err != nil) != c.wantErr {
+			t.Errorf("NewIdentityProvider(%q) error = %v, wantErr %v", c.name, err, c.wantErr)
+			continue
+		}
+		got := ""
+		if provider != nil {
+			got = provider.Name()
+		}
+		if got != c.want {
+			t.Errorf("NewIdentityProvider(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	if _, err := NewIdentityProvider("authentik", keycloak, AuthentikConfig{URL: "http://authentik:9000"}); err == nil {
+		t.Error("authentik without an API token should fail")
+	}
+}
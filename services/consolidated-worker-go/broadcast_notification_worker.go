@@ -0,0 +1,464 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Notification Broadcasts
+// ============================================================================
+//
+// request_notification_broadcast() records a metadata.notification_broadcasts
+// row and queues broadcast_notification. The job runs in two phases:
+//
+//  1. sending: one run per batch of recipients, ordered by user ID after the
+//     broadcast's cursor. Each batch creates its notifications and their
+//     send_notification jobs, scheduled sendInterval apart after the latest
+//     send of any active broadcast, and moves the cursor, all in one
+//     transaction. Users with none of the broadcast's channels enabled are
+//     counted as skipped.
+//  2. delivering: snooze until the sends have settled, then total sent and
+//     failed notifications and send the requester a
+//     notification_broadcast_summary.
+//
+// The listener also queues a send job for each new notification; it is
+// skipped as a duplicate of the scheduled one (unique by notification ID).
+
+const (
+	defaultBroadcastBatchSize     = 500
+	defaultBroadcastRatePerMinute = 600
+	defaultBroadcastPoll          = 30 * time.Second
+
+	// Pending notifications are counted as failed this long after the last
+	// scheduled send, so a stuck send can't hold the summary back forever
+	broadcastDeliveryGrace = time.Hour
+)
+
+// BroadcastNotificationArgs defines the job arguments
+type BroadcastNotificationArgs struct {
+	BroadcastID int64            `json:"broadcast_id"`
+	Audit       *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger
+}
+
+func (BroadcastNotificationArgs) Kind() string { return "broadcast_notification" }
+
+func (BroadcastNotificationArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "notifications",
+		MaxAttempts: 5,
+		Priority:    3,
+	}
+}
+
+// BroadcastNotificationWorker sends one template to a role or list of users
+type BroadcastNotificationWorker struct {
+	river.WorkerDefaults[BroadcastNotificationArgs]
+	dbPool       *pgxpool.Pool
+	jobs         *JobEnqueuer
+	batchSize    int           // recipients per run
+	sendInterval time.Duration // between send jobs, across all broadcasts
+	pollInterval time.Duration // snooze while sends are delivered
+}
+
+// notificationBroadcast holds data from metadata.notification_broadcasts
+type notificationBroadcast struct {
+	ID             int64
+	TemplateName   string
+	EntityData     json.RawMessage
+	Channels       []string
+	RoleKeys       []string
+	UserIDs        []string
+	AllUsers       bool
+	Status         string
+	LastUserID     *string
+	ScheduledUntil *time.Time
+	RequestedBy    *string
+}
+
+// broadcastRecipient is one user matched by a broadcast and the channels
+// their preferences allow, worked out the way NotificationWorker does
+type broadcastRecipient struct {
+	UserID  string
+	EmailOK bool
+	SMSOK   bool
+}
+
+// broadcastTotals are the final counts of a broadcast
+type broadcastTotals struct {
+	Recipients, Skipped, Sent, Failed int
+}
+
+func (t broadcastTotals) String() string {
+	return fmt.Sprintf("%d recipient(s), %d sent, %d skipped, %d failed", t.Recipients, t.Sent, t.Skipped, t.Failed)
+}
+
+func (w *BroadcastNotificationWorker) Work(ctx context.Context, job *river.Job[BroadcastNotificationArgs]) error {
+	broadcastID := job.Args.BroadcastID
+
+	b, err := w.fetchBroadcast(ctx, broadcastID)
+	if err != nil {
+		return err
+	}
+
+	switch b.Status {
+	case "completed", "failed":
+		log.Printf("[Job %d] Broadcast %d already %s, skipping", job.ID, broadcastID, b.Status)
+		return nil
+	case "pending", "sending":
+		done, err := w.queueBatch(ctx, job.ID, b)
+		if err != nil {
+			if job.Attempt >= job.MaxAttempts {
+				log.Printf("[Job %d] Broadcast %d failed: %v", job.ID, broadcastID, err)
+				w.failBroadcast(ctx, job.ID, b, err.Error())
+				return nil
+			}
+			return err
+		}
+		if !done {
+			return river.JobSnooze(0)
+		}
+		// Sends are scheduled from now on; nothing can have settled yet
+		return river.JobSnooze(w.pollInterval)
+	}
+
+	totals, settled, err := w.tally(ctx, b)
+	if err != nil {
+		return err
+	}
+	if !settled {
+		return river.JobSnooze(w.pollInterval)
+	}
+	log.Printf("[Job %d] Broadcast %d finished: %s", job.ID, broadcastID, totals)
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "notification_broadcast_completed", map[string]interface{}{
+		"broadcast_id":  broadcastID,
+		"template_name": b.TemplateName,
+		"recipients":    totals.Recipients,
+		"sent":          totals.Sent,
+		"skipped":       totals.Skipped,
+		"failed":        totals.Failed,
+	})
+
+	w.sendSummary(ctx, job.ID, b, "completed", "")
+	return nil
+}
+
+func (w *BroadcastNotificationWorker) fetchBroadcast(ctx context.Context, id int64) (*notificationBroadcast, error) {
+	var b notificationBroadcast
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT id, template_name, entity_data, channels, role_keys, user_ids::TEXT[], all_users, status,
+		       last_user_id::TEXT, scheduled_until, requested_by::TEXT
+		FROM metadata.notification_broadcasts
+		WHERE id = $1
+	`, id).Scan(&b.ID, &b.TemplateName, &b.EntityData, &b.Channels, &b.RoleKeys, &b.UserIDs, &b.AllUsers,
+		&b.Status, &b.LastUserID, &b.ScheduledUntil, &b.RequestedBy)
+	if err != nil {
+		return nil, fmt.Errorf("broadcast %d not found: %w", id, err)
+	}
+	return &b, nil
+}
+
+// ============================================================================
+// Phase 1: create notifications and schedule their sends
+// ============================================================================
+
+// queueBatch handles the next batch of recipients and reports whether every
+// recipient has now been handled
+func (w *BroadcastNotificationWorker) queueBatch(ctx context.Context, jobID int64, b *notificationBroadcast) (bool, error) {
+	recipients, err := w.loadRecipients(ctx, b)
+	if err != nil {
+		return false, err
+	}
+	done := len(recipients) < w.batchSize
+
+	type delivery struct {
+		UserID   string   `json:"user_id"`
+		Channels []string `json:"channels"`
+	}
+	var deliveries []delivery
+	for _, r := range recipients {
+		if channels := broadcastChannels(r, b.Channels); len(channels) > 0 {
+			deliveries = append(deliveries, delivery{UserID: r.UserID, Channels: channels})
+		}
+	}
+	skipped := len(recipients) - len(deliveries)
+
+	deliveriesJSON, err := json.Marshal(deliveries)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal broadcast recipients: %w", err)
+	}
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// One broadcast at a time reserves send slots, so the rate holds across
+	// broadcasts queuing batches concurrently
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('metadata.notification_broadcasts'))`); err != nil {
+		return false, fmt.Errorf("failed to lock broadcast schedule: %w", err)
+	}
+
+	var now time.Time
+	var latest *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT NOW(), MAX(scheduled_until)
+		FROM metadata.notification_broadcasts
+		WHERE status IN ('sending', 'delivering')
+	`).Scan(&now, &latest)
+	if err != nil {
+		return false, fmt.Errorf("failed to read broadcast schedule: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO metadata.notifications (
+			user_id, template_name, entity_type, entity_id, entity_data, channels, broadcast_id
+		)
+		SELECT r.user_id, $2, 'notification_broadcasts', $1::BIGINT::TEXT, $3::JSONB, r.channels, $1
+		FROM jsonb_to_recordset($4::JSONB) AS r(user_id UUID, channels TEXT[])
+		RETURNING id::TEXT, user_id::TEXT, channels
+	`, b.ID, b.TemplateName, string(b.EntityData), string(deliveriesJSON))
+	if err != nil {
+		return false, fmt.Errorf("failed to create broadcast notifications: %w", err)
+	}
+	var sends []NotificationArgs
+	for rows.Next() {
+		args := NotificationArgs{
+			TemplateName: b.TemplateName,
+			EntityType:   "notification_broadcasts",
+			EntityID:     fmt.Sprint(b.ID),
+			EntityData:   b.EntityData,
+		}
+		if err := rows.Scan(&args.NotificationID, &args.UserID, &args.Channels); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan broadcast notification: %w", err)
+		}
+		sends = append(sends, args)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to create broadcast notifications: %w", err)
+	}
+
+	times := broadcastSendTimes(now, latest, len(sends), w.sendInterval)
+	params := make([]river.InsertManyParams, len(sends))
+	for i, args := range sends {
+		params[i] = river.InsertManyParams{Args: args, InsertOpts: &river.InsertOpts{ScheduledAt: times[i]}}
+	}
+	if _, err := w.jobs.InsertManyTx(ctx, tx, params); err != nil {
+		return false, fmt.Errorf("failed to queue broadcast sends: %w", err)
+	}
+
+	var lastUserID *string
+	if len(recipients) > 0 {
+		lastUserID = &recipients[len(recipients)-1].UserID
+	}
+	var scheduledUntil *time.Time
+	if len(times) > 0 {
+		scheduledUntil = &times[len(times)-1]
+	}
+	status := "sending"
+	if done {
+		status = "delivering"
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE metadata.notification_broadcasts
+		SET status = $2,
+		    recipients = recipients + $3, queued = queued + $4, skipped = skipped + $5,
+		    last_user_id = COALESCE($6::UUID, last_user_id),
+		    scheduled_until = COALESCE($7, scheduled_until),
+		    started_at = COALESCE(started_at, NOW())
+		WHERE id = $1
+	`, b.ID, status, len(recipients), len(sends), skipped, lastUserID, scheduledUntil)
+	if err != nil {
+		return false, fmt.Errorf("failed to update broadcast %d: %w", b.ID, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit broadcast batch: %w", err)
+	}
+
+	if len(times) > 0 {
+		log.Printf("[Job %d] Broadcast %d: %d notification(s) scheduled until %s, %d skipped",
+			jobID, b.ID, len(sends), times[len(times)-1].Format(time.RFC3339), skipped)
+	} else {
+		log.Printf("[Job %d] Broadcast %d: no notifications in batch, %d skipped", jobID, b.ID, skipped)
+	}
+	return done, nil
+}
+
+// loadRecipients returns the next batch of users after the cursor, once each
+// however many of the broadcast's roles they hold. Channel checks mirror
+// NotificationWorker.getUserPreferences: without an email preference row the
+// account email is used; SMS needs an enabled, not opted-out preference and
+// a phone number.
+func (w *BroadcastNotificationWorker) loadRecipients(ctx context.Context, b *notificationBroadcast) ([]broadcastRecipient, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT u.id::TEXT,
+		       CASE WHEN pe.user_id IS NOT NULL
+		            THEN pe.enabled AND COALESCE(pe.email_address::TEXT, '') <> ''
+		            ELSE COALESCE(p.email::TEXT, '') <> '' END,
+		       COALESCE(ps.enabled AND NOT ps.sms_opted_out AND COALESCE(p.phone::TEXT, '') <> '', false)
+		FROM metadata.civic_os_users u
+		LEFT JOIN metadata.civic_os_users_private p ON p.id = u.id
+		LEFT JOIN metadata.notification_preferences pe ON pe.user_id = u.id AND pe.channel = 'email'
+		LEFT JOIN metadata.notification_preferences ps ON ps.user_id = u.id AND ps.channel = 'sms'
+		WHERE ($1::UUID IS NULL OR u.id > $1::UUID)
+		  AND ($2 OR u.id = ANY($3::UUID[]) OR EXISTS (
+		      SELECT 1
+		      FROM metadata.user_roles ur
+		      JOIN metadata.roles r ON r.id = ur.role_id
+		      WHERE ur.user_id = u.id AND r.role_key = ANY($4::TEXT[])))
+		ORDER BY u.id
+		LIMIT $5
+	`, b.LastUserID, b.AllUsers, b.UserIDs, b.RoleKeys, w.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load broadcast recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []broadcastRecipient
+	for rows.Next() {
+		var r broadcastRecipient
+		if err := rows.Scan(&r.UserID, &r.EmailOK, &r.SMSOK); err != nil {
+			return nil, fmt.Errorf("failed to scan broadcast recipient: %w", err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// broadcastChannels returns the broadcast's channels the recipient can
+// receive; none means the recipient is skipped
+func broadcastChannels(r broadcastRecipient, channels []string) []string {
+	var allowed []string
+	for _, channel := range channels {
+		if (channel == "email" && r.EmailOK) || (channel == "sms" && r.SMSOK) {
+			if !slices.Contains(allowed, channel) {
+				allowed = append(allowed, channel)
+			}
+		}
+	}
+	return allowed
+}
+
+// broadcastSendTimes spaces n sends interval apart, starting now or one
+// interval after the latest send already scheduled, whichever is later
+func broadcastSendTimes(now time.Time, latest *time.Time, n int, interval time.Duration) []time.Time {
+	start := now
+	if latest != nil && latest.Add(interval).After(start) {
+		start = latest.Add(interval)
+	}
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = start.Add(time.Duration(i) * interval)
+	}
+	return times
+}
+
+// ============================================================================
+// Phase 2: wait for delivery and total the results
+// ============================================================================
+
+// broadcastSettled reports whether the counts are final: the last send is
+// due and none is pending, or the grace period after it has passed
+func broadcastSettled(now time.Time, scheduledUntil *time.Time, pending int) bool {
+	if scheduledUntil == nil {
+		return true
+	}
+	if now.Before(*scheduledUntil) {
+		return false
+	}
+	return pending == 0 || !now.Before(scheduledUntil.Add(broadcastDeliveryGrace))
+}
+
+// tally counts the broadcast's notifications and, once settled, completes it
+func (w *BroadcastNotificationWorker) tally(ctx context.Context, b *notificationBroadcast) (broadcastTotals, bool, error) {
+	var t broadcastTotals
+	var pending int
+	var now time.Time
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT NOW(),
+		       COUNT(*) FILTER (WHERE status = 'sent'),
+		       COUNT(*) FILTER (WHERE status = 'failed'),
+		       COUNT(*) FILTER (WHERE status = 'pending')
+		FROM metadata.notifications
+		WHERE broadcast_id = $1
+	`, b.ID).Scan(&now, &t.Sent, &t.Failed, &pending)
+	if err != nil {
+		return t, false, fmt.Errorf("failed to count broadcast %d notifications: %w", b.ID, err)
+	}
+	if !broadcastSettled(now, b.ScheduledUntil, pending) {
+		return t, false, nil
+	}
+	// Anything still pending after the grace period didn't go out
+	t.Failed += pending
+
+	err = w.dbPool.QueryRow(ctx, `
+		UPDATE metadata.notification_broadcasts
+		SET status = 'completed', sent = $2, failed = $3, completed_at = NOW()
+		WHERE id = $1
+		RETURNING recipients, skipped
+	`, b.ID, t.Sent, t.Failed).Scan(&t.Recipients, &t.Skipped)
+	if err != nil {
+		return t, false, fmt.Errorf("failed to complete broadcast %d: %w", b.ID, err)
+	}
+	return t, true, nil
+}
+
+func (w *BroadcastNotificationWorker) failBroadcast(ctx context.Context, jobID int64, b *notificationBroadcast, reason string) {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.notification_broadcasts
+		SET status = 'failed', error_message = $2, completed_at = NOW()
+		WHERE id = $1
+	`, b.ID, reason)
+	if err != nil {
+		log.Printf("[Job %d] Failed to mark broadcast %d failed: %v", jobID, b.ID, err)
+		return
+	}
+	w.sendSummary(ctx, jobID, b, "failed", reason)
+}
+
+// sendSummary notifies the requester. Failures are logged, not returned: the
+// broadcast is already final and retrying the job won't resend.
+func (w *BroadcastNotificationWorker) sendSummary(ctx context.Context, jobID int64, b *notificationBroadcast, status, reason string) {
+	if b.RequestedBy == nil {
+		log.Printf("[Job %d] Broadcast %d has no requester, summary not sent", jobID, b.ID)
+		return
+	}
+
+	// The enqueue_notification_job_trigger queues the send_notification job
+	_, err := w.dbPool.Exec(ctx, `
+		INSERT INTO metadata.notifications (user_id, template_name, entity_type, entity_id, entity_data, channels)
+		SELECT $2, 'notification_broadcast_summary', 'notification_broadcasts', b.id::TEXT,
+		       jsonb_build_object(
+		           'broadcast_id', b.id,
+		           'template_name', b.template_name,
+		           'status', $3::TEXT,
+		           'error_message', COALESCE($4::TEXT, ''),
+		           'recipients', b.recipients,
+		           'skipped', b.skipped,
+		           'sent', b.sent,
+		           'failed', b.failed
+		       ),
+		       ARRAY['email']
+		FROM metadata.notification_broadcasts b
+		WHERE b.id = $1
+	`, b.ID, *b.RequestedBy, status, reason)
+	if err != nil {
+		log.Printf("[Job %d] Broadcast %d summary not sent: %v", jobID, b.ID, err)
+		return
+	}
+	log.Printf("[Job %d] Broadcast %d summary queued for %s", jobID, b.ID, *b.RequestedBy)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBroadcastChannels(t *testing.T) {
+	tests := []struct {
+		recipient broadcastRecipient
+		channels  []string
+		want      []string
+	}{
+		{broadcastRecipient{EmailOK: true, SMSOK: true}, []string{"email", "sms"}, []string{"email", "sms"}},
+		{broadcastRecipient{EmailOK: true}, []string{"email", "sms"}, []string{"email"}},
+		{broadcastRecipient{SMSOK: true}, []string{"email"}, nil}, // skipped
+		{broadcastRecipient{}, []string{"email", "sms"}, nil},
+		{broadcastRecipient{EmailOK: true}, []string{"email", "email"}, []string{"email"}},
+	}
+	for _, tt := range tests {
+		if got := broadcastChannels(tt.recipient, tt.channels); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("broadcastChannels(%+v, %v) = %v, want %v", tt.recipient, tt.channels, got, tt.want)
+		}
+	}
+}
+
+func TestBroadcastSendTimes(t *testing.T) {
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	interval := 100 * time.Millisecond
+
+	got := broadcastSendTimes(now, nil, 3, interval)
+	want := []time.Time{now, now.Add(interval), now.Add(2 * interval)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("no earlier sends: %v, want %v", got, want)
+	}
+
+	// Queue behind another broadcast's last send
+	latest := now.Add(time.Minute)
+	if got := broadcastSendTimes(now, &latest, 2, interval); !got[0].Equal(latest.Add(interval)) || !got[1].Equal(latest.Add(2*interval)) {
+		t.Errorf("behind %v: %v", latest, got)
+	}
+
+	// A schedule that already passed doesn't delay the sends
+	past := now.Add(-time.Hour)
+	if got := broadcastSendTimes(now, &past, 1, interval); !got[0].Equal(now) {
+		t.Errorf("past schedule: %v, want now", got)
+	}
+
+	if got := broadcastSendTimes(now, nil, 0, interval); len(got) != 0 {
+		t.Errorf("no sends: %v", got)
+	}
+}
+
+func TestBroadcastSettled(t *testing.T) {
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+	earlier := now.Add(-time.Minute)
+	longAgo := now.Add(-broadcastDeliveryGrace)
+
+	tests := []struct {
+		name           string
+		scheduledUntil *time.Time
+		pending        int
+		want           bool
+	}{
+		{"nothing scheduled", nil, 0, true},
+		{"sends still due", &later, 0, false},
+		{"last send due, some pending", &earlier, 3, false},
+		{"last send due, none pending", &earlier, 0, true},
+		{"grace period over", &longAgo, 3, true},
+	}
+	for _, tt := range tests {
+		if got := broadcastSettled(now, tt.scheduledUntil, tt.pending); got != tt.want {
+			t.Errorf("%s: settled = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
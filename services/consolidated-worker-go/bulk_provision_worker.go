@@ -0,0 +1,879 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Bulk User Import
+// ============================================================================
+//
+// request_user_import() records a metadata.user_import_batches row for an
+// uploaded CSV and queues bulk_provision_users. The job runs in two phases:
+//
+//  1. pending: download the CSV, validate every line and record it in
+//     metadata.user_import_rows (invalid and already-existing rows included,
+//     so the importer sees what was not imported and why)
+//  2. provisioning: keep at most `concurrency` rows in flight as regular
+//     user_provisioning records + provision_keycloak_user jobs, snoozing
+//     between waves. Snoozes don't use up attempts.
+//
+// When no row is pending or queued the batch is totalled and the importer
+// gets a user_import_summary notification.
+
+const (
+	defaultBulkProvisionConcurrency = 10
+	defaultBulkProvisionMaxRows     = 5000
+	defaultBulkProvisionPoll        = 10 * time.Second
+
+	// Rows listed in the summary notification; the rest are counted
+	userImportSummaryProblems = 25
+)
+
+// BulkProvisionUsersArgs defines the job arguments
+type BulkProvisionUsersArgs struct {
+	BatchID int64            `json:"batch_id"`
+	Audit   *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger
+}
+
+func (BulkProvisionUsersArgs) Kind() string { return "bulk_provision_users" }
+
+func (BulkProvisionUsersArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "user_provisioning",
+		MaxAttempts: 5,
+		Priority:    2,
+	}
+}
+
+// BulkProvisionWorker imports users from a CSV in metadata.files
+type BulkProvisionWorker struct {
+	river.WorkerDefaults[BulkProvisionUsersArgs]
+	dbPool       *pgxpool.Pool
+	jobs         *JobEnqueuer
+	originals    *OriginalStore
+	concurrency  int           // provision jobs in flight per batch
+	maxRows      int           // data rows accepted per file
+	pollInterval time.Duration // snooze between waves
+}
+
+// userImportBatch holds data from metadata.user_import_batches
+type userImportBatch struct {
+	ID               int64
+	FileID           string
+	FileName         string
+	Status           string
+	DefaultRoles     []string
+	AllowedRoles     []string
+	SendWelcomeEmail bool
+	SendWelcomeSMS   bool
+	RequestedBy      *string
+}
+
+// userImportFileError is a problem with the file as a whole (not a CSV, no
+// header, too many rows). Retrying won't help, so the batch fails at once.
+type userImportFileError struct {
+	msg string
+}
+
+func (e *userImportFileError) Error() string { return e.msg }
+
+func (w *BulkProvisionWorker) Work(ctx context.Context, job *river.Job[BulkProvisionUsersArgs]) error {
+	batchID := job.Args.BatchID
+
+	batch, err := w.fetchBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+
+	switch batch.Status {
+	case "completed", "failed":
+		log.Printf("[Job %d] User import %d already %s, skipping", job.ID, batchID, batch.Status)
+		return nil
+	case "pending":
+		log.Printf("[Job %d] Reading user import %d (%s)", job.ID, batchID, batch.FileName)
+		if err := w.loadRows(ctx, job.ID, batch); err != nil {
+			var fileErr *userImportFileError
+			if errors.As(err, &fileErr) || job.Attempt >= job.MaxAttempts {
+				log.Printf("[Job %d] User import %d failed: %v", job.ID, batchID, err)
+				w.failBatch(ctx, job.ID, batch, err.Error())
+				return nil
+			}
+			return err
+		}
+	}
+
+	remaining, err := w.advance(ctx, job.ID, batch)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return river.JobSnooze(w.pollInterval)
+	}
+
+	totals, err := w.finishBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Job %d] User import %d finished: %s", job.ID, batchID, totals)
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "user_import_completed", map[string]interface{}{
+		"batch_id":  batchID,
+		"file_name": batch.FileName,
+		"completed": totals.Completed,
+		"failed":    totals.Failed,
+		"invalid":   totals.Invalid,
+		"skipped":   totals.Skipped,
+	})
+
+	w.sendSummary(ctx, job.ID, batch, "completed", "")
+	return nil
+}
+
+func (w *BulkProvisionWorker) fetchBatch(ctx context.Context, id int64) (*userImportBatch, error) {
+	var b userImportBatch
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT id, file_id::TEXT, file_name, status, default_roles, allowed_roles,
+		       send_welcome_email, send_welcome_sms, requested_by::TEXT
+		FROM metadata.user_import_batches
+		WHERE id = $1
+	`, id).Scan(&b.ID, &b.FileID, &b.FileName, &b.Status, &b.DefaultRoles, &b.AllowedRoles,
+		&b.SendWelcomeEmail, &b.SendWelcomeSMS, &b.RequestedBy)
+	if err != nil {
+		return nil, fmt.Errorf("user import %d not found: %w", id, err)
+	}
+	return &b, nil
+}
+
+// ============================================================================
+// Phase 1: read and validate the file
+// ============================================================================
+
+func (w *BulkProvisionWorker) loadRows(ctx context.Context, jobID int64, batch *userImportBatch) error {
+	var bucket, key string
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT s3_bucket, s3_original_key FROM metadata.files WHERE id = $1
+	`, batch.FileID).Scan(&bucket, &key)
+	if err != nil {
+		return fmt.Errorf("failed to look up file %s: %w", batch.FileID, err)
+	}
+
+	data, _, err := w.originals.Fetch(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	opts, err := w.importOptions(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	rows, err := parseUserImportCSV(data, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := w.markExisting(ctx, rows); err != nil {
+		return err
+	}
+
+	rowsJSON, err := json.Marshal(rows)
+	if err != nil {
+		return fmt.Errorf("failed to marshal import rows: %w", err)
+	}
+
+	counts := countImportRows(rows)
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO metadata.user_import_rows (
+			batch_id, row_number, email, first_name, last_name, phone, roles,
+			send_welcome_email, send_welcome_sms, status, error_message
+		)
+		SELECT $1, r.row_number, r.email, r.first_name, r.last_name, r.phone, r.roles,
+		       r.send_welcome_email, r.send_welcome_sms, r.status, r.error_message
+		FROM jsonb_to_recordset($2::JSONB) AS r(
+			row_number INT, email TEXT, first_name TEXT, last_name TEXT, phone TEXT, roles TEXT[],
+			send_welcome_email BOOLEAN, send_welcome_sms BOOLEAN, status TEXT, error_message TEXT
+		)
+		ON CONFLICT (batch_id, row_number) DO NOTHING
+	`, batch.ID, string(rowsJSON))
+	if err != nil {
+		return fmt.Errorf("failed to record import rows: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE metadata.user_import_batches
+		SET status = 'provisioning', total_rows = $2, invalid_rows = $3, skipped_rows = $4,
+		    started_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+	`, batch.ID, len(rows), counts["invalid"], counts["skipped"])
+	if err != nil {
+		return fmt.Errorf("failed to start user import: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit import rows: %w", err)
+	}
+
+	batch.Status = "provisioning"
+	log.Printf("[Job %d] User import %d: %d row(s), %d valid, %d invalid, %d already exist",
+		jobID, batch.ID, len(rows), counts["pending"], counts["invalid"], counts["skipped"])
+	return nil
+}
+
+// importOptions resolves the roles a row may name from metadata.roles
+func (w *BulkProvisionWorker) importOptions(ctx context.Context, batch *userImportBatch) (userImportOptions, error) {
+	opts := userImportOptions{
+		roleKeys:         map[string]string{},
+		allowedRoles:     map[string]bool{},
+		defaultRoles:     batch.DefaultRoles,
+		sendWelcomeEmail: batch.SendWelcomeEmail,
+		sendWelcomeSMS:   batch.SendWelcomeSMS,
+		maxRows:          w.maxRows,
+	}
+	for _, role := range batch.AllowedRoles {
+		opts.allowedRoles[role] = true
+	}
+
+	rows, err := w.dbPool.Query(ctx, `SELECT role_key, display_name FROM metadata.roles`)
+	if err != nil {
+		return opts, fmt.Errorf("failed to load roles: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roleKey, displayName string
+		if err := rows.Scan(&roleKey, &displayName); err != nil {
+			return opts, fmt.Errorf("failed to scan role: %w", err)
+		}
+		// Same precedence as resolve_role_key(): role_key, then display name
+		opts.roleKeys[roleKey] = roleKey
+		if _, taken := opts.roleKeys[strings.ToLower(displayName)]; !taken {
+			opts.roleKeys[strings.ToLower(displayName)] = roleKey
+		}
+	}
+	return opts, rows.Err()
+}
+
+// markExisting skips rows whose email already has a user or an active
+// provisioning request, so re-running an import doesn't create duplicates
+func (w *BulkProvisionWorker) markExisting(ctx context.Context, rows []userImportRow) error {
+	var emails []string
+	for _, row := range rows {
+		if row.Status == "pending" {
+			emails = append(emails, *row.Email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	result, err := w.dbPool.Query(ctx, `
+		SELECT lower(email::TEXT) FROM metadata.civic_os_users_private
+		WHERE lower(email::TEXT) = ANY($1)
+		UNION
+		SELECT lower(email::TEXT) FROM metadata.user_provisioning
+		WHERE status IN ('pending', 'processing', 'completed') AND lower(email::TEXT) = ANY($1)
+	`, emails)
+	if err != nil {
+		return fmt.Errorf("failed to check existing users: %w", err)
+	}
+	defer result.Close()
+
+	existing := map[string]bool{}
+	for result.Next() {
+		var email string
+		if err := result.Scan(&email); err != nil {
+			return fmt.Errorf("failed to scan existing user: %w", err)
+		}
+		existing[email] = true
+	}
+	if err := result.Err(); err != nil {
+		return err
+	}
+
+	for i := range rows {
+		if rows[i].Status == "pending" && existing[*rows[i].Email] {
+			rows[i].skip("a user with this email already exists")
+		}
+	}
+	return nil
+}
+
+// ============================================================================
+// Phase 2: feed rows to provision_keycloak_user
+// ============================================================================
+
+// advance settles finished rows, queues pending rows into free slots and
+// returns how many rows are still pending or queued
+func (w *BulkProvisionWorker) advance(ctx context.Context, jobID int64, batch *userImportBatch) (int, error) {
+	// A provision job marks its record failed on every failed attempt, so a
+	// failed record is only final once River has stopped retrying the job
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.user_import_rows r
+		SET status = CASE WHEN p.status = 'completed' THEN 'completed' ELSE 'failed' END,
+		    error_message = CASE WHEN p.status = 'completed' THEN NULL
+		                         ELSE COALESCE(p.error_message, 'provisioning failed') END,
+		    updated_at = NOW()
+		FROM metadata.user_provisioning p
+		WHERE r.batch_id = $1
+		  AND r.status = 'queued'
+		  AND p.id = r.provision_id
+		  AND (p.status = 'completed'
+		       OR (p.status = 'failed' AND NOT EXISTS (
+		           SELECT 1 FROM metadata.river_job j
+		           WHERE j.id = r.provision_job_id
+		             AND j.state IN ('available', 'pending', 'running', 'retryable', 'scheduled'))))
+	`, batch.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update import row status: %w", err)
+	}
+
+	var pending, queued int
+	err = w.dbPool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE status = 'pending'),
+		       COUNT(*) FILTER (WHERE status = 'queued')
+		FROM metadata.user_import_rows
+		WHERE batch_id = $1
+	`, batch.ID).Scan(&pending, &queued)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count import rows: %w", err)
+	}
+
+	slots := w.concurrency - queued
+	if pending == 0 || slots <= 0 {
+		return pending + queued, nil
+	}
+
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT id, row_number, email, first_name, last_name, phone, roles,
+		       send_welcome_email, send_welcome_sms
+		FROM metadata.user_import_rows
+		WHERE batch_id = $1 AND status = 'pending'
+		ORDER BY row_number
+		LIMIT $2
+	`, batch.ID, slots)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pending import rows: %w", err)
+	}
+	var next []userImportRow
+	for rows.Next() {
+		var row userImportRow
+		if err := rows.Scan(&row.ID, &row.RowNumber, &row.Email, &row.FirstName, &row.LastName, &row.Phone,
+			&row.Roles, &row.SendWelcomeEmail, &row.SendWelcomeSMS); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan import row: %w", err)
+		}
+		next = append(next, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, row := range next {
+		if err := w.queueRow(ctx, batch, row); err != nil {
+			// The database rejected the row (e.g. a constraint the CSV checks
+			// don't cover); fail it rather than the whole batch
+			log.Printf("[Job %d] User import %d row %d: %v", jobID, batch.ID, row.RowNumber, err)
+			if _, markErr := w.dbPool.Exec(ctx, `
+				UPDATE metadata.user_import_rows
+				SET status = 'failed', error_message = $2, updated_at = NOW()
+				WHERE id = $1
+			`, row.ID, err.Error()); markErr != nil {
+				return 0, fmt.Errorf("failed to mark import row %d failed: %w", row.ID, markErr)
+			}
+			pending--
+			continue
+		}
+		pending--
+		queued++
+	}
+	log.Printf("[Job %d] User import %d: %d queued, %d waiting", jobID, batch.ID, queued, pending)
+
+	return pending + queued, nil
+}
+
+// queueRow creates the user_provisioning record and provision job for one
+// row, the same way create_provisioned_user() does
+func (w *BulkProvisionWorker) queueRow(ctx context.Context, batch *userImportBatch, row userImportRow) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var provisionID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO metadata.user_provisioning (
+			email, first_name, last_name, phone,
+			initial_roles, send_welcome_email, send_welcome_sms,
+			status, requested_by
+		) VALUES ($1::email_address, $2, $3, $4::phone_number, $5, $6, $7, 'pending', $8)
+		RETURNING id
+	`, row.Email, row.FirstName, row.LastName, row.Phone, row.Roles,
+		row.SendWelcomeEmail, row.SendWelcomeSMS, batch.RequestedBy).Scan(&provisionID)
+	if err != nil {
+		return fmt.Errorf("insert user_provisioning failed: %w", err)
+	}
+
+	job, err := w.jobs.InsertTx(ctx, tx, ProvisionUserArgs{ProvisionID: provisionID}, nil)
+	if err != nil {
+		return fmt.Errorf("queue provision job failed: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE metadata.user_import_rows
+		SET status = 'queued', provision_id = $2, provision_job_id = $3, updated_at = NOW()
+		WHERE id = $1
+	`, row.ID, provisionID, job.Job.ID)
+	if err != nil {
+		return fmt.Errorf("update import row failed: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ============================================================================
+// Completion
+// ============================================================================
+
+// userImportTotals are the final row counts of a batch
+type userImportTotals struct {
+	Completed, Failed, Invalid, Skipped int
+}
+
+func (t userImportTotals) String() string {
+	return fmt.Sprintf("%d created, %d failed, %d invalid, %d already existed",
+		t.Completed, t.Failed, t.Invalid, t.Skipped)
+}
+
+func (w *BulkProvisionWorker) finishBatch(ctx context.Context, batchID int64) (userImportTotals, error) {
+	var t userImportTotals
+	err := w.dbPool.QueryRow(ctx, `
+		WITH counts AS (
+			SELECT COUNT(*) FILTER (WHERE status = 'completed') AS completed,
+			       COUNT(*) FILTER (WHERE status = 'failed') AS failed,
+			       COUNT(*) FILTER (WHERE status = 'invalid') AS invalid,
+			       COUNT(*) FILTER (WHERE status = 'skipped') AS skipped
+			FROM metadata.user_import_rows
+			WHERE batch_id = $1
+		)
+		UPDATE metadata.user_import_batches b
+		SET status = 'completed', completed_rows = c.completed, failed_rows = c.failed,
+		    invalid_rows = c.invalid, skipped_rows = c.skipped, completed_at = NOW()
+		FROM counts c
+		WHERE b.id = $1
+		RETURNING b.completed_rows, b.failed_rows, b.invalid_rows, b.skipped_rows
+	`, batchID).Scan(&t.Completed, &t.Failed, &t.Invalid, &t.Skipped)
+	if err != nil {
+		return t, fmt.Errorf("failed to complete user import %d: %w", batchID, err)
+	}
+	return t, nil
+}
+
+func (w *BulkProvisionWorker) failBatch(ctx context.Context, jobID int64, batch *userImportBatch, reason string) {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.user_import_batches
+		SET status = 'failed', error_message = $2, completed_at = NOW()
+		WHERE id = $1
+	`, batch.ID, reason)
+	if err != nil {
+		log.Printf("[Job %d] Failed to mark user import %d failed: %v", jobID, batch.ID, err)
+		return
+	}
+	w.sendSummary(ctx, jobID, batch, "failed", reason)
+}
+
+// sendSummary notifies the importer. Failures are logged, not returned: the
+// batch is already final and retrying the job won't resend.
+func (w *BulkProvisionWorker) sendSummary(ctx context.Context, jobID int64, batch *userImportBatch, status, reason string) {
+	if batch.RequestedBy == nil {
+		log.Printf("[Job %d] User import %d has no requester, summary not sent", jobID, batch.ID)
+		return
+	}
+
+	var entityData []byte
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT jsonb_build_object(
+			'file_name', b.file_name,
+			'status', $2::TEXT,
+			'error_message', COALESCE($3::TEXT, ''),
+			'total_rows', b.total_rows,
+			'completed_rows', b.completed_rows,
+			'failed_rows', b.failed_rows,
+			'invalid_rows', b.invalid_rows,
+			'skipped_rows', b.skipped_rows,
+			'problems', COALESCE((
+				SELECT jsonb_agg(jsonb_build_object(
+				           'row_number', p.row_number, 'email', COALESCE(p.email, ''),
+				           'status', p.status, 'error', COALESCE(p.error_message, ''))
+				       ORDER BY p.row_number)
+				FROM (SELECT * FROM metadata.user_import_rows r
+				      WHERE r.batch_id = b.id AND r.status IN ('invalid', 'skipped', 'failed')
+				      ORDER BY r.row_number LIMIT $4) p
+			), '[]'::JSONB),
+			'more_problems', GREATEST((
+				SELECT COUNT(*) FROM metadata.user_import_rows r
+				WHERE r.batch_id = b.id AND r.status IN ('invalid', 'skipped', 'failed')
+			) - $4, 0)
+		)
+		FROM metadata.user_import_batches b
+		WHERE b.id = $1
+	`, batch.ID, status, reason, userImportSummaryProblems).Scan(&entityData)
+	if err != nil {
+		log.Printf("[Job %d] User import %d summary not sent: %v", jobID, batch.ID, err)
+		return
+	}
+
+	// The enqueue_notification_job_trigger queues the send_notification job
+	_, err = w.dbPool.Exec(ctx, `
+		INSERT INTO metadata.notifications (user_id, template_name, entity_type, entity_id, entity_data, channels)
+		VALUES ($1, 'user_import_summary', 'user_import_batches', $2::BIGINT::TEXT, $3::JSONB, ARRAY['email'])
+	`, *batch.RequestedBy, batch.ID, string(entityData))
+	if err != nil {
+		log.Printf("[Job %d] User import %d summary not sent: %v", jobID, batch.ID, err)
+		return
+	}
+	log.Printf("[Job %d] User import %d summary queued for %s", jobID, batch.ID, *batch.RequestedBy)
+}
+
+// ============================================================================
+// CSV Parsing
+// ============================================================================
+
+// userImportRow is one line of an import file, as stored in
+// metadata.user_import_rows
+type userImportRow struct {
+	ID               int64    `json:"-"`
+	RowNumber        int      `json:"row_number"`
+	Email            *string  `json:"email"`
+	FirstName        *string  `json:"first_name"`
+	LastName         *string  `json:"last_name"`
+	Phone            *string  `json:"phone"`
+	Roles            []string `json:"roles"`
+	SendWelcomeEmail *bool    `json:"send_welcome_email"`
+	SendWelcomeSMS   *bool    `json:"send_welcome_sms"`
+	Status           string   `json:"status"`
+	ErrorMessage     *string  `json:"error_message"`
+}
+
+func (r *userImportRow) reject(problems []string) {
+	r.Status = "invalid"
+	msg := strings.Join(problems, "; ")
+	r.ErrorMessage = &msg
+}
+
+func (r *userImportRow) skip(reason string) {
+	r.Status = "skipped"
+	r.ErrorMessage = &reason
+}
+
+// userImportOptions configures parseUserImportCSV for one batch
+type userImportOptions struct {
+	roleKeys         map[string]string // role_key and lower(display_name) -> role_key
+	allowedRoles     map[string]bool   // role keys the importer may assign
+	defaultRoles     []string
+	sendWelcomeEmail bool
+	sendWelcomeSMS   bool
+	maxRows          int
+}
+
+// userImportHeaders maps normalized header names to row fields. The names
+// match the Import Users template, so an exported template works unchanged.
+var userImportHeaders = map[string]string{
+	"email":              "email",
+	"e_mail":             "email",
+	"email_address":      "email",
+	"first_name":         "first_name",
+	"firstname":          "first_name",
+	"given_name":         "first_name",
+	"last_name":          "last_name",
+	"lastname":           "last_name",
+	"surname":            "last_name",
+	"family_name":        "last_name",
+	"phone":              "phone",
+	"phone_number":       "phone",
+	"roles":              "roles",
+	"role":               "roles",
+	"send_welcome_email": "send_welcome_email",
+	"send_welcome_sms":   "send_welcome_sms",
+}
+
+// userImportHeaderSearchLines is how far down the header row may be. The
+// template puts a row of hints above the headers.
+const userImportHeaderSearchLines = 5
+
+// Mirrors the email_address domain check
+var userImportEmailPattern = regexp.MustCompile(`^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$`)
+
+// parseUserImportCSV reads and validates an import file. Every data line
+// becomes a row: valid rows have status pending, the rest invalid with the
+// reasons in ErrorMessage. Errors are returned only for problems with the
+// file as a whole.
+func parseUserImportCSV(data []byte, opts userImportOptions) ([]userImportRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel's UTF-8 BOM
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = sniffCSVDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var columns map[int]string
+	var rows []userImportRow
+	seen := map[string]int{} // email -> row number
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &userImportFileError{msg: fmt.Sprintf("not a readable CSV file: %v", err)}
+		}
+		line, _ := reader.FieldPos(0)
+
+		if columns == nil {
+			if columns = userImportColumns(record); columns == nil {
+				if line >= userImportHeaderSearchLines {
+					return nil, &userImportFileError{msg: "no header row with an Email column found"}
+				}
+			} else {
+				for _, required := range []string{"first_name", "last_name"} {
+					if !hasColumn(columns, required) {
+						return nil, &userImportFileError{msg: fmt.Sprintf("header row has no %s column", strings.ReplaceAll(required, "_", " "))}
+					}
+				}
+			}
+			continue
+		}
+
+		fields := map[string]string{}
+		blank := true
+		for i, value := range record {
+			if name, ok := columns[i]; ok {
+				fields[name] = strings.TrimSpace(value)
+				if fields[name] != "" {
+					blank = false
+				}
+			}
+		}
+		if blank {
+			continue
+		}
+
+		if len(rows) == opts.maxRows {
+			return nil, &userImportFileError{msg: fmt.Sprintf("file has more than %d rows; split it into smaller imports", opts.maxRows)}
+		}
+
+		row := validateUserImportRow(line, fields, opts)
+		if row.Status == "pending" {
+			if first, dup := seen[*row.Email]; dup {
+				row.reject([]string{fmt.Sprintf("duplicate of row %d", first)})
+			} else {
+				seen[*row.Email] = line
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if columns == nil {
+		return nil, &userImportFileError{msg: "no header row with an Email column found"}
+	}
+	if len(rows) == 0 {
+		return nil, &userImportFileError{msg: "file has no data rows"}
+	}
+	return rows, nil
+}
+
+// validateUserImportRow applies the batch defaults and checks one row
+func validateUserImportRow(line int, fields map[string]string, opts userImportOptions) userImportRow {
+	row := userImportRow{RowNumber: line, Status: "pending"}
+	var problems []string
+
+	email := strings.ToLower(fields["email"])
+	row.Email = optionalString(email)
+	switch {
+	case email == "":
+		problems = append(problems, "email is required")
+	case !userImportEmailPattern.MatchString(email):
+		problems = append(problems, fmt.Sprintf("%q is not a valid email address", fields["email"]))
+	}
+
+	row.FirstName = optionalString(fields["first_name"])
+	if row.FirstName == nil {
+		problems = append(problems, "first name is required")
+	}
+	row.LastName = optionalString(fields["last_name"])
+	if row.LastName == nil {
+		problems = append(problems, "last name is required")
+	}
+
+	if raw := fields["phone"]; raw != "" {
+		if phone, ok := normalizeImportPhone(raw); ok {
+			row.Phone = &phone
+		} else {
+			problems = append(problems, fmt.Sprintf("%q is not a 10-digit phone number", raw))
+		}
+	}
+
+	row.Roles = opts.defaultRoles
+	if raw := fields["roles"]; raw != "" {
+		row.Roles = nil
+		for _, name := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ';' }) {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			roleKey, ok := opts.roleKeys[name]
+			if !ok {
+				roleKey, ok = opts.roleKeys[strings.ToLower(name)]
+			}
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("role %q does not exist", name))
+			case !opts.allowedRoles[roleKey]:
+				problems = append(problems, fmt.Sprintf("you cannot assign the %q role", name))
+			case !slices.Contains(row.Roles, roleKey):
+				row.Roles = append(row.Roles, roleKey)
+			}
+		}
+		if len(row.Roles) == 0 && len(problems) == 0 {
+			row.Roles = opts.defaultRoles
+		}
+	}
+
+	for _, flag := range []struct {
+		field string
+		def   bool
+		dest  **bool
+	}{
+		{"send_welcome_email", opts.sendWelcomeEmail, &row.SendWelcomeEmail},
+		{"send_welcome_sms", opts.sendWelcomeSMS, &row.SendWelcomeSMS},
+	} {
+		value, ok := parseImportBool(fields[flag.field], flag.def)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s must be true or false, got %q", strings.ReplaceAll(flag.field, "_", " "), fields[flag.field]))
+		}
+		*flag.dest = &value
+	}
+	if *row.SendWelcomeSMS && row.Phone == nil && len(problems) == 0 {
+		problems = append(problems, "a phone number is required to send a welcome SMS")
+	}
+
+	if len(problems) > 0 {
+		row.reject(problems)
+	}
+	return row
+}
+
+// userImportColumns maps column positions to fields, or returns nil when the
+// record is not a header row (no Email column)
+func userImportColumns(record []string) map[int]string {
+	columns := map[int]string{}
+	for i, header := range record {
+		if name, ok := userImportHeaders[normalizeImportHeader(header)]; ok && !hasColumn(columns, name) {
+			columns[i] = name
+		}
+	}
+	if !hasColumn(columns, "email") {
+		return nil
+	}
+	return columns
+}
+
+func hasColumn(columns map[int]string, name string) bool {
+	for _, c := range columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeImportHeader turns "First Name", "first-name" and " FIRST_NAME"
+// into first_name
+func normalizeImportHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return '_'
+		}
+		return r
+	}, header)
+}
+
+// sniffCSVDelimiter picks ';' for files from locales where Excel exports
+// semicolon-separated "CSV", otherwise ','
+func sniffCSVDelimiter(data []byte) rune {
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+// normalizeImportPhone strips formatting and a leading US country code,
+// returning the 10 digits the phone_number domain accepts
+func normalizeImportPhone(raw string) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, raw)
+	if len(digits) == 11 && digits[0] == '1' {
+		digits = digits[1:]
+	}
+	return digits, len(digits) == 10
+}
+
+// parseImportBool accepts the spellings spreadsheets produce; blank means def
+func parseImportBool(raw string, def bool) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "":
+		return def, true
+	case "true", "t", "yes", "y", "1":
+		return true, true
+	case "false", "f", "no", "n", "0":
+		return false, true
+	}
+	return def, false
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// countImportRows tallies rows by status
+func countImportRows(rows []userImportRow) map[string]int {
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.Status]++
+	}
+	return counts
+}
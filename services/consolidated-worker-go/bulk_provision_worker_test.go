@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testImportOptions() userImportOptions {
+	return userImportOptions{
+		roleKeys: map[string]string{
+			"user": "user", "editor": "editor", "admin": "admin",
+			"content editor": "editor", "administrator": "admin",
+		},
+		allowedRoles:     map[string]bool{"user": true, "editor": true},
+		defaultRoles:     []string{"user"},
+		sendWelcomeEmail: true,
+		maxRows:          100,
+	}
+}
+
+func TestParseUserImportCSV_TemplateLayout(t *testing.T) {
+	// The Import Users template puts a hint row above the headers
+	csvData := "\xef\xbb\xbfRequired. User email address,Required. User first name,Required. User last name,Optional. 10-digit phone number,Optional roles\n" +
+		"Email,First Name,Last Name,Phone,Roles,Send Welcome Email,Send Welcome SMS\n" +
+		"Jane@Example.com,Jane,Doe,(555) 123-4567,Content Editor,,yes\n" +
+		"bob@example.com,Bob,Smith,,,no,\n" +
+		",,,,,,\n"
+
+	rows, err := parseUserImportCSV([]byte(csvData), testImportOptions())
+	if err != nil {
+		t.Fatalf("parseUserImportCSV: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2 (blank line skipped)", len(rows))
+	}
+
+	jane := rows[0]
+	if jane.Status != "pending" || jane.RowNumber != 3 || *jane.Email != "jane@example.com" || *jane.Phone != "5551234567" {
+		t.Errorf("jane = %+v", jane)
+	}
+	if !reflect.DeepEqual(jane.Roles, []string{"editor"}) || !*jane.SendWelcomeEmail || !*jane.SendWelcomeSMS {
+		t.Errorf("jane roles/flags = %v, email=%v sms=%v", jane.Roles, *jane.SendWelcomeEmail, *jane.SendWelcomeSMS)
+	}
+
+	bob := rows[1]
+	if bob.Status != "pending" || bob.Phone != nil || !reflect.DeepEqual(bob.Roles, []string{"user"}) || *bob.SendWelcomeEmail {
+		t.Errorf("bob = %+v", bob)
+	}
+}
+
+func TestParseUserImportCSV_RowProblems(t *testing.T) {
+	csvData := "email,first_name,last_name,phone,roles\n" +
+		"not-an-email,A,B,,\n" +
+		"c@example.com,,D,,\n" +
+		"e@example.com,E,F,123,\n" +
+		"g@example.com,G,H,,admin\n" +
+		"i@example.com,I,J,,ghost\n" +
+		"k@example.com,K,L,,\n" +
+		"K@example.com,K,L,,\n"
+
+	rows, err := parseUserImportCSV([]byte(csvData), testImportOptions())
+	if err != nil {
+		t.Fatalf("parseUserImportCSV: %v", err)
+	}
+
+	want := map[int]string{
+		2: "is not a valid email address",
+		3: "first name is required",
+		4: "is not a 10-digit phone number",
+		5: `you cannot assign the "admin" role`,
+		6: `role "ghost" does not exist`,
+		8: "duplicate of row 7",
+	}
+	for _, row := range rows {
+		msg, bad := want[row.RowNumber]
+		if !bad {
+			if row.Status != "pending" {
+				t.Errorf("row %d: status %s (%v), want pending", row.RowNumber, row.Status, *row.ErrorMessage)
+			}
+			continue
+		}
+		if row.Status != "invalid" || row.ErrorMessage == nil || !strings.Contains(*row.ErrorMessage, msg) {
+			t.Errorf("row %d: status %s error %v, want invalid containing %q", row.RowNumber, row.Status, row.ErrorMessage, msg)
+		}
+	}
+}
+
+func TestParseUserImportCSV_WelcomeSMSNeedsPhone(t *testing.T) {
+	rows, err := parseUserImportCSV([]byte("Email;First Name;Last Name;Send Welcome SMS\na@example.com;A;B;true\n"), testImportOptions())
+	if err != nil {
+		t.Fatalf("parseUserImportCSV: %v", err)
+	}
+	if rows[0].Status != "invalid" || !strings.Contains(*rows[0].ErrorMessage, "phone number is required") {
+		t.Errorf("row = %+v, want invalid for SMS without a phone", rows[0])
+	}
+}
+
+func TestParseUserImportCSV_FileErrors(t *testing.T) {
+	opts := testImportOptions()
+	opts.maxRows = 2
+
+	cases := map[string]string{
+		"name,address\nJane,Main St\n":                                     "no header row with an Email column",
+		"email,first_name\na@example.com,A\n":                              "no last name column",
+		"email,first_name,last_name\n":                                     "no data rows",
+		"email,first_name,last_name\na@x.io,A,B\nb@x.io,B,C\nc@x.io,C,D\n": "more than 2 rows",
+		"email,first_name,last_name\n\"a@x.io,A,B\n":                       "not a readable CSV file",
+	}
+	for data, want := range cases {
+		_, err := parseUserImportCSV([]byte(data), opts)
+		var fileErr *userImportFileError
+		if !errors.As(err, &fileErr) || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseUserImportCSV(%q) = %v, want a file error containing %q", data, err, want)
+		}
+	}
+}
+
+func TestNormalizeImportPhone(t *testing.T) {
+	cases := map[string]string{
+		"555-123-4567":     "5551234567",
+		"+1 (555) 1234567": "5551234567",
+		"15551234567":      "5551234567",
+	}
+	for raw, want := range cases {
+		if got, ok := normalizeImportPhone(raw); !ok || got != want {
+			t.Errorf("normalizeImportPhone(%q) = %q, %v; want %q", raw, got, ok, want)
+		}
+	}
+	if _, ok := normalizeImportPhone("25551234567"); ok {
+		t.Error("an 11-digit number without the US country code should be rejected")
+	}
+}
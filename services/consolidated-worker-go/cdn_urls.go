@@ -0,0 +1,353 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Signed CDN URLs for Thumbnails
+//
+// Deployments can serve thumbnails through a CDN (CloudFront or Cloudflare)
+// in front of the bucket instead of making the objects public-read. The
+// worker signs one URL per thumbnail size and stores them in
+// metadata.file_cdn_urls, which public.files joins in, so the frontend reads
+// them like any other file column:
+//
+//   - ThumbnailWorker signs a file's URLs right after generating thumbnails,
+//     and uploads them without the public-read ACL
+//   - CDNURLRefreshTask re-signs URLs that pass half their lifetime and signs
+//     files that have none (uploaded before signing was enabled)
+//
+// Only files in CDN_S3_BUCKET (default S3_BUCKET) are signed: the CDN origin
+// is a single bucket. Originals keep their direct S3 URLs.
+// ============================================================================
+
+const (
+	defaultCDNURLTTL       = 24 * time.Hour
+	defaultCDNTokenParam   = "verify"
+	cdnURLRefreshBatchSize = 500
+)
+
+// CDNSigner signs a URL for one CDN's token scheme
+type CDNSigner interface {
+	// Name returns the CDN_URL_SIGNER value that selects this signer
+	Name() string
+	// Sign returns rawURL with the CDN's token, valid from signedAt until expires
+	Sign(rawURL string, signedAt, expires time.Time) (string, error)
+}
+
+// CDNConfig configures thumbnail URL signing
+type CDNConfig struct {
+	Signer     string        // "cloudfront", "cloudflare" or "" (off)
+	BaseURL    string        // CDN origin for the bucket, e.g. https://d111.cloudfront.net
+	Bucket     string        // Bucket the CDN serves
+	TTL        time.Duration // Lifetime of each signed URL
+	KeyPairID  string        // CloudFront public key ID
+	SigningKey string        // CloudFront RSA private key (PEM) or Cloudflare HMAC secret
+	TokenParam string        // Cloudflare query parameter holding the token
+}
+
+// loadCDNConfig reads the configuration from the environment
+//
+//   - CDN_URL_SIGNER: cloudfront or cloudflare (unset = off)
+//   - CDN_BASE_URL (required when on)
+//   - CDN_S3_BUCKET (default S3_BUCKET)
+//   - CDN_URL_TTL_HOURS (default 24)
+//   - CDN_KEY_PAIR_ID (CloudFront)
+//   - CDN_SIGNING_KEY, or CDN_SIGNING_KEY_FILE to read it from a file
+//   - CDN_TOKEN_PARAM (Cloudflare, default "verify")
+func loadCDNConfig(defaultBucket string) (CDNConfig, error) {
+	cfg := CDNConfig{
+		Signer:     strings.ToLower(getEnv("CDN_URL_SIGNER", "")),
+		BaseURL:    strings.TrimRight(getEnv("CDN_BASE_URL", ""), "/"),
+		Bucket:     getEnv("CDN_S3_BUCKET", defaultBucket),
+		TTL:        time.Duration(max(getEnvInt("CDN_URL_TTL_HOURS", int(defaultCDNURLTTL/time.Hour)), 1)) * time.Hour,
+		KeyPairID:  getEnv("CDN_KEY_PAIR_ID", ""),
+		SigningKey: getEnv("CDN_SIGNING_KEY", ""),
+		TokenParam: getEnv("CDN_TOKEN_PARAM", defaultCDNTokenParam),
+	}
+	if path := getEnv("CDN_SIGNING_KEY_FILE", ""); path != "" && cfg.SigningKey == "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("CDN_SIGNING_KEY_FILE: %w", err)
+		}
+		cfg.SigningKey = strings.TrimSpace(string(data))
+	}
+	return cfg, nil
+}
+
+// newCDNSigner builds the signer selected by cfg; nil when signing is off
+func newCDNSigner(cfg CDNConfig) (CDNSigner, error) {
+	if cfg.Signer == "" {
+		return nil, nil
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("CDN_URL_SIGNER=%s requires CDN_BASE_URL", cfg.Signer)
+	}
+	if cfg.SigningKey == "" {
+		return nil, fmt.Errorf("CDN_URL_SIGNER=%s requires CDN_SIGNING_KEY or CDN_SIGNING_KEY_FILE", cfg.Signer)
+	}
+	switch cfg.Signer {
+	case "cloudfront":
+		if cfg.KeyPairID == "" {
+			return nil, fmt.Errorf("CDN_URL_SIGNER=cloudfront requires CDN_KEY_PAIR_ID")
+		}
+		key, err := parseRSAPrivateKey(cfg.SigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("CDN_SIGNING_KEY: %w", err)
+		}
+		return &cloudFrontSigner{keyPairID: cfg.KeyPairID, key: key}, nil
+	case "cloudflare":
+		return &cloudflareSigner{secret: []byte(cfg.SigningKey), param: cfg.TokenParam}, nil
+	default:
+		return nil, fmt.Errorf("unknown CDN_URL_SIGNER %q (want cloudfront or cloudflare)", cfg.Signer)
+	}
+}
+
+// --- CloudFront ---
+
+// cloudFrontSigner produces canned-policy signed URLs
+// (https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/private-content-creating-signed-url-canned-policy.html)
+type cloudFrontSigner struct {
+	keyPairID string
+	key       *rsa.PrivateKey
+}
+
+func (s *cloudFrontSigner) Name() string { return "cloudfront" }
+
+func (s *cloudFrontSigner) Sign(rawURL string, signedAt, expires time.Time) (string, error) {
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":%d}}}]}`, rawURL, expires.Unix())
+	digest := sha1.Sum([]byte(policy))
+	signature, err := rsa.SignPKCS1v15(nil, s.key, crypto.SHA1, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign policy: %w", err)
+	}
+	// CloudFront's URL-safe base64 variant
+	encoded := strings.NewReplacer("+", "-", "=", "_", "/", "~").Replace(base64.StdEncoding.EncodeToString(signature))
+	return fmt.Sprintf("%s%sExpires=%d&Signature=%s&Key-Pair-Id=%s",
+		rawURL, querySeparator(rawURL), expires.Unix(), encoded, url.QueryEscape(s.keyPairID)), nil
+}
+
+// --- Cloudflare ---
+
+// cloudflareSigner produces tokens for a WAF rule using
+// is_timed_hmac_valid_v0(secret, http.request.uri, lifetime,
+// http.request.timestamp.sec, len("?verify=")): an HMAC-SHA256 of the path
+// and the signing time. The token records when it was signed, not when it
+// expires, so the rule's lifetime must equal CDN_URL_TTL_HOURS for
+// Cloudflare and metadata.file_cdn_urls to agree on expiry.
+type cloudflareSigner struct {
+	secret []byte
+	param  string
+}
+
+func (s *cloudflareSigner) Name() string { return "cloudflare" }
+
+func (s *cloudflareSigner) Sign(rawURL string, signedAt, expires time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parse url: %w", err)
+	}
+	timestamp := fmt.Sprint(signedAt.Unix())
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(u.EscapedPath() + timestamp))
+	token := timestamp + "-" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return rawURL + querySeparator(rawURL) + s.param + "=" + url.QueryEscape(token), nil
+}
+
+func querySeparator(rawURL string) string {
+	if strings.Contains(rawURL, "?") {
+		return "&"
+	}
+	return "?"
+}
+
+// ============================================================================
+// Storing signed URLs
+// ============================================================================
+
+// CDNURLs signs thumbnail URLs and stores them in metadata.file_cdn_urls
+type CDNURLs struct {
+	signer  CDNSigner
+	baseURL string
+	bucket  string
+	ttl     time.Duration
+}
+
+// newCDNURLs returns nil when signing is off
+func newCDNURLs(cfg CDNConfig) (*CDNURLs, error) {
+	signer, err := newCDNSigner(cfg)
+	if err != nil || signer == nil {
+		return nil, err
+	}
+	return &CDNURLs{signer: signer, baseURL: cfg.BaseURL, bucket: cfg.Bucket, ttl: cfg.TTL}, nil
+}
+
+// Serves reports whether the CDN fronts bucket
+func (c *CDNURLs) Serves(bucket string) bool {
+	return c != nil && bucket == c.bucket
+}
+
+// objectURL is the unsigned CDN URL of an object key
+func (c *CDNURLs) objectURL(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return c.baseURL + "/" + strings.Join(segments, "/")
+}
+
+// cdnFileURLs is one metadata.file_cdn_urls row
+type cdnFileURLs struct {
+	FileID               string
+	Small, Medium, Large *string
+	SignedAt, ExpiresAt  time.Time
+}
+
+// sign signs the URL of each thumbnail key that is set
+func (c *CDNURLs) sign(fileID string, small, medium, large *string, now time.Time) (cdnFileURLs, error) {
+	row := cdnFileURLs{FileID: fileID, SignedAt: now, ExpiresAt: now.Add(c.ttl)}
+	for _, pair := range []struct {
+		key *string
+		url **string
+	}{{small, &row.Small}, {medium, &row.Medium}, {large, &row.Large}} {
+		if pair.key == nil || *pair.key == "" {
+			continue
+		}
+		signed, err := c.signer.Sign(c.objectURL(*pair.key), row.SignedAt, row.ExpiresAt)
+		if err != nil {
+			return row, err
+		}
+		*pair.url = &signed
+	}
+	return row, nil
+}
+
+// dbExecer is satisfied by *pgxpool.Pool and pgx.Tx
+type dbExecer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// store upserts signed URL rows
+func (c *CDNURLs) store(ctx context.Context, db dbExecer, rows []cdnFileURLs) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	ids := make([]string, len(rows))
+	small, medium, large := make([]*string, len(rows)), make([]*string, len(rows)), make([]*string, len(rows))
+	signedAt, expiresAt := make([]time.Time, len(rows)), make([]time.Time, len(rows))
+	for i, r := range rows {
+		ids[i], small[i], medium[i], large[i], signedAt[i], expiresAt[i] = r.FileID, r.Small, r.Medium, r.Large, r.SignedAt, r.ExpiresAt
+	}
+	_, err := db.Exec(ctx, `
+		INSERT INTO metadata.file_cdn_urls
+		       (file_id, thumbnail_small_url, thumbnail_medium_url, thumbnail_large_url, signed_at, expires_at)
+		SELECT * FROM unnest($1::uuid[], $2::text[], $3::text[], $4::text[], $5::timestamptz[], $6::timestamptz[])
+		ON CONFLICT (file_id) DO UPDATE
+		SET thumbnail_small_url = EXCLUDED.thumbnail_small_url,
+		    thumbnail_medium_url = EXCLUDED.thumbnail_medium_url,
+		    thumbnail_large_url = EXCLUDED.thumbnail_large_url,
+		    signed_at = EXCLUDED.signed_at,
+		    expires_at = EXCLUDED.expires_at
+	`, ids, small, medium, large, signedAt, expiresAt)
+	return err
+}
+
+// SignFile signs and stores the URLs of one file's thumbnails
+func (c *CDNURLs) SignFile(ctx context.Context, db dbExecer, fileID string, thumbnailKeys map[string]string) error {
+	key := func(size string) *string {
+		if k, ok := thumbnailKeys[thumbnailKeyColumn(size)]; ok {
+			return &k
+		}
+		return nil
+	}
+	row, err := c.sign(fileID, key("small"), key("medium"), key("large"), time.Now())
+	if err != nil {
+		return err
+	}
+	return c.store(ctx, db, []cdnFileURLs{row})
+}
+
+// ============================================================================
+// Maintenance Task: CDN URL Refresh
+// ============================================================================
+
+// CDNURLRefreshTask re-signs URLs before they expire
+type CDNURLRefreshTask struct {
+	dbPool *pgxpool.Pool
+	cdn    *CDNURLs
+}
+
+// MaintenanceTask declares the task with its default schedule: four runs per
+// URL lifetime, so a URL read from the database has at least a quarter of
+// its lifetime left
+func (t *CDNURLRefreshTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "cdn_url_refresh",
+		Description: "Re-sign thumbnail CDN URLs past half their lifetime and sign files without any",
+		Interval:    max(t.cdn.ttl/4, 5*time.Minute),
+		Jitter:      time.Minute,
+		Run:         t.runRefresh,
+	}
+}
+
+func (t *CDNURLRefreshTask) runRefresh(ctx context.Context) (string, error) {
+	total := 0
+	for {
+		now := time.Now()
+		rows, err := t.dbPool.Query(ctx, `
+			SELECT f.id::text, f.s3_thumbnail_small_key, f.s3_thumbnail_medium_key, f.s3_thumbnail_large_key
+			FROM metadata.files f
+			LEFT JOIN metadata.file_cdn_urls c ON c.file_id = f.id
+			WHERE f.thumbnail_status = 'completed'
+			  AND f.s3_bucket = $1
+			  AND (c.file_id IS NULL OR c.expires_at < $2)
+			ORDER BY c.expires_at NULLS FIRST
+			LIMIT $3
+		`, t.cdn.bucket, now.Add(t.cdn.ttl/2), cdnURLRefreshBatchSize)
+		if err != nil {
+			return "", fmt.Errorf("failed to find URLs to sign: %w", err)
+		}
+		batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (cdnFileURLs, error) {
+			var id string
+			var small, medium, large *string
+			if err := row.Scan(&id, &small, &medium, &large); err != nil {
+				return cdnFileURLs{}, err
+			}
+			return t.cdn.sign(id, small, medium, large, now)
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to sign URLs: %w", err)
+		}
+		if err := t.cdn.store(ctx, t.dbPool, batch); err != nil {
+			return "", fmt.Errorf("failed to store signed URLs: %w", err)
+		}
+		total += len(batch)
+		// Signed rows expire after the threshold, so the next query moves on
+		if len(batch) < cdnURLRefreshBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("[CDN] Signed thumbnail URLs for %d files", total)
+	}
+	return fmt.Sprintf("Signed URLs for %d files", total), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewCDNSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	if s, err := newCDNSigner(CDNConfig{}); s != nil || err != nil {
+		t.Errorf("off: got %v, %v", s, err)
+	}
+
+	base := CDNConfig{BaseURL: "https://cdn.test", SigningKey: keyPEM, KeyPairID: "K2JCJMDEHXQW5F"}
+	for _, signer := range []string{"cloudfront", "cloudflare"} {
+		cfg := base
+		cfg.Signer = signer
+		if s, err := newCDNSigner(cfg); err != nil || s.Name() != signer {
+			t.Errorf("%s: got %v, %v", signer, s, err)
+		}
+	}
+
+	invalid := []CDNConfig{
+		{Signer: "cloudfront", SigningKey: keyPEM, KeyPairID: "K"},                           // no base URL
+		{Signer: "cloudfront", BaseURL: "https://cdn.test", KeyPairID: "K"},                  // no key
+		{Signer: "cloudfront", BaseURL: "https://cdn.test", SigningKey: keyPEM},              // no key pair ID
+		{Signer: "cloudfront", BaseURL: "https://cdn.test", SigningKey: "x", KeyPairID: "K"}, // not PEM
+		{Signer: "akamai", BaseURL: "https://cdn.test", SigningKey: "x"},
+	}
+	for _, cfg := range invalid {
+		if _, err := newCDNSigner(cfg); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
+
+func TestCloudFrontSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &cloudFrontSigner{keyPairID: "K2JCJMDEHXQW5F", key: key}
+	expires := time.Unix(1767225600, 0)
+	raw := "https://d111.cloudfront.net/issues/42/f1/thumb-small.jpg"
+
+	signed, err := s.Sign(raw, expires.Add(-time.Hour), expires)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	u, _ := url.Parse(signed)
+	q := u.Query()
+	if q.Get("Expires") != "1767225600" || q.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" {
+		t.Errorf("query = %v", q)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(q.Get("Signature")))
+	if err != nil {
+		t.Fatalf("signature is not CloudFront base64: %v", err)
+	}
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":1767225600}}}]}`, raw)
+	digest := sha1.Sum([]byte(policy))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature); err != nil {
+		t.Errorf("signature does not verify against the canned policy: %v", err)
+	}
+}
+
+func TestCloudflareSigner(t *testing.T) {
+	s := &cloudflareSigner{secret: []byte("mysecrettoken"), param: "verify"}
+	signedAt := time.Unix(1484063137, 0)
+
+	signed, err := s.Sign("https://cdn.example.org/images/cat%20photo.jpg", signedAt, signedAt.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	u, _ := url.Parse(signed)
+	timestamp, mac, ok := strings.Cut(u.Query().Get("verify"), "-")
+	if !ok || timestamp != "1484063137" {
+		t.Fatalf("token = %q, want <signed at>-<mac>", u.Query().Get("verify"))
+	}
+	want := hmac.New(sha256.New, []byte("mysecrettoken"))
+	want.Write([]byte("/images/cat%20photo.jpg1484063137"))
+	if mac != base64.StdEncoding.EncodeToString(want.Sum(nil)) {
+		t.Errorf("mac = %q, want HMAC-SHA256 of the escaped path and timestamp", mac)
+	}
+}
+
+func TestCDNURLsSign(t *testing.T) {
+	c := &CDNURLs{
+		signer:  &cloudflareSigner{secret: []byte("s"), param: "verify"},
+		baseURL: "https://cdn.test",
+		bucket:  "civic-os-files",
+		ttl:     24 * time.Hour,
+	}
+	if !c.Serves("civic-os-files") || c.Serves("archive") || (*CDNURLs)(nil).Serves("civic-os-files") {
+		t.Error("Serves() should only match the configured bucket")
+	}
+
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	small, medium := "issues/42/f1/thumb-small.jpg", "issues/42/f1/my photo.png"
+	row, err := c.sign("f1", &small, &medium, nil, now)
+	if err != nil {
+		t.Fatalf("sign() error = %v", err)
+	}
+	if !row.ExpiresAt.Equal(now.Add(24*time.Hour)) || row.Large != nil {
+		t.Errorf("row = %+v", row)
+	}
+	if row.Small == nil || !strings.HasPrefix(*row.Small, "https://cdn.test/issues/42/f1/thumb-small.jpg?verify=") {
+		t.Errorf("small = %v", row.Small)
+	}
+	if row.Medium == nil || !strings.HasPrefix(*row.Medium, "https://cdn.test/issues/42/f1/my%20photo.png?verify=") {
+		t.Errorf("medium = %v, want the key path-escaped", row.Medium)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// Config File and SIGHUP Reload
+//
+// A process's environment can't change after it starts, so settings that can
+// be reloaded come from an optional env-style file (WORKER_CONFIG_FILE,
+// KEY=VALUE per line). At startup the file's values override the container
+// environment. On SIGHUP the file is read again: reloadable settings take
+// effect at once, and any other changed key is logged as needing a restart.
+// Removing a key from the file doesn't unset it until the next restart.
+// ============================================================================
+
+// reloadableConfigKeys are the settings applied on SIGHUP without a restart
+var reloadableConfigKeys = map[string]bool{
+	"DRAIN_TIMEOUT_SECONDS":        true,
+	"QUEUE_DRAIN_TIMEOUTS":         true,
+	"MEMORY_WATERMARK_MB":          true,
+	"MEMORY_THROTTLED_CONCURRENCY": true,
+	"JOB_RATE_LIMITS":              true,
+}
+
+// readConfigFile parses KEY=VALUE lines. Blank lines, # comments and an
+// "export " prefix are ignored, and matching surrounding quotes are removed.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// applyConfigFile copies the file's values into the environment and returns
+// the keys whose value changed, sorted
+func applyConfigFile(path string) ([]string, error) {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for key, value := range values {
+		if current, ok := os.LookupEnv(key); ok && current == value {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return nil, fmt.Errorf("set %s: %w", key, err)
+		}
+		changed = append(changed, key)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// ConfigReloader re-reads WORKER_CONFIG_FILE on SIGHUP and applies the
+// reloadable settings to the running components
+type ConfigReloader struct {
+	path        string
+	drainer     *JobDrainer
+	memoryGuard *MemoryGuard // nil when the guard is disabled
+	rateLimiter *JobRateLimiter
+}
+
+// Reload applies the config file. Errors are logged; the running config is
+// kept.
+func (r *ConfigReloader) Reload() {
+	if r.path == "" {
+		log.Println("[Reload] SIGHUP received, but WORKER_CONFIG_FILE is not set; nothing to reload")
+		return
+	}
+
+	changed, err := applyConfigFile(r.path)
+	if err != nil {
+		log.Printf("[Reload] Failed to read %s, keeping current config: %v", r.path, err)
+		return
+	}
+	if len(changed) == 0 {
+		log.Printf("[Reload] %s unchanged", r.path)
+		return
+	}
+
+	var applied, restart []string
+	for _, key := range changed {
+		if reloadableConfigKeys[key] {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+
+	if len(applied) > 0 {
+		r.drainer.SetConfig(drainConfigFromEnv())
+		log.Printf("[Reload]   Drain timeout: %s", r.drainer.Config())
+
+		watermark := memoryWatermark(getEnvInt("MEMORY_WATERMARK_MB", -1))
+		concurrency := getEnvInt("MEMORY_THROTTLED_CONCURRENCY", 1)
+		switch {
+		case r.memoryGuard == nil && watermark > 0:
+			restart = append(restart, "MEMORY_WATERMARK_MB (enabling the memory guard)")
+		case r.memoryGuard != nil && watermark == 0:
+			restart = append(restart, "MEMORY_WATERMARK_MB (disabling the memory guard)")
+		case r.memoryGuard != nil:
+			r.memoryGuard.SetLimits(watermark, concurrency)
+			log.Printf("[Reload]   Memory guard: watermark %s, %d heavy job(s) at a time above it",
+				formatMB(watermark), concurrency)
+		}
+		if r.rateLimiter != nil {
+			r.rateLimiter.SetLimits(jobRateLimitsFromEnv())
+			log.Printf("[Reload]   Job rate limits: %s", formatRateLimits(r.rateLimiter.Limits()))
+		}
+		log.Printf("[Reload] ✓ Applied %s", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		log.Printf("[Reload] ⚠ Changed but only applied on restart: %s", strings.Join(restart, ", "))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeTestConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "worker.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfigFile(t *testing.T) {
+	path := writeTestConfigFile(t, `
+# Drain settings
+DRAIN_TIMEOUT_SECONDS=60
+export QUEUE_DRAIN_TIMEOUTS="thumbnails=120"
+MEMORY_WATERMARK_MB = '900'
+EMPTY=
+`)
+	got, err := readConfigFile(path)
+	if err != nil {
+		t.Fatalf("readConfigFile: %v", err)
+	}
+	want := map[string]string{
+		"DRAIN_TIMEOUT_SECONDS": "60",
+		"QUEUE_DRAIN_TIMEOUTS":  "thumbnails=120",
+		"MEMORY_WATERMARK_MB":   "900",
+		"EMPTY":                 "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readConfigFile = %v, want %v", got, want)
+	}
+
+	if _, err := readConfigFile(writeTestConfigFile(t, "NOT A SETTING\n")); err == nil {
+		t.Error("expected an error for a line without =")
+	}
+}
+
+func TestApplyConfigFile_ReturnsChangedKeys(t *testing.T) {
+	t.Setenv("DRAIN_TIMEOUT_SECONDS", "30")
+	t.Setenv("QUEUE_DRAIN_TIMEOUTS", "")
+	path := writeTestConfigFile(t, "DRAIN_TIMEOUT_SECONDS=30\nQUEUE_DRAIN_TIMEOUTS=thumbnails=90\n")
+
+	changed, err := applyConfigFile(path)
+	if err != nil {
+		t.Fatalf("applyConfigFile: %v", err)
+	}
+	if want := []string{"QUEUE_DRAIN_TIMEOUTS"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+}
+
+func TestConfigReloader_AppliesDrainTimeouts(t *testing.T) {
+	t.Setenv("DRAIN_TIMEOUT_SECONDS", "30")
+	t.Setenv("QUEUE_DRAIN_TIMEOUTS", "")
+	d := NewJobDrainer(drainConfigFromEnv())
+
+	path := writeTestConfigFile(t, "QUEUE_DRAIN_TIMEOUTS=thumbnails=90\n")
+	(&ConfigReloader{path: path, drainer: d}).Reload()
+	if got := d.Config().Timeout("thumbnails"); got != 90*time.Second {
+		t.Errorf("Timeout(thumbnails) = %s, want 1m30s", got)
+	}
+}
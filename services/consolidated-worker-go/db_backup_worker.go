@@ -0,0 +1,543 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Database Backups
+//
+// Scheduled jobs with target_type 'backup' (see migration
+// v0-106-0-database-backups) run as db_backup jobs:
+//
+//   pg_dump (custom format, compressed) → pg_restore --list → age/gpg →
+//   upload to BACKUP_S3_BUCKET → HEAD to confirm → delete the oldest
+//   backups beyond backup_keep
+//
+// The bucket and the encryption keys are worker settings, so editing a
+// scheduled job can't send the database anywhere else. Encryption is to
+// public keys only: the worker can write backups but never read them back.
+// ============================================================================
+
+const (
+	defaultBackupPrefix      = "backups"
+	defaultBackupTimeoutMins = 120
+
+	// backupStderrCapture is how much of a failing command's stderr the run
+	// message keeps
+	backupStderrCapture = 2048
+)
+
+// DBBackupArgs defines the arguments for a backup run. Unique like
+// ScheduledJobHTTPArgs, so a due time only runs once.
+type DBBackupArgs struct {
+	JobID        int       `json:"job_id" river:"unique"`
+	JobName      string    `json:"job_name"`
+	ScheduledFor time.Time `json:"scheduled_for" river:"unique"`
+	TriggeredBy  string    `json:"triggered_by"` // "scheduler", "manual", "catchup"
+
+	Audit *JobAuditContext `json:"audit,omitempty"` // set when enqueued from a user request
+}
+
+// Kind returns the job type identifier for River routing
+func (DBBackupArgs) Kind() string {
+	return "db_backup"
+}
+
+// InsertOpts specifies River job insertion options
+func (DBBackupArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "scheduled_jobs",
+		MaxAttempts: 2,
+		Priority:    3,
+		UniqueOpts:  river.UniqueOpts{ByArgs: true},
+	}
+}
+
+// backupEncryption encrypts archives to age recipients or a GPG public key
+type backupEncryption struct {
+	AgeRecipients []string // BACKUP_AGE_RECIPIENTS
+	GPGKeyFile    string   // BACKUP_GPG_RECIPIENT_FILE
+}
+
+// newBackupEncryption reads the encryption settings; nil when neither is
+// set. age wins when both are.
+func newBackupEncryption(ageRecipients, gpgKeyFile string) *backupEncryption {
+	recipients := strings.FieldsFunc(ageRecipients, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t'
+	})
+	switch {
+	case len(recipients) > 0:
+		return &backupEncryption{AgeRecipients: recipients}
+	case gpgKeyFile != "":
+		return &backupEncryption{GPGKeyFile: gpgKeyFile}
+	}
+	return nil
+}
+
+// Method is "age" or "gpg"
+func (e *backupEncryption) Method() string {
+	if len(e.AgeRecipients) > 0 {
+		return "age"
+	}
+	return "gpg"
+}
+
+// command returns the program and arguments that encrypt stdin to stdout.
+// GPG gets a throwaway home directory so nothing is read from or left in
+// the worker's keyring.
+func (e *backupEncryption) command(tempDir string) (string, []string) {
+	if e.Method() == "age" {
+		args := []string{"--encrypt"}
+		for _, recipient := range e.AgeRecipients {
+			args = append(args, "--recipient", recipient)
+		}
+		return "age", args
+	}
+	return "gpg", []string{
+		"--batch", "--no-tty", "--quiet",
+		"--homedir", filepath.Join(tempDir, "gnupg"),
+		"--trust-model", "always",
+		"--recipient-file", e.GPGKeyFile,
+		"--output", "-",
+		"--encrypt",
+	}
+}
+
+// DBBackupConfig holds the worker settings for backups
+type DBBackupConfig struct {
+	DatabaseURL string // BACKUP_DATABASE_URL, default DATABASE_URL
+	Bucket      string // BACKUP_S3_BUCKET; empty = backups fail with a message
+	Prefix      string // BACKUP_S3_PREFIX
+	Encryption  *backupEncryption
+	Timeout     time.Duration // BACKUP_TIMEOUT_MINUTES
+}
+
+// backupTarget is the backup configuration of a scheduled job
+type backupTarget struct {
+	Schemas []string // nil = whole database
+	Keep    int
+}
+
+// backupResult is stored in scheduled_job_runs.details
+type backupResult struct {
+	Bucket       string   `json:"bucket"`
+	Key          string   `json:"key"`
+	Schemas      []string `json:"schemas,omitempty"`
+	Encryption   string   `json:"encryption"`
+	DumpBytes    int64    `json:"dump_bytes"`
+	SizeBytes    int64    `json:"size_bytes"`
+	SHA256       string   `json:"sha256"`
+	TOCEntries   int      `json:"toc_entries"`
+	Deleted      []string `json:"deleted,omitempty"`
+	DeleteErrors []string `json:"delete_errors,omitempty"`
+}
+
+// backupConfigError is a problem a retry can't fix (missing bucket or keys)
+type backupConfigError struct {
+	message string
+}
+
+func (e *backupConfigError) Error() string { return e.message }
+
+// backupObjectAPI is the subset of *s3.Client used to store backups
+type backupObjectAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// DBBackupWorker runs backup-target scheduled jobs
+type DBBackupWorker struct {
+	river.WorkerDefaults[DBBackupArgs]
+	dbPool   *pgxpool.Pool
+	s3Client backupObjectAPI
+	config   DBBackupConfig
+	alerts   *ScheduledJobAlerter // nil = failure alerting disabled
+}
+
+// Timeout covers the dump of a whole database
+func (w *DBBackupWorker) Timeout(*river.Job[DBBackupArgs]) time.Duration {
+	if w.config.Timeout <= 0 {
+		return defaultBackupTimeoutMins * time.Minute
+	}
+	return w.config.Timeout
+}
+
+// Work runs one backup and records the outcome as a scheduled job run
+func (w *DBBackupWorker) Work(ctx context.Context, job *river.Job[DBBackupArgs]) error {
+	startTime := time.Now()
+	args := job.Args
+
+	log.Printf("[Job %d] Backing up for scheduled job '%s' (scheduled_for: %s, triggered_by: %s, attempt %d/%d)",
+		job.ID, args.JobName, args.ScheduledFor.Format(time.RFC3339), args.TriggeredBy, job.Attempt, job.MaxAttempts)
+
+	var target backupTarget
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT backup_schemas, backup_keep
+		FROM metadata.scheduled_jobs
+		WHERE id = $1 AND target_type = 'backup'
+	`, args.JobID).Scan(&target.Schemas, &target.Keep)
+	if err != nil {
+		return fmt.Errorf("backup scheduled job %d not found: %w", args.JobID, err)
+	}
+
+	var runID int64
+	err = w.dbPool.QueryRow(ctx, `
+		INSERT INTO metadata.scheduled_job_runs (job_id, started_at, scheduled_for, triggered_by, audit_context)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, args.JobID, startTime, args.ScheduledFor, args.TriggeredBy, args.Audit).Scan(&runID)
+	if err != nil {
+		return fmt.Errorf("failed to create run record: %w", err)
+	}
+
+	result, err := w.backup(ctx, args.JobName, target, startTime)
+
+	endTime := time.Now()
+	durationMs := int(endTime.Sub(startTime).Milliseconds())
+	updateScheduledJobLastRunAt(ctx, w.dbPool, args.JobID, startTime)
+
+	if err != nil {
+		log.Printf("[Job %d] ✗ Backup '%s' failed: %v", job.ID, args.JobName, err)
+		w.recordRun(ctx, job.ID, runID, endTime, durationMs, false, err.Error(), result)
+		w.alerts.CheckFailureStreak(ctx, job.ID, args.JobID, args.JobName, "database backup", args.ScheduledFor, runID, err.Error())
+		var configErr *backupConfigError
+		if errors.As(err, &configErr) {
+			return nil
+		}
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	message := fmt.Sprintf("Backup uploaded to s3://%s/%s (%s, %d archive entries)",
+		result.Bucket, result.Key, formatBackupSize(result.SizeBytes), result.TOCEntries)
+	if len(result.Deleted) > 0 {
+		message += fmt.Sprintf(", %d old backup(s) deleted", len(result.Deleted))
+	}
+	if len(result.DeleteErrors) > 0 {
+		message += fmt.Sprintf(", %d old backup(s) could not be deleted", len(result.DeleteErrors))
+	}
+	w.recordRun(ctx, job.ID, runID, endTime, durationMs, true, message, result)
+	log.Printf("[Job %d] ✓ %s (took %dms)", job.ID, message, durationMs)
+	return nil
+}
+
+// backup dumps, checks, encrypts, uploads and rotates. The result is
+// returned with what was done so far even when a step fails.
+func (w *DBBackupWorker) backup(ctx context.Context, jobName string, target backupTarget, now time.Time) (*backupResult, error) {
+	if w.config.Bucket == "" {
+		return nil, &backupConfigError{"BACKUP_S3_BUCKET is not set"}
+	}
+	if w.config.Encryption == nil {
+		return nil, &backupConfigError{"no backup encryption configured (set BACKUP_AGE_RECIPIENTS or BACKUP_GPG_RECIPIENT_FILE)"}
+	}
+
+	tempDir, err := os.MkdirTemp("", "civic-os-backup-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	result := &backupResult{
+		Bucket:     w.config.Bucket,
+		Schemas:    target.Schemas,
+		Encryption: w.config.Encryption.Method(),
+	}
+
+	// 1. Dump
+	dumpPath := filepath.Join(tempDir, "database.dump")
+	dsn, env, err := backupConnection(w.config.DatabaseURL)
+	if err != nil {
+		return result, &backupConfigError{err.Error()}
+	}
+	if _, err := runBackupCommand(ctx, nil, nil, env, "pg_dump", pgDumpArgs(dsn, target.Schemas, dumpPath)...); err != nil {
+		return result, fmt.Errorf("pg_dump failed: %w", err)
+	}
+	if info, err := os.Stat(dumpPath); err == nil {
+		result.DumpBytes = info.Size()
+	}
+
+	// 2. Check the archive reads back
+	listing, err := runBackupCommand(ctx, nil, nil, nil, "pg_restore", "--list", dumpPath)
+	if err != nil {
+		return result, fmt.Errorf("archive check failed: pg_restore --list: %w", err)
+	}
+	result.TOCEntries = countTOCEntries(listing)
+	if result.TOCEntries == 0 {
+		return result, fmt.Errorf("archive check failed: the dump lists no objects")
+	}
+
+	// 3. Encrypt
+	encryptedPath := dumpPath + "." + result.Encryption
+	if err := w.encrypt(ctx, tempDir, dumpPath, encryptedPath); err != nil {
+		return result, err
+	}
+	encrypted, err := os.Open(encryptedPath)
+	if err != nil {
+		return result, fmt.Errorf("open encrypted archive: %w", err)
+	}
+	defer encrypted.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, encrypted)
+	if err != nil {
+		return result, fmt.Errorf("hash encrypted archive: %w", err)
+	}
+	if _, err := encrypted.Seek(0, io.SeekStart); err != nil {
+		return result, fmt.Errorf("rewind encrypted archive: %w", err)
+	}
+	result.SizeBytes = size
+	result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	// 4. Upload and confirm
+	result.Key = backupObjectKey(w.config.Prefix, jobName, now, result.Encryption)
+	// A dump can take longer than S3_TRANSFER_TIMEOUT_SECONDS to upload; the
+	// job's BACKUP_TIMEOUT_MINUTES deadline bounds it instead
+	_, err = w.s3Client.PutObject(withoutS3Timeout(ctx), &s3.PutObjectInput{
+		Bucket:        aws.String(w.config.Bucket),
+		Key:           aws.String(result.Key),
+		Body:          encrypted,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String("application/octet-stream"),
+		Metadata: map[string]string{
+			"sha256":      result.SHA256,
+			"dump-bytes":  fmt.Sprint(result.DumpBytes),
+			"toc-entries": fmt.Sprint(result.TOCEntries),
+		},
+	})
+	if err != nil {
+		return result, fmt.Errorf("upload failed: %w", err)
+	}
+	head, err := w.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(w.config.Bucket),
+		Key:    aws.String(result.Key),
+	})
+	if err != nil {
+		return result, fmt.Errorf("upload check failed: %w", err)
+	}
+	if stored := aws.ToInt64(head.ContentLength); stored != size {
+		return result, fmt.Errorf("upload check failed: stored object is %d bytes, expected %d", stored, size)
+	}
+
+	// 5. Rotate; a failed delete is reported but doesn't fail the backup
+	result.Deleted, result.DeleteErrors = w.rotate(ctx, jobName, target.Keep)
+	return result, nil
+}
+
+// encrypt pipes the dump through age or gpg into encryptedPath
+func (w *DBBackupWorker) encrypt(ctx context.Context, tempDir, dumpPath, encryptedPath string) error {
+	in, err := os.Open(dumpPath)
+	if err != nil {
+		return fmt.Errorf("open dump: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(encryptedPath)
+	if err != nil {
+		return fmt.Errorf("create encrypted archive: %w", err)
+	}
+	defer out.Close()
+
+	if w.config.Encryption.Method() == "gpg" {
+		if err := os.Mkdir(filepath.Join(tempDir, "gnupg"), 0o700); err != nil {
+			return fmt.Errorf("create gpg home: %w", err)
+		}
+	}
+	name, args := w.config.Encryption.command(tempDir)
+	if _, err := runBackupCommand(ctx, in, out, nil, name, args...); err != nil {
+		return fmt.Errorf("encryption failed: %s: %w", name, err)
+	}
+	return out.Close()
+}
+
+// rotate deletes this job's backups beyond the newest keep
+func (w *DBBackupWorker) rotate(ctx context.Context, jobName string, keep int) ([]string, []string) {
+	prefix := backupJobPrefix(w.config.Prefix, jobName)
+	var keys, failed []string
+
+	paginator := s3.NewListObjectsV2Paginator(w.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(w.config.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("list %s: %v", prefix, err)}
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+	}
+
+	deleted, errs := deleteObjectsBatch(ctx, w.s3Client, w.config.Bucket, expiredBackupKeys(keys, prefix, jobName, keep))
+	for key, err := range errs {
+		failed = append(failed, fmt.Sprintf("%s: %v", key, err))
+	}
+	slices.Sort(failed)
+	return deleted, failed
+}
+
+// recordRun updates the run record with the backup outcome
+func (w *DBBackupWorker) recordRun(ctx context.Context, jobID int64, runID int64, endTime time.Time, durationMs int, success bool, message string, result *backupResult) {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.scheduled_job_runs
+		SET completed_at = $1, duration_ms = $2, success = $3, message = $4, details = $5
+		WHERE id = $6
+	`, endTime, durationMs, success, message, result, runID)
+	if err != nil {
+		log.Printf("[Job %d] Failed to update run record: %v", jobID, err)
+	}
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// pgDumpArgs builds the pg_dump command line: custom format (compressed,
+// restorable table by table), optionally limited to some schemas
+func pgDumpArgs(dsn string, schemas []string, path string) []string {
+	args := []string{
+		"--format=custom",
+		"--compress=6",
+		"--no-password",
+		"--file=" + path,
+		"--dbname=" + dsn,
+	}
+	for _, schema := range schemas {
+		args = append(args, "--schema="+schema)
+	}
+	return args
+}
+
+// backupConnection moves the password of a postgres:// URL into PGPASSWORD,
+// so it doesn't show up in the process list. Keyword/value strings are
+// passed through as they are.
+func backupConnection(databaseURL string) (string, []string, error) {
+	if databaseURL == "" {
+		return "", nil, fmt.Errorf("no database URL for backups (set BACKUP_DATABASE_URL)")
+	}
+	if !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") {
+		return databaseURL, nil, nil
+	}
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid backup database URL: %v", err)
+	}
+	var env []string
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			env = append(env, "PGPASSWORD="+password)
+			u.User = url.User(u.User.Username())
+		}
+	}
+	return u.String(), env, nil
+}
+
+// runBackupCommand runs a command with the worker's environment plus env,
+// returning stdout when no writer is given. On failure the error carries
+// the end of stderr.
+func runBackupCommand(ctx context.Context, stdin io.Reader, stdout io.Writer, env []string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+	var captured, stderr bytes.Buffer
+	cmd.Stdout = &captured
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > backupStderrCapture {
+			message = "…" + message[len(message)-backupStderrCapture:]
+		}
+		if message == "" {
+			return "", err
+		}
+		return "", fmt.Errorf("%v: %s", err, message)
+	}
+	return captured.String(), nil
+}
+
+// countTOCEntries counts the objects pg_restore --list reports; comment
+// lines start with ';'
+func countTOCEntries(listing string) int {
+	count := 0
+	for _, line := range strings.Split(listing, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, ";") {
+			count++
+		}
+	}
+	return count
+}
+
+// backupJobPrefix is the key prefix of one scheduled job's backups
+func backupJobPrefix(prefix, jobName string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return jobName + "/"
+	}
+	return prefix + "/" + jobName + "/"
+}
+
+// backupObjectKey names a backup: <prefix>/<job>/<job>-20260102T030000Z.dump.age.
+// Timestamps sort in time order, which is what rotation relies on.
+func backupObjectKey(prefix, jobName string, at time.Time, encryption string) string {
+	return fmt.Sprintf("%s%s-%s.dump.%s", backupJobPrefix(prefix, jobName), jobName,
+		at.UTC().Format("20060102T150405Z"), encryption)
+}
+
+var backupKeyTimestamp = regexp.MustCompile(`^-\d{8}T\d{6}Z\.dump\.(age|gpg)$`)
+
+// expiredBackupKeys returns the keys of this job's backups beyond the newest
+// keep. Other objects under the prefix are never touched.
+func expiredBackupKeys(keys []string, prefix, jobName string, keep int) []string {
+	var backups []string
+	for _, key := range keys {
+		if rest, ok := strings.CutPrefix(key, prefix+jobName); ok && backupKeyTimestamp.MatchString(rest) {
+			backups = append(backups, key)
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+	slices.Sort(backups)
+	return backups[:len(backups)-keep]
+}
+
+// formatBackupSize formats a byte count for run messages
+func formatBackupSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestBackupObjectKey(t *testing.T) {
+	at := time.Date(2026, 3, 4, 5, 6, 7, 0, time.FixedZone("EST", -5*3600))
+	tests := []struct {
+		prefix, want string
+	}{
+		{"backups", "backups/nightly/nightly-20260304T100607Z.dump.age"},
+		{"/backups/", "backups/nightly/nightly-20260304T100607Z.dump.age"},
+		{"", "nightly/nightly-20260304T100607Z.dump.age"},
+	}
+	for _, tt := range tests {
+		if got := backupObjectKey(tt.prefix, "nightly", at, "age"); got != tt.want {
+			t.Errorf("backupObjectKey(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestExpiredBackupKeys(t *testing.T) {
+	keys := []string{
+		"backups/nightly/nightly-20260103T020000Z.dump.age",
+		"backups/nightly/nightly-20260101T020000Z.dump.age",
+		"backups/nightly/nightly-20260104T020000Z.dump.gpg",
+		"backups/nightly/nightly-20260102T020000Z.dump.age",
+		"backups/nightly/README.txt",
+		"backups/nightly/nightly-weekly-20260101T020000Z.dump.age",
+	}
+	got := expiredBackupKeys(keys, "backups/nightly/", "nightly", 2)
+	want := []string{
+		"backups/nightly/nightly-20260101T020000Z.dump.age",
+		"backups/nightly/nightly-20260102T020000Z.dump.age",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expired = %v, want %v (oldest first, other objects untouched)", got, want)
+	}
+	if got := expiredBackupKeys(keys, "backups/nightly/", "nightly", 4); got != nil {
+		t.Errorf("keep 4: expired = %v, want none", got)
+	}
+}
+
+func TestPgDumpArgs(t *testing.T) {
+	args := pgDumpArgs("postgres://backup@db/civic_os", []string{"public", "metadata"}, "/tmp/x.dump")
+	want := []string{
+		"--format=custom", "--compress=6", "--no-password", "--file=/tmp/x.dump",
+		"--dbname=postgres://backup@db/civic_os", "--schema=public", "--schema=metadata",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestBackupConnection(t *testing.T) {
+	dsn, env, err := backupConnection("postgres://backup:s3cr%40t@db:5432/civic_os?sslmode=require")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn != "postgres://backup@db:5432/civic_os?sslmode=require" {
+		t.Errorf("dsn = %q, want the password removed", dsn)
+	}
+	if !reflect.DeepEqual(env, []string{"PGPASSWORD=s3cr@t"}) {
+		t.Errorf("env = %v", env)
+	}
+
+	dsn, env, err = backupConnection("host=db dbname=civic_os")
+	if err != nil || dsn != "host=db dbname=civic_os" || env != nil {
+		t.Errorf("keyword/value: dsn = %q, env = %v, err = %v", dsn, env, err)
+	}
+	if _, _, err := backupConnection(""); err == nil {
+		t.Error("empty URL: expected an error")
+	}
+}
+
+func TestCountTOCEntries(t *testing.T) {
+	listing := `;
+; Archive created at 2026-03-04 10:06:07 UTC
+;     dbname: civic_os
+;
+3; 2615 2200 SCHEMA - public pg_database_owner
+215; 1259 16385 TABLE public issues postgres
+3390; 0 16385 TABLE DATA public issues postgres
+`
+	if got := countTOCEntries(listing); got != 3 {
+		t.Errorf("countTOCEntries = %d, want 3", got)
+	}
+}
+
+func TestBackupEncryption(t *testing.T) {
+	if newBackupEncryption("", "") != nil {
+		t.Error("expected no encryption when nothing is configured")
+	}
+
+	e := newBackupEncryption("age1aaa, age1bbb", "/keys/backup.asc")
+	name, args := e.command("/tmp/b")
+	if e.Method() != "age" || name != "age" ||
+		!reflect.DeepEqual(args, []string{"--encrypt", "--recipient", "age1aaa", "--recipient", "age1bbb"}) {
+		t.Errorf("age: %s %v", name, args)
+	}
+
+	e = newBackupEncryption("", "/keys/backup.asc")
+	name, args = e.command("/tmp/b")
+	if e.Method() != "gpg" || name != "gpg" {
+		t.Errorf("gpg: method %s, command %s", e.Method(), name)
+	}
+	if !slices.Contains(args, "/keys/backup.asc") || !slices.Contains(args, "/tmp/b/gnupg") {
+		t.Errorf("gpg args = %v, want the key file and a throwaway home", args)
+	}
+}
+
+// fakeBackupAPI lists the given keys and records deletes
+type fakeBackupAPI struct {
+	keys      []string
+	deleted   []string
+	failOnKey string
+}
+
+func (f *fakeBackupAPI) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeBackupAPI) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (f *fakeBackupAPI) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out := &s3.ListObjectsV2Output{}
+	for _, key := range f.keys {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeBackupAPI) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	out := &s3.DeleteObjectsOutput{}
+	for _, object := range params.Delete.Objects {
+		if aws.ToString(object.Key) == f.failOnKey {
+			out.Errors = append(out.Errors, types.Error{Key: object.Key, Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")})
+			continue
+		}
+		f.deleted = append(f.deleted, aws.ToString(object.Key))
+	}
+	return out, nil
+}
+
+func TestDBBackupRotate(t *testing.T) {
+	api := &fakeBackupAPI{
+		keys: []string{
+			"backups/nightly/nightly-20260101T020000Z.dump.age",
+			"backups/nightly/nightly-20260102T020000Z.dump.age",
+			"backups/nightly/nightly-20260103T020000Z.dump.age",
+			"backups/nightly/nightly-20260104T020000Z.dump.age",
+			"backups/weekly/weekly-20251201T020000Z.dump.age",
+		},
+		failOnKey: "backups/nightly/nightly-20260102T020000Z.dump.age",
+	}
+	w := &DBBackupWorker{s3Client: api, config: DBBackupConfig{Bucket: "backups-bucket", Prefix: "backups"}}
+
+	deleted, failed := w.rotate(context.Background(), "nightly", 2)
+	if !reflect.DeepEqual(deleted, []string{"backups/nightly/nightly-20260101T020000Z.dump.age"}) {
+		t.Errorf("deleted = %v", deleted)
+	}
+	if len(failed) != 1 || !strings.Contains(failed[0], "nightly-20260102") {
+		t.Errorf("failed = %v, want the denied delete reported", failed)
+	}
+}
+
+func TestDBBackupConfigErrors(t *testing.T) {
+	w := &DBBackupWorker{config: DBBackupConfig{}}
+	_, err := w.backup(context.Background(), "nightly", backupTarget{Keep: 3}, time.Now())
+	var configErr *backupConfigError
+	if !errors.As(err, &configErr) || !strings.Contains(err.Error(), "BACKUP_S3_BUCKET") {
+		t.Errorf("no bucket: err = %v", err)
+	}
+
+	w.config.Bucket = "backups-bucket"
+	_, err = w.backup(context.Background(), "nightly", backupTarget{Keep: 3}, time.Now())
+	if !errors.As(err, &configErr) || !strings.Contains(err.Error(), "encryption") {
+		t.Errorf("no encryption: err = %v", err)
+	}
+}
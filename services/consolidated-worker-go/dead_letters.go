@@ -0,0 +1,120 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Dead Letters
+//
+// A job that uses up its attempts is discarded, and River deletes it a week
+// later. DeadLetterRecorder watches this worker's job events and, for every
+// discarded job, calls metadata.capture_job_dead_letter() (see migration
+// v0-91-0-job-dead-letters). It copies the job into metadata.job_dead_letters
+// and alerts the roles in DEAD_LETTER_NOTIFY_ROLES through the notification
+// pipeline, grouped per kind with a 15-minute cooldown.
+//
+// Events are best-effort: River drops them when a subscriber falls behind,
+// and jobs discarded by the rescuer never produce one. The dead_letter_sweep
+// maintenance task captures whatever was missed (including the payment
+// worker's jobs if its recorder is down) and sends alerts the cooldown held
+// back.
+// ============================================================================
+
+const (
+	deadLetterSweepInterval  = 5 * time.Minute
+	deadLetterSweepLookback  = 7 * 24 * time.Hour // River's discarded job retention
+	deadLetterCaptureTimeout = 10 * time.Second
+)
+
+// parseNotifyRoles splits DEAD_LETTER_NOTIFY_ROLES ("admin,ops") into role
+// keys. An empty list captures dead letters without alerting anyone.
+func parseNotifyRoles(value string) []string {
+	roles := []string{}
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// DeadLetterRecorder captures discarded jobs as they happen
+type DeadLetterRecorder struct {
+	dbPool      *pgxpool.Pool
+	notifyRoles []string
+
+	// capture records one job; defaults to captureDeadLetter (tests replace it)
+	capture func(ctx context.Context, jobID int64) error
+}
+
+// NewDeadLetterRecorder creates a recorder alerting notifyRoles
+func NewDeadLetterRecorder(dbPool *pgxpool.Pool, notifyRoles []string) *DeadLetterRecorder {
+	r := &DeadLetterRecorder{dbPool: dbPool, notifyRoles: notifyRoles}
+	r.capture = r.captureDeadLetter
+	return r
+}
+
+// deadLetterEventKinds are the River events Observe needs; a discarded job
+// arrives as a failed event with state discarded
+var deadLetterEventKinds = []river.EventKind{river.EventKindJobFailed}
+
+// Observe captures discarded jobs until events is closed. Run it in a
+// goroutine with the channel from riverClient.Subscribe.
+func (r *DeadLetterRecorder) Observe(events <-chan *river.Event) {
+	for event := range events {
+		if event.Job == nil || event.Job.State != rivertype.JobStateDiscarded {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), deadLetterCaptureTimeout)
+		if err := r.capture(ctx, event.Job.ID); err != nil {
+			log.Printf("[DeadLetter] Failed to capture discarded job %d (%s); the sweep will retry: %v",
+				event.Job.ID, event.Job.Kind, err)
+		} else {
+			log.Printf("[DeadLetter] Job %d (%s, queue %s) discarded after %d attempt(s)",
+				event.Job.ID, event.Job.Kind, event.Job.Queue, event.Job.Attempt)
+		}
+		cancel()
+	}
+}
+
+func (r *DeadLetterRecorder) captureDeadLetter(ctx context.Context, jobID int64) error {
+	_, err := r.dbPool.Exec(ctx, `SELECT metadata.capture_job_dead_letter($1, $2)`, jobID, r.notifyRoles)
+	return err
+}
+
+// MaintenanceTask declares the sweep with its default schedule
+func (r *DeadLetterRecorder) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "dead_letter_sweep",
+		Description: "Capture discarded jobs missed by the workers' event subscriptions and send dead-letter alerts held back by the cooldown",
+		Interval:    deadLetterSweepInterval,
+		Run:         r.runSweep,
+	}
+}
+
+func (r *DeadLetterRecorder) runSweep(ctx context.Context) (string, error) {
+	var captured int
+	err := r.dbPool.QueryRow(ctx,
+		`SELECT metadata.capture_missed_dead_letters($1, $2::interval)`,
+		r.notifyRoles, intervalString(deadLetterSweepLookback),
+	).Scan(&captured)
+	if err != nil {
+		return "", fmt.Errorf("capture_missed_dead_letters(): %w", err)
+	}
+	if captured == 0 {
+		return "No missed dead letters", nil
+	}
+	log.Printf("[DeadLetter] Sweep captured %d discarded job(s) missed by event subscriptions", captured)
+	return fmt.Sprintf("Captured %d missed dead letter(s)", captured), nil
+}
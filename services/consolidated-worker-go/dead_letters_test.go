@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestParseNotifyRoles(t *testing.T) {
+	if got, want := parseNotifyRoles(" admin, ops ,,"), []string{"admin", "ops"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNotifyRoles() = %v, want %v", got, want)
+	}
+	if got := parseNotifyRoles(""); got == nil || len(got) != 0 {
+		t.Errorf("parseNotifyRoles(\"\") = %#v, want an empty, non-nil list", got)
+	}
+}
+
+func TestDeadLetterRecorder_CapturesDiscardedJobsOnly(t *testing.T) {
+	var captured []int64
+	r := NewDeadLetterRecorder(nil, []string{"admin"})
+	r.capture = func(ctx context.Context, jobID int64) error {
+		captured = append(captured, jobID)
+		if jobID == 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	events := make(chan *river.Event, 4)
+	events <- &river.Event{Kind: river.EventKindJobFailed, Job: &rivertype.JobRow{ID: 1, State: rivertype.JobStateRetryable}}
+	events <- &river.Event{Kind: river.EventKindJobFailed, Job: &rivertype.JobRow{ID: 2, State: rivertype.JobStateDiscarded}}
+	events <- &river.Event{Kind: river.EventKindJobFailed, Job: &rivertype.JobRow{ID: 3, State: rivertype.JobStateDiscarded}}
+	events <- &river.Event{Kind: river.EventKindQueuePaused}
+	close(events)
+
+	r.Observe(events)
+
+	// A failed capture is logged and left to the sweep
+	if want := []int64{2, 3}; !reflect.DeepEqual(captured, want) {
+		t.Errorf("captured %v, want %v", captured, want)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DocuSignConfig holds the JWT grant credentials for a DocuSign integration.
+// The integration user must have granted consent for "signature impersonation".
+type DocuSignConfig struct {
+	IntegrationKey string // OAuth client ID
+	UserID         string // API user GUID to impersonate
+	AccountID      string // eSignature account GUID
+	PrivateKeyPEM  string // RSA private key for the integration key
+	AuthServer     string // account-d.docusign.com (demo) or account.docusign.com
+	BaseURL        string // e.g. https://demo.docusign.net/restapi
+}
+
+// DocuSignClient implements SignatureProvider using the eSignature REST API
+type DocuSignClient struct {
+	cfg        DocuSignConfig
+	privateKey *rsa.PrivateKey
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu          sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// NewDocuSignClient validates the config and parses the private key
+func NewDocuSignClient(cfg DocuSignConfig) (*DocuSignClient, error) {
+	if cfg.IntegrationKey == "" || cfg.UserID == "" || cfg.AccountID == "" || cfg.PrivateKeyPEM == "" {
+		return nil, errors.New("DOCUSIGN_INTEGRATION_KEY, DOCUSIGN_USER_ID, DOCUSIGN_ACCOUNT_ID and DOCUSIGN_PRIVATE_KEY are required")
+	}
+	if cfg.AuthServer == "" {
+		cfg.AuthServer = "account-d.docusign.com"
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "https://demo.docusign.net/restapi"
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+
+	key, err := parseRSAPrivateKey(cfg.PrivateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("DOCUSIGN_PRIVATE_KEY: %w", err)
+	}
+
+	return &DocuSignClient{
+		cfg:        cfg,
+		privateKey: key,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+		now:        time.Now,
+	}, nil
+}
+
+func (d *DocuSignClient) Name() string { return "docusign" }
+
+// Send creates an envelope with status "sent" so DocuSign emails the signer.
+// No tabs are placed: the signer uses free-form signing to add a signature
+// wherever the document asks for one.
+func (d *DocuSignClient) Send(ctx context.Context, doc SignatureDocument) (string, error) {
+	subject := doc.EmailSubject
+	if subject == "" {
+		subject = "Please sign: " + doc.FileName
+	}
+
+	envelope := map[string]any{
+		"emailSubject": subject,
+		"status":       "sent",
+		"documents": []map[string]any{{
+			"documentId":     "1",
+			"name":           doc.FileName,
+			"fileExtension":  "pdf",
+			"documentBase64": base64.StdEncoding.EncodeToString(doc.PDF),
+		}},
+		"recipients": map[string]any{
+			"signers": []map[string]any{{
+				"recipientId":  "1",
+				"routingOrder": "1",
+				"email":        doc.SignerEmail,
+				"name":         doc.SignerName,
+			}},
+		},
+		"customFields": map[string]any{
+			"textCustomFields": []map[string]any{{
+				"name":  "civic_os_request_id",
+				"value": doc.RequestID,
+				"show":  "false",
+			}},
+		},
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	var result struct {
+		EnvelopeID string `json:"envelopeId"`
+	}
+	if err := d.doJSON(ctx, "POST", "/envelopes", body, &result); err != nil {
+		return "", err
+	}
+	if result.EnvelopeID == "" {
+		return "", errors.New("DocuSign response missing envelopeId")
+	}
+	return result.EnvelopeID, nil
+}
+
+// Status maps the DocuSign envelope status onto the Envelope* states
+func (d *DocuSignClient) Status(ctx context.Context, envelopeID string) (string, error) {
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := d.doJSON(ctx, "GET", "/envelopes/"+url.PathEscape(envelopeID), nil, &result); err != nil {
+		return "", err
+	}
+
+	return docuSignEnvelopeState(result.Status)
+}
+
+// docuSignEnvelopeState maps a DocuSign envelope status, from the API or a
+// Connect webhook, onto the Envelope* states
+func docuSignEnvelopeState(status string) (string, error) {
+	switch status {
+	case "completed":
+		return EnvelopeCompleted, nil
+	case "declined":
+		return EnvelopeDeclined, nil
+	case "voided":
+		return EnvelopeVoided, nil
+	case "created", "sent", "delivered", "signed", "correct":
+		// "signed" means the signer finished but DocuSign hasn't completed
+		// the envelope yet; keep waiting for "completed"
+		return EnvelopeSent, nil
+	default:
+		return "", fmt.Errorf("unexpected DocuSign envelope status %q", status)
+	}
+}
+
+// DownloadSigned fetches all envelope documents combined into one PDF
+func (d *DocuSignClient) DownloadSigned(ctx context.Context, envelopeID string) ([]byte, error) {
+	resp, err := d.do(ctx, "GET", "/envelopes/"+url.PathEscape(envelopeID)+"/documents/combined", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed document: %w", err)
+	}
+	return data, nil
+}
+
+// doJSON performs a request and decodes the JSON response into out
+func (d *DocuSignClient) doJSON(ctx context.Context, method, path string, body []byte, out any) error {
+	resp, err := d.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode DocuSign response: %w", err)
+	}
+	return nil
+}
+
+// do performs an authenticated request against the account's API path.
+// Non-2xx responses are returned as errors with the response body.
+func (d *DocuSignClient) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	token, err := d.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/v2.1/accounts/%s%s", d.cfg.BaseURL, url.PathEscape(d.cfg.AccountID), path)
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DocuSign request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DocuSign request failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusUnauthorized {
+			// Force a fresh token on the next attempt
+			d.mu.Lock()
+			d.accessToken = ""
+			d.mu.Unlock()
+		}
+		return nil, fmt.Errorf("DocuSign %s %s returned %d: %s", method, path, resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+// token returns a cached access token, requesting a new one via JWT grant
+// when it is missing or about to expire
+func (d *DocuSignClient) token(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.accessToken != "" && d.now().Before(d.tokenExpiry) {
+		return d.accessToken, nil
+	}
+
+	assertion, err := d.jwtAssertion()
+	if err != nil {
+		return "", err
+	}
+
+	authURL := d.cfg.AuthServer
+	if !strings.HasPrefix(authURL, "http://") && !strings.HasPrefix(authURL, "https://") {
+		authURL = "https://" + authURL
+	}
+	data := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", authURL+"/oauth/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("token request returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	d.accessToken = token.AccessToken
+	// Refresh 60 seconds before expiry
+	d.tokenExpiry = d.now().Add(time.Duration(token.ExpiresIn-60) * time.Second)
+	return d.accessToken, nil
+}
+
+// jwtAssertion builds the RS256-signed JWT for the JWT bearer grant
+func (d *DocuSignClient) jwtAssertion() (string, error) {
+	now := d.now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	claims := map[string]any{
+		"iss":   d.cfg.IntegrationKey,
+		"sub":   d.cfg.UserID,
+		"aud":   strings.TrimPrefix(strings.TrimPrefix(d.cfg.AuthServer, "https://"), "http://"),
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"scope": "signature impersonation",
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, d.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey accepts PKCS#1 ("RSA PRIVATE KEY", as DocuSign and
+// CloudFront issue) or PKCS#8 ("PRIVATE KEY") PEM. Literal "\n" sequences are expanded so the
+// key can be passed through a single-line environment variable.
+func parseRSAPrivateKey(pemData string) (*rsa.PrivateKey, error) {
+	pemData = strings.ReplaceAll(pemData, `\n`, "\n")
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, errors.New("key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key must be an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestDocuSign starts a fake DocuSign auth + REST server and returns a
+// client pointed at it along with a count of token requests
+func newTestDocuSign(t *testing.T, handler http.HandlerFunc) (*DocuSignClient, *int) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			tokenRequests++
+			verifyAssertion(t, &key.PublicKey, r.FormValue("assertion"))
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "test-token", "expires_in": 3600})
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q, want bearer token", got)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewDocuSignClient(DocuSignConfig{
+		IntegrationKey: "integration-key",
+		UserID:         "user-guid",
+		AccountID:      "account-guid",
+		// Single-line form with literal \n, as passed through .env files
+		PrivateKeyPEM: strings.ReplaceAll(string(keyPEM), "\n", `\n`),
+		AuthServer:    server.URL,
+		BaseURL:       server.URL + "/restapi",
+	})
+	if err != nil {
+		t.Fatalf("NewDocuSignClient() error = %v", err)
+	}
+	return client, &tokenRequests
+}
+
+// verifyAssertion checks the JWT grant assertion signature and claims
+func verifyAssertion(t *testing.T, pub *rsa.PublicKey, assertion string) {
+	t.Helper()
+
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion has %d parts, want 3", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("assertion signature invalid: %v", err)
+	}
+
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]any
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		t.Fatalf("failed to decode claims: %v", err)
+	}
+	if claims["iss"] != "integration-key" || claims["sub"] != "user-guid" || claims["scope"] != "signature impersonation" {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+}
+
+func TestDocuSignSend(t *testing.T) {
+	client, tokenRequests := newTestDocuSign(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/restapi/v2.1/accounts/account-guid/envelopes" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		var envelope struct {
+			EmailSubject string `json:"emailSubject"`
+			Status       string `json:"status"`
+			Documents    []struct {
+				DocumentBase64 string `json:"documentBase64"`
+			} `json:"documents"`
+			Recipients struct {
+				Signers []struct {
+					Email string `json:"email"`
+					Name  string `json:"name"`
+				} `json:"signers"`
+			} `json:"recipients"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+			t.Fatalf("failed to decode envelope: %v", err)
+		}
+		if envelope.Status != "sent" || envelope.EmailSubject != "Please sign: permit.pdf" {
+			t.Errorf("envelope status/subject = %q/%q", envelope.Status, envelope.EmailSubject)
+		}
+		if len(envelope.Documents) != 1 || envelope.Documents[0].DocumentBase64 != base64.StdEncoding.EncodeToString([]byte("%PDF")) {
+			t.Errorf("unexpected documents: %+v", envelope.Documents)
+		}
+		if len(envelope.Recipients.Signers) != 1 || envelope.Recipients.Signers[0].Email != "resident@example.com" {
+			t.Errorf("unexpected signers: %+v", envelope.Recipients.Signers)
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"envelopeId": "env-123", "status": "sent"})
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		envelopeID, err := client.Send(ctx, SignatureDocument{
+			RequestID:   "req-1",
+			FileName:    "permit.pdf",
+			PDF:         []byte("%PDF"),
+			SignerEmail: "resident@example.com",
+			SignerName:  "Pat Resident",
+		})
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		if envelopeID != "env-123" {
+			t.Errorf("Send() = %q, want env-123", envelopeID)
+		}
+	}
+
+	// The access token is cached between calls
+	if *tokenRequests != 1 {
+		t.Errorf("token requests = %d, want 1", *tokenRequests)
+	}
+}
+
+func TestDocuSignStatus(t *testing.T) {
+	tests := []struct {
+		docusign string
+		want     string
+		wantErr  bool
+	}{
+		{"sent", EnvelopeSent, false},
+		{"delivered", EnvelopeSent, false},
+		{"signed", EnvelopeSent, false},
+		{"completed", EnvelopeCompleted, false},
+		{"declined", EnvelopeDeclined, false},
+		{"voided", EnvelopeVoided, false},
+		{"deleted", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.docusign, func(t *testing.T) {
+			client, _ := newTestDocuSign(t, func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]string{"status": tt.docusign})
+			})
+
+			got, err := client.Status(context.Background(), "env-123")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Status() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Status() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocuSignErrorResponse(t *testing.T) {
+	client, _ := newTestDocuSign(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errorCode":"INVALID_EMAIL_ADDRESS_FOR_RECIPIENT"}`))
+	})
+
+	_, err := client.Send(context.Background(), SignatureDocument{FileName: "a.pdf", PDF: []byte("%PDF")})
+	if err == nil || !strings.Contains(err.Error(), "INVALID_EMAIL_ADDRESS_FOR_RECIPIENT") {
+		t.Errorf("Send() error = %v, want DocuSign error body", err)
+	}
+}
+
+func TestNewDocuSignClientRequiresCredentials(t *testing.T) {
+	if _, err := NewDocuSignClient(DocuSignConfig{IntegrationKey: "key"}); err == nil {
+		t.Error("NewDocuSignClient() with missing credentials: want error")
+	}
+}
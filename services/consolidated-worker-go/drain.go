@@ -0,0 +1,326 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Graceful Job Draining
+//
+// On SIGTERM the River client stops fetching immediately and waits for
+// running jobs. JobDrainer gives each queue its own drain timeout
+// (DRAIN_TIMEOUT_SECONDS, overridden per queue by QUEUE_DRAIN_TIMEOUTS):
+// when a queue's timeout passes, its jobs' contexts are cancelled, and a job
+// that then returns an error is snoozed for zero seconds. River puts it back
+// as available without using up an attempt, so another replica (or this one
+// after the restart) picks it up at once.
+//
+// A job that ignores cancellation is still running when the hard deadline
+// (the longest queue timeout plus drainHardStopGrace) passes. Those jobs are
+// requeued directly in river_job before the process exits, rather than
+// waiting an hour for River's rescuer. Either way the drain report logs what
+// finished, what was requeued, and what had to be abandoned.
+// ============================================================================
+
+// drainHardStopGrace is how long cancelled jobs get to return before the
+// remaining ones are abandoned and requeued
+const drainHardStopGrace = 10 * time.Second
+
+// errDrainTimeout is the cancellation cause for jobs past their queue's
+// drain timeout
+var errDrainTimeout = errors.New("drain timeout reached during shutdown")
+
+// DrainConfig is how long each queue's running jobs may take to finish
+// after shutdown begins
+type DrainConfig struct {
+	Default  time.Duration
+	PerQueue map[string]time.Duration
+}
+
+// drainConfigFromEnv reads DRAIN_TIMEOUT_SECONDS (default 30) and
+// QUEUE_DRAIN_TIMEOUTS ("thumbnails=120,source_parsing=60", in seconds)
+func drainConfigFromEnv() DrainConfig {
+	cfg := DrainConfig{
+		Default:  time.Duration(max(getEnvInt("DRAIN_TIMEOUT_SECONDS", 30), 0)) * time.Second,
+		PerQueue: make(map[string]time.Duration),
+	}
+	for queue, value := range parseKeyValueList(getEnv("QUEUE_DRAIN_TIMEOUTS", "")) {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			log.Printf("⚠️  WARNING: Invalid drain timeout for queue %s in QUEUE_DRAIN_TIMEOUTS: %q, using default", queue, value)
+			continue
+		}
+		cfg.PerQueue[queue] = time.Duration(seconds) * time.Second
+	}
+	return cfg
+}
+
+// Timeout returns the drain timeout for a queue
+func (c DrainConfig) Timeout(queue string) time.Duration {
+	if timeout, ok := c.PerQueue[queue]; ok {
+		return timeout
+	}
+	return c.Default
+}
+
+// Max returns the longest drain timeout of any queue
+func (c DrainConfig) Max() time.Duration {
+	longest := c.Default
+	for _, timeout := range c.PerQueue {
+		longest = max(longest, timeout)
+	}
+	return longest
+}
+
+// String formats the config for logs, e.g. "30s (thumbnails: 2m0s)"
+func (c DrainConfig) String() string {
+	if len(c.PerQueue) == 0 {
+		return c.Default.String()
+	}
+	queues := make([]string, 0, len(c.PerQueue))
+	for queue := range c.PerQueue {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	overrides := make([]string, len(queues))
+	for i, queue := range queues {
+		overrides[i] = fmt.Sprintf("%s: %s", queue, c.PerQueue[queue])
+	}
+	return fmt.Sprintf("%s (%s)", c.Default, strings.Join(overrides, ", "))
+}
+
+// drainingJob is a running job and the means to stop it
+type drainingJob struct {
+	job     *rivertype.JobRow
+	started time.Time
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+}
+
+// DrainQueueStats counts what happened to one queue's jobs during a drain
+type DrainQueueStats struct {
+	Finished  int // Returned on their own (completed or failed as usual)
+	Requeued  int // Cancelled at the drain timeout and snoozed back to available
+	Abandoned int // Still running at the hard deadline; requeued in the database
+}
+
+// DrainReport summarizes a drain
+type DrainReport struct {
+	Duration  time.Duration
+	Queues    map[string]*DrainQueueStats
+	Abandoned []*rivertype.JobRow
+}
+
+// JobDrainer is River worker middleware that tracks running jobs so shutdown
+// can stop each queue at its own drain timeout
+type JobDrainer struct {
+	river.MiddlewareDefaults
+
+	mu           sync.Mutex
+	config       DrainConfig
+	running      map[int64]*drainingJob
+	drainStarted time.Time // Zero until BeginDrain
+	stats        map[string]*DrainQueueStats
+}
+
+// NewJobDrainer creates a drainer with the given timeouts
+func NewJobDrainer(cfg DrainConfig) *JobDrainer {
+	return &JobDrainer{
+		config:  cfg,
+		running: make(map[int64]*drainingJob),
+		stats:   make(map[string]*DrainQueueStats),
+	}
+}
+
+// Config returns the current drain timeouts
+func (d *JobDrainer) Config() DrainConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.config
+}
+
+// SetConfig replaces the drain timeouts (SIGHUP reload). It has no effect on
+// a drain already in progress.
+func (d *JobDrainer) SetConfig(cfg DrainConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.config = cfg
+}
+
+// Work implements rivertype.WorkerMiddleware
+func (d *JobDrainer) Work(ctx context.Context, job *rivertype.JobRow, doInner func(context.Context) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	entry := &drainingJob{job: job, started: time.Now(), cancel: cancel}
+	d.mu.Lock()
+	d.running[job.ID] = entry
+	if !d.drainStarted.IsZero() {
+		d.scheduleLocked(entry)
+	}
+	d.mu.Unlock()
+
+	err := doInner(ctx)
+	requeue := err != nil && errors.Is(context.Cause(ctx), errDrainTimeout)
+
+	d.mu.Lock()
+	delete(d.running, job.ID)
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	if !d.drainStarted.IsZero() {
+		stats := d.statsLocked(job.Queue)
+		if requeue {
+			stats.Requeued++
+		} else {
+			stats.Finished++
+		}
+	}
+	d.mu.Unlock()
+
+	if requeue {
+		log.Printf("[Drain] Job %d (%s) stopped at the %s drain timeout of queue %s; requeued (%v)",
+			job.ID, job.Kind, d.Config().Timeout(job.Queue), job.Queue, err)
+		return river.JobSnooze(0)
+	}
+	return err
+}
+
+// BeginDrain starts each running job's drain timeout. Call it when shutdown
+// starts, before stopping the River client.
+func (d *JobDrainer) BeginDrain() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.drainStarted.IsZero() {
+		return
+	}
+	d.drainStarted = time.Now()
+	for _, entry := range d.running {
+		d.scheduleLocked(entry)
+	}
+	log.Printf("[Drain] Draining %d running job(s); timeout %s", len(d.running), d.config)
+}
+
+// HardDeadline is how long to wait for the River client to stop: the longest
+// queue timeout plus time for cancelled jobs to return
+func (d *JobDrainer) HardDeadline() time.Duration {
+	return d.Config().Max() + drainHardStopGrace
+}
+
+// scheduleLocked cancels a job when its queue's drain timeout passes
+func (d *JobDrainer) scheduleLocked(entry *drainingJob) {
+	remaining := time.Until(d.drainStarted.Add(d.config.Timeout(entry.job.Queue)))
+	entry.timer = time.AfterFunc(max(remaining, 0), func() {
+		entry.cancel(errDrainTimeout)
+	})
+}
+
+func (d *JobDrainer) statsLocked(queue string) *DrainQueueStats {
+	stats, ok := d.stats[queue]
+	if !ok {
+		stats = &DrainQueueStats{}
+		d.stats[queue] = stats
+	}
+	return stats
+}
+
+// Report returns the drain's outcome so far. Jobs still running are counted
+// as abandoned.
+func (d *JobDrainer) Report() DrainReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	report := DrainReport{Queues: make(map[string]*DrainQueueStats, len(d.stats))}
+	if !d.drainStarted.IsZero() {
+		report.Duration = time.Since(d.drainStarted)
+	}
+	for queue, stats := range d.stats {
+		copied := *stats
+		report.Queues[queue] = &copied
+	}
+	for _, entry := range d.running {
+		report.Abandoned = append(report.Abandoned, entry.job)
+		stats, ok := report.Queues[entry.job.Queue]
+		if !ok {
+			stats = &DrainQueueStats{}
+			report.Queues[entry.job.Queue] = stats
+		}
+		stats.Abandoned++
+	}
+	sort.Slice(report.Abandoned, func(i, j int) bool { return report.Abandoned[i].ID < report.Abandoned[j].ID })
+	return report
+}
+
+// String formats the report for logs, e.g.
+// "4.2s; notifications: 5 finished; thumbnails: 1 finished, 2 requeued"
+func (r DrainReport) String() string {
+	if len(r.Queues) == 0 {
+		return fmt.Sprintf("%s; no jobs were running", r.Duration.Round(100*time.Millisecond))
+	}
+	queues := make([]string, 0, len(r.Queues))
+	for queue := range r.Queues {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+
+	parts := []string{r.Duration.Round(100 * time.Millisecond).String()}
+	for _, queue := range queues {
+		stats := r.Queues[queue]
+		var counts []string
+		if stats.Finished > 0 {
+			counts = append(counts, fmt.Sprintf("%d finished", stats.Finished))
+		}
+		if stats.Requeued > 0 {
+			counts = append(counts, fmt.Sprintf("%d requeued", stats.Requeued))
+		}
+		if stats.Abandoned > 0 {
+			counts = append(counts, fmt.Sprintf("%d abandoned", stats.Abandoned))
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", queue, strings.Join(counts, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// requeueAbandonedJobs makes jobs still marked running available again,
+// recording the shutdown as an attempt error. max_attempts is raised so the
+// interrupted attempt doesn't count, as with a snooze.
+func requeueAbandonedJobs(ctx context.Context, dbPool *pgxpool.Pool, jobs []*rivertype.JobRow) (int64, error) {
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+	ids := make([]int64, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	tag, err := dbPool.Exec(ctx, `
+		UPDATE metadata.river_job
+		SET state = 'available',
+			scheduled_at = NOW(),
+			max_attempts = max_attempts + 1,
+			errors = array_append(errors, jsonb_build_object(
+				'at', NOW(),
+				'attempt', attempt,
+				'error', 'worker shut down before the job finished; requeued',
+				'trace', ''
+			))
+		WHERE id = ANY($1) AND state = 'running'
+	`, ids)
+	if err != nil {
+		return 0, fmt.Errorf("requeue abandoned jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
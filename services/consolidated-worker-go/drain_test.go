@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestDrainConfigFromEnv(t *testing.T) {
+	t.Setenv("DRAIN_TIMEOUT_SECONDS", "45")
+	t.Setenv("QUEUE_DRAIN_TIMEOUTS", "thumbnails=120, notifications=5, broken=abc")
+
+	cfg := drainConfigFromEnv()
+	if cfg.Default != 45*time.Second {
+		t.Errorf("Default = %s, want 45s", cfg.Default)
+	}
+	if got := cfg.Timeout("thumbnails"); got != 2*time.Minute {
+		t.Errorf("Timeout(thumbnails) = %s, want 2m0s", got)
+	}
+	if got := cfg.Timeout("broken"); got != 45*time.Second {
+		t.Errorf("Timeout(broken) = %s, want the default for an invalid value", got)
+	}
+	if got := cfg.Max(); got != 2*time.Minute {
+		t.Errorf("Max() = %s, want 2m0s", got)
+	}
+	if got, want := cfg.String(), "45s (notifications: 5s, thumbnails: 2m0s)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestJobDrainer_FinishedBeforeTimeout(t *testing.T) {
+	d := NewJobDrainer(DrainConfig{Default: time.Minute})
+	job := &rivertype.JobRow{ID: 1, Kind: "send_notification", Queue: "notifications"}
+
+	// Jobs finishing before shutdown aren't part of the report
+	if err := d.Work(context.Background(), job, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Work before drain: err = %v", err)
+	}
+
+	d.BeginDrain()
+	wantErr := errors.New("smtp refused")
+	if err := d.Work(context.Background(), job, func(ctx context.Context) error { return wantErr }); err != wantErr {
+		t.Errorf("Work during drain: err = %v, want the job's own error", err)
+	}
+
+	report := d.Report()
+	stats := report.Queues["notifications"]
+	if stats == nil || stats.Finished != 1 || stats.Requeued != 0 || len(report.Abandoned) != 0 {
+		t.Errorf("report = %+v, want 1 finished", stats)
+	}
+}
+
+func TestJobDrainer_RequeuesAtTimeout(t *testing.T) {
+	d := NewJobDrainer(DrainConfig{
+		Default:  time.Minute,
+		PerQueue: map[string]time.Duration{"thumbnails": 0},
+	})
+	job := &rivertype.JobRow{ID: 7, Kind: "thumbnail_generate", Queue: "thumbnails"}
+
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- d.Work(context.Background(), job, func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-started
+
+	if got := d.Report(); len(got.Abandoned) != 1 {
+		t.Fatalf("abandoned = %d before the job returned, want 1", len(got.Abandoned))
+	}
+
+	d.BeginDrain()
+	select {
+	case err := <-result:
+		var snooze *river.JobSnoozeError
+		if !errors.As(err, &snooze) || snooze.Duration != 0 {
+			t.Errorf("err = %v, want a zero snooze", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not cancelled at its queue's drain timeout")
+	}
+
+	report := d.Report()
+	if stats := report.Queues["thumbnails"]; stats == nil || stats.Requeued != 1 || len(report.Abandoned) != 0 {
+		t.Errorf("report = %s, want 1 requeued", report)
+	}
+	if got := d.HardDeadline(); got != time.Minute+drainHardStopGrace {
+		t.Errorf("HardDeadline() = %s, want %s", got, time.Minute+drainHardStopGrace)
+	}
+}
+
+func TestDrainReport_String(t *testing.T) {
+	report := DrainReport{
+		Duration: 4210 * time.Millisecond,
+		Queues: map[string]*DrainQueueStats{
+			"thumbnails":    {Finished: 1, Requeued: 2},
+			"notifications": {Finished: 5, Abandoned: 1},
+		},
+	}
+	want := "4.2s; notifications: 5 finished, 1 abandoned; thumbnails: 1 finished, 2 requeued"
+	if got := report.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := (DrainReport{}).String(); got != "0s; no jobs were running" {
+		t.Errorf("empty String() = %q", got)
+	}
+}
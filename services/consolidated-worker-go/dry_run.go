@@ -0,0 +1,309 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Dry Run
+//
+// DRY_RUN=true makes the worker simulate its side effects instead of
+// performing them, so a staging install pointed at a copy of production data
+// can't email residents or change their accounts. Each simulated operation is
+// logged and recorded in metadata.simulated_operations, and the job carries on
+// as if it had succeeded. DRY_RUN_<CATEGORY> overrides DRY_RUN for one
+// category, e.g. DRY_RUN=true with DRY_RUN_STORAGE=false still deletes files.
+//
+//	email     SMTP sends (notifications, send_email, summaries)
+//	sms       Telnyx sends
+//	identity  Keycloak / authentik changes (reads still reach the provider)
+//	storage   S3 object deletes
+//
+// The payment worker has its own DRY_RUN for provider calls that move money.
+// ============================================================================
+
+// Dry-run categories
+const (
+	dryRunEmail    = "email"
+	dryRunSMS      = "sms"
+	dryRunIdentity = "identity"
+	dryRunStorage  = "storage"
+)
+
+var dryRunCategories = []string{dryRunEmail, dryRunSMS, dryRunIdentity, dryRunStorage}
+
+// DryRun records simulated side effects. A nil *DryRun simulates nothing.
+type DryRun struct {
+	river.MiddlewareDefaults
+	dbPool    *pgxpool.Pool
+	simulated map[string]bool
+}
+
+// dryRunJobKey carries the running job to Record
+type dryRunJobKey struct{}
+
+// NewDryRun returns a DryRun for the categories simulated, or nil when none is
+func NewDryRun(dbPool *pgxpool.Pool, simulated map[string]bool) *DryRun {
+	d := &DryRun{dbPool: dbPool, simulated: make(map[string]bool)}
+	for _, category := range dryRunCategories {
+		if simulated[category] {
+			d.simulated[category] = true
+		}
+	}
+	if len(d.simulated) == 0 {
+		return nil
+	}
+	return d
+}
+
+// Simulates reports whether category's side effects are simulated
+func (d *DryRun) Simulates(category string) bool {
+	return d != nil && d.simulated[category]
+}
+
+// Categories lists the simulated categories, for the startup log
+func (d *DryRun) Categories() []string {
+	var categories []string
+	for _, category := range dryRunCategories {
+		if d.Simulates(category) {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// Record logs a simulated operation and stores it. Like the audit helpers it
+// never fails the caller: the operation was skipped either way.
+func (d *DryRun) Record(ctx context.Context, category, operation, target string, details map[string]any) {
+	var jobID *int64
+	var jobKind *string
+	if job, ok := ctx.Value(dryRunJobKey{}).(*rivertype.JobRow); ok {
+		jobID, jobKind = &job.ID, &job.Kind
+	}
+	if jobID != nil {
+		log.Printf("[Job %d] [DryRun] SIMULATED %s %s", *jobID, operation, target)
+	} else {
+		log.Printf("[DryRun] SIMULATED %s %s", operation, target)
+	}
+
+	if details == nil {
+		details = map[string]any{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		log.Printf("[DryRun] Failed to marshal details of %s: %v", operation, err)
+		detailsJSON = []byte("{}")
+	}
+	_, err = d.dbPool.Exec(ctx, `
+		INSERT INTO metadata.simulated_operations
+		    (service, category, operation, target, details, river_job_id, job_kind)
+		VALUES ('consolidated-worker', $1, $2, NULLIF($3, ''), $4, $5, $6)
+	`, category, operation, target, detailsJSON, jobID, jobKind)
+	if err != nil {
+		log.Printf("[DryRun] Failed to record %s: %v", operation, err)
+	}
+}
+
+// Work implements rivertype.WorkerMiddleware: it makes the running job
+// available to Record
+func (d *DryRun) Work(ctx context.Context, job *rivertype.JobRow, doInner func(context.Context) error) error {
+	return doInner(context.WithValue(ctx, dryRunJobKey{}, job))
+}
+
+// ============================================================================
+// Storage
+// ============================================================================
+
+// objectDeleter is the subset of *s3.Client used by the cleanup tasks
+type objectDeleter interface {
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// dryRunObjectStore is an *s3.Client whose deletes are simulated when
+// storage is. Workers that delete objects get it instead of the client.
+type dryRunObjectStore struct {
+	*s3.Client
+	dryRun *DryRun
+}
+
+// ObjectStore wraps client for workers that delete objects
+func (d *DryRun) ObjectStore(client *s3.Client) *dryRunObjectStore {
+	return &dryRunObjectStore{Client: client, dryRun: d}
+}
+
+func (o *dryRunObjectStore) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if !o.dryRun.Simulates(dryRunStorage) {
+		return o.Client.DeleteObject(ctx, params, optFns...)
+	}
+	o.dryRun.Record(ctx, dryRunStorage, "s3.delete_object", aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key), nil)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// DeleteObjects records each key of a simulated batch and reports them all deleted
+func (o *dryRunObjectStore) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	if !o.dryRun.Simulates(dryRunStorage) {
+		return o.Client.DeleteObjects(ctx, params, optFns...)
+	}
+	out := &s3.DeleteObjectsOutput{}
+	for _, object := range params.Delete.Objects {
+		o.dryRun.Record(ctx, dryRunStorage, "s3.delete_object", aws.ToString(params.Bucket)+"/"+aws.ToString(object.Key), nil)
+		out.Deleted = append(out.Deleted, types.DeletedObject{Key: object.Key})
+	}
+	return out, nil
+}
+
+// PutBucketLifecycleConfiguration records a simulated lifecycle change
+func (o *dryRunObjectStore) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	if !o.dryRun.Simulates(dryRunStorage) {
+		return o.Client.PutBucketLifecycleConfiguration(ctx, params, optFns...)
+	}
+	o.dryRun.Record(ctx, dryRunStorage, "s3.put_bucket_lifecycle", aws.ToString(params.Bucket),
+		map[string]any{"rules": describeLifecycleRules(params.LifecycleConfiguration.Rules)})
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+// DeleteBucketLifecycle records a simulated lifecycle removal
+func (o *dryRunObjectStore) DeleteBucketLifecycle(ctx context.Context, params *s3.DeleteBucketLifecycleInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketLifecycleOutput, error) {
+	if !o.dryRun.Simulates(dryRunStorage) {
+		return o.Client.DeleteBucketLifecycle(ctx, params, optFns...)
+	}
+	o.dryRun.Record(ctx, dryRunStorage, "s3.delete_bucket_lifecycle", aws.ToString(params.Bucket), nil)
+	return &s3.DeleteBucketLifecycleOutput{}, nil
+}
+
+// ============================================================================
+// Identity Provider
+// ============================================================================
+
+// IdentityProvider wraps provider so that its changes are simulated when
+// identity is; reads still reach the provider
+func (d *DryRun) IdentityProvider(provider IdentityProvider) IdentityProvider {
+	if provider == nil || !d.Simulates(dryRunIdentity) {
+		return provider
+	}
+	return &dryRunIdentityProvider{IdentityProvider: provider, dryRun: d}
+}
+
+// dryRunIdentityProvider simulates every IdentityProvider method that
+// changes something. It serves the realms of the provider it wraps.
+type dryRunIdentityProvider struct {
+	IdentityProvider
+	dryRun *DryRun
+}
+
+func (p *dryRunIdentityProvider) record(ctx context.Context, operation, target string, details map[string]any) {
+	p.dryRun.Record(ctx, dryRunIdentity, p.Name()+"."+operation, target, details)
+}
+
+// CreateUser returns a made-up user ID, so provisioning completes with a
+// Civic OS user nobody can sign in as
+func (p *dryRunIdentityProvider) CreateUser(ctx context.Context, email, firstName, lastName, phone string) (string, error) {
+	id, err := simulatedUserID()
+	if err != nil {
+		return "", err
+	}
+	p.record(ctx, "create_user", id, map[string]any{"email": email, "first_name": firstName, "last_name": lastName})
+	return id, nil
+}
+
+func (p *dryRunIdentityProvider) UpdateUser(ctx context.Context, userID, email, firstName, lastName, phone string) error {
+	p.record(ctx, "update_user", userID, map[string]any{"email": email, "first_name": firstName, "last_name": lastName})
+	return nil
+}
+
+func (p *dryRunIdentityProvider) DisableUser(ctx context.Context, userID string) error {
+	p.record(ctx, "disable_user", userID, nil)
+	return nil
+}
+
+func (p *dryRunIdentityProvider) AnonymizeUser(ctx context.Context, userID string) error {
+	p.record(ctx, "anonymize_user", userID, nil)
+	return nil
+}
+
+func (p *dryRunIdentityProvider) LogoutUser(ctx context.Context, userID string) error {
+	p.record(ctx, "logout_user", userID, nil)
+	return nil
+}
+
+func (p *dryRunIdentityProvider) AssignRoles(ctx context.Context, userID string, roleNames []string) error {
+	p.record(ctx, "assign_roles", userID, map[string]any{"roles": roleNames})
+	return nil
+}
+
+func (p *dryRunIdentityProvider) RemoveRoles(ctx context.Context, userID string, roleNames []string) error {
+	p.record(ctx, "remove_roles", userID, map[string]any{"roles": roleNames})
+	return nil
+}
+
+func (p *dryRunIdentityProvider) CreateRole(ctx context.Context, name, description string) error {
+	p.record(ctx, "create_role", name, map[string]any{"description": description})
+	return nil
+}
+
+func (p *dryRunIdentityProvider) DeleteRole(ctx context.Context, name string) error {
+	p.record(ctx, "delete_role", name, nil)
+	return nil
+}
+
+func (p *dryRunIdentityProvider) CreateGroup(ctx context.Context, name, description string) error {
+	p.record(ctx, "create_group", name, map[string]any{"description": description})
+	return nil
+}
+
+func (p *dryRunIdentityProvider) DeleteGroup(ctx context.Context, name string) error {
+	p.record(ctx, "delete_group", name, nil)
+	return nil
+}
+
+func (p *dryRunIdentityProvider) AddUserToGroup(ctx context.Context, userID, groupName string) error {
+	p.record(ctx, "add_user_to_group", userID, map[string]any{"group": groupName})
+	return nil
+}
+
+func (p *dryRunIdentityProvider) RemoveUserFromGroup(ctx context.Context, userID, groupName string) error {
+	p.record(ctx, "remove_user_from_group", userID, map[string]any{"group": groupName})
+	return nil
+}
+
+// Realms implements IdentityRealms for the wrapped provider's realms
+func (p *dryRunIdentityProvider) Realms() []string {
+	if realms, ok := p.IdentityProvider.(IdentityRealms); ok {
+		return realms.Realms()
+	}
+	return []string{""}
+}
+
+// ForRealm implements IdentityRealms, simulating changes in every realm
+func (p *dryRunIdentityProvider) ForRealm(realm string) (IdentityProvider, error) {
+	provider, err := providerForRealm(p.IdentityProvider, realm)
+	if err != nil {
+		return nil, err
+	}
+	return &dryRunIdentityProvider{IdentityProvider: provider, dryRun: p.dryRun}, nil
+}
+
+// simulatedUserID returns a random (version 4) UUID
+func simulatedUserID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate user ID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewDryRun(t *testing.T) {
+	if d := NewDryRun(nil, map[string]bool{dryRunEmail: false}); d != nil {
+		t.Errorf("NewDryRun with nothing simulated = %+v, want nil", d)
+	}
+	var off *DryRun
+	if off.Simulates(dryRunEmail) {
+		t.Error("nil DryRun simulates email")
+	}
+
+	d := NewDryRun(nil, map[string]bool{dryRunEmail: true, dryRunStorage: true, "payments": true})
+	if !d.Simulates(dryRunEmail) || d.Simulates(dryRunIdentity) {
+		t.Errorf("Simulates() wrong for %v", d.Categories())
+	}
+	if got := strings.Join(d.Categories(), ","); got != "email,storage" {
+		t.Errorf("Categories() = %s, want email,storage", got)
+	}
+}
+
+func TestDryRunIdentityProvider(t *testing.T) {
+	kc := NewKeycloakClient("http://keycloak.invalid", "staff", "test-client", "test-secret")
+	kc.ServeRealms("", []string{"residents"})
+
+	if got := NewDryRun(nil, map[string]bool{dryRunEmail: true}).IdentityProvider(kc); got != IdentityProvider(kc) {
+		t.Errorf("identity not simulated: IdentityProvider() = %T, want the client", got)
+	}
+
+	wrapped := NewDryRun(nil, map[string]bool{dryRunIdentity: true}).IdentityProvider(kc)
+	if _, ok := wrapped.(*dryRunIdentityProvider); !ok {
+		t.Fatalf("IdentityProvider() = %T, want *dryRunIdentityProvider", wrapped)
+	}
+	if got := strings.Join(wrapped.(IdentityRealms).Realms(), ","); got != "staff,residents" {
+		t.Errorf("Realms() = %s, want staff,residents", got)
+	}
+	residents, err := providerForRealm(wrapped, "residents")
+	if _, ok := residents.(*dryRunIdentityProvider); err != nil || !ok {
+		t.Errorf("ForRealm(residents) = %T, %v; want a simulating provider", residents, err)
+	}
+	if _, err := providerForRealm(wrapped, "partners"); !errors.Is(err, errIdentityRealmNotServed) {
+		t.Errorf("ForRealm(partners) = %v, want errIdentityRealmNotServed", err)
+	}
+}
+
+func TestSimulatedUserID(t *testing.T) {
+	uuidV4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, err := simulatedUserID()
+	if err != nil || !uuidV4.MatchString(a) {
+		t.Fatalf("simulatedUserID() = %q, %v", a, err)
+	}
+	if b, _ := simulatedUserID(); a == b {
+		t.Errorf("simulatedUserID() returned %s twice", a)
+	}
+}
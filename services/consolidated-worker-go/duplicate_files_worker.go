@@ -0,0 +1,157 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Job Definition: Find Duplicate Files
+// ============================================================================
+
+const (
+	// defaultDuplicateHashDistance is the most dHash bits two images may
+	// differ by and still be flagged (DUPLICATE_HASH_DISTANCE). Re-encoded
+	// and resized copies differ by a few bits; unrelated photos by ~32.
+	defaultDuplicateHashDistance = 5
+
+	// duplicateScanDelay lets a burst of uploads to one record be scanned by
+	// a single job: later inserts are skipped while the first is scheduled
+	duplicateScanDelay = 30 * time.Second
+)
+
+// duplicateScanUniqueStates leaves out running, so a file hashed while a
+// scan of its record is already running gets a scan of its own
+var duplicateScanUniqueStates = []rivertype.JobState{
+	rivertype.JobStateAvailable,
+	rivertype.JobStatePending,
+	rivertype.JobStateRetryable,
+	rivertype.JobStateScheduled,
+}
+
+// FindDuplicateFilesArgs defines the arguments for scanning one record's
+// files. Queued by ThumbnailWorker after it stores an image's hash.
+type FindDuplicateFilesArgs struct {
+	EntityType string `json:"entity_type"`
+	EntityID   string `json:"entity_id"`
+}
+
+// Kind returns the job type identifier for River routing
+func (FindDuplicateFilesArgs) Kind() string {
+	return "find_duplicate_files"
+}
+
+// InsertOpts specifies River job insertion options
+func (FindDuplicateFilesArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "thumbnails",
+		MaxAttempts: 5,
+		Priority:    3,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:  true,
+			ByState: duplicateScanUniqueStates,
+		},
+	}
+}
+
+// ============================================================================
+// Worker Implementation: Find Duplicate Files Worker
+// ============================================================================
+
+// FindDuplicateFilesWorker compares the perceptual hashes of one record's
+// images and records near-duplicates in metadata.file_duplicates
+type FindDuplicateFilesWorker struct {
+	river.WorkerDefaults[FindDuplicateFilesArgs]
+	dbPool      *pgxpool.Pool
+	maxDistance int
+}
+
+// hashedFile is an image with its perceptual hash, oldest first
+type hashedFile struct {
+	ID   string
+	Hash uint64
+}
+
+// fileDuplicate flags FileID as a near-copy of the earlier DuplicateOf
+type fileDuplicate struct {
+	FileID      string
+	DuplicateOf string
+	Distance    int
+}
+
+// Work flags the record's near-duplicate images. Pairs already recorded,
+// including dismissed ones, are left as they are.
+func (w *FindDuplicateFilesWorker) Work(ctx context.Context, job *river.Job[FindDuplicateFilesArgs]) error {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT id::text, perceptual_hash
+		FROM metadata.files
+		WHERE entity_type = $1 AND entity_id = $2 AND perceptual_hash IS NOT NULL
+		ORDER BY created_at, id
+	`, job.Args.EntityType, job.Args.EntityID)
+	if err != nil {
+		return fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []hashedFile
+	for rows.Next() {
+		var f hashedFile
+		var hash int64
+		if err := rows.Scan(&f.ID, &hash); err != nil {
+			return fmt.Errorf("failed to scan file: %w", err)
+		}
+		f.Hash = uint64(hash)
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read files: %w", err)
+	}
+
+	duplicates := findDuplicates(files, w.maxDistance)
+	if len(duplicates) == 0 {
+		log.Printf("[Job %d] No duplicates among %d images of %s/%s", job.ID, len(files), job.Args.EntityType, job.Args.EntityID)
+		return nil
+	}
+
+	fileIDs := make([]string, len(duplicates))
+	originalIDs := make([]string, len(duplicates))
+	distances := make([]int32, len(duplicates))
+	for i, d := range duplicates {
+		fileIDs[i], originalIDs[i], distances[i] = d.FileID, d.DuplicateOf, int32(d.Distance)
+	}
+	tag, err := w.dbPool.Exec(ctx, `
+		INSERT INTO metadata.file_duplicates (file_id, duplicate_of, distance)
+		SELECT * FROM unnest($1::uuid[], $2::uuid[], $3::int[])
+		ON CONFLICT (file_id, duplicate_of) DO NOTHING
+	`, fileIDs, originalIDs, distances)
+	if err != nil {
+		return fmt.Errorf("failed to record duplicates: %w", err)
+	}
+
+	log.Printf("[Job %d] ✓ %d of %d images of %s/%s are duplicates (%d newly flagged)",
+		job.ID, len(duplicates), len(files), job.Args.EntityType, job.Args.EntityID, tag.RowsAffected())
+	return nil
+}
+
+// findDuplicates pairs each file with the earliest file whose hash is within
+// maxDistance bits, so copies point at the earliest similar upload
+func findDuplicates(files []hashedFile, maxDistance int) []fileDuplicate {
+	var duplicates []fileDuplicate
+	for i, f := range files {
+		for _, earlier := range files[:i] {
+			if d := hammingDistance(f.Hash, earlier.Hash); d <= maxDistance {
+				duplicates = append(duplicates, fileDuplicate{FileID: f.ID, DuplicateOf: earlier.ID, Distance: d})
+				break
+			}
+		}
+	}
+	return duplicates
+}
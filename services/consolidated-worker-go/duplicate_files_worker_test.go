@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	files := []hashedFile{
+		{ID: "a", Hash: 0x0000_0000_0000_00ff},
+		{ID: "b", Hash: 0xff00_0000_0000_0000}, // unrelated
+		{ID: "c", Hash: 0x0000_0000_0000_00fe}, // 1 bit from a
+		{ID: "d", Hash: 0x0000_0000_0000_0ff0}, // 8 bits from a
+		{ID: "e", Hash: 0xff00_0000_0000_0001}, // 1 bit from b
+	}
+
+	got := findDuplicates(files, 5)
+	want := []fileDuplicate{
+		{FileID: "c", DuplicateOf: "a", Distance: 1},
+		{FileID: "e", DuplicateOf: "b", Distance: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findDuplicates(5) = %+v, want %+v", got, want)
+	}
+
+	// A wider threshold pairs d with the earliest match, not the closest
+	got = findDuplicates(files, 8)
+	if len(got) != 3 || got[1] != (fileDuplicate{FileID: "d", DuplicateOf: "a", Distance: 8}) {
+		t.Errorf("findDuplicates(8) = %+v", got)
+	}
+
+	if got := findDuplicates(files[:1], 64); len(got) != 0 {
+		t.Errorf("single file: %+v", got)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Email Suppression List
+//
+// metadata.email_suppressions lists addresses the worker won't email. Hard
+// bounces and spam complaints are added until an admin removes them
+// (public.unsuppress_email), soft bounces for EMAIL_SOFT_BOUNCE_SUPPRESSION_DAYS.
+// They come from SendGrid events (email_event_webhook) and from SMTP servers
+// rejecting RCPT TO with a 5.1.x code; admins add others with
+// public.suppress_email. send_notification and send_email check the list
+// before every send. Scheduled by MaintenanceScheduler (task
+// "email_suppression_expiry"), which deletes expired rows.
+// ============================================================================
+
+// Suppression reasons
+const (
+	suppressHardBounce = "hard_bounce"
+	suppressSoftBounce = "soft_bounce"
+	suppressComplaint  = "complaint"
+)
+
+// errEmailSuppressed marks sends refused because of the suppression list.
+// isTransientError never retries them.
+var errEmailSuppressed = errors.New("address is on the email suppression list")
+
+// EmailSuppressions checks and adds to the suppression list. A nil
+// *EmailSuppressions suppresses nothing.
+type EmailSuppressions struct {
+	dbPool        *pgxpool.Pool
+	softBounceFor time.Duration
+}
+
+// NewEmailSuppressions creates the list; soft bounces suppress an address
+// for softBounceFor
+func NewEmailSuppressions(dbPool *pgxpool.Pool, softBounceFor time.Duration) *EmailSuppressions {
+	return &EmailSuppressions{dbPool: dbPool, softBounceFor: softBounceFor}
+}
+
+// Suppressed returns the reason for each of addresses that is currently
+// suppressed, keyed by the address as given
+func (s *EmailSuppressions) Suppressed(ctx context.Context, addresses []string) (map[string]string, error) {
+	if s == nil || len(addresses) == 0 {
+		return nil, nil
+	}
+	byKey := make(map[string][]string, len(addresses))
+	keys := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		key := suppressionKey(addr)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], addr)
+	}
+
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT email_address, reason
+		FROM metadata.email_suppressions
+		WHERE email_address = ANY($1)
+		  AND (expires_at IS NULL OR expires_at > NOW())
+	`, keys)
+	if err != nil {
+		return nil, fmt.Errorf("check email suppressions: %w", err)
+	}
+	defer rows.Close()
+
+	suppressed := make(map[string]string)
+	for rows.Next() {
+		var key, reason string
+		if err := rows.Scan(&key, &reason); err != nil {
+			return nil, fmt.Errorf("check email suppressions: %w", err)
+		}
+		for _, addr := range byKey[key] {
+			suppressed[addr] = reason
+		}
+	}
+	return suppressed, rows.Err()
+}
+
+// Suppress adds address to the list for reason. Soft bounces expire; a
+// permanent suppression is never shortened by one.
+func (s *EmailSuppressions) Suppress(ctx context.Context, address, reason, source, detail string) error {
+	if s == nil {
+		return nil
+	}
+	var expiresAt *time.Time
+	if reason == suppressSoftBounce {
+		t := time.Now().Add(s.softBounceFor)
+		expiresAt = &t
+	}
+
+	_, err := s.dbPool.Exec(ctx, `
+		INSERT INTO metadata.email_suppressions AS s
+			(email_address, reason, source, detail, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (email_address) DO UPDATE SET
+			reason = CASE WHEN s.expires_at IS NULL AND EXCLUDED.expires_at IS NOT NULL
+			              THEN s.reason ELSE EXCLUDED.reason END,
+			source = CASE WHEN s.expires_at IS NULL AND EXCLUDED.expires_at IS NOT NULL
+			              THEN s.source ELSE EXCLUDED.source END,
+			detail = CASE WHEN s.expires_at IS NULL AND EXCLUDED.expires_at IS NOT NULL
+			              THEN s.detail ELSE EXCLUDED.detail END,
+			expires_at = CASE WHEN s.expires_at IS NULL OR EXCLUDED.expires_at IS NULL THEN NULL
+			                  ELSE GREATEST(s.expires_at, EXCLUDED.expires_at) END,
+			event_count = s.event_count + 1,
+			last_event_at = NOW()
+	`, suppressionKey(address), reason, source, detail, expiresAt)
+	if err != nil {
+		return fmt.Errorf("suppress %s: %w", address, err)
+	}
+	log.Printf("[Suppression] %s suppressed (%s from %s)", address, reason, source)
+	return nil
+}
+
+// suppressionKey normalizes an address for the list: a bare, lowercased
+// address, also for "Name <addr>" recipients
+func suppressionKey(address string) string {
+	_, addr := parseEmailAddress(address)
+	return strings.ToLower(addr)
+}
+
+// smtpHardBounce reports whether a RCPT TO rejection says the mailbox doesn't
+// exist: 550, 551 or 553 with a 5.1.x enhanced status code, or with none.
+// Policy rejections (5.7.x) are about the sender, not the address.
+func smtpHardBounce(err error) bool {
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) {
+		return false
+	}
+	switch tpErr.Code {
+	case 550, 551, 553:
+	default:
+		return false
+	}
+	status, _, _ := strings.Cut(strings.TrimSpace(tpErr.Msg), " ")
+	if len(status) >= 2 && status[0] >= '2' && status[0] <= '5' && status[1] == '.' {
+		return strings.HasPrefix(status, "5.1.")
+	}
+	return true
+}
+
+// suppressRejectedRecipient suppresses a recipient the SMTP server rejected
+// as a hard bounce, and marks the error so the send isn't retried
+func suppressRejectedRecipient(ctx context.Context, suppressions *EmailSuppressions, recipient string, err error) error {
+	if suppressions == nil || !smtpHardBounce(err) {
+		return err
+	}
+	if suppressErr := suppressions.Suppress(ctx, recipient, suppressHardBounce, "smtp", err.Error()); suppressErr != nil {
+		log.Printf("[Suppression] %v", suppressErr)
+		return err
+	}
+	return fmt.Errorf("%w: %w", errEmailSuppressed, err)
+}
+
+// sendGridSuppression returns the suppression a stored SendGrid event calls
+// for, if any: bounce (type "bounce") and spamreport suppress the address
+// until removed, a blocked bounce temporarily
+func sendGridSuppression(payload []byte) (address, reason, detail string, err error) {
+	var event sendGridEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return "", "", "", err
+	}
+	switch event.Event {
+	case "bounce":
+		if event.Type == "blocked" {
+			return event.Email, suppressSoftBounce, event.Reason, nil
+		}
+		return event.Email, suppressHardBounce, event.Reason, nil
+	case "spamreport":
+		return event.Email, suppressComplaint, "", nil
+	}
+	return "", "", "", nil
+}
+
+// ============================================================================
+// Email Suppression Expiry Maintenance Task
+// ============================================================================
+
+// EmailSuppressionExpiryTask deletes temporary suppressions that have ended.
+// Sends already ignore them; this keeps the admin list current.
+type EmailSuppressionExpiryTask struct {
+	dbPool *pgxpool.Pool
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (e *EmailSuppressionExpiryTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "email_suppression_expiry",
+		Description: "Delete temporary email suppressions (soft bounces, admin entries with an expiry) that have ended",
+		Interval:    time.Hour,
+		Jitter:      5 * time.Minute,
+		Run:         e.runExpiry,
+	}
+}
+
+func (e *EmailSuppressionExpiryTask) runExpiry(ctx context.Context) (string, error) {
+	result, err := e.dbPool.Exec(ctx, `
+		DELETE FROM metadata.email_suppressions
+		WHERE expires_at <= NOW()
+	`)
+	if err != nil {
+		return "", fmt.Errorf("delete expired suppressions: %w", err)
+	}
+	return fmt.Sprintf("Deleted %d expired email suppressions", result.RowsAffected()), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+)
+
+func TestSMTPHardBounce(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&textproto.Error{Code: 550, Msg: "5.1.1 <gone@example.org>: Recipient address rejected: User unknown"}, true},
+		{&textproto.Error{Code: 553, Msg: "mailbox name not allowed"}, true},
+		{fmt.Errorf("RCPT TO failed: %w", &textproto.Error{Code: 551, Msg: "5.1.6 user has moved"}), true},
+		{&textproto.Error{Code: 550, Msg: "5.7.1 Relaying denied"}, false},
+		{&textproto.Error{Code: 552, Msg: "5.2.2 Mailbox full"}, false},
+		{&textproto.Error{Code: 450, Msg: "4.2.1 Mailbox busy"}, false},
+		{errors.New("connection reset by peer"), false},
+	}
+	for _, tt := range tests {
+		if got := smtpHardBounce(tt.err); got != tt.want {
+			t.Errorf("smtpHardBounce(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSendGridSuppression(t *testing.T) {
+	tests := []struct {
+		payload    string
+		wantReason string
+	}{
+		{`{"email":"a@example.org","event":"bounce","type":"bounce","reason":"550 5.1.1 unknown user"}`, suppressHardBounce},
+		{`{"email":"a@example.org","event":"bounce","reason":"550 5.1.1 unknown user"}`, suppressHardBounce},
+		{`{"email":"a@example.org","event":"bounce","type":"blocked","reason":"421 try later"}`, suppressSoftBounce},
+		{`{"email":"a@example.org","event":"spamreport"}`, suppressComplaint},
+		{`{"email":"a@example.org","event":"delivered"}`, ""},
+		{`{"email":"a@example.org","event":"deferred"}`, ""},
+	}
+	for _, tt := range tests {
+		address, reason, _, err := sendGridSuppression([]byte(tt.payload))
+		if err != nil || reason != tt.wantReason || (reason != "" && address != "a@example.org") {
+			t.Errorf("sendGridSuppression(%s) = %q, %q, %v; want reason %q", tt.payload, address, reason, err, tt.wantReason)
+		}
+	}
+}
+
+func TestEmailSuppressedNotRetried(t *testing.T) {
+	err := fmt.Errorf("RCPT TO failed: %w", fmt.Errorf("%w: %w", errEmailSuppressed,
+		&textproto.Error{Code: 550, Msg: "5.1.1 mailbox unavailable"}))
+	if isTransientError(err) {
+		t.Errorf("isTransientError(%v) = true, want false for a suppressed address", err)
+	}
+}
+
+func TestSuppressionKey(t *testing.T) {
+	for _, addr := range []string{"Resident@Example.org", `"A Resident" <resident@EXAMPLE.org>`, " resident@example.org "} {
+		if got := suppressionKey(addr); got != "resident@example.org" {
+			t.Errorf("suppressionKey(%q) = %q", addr, got)
+		}
+	}
+}
+
+func TestWithoutSuppressed(t *testing.T) {
+	kept := withoutSuppressed([]string{"a@example.org", "b@example.org"}, map[string]string{"b@example.org": suppressHardBounce}, "TO")
+	if len(kept) != 1 || kept[0] != "a@example.org" {
+		t.Errorf("withoutSuppressed() = %v", kept)
+	}
+
+	var none *EmailSuppressions
+	if suppressed, err := none.Suppressed(context.Background(), []string{"a@example.org"}); err != nil || suppressed != nil {
+		t.Errorf("nil list Suppressed() = %v, %v", suppressed, err)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// Email Threading
+//
+// Every notification got a fresh Message-ID and nothing else, so a dozen
+// updates about one reservation arrived as a dozen unrelated messages. Email
+// about a record (entity_type and entity_id set on send_notification or
+// send_email) now carries In-Reply-To and References naming a thread ID
+// derived from the record, the way issue trackers thread their mail. The
+// thread's root message is never sent; mail clients thread on the shared
+// reference. Each message keeps its own random Message-ID, since clients
+// drop a second message with an ID they have seen.
+//
+// The ID is "<entity_type.hash@domain>": the hash covers the type and ID,
+// which can hold characters a msg-id can't, and the domain is the envelope
+// sender's, so it stays the same as long as SMTP_FROM does.
+// ============================================================================
+
+// entityThreadID returns the thread Message-ID for a record, or "" when the
+// message isn't about one
+func entityThreadID(entityType, entityID, domain string) string {
+	if entityType == "" || entityID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(entityType + "\x00" + entityID)) // text can't hold NUL
+	return fmt.Sprintf("<%s.%x@%s>", msgIDAtom(entityType), sum[:12], domain)
+}
+
+// setThreadHeaders makes the message a reply to its record's thread
+func setThreadHeaders(headers map[string]string, entityType, entityID, domain string) {
+	if thread := entityThreadID(entityType, entityID, domain); thread != "" {
+		headers["In-Reply-To"] = thread
+		headers["References"] = thread
+	}
+}
+
+// msgIDAtom keeps the letters, digits, '-' and '_' of s (lowercased) for
+// the readable part of a thread ID
+func msgIDAtom(s string) string {
+	atom := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return -1
+	}, s)
+	if atom == "" {
+		return "entity"
+	}
+	return atom
+}
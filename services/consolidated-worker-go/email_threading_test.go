@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEntityThreadID(t *testing.T) {
+	id := entityThreadID("reservations", "42", "parks.example.gov")
+	if id != entityThreadID("reservations", "42", "parks.example.gov") {
+		t.Error("thread ID is not stable")
+	}
+	if !strings.HasPrefix(id, "<reservations.") || !strings.HasSuffix(id, "@parks.example.gov>") {
+		t.Errorf("id = %s", id)
+	}
+	for _, other := range []string{
+		entityThreadID("reservations", "43", "parks.example.gov"),
+		entityThreadID("issues", "42", "parks.example.gov"),
+	} {
+		if other == id {
+			t.Errorf("%s collides with another record", other)
+		}
+	}
+
+	if entityThreadID("a/b", "c", "x.example.gov") == entityThreadID("a", "b/c", "x.example.gov") {
+		t.Error("type and ID run together")
+	}
+
+	// IDs with characters a msg-id can't hold
+	odd := entityThreadID("Permit Apps", "<x@y> z", "city.example.gov")
+	if strings.ContainsAny(odd[1:len(odd)-1], " <>") || strings.Count(odd, "@") != 1 {
+		t.Errorf("odd = %s", odd)
+	}
+
+	if entityThreadID("", "42", "parks.example.gov") != "" || entityThreadID("reservations", "", "parks.example.gov") != "" {
+		t.Error("thread ID without a record")
+	}
+}
+
+func TestSetThreadHeaders(t *testing.T) {
+	headers := map[string]string{}
+	setThreadHeaders(headers, "", "", "parks.example.gov")
+	if len(headers) != 0 {
+		t.Errorf("headers without a record = %v", headers)
+	}
+
+	setThreadHeaders(headers, "reservations", "42", "parks.example.gov")
+	want := entityThreadID("reservations", "42", "parks.example.gov")
+	if headers["In-Reply-To"] != want || headers["References"] != want {
+		t.Errorf("headers = %v, want both %s", headers, want)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Email Engagement Tracking
+//
+// For templates with track_engagement (see migration
+// v0-107-0-notification-engagement), the Renderer rewrites the rendered
+// HTML's links to <base>/c/<notification>/<sig>?u=<target> and appends a
+// pixel at <base>/o/<notification>/<sig>.gif. The TrackingServer verifies
+// the signature, records the event in metadata.notification_engagement and
+// redirects or returns the pixel. Signatures cover the target URL, so the
+// redirect can't be pointed anywhere else.
+// ============================================================================
+
+const (
+	// engagementSignatureBytes is how much of the HMAC goes in a URL
+	engagementSignatureBytes = 16
+
+	// engagementRecordTimeout bounds the INSERT behind one request
+	engagementRecordTimeout = 5 * time.Second
+)
+
+// trackingPixel is a transparent 1x1 GIF
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// anchorHref matches the href attribute of an <a> tag, quoted either way
+var anchorHref = regexp.MustCompile(`(?is)<a\s[^>]*?\bhref\s*=\s*("[^"]*"|'[^']*')[^>]*>`)
+
+// bodyClose finds where the pixel goes
+var bodyClose = regexp.MustCompile(`(?i)</body\s*>`)
+
+// EngagementTracker signs and builds tracking URLs
+type EngagementTracker struct {
+	baseURL string // TRACKING_BASE_URL, no trailing slash
+	secret  []byte // TRACKING_SECRET
+}
+
+// NewEngagementTracker returns nil (tracking off) unless both the public
+// base URL and the signing secret are set
+func NewEngagementTracker(baseURL, secret string) *EngagementTracker {
+	if baseURL == "" || secret == "" {
+		return nil
+	}
+	return &EngagementTracker{baseURL: strings.TrimRight(baseURL, "/"), secret: []byte(secret)}
+}
+
+// sign returns the URL-safe signature of one open or click
+func (t *EngagementTracker) sign(eventType, notificationID, target string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(eventType + ":" + notificationID + ":" + target))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:engagementSignatureBytes])
+}
+
+// verify checks a signature from a tracking URL
+func (t *EngagementTracker) verify(eventType, notificationID, target, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(t.sign(eventType, notificationID, target)))
+}
+
+// OpenURL is the pixel URL for a notification
+func (t *EngagementTracker) OpenURL(notificationID string) string {
+	return t.baseURL + "/o/" + notificationID + "/" + t.sign("open", notificationID, "") + ".gif"
+}
+
+// ClickURL is the redirect URL for one link of a notification
+func (t *EngagementTracker) ClickURL(notificationID, target string) string {
+	return t.baseURL + "/c/" + notificationID + "/" + t.sign("click", notificationID, target) +
+		"?u=" + url.QueryEscape(target)
+}
+
+// Instrument rewrites the http(s) links of an HTML body and appends the
+// pixel. Links with a data-no-track attribute are left alone (put it on
+// links whose clicks shouldn't be counted).
+func (t *EngagementTracker) Instrument(body, notificationID string) string {
+	body = anchorHref.ReplaceAllStringFunc(body, func(tag string) string {
+		if strings.Contains(strings.ToLower(tag), "data-no-track") {
+			return tag
+		}
+		m := anchorHref.FindStringSubmatchIndex(tag)
+		quoted := tag[m[2]:m[3]]
+		target := strings.TrimSpace(html.UnescapeString(quoted[1 : len(quoted)-1]))
+		if !isTrackableLink(target) || strings.HasPrefix(target, t.baseURL+"/") {
+			return tag
+		}
+		rewritten := quoted[:1] + html.EscapeString(t.ClickURL(notificationID, target)) + quoted[:1]
+		return tag[:m[2]] + rewritten + tag[m[3]:]
+	})
+
+	pixel := `<img src="` + html.EscapeString(t.OpenURL(notificationID)) +
+		`" width="1" height="1" alt="" style="border:0;width:1px;height:1px">`
+	if loc := bodyClose.FindAllStringIndex(body, -1); len(loc) > 0 {
+		last := loc[len(loc)-1][0]
+		return body[:last] + pixel + body[last:]
+	}
+	return body + pixel
+}
+
+// isTrackableLink is true for absolute http(s) URLs; mailto:, tel:, anchors
+// and relative links are left alone
+func isTrackableLink(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Scheme, "http") || strings.EqualFold(u.Scheme, "https")
+}
+
+// engagementURLForStorage drops the query and fragment of a clicked link, so
+// tokens in links (password resets, magic links) don't end up in the table
+func engagementURLForStorage(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	u.RawQuery, u.Fragment, u.RawFragment = "", "", ""
+	return u.String()
+}
+
+// TrackEngagement instruments a rendered email for a tracked template. No-op
+// when tracking isn't configured.
+func (r *Renderer) TrackEngagement(rendered *RenderedNotification, notificationID string) {
+	if r.tracker == nil || rendered.HTML == "" {
+		return
+	}
+	rendered.HTML = r.tracker.Instrument(rendered.HTML, notificationID)
+}
+
+// ============================================================================
+// Tracking Server
+// ============================================================================
+
+// engagementRecorder stores one event; the database one is recordEngagement
+type engagementRecorder func(ctx context.Context, notificationID int64, eventType, target string) error
+
+// TrackingServer serves the public open and click endpoints. It runs on its
+// own port because, unlike /healthz and /metrics, it is reachable from the
+// internet through the reverse proxy.
+type TrackingServer struct {
+	tracker *EngagementTracker
+	record  engagementRecorder
+	server  *http.Server
+}
+
+// NewTrackingServer creates a tracking server listening on port
+func NewTrackingServer(port string, tracker *EngagementTracker, dbPool *pgxpool.Pool) *TrackingServer {
+	s := &TrackingServer{
+		tracker: tracker,
+		record: func(ctx context.Context, notificationID int64, eventType, target string) error {
+			return recordEngagement(ctx, dbPool, notificationID, eventType, target)
+		},
+	}
+	s.server = &http.Server{
+		Addr:              ":" + port,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+func (s *TrackingServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /o/{id}/{file}", s.handleOpen)
+	mux.HandleFunc("GET /c/{id}/{sig}", s.handleClick)
+	return mux
+}
+
+// Start listens in a goroutine. A listen failure is logged, not fatal:
+// emails keep going out, their pixels and links just stop working.
+func (s *TrackingServer) Start() {
+	go func() {
+		log.Printf("[Tracking] Serving open and click tracking on %s (public at %s)", s.server.Addr, s.tracker.baseURL)
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[Tracking] Server stopped: %v", err)
+		}
+	}()
+}
+
+// Stop shuts the server down, waiting for in-flight requests
+func (s *TrackingServer) Stop(ctx context.Context) {
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("[Tracking] Shutdown error: %v", err)
+	}
+}
+
+// handleOpen always returns the pixel, so a bad signature shows the same
+// thing as a good one; only valid opens are recorded
+func (s *TrackingServer) handleOpen(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	sig, ok := strings.CutSuffix(r.PathValue("file"), ".gif")
+	if notificationID, err := strconv.ParseInt(id, 10, 64); err == nil && ok && s.tracker.verify("open", id, "", sig) {
+		s.store(r.Context(), notificationID, "open", "")
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Length", strconv.Itoa(len(trackingPixel)))
+	w.Write(trackingPixel)
+}
+
+// handleClick redirects only when the signature matches the target
+func (s *TrackingServer) handleClick(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	target := r.URL.Query().Get("u")
+	notificationID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || !isTrackableLink(target) || !s.tracker.verify("click", id, target, r.PathValue("sig")) {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.store(r.Context(), notificationID, "click", engagementURLForStorage(target))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// store records an event. Failures are logged: the reader still gets the
+// pixel or the page.
+func (s *TrackingServer) store(ctx context.Context, notificationID int64, eventType, target string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), engagementRecordTimeout)
+	defer cancel()
+	if err := s.record(ctx, notificationID, eventType, target); err != nil {
+		log.Printf("[Tracking] Failed to record %s for notification %d: %v", eventType, notificationID, err)
+	}
+}
+
+// recordEngagement inserts one event. A deleted notification records nothing.
+func recordEngagement(ctx context.Context, dbPool *pgxpool.Pool, notificationID int64, eventType, target string) error {
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO metadata.notification_engagement (notification_id, template_name, event_type, url)
+		SELECT id, template_name, $2::TEXT, NULLIF($3::TEXT, '')
+		FROM metadata.notifications
+		WHERE id = $1
+	`, notificationID, eventType, target)
+	return err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func testTracker() *EngagementTracker {
+	return NewEngagementTracker("https://city.example.gov/_/t/", "s3cret")
+}
+
+func TestNewEngagementTracker(t *testing.T) {
+	if NewEngagementTracker("https://city.example.gov/_/t", "") != nil {
+		t.Error("expected tracking off without a secret")
+	}
+	if NewEngagementTracker("", "s3cret") != nil {
+		t.Error("expected tracking off without a base URL")
+	}
+	if got := testTracker().baseURL; got != "https://city.example.gov/_/t" {
+		t.Errorf("baseURL = %q, want the trailing slash trimmed", got)
+	}
+}
+
+func TestEngagementInstrument(t *testing.T) {
+	tr := testTracker()
+	body := `<html><body>
+<a href="https://city.example.gov/issues/4?tab=a&amp;x=1">View</a>
+<a class="btn" href='http://parks.example.org/'>Parks</a>
+<a href="mailto:clerk@example.gov">Email us</a>
+<a href="#top">Top</a>
+<a data-no-track href="https://city.example.gov/unsubscribe">Unsubscribe</a>
+</BODY></html>`
+	got := tr.Instrument(body, "42")
+
+	want := `href="` + strings.ReplaceAll(tr.ClickURL("42", "https://city.example.gov/issues/4?tab=a&x=1"), "&", "&amp;") + `"`
+	if !strings.Contains(got, want) {
+		t.Errorf("first link not rewritten with the unescaped target:\n%s", got)
+	}
+	if !strings.Contains(got, `class="btn" href='`+tr.ClickURL("42", "http://parks.example.org/")+`'`) {
+		t.Errorf("single-quoted link not rewritten:\n%s", got)
+	}
+	for _, kept := range []string{`href="mailto:clerk@example.gov"`, `href="#top"`, `href="https://city.example.gov/unsubscribe"`} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("%s should be left alone:\n%s", kept, got)
+		}
+	}
+	pixel := `<img src="` + tr.OpenURL("42") + `"`
+	if i := strings.Index(got, pixel); i < 0 || i > strings.Index(got, "</BODY>") {
+		t.Errorf("pixel missing or not before </body>:\n%s", got)
+	}
+
+	// Instrumenting twice doesn't wrap the tracking links again
+	if again := tr.Instrument(got, "42"); strings.Count(again, "/c/42/") != strings.Count(got, "/c/42/") {
+		t.Errorf("links rewritten twice:\n%s", again)
+	}
+
+	if got := tr.Instrument("<p>Hi</p>", "42"); !strings.HasPrefix(got, "<p>Hi</p><img ") {
+		t.Errorf("fragment: pixel not appended: %s", got)
+	}
+}
+
+func TestRendererTrackEngagement(t *testing.T) {
+	r := NewRenderer("https://city.example.gov", "Civic OS", nil, nil, "")
+	rendered := &RenderedNotification{HTML: `<a href="https://example.org">x</a>`, Text: "https://example.org"}
+	r.TrackEngagement(rendered, "7")
+	if rendered.HTML != `<a href="https://example.org">x</a>` {
+		t.Errorf("untracked renderer changed the HTML: %s", rendered.HTML)
+	}
+
+	r.SetEngagementTracker(testTracker())
+	r.TrackEngagement(rendered, "7")
+	if !strings.Contains(rendered.HTML, "/c/7/") || rendered.Text != "https://example.org" {
+		t.Errorf("HTML = %s, Text = %s; want only the HTML rewritten", rendered.HTML, rendered.Text)
+	}
+}
+
+type recordedEngagement struct {
+	notificationID int64
+	eventType      string
+	url            string
+}
+
+func testTrackingServer() (*TrackingServer, *[]recordedEngagement) {
+	var events []recordedEngagement
+	s := &TrackingServer{
+		tracker: testTracker(),
+		record: func(ctx context.Context, notificationID int64, eventType, target string) error {
+			events = append(events, recordedEngagement{notificationID, eventType, target})
+			return nil
+		},
+	}
+	return s, &events
+}
+
+// trackingPath strips the public base from a tracking URL
+func trackingPath(t *testing.T, raw string) string {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimPrefix(u.RequestURI(), "/_/t")
+}
+
+func TestTrackingServerOpen(t *testing.T) {
+	s, events := testTrackingServer()
+	for _, path := range []string{trackingPath(t, s.tracker.OpenURL("42")), "/o/42/forged.gif", "/o/43/" + s.tracker.sign("open", "42", "") + ".gif"} {
+		rec := httptest.NewRecorder()
+		s.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/gif" {
+			t.Errorf("%s: status %d, type %s", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if _, err := gif.Decode(bytes.NewReader(rec.Body.Bytes())); err != nil {
+			t.Errorf("%s: pixel is not a GIF: %v", path, err)
+		}
+	}
+	if len(*events) != 1 || (*events)[0] != (recordedEngagement{42, "open", ""}) {
+		t.Errorf("events = %v, want only the signed open", *events)
+	}
+}
+
+func TestTrackingServerClick(t *testing.T) {
+	s, events := testTrackingServer()
+	target := "https://city.example.gov/reset?token=abc#form"
+
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, trackingPath(t, s.tracker.ClickURL("42", target)), nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != target {
+		t.Errorf("status %d, Location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if len(*events) != 1 || (*events)[0] != (recordedEngagement{42, "click", "https://city.example.gov/reset"}) {
+		t.Errorf("events = %v, want the click stored without query or fragment", *events)
+	}
+
+	// A signature for one target doesn't redirect to another
+	sig := s.tracker.sign("click", "42", target)
+	for _, path := range []string{
+		"/c/42/" + sig + "?u=" + url.QueryEscape("https://evil.example.com/"),
+		"/c/43/" + sig + "?u=" + url.QueryEscape(target),
+		"/c/42/" + s.tracker.sign("click", "42", "javascript:alert(1)") + "?u=javascript%3Aalert(1)",
+	} {
+		rec := httptest.NewRecorder()
+		s.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, rec.Code)
+		}
+	}
+	if len(*events) != 1 {
+		t.Errorf("events = %v, want forged clicks unrecorded", *events)
+	}
+}
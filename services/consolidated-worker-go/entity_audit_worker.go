@@ -0,0 +1,294 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Entity Audit Log
+//
+// metadata.capture_entity_changes() (see migration v0-105-0-entity-audit-log)
+// writes every change to an audited table into metadata.entity_changes and
+// notifies entity_changed. The entity_audit_capture job turns those raw rows
+// into metadata.entity_audit_log entries: updates keep only the columns that
+// changed, with their values before and after, and the request's audit
+// context becomes typed who-columns. Each batch is written and its raw rows
+// deleted in one transaction, so every change is logged exactly once.
+// ============================================================================
+
+const (
+	// entityAuditBatchSize is how many changes one transaction processes
+	entityAuditBatchSize = 500
+
+	// entityAuditIgnoredColumn changes on every update and says nothing the
+	// entry's occurred_at doesn't
+	entityAuditIgnoredColumn = "updated_at"
+)
+
+// EntityAuditCaptureArgs processes pending entity changes. The jobs aren't
+// unique, like outbox dispatchers: one inserted while another is running
+// must still run, in case the running one already found no changes. Jobs
+// running together take different rows (SKIP LOCKED).
+type EntityAuditCaptureArgs struct{}
+
+// Kind returns the job type identifier for River routing
+func (EntityAuditCaptureArgs) Kind() string { return "entity_audit_capture" }
+
+// InsertOpts specifies River job insertion options
+func (EntityAuditCaptureArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "audit",
+		MaxAttempts: 10,
+		Priority:    2,
+	}
+}
+
+func scanEntityAuditCapture(rows pgx.Rows) (river.JobArgs, error) {
+	var pending bool
+	err := rows.Scan(&pending)
+	return EntityAuditCaptureArgs{}, err
+}
+
+// entityChangedChannel queues a capture job for each transaction that
+// capture_entity_changes() announces on entity_changed (no payload).
+// Resync queues one if changes are waiting.
+func entityChangedChannel(dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx]) NotifyChannel {
+	return NotifyChannel{
+		Name: "entity_changed",
+		Handle: func(ctx context.Context, payload string) error {
+			_, err := riverClient.Insert(ctx, EntityAuditCaptureArgs{}, nil)
+			return err
+		},
+		Resync: func(ctx context.Context) error {
+			return resyncJobs(ctx, "entity_changed", dbPool, riverClient, scanEntityAuditCapture,
+				`SELECT TRUE WHERE EXISTS (SELECT 1 FROM metadata.entity_changes)`)
+		},
+	}
+}
+
+// entityChange is a metadata.entity_changes row
+type entityChange struct {
+	ID         int64
+	TableName  string
+	EntityID   *string
+	Operation  string
+	OldRow     map[string]json.RawMessage
+	NewRow     map[string]json.RawMessage
+	Audit      JobAuditContext
+	TxID       int64
+	OccurredAt time.Time
+}
+
+// entityAuditEntry is an entity_audit_log row built from a change
+type entityAuditEntry struct {
+	ChangedColumns []string
+	Before         map[string]json.RawMessage
+	After          map[string]json.RawMessage
+}
+
+// buildEntityAuditEntry diffs a change. Inserts keep the new row and
+// deletes the old one; updates keep the changed columns on both sides. An
+// update that changed nothing but updated_at is dropped (ok false).
+func buildEntityAuditEntry(c *entityChange) (entityAuditEntry, bool) {
+	switch c.Operation {
+	case "insert":
+		return entityAuditEntry{ChangedColumns: slices.Sorted(maps.Keys(c.NewRow)), After: c.NewRow}, true
+	case "delete":
+		return entityAuditEntry{ChangedColumns: slices.Sorted(maps.Keys(c.OldRow)), Before: c.OldRow}, true
+	}
+
+	entry := entityAuditEntry{
+		Before: map[string]json.RawMessage{},
+		After:  map[string]json.RawMessage{},
+	}
+	for column, value := range c.NewRow {
+		if old, ok := c.OldRow[column]; !ok || string(old) != string(value) {
+			entry.After[column] = value
+			if ok {
+				entry.Before[column] = old
+			}
+		}
+	}
+	// Dropped columns (the table changed between OLD and NEW) count too
+	for column, old := range c.OldRow {
+		if _, ok := c.NewRow[column]; !ok {
+			entry.Before[column] = old
+		}
+	}
+	delete(entry.Before, entityAuditIgnoredColumn)
+	delete(entry.After, entityAuditIgnoredColumn)
+
+	for column := range entry.Before {
+		entry.ChangedColumns = append(entry.ChangedColumns, column)
+	}
+	for column := range entry.After {
+		if _, ok := entry.Before[column]; !ok {
+			entry.ChangedColumns = append(entry.ChangedColumns, column)
+		}
+	}
+	slices.Sort(entry.ChangedColumns)
+	return entry, len(entry.ChangedColumns) > 0
+}
+
+// marshalAuditValues encodes one side of an entry; nil stays NULL
+func marshalAuditValues(values map[string]json.RawMessage) ([]byte, error) {
+	if values == nil {
+		return nil, nil
+	}
+	return json.Marshal(values)
+}
+
+// EntityAuditCaptureWorker writes entity changes to the audit log
+type EntityAuditCaptureWorker struct {
+	river.WorkerDefaults[EntityAuditCaptureArgs]
+	dbPool *pgxpool.Pool
+}
+
+// Work processes batches until no unlocked changes are left
+func (w *EntityAuditCaptureWorker) Work(ctx context.Context, job *river.Job[EntityAuditCaptureArgs]) error {
+	logged, dropped := 0, 0
+	for {
+		changes, entries, err := w.captureBatch(ctx, entityAuditBatchSize)
+		if err != nil {
+			return err
+		}
+		logged += entries
+		dropped += changes - entries
+		if changes < entityAuditBatchSize {
+			break
+		}
+	}
+	if logged > 0 || dropped > 0 {
+		log.Printf("[Job %d] Entity audit: %d change(s) logged, %d no-op update(s) dropped", job.ID, logged, dropped)
+	}
+	return nil
+}
+
+// captureBatch logs up to batchSize changes and deletes them. Returns how
+// many changes it took and how many entries it wrote.
+func (w *EntityAuditCaptureWorker) captureBatch(ctx context.Context, batchSize int) (int, int, error) {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, table_name, entity_id, operation, old_row, new_row, audit, txid, occurred_at
+		FROM metadata.entity_changes
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, batchSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("lock changes: %w", err)
+	}
+	changes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*entityChange, error) {
+		var c entityChange
+		var audit []byte
+		if err := row.Scan(&c.ID, &c.TableName, &c.EntityID, &c.Operation, &c.OldRow, &c.NewRow,
+			&audit, &c.TxID, &c.OccurredAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(audit, &c.Audit); err != nil {
+			// Still log the change; who made it is then unknown
+			log.Printf("[Audit] Change %d: unreadable audit context: %v", c.ID, err)
+		}
+		return &c, nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("read changes: %w", err)
+	}
+	if len(changes) == 0 {
+		return 0, 0, nil
+	}
+
+	batch := &pgx.Batch{}
+	ids := make([]int64, len(changes))
+	for i, c := range changes {
+		ids[i] = c.ID
+		entry, ok := buildEntityAuditEntry(c)
+		if !ok {
+			continue
+		}
+		before, err := marshalAuditValues(entry.Before)
+		if err != nil {
+			return 0, 0, fmt.Errorf("encode change %d: %w", c.ID, err)
+		}
+		after, err := marshalAuditValues(entry.After)
+		if err != nil {
+			return 0, 0, fmt.Errorf("encode change %d: %w", c.ID, err)
+		}
+		batch.Queue(`
+			INSERT INTO metadata.entity_audit_log (
+				change_id, occurred_at, txid, table_name, entity_id, operation, changed_columns,
+				before_values, after_values, actor_id, on_behalf_of, impersonated_roles, request_id, db_user
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::TEXT::UUID, $11::TEXT::UUID, $12, $13, $14)
+			ON CONFLICT (change_id) DO NOTHING
+		`, c.ID, c.OccurredAt, c.TxID, c.TableName, c.EntityID, c.Operation, entry.ChangedColumns,
+			before, after, nonEmpty(c.Audit.ActorID), nonEmpty(c.Audit.OnBehalfOf), c.Audit.ImpersonatedRoles,
+			nonEmpty(c.Audit.RequestID), nonEmpty(c.Audit.DBUser))
+	}
+	entries := batch.Len()
+	if entries > 0 {
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return 0, 0, fmt.Errorf("write audit log: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM metadata.entity_changes WHERE id = ANY($1)`, ids); err != nil {
+		return 0, 0, fmt.Errorf("delete processed changes: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(changes), entries, nil
+}
+
+// ============================================================================
+// Entity Audit Retention Maintenance Task
+//
+// Scheduled by MaintenanceScheduler (task "entity_audit_retention"). Only
+// tables with a row in metadata.entity_audit_retention lose history.
+// ============================================================================
+
+// EntityAuditRetentionTask applies the per-table retention policies
+type EntityAuditRetentionTask struct {
+	dbPool *pgxpool.Pool
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (e *EntityAuditRetentionTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "entity_audit_retention",
+		Description: "Delete entity audit log entries older than their table's retention policy",
+		Interval:    24 * time.Hour,
+		Jitter:      time.Hour,
+		Run:         e.runRetention,
+	}
+}
+
+func (e *EntityAuditRetentionTask) runRetention(ctx context.Context) (string, error) {
+	result, err := e.dbPool.Exec(ctx, `
+		DELETE FROM metadata.entity_audit_log l
+		USING metadata.entity_audit_retention r
+		WHERE l.table_name = r.table_name
+		  AND l.occurred_at < NOW() - make_interval(days => r.retain_days)
+	`)
+	if err != nil {
+		return "", fmt.Errorf("delete expired audit entries: %w", err)
+	}
+	return fmt.Sprintf("Deleted %d expired entity audit log entries", result.RowsAffected()), nil
+}
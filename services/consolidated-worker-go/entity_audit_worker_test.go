@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func auditRow(t *testing.T, s string) map[string]json.RawMessage {
+	t.Helper()
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &row); err != nil {
+		t.Fatal(err)
+	}
+	return row
+}
+
+func auditValues(t *testing.T, values map[string]json.RawMessage) string {
+	t.Helper()
+	b, err := marshalAuditValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestBuildEntityAuditEntry_Update(t *testing.T) {
+	c := &entityChange{
+		Operation: "update",
+		OldRow:    auditRow(t, `{"id": 4, "status": "open", "notes": null, "tags": [1], "updated_at": "2026-01-01T10:00:00"}`),
+		NewRow:    auditRow(t, `{"id": 4, "status": "closed", "notes": "done", "tags": [1], "updated_at": "2026-01-02T10:00:00"}`),
+	}
+	entry, ok := buildEntityAuditEntry(c)
+	if !ok {
+		t.Fatal("expected an entry")
+	}
+	if !reflect.DeepEqual(entry.ChangedColumns, []string{"notes", "status"}) {
+		t.Errorf("changed columns = %v", entry.ChangedColumns)
+	}
+	if got := auditValues(t, entry.Before); got != `{"notes":null,"status":"open"}` {
+		t.Errorf("before = %s", got)
+	}
+	if got := auditValues(t, entry.After); got != `{"notes":"done","status":"closed"}` {
+		t.Errorf("after = %s", got)
+	}
+}
+
+func TestBuildEntityAuditEntry_OnlyUpdatedAt(t *testing.T) {
+	c := &entityChange{
+		Operation: "update",
+		OldRow:    auditRow(t, `{"id": 4, "updated_at": "2026-01-01T10:00:00"}`),
+		NewRow:    auditRow(t, `{"id": 4, "updated_at": "2026-01-02T10:00:00"}`),
+	}
+	if entry, ok := buildEntityAuditEntry(c); ok {
+		t.Errorf("expected no entry, got %+v", entry)
+	}
+}
+
+func TestBuildEntityAuditEntry_SchemaChange(t *testing.T) {
+	c := &entityChange{
+		Operation: "update",
+		OldRow:    auditRow(t, `{"id": 4, "legacy": "x"}`),
+		NewRow:    auditRow(t, `{"id": 4, "added": 1}`),
+	}
+	entry, _ := buildEntityAuditEntry(c)
+	if !reflect.DeepEqual(entry.ChangedColumns, []string{"added", "legacy"}) {
+		t.Errorf("changed columns = %v", entry.ChangedColumns)
+	}
+	if got := auditValues(t, entry.Before); got != `{"legacy":"x"}` {
+		t.Errorf("before = %s", got)
+	}
+	if got := auditValues(t, entry.After); got != `{"added":1}` {
+		t.Errorf("after = %s", got)
+	}
+}
+
+func TestBuildEntityAuditEntry_InsertAndDelete(t *testing.T) {
+	row := auditRow(t, `{"id": 9, "title": "Pothole", "updated_at": "2026-01-01T10:00:00"}`)
+
+	entry, ok := buildEntityAuditEntry(&entityChange{Operation: "insert", NewRow: row})
+	if !ok || entry.Before != nil || !reflect.DeepEqual(entry.After, row) {
+		t.Errorf("insert entry = %+v", entry)
+	}
+	if !reflect.DeepEqual(entry.ChangedColumns, []string{"id", "title", "updated_at"}) {
+		t.Errorf("insert changed columns = %v", entry.ChangedColumns)
+	}
+
+	entry, ok = buildEntityAuditEntry(&entityChange{Operation: "delete", OldRow: row})
+	if !ok || entry.After != nil || !reflect.DeepEqual(entry.Before, row) {
+		t.Errorf("delete entry = %+v", entry)
+	}
+	if got := auditValues(t, entry.After); got != "" {
+		t.Errorf("delete after = %q, want NULL", got)
+	}
+}
+
+func TestEntityAuditCaptureArgsNotUnique(t *testing.T) {
+	opts := EntityAuditCaptureArgs{}.InsertOpts()
+	if opts.UniqueOpts.ByArgs || len(opts.UniqueOpts.ByState) > 0 {
+		t.Errorf("UniqueOpts = %+v, want none so a change during a run is not skipped", opts.UniqueOpts)
+	}
+	if opts.Queue != "audit" {
+		t.Errorf("Queue = %q", opts.Queue)
+	}
+}
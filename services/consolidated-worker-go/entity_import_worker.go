@@ -0,0 +1,1214 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Job Definition: Entity Import
+// ============================================================================
+//
+// request_entity_import() records a metadata.entity_imports row for an
+// uploaded CSV or XLSX and notifies import_requested. The job runs in one of
+// two modes:
+//
+//  1. dry run: insert every row as the importer in one transaction, each row
+//     under a savepoint, and roll it all back. What is left is the error
+//     report in metadata.entity_import_errors and the import is validated.
+//  2. import (after start_entity_import()): the same inserts, committed in
+//     batches together with the progress counters. Rows that fail are
+//     skipped and reported; a retried job resumes after the last batch.
+//
+// Before each batch the job checks for a cancellation request
+// (cancel_entity_import(), job_cancellation.go); if there is one the import
+// stops as cancelled, keeping the batches it committed. Either way the
+// importer gets an entity_import_summary notification.
+
+// Default limits (IMPORT_MAX_ROWS, IMPORT_BATCH_SIZE)
+const (
+	defaultImportMaxRows   = 100000
+	defaultImportBatchSize = 500
+
+	importStoredProblems  = 1000 // error report rows kept per import
+	importSummaryProblems = 25   // listed in the summary notification
+
+	// importHeaderSearchRows is how far down the header row may be. Import
+	// templates have a row of hints above the headers, browser exports a
+	// title row.
+	importHeaderSearchRows = 5
+)
+
+// EntityImportArgs processes one metadata.entity_imports row, queued by the
+// listener when request_entity_import() or start_entity_import() notifies
+// import_requested
+type EntityImportArgs struct {
+	ImportID int64 `json:"import_id"`
+}
+
+func (EntityImportArgs) Kind() string { return "entity_import" }
+
+func (EntityImportArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "imports",
+		MaxAttempts: 3,
+		Priority:    2,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:  true,
+			ByState: notifyJobUniqueStates,
+		},
+	}
+}
+
+// importRequestedChannel queues imports that request_entity_import() and
+// start_entity_import() announce on import_requested (payload: import ID).
+// Resync covers imports still pending.
+func importRequestedChannel(dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx]) NotifyChannel {
+	scan := func(rows pgx.Rows) (river.JobArgs, error) {
+		var args EntityImportArgs
+		err := rows.Scan(&args.ImportID)
+		return args, err
+	}
+	return NotifyChannel{
+		Name: "import_requested",
+		Handle: func(ctx context.Context, payload string) error {
+			id, err := strconv.ParseInt(payload, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid import ID %q", payload)
+			}
+			_, err = riverClient.Insert(ctx, EntityImportArgs{ImportID: id}, nil)
+			return err
+		},
+		Resync: func(ctx context.Context) error {
+			return resyncJobs(ctx, "import_requested", dbPool, riverClient, scan, `
+				SELECT id FROM metadata.entity_imports WHERE status = 'pending'
+			`)
+		},
+	}
+}
+
+// ============================================================================
+// Worker Implementation
+// ============================================================================
+
+// EntityImportWorker validates and imports rows from an uploaded file into
+// an entity table as the importer
+type EntityImportWorker struct {
+	river.WorkerDefaults[EntityImportArgs]
+	dbPool    *pgxpool.Pool
+	originals *OriginalStore
+	maxRows   int // data rows accepted per file
+	batchSize int // rows committed per transaction
+}
+
+// Timeout allows for large files; an interrupted import resumes where it
+// stopped
+func (w *EntityImportWorker) Timeout(*river.Job[EntityImportArgs]) time.Duration {
+	return time.Hour
+}
+
+// importRequestError is a problem with the import as a whole (unreadable
+// file, no matching headers, a required column missing, no access);
+// retrying can't fix it
+type importRequestError struct{ msg string }
+
+func (e *importRequestError) Error() string { return e.msg }
+
+func importRequestErrorf(format string, args ...any) error {
+	return &importRequestError{msg: fmt.Sprintf(format, args...)}
+}
+
+// entityImport is a metadata.entity_imports row with its importer
+type entityImport struct {
+	ID            int64
+	UserID        string
+	UserEmail     string
+	TableName     string
+	DisplayName   string
+	FileID        string
+	FileName      string
+	ColumnMap     []byte // JSON object of header -> column (or null)
+	DryRun        bool
+	Roles         []string
+	Status        string
+	ProcessedRows int
+}
+
+// importProblem is one entry of the error report
+type importProblem struct {
+	Line    int
+	Column  string // empty for the row as a whole
+	Value   string
+	Message string
+}
+
+func (w *EntityImportWorker) Work(ctx context.Context, job *river.Job[EntityImportArgs]) error {
+	imp, err := w.loadImport(ctx, job.Args.ImportID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("[Job %d] Import %d no longer exists, skipping", job.ID, job.Args.ImportID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load import: %w", err)
+	}
+	if imp.Status != "pending" && imp.Status != "validating" && imp.Status != "importing" {
+		log.Printf("[Job %d] Import %d already %s, skipping", job.ID, imp.ID, imp.Status)
+		return nil
+	}
+
+	mode := "import"
+	if imp.DryRun {
+		mode = "dry run"
+	}
+	log.Printf("[Job %d] Importing %s into %s for user %s (%s, attempt %d/%d)",
+		job.ID, imp.FileName, imp.TableName, imp.UserID, mode, job.Attempt, job.MaxAttempts)
+
+	if err := w.start(ctx, imp); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := w.run(ctx, job.ID, imp); err != nil {
+		var cancelErr *jobCancellationError
+		if errors.As(err, &cancelErr) {
+			log.Printf("[Job %d] Import %d %s", job.ID, imp.ID, cancelErr)
+			if err := w.cancel(ctx, job.ID, imp, cancelErr.Reason); err != nil {
+				return err
+			}
+			return river.JobCancel(cancelErr)
+		}
+		var requestErr *importRequestError
+		if errors.As(err, &requestErr) || job.Attempt >= job.MaxAttempts {
+			log.Printf("[Job %d] Import %d failed: %v", job.ID, imp.ID, err)
+			return w.fail(ctx, imp, err.Error())
+		}
+		return err
+	}
+
+	if err := w.finish(ctx, imp); err != nil {
+		return err
+	}
+	log.Printf("[Job %d] ✓ Import %d %s in %v", job.ID, imp.ID, mode, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (w *EntityImportWorker) loadImport(ctx context.Context, id int64) (*entityImport, error) {
+	imp := &entityImport{ID: id}
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT i.user_id::text, COALESCE(u.email, ''), i.table_name,
+		       COALESCE(e.display_name, i.table_name), i.file_id::text, i.file_name,
+		       i.column_map, i.dry_run, i.roles, i.status, i.processed_rows
+		FROM metadata.entity_imports i
+		LEFT JOIN metadata.entities e ON e.table_name = i.table_name
+		LEFT JOIN metadata.civic_os_users_private u ON u.id = i.user_id
+		WHERE i.id = $1
+	`, id).Scan(&imp.UserID, &imp.UserEmail, &imp.TableName,
+		&imp.DisplayName, &imp.FileID, &imp.FileName,
+		&imp.ColumnMap, &imp.DryRun, &imp.Roles, &imp.Status, &imp.ProcessedRows)
+	if err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// start marks the import running. A dry run always starts over, as does an
+// import that hasn't started; an interrupted import keeps its progress.
+func (w *EntityImportWorker) start(ctx context.Context, imp *entityImport) error {
+	if !imp.DryRun && imp.Status == "importing" {
+		return nil
+	}
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	if _, err := tx.Exec(ctx, `DELETE FROM metadata.entity_import_errors WHERE import_id = $1`, imp.ID); err != nil {
+		return fmt.Errorf("failed to clear error report: %w", err)
+	}
+	status := "importing"
+	if imp.DryRun {
+		status = "validating"
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE metadata.entity_imports
+		SET status = $2, processed_rows = 0, valid_rows = 0, invalid_rows = 0, imported_rows = 0,
+		    error_message = NULL, started_at = COALESCE(started_at, NOW())
+		WHERE id = $1
+	`, imp.ID, status); err != nil {
+		return fmt.Errorf("failed to start import: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	imp.Status, imp.ProcessedRows = status, 0
+	return nil
+}
+
+// run reads the file, maps its headers and processes every row
+func (w *EntityImportWorker) run(ctx context.Context, jobID int64, imp *entityImport) error {
+	var bucket, key string
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT s3_bucket, s3_original_key FROM metadata.files WHERE id = $1
+	`, imp.FileID).Scan(&bucket, &key)
+	if err != nil {
+		return fmt.Errorf("failed to look up file %s: %w", imp.FileID, err)
+	}
+	data, _, err := w.originals.Fetch(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	records, err := readImportFile(data)
+	if err != nil {
+		return importRequestErrorf("%v", err)
+	}
+
+	columns, err := w.loadColumns(ctx, imp.TableName)
+	if err != nil {
+		return err
+	}
+	var overrides map[string]*string
+	if err := json.Unmarshal(imp.ColumnMap, &overrides); err != nil {
+		return importRequestErrorf("invalid column map: %v", err)
+	}
+	plan, rows, err := planImport(records, columns, overrides)
+	if err != nil {
+		return err
+	}
+	plan.tableName = imp.TableName
+	if len(rows) > w.maxRows {
+		return importRequestErrorf("file has more than %d rows; split it into smaller imports", w.maxRows)
+	}
+	if plan.constraints, err = w.loadConstraints(ctx, imp.TableName); err != nil {
+		return err
+	}
+
+	if _, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.entity_imports SET total_rows = $2, columns = $3, ignored_headers = $4 WHERE id = $1
+	`, imp.ID, len(rows), plan.columnNames(), plan.ignored); err != nil {
+		return fmt.Errorf("failed to record import columns: %w", err)
+	}
+	log.Printf("[Job %d] Import %d: %d row(s), columns %s", jobID, imp.ID, len(rows), strings.Join(plan.columnNames(), ", "))
+
+	if imp.DryRun {
+		return w.validate(ctx, jobID, imp, plan, rows)
+	}
+	return w.insert(ctx, jobID, imp, plan, rows)
+}
+
+// validate is the dry run: every batch goes into one transaction that is
+// rolled back, so rows are checked against each other too (a duplicate of
+// an earlier row fails its unique constraint)
+func (w *EntityImportWorker) validate(ctx context.Context, jobID int64, imp *entityImport, plan *importPlan, rows []importRecord) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // a dry run is never committed
+
+	if err := assumeImporter(ctx, tx, imp); err != nil {
+		return err
+	}
+	lookup := newImportNameLookup()
+	stored := 0
+	for start := 0; start < len(rows); start += w.batchSize {
+		if err := checkJobCancellation(ctx, w.dbPool, jobID); err != nil {
+			return err
+		}
+		batch := rows[start:min(start+w.batchSize, len(rows))]
+		inserted, invalid, problems, err := insertImportBatch(ctx, tx, plan, lookup, batch)
+		if err != nil {
+			return err
+		}
+		problems = problems[:min(len(problems), importStoredProblems-stored)]
+		stored += len(problems)
+
+		// Progress goes through the pool: this transaction is rolled back
+		if err := storeImportProblems(ctx, w.dbPool, imp.ID, problems); err != nil {
+			return err
+		}
+		if _, err := w.dbPool.Exec(ctx, `
+			UPDATE metadata.entity_imports
+			SET processed_rows = processed_rows + $2, valid_rows = valid_rows + $3, invalid_rows = invalid_rows + $4
+			WHERE id = $1
+		`, imp.ID, len(batch), inserted, invalid); err != nil {
+			return fmt.Errorf("failed to record progress: %w", err)
+		}
+		log.Printf("[Job %d] Import %d dry run: %d/%d rows checked", jobID, imp.ID, start+len(batch), len(rows))
+	}
+	return nil
+}
+
+// insert is the real import: each batch commits its rows, its part of the
+// error report and the progress counters together
+func (w *EntityImportWorker) insert(ctx context.Context, jobID int64, imp *entityImport, plan *importPlan, rows []importRecord) error {
+	var stored int
+	if err := w.dbPool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM metadata.entity_import_errors WHERE import_id = $1
+	`, imp.ID).Scan(&stored); err != nil {
+		return fmt.Errorf("failed to count error report: %w", err)
+	}
+	if imp.ProcessedRows > 0 {
+		log.Printf("[Job %d] Import %d resuming after row %d", jobID, imp.ID, imp.ProcessedRows)
+	}
+
+	lookup := newImportNameLookup()
+	for start := min(imp.ProcessedRows, len(rows)); start < len(rows); start += w.batchSize {
+		if err := checkJobCancellation(ctx, w.dbPool, jobID); err != nil {
+			return err
+		}
+		batch := rows[start:min(start+w.batchSize, len(rows))]
+		n, err := w.insertBatch(ctx, imp, plan, lookup, batch, stored)
+		if err != nil {
+			return err
+		}
+		stored += n
+		log.Printf("[Job %d] Import %d: %d/%d rows processed", jobID, imp.ID, start+len(batch), len(rows))
+	}
+	return nil
+}
+
+// insertBatch commits one batch of the real import and returns how many
+// problems it added to the error report
+func (w *EntityImportWorker) insertBatch(ctx context.Context, imp *entityImport, plan *importPlan,
+	lookup *importNameLookup, batch []importRecord, stored int) (int, error) {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	if err := assumeImporter(ctx, tx, imp); err != nil {
+		return 0, err
+	}
+	inserted, invalid, problems, err := insertImportBatch(ctx, tx, plan, lookup, batch)
+	if err != nil {
+		return 0, err
+	}
+	problems = problems[:min(len(problems), importStoredProblems-stored)]
+
+	// Back to the worker's own role for the bookkeeping
+	if _, err := tx.Exec(ctx, `SET LOCAL ROLE NONE`); err != nil {
+		return 0, fmt.Errorf("failed to reset role: %w", err)
+	}
+	if err := storeImportProblems(ctx, tx, imp.ID, problems); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE metadata.entity_imports
+		SET processed_rows = processed_rows + $2, imported_rows = imported_rows + $3, invalid_rows = invalid_rows + $4
+		WHERE id = $1
+	`, imp.ID, len(batch), inserted, invalid); err != nil {
+		return 0, fmt.Errorf("failed to record progress: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit batch: %w", err)
+	}
+	return len(problems), nil
+}
+
+// assumeImporter switches the transaction to role authenticated with claims
+// rebuilt from the request, so grants, RLS and triggers see the importer
+func assumeImporter(ctx context.Context, tx pgx.Tx, imp *entityImport) error {
+	claims, err := json.Marshal(map[string]any{
+		"sub":   imp.UserID,
+		"role":  "authenticated",
+		"email": imp.UserEmail,
+		"roles": imp.Roles,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode claims: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		SELECT set_config('request.jwt.claims', $1, true),
+		       set_config('role', 'authenticated', true)
+	`, string(claims)); err != nil {
+		return fmt.Errorf("failed to assume importer: %w", err)
+	}
+	return nil
+}
+
+// pgxExecer is the part of a pool or transaction the error report needs
+type pgxExecer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func storeImportProblems(ctx context.Context, db pgxExecer, importID int64, problems []importProblem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	lines := make([]int, len(problems))
+	columns := make([]*string, len(problems))
+	values := make([]*string, len(problems))
+	messages := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i], columns[i], values[i], messages[i] = p.Line, optionalString(p.Column), optionalString(p.Value), p.Message
+	}
+	_, err := db.Exec(ctx, `
+		INSERT INTO metadata.entity_import_errors (import_id, row_number, column_name, value, message)
+		SELECT $1, p.line, p.col, p.val, p.msg
+		FROM unnest($2::INT[], $3::TEXT[], $4::TEXT[], $5::TEXT[]) AS p(line, col, val, msg)
+	`, importID, lines, columns, values, messages)
+	if err != nil {
+		return fmt.Errorf("failed to record error report: %w", err)
+	}
+	return nil
+}
+
+// ============================================================================
+// Completion
+// ============================================================================
+
+// finish marks the import validated or completed, audits a real import and
+// sends the summary, in one transaction so a retry can't notify twice
+func (w *EntityImportWorker) finish(ctx context.Context, imp *entityImport) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	status := "completed"
+	if imp.DryRun {
+		status = "validated"
+	}
+	var imported, invalid int
+	var columns []string
+	err = tx.QueryRow(ctx, `
+		UPDATE metadata.entity_imports
+		SET status = $2,
+		    validated_at = CASE WHEN $2 = 'validated' THEN NOW() ELSE validated_at END,
+		    completed_at = CASE WHEN $2 = 'completed' THEN NOW() ELSE completed_at END
+		WHERE id = $1 AND status IN ('validating', 'importing')
+		RETURNING imported_rows, invalid_rows, columns
+	`, imp.ID, status).Scan(&imported, &invalid, &columns)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // another attempt got there first
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish import: %w", err)
+	}
+
+	if !imp.DryRun {
+		if err := auditImport(ctx, tx, imp, map[string]any{
+			"row_count":    imported,
+			"invalid_rows": invalid,
+			"columns":      columns,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := w.notify(ctx, tx, imp, status, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// fail marks the import failed and tells the importer why
+func (w *EntityImportWorker) fail(ctx context.Context, imp *entityImport, message string) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE metadata.entity_imports
+		SET status = 'failed', error_message = $2, completed_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'validating', 'importing')
+	`, imp.ID, message)
+	if err != nil {
+		return fmt.Errorf("failed to record import failure: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	if err := w.notify(ctx, tx, imp, "failed", message); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// cancel marks the import cancelled, audits the rows a real import committed,
+// tells the importer and closes the cancellation request, in one transaction
+func (w *EntityImportWorker) cancel(ctx context.Context, jobID int64, imp *entityImport, reason string) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	var processed, imported, valid, invalid int
+	var columns []string
+	err = tx.QueryRow(ctx, `
+		UPDATE metadata.entity_imports
+		SET status = 'cancelled', error_message = NULLIF($2, ''), completed_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'validating', 'importing')
+		RETURNING processed_rows, imported_rows, valid_rows, invalid_rows, columns
+	`, imp.ID, reason).Scan(&processed, &imported, &valid, &invalid, &columns)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to cancel import: %w", err)
+	}
+
+	result := map[string]any{"processed_rows": processed}
+	if err == nil {
+		if imp.DryRun {
+			result["valid_rows"], result["invalid_rows"] = valid, invalid
+		} else {
+			result["imported_rows"], result["invalid_rows"] = imported, invalid
+			if err := auditImport(ctx, tx, imp, map[string]any{
+				"row_count":    imported,
+				"invalid_rows": invalid,
+				"columns":      columns,
+				"cancelled":    true,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := w.notify(ctx, tx, imp, "cancelled", reason); err != nil {
+			return err
+		}
+	}
+	if err := acknowledgeJobCancellation(ctx, tx, jobID, result); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// auditImport records rows committed by a real import in admin_audit_log
+func auditImport(ctx context.Context, tx pgx.Tx, imp *entityImport, data map[string]any) error {
+	data["table_name"], data["import_id"], data["file_name"] = imp.TableName, imp.ID, imp.FileName
+	auditData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit data: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+		VALUES ($1, NULLIF($2, ''), 'data_import', $3)
+	`, imp.UserID, imp.UserEmail, auditData); err != nil {
+		return fmt.Errorf("failed to audit import: %w", err)
+	}
+	return nil
+}
+
+// notify creates the entity_import_summary notification with the first
+// problems of the error report; its insert trigger queues the email
+func (w *EntityImportWorker) notify(ctx context.Context, tx pgx.Tx, imp *entityImport, status, reason string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO metadata.notifications (user_id, template_name, entity_type, entity_id, entity_data, channels)
+		SELECT i.user_id, 'entity_import_summary', 'entity_imports', i.id::TEXT,
+		       jsonb_build_object(
+		           'id', i.id,
+		           'status', $2::TEXT,
+		           'table_name', i.table_name,
+		           'display_name', $3::TEXT,
+		           'file_name', i.file_name,
+		           'error_message', COALESCE($4::TEXT, ''),
+		           'total_rows', i.total_rows,
+		           'valid_rows', i.valid_rows,
+		           'invalid_rows', i.invalid_rows,
+		           'imported_rows', i.imported_rows,
+		           'ignored_headers', array_to_string(i.ignored_headers, ', '),
+		           'problems', COALESCE((
+		               SELECT jsonb_agg(jsonb_build_object(
+		                          'row_number', p.row_number, 'column', COALESCE(p.column_name, ''),
+		                          'value', COALESCE(p.value, ''), 'message', p.message)
+		                      ORDER BY p.row_number, p.id)
+		               FROM (SELECT * FROM metadata.entity_import_errors e
+		                     WHERE e.import_id = i.id
+		                     ORDER BY e.row_number, e.id LIMIT $5) p
+		           ), '[]'::JSONB),
+		           'more_problems', GREATEST((
+		               SELECT COUNT(*) FROM metadata.entity_import_errors e WHERE e.import_id = i.id
+		           ) - $5, 0)
+		       ),
+		       '{email}'
+		FROM metadata.entity_imports i
+		WHERE i.id = $1
+	`, imp.ID, status, imp.DisplayName, reason, importSummaryProblems)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	return nil
+}
+
+// ============================================================================
+// Columns and Header Mapping
+// ============================================================================
+
+// importColumn is one column rows can be imported into
+type importColumn struct {
+	Name     string
+	Header   string // metadata.properties display name, or the column name
+	Type     string // format_type(), e.g. "integer", "character varying(50)"
+	Required bool   // NOT NULL without a default
+	Checked  bool   // input can be checked with pg_input_error_info()
+	Range    bool   // tstzrange: also accepts "(Start)" and "(End)" columns
+	RefTable string // referenced table of a single-column foreign key, quoted
+	RefKey   string // referenced column, quoted
+	RefNames bool   // the referenced table has display_name: "(Name)" columns resolve
+}
+
+// importConstraint is what the error report says when a constraint fails
+type importConstraint struct {
+	Columns []string
+	Message string // metadata.constraint_messages, if any
+}
+
+// loadColumns reads the insertable columns of a public table in list
+// order. Like the browser import, id, created_at and updated_at are left
+// out, as are generated, always-identity and tsvector columns. Built-in
+// types, enums and ranges report bad input as soft errors, so their values
+// can be checked before the INSERT; others (PostGIS) are left to it.
+func (w *EntityImportWorker) loadColumns(ctx context.Context, tableName string) ([]*importColumn, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT a.attname, COALESCE(p.display_name, initcap(replace(a.attname, '_', ' '))),
+		       format_type(a.atttypid, a.atttypmod),
+		       a.attnotnull AND NOT a.atthasdef AND a.attidentity = '',
+		       et.typnamespace = 'pg_catalog'::regnamespace OR et.typtype IN ('e', 'r'),
+		       t.typname = 'tstzrange',
+		       COALESCE(fk.ref_table, ''), COALESCE(fk.ref_key, ''), COALESCE(fk.ref_names, false)
+		FROM pg_attribute a
+		JOIN pg_type t ON t.oid = a.atttypid
+		JOIN pg_type bt ON bt.oid = CASE WHEN t.typtype = 'd' THEN t.typbasetype ELSE t.oid END
+		JOIN pg_type et ON et.oid = CASE WHEN bt.typcategory = 'A' THEN bt.typelem ELSE bt.oid END
+		LEFT JOIN metadata.properties p ON p.table_name = $1 AND p.column_name = a.attname
+		LEFT JOIN LATERAL (
+			SELECT format('%I.%I', n.nspname, r.relname) AS ref_table,
+			       quote_ident(rk.attname) AS ref_key,
+			       EXISTS (SELECT 1 FROM pg_attribute d
+			               WHERE d.attrelid = c.confrelid AND d.attname = 'display_name' AND NOT d.attisdropped) AS ref_names
+			FROM pg_constraint c
+			JOIN pg_class r ON r.oid = c.confrelid
+			JOIN pg_namespace n ON n.oid = r.relnamespace
+			JOIN pg_attribute rk ON rk.attrelid = c.confrelid AND rk.attnum = c.confkey[1]
+			WHERE c.conrelid = a.attrelid AND c.contype = 'f' AND c.conkey = ARRAY[a.attnum]
+			LIMIT 1
+		) fk ON true
+		WHERE a.attrelid = to_regclass(format('public.%I', $1::TEXT))
+		  AND a.attnum > 0 AND NOT a.attisdropped
+		  AND a.attgenerated = '' AND a.attidentity <> 'a'
+		  AND t.typname <> 'tsvector'
+		  AND a.attname NOT IN ('id', 'created_at', 'updated_at')
+		ORDER BY COALESCE(p.sort_order, a.attnum), a.attnum
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	columns, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*importColumn, error) {
+		c := &importColumn{}
+		err := row.Scan(&c.Name, &c.Header, &c.Type, &c.Required, &c.Checked, &c.Range, &c.RefTable, &c.RefKey, &c.RefNames)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return nil, importRequestErrorf("table %q not found or has no importable columns", tableName)
+	}
+	return columns, nil
+}
+
+// loadConstraints reads the table's constraints and their custom messages
+func (w *EntityImportWorker) loadConstraints(ctx context.Context, tableName string) (map[string]importConstraint, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT c.conname, COALESCE(m.error_message, ''),
+		       ARRAY(SELECT a.attname::TEXT FROM pg_attribute a
+		             WHERE a.attrelid = c.conrelid AND a.attnum = ANY(c.conkey) ORDER BY a.attnum)
+		FROM pg_constraint c
+		LEFT JOIN metadata.constraint_messages m ON m.constraint_name = c.conname
+		WHERE c.conrelid = to_regclass(format('public.%I', $1::TEXT))
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load constraints: %w", err)
+	}
+	defer rows.Close()
+	constraints := map[string]importConstraint{}
+	for rows.Next() {
+		var name string
+		var c importConstraint
+		if err := rows.Scan(&name, &c.Message, &c.Columns); err != nil {
+			return nil, fmt.Errorf("failed to scan constraint: %w", err)
+		}
+		constraints[name] = c
+	}
+	return constraints, rows.Err()
+}
+
+// Parts of a column a file column can hold
+const (
+	importPartValue = ""      // the value itself (an ID for foreign keys)
+	importPartName  = "name"  // "(Name)": the referenced row's display_name
+	importPartStart = "start" // "(Start)": lower bound of a time slot
+	importPartEnd   = "end"   // "(End)": upper bound of a time slot
+)
+
+// importField is a file column mapped to a table column
+type importField struct {
+	Column *importColumn
+	Part   string
+}
+
+// importPlan is how the cells of a file become the columns of a row
+type importPlan struct {
+	tableName   string
+	columns     []*importColumn                  // mapped columns in insert order
+	fields      map[*importColumn]map[string]int // column -> part -> cell index
+	ignored     []string                         // headers not imported
+	constraints map[string]importConstraint
+}
+
+func (p *importPlan) columnNames() []string {
+	names := make([]string, len(p.columns))
+	for i, col := range p.columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func (p *importPlan) column(name string) *importColumn {
+	for _, col := range p.columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+// importHeaderKeys maps normalized headers to the columns and parts they
+// name: column name or display name, with "(Name)", "(Start)" and "(End)"
+// variants where they apply
+func importHeaderKeys(columns []*importColumn) map[string]importField {
+	keys := map[string]importField{}
+	add := func(label string, col *importColumn, part string) {
+		key := normalizeImportHeader(label)
+		if _, taken := keys[key]; !taken {
+			keys[key] = importField{Column: col, Part: part}
+		}
+	}
+	for _, col := range columns {
+		for _, label := range []string{col.Name, col.Header} {
+			add(label, col, importPartValue)
+			if col.RefNames {
+				add(label+" (Name)", col, importPartName)
+			}
+			if col.Range {
+				add(label+" (Start)", col, importPartStart)
+				add(label+" (End)", col, importPartEnd)
+			}
+		}
+	}
+	return keys
+}
+
+// planImport finds the header row among the first few records (the one
+// naming the most columns), maps its cells and returns the data rows after
+// it. Overrides map a header to a column name, with the same suffixes as
+// headers; a nil override ignores the header.
+func planImport(records []importRecord, columns []*importColumn, overrides map[string]*string) (*importPlan, []importRecord, error) {
+	keys := importHeaderKeys(columns)
+	byName := map[string]importField{}
+	for key, field := range keys {
+		if key == normalizeImportHeader(field.Column.Name) ||
+			strings.HasPrefix(key, normalizeImportHeader(field.Column.Name)+"_(") {
+			byName[key] = field
+		}
+	}
+
+	for _, target := range overrides {
+		if target != nil {
+			if _, ok := byName[normalizeImportHeader(*target)]; !ok {
+				return nil, nil, importRequestErrorf("the column map names unknown column %q", *target)
+			}
+		}
+	}
+	match := func(header string) (importField, bool) {
+		if target, ok := overrides[header]; ok {
+			if target == nil {
+				return importField{}, false
+			}
+			return byName[normalizeImportHeader(*target)], true
+		}
+		field, ok := keys[normalizeImportHeader(header)]
+		return field, ok
+	}
+
+	headerAt, best := -1, 0
+	for i := 0; i < min(len(records), importHeaderSearchRows); i++ {
+		n := 0
+		for _, cell := range records[i].Cells {
+			if _, ok := match(cell); ok {
+				n++
+			}
+		}
+		if n > best {
+			headerAt, best = i, n
+		}
+	}
+	if headerAt < 0 {
+		return nil, nil, importRequestErrorf("no header row matches the columns of this table")
+	}
+
+	plan := &importPlan{fields: map[*importColumn]map[string]int{}, ignored: []string{}}
+	for i, header := range records[headerAt].Cells {
+		if header == "" {
+			continue
+		}
+		field, ok := match(header)
+		if !ok {
+			if target, listed := overrides[header]; !listed || target != nil {
+				plan.ignored = append(plan.ignored, header)
+			}
+			continue
+		}
+		parts := plan.fields[field.Column]
+		if parts == nil {
+			parts = map[string]int{}
+			plan.fields[field.Column] = parts
+		}
+		if _, dup := parts[field.Part]; dup {
+			plan.ignored = append(plan.ignored, header)
+			continue
+		}
+		parts[field.Part] = i
+	}
+
+	for _, col := range columns {
+		parts, ok := plan.fields[col]
+		switch {
+		case ok:
+			plan.columns = append(plan.columns, col)
+			if col.Range && !hasPart(parts, importPartValue) &&
+				hasPart(parts, importPartStart) != hasPart(parts, importPartEnd) {
+				return nil, nil, importRequestErrorf("%s needs both a (Start) and an (End) column", col.Header)
+			}
+		case col.Required:
+			return nil, nil, importRequestErrorf("the file has no %s column, which is required", col.Header)
+		}
+	}
+	return plan, records[headerAt+1:], nil
+}
+
+func hasPart(parts map[string]int, part string) bool {
+	_, ok := parts[part]
+	return ok
+}
+
+// ============================================================================
+// Row Processing
+// ============================================================================
+
+// importCell is the text to insert into one column of a row
+type importCell struct {
+	Column *importColumn
+	Value  string
+}
+
+// rowCells turns a record into the cells to insert; blank cells are left
+// out so column defaults apply. Foreign keys given only by name are
+// returned separately for lookup.
+func (p *importPlan) rowCells(rec importRecord) (cells []importCell, names []importCell, problems []importProblem) {
+	cell := func(i int) string {
+		if i < len(rec.Cells) {
+			return rec.Cells[i]
+		}
+		return ""
+	}
+	for _, col := range p.columns {
+		parts := p.fields[col]
+		if i, ok := parts[importPartValue]; ok && cell(i) != "" {
+			cells = append(cells, importCell{col, cell(i)})
+			continue
+		}
+		if i, ok := parts[importPartName]; ok && cell(i) != "" {
+			names = append(names, importCell{col, cell(i)})
+			continue
+		}
+		if hasPart(parts, importPartStart) {
+			start, end := cell(parts[importPartStart]), cell(parts[importPartEnd])
+			switch {
+			case start != "" && end != "":
+				cells = append(cells, importCell{col, tstzrangeLiteral(start, end)})
+			case start != "" || end != "":
+				problems = append(problems, importProblem{Line: rec.Line, Column: col.Name, Value: start + end,
+					Message: fmt.Sprintf("%s needs both a start and an end", col.Header)})
+			}
+		}
+	}
+	return cells, names, problems
+}
+
+// tstzrangeLiteral builds the range text for a time slot, end excluded
+func tstzrangeLiteral(start, end string) string {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	return "[" + quote(start) + "," + quote(end) + ")"
+}
+
+// importNameLookup resolves "(Name)" cells to IDs, loading each referenced
+// table's names once per job. The lookup runs as the importer, so it only
+// finds rows they can see.
+type importNameLookup struct {
+	tables map[string]map[string][]string // table -> lower(display_name) -> IDs
+}
+
+func newImportNameLookup() *importNameLookup {
+	return &importNameLookup{tables: map[string]map[string][]string{}}
+}
+
+func (l *importNameLookup) resolve(ctx context.Context, tx pgx.Tx, col *importColumn, name string) (string, string, error) {
+	names, ok := l.tables[col.RefTable]
+	if !ok {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to begin savepoint: %w", err)
+		}
+		rows, err := sp.Query(ctx, fmt.Sprintf(`SELECT %s::text, display_name::text FROM %s WHERE display_name IS NOT NULL`,
+			col.RefKey, col.RefTable))
+		if err == nil {
+			names = map[string][]string{}
+			for rows.Next() {
+				var id, display string
+				if err = rows.Scan(&id, &display); err != nil {
+					break
+				}
+				key := strings.ToLower(strings.TrimSpace(display))
+				names[key] = append(names[key], id)
+			}
+			rows.Close()
+			if err == nil {
+				err = rows.Err()
+			}
+		}
+		if err != nil {
+			_ = sp.Rollback(ctx)
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "42501" {
+				return "", "", importRequestErrorf("you can't read the names %s refers to; use its ID column instead", col.Header)
+			}
+			return "", "", fmt.Errorf("failed to load names for %s: %w", col.Name, err)
+		}
+		if err := sp.Commit(ctx); err != nil {
+			return "", "", fmt.Errorf("failed to release savepoint: %w", err)
+		}
+		l.tables[col.RefTable] = names
+	}
+
+	switch ids := names[strings.ToLower(strings.TrimSpace(name))]; len(ids) {
+	case 0:
+		return "", fmt.Sprintf("%s %q not found", col.Header, name), nil
+	case 1:
+		return ids[0], "", nil
+	default:
+		return "", fmt.Sprintf("%s %q matches several records (IDs %s); use the ID column instead",
+			col.Header, name, strings.Join(ids, ", ")), nil
+	}
+}
+
+// insertImportBatch checks and inserts a batch of rows in tx as the
+// importer, each row under its own savepoint so a failing row doesn't undo
+// the others. It returns the rows inserted, the rows rejected and their
+// problems; errors are returned only when the batch can't go on.
+func insertImportBatch(ctx context.Context, tx pgx.Tx, plan *importPlan, lookup *importNameLookup,
+	batch []importRecord) (inserted, invalid int, problems []importProblem, err error) {
+	rows := make([][]importCell, len(batch))
+	rejected := make([]bool, len(batch))
+	reject := func(i int, p ...importProblem) {
+		problems = append(problems, p...)
+		if !rejected[i] {
+			rejected[i] = true
+			invalid++
+		}
+	}
+
+	for i, rec := range batch {
+		cells, names, rowProblems := plan.rowCells(rec)
+		if len(rowProblems) > 0 {
+			reject(i, rowProblems...)
+		}
+		for _, n := range names {
+			id, problem, err := lookup.resolve(ctx, tx, n.Column, n.Value)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			if problem != "" {
+				reject(i, importProblem{Line: rec.Line, Column: n.Column.Name, Value: n.Value, Message: problem})
+				continue
+			}
+			cells = append(cells, importCell{n.Column, id})
+		}
+		rows[i] = cells
+	}
+
+	// Values are checked against their column types in one query, which
+	// names the offending column where a failed INSERT would not
+	var refs [][2]int
+	var values, types []string
+	for i, cells := range rows {
+		for j, c := range cells {
+			if !c.Column.Checked {
+				continue
+			}
+			refs = append(refs, [2]int{i, j})
+			values = append(values, c.Value)
+			types = append(types, c.Column.Type)
+		}
+	}
+	if len(values) > 0 {
+		result, err := tx.Query(ctx, `
+			SELECT c.n::INT - 1, e.message
+			FROM unnest($1::TEXT[], $2::TEXT[]) WITH ORDINALITY AS c(v, t, n),
+			     LATERAL pg_input_error_info(c.v, c.t) e
+			WHERE e.message IS NOT NULL
+		`, values, types)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("failed to check values: %w", err)
+		}
+		for result.Next() {
+			var k int
+			var message string
+			if err := result.Scan(&k, &message); err != nil {
+				result.Close()
+				return 0, 0, nil, fmt.Errorf("failed to check values: %w", err)
+			}
+			i, j := refs[k][0], refs[k][1]
+			c := rows[i][j]
+			reject(i, importProblem{Line: batch[i].Line, Column: c.Column.Name, Value: c.Value,
+				Message: fmt.Sprintf("%s: %s", c.Column.Header, message)})
+		}
+		result.Close()
+		if err := result.Err(); err != nil {
+			return 0, 0, nil, fmt.Errorf("failed to check values: %w", err)
+		}
+	}
+
+	for i, cells := range rows {
+		if rejected[i] {
+			continue
+		}
+		if len(cells) == 0 {
+			reject(i, importProblem{Line: batch[i].Line, Message: "the row has no values for the imported columns"})
+			continue
+		}
+		query, args := importInsertQuery(plan, cells)
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("failed to begin savepoint: %w", err)
+		}
+		if _, execErr := sp.Exec(ctx, query, args...); execErr != nil {
+			if err := sp.Rollback(ctx); err != nil {
+				return 0, 0, nil, fmt.Errorf("failed to roll back row %d: %w", batch[i].Line, err)
+			}
+			problem, err := importInsertProblem(execErr, plan, batch[i].Line, cells)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			reject(i, problem)
+			continue
+		}
+		if err := sp.Commit(ctx); err != nil {
+			return 0, 0, nil, fmt.Errorf("failed to release savepoint: %w", err)
+		}
+		inserted++
+	}
+	return inserted, invalid, problems, nil
+}
+
+// importInsertQuery builds the INSERT for one row. Every value is a text
+// parameter cast to its column's type; identifiers and types come from the
+// catalog.
+func importInsertQuery(plan *importPlan, cells []importCell) (string, []any) {
+	names := make([]string, len(cells))
+	params := make([]string, len(cells))
+	args := make([]any, len(cells))
+	for i, c := range cells {
+		names[i] = pgx.Identifier{c.Column.Name}.Sanitize()
+		params[i] = fmt.Sprintf("$%d::text::%s", i+1, c.Column.Type)
+		args[i] = c.Value
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", plan.table(),
+		strings.Join(names, ", "), strings.Join(params, ", ")), args
+}
+
+func (p *importPlan) table() string {
+	return pgx.Identifier{"public", p.tableName}.Sanitize()
+}
+
+// importInsertProblem explains why a row's INSERT failed, naming the column
+// where the error allows. Errors that are not about the row (lost
+// connection, no permission on the table) are returned as errors.
+func importInsertProblem(err error, plan *importPlan, line int, cells []importCell) (importProblem, error) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return importProblem{}, fmt.Errorf("insert failed at row %d: %w", line, err)
+	}
+	problem := importProblem{Line: line, Message: pgErr.Message}
+	setColumn := func(name string) {
+		problem.Column = name
+		for _, c := range cells {
+			if c.Column.Name == name {
+				problem.Value = c.Value
+			}
+		}
+	}
+	header := func(name string) string {
+		if col := plan.column(name); col != nil {
+			return col.Header
+		}
+		return name
+	}
+
+	constraint, known := plan.constraints[pgErr.ConstraintName]
+	if known && len(constraint.Columns) == 1 {
+		setColumn(constraint.Columns[0])
+	} else if pgErr.ColumnName != "" {
+		setColumn(pgErr.ColumnName)
+	}
+
+	switch code := pgErr.Code; {
+	case known && constraint.Message != "":
+		problem.Message = constraint.Message
+	case code == "23502":
+		problem.Message = fmt.Sprintf("%s is required", header(pgErr.ColumnName))
+	case code == "23503" && problem.Column != "":
+		problem.Message = fmt.Sprintf("%s %q does not exist", header(problem.Column), problem.Value)
+	case code == "23505" && problem.Column != "":
+		problem.Message = fmt.Sprintf("%s %q is already used", header(problem.Column), problem.Value)
+	case code == "23505":
+		problem.Message = "duplicates an existing row: " + pgErr.Detail
+	case code == "23514" && problem.Column != "":
+		problem.Message = fmt.Sprintf("%s %q is not allowed (%s)", header(problem.Column), problem.Value, pgErr.ConstraintName)
+	case code == "42501" && strings.HasPrefix(pgErr.Message, "new row violates row-level security"):
+		problem.Message = "you can't create this row"
+	case code == "42501":
+		return importProblem{}, importRequestErrorf("you don't have permission to add these rows: %s", pgErr.Message)
+	case len(code) == 5 && strings.Contains("08 40 53 57 58 XX", code[:2]):
+		// Connection, serialization, resources, shutdown: retry the job
+		return importProblem{}, fmt.Errorf("insert failed at row %d: %w", line, err)
+	}
+	return problem, nil
+}
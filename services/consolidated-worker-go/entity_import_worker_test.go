@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func importTestColumns() []*importColumn {
+	return []*importColumn{
+		{Name: "title", Header: "Title", Type: "character varying(100)", Required: true, Checked: true},
+		{Name: "status_id", Header: "Status", Type: "integer", Checked: true,
+			RefTable: "public.statuses", RefKey: "id", RefNames: true},
+		{Name: "slot", Header: "Reserved", Type: "tstzrange", Range: true, Checked: true},
+		{Name: "location", Header: "Location", Type: "geography(Point,4326)"},
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	records := []importRecord{
+		{Line: 1, Cells: []string{"Text (max 100 chars)", "Number"}},
+		{Line: 2, Cells: []string{"Title", "Status (Name)", "Reserved (Start)", "Reserved (End)", "Notes", "ID"}},
+		{Line: 3, Cells: []string{"Pothole", "Open", "2026-01-01 10:00", "2026-01-01 11:00"}},
+	}
+	plan, rows, err := planImport(records, importTestColumns(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plan.columnNames(); !reflect.DeepEqual(got, []string{"title", "status_id", "slot"}) {
+		t.Errorf("columns = %v", got)
+	}
+	if !reflect.DeepEqual(plan.ignored, []string{"Notes", "ID"}) {
+		t.Errorf("ignored = %v", plan.ignored)
+	}
+	if len(rows) != 1 || rows[0].Line != 3 {
+		t.Errorf("rows = %v, want the line after the header", rows)
+	}
+	status := plan.column("status_id")
+	if !reflect.DeepEqual(plan.fields[status], map[string]int{importPartName: 1}) {
+		t.Errorf("status fields = %v", plan.fields[status])
+	}
+}
+
+func TestPlanImportOverrides(t *testing.T) {
+	records := []importRecord{{Line: 1, Cells: []string{"Name", "State", "Junk"}}}
+	stateName := "status_id (Name)"
+	plan, _, err := planImport(records, importTestColumns(), map[string]*string{
+		"Name":  strPtr("title"),
+		"State": &stateName,
+		"Junk":  nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plan.columnNames(); !reflect.DeepEqual(got, []string{"title", "status_id"}) {
+		t.Errorf("columns = %v", got)
+	}
+	if len(plan.ignored) != 0 {
+		t.Errorf("ignored = %v, want headers mapped to null left out", plan.ignored)
+	}
+
+	_, _, err = planImport(records, importTestColumns(), map[string]*string{"Name": strPtr("nope")})
+	if !strings.Contains(fmt.Sprint(err), `unknown column "nope"`) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestPlanImportRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    string
+	}{
+		{"no header", []string{"foo", "bar"}, "no header row"},
+		{"required missing", []string{"Status"}, "no Title column"},
+		{"half a range", []string{"Title", "Reserved (Start)"}, "both a (Start) and an (End)"},
+	}
+	for _, tt := range tests {
+		_, _, err := planImport([]importRecord{{Line: 1, Cells: tt.headers}}, importTestColumns(), nil)
+		var requestErr *importRequestError
+		if !errors.As(err, &requestErr) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want request error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestImportRowCells(t *testing.T) {
+	records := []importRecord{
+		{Line: 1, Cells: []string{"title", "Status", "Status (Name)", "Reserved (Start)", "Reserved (End)"}},
+	}
+	plan, _, err := planImport(records, importTestColumns(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cells, names, problems := plan.rowCells(importRecord{Line: 2, Cells: []string{"A", "3", "Open", "9:00", "10:00"}})
+	if len(problems) != 0 || len(names) != 0 {
+		t.Fatalf("names = %v, problems = %v", names, problems)
+	}
+	got := map[string]string{}
+	for _, c := range cells {
+		got[c.Column.Name] = c.Value
+	}
+	want := map[string]string{"title": "A", "status_id": "3", "slot": `["9:00","10:00")`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cells = %v, want %v (ID before name)", got, want)
+	}
+
+	cells, names, problems = plan.rowCells(importRecord{Line: 3, Cells: []string{"B", "", "Open", "9:00"}})
+	if len(cells) != 1 || len(names) != 1 || names[0].Value != "Open" {
+		t.Errorf("cells = %v, names = %v", cells, names)
+	}
+	if len(problems) != 1 || problems[0].Line != 3 || problems[0].Column != "slot" {
+		t.Errorf("problems = %v, want the half-filled time slot", problems)
+	}
+}
+
+func TestTstzrangeLiteral(t *testing.T) {
+	if got := tstzrangeLiteral(`a"b`, `c\d`); got != `["a\"b","c\\d")` {
+		t.Errorf("tstzrangeLiteral = %s", got)
+	}
+}
+
+func TestImportInsertQuery(t *testing.T) {
+	columns := importTestColumns()
+	plan := &importPlan{tableName: "issues"}
+	query, args := importInsertQuery(plan, []importCell{{columns[0], "A"}, {columns[3], "POINT(1 2)"}})
+	want := `INSERT INTO "public"."issues" ("title", "location") VALUES ($1::text::character varying(100), $2::text::geography(Point,4326))`
+	if query != want {
+		t.Errorf("query = %s\nwant    %s", query, want)
+	}
+	if !reflect.DeepEqual(args, []any{"A", "POINT(1 2)"}) {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestImportInsertProblem(t *testing.T) {
+	columns := importTestColumns()
+	plan := &importPlan{
+		columns: columns,
+		constraints: map[string]importConstraint{
+			"issues_status_id_fkey": {Columns: []string{"status_id"}},
+			"issues_title_key":      {Columns: []string{"title"}},
+			"issues_title_check":    {Columns: []string{"title"}, Message: "Title must not shout"},
+		},
+	}
+	cells := []importCell{{columns[0], "A"}, {columns[1], "99"}}
+
+	tests := []struct {
+		name    string
+		err     *pgconn.PgError
+		column  string
+		message string
+	}{
+		{"not null", &pgconn.PgError{Code: "23502", ColumnName: "title", Message: "null value"}, "title", "Title is required"},
+		{"foreign key", &pgconn.PgError{Code: "23503", ConstraintName: "issues_status_id_fkey"}, "status_id", `Status "99" does not exist`},
+		{"unique", &pgconn.PgError{Code: "23505", ConstraintName: "issues_title_key"}, "title", `Title "A" is already used`},
+		{"custom message", &pgconn.PgError{Code: "23514", ConstraintName: "issues_title_check"}, "title", "Title must not shout"},
+		{"rls", &pgconn.PgError{Code: "42501", Message: `new row violates row-level security policy for table "issues"`}, "", "you can't create this row"},
+		{"trigger", &pgconn.PgError{Code: "P0001", Message: "Closed issues need a resolution"}, "", "Closed issues need a resolution"},
+	}
+	for _, tt := range tests {
+		problem, err := importInsertProblem(tt.err, plan, 7, cells)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if problem.Line != 7 || problem.Column != tt.column || problem.Message != tt.message {
+			t.Errorf("%s: problem = %+v, want column %q message %q", tt.name, problem, tt.column, tt.message)
+		}
+	}
+
+	_, err := importInsertProblem(&pgconn.PgError{Code: "42501", Message: "permission denied for table issues"}, plan, 7, cells)
+	var requestErr *importRequestError
+	if !errors.As(err, &requestErr) {
+		t.Errorf("permission denied: err = %v, want a request error", err)
+	}
+	for _, code := range []string{"40001", "57014", "08006"} {
+		_, err := importInsertProblem(&pgconn.PgError{Code: code}, plan, 7, cells)
+		if err == nil || errors.As(err, &requestErr) {
+			t.Errorf("%s: err = %v, want a retryable error", code, err)
+		}
+	}
+}
+
+func TestEntityImportArgsUnique(t *testing.T) {
+	opts := EntityImportArgs{}.InsertOpts()
+	if !opts.UniqueOpts.ByArgs || !reflect.DeepEqual(opts.UniqueOpts.ByState, notifyJobUniqueStates) {
+		t.Errorf("UniqueOpts = %+v, want by args while queued or running", opts.UniqueOpts)
+	}
+	if opts.Queue != "imports" {
+		t.Errorf("Queue = %q", opts.Queue)
+	}
+}
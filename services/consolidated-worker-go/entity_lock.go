@@ -0,0 +1,159 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Entity Soft Locks
+//
+// Batch workers lock each entity row they touch through
+// metadata.try_lock_entity() (see migration v0-79-0-entity-soft-locks): a
+// transaction-scoped advisory lock, refused while a user has the row open in
+// the Edit page (metadata.entity_soft_locks lease) or another batch operation
+// holds it. The lock is released when the caller's transaction ends.
+//
+// Rows that can't be locked are logged to metadata.entity_lock_conflicts so
+// admins can see what a job left alone and why.
+// ============================================================================
+
+// EntityLockPolicy decides what happens when a row is already locked
+type EntityLockPolicy string
+
+const (
+	// EntityLockWait polls until the lock is free or the timeout passes
+	EntityLockWait EntityLockPolicy = "wait"
+	// EntityLockSkip gives up immediately
+	EntityLockSkip EntityLockPolicy = "skip"
+)
+
+// EntityLock describes one row a batch operation wants to lock
+type EntityLock struct {
+	EntityType string
+	EntityID   string
+	Policy     EntityLockPolicy
+	Timeout    time.Duration // Wait policy only
+	Operation  string        // Logged with conflicts, e.g. "expand_recurring_series"
+	JobID      int64         // River job, if any
+}
+
+// EntityLockConflict reports a row that could not be locked
+type EntityLockConflict struct {
+	EntityType string
+	EntityID   string
+	HeldBy     string // User whose lease blocked the lock; "" = another batch operation
+}
+
+func (c *EntityLockConflict) Error() string {
+	if c.HeldBy != "" {
+		return fmt.Sprintf("%s %s is being edited by user %s", c.EntityType, c.EntityID, c.HeldBy)
+	}
+	return fmt.Sprintf("%s %s is locked by another batch operation", c.EntityType, c.EntityID)
+}
+
+// wait returns how long try_lock_entity() may poll for this lock
+func (l EntityLock) wait() time.Duration {
+	if l.Policy != EntityLockWait || l.Timeout < 0 {
+		return 0
+	}
+	return l.Timeout
+}
+
+// lockEntity locks a row for the rest of tx. It returns a nil conflict when
+// the lock was taken. Otherwise the conflict is recorded outside tx (through
+// dbPool), so the record survives the caller rolling tx back.
+func lockEntity(ctx context.Context, dbPool *pgxpool.Pool, tx pgx.Tx, lock EntityLock) (*EntityLockConflict, error) {
+	var locked bool
+	err := tx.QueryRow(ctx,
+		"SELECT metadata.try_lock_entity($1, $2, $3::interval)",
+		lock.EntityType, lock.EntityID, intervalMillis(lock.wait()),
+	).Scan(&locked)
+	if err != nil {
+		return nil, fmt.Errorf("try_lock_entity(%s, %s): %w", lock.EntityType, lock.EntityID, err)
+	}
+	if locked {
+		return nil, nil
+	}
+
+	conflict := &EntityLockConflict{EntityType: lock.EntityType, EntityID: lock.EntityID}
+
+	var jobID *int64
+	if lock.JobID != 0 {
+		jobID = &lock.JobID
+	}
+	var heldBy *string
+	err = dbPool.QueryRow(ctx,
+		"SELECT metadata.record_entity_lock_conflict($1, $2, $3, $4, $5)::text",
+		lock.EntityType, lock.EntityID, lock.Operation, string(lock.Policy), jobID,
+	).Scan(&heldBy)
+	if err != nil {
+		// Reporting is best-effort; the caller still needs the conflict
+		log.Printf("[EntityLock] Failed to record conflict on %s %s: %v", lock.EntityType, lock.EntityID, err)
+	} else if heldBy != nil {
+		conflict.HeldBy = *heldBy
+	}
+
+	return conflict, nil
+}
+
+// intervalMillis formats a duration as a PostgreSQL interval literal with
+// millisecond precision
+func intervalMillis(d time.Duration) string {
+	return fmt.Sprintf("%d milliseconds", d.Milliseconds())
+}
+
+// ============================================================================
+// Entity Lock Cleanup Maintenance Task
+//
+// Expired leases are already ignored; this keeps both tables small.
+// Scheduled by MaintenanceScheduler (task "entity_lock_cleanup").
+// ============================================================================
+
+// entityLockConflictRetention is how long conflict records are kept
+const entityLockConflictRetention = 30 * 24 * time.Hour
+
+// EntityLockCleanupTask purges expired leases and old conflict records
+type EntityLockCleanupTask struct {
+	dbPool *pgxpool.Pool
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (e *EntityLockCleanupTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "entity_lock_cleanup",
+		Description: "Delete expired entity edit leases and lock conflicts older than 30 days",
+		Interval:    1 * time.Hour,
+		Jitter:      5 * time.Minute,
+		Run:         e.runCleanup,
+	}
+}
+
+// runCleanup deletes leases that expired over an hour ago and old conflicts
+func (e *EntityLockCleanupTask) runCleanup(ctx context.Context) (string, error) {
+	leases, err := e.dbPool.Exec(ctx, `
+		DELETE FROM metadata.entity_soft_locks
+		WHERE expires_at < NOW() - INTERVAL '1 hour'
+	`)
+	if err != nil {
+		return "", fmt.Errorf("delete expired leases: %w", err)
+	}
+
+	conflicts, err := e.dbPool.Exec(ctx, `
+		DELETE FROM metadata.entity_lock_conflicts
+		WHERE created_at < NOW() - $1::interval
+	`, intervalString(entityLockConflictRetention))
+	if err != nil {
+		return "", fmt.Errorf("delete old conflicts: %w", err)
+	}
+
+	return fmt.Sprintf("Deleted %d expired leases and %d old conflicts",
+		leases.RowsAffected(), conflicts.RowsAffected()), nil
+}
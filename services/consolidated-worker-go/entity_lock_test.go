@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEntityLockWait(t *testing.T) {
+	tests := []struct {
+		name string
+		lock EntityLock
+		want time.Duration
+	}{
+		{"skip ignores timeout", EntityLock{Policy: EntityLockSkip, Timeout: time.Minute}, 0},
+		{"wait uses timeout", EntityLock{Policy: EntityLockWait, Timeout: 30 * time.Second}, 30 * time.Second},
+		{"negative timeout never waits", EntityLock{Policy: EntityLockWait, Timeout: -time.Second}, 0},
+		{"unset policy skips", EntityLock{Timeout: time.Second}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.lock.wait(); got != tt.want {
+				t.Errorf("wait() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntervalMillis(t *testing.T) {
+	if got := intervalMillis(0); got != "0 milliseconds" {
+		t.Errorf("intervalMillis(0) = %q", got)
+	}
+	if got := intervalMillis(1500 * time.Millisecond); got != "1500 milliseconds" {
+		t.Errorf("intervalMillis(1.5s) = %q", got)
+	}
+}
+
+func TestEntityLockConflictError(t *testing.T) {
+	byUser := &EntityLockConflict{EntityType: "appointments", EntityID: "7", HeldBy: "u-1"}
+	if got, want := byUser.Error(), "appointments 7 is being edited by user u-1"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	byJob := &EntityLockConflict{EntityType: "time_slot_series", EntityID: "3"}
+	if got, want := byJob.Error(), "time_slot_series 3 is locked by another batch operation"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,565 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Entity Subscriptions
+//
+// metadata.queue_entity_subscription_fanout() (see migration
+// v0-109-0-entity-subscriptions) queues a fan_out_notification job when a
+// row of a table with subscriptions changes. The worker reads the row as
+// each subscriber, so RLS, grants and column privacy decide what they see,
+// checks their filters and inserts one metadata.notifications row per
+// subscriber. Those rows queue send_notification like any other
+// notification.
+// ============================================================================
+
+// FanOutNotificationArgs is one change to a row of a subscribed table, as
+// queued by the fan-out trigger
+type FanOutNotificationArgs struct {
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	Event      string          `json:"event"` // insert, update or delete
+	OldRow     json.RawMessage `json:"old_row,omitempty"`
+	NewRow     json.RawMessage `json:"new_row,omitempty"`
+	ActorID    string          `json:"actor_id,omitempty"` // Not notified of their own change
+}
+
+// Kind returns the job type identifier
+func (FanOutNotificationArgs) Kind() string { return "fan_out_notification" }
+
+// InsertOpts returns job insertion options
+func (FanOutNotificationArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "notifications",
+		MaxAttempts: 5,
+		Priority:    2,
+	}
+}
+
+// entitySubscription is a metadata.entity_subscriptions row with the
+// subscriber's current roles
+type entitySubscription struct {
+	ID           int64
+	UserID       string
+	EntityID     *string // nil: every row matching Filters
+	Filters      []exportFilter
+	Channels     []string
+	TemplateName string
+	Roles        []string
+}
+
+// subscriptionTable is what the entity data needs to know about a table
+type subscriptionTable struct {
+	Label   string            // metadata.entities display name
+	Labels  map[string]string // column -> metadata.properties display name
+	Private []string          // metadata.column_privacy
+}
+
+// subscriptionDelivery is one notification to create
+type subscriptionDelivery struct {
+	UserID       string
+	TemplateName string
+	Channels     []string
+	EntityData   map[string]any
+}
+
+// FanOutNotificationWorker turns an entity change into notifications for
+// its subscribers
+type FanOutNotificationWorker struct {
+	river.WorkerDefaults[FanOutNotificationArgs]
+	dbPool *pgxpool.Pool
+}
+
+// Work creates the change's notifications in one transaction, so a retry
+// never notifies anyone twice
+func (w *FanOutNotificationWorker) Work(ctx context.Context, job *river.Job[FanOutNotificationArgs]) error {
+	args := job.Args
+	if args.EntityID == "" {
+		log.Printf("[Job %d] Subscriptions: %s has no id column, nothing to fan out", job.ID, args.EntityType)
+		return nil
+	}
+
+	oldRow, err := decodeSubscriptionRow(args.OldRow)
+	if err != nil {
+		return fmt.Errorf("invalid old row: %w", err)
+	}
+	newRow, err := decodeSubscriptionRow(args.NewRow)
+	if err != nil {
+		return fmt.Errorf("invalid new row: %w", err)
+	}
+
+	table, err := w.loadTable(ctx, args.EntityType)
+	if err != nil {
+		return err
+	}
+	changed := subscriptionChangedColumns(args.Event, oldRow, newRow, table.Private)
+	if args.Event == "update" && len(changed) == 0 {
+		return nil
+	}
+
+	subs, err := w.loadSubscriptions(ctx, args)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	var deliveries []subscriptionDelivery
+	if args.Event == "delete" {
+		deliveries, err = w.matchDeleted(ctx, args, table, subs, oldRow)
+	} else {
+		deliveries, err = w.matchCurrent(ctx, args, table, subs, changed, oldRow)
+	}
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := w.createNotifications(ctx, args, deliveries); err != nil {
+		return err
+	}
+	log.Printf("[Job %d] Subscriptions: %s %s %s notified %d of %d subscriber(s)",
+		job.ID, args.EntityType, args.EntityID, args.Event, len(deliveries), len(subscribersOf(subs)))
+	return nil
+}
+
+// loadTable reads the table's labels and private columns
+func (w *FanOutNotificationWorker) loadTable(ctx context.Context, tableName string) (*subscriptionTable, error) {
+	table := &subscriptionTable{Labels: map[string]string{}}
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT COALESCE((SELECT display_name FROM metadata.entities WHERE table_name = $1::TEXT),
+		                initcap(replace($1::TEXT, '_', ' '))),
+		       COALESCE(metadata.private_columns($1::TEXT)::TEXT[], '{}')
+	`, tableName).Scan(&table.Label, &table.Private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load table: %w", err)
+	}
+
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT column_name, display_name FROM metadata.properties
+		WHERE table_name = $1 AND display_name IS NOT NULL
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load column labels: %w", err)
+	}
+	var column, label string
+	_, err = pgx.ForEachRow(rows, []any{&column, &label}, func() error {
+		table.Labels[column] = label
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load column labels: %w", err)
+	}
+	return table, nil
+}
+
+// loadSubscriptions reads the subscriptions the change could match, record
+// subscriptions first. The user who made the change is left out.
+func (w *FanOutNotificationWorker) loadSubscriptions(ctx context.Context, args FanOutNotificationArgs) ([]entitySubscription, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT s.id, s.user_id::TEXT, s.entity_id, s.filters, s.channels, s.template_name,
+		       ARRAY(SELECT r.role_key FROM metadata.user_roles ur
+		             JOIN metadata.roles r ON r.id = ur.role_id
+		             WHERE ur.user_id = s.user_id ORDER BY r.role_key)
+		FROM metadata.entity_subscriptions s
+		WHERE s.entity_type = $1
+		  AND $2 = ANY(s.events)
+		  AND (s.entity_id IS NULL OR s.entity_id = $3)
+		  AND s.user_id IS DISTINCT FROM NULLIF($4::TEXT, '')::UUID
+		ORDER BY s.entity_id IS NULL, s.id
+	`, args.EntityType, args.Event, args.EntityID, args.ActorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+	subs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entitySubscription, error) {
+		var s entitySubscription
+		err := row.Scan(&s.ID, &s.UserID, &s.EntityID, &s.Filters, &s.Channels, &s.TemplateName, &s.Roles)
+		return s, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// matchCurrent reads the row as each subscriber and keeps the subscriptions
+// whose filters match what they see. An update notifies a subscriber only if
+// a column they can see changed.
+func (w *FanOutNotificationWorker) matchCurrent(ctx context.Context, args FanOutNotificationArgs, table *subscriptionTable,
+	subs []entitySubscription, changed []string, oldRow map[string]any) ([]subscriptionDelivery, error) {
+	columns, err := loadPreviewColumns(ctx, w.dbPool, args.EntityType)
+	if err != nil {
+		return nil, err
+	}
+	query, err := buildPreviewEntityQuery(args.EntityType, columns)
+	var entityErr *previewEntityError
+	if errors.As(err, &entityErr) {
+		// Nobody can read it through the API, so nobody is notified
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	records := map[string]map[string]any{}
+	for _, user := range subscribersOf(subs) {
+		record, err := w.readAs(ctx, query, args.EntityID, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s %s as %s: %w", args.EntityType, args.EntityID, user.UserID, err)
+		}
+		if record != nil {
+			records[user.UserID] = record
+		}
+	}
+
+	return pickSubscriptionDeliveries(subs, func(sub entitySubscription) map[string]any {
+		record, ok := records[sub.UserID]
+		if !ok || !matchSubscriptionFilters(record, sub.Filters) {
+			return nil
+		}
+		return buildSubscriptionEntityData(args, table, record, changed, oldRow)
+	}), nil
+}
+
+// readAs reads the row with one subscriber's permissions; nil when they
+// can't see it
+func (w *FanOutNotificationWorker) readAs(ctx context.Context, query, entityID string, sub entitySubscription) (map[string]any, error) {
+	tx, err := beginAsUser(ctx, w.dbPool, sub.UserID, sub.Roles)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // read-only, nothing to keep
+
+	var data []byte
+	err = tx.QueryRow(ctx, query, entityID).Scan(&data)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.As(err, &pgErr) && pgErr.Code == "42501":
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return decodeSubscriptionRow(data)
+}
+
+// matchDeleted notifies record subscribers who may still read the table.
+// The row is gone, so they get the deleted row without private columns.
+func (w *FanOutNotificationWorker) matchDeleted(ctx context.Context, args FanOutNotificationArgs, table *subscriptionTable,
+	subs []entitySubscription, oldRow map[string]any) ([]subscriptionDelivery, error) {
+	record := make(map[string]any, len(oldRow))
+	for column, value := range oldRow {
+		if !slices.Contains(table.Private, column) {
+			record[column] = value
+		}
+	}
+
+	allowed := map[string]bool{}
+	for _, user := range subscribersOf(subs) {
+		ok, err := w.canRead(ctx, args.EntityType, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s's access to %s: %w", user.UserID, args.EntityType, err)
+		}
+		allowed[user.UserID] = ok
+	}
+
+	return pickSubscriptionDeliveries(subs, func(sub entitySubscription) map[string]any {
+		if sub.EntityID == nil || !allowed[sub.UserID] || !matchSubscriptionFilters(record, sub.Filters) {
+			return nil
+		}
+		return buildSubscriptionEntityData(args, table, record, nil, nil)
+	}), nil
+}
+
+// canRead checks the subscriber's read permission on the table
+func (w *FanOutNotificationWorker) canRead(ctx context.Context, tableName string, sub entitySubscription) (bool, error) {
+	tx, err := beginAsUser(ctx, w.dbPool, sub.UserID, sub.Roles)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // read-only, nothing to keep
+
+	var ok bool
+	err = tx.QueryRow(ctx, `SELECT metadata.has_permission($1, 'read')`, tableName).Scan(&ok)
+	return ok, err
+}
+
+// createNotifications inserts the notifications; their insert trigger
+// queues send_notification
+func (w *FanOutNotificationWorker) createNotifications(ctx context.Context, args FanOutNotificationArgs, deliveries []subscriptionDelivery) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, d := range deliveries {
+		entityData, err := json.Marshal(d.EntityData)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification data: %w", err)
+		}
+		batch.Queue(`
+			INSERT INTO metadata.notifications (user_id, template_name, entity_type, entity_id, entity_data, channels)
+			VALUES ($1::TEXT::UUID, $2, $3, $4, $5, $6)
+		`, d.UserID, d.TemplateName, args.EntityType, args.EntityID, entityData, d.Channels)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to create notifications: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// ============================================================================
+// Matching
+// ============================================================================
+
+// subscribersOf returns the first subscription of each user, in order
+func subscribersOf(subs []entitySubscription) []entitySubscription {
+	seen := map[string]bool{}
+	var users []entitySubscription
+	for _, sub := range subs {
+		if !seen[sub.UserID] {
+			seen[sub.UserID] = true
+			users = append(users, sub)
+		}
+	}
+	return users
+}
+
+// pickSubscriptionDeliveries gives each user at most one notification. The
+// first matching subscription (record subscriptions come first) picks the
+// template; channels are merged across the user's matching subscriptions.
+// entityData returns nil for a subscription that doesn't match.
+func pickSubscriptionDeliveries(subs []entitySubscription, entityData func(entitySubscription) map[string]any) []subscriptionDelivery {
+	var deliveries []subscriptionDelivery
+	byUser := map[string]int{}
+	for _, sub := range subs {
+		if i, ok := byUser[sub.UserID]; ok {
+			if entityData(sub) != nil {
+				for _, channel := range sub.Channels {
+					if !slices.Contains(deliveries[i].Channels, channel) {
+						deliveries[i].Channels = append(deliveries[i].Channels, channel)
+					}
+				}
+			}
+			continue
+		}
+		data := entityData(sub)
+		if data == nil {
+			continue
+		}
+		byUser[sub.UserID] = len(deliveries)
+		deliveries = append(deliveries, subscriptionDelivery{
+			UserID:       sub.UserID,
+			TemplateName: sub.TemplateName,
+			Channels:     slices.Clone(sub.Channels),
+			EntityData:   data,
+		})
+	}
+	return deliveries
+}
+
+// subscriptionChangedColumns lists the columns an update changed, without
+// updated_at and private columns. Inserts and deletes have none.
+func subscriptionChangedColumns(event string, oldRow, newRow map[string]any, private []string) []string {
+	if event != "update" {
+		return nil
+	}
+	var changed []string
+	for column, value := range newRow {
+		if column == entityAuditIgnoredColumn || slices.Contains(private, column) {
+			continue
+		}
+		if old, ok := oldRow[column]; !ok || !jsonEqual(old, value) {
+			changed = append(changed, column)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// buildSubscriptionEntityData is the notification's .Entity. Only changed
+// columns the subscriber can see in record are reported; an update with
+// none returns nil.
+func buildSubscriptionEntityData(args FanOutNotificationArgs, table *subscriptionTable, record map[string]any,
+	changed []string, oldRow map[string]any) map[string]any {
+	var visible, labels []string
+	previous := map[string]any{}
+	for _, column := range changed {
+		if _, ok := record[column]; !ok {
+			continue
+		}
+		visible = append(visible, column)
+		labels = append(labels, columnLabel(table, column))
+		previous[column] = oldRow[column]
+	}
+	if args.Event == "update" && len(visible) == 0 {
+		return nil
+	}
+
+	displayName, _ := record["display_name"].(string)
+	data := map[string]any{
+		"event":           args.Event,
+		"entity_type":     args.EntityType,
+		"entity_label":    table.Label,
+		"entity_id":       args.EntityID,
+		"display_name":    displayName,
+		"changed_columns": visible,
+		"changed_labels":  strings.Join(labels, ", "),
+		"record":          record,
+	}
+	if args.Event == "update" {
+		data["previous"] = previous
+	}
+	return data
+}
+
+// columnLabel is the column's display name, or the column name in title case
+func columnLabel(table *subscriptionTable, column string) string {
+	if label, ok := table.Labels[column]; ok {
+		return label
+	}
+	words := strings.Fields(strings.ReplaceAll(column, "_", " "))
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// matchSubscriptionFilters checks every filter against the row the
+// subscriber can see. A column they can't see is NULL, as in SQL.
+func matchSubscriptionFilters(row map[string]any, filters []exportFilter) bool {
+	for _, f := range filters {
+		if !matchSubscriptionFilter(row[f.Column], f) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSubscriptionFilter evaluates one PostgREST-style filter. Values
+// compare as numbers when both sides are numbers, as text otherwise (which
+// orders ISO dates and timestamps correctly).
+func matchSubscriptionFilter(value any, f exportFilter) bool {
+	if f.Operator == "is" {
+		switch strings.ToLower(filterText(f.Value)) {
+		case "null", "":
+			return value == nil
+		case "true":
+			return value == true
+		case "false":
+			return value == false
+		}
+		return false
+	}
+	if value == nil {
+		return false
+	}
+
+	actual := filterText(value)
+	switch f.Operator {
+	case "eq":
+		return compareFilterValues(actual, filterText(f.Value)) == 0
+	case "neq":
+		return compareFilterValues(actual, filterText(f.Value)) != 0
+	case "gt":
+		return compareFilterValues(actual, filterText(f.Value)) > 0
+	case "gte":
+		return compareFilterValues(actual, filterText(f.Value)) >= 0
+	case "lt":
+		return compareFilterValues(actual, filterText(f.Value)) < 0
+	case "lte":
+		return compareFilterValues(actual, filterText(f.Value)) <= 0
+	case "like":
+		return likePattern(filterText(f.Value), false).MatchString(actual)
+	case "ilike":
+		return likePattern(filterText(f.Value), true).MatchString(actual)
+	case "in":
+		return slices.ContainsFunc(filterList(f.Value), func(v string) bool {
+			return compareFilterValues(actual, v) == 0
+		})
+	}
+	return false
+}
+
+func compareFilterValues(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// likePattern translates a LIKE pattern (% or PostgREST's * for any run,
+// _ for one character) to an anchored regexp
+func likePattern(pattern string, fold bool) *regexp.Regexp {
+	var b strings.Builder
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%', '*':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile("(?s)" + b.String())
+}
+
+// decodeSubscriptionRow decodes a row snapshot, keeping numbers exact
+func decodeSubscriptionRow(raw []byte) (map[string]any, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var row map[string]any
+	if err := dec.Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// jsonEqual compares two decoded JSON values
+func jsonEqual(a, b any) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
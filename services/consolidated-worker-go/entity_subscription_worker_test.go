@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func mustDecodeRow(t *testing.T, raw string) map[string]any {
+	t.Helper()
+	row, err := decodeSubscriptionRow([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return row
+}
+
+func TestMatchSubscriptionFilter(t *testing.T) {
+	row := map[string]any{
+		"status_id": json.Number("3"),
+		"ward":      "Ward 4",
+		"urgent":    true,
+		"due_on":    "2026-03-04",
+		"closed_at": nil,
+	}
+	tests := []struct {
+		filter exportFilter
+		want   bool
+	}{
+		{exportFilter{"status_id", "eq", float64(3)}, true},
+		{exportFilter{"status_id", "eq", "3.0"}, true},
+		{exportFilter{"status_id", "neq", float64(3)}, false},
+		{exportFilter{"status_id", "gt", "20"}, false}, // numeric, not text, ordering
+		{exportFilter{"status_id", "in", "(1,3,5)"}, true},
+		{exportFilter{"status_id", "in", []any{float64(1), float64(2)}}, false},
+		{exportFilter{"ward", "like", "Ward*"}, true},
+		{exportFilter{"ward", "like", "ward%"}, false},
+		{exportFilter{"ward", "ilike", "ward _"}, true},
+		{exportFilter{"due_on", "gte", "2026-03-01"}, true},
+		{exportFilter{"due_on", "lt", "2026-03-01"}, false},
+		{exportFilter{"urgent", "is", "true"}, true},
+		{exportFilter{"closed_at", "is", "null"}, true},
+		{exportFilter{"closed_at", "eq", "x"}, false},    // NULL never compares
+		{exportFilter{"hidden", "is", nil}, true},        // unreadable column is NULL
+		{exportFilter{"status_id", "between", 1}, false}, // unknown operator
+	}
+	for _, tt := range tests {
+		if got := matchSubscriptionFilter(row[tt.filter.Column], tt.filter); got != tt.want {
+			t.Errorf("%s.%s(%v) = %v, want %v", tt.filter.Column, tt.filter.Operator, tt.filter.Value, got, tt.want)
+		}
+	}
+	if matchSubscriptionFilters(row, []exportFilter{{"urgent", "is", "true"}, {"ward", "eq", "Ward 5"}}) {
+		t.Error("every filter must match")
+	}
+}
+
+func TestSubscriptionChangedColumns(t *testing.T) {
+	oldRow := mustDecodeRow(t, `{"id": 1, "status_id": 2, "notes": "a", "ssn": "x", "updated_at": "t1", "tags": [1]}`)
+	newRow := mustDecodeRow(t, `{"id": 1, "status_id": 3, "notes": "a", "ssn": "y", "updated_at": "t2", "tags": [1, 2]}`)
+	got := subscriptionChangedColumns("update", oldRow, newRow, []string{"ssn"})
+	if !reflect.DeepEqual(got, []string{"status_id", "tags"}) {
+		t.Errorf("changed = %v, want status_id and tags (no updated_at, no private columns)", got)
+	}
+	if got := subscriptionChangedColumns("insert", nil, newRow, nil); got != nil {
+		t.Errorf("insert: changed = %v", got)
+	}
+}
+
+func TestBuildSubscriptionEntityData(t *testing.T) {
+	table := &subscriptionTable{Label: "Issues", Labels: map[string]string{"status_id": "Status"}}
+	args := FanOutNotificationArgs{EntityType: "issues", EntityID: "7", Event: "update"}
+	oldRow := mustDecodeRow(t, `{"status_id": 2, "assigned_user_id": "u1"}`)
+	record := mustDecodeRow(t, `{"id": 7, "display_name": "Pothole", "status_id": 3, "status": {"id": 3, "display_name": "Fixed"}}`)
+
+	data := buildSubscriptionEntityData(args, table, record, []string{"assigned_user_id", "status_id"}, oldRow)
+	if data["display_name"] != "Pothole" || data["entity_label"] != "Issues" {
+		t.Errorf("data = %v", data)
+	}
+	// assigned_user_id isn't in what the subscriber can read
+	if !reflect.DeepEqual(data["changed_columns"], []string{"status_id"}) || data["changed_labels"] != "Status" {
+		t.Errorf("changed = %v (%v)", data["changed_columns"], data["changed_labels"])
+	}
+	if !reflect.DeepEqual(data["previous"], map[string]any{"status_id": json.Number("2")}) {
+		t.Errorf("previous = %v", data["previous"])
+	}
+
+	if data := buildSubscriptionEntityData(args, table, record, []string{"assigned_user_id"}, oldRow); data != nil {
+		t.Errorf("update with no visible change: data = %v, want nil", data)
+	}
+	if got := columnLabel(table, "assigned_user_id"); got != "Assigned User Id" {
+		t.Errorf("columnLabel = %q", got)
+	}
+}
+
+func TestPickSubscriptionDeliveries(t *testing.T) {
+	id := "7"
+	subs := []entitySubscription{
+		{ID: 1, UserID: "alice", EntityID: &id, Channels: []string{"email"}, TemplateName: "issue_watch"},
+		{ID: 2, UserID: "bob", EntityID: &id, Channels: []string{"email"}, TemplateName: "entity_subscription_update"},
+		{ID: 3, UserID: "alice", Channels: []string{"sms"}, TemplateName: "entity_subscription_update"},
+		{ID: 4, UserID: "carol", Channels: []string{"email"}, TemplateName: "entity_subscription_update"},
+		{ID: 5, UserID: "carol", Channels: []string{"sms"}, TemplateName: "carol_template"},
+	}
+	matches := map[int64]bool{1: true, 2: false, 3: true, 4: false, 5: true}
+	got := pickSubscriptionDeliveries(subs, func(sub entitySubscription) map[string]any {
+		if !matches[sub.ID] {
+			return nil
+		}
+		return map[string]any{"subscription": sub.ID}
+	})
+
+	if len(got) != 2 {
+		t.Fatalf("deliveries = %+v, want alice and carol", got)
+	}
+	if got[0].UserID != "alice" || got[0].TemplateName != "issue_watch" || !reflect.DeepEqual(got[0].Channels, []string{"email", "sms"}) {
+		t.Errorf("alice = %+v, want the record template with both channels", got[0])
+	}
+	if got[1].UserID != "carol" || got[1].TemplateName != "carol_template" || !reflect.DeepEqual(got[1].Channels, []string{"sms"}) {
+		t.Errorf("carol = %+v, want only the matching subscription", got[1])
+	}
+	if len(subscribersOf(subs)) != 3 {
+		t.Errorf("subscribersOf = %v", subscribersOf(subs))
+	}
+}
@@ -0,0 +1,536 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Entity Webhooks
+//
+// metadata.queue_entity_webhooks() (see migration v0-81-0-entity-webhooks)
+// snapshots each changed row into metadata.entity_webhook_deliveries and
+// enqueues one entity_webhook_delivery job per subscription. The worker
+// renders the subscription's payload template with the notification Renderer
+// so the body can match the partner's schema (Open311, a CRM's JSON, ...),
+// sends it, and stores every attempt's request and response.
+//
+// Retries follow HTTP scheduled jobs: 5xx, 429 and network errors are
+// retried up to the subscription's max_attempts, backing off exponentially
+// (v0.104.0); other 4xx responses fail the delivery at once.
+//
+// Since v0.104.0 a subscription with a signing secret gets HMAC-signed
+// requests, and one whose deliveries keep failing is disabled once
+// consecutive_failures reaches disable_after_failures.
+// ============================================================================
+
+// EntityWebhookDeliveryArgs matches the JSON args inserted by
+// metadata.queue_entity_webhooks()
+type EntityWebhookDeliveryArgs struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
+
+// Kind returns the job type identifier for River routing
+func (EntityWebhookDeliveryArgs) Kind() string {
+	return "entity_webhook_delivery"
+}
+
+// InsertOpts specifies River job insertion options
+func (EntityWebhookDeliveryArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "webhooks",
+		MaxAttempts: 8,
+		Priority:    2,
+	}
+}
+
+const (
+	// Secret references resolve only env vars with this prefix, so anyone who
+	// can edit subscriptions can't exfiltrate DATABASE_URL etc.
+	entityWebhookSecretEnvPrefix = "ENTITY_WEBHOOK_SECRET_"
+
+	// redactedSecret replaces secret values in stored transcripts
+	redactedSecret = "[REDACTED]"
+
+	// Retries wait 30s, 1m, 2m ... capped at 6 hours
+	entityWebhookBaseRetry = 30 * time.Second
+	entityWebhookMaxRetry  = 6 * time.Hour
+)
+
+// entityWebhookRetryDelay is the wait after the attempt-th failed attempt
+func entityWebhookRetryDelay(attempt int) time.Duration {
+	if attempt < 1 || attempt > 20 {
+		return entityWebhookMaxRetry
+	}
+	return min(entityWebhookBaseRetry<<(attempt-1), entityWebhookMaxRetry)
+}
+
+// entityWebhookDelivery is a delivery joined with its subscription
+type entityWebhookDelivery struct {
+	ID           int64
+	EntityType   string
+	EntityID     string
+	Event        string
+	EntityData   json.RawMessage
+	PreviousData json.RawMessage
+	Status       string
+	CreatedAt    time.Time
+
+	SubscriptionName string
+	Enabled          bool
+	URL              string
+	Method           string
+	Headers          map[string]string // values are templates
+	PayloadTemplate  string            // "" = default envelope
+	Timeout          time.Duration
+	SigningSecret    string // secret name; "" = unsigned
+}
+
+// entityWebhookRequest is a rendered request plus the secret values it
+// contains, so the transcript can redact them
+type entityWebhookRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+	secrets []string
+}
+
+// redact replaces every secret value in s
+func (r *entityWebhookRequest) redact(s string) string {
+	for _, secret := range r.secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redactedSecret)
+		}
+	}
+	return s
+}
+
+// sign adds the signature headers: X-CivicOS-Signature is the hex
+// HMAC-SHA256 of "<timestamp>.<body>", so a partner can check both the
+// body and the timestamp (to reject replays)
+func (r *entityWebhookRequest) sign(secret string, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + r.Body))
+	r.Headers["X-CivicOS-Timestamp"] = timestamp
+	r.Headers["X-CivicOS-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// lookupEntityWebhookSecret resolves a {{secret "NAME"}} reference
+func lookupEntityWebhookSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(entityWebhookSecretEnvPrefix + name)
+	if !ok {
+		return "", fmt.Errorf("secret %q not configured (set %s%s)", name, entityWebhookSecretEnvPrefix, name)
+	}
+	return value, nil
+}
+
+// buildEntityWebhookRequest renders the headers and payload of a delivery
+func buildEntityWebhookRequest(renderer *Renderer, d *entityWebhookDelivery) (*entityWebhookRequest, error) {
+	req := &entityWebhookRequest{
+		Method:  d.Method,
+		URL:     d.URL,
+		Headers: make(map[string]string, len(d.Headers)+1),
+	}
+
+	funcs := template.FuncMap{
+		"secret": func(name string) (string, error) {
+			value, err := lookupEntityWebhookSecret(name)
+			if err == nil {
+				req.secrets = append(req.secrets, value)
+			}
+			return value, err
+		},
+	}
+
+	var entity, previous map[string]interface{}
+	if err := json.Unmarshal(d.EntityData, &entity); err != nil {
+		return nil, fmt.Errorf("invalid entity data: %w", err)
+	}
+	if len(d.PreviousData) > 0 {
+		if err := json.Unmarshal(d.PreviousData, &previous); err != nil {
+			return nil, fmt.Errorf("invalid previous data: %w", err)
+		}
+	}
+
+	occurredAt := d.CreatedAt.UTC().Format(time.RFC3339)
+	data := renderer.buildContext(entity)
+	data["Previous"] = previous
+	data["Event"] = d.Event
+	data["EntityType"] = d.EntityType
+	data["EntityID"] = d.EntityID
+	data["DeliveryID"] = d.ID
+	data["OccurredAt"] = occurredAt
+
+	if d.PayloadTemplate != "" {
+		body, err := renderer.renderTextWith(d.PayloadTemplate, data, funcs)
+		if err != nil {
+			return nil, fmt.Errorf("payload template: %w", err)
+		}
+		req.Body = body
+	} else {
+		body, err := json.Marshal(map[string]interface{}{
+			"event":       d.Event,
+			"entity_type": d.EntityType,
+			"entity_id":   d.EntityID,
+			"delivery_id": d.ID,
+			"occurred_at": occurredAt,
+			"data":        entity,
+			"previous":    previous,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("encode default payload: %w", err)
+		}
+		req.Body = string(body)
+		req.Headers["Content-Type"] = "application/json"
+	}
+
+	for name, valueTemplate := range d.Headers {
+		value, err := renderer.renderTextWith(valueTemplate, data, funcs)
+		if err != nil {
+			return nil, fmt.Errorf("header %s template: %w", name, err)
+		}
+		req.Headers[name] = value
+	}
+
+	// Set last so subscription headers can't replace them
+	req.Headers["X-CivicOS-Delivery"] = strconv.FormatInt(d.ID, 10)
+	req.Headers["X-CivicOS-Event"] = d.EntityType + "." + d.Event
+	if d.SigningSecret != "" {
+		secret, err := lookupEntityWebhookSecret(d.SigningSecret)
+		if err != nil {
+			return nil, fmt.Errorf("signing secret: %w", err)
+		}
+		req.secrets = append(req.secrets, secret)
+		req.sign(secret, time.Now())
+	}
+
+	return req, nil
+}
+
+// sendEntityWebhook sends a rendered request and captures the response.
+// Returns an error only when no response was received.
+func sendEntityWebhook(ctx context.Context, client *http.Client, req *entityWebhookRequest, timeout time.Duration) (*httpTargetResult, http.Header, error) {
+	if timeout <= 0 {
+		timeout = defaultHTTPTargetTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, strings.NewReader(req.Body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	httpReq.Header.Set("User-Agent", "CivicOS-Webhooks/1.0")
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the cap to detect truncation
+	captured, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseCapture+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	result := &httpTargetResult{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if len(captured) > maxHTTPResponseCapture {
+		captured = captured[:maxHTTPResponseCapture]
+		result.Truncated = true
+	}
+	result.Body = string(captured)
+	return result, resp.Header, nil
+}
+
+// EntityWebhookWorker delivers outbound entity webhooks
+type EntityWebhookWorker struct {
+	river.WorkerDefaults[EntityWebhookDeliveryArgs]
+	dbPool     *pgxpool.Pool
+	renderer   *Renderer
+	httpClient *http.Client
+}
+
+// NextRetry backs off exponentially instead of River's default
+func (w *EntityWebhookWorker) NextRetry(job *river.Job[EntityWebhookDeliveryArgs]) time.Time {
+	return time.Now().Add(entityWebhookRetryDelay(job.Attempt))
+}
+
+// Work sends one delivery and records the attempt
+func (w *EntityWebhookWorker) Work(ctx context.Context, job *river.Job[EntityWebhookDeliveryArgs]) error {
+	deliveryID := job.Args.DeliveryID
+
+	d, err := w.loadDelivery(ctx, deliveryID)
+	if err == pgx.ErrNoRows {
+		// Subscription (and its deliveries) deleted since the change
+		log.Printf("[Webhook %d] Delivery not found, skipping", deliveryID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load delivery %d: %w", deliveryID, err)
+	}
+	if d.Status == "delivered" {
+		return nil
+	}
+	if !d.Enabled {
+		w.finish(ctx, deliveryID, job.Attempt, "failed", nil, "Subscription disabled")
+		return nil
+	}
+
+	log.Printf("[Webhook %d] %s %s/%s → %s (%s, attempt %d/%d)",
+		deliveryID, d.Event, d.EntityType, d.EntityID, d.SubscriptionName, d.URL, job.Attempt, job.MaxAttempts)
+
+	req, err := buildEntityWebhookRequest(w.renderer, d)
+	if err != nil {
+		// A broken template won't fix itself on retry
+		w.recordAttempt(ctx, deliveryID, job.Attempt, &entityWebhookRequest{Method: d.Method, URL: d.URL}, nil, nil, err, 0)
+		w.finish(ctx, deliveryID, job.Attempt, "failed", nil, err.Error())
+		log.Printf("[Webhook %d] ✗ %v", deliveryID, err)
+		return nil
+	}
+
+	start := time.Now()
+	result, respHeaders, sendErr := sendEntityWebhook(ctx, w.httpClient, req, d.Timeout)
+	durationMs := int(time.Since(start).Milliseconds())
+	w.recordAttempt(ctx, deliveryID, job.Attempt, req, result, respHeaders, sendErr, durationMs)
+
+	lastAttempt := job.Attempt >= job.MaxAttempts
+	switch {
+	case sendErr != nil:
+		message := req.redact(sendErr.Error())
+		if lastAttempt {
+			w.finish(ctx, deliveryID, job.Attempt, "failed", nil, message)
+			log.Printf("[Webhook %d] ✗ %s (giving up)", deliveryID, message)
+			return nil
+		}
+		w.finish(ctx, deliveryID, job.Attempt, "retrying", nil, message)
+		return fmt.Errorf("webhook request failed: %s", message)
+
+	case result.Success():
+		w.finish(ctx, deliveryID, job.Attempt, "delivered", &result.StatusCode, "")
+		log.Printf("[Webhook %d] ✓ HTTP %d (took %dms)", deliveryID, result.StatusCode, durationMs)
+		return nil
+
+	default:
+		message := fmt.Sprintf("HTTP %d %s", result.StatusCode, http.StatusText(result.StatusCode))
+		if result.Retryable() && !lastAttempt {
+			w.finish(ctx, deliveryID, job.Attempt, "retrying", &result.StatusCode, message)
+			return fmt.Errorf("endpoint returned %s", message)
+		}
+		// 4xx: the partner rejected the payload, retrying won't help
+		w.finish(ctx, deliveryID, job.Attempt, "failed", &result.StatusCode, message)
+		log.Printf("[Webhook %d] ✗ %s", deliveryID, message)
+		return nil
+	}
+}
+
+// loadDelivery reads a delivery and its subscription's request configuration
+func (w *EntityWebhookWorker) loadDelivery(ctx context.Context, deliveryID int64) (*entityWebhookDelivery, error) {
+	var d entityWebhookDelivery
+	var headersJSON []byte
+	var payloadTemplate, signingSecret *string
+	var timeoutSeconds int
+
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT d.id, d.entity_type, d.entity_id, d.event, d.entity_data, d.previous_data, d.status, d.created_at,
+		       s.name, s.enabled, s.url, s.http_method, s.headers, s.payload_template, s.timeout_seconds,
+		       s.signing_secret_name
+		FROM metadata.entity_webhook_deliveries d
+		JOIN metadata.entity_webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.id = $1
+	`, deliveryID).Scan(&d.ID, &d.EntityType, &d.EntityID, &d.Event, &d.EntityData, &d.PreviousData, &d.Status, &d.CreatedAt,
+		&d.SubscriptionName, &d.Enabled, &d.URL, &d.Method, &headersJSON, &payloadTemplate, &timeoutSeconds,
+		&signingSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(headersJSON) > 0 {
+		if err := json.Unmarshal(headersJSON, &d.Headers); err != nil {
+			return nil, fmt.Errorf("invalid headers: %w", err)
+		}
+	}
+	if payloadTemplate != nil {
+		d.PayloadTemplate = *payloadTemplate
+	}
+	if signingSecret != nil {
+		d.SigningSecret = *signingSecret
+	}
+	d.Timeout = time.Duration(timeoutSeconds) * time.Second
+	return &d, nil
+}
+
+// recordAttempt stores the transcript of one attempt, secrets redacted
+func (w *EntityWebhookWorker) recordAttempt(ctx context.Context, deliveryID int64, attempt int, req *entityWebhookRequest,
+	result *httpTargetResult, respHeaders http.Header, sendErr error, durationMs int) {
+
+	requestHeaders := make(map[string]string, len(req.Headers))
+	for name, value := range req.Headers {
+		requestHeaders[name] = req.redact(value)
+	}
+
+	var (
+		status     *int
+		body       *string
+		truncated  bool
+		headers    map[string]string
+		errMessage *string
+	)
+	if result != nil {
+		status = &result.StatusCode
+		body = &result.Body
+		truncated = result.Truncated
+		headers = make(map[string]string, len(respHeaders))
+		for name := range respHeaders {
+			headers[name] = respHeaders.Get(name)
+		}
+	}
+	if sendErr != nil {
+		message := req.redact(sendErr.Error())
+		errMessage = &message
+	}
+
+	_, err := w.dbPool.Exec(ctx, `
+		INSERT INTO metadata.entity_webhook_attempts (
+			delivery_id, attempt, request_method, request_url, request_headers, request_body,
+			response_status, response_headers, response_body, response_truncated, error, duration_ms
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, deliveryID, attempt, req.Method, req.redact(req.URL), requestHeaders, req.redact(req.Body),
+		status, headers, body, truncated, errMessage, durationMs)
+	if err != nil {
+		log.Printf("[Webhook %d] Failed to record attempt: %v", deliveryID, err)
+	}
+}
+
+// finish updates the delivery's status after an attempt
+func (w *EntityWebhookWorker) finish(ctx context.Context, deliveryID int64, attempt int, status string, httpStatus *int, errMessage string) {
+	var lastError *string
+	if errMessage != "" {
+		lastError = &errMessage
+	}
+
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.entity_webhook_deliveries
+		SET status = $2,
+		    attempts = $3,
+		    last_http_status = COALESCE($4, last_http_status),
+		    last_error = $5,
+		    delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() ELSE delivered_at END
+		WHERE id = $1
+	`, deliveryID, status, attempt, httpStatus, lastError)
+	if err != nil {
+		log.Printf("[Webhook %d] Failed to update delivery: %v", deliveryID, err)
+	}
+	if status == "delivered" || status == "failed" {
+		w.recordOutcome(ctx, deliveryID, status == "delivered", errMessage)
+	}
+}
+
+// recordOutcome keeps the subscription's count of deliveries failed in a
+// row and disables it at disable_after_failures. Deliveries that fail
+// because the subscription is already disabled don't count.
+func (w *EntityWebhookWorker) recordOutcome(ctx context.Context, deliveryID int64, delivered bool, errMessage string) {
+	if delivered {
+		_, err := w.dbPool.Exec(ctx, `
+			UPDATE metadata.entity_webhook_subscriptions s
+			SET consecutive_failures = 0
+			FROM metadata.entity_webhook_deliveries d
+			WHERE d.id = $1 AND s.id = d.subscription_id AND s.consecutive_failures > 0
+		`, deliveryID)
+		if err != nil {
+			log.Printf("[Webhook %d] Failed to reset subscription failures: %v", deliveryID, err)
+		}
+		return
+	}
+
+	var name string
+	var failures int
+	var disabled bool
+	err := w.dbPool.QueryRow(ctx, `
+		UPDATE metadata.entity_webhook_subscriptions s
+		SET consecutive_failures = s.consecutive_failures + 1,
+		    enabled = s.disable_after_failures IS NULL OR s.consecutive_failures + 1 < s.disable_after_failures,
+		    disabled_at = CASE WHEN s.consecutive_failures + 1 >= s.disable_after_failures THEN NOW() END,
+		    disabled_reason = CASE WHEN s.consecutive_failures + 1 >= s.disable_after_failures THEN format(
+		        'Disabled after %s failed deliveries in a row. Last error: %s',
+		        s.consecutive_failures + 1, $2::TEXT) END
+		FROM metadata.entity_webhook_deliveries d
+		WHERE d.id = $1 AND s.id = d.subscription_id AND s.enabled
+		RETURNING s.name, s.consecutive_failures, NOT s.enabled
+	`, deliveryID, errMessage).Scan(&name, &failures, &disabled)
+	if err == pgx.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("[Webhook %d] Failed to count subscription failure: %v", deliveryID, err)
+		return
+	}
+	if disabled {
+		log.Printf("[Webhook %d] ✗ Subscription %s disabled after %d failed deliveries in a row", deliveryID, name, failures)
+	}
+}
+
+// ============================================================================
+// Entity Webhook Cleanup Maintenance Task
+//
+// Scheduled by MaintenanceScheduler (task "entity_webhook_cleanup").
+// Attempts are deleted with their delivery (ON DELETE CASCADE).
+// ============================================================================
+
+// entityWebhookRetention is how long finished deliveries are kept
+const entityWebhookRetention = 30 * 24 * time.Hour
+
+// EntityWebhookCleanupTask purges old finished deliveries and transcripts
+type EntityWebhookCleanupTask struct {
+	dbPool *pgxpool.Pool
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (e *EntityWebhookCleanupTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "entity_webhook_cleanup",
+		Description: "Delete delivered and failed entity webhook deliveries (with transcripts) older than 30 days",
+		Interval:    6 * time.Hour,
+		Jitter:      15 * time.Minute,
+		Run:         e.runCleanup,
+	}
+}
+
+// runCleanup deletes finished deliveries past the retention period
+func (e *EntityWebhookCleanupTask) runCleanup(ctx context.Context) (string, error) {
+	result, err := e.dbPool.Exec(ctx, `
+		DELETE FROM metadata.entity_webhook_deliveries
+		WHERE status IN ('delivered', 'failed')
+		  AND created_at < NOW() - $1::interval
+	`, intervalString(entityWebhookRetention))
+	if err != nil {
+		return "", fmt.Errorf("delete old deliveries: %w", err)
+	}
+	return fmt.Sprintf("Deleted %d old webhook deliveries", result.RowsAffected()), nil
+}
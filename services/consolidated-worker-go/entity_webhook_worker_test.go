@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWebhookDelivery() *entityWebhookDelivery {
+	return &entityWebhookDelivery{
+		ID:           99,
+		EntityType:   "issues",
+		EntityID:     "12",
+		Event:        "update",
+		EntityData:   json.RawMessage(`{"id":12,"display_name":"Pothole on Main St","status":"open","location":{"lat":42.3,"lng":-83.1}}`),
+		PreviousData: json.RawMessage(`{"id":12,"display_name":"Pothole on Main St","status":"new"}`),
+		CreatedAt:    time.Date(2026, 3, 1, 14, 30, 0, 0, time.UTC),
+		URL:          "https://crm.example.gov/api/requests",
+		Method:       "POST",
+	}
+}
+
+func newTestWebhookRenderer() *Renderer {
+	return NewRenderer("https://city.example.gov", "Civic OS", time.UTC, nil, "")
+}
+
+// ============================================================================
+// Tests: payload rendering
+// ============================================================================
+
+func TestBuildEntityWebhookRequest_DefaultEnvelope(t *testing.T) {
+	req, err := buildEntityWebhookRequest(newTestWebhookRenderer(), newTestWebhookDelivery())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if req.Headers["Content-Type"] != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", req.Headers["Content-Type"])
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(req.Body), &body); err != nil {
+		t.Fatalf("default payload is not JSON: %v", err)
+	}
+	if body["event"] != "update" || body["entity_type"] != "issues" || body["entity_id"] != "12" {
+		t.Errorf("envelope fields mismatch: %v", body)
+	}
+	if body["occurred_at"] != "2026-03-01T14:30:00Z" {
+		t.Errorf("occurred_at = %v", body["occurred_at"])
+	}
+	if data, _ := body["data"].(map[string]interface{}); data["status"] != "open" {
+		t.Errorf("data.status = %v, want open", body["data"])
+	}
+	if previous, _ := body["previous"].(map[string]interface{}); previous["status"] != "new" {
+		t.Errorf("previous.status = %v, want new", body["previous"])
+	}
+}
+
+func TestBuildEntityWebhookRequest_MappingTemplate(t *testing.T) {
+	d := newTestWebhookDelivery()
+	// Open311 GeoReport-style mapping
+	d.PayloadTemplate = `{"service_request_id":"{{.EntityID}}","description":{{toJSON .Entity.display_name}},` +
+		`"status":"{{if eq .Entity.status "open"}}open{{else}}closed{{end}}",` +
+		`"lat":{{.Entity.location.lat}},"long":{{.Entity.location.lng}},"was":"{{.Previous.status}}"}`
+	d.Headers = map[string]string{"Content-Type": "application/json", "X-Source": "{{.Metadata.site_name}}"}
+
+	req, err := buildEntityWebhookRequest(newTestWebhookRenderer(), d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"service_request_id":"12","description":"Pothole on Main St","status":"open","lat":42.3,"long":-83.1,"was":"new"}`
+	if req.Body != want {
+		t.Errorf("body = %s\nwant   %s", req.Body, want)
+	}
+	if req.Headers["X-Source"] != "Civic OS" {
+		t.Errorf("X-Source = %q, want Civic OS", req.Headers["X-Source"])
+	}
+}
+
+func TestBuildEntityWebhookRequest_TemplateError(t *testing.T) {
+	d := newTestWebhookDelivery()
+	d.PayloadTemplate = `{{.Entity.status`
+
+	if _, err := buildEntityWebhookRequest(newTestWebhookRenderer(), d); err == nil {
+		t.Error("expected error for malformed payload template")
+	}
+}
+
+func TestToJSON_EscapesStrings(t *testing.T) {
+	got, err := toJSON(`He said "hi"` + "\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != `"He said \"hi\"\n"` {
+		t.Errorf("toJSON = %s", got)
+	}
+}
+
+// ============================================================================
+// Tests: secrets
+// ============================================================================
+
+func TestBuildEntityWebhookRequest_SecretRedacted(t *testing.T) {
+	t.Setenv("ENTITY_WEBHOOK_SECRET_CRM_TOKEN", "tok-123")
+
+	d := newTestWebhookDelivery()
+	d.Headers = map[string]string{"Authorization": `Bearer {{secret "CRM_TOKEN"}}`}
+
+	req, err := buildEntityWebhookRequest(newTestWebhookRenderer(), d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Headers["Authorization"] != "Bearer tok-123" {
+		t.Errorf("Authorization = %q, want Bearer tok-123", req.Headers["Authorization"])
+	}
+	if got := req.redact(req.Headers["Authorization"]); got != "Bearer [REDACTED]" {
+		t.Errorf("redacted header = %q, want Bearer [REDACTED]", got)
+	}
+}
+
+func TestBuildEntityWebhookRequest_SecretOutsidePrefixNotReadable(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://should-not-leak")
+
+	d := newTestWebhookDelivery()
+	d.Headers = map[string]string{"X-Leak": `{{secret "DATABASE_URL"}}`}
+
+	if _, err := buildEntityWebhookRequest(newTestWebhookRenderer(), d); err == nil {
+		t.Fatal("expected error: secret lookup must be restricted to the ENTITY_WEBHOOK_SECRET_ prefix")
+	}
+}
+
+// ============================================================================
+// Tests: signing
+// ============================================================================
+
+func TestBuildEntityWebhookRequest_Signed(t *testing.T) {
+	t.Setenv("ENTITY_WEBHOOK_SECRET_CRM_SIGNING", "whsec-abc")
+
+	d := newTestWebhookDelivery()
+	d.SigningSecret = "CRM_SIGNING"
+	d.Headers = map[string]string{"X-CivicOS-Signature": "spoofed"}
+
+	req, err := buildEntityWebhookRequest(newTestWebhookRenderer(), d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	timestamp := req.Headers["X-CivicOS-Timestamp"]
+	mac := hmac.New(sha256.New, []byte("whsec-abc"))
+	mac.Write([]byte(timestamp + "." + req.Body))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if timestamp == "" || req.Headers["X-CivicOS-Signature"] != want {
+		t.Errorf("signature = %q (timestamp %q), want %q", req.Headers["X-CivicOS-Signature"], timestamp, want)
+	}
+	if req.Headers["X-CivicOS-Delivery"] != "99" || req.Headers["X-CivicOS-Event"] != "issues.update" {
+		t.Errorf("delivery headers = %v", req.Headers)
+	}
+	if got := req.redact("whsec-abc"); got != redactedSecret {
+		t.Errorf("signing secret not redacted: %q", got)
+	}
+}
+
+func TestEntityWebhookRequestSign(t *testing.T) {
+	req := &entityWebhookRequest{Headers: map[string]string{}, Body: `{"a":1}`}
+	req.sign("secret", time.Unix(1767225600, 0))
+
+	if req.Headers["X-CivicOS-Timestamp"] != "1767225600" {
+		t.Errorf("timestamp = %q", req.Headers["X-CivicOS-Timestamp"])
+	}
+	// echo -n '1767225600.{"a":1}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=96a067a1c95eb143fc00b9097bcfcbcd5456adda508c443ff219748e764dbed7"
+	if req.Headers["X-CivicOS-Signature"] != want {
+		t.Errorf("signature = %q, want %q", req.Headers["X-CivicOS-Signature"], want)
+	}
+}
+
+func TestBuildEntityWebhookRequest_SigningSecretMissing(t *testing.T) {
+	d := newTestWebhookDelivery()
+	d.SigningSecret = "NOT_CONFIGURED"
+
+	if _, err := buildEntityWebhookRequest(newTestWebhookRenderer(), d); err == nil {
+		t.Error("expected error for an unconfigured signing secret")
+	}
+}
+
+func TestEntityWebhookRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		10: 256 * time.Minute,
+		11: 6 * time.Hour,
+		64: 6 * time.Hour,
+	}
+	for attempt, want := range cases {
+		if got := entityWebhookRetryDelay(attempt); got != want {
+			t.Errorf("entityWebhookRetryDelay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+// ============================================================================
+// Tests: request execution
+// ============================================================================
+
+func TestSendEntityWebhook_CapturesResponse(t *testing.T) {
+	var gotMethod, gotBody, gotAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotAgent = r.Header.Get("User-Agent")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("X-Request-Id", "crm-77")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"crm-77"}`))
+	}))
+	defer server.Close()
+
+	req := &entityWebhookRequest{Method: "PUT", URL: server.URL, Body: `{"a":1}`}
+	result, headers, err := sendEntityWebhook(context.Background(), server.Client(), req, 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotMethod != "PUT" || gotBody != `{"a":1}` || gotAgent != "CivicOS-Webhooks/1.0" {
+		t.Errorf("request mismatch: method=%s body=%s agent=%s", gotMethod, gotBody, gotAgent)
+	}
+	if !result.Success() || result.Body != `{"id":"crm-77"}` {
+		t.Errorf("response not captured: %+v", result)
+	}
+	if headers.Get("X-Request-Id") != "crm-77" {
+		t.Errorf("response headers not captured: %v", headers)
+	}
+}
+
+func TestSendEntityWebhook_RetryClassification(t *testing.T) {
+	cases := []struct {
+		status    int
+		retryable bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusUnprocessableEntity, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusBadGateway, true},
+	}
+
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+		}))
+
+		req := &entityWebhookRequest{Method: "POST", URL: server.URL}
+		result, _, err := sendEntityWebhook(context.Background(), server.Client(), req, 5*time.Second)
+		server.Close()
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", tc.status, err)
+		}
+		if result.Success() || result.Retryable() != tc.retryable {
+			t.Errorf("%d: success=%v retryable=%v, want retryable=%v", tc.status, result.Success(), result.Retryable(), tc.retryable)
+		}
+	}
+}
+
+func TestSendEntityWebhook_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	req := &entityWebhookRequest{Method: "POST", URL: server.URL}
+	_, _, err := sendEntityWebhook(context.Background(), server.Client(), req, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "request failed") {
+		t.Errorf("expected request failure on timeout, got %v", err)
+	}
+}
@@ -7,9 +7,12 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riverqueue/river"
@@ -40,6 +43,55 @@ func (ExpandRecurringSeriesArgs) InsertOpts() river.InsertOpts {
 	}
 }
 
+// seriesExpansionQuery finds active series with an expansion requested past
+// what has been expanded
+const seriesExpansionQuery = `
+	SELECT id, expansion_requested_until
+	FROM metadata.time_slot_series
+	WHERE status = 'active'
+	  AND expansion_requested_until > COALESCE(expanded_until, '-infinity'::DATE)
+`
+
+func scanSeriesExpansion(rows pgx.Rows) (river.JobArgs, error) {
+	var args ExpandRecurringSeriesArgs
+	err := rows.Scan(&args.SeriesID, &args.ExpandUntil)
+	return args, err
+}
+
+// seriesChangedChannel queues expansion of series that
+// request_series_expansion() announces on series_changed (payload: series
+// ID), up to the series' expansion_requested_until. Expansion skips existing
+// instances, so jobs aren't unique; the debounce just collapses bursts of
+// edits to one series. Resync covers every series still waiting.
+func seriesChangedChannel(dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx]) NotifyChannel {
+	return NotifyChannel{
+		Name:     "series_changed",
+		Debounce: 2 * time.Second,
+		Handle: func(ctx context.Context, payload string) error {
+			id, err := strconv.ParseInt(payload, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid series ID: %w", err)
+			}
+			_, err = insertJobsFromQuery(ctx, dbPool, riverClient, scanSeriesExpansion,
+				seriesExpansionQuery+" AND id = $1", id)
+			return err
+		},
+		Resync: func(ctx context.Context) error {
+			return resyncJobs(ctx, "series_changed", dbPool, riverClient, scanSeriesExpansion, seriesExpansionQuery)
+		},
+	}
+}
+
+// seriesLockTimeout is how long an expansion waits for another operation on
+// the same series (a schedule change) before snoozing
+const seriesLockTimeout = 30 * time.Second
+
+// seriesLockSnooze is how long a blocked expansion waits before resuming
+const seriesLockSnooze = 1 * time.Minute
+
+// errSeriesChanged means the series schedule was replaced mid-expansion
+var errSeriesChanged = errors.New("series schedule changed")
+
 // ============================================================================
 // Series Data Structures
 // ============================================================================
@@ -53,11 +105,17 @@ type SeriesRecord struct {
 	RRULE            string
 	Dtstart          time.Time
 	Duration         time.Duration
+	DurationText     string // duration as PostgreSQL formats it, for rechecks
 	Timezone         *string
 	TimeSlotProperty string
 	Status           string
 	ExpandedUntil    *time.Time
 	CreatedBy        *string
+
+	// From the series group (v0.133.0, v0.134.0)
+	HolidayCalendarID *int
+	HolidayPolicy     string
+	DSTPolicy         string
 }
 
 // TableColumnInfo caches column existence checks for a target table.
@@ -66,6 +124,23 @@ type TableColumnInfo struct {
 	HasCreatedBy bool
 }
 
+// SeriesChildTemplate is a metadata.series_child_templates row (v0.132.0):
+// rows of ChildTable created with every occurrence, with ParentColumn set to
+// the occurrence's ID
+type SeriesChildTemplate struct {
+	ID             int64
+	ChildTable     string
+	ParentColumn   string
+	Template       map[string]interface{}
+	Copies         int
+	CopiesProperty *string // occurrence column holding the count instead
+	HasCreatedBy   bool
+}
+
+// maxSeriesChildCopies caps the rows one child template creates per
+// occurrence, matching the copies CHECK constraint
+const maxSeriesChildCopies = 100
+
 // ============================================================================
 // Worker Implementation: Expand Recurring Series Worker
 // ============================================================================
@@ -97,13 +172,30 @@ func (w *ExpandRecurringSeriesWorker) Work(ctx context.Context, job *river.Job[E
 
 	log.Printf("[Job %d] Series: entity_table=%s, rrule=%s", job.ID, series.EntityTable, series.RRULE)
 
-	// 2. Validate template against schema (detect drift)
+	// 2. Validate template and child templates against schema (detect drift)
 	driftIssues, err := w.checkSchemaDrift(ctx, series)
 	if err != nil {
 		log.Printf("[Job %d] Error checking schema drift: %v", job.ID, err)
 		return fmt.Errorf("failed to check schema drift: %w", err)
 	}
 
+	children, err := w.fetchChildTemplates(ctx, series.GroupID)
+	if err != nil {
+		log.Printf("[Job %d] Error fetching child templates: %v", job.ID, err)
+		return fmt.Errorf("failed to fetch child templates: %w", err)
+	}
+	for _, child := range children {
+		childIssues, err := w.checkChildTemplateDrift(ctx, child)
+		if err != nil {
+			log.Printf("[Job %d] Error checking child template drift: %v", job.ID, err)
+			return fmt.Errorf("failed to check child template drift: %w", err)
+		}
+		driftIssues = append(driftIssues, childIssues...)
+	}
+	if len(children) > 0 {
+		log.Printf("[Job %d] %d child template(s) per occurrence", job.ID, len(children))
+	}
+
 	// Separate hard drift (missing/extra columns) from JWT warnings
 	var hardDrift []string
 	for _, issue := range driftIssues {
@@ -154,10 +246,27 @@ func (w *ExpandRecurringSeriesWorker) Work(ctx context.Context, job *river.Job[E
 
 	log.Printf("[Job %d] Found %d existing instances", job.ID, len(existingDates))
 
+	// 4b. Load holidays the occurrences may land on, or shift onto
+	loc := time.UTC
+	var holidays map[string]string
+	if series.HolidayCalendarID != nil && len(occurrences) > 0 {
+		loc = seriesLocation(series)
+		from := occurrences[0].In(loc).AddDate(0, 0, -maxHolidayShiftDays)
+		to := occurrences[len(occurrences)-1].In(loc).AddDate(0, 0, maxHolidayShiftDays)
+		holidays, err = fetchHolidays(ctx, w.dbPool, *series.HolidayCalendarID, from, to)
+		if err != nil {
+			log.Printf("[Job %d] Error fetching holidays: %v", job.ID, err)
+			return fmt.Errorf("failed to fetch holidays: %w", err)
+		}
+		log.Printf("[Job %d] Holiday calendar %d (%s): %d holiday(s) in range",
+			job.ID, *series.HolidayCalendarID, series.HolidayPolicy, len(holidays))
+	}
+
 	// 5. Create new instances
 	created := 0
 	skipped := 0
 	failed := 0
+	holidaySkipped := 0
 
 	for _, occDate := range occurrences {
 		dateKey := occDate.Format("2006-01-02")
@@ -166,10 +275,26 @@ func (w *ExpandRecurringSeriesWorker) Work(ctx context.Context, job *river.Job[E
 			continue // Already expanded
 		}
 
+		// Skip or shift occurrences on holidays. A shifted occurrence keeps
+		// its original occurrence_date so it is recognised as expanded.
+		start, holiday, skip := avoidHoliday(occDate, loc, holidays, series.HolidayPolicy)
+		if skip {
+			log.Printf("[Job %d] Skipping %s: %s", job.ID, dateKey, holiday)
+			err = w.createInstanceRecord(ctx, series.ID, occDate, series.EntityTable, nil, true, "holiday_skipped")
+			if err != nil {
+				log.Printf("[Job %d] Failed to create exception instance: %v", job.ID, err)
+			}
+			holidaySkipped++
+			continue
+		}
+		if holiday != "" {
+			log.Printf("[Job %d] Moving %s (%s) to %s", job.ID, dateKey, holiday, start.In(loc).Format("2006-01-02"))
+		}
+
 		// Build time_slot from occurrence + duration
-		endTime := occDate.Add(series.Duration)
+		endTime := start.Add(series.Duration)
 		timeSlot := fmt.Sprintf("[%s,%s)",
-			occDate.Format(time.RFC3339),
+			start.Format(time.RFC3339),
 			endTime.Format(time.RFC3339))
 
 		// Prepare entity record
@@ -179,9 +304,22 @@ func (w *ExpandRecurringSeriesWorker) Work(ctx context.Context, job *river.Job[E
 		}
 		record[series.TimeSlotProperty] = timeSlot
 
-		// Insert entity + junction record atomically in a single transaction.
-		// This prevents orphaned entities if the junction INSERT fails.
-		entityID, err := w.insertEntityWithInstance(ctx, series, occDate, record, colInfo)
+		// Insert entity, child records and junction record atomically in a
+		// single transaction. This prevents orphaned entities if the junction
+		// INSERT fails, and occurrences missing children if a child fails.
+		entityID, err := w.insertEntityWithInstance(ctx, job.ID, series, occDate, record, colInfo, children)
+		var lockConflict *EntityLockConflict
+		if errors.As(err, &lockConflict) {
+			// Another batch operation (e.g. a schedule change) holds the series;
+			// instances created so far are kept and the rest are retried
+			log.Printf("[Job %d] %v after %d created, snoozing", job.ID, lockConflict, created)
+			return river.JobSnooze(seriesLockSnooze)
+		}
+		if errors.Is(err, errSeriesChanged) {
+			// update_series_schedule() replaced the schedule and queued a new expansion
+			log.Printf("[Job %d] Series schedule changed during expansion after %d created, stopping", job.ID, created)
+			return nil
+		}
 		if err != nil {
 			errType := classifyInsertError(err)
 			log.Printf("[Job %d] Failed to insert entity for %s (%s): %v", job.ID, dateKey, errType, err)
@@ -211,7 +349,8 @@ func (w *ExpandRecurringSeriesWorker) Work(ctx context.Context, job *river.Job[E
 	}
 
 	duration := time.Since(startTime)
-	log.Printf("[Job %d] ✓ Completed: %d created, %d conflict_skipped, %d insert_failed, took %v", job.ID, created, skipped, failed, duration)
+	log.Printf("[Job %d] ✓ Completed: %d created, %d conflict_skipped, %d insert_failed, %d holiday_skipped, took %v",
+		job.ID, created, skipped, failed, holidaySkipped, duration)
 
 	return nil
 }
@@ -220,11 +359,14 @@ func (w *ExpandRecurringSeriesWorker) Work(ctx context.Context, job *river.Job[E
 func (w *ExpandRecurringSeriesWorker) fetchSeries(ctx context.Context, seriesID int64) (*SeriesRecord, error) {
 	query := `
 		SELECT
-			id, group_id, entity_table, entity_template, rrule,
-			dtstart, duration::text, timezone, time_slot_property, status,
-			expanded_until, created_by
-		FROM metadata.time_slot_series
-		WHERE id = $1
+			s.id, s.group_id, s.entity_table, s.entity_template, s.rrule,
+			s.dtstart, s.duration::text, s.timezone, s.time_slot_property, s.status,
+			s.expanded_until, s.created_by,
+			g.holiday_calendar_id, COALESCE(g.holiday_policy, 'skip'),
+			COALESCE(g.dst_policy, 'pick_first')
+		FROM metadata.time_slot_series s
+		LEFT JOIN metadata.time_slot_series_groups g ON g.id = s.group_id
+		WHERE s.id = $1
 	`
 
 	var series SeriesRecord
@@ -235,7 +377,8 @@ func (w *ExpandRecurringSeriesWorker) fetchSeries(ctx context.Context, seriesID
 		&series.ID, &series.GroupID, &series.EntityTable, &templateJSON,
 		&series.RRULE, &series.Dtstart, &durationStr, &series.Timezone,
 		&series.TimeSlotProperty, &series.Status, &series.ExpandedUntil,
-		&series.CreatedBy,
+		&series.CreatedBy, &series.HolidayCalendarID, &series.HolidayPolicy,
+		&series.DSTPolicy,
 	)
 	if err != nil {
 		return nil, err
@@ -247,6 +390,7 @@ func (w *ExpandRecurringSeriesWorker) fetchSeries(ctx context.Context, seriesID
 	}
 
 	// Parse duration (PostgreSQL interval to Go duration)
+	series.DurationText = durationStr
 	series.Duration, err = parsePGInterval(durationStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse duration: %w", err)
@@ -261,20 +405,12 @@ func (w *ExpandRecurringSeriesWorker) fetchSeries(ctx context.Context, seriesID
 // dtstart is stored as TIMESTAMP (wall-clock local time) in the database.
 // pgx reads it as time.Time tagged with UTC, but the numeric values represent
 // local wall-clock time. We use these values directly for RRULE expansion,
-// then convertToUTC() handles per-occurrence DST conversion for storage.
+// then resolveLocalTimes() converts each occurrence for storage, applying the
+// series' DST policy to times in a transition.
 func (w *ExpandRecurringSeriesWorker) generateOccurrences(series *SeriesRecord, until time.Time) ([]time.Time, error) {
-	// Determine the timezone for expansion
-	// When a timezone is specified, we expand in that local time to respect DST transitions
+	// Expand in the series' local time to respect DST transitions
 	// (e.g., "2 PM every Monday" stays 2 PM local year-round)
-	loc := time.UTC
-	if series.Timezone != nil && *series.Timezone != "" {
-		var err error
-		loc, err = time.LoadLocation(*series.Timezone)
-		if err != nil {
-			log.Printf("[Warning] Invalid timezone '%s', falling back to UTC: %v", *series.Timezone, err)
-			loc = time.UTC
-		}
-	}
+	loc := seriesLocation(series)
 
 	// dtstart is already wall-clock local time (stored as TIMESTAMP in DB).
 	// pgx tags it as UTC but the numeric values ARE the local time.
@@ -299,23 +435,47 @@ func (w *ExpandRecurringSeriesWorker) generateOccurrences(series *SeriesRecord,
 		rule.DTStart(localDtstart)
 		localOccurrences := rule.Between(localDtstart, localUntil, true)
 		// Convert results back to UTC for storage
-		return convertToUTC(localOccurrences, loc), nil
+		return seriesOccurrencesToUTC(series, localOccurrences, loc), nil
 	}
 
 	localOccurrences := ruleSet.Between(localDtstart, localUntil, true)
 	// Convert results back to UTC for storage
-	return convertToUTC(localOccurrences, loc), nil
+	return seriesOccurrencesToUTC(series, localOccurrences, loc), nil
+}
+
+// seriesOccurrencesToUTC converts wall-clock occurrences to UTC with the
+// series' DST policy, logging every occurrence the policy moved or skipped
+func seriesOccurrencesToUTC(series *SeriesRecord, localOccurrences []time.Time, loc *time.Location) []time.Time {
+	policy := series.DSTPolicy
+	if policy == "" {
+		policy = dstPolicyPickFirst
+	}
+	occurrences, adjustments := resolveLocalTimes(localOccurrences, loc, policy)
+	for _, adj := range adjustments {
+		log.Printf("[Series %d] DST transition: %s (dst_policy=%s)", series.ID, adj.Message, policy)
+	}
+	return occurrences
+}
+
+// seriesLocation returns the series' timezone, or UTC if it has none or it
+// is invalid
+func seriesLocation(series *SeriesRecord) *time.Location {
+	if series.Timezone == nil || *series.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(*series.Timezone)
+	if err != nil {
+		log.Printf("[Warning] Invalid timezone '%s', falling back to UTC: %v", *series.Timezone, err)
+		return time.UTC
+	}
+	return loc
 }
 
 // convertToUTC converts a slice of times from local timezone to UTC.
 // This ensures storage is always UTC while respecting wall-clock DST transitions.
+// Times in a transition are resolved with the default pick_first policy.
 func convertToUTC(times []time.Time, loc *time.Location) []time.Time {
-	result := make([]time.Time, len(times))
-	for i, t := range times {
-		// Create time in the local timezone, then convert to UTC
-		localTime := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
-		result[i] = localTime.UTC()
-	}
+	result, _ := resolveLocalTimes(times, loc, dstPolicyPickFirst)
 	return result
 }
 
@@ -425,12 +585,13 @@ func (w *ExpandRecurringSeriesWorker) insertEntityRecord(ctx context.Context, ta
 	return entityID, nil
 }
 
-// insertEntityWithInstance atomically inserts an entity record AND its junction
-// record in a single transaction. This prevents orphaned entities when the
-// junction INSERT fails (e.g., due to a unique constraint on series_id + occurrence_date).
+// insertEntityWithInstance atomically inserts an entity record, its child
+// records AND its junction record in a single transaction. This prevents
+// orphaned entities when the junction INSERT fails (e.g., due to a unique
+// constraint on series_id + occurrence_date).
 func (w *ExpandRecurringSeriesWorker) insertEntityWithInstance(
-	ctx context.Context, series *SeriesRecord, occDate time.Time,
-	record map[string]interface{}, colInfo *TableColumnInfo,
+	ctx context.Context, jobID int64, series *SeriesRecord, occDate time.Time,
+	record map[string]interface{}, colInfo *TableColumnInfo, children []SeriesChildTemplate,
 ) (int64, error) {
 	tx, err := w.dbPool.Begin(ctx)
 	if err != nil {
@@ -438,6 +599,36 @@ func (w *ExpandRecurringSeriesWorker) insertEntityWithInstance(
 	}
 	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
 
+	// Hold the series lock so update_series_schedule() can't replace the
+	// schedule between this check and the INSERT
+	conflict, err := lockEntity(ctx, w.dbPool, tx, EntityLock{
+		EntityType: "time_slot_series",
+		EntityID:   strconv.FormatInt(series.ID, 10),
+		Policy:     EntityLockWait,
+		Timeout:    seriesLockTimeout,
+		Operation:  "expand_recurring_series",
+		JobID:      jobID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if conflict != nil {
+		return 0, conflict
+	}
+
+	var unchanged bool
+	err = tx.QueryRow(ctx, `
+		SELECT status = 'active' AND rrule = $2 AND dtstart = $3 AND duration::text = $4
+		FROM metadata.time_slot_series
+		WHERE id = $1
+	`, series.ID, series.RRULE, series.Dtstart, series.DurationText).Scan(&unchanged)
+	if err != nil {
+		return 0, fmt.Errorf("failed to recheck series: %w", err)
+	}
+	if !unchanged {
+		return 0, errSeriesChanged
+	}
+
 	// Set JWT claims GUC so current_user_id() works for column defaults
 	if series.CreatedBy != nil {
 		if !uuidPattern.MatchString(*series.CreatedBy) {
@@ -482,7 +673,13 @@ func (w *ExpandRecurringSeriesWorker) insertEntityWithInstance(
 		return 0, err
 	}
 
-	// 2. Insert junction record in the same transaction
+	// 2. Insert child records; a failure (e.g. a double-booked staff member)
+	// rolls back the occurrence
+	if err = insertChildRecords(ctx, tx, series, entityID, children); err != nil {
+		return 0, err
+	}
+
+	// 3. Insert junction record in the same transaction
 	instanceQuery := `
 		INSERT INTO metadata.time_slot_instances
 		(series_id, occurrence_date, entity_table, entity_id, is_exception, exception_type)
@@ -502,6 +699,135 @@ func (w *ExpandRecurringSeriesWorker) insertEntityWithInstance(
 	return entityID, nil
 }
 
+// insertChildRecords inserts each child template's copies for the
+// occurrence entityID in tx
+func insertChildRecords(ctx context.Context, tx pgx.Tx, series *SeriesRecord, entityID int64, children []SeriesChildTemplate) error {
+	for _, child := range children {
+		copies := child.Copies
+		if child.CopiesProperty != nil {
+			countQuery := fmt.Sprintf("SELECT COALESCE(%s, 0)::INT FROM public.%s WHERE id = $1",
+				pgx.Identifier{*child.CopiesProperty}.Sanitize(), pgx.Identifier{series.EntityTable}.Sanitize())
+			if err := tx.QueryRow(ctx, countQuery, entityID).Scan(&copies); err != nil {
+				return fmt.Errorf("failed to read %s for %s rows: %w", *child.CopiesProperty, child.ChildTable, err)
+			}
+		}
+		copies = min(max(copies, 0), maxSeriesChildCopies)
+
+		query, values := buildChildInsert(child, entityID, series.CreatedBy)
+		for range copies {
+			if _, err := tx.Exec(ctx, query, values...); err != nil {
+				return fmt.Errorf("failed to create %s record: %w", child.ChildTable, err)
+			}
+		}
+	}
+	return nil
+}
+
+// buildChildInsert returns the INSERT for one row of child, in column order
+func buildChildInsert(child SeriesChildTemplate, entityID int64, createdBy *string) (string, []interface{}) {
+	keys := make([]string, 0, len(child.Template))
+	for k := range child.Template {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	columns := make([]string, 0, len(keys)+2)
+	values := make([]interface{}, 0, len(keys)+2)
+	placeholders := make([]string, 0, len(keys)+2)
+	add := func(column string, value interface{}) {
+		columns = append(columns, pgx.Identifier{column}.Sanitize())
+		values = append(values, value)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(values)))
+	}
+	for _, k := range keys {
+		add(k, child.Template[k])
+	}
+	add(child.ParentColumn, entityID)
+	if createdBy != nil && child.HasCreatedBy {
+		add("created_by", *createdBy)
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO public.%s (%s) VALUES (%s)",
+		pgx.Identifier{child.ChildTable}.Sanitize(),
+		joinStrings(columns, ", "),
+		joinStrings(placeholders, ", "),
+	)
+	return query, values
+}
+
+// fetchChildTemplates returns the series group's child templates in order.
+// A series without a group has none.
+func (w *ExpandRecurringSeriesWorker) fetchChildTemplates(ctx context.Context, groupID *int64) ([]SeriesChildTemplate, error) {
+	if groupID == nil {
+		return nil, nil
+	}
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT c.id, c.child_table, c.parent_column, c.child_template, c.copies, c.copies_property,
+		       EXISTS(
+		           SELECT 1 FROM information_schema.columns ic
+		           WHERE ic.table_schema = 'public' AND ic.table_name = c.child_table
+		             AND ic.column_name = 'created_by'
+		       )
+		FROM metadata.series_child_templates c
+		WHERE c.group_id = $1
+		ORDER BY c.sort_order, c.id
+	`, *groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []SeriesChildTemplate
+	for rows.Next() {
+		var child SeriesChildTemplate
+		var templateJSON []byte
+		if err := rows.Scan(&child.ID, &child.ChildTable, &child.ParentColumn, &templateJSON,
+			&child.Copies, &child.CopiesProperty, &child.HasCreatedBy); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(templateJSON, &child.Template); err != nil {
+			return nil, fmt.Errorf("failed to parse child_template %d: %w", child.ID, err)
+		}
+		children = append(children, child)
+	}
+	return children, rows.Err()
+}
+
+// checkChildTemplateDrift validates a child template against its table's
+// current schema, like checkSchemaDrift. The parent column is set by
+// expansion, so it counts as present.
+func (w *ExpandRecurringSeriesWorker) checkChildTemplateDrift(ctx context.Context, child SeriesChildTemplate) ([]string, error) {
+	template := make(map[string]interface{}, len(child.Template)+1)
+	for k, v := range child.Template {
+		template[k] = v
+	}
+	template[child.ParentColumn] = nil
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT field, issue
+		FROM metadata.validate_template_against_schema($1, $2)
+	`, child.ChildTable, templateJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var issues []string
+	for rows.Next() {
+		var field, issue string
+		if err := rows.Scan(&field, &issue); err != nil {
+			return nil, err
+		}
+		issues = append(issues, fmt.Sprintf("%s.%s: %s", child.ChildTable, field, issue))
+	}
+	return issues, rows.Err()
+}
+
 // createInstanceRecord creates a junction record
 func (w *ExpandRecurringSeriesWorker) createInstanceRecord(ctx context.Context, seriesID int64, occDate time.Time, entityTable string, entityID *int64, isException bool, exceptionType string) error {
 	query := `
@@ -685,29 +1011,10 @@ func (w *ExpandRecurringSeriesWorker) notifySeriesSchemasDrift(ctx context.Conte
 		return
 	}
 
-	// Insert notification record and queue job
+	// enqueue_notification_job() announces the row; the listener queues delivery
 	_, err = w.dbPool.Exec(ctx, `
-		WITH notif AS (
-			INSERT INTO metadata.notifications (user_id, template_name, entity_type, entity_id, entity_data, channels)
-			VALUES ($1, 'series_schema_drift', 'time_slot_series', $2::TEXT, $3::JSONB, ARRAY['email'])
-			RETURNING id
-		)
-		INSERT INTO river_job (state, queue, kind, args, scheduled_at)
-		SELECT
-			'available',
-			'notifications',
-			'send_notification',
-			jsonb_build_object(
-				'notification_id', notif.id::TEXT,
-				'user_id', $1::TEXT,
-				'template_name', 'series_schema_drift',
-				'entity_type', 'time_slot_series',
-				'entity_id', $2::TEXT,
-				'entity_data', $3::JSONB,
-				'channels', ARRAY['email']
-			),
-			NOW()
-		FROM notif
+		INSERT INTO metadata.notifications (user_id, template_name, entity_type, entity_id, entity_data, channels)
+		VALUES ($1, 'series_schema_drift', 'time_slot_series', $2::TEXT, $3::JSONB, ARRAY['email'])
 	`, series.CreatedBy, series.ID, entityDataJSON)
 
 	if err != nil {
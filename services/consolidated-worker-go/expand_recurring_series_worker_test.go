@@ -924,3 +924,43 @@ func TestIsJWTWarning_FalseForHardDrift(t *testing.T) {
 		t.Errorf("isJWTWarning(%q) = true, want false", issue)
 	}
 }
+
+// ============================================================================
+// Child Template Tests
+// ============================================================================
+
+func TestBuildChildInsert_SortedColumnsWithParentAndCreatedBy(t *testing.T) {
+	createdBy := "11111111-2222-3333-4444-555555555555"
+	child := SeriesChildTemplate{
+		ChildTable:   "staff_assignments",
+		ParentColumn: "shift_id",
+		Template:     map[string]interface{}{"role": "lifeguard", "hours": float64(2)},
+		HasCreatedBy: true,
+	}
+
+	query, values := buildChildInsert(child, 42, &createdBy)
+
+	want := `INSERT INTO public."staff_assignments" ("hours", "role", "shift_id", "created_by") VALUES ($1, $2, $3, $4)`
+	if query != want {
+		t.Errorf("query = %s\nwant %s", query, want)
+	}
+	if len(values) != 4 || values[0] != float64(2) || values[1] != "lifeguard" || values[2] != int64(42) || values[3] != createdBy {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestBuildChildInsert_NoCreatedByColumn(t *testing.T) {
+	createdBy := "11111111-2222-3333-4444-555555555555"
+	child := SeriesChildTemplate{
+		ChildTable:   "seats",
+		ParentColumn: "event_id",
+		Template:     map[string]interface{}{},
+	}
+
+	query, values := buildChildInsert(child, 7, &createdBy)
+
+	want := `INSERT INTO public."seats" ("event_id") VALUES ($1)`
+	if query != want || len(values) != 1 {
+		t.Errorf("query = %s (%d values), want %s", query, len(values), want)
+	}
+}
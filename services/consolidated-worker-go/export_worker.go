@@ -0,0 +1,788 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Job Definition: Entity Export
+// ============================================================================
+
+// Default limits (EXPORT_MAX_ROWS, EXPORT_PDF_MAX_ROWS, EXPORT_LINK_HOURS)
+const (
+	defaultExportMaxRows    = 500000
+	defaultExportPDFMaxRows = 5000
+	defaultExportLinkHours  = 72
+	maxExportLinkTTL        = 7 * 24 * time.Hour // SigV4 presigned URL limit
+)
+
+// ExportGenerateArgs generates one metadata.entity_exports row, queued by
+// the listener when request_entity_export() notifies export_requested
+type ExportGenerateArgs struct {
+	ExportID int64 `json:"export_id"`
+}
+
+func (ExportGenerateArgs) Kind() string { return "export_generate" }
+
+func (ExportGenerateArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "exports",
+		MaxAttempts: 3,
+		Priority:    2,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:  true,
+			ByState: notifyJobUniqueStates,
+		},
+	}
+}
+
+// exportRequestedChannel queues exports that request_entity_export()
+// announces on export_requested (payload: export ID). Resync covers exports
+// still pending; the worker marks an export running when it starts.
+func exportRequestedChannel(dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx]) NotifyChannel {
+	scan := func(rows pgx.Rows) (river.JobArgs, error) {
+		var args ExportGenerateArgs
+		err := rows.Scan(&args.ExportID)
+		return args, err
+	}
+	return NotifyChannel{
+		Name: "export_requested",
+		Handle: func(ctx context.Context, payload string) error {
+			id, err := strconv.ParseInt(payload, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid export ID %q", payload)
+			}
+			_, err = riverClient.Insert(ctx, ExportGenerateArgs{ExportID: id}, nil)
+			return err
+		},
+		Resync: func(ctx context.Context) error {
+			return resyncJobs(ctx, "export_requested", dbPool, riverClient, scan, `
+				SELECT id FROM metadata.entity_exports
+				WHERE status = 'pending'
+			`)
+		},
+	}
+}
+
+// ============================================================================
+// Worker Implementation
+// ============================================================================
+
+// ExportWorker runs an export's list query as the requester, writes the
+// rows to a temporary file, uploads it to S3 and notifies the requester
+// with a presigned download link
+type ExportWorker struct {
+	river.WorkerDefaults[ExportGenerateArgs]
+	dbPool     *pgxpool.Pool
+	s3Client   *s3.Client
+	presigner  *s3.PresignClient
+	bucket     string
+	maxRows    int
+	pdfMaxRows int
+	linkTTL    time.Duration
+	timezone   *time.Location
+}
+
+// Timeout allows for large tables; the query has its own statement timeout
+func (w *ExportWorker) Timeout(*river.Job[ExportGenerateArgs]) time.Duration {
+	return 30 * time.Minute
+}
+
+// exportRequestError is a problem with the export request itself (unknown
+// column, bad filter, too many rows, no access); retrying can't fix it
+type exportRequestError struct{ msg string }
+
+func (e *exportRequestError) Error() string { return e.msg }
+
+func exportRequestErrorf(format string, args ...any) error {
+	return &exportRequestError{msg: fmt.Sprintf(format, args...)}
+}
+
+// entityExport is a metadata.entity_exports row with its requester
+type entityExport struct {
+	ID          int64
+	UserID      string
+	UserEmail   string
+	TableName   string
+	DisplayName string
+	Format      string
+	Filters     []byte // JSON array of exportFilter
+	Columns     []string
+	OrderBy     string
+	Roles       []string
+	Status      string
+}
+
+// exportResult is a generated file
+type exportResult struct {
+	RowCount  int
+	Columns   []string
+	Withheld  []string
+	FileName  string
+	S3Key     string
+	ByteSize  int64
+	URL       string
+	ExpiresAt time.Time
+}
+
+func (w *ExportWorker) Work(ctx context.Context, job *river.Job[ExportGenerateArgs]) error {
+	exp, err := w.loadExport(ctx, job.Args.ExportID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("[Job %d] Export %d no longer exists, skipping", job.ID, job.Args.ExportID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load export: %w", err)
+	}
+	if exp.Status != "pending" && exp.Status != "running" {
+		log.Printf("[Job %d] Export %d already %s, skipping", job.ID, exp.ID, exp.Status)
+		return nil
+	}
+
+	log.Printf("[Job %d] Exporting %s as %s for user %s (attempt %d/%d)",
+		job.ID, exp.TableName, exp.Format, exp.UserID, job.Attempt, job.MaxAttempts)
+	if _, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.entity_exports SET status = 'running', started_at = COALESCE(started_at, NOW())
+		WHERE id = $1
+	`, exp.ID); err != nil {
+		return fmt.Errorf("failed to mark export running: %w", err)
+	}
+
+	start := time.Now()
+	result, err := w.generate(ctx, exp)
+	if err != nil {
+		var requestErr *exportRequestError
+		if errors.As(err, &requestErr) || job.Attempt >= job.MaxAttempts {
+			log.Printf("[Job %d] Export %d failed: %v", job.ID, exp.ID, err)
+			return w.fail(ctx, exp, err.Error())
+		}
+		return err
+	}
+
+	if err := w.complete(ctx, exp, result); err != nil {
+		return err
+	}
+	log.Printf("[Job %d] ✓ Export %d: %d rows, %d bytes at %s in %v",
+		job.ID, exp.ID, result.RowCount, result.ByteSize, result.S3Key, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (w *ExportWorker) loadExport(ctx context.Context, id int64) (*entityExport, error) {
+	exp := &entityExport{ID: id}
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT x.user_id::text, COALESCE(u.email, ''), x.table_name,
+		       COALESCE(e.display_name, x.table_name), x.format, x.filters,
+		       COALESCE(x.columns, '{}'), COALESCE(x.order_by, ''), x.roles, x.status
+		FROM metadata.entity_exports x
+		LEFT JOIN metadata.entities e ON e.table_name = x.table_name
+		LEFT JOIN metadata.civic_os_users_private u ON u.id = x.user_id
+		WHERE x.id = $1
+	`, id).Scan(&exp.UserID, &exp.UserEmail, &exp.TableName,
+		&exp.DisplayName, &exp.Format, &exp.Filters,
+		&exp.Columns, &exp.OrderBy, &exp.Roles, &exp.Status)
+	if err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// generate writes the export file and uploads it
+func (w *ExportWorker) generate(ctx context.Context, exp *entityExport) (*exportResult, error) {
+	format, ok := exportFormats[exp.Format]
+	if !ok {
+		return nil, exportRequestErrorf("unsupported export format %q", exp.Format)
+	}
+	var filters []exportFilter
+	if err := json.Unmarshal(exp.Filters, &filters); err != nil {
+		return nil, exportRequestErrorf("invalid filters: %v", err)
+	}
+	maxRows := w.maxRows
+	if exp.Format == "pdf" {
+		maxRows = min(maxRows, w.pdfMaxRows)
+	}
+
+	table, err := w.loadColumns(ctx, exp.TableName)
+	if err != nil {
+		return nil, err
+	}
+	columns, withheld, err := table.selectColumns(exp.Columns)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := buildExportQuery(exp.TableName, table, columns, filters, exp.OrderBy, maxRows+1)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "export-*"+format.Extension)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	buffered := bufio.NewWriterSize(file, 64*1024)
+	writer, err := format.New(buffered, exp.DisplayName, columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s file: %w", exp.Format, err)
+	}
+	rowCount, err := w.streamRows(ctx, exp, query, args, len(columns), maxRows, writer)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish %s file: %w", exp.Format, err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write export file: %w", err)
+	}
+	size, err := file.Seek(0, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to size export file: %w", err)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("failed to rewind export file: %w", err)
+	}
+
+	now := time.Now()
+	result := &exportResult{
+		RowCount:  rowCount,
+		Columns:   make([]string, len(columns)),
+		Withheld:  withheld,
+		FileName:  exportFileName(exp.DisplayName, format.Extension, now.In(w.timezone)),
+		S3Key:     fmt.Sprintf("exports/%s/%d/export%s", exp.UserID, exp.ID, format.Extension),
+		ByteSize:  size,
+		ExpiresAt: now.Add(w.linkTTL),
+	}
+	for i, col := range columns {
+		result.Columns[i] = col.Name
+	}
+	disposition := fmt.Sprintf("attachment; filename=%q", result.FileName)
+	_, err = w.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:             aws.String(w.bucket),
+		Key:                aws.String(result.S3Key),
+		Body:               file,
+		ContentLength:      aws.Int64(size),
+		ContentType:        aws.String(format.ContentType),
+		ContentDisposition: aws.String(disposition),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload export: %w", err)
+	}
+
+	presigned, err := w.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(w.bucket),
+		Key:                        aws.String(result.S3Key),
+		ResponseContentDisposition: aws.String(disposition),
+	}, s3.WithPresignExpires(w.linkTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign download link: %w", err)
+	}
+	result.URL = presigned.URL
+	return result, nil
+}
+
+// streamRows runs the export query as the requester and writes every row.
+// Role authenticated and claims rebuilt from the request make grants and RLS
+// apply exactly as they would through PostgREST.
+func (w *ExportWorker) streamRows(ctx context.Context, exp *entityExport, query string, args []any,
+	columnCount, maxRows int, writer exportWriter) (int, error) {
+	claims, err := json.Marshal(map[string]any{
+		"sub":   exp.UserID,
+		"role":  "authenticated",
+		"email": exp.UserEmail,
+		"roles": exp.Roles,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode claims: %w", err)
+	}
+
+	tx, err := w.dbPool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // read-only, nothing to keep
+
+	if _, err := tx.Exec(ctx, `
+		SELECT set_config('request.jwt.claims', $1, true),
+		       set_config('statement_timeout', '25min', true),
+		       set_config('role', 'authenticated', true)
+	`, string(claims)); err != nil {
+		return 0, fmt.Errorf("failed to assume requester: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return 0, exportQueryError(err)
+	}
+	defer rows.Close()
+
+	cells := make([]*string, columnCount)
+	dest := make([]any, columnCount)
+	for i := range cells {
+		dest[i] = &cells[i]
+	}
+	count := 0
+	for rows.Next() {
+		count++
+		if count > maxRows {
+			return 0, exportRequestErrorf("the list has more than %d rows; narrow the filters or choose another format", maxRows)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return 0, fmt.Errorf("failed to read row %d: %w", count, err)
+		}
+		if err := writer.WriteRow(cells); err != nil {
+			return 0, fmt.Errorf("failed to write row %d: %w", count, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, exportQueryError(err)
+	}
+	return count, nil
+}
+
+// exportQueryError reports errors caused by the request (no access, a
+// filter value that doesn't fit the column) as permanent
+func exportQueryError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "42501":
+			return exportRequestErrorf("you don't have permission to read this list")
+		case strings.HasPrefix(pgErr.Code, "22"):
+			return exportRequestErrorf("a filter value doesn't match its column: %s", pgErr.Message)
+		}
+	}
+	return fmt.Errorf("export query failed: %w", err)
+}
+
+// complete records the file, audits the export and notifies the requester
+// in one transaction, so a retry after a crash can't notify twice
+func (w *ExportWorker) complete(ctx context.Context, exp *entityExport, result *exportResult) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE metadata.entity_exports
+		SET status = 'completed', row_count = $2, withheld_columns = $3, file_name = $4,
+		    s3_key = $5, byte_size = $6, expires_at = $7, completed_at = NOW(), error_message = NULL
+		WHERE id = $1 AND status IN ('pending', 'running')
+	`, exp.ID, result.RowCount, result.Withheld, result.FileName, result.S3Key, result.ByteSize, result.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record export: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil // another attempt got there first
+	}
+
+	// Same event as the browser export's log_data_export()
+	auditData, err := json.Marshal(map[string]any{
+		"table_name":               exp.TableName,
+		"export_type":              "worker_" + exp.Format,
+		"export_id":                exp.ID,
+		"row_count":                result.RowCount,
+		"columns":                  result.Columns,
+		"withheld_columns":         result.Withheld,
+		"private_columns_exported": []string{},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode audit data: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+		VALUES ($1, NULLIF($2, ''), 'data_export', $3)
+	`, exp.UserID, exp.UserEmail, auditData); err != nil {
+		return fmt.Errorf("failed to audit export: %w", err)
+	}
+
+	if err := w.notify(ctx, tx, exp, map[string]any{
+		"status":           "completed",
+		"row_count":        result.RowCount,
+		"file_name":        result.FileName,
+		"download_url":     result.URL,
+		"expires_at":       result.ExpiresAt.In(w.timezone).Format("January 2, 2006 3:04 PM MST"),
+		"withheld_columns": strings.Join(result.Withheld, ", "),
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// fail marks the export failed and tells the requester why
+func (w *ExportWorker) fail(ctx context.Context, exp *entityExport, message string) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE metadata.entity_exports
+		SET status = 'failed', error_message = $2, completed_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'running')
+	`, exp.ID, message)
+	if err != nil {
+		return fmt.Errorf("failed to record export failure: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	if err := w.notify(ctx, tx, exp, map[string]any{
+		"status":        "failed",
+		"error_message": message,
+	}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// notify creates the entity_export_ready notification; its insert trigger
+// queues the email
+func (w *ExportWorker) notify(ctx context.Context, tx pgx.Tx, exp *entityExport, data map[string]any) error {
+	data["id"] = exp.ID
+	data["table_name"] = exp.TableName
+	data["display_name"] = exp.DisplayName
+	data["format"] = strings.ToUpper(exp.Format)
+	entityData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification data: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO metadata.notifications (user_id, template_name, entity_type, entity_id, entity_data, channels)
+		VALUES ($1, 'entity_export_ready', 'entity_exports', $2, $3, '{email}')
+	`, exp.UserID, strconv.FormatInt(exp.ID, 10), entityData)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	return nil
+}
+
+// ============================================================================
+// Columns and Query
+// ============================================================================
+
+// exportColumn is one column of an export
+type exportColumn struct {
+	Name    string
+	Header  string // metadata.properties display name, or the column name
+	Type    string // format_type(), e.g. "integer", "character varying(50)"
+	Numeric bool   // written as a number in XLSX
+	Private bool   // in metadata.column_privacy, never exported
+}
+
+// exportTable is the exportable columns of a table in list order
+type exportTable struct {
+	columns []exportColumn
+	byName  map[string]exportColumn
+}
+
+func newExportTable(columns []exportColumn) *exportTable {
+	t := &exportTable{columns: columns, byName: make(map[string]exportColumn, len(columns))}
+	for _, col := range columns {
+		t.byName[col.Name] = col
+	}
+	return t
+}
+
+// loadColumns reads the columns of a public table or view in list order:
+// metadata.properties sort order, then position. The full-text search
+// column and other tsvector columns are left out.
+func (w *ExportWorker) loadColumns(ctx context.Context, tableName string) (*exportTable, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT a.attname, COALESCE(p.display_name, initcap(replace(a.attname, '_', ' '))),
+		       format_type(a.atttypid, a.atttypmod), t.typcategory = 'N',
+		       metadata.is_column_private($1, a.attname)
+		FROM pg_attribute a
+		JOIN pg_type t ON t.oid = a.atttypid
+		LEFT JOIN metadata.properties p ON p.table_name = $1 AND p.column_name = a.attname
+		WHERE a.attrelid = to_regclass(format('public.%I', $1::TEXT))
+		  AND a.attnum > 0 AND NOT a.attisdropped
+		  AND t.typname <> 'tsvector'
+		ORDER BY COALESCE(p.sort_order, a.attnum), a.attnum
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	columns, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (exportColumn, error) {
+		var c exportColumn
+		err := row.Scan(&c.Name, &c.Header, &c.Type, &c.Numeric, &c.Private)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return nil, exportRequestErrorf("table %q not found", tableName)
+	}
+	return newExportTable(columns), nil
+}
+
+// selectColumns returns the requested columns (every column when none are
+// requested) without private ones, and the private columns left out
+func (t *exportTable) selectColumns(requested []string) ([]exportColumn, []string, error) {
+	candidates := t.columns
+	if len(requested) > 0 {
+		candidates = make([]exportColumn, 0, len(requested))
+		for _, name := range requested {
+			col, ok := t.byName[name]
+			if !ok {
+				return nil, nil, exportRequestErrorf("unknown column %q", name)
+			}
+			candidates = append(candidates, col)
+		}
+	}
+
+	var selected []exportColumn
+	withheld := []string{}
+	for _, col := range candidates {
+		if col.Private {
+			withheld = append(withheld, col.Name)
+			continue
+		}
+		selected = append(selected, col)
+	}
+	if len(selected) == 0 {
+		return nil, nil, exportRequestErrorf("no exportable columns")
+	}
+	return selected, withheld, nil
+}
+
+// exportFilter is one list view filter, as sent to PostgREST
+type exportFilter struct {
+	Column   string `json:"column"`
+	Operator string `json:"operator"`
+	Value    any    `json:"value"`
+}
+
+// exportComparisons maps PostgREST comparison operators to SQL
+var exportComparisons = map[string]string{
+	"eq": "=", "neq": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=",
+}
+
+// buildExportQuery builds the export SELECT. Every value is a parameter
+// cast to the column's type; identifiers and types come from the catalog.
+func buildExportQuery(tableName string, table *exportTable, columns []exportColumn,
+	filters []exportFilter, orderBy string, limit int) (string, []any, error) {
+	selects := make([]string, len(columns))
+	for i, col := range columns {
+		name := pgx.Identifier{col.Name}.Sanitize()
+		if strings.HasPrefix(col.Type, "geography") || strings.HasPrefix(col.Type, "geometry") {
+			selects[i] = "ST_AsText(" + name + ")"
+		} else {
+			selects[i] = name + "::text"
+		}
+	}
+
+	var where []string
+	var args []any
+	param := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	for _, f := range filters {
+		col, ok := table.byName[f.Column]
+		if !ok {
+			return "", nil, exportRequestErrorf("unknown filter column %q", f.Column)
+		}
+		name := pgx.Identifier{col.Name}.Sanitize()
+		switch op := f.Operator; op {
+		case "eq", "neq", "gt", "gte", "lt", "lte":
+			where = append(where, fmt.Sprintf("%s %s %s::text::%s", name, exportComparisons[op], param(filterText(f.Value)), col.Type))
+		case "like", "ilike":
+			// PostgREST accepts * as the wildcard
+			pattern := strings.ReplaceAll(filterText(f.Value), "*", "%")
+			where = append(where, fmt.Sprintf("%s::text %s %s", name, strings.ToUpper(op), param(pattern)))
+		case "is":
+			switch strings.ToLower(filterText(f.Value)) {
+			case "null", "":
+				where = append(where, name+" IS NULL")
+			case "true":
+				where = append(where, name+" IS TRUE")
+			case "false":
+				where = append(where, name+" IS FALSE")
+			default:
+				return "", nil, exportRequestErrorf("invalid value for %s.is: %v", f.Column, f.Value)
+			}
+		case "in":
+			where = append(where, fmt.Sprintf("%s = ANY(%s::text[]::%s[])", name, param(filterList(f.Value)), col.Type))
+		default:
+			return "", nil, exportRequestErrorf("unsupported filter operator %q", op)
+		}
+	}
+
+	order, err := exportOrder(table, orderBy)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "), pgx.Identifier{"public", tableName}.Sanitize())
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + order + " LIMIT " + param(limit)
+	return query, args, nil
+}
+
+// exportOrder parses "column", "column desc" or "column.desc"; by default
+// the list is ordered by id, or its first column
+func exportOrder(table *exportTable, orderBy string) (string, error) {
+	column, direction := strings.TrimSpace(orderBy), "ASC"
+	if i := strings.LastIndexAny(column, ". "); i > 0 {
+		switch strings.ToLower(strings.TrimSpace(column[i+1:])) {
+		case "asc":
+			column = strings.TrimSpace(column[:i])
+		case "desc":
+			column, direction = strings.TrimSpace(column[:i]), "DESC"
+		}
+	}
+	if column == "" {
+		if _, ok := table.byName["id"]; ok {
+			column = "id"
+		} else {
+			column = table.columns[0].Name
+		}
+	}
+	if _, ok := table.byName[column]; !ok {
+		return "", exportRequestErrorf("unknown sort column %q", column)
+	}
+	return pgx.Identifier{column}.Sanitize() + " " + direction, nil
+}
+
+// filterText formats a JSON filter value the way PostgREST receives it
+func filterText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// filterList reads an in filter's value: a JSON array, or PostgREST's
+// "(a,b,c)" text form
+func filterList(v any) []string {
+	if items, ok := v.([]any); ok {
+		list := make([]string, len(items))
+		for i, item := range items {
+			list[i] = filterText(item)
+		}
+		return list
+	}
+	text := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(filterText(v)), "("), ")")
+	if text == "" {
+		return []string{}
+	}
+	list := strings.Split(text, ",")
+	for i := range list {
+		list[i] = strings.Trim(strings.TrimSpace(list[i]), `"`)
+	}
+	return list
+}
+
+// ============================================================================
+// Cleanup
+// ============================================================================
+
+// ExportCleanupTask deletes export files whose download link has expired
+type ExportCleanupTask struct {
+	dbPool   *pgxpool.Pool
+	s3Client objectDeleter
+	bucket   string
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (e *ExportCleanupTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "export_cleanup",
+		Description: "Delete export files whose download link has expired",
+		Interval:    time.Hour,
+		Jitter:      5 * time.Minute,
+		Run:         e.runCleanup,
+	}
+}
+
+func (e *ExportCleanupTask) runCleanup(ctx context.Context) (string, error) {
+	rows, err := e.dbPool.Query(ctx, `
+		SELECT id, s3_key FROM metadata.entity_exports
+		WHERE status = 'completed' AND expires_at < NOW()
+		ORDER BY expires_at
+		LIMIT 500
+	`)
+	if err != nil {
+		return "", fmt.Errorf("failed to find expired exports: %w", err)
+	}
+	type expired struct {
+		id    int64
+		s3Key string
+	}
+	exports, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (expired, error) {
+		var x expired
+		err := row.Scan(&x.id, &x.s3Key)
+		return x, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find expired exports: %w", err)
+	}
+
+	ids := make(map[string][]int64, len(exports))
+	keys := make([]string, 0, len(exports))
+	for _, x := range exports {
+		if ids[x.s3Key] == nil {
+			keys = append(keys, x.s3Key)
+		}
+		ids[x.s3Key] = append(ids[x.s3Key], x.id)
+	}
+
+	deletedKeys, failed := deleteObjectsBatch(ctx, e.s3Client, e.bucket, keys)
+	for key, err := range failed {
+		log.Printf("[Maintenance] export_cleanup: failed to delete %s: %v", key, err)
+	}
+	var expiredIDs []int64
+	for _, key := range deletedKeys {
+		expiredIDs = append(expiredIDs, ids[key]...)
+	}
+	deleted := len(expiredIDs)
+	if deleted > 0 {
+		if _, err := e.dbPool.Exec(ctx, `
+			UPDATE metadata.entity_exports SET status = 'expired', s3_key = NULL WHERE id = ANY($1)
+		`, expiredIDs); err != nil {
+			return "", fmt.Errorf("failed to mark %d export(s) expired: %w", deleted, err)
+		}
+	}
+	return fmt.Sprintf("Deleted %d expired export file(s)", deleted), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testExportTable() *exportTable {
+	return newExportTable([]exportColumn{
+		{Name: "id", Header: "ID", Type: "bigint", Numeric: true},
+		{Name: "title", Header: "Title", Type: "character varying(200)"},
+		{Name: "status_id", Header: "Status", Type: "integer", Numeric: true},
+		{Name: "location", Header: "Location", Type: "geography(Point,4326)"},
+		{Name: "contact_phone", Header: "Contact Phone", Type: "text", Private: true},
+		{Name: "is_public", Header: "Is Public", Type: "boolean"},
+	})
+}
+
+func TestExportSelectColumns(t *testing.T) {
+	table := testExportTable()
+
+	columns, withheld, err := table.selectColumns(nil)
+	if err != nil {
+		t.Fatalf("selectColumns(nil) error = %v", err)
+	}
+	if len(columns) != 5 {
+		t.Errorf("selectColumns(nil) = %d columns, want 5 (all but the private one)", len(columns))
+	}
+	if !reflect.DeepEqual(withheld, []string{"contact_phone"}) {
+		t.Errorf("withheld = %v, want [contact_phone]", withheld)
+	}
+
+	// Requested order is kept and private columns are withheld even when asked for
+	columns, withheld, err = table.selectColumns([]string{"title", "contact_phone", "id"})
+	if err != nil {
+		t.Fatalf("selectColumns() error = %v", err)
+	}
+	if len(columns) != 2 || columns[0].Name != "title" || columns[1].Name != "id" {
+		t.Errorf("selectColumns() = %+v, want title, id", columns)
+	}
+	if !reflect.DeepEqual(withheld, []string{"contact_phone"}) {
+		t.Errorf("withheld = %v, want [contact_phone]", withheld)
+	}
+
+	var requestErr *exportRequestError
+	if _, _, err := table.selectColumns([]string{"nope"}); !errors.As(err, &requestErr) {
+		t.Errorf("unknown column: error = %v, want exportRequestError", err)
+	}
+	if _, _, err := table.selectColumns([]string{"contact_phone"}); !errors.As(err, &requestErr) {
+		t.Errorf("only private columns: error = %v, want exportRequestError", err)
+	}
+}
+
+func TestBuildExportQuery(t *testing.T) {
+	table := testExportTable()
+	columns, _, _ := table.selectColumns([]string{"id", "title", "location"})
+	filters := []exportFilter{
+		{Column: "status_id", Operator: "eq", Value: float64(3)},
+		{Column: "title", Operator: "ilike", Value: "*pothole*"},
+		{Column: "id", Operator: "in", Value: "(1,2,3)"},
+		{Column: "is_public", Operator: "is", Value: "true"},
+	}
+
+	query, args, err := buildExportQuery("issues", table, columns, filters, "title.desc", 101)
+	if err != nil {
+		t.Fatalf("buildExportQuery() error = %v", err)
+	}
+	want := `SELECT "id"::text, "title"::text, ST_AsText("location") FROM "public"."issues"` +
+		` WHERE "status_id" = $1::text::integer AND "title"::text ILIKE $2` +
+		` AND "id" = ANY($3::text[]::bigint[]) AND "is_public" IS TRUE` +
+		` ORDER BY "title" DESC LIMIT $4`
+	if query != want {
+		t.Errorf("query =\n%s\nwant\n%s", query, want)
+	}
+	wantArgs := []any{"3", "%pothole%", []string{"1", "2", "3"}, 101}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %#v, want %#v", args, wantArgs)
+	}
+}
+
+func TestBuildExportQueryRejects(t *testing.T) {
+	table := testExportTable()
+	columns, _, _ := table.selectColumns(nil)
+	tests := []struct {
+		name    string
+		filters []exportFilter
+		orderBy string
+	}{
+		{"unknown filter column", []exportFilter{{Column: "id; DROP TABLE issues", Operator: "eq", Value: "1"}}, ""},
+		{"unknown operator", []exportFilter{{Column: "id", Operator: "cs", Value: "{1}"}}, ""},
+		{"bad is value", []exportFilter{{Column: "is_public", Operator: "is", Value: "maybe"}}, ""},
+		{"unknown sort column", nil, "secret desc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := buildExportQuery("issues", table, columns, tt.filters, tt.orderBy, 10)
+			var requestErr *exportRequestError
+			if !errors.As(err, &requestErr) {
+				t.Errorf("error = %v, want exportRequestError", err)
+			}
+		})
+	}
+}
+
+func TestExportOrder(t *testing.T) {
+	table := testExportTable()
+	tests := map[string]string{
+		"":              `"id" ASC`,
+		"title":         `"title" ASC`,
+		"title desc":    `"title" DESC`,
+		"status_id.asc": `"status_id" ASC`,
+		" title.DESC ":  `"title" DESC`,
+		"contact_phone": `"contact_phone" ASC`, // sorting by a private column doesn't export it
+	}
+	for orderBy, want := range tests {
+		got, err := exportOrder(table, orderBy)
+		if err != nil || got != want {
+			t.Errorf("exportOrder(%q) = %q, %v, want %q", orderBy, got, err, want)
+		}
+	}
+
+	// Without an id column the first column is the default sort
+	noID := newExportTable([]exportColumn{{Name: "code", Type: "text"}})
+	if got, _ := exportOrder(noID, ""); got != `"code" ASC` {
+		t.Errorf("exportOrder() without id = %q, want \"code\" ASC", got)
+	}
+}
+
+func TestFilterValues(t *testing.T) {
+	textTests := []struct {
+		in   any
+		want string
+	}{
+		{nil, ""},
+		{"abc", "abc"},
+		{true, "true"},
+		{float64(12), "12"},
+		{1.5, "1.5"},
+	}
+	for _, tt := range textTests {
+		if got := filterText(tt.in); got != tt.want {
+			t.Errorf("filterText(%#v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	listTests := []struct {
+		in   any
+		want []string
+	}{
+		{[]any{float64(1), "b"}, []string{"1", "b"}},
+		{"(1, 2,3)", []string{"1", "2", "3"}},
+		{`("a b","c")`, []string{"a b", "c"}},
+		{"()", []string{}},
+	}
+	for _, tt := range listTests {
+		if got := filterList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterList(%#v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExportArgsUnique(t *testing.T) {
+	opts := ExportGenerateArgs{}.InsertOpts()
+	if !opts.UniqueOpts.ByArgs || !reflect.DeepEqual(opts.UniqueOpts.ByState, notifyJobUniqueStates) {
+		t.Errorf("UniqueOpts = %+v, want by args while queued or running", opts.UniqueOpts)
+	}
+	if !strings.HasPrefix(ExportGenerateArgs{}.Kind(), "export_") {
+		t.Errorf("Kind() = %q", ExportGenerateArgs{}.Kind())
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Export Writers
+//
+// An export is streamed row by row into one of three formats. Like the
+// receipt PDF, XLSX and PDF are written by hand instead of with a library:
+// an export is a single sheet or a plain table, which needs a few XML parts
+// or PDF objects, not a document model. Cells arrive as text (the export
+// query casts every column to text); a NULL cell is nil.
+// ============================================================================
+
+// exportWriter writes one export file
+type exportWriter interface {
+	// WriteRow writes one row of cells, in header order
+	WriteRow(cells []*string) error
+	// Close finishes the file; the underlying writer is not closed
+	Close() error
+}
+
+// exportFormat describes a file format
+type exportFormat struct {
+	Extension   string
+	ContentType string
+	New         func(w io.Writer, title string, columns []exportColumn) (exportWriter, error)
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":  {".csv", "text/csv; charset=utf-8", newCSVExportWriter},
+	"xlsx": {".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newXLSXExportWriter},
+	"pdf":  {".pdf", "application/pdf", newPDFExportWriter},
+}
+
+// ============================================================================
+// CSV
+// ============================================================================
+
+type csvExportWriter struct {
+	csv    *csv.Writer
+	record []string
+}
+
+func newCSVExportWriter(w io.Writer, _ string, columns []exportColumn) (exportWriter, error) {
+	// A byte order mark so Excel opens the file as UTF-8
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	c := &csvExportWriter{csv: csv.NewWriter(w), record: make([]string, len(columns))}
+	for i, col := range columns {
+		c.record[i] = col.Header
+	}
+	if err := c.csv.Write(c.record); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvExportWriter) WriteRow(cells []*string) error {
+	for i, cell := range cells {
+		c.record[i] = ""
+		if cell != nil {
+			c.record[i] = *cell
+		}
+	}
+	return c.csv.Write(c.record)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+// ============================================================================
+// XLSX
+// ============================================================================
+//
+// The smallest workbook Excel and LibreOffice accept: content types, package
+// and workbook relationships, a workbook with one sheet, a stylesheet with a
+// bold font for the header row, and the sheet itself, which is streamed.
+// Text uses inline strings so no shared string table has to be built in
+// memory; numeric columns are written as numbers.
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+</styleSheet>`
+
+type xlsxExportWriter struct {
+	zip     *zip.Writer
+	sheet   *bufio.Writer
+	numeric []bool
+}
+
+func newXLSXExportWriter(w io.Writer, title string, columns []exportColumn) (exportWriter, error) {
+	z := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(xlsxSheetName(title)))},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sheet is the last part, so it can stay open while rows arrive
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxExportWriter{zip: z, sheet: bufio.NewWriter(f), numeric: make([]bool, len(columns))}
+	x.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<sheetData><row>`)
+	for i, col := range columns {
+		x.numeric[i] = col.Numeric
+		x.sheet.WriteString(`<c t="inlineStr" s="1"><is><t>`)
+		x.sheet.WriteString(xmlEscape(col.Header))
+		x.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err = x.sheet.WriteString(`</row>`)
+	return x, err
+}
+
+func (x *xlsxExportWriter) WriteRow(cells []*string) error {
+	x.sheet.WriteString(`<row>`)
+	for i, cell := range cells {
+		switch {
+		case cell == nil:
+			x.sheet.WriteString(`<c/>`)
+		case x.numeric[i] && isXLSXNumber(*cell):
+			x.sheet.WriteString(`<c><v>`)
+			x.sheet.WriteString(xmlEscape(*cell))
+			x.sheet.WriteString(`</v></c>`)
+		default:
+			x.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			x.sheet.WriteString(xmlEscape(*cell))
+			x.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxExportWriter) Close() error {
+	x.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// isXLSXNumber reports whether a numeric column's text can be stored as a
+// number (NaN and Infinity can't)
+func isXLSXNumber(s string) bool {
+	f, err := strconv.ParseFloat(s, 64)
+	return err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// xmlEscape escapes text for an element or attribute; characters XML can't
+// carry (most control characters) become U+FFFD
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s)) //nolint:errcheck // strings.Builder doesn't fail
+	return b.String()
+}
+
+// xlsxSheetName makes a title a valid sheet name: at most 31 characters,
+// none of []:*?/\
+func xlsxSheetName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, title)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if strings.TrimSpace(name) == "" {
+		return "Export"
+	}
+	return name
+}
+
+// ============================================================================
+// PDF
+// ============================================================================
+//
+// A landscape table with the header repeated on every page. Columns share
+// the page width equally and cells are cut to fit, so PDF suits printing a
+// filtered list rather than archiving every column of a table. Pages are
+// kept in memory until Close, which is why PDF exports have a lower row cap.
+
+const (
+	exportPDFWidth      = 792.0 // US Letter landscape
+	exportPDFHeight     = 612.0
+	exportPDFMargin     = 36.0
+	exportPDFFontSize   = 7.0
+	exportPDFRowHeight  = 11.0
+	exportPDFCellMargin = 3.0
+)
+
+type pdfExportWriter struct {
+	w       io.Writer
+	title   string
+	headers []string
+	pages   []*pdfPage
+	page    *pdfPage
+	y       float64
+	rows    int
+}
+
+func newPDFExportWriter(w io.Writer, title string, columns []exportColumn) (exportWriter, error) {
+	p := &pdfExportWriter{w: w, title: title, headers: make([]string, len(columns))}
+	for i, col := range columns {
+		p.headers[i] = col.Header
+	}
+	p.newPage()
+	return p, nil
+}
+
+func (p *pdfExportWriter) columnWidth() float64 {
+	return (exportPDFWidth - 2*exportPDFMargin) / float64(max(len(p.headers), 1))
+}
+
+// newPage starts a page with the title, page number and column headers
+func (p *pdfExportWriter) newPage() {
+	p.page = &pdfPage{}
+	p.pages = append(p.pages, p.page)
+	left, right := exportPDFMargin, exportPDFWidth-exportPDFMargin
+	top := exportPDFHeight - exportPDFMargin
+
+	p.page.Text(left, top-10, pdfFontBold, 12, p.title)
+	p.page.TextRight(right, top-10, pdfFontRegular, 8, fmt.Sprintf("Page %d", len(p.pages)))
+
+	y := top - 30
+	p.page.FillRect(left, y-3, right-left, exportPDFRowHeight+1, 0.9)
+	p.writeCells(y, pdfFontBold, p.headers)
+	p.y = y - exportPDFRowHeight
+}
+
+func (p *pdfExportWriter) writeCells(y float64, font pdfFont, cells []string) {
+	width := p.columnWidth()
+	for i, cell := range cells {
+		x := exportPDFMargin + float64(i)*width + exportPDFCellMargin
+		p.page.Text(x, y, font, exportPDFFontSize, fitPDFText(cell, font, exportPDFFontSize, width-2*exportPDFCellMargin))
+	}
+}
+
+func (p *pdfExportWriter) WriteRow(cells []*string) error {
+	if p.y < exportPDFMargin {
+		p.newPage()
+	}
+	text := make([]string, len(cells))
+	for i, cell := range cells {
+		if cell != nil {
+			text[i] = *cell
+		}
+	}
+	if p.rows%2 == 1 {
+		p.page.FillRect(exportPDFMargin, p.y-3, exportPDFWidth-2*exportPDFMargin, exportPDFRowHeight, 0.97)
+	}
+	p.writeCells(p.y, pdfFontRegular, text)
+	p.y -= exportPDFRowHeight
+	p.rows++
+	return nil
+}
+
+func (p *pdfExportWriter) Close() error {
+	_, err := p.w.Write(pdfDocument(p.title, exportPDFWidth, exportPDFHeight, p.pages))
+	return err
+}
+
+// fitPDFText cuts s with an ellipsis so it is no wider than maxWidth
+func fitPDFText(s string, font pdfFont, size, maxWidth float64) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if pdfTextWidth(s, font, size) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for n := len(runes) - 1; n > 0; n-- {
+		if cut := string(runes[:n]) + "…"; pdfTextWidth(cut, font, size) <= maxWidth {
+			return cut
+		}
+	}
+	return ""
+}
+
+// exportFileName names the download, e.g. "Issues 2026-10-16.xlsx"
+func exportFileName(displayName, extension string, at time.Time) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '-'
+		}
+		return r
+	}, displayName)
+	return fmt.Sprintf("%s %s%s", strings.TrimSpace(name), at.Format("2006-01-02"), extension)
+}
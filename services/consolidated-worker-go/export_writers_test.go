@@ -0,0 +1,158 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportTestColumns() []exportColumn {
+	return []exportColumn{
+		{Name: "id", Header: "ID", Type: "bigint", Numeric: true},
+		{Name: "title", Header: "Title", Type: "text"},
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func writeExport(t *testing.T, format string, rows [][]*string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := exportFormats[format].New(&buf, "Issues", exportTestColumns())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVExportWriter(t *testing.T) {
+	out := writeExport(t, "csv", [][]*string{
+		{strPtr("1"), strPtr(`Pothole, "big"`)},
+		{strPtr("2"), nil},
+	})
+	if !bytes.HasPrefix(out, []byte("\ufeff")) {
+		t.Error("CSV should start with a byte order mark")
+	}
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(out, []byte("\ufeff")))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	want := [][]string{{"ID", "Title"}, {"1", `Pothole, "big"`}, {"2", ""}}
+	if len(records) != len(want) {
+		t.Fatalf("records = %q, want %q", records, want)
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("record %d = %q, want %q", i, records[i], want[i])
+		}
+	}
+}
+
+func TestXLSXExportWriter(t *testing.T) {
+	out := writeExport(t, "xlsx", [][]*string{
+		{strPtr("42"), strPtr("Fish & <Chips>")},
+		{strPtr("NaN"), nil},
+	})
+	z, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		parts[f.Name] = string(b)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c t="inlineStr" s="1"><is><t>ID</t></is></c>`,
+		`<c><v>42</v></c>`,
+		`Fish &amp; &lt;Chips&gt;`,
+		`<t xml:space="preserve">NaN</t>`, // not a number Excel can store
+		`<c/>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet missing %q", want)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `name="Issues"`) {
+		t.Error("workbook should name the sheet after the export")
+	}
+}
+
+func TestPDFExportWriterPages(t *testing.T) {
+	rows := make([][]*string, 120)
+	for i := range rows {
+		rows[i] = []*string{strPtr("1"), strPtr("Row")}
+	}
+	out := string(writeExport(t, "pdf", rows))
+
+	if !strings.HasPrefix(out, "%PDF-1.4") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Fatal("not a PDF document")
+	}
+	pages := strings.Count(out, "/Type /Page ")
+	if pages < 2 {
+		t.Errorf("pages = %d, want the rows split over several pages", pages)
+	}
+	if !strings.Contains(out, fmt.Sprintf("/Count %d", pages)) {
+		t.Errorf("page tree count doesn't match %d pages", pages)
+	}
+	if got := strings.Count(out, "(Title) Tj"); got != pages {
+		t.Errorf("header drawn %d times, want once per page (%d)", got, pages)
+	}
+}
+
+func TestXLSXSheetName(t *testing.T) {
+	tests := map[string]string{
+		"Issues":                "Issues",
+		"Q1/Q2 [draft]":         "Q1-Q2 -draft-",
+		"":                      "Export",
+		strings.Repeat("x", 40): strings.Repeat("x", 31),
+	}
+	for in, want := range tests {
+		if got := xlsxSheetName(in); got != want {
+			t.Errorf("xlsxSheetName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFitPDFText(t *testing.T) {
+	if got := fitPDFText("short", pdfFontRegular, 7, 100); got != "short" {
+		t.Errorf("fitPDFText(short) = %q", got)
+	}
+	long := strings.Repeat("word ", 40)
+	got := fitPDFText(long, pdfFontRegular, 7, 60)
+	if !strings.HasSuffix(got, "…") || pdfTextWidth(got, pdfFontRegular, 7) > 60 {
+		t.Errorf("fitPDFText(long) = %q, want cut with an ellipsis within 60pt", got)
+	}
+}
+
+func TestExportFileName(t *testing.T) {
+	at := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	if got := exportFileName("Permits: 2026/Q3", ".csv", at); got != "Permits- 2026-Q3 2026-10-16.csv" {
+		t.Errorf("exportFileName() = %q", got)
+	}
+}
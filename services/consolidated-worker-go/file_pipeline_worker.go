@@ -0,0 +1,497 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Job Definition: File Pipeline
+// ============================================================================
+//
+// Every new metadata.files row is announced on file_uploaded, and the
+// listener queues one file_pipeline job for it (migration
+// v0-125-0-file-pipeline). The job runs the file's steps in order, each
+// recorded on its own status column so a retry skips what is done:
+//
+//  1. upload_status: HeadObject on the original. An object not visible yet
+//     snoozes the job for a few minutes before the file counts as missing.
+//  2. scan_status: the original is streamed to the FileScanner (clamd), if
+//     one is configured. An infected original is moved to a private
+//     quarantine/ key and gets no thumbnails.
+//  3. metadata_status: in the same read, the SHA-256, the sniffed MIME type
+//     and the actual size.
+//  4. thumbnail_status: thumbnail_generate is queued in the transaction that
+//     records steps 1-3. Images and PDFs are read through the original store
+//     so the thumbnail job finds them in the local cache.
+
+const (
+	// filePipelineUploadWait is how long after the file row appears a missing
+	// object is waited for before the upload counts as missing
+	filePipelineUploadWait = 5 * time.Minute
+	filePipelineSnooze     = 20 * time.Second
+
+	// quarantinePrefix is where infected originals are moved, without the
+	// public-read ACL
+	quarantinePrefix = "quarantine/"
+)
+
+// FilePipelineArgs runs the upload pipeline for one metadata.files row
+type FilePipelineArgs struct {
+	FileID string `json:"file_id"`
+}
+
+func (FilePipelineArgs) Kind() string { return "file_pipeline" }
+
+func (FilePipelineArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "s3_signer",
+		MaxAttempts: 10,
+		Priority:    1,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:  true,
+			ByState: notifyJobUniqueStates,
+		},
+	}
+}
+
+// fileUploadedChannel queues the pipeline for files that insert_thumbnail_job()
+// announces on file_uploaded (payload: file ID). Resync covers files with a
+// pipeline step still pending; thumbnail_status is left out because the
+// pipeline queues thumbnail_generate in the transaction that finishes it.
+func fileUploadedChannel(dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx]) NotifyChannel {
+	scan := func(rows pgx.Rows) (river.JobArgs, error) {
+		var args FilePipelineArgs
+		err := rows.Scan(&args.FileID)
+		return args, err
+	}
+	return NotifyChannel{
+		Name: "file_uploaded",
+		Handle: func(ctx context.Context, payload string) error {
+			_, err := riverClient.Insert(ctx, FilePipelineArgs{FileID: payload}, nil)
+			return err
+		},
+		Resync: func(ctx context.Context) error {
+			return resyncJobs(ctx, "file_uploaded", dbPool, riverClient, scan, `
+				SELECT id::TEXT FROM metadata.files
+				WHERE upload_status = 'pending' OR scan_status = 'pending' OR metadata_status = 'pending'
+			`)
+		},
+	}
+}
+
+// ============================================================================
+// Worker Implementation
+// ============================================================================
+
+// filePipelineObjectAPI is the subset of *s3.Client the pipeline uses
+type filePipelineObjectAPI interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+}
+
+// FilePipelineWorker runs an uploaded file's steps in order
+type FilePipelineWorker struct {
+	river.WorkerDefaults[FilePipelineArgs]
+	dbPool    *pgxpool.Pool
+	s3Client  filePipelineObjectAPI
+	originals *OriginalStore // pre-warms the cache for thumbnails
+	scanner   FileScanner    // nil: scan_status 'skipped'
+	jobs      *JobEnqueuer   // queues thumbnail_generate
+
+	// tagOriginals tags verified originals for the STANDARD_IA lifecycle
+	// rule (see s3_lifecycle.go)
+	tagOriginals bool
+}
+
+// pipelineFile is the part of a metadata.files row the pipeline reads
+type pipelineFile struct {
+	ID              string
+	Bucket          string
+	Key             string
+	FileName        string
+	EntityType      string
+	EntityID        string
+	CreatedAt       time.Time
+	UploadStatus    string
+	ScanStatus      string
+	MetadataStatus  string
+	ThumbnailStatus string
+}
+
+// fileInspection is what steps 2 and 3 found in one read of the original
+type fileInspection struct {
+	ScanStatus    string
+	Signature     string
+	ScanError     string
+	SHA256        string
+	DetectedType  string
+	Size          int64
+	MetadataError string
+}
+
+func (w *FilePipelineWorker) Work(ctx context.Context, job *river.Job[FilePipelineArgs]) error {
+	f, err := w.loadFile(ctx, job.Args.FileID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("[Job %d] File %s no longer exists, skipping", job.ID, job.Args.FileID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("[Job %d] File pipeline for %s (upload %s, scan %s, metadata %s, thumbnails %s)",
+		job.ID, f.ID, f.UploadStatus, f.ScanStatus, f.MetadataStatus, f.ThumbnailStatus)
+
+	// 1. Upload
+	if f.UploadStatus == "pending" {
+		present, err := w.objectExists(ctx, f.Bucket, f.Key)
+		if err != nil {
+			return err
+		}
+		if !present {
+			if time.Since(f.CreatedAt) < filePipelineUploadWait {
+				log.Printf("[Job %d] Original %s not visible yet, waiting", job.ID, f.Key)
+				return river.JobSnooze(filePipelineSnooze)
+			}
+			log.Printf("[Job %d] Original %s is missing, stopping", job.ID, f.Key)
+			return w.markMissing(ctx, f)
+		}
+		if w.tagOriginals {
+			w.tagOriginal(ctx, f)
+		}
+		f.UploadStatus = "verified"
+	}
+	if f.UploadStatus != "verified" {
+		return nil
+	}
+
+	// 2-3. Scan and metadata, one read
+	var inspection *fileInspection
+	if f.ScanStatus == "pending" || f.MetadataStatus == "pending" {
+		inspection, err = w.inspect(ctx, f, job.Attempt >= job.MaxAttempts)
+		if err != nil {
+			return err
+		}
+		if inspection.ScanStatus == "infected" {
+			log.Printf("[Job %d] ⚠ File %s is infected (%s)", job.ID, f.ID, inspection.Signature)
+		}
+	}
+
+	// 4. Thumbnails, queued with the record of steps 1-3
+	queueThumbnails := f.ThumbnailStatus == "pending" && (inspection == nil || inspection.ScanStatus != "infected")
+	if err := w.record(ctx, f, inspection, queueThumbnails); err != nil {
+		return err
+	}
+	if inspection != nil && inspection.ScanStatus == "infected" || f.ScanStatus == "infected" {
+		if err := w.quarantine(ctx, f); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[Job %d] ✓ File pipeline for %s done (thumbnails queued: %v)", job.ID, f.ID, queueThumbnails)
+	return nil
+}
+
+func (w *FilePipelineWorker) loadFile(ctx context.Context, id string) (*pipelineFile, error) {
+	f := &pipelineFile{ID: id}
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT s3_bucket, s3_original_key, file_name, entity_type, entity_id, created_at,
+		       upload_status, scan_status, metadata_status, COALESCE(thumbnail_status, 'pending')
+		FROM metadata.files WHERE id = $1
+	`, id).Scan(&f.Bucket, &f.Key, &f.FileName, &f.EntityType, &f.EntityID, &f.CreatedAt,
+		&f.UploadStatus, &f.ScanStatus, &f.MetadataStatus, &f.ThumbnailStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to load file %s: %w", id, err)
+	}
+	return f, nil
+}
+
+// objectExists heads the original; only "not found" counts as missing
+func (w *FilePipelineWorker) objectExists(ctx context.Context, bucket, key string) (bool, error) {
+	_, err := w.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to head s3://%s/%s: %w", bucket, key, err)
+	}
+	return true, nil
+}
+
+// tagOriginal marks the original for the civic-os-originals-ia lifecycle
+// rule. An untagged original only stays in its storage class, so failures
+// are logged, not retried.
+func (w *FilePipelineWorker) tagOriginal(ctx context.Context, f *pipelineFile) {
+	_, err := w.s3Client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket: aws.String(f.Bucket),
+		Key:    aws.String(f.Key),
+		Tagging: &types.Tagging{TagSet: []types.Tag{{
+			Key:   aws.String(originalObjectTagKey),
+			Value: aws.String(originalObjectTagValue),
+		}}},
+	})
+	if err != nil {
+		log.Printf("[FilePipeline] Failed to tag original %s: %v", f.Key, err)
+	}
+}
+
+// markMissing stops the pipeline for a file whose object never arrived
+func (w *FilePipelineWorker) markMissing(ctx context.Context, f *pipelineFile) error {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.files
+		SET upload_status = 'missing',
+		    scan_status = CASE WHEN scan_status = 'pending' THEN 'skipped' ELSE scan_status END,
+		    metadata_status = CASE WHEN metadata_status = 'pending' THEN 'skipped' ELSE metadata_status END,
+		    thumbnail_status = CASE WHEN thumbnail_status = 'pending' THEN 'failed' ELSE thumbnail_status END,
+		    thumbnail_error = CASE WHEN thumbnail_status = 'pending' THEN 'original file missing' ELSE thumbnail_error END,
+		    pipeline_error = 'no object at ' || s3_original_key,
+		    updated_at = NOW()
+		WHERE id = $1
+	`, f.ID)
+	if err != nil {
+		return fmt.Errorf("failed to mark file %s missing: %w", f.ID, err)
+	}
+	return nil
+}
+
+// inspect reads the original once, scanning it and collecting its metadata.
+// Scanner errors are retried; on the last attempt the scan is recorded as
+// failed and the pipeline goes on.
+func (w *FilePipelineWorker) inspect(ctx context.Context, f *pipelineFile, lastAttempt bool) (*fileInspection, error) {
+	body, err := w.openOriginal(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	inspector := newFileInspector()
+	tee := io.TeeReader(body, inspector)
+	result := &fileInspection{ScanStatus: "skipped"}
+
+	if f.ScanStatus == "pending" && w.scanner != nil {
+		signature, scanErr := w.scanner.Scan(ctx, tee)
+		switch {
+		case scanErr == nil && signature != "":
+			result.ScanStatus, result.Signature = "infected", signature
+		case scanErr == nil:
+			result.ScanStatus = "clean"
+		case errors.Is(scanErr, errScanTooLarge):
+			result.ScanError = scanErr.Error()
+		case !lastAttempt:
+			return nil, fmt.Errorf("failed to scan %s: %w", f.ID, scanErr)
+		default:
+			result.ScanStatus, result.ScanError = "failed", scanErr.Error()
+		}
+	}
+
+	// The scanner may stop early (size limit); the metadata needs all of it
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, fmt.Errorf("failed to read original of %s: %w", f.ID, err)
+	}
+	result.SHA256, result.DetectedType, result.Size = inspector.Result()
+	return result, nil
+}
+
+// openOriginal returns the original's content. Files waiting for thumbnails
+// go through the original store so the thumbnail job hits the cache; others
+// are streamed.
+func (w *FilePipelineWorker) openOriginal(ctx context.Context, f *pipelineFile) (io.ReadCloser, error) {
+	if f.ThumbnailStatus == "pending" && w.originals != nil {
+		data, _, err := w.originals.Fetch(ctx, f.Bucket, f.Key)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	out, err := w.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(f.Bucket),
+		Key:    aws.String(f.Key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object from S3: %w", err)
+	}
+	return out.Body, nil
+}
+
+// record writes the steps' outcome and queues thumbnails in one transaction
+func (w *FilePipelineWorker) record(ctx context.Context, f *pipelineFile, inspection *fileInspection, queueThumbnails bool) error {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE metadata.files SET upload_status = 'verified', updated_at = NOW()
+		WHERE id = $1 AND upload_status = 'pending'
+	`, f.ID); err != nil {
+		return fmt.Errorf("failed to record upload: %w", err)
+	}
+
+	if inspection != nil {
+		_, err := tx.Exec(ctx, `
+			UPDATE metadata.files
+			SET scan_status = CASE WHEN scan_status = 'pending' THEN $2 ELSE scan_status END,
+			    scan_signature = CASE WHEN scan_status = 'pending' THEN NULLIF($3, '') ELSE scan_signature END,
+			    metadata_status = 'completed',
+			    content_sha256 = $4,
+			    detected_type = $5,
+			    file_size = $6,
+			    thumbnail_status = CASE WHEN $2 = 'infected' AND thumbnail_status = 'pending'
+			                            THEN 'not_applicable' ELSE thumbnail_status END,
+			    pipeline_error = NULLIF($7, ''),
+			    updated_at = NOW()
+			WHERE id = $1
+		`, f.ID, inspection.ScanStatus, inspection.Signature, inspection.SHA256,
+			inspection.DetectedType, inspection.Size, inspection.ScanError)
+		if err != nil {
+			return fmt.Errorf("failed to record scan and metadata: %w", err)
+		}
+	}
+
+	if queueThumbnails {
+		if _, err := w.jobs.InsertTx(ctx, tx, ThumbnailArgs{FileID: f.ID}, nil); err != nil {
+			return fmt.Errorf("failed to queue thumbnails: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// quarantine moves an infected original to a private key under
+// quarantinePrefix and points the file row at it. Each step is safe to
+// repeat: a retry finds the row already moved, or the copy already made.
+func (w *FilePipelineWorker) quarantine(ctx context.Context, f *pipelineFile) error {
+	if strings.HasPrefix(f.Key, quarantinePrefix) {
+		return nil
+	}
+	target := quarantineKey(f.Key)
+
+	// No ACL on the copy: it is private, unlike the public-read upload
+	_, err := w.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(f.Bucket),
+		Key:        aws.String(target),
+		CopySource: aws.String(copySource(f.Bucket, f.Key)),
+	})
+	var noSuchKey *types.NoSuchKey
+	if err != nil && !errors.As(err, &noSuchKey) {
+		return fmt.Errorf("failed to copy %s to quarantine: %w", f.Key, err)
+	}
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // rollback is a no-op after commit
+
+	var signature *string
+	if err := tx.QueryRow(ctx, `
+		UPDATE metadata.files SET s3_original_key = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING scan_signature
+	`, f.ID, target).Scan(&signature); err != nil {
+		return fmt.Errorf("failed to point file %s at quarantine: %w", f.ID, err)
+	}
+	auditData, err := json.Marshal(map[string]any{
+		"file_id":     f.ID,
+		"file_name":   f.FileName,
+		"entity_type": f.EntityType,
+		"entity_id":   f.EntityID,
+		"signature":   signature,
+		"moved_to":    target,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode audit data: %w", err)
+	}
+	// Attributed to the uploader; files without one go unaudited
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+		SELECT f.created_by, p.email::TEXT, 'file_quarantined', $2::JSONB
+		FROM metadata.files f
+		LEFT JOIN metadata.civic_os_users_private p ON p.id = f.created_by
+		WHERE f.id = $1 AND f.created_by IS NOT NULL
+	`, f.ID, auditData); err != nil {
+		return fmt.Errorf("failed to audit quarantine: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+
+	if _, err := w.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(f.Bucket),
+		Key:    aws.String(f.Key),
+	}); err != nil {
+		// The row already points at the quarantined copy; retry the delete
+		return fmt.Errorf("failed to delete infected original %s: %w", f.Key, err)
+	}
+	f.Key = target
+	log.Printf("[FilePipeline] Moved infected file %s to s3://%s/%s", f.ID, f.Bucket, target)
+	return nil
+}
+
+// quarantineKey is where an infected original is kept
+func quarantineKey(key string) string {
+	return quarantinePrefix + key
+}
+
+// ============================================================================
+// File Inspector
+// ============================================================================
+
+// fileInspector hashes, counts and sniffs content written to it
+type fileInspector struct {
+	hash  hash.Hash
+	size  int64
+	sniff []byte // first 512 bytes, as http.DetectContentType reads
+}
+
+func newFileInspector() *fileInspector {
+	return &fileInspector{hash: sha256.New(), sniff: make([]byte, 0, 512)}
+}
+
+func (i *fileInspector) Write(p []byte) (int, error) {
+	if room := cap(i.sniff) - len(i.sniff); room > 0 {
+		i.sniff = append(i.sniff, p[:min(room, len(p))]...)
+	}
+	i.size += int64(len(p))
+	return i.hash.Write(p)
+}
+
+// Result returns the hex SHA-256, the sniffed MIME type (without
+// parameters) and the size
+func (i *fileInspector) Result() (string, string, int64) {
+	detected, _, _ := strings.Cut(http.DetectContentType(i.sniff), ";")
+	return hex.EncodeToString(i.hash.Sum(nil)), detected, i.size
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestFileInspector(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 4096)...)
+	inspector := newFileInspector()
+	// Small reads, as a TeeReader feeding the scanner would make
+	if _, err := io.CopyBuffer(inspector, bytes.NewReader(png), make([]byte, 100)); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+
+	sum := sha256.Sum256(png)
+	digest, detected, size := inspector.Result()
+	if digest != hex.EncodeToString(sum[:]) {
+		t.Errorf("sha256 = %s, want %x", digest, sum)
+	}
+	if detected != "image/png" {
+		t.Errorf("detected type = %q, want image/png", detected)
+	}
+	if size != int64(len(png)) {
+		t.Errorf("size = %d, want %d", size, len(png))
+	}
+	if len(inspector.sniff) != 512 {
+		t.Errorf("sniffed %d bytes, want 512", len(inspector.sniff))
+	}
+
+	if _, detected, _ := newFileInspector().Result(); detected != "text/plain" {
+		t.Errorf("empty file detected as %q", detected)
+	}
+}
+
+func TestQuarantineKey(t *testing.T) {
+	got := quarantineKey("files/abc/original.pdf")
+	if got != "quarantine/files/abc/original.pdf" {
+		t.Errorf("quarantineKey() = %q", got)
+	}
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
@@ -11,93 +12,40 @@ import (
 )
 
 // ============================================================================
-// Gallery Cleanup Cron Job
+// Gallery Cleanup Maintenance Task
 //
-// Runs daily at ~3:00 AM to clean up orphaned draft photo galleries.
-// Draft galleries with no associated entity that haven't been updated in
-// 12 hours are assumed abandoned and deleted by the metadata.cleanup_draft_galleries()
-// PostgreSQL function (in metadata schema, hidden from PostgREST).
+// Runs daily to clean up orphaned draft photo galleries. Draft galleries with
+// no associated entity that haven't been updated in 12 hours are assumed
+// abandoned and deleted by the metadata.cleanup_draft_galleries() PostgreSQL
+// function (in metadata schema, hidden from PostgREST).
 //
-// ARCHITECTURE: Uses a Go ticker (like ScheduledJobScheduler) rather than
-// River periodic jobs. This ensures only consolidated-worker runs the cleanup,
-// avoiding leader election issues with payment-worker.
+// Scheduled by MaintenanceScheduler (task "gallery_cleanup").
 // ============================================================================
 
-// GalleryCleanupCron runs cleanup_draft_galleries() once daily at approximately 3:00 AM.
-type GalleryCleanupCron struct {
+// GalleryCleanupTask runs cleanup_draft_galleries().
+type GalleryCleanupTask struct {
 	dbPool *pgxpool.Pool
-	done   chan bool
 }
 
-// Start launches the gallery cleanup goroutine. It calculates the duration
-// until the next 3:00 AM, sleeps until then, runs cleanup, and repeats every
-// 24 hours thereafter.
-func (g *GalleryCleanupCron) Start(ctx context.Context) {
-	g.done = make(chan bool)
-
-	go func() {
-		// Calculate time until next 3:00 AM
-		now := time.Now()
-		next3AM := time.Date(now.Year(), now.Month(), now.Day(), 3, 0, 0, 0, now.Location())
-		if !next3AM.After(now) {
-			// Already past 3 AM today, schedule for tomorrow
-			next3AM = next3AM.Add(24 * time.Hour)
-		}
-		initialDelay := time.Until(next3AM)
-
-		log.Printf("[GalleryCleanup] Next run scheduled at %s (in %s)",
-			next3AM.Format("2006-01-02 15:04:05"), initialDelay.Round(time.Minute))
-
-		// Wait for initial delay or shutdown
-		timer := time.NewTimer(initialDelay)
-		defer timer.Stop()
-
-		select {
-		case <-timer.C:
-			// Initial delay elapsed, run cleanup
-			g.runCleanup(ctx)
-		case <-g.done:
-			return
-		case <-ctx.Done():
-			return
-		}
-
-		// After first run, tick every 24 hours
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				g.runCleanup(ctx)
-			case <-g.done:
-				return
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
-	log.Println("[GalleryCleanup] Started - runs daily at ~3:00 AM")
-}
-
-// Stop gracefully shuts down the gallery cleanup goroutine.
-func (g *GalleryCleanupCron) Stop() {
-	if g.done != nil {
-		close(g.done)
+// MaintenanceTask declares the task with its default schedule
+func (g *GalleryCleanupTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "gallery_cleanup",
+		Description: "Delete draft photo galleries never attached to a record (idle for 12+ hours)",
+		Interval:    24 * time.Hour,
+		Jitter:      time.Hour,
+		Run:         g.runCleanup,
 	}
-	log.Println("[GalleryCleanup] Stopped")
 }
 
 // runCleanup calls metadata.cleanup_draft_galleries() and logs the result.
-func (g *GalleryCleanupCron) runCleanup(ctx context.Context) {
+func (g *GalleryCleanupTask) runCleanup(ctx context.Context) (string, error) {
 	log.Println("[GalleryCleanup] Running draft gallery cleanup...")
 
 	var deletedCount int
 	err := g.dbPool.QueryRow(ctx, "SELECT metadata.cleanup_draft_galleries()").Scan(&deletedCount)
 	if err != nil {
-		log.Printf("[GalleryCleanup] Error executing cleanup_draft_galleries(): %v", err)
-		return
+		return "", fmt.Errorf("cleanup_draft_galleries(): %w", err)
 	}
 
 	if deletedCount > 0 {
@@ -105,4 +53,5 @@ func (g *GalleryCleanupCron) runCleanup(ctx context.Context) {
 	} else {
 		log.Println("[GalleryCleanup] No orphaned draft galleries found")
 	}
+	return fmt.Sprintf("Deleted %d draft galleries", deletedCount), nil
 }
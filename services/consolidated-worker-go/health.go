@@ -0,0 +1,203 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout bounds all checks of one /readyz request
+const readinessTimeout = 5 * time.Second
+
+// remoteCheckTTL is how long an S3 or Keycloak check is reused. Probes run
+// every few seconds; the remote services don't need to be hit that often.
+const remoteCheckTTL = 30 * time.Second
+
+// errRiverNotRunning is the River check's error before Start and after shutdown begins
+var errRiverNotRunning = errors.New("river client not running")
+
+// HealthCheck is the result of checking one dependency
+type HealthCheck struct {
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ReadinessReport is the /readyz response body
+type ReadinessReport struct {
+	Ready  bool                   `json:"ready"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// readinessCheck is one dependency checked by /readyz
+type readinessCheck struct {
+	name  string
+	ttl   time.Duration // Reuse a result this long; 0 = check on every probe
+	check func(context.Context) error
+}
+
+// HealthServer serves the Kubernetes probes: /healthz (process alive),
+// /readyz (dependencies reachable) and /version. Unlike /metrics it has no
+// token, so it only reports up/down and error messages.
+type HealthServer struct {
+	checks      []readinessCheck
+	riverActive atomic.Bool
+	startedAt   time.Time
+	server      *http.Server
+
+	mu        sync.Mutex
+	cached    map[string]HealthCheck
+	checkedAt map[string]time.Time
+}
+
+// NewHealthServer creates a health server listening on port. River starts
+// out not running; add the other dependencies with AddCheck before Start.
+func NewHealthServer(port string) *HealthServer {
+	s := &HealthServer{
+		startedAt: time.Now(),
+		cached:    make(map[string]HealthCheck),
+		checkedAt: make(map[string]time.Time),
+	}
+	s.AddCheck("river", 0, func(context.Context) error {
+		if !s.riverActive.Load() {
+			return errRiverNotRunning
+		}
+		return nil
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/version", s.handleVersion)
+	s.server = &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// AddCheck adds a dependency to /readyz. Not safe once the server is started.
+func (s *HealthServer) AddCheck(name string, ttl time.Duration, check func(context.Context) error) {
+	s.checks = append(s.checks, readinessCheck{name: name, ttl: ttl, check: check})
+}
+
+// SetRiverRunning marks the River client started, or stopping. Clearing it
+// at the start of shutdown takes the pod out of rotation while jobs drain.
+func (s *HealthServer) SetRiverRunning(running bool) {
+	s.riverActive.Store(running)
+}
+
+// Start listens in a goroutine. A listen failure is logged, not fatal: jobs
+// keep running, and the orchestrator's probes fail and restart the container.
+func (s *HealthServer) Start() {
+	go func() {
+		log.Printf("[Health] Serving /healthz, /readyz and /version on %s", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[Health] Server stopped: %v", err)
+		}
+	}()
+}
+
+// Stop shuts the server down, waiting for in-flight probes
+func (s *HealthServer) Stop(ctx context.Context) {
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("[Health] Shutdown error: %v", err)
+	}
+}
+
+// Check runs all readiness checks concurrently
+func (s *HealthServer) Check(ctx context.Context) ReadinessReport {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	results := make([]HealthCheck, len(s.checks))
+	var wg sync.WaitGroup
+	for i, c := range s.checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+			results[i] = s.runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := ReadinessReport{Ready: true, Checks: make(map[string]HealthCheck, len(s.checks))}
+	for i, c := range s.checks {
+		report.Checks[c.name] = results[i]
+		if !results[i].OK {
+			report.Ready = false
+		}
+	}
+	return report
+}
+
+// runCheck runs one check, reusing a result younger than its TTL
+func (s *HealthServer) runCheck(ctx context.Context, c readinessCheck) HealthCheck {
+	if c.ttl > 0 {
+		s.mu.Lock()
+		check, cached := s.cached[c.name]
+		fresh := cached && time.Since(s.checkedAt[c.name]) < c.ttl
+		s.mu.Unlock()
+		if fresh {
+			return check
+		}
+	}
+
+	started := time.Now()
+	check := newHealthCheck(started, c.check(ctx))
+
+	if c.ttl > 0 {
+		s.mu.Lock()
+		s.cached[c.name] = check
+		s.checkedAt[c.name] = time.Now()
+		s.mu.Unlock()
+	}
+	return check
+}
+
+// handleHealthz answers as long as the process can serve HTTP. It checks
+// nothing else: a restart doesn't fix an unreachable database.
+func (s *HealthServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *HealthServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := s.Check(r.Context())
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+func (s *HealthServer) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"version":    version,
+		"go_version": runtime.Version(),
+		"started_at": s.startedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func newHealthCheck(started time.Time, err error) HealthCheck {
+	check := HealthCheck{OK: err == nil, LatencyMS: time.Since(started).Milliseconds()}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serveHealth(t *testing.T, s *HealthServer, path string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: invalid JSON %q: %v", path, rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestHealthServer_Healthz(t *testing.T) {
+	s := NewHealthServer("0")
+	s.AddCheck("database", 0, func(context.Context) error { return errors.New("connection refused") })
+
+	// Liveness ignores dependencies
+	if code, _ := serveHealth(t, s, "/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz status = %d, want 200", code)
+	}
+}
+
+func TestHealthServer_Readyz(t *testing.T) {
+	var dbErr error
+	s := NewHealthServer("0")
+	s.AddCheck("database", 0, func(context.Context) error { return dbErr })
+
+	code, body := serveHealth(t, s, "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("before River starts: status = %d, want 503", code)
+	}
+	river := body["checks"].(map[string]any)["river"].(map[string]any)
+	if river["ok"] != false || river["error"] != errRiverNotRunning.Error() {
+		t.Errorf("river check = %v, want not running", river)
+	}
+
+	s.SetRiverRunning(true)
+	if code, _ := serveHealth(t, s, "/readyz"); code != http.StatusOK {
+		t.Errorf("all checks pass: status = %d, want 200", code)
+	}
+
+	dbErr = errors.New("connection refused")
+	code, body = serveHealth(t, s, "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("database down: status = %d, want 503", code)
+	}
+	if body["ready"] != false {
+		t.Errorf("ready = %v, want false", body["ready"])
+	}
+
+	dbErr = nil
+	s.SetRiverRunning(false)
+	if code, _ := serveHealth(t, s, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("shutting down: status = %d, want 503", code)
+	}
+}
+
+func TestHealthServer_CheckTTL(t *testing.T) {
+	calls := 0
+	s := NewHealthServer("0")
+	s.SetRiverRunning(true)
+	s.AddCheck("s3", time.Minute, func(context.Context) error {
+		calls++
+		return errors.New("403 Forbidden")
+	})
+
+	for i := 0; i < 3; i++ {
+		report := s.Check(context.Background())
+		if report.Ready || report.Checks["s3"].Error != "403 Forbidden" {
+			t.Fatalf("report = %+v, want cached s3 failure", report)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("s3 checked %d times, want 1 within TTL", calls)
+	}
+}
+
+func TestHealthServer_Version(t *testing.T) {
+	code, body := serveHealth(t, NewHealthServer("0"), "/version")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if body["version"] != version || body["go_version"] == "" || body["started_at"] == "" {
+		t.Errorf("body = %v", body)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Holiday Calendars (v0.133.0)
+// ============================================================================
+//
+// metadata.holiday_calendar_dates holds plain dates. A series group or
+// scheduled job that picks a calendar compares them with the local date of
+// each occurrence or run, in its own timezone.
+
+// Holiday policies of a series group (time_slot_series_groups.holiday_policy)
+const (
+	holidayPolicySkip         = "skip"
+	holidayPolicyShiftForward = "shift_forward"
+	holidayPolicyShiftBack    = "shift_back"
+)
+
+// maxHolidayShiftDays is how far an occurrence moves looking for a day that
+// isn't a holiday before it is skipped instead
+const maxHolidayShiftDays = 14
+
+// holidayDateFormat keys holidays by local date
+const holidayDateFormat = "2006-01-02"
+
+// fetchHolidays returns the calendar's holidays from from to to (local dates,
+// inclusive), keyed by date, with their names
+func fetchHolidays(ctx context.Context, dbPool *pgxpool.Pool, calendarID int, from, to time.Time) (map[string]string, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT holiday_date::text, name
+		FROM metadata.holiday_calendar_dates
+		WHERE calendar_id = $1
+		  AND holiday_date BETWEEN $2::date AND $3::date
+	`, calendarID, from.Format(holidayDateFormat), to.Format(holidayDateFormat))
+	if err != nil {
+		return nil, fmt.Errorf("query holidays: %w", err)
+	}
+	defer rows.Close()
+
+	holidays := make(map[string]string)
+	for rows.Next() {
+		var date, name string
+		if err := rows.Scan(&date, &name); err != nil {
+			return nil, fmt.Errorf("scan holiday: %w", err)
+		}
+		holidays[date] = name
+	}
+	return holidays, rows.Err()
+}
+
+// holidayOn returns the name of the calendar's holiday on t's date in loc, or
+// "" if that day isn't a holiday
+func holidayOn(ctx context.Context, dbPool *pgxpool.Pool, calendarID int, t time.Time, loc *time.Location) (string, error) {
+	day := t.In(loc)
+	holidays, err := fetchHolidays(ctx, dbPool, calendarID, day, day)
+	if err != nil {
+		return "", err
+	}
+	return holidays[day.Format(holidayDateFormat)], nil
+}
+
+// avoidHoliday applies a series' holiday policy to an occurrence. It returns
+// the occurrence's start (moved for the shift policies), the name of the
+// holiday it landed on ("" if none), and whether to skip it. Shifts keep the
+// local wall-clock time and give up after maxHolidayShiftDays.
+func avoidHoliday(occ time.Time, loc *time.Location, holidays map[string]string, policy string) (time.Time, string, bool) {
+	local := occ.In(loc)
+	name, ok := holidays[local.Format(holidayDateFormat)]
+	if !ok {
+		return occ, "", false
+	}
+
+	step := 0
+	switch policy {
+	case holidayPolicyShiftForward:
+		step = 1
+	case holidayPolicyShiftBack:
+		step = -1
+	default:
+		return occ, name, true
+	}
+
+	for i := 1; i <= maxHolidayShiftDays; i++ {
+		candidate := time.Date(local.Year(), local.Month(), local.Day()+step*i,
+			local.Hour(), local.Minute(), local.Second(), 0, loc)
+		if _, holiday := holidays[candidate.Format(holidayDateFormat)]; !holiday {
+			return candidate.UTC(), name, false
+		}
+	}
+	return occ, name, true
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAvoidHoliday_NotAHoliday(t *testing.T) {
+	occ := time.Date(2026, 11, 24, 19, 0, 0, 0, time.UTC)
+	holidays := map[string]string{"2026-11-26": "Thanksgiving"}
+
+	got, name, skip := avoidHoliday(occ, time.UTC, holidays, holidayPolicySkip)
+	if !got.Equal(occ) || name != "" || skip {
+		t.Errorf("avoidHoliday() = %v, %q, %v; want unchanged", got, name, skip)
+	}
+}
+
+func TestAvoidHoliday_Skip(t *testing.T) {
+	occ := time.Date(2026, 11, 26, 15, 0, 0, 0, time.UTC)
+	holidays := map[string]string{"2026-11-26": "Thanksgiving"}
+
+	_, name, skip := avoidHoliday(occ, time.UTC, holidays, holidayPolicySkip)
+	if !skip || name != "Thanksgiving" {
+		t.Errorf("avoidHoliday() = %q, %v; want Thanksgiving, skip", name, skip)
+	}
+}
+
+func TestAvoidHoliday_UsesLocalDate(t *testing.T) {
+	loc, err := time.LoadLocation("America/Detroit")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+	// 8 PM Wednesday in Detroit is already Thursday in UTC
+	occ := time.Date(2026, 11, 25, 20, 0, 0, 0, loc).UTC()
+	holidays := map[string]string{"2026-11-26": "Thanksgiving"}
+
+	_, name, skip := avoidHoliday(occ, loc, holidays, holidayPolicySkip)
+	if skip || name != "" {
+		t.Errorf("avoidHoliday() = %q, %v; want the Wednesday occurrence kept", name, skip)
+	}
+}
+
+func TestAvoidHoliday_ShiftForwardPastConsecutiveHolidays(t *testing.T) {
+	occ := time.Date(2026, 12, 24, 10, 0, 0, 0, time.UTC)
+	holidays := map[string]string{
+		"2026-12-24": "Christmas Eve",
+		"2026-12-25": "Christmas Day",
+	}
+
+	got, name, skip := avoidHoliday(occ, time.UTC, holidays, holidayPolicyShiftForward)
+	want := time.Date(2026, 12, 26, 10, 0, 0, 0, time.UTC)
+	if skip || name != "Christmas Eve" || !got.Equal(want) {
+		t.Errorf("avoidHoliday() = %v, %q, %v; want %v, Christmas Eve, no skip", got, name, skip, want)
+	}
+}
+
+func TestAvoidHoliday_ShiftBack(t *testing.T) {
+	occ := time.Date(2026, 7, 3, 9, 30, 0, 0, time.UTC)
+	holidays := map[string]string{"2026-07-03": "Independence Day (observed)"}
+
+	got, _, skip := avoidHoliday(occ, time.UTC, holidays, holidayPolicyShiftBack)
+	want := time.Date(2026, 7, 2, 9, 30, 0, 0, time.UTC)
+	if skip || !got.Equal(want) {
+		t.Errorf("avoidHoliday() = %v, %v; want %v", got, skip, want)
+	}
+}
+
+func TestAvoidHoliday_ShiftKeepsWallClockAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/Detroit")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+	// Saturday before DST ends; shifting forward lands on Sunday after
+	occ := time.Date(2026, 10, 31, 14, 0, 0, 0, loc).UTC()
+	holidays := map[string]string{"2026-10-31": "Closed"}
+
+	got, _, skip := avoidHoliday(occ, loc, holidays, holidayPolicyShiftForward)
+	want := time.Date(2026, 11, 1, 14, 0, 0, 0, loc)
+	if skip || !got.Equal(want) {
+		t.Errorf("avoidHoliday() = %v, %v; want %v (2 PM local)", got, skip, want)
+	}
+}
+
+func TestAvoidHoliday_ShiftGivesUp(t *testing.T) {
+	occ := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	holidays := make(map[string]string)
+	for i := 0; i <= maxHolidayShiftDays; i++ {
+		holidays[occ.AddDate(0, 0, i).Format(holidayDateFormat)] = "Closure"
+	}
+
+	_, name, skip := avoidHoliday(occ, time.UTC, holidays, holidayPolicyShiftForward)
+	if !skip || name != "Closure" {
+		t.Errorf("avoidHoliday() = %q, %v; want skip after %d days", name, skip, maxHolidayShiftDays)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Identity Audit Log
+//
+// Every worker that changes the identity provider writes one
+// metadata.identity_audit_log row per change (see migration
+// v0-97-0-identity-audit-log): what changed, its state before and after, the
+// job that changed it, and who caused the job. Unlike admin_audit_log, rows
+// are written for system-triggered jobs too; the database user that enqueued
+// the job (args.audit.db_user) is recorded when there is no JWT actor.
+// ============================================================================
+
+// identityAuditEntry describes one change at the identity provider
+type identityAuditEntry struct {
+	Operation  string // e.g. "user.create", "role.assign", "group.delete"
+	TargetType string // "user", "role" or "group"
+	TargetID   string // user ID, or role/group name
+	// State snapshots; nil when the target didn't exist before or doesn't
+	// after, or when the state couldn't be read
+	Before interface{}
+	After  interface{}
+}
+
+// recordIdentityAudit writes an identity_audit_log row for a change the job
+// made. Non-blocking like recordJobAuditEvent: the change has already been
+// made at the provider, so a failed write is logged only.
+func recordIdentityAudit(ctx context.Context, dbPool *pgxpool.Pool, provider IdentityProvider, job *rivertype.JobRow, audit *JobAuditContext, entry identityAuditEntry) {
+	before, err := marshalAuditState(entry.Before)
+	if err != nil {
+		log.Printf("[Job %d] Identity audit '%s' skipped: failed to marshal before state: %v", job.ID, entry.Operation, err)
+		return
+	}
+	after, err := marshalAuditState(entry.After)
+	if err != nil {
+		log.Printf("[Job %d] Identity audit '%s' skipped: failed to marshal after state: %v", job.ID, entry.Operation, err)
+		return
+	}
+
+	var actorID, onBehalfOf, requestID, dbUser *string
+	var impersonatedRoles []string
+	if audit != nil {
+		actorID = nonEmpty(audit.ActorID)
+		onBehalfOf = nonEmpty(audit.OnBehalfOf)
+		requestID = nonEmpty(audit.RequestID)
+		dbUser = nonEmpty(audit.DBUser)
+		impersonatedRoles = audit.ImpersonatedRoles
+	}
+
+	_, err = dbPool.Exec(ctx, `
+		INSERT INTO metadata.identity_audit_log (
+			provider, operation, target_type, target_id, before_state, after_state,
+			job_id, job_kind, job_attempt,
+			actor_id, on_behalf_of, impersonated_roles, request_id, db_user
+		) VALUES (
+			$1, $2, $3, $4, $5::JSONB, $6::JSONB,
+			$7, $8, $9,
+			$10::UUID, $11::UUID, $12, $13, $14
+		)
+	`, provider.Name(), entry.Operation, entry.TargetType, entry.TargetID, before, after,
+		job.ID, job.Kind, job.Attempt,
+		actorID, onBehalfOf, impersonatedRoles, requestID, dbUser)
+	if err != nil {
+		log.Printf("[Job %d] Identity audit '%s' for %s %s skipped: %v", job.ID, entry.Operation, entry.TargetType, entry.TargetID, err)
+	}
+}
+
+// marshalAuditState returns the JSON for a state snapshot, or nil for SQL NULL
+func marshalAuditState(state interface{}) (*string, error) {
+	if state == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	s := string(b)
+	return &s, nil
+}
+
+// nonEmpty returns nil for "" so optional columns are stored as NULL
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// identityUserState is the audited snapshot of a user's profile
+func identityUserState(u *IdentityUser) map[string]interface{} {
+	state := map[string]interface{}{
+		"email":      u.Email,
+		"first_name": u.FirstName,
+		"last_name":  u.LastName,
+		"enabled":    u.Enabled,
+	}
+	if phone := u.Attributes["phoneNumber"]; len(phone) > 0 {
+		state["phone"] = phone[0]
+	}
+	return state
+}
+
+// userRolesState snapshots the user's direct roles for a before/after entry.
+// Returns nil (an unknown state) rather than failing the job when the
+// provider can't be read.
+func userRolesState(ctx context.Context, provider IdentityProvider, userID string) interface{} {
+	roles, err := provider.GetUserDirectRoles(ctx, userID)
+	if err != nil {
+		log.Printf("[IdentityAudit] Could not read roles of user %s: %v", userID, err)
+		return nil
+	}
+	return map[string]interface{}{"roles": roles}
+}
+
+// userProfileState snapshots the user's profile, or nil when it can't be read
+func userProfileState(ctx context.Context, provider IdentityProvider, userID string) interface{} {
+	user, err := provider.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("[IdentityAudit] Could not read user %s: %v", userID, err)
+		return nil
+	}
+	return identityUserState(user)
+}
+
+// crudAuditEntry describes a role or group create/delete. The providers treat
+// both as idempotent, so the entry records what was asked for, not whether
+// it already existed.
+func crudAuditEntry(targetType, action, name, description string) identityAuditEntry {
+	state := map[string]interface{}{"name": name, "description": description}
+	entry := identityAuditEntry{Operation: targetType + "." + action, TargetType: targetType, TargetID: name}
+	if action == "delete" {
+		entry.Before = map[string]interface{}{"name": name}
+	} else {
+		entry.After = state
+	}
+	return entry
+}
+
+// membershipAuditEntry describes a group membership change. Providers don't
+// list a user's groups through IdentityProvider, so only the resulting
+// membership is recorded.
+func membershipAuditEntry(operation, userID, groupName string, member bool) identityAuditEntry {
+	return identityAuditEntry{
+		Operation:  operation,
+		TargetType: "user",
+		TargetID:   userID,
+		After:      map[string]interface{}{"group": groupName, "member": member},
+	}
+}
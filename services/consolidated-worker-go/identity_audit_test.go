@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCrudAuditEntry(t *testing.T) {
+	create := crudAuditEntry("role", "create", "editor", "Can edit")
+	if create.Operation != "role.create" || create.TargetType != "role" || create.TargetID != "editor" ||
+		create.Before != nil || !reflect.DeepEqual(create.After, map[string]interface{}{"name": "editor", "description": "Can edit"}) {
+		t.Errorf("create entry = %+v", create)
+	}
+
+	del := crudAuditEntry("group", "delete", "public_works", "")
+	if del.Operation != "group.delete" || del.After != nil || !reflect.DeepEqual(del.Before, map[string]interface{}{"name": "public_works"}) {
+		t.Errorf("delete entry = %+v", del)
+	}
+}
+
+func TestIdentityUserState(t *testing.T) {
+	state := identityUserState(&IdentityUser{
+		ID: "u1", Username: "jdoe", Email: "jdoe@example.com", FirstName: "Jane", LastName: "Doe", Enabled: true,
+		Attributes: map[string][]string{"phoneNumber": {"5551234567"}, "locale": {"en"}},
+	})
+	want := map[string]interface{}{
+		"email": "jdoe@example.com", "first_name": "Jane", "last_name": "Doe", "enabled": true, "phone": "5551234567",
+	}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("state = %v\nwant    %v", state, want)
+	}
+
+	if _, ok := identityUserState(&IdentityUser{})["phone"]; ok {
+		t.Error("phone should be omitted when the user has none")
+	}
+}
+
+func TestMarshalAuditState(t *testing.T) {
+	if got, err := marshalAuditState(nil); got != nil || err != nil {
+		t.Errorf("marshalAuditState(nil) = %v, %v; want SQL NULL", got, err)
+	}
+	got, err := marshalAuditState(map[string]interface{}{"roles": []string{"user"}})
+	if err != nil || *got != `{"roles":["user"]}` {
+		t.Errorf("marshalAuditState = %v, %v", got, err)
+	}
+}
+
+func TestJobAuditContext_DBUser(t *testing.T) {
+	var args AssignKeycloakRoleArgs
+	if err := json.Unmarshal([]byte(`{"user_id":"u1","role_name":"editor","audit":{"db_user":"postgres"}}`), &args); err != nil {
+		t.Fatal(err)
+	}
+	if args.Audit == nil || args.Audit.DBUser != "postgres" || args.Audit.HasActor() {
+		t.Errorf("audit = %+v; want db_user without an actor", args.Audit)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Identity Providers
+//
+// IdentityProvider abstracts the admin API behind the user provisioning,
+// role/group sync, update, deprovisioning and user sync jobs.
+// IDENTITY_PROVIDER selects the implementation:
+//   - keycloak:  Keycloak Admin REST API (keycloak_client.go), the default
+//     when KEYCLOAK_ADMIN_URL is set
+//   - authentik: authentik API v3 (authentik_client.go)
+//
+// Installs that keep staff and residents in separate Keycloak realms set
+// KEYCLOAK_REALMS; the provider then implements IdentityRealms. Each user's
+// realm is metadata.civic_os_users.identity_realm (NULL: the default realm,
+// KEYCLOAK_REALM), set when the user is provisioned or synced, and jobs for
+// an existing user run against that realm (providerForUser). Roles and groups
+// are created and deleted in every realm.
+//
+// Civic OS uses the provider's user ID as civic_os_users.id and the JWT sub,
+// so it must be a UUID. Job kinds keep their Keycloak names
+// (provision_keycloak_user, assign_keycloak_role, ...) whichever provider runs
+// them, since the database triggers insert them by name.
+// ============================================================================
+
+// errIdentityUserNotFound is wrapped by lookups of a user ID the provider doesn't have
+var errIdentityUserNotFound = errors.New("not found in the identity provider")
+
+// errIdentityGroupNotFound is wrapped by lookups of a group name the provider doesn't have
+var errIdentityGroupNotFound = errors.New("group not found in the identity provider")
+
+// errIdentityRealmNotServed is wrapped when a job names a realm the worker
+// isn't configured for
+var errIdentityRealmNotServed = errors.New("is not served by this worker (KEYCLOAK_REALMS)")
+
+// IdentityUser represents a user at the identity provider. The JSON tags
+// follow Keycloak's UserRepresentation; other providers map their users onto it.
+type IdentityUser struct {
+	ID            string              `json:"id"`
+	Username      string              `json:"username"`
+	Email         string              `json:"email"`
+	FirstName     string              `json:"firstName"`
+	LastName      string              `json:"lastName"`
+	Enabled       bool                `json:"enabled"`
+	EmailVerified bool                `json:"emailVerified"`
+	Attributes    map[string][]string `json:"attributes,omitempty"`
+
+	// Set on the users Keycloak creates for client service accounts (and on
+	// authentik service accounts, to the account type)
+	ServiceAccountClientID string `json:"serviceAccountClientId,omitempty"`
+}
+
+// IdentityProvider manages users, roles and groups at the identity provider.
+// Roles are what the JWT carries as roles; groups are the v0.95.0 groups.
+type IdentityProvider interface {
+	// Name identifies the provider in logs and the health check
+	Name() string
+	// Ping checks that the provider is reachable with the configured credentials
+	Ping(ctx context.Context) error
+
+	// GetUserByEmail returns nil, nil when no user has the email
+	GetUserByEmail(ctx context.Context, email string) (*IdentityUser, error)
+	// GetUserByID wraps errIdentityUserNotFound when the user doesn't exist
+	GetUserByID(ctx context.Context, userID string) (*IdentityUser, error)
+	// ListUsers returns one page of users starting at offset first. A page
+	// shorter than max is the last one.
+	ListUsers(ctx context.Context, first, max int) ([]IdentityUser, error)
+	// CreateUser creates an enabled user and returns its ID
+	CreateUser(ctx context.Context, email, firstName, lastName, phone string) (string, error)
+	UpdateUser(ctx context.Context, userID, email, firstName, lastName, phone string) error
+	DisableUser(ctx context.Context, userID string) error
+	// AnonymizeUser disables the user and clears their profile
+	AnonymizeUser(ctx context.Context, userID string) error
+	// LogoutUser ends all of the user's sessions
+	LogoutUser(ctx context.Context, userID string) error
+
+	// GetUserRoles returns the user's effective roles (what the JWT carries);
+	// it wraps errIdentityUserNotFound when the user doesn't exist
+	GetUserRoles(ctx context.Context, userID string) ([]string, error)
+	// GetUserDirectRoles returns the roles RemoveRoles can take away
+	GetUserDirectRoles(ctx context.Context, userID string) ([]string, error)
+	AssignRoles(ctx context.Context, userID string, roleNames []string) error
+	RemoveRoles(ctx context.Context, userID string, roleNames []string) error
+	// CreateRole and DeleteRole succeed when there is nothing to do
+	CreateRole(ctx context.Context, name, description string) error
+	DeleteRole(ctx context.Context, name string) error
+
+	// CreateGroup and DeleteGroup succeed when there is nothing to do
+	CreateGroup(ctx context.Context, name, description string) error
+	DeleteGroup(ctx context.Context, name string) error
+	// AddUserToGroup and RemoveUserFromGroup wrap errIdentityGroupNotFound
+	// when the group doesn't exist
+	AddUserToGroup(ctx context.Context, userID, groupName string) error
+	RemoveUserFromGroup(ctx context.Context, userID, groupName string) error
+}
+
+// IdentityRealms is implemented by providers serving several realms
+type IdentityRealms interface {
+	// Realms lists the realms served, the default one first
+	Realms() []string
+	// ForRealm returns the provider for realm; "" is the default realm
+	ForRealm(realm string) (IdentityProvider, error)
+}
+
+// providerForRealm returns the provider for realm. "" is the default realm,
+// the only one a provider without IdentityRealms serves.
+func providerForRealm(provider IdentityProvider, realm string) (IdentityProvider, error) {
+	if realms, ok := provider.(IdentityRealms); ok {
+		return realms.ForRealm(realm)
+	}
+	if realm != "" {
+		return nil, fmt.Errorf("realm %q %w", realm, errIdentityRealmNotServed)
+	}
+	return provider, nil
+}
+
+// providerRealms returns one provider per realm served, the default first
+func providerRealms(provider IdentityProvider) ([]IdentityProvider, error) {
+	realms, ok := provider.(IdentityRealms)
+	if !ok {
+		return []IdentityProvider{provider}, nil
+	}
+	var providers []IdentityProvider
+	for _, realm := range realms.Realms() {
+		p, err := realms.ForRealm(realm)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// providerForUser returns the provider for the realm of an existing user.
+// With a single realm there is nothing to look up.
+func providerForUser(ctx context.Context, dbPool *pgxpool.Pool, provider IdentityProvider, userID string) (IdentityProvider, error) {
+	if realms, ok := provider.(IdentityRealms); !ok || len(realms.Realms()) < 2 {
+		return provider, nil
+	}
+	var realm *string
+	err := dbPool.QueryRow(ctx, `
+		SELECT identity_realm FROM metadata.civic_os_users WHERE id = $1
+	`, userID).Scan(&realm)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to look up realm of user %s: %w", userID, err)
+	}
+	if realm == nil {
+		return providerForRealm(provider, "")
+	}
+	return providerForRealm(provider, *realm)
+}
+
+// KeycloakConfig holds the Keycloak service account settings
+type KeycloakConfig struct {
+	AdminURL     string
+	Realm        string // default realm
+	ClientID     string
+	ClientSecret string
+
+	// Realms are served besides Realm, with the service account of
+	// AuthRealm ("" means Realm)
+	Realms    []string
+	AuthRealm string
+}
+
+// NewIdentityProvider builds the provider named by IDENTITY_PROVIDER. An
+// empty name means keycloak when KEYCLOAK_ADMIN_URL is set, and otherwise
+// returns nil (user provisioning disabled).
+func NewIdentityProvider(name string, keycloak KeycloakConfig, authentik AuthentikConfig) (IdentityProvider, error) {
+	if name == "" && keycloak.AdminURL != "" {
+		name = "keycloak"
+	}
+	switch name {
+	case "":
+		return nil, nil
+	case "keycloak":
+		if keycloak.AdminURL == "" {
+			return nil, fmt.Errorf("IDENTITY_PROVIDER=keycloak requires KEYCLOAK_ADMIN_URL")
+		}
+		kc := NewKeycloakClient(keycloak.AdminURL, keycloak.Realm, keycloak.ClientID, keycloak.ClientSecret)
+		if len(keycloak.Realms) > 0 || keycloak.AuthRealm != "" {
+			kc.ServeRealms(keycloak.AuthRealm, keycloak.Realms)
+		}
+		return kc, nil
+	case "authentik":
+		if len(keycloak.Realms) > 0 {
+			return nil, fmt.Errorf("KEYCLOAK_REALMS is not supported with IDENTITY_PROVIDER=authentik")
+		}
+		return NewAuthentikClient(authentik)
+	default:
+		return nil, fmt.Errorf("unknown IDENTITY_PROVIDER %q (expected keycloak or authentik)", name)
+	}
+}
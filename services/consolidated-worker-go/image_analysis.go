@@ -0,0 +1,220 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/bits"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// ============================================================================
+// Image Analysis
+//
+// Alongside the thumbnails the worker stores, in metadata.files:
+//   - a BlurHash (https://blurha.sh) and the average colour, so lists can
+//     show a blurred preview before any thumbnail has downloaded (v0.111.0)
+//   - a 64-bit difference hash (dHash) that find_duplicate_files compares to
+//     flag near-duplicate uploads (v0.112.0)
+//
+// All are computed from one copy scaled down to at most analysisSize pixels
+// by the configured ImageProcessor, so they work for every format the
+// backend reads.
+// ============================================================================
+
+// analysisSize bounds the image the analysis runs on; a blurhash keeps only
+// a few frequencies and a dHash 9x8 pixels, so more pixels add nothing
+const analysisSize = 32
+
+// blurhashMaxComponents is the number of components along the longer side
+const blurhashMaxComponents = 4
+
+// ImageAnalysis is derived from an image (or rendered PDF page)
+type ImageAnalysis struct {
+	Blurhash       string
+	Color          string  // Average colour, #rrggbb
+	PerceptualHash *uint64 // dHash; the caller may drop it (PDFs)
+}
+
+// analyseImage scales the image down and analyses it
+func analyseImage(images ImageProcessor, data []byte) (*ImageAnalysis, error) {
+	small, err := images.Fit(data, analysisSize, analysisSize, 80)
+	if err != nil {
+		return nil, fmt.Errorf("scale image: %w", err)
+	}
+	src, _, err := image.Decode(bytes.NewReader(small))
+	if err != nil {
+		return nil, fmt.Errorf("decode scaled image: %w", err)
+	}
+
+	// Thumbnails are shown on white, so transparency is too
+	b := src.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, b.Min, draw.Over)
+
+	cx, cy := blurhashComponents(b.Dx(), b.Dy())
+	factors := blurhashFactors(flat, cx, cy)
+	hash := differenceHash(flat)
+	return &ImageAnalysis{
+		Blurhash:       encodeBlurhash(factors, cx, cy),
+		Color:          linearToHex(factors[0]),
+		PerceptualHash: &hash,
+	}, nil
+}
+
+// differenceHash computes a dHash: the image is squeezed to 9x8 grey pixels
+// and each bit records whether a pixel is brighter than its right
+// neighbour. Re-encoding, resizing and small edits change few bits, so the
+// Hamming distance between two hashes measures how alike the images look.
+func differenceHash(img *image.RGBA) uint64 {
+	small := imaging.Resize(img, 9, 8, imaging.Box)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luminance(small.NRGBAAt(x, y)) > luminance(small.NRGBAAt(x+1, y)) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// luminance is the Rec. 601 brightness of an opaque pixel
+func luminance(c color.NRGBA) float64 {
+	return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+}
+
+// hammingDistance counts the bits that differ between two hashes
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// blurhashComponents picks the component grid for an image: the longer side
+// gets blurhashMaxComponents, the shorter side proportionally fewer
+func blurhashComponents(width, height int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return blurhashMaxComponents, blurhashMaxComponents
+	}
+	short := func(long, short int) int {
+		return min(max(1, (blurhashMaxComponents*short+long/2)/long), blurhashMaxComponents)
+	}
+	if width >= height {
+		return blurhashMaxComponents, short(width, height)
+	}
+	return short(height, width), blurhashMaxComponents
+}
+
+// blurhashFactors returns the DCT components of img in linear RGB, row by
+// row (cx per row). The first is the DC component: the average colour.
+func blurhashFactors(img *image.RGBA, cx, cy int) [][3]float64 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	linear := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := img.RGBAAt(x, y)
+			linear[y*w+x] = [3]float64{sRGBToLinear(p.R), sRGBToLinear(p.G), sRGBToLinear(p.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, cx*cy)
+	for j := 0; j < cy; j++ {
+		for i := 0; i < cx; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				cosY := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) * cosY
+					px := linear[y*w+x]
+					f[0] += basis * px[0]
+					f[1] += basis * px[1]
+					f[2] += basis * px[2]
+				}
+			}
+			scale := normalisation / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+	return factors
+}
+
+// encodeBlurhash encodes components from blurhashFactors as specified at
+// https://github.com/woltapp/blurhash/blob/master/Algorithm.md
+func encodeBlurhash(factors [][3]float64, cx, cy int) string {
+	var sb strings.Builder
+	sb.WriteString(encodeBase83((cx-1)+(cy-1)*9, 1))
+
+	ac := factors[1:]
+	maximum := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = max(actualMax, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2]))
+		}
+		quantisedMax := int(max(0, min(82, math.Floor(actualMax*166-0.5))))
+		maximum = float64(quantisedMax+1) / 166
+		sb.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		sb.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	sb.WriteString(encodeBase83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(max(0, min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		sb.WriteString(encodeBase83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+	return sb.String()
+}
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// encodeBase83 writes value as exactly length base-83 digits
+func encodeBase83(value, length int) string {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = base83Chars[value%83]
+		value /= 83
+	}
+	return string(out)
+}
+
+func sRGBToLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	c := max(0, min(1, v))
+	if c <= 0.0031308 {
+		return int(c*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(c, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// linearToHex formats a linear RGB colour as #rrggbb
+func linearToHex(c [3]float64) string {
+	return fmt.Sprintf("#%02x%02x%02x", linearToSRGB(c[0]), linearToSRGB(c[1]), linearToSRGB(c[2]))
+}
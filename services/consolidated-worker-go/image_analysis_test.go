@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+func TestBlurhashComponents(t *testing.T) {
+	tests := []struct {
+		w, h   int
+		cx, cy int
+	}{
+		{32, 32, 4, 4},
+		{32, 24, 4, 3},
+		{24, 32, 3, 4},
+		{32, 8, 4, 1},
+		{32, 1, 4, 1},
+		{0, 0, 4, 4},
+	}
+	for _, tt := range tests {
+		if cx, cy := blurhashComponents(tt.w, tt.h); cx != tt.cx || cy != tt.cy {
+			t.Errorf("blurhashComponents(%d, %d) = %d, %d, want %d, %d", tt.w, tt.h, cx, cy, tt.cx, tt.cy)
+		}
+	}
+}
+
+func TestEncodeBase83(t *testing.T) {
+	if got := encodeBase83(0xFFFFFF, 4); got != "TSUA" {
+		t.Errorf("encodeBase83(white) = %q, want TSUA", got)
+	}
+	if got := encodeBase83(21, 1); got != "L" {
+		t.Errorf("encodeBase83(21) = %q, want L", got)
+	}
+}
+
+func TestAnalyseImage_SolidColour(t *testing.T) {
+	data := encodeTestPNG(t, solidImage(64, 48, color.NRGBA{R: 255, A: 255}))
+
+	p, err := analyseImage(goImageProcessor{}, data)
+	if err != nil {
+		t.Fatalf("analyseImage() error = %v", err)
+	}
+	if p.Color != "#ff0000" {
+		t.Errorf("color = %q, want #ff0000", p.Color)
+	}
+	// 4x3 components: size flag, max AC, then the DC (the colour itself)
+	if len(p.Blurhash) != 6+2*11 || p.Blurhash[:1] != encodeBase83(3+2*9, 1) || p.Blurhash[2:6] != encodeBase83(0xFF0000, 4) {
+		t.Errorf("blurhash = %q", p.Blurhash)
+	}
+}
+
+func TestAnalyseImage_TransparencyOnWhite(t *testing.T) {
+	data := encodeTestPNG(t, solidImage(16, 16, color.NRGBA{}))
+
+	p, err := analyseImage(goImageProcessor{}, data)
+	if err != nil {
+		t.Fatalf("analyseImage() error = %v", err)
+	}
+	if p.Color != "#ffffff" {
+		t.Errorf("color = %q, want #ffffff", p.Color)
+	}
+}
+
+func TestBlurhashFactors_Edge(t *testing.T) {
+	// Black left half, white right half
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 16; x < 32; x++ {
+			img.Set(x, y, color.White)
+		}
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+
+	factors := blurhashFactors(img, 4, 4)
+	if len(factors) != 16 {
+		t.Fatalf("len(factors) = %d, want 16", len(factors))
+	}
+	if dc := factors[0][0]; dc < 0.49 || dc > 0.51 {
+		t.Errorf("DC = %v, want 0.5 (half white in linear light)", dc)
+	}
+	// The edge is carried by the first horizontal component, not the vertical one
+	horizontal, vertical := factors[1][0], factors[4][0]
+	if horizontal > -0.5 || math.Abs(vertical) > math.Abs(horizontal)/10 {
+		t.Errorf("horizontal AC = %v, vertical AC = %v", horizontal, vertical)
+	}
+	if hash := encodeBlurhash(factors, 4, 4); len(hash) != 6+2*15 {
+		t.Errorf("blurhash = %q, want 36 characters for 4x4 components", hash)
+	}
+}
+
+func TestAnalyseImage_RejectsUnsupportedFormat(t *testing.T) {
+	if _, err := analyseImage(goImageProcessor{}, []byte("not an image")); err == nil {
+		t.Error("expected error for undecodable data")
+	}
+}
+
+func TestDifferenceHash(t *testing.T) {
+	// Brightness falls left to right, so every pixel is brighter than its neighbour
+	falling := image.NewRGBA(image.Rect(0, 0, 36, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 36; x++ {
+			v := uint8(255 - x*7)
+			falling.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	if got := differenceHash(falling); got != ^uint64(0) {
+		t.Errorf("falling gradient hash = %016x, want all ones", got)
+	}
+	if got := differenceHash(image.NewRGBA(image.Rect(0, 0, 32, 32))); got != 0 {
+		t.Errorf("flat image hash = %016x, want 0", got)
+	}
+}
+
+func TestAnalyseImage_NearDuplicates(t *testing.T) {
+	// Blocks of light and shade, and the same picture mirrored
+	photo := image.NewNRGBA(image.Rect(0, 0, 200, 150))
+	mirrored := image.NewNRGBA(photo.Bounds())
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			c := color.NRGBA{R: uint8(x), G: 40, B: uint8(y), A: 255}
+			if (x/30+y/40)%2 == 0 {
+				c.G = 220
+			}
+			photo.Set(x, y, c)
+			mirrored.Set(199-x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, photo, &jpeg.Options{Quality: 40}); err != nil {
+		t.Fatal(err)
+	}
+	resized, err := goImageProcessor{}.Embed(encodeTestPNG(t, photo), 100, 75, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	different := encodeTestPNG(t, mirrored)
+
+	hash := func(data []byte) uint64 {
+		t.Helper()
+		a, err := analyseImage(goImageProcessor{}, data)
+		if err != nil {
+			t.Fatalf("analyseImage() error = %v", err)
+		}
+		return *a.PerceptualHash
+	}
+	original := hash(encodeTestPNG(t, photo))
+	if d := hammingDistance(original, hash(buf.Bytes())); d > defaultDuplicateHashDistance {
+		t.Errorf("re-encoded JPEG distance = %d, want <= %d", d, defaultDuplicateHashDistance)
+	}
+	if d := hammingDistance(original, hash(resized)); d > defaultDuplicateHashDistance {
+		t.Errorf("resized copy distance = %d, want <= %d", d, defaultDuplicateHashDistance)
+	}
+	if d := hammingDistance(original, hash(different)); d <= defaultDuplicateHashDistance {
+		t.Errorf("different image distance = %d, want > %d", d, defaultDuplicateHashDistance)
+	}
+}
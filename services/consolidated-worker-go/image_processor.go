@@ -0,0 +1,112 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+)
+
+// ============================================================================
+// Image Processing Backends
+//
+// Thumbnails are rendered by libvips (through bimg) when the binary is built
+// with cgo and without the novips tag. libvips is a C library, which makes
+// arm64 and static builds awkward, so there is also a pure-Go backend built
+// on disintegration/imaging. It is always compiled in and is selected with
+// IMAGE_PROCESSOR=go, or automatically when libvips isn't available:
+//
+//	CGO_ENABLED=1 go build .              # libvips (default)
+//	CGO_ENABLED=1 go build -tags novips . # pure-Go images, SQL parser kept
+//	CGO_ENABLED=0 go build .              # fully static, no SQL parser
+// ============================================================================
+
+// ImageProcessor renders thumbnails from an original image
+type ImageProcessor interface {
+	// Name returns the IMAGE_PROCESSOR value that selects this backend
+	Name() string
+	// Describe returns library versions for the startup log
+	Describe() string
+	// Embed scales the image to fit width x height and centres it on a white
+	// canvas of exactly that size. Returns JPEG.
+	Embed(data []byte, width, height, quality int) ([]byte, error)
+	// Fit scales the image to fit width x height, keeping its aspect ratio
+	// and transparency. Returns PNG.
+	Fit(data []byte, width, height, quality int) ([]byte, error)
+}
+
+// newImageProcessor selects a backend from IMAGE_PROCESSOR ("auto", "vips" or "go")
+func newImageProcessor(mode string) (ImageProcessor, error) {
+	switch mode {
+	case "", "auto":
+		if vipsAvailable {
+			return newVipsImageProcessor(), nil
+		}
+		return goImageProcessor{}, nil
+	case "vips":
+		if !vipsAvailable {
+			return nil, fmt.Errorf("IMAGE_PROCESSOR=vips, but this binary was built without libvips (CGO_ENABLED=0 or -tags novips)")
+		}
+		return newVipsImageProcessor(), nil
+	case "go":
+		return goImageProcessor{}, nil
+	default:
+		return nil, fmt.Errorf("unknown IMAGE_PROCESSOR %q (want auto, vips or go)", mode)
+	}
+}
+
+// goImageProcessor implements ImageProcessor with disintegration/imaging.
+// It reads JPEG, PNG, GIF, TIFF and BMP, applies the EXIF orientation and
+// resamples with a Lanczos filter.
+type goImageProcessor struct{}
+
+func (goImageProcessor) Name() string { return "go" }
+
+func (goImageProcessor) Describe() string { return "pure Go (disintegration/imaging)" }
+
+func (goImageProcessor) Embed(data []byte, width, height, quality int) ([]byte, error) {
+	src, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, unsupportedFile(fmt.Errorf("decode image: %w", err))
+	}
+
+	// Resize rather than Fit so small originals are enlarged, like libvips
+	w, h := fitDimensions(src.Bounds().Dx(), src.Bounds().Dy(), width, height)
+	scaled := imaging.Resize(src, w, h, imaging.Lanczos)
+	canvas := imaging.OverlayCenter(imaging.New(width, height, color.White), scaled, 1)
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, canvas, imaging.JPEG, imaging.JPEGQuality(quality)); err != nil {
+		return nil, fmt.Errorf("encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (goImageProcessor) Fit(data []byte, width, height, quality int) ([]byte, error) {
+	src, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, unsupportedFile(fmt.Errorf("decode image: %w", err))
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, imaging.Fit(src, width, height, imaging.Lanczos), imaging.PNG); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fitDimensions returns the largest size with the source's aspect ratio
+// that fits in maxW x maxH (at least 1x1)
+func fitDimensions(srcW, srcH, maxW, maxH int) (int, int) {
+	if srcW <= 0 || srcH <= 0 {
+		return maxW, maxH
+	}
+	// Compare srcW/srcH with maxW/maxH without floating point
+	if srcW*maxH >= srcH*maxW {
+		return maxW, max(1, (srcH*maxW+srcW/2)/srcW)
+	}
+	return max(1, (srcW*maxH+srcH/2)/srcH), maxH
+}
@@ -0,0 +1,11 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+//go:build !cgo || novips
+
+package main
+
+// vipsAvailable reports whether this binary links libvips
+const vipsAvailable = false
+
+// newVipsImageProcessor is never called when vipsAvailable is false
+func newVipsImageProcessor() ImageProcessor { return nil }
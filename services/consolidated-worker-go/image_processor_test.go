@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode test png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// solidImage returns a w x h image filled with c
+func solidImage(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestNewImageProcessor(t *testing.T) {
+	auto, err := newImageProcessor("auto")
+	if err != nil {
+		t.Fatalf("auto: unexpected error: %v", err)
+	}
+	wantAuto := "go"
+	if vipsAvailable {
+		wantAuto = "vips"
+	}
+	if auto.Name() != wantAuto {
+		t.Errorf("auto selected %q, want %q", auto.Name(), wantAuto)
+	}
+
+	if p, err := newImageProcessor("go"); err != nil || p.Name() != "go" {
+		t.Errorf("go: got %v, %v", p, err)
+	}
+
+	_, err = newImageProcessor("vips")
+	if vipsAvailable != (err == nil) {
+		t.Errorf("vips: err = %v with vipsAvailable = %v", err, vipsAvailable)
+	}
+
+	if _, err := newImageProcessor("imagemagick"); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
+
+func TestFitDimensions(t *testing.T) {
+	tests := []struct {
+		srcW, srcH, maxW, maxH int
+		wantW, wantH           int
+	}{
+		{1600, 1200, 400, 400, 400, 300}, // landscape
+		{1200, 1600, 400, 400, 300, 400}, // portrait
+		{500, 500, 150, 150, 150, 150},   // square
+		{50, 40, 800, 800, 800, 640},     // enlarged
+		{10000, 1, 150, 150, 150, 1},     // never 0 tall
+	}
+	for _, tt := range tests {
+		w, h := fitDimensions(tt.srcW, tt.srcH, tt.maxW, tt.maxH)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("fitDimensions(%dx%d in %dx%d) = %dx%d, want %dx%d",
+				tt.srcW, tt.srcH, tt.maxW, tt.maxH, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestGoImageProcessor_EmbedLetterboxesOnWhite(t *testing.T) {
+	// 200x100 red image into a 100x100 square: 100x50 of red, white bars above and below
+	data := encodeTestPNG(t, solidImage(200, 100, color.NRGBA{R: 255, A: 255}))
+
+	out, err := goImageProcessor{}.Embed(data, 100, 100, 90)
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("output is not JPEG: %v", err)
+	}
+	if img.Bounds().Dx() != 100 || img.Bounds().Dy() != 100 {
+		t.Fatalf("size = %v, want 100x100", img.Bounds())
+	}
+
+	assertNear(t, "top bar", img.At(50, 5), color.White)
+	assertNear(t, "centre", img.At(50, 50), color.NRGBA{R: 255, A: 255})
+	assertNear(t, "bottom bar", img.At(50, 95), color.White)
+}
+
+func TestGoImageProcessor_EmbedFlattensTransparencyOnWhite(t *testing.T) {
+	data := encodeTestPNG(t, solidImage(64, 64, color.NRGBA{}))
+
+	out, err := goImageProcessor{}.Embed(data, 32, 32, 90)
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	img, _ := jpeg.Decode(bytes.NewReader(out))
+	assertNear(t, "transparent pixel", img.At(16, 16), color.White)
+}
+
+func TestGoImageProcessor_FitKeepsAspectAndAlpha(t *testing.T) {
+	data := encodeTestPNG(t, solidImage(300, 600, color.NRGBA{B: 255, A: 128}))
+
+	out, err := goImageProcessor{}.Fit(data, 150, 150, 80)
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("output is not PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 75 || img.Bounds().Dy() != 150 {
+		t.Errorf("size = %v, want 75x150", img.Bounds())
+	}
+	if _, _, _, a := img.At(30, 70).RGBA(); a>>8 < 126 || a>>8 > 130 {
+		t.Errorf("alpha = %d, want ~128 (transparency kept)", a>>8)
+	}
+}
+
+func TestGoImageProcessor_AppliesEXIFOrientation(t *testing.T) {
+	// A 200x100 photo tagged "rotate 90° clockwise" (orientation 6) is shown
+	// 100x200 by viewers, so the thumbnail must be portrait too
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, solidImage(200, 100, color.NRGBA{G: 255, A: 255}), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := withEXIFOrientation(buf.Bytes(), 6)
+
+	out, err := goImageProcessor{}.Fit(data, 50, 50, 80)
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("output is not PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 25 || img.Bounds().Dy() != 50 {
+		t.Errorf("size = %v, want 25x50 (rotated)", img.Bounds())
+	}
+}
+
+// withEXIFOrientation inserts an APP1 segment holding only the EXIF
+// orientation tag after the JPEG's SOI marker
+func withEXIFOrientation(jpegData []byte, orientation byte) []byte {
+	exif := []byte("Exif\x00\x00" +
+		"MM\x00\x2a\x00\x00\x00\x08" + // big-endian TIFF header, IFD at 8
+		"\x00\x01" + // one entry
+		"\x01\x12\x00\x03\x00\x00\x00\x01\x00" + string(orientation) + "\x00\x00" + // Orientation, SHORT
+		"\x00\x00\x00\x00") // no next IFD
+	segment := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	return append(append(append([]byte{}, jpegData[:2]...), segment...), jpegData[2:]...)
+}
+
+func TestGoImageProcessor_RejectsUnsupportedFormat(t *testing.T) {
+	_, err := (goImageProcessor{}).Embed([]byte("RIFF....WEBPVP8 "), 150, 150, 80)
+	if err == nil {
+		t.Fatal("expected decode error for WebP input")
+	}
+	if !isUnsupportedFile(err) {
+		t.Errorf("decode error %v should be permanent", err)
+	}
+}
+
+// assertNear fails if two colours differ by more than JPEG noise
+func assertNear(t *testing.T, name string, got, want color.Color) {
+	t.Helper()
+	r1, g1, b1, _ := got.RGBA()
+	r2, g2, b2, _ := want.RGBA()
+	diff := func(a, b uint32) int {
+		d := int(a>>8) - int(b>>8)
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	if diff(r1, r2) > 8 || diff(g1, g2) > 8 || diff(b1, b2) > 8 {
+		t.Errorf("%s: got rgb(%d,%d,%d), want rgb(%d,%d,%d)", name, r1>>8, g1>>8, b1>>8, r2>>8, g2>>8, b2>>8)
+	}
+}
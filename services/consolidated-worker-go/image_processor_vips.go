@@ -0,0 +1,48 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+//go:build cgo && !novips
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/h2non/bimg"
+)
+
+// vipsAvailable reports whether this binary links libvips
+const vipsAvailable = true
+
+// vipsImageProcessor implements ImageProcessor with bimg (libvips)
+type vipsImageProcessor struct{}
+
+func newVipsImageProcessor() ImageProcessor { return vipsImageProcessor{} }
+
+func (vipsImageProcessor) Name() string { return "vips" }
+
+func (vipsImageProcessor) Describe() string {
+	return fmt.Sprintf("bimg %s, libvips %s", bimg.Version, bimg.VipsVersion)
+}
+
+func (vipsImageProcessor) Embed(data []byte, width, height, quality int) ([]byte, error) {
+	out, err := bimg.NewImage(data).Process(bimg.Options{
+		Width:      width,
+		Height:     height,
+		Embed:      true,                               // Maintain aspect ratio, center within dimensions
+		Gravity:    bimg.GravityCentre,                 // Center the image
+		Background: bimg.Color{R: 255, G: 255, B: 255}, // White background for transparent areas
+		Type:       bimg.JPEG,
+		Quality:    quality,
+	})
+	return out, classifyVipsError(err)
+}
+
+func (vipsImageProcessor) Fit(data []byte, width, height, quality int) ([]byte, error) {
+	out, err := bimg.NewImage(data).Process(bimg.Options{
+		Width:   width,
+		Height:  height,
+		Type:    bimg.PNG,
+		Quality: quality,
+	})
+	return out, classifyVipsError(err)
+}
@@ -0,0 +1,377 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Import Readers
+//
+// An import file is read into records of text cells, whatever its format.
+// Like the export writers, XLSX is handled by hand: an import needs the
+// cell values of the first sheet, not formulas or formatting, and the only
+// formatting that matters is whether a number is a date.
+// ============================================================================
+
+// importRecord is one non-blank row of an import file
+type importRecord struct {
+	Line  int // row number in the file (spreadsheet row or CSV line)
+	Cells []string
+}
+
+// readImportFile reads a CSV or XLSX file; XLSX is recognised by its zip
+// signature, so a misnamed file is still read correctly
+func readImportFile(data []byte) ([]importRecord, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return readImportXLSX(data)
+	}
+	return readImportCSV(data)
+}
+
+// readImportCSV reads a CSV file, comma- or semicolon-separated
+func readImportCSV(data []byte) ([]importRecord, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel's UTF-8 BOM
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = sniffCSVDelimiter(data)
+	reader.FieldsPerRecord = -1
+
+	var records []importRecord
+	for {
+		cells, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a readable CSV file: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if record, ok := newImportRecord(line, cells); ok {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// newImportRecord trims the cells; blank rows are dropped
+func newImportRecord(line int, cells []string) (importRecord, bool) {
+	blank := true
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+		if cells[i] != "" {
+			blank = false
+		}
+	}
+	return importRecord{Line: line, Cells: cells}, !blank
+}
+
+// ============================================================================
+// XLSX
+// ============================================================================
+
+type xlsxWorkbookXML struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelsXML struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxRichText is a shared or inline string: plain text, or rich text runs.
+// Phonetic runs (rPh) are not part of the value.
+type xlsxRichText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (r xlsxRichText) String() string {
+	if len(r.Runs) == 0 {
+		return r.T
+	}
+	var b strings.Builder
+	for _, run := range r.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type xlsxStylesXML struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxCellXML struct {
+	Ref    string       `xml:"r,attr"`
+	Type   string       `xml:"t,attr"`
+	Style  int          `xml:"s,attr"`
+	Value  string       `xml:"v"`
+	Inline xlsxRichText `xml:"is"`
+}
+
+// xlsxReader holds what is needed to turn cells into text
+type xlsxReader struct {
+	files      map[string]*zip.File
+	strings    []string
+	dateStyles map[int]bool // cellXfs indexes with a date or time format
+	date1904   bool
+}
+
+// readImportXLSX reads the first sheet of a workbook
+func readImportXLSX(data []byte) ([]importRecord, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a readable XLSX file: %v", err)
+	}
+	x := &xlsxReader{files: map[string]*zip.File{}, dateStyles: map[int]bool{}}
+	for _, f := range archive.File {
+		x.files[f.Name] = f
+	}
+
+	var workbook xlsxWorkbookXML
+	if err := x.decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("the workbook has no sheets")
+	}
+	x.date1904 = workbook.Properties.Date1904
+
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var rels xlsxRelsXML
+	if err := x.decode("xl/_rels/workbook.xml.rels", &rels); err == nil {
+		for _, rel := range rels.Relationships {
+			if rel.ID == workbook.Sheets[0].RID {
+				sheetPath = xlsxPartPath(rel.Target)
+			}
+		}
+	}
+
+	if _, ok := x.files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxRichText `xml:"si"`
+		}
+		if err := x.decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		x.strings = make([]string, len(sst.Items))
+		for i, item := range sst.Items {
+			x.strings[i] = item.String()
+		}
+	}
+
+	if _, ok := x.files["xl/styles.xml"]; ok {
+		var styles xlsxStylesXML
+		if err := x.decode("xl/styles.xml", &styles); err != nil {
+			return nil, err
+		}
+		codes := map[int]string{}
+		for _, f := range styles.NumFmts {
+			codes[f.ID] = f.Code
+		}
+		for i, xf := range styles.CellXfs {
+			x.dateStyles[i] = isXLSXDateFormat(xf.NumFmtID, codes[xf.NumFmtID])
+		}
+	}
+
+	return x.readSheet(sheetPath)
+}
+
+// xlsxPartPath resolves a workbook relationship target to a part name
+func xlsxPartPath(target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join("xl", target)
+}
+
+func (x *xlsxReader) open(name string) (io.ReadCloser, error) {
+	f, ok := x.files[name]
+	if !ok {
+		return nil, fmt.Errorf("not a readable XLSX file: %s is missing", name)
+	}
+	return f.Open()
+}
+
+func (x *xlsxReader) decode(name string, v any) error {
+	r, err := x.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("not a readable XLSX file: %s: %v", name, err)
+	}
+	return nil
+}
+
+// readSheet streams the sheet's rows. Cells may be missing (blank) or
+// carry no reference, in which case they follow the previous cell.
+func (x *xlsxReader) readSheet(name string) ([]importRecord, error) {
+	r, err := x.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var records []importRecord
+	var cells []string
+	line := 0
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a readable XLSX file: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				line++
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "r" {
+						if n, err := strconv.Atoi(attr.Value); err == nil {
+							line = n
+						}
+					}
+				}
+				cells = cells[:0]
+			case "c":
+				var c xlsxCellXML
+				if err := decoder.DecodeElement(&c, &t); err != nil {
+					return nil, fmt.Errorf("not a readable XLSX file: %v", err)
+				}
+				col := len(cells)
+				if c.Ref != "" {
+					col = xlsxColumnIndex(c.Ref)
+				}
+				for len(cells) <= col {
+					cells = append(cells, "")
+				}
+				cells[col] = x.cellText(c)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				if record, ok := newImportRecord(line, append([]string(nil), cells...)); ok {
+					records = append(records, record)
+				}
+			}
+		}
+	}
+	return records, nil
+}
+
+// cellText is a cell's value as the import expects it: booleans as
+// true/false, numbers in a date format as ISO dates and times
+func (x *xlsxReader) cellText(c xlsxCellXML) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(x.strings) {
+			return ""
+		}
+		return x.strings[i]
+	case "inlineStr":
+		return c.Inline.String()
+	case "b":
+		return strconv.FormatBool(c.Value == "1")
+	case "str", "e", "d":
+		return c.Value
+	}
+	if x.dateStyles[c.Style] {
+		if serial, err := strconv.ParseFloat(c.Value, 64); err == nil {
+			return xlsxSerialText(serial, x.date1904)
+		}
+	}
+	return c.Value
+}
+
+// xlsxColumnIndex converts the letters of a cell reference ("AB12") to a
+// zero-based column index
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	return max(col-1, 0)
+}
+
+// isXLSXDateFormat reports whether a number format shows a date or time:
+// the built-in date formats, or a custom code with date or time parts
+// outside quoted text and [colour]/[$locale] sections
+func isXLSXDateFormat(id int, code string) bool {
+	switch {
+	case id >= 14 && id <= 22, id >= 45 && id <= 47:
+		return true
+	case code == "":
+		return false
+	}
+	var b strings.Builder
+	inQuote, inBracket := false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case !inBracket:
+			b.WriteRune(r)
+		}
+	}
+	return strings.ContainsAny(b.String(), "ymdhs")
+}
+
+// xlsxSerialText formats a spreadsheet date serial: a date when it is a
+// whole day, a time when it is under a day, otherwise a timestamp
+func xlsxSerialText(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	seconds := math.Round(serial * 86400)
+	t := epoch.Add(time.Duration(seconds) * time.Second)
+	switch {
+	case serial >= 0 && serial < 1:
+		return t.Format("15:04:05")
+	case math.Mod(seconds, 86400) == 0:
+		return t.Format("2006-01-02")
+	default:
+		return t.Format("2006-01-02 15:04:05")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadImportCSV(t *testing.T) {
+	data := []byte("\xef\xbb\xbfTitle;Count\n\n  Pothole ; 3\n;\n\"Two\nlines\";4\n")
+	records, err := readImportFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []importRecord{
+		{Line: 1, Cells: []string{"Title", "Count"}},
+		{Line: 3, Cells: []string{"Pothole", "3"}},
+		{Line: 5, Cells: []string{"Two\nlines", "4"}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %#v, want %#v", records, want)
+	}
+
+	if _, err := readImportCSV([]byte("a,\"b\n")); err == nil {
+		t.Error("expected an error for an unterminated quote")
+	}
+}
+
+func TestReadImportXLSXRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newXLSXExportWriter(&buf, "Issues", exportTestColumns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, title := "7", "Fix <lights> & signs"
+	if err := w.WriteRow([]*string{&id, &title}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]*string{nil, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readImportFile(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []importRecord{
+		{Line: 1, Cells: []string{"ID", "Title"}},
+		{Line: 2, Cells: []string{"7", "Fix <lights> & signs"}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %#v, want %#v", records, want)
+	}
+}
+
+func TestReadImportXLSXCells(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Data" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId3" Type="worksheet" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Due</t></si><si><r><t>Ti</t></r><r><t>tle</t></r><rPh><t>x</t></rPh></si></sst>`,
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd hh:mm"/></numFmts>
+<cellXfs count="3"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/></cellXfs></styleSheet>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>1</v></c><c r="C1" t="s"><v>0</v></c><c r="D1" t="inlineStr"><is><t>Done</t></is></c></row>
+<row r="4"><c r="A4"><v>12.5</v></c><c r="C4" s="1"><v>45292</v></c><c r="D4" t="b"><v>1</v></c><c r="E4" s="2"><v>45292.75</v></c></row>
+</sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for name, body := range parts {
+		f, _ := z.Create(name)
+		f.Write([]byte(body))
+	}
+	z.Close()
+
+	records, err := readImportFile(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []importRecord{
+		{Line: 1, Cells: []string{"Title", "", "Due", "Done"}},
+		{Line: 4, Cells: []string{"12.5", "", "2024-01-01", "true", "2024-01-01 18:00:00"}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %#v, want %#v", records, want)
+	}
+
+	if _, err := readImportXLSX([]byte("PK\x03\x04 not a zip")); err == nil {
+		t.Error("expected an error for a broken zip")
+	}
+}
+
+func TestIsXLSXDateFormat(t *testing.T) {
+	tests := []struct {
+		id   int
+		code string
+		want bool
+	}{
+		{0, "", false},
+		{2, "", false},
+		{14, "", true},
+		{22, "", true},
+		{164, "General", false},
+		{164, "#,##0.00", false},
+		{164, `0 "days"`, false},
+		{164, "[Red]0.00", false},
+		{164, "dd/mm/yyyy", true},
+		{164, "[$-409]h:mm AM/PM", true},
+	}
+	for _, tt := range tests {
+		if got := isXLSXDateFormat(tt.id, tt.code); got != tt.want {
+			t.Errorf("isXLSXDateFormat(%d, %q) = %v, want %v", tt.id, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXSerialText(t *testing.T) {
+	tests := []struct {
+		serial   float64
+		date1904 bool
+		want     string
+	}{
+		{45292, false, "2024-01-01"},
+		{45292.5, false, "2024-01-01 12:00:00"},
+		{0.25, false, "06:00:00"},
+		{0, true, "00:00:00"},
+		{1, true, "1904-01-02"},
+	}
+	for _, tt := range tests {
+		if got := xlsxSerialText(tt.serial, tt.date1904); got != tt.want {
+			t.Errorf("xlsxSerialText(%v, %v) = %q, want %q", tt.serial, tt.date1904, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXColumnIndex(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "C12": 2, "Z3": 25, "AA1": 26, "AB7": 27} {
+		if got := xlsxColumnIndex(ref); got != want {
+			t.Errorf("xlsxColumnIndex(%q) = %d, want %d", ref, got, want)
+		}
+	}
+}
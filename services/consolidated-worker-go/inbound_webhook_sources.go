@@ -0,0 +1,630 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Inbound Webhook Sources
+//
+// Each source is enabled by its verification key:
+//   - stripe:   STRIPE_WEBHOOK_SECRET (whsec_...), HMAC-SHA256 in
+//               Stripe-Signature; processed by the payment worker's
+//               reprocess_webhook job
+//   - telnyx:   TELNYX_PUBLIC_KEY, Ed25519 over "timestamp|body";
+//               sms_delivery_webhook records delivery reports
+//   - sendgrid: SENDGRID_WEBHOOK_PUBLIC_KEY, ECDSA P-256 over
+//               timestamp+body; email_event_webhook records each event
+//               and suppresses addresses that bounce or complain
+//   - docusign: DOCUSIGN_CONNECT_HMAC_KEYS (comma-separated), HMAC-SHA256
+//               in X-DocuSign-Signature-N; signature_webhook applies the
+//               envelope state (needs SIGNATURE_PROVIDER=docusign)
+//
+// Delivery reports go to metadata.delivery_events. They carry the
+// provider's message ID and the recipient, not a notification ID: the
+// senders don't record provider message IDs.
+// ============================================================================
+
+// InboundWebhookConfig holds the sources' verification keys; an empty key
+// leaves its source disabled
+type InboundWebhookConfig struct {
+	StripeSecret      string
+	TelnyxPublicKey   string // base64 Ed25519 key from the Telnyx portal
+	SendGridPublicKey string // base64 DER or PEM key from the SendGrid Event Webhook settings
+	DocuSignHMACKeys  string // Connect HMAC keys, comma-separated (rotation)
+}
+
+// NewInboundWebhookSources builds the sources with a key. The docusign
+// source also needs the DocuSign signature provider, since its job applies
+// envelope states to requests that provider sent.
+func NewInboundWebhookSources(config InboundWebhookConfig, docuSignSigning bool) ([]InboundWebhookSource, error) {
+	var sources []InboundWebhookSource
+	if config.StripeSecret != "" {
+		sources = append(sources, &stripeWebhookSource{secret: []byte(config.StripeSecret)})
+	}
+	if config.TelnyxPublicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(config.TelnyxPublicKey))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("TELNYX_PUBLIC_KEY: not a base64 Ed25519 public key")
+		}
+		sources = append(sources, &telnyxWebhookSource{publicKey: ed25519.PublicKey(key)})
+	}
+	if config.SendGridPublicKey != "" {
+		key, err := parseECDSAPublicKey(config.SendGridPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("SENDGRID_WEBHOOK_PUBLIC_KEY: %w", err)
+		}
+		sources = append(sources, &sendGridWebhookSource{publicKey: key})
+	}
+	if config.DocuSignHMACKeys != "" {
+		if !docuSignSigning {
+			log.Println("[Init] ⚠ DOCUSIGN_CONNECT_HMAC_KEYS is set but SIGNATURE_PROVIDER is not docusign; DocuSign webhooks disabled")
+		} else {
+			var keys [][]byte
+			for _, key := range strings.Split(config.DocuSignHMACKeys, ",") {
+				if key = strings.TrimSpace(key); key != "" {
+					keys = append(keys, []byte(key))
+				}
+			}
+			sources = append(sources, &docuSignWebhookSource{keys: keys})
+		}
+	}
+	return sources, nil
+}
+
+// parseECDSAPublicKey parses a PKIX ECDSA public key, PEM or bare base64
+func parseECDSAPublicKey(value string) (*ecdsa.PublicKey, error) {
+	value = strings.TrimSpace(value)
+	var der []byte
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("not base64 or PEM: %w", err)
+		}
+		der = decoded
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA public key")
+	}
+	return ecKey, nil
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of message under key
+func hmacSHA256(key []byte, message ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, m := range message {
+		mac.Write(m)
+	}
+	return mac.Sum(nil)
+}
+
+// ============================================================================
+// Stripe
+// ============================================================================
+
+// ReprocessWebhookArgs are the args of the payment worker's
+// reprocess_webhook job. Only the payment worker works it, so Kind and
+// InsertOpts must stay as in its reprocess_webhook.go.
+type ReprocessWebhookArgs struct {
+	WebhookID string `json:"webhook_id"`
+	Force     bool   `json:"force,omitempty"`
+}
+
+func (ReprocessWebhookArgs) Kind() string { return "reprocess_webhook" }
+
+func (ReprocessWebhookArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       river.QueueDefault,
+		MaxAttempts: 3,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs: true,
+			// Not completed: a fixed webhook can be reprocessed again
+			ByState: []rivertype.JobState{
+				rivertype.JobStateAvailable,
+				rivertype.JobStatePending,
+				rivertype.JobStateRetryable,
+				rivertype.JobStateRunning,
+				rivertype.JobStateScheduled,
+			},
+		},
+	}
+}
+
+// stripeWebhookSource stores Stripe events for the payment worker, which
+// processes stored events with its reprocess_webhook job
+type stripeWebhookSource struct {
+	secret []byte
+}
+
+func (s *stripeWebhookSource) Name() string { return "stripe" }
+
+// Verify checks Stripe-Signature: t=<unix>,v1=<hex HMAC of "t.body">, with
+// more than one v1 while the secret is being rolled
+func (s *stripeWebhookSource) Verify(header http.Header, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if err := checkWebhookTimestamp(timestamp, now); err != nil {
+		return err
+	}
+	expected := hmacSHA256(s.secret, []byte(timestamp), []byte("."), body)
+	for _, signature := range signatures {
+		if decoded, err := hex.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return errors.New("no matching v1 signature")
+}
+
+func (s *stripeWebhookSource) Events(body []byte) ([]InboundWebhookEvent, error) {
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, errors.New("event without id or type")
+	}
+	return []InboundWebhookEvent{{ID: event.ID, Type: event.Type, Payload: body}}, nil
+}
+
+// Enqueue queues the payment worker's reprocess_webhook job
+func (s *stripeWebhookSource) Enqueue(ctx context.Context, tx pgx.Tx, jobs *JobEnqueuer, webhookID string) error {
+	_, err := jobs.InsertTx(ctx, tx, ReprocessWebhookArgs{WebhookID: webhookID}, nil)
+	return err
+}
+
+// ============================================================================
+// Telnyx (SMS delivery reports)
+// ============================================================================
+
+// telnyxWebhookSource receives Telnyx messaging webhooks
+type telnyxWebhookSource struct {
+	publicKey ed25519.PublicKey
+}
+
+func (s *telnyxWebhookSource) Name() string { return "telnyx" }
+
+// Verify checks telnyx-signature-ed25519 over "<telnyx-timestamp>|<body>"
+func (s *telnyxWebhookSource) Verify(header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("Telnyx-Timestamp")
+	if err := checkWebhookTimestamp(timestamp, now); err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(header.Get("Telnyx-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return errors.New("missing or malformed signature")
+	}
+	if !ed25519.Verify(s.publicKey, append([]byte(timestamp+"|"), body...), signature) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// telnyxWebhook is the part of a Telnyx messaging webhook the worker reads
+type telnyxWebhook struct {
+	Data struct {
+		ID         string    `json:"id"`
+		EventType  string    `json:"event_type"`
+		OccurredAt time.Time `json:"occurred_at"`
+		Payload    struct {
+			ID string `json:"id"` // message ID
+			To []struct {
+				PhoneNumber string `json:"phone_number"`
+				Status      string `json:"status"`
+			} `json:"to"`
+			Errors []telnyxErrorDetail `json:"errors"`
+		} `json:"payload"`
+	} `json:"data"`
+}
+
+func (s *telnyxWebhookSource) Events(body []byte) ([]InboundWebhookEvent, error) {
+	var webhook telnyxWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, err
+	}
+	if webhook.Data.ID == "" || webhook.Data.EventType == "" {
+		return nil, errors.New("event without id or event_type")
+	}
+	return []InboundWebhookEvent{{ID: webhook.Data.ID, Type: webhook.Data.EventType, Payload: body}}, nil
+}
+
+func (s *telnyxWebhookSource) Enqueue(ctx context.Context, tx pgx.Tx, jobs *JobEnqueuer, webhookID string) error {
+	_, err := jobs.InsertTx(ctx, tx, SMSDeliveryWebhookArgs{WebhookID: webhookID}, nil)
+	return err
+}
+
+// telnyxDeliveryEvents returns one delivery event per recipient of a
+// message.sent or message.finalized webhook; other events report nothing
+func telnyxDeliveryEvents(payload []byte) ([]DeliveryEvent, error) {
+	var webhook telnyxWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, err
+	}
+	data := webhook.Data
+	if data.EventType != "message.sent" && data.EventType != "message.finalized" {
+		return nil, nil
+	}
+
+	var reasons []string
+	for _, e := range data.Payload.Errors {
+		reasons = append(reasons, strings.TrimSpace(e.Code+" "+e.Title+": "+e.Detail))
+	}
+	events := make([]DeliveryEvent, 0, len(data.Payload.To))
+	for _, to := range data.Payload.To {
+		events = append(events, DeliveryEvent{
+			Channel:           "sms",
+			Provider:          "telnyx",
+			ProviderMessageID: data.Payload.ID,
+			Recipient:         to.PhoneNumber,
+			Event:             to.Status,
+			Reason:            strings.Join(reasons, "; "),
+			OccurredAt:        data.OccurredAt,
+		})
+	}
+	return events, nil
+}
+
+// ============================================================================
+// SendGrid (email events)
+// ============================================================================
+
+// sendGridWebhookSource receives SendGrid Event Webhook batches
+type sendGridWebhookSource struct {
+	publicKey *ecdsa.PublicKey
+}
+
+func (s *sendGridWebhookSource) Name() string { return "sendgrid" }
+
+// Verify checks the signed event webhook signature, an ASN.1 ECDSA
+// signature of SHA-256(timestamp + body). The timestamp's age isn't
+// checked: SendGrid retries a failed batch for up to 24 hours, and a
+// replayed batch is deduplicated by event ID.
+func (s *sendGridWebhookSource) Verify(header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Twilio-Email-Event-Webhook-Timestamp")
+	signature, err := base64.StdEncoding.DecodeString(header.Get("X-Twilio-Email-Event-Webhook-Signature"))
+	if err != nil || len(signature) == 0 || timestamp == "" {
+		return errors.New("missing or malformed signature")
+	}
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	if !ecdsa.VerifyASN1(s.publicKey, digest[:], signature) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// sendGridEvent is one event of a SendGrid Event Webhook batch
+type sendGridEvent struct {
+	EventID   string `json:"sg_event_id"`
+	MessageID string `json:"sg_message_id"`
+	Email     string `json:"email"`
+	Event     string `json:"event"`
+	Timestamp int64  `json:"timestamp"`
+	Reason    string `json:"reason"`   // bounce, dropped
+	Type      string `json:"type"`     // bounce: "bounce" (hard) or "blocked" (soft)
+	Response  string `json:"response"` // deferred, delivered
+}
+
+// Events stores each event of the batch on its own, so one bad event
+// doesn't block the rest
+func (s *sendGridWebhookSource) Events(body []byte) ([]InboundWebhookEvent, error) {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, err
+	}
+	events := make([]InboundWebhookEvent, 0, len(batch))
+	for i, raw := range batch {
+		var event sendGridEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		if event.EventID == "" || event.Event == "" {
+			return nil, fmt.Errorf("event %d has no sg_event_id or event", i)
+		}
+		events = append(events, InboundWebhookEvent{ID: event.EventID, Type: event.Event, Payload: raw})
+	}
+	return events, nil
+}
+
+func (s *sendGridWebhookSource) Enqueue(ctx context.Context, tx pgx.Tx, jobs *JobEnqueuer, webhookID string) error {
+	_, err := jobs.InsertTx(ctx, tx, EmailEventWebhookArgs{WebhookID: webhookID}, nil)
+	return err
+}
+
+// sendGridDeliveryEvent converts a stored SendGrid event
+func sendGridDeliveryEvent(payload []byte) (DeliveryEvent, error) {
+	var event sendGridEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return DeliveryEvent{}, err
+	}
+	// sg_message_id is "<X-Message-Id>.<filter>..."; the prefix matches the send
+	messageID, _, _ := strings.Cut(event.MessageID, ".")
+	reason := event.Reason
+	if reason == "" && event.Event == "deferred" {
+		reason = event.Response
+	}
+	return DeliveryEvent{
+		Channel:           "email",
+		Provider:          "sendgrid",
+		ProviderMessageID: messageID,
+		Recipient:         event.Email,
+		Event:             event.Event,
+		Reason:            reason,
+		OccurredAt:        time.Unix(event.Timestamp, 0).UTC(),
+	}, nil
+}
+
+// ============================================================================
+// DocuSign (Connect envelope events)
+// ============================================================================
+
+// docuSignWebhookSource receives DocuSign Connect (JSON) notifications
+type docuSignWebhookSource struct {
+	keys [][]byte
+}
+
+func (s *docuSignWebhookSource) Name() string { return "docusign" }
+
+// Verify checks the X-DocuSign-Signature-N headers, base64 HMAC-SHA256 of
+// the body; DocuSign sends one per active key, so any match will do
+func (s *docuSignWebhookSource) Verify(header http.Header, body []byte, now time.Time) error {
+	for name, values := range header {
+		if !strings.HasPrefix(name, "X-Docusign-Signature-") {
+			continue
+		}
+		for _, value := range values {
+			signature, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				continue
+			}
+			for _, key := range s.keys {
+				if hmac.Equal(signature, hmacSHA256(key, body)) {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("no matching X-DocuSign-Signature header")
+}
+
+// docuSignWebhook is the part of a Connect notification the worker reads
+type docuSignWebhook struct {
+	Event             string `json:"event"` // envelope-completed, recipient-signed, ...
+	GeneratedDateTime string `json:"generatedDateTime"`
+	Data              struct {
+		EnvelopeID      string `json:"envelopeId"`
+		EnvelopeSummary struct {
+			Status string `json:"status"`
+		} `json:"envelopeSummary"`
+	} `json:"data"`
+}
+
+// Events uses envelope, event and time as the ID; Connect notifications
+// have no event ID of their own
+func (s *docuSignWebhookSource) Events(body []byte) ([]InboundWebhookEvent, error) {
+	var webhook docuSignWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, err
+	}
+	if webhook.Data.EnvelopeID == "" || webhook.Event == "" {
+		return nil, errors.New("notification without envelopeId or event")
+	}
+	id := webhook.Data.EnvelopeID + "/" + webhook.Event + "/" + webhook.GeneratedDateTime
+	return []InboundWebhookEvent{{ID: id, Type: webhook.Event, Payload: body}}, nil
+}
+
+func (s *docuSignWebhookSource) Enqueue(ctx context.Context, tx pgx.Tx, jobs *JobEnqueuer, webhookID string) error {
+	_, err := jobs.InsertTx(ctx, tx, SignatureWebhookArgs{WebhookID: webhookID}, nil)
+	return err
+}
+
+// docuSignWebhookState returns the envelope and its Envelope* state. The
+// envelope summary is used when Connect includes it; otherwise envelope-*
+// events name the status. Events that say nothing about the envelope (most
+// recipient-* ones) return an empty state.
+func docuSignWebhookState(payload []byte) (envelopeID, state string, err error) {
+	var webhook docuSignWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return "", "", err
+	}
+	status := webhook.Data.EnvelopeSummary.Status
+	if status == "" {
+		status, _ = strings.CutPrefix(webhook.Event, "envelope-")
+		if status == webhook.Event {
+			return webhook.Data.EnvelopeID, "", nil
+		}
+	}
+	state, err = docuSignEnvelopeState(status)
+	if err != nil {
+		// envelope-resent, envelope-purge and the like; the poll covers them
+		return webhook.Data.EnvelopeID, "", nil
+	}
+	return webhook.Data.EnvelopeID, state, nil
+}
+
+// ============================================================================
+// Job Definitions
+// ============================================================================
+
+// SMSDeliveryWebhookArgs processes one stored Telnyx webhook
+type SMSDeliveryWebhookArgs struct {
+	WebhookID string `json:"webhook_id"`
+}
+
+func (SMSDeliveryWebhookArgs) Kind() string { return "sms_delivery_webhook" }
+
+func (SMSDeliveryWebhookArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: "inbound_webhooks", MaxAttempts: 5, Priority: 3}
+}
+
+// EmailEventWebhookArgs processes one stored SendGrid event
+type EmailEventWebhookArgs struct {
+	WebhookID string `json:"webhook_id"`
+}
+
+func (EmailEventWebhookArgs) Kind() string { return "email_event_webhook" }
+
+func (EmailEventWebhookArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: "inbound_webhooks", MaxAttempts: 5, Priority: 3}
+}
+
+// SignatureWebhookArgs processes one stored DocuSign Connect notification
+type SignatureWebhookArgs struct {
+	WebhookID string `json:"webhook_id"`
+}
+
+func (SignatureWebhookArgs) Kind() string { return "signature_webhook" }
+
+func (SignatureWebhookArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: "signatures", MaxAttempts: 5, Priority: 1}
+}
+
+// DeliveryEvent is one metadata.delivery_events row
+type DeliveryEvent struct {
+	Channel           string // "email" or "sms"
+	Provider          string
+	ProviderMessageID string
+	Recipient         string
+	Event             string
+	Reason            string
+	OccurredAt        time.Time
+}
+
+// recordDeliveryEvents inserts the events of one webhook; a reprocessed
+// webhook doesn't record a recipient twice
+func recordDeliveryEvents(ctx context.Context, dbPool *pgxpool.Pool, webhookID string, events []DeliveryEvent) error {
+	for _, e := range events {
+		if e.Recipient == "" {
+			continue
+		}
+		_, err := dbPool.Exec(ctx, `
+			INSERT INTO metadata.delivery_events
+				(webhook_id, channel, provider, provider_message_id, recipient, event, reason, occurred_at)
+			VALUES ($1::uuid, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, ''), $8)
+			ON CONFLICT (webhook_id, recipient) WHERE webhook_id IS NOT NULL DO NOTHING
+		`, webhookID, e.Channel, e.Provider, e.ProviderMessageID, e.Recipient, e.Event, e.Reason, e.OccurredAt)
+		if err != nil {
+			return fmt.Errorf("record %s event for %s: %w", e.Event, e.Recipient, err)
+		}
+	}
+	return nil
+}
+
+// SMSDeliveryWebhookWorker records Telnyx delivery reports
+type SMSDeliveryWebhookWorker struct {
+	river.WorkerDefaults[SMSDeliveryWebhookArgs]
+	dbPool *pgxpool.Pool
+}
+
+func (w *SMSDeliveryWebhookWorker) Work(ctx context.Context, job *river.Job[SMSDeliveryWebhookArgs]) error {
+	return processInboundWebhook(ctx, w.dbPool, job.Args.WebhookID, func(payload []byte) error {
+		events, err := telnyxDeliveryEvents(payload)
+		if err != nil {
+			return fmt.Errorf("parse Telnyx webhook: %w", err)
+		}
+		return recordDeliveryEvents(ctx, w.dbPool, job.Args.WebhookID, events)
+	})
+}
+
+// EmailEventWebhookWorker records SendGrid email events and suppresses
+// addresses that bounced or complained
+type EmailEventWebhookWorker struct {
+	river.WorkerDefaults[EmailEventWebhookArgs]
+	dbPool       *pgxpool.Pool
+	suppressions *EmailSuppressions
+}
+
+func (w *EmailEventWebhookWorker) Work(ctx context.Context, job *river.Job[EmailEventWebhookArgs]) error {
+	return processInboundWebhook(ctx, w.dbPool, job.Args.WebhookID, func(payload []byte) error {
+		event, err := sendGridDeliveryEvent(payload)
+		if err != nil {
+			return fmt.Errorf("parse SendGrid event: %w", err)
+		}
+		if err := recordDeliveryEvents(ctx, w.dbPool, job.Args.WebhookID, []DeliveryEvent{event}); err != nil {
+			return err
+		}
+		address, reason, detail, err := sendGridSuppression(payload)
+		if err != nil || address == "" || reason == "" {
+			return err
+		}
+		return w.suppressions.Suppress(ctx, address, reason, "sendgrid", detail)
+	})
+}
+
+// SignatureWebhookWorker applies envelope states reported by DocuSign
+// Connect, so a signed document is stored without waiting for the poll
+type SignatureWebhookWorker struct {
+	river.WorkerDefaults[SignatureWebhookArgs]
+	dbPool *pgxpool.Pool
+	jobs   *JobEnqueuer
+}
+
+func (w *SignatureWebhookWorker) Work(ctx context.Context, job *river.Job[SignatureWebhookArgs]) error {
+	return processInboundWebhook(ctx, w.dbPool, job.Args.WebhookID, func(payload []byte) error {
+		envelopeID, state, err := docuSignWebhookState(payload)
+		if err != nil {
+			return fmt.Errorf("parse DocuSign notification: %w", err)
+		}
+		if state == "" || state == EnvelopeSent {
+			return nil
+		}
+
+		// Requests already moved on (by the poll or an earlier notification)
+		// are left alone
+		var requestID string
+		err = w.dbPool.QueryRow(ctx, `
+			SELECT id::text FROM metadata.signature_requests
+			WHERE provider = 'docusign' AND envelope_id = $1 AND status = 'sent'
+		`, envelopeID).Scan(&requestID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("find request for envelope %s: %w", envelopeID, err)
+		}
+		if err := applyEnvelopeState(ctx, w.dbPool, w.jobs, requestID, state); err != nil {
+			return fmt.Errorf("record %s for request %s: %w", state, requestID, err)
+		}
+		log.Printf("[Job %d] ✓ Request %s envelope %s (DocuSign Connect)", job.ID, requestID, state)
+		return nil
+	})
+}
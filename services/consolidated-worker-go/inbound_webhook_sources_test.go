@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var webhookTestNow = time.Unix(1_700_000_000, 0)
+
+func TestStripeWebhookSource(t *testing.T) {
+	source := &stripeWebhookSource{secret: []byte("whsec_test")}
+	body := []byte(`{"id":"evt_1","type":"payment_intent.succeeded"}`)
+	ts := strconv.FormatInt(webhookTestNow.Unix(), 10)
+	valid := hex.EncodeToString(hmacSHA256([]byte("whsec_test"), []byte(ts+"."), body))
+	other := hex.EncodeToString(hmacSHA256([]byte("whsec_old"), []byte(ts+"."), body))
+
+	for _, tt := range []struct {
+		name   string
+		header string
+		ok     bool
+	}{
+		{"valid", "t=" + ts + ",v1=" + valid, true},
+		{"rolled secret", "t=" + ts + ",v1=" + other + ",v1=" + valid, true},
+		{"wrong secret", "t=" + ts + ",v1=" + other, false},
+		{"stale", "t=" + strconv.FormatInt(webhookTestNow.Add(-time.Hour).Unix(), 10) + ",v1=" + valid, false},
+		{"missing", "", false},
+	} {
+		header := http.Header{}
+		header.Set("Stripe-Signature", tt.header)
+		if err := source.Verify(header, body, webhookTestNow); (err == nil) != tt.ok {
+			t.Errorf("%s: Verify() = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+
+	events, err := source.Events(body)
+	if err != nil || len(events) != 1 || events[0].ID != "evt_1" || events[0].Type != "payment_intent.succeeded" {
+		t.Errorf("Events() = %+v, %v", events, err)
+	}
+	if _, err := source.Events([]byte(`{"object":"event"}`)); err == nil {
+		t.Error("Events() accepted an event without an id")
+	}
+}
+
+func TestTelnyxWebhookSource(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	sources, err := NewInboundWebhookSources(InboundWebhookConfig{TelnyxPublicKey: base64.StdEncoding.EncodeToString(public)}, false)
+	if err != nil || len(sources) != 1 || sources[0].Name() != "telnyx" {
+		t.Fatalf("NewInboundWebhookSources() = %v, %v", sources, err)
+	}
+	source := sources[0]
+
+	body := []byte(`{"data":{"id":"e1","event_type":"message.finalized","occurred_at":"2026-10-16T12:00:00Z",
+		"payload":{"id":"msg_1","to":[{"phone_number":"+15555550100","status":"delivery_failed"}],
+		"errors":[{"code":"40300","title":"Blocked as spam","detail":"Carrier rejected"}]}}}`)
+	ts := strconv.FormatInt(webhookTestNow.Unix(), 10)
+	header := http.Header{}
+	header.Set("Telnyx-Timestamp", ts)
+	header.Set("Telnyx-Signature-Ed25519", base64.StdEncoding.EncodeToString(ed25519.Sign(private, append([]byte(ts+"|"), body...))))
+	if err := source.Verify(header, body, webhookTestNow); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+	if err := source.Verify(header, append(body, ' '), webhookTestNow); err == nil {
+		t.Error("Verify() accepted a modified body")
+	}
+	if err := source.Verify(header, body, webhookTestNow.Add(time.Hour)); err == nil {
+		t.Error("Verify() accepted a stale timestamp")
+	}
+
+	events, err := source.Events(body)
+	if err != nil || len(events) != 1 || events[0].ID != "e1" || events[0].Type != "message.finalized" {
+		t.Fatalf("Events() = %+v, %v", events, err)
+	}
+	delivery, err := telnyxDeliveryEvents(events[0].Payload)
+	if err != nil || len(delivery) != 1 {
+		t.Fatalf("telnyxDeliveryEvents() = %+v, %v", delivery, err)
+	}
+	got := delivery[0]
+	if got.Recipient != "+15555550100" || got.Event != "delivery_failed" || got.ProviderMessageID != "msg_1" ||
+		got.Reason != "40300 Blocked as spam: Carrier rejected" || !got.OccurredAt.Equal(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("delivery event = %+v", got)
+	}
+
+	if delivery, _ := telnyxDeliveryEvents([]byte(`{"data":{"event_type":"message.received","payload":{"to":[{"phone_number":"+1"}]}}}`)); len(delivery) != 0 {
+		t.Errorf("inbound message reported as delivery: %+v", delivery)
+	}
+
+	if _, err := NewInboundWebhookSources(InboundWebhookConfig{TelnyxPublicKey: "c2hvcnQ="}, false); err == nil {
+		t.Error("accepted a short Telnyx key")
+	}
+}
+
+func TestSendGridWebhookSource(t *testing.T) {
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	sources, err := NewInboundWebhookSources(InboundWebhookConfig{SendGridPublicKey: base64.StdEncoding.EncodeToString(der)}, false)
+	if err != nil || len(sources) != 1 || sources[0].Name() != "sendgrid" {
+		t.Fatalf("NewInboundWebhookSources() = %v, %v", sources, err)
+	}
+	source := sources[0]
+
+	body := []byte(`[{"email":"a@example.org","event":"bounce","sg_event_id":"ev1","sg_message_id":"abc.filter0001","timestamp":1700000000,"reason":"550 mailbox unavailable"},
+		{"email":"b@example.org","event":"deferred","sg_event_id":"ev2","timestamp":1700000001,"response":"421 try later"}]`)
+	ts := "1700000000"
+	digest := sha256.Sum256(append([]byte(ts), body...))
+	signature, _ := ecdsa.SignASN1(rand.Reader, private, digest[:])
+	header := http.Header{}
+	header.Set("X-Twilio-Email-Event-Webhook-Timestamp", ts)
+	header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(signature))
+	if err := source.Verify(header, body, webhookTestNow); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+	header.Set("X-Twilio-Email-Event-Webhook-Timestamp", "1700000001")
+	if err := source.Verify(header, body, webhookTestNow); err == nil {
+		t.Error("Verify() accepted a different timestamp")
+	}
+
+	events, err := source.Events(body)
+	if err != nil || len(events) != 2 || events[0].ID != "ev1" || events[1].Type != "deferred" {
+		t.Fatalf("Events() = %+v, %v", events, err)
+	}
+	bounce, err := sendGridDeliveryEvent(events[0].Payload)
+	if err != nil || bounce.Recipient != "a@example.org" || bounce.ProviderMessageID != "abc" ||
+		bounce.Reason != "550 mailbox unavailable" || bounce.OccurredAt.Unix() != 1700000000 {
+		t.Errorf("bounce = %+v, %v", bounce, err)
+	}
+	if deferred, _ := sendGridDeliveryEvent(events[1].Payload); deferred.Reason != "421 try later" {
+		t.Errorf("deferred reason = %q, want the SMTP response", deferred.Reason)
+	}
+
+	if _, err := source.Events([]byte(`[{"email":"a@example.org","event":"open"}]`)); err == nil {
+		t.Error("Events() accepted an event without sg_event_id")
+	}
+}
+
+func TestDocuSignWebhookSource(t *testing.T) {
+	sources, err := NewInboundWebhookSources(InboundWebhookConfig{DocuSignHMACKeys: "old-key, new-key"}, true)
+	if err != nil || len(sources) != 1 || sources[0].Name() != "docusign" {
+		t.Fatalf("NewInboundWebhookSources() = %v, %v", sources, err)
+	}
+	source := sources[0]
+
+	body := []byte(`{"event":"envelope-completed","generatedDateTime":"2026-10-16T12:00:00Z","data":{"envelopeId":"env-1"}}`)
+	header := http.Header{}
+	header.Set("X-DocuSign-Signature-1", base64.StdEncoding.EncodeToString(hmacSHA256([]byte("unknown"), body)))
+	if err := source.Verify(header, body, webhookTestNow); err == nil {
+		t.Error("Verify() accepted an unknown key")
+	}
+	header.Set("X-DocuSign-Signature-2", base64.StdEncoding.EncodeToString(hmacSHA256([]byte("new-key"), body)))
+	if err := source.Verify(header, body, webhookTestNow); err != nil {
+		t.Errorf("Verify() = %v, want any matching key accepted", err)
+	}
+
+	events, err := source.Events(body)
+	if err != nil || len(events) != 1 || events[0].ID != "env-1/envelope-completed/2026-10-16T12:00:00Z" {
+		t.Fatalf("Events() = %+v, %v", events, err)
+	}
+
+	for _, tt := range []struct {
+		payload string
+		want    string
+	}{
+		{`{"event":"envelope-completed","data":{"envelopeId":"env-1"}}`, EnvelopeCompleted},
+		{`{"event":"envelope-voided","data":{"envelopeId":"env-1"}}`, EnvelopeVoided},
+		{`{"event":"recipient-declined","data":{"envelopeId":"env-1","envelopeSummary":{"status":"declined"}}}`, EnvelopeDeclined},
+		{`{"event":"envelope-delivered","data":{"envelopeId":"env-1"}}`, EnvelopeSent},
+		{`{"event":"recipient-signed","data":{"envelopeId":"env-1"}}`, ""},
+		{`{"event":"envelope-purge","data":{"envelopeId":"env-1"}}`, ""},
+	} {
+		envelopeID, state, err := docuSignWebhookState([]byte(tt.payload))
+		if err != nil || envelopeID != "env-1" || state != tt.want {
+			t.Errorf("docuSignWebhookState(%s) = %q, %q, %v; want %q", tt.payload, envelopeID, state, err, tt.want)
+		}
+	}
+
+	// Without DocuSign signing there is nothing to apply states to
+	if sources, _ := NewInboundWebhookSources(InboundWebhookConfig{DocuSignHMACKeys: "k"}, false); len(sources) != 0 {
+		t.Errorf("docusign source enabled without the DocuSign provider: %v", sources)
+	}
+}
+
+func TestReprocessWebhookArgsMatchPaymentWorker(t *testing.T) {
+	other, err := os.ReadFile("../payment-worker/reprocess_webhook.go")
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skip("the payment worker isn't checked out next to this one")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := os.ReadFile("inbound_webhook_sources.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl := "func (ReprocessWebhookArgs) InsertOpts() river.InsertOpts {"
+	if funcBody(own, decl) == "" || funcBody(own, decl) != funcBody(other, decl) {
+		t.Error("ReprocessWebhookArgs.InsertOpts differs from ../payment-worker/reprocess_webhook.go")
+	}
+	if kind := (ReprocessWebhookArgs{}).Kind(); !strings.Contains(string(other), `return "`+kind+`"`) {
+		t.Errorf("the payment worker has no %s job", kind)
+	}
+}
+
+// funcBody is src from decl up to the end of its block, or "" without decl
+func funcBody(src []byte, decl string) string {
+	s := string(src)
+	start := strings.Index(s, decl)
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(s[start:], "\n}\n")
+	if end < 0 {
+		return s[start:]
+	}
+	return s[start : start+end]
+}
@@ -0,0 +1,283 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Inbound Webhook Receiver
+//
+// Providers report what happened to what we sent them (a delivered SMS, a
+// bounced email, a signed envelope, a payment) by calling us back. The
+// InboundWebhookServer takes those calls on WEBHOOK_RECEIVER_PORT at
+// POST /webhooks/{source}, one path per InboundWebhookSource
+// (inbound_webhook_sources.go):
+//
+//  1. the source verifies the provider's signature over the raw body
+//  2. the source splits the body into events (SendGrid posts a batch)
+//  3. each new event is stored in metadata.webhooks, deduplicated by the
+//     provider's event ID, and the source queues the job that processes it,
+//     in the same transaction
+//  4. the provider gets 200 once everything is stored
+//
+// Processing happens in River, so a slow or failing handler doesn't make
+// the provider retry, and a failed event keeps its error on the stored row.
+// A source is enabled by its verification key; the others return 404.
+// ============================================================================
+
+// inboundWebhookMaxBody caps a webhook body; provider events are a few KB
+const inboundWebhookMaxBody = 1 << 20
+
+// inboundWebhookTolerance is how far a signed timestamp may be from now
+// before the request is treated as a replay
+const inboundWebhookTolerance = 5 * time.Minute
+
+// InboundWebhookEvent is one event from a webhook body
+type InboundWebhookEvent struct {
+	ID      string          // provider's event ID, unique per source
+	Type    string          // provider's event type, for metadata.webhooks.event_type
+	Payload json.RawMessage // stored as metadata.webhooks.payload
+}
+
+// InboundWebhookSource is a provider that posts webhooks to the receiver
+type InboundWebhookSource interface {
+	// Name is the path segment and metadata.webhooks.provider
+	Name() string
+	// Verify checks the provider's signature over the raw body
+	Verify(header http.Header, body []byte, now time.Time) error
+	// Events splits a verified body into events
+	Events(body []byte) ([]InboundWebhookEvent, error)
+	// Enqueue queues the job that processes a stored event, in tx
+	Enqueue(ctx context.Context, tx pgx.Tx, jobs *JobEnqueuer, webhookID string) error
+}
+
+// inboundEventStore stores events and queues their jobs, returning how many
+// were new; the database one is storeInboundEvents
+type inboundEventStore func(ctx context.Context, source InboundWebhookSource, events []InboundWebhookEvent) (int, error)
+
+// InboundWebhookServer serves the webhook endpoints. Like the tracking
+// server, it runs on its own port because it is reachable from the internet.
+type InboundWebhookServer struct {
+	sources map[string]InboundWebhookSource
+	store   inboundEventStore
+	now     func() time.Time // tests replace it
+	server  *http.Server
+}
+
+// NewInboundWebhookServer creates a receiver for sources listening on port
+func NewInboundWebhookServer(port string, sources []InboundWebhookSource, dbPool *pgxpool.Pool, jobs *JobEnqueuer) *InboundWebhookServer {
+	s := &InboundWebhookServer{
+		sources: make(map[string]InboundWebhookSource, len(sources)),
+		store: func(ctx context.Context, source InboundWebhookSource, events []InboundWebhookEvent) (int, error) {
+			return storeInboundEvents(ctx, dbPool, jobs, source, events)
+		},
+		now: time.Now,
+	}
+	for _, source := range sources {
+		s.sources[source.Name()] = source
+	}
+	s.server = &http.Server{
+		Addr:              ":" + port,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	return s
+}
+
+func (s *InboundWebhookServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webhooks/{source}", s.handleWebhook)
+	return mux
+}
+
+// Names returns the enabled sources, sorted
+func (s *InboundWebhookServer) Names() []string {
+	names := make([]string, 0, len(s.sources))
+	for name := range s.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start listens in a goroutine. A listen failure is logged, not fatal:
+// providers retry, and the signature poll still finds signed envelopes.
+func (s *InboundWebhookServer) Start() {
+	go func() {
+		log.Printf("[Webhooks] Receiving %v webhooks on %s", s.Names(), s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[Webhooks] Server stopped: %v", err)
+		}
+	}()
+}
+
+// Stop shuts the server down, waiting for in-flight requests
+func (s *InboundWebhookServer) Stop(ctx context.Context) {
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("[Webhooks] Shutdown error: %v", err)
+	}
+}
+
+func (s *InboundWebhookServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	source, ok := s.sources[r.PathValue("source")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	name := source.Name()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, inboundWebhookMaxBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := source.Verify(r.Header, body, s.now()); err != nil {
+		log.Printf("[Webhooks] Rejected %s webhook from %s: %v", name, r.RemoteAddr, err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	events, err := source.Events(body)
+	if err != nil {
+		log.Printf("[Webhooks] Invalid %s webhook: %v", name, err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := s.store(r.Context(), source, events)
+	if err != nil {
+		// The provider retries; nothing was stored
+		log.Printf("[Webhooks] Failed to store %s webhook: %v", name, err)
+		http.Error(w, "failed to store webhook", http.StatusInternalServerError)
+		return
+	}
+	if stored > 0 {
+		log.Printf("[Webhooks] ✓ %s: stored %d of %d event(s)", name, stored, len(events))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// storeInboundEvents stores the new events and queues a job for each in one
+// transaction. Events already stored (a provider retry) are skipped.
+func storeInboundEvents(ctx context.Context, dbPool *pgxpool.Pool, jobs *JobEnqueuer, source InboundWebhookSource, events []InboundWebhookEvent) (int, error) {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stored := 0
+	for _, event := range events {
+		var webhookID string
+		err := tx.QueryRow(ctx, `
+			INSERT INTO metadata.webhooks (provider, provider_event_id, event_type, payload, signature_verified)
+			VALUES ($1, $2, $3, $4, TRUE)
+			ON CONFLICT (provider, provider_event_id) DO NOTHING
+			RETURNING id::text
+		`, source.Name(), event.ID, event.Type, []byte(event.Payload)).Scan(&webhookID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("store event %s: %w", event.ID, err)
+		}
+		if err := source.Enqueue(ctx, tx, jobs, webhookID); err != nil {
+			return 0, fmt.Errorf("queue event %s: %w", event.ID, err)
+		}
+		stored++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+	return stored, nil
+}
+
+// checkWebhookTimestamp rejects a signed Unix timestamp outside the tolerance
+func checkWebhookTimestamp(value string, now time.Time) error {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid timestamp %q", value)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)).Abs(); age > inboundWebhookTolerance {
+		return fmt.Errorf("timestamp is %s from now", age.Round(time.Second))
+	}
+	return nil
+}
+
+// ============================================================================
+// Stored Event Processing
+// ============================================================================
+
+// errInboundWebhookNotFound is returned for a job whose event was deleted
+var errInboundWebhookNotFound = errors.New("webhook not found")
+
+// loadInboundWebhook returns a stored event's payload and whether it was
+// already processed
+func loadInboundWebhook(ctx context.Context, dbPool *pgxpool.Pool, webhookID string) ([]byte, bool, error) {
+	var payload []byte
+	var processed bool
+	err := dbPool.QueryRow(ctx, `
+		SELECT payload, processed FROM metadata.webhooks WHERE id = $1::uuid
+	`, webhookID).Scan(&payload, &processed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, errInboundWebhookNotFound
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("load webhook %s: %w", webhookID, err)
+	}
+	return payload, processed, nil
+}
+
+// finishInboundWebhook marks the event processed, or records why it wasn't
+// and returns the error so River retries
+func finishInboundWebhook(ctx context.Context, dbPool *pgxpool.Pool, webhookID string, processErr error) error {
+	if processErr != nil {
+		if _, err := dbPool.Exec(ctx, `
+			UPDATE metadata.webhooks SET error_message = $2 WHERE id = $1::uuid
+		`, webhookID, processErr.Error()); err != nil {
+			log.Printf("[Webhooks] Failed to record error on webhook %s: %v", webhookID, err)
+		}
+		return processErr
+	}
+	_, err := dbPool.Exec(ctx, `
+		UPDATE metadata.webhooks
+		SET processed = TRUE, processed_at = NOW(), error_message = NULL
+		WHERE id = $1::uuid
+	`, webhookID)
+	if err != nil {
+		return fmt.Errorf("mark webhook %s processed: %w", webhookID, err)
+	}
+	return nil
+}
+
+// processInboundWebhook runs process on a stored event unless it is gone or
+// already processed, and records the outcome on the row
+func processInboundWebhook(ctx context.Context, dbPool *pgxpool.Pool, webhookID string, process func(payload []byte) error) error {
+	payload, processed, err := loadInboundWebhook(ctx, dbPool, webhookID)
+	if errors.Is(err, errInboundWebhookNotFound) {
+		log.Printf("[Webhooks] Skipping webhook %s: %v", webhookID, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if processed {
+		return nil
+	}
+	return finishInboundWebhook(ctx, dbPool, webhookID, process(payload))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeWebhookSource accepts requests with X-Test-Signature: ok
+type fakeWebhookSource struct{}
+
+func (fakeWebhookSource) Name() string { return "fake" }
+
+func (fakeWebhookSource) Verify(header http.Header, body []byte, now time.Time) error {
+	if header.Get("X-Test-Signature") != "ok" {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+func (fakeWebhookSource) Events(body []byte) ([]InboundWebhookEvent, error) {
+	if string(body) == "garbage" {
+		return nil, errors.New("unparseable")
+	}
+	return []InboundWebhookEvent{{ID: "evt_1", Type: "test", Payload: body}}, nil
+}
+
+func (fakeWebhookSource) Enqueue(ctx context.Context, tx pgx.Tx, jobs *JobEnqueuer, webhookID string) error {
+	return nil
+}
+
+func testInboundWebhookServer(storeErr error) (*InboundWebhookServer, *[]InboundWebhookEvent) {
+	var stored []InboundWebhookEvent
+	s := &InboundWebhookServer{
+		sources: map[string]InboundWebhookSource{"fake": fakeWebhookSource{}},
+		store: func(ctx context.Context, source InboundWebhookSource, events []InboundWebhookEvent) (int, error) {
+			if storeErr != nil {
+				return 0, storeErr
+			}
+			stored = append(stored, events...)
+			return len(events), nil
+		},
+		now: time.Now,
+	}
+	return s, &stored
+}
+
+func TestInboundWebhookServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		signature string
+		body      string
+		storeErr  error
+		want      int
+		stored    int
+	}{
+		{"stored", http.MethodPost, "/webhooks/fake", "ok", `{"a":1}`, nil, http.StatusOK, 1},
+		{"unknown source", http.MethodPost, "/webhooks/twilio", "ok", `{}`, nil, http.StatusNotFound, 0},
+		{"bad signature", http.MethodPost, "/webhooks/fake", "forged", `{}`, nil, http.StatusUnauthorized, 0},
+		{"bad payload", http.MethodPost, "/webhooks/fake", "ok", "garbage", nil, http.StatusBadRequest, 0},
+		{"too large", http.MethodPost, "/webhooks/fake", "ok", strings.Repeat("x", inboundWebhookMaxBody+1), nil, http.StatusRequestEntityTooLarge, 0},
+		{"store failure", http.MethodPost, "/webhooks/fake", "ok", `{}`, errors.New("db down"), http.StatusInternalServerError, 0},
+		{"GET", http.MethodGet, "/webhooks/fake", "ok", "", nil, http.StatusMethodNotAllowed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, stored := testInboundWebhookServer(tt.storeErr)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-Test-Signature", tt.signature)
+			rec := httptest.NewRecorder()
+			s.handler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if len(*stored) != tt.stored {
+				t.Errorf("stored %d events, want %d", len(*stored), tt.stored)
+			}
+		})
+	}
+}
+
+func TestCheckWebhookTimestamp(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	for _, tt := range []struct {
+		value string
+		ok    bool
+	}{
+		{strconv.FormatInt(now.Unix(), 10), true},
+		{strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10), true},
+		{strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), false},
+		{strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), false},
+		{"", false},
+		{"yesterday", false},
+	} {
+		if err := checkWebhookTimestamp(tt.value, now); (err == nil) != tt.ok {
+			t.Errorf("checkWebhookTimestamp(%q) = %v, want ok %v", tt.value, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Job Administration
+//
+// Housekeeping for River's own river_job table (see migration
+// v0-90-0-job-admin):
+//
+//   - job_purge maintenance task: deletes completed and cancelled jobs past
+//     JOB_RETENTION_COMPLETED_HOURS / JOB_RETENTION_CANCELLED_HOURS. Both
+//     workers turn River's cleaner off for those states so this is the only
+//     place retention is decided.
+//   - job_admin_retry_discarded: queued by request_retry_discarded_jobs(),
+//     makes a kind's discarded jobs available again.
+//   - job_admin_cancel_stuck: queued by request_cancel_stuck_jobs(), cancels
+//     jobs running longer than a threshold.
+//
+// Retries and cancellations go through River's JobRetry/JobCancel so a
+// running job is cancelled on the worker holding it, not just in its row.
+// Every run is recorded in metadata.job_admin_runs for the admin UI.
+// ============================================================================
+
+const (
+	// Jobs retried or cancelled per job_admin job; the rest are reported as
+	// remaining so the admin can run it again
+	maxJobAdminJobsPerRun = 1000
+
+	// Rows deleted per purge statement, and statements per state per run, so
+	// a large backlog is worked off over several runs without long locks
+	jobPurgeBatchSize  = 5000
+	maxJobPurgeBatches = 100
+
+	// jobAdminRunRetention is how long job_admin_runs rows and resolved dead
+	// letters are kept
+	jobAdminRunRetention = 90 * 24 * time.Hour
+)
+
+// jobAdminRunStats is what one job_admin run did
+type jobAdminRunStats struct {
+	Affected  int
+	Remaining int
+}
+
+// ============================================================================
+// Retry Discarded Jobs
+// ============================================================================
+
+// RetryDiscardedJobsArgs is inserted by public.request_retry_discarded_jobs()
+type RetryDiscardedJobsArgs struct {
+	JobKind        string           `json:"kind"`
+	DiscardedSince *time.Time       `json:"discarded_since,omitempty"`
+	Audit          *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger
+}
+
+func (RetryDiscardedJobsArgs) Kind() string { return "job_admin_retry_discarded" }
+
+func (RetryDiscardedJobsArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "job_admin",
+		MaxAttempts: 3,
+		Priority:    1,
+	}
+}
+
+// RetryDiscardedJobsWorker makes discarded jobs of one kind available again
+type RetryDiscardedJobsWorker struct {
+	river.WorkerDefaults[RetryDiscardedJobsArgs]
+	dbPool *pgxpool.Pool
+}
+
+func (w *RetryDiscardedJobsWorker) Work(ctx context.Context, job *river.Job[RetryDiscardedJobsArgs]) error {
+	kind := job.Args.JobKind
+	log.Printf("[Job %d] Retrying discarded %s jobs (attempt %d/%d)", job.ID, kind, job.Attempt, job.MaxAttempts)
+
+	params := map[string]interface{}{}
+	if job.Args.DiscardedSince != nil {
+		params["discarded_since"] = job.Args.DiscardedSince
+	}
+	runID, err := startJobAdminRun(ctx, w.dbPool, "retry_discarded", kind, params, job.Args.Audit, job.ID)
+	if err != nil {
+		return err
+	}
+
+	stats, err := w.retry(ctx, job.Args)
+	finishJobAdminRun(ctx, w.dbPool, runID, stats, err)
+	if err != nil {
+		return err
+	}
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "jobs_retried", map[string]interface{}{
+		"kind":    kind,
+		"retried": stats.Affected,
+	})
+	log.Printf("[Job %d] ✓ Retried %d discarded %s job(s)%s", job.ID, stats.Affected, kind, remainingNote(stats.Remaining))
+	return nil
+}
+
+func (w *RetryDiscardedJobsWorker) retry(ctx context.Context, args RetryDiscardedJobsArgs) (jobAdminRunStats, error) {
+	client, err := river.ClientFromContextSafely[pgx.Tx](ctx)
+	if err != nil {
+		return jobAdminRunStats{}, err
+	}
+	ids, total, err := selectJobIDs(ctx, w.dbPool, `
+		FROM metadata.river_job
+		WHERE state = 'discarded' AND kind = $1
+		  AND ($2::TIMESTAMPTZ IS NULL OR finalized_at >= $2)
+	`, args.JobKind, args.DiscardedSince)
+	if err != nil {
+		return jobAdminRunStats{}, fmt.Errorf("find discarded %s jobs: %w", args.JobKind, err)
+	}
+	stats, err := applyToJobs(ctx, ids, total, client.JobRetry)
+
+	// Retried jobs' dead letters are resolved; ones still discarded stay open
+	if _, dbErr := w.dbPool.Exec(ctx, `
+		UPDATE metadata.job_dead_letters d
+		SET resolved_at = NOW(), resolution = 'retried', resolved_by = NULLIF($2, '')::UUID
+		FROM metadata.river_job j
+		WHERE d.river_job_id = j.id AND j.id = ANY($1) AND j.state <> 'discarded'
+		  AND d.resolved_at IS NULL
+	`, ids, requestedBy(args.Audit)); dbErr != nil {
+		log.Printf("[JobAdmin] Failed to resolve dead letters of retried %s jobs: %v", args.JobKind, dbErr)
+	}
+	return stats, err
+}
+
+// ============================================================================
+// Cancel Stuck Jobs
+// ============================================================================
+
+// CancelStuckJobsArgs is inserted by public.request_cancel_stuck_jobs()
+type CancelStuckJobsArgs struct {
+	RunningMinutes int              `json:"running_minutes"`
+	JobKind        string           `json:"kind,omitempty"` // Empty cancels every kind
+	Audit          *JobAuditContext `json:"audit,omitempty"`
+}
+
+func (CancelStuckJobsArgs) Kind() string { return "job_admin_cancel_stuck" }
+
+func (CancelStuckJobsArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "job_admin",
+		MaxAttempts: 3,
+		Priority:    1,
+	}
+}
+
+// CancelStuckJobsWorker cancels jobs that have been running too long
+type CancelStuckJobsWorker struct {
+	river.WorkerDefaults[CancelStuckJobsArgs]
+	dbPool *pgxpool.Pool
+}
+
+func (w *CancelStuckJobsWorker) Work(ctx context.Context, job *river.Job[CancelStuckJobsArgs]) error {
+	minutes := job.Args.RunningMinutes
+	if minutes <= 0 {
+		return river.JobCancel(fmt.Errorf("running_minutes must be positive, got %d", minutes))
+	}
+	log.Printf("[Job %d] Cancelling %s jobs running longer than %d minutes (attempt %d/%d)",
+		job.ID, kindOrAll(job.Args.JobKind), minutes, job.Attempt, job.MaxAttempts)
+
+	runID, err := startJobAdminRun(ctx, w.dbPool, "cancel_stuck", job.Args.JobKind,
+		map[string]interface{}{"running_minutes": minutes}, job.Args.Audit, job.ID)
+	if err != nil {
+		return err
+	}
+
+	stats, err := w.cancel(ctx, job.Args)
+	finishJobAdminRun(ctx, w.dbPool, runID, stats, err)
+	if err != nil {
+		return err
+	}
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "jobs_cancelled", map[string]interface{}{
+		"kind":            job.Args.JobKind,
+		"running_minutes": minutes,
+		"cancelled":       stats.Affected,
+	})
+	log.Printf("[Job %d] ✓ Cancelled %d stuck job(s)%s", job.ID, stats.Affected, remainingNote(stats.Remaining))
+	return nil
+}
+
+func (w *CancelStuckJobsWorker) cancel(ctx context.Context, args CancelStuckJobsArgs) (jobAdminRunStats, error) {
+	client, err := river.ClientFromContextSafely[pgx.Tx](ctx)
+	if err != nil {
+		return jobAdminRunStats{}, err
+	}
+	// Job admin jobs are never cancelled, including this one
+	ids, total, err := selectJobIDs(ctx, w.dbPool, `
+		FROM metadata.river_job
+		WHERE state = 'running'
+		  AND attempted_at < NOW() - make_interval(mins => $1)
+		  AND (NULLIF($2, '') IS NULL OR kind = $2)
+		  AND kind NOT LIKE 'job_admin_%'
+	`, args.RunningMinutes, args.JobKind)
+	if err != nil {
+		return jobAdminRunStats{}, fmt.Errorf("find stuck jobs: %w", err)
+	}
+	return applyToJobs(ctx, ids, total, client.JobCancel)
+}
+
+// ============================================================================
+// Shared Helpers
+// ============================================================================
+
+// selectJobIDs returns up to maxJobAdminJobsPerRun job IDs matching the
+// FROM/WHERE clause, oldest first, and how many match in total
+func selectJobIDs(ctx context.Context, dbPool *pgxpool.Pool, fromWhere string, args ...interface{}) ([]int64, int, error) {
+	var total int
+	if err := dbPool.QueryRow(ctx, "SELECT COUNT(*) "+fromWhere, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	rows, err := dbPool.Query(ctx,
+		fmt.Sprintf("SELECT id %s ORDER BY id LIMIT %d", fromWhere, maxJobAdminJobsPerRun), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, 0, err
+	}
+	return ids, total, nil
+}
+
+// applyToJobs calls fn (JobRetry or JobCancel) for each job. Jobs deleted or
+// finished in the meantime are skipped; any other error stops the run.
+func applyToJobs(ctx context.Context, ids []int64, total int, fn func(context.Context, int64) (*rivertype.JobRow, error)) (jobAdminRunStats, error) {
+	stats := jobAdminRunStats{Remaining: max(total-len(ids), 0)}
+	for i, id := range ids {
+		if _, err := fn(ctx, id); err != nil {
+			if errors.Is(err, river.ErrNotFound) {
+				continue
+			}
+			stats.Remaining += len(ids) - i
+			return stats, fmt.Errorf("job %d: %w", id, err)
+		}
+		stats.Affected++
+	}
+	return stats, nil
+}
+
+// startJobAdminRun records the start of a run in metadata.job_admin_runs
+func startJobAdminRun(ctx context.Context, dbPool *pgxpool.Pool, action, jobKind string, params map[string]interface{}, audit *JobAuditContext, jobID int64) (int64, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return 0, fmt.Errorf("marshal run parameters: %w", err)
+	}
+	var runID int64
+	err = dbPool.QueryRow(ctx, `
+		INSERT INTO metadata.job_admin_runs (action, job_kind, parameters, requested_by, river_job_id)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, '')::UUID, $5)
+		RETURNING id
+	`, action, jobKind, paramsJSON, requestedBy(audit), jobID).Scan(&runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record job admin run: %w", err)
+	}
+	return runID, nil
+}
+
+// finishJobAdminRun records the outcome. Failures are logged only: the run
+// row is bookkeeping and must not mask the job's own result.
+func finishJobAdminRun(ctx context.Context, dbPool *pgxpool.Pool, runID int64, stats jobAdminRunStats, runErr error) {
+	status, errorMessage := "completed", ""
+	if runErr != nil {
+		status, errorMessage = "failed", runErr.Error()
+	}
+	_, err := dbPool.Exec(ctx, `
+		UPDATE metadata.job_admin_runs
+		SET status = $2, jobs_affected = $3, jobs_remaining = $4,
+		    error_message = NULLIF($5, ''), finished_at = NOW()
+		WHERE id = $1
+	`, runID, status, stats.Affected, stats.Remaining, errorMessage)
+	if err != nil {
+		log.Printf("[JobAdmin] Failed to record outcome of run %d: %v", runID, err)
+	}
+}
+
+// requestedBy is the admin who queued a job_admin job, or "" if unknown
+func requestedBy(audit *JobAuditContext) string {
+	if audit.HasActor() {
+		return audit.ActorID
+	}
+	return ""
+}
+
+func remainingNote(remaining int) string {
+	if remaining == 0 {
+		return ""
+	}
+	return fmt.Sprintf("; %d more match, run again to continue", remaining)
+}
+
+func kindOrAll(kind string) string {
+	if kind == "" {
+		return "all"
+	}
+	return kind
+}
+
+// ============================================================================
+// Job Purge Maintenance Task
+// ============================================================================
+
+// JobPurgeTask deletes finished jobs past their retention. A retention of 0
+// keeps that state's jobs forever.
+type JobPurgeTask struct {
+	dbPool             *pgxpool.Pool
+	completedRetention time.Duration // JOB_RETENTION_COMPLETED_HOURS
+	cancelledRetention time.Duration // JOB_RETENTION_CANCELLED_HOURS
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (p *JobPurgeTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "job_purge",
+		Description: "Delete completed and cancelled River jobs past their retention period",
+		Interval:    time.Hour,
+		Jitter:      5 * time.Minute,
+		Run:         p.runPurge,
+	}
+}
+
+// runPurge deletes each state's expired jobs and records the run when it
+// deleted anything
+func (p *JobPurgeTask) runPurge(ctx context.Context) (string, error) {
+	started := time.Now()
+	deleted := map[string]int{}
+	var remaining bool
+	var runErr error
+	for _, state := range []struct {
+		name      rivertype.JobState
+		retention time.Duration
+	}{
+		{rivertype.JobStateCompleted, p.completedRetention},
+		{rivertype.JobStateCancelled, p.cancelledRetention},
+	} {
+		if state.retention <= 0 {
+			continue
+		}
+		n, more, err := p.purgeState(ctx, state.name, state.retention)
+		deleted[string(state.name)] = n
+		remaining = remaining || more
+		if err != nil {
+			runErr = fmt.Errorf("purge %s jobs: %w", state.name, err)
+			break
+		}
+	}
+
+	if _, err := p.dbPool.Exec(ctx,
+		`DELETE FROM metadata.job_admin_runs WHERE started_at < NOW() - $1::interval`,
+		intervalString(jobAdminRunRetention),
+	); err != nil && runErr == nil {
+		runErr = fmt.Errorf("purge job admin runs: %w", err)
+	}
+	if _, err := p.dbPool.Exec(ctx,
+		`DELETE FROM metadata.job_dead_letters WHERE resolved_at < NOW() - $1::interval`,
+		intervalString(jobAdminRunRetention),
+	); err != nil && runErr == nil {
+		runErr = fmt.Errorf("purge resolved dead letters: %w", err)
+	}
+
+	total := deleted[string(rivertype.JobStateCompleted)] + deleted[string(rivertype.JobStateCancelled)]
+	if total > 0 || runErr != nil {
+		p.recordPurge(ctx, started, deleted, remaining, runErr)
+	}
+	if runErr != nil {
+		return "", runErr
+	}
+	return jobPurgeSummary(deleted, remaining), nil
+}
+
+// purgeState deletes one state's jobs finalized before the retention, in
+// batches. more reports that the batch limit was hit with rows left.
+func (p *JobPurgeTask) purgeState(ctx context.Context, state rivertype.JobState, retention time.Duration) (deleted int, more bool, err error) {
+	for batch := 0; batch < maxJobPurgeBatches; batch++ {
+		tag, err := p.dbPool.Exec(ctx, `
+			DELETE FROM metadata.river_job
+			WHERE id IN (
+				SELECT id FROM metadata.river_job
+				WHERE state = $1 AND finalized_at < NOW() - $2::interval
+				LIMIT $3
+			)
+		`, string(state), intervalString(retention), jobPurgeBatchSize)
+		if err != nil {
+			return deleted, false, err
+		}
+		deleted += int(tag.RowsAffected())
+		if tag.RowsAffected() < jobPurgeBatchSize {
+			return deleted, false, nil
+		}
+	}
+	return deleted, true, nil
+}
+
+// recordPurge writes a finished job_admin_runs row for a purge. Failures are
+// logged only.
+func (p *JobPurgeTask) recordPurge(ctx context.Context, started time.Time, deleted map[string]int, remaining bool, runErr error) {
+	params, _ := json.Marshal(map[string]interface{}{
+		"completed_retention_hours": int(p.completedRetention / time.Hour),
+		"cancelled_retention_hours": int(p.cancelledRetention / time.Hour),
+		"deleted":                   deleted,
+	})
+	status, errorMessage := "completed", ""
+	if runErr != nil {
+		status, errorMessage = "failed", runErr.Error()
+	}
+	var remainingCount int
+	if remaining {
+		// Unknown without another scan; at least one more batch is waiting
+		remainingCount = jobPurgeBatchSize
+	}
+	_, err := p.dbPool.Exec(ctx, `
+		INSERT INTO metadata.job_admin_runs
+			(action, parameters, status, jobs_affected, jobs_remaining, error_message, started_at, finished_at)
+		VALUES ('purge', $1, $2, $3, $4, NULLIF($5, ''), $6, NOW())
+	`, params, status, deleted[string(rivertype.JobStateCompleted)]+deleted[string(rivertype.JobStateCancelled)],
+		remainingCount, errorMessage, started)
+	if err != nil {
+		log.Printf("[JobAdmin] Failed to record purge: %v", err)
+	}
+}
+
+// jobPurgeSummary is the task's last_message, e.g. "Deleted 120 completed, 3 cancelled jobs"
+func jobPurgeSummary(deleted map[string]int, remaining bool) string {
+	var parts []string
+	for _, state := range []rivertype.JobState{rivertype.JobStateCompleted, rivertype.JobStateCancelled} {
+		if n := deleted[string(state)]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, state))
+		}
+	}
+	if len(parts) == 0 {
+		return "No expired jobs"
+	}
+	summary := fmt.Sprintf("Deleted %s jobs", strings.Join(parts, ", "))
+	if remaining {
+		summary += "; more remain for the next run"
+	}
+	return summary
+}
+
+// jobRetention reads an hours setting; negative values are treated as 0
+// (keep forever)
+func jobRetention(key string, defaultHours int) time.Duration {
+	return time.Duration(max(getEnvInt(key, defaultHours), 0)) * time.Hour
+}
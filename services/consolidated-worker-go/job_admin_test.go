@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestApplyToJobs(t *testing.T) {
+	var called []int64
+	fn := func(ctx context.Context, id int64) (*rivertype.JobRow, error) {
+		called = append(called, id)
+		switch id {
+		case 2:
+			return nil, river.ErrNotFound // deleted since it was selected
+		case 4:
+			return nil, errors.New("connection reset")
+		}
+		return &rivertype.JobRow{ID: id}, nil
+	}
+
+	stats, err := applyToJobs(context.Background(), []int64{1, 2, 3}, 1200, fn)
+	if err != nil {
+		t.Fatalf("applyToJobs: %v", err)
+	}
+	if stats.Affected != 2 || stats.Remaining != 1197 {
+		t.Errorf("stats = %+v, want 2 affected, 1197 remaining", stats)
+	}
+
+	called = nil
+	stats, err = applyToJobs(context.Background(), []int64{3, 4, 5}, 3, fn)
+	if err == nil {
+		t.Fatal("expected the error from job 4")
+	}
+	if stats.Affected != 1 || stats.Remaining != 2 {
+		t.Errorf("stats = %+v, want 1 affected, 2 remaining (4 and 5)", stats)
+	}
+	if len(called) != 2 {
+		t.Errorf("called %v, want the run to stop at job 4", called)
+	}
+}
+
+func TestJobPurgeSummary(t *testing.T) {
+	tests := []struct {
+		name      string
+		deleted   map[string]int
+		remaining bool
+		want      string
+	}{
+		{"nothing", map[string]int{"completed": 0}, false, "No expired jobs"},
+		{"completed", map[string]int{"completed": 120}, false, "Deleted 120 completed jobs"},
+		{"both", map[string]int{"completed": 120, "cancelled": 3}, true,
+			"Deleted 120 completed, 3 cancelled jobs; more remain for the next run"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jobPurgeSummary(tt.deleted, tt.remaining); got != tt.want {
+				t.Errorf("jobPurgeSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobRetention(t *testing.T) {
+	t.Setenv("JOB_RETENTION_COMPLETED_HOURS", "168")
+	t.Setenv("JOB_RETENTION_CANCELLED_HOURS", "-5")
+
+	if got := jobRetention("JOB_RETENTION_COMPLETED_HOURS", 24); got != 168*time.Hour {
+		t.Errorf("completed retention = %s, want 168h", got)
+	}
+	if got := jobRetention("JOB_RETENTION_CANCELLED_HOURS", 24); got != 0 {
+		t.Errorf("negative retention = %s, want 0 (keep forever)", got)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Job Audit Context
+//
+// Jobs enqueued from a PostgREST request are stamped with an "audit" object by
+// the metadata.stamp_job_audit_context() trigger on metadata.river_job (see
+// migration v0-69-0-job-audit-context). It records who actually clicked the
+// button (actor_id), whose behalf they acted on (on_behalf_of, from the
+// X-On-Behalf-Of header, honored for real admins only), and the request ID
+// for log correlation.
+//
+// Jobs inserted by workers or the scheduler carry no audit context; the
+// helpers below are no-ops in that case. Identity jobs (user_provisioning
+// queue) always carry db_user, see identity_audit.go.
+// ============================================================================
+
+// JobAuditContext is the standardized "who did this" payload carried in job args
+type JobAuditContext struct {
+	ActorID           string   `json:"actor_id,omitempty"`
+	OnBehalfOf        string   `json:"on_behalf_of,omitempty"`
+	RequestID         string   `json:"request_id,omitempty"`
+	ImpersonatedRoles []string `json:"impersonated_roles,omitempty"`
+
+	// Database login role that enqueued the job. Stamped on user_provisioning
+	// queue jobs even without a JWT, for the identity audit log (v0.97.0).
+	DBUser string `json:"db_user,omitempty"`
+}
+
+// HasActor reports whether the job was triggered by an authenticated user
+func (a *JobAuditContext) HasActor() bool {
+	return a != nil && a.ActorID != ""
+}
+
+// EffectiveUserID returns the user an action should be attributed to:
+// the user acted on behalf of, or the actor themselves
+func (a *JobAuditContext) EffectiveUserID() string {
+	if a == nil {
+		return ""
+	}
+	if a.OnBehalfOf != "" {
+		return a.OnBehalfOf
+	}
+	return a.ActorID
+}
+
+// auditEventData merges the audit fields into an event payload.
+// Event-specific keys win over audit keys on collision.
+func (a *JobAuditContext) auditEventData(eventData map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	if a != nil {
+		if a.OnBehalfOf != "" {
+			merged["on_behalf_of"] = a.OnBehalfOf
+		}
+		if a.RequestID != "" {
+			merged["request_id"] = a.RequestID
+		}
+		if len(a.ImpersonatedRoles) > 0 {
+			merged["impersonated_roles"] = a.ImpersonatedRoles
+		}
+	}
+	for k, v := range eventData {
+		merged[k] = v
+	}
+	return merged
+}
+
+// recordJobAuditEvent writes an admin_audit_log row attributing a job's side
+// effect to the user who triggered it. Non-blocking: failures are logged only,
+// since the job's real work has already succeeded.
+func recordJobAuditEvent(ctx context.Context, dbPool *pgxpool.Pool, jobID int64, audit *JobAuditContext, eventType string, eventData map[string]interface{}) {
+	if !audit.HasActor() {
+		return
+	}
+
+	eventDataJSON, err := json.Marshal(audit.auditEventData(eventData))
+	if err != nil {
+		log.Printf("[Job %d] Audit event '%s' skipped: failed to marshal event data: %v", jobID, eventType, err)
+		return
+	}
+
+	_, err = dbPool.Exec(ctx, `
+		INSERT INTO metadata.admin_audit_log (user_id, user_email, event_type, event_data)
+		SELECT $1::UUID, p.email::TEXT, $2, $3::JSONB
+		FROM (SELECT 1) AS one
+		LEFT JOIN metadata.civic_os_users_private p ON p.id = $1::UUID
+	`, audit.ActorID, eventType, eventDataJSON)
+	if err != nil {
+		log.Printf("[Job %d] Audit event '%s' skipped: %v", jobID, eventType, err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJobAuditContext_EffectiveUserID(t *testing.T) {
+	var nilAudit *JobAuditContext
+	if got := nilAudit.EffectiveUserID(); got != "" {
+		t.Errorf("nil audit: expected empty, got %q", got)
+	}
+
+	self := &JobAuditContext{ActorID: "admin-1"}
+	if got := self.EffectiveUserID(); got != "admin-1" {
+		t.Errorf("expected actor when not acting on behalf, got %q", got)
+	}
+
+	onBehalf := &JobAuditContext{ActorID: "admin-1", OnBehalfOf: "user-2"}
+	if got := onBehalf.EffectiveUserID(); got != "user-2" {
+		t.Errorf("expected on_behalf_of user, got %q", got)
+	}
+}
+
+func TestJobAuditContext_HasActor(t *testing.T) {
+	var nilAudit *JobAuditContext
+	if nilAudit.HasActor() {
+		t.Error("nil audit should not have an actor")
+	}
+	if (&JobAuditContext{RequestID: "req-1"}).HasActor() {
+		t.Error("audit without actor_id should not have an actor")
+	}
+	if !(&JobAuditContext{ActorID: "admin-1"}).HasActor() {
+		t.Error("expected actor")
+	}
+}
+
+func TestJobAuditContext_AuditEventData(t *testing.T) {
+	audit := &JobAuditContext{
+		ActorID:           "admin-1",
+		OnBehalfOf:        "user-2",
+		RequestID:         "req-123",
+		ImpersonatedRoles: []string{"editor"},
+	}
+
+	got := audit.auditEventData(map[string]interface{}{
+		"role_name":  "manager",
+		"request_id": "event-wins",
+	})
+
+	if got["on_behalf_of"] != "user-2" {
+		t.Errorf("expected on_behalf_of to be merged, got %v", got["on_behalf_of"])
+	}
+	if got["role_name"] != "manager" {
+		t.Errorf("expected event field to be kept, got %v", got["role_name"])
+	}
+	if got["request_id"] != "event-wins" {
+		t.Errorf("expected event data to win on key collision, got %v", got["request_id"])
+	}
+	if _, ok := got["actor_id"]; ok {
+		t.Error("actor_id belongs in admin_audit_log.user_id, not event_data")
+	}
+}
+
+// TestProvisionUserArgs_AuditRoundTrip checks the args shape produced by the
+// stamp_job_audit_context trigger decodes, and that args without it still work.
+func TestProvisionUserArgs_AuditRoundTrip(t *testing.T) {
+	var stamped ProvisionUserArgs
+	raw := `{"provision_id": 7, "audit": {"actor_id": "a1", "on_behalf_of": "u2", "request_id": "r3"}}`
+	if err := json.Unmarshal([]byte(raw), &stamped); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if stamped.Audit == nil || stamped.Audit.OnBehalfOf != "u2" || stamped.Audit.RequestID != "r3" {
+		t.Errorf("expected audit context to decode, got %+v", stamped.Audit)
+	}
+
+	var plain ProvisionUserArgs
+	if err := json.Unmarshal([]byte(`{"provision_id": 7}`), &plain); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if plain.Audit != nil {
+		t.Errorf("expected nil audit for system-enqueued job, got %+v", plain.Audit)
+	}
+}
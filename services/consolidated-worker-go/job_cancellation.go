@@ -0,0 +1,85 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Cooperative Job Cancellation
+//
+// request_job_cancellation() and cancel_entity_import() record a row in
+// metadata.job_cancellation_requests (migration v0-124-0-job-cancellation)
+// instead of cancelling the job's context through River. A worker that
+// supports this checks for an open request before each batch:
+//
+//	if err := checkJobCancellation(ctx, w.dbPool, job.ID); err != nil {
+//		return err // *jobCancellationError when one was requested
+//	}
+//
+// On a *jobCancellationError it finishes its own record, calls
+// acknowledgeJobCancellation in the same transaction with what it got done,
+// and returns river.JobCancel so the job isn't retried. Batches already
+// committed stay; nothing is interrupted mid-statement.
+//
+// Supporting kinds are listed in request_job_cancellation(); a new one needs
+// a migration adding it there.
+// ============================================================================
+
+// jobCancellationError is returned by checkJobCancellation when the job has
+// an open cancellation request
+type jobCancellationError struct {
+	Reason string // empty if the requester gave none
+}
+
+func (e *jobCancellationError) Error() string {
+	if e.Reason == "" {
+		return "stopped on request"
+	}
+	return "stopped on request: " + e.Reason
+}
+
+// checkJobCancellation returns a *jobCancellationError if jobID has an open
+// cancellation request, nil if it hasn't
+func checkJobCancellation(ctx context.Context, dbPool *pgxpool.Pool, jobID int64) error {
+	var reason *string
+	err := dbPool.QueryRow(ctx, `
+		SELECT reason FROM metadata.job_cancellation_requests
+		WHERE river_job_id = $1 AND acknowledged_at IS NULL
+	`, jobID).Scan(&reason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check for cancellation: %w", err)
+	}
+	cancelErr := &jobCancellationError{}
+	if reason != nil {
+		cancelErr.Reason = *reason
+	}
+	return cancelErr
+}
+
+// acknowledgeJobCancellation closes jobID's request with what the job got
+// done before it stopped
+func acknowledgeJobCancellation(ctx context.Context, db dbExecer, jobID int64, result map[string]any) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode cancellation result: %w", err)
+	}
+	if _, err := db.Exec(ctx, `
+		UPDATE metadata.job_cancellation_requests
+		SET acknowledged_at = NOW(), result = $2
+		WHERE river_job_id = $1 AND acknowledged_at IS NULL
+	`, jobID, data); err != nil {
+		return fmt.Errorf("failed to acknowledge cancellation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/riverqueue/river"
+)
+
+func TestJobCancellationError(t *testing.T) {
+	for _, tt := range []struct {
+		reason string
+		want   string
+	}{
+		{"", "stopped on request"},
+		{"wrong file", "stopped on request: wrong file"},
+	} {
+		if got := (&jobCancellationError{Reason: tt.reason}).Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+
+	// Workers return it wrapped by their batch loop, and end the job with
+	// river.JobCancel
+	wrapped := fmt.Errorf("import 7: %w", &jobCancellationError{Reason: "duplicate upload"})
+	var cancelErr *jobCancellationError
+	if !errors.As(wrapped, &cancelErr) || cancelErr.Reason != "duplicate upload" {
+		t.Fatalf("errors.As() found %+v", cancelErr)
+	}
+	var riverCancel *river.JobCancelError
+	if !errors.As(river.JobCancel(cancelErr), &riverCancel) {
+		t.Error("river.JobCancel() didn't produce a JobCancelError")
+	}
+}
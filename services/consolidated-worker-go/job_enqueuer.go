@@ -0,0 +1,85 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Job Enqueuer
+// ============================================================================
+//
+// Go code queues River jobs through JobEnqueuer instead of writing
+// INSERT INTO metadata.river_job by hand, so each job gets the queue,
+// priority, max attempts and unique options declared by its args type, and
+// River's own unique_key/unique_states handling. SQL triggers don't use it:
+// they announce work with pg_notify() (see notify_listener.go).
+//
+// Workers and maintenance tasks are built before the River client, which
+// needs the workers to exist, so main binds the client once it is created.
+
+// errJobEnqueuerUnbound is returned by inserts before Bind
+var errJobEnqueuerUnbound = errors.New("job enqueuer: River client not bound yet")
+
+// JobEnqueuer inserts River jobs through the shared River client
+type JobEnqueuer struct {
+	client atomic.Pointer[river.Client[pgx.Tx]]
+}
+
+// NewJobEnqueuer creates an enqueuer; call Bind before inserting
+func NewJobEnqueuer() *JobEnqueuer {
+	return &JobEnqueuer{}
+}
+
+// Bind sets the River client jobs are inserted with
+func (e *JobEnqueuer) Bind(client *river.Client[pgx.Tx]) {
+	e.client.Store(client)
+}
+
+func (e *JobEnqueuer) riverClient() (*river.Client[pgx.Tx], error) {
+	client := e.client.Load()
+	if client == nil {
+		return nil, errJobEnqueuerUnbound
+	}
+	return client, nil
+}
+
+// Insert queues one job. opts overrides the args' InsertOpts field by
+// field and may be nil. A job skipped as a duplicate returns a result with
+// UniqueSkippedAsDuplicate set and the existing job.
+func (e *JobEnqueuer) Insert(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error) {
+	client, err := e.riverClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Insert(ctx, args, opts)
+}
+
+// InsertTx queues one job in tx, so it only becomes visible (and runs) if
+// tx commits
+func (e *JobEnqueuer) InsertTx(ctx context.Context, tx pgx.Tx, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error) {
+	client, err := e.riverClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.InsertTx(ctx, tx, args, opts)
+}
+
+// InsertManyTx queues several jobs in tx with one round trip
+func (e *JobEnqueuer) InsertManyTx(ctx context.Context, tx pgx.Tx, params []river.InsertManyParams) ([]*rivertype.JobInsertResult, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	client, err := e.riverClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.InsertManyTx(ctx, tx, params)
+}
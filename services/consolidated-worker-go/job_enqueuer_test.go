@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/riverqueue/river"
+)
+
+func TestJobEnqueuerUnbound(t *testing.T) {
+	jobs := NewJobEnqueuer()
+	ctx := context.Background()
+
+	if _, err := jobs.Insert(ctx, ThumbnailArgs{FileID: "f1"}, nil); !errors.Is(err, errJobEnqueuerUnbound) {
+		t.Errorf("Insert() error = %v, want errJobEnqueuerUnbound", err)
+	}
+	if _, err := jobs.InsertTx(ctx, nil, ThumbnailArgs{FileID: "f1"}, nil); !errors.Is(err, errJobEnqueuerUnbound) {
+		t.Errorf("InsertTx() error = %v, want errJobEnqueuerUnbound", err)
+	}
+	params := []river.InsertManyParams{{Args: ThumbnailArgs{FileID: "f1"}}}
+	if _, err := jobs.InsertManyTx(ctx, nil, params); !errors.Is(err, errJobEnqueuerUnbound) {
+		t.Errorf("InsertManyTx() error = %v, want errJobEnqueuerUnbound", err)
+	}
+}
+
+func TestJobEnqueuerInsertManyTxEmpty(t *testing.T) {
+	// Nothing to insert needs no client (a backfill batch with no outdated files)
+	results, err := NewJobEnqueuer().InsertManyTx(context.Background(), nil, nil)
+	if err != nil || results != nil {
+		t.Errorf("InsertManyTx(nil) = %v, %v, want nil, nil", results, err)
+	}
+}
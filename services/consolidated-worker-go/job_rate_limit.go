@@ -0,0 +1,289 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Job Rate Limits
+//
+// Providers cap request rates (Telnyx per sending number, webhook receivers,
+// Stripe), and a backlog of queued jobs would otherwise hit them all at once
+// and fail on 429s. JobRateLimiter is River worker middleware holding a token
+// bucket per job kind or queue (JOB_RATE_LIMITS). A job that finds its bucket
+// empty waits for a token while holding its worker slot, so a limited kind
+// runs at the limit instead of failing. If the wait would be longer than
+// jobRateLimitMaxWait, the job is snoozed for the wait instead, without
+// using up an attempt.
+//
+// Code can also wait on a named limit itself: the notification worker waits
+// on "channel:sms" before each text, because send_notification jobs also
+// carry email.
+//
+// Buckets are in memory, so a limit applies per worker instance; divide a
+// provider's limit by the number of replicas.
+// ============================================================================
+
+// jobRateLimitMaxWait is the longest a job blocks for a token before it is
+// snoozed instead
+const jobRateLimitMaxWait = 10 * time.Second
+
+// jobRateLimitLogWait is the shortest wait that is logged
+const jobRateLimitLogWait = time.Second
+
+// RateLimit allows Count operations per Per, in bursts of up to Count
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+// parseRateLimit parses "14/s", "30/m", "500/h", or a bare count per second
+func parseRateLimit(s string) (RateLimit, error) {
+	count, unit, hasUnit := strings.Cut(strings.TrimSpace(s), "/")
+	limit := RateLimit{Per: time.Second}
+	if hasUnit {
+		switch strings.TrimSpace(unit) {
+		case "s":
+		case "m":
+			limit.Per = time.Minute
+		case "h":
+			limit.Per = time.Hour
+		default:
+			return RateLimit{}, fmt.Errorf("unknown unit %q (use s, m or h)", unit)
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n <= 0 {
+		return RateLimit{}, fmt.Errorf("count must be a positive integer, got %q", count)
+	}
+	limit.Count = n
+	return limit, nil
+}
+
+// String formats the limit as parseRateLimit reads it
+func (r RateLimit) String() string {
+	unit := "s"
+	switch r.Per {
+	case time.Minute:
+		unit = "m"
+	case time.Hour:
+		unit = "h"
+	}
+	return fmt.Sprintf("%d/%s", r.Count, unit)
+}
+
+// jobRateLimitsFromEnv reads JOB_RATE_LIMITS, e.g.
+// "channel:sms=14/s,entity_webhook_delivery=5/s,queue:exports=30/m". Keys are
+// job kinds, "queue:<name>", or names code waits on directly.
+func jobRateLimitsFromEnv() map[string]RateLimit {
+	limits := make(map[string]RateLimit)
+	for key, value := range parseKeyValueList(getEnv("JOB_RATE_LIMITS", "")) {
+		limit, err := parseRateLimit(value)
+		if err != nil {
+			log.Printf("⚠️  WARNING: Invalid rate limit for %s in JOB_RATE_LIMITS: %v, ignoring", key, err)
+			continue
+		}
+		limits[key] = limit
+	}
+	return limits
+}
+
+// formatRateLimits formats limits for logs, e.g. "channel:sms=14/s, queue:exports=30/m"
+func formatRateLimits(limits map[string]RateLimit) string {
+	if len(limits) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(limits))
+	for key := range limits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + limits[key].String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// jobTokenBucket refills at limit.Count per limit.Per up to limit.Count tokens.
+// Tokens may go negative: each taker reserves its place and waits its turn.
+type jobTokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newJobTokenBucket(limit RateLimit, now time.Time) *jobTokenBucket {
+	return &jobTokenBucket{limit: limit, tokens: float64(limit.Count), last: now}
+}
+
+// take reserves a token and returns how long to wait before using it
+func (b *jobTokenBucket) take(now time.Time) time.Duration {
+	perSecond := float64(b.limit.Count) / b.limit.Per.Seconds()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(b.limit.Count), b.tokens+elapsed.Seconds()*perSecond)
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / perSecond * float64(time.Second))
+}
+
+// giveBack returns a reserved token that won't be used
+func (b *jobTokenBucket) giveBack() {
+	b.tokens++
+}
+
+// JobRateLimitStats are cumulative counters since startup
+type JobRateLimitStats struct {
+	Waited  int64 // jobs or calls that waited for a token
+	Snoozed int64 // jobs snoozed because the wait was too long
+}
+
+// JobRateLimiter is River worker middleware enforcing JOB_RATE_LIMITS
+type JobRateLimiter struct {
+	river.MiddlewareDefaults
+
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[string]*jobTokenBucket
+	stats   JobRateLimitStats
+	now     func() time.Time
+}
+
+// NewJobRateLimiter creates a limiter enforcing limits
+func NewJobRateLimiter(limits map[string]RateLimit) *JobRateLimiter {
+	return &JobRateLimiter{
+		limits:  limits,
+		buckets: make(map[string]*jobTokenBucket),
+		now:     time.Now,
+	}
+}
+
+// SetLimits replaces the limits (SIGHUP reload). Buckets of changed or
+// removed limits start over.
+func (l *JobRateLimiter) SetLimits(limits map[string]RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, bucket := range l.buckets {
+		if limits[key] != bucket.limit {
+			delete(l.buckets, key)
+		}
+	}
+	l.limits = limits
+}
+
+// Limits returns a copy of the current limits
+func (l *JobRateLimiter) Limits() map[string]RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limits := make(map[string]RateLimit, len(l.limits))
+	for key, limit := range l.limits {
+		limits[key] = limit
+	}
+	return limits
+}
+
+// reserve takes a token for key and returns the wait before using it. When
+// the wait is longer than maxWait the token is given back and ok is false.
+func (l *JobRateLimiter) reserve(key string, maxWait time.Duration) (wait time.Duration, ok bool) {
+	wait, _, ok = l.reserveAll([]string{key}, maxWait)
+	return wait, ok
+}
+
+// reserveAll takes a token for each of keys and returns the longest wait and
+// the key it is for. When that wait is longer than maxWait every token is
+// given back and ok is false, so a job snoozed by one limit doesn't use up
+// the others.
+func (l *JobRateLimiter) reserveAll(keys []string, maxWait time.Duration) (wait time.Duration, key string, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var taken []*jobTokenBucket
+	for _, k := range keys {
+		limit, limited := l.limits[k]
+		if !limited {
+			continue
+		}
+		bucket := l.buckets[k]
+		if bucket == nil {
+			bucket = newJobTokenBucket(limit, now)
+			l.buckets[k] = bucket
+		}
+		if w := bucket.take(now); w > wait {
+			wait, key = w, k
+		}
+		taken = append(taken, bucket)
+	}
+	if wait > maxWait {
+		for _, bucket := range taken {
+			bucket.giveBack()
+		}
+		l.stats.Snoozed++
+		return wait, key, false
+	}
+	if wait > 0 {
+		l.stats.Waited++
+	}
+	return wait, key, true
+}
+
+// Wait blocks until key's limit allows one more operation or ctx ends. On a
+// nil *JobRateLimiter it returns at once.
+func (l *JobRateLimiter) Wait(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	wait, _ := l.reserve(key, time.Duration(1<<63-1))
+	if wait <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, wait)
+}
+
+// Work implements rivertype.WorkerMiddleware. The kind and queue limits are
+// reserved together: the job waits for the later of the two, or is snoozed
+// holding neither.
+func (l *JobRateLimiter) Work(ctx context.Context, job *rivertype.JobRow, doInner func(context.Context) error) error {
+	wait, key, ok := l.reserveAll([]string{job.Kind, "queue:" + job.Queue}, jobRateLimitMaxWait)
+	if !ok {
+		log.Printf("[Job %d] Rate limit %s reached, snoozing %s for %s", job.ID, key, job.Kind, wait.Round(time.Second))
+		return river.JobSnooze(wait)
+	}
+	if wait > 0 {
+		if wait >= jobRateLimitLogWait {
+			log.Printf("[Job %d] Rate limit %s reached, waiting %s", job.ID, key, wait.Round(100*time.Millisecond))
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+	return doInner(ctx)
+}
+
+// Stats returns a snapshot of the limiter's counters
+func (l *JobRateLimiter) Stats() JobRateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// String formats the stats for logs
+func (s JobRateLimitStats) String() string {
+	return fmt.Sprintf("waited=%d snoozed=%d", s.Waited, s.Snoozed)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RateLimit
+		wantErr bool
+	}{
+		{"14/s", RateLimit{Count: 14, Per: time.Second}, false},
+		{"30/m", RateLimit{Count: 30, Per: time.Minute}, false},
+		{" 500 / h ", RateLimit{Count: 500, Per: time.Hour}, false},
+		{"10", RateLimit{Count: 10, Per: time.Second}, false},
+		{"0/s", RateLimit{}, true},
+		{"-1/s", RateLimit{}, true},
+		{"ten/s", RateLimit{}, true},
+		{"5/d", RateLimit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRateLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRateLimit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRateLimit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if err == nil && got.String() != tt.want.String() {
+			t.Errorf("String() = %q", got.String())
+		}
+	}
+}
+
+func TestJobRateLimitsFromEnv(t *testing.T) {
+	t.Setenv("JOB_RATE_LIMITS", "channel:sms=14/s,queue:exports=30/m,bad=fast")
+	limits := jobRateLimitsFromEnv()
+	if got := formatRateLimits(limits); got != "channel:sms=14/s, queue:exports=30/m" {
+		t.Errorf("limits = %s", got)
+	}
+}
+
+func TestJobTokenBucket_BurstThenRate(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newJobTokenBucket(RateLimit{Count: 2, Per: time.Second}, start)
+
+	// The burst is free, then each taker queues half a second behind the last
+	waits := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, want := range waits {
+		if got := b.take(start); got != want {
+			t.Errorf("take %d: wait = %v, want %v", i, got, want)
+		}
+	}
+
+	// A second later two tokens have refilled the two reservations
+	if got := b.take(start.Add(time.Second)); got != 500*time.Millisecond {
+		t.Errorf("take after refill: wait = %v, want 500ms", got)
+	}
+
+	// Idle time refills only up to the burst
+	if got := b.take(start.Add(time.Hour)); got != 0 {
+		t.Errorf("take after idle: wait = %v, want 0", got)
+	}
+	if got := b.take(start.Add(time.Hour)); got != 0 {
+		t.Errorf("second take after idle: wait = %v, want 0", got)
+	}
+	if got := b.take(start.Add(time.Hour)); got == 0 {
+		t.Error("third take after idle should wait: the burst is 2")
+	}
+}
+
+func TestJobRateLimiter_WorkWaitsThenSnoozes(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewJobRateLimiter(map[string]RateLimit{"entity_webhook_delivery": {Count: 1, Per: 4 * time.Second}})
+	l.now = func() time.Time { return now }
+
+	ran := 0
+	work := func(context.Context) error { ran++; return nil }
+	job := &rivertype.JobRow{ID: 1, Kind: "entity_webhook_delivery", Queue: "webhooks"}
+	ctx := context.Background()
+
+	if err := l.Work(ctx, job, work); err != nil || ran != 1 {
+		t.Fatalf("first job: err = %v, ran = %d", err, ran)
+	}
+
+	// The next token is 4s away (within jobRateLimitMaxWait), but the clock
+	// is frozen; cancel the context so the wait returns at once
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.Work(cancelled, job, work); !errors.Is(err, context.Canceled) || ran != 1 {
+		t.Fatalf("waiting job: err = %v, ran = %d, want context.Canceled without running", err, ran)
+	}
+
+	// Two reservations deep the wait is 8s; three deep it is past the max
+	l.reserve("entity_webhook_delivery", jobRateLimitMaxWait)
+	var snooze *river.JobSnoozeError
+	if err := l.Work(ctx, job, work); !errors.As(err, &snooze) || snooze.Duration <= jobRateLimitMaxWait {
+		t.Fatalf("expected a snooze longer than %s, got %v", jobRateLimitMaxWait, err)
+	}
+	if stats := l.Stats(); stats.Snoozed != 1 || stats.Waited != 2 {
+		t.Errorf("stats = %s, want waited=2 snoozed=1", stats)
+	}
+
+	// Unlimited kinds pass straight through
+	other := &rivertype.JobRow{ID: 2, Kind: "send_email", Queue: "notifications"}
+	if err := l.Work(ctx, other, work); err != nil || ran != 2 {
+		t.Errorf("unlimited job: err = %v, ran = %d", err, ran)
+	}
+}
+
+func TestJobRateLimiter_QueueLimit(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewJobRateLimiter(map[string]RateLimit{"queue:exports": {Count: 1, Per: time.Hour}})
+	l.now = func() time.Time { return now }
+
+	work := func(context.Context) error { return nil }
+	ctx := context.Background()
+	if err := l.Work(ctx, &rivertype.JobRow{ID: 1, Kind: "export_generate", Queue: "exports"}, work); err != nil {
+		t.Fatalf("first job: %v", err)
+	}
+	var snooze *river.JobSnoozeError
+	if err := l.Work(ctx, &rivertype.JobRow{ID: 2, Kind: "other_export", Queue: "exports"}, work); !errors.As(err, &snooze) {
+		t.Errorf("second job in the queue: err = %v, want snooze", err)
+	}
+}
+
+func TestJobRateLimiter_SnoozeGivesBackOtherTokens(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewJobRateLimiter(map[string]RateLimit{
+		"entity_webhook_delivery": {Count: 2, Per: time.Hour},
+		"queue:webhooks":          {Count: 1, Per: time.Hour},
+	})
+	l.now = func() time.Time { return now }
+
+	work := func(context.Context) error { return nil }
+	ctx := context.Background()
+	if err := l.Work(ctx, &rivertype.JobRow{ID: 1, Kind: "other_webhook", Queue: "webhooks"}, work); err != nil {
+		t.Fatalf("first job: %v", err)
+	}
+
+	// The queue is exhausted and the kind is not: each snooze must hand the
+	// kind's token back instead of draining it
+	job := &rivertype.JobRow{ID: 2, Kind: "entity_webhook_delivery", Queue: "webhooks"}
+	var snooze *river.JobSnoozeError
+	for i := 0; i < 3; i++ {
+		if err := l.Work(ctx, job, work); !errors.As(err, &snooze) || snooze.Duration != time.Hour {
+			t.Fatalf("snooze %d: err = %v, want a 1h snooze for the queue", i, err)
+		}
+	}
+	if wait, ok := l.reserve("entity_webhook_delivery", 0); wait != 0 || !ok {
+		t.Errorf("kind bucket drained by snoozed jobs: wait = %s", wait)
+	}
+}
+
+func TestJobRateLimiter_SetLimitsResetsChangedBuckets(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewJobRateLimiter(map[string]RateLimit{
+		"a": {Count: 1, Per: time.Hour},
+		"b": {Count: 1, Per: time.Hour},
+	})
+	l.now = func() time.Time { return now }
+	l.reserve("a", time.Hour)
+	l.reserve("b", time.Hour)
+
+	l.SetLimits(map[string]RateLimit{
+		"a": {Count: 1, Per: time.Hour},
+		"b": {Count: 5, Per: time.Hour},
+	})
+	if wait, _ := l.reserve("a", time.Hour); wait == 0 {
+		t.Error("unchanged limit a should keep its empty bucket")
+	}
+	if wait, _ := l.reserve("b", time.Hour); wait != 0 {
+		t.Errorf("changed limit b should start with a full bucket, wait = %v", wait)
+	}
+
+	l.SetLimits(map[string]RateLimit{})
+	if wait, ok := l.reserve("a", 0); wait != 0 || !ok {
+		t.Errorf("removed limit a: wait = %v, ok = %v", wait, ok)
+	}
+}
+
+func TestJobRateLimiter_WaitNil(t *testing.T) {
+	var l *JobRateLimiter
+	if err := l.Wait(context.Background(), "channel:sms"); err != nil {
+		t.Errorf("nil limiter Wait() = %v", err)
+	}
+}
@@ -1,30 +1,77 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Retry policy for Admin API calls. 429 and 503 mean Keycloak didn't process
+// the request, so every method is retried; 502, 504 and network errors may
+// hide a processed request, so only idempotent methods are. A Retry-After
+// longer than keycloakMaxRetryAfter fails the call and leaves the wait to
+// River's job retry.
+const (
+	keycloakMaxAttempts    = 4
+	keycloakBaseBackoff    = 500 * time.Millisecond
+	keycloakMaxBackoff     = 8 * time.Second
+	keycloakMaxRetryAfter  = 30 * time.Second
+	keycloakAuthTimeout    = 30 * time.Second
+	keycloakTokenAuthGroup = "token"
 )
 
-// KeycloakClient wraps the Keycloak Admin REST API
+// KeycloakClient wraps the Keycloak Admin REST API for one realm. A client
+// set up with ServeRealms also hands out clients for other realms through
+// ForRealm; they share its service account token but cache their own roles
+// and groups, since IDs differ between realms.
 type KeycloakClient struct {
-	baseURL      string
-	realm        string
+	baseURL    string
+	realm      string // the realm administered
+	httpClient *http.Client
+	session    *keycloakSession
+
+	mu     sync.RWMutex
+	roles  map[string]string // role name -> role ID cache
+	groups map[string]string // top-level group name -> group ID cache
+
+	// served is set by ServeRealms and shared by the clients of all realms
+	served *keycloakRealms
+	// sleep waits between retries; tests replace it
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// keycloakSession is the service account's token
+type keycloakSession struct {
+	authRealm    string // realm the service account authenticates in
 	clientID     string
 	clientSecret string
-	httpClient   *http.Client
 
 	mu          sync.RWMutex
 	token       *tokenResponse
 	tokenExpiry time.Time
-	roles       map[string]string // role name -> role ID cache
+
+	// auth collapses concurrent token requests into one
+	auth singleflight.Group
+}
+
+// keycloakRealms is the set of realms a client serves
+type keycloakRealms struct {
+	defaultRealm string
+	names        []string // default first, then in configured order
+	clients      map[string]*KeycloakClient
 }
 
 type tokenResponse struct {
@@ -33,43 +80,133 @@ type tokenResponse struct {
 	TokenType   string `json:"token_type"`
 }
 
-// KeycloakUser represents a user in Keycloak
-type KeycloakUser struct {
-	ID            string              `json:"id"`
-	Username      string              `json:"username"`
-	Email         string              `json:"email"`
-	FirstName     string              `json:"firstName"`
-	LastName      string              `json:"lastName"`
-	Enabled       bool                `json:"enabled"`
-	EmailVerified bool                `json:"emailVerified"`
-	Attributes    map[string][]string `json:"attributes,omitempty"`
+type keycloakRole struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
 }
 
-type keycloakRole struct {
+type keycloakGroup struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
+	Path string `json:"path"`
 }
 
 // NewKeycloakClient creates a new Keycloak Admin API client
 func NewKeycloakClient(baseURL, realm, clientID, clientSecret string) *KeycloakClient {
 	return &KeycloakClient{
-		baseURL:      strings.TrimRight(baseURL, "/"),
-		realm:        realm,
-		clientID:     clientID,
-		clientSecret: clientSecret,
-		httpClient:   &http.Client{Timeout: 30 * time.Second},
-		roles:        make(map[string]string),
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		realm:      realm,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: newTracingTransport(nil, "keycloak")},
+		session: &keycloakSession{
+			authRealm:    realm,
+			clientID:     clientID,
+			clientSecret: clientSecret,
+		},
+		roles:  make(map[string]string),
+		groups: make(map[string]string),
+		sleep:  sleepContext,
+	}
+}
+
+// ServeRealms makes the client administer realms besides its own, with the
+// service account of authRealm ("" keeps the client's own realm, whose
+// service account then needs admin roles in the others). Call it before the
+// client is used.
+func (kc *KeycloakClient) ServeRealms(authRealm string, realms []string) {
+	if authRealm != "" {
+		kc.session.authRealm = authRealm
+	}
+	served := &keycloakRealms{
+		defaultRealm: kc.realm,
+		names:        []string{kc.realm},
+		clients:      map[string]*KeycloakClient{kc.realm: kc},
+	}
+	for _, realm := range realms {
+		realm = strings.TrimSpace(realm)
+		if realm == "" || served.clients[realm] != nil {
+			continue
+		}
+		served.names = append(served.names, realm)
+		served.clients[realm] = &KeycloakClient{
+			baseURL:    kc.baseURL,
+			realm:      realm,
+			httpClient: kc.httpClient,
+			session:    kc.session,
+			roles:      make(map[string]string),
+			groups:     make(map[string]string),
+			served:     served,
+			sleep:      kc.sleep,
+		}
+	}
+	kc.served = served
+}
+
+// Realms lists the realms served, the default one first
+func (kc *KeycloakClient) Realms() []string {
+	if kc.served == nil {
+		return []string{kc.realm}
+	}
+	return slices.Clone(kc.served.names)
+}
+
+// ForRealm returns the client for realm; "" is the default realm
+func (kc *KeycloakClient) ForRealm(realm string) (IdentityProvider, error) {
+	if kc.served == nil {
+		if realm == "" || realm == kc.realm {
+			return kc, nil
+		}
+		return nil, fmt.Errorf("realm %q %w", realm, errIdentityRealmNotServed)
+	}
+	if realm == "" {
+		realm = kc.served.defaultRealm
+	}
+	if client := kc.served.clients[realm]; client != nil {
+		return client, nil
+	}
+	return nil, fmt.Errorf("realm %q %w", realm, errIdentityRealmNotServed)
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
 }
 
+// Name identifies the provider
+func (kc *KeycloakClient) Name() string { return "keycloak" }
+
+// Ping checks that a service account token can be obtained
+func (kc *KeycloakClient) Ping(ctx context.Context) error {
+	_, err := kc.ensureValidToken(ctx)
+	return err
+}
+
+// SetClientSecret swaps in a rotated client secret (see secrets.go). The
+// current token stays valid; the new secret is used for the next one.
+func (kc *KeycloakClient) SetClientSecret(secret string) {
+	kc.session.mu.Lock()
+	kc.session.clientSecret = secret
+	kc.session.mu.Unlock()
+}
+
 // authenticate obtains a token via client_credentials grant
 func (kc *KeycloakClient) authenticate(ctx context.Context) error {
-	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", kc.baseURL, kc.realm)
+	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", kc.baseURL, kc.session.authRealm)
+
+	kc.session.mu.RLock()
+	clientSecret := kc.session.clientSecret
+	kc.session.mu.RUnlock()
 
 	data := url.Values{
 		"grant_type":    {"client_credentials"},
-		"client_id":     {kc.clientID},
-		"client_secret": {kc.clientSecret},
+		"client_id":     {kc.session.clientID},
+		"client_secret": {clientSecret},
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
@@ -94,46 +231,191 @@ func (kc *KeycloakClient) authenticate(ctx context.Context) error {
 		return fmt.Errorf("failed to decode token response: %w", err)
 	}
 
-	kc.mu.Lock()
-	kc.token = &token
+	kc.session.mu.Lock()
+	kc.session.token = &token
 	// Refresh 30 seconds before expiry
-	kc.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn-30) * time.Second)
-	kc.mu.Unlock()
+	kc.session.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn-30) * time.Second)
+	kc.session.mu.Unlock()
 
 	return nil
 }
 
-// ensureValidToken refreshes the token if expired
-func (kc *KeycloakClient) ensureValidToken(ctx context.Context) error {
-	kc.mu.RLock()
-	valid := kc.token != nil && time.Now().Before(kc.tokenExpiry)
-	kc.mu.RUnlock()
+// validToken returns the cached access token, or "" if it has expired
+func (kc *KeycloakClient) validToken() string {
+	kc.session.mu.RLock()
+	defer kc.session.mu.RUnlock()
+	if kc.session.token == nil || !time.Now().Before(kc.session.tokenExpiry) {
+		return ""
+	}
+	return kc.session.token.AccessToken
+}
 
-	if valid {
-		return nil
+// ensureValidToken returns a valid access token, fetching a new one if the
+// cached one expired. Concurrent callers share one token request, which
+// runs detached from any single caller's cancellation.
+func (kc *KeycloakClient) ensureValidToken(ctx context.Context) (string, error) {
+	if token := kc.validToken(); token != "" {
+		return token, nil
 	}
 
-	return kc.authenticate(ctx)
+	result := kc.session.auth.DoChan(keycloakTokenAuthGroup, func() (interface{}, error) {
+		// Another caller may have refreshed it while this one waited
+		if token := kc.validToken(); token != "" {
+			return token, nil
+		}
+		authCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), keycloakAuthTimeout)
+		defer cancel()
+		if err := kc.authenticate(authCtx); err != nil {
+			return "", err
+		}
+		// Not validToken(): a token issued for 30s or less is already "expired"
+		kc.session.mu.RLock()
+		defer kc.session.mu.RUnlock()
+		if kc.session.token == nil {
+			return "", fmt.Errorf("token was invalidated during authentication")
+		}
+		return kc.session.token.AccessToken, nil
+	})
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-result:
+		if r.Err != nil {
+			return "", r.Err
+		}
+		return r.Val.(string), nil
+	}
 }
 
-// doRequest performs an authenticated HTTP request
-func (kc *KeycloakClient) doRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
-	if err := kc.ensureValidToken(ctx); err != nil {
-		return nil, fmt.Errorf("authentication failed: %w", err)
+// invalidateToken drops the cached token if it is still the rejected one,
+// so a 401 seen by many requests triggers a single re-authentication
+func (kc *KeycloakClient) invalidateToken(rejected string) {
+	kc.session.mu.Lock()
+	if kc.session.token != nil && kc.session.token.AccessToken == rejected {
+		kc.session.token = nil
 	}
+	kc.session.mu.Unlock()
+}
 
+// doRequest performs an authenticated HTTP request with the retry policy
+// above. A 401 drops the token and retries once with a fresh one, for tokens
+// revoked before they expired.
+func (kc *KeycloakClient) doRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
 	reqURL := fmt.Sprintf("%s/admin/realms/%s%s", kc.baseURL, kc.realm, path)
-	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	idempotent := method != http.MethodPost
+
+	reauthenticated := false
+	for attempt := 1; ; attempt++ {
+		token, err := kc.ensureValidToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+
+		var reqBody io.Reader
+		if payload != nil {
+			reqBody = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := kc.httpClient.Do(req)
+		if err != nil {
+			if !idempotent || attempt >= keycloakMaxAttempts || ctx.Err() != nil {
+				return nil, err
+			}
+			log.Printf("[Keycloak] %s %s failed (attempt %d/%d), retrying: %v", method, path, attempt, keycloakMaxAttempts, err)
+			if err := kc.sleep(ctx, keycloakBackoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !reauthenticated {
+			reauthenticated = true
+			drainAndClose(resp)
+			kc.invalidateToken(token)
+			log.Printf("[Keycloak] %s %s returned 401, re-authenticating", method, path)
+			attempt-- // a re-auth doesn't use up an attempt
+			continue
+		}
+
+		if !keycloakRetryable(resp.StatusCode, idempotent) || attempt >= keycloakMaxAttempts {
+			return resp, nil
+		}
+		wait := keycloakBackoff(attempt)
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if retryAfter > keycloakMaxRetryAfter {
+				return resp, nil
+			}
+			wait = retryAfter
+		}
+		drainAndClose(resp)
+		log.Printf("[Keycloak] %s %s returned %d (attempt %d/%d), retrying in %s",
+			method, path, resp.StatusCode, attempt, keycloakMaxAttempts, wait)
+		if err := kc.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	kc.mu.RLock()
-	req.Header.Set("Authorization", "Bearer "+kc.token.AccessToken)
-	kc.mu.RUnlock()
-	req.Header.Set("Content-Type", "application/json")
+// keycloakRetryable reports whether a response status is worth retrying
+func keycloakRetryable(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
 
-	return kc.httpClient.Do(req)
+// keycloakBackoff is the wait after a failed attempt: 0.5s, 1s, 2s, ...
+// capped at keycloakMaxBackoff
+func keycloakBackoff(attempt int) time.Duration {
+	wait := keycloakBaseBackoff << (attempt - 1)
+	if wait <= 0 || wait > keycloakMaxBackoff {
+		return keycloakMaxBackoff
+	}
+	return wait
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// drainAndClose discards a response that is about to be retried, so the
+// connection can be reused
+func drainAndClose(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
 }
 
 // CreateUser creates a user in Keycloak and returns the UUID
@@ -184,7 +466,7 @@ func (kc *KeycloakClient) CreateUser(ctx context.Context, email, firstName, last
 }
 
 // GetUserByEmail finds a user by email (for idempotency checks)
-func (kc *KeycloakClient) GetUserByEmail(ctx context.Context, email string) (*KeycloakUser, error) {
+func (kc *KeycloakClient) GetUserByEmail(ctx context.Context, email string) (*IdentityUser, error) {
 	path := fmt.Sprintf("/users?email=%s&exact=true", url.QueryEscape(email))
 	resp, err := kc.doRequest(ctx, "GET", path, nil)
 	if err != nil {
@@ -197,7 +479,7 @@ func (kc *KeycloakClient) GetUserByEmail(ctx context.Context, email string) (*Ke
 		return nil, fmt.Errorf("search user returned %d: %s", resp.StatusCode, string(body))
 	}
 
-	var users []KeycloakUser
+	var users []IdentityUser
 	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
 		return nil, fmt.Errorf("failed to decode user search: %w", err)
 	}
@@ -210,7 +492,7 @@ func (kc *KeycloakClient) GetUserByEmail(ctx context.Context, email string) (*Ke
 }
 
 // GetUserByID fetches a user by their Keycloak UUID
-func (kc *KeycloakClient) GetUserByID(ctx context.Context, userID string) (*KeycloakUser, error) {
+func (kc *KeycloakClient) GetUserByID(ctx context.Context, userID string) (*IdentityUser, error) {
 	path := fmt.Sprintf("/users/%s", userID)
 	resp, err := kc.doRequest(ctx, "GET", path, nil)
 	if err != nil {
@@ -219,7 +501,7 @@ func (kc *KeycloakClient) GetUserByID(ctx context.Context, userID string) (*Keyc
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("user %s not found in Keycloak", userID)
+		return nil, fmt.Errorf("user %s %w", userID, errIdentityUserNotFound)
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -227,7 +509,7 @@ func (kc *KeycloakClient) GetUserByID(ctx context.Context, userID string) (*Keyc
 		return nil, fmt.Errorf("get user returned %d: %s", resp.StatusCode, string(body))
 	}
 
-	var user KeycloakUser
+	var user IdentityUser
 	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
 		return nil, fmt.Errorf("failed to decode user response: %w", err)
 	}
@@ -235,6 +517,69 @@ func (kc *KeycloakClient) GetUserByID(ctx context.Context, userID string) (*Keyc
 	return &user, nil
 }
 
+// ListUsers returns one page of realm users ordered by username, starting at
+// offset first. A page shorter than max is the last one.
+func (kc *KeycloakClient) ListUsers(ctx context.Context, first, max int) ([]IdentityUser, error) {
+	path := fmt.Sprintf("/users?first=%d&max=%d&briefRepresentation=false", first, max)
+	resp, err := kc.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("list users request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list users returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var users []IdentityUser
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return nil, fmt.Errorf("failed to decode user list: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetUserRoles returns the names of a user's effective realm roles,
+// including roles granted through composites and groups (what the JWT carries)
+func (kc *KeycloakClient) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	return kc.getUserRoleNames(ctx, userID, fmt.Sprintf("/users/%s/role-mappings/realm/composite", userID))
+}
+
+// GetUserDirectRoles returns the names of the realm roles mapped to the
+// user directly, the ones RemoveRoles can take away
+func (kc *KeycloakClient) GetUserDirectRoles(ctx context.Context, userID string) ([]string, error) {
+	return kc.getUserRoleNames(ctx, userID, fmt.Sprintf("/users/%s/role-mappings/realm", userID))
+}
+
+func (kc *KeycloakClient) getUserRoleNames(ctx context.Context, userID, path string) ([]string, error) {
+	resp, err := kc.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get user roles request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("user %s %w", userID, errIdentityUserNotFound)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("get user roles returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var roles []keycloakRole
+	if err := json.NewDecoder(resp.Body).Decode(&roles); err != nil {
+		return nil, fmt.Errorf("failed to decode user roles: %w", err)
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, r.Name)
+	}
+	return names, nil
+}
+
 // loadRoles fetches all realm roles and caches name->ID mapping
 func (kc *KeycloakClient) loadRoles(ctx context.Context) error {
 	resp, err := kc.doRequest(ctx, "GET", "/roles", nil)
@@ -288,8 +633,8 @@ func (kc *KeycloakClient) getRoleID(ctx context.Context, roleName string) (strin
 	return id, nil
 }
 
-// AssignRealmRoles assigns realm roles to a user
-func (kc *KeycloakClient) AssignRealmRoles(ctx context.Context, userID string, roleNames []string) error {
+// AssignRoles assigns realm roles to a user
+func (kc *KeycloakClient) AssignRoles(ctx context.Context, userID string, roleNames []string) error {
 	var roles []keycloakRole
 	for _, name := range roleNames {
 		id, err := kc.getRoleID(ctx, name)
@@ -319,8 +664,8 @@ func (kc *KeycloakClient) AssignRealmRoles(ctx context.Context, userID string, r
 	return nil
 }
 
-// RemoveRealmRoles removes realm roles from a user
-func (kc *KeycloakClient) RemoveRealmRoles(ctx context.Context, userID string, roleNames []string) error {
+// RemoveRoles removes realm roles from a user
+func (kc *KeycloakClient) RemoveRoles(ctx context.Context, userID string, roleNames []string) error {
 	var roles []keycloakRole
 	for _, name := range roleNames {
 		id, err := kc.getRoleID(ctx, name)
@@ -439,8 +784,64 @@ func (kc *KeycloakClient) DisableUser(ctx context.Context, userID string) error
 	return nil
 }
 
-// CreateRealmRole creates a new realm role in Keycloak
-func (kc *KeycloakClient) CreateRealmRole(ctx context.Context, name, description string) error {
+// AnonymizeUser disables a Keycloak user and clears their email, names and
+// attributes. The username is kept: Keycloak may not allow changing it.
+func (kc *KeycloakClient) AnonymizeUser(ctx context.Context, userID string) error {
+	current, err := kc.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("fetch current user for anonymize failed: %w", err)
+	}
+
+	payload := map[string]interface{}{
+		"username":      current.Username,
+		"email":         "",
+		"firstName":     "",
+		"lastName":      "",
+		"enabled":       false,
+		"emailVerified": false,
+		"attributes":    map[string][]string{},
+	}
+
+	payloadBytes, _ := json.Marshal(payload)
+
+	path := fmt.Sprintf("/users/%s", userID)
+	resp, err := kc.doRequest(ctx, "PUT", path, strings.NewReader(string(payloadBytes)))
+	if err != nil {
+		return fmt.Errorf("anonymize user request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("anonymize user returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// LogoutUser ends all of a user's Keycloak sessions
+func (kc *KeycloakClient) LogoutUser(ctx context.Context, userID string) error {
+	path := fmt.Sprintf("/users/%s/logout", userID)
+	resp, err := kc.doRequest(ctx, "POST", path, nil)
+	if err != nil {
+		return fmt.Errorf("logout user request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("user %s %w", userID, errIdentityUserNotFound)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("logout user returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// CreateRole creates a new realm role in Keycloak
+func (kc *KeycloakClient) CreateRole(ctx context.Context, name, description string) error {
 	payload := map[string]string{
 		"name":        name,
 		"description": description,
@@ -471,8 +872,8 @@ func (kc *KeycloakClient) CreateRealmRole(ctx context.Context, name, description
 	return nil
 }
 
-// DeleteRealmRole deletes a realm role from Keycloak
-func (kc *KeycloakClient) DeleteRealmRole(ctx context.Context, name string) error {
+// DeleteRole deletes a realm role from Keycloak
+func (kc *KeycloakClient) DeleteRole(ctx context.Context, name string) error {
 	path := fmt.Sprintf("/roles/%s", url.PathEscape(name))
 	resp, err := kc.doRequest(ctx, "DELETE", path, nil)
 	if err != nil {
@@ -497,3 +898,147 @@ func (kc *KeycloakClient) DeleteRealmRole(ctx context.Context, name string) erro
 
 	return nil
 }
+
+// getGroupID returns the ID of the top-level group with the given name,
+// looking it up by exact name on a cache miss
+func (kc *KeycloakClient) getGroupID(ctx context.Context, name string) (string, error) {
+	kc.mu.RLock()
+	id, ok := kc.groups[name]
+	kc.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	query := url.Values{}
+	query.Set("search", name)
+	query.Set("exact", "true")
+	query.Set("briefRepresentation", "true")
+	resp, err := kc.doRequest(ctx, "GET", "/groups?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("fetch groups request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("fetch groups returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var groups []keycloakGroup
+	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+		return "", fmt.Errorf("failed to decode groups: %w", err)
+	}
+
+	// search also matches subgroups; only a top-level group has path /name
+	for _, g := range groups {
+		if g.Name == name && (g.Path == "" || g.Path == "/"+name) {
+			kc.mu.Lock()
+			kc.groups[name] = g.ID
+			kc.mu.Unlock()
+			return g.ID, nil
+		}
+	}
+	return "", fmt.Errorf("'%s': %w", name, errIdentityGroupNotFound)
+}
+
+// CreateGroup creates a top-level group in Keycloak, keeping the description
+// in its attributes
+func (kc *KeycloakClient) CreateGroup(ctx context.Context, name, description string) error {
+	payload := map[string]interface{}{
+		"name": name,
+	}
+	if description != "" {
+		payload["attributes"] = map[string][]string{"description": {description}}
+	}
+	payloadBytes, _ := json.Marshal(payload)
+
+	resp, err := kc.doRequest(ctx, "POST", "/groups", strings.NewReader(string(payloadBytes)))
+	if err != nil {
+		return fmt.Errorf("create group request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		log.Printf("[Keycloak] Group '%s' already exists (idempotent)", name)
+		return nil // Idempotent
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("create group returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// DeleteGroup deletes a top-level group from Keycloak
+func (kc *KeycloakClient) DeleteGroup(ctx context.Context, name string) error {
+	id, err := kc.getGroupID(ctx, name)
+	if errors.Is(err, errIdentityGroupNotFound) {
+		log.Printf("[Keycloak] Group '%s' not found (already deleted)", name)
+		return nil // Idempotent
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := kc.doRequest(ctx, "DELETE", "/groups/"+url.PathEscape(id), nil)
+	if err != nil {
+		return fmt.Errorf("delete group request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Invalidate group cache
+	kc.mu.Lock()
+	delete(kc.groups, name)
+	kc.mu.Unlock()
+
+	if resp.StatusCode == http.StatusNotFound {
+		log.Printf("[Keycloak] Group '%s' not found (already deleted)", name)
+		return nil // Idempotent
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete group returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// AddUserToGroup makes a user a member of a top-level group
+func (kc *KeycloakClient) AddUserToGroup(ctx context.Context, userID, groupName string) error {
+	return kc.setGroupMembership(ctx, "PUT", userID, groupName)
+}
+
+// RemoveUserFromGroup ends a user's membership of a top-level group
+func (kc *KeycloakClient) RemoveUserFromGroup(ctx context.Context, userID, groupName string) error {
+	return kc.setGroupMembership(ctx, "DELETE", userID, groupName)
+}
+
+func (kc *KeycloakClient) setGroupMembership(ctx context.Context, method, userID, groupName string) error {
+	groupID, err := kc.getGroupID(ctx, groupName)
+	if err != nil {
+		return fmt.Errorf("group lookup failed: %w", err)
+	}
+
+	path := fmt.Sprintf("/users/%s/groups/%s", userID, url.PathEscape(groupID))
+	resp, err := kc.doRequest(ctx, method, path, nil)
+	if err != nil {
+		return fmt.Errorf("group membership request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusNotFound {
+			// The cached group may have been deleted and recreated in Keycloak
+			kc.mu.Lock()
+			delete(kc.groups, groupName)
+			kc.mu.Unlock()
+		}
+		return fmt.Errorf("group membership returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
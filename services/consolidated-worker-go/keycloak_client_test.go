@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestKeycloak serves the token endpoint (counting calls and issuing
+// token-1, token-2, ...) and hands admin API requests to admin
+func newTestKeycloak(t *testing.T, admin http.HandlerFunc) (*KeycloakClient, *atomic.Int32, *[]time.Duration) {
+	t.Helper()
+	var tokenCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/protocol/openid-connect/token") {
+			n := tokenCalls.Add(1)
+			time.Sleep(20 * time.Millisecond) // long enough for concurrent callers to pile up
+			fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":300,"token_type":"Bearer"}`, n)
+			return
+		}
+		admin(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	kc := NewKeycloakClient(server.URL, "test-realm", "test-client", "test-secret")
+	var mu sync.Mutex
+	var waits []time.Duration
+	kc.sleep = func(ctx context.Context, d time.Duration) error {
+		mu.Lock()
+		waits = append(waits, d)
+		mu.Unlock()
+		return nil
+	}
+	return kc, &tokenCalls, &waits
+}
+
+func TestKeycloakClient_ConcurrentCallsShareOneTokenRequest(t *testing.T) {
+	kc, tokenCalls, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := kc.doRequest(context.Background(), http.MethodGet, "/roles", nil)
+			if err != nil {
+				t.Errorf("doRequest: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if got := tokenCalls.Load(); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+}
+
+func TestKeycloakClient_ReauthenticatesOnceOn401(t *testing.T) {
+	var seen []string
+	kc, tokenCalls, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized) // revoked before expiry
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+
+	resp, err := kc.doRequest(context.Background(), http.MethodGet, "/roles", nil)
+	if err != nil {
+		t.Fatalf("doRequest: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if want := []string{"Bearer token-1", "Bearer token-2"}; strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("Authorization headers = %v, want %v", seen, want)
+	}
+	if got := tokenCalls.Load(); got != 2 {
+		t.Errorf("token requests = %d, want 2", got)
+	}
+}
+
+func TestKeycloakClient_Persistent401IsReturned(t *testing.T) {
+	var calls atomic.Int32
+	kc, _, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	resp, err := kc.doRequest(context.Background(), http.MethodGet, "/roles", nil)
+	if err != nil {
+		t.Fatalf("doRequest: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || calls.Load() != 2 {
+		t.Errorf("status = %d after %d calls, want 401 after 2", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestKeycloakClient_RetriesRateLimitWithRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	kc, _, waits := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	resp, err := kc.doRequest(context.Background(), http.MethodPost, "/users", strings.NewReader(`{"username":"a"}`))
+	if err != nil {
+		t.Fatalf("doRequest: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("status = %d, want 201", resp.StatusCode)
+	}
+	if len(*waits) != 2 || (*waits)[0] != 2*time.Second || (*waits)[1] != 2*time.Second {
+		t.Errorf("waits = %v, want [2s 2s]", *waits)
+	}
+	for i, body := range bodies {
+		if body != `{"username":"a"}` {
+			t.Errorf("attempt %d body = %q, want the original payload", i+1, body)
+		}
+	}
+}
+
+func TestKeycloakClient_LongRetryAfterIsNotWaited(t *testing.T) {
+	kc, _, waits := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	resp, err := kc.doRequest(context.Background(), http.MethodGet, "/roles", nil)
+	if err != nil {
+		t.Fatalf("doRequest: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || len(*waits) != 0 {
+		t.Errorf("status = %d with waits %v, want 429 without waiting", resp.StatusCode, *waits)
+	}
+}
+
+func TestKeycloakClient_GatewayErrorsRetryOnlyIdempotentMethods(t *testing.T) {
+	var calls atomic.Int32
+	kc, _, waits := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	resp, err := kc.doRequest(context.Background(), http.MethodPost, "/users", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("doRequest: %v", err)
+	}
+	resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("POST attempts = %d, want 1 (a 502 may hide a created user)", calls.Load())
+	}
+
+	calls.Store(0)
+	resp, err = kc.doRequest(context.Background(), http.MethodGet, "/roles", nil)
+	if err != nil {
+		t.Fatalf("doRequest: %v", err)
+	}
+	resp.Body.Close()
+	if calls.Load() != keycloakMaxAttempts {
+		t.Errorf("GET attempts = %d, want %d", calls.Load(), keycloakMaxAttempts)
+	}
+	if want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}; fmt.Sprint(*waits) != fmt.Sprint(want) {
+		t.Errorf("waits = %v, want %v", *waits, want)
+	}
+}
+
+func TestKeycloakClient_ListUsersAndRealmRoles(t *testing.T) {
+	var paths []string
+	kc, _, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/users"):
+			w.Write([]byte(`[{"id":"u1","username":"jane","email":"jane@example.com","firstName":"Jane","enabled":true},
+				{"id":"u2","username":"service-account-civic-os","serviceAccountClientId":"civic-os"}]`))
+		case strings.HasSuffix(r.URL.Path, "/users/u1/role-mappings/realm/composite"):
+			w.Write([]byte(`[{"id":"r1","name":"editor"},{"id":"r2","name":"offline_access"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	users, err := kc.ListUsers(context.Background(), 200, 100)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(users) != 2 || users[0].Email != "jane@example.com" || users[1].ServiceAccountClientID != "civic-os" {
+		t.Errorf("users = %+v", users)
+	}
+	if want := "/admin/realms/test-realm/users?first=200&max=100&briefRepresentation=false"; paths[0] != want {
+		t.Errorf("list path = %s, want %s", paths[0], want)
+	}
+
+	roles, err := kc.GetUserRoles(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("GetUserRoles: %v", err)
+	}
+	if fmt.Sprint(roles) != "[editor offline_access]" {
+		t.Errorf("roles = %v", roles)
+	}
+
+	if _, err := kc.GetUserRoles(context.Background(), "missing"); !errors.Is(err, errIdentityUserNotFound) {
+		t.Errorf("GetUserRoles(missing) error = %v, want errIdentityUserNotFound", err)
+	}
+}
+
+func TestKeycloakClient_GroupMembership(t *testing.T) {
+	var calls []string
+	kc, _, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/groups"):
+			if r.URL.Query().Get("exact") != "true" {
+				t.Errorf("group search without exact=true: %s", r.URL.RawQuery)
+			}
+			if r.URL.Query().Get("search") == "public_works" {
+				// search also returns a subgroup with the same name
+				w.Write([]byte(`[{"id":"g-sub","name":"public_works","path":"/city/public_works"},
+					{"id":"g1","name":"public_works","path":"/public_works"}]`))
+				return
+			}
+			w.Write([]byte(`[]`))
+		case r.URL.Path == "/admin/realms/test-realm/users/u1/groups/g1":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	ctx := context.Background()
+
+	if err := kc.AddUserToGroup(ctx, "u1", "public_works"); err != nil {
+		t.Fatalf("AddUserToGroup: %v", err)
+	}
+	if err := kc.RemoveUserFromGroup(ctx, "u1", "public_works"); err != nil {
+		t.Fatalf("RemoveUserFromGroup: %v", err)
+	}
+	want := "[GET /admin/realms/test-realm/groups PUT /admin/realms/test-realm/users/u1/groups/g1 DELETE /admin/realms/test-realm/users/u1/groups/g1]"
+	if fmt.Sprint(calls) != want {
+		t.Errorf("calls = %v, want %s (group ID cached after the first lookup)", calls, want)
+	}
+
+	if err := kc.AddUserToGroup(ctx, "u1", "parks"); !errors.Is(err, errIdentityGroupNotFound) {
+		t.Errorf("AddUserToGroup(parks) error = %v, want errIdentityGroupNotFound", err)
+	}
+}
+
+func TestKeycloakClient_GroupCRUDIsIdempotent(t *testing.T) {
+	var created string
+	kc, _, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/groups"):
+			body, _ := io.ReadAll(r.Body)
+			created = string(body)
+			w.WriteHeader(http.StatusConflict)
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/groups"):
+			w.Write([]byte(`[]`))
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	ctx := context.Background()
+
+	if err := kc.CreateGroup(ctx, "public_works", "Public Works Department"); err != nil {
+		t.Fatalf("CreateGroup on 409: %v", err)
+	}
+	if want := `{"attributes":{"description":["Public Works Department"]},"name":"public_works"}`; created != want {
+		t.Errorf("create payload = %s, want %s", created, want)
+	}
+	if err := kc.DeleteGroup(ctx, "public_works"); err != nil {
+		t.Errorf("DeleteGroup of a missing group: %v", err)
+	}
+}
+
+func TestKeycloakClient_ServesSeveralRealms(t *testing.T) {
+	var mu sync.Mutex
+	var tokenPaths, assigned []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/protocol/openid-connect/token"):
+			tokenPaths = append(tokenPaths, r.URL.Path)
+			w.Write([]byte(`{"access_token":"token","expires_in":300,"token_type":"Bearer"}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/roles"):
+			// Role IDs differ per realm
+			realm := strings.Split(r.URL.Path, "/")[3]
+			fmt.Fprintf(w, `[{"id":"%s-editor-id","name":"editor"}]`, realm)
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/role-mappings/realm"):
+			body, _ := io.ReadAll(r.Body)
+			assigned = append(assigned, r.URL.Path+" "+string(body))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	kc := NewKeycloakClient(server.URL, "staff", "test-client", "test-secret")
+	kc.ServeRealms("master", []string{" residents", "staff", "residents"})
+	if got := strings.Join(kc.Realms(), ","); got != "staff,residents" {
+		t.Errorf("Realms() = %s, want staff,residents", got)
+	}
+
+	ctx := context.Background()
+	residents, err := providerForRealm(kc, "residents")
+	if err != nil {
+		t.Fatalf("ForRealm(residents): %v", err)
+	}
+	staff, err := providerForRealm(kc, "")
+	if err != nil || staff != IdentityProvider(kc) {
+		t.Fatalf("ForRealm(\"\") = %v, %v; want the default client", staff, err)
+	}
+	if err := residents.AssignRoles(ctx, "u1", []string{"editor"}); err != nil {
+		t.Fatalf("AssignRoles in residents: %v", err)
+	}
+	if err := staff.AssignRoles(ctx, "u2", []string{"editor"}); err != nil {
+		t.Fatalf("AssignRoles in staff: %v", err)
+	}
+
+	want := []string{
+		`/admin/realms/residents/users/u1/role-mappings/realm [{"id":"residents-editor-id","name":"editor"}]`,
+		`/admin/realms/staff/users/u2/role-mappings/realm [{"id":"staff-editor-id","name":"editor"}]`,
+	}
+	if strings.Join(assigned, "\n") != strings.Join(want, "\n") {
+		t.Errorf("assignments =\n%s\nwant\n%s", strings.Join(assigned, "\n"), strings.Join(want, "\n"))
+	}
+	if len(tokenPaths) != 1 || tokenPaths[0] != "/realms/master/protocol/openid-connect/token" {
+		t.Errorf("token requests = %v, want one from the master realm", tokenPaths)
+	}
+
+	if _, err := providerForRealm(kc, "partners"); !errors.Is(err, errIdentityRealmNotServed) {
+		t.Errorf("ForRealm(partners) = %v, want errIdentityRealmNotServed", err)
+	}
+	single := NewKeycloakClient(server.URL, "staff", "test-client", "test-secret")
+	if _, err := providerForRealm(single, "residents"); !errors.Is(err, errIdentityRealmNotServed) {
+		t.Errorf("single-realm ForRealm(residents) = %v, want errIdentityRealmNotServed", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"5", 5 * time.Second, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, c := range cases {
+		got, ok := parseRetryAfter(c.value, now)
+		if got != c.want || ok != c.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", c.value, got, ok, c.want, c.ok)
+		}
+	}
+}
@@ -0,0 +1,671 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Keycloak User Sync
+// ============================================================================
+//
+// The keycloak_user_sync maintenance task queues one keycloak_user_sync job
+// an hour. The job pages through the realm's users (each realm's in turn
+// with KEYCLOAK_REALMS) and, for each one, does what refresh_current_user()
+// does at login: upsert civic_os_users (with the user's identity_realm) and
+// civic_os_users_private (never phone, which the database owns) and make
+// user_roles match the user's effective realm roles, recording the role
+// changes it makes to existing users as role drift. It works for about
+// keycloakUserSyncBatchTime, saves its offset in keycloak_user_sync_runs and
+// snoozes, so a large realm never runs into River's job timeout.
+//
+// What can't be reconciled is recorded in keycloak_user_sync_conflicts rather
+// than forced; a complete run resolves the conflicts it no longer sees.
+
+const (
+	keycloakUserSyncPageSize  = 100
+	keycloakUserSyncBatchTime = 30 * time.Second
+)
+
+// Job kinds that push a Civic OS change for one user to Keycloak. Until they
+// finish, Keycloak still holds the old values.
+var keycloakUserSyncPendingKinds = []string{"update_keycloak_user", "assign_keycloak_role", "revoke_keycloak_role"}
+
+// KeycloakUserSyncArgs is inserted by metadata.enqueue_keycloak_user_sync()
+type KeycloakUserSyncArgs struct{}
+
+func (KeycloakUserSyncArgs) Kind() string { return "keycloak_user_sync" }
+
+func (KeycloakUserSyncArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "user_provisioning",
+		MaxAttempts: 5,
+		Priority:    3,
+	}
+}
+
+// keycloakUserSyncStats is what a page (or a whole run) did
+type keycloakUserSyncStats struct {
+	Seen         int
+	Created      int
+	Updated      int
+	Skipped      int
+	RolesAdded   int
+	RolesRemoved int
+	SeenIDs      []string
+}
+
+func (s *keycloakUserSyncStats) add(o keycloakUserSyncStats) {
+	s.Seen += o.Seen
+	s.Created += o.Created
+	s.Updated += o.Updated
+	s.Skipped += o.Skipped
+	s.RolesAdded += o.RolesAdded
+	s.RolesRemoved += o.RolesRemoved
+}
+
+// keycloakUserSyncResult is what syncing one user did
+type keycloakUserSyncResult struct {
+	Created      bool
+	Updated      bool
+	Skipped      bool
+	RolesAdded   int
+	RolesRemoved int
+	Conflicts    []keycloakUserSyncConflict
+}
+
+// keycloakUserSyncConflict is one row for metadata.keycloak_user_sync_conflicts
+type keycloakUserSyncConflict struct {
+	Type        string
+	Subject     string
+	OtherUserID *string
+	Message     string
+}
+
+// KeycloakUserSyncWorker syncs realm users and their role mappings into Civic OS
+type KeycloakUserSyncWorker struct {
+	river.WorkerDefaults[KeycloakUserSyncArgs]
+	dbPool    *pgxpool.Pool
+	provider  IdentityProvider
+	pageSize  int
+	batchTime time.Duration
+	// keepRoles leaves the roles of existing users alone: the role audit
+	// heals toward Keycloak (ROLE_AUDIT_HEAL=to_keycloak)
+	keepRoles bool
+}
+
+func (w *KeycloakUserSyncWorker) Work(ctx context.Context, job *river.Job[KeycloakUserSyncArgs]) error {
+	runID, realm, offset, err := w.startRun(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Job %d] Syncing Keycloak users from offset %d%s (run %d, attempt %d/%d)",
+		job.ID, offset, realmSuffix(realm), runID, job.Attempt, job.MaxAttempts)
+
+	realms := keycloakUserSyncRealms(w.provider)
+	provider, err := providerForRealm(w.provider, realm)
+	if err != nil {
+		return w.failRun(ctx, job, runID, err)
+	}
+
+	deadline := time.Now().Add(w.batchTime)
+	var batch keycloakUserSyncStats
+	for {
+		users, err := provider.ListUsers(ctx, offset, w.pageSize)
+		if err != nil {
+			return w.failRun(ctx, job, runID, err)
+		}
+
+		page, err := w.syncPage(ctx, provider, realm, users)
+		if err != nil {
+			return w.failRun(ctx, job, runID, err)
+		}
+		offset += len(users)
+		if err := w.savePage(ctx, runID, offset, page); err != nil {
+			return w.failRun(ctx, job, runID, err)
+		}
+		batch.add(page)
+
+		if len(users) < w.pageSize {
+			next, ok := nextKeycloakUserSyncRealm(realms, realm)
+			if !ok {
+				break
+			}
+			// One run covers every realm, so users missing from all of
+			// them are flagged once at the end
+			realm, offset = next, 0
+			if provider, err = providerForRealm(w.provider, realm); err != nil {
+				return w.failRun(ctx, job, runID, err)
+			}
+			if err := w.startRealm(ctx, runID, realm); err != nil {
+				return w.failRun(ctx, job, runID, err)
+			}
+		}
+		if time.Now().After(deadline) {
+			log.Printf("[Job %d] Synced %d Keycloak user(s) this batch, continuing from offset %d%s",
+				job.ID, batch.Seen, offset, realmSuffix(realm))
+			return river.JobSnooze(time.Second)
+		}
+	}
+
+	openConflicts, err := w.finishRun(ctx, runID)
+	if err != nil {
+		return w.failRun(ctx, job, runID, err)
+	}
+	log.Printf("[Job %d] ✓ Keycloak user sync complete (%d realm(s)): %d open conflict(s)",
+		job.ID, len(realms), openConflicts)
+	return nil
+}
+
+// keycloakUserSyncRealms lists the realms a run pages through in order, ""
+// standing for the default realm
+func keycloakUserSyncRealms(provider IdentityProvider) []string {
+	realms, ok := provider.(IdentityRealms)
+	if !ok {
+		return []string{""}
+	}
+	names := realms.Realms()
+	names[0] = ""
+	return names
+}
+
+// nextKeycloakUserSyncRealm returns the realm after current, false after the last
+func nextKeycloakUserSyncRealm(realms []string, current string) (string, bool) {
+	for i, realm := range realms {
+		if realm == current && i+1 < len(realms) {
+			return realms[i+1], true
+		}
+	}
+	return "", false
+}
+
+// realmSuffix names a non-default realm in log lines
+func realmSuffix(realm string) string {
+	if realm == "" {
+		return ""
+	}
+	return " in realm " + realm
+}
+
+// startRun returns the run this job is working through and where it got to,
+// creating it on the job's first attempt
+func (w *KeycloakUserSyncWorker) startRun(ctx context.Context, jobID int64) (int64, string, int, error) {
+	var runID int64
+	var realm string
+	var offset int
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT id, COALESCE(realm, ''), next_offset FROM metadata.keycloak_user_sync_runs
+		WHERE river_job_id = $1 AND status = 'running'
+		ORDER BY id DESC LIMIT 1
+	`, jobID).Scan(&runID, &realm, &offset)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = w.dbPool.QueryRow(ctx, `
+			INSERT INTO metadata.keycloak_user_sync_runs (river_job_id) VALUES ($1) RETURNING id
+		`, jobID).Scan(&runID)
+	}
+	if err != nil {
+		return 0, "", 0, fmt.Errorf("failed to start sync run: %w", err)
+	}
+	return runID, realm, offset, nil
+}
+
+// startRealm moves the run on to the first page of realm
+func (w *KeycloakUserSyncWorker) startRealm(ctx context.Context, runID int64, realm string) error {
+	if _, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.keycloak_user_sync_runs SET realm = NULLIF($2, ''), next_offset = 0
+		WHERE id = $1
+	`, runID, realm); err != nil {
+		return fmt.Errorf("failed to move sync run to realm %s: %w", realm, err)
+	}
+	return nil
+}
+
+// savePage adds a page's results to the run and moves its offset past the page
+func (w *KeycloakUserSyncWorker) savePage(ctx context.Context, runID int64, offset int, page keycloakUserSyncStats) error {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.keycloak_user_sync_runs
+		SET next_offset = $2,
+		    seen_user_ids = seen_user_ids || $3::UUID[],
+		    users_seen = users_seen + $4,
+		    users_created = users_created + $5,
+		    users_updated = users_updated + $6,
+		    users_skipped = users_skipped + $7,
+		    roles_added = roles_added + $8,
+		    roles_removed = roles_removed + $9,
+		    error_message = NULL
+		WHERE id = $1
+	`, runID, offset, page.SeenIDs, page.Seen, page.Created, page.Updated, page.Skipped, page.RolesAdded, page.RolesRemoved)
+	if err != nil {
+		return fmt.Errorf("failed to save sync progress: %w", err)
+	}
+	return nil
+}
+
+// finishRun flags Civic OS users the realm did not list, resolves conflicts
+// this run did not see again and closes the run
+func (w *KeycloakUserSyncWorker) finishRun(ctx context.Context, runID int64) (int, error) {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Users created after the run started may have been added past our offset
+	_, err = tx.Exec(ctx, `
+		INSERT INTO metadata.keycloak_user_sync_conflicts (user_id, conflict_type, email, message)
+		SELECT u.id, 'missing_in_keycloak', p.email,
+		       'Civic OS user "' || u.display_name || '" is not in the Keycloak realm'
+		FROM metadata.keycloak_user_sync_runs r
+		JOIN metadata.civic_os_users u ON u.created_at < r.started_at
+		LEFT JOIN metadata.civic_os_users_private p ON p.id = u.id
+		WHERE r.id = $1 AND NOT (u.id = ANY(r.seen_user_ids))
+		  AND NOT EXISTS (
+		      SELECT 1 FROM metadata.user_deprovisioning d
+		      WHERE d.user_id = u.id AND d.status = 'completed'
+		  )
+		ON CONFLICT (user_id, conflict_type, subject) DO UPDATE
+		SET email = EXCLUDED.email, message = EXCLUDED.message,
+		    last_seen_at = NOW(), resolved_at = NULL
+	`, runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to flag users missing from Keycloak: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE metadata.keycloak_user_sync_conflicts c
+		SET resolved_at = NOW()
+		FROM metadata.keycloak_user_sync_runs r
+		WHERE r.id = $1 AND c.resolved_at IS NULL AND c.last_seen_at < r.started_at
+	`, runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve stale conflicts: %w", err)
+	}
+
+	var openConflicts int
+	err = tx.QueryRow(ctx, `
+		UPDATE metadata.keycloak_user_sync_runs
+		SET status = 'completed', finished_at = NOW(), seen_user_ids = '{}',
+		    open_conflicts = (SELECT COUNT(*) FROM metadata.keycloak_user_sync_conflicts WHERE resolved_at IS NULL)
+		WHERE id = $1
+		RETURNING open_conflicts
+	`, runID).Scan(&openConflicts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to finish sync run: %w", err)
+	}
+
+	return openConflicts, tx.Commit(ctx)
+}
+
+// failRun records the error on the run, marking it failed once River has no
+// attempts left, and returns the error for River to retry
+func (w *KeycloakUserSyncWorker) failRun(ctx context.Context, job *river.Job[KeycloakUserSyncArgs], runID int64, err error) error {
+	final := job.Attempt >= job.MaxAttempts
+	_, dbErr := w.dbPool.Exec(ctx, `
+		UPDATE metadata.keycloak_user_sync_runs
+		SET error_message = $2,
+		    status = CASE WHEN $3 THEN 'failed' ELSE status END,
+		    finished_at = CASE WHEN $3 THEN NOW() ELSE finished_at END
+		WHERE id = $1
+	`, runID, err.Error(), final)
+	if dbErr != nil {
+		log.Printf("[Job %d] Failed to record sync error on run %d: %v", job.ID, runID, dbErr)
+	}
+	return fmt.Errorf("keycloak user sync failed: %w", err)
+}
+
+// syncPage syncs one page of Keycloak users of realm ("" is the default one)
+func (w *KeycloakUserSyncWorker) syncPage(ctx context.Context, provider IdentityProvider, realm string, users []IdentityUser) (keycloakUserSyncStats, error) {
+	var stats keycloakUserSyncStats
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	stats.SeenIDs = ids
+	stats.Seen = len(users)
+
+	pending, err := usersWithPendingKeycloakChanges(ctx, w.dbPool, ids)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, u := range users {
+		if isKeycloakServiceAccount(u) {
+			stats.Skipped++
+			continue
+		}
+		if pending[u.ID] {
+			// Keep the user's open conflicts open; they weren't re-checked
+			if _, err := w.dbPool.Exec(ctx, `
+				UPDATE metadata.keycloak_user_sync_conflicts SET last_seen_at = NOW()
+				WHERE user_id = $1 AND resolved_at IS NULL
+			`, u.ID); err != nil {
+				return stats, fmt.Errorf("failed to keep conflicts of user %s: %w", u.ID, err)
+			}
+			stats.Skipped++
+			continue
+		}
+
+		roles, err := provider.GetUserRoles(ctx, u.ID)
+		if err != nil {
+			return stats, fmt.Errorf("user %s: %w", u.ID, err)
+		}
+		if err := w.syncUser(ctx, u, realm, roles, &stats); err != nil {
+			return stats, fmt.Errorf("user %s: %w", u.ID, err)
+		}
+	}
+	return stats, nil
+}
+
+// usersWithPendingKeycloakChanges returns the users that have a Civic OS
+// change still on its way to Keycloak, and deprovisioned users. Syncing or
+// auditing them now would undo that change.
+func usersWithPendingKeycloakChanges(ctx context.Context, dbPool *pgxpool.Pool, ids []string) (map[string]bool, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT DISTINCT args->>'user_id'
+		FROM metadata.river_job
+		WHERE kind = ANY($1)
+		  AND state IN ('available', 'scheduled', 'running', 'retryable')
+		  AND args->>'user_id' = ANY($2)
+		UNION
+		SELECT user_id::TEXT
+		FROM metadata.user_deprovisioning
+		WHERE status <> 'failed' AND user_id::TEXT = ANY($2)
+	`, keycloakUserSyncPendingKinds, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pending Keycloak jobs: %w", err)
+	}
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pending Keycloak jobs: %w", err)
+	}
+
+	pending := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		pending[id] = true
+	}
+	return pending, nil
+}
+
+// syncUser upserts one user and their roles, then records what could not be
+// reconciled. A rejected profile is a conflict, not a job failure.
+func (w *KeycloakUserSyncWorker) syncUser(ctx context.Context, u IdentityUser, realm string, roles []string, stats *keycloakUserSyncStats) error {
+	result, err := w.upsertUser(ctx, u, realm, roles)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || (pgErr.Code[:2] != "22" && pgErr.Code[:2] != "23") {
+			return err
+		}
+		// Data or constraint error (e.g. the email_address domain)
+		result = keycloakUserSyncResult{
+			Skipped: true,
+			Conflicts: []keycloakUserSyncConflict{{
+				Type:    "invalid_profile",
+				Message: fmt.Sprintf("Keycloak profile rejected: %s", pgErr.Message),
+			}},
+		}
+	}
+
+	for _, c := range result.Conflicts {
+		if err := w.recordConflict(ctx, u, c); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case result.Skipped:
+		stats.Skipped++
+	case result.Created:
+		stats.Created++
+	case result.Updated:
+		stats.Updated++
+	}
+	stats.RolesAdded += result.RolesAdded
+	stats.RolesRemoved += result.RolesRemoved
+	return nil
+}
+
+// upsertUser writes one user's rows in a transaction, skipping the user when
+// another Civic OS user already has their email
+func (w *KeycloakUserSyncWorker) upsertUser(ctx context.Context, u IdentityUser, realm string, roles []string) (keycloakUserSyncResult, error) {
+	var result keycloakUserSyncResult
+	firstName, lastName := keycloakUserNames(u)
+	fullName := strings.TrimSpace(firstName + " " + lastName)
+	email := strings.TrimSpace(u.Email)
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback(ctx)
+
+	if email != "" {
+		var otherID string
+		err := tx.QueryRow(ctx, `
+			SELECT id::TEXT FROM metadata.civic_os_users_private
+			WHERE lower(email) = lower($1) AND id <> $2::UUID
+			LIMIT 1
+		`, email, u.ID).Scan(&otherID)
+		if err == nil {
+			result.Skipped = true
+			result.Conflicts = append(result.Conflicts, keycloakUserSyncConflict{
+				Type:        "email_in_use",
+				Subject:     strings.ToLower(email),
+				OtherUserID: &otherID,
+				Message:     fmt.Sprintf("%s already belongs to another Civic OS user", email),
+			})
+			return result, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return result, fmt.Errorf("email check failed: %w", err)
+		}
+	}
+
+	// Rows are only written when a value changes (RETURNING nothing otherwise)
+	var inserted bool
+	err = tx.QueryRow(ctx, `
+		INSERT INTO metadata.civic_os_users AS u (id, display_name, identity_realm)
+		VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (id) DO UPDATE SET
+		    display_name = EXCLUDED.display_name,
+		    identity_realm = EXCLUDED.identity_realm,
+		    updated_at = NOW()
+		WHERE (u.display_name, u.identity_realm) IS DISTINCT FROM (EXCLUDED.display_name, EXCLUDED.identity_realm)
+		RETURNING xmax = 0
+	`, u.ID, formatPublicDisplayName(firstName, lastName), realm).Scan(&inserted)
+	switch {
+	case err == nil:
+		result.Created, result.Updated = inserted, !inserted
+	case !errors.Is(err, pgx.ErrNoRows):
+		return result, err
+	}
+
+	// Phone is left alone: the database is its authority (v0.65.0)
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO metadata.civic_os_users_private AS p (id, display_name, email, first_name, last_name)
+		VALUES ($1, $2, NULLIF($3, '')::email_address, NULLIF($4, ''), NULLIF($5, ''))
+		ON CONFLICT (id) DO UPDATE SET
+		    display_name = EXCLUDED.display_name,
+		    email = EXCLUDED.email,
+		    first_name = EXCLUDED.first_name,
+		    last_name = EXCLUDED.last_name,
+		    updated_at = NOW()
+		WHERE (p.display_name, p.email, p.first_name, p.last_name)
+		      IS DISTINCT FROM (EXCLUDED.display_name, EXCLUDED.email, EXCLUDED.first_name, EXCLUDED.last_name)
+	`, u.ID, fullName, email, firstName, lastName)
+	if err != nil {
+		return result, err
+	}
+	if tag.RowsAffected() > 0 && !result.Created {
+		result.Updated = true
+	}
+
+	// Same role rules as refresh_current_user(), except that unknown roles
+	// are flagged instead of created
+	rows, err := tx.Query(ctx, `
+		SELECT name FROM unnest($1::TEXT[]) AS name
+		WHERE NOT metadata.is_keycloak_system_role(name)
+		  AND NOT EXISTS (SELECT 1 FROM metadata.roles r WHERE r.role_key = name)
+		ORDER BY name
+	`, roles)
+	if err != nil {
+		return result, err
+	}
+	unknown, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return result, err
+	}
+	for _, name := range unknown {
+		result.Conflicts = append(result.Conflicts, keycloakUserSyncConflict{
+			Type:    "unknown_role",
+			Subject: name,
+			Message: fmt.Sprintf("Keycloak role %q has no Civic OS role and was not assigned", name),
+		})
+	}
+
+	// With ROLE_AUDIT_HEAL=to_keycloak user_roles is the authority for users
+	// Civic OS already has; Keycloak roles only seed new users
+	if w.keepRoles && !result.Created {
+		return result, tx.Commit(ctx)
+	}
+
+	// Adding and removing rows fires the user_roles trigger; the assign and
+	// revoke jobs it queues find Keycloak already matching
+	rows, err = tx.Query(ctx, `
+		DELETE FROM metadata.user_roles ur
+		USING metadata.roles r
+		WHERE ur.role_id = r.id AND ur.user_id = $1
+		  AND NOT (r.role_key = ANY($2))
+		RETURNING r.role_key
+	`, u.ID, roles)
+	if err != nil {
+		return result, err
+	}
+	removed, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return result, err
+	}
+	result.RolesRemoved = len(removed)
+
+	rows, err = tx.Query(ctx, `
+		WITH added AS (
+		    INSERT INTO metadata.user_roles (user_id, role_id, synced_at)
+		    SELECT $1, r.id, NOW()
+		    FROM metadata.roles r
+		    WHERE r.role_key = ANY($2) AND NOT metadata.is_keycloak_system_role(r.role_key)
+		    ON CONFLICT (user_id, role_id) DO NOTHING
+		    RETURNING role_id
+		)
+		SELECT r.role_key FROM added JOIN metadata.roles r ON r.id = added.role_id
+	`, u.ID, roles)
+	if err != nil {
+		return result, err
+	}
+	added, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return result, err
+	}
+	result.RolesAdded = len(added)
+
+	// A role change for a user Civic OS already had is drift, healed here
+	// in the database's direction (see role_audit_worker.go)
+	if !result.Created {
+		for _, role := range removed {
+			if err := recordRoleDrift(ctx, tx, u.ID, realm, role, roleDriftMissingInKeycloak, "healed_database", ""); err != nil {
+				return result, err
+			}
+		}
+		for _, role := range added {
+			if err := recordRoleDrift(ctx, tx, u.ID, realm, role, roleDriftMissingInDatabase, "healed_database", ""); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE metadata.user_roles ur SET synced_at = NOW()
+		FROM metadata.roles r
+		WHERE ur.role_id = r.id AND ur.user_id = $1 AND r.role_key = ANY($2)
+	`, u.ID, roles); err != nil {
+		return result, err
+	}
+
+	return result, tx.Commit(ctx)
+}
+
+// recordConflict opens (or re-opens) a conflict and marks it seen now
+func (w *KeycloakUserSyncWorker) recordConflict(ctx context.Context, u IdentityUser, c keycloakUserSyncConflict) error {
+	_, err := w.dbPool.Exec(ctx, `
+		INSERT INTO metadata.keycloak_user_sync_conflicts
+		    (user_id, conflict_type, subject, username, email, other_user_id, message)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6::UUID, $7)
+		ON CONFLICT (user_id, conflict_type, subject) DO UPDATE
+		SET username = EXCLUDED.username, email = EXCLUDED.email,
+		    other_user_id = EXCLUDED.other_user_id, message = EXCLUDED.message,
+		    last_seen_at = NOW(), resolved_at = NULL
+	`, u.ID, c.Type, c.Subject, u.Username, u.Email, c.OtherUserID, c.Message)
+	if err != nil {
+		return fmt.Errorf("failed to record %s conflict: %w", c.Type, err)
+	}
+	return nil
+}
+
+// keycloakUserNames returns the first and last name Civic OS stores for a
+// Keycloak user. A user without either falls back to the username, as
+// refresh_current_user() falls back to the name claim.
+func keycloakUserNames(u IdentityUser) (string, string) {
+	firstName := strings.TrimSpace(u.FirstName)
+	lastName := strings.TrimSpace(u.LastName)
+	if firstName == "" && lastName == "" {
+		return strings.TrimSpace(u.Username), ""
+	}
+	return firstName, lastName
+}
+
+// isKeycloakServiceAccount reports whether u is the user Keycloak creates for
+// a client's service account (including the worker's own)
+func isKeycloakServiceAccount(u IdentityUser) bool {
+	return u.ServiceAccountClientID != "" || strings.HasPrefix(u.Username, "service-account-")
+}
+
+// ============================================================================
+// Keycloak User Sync Maintenance Task
+// ============================================================================
+
+// KeycloakUserSyncTask enqueues the hourly keycloak_user_sync job
+type KeycloakUserSyncTask struct {
+	dbPool *pgxpool.Pool
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (k *KeycloakUserSyncTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "keycloak_user_sync",
+		Description: "Enqueue a job that syncs Keycloak users and role mappings into Civic OS",
+		Interval:    time.Hour,
+		Jitter:      5 * time.Minute,
+		Run:         k.runEnqueue,
+	}
+}
+
+// runEnqueue calls metadata.enqueue_keycloak_user_sync()
+func (k *KeycloakUserSyncTask) runEnqueue(ctx context.Context) (string, error) {
+	var queued bool
+	if err := k.dbPool.QueryRow(ctx, "SELECT metadata.enqueue_keycloak_user_sync()").Scan(&queued); err != nil {
+		return "", fmt.Errorf("enqueue_keycloak_user_sync(): %w", err)
+	}
+	if !queued {
+		return "Previous sync still pending, nothing enqueued", nil
+	}
+	return "Enqueued keycloak_user_sync", nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeycloakUserNames(t *testing.T) {
+	cases := []struct {
+		user        IdentityUser
+		first, last string
+	}{
+		{IdentityUser{Username: "jdoe", FirstName: " Jane ", LastName: "Doe"}, "Jane", "Doe"},
+		{IdentityUser{Username: "jdoe", FirstName: "Jane"}, "Jane", ""},
+		{IdentityUser{Username: "jdoe", LastName: "Doe"}, "", "Doe"},
+		// Federated users often arrive without names
+		{IdentityUser{Username: "jdoe"}, "jdoe", ""},
+	}
+	for _, c := range cases {
+		first, last := keycloakUserNames(c.user)
+		if first != c.first || last != c.last {
+			t.Errorf("keycloakUserNames(%+v) = %q, %q; want %q, %q", c.user, first, last, c.first, c.last)
+		}
+	}
+}
+
+func TestIsKeycloakServiceAccount(t *testing.T) {
+	cases := map[string]struct {
+		user IdentityUser
+		want bool
+	}{
+		"client link":    {IdentityUser{Username: "bot", ServiceAccountClientID: "civic-os"}, true},
+		"username":       {IdentityUser{Username: "service-account-civic-os-service-account"}, true},
+		"regular user":   {IdentityUser{Username: "jane@example.com"}, false},
+		"prefix in name": {IdentityUser{Username: "my-service-account-user"}, false},
+	}
+	for name, c := range cases {
+		if got := isKeycloakServiceAccount(c.user); got != c.want {
+			t.Errorf("%s: isKeycloakServiceAccount = %v, want %v", name, got, c.want)
+		}
+	}
+}
+
+func TestNextKeycloakUserSyncRealm(t *testing.T) {
+	kc := NewKeycloakClient("http://keycloak", "staff", "client", "secret")
+	if realms := keycloakUserSyncRealms(kc); len(realms) != 1 || realms[0] != "" {
+		t.Errorf("single realm = %q, want just the default", realms)
+	}
+
+	kc.ServeRealms("", []string{"residents", "partners"})
+	realms := keycloakUserSyncRealms(kc)
+	var order []string
+	for realm, ok := "", true; ok; realm, ok = nextKeycloakUserSyncRealm(realms, realm) {
+		order = append(order, realm)
+	}
+	if got := strings.Join(order, ","); got != ",residents,partners" {
+		t.Errorf("realm order = %q, want the default, residents, partners", got)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Maintenance Task Scheduler
+//
+// Runs the worker's built-in maintenance tasks (draft gallery cleanup,
+// validation result purge, signature polling, ...) from one declarative list.
+// Each task declares a default interval and jitter; on startup the scheduler
+// inserts any missing rows into metadata.maintenance_tasks, and from then on
+// the table is authoritative so admins can disable or retune a task from the
+// admin UI without a redeploy.
+//
+// Every maintenanceCheckInterval the scheduler claims due tasks with a single
+// UPDATE ... RETURNING that also moves next_run_at forward, so replicas never
+// run the same task twice. Like ScheduledJobScheduler, this uses a Go ticker
+// rather than River periodic jobs so only consolidated-worker runs it.
+// ============================================================================
+
+// maintenanceCheckInterval is how often due tasks are claimed; it bounds how
+// late a task (or a "Run now" from the admin UI) can start
+const maintenanceCheckInterval = 15 * time.Second
+
+// MaintenanceTask is one built-in task and its default schedule. Run returns a
+// short summary stored as last_message (e.g., "Purged 3 results").
+type MaintenanceTask struct {
+	Name        string
+	Description string
+	Interval    time.Duration
+	Jitter      time.Duration
+	Run         func(ctx context.Context) (string, error)
+}
+
+// MaintenanceScheduler claims and runs due maintenance tasks
+type MaintenanceScheduler struct {
+	dbPool *pgxpool.Pool
+	tasks  []MaintenanceTask
+	done   chan bool
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// NewMaintenanceScheduler creates a scheduler for the declared tasks
+func NewMaintenanceScheduler(dbPool *pgxpool.Pool, tasks []MaintenanceTask) *MaintenanceScheduler {
+	return &MaintenanceScheduler{
+		dbPool:  dbPool,
+		tasks:   tasks,
+		running: make(map[string]bool),
+	}
+}
+
+// Start registers the declared tasks and launches the scheduler goroutine.
+// The first check runs immediately so overdue tasks catch up on boot.
+func (m *MaintenanceScheduler) Start(ctx context.Context) {
+	m.done = make(chan bool)
+
+	if err := m.register(ctx); err != nil {
+		log.Printf("[Maintenance] Error registering tasks: %v", err)
+	}
+
+	go func() {
+		m.checkDue(ctx)
+
+		ticker := time.NewTicker(maintenanceCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.checkDue(ctx)
+			case <-m.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Printf("[Maintenance] Started - %d tasks, checking every %s", len(m.tasks), maintenanceCheckInterval)
+}
+
+// Stop shuts down the scheduler and waits for running tasks to finish.
+func (m *MaintenanceScheduler) Stop() {
+	if m.done != nil {
+		close(m.done)
+	}
+	m.wg.Wait()
+	log.Println("[Maintenance] Stopped")
+}
+
+// register inserts missing task rows with their default schedule. Existing
+// rows keep their schedule; only the description and registered_at change.
+func (m *MaintenanceScheduler) register(ctx context.Context) error {
+	for _, task := range m.tasks {
+		_, err := m.dbPool.Exec(ctx, `
+			INSERT INTO metadata.maintenance_tasks
+				(name, description, interval_seconds, jitter_seconds, next_run_at, registered_at)
+			VALUES ($1, $2, $3, $4, NOW() + $5::interval, NOW())
+			ON CONFLICT (name) DO UPDATE
+			SET description = EXCLUDED.description, registered_at = NOW()
+		`, task.Name, task.Description, durationSeconds(task.Interval), durationSeconds(task.Jitter),
+			intervalString(initialDelay(task.Interval)))
+		if err != nil {
+			return fmt.Errorf("register %s: %w", task.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkDue claims all due tasks and runs each in its own goroutine
+func (m *MaintenanceScheduler) checkDue(ctx context.Context) {
+	names := make([]string, 0, len(m.tasks))
+	m.mu.Lock()
+	for _, task := range m.tasks {
+		// A task still running from an earlier claim is left due, not claimed twice
+		if !m.running[task.Name] {
+			names = append(names, task.Name)
+		}
+	}
+	m.mu.Unlock()
+	if len(names) == 0 {
+		return
+	}
+
+	rows, err := m.dbPool.Query(ctx, `
+		UPDATE metadata.maintenance_tasks
+		SET
+			next_run_at = NOW() + make_interval(secs => interval_seconds + floor(random() * (jitter_seconds + 1))),
+			last_started_at = NOW()
+		WHERE enabled AND next_run_at <= NOW() AND name = ANY($1)
+		RETURNING name
+	`, names)
+	if err != nil {
+		log.Printf("[Maintenance] Error claiming due tasks: %v", err)
+		return
+	}
+	var claimed []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Printf("[Maintenance] Error reading claimed task: %v", err)
+			continue
+		}
+		claimed = append(claimed, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("[Maintenance] Error claiming due tasks: %v", err)
+		return
+	}
+
+	for _, name := range claimed {
+		task, ok := m.task(name)
+		if !ok {
+			continue
+		}
+		m.mu.Lock()
+		m.running[name] = true
+		m.mu.Unlock()
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			defer func() {
+				m.mu.Lock()
+				delete(m.running, task.Name)
+				m.mu.Unlock()
+			}()
+			m.runTask(ctx, task)
+		}()
+	}
+}
+
+// runTask runs one claimed task and records its outcome
+func (m *MaintenanceScheduler) runTask(ctx context.Context, task MaintenanceTask) {
+	start := time.Now()
+	message, err := task.Run(ctx)
+	duration := time.Since(start)
+
+	success := err == nil
+	if err != nil {
+		message = err.Error()
+		log.Printf("[Maintenance] %s failed after %s: %v", task.Name, duration.Round(time.Millisecond), err)
+	}
+
+	_, dbErr := m.dbPool.Exec(ctx, `
+		UPDATE metadata.maintenance_tasks
+		SET
+			last_finished_at = NOW(),
+			last_duration_ms = $2,
+			last_success = $3,
+			last_message = $4,
+			run_count = run_count + 1,
+			failure_count = failure_count + CASE WHEN $3 THEN 0 ELSE 1 END
+		WHERE name = $1
+	`, task.Name, duration.Milliseconds(), success, message)
+	if dbErr != nil {
+		log.Printf("[Maintenance] Error recording %s result: %v", task.Name, dbErr)
+	}
+}
+
+// task looks up a declared task by name
+func (m *MaintenanceScheduler) task(name string) (MaintenanceTask, bool) {
+	for _, task := range m.tasks {
+		if task.Name == name {
+			return task, true
+		}
+	}
+	return MaintenanceTask{}, false
+}
+
+// initialDelay spreads the first run of a newly registered task: short tasks
+// run right away, daily-or-longer tasks wait one interval so a fresh install
+// or new task doesn't sweep during startup.
+func initialDelay(interval time.Duration) time.Duration {
+	if interval >= 24*time.Hour {
+		return interval
+	}
+	return 0
+}
+
+// durationSeconds converts a duration to whole seconds for the schedule
+// columns, rounding sub-second intervals up to one second
+func durationSeconds(d time.Duration) int {
+	seconds := int(d / time.Second)
+	if d > 0 && seconds == 0 {
+		return 1
+	}
+	return seconds
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationSeconds(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{500 * time.Millisecond, 1},
+		{time.Minute, 60},
+		{90 * time.Second, 90},
+		{24 * time.Hour, 86400},
+	}
+
+	for _, tt := range tests {
+		if got := durationSeconds(tt.d); got != tt.want {
+			t.Errorf("durationSeconds(%s) = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestInitialDelay(t *testing.T) {
+	if got := initialDelay(time.Minute); got != 0 {
+		t.Errorf("initialDelay(1m) = %s, want 0", got)
+	}
+	if got := initialDelay(24 * time.Hour); got != 24*time.Hour {
+		t.Errorf("initialDelay(24h) = %s, want 24h", got)
+	}
+}
+
+func TestMaintenanceTaskDeclarations(t *testing.T) {
+	tasks := []MaintenanceTask{
+		(&GalleryCleanupTask{}).MaintenanceTask(),
+		(&ValidationCleanupTask{retention: time.Hour}).MaintenanceTask(),
+		(&EntityLockCleanupTask{}).MaintenanceTask(),
+		(&EntityWebhookCleanupTask{}).MaintenanceTask(),
+		(&EntityArchivalTask{}).MaintenanceTask(),
+		(&QueueCircuitBreakerTask{}).MaintenanceTask(),
+		(&JobPurgeTask{completedRetention: 24 * time.Hour}).MaintenanceTask(),
+		NewDeadLetterRecorder(nil, []string{"admin"}).MaintenanceTask(),
+		(&SignaturePollTask{provider: NewFakeSignatureProvider(), interval: 5 * time.Minute}).MaintenanceTask(),
+		(&KeycloakUserSyncTask{}).MaintenanceTask(),
+		(&CDNURLRefreshTask{cdn: &CDNURLs{ttl: 24 * time.Hour}}).MaintenanceTask(),
+		(&UploadRequestCleanupTask{retention: 30 * 24 * time.Hour}).MaintenanceTask(),
+		(&StorageUsageTask{}).MaintenanceTask(),
+	}
+
+	seen := make(map[string]bool)
+	for _, task := range tasks {
+		if task.Name == "" || len(task.Name) > 100 {
+			t.Errorf("task name %q must be 1-100 characters", task.Name)
+		}
+		if seen[task.Name] {
+			t.Errorf("duplicate task name %q", task.Name)
+		}
+		seen[task.Name] = true
+
+		if durationSeconds(task.Interval) <= 0 {
+			t.Errorf("%s: interval %s must be at least one second", task.Name, task.Interval)
+		}
+		if task.Jitter < 0 {
+			t.Errorf("%s: jitter %s must not be negative", task.Name, task.Jitter)
+		}
+		if task.Run == nil {
+			t.Errorf("%s: Run is nil", task.Name)
+		}
+	}
+}
+
+func TestMaintenanceSchedulerTaskLookup(t *testing.T) {
+	m := NewMaintenanceScheduler(nil, []MaintenanceTask{{Name: "a"}, {Name: "b"}})
+
+	if task, ok := m.task("b"); !ok || task.Name != "b" {
+		t.Errorf("task(b) = %q, %v; want b, true", task.Name, ok)
+	}
+	if _, ok := m.task("missing"); ok {
+		t.Error("task(missing) found, want not found")
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Memory Guard
+//
+// One worker process runs every queue, so an OOM kill takes out every
+// in-flight job, not just the thumbnail that blew the budget. MemoryGuard
+// samples the process's resident memory and, above a watermark, limits how
+// many heavy jobs (thumbnails, PDF rendering) run at once. Heavy jobs that
+// would exceed the limit are snoozed rather than failed; River retries them
+// after memoryGuardSnooze without using up an attempt. Light kinds are never
+// held back.
+//
+// Throttling ends once memory falls below memoryGuardResumeRatio of the
+// watermark, so the guard doesn't flap around the threshold.
+// ============================================================================
+
+const (
+	memoryGuardSnooze      = 30 * time.Second
+	memoryGuardResumeRatio = 0.85
+	// memoryGuardDefaultRatio of the cgroup limit is the watermark when
+	// MEMORY_WATERMARK_MB isn't set
+	memoryGuardDefaultRatio = 0.8
+)
+
+// defaultHeavyJobKinds are the job kinds that decode whole files in memory
+var defaultHeavyJobKinds = []string{
+	"thumbnail_generate",
+	"thumbnail_backfill",
+	"signature_send",
+	"signature_complete",
+}
+
+// MemoryGuard is River worker middleware that throttles heavy job kinds while
+// process memory is above a watermark. A nil *MemoryGuard is never installed.
+type MemoryGuard struct {
+	river.MiddlewareDefaults
+
+	watermark            uint64 // bytes
+	throttledConcurrency int    // heavy jobs allowed at once while throttled
+	heavyKinds           map[string]bool
+	interval             time.Duration
+	readMemory           func() (uint64, error)
+
+	mu           sync.Mutex
+	throttled    bool
+	heavyRunning int
+	stats        MemoryGuardStats
+	done         chan bool
+}
+
+// MemoryGuardStats are cumulative counters since startup plus current state
+type MemoryGuardStats struct {
+	ThrottleEvents int64 // times memory crossed the watermark
+	Recoveries     int64 // times memory fell back below the resume level
+	Snoozed        int64 // heavy jobs deferred while throttled
+	CurrentBytes   uint64
+	PeakBytes      uint64
+	Throttled      bool
+	HeavyRunning   int
+}
+
+// NewMemoryGuard creates a guard throttling heavyKinds above watermark bytes.
+// Returns nil (guard disabled) when watermark is 0.
+func NewMemoryGuard(watermark uint64, throttledConcurrency int, heavyKinds []string) *MemoryGuard {
+	if watermark == 0 {
+		return nil
+	}
+	kinds := make(map[string]bool, len(heavyKinds))
+	for _, kind := range heavyKinds {
+		kinds[kind] = true
+	}
+	return &MemoryGuard{
+		watermark:            watermark,
+		throttledConcurrency: max(throttledConcurrency, 0),
+		heavyKinds:           kinds,
+		interval:             2 * time.Second,
+		readMemory:           readProcessMemory,
+	}
+}
+
+// SetLimits changes the watermark and throttled concurrency (SIGHUP reload).
+// The next sample re-evaluates throttling against the new watermark.
+func (g *MemoryGuard) SetLimits(watermark uint64, throttledConcurrency int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.watermark = watermark
+	g.throttledConcurrency = max(throttledConcurrency, 0)
+}
+
+// Work implements rivertype.WorkerMiddleware
+func (g *MemoryGuard) Work(ctx context.Context, job *rivertype.JobRow, doInner func(context.Context) error) error {
+	if !g.heavyKinds[job.Kind] {
+		return doInner(ctx)
+	}
+
+	g.mu.Lock()
+	if g.throttled && g.heavyRunning >= g.throttledConcurrency {
+		g.stats.Snoozed++
+		running := g.heavyRunning
+		g.mu.Unlock()
+		log.Printf("[Job %d] Memory above watermark, snoozing %s for %s (%d heavy job(s) running)",
+			job.ID, job.Kind, memoryGuardSnooze, running)
+		return river.JobSnooze(memoryGuardSnooze)
+	}
+	g.heavyRunning++
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		g.heavyRunning--
+		g.mu.Unlock()
+	}()
+	return doInner(ctx)
+}
+
+// observe records a memory sample and switches throttling on or off
+func (g *MemoryGuard) observe(bytes uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stats.CurrentBytes = bytes
+	g.stats.PeakBytes = max(g.stats.PeakBytes, bytes)
+
+	switch {
+	case !g.throttled && bytes >= g.watermark:
+		g.throttled = true
+		g.stats.ThrottleEvents++
+		log.Printf("[MemoryGuard] ⚠ Memory %s above watermark %s: heavy jobs limited to %d at a time (%d running)",
+			formatMB(bytes), formatMB(g.watermark), g.throttledConcurrency, g.heavyRunning)
+	case g.throttled && bytes < uint64(float64(g.watermark)*memoryGuardResumeRatio):
+		g.throttled = false
+		g.stats.Recoveries++
+		log.Printf("[MemoryGuard] ✓ Memory recovered to %s: heavy job concurrency restored (%s)",
+			formatMB(bytes), g.statsLocked())
+	}
+}
+
+// Stats returns a snapshot of the guard's counters
+func (g *MemoryGuard) Stats() MemoryGuardStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.statsLocked()
+}
+
+func (g *MemoryGuard) statsLocked() MemoryGuardStats {
+	stats := g.stats
+	stats.Throttled = g.throttled
+	stats.HeavyRunning = g.heavyRunning
+	return stats
+}
+
+// Start launches the sampling goroutine
+func (g *MemoryGuard) Start(ctx context.Context) {
+	g.done = make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(g.interval)
+		defer ticker.Stop()
+
+		for {
+			bytes, err := g.readMemory()
+			if err != nil {
+				log.Printf("[MemoryGuard] Failed to read process memory, guard stopped: %v", err)
+				return
+			}
+			g.observe(bytes)
+
+			select {
+			case <-ticker.C:
+			case <-g.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the sampling goroutine to exit and logs the final counters
+func (g *MemoryGuard) Stop() {
+	if g.done != nil {
+		close(g.done)
+	}
+	log.Printf("[MemoryGuard] Final: %s", g.Stats())
+}
+
+// String formats the stats for logs
+func (s MemoryGuardStats) String() string {
+	return fmt.Sprintf("throttle_events=%d recoveries=%d snoozed=%d current=%s peak=%s throttled=%v heavy_running=%d",
+		s.ThrottleEvents, s.Recoveries, s.Snoozed, formatMB(s.CurrentBytes), formatMB(s.PeakBytes), s.Throttled, s.HeavyRunning)
+}
+
+// memoryWatermark returns MEMORY_WATERMARK_MB in bytes, or a share of the
+// container's cgroup memory limit when it's unset (-1). Returns 0 when
+// neither is available or MEMORY_WATERMARK_MB=0.
+func memoryWatermark(watermarkMB int) uint64 {
+	if watermarkMB >= 0 {
+		return uint64(watermarkMB) * 1024 * 1024
+	}
+	limit, ok := cgroupMemoryLimit()
+	if !ok {
+		return 0
+	}
+	return uint64(float64(limit) * memoryGuardDefaultRatio)
+}
+
+// cgroupMemoryLimit reads the container memory limit (cgroup v2, then v1)
+func cgroupMemoryLimit() (uint64, bool) {
+	for _, path := range []string{
+		"/sys/fs/cgroup/memory.max",
+		"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		// "max" (v2) or a near-2^63 value (v1) means unlimited
+		if err != nil || limit >= 1<<62 {
+			return 0, false
+		}
+		return limit, true
+	}
+	return 0, false
+}
+
+// readProcessMemory returns the process's resident set size. Unlike Go heap
+// statistics it includes C allocations (libvips, pg_query). Falls back to
+// memory obtained by the Go runtime where /proc isn't available.
+func readProcessMemory() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return m.Sys, nil
+	}
+	return parseStatmRSS(string(data), uint64(os.Getpagesize()))
+}
+
+// parseStatmRSS extracts resident memory in bytes from /proc/self/statm
+// ("size resident shared text lib data dt", in pages)
+func parseStatmRSS(statm string, pageSize uint64) (uint64, error) {
+	fields := strings.Fields(statm)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected statm format: %q", statm)
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse resident pages: %w", err)
+	}
+	return pages * pageSize, nil
+}
+
+// formatMB formats a byte count as megabytes for logs
+func formatMB(bytes uint64) string {
+	return fmt.Sprintf("%dMB", bytes/(1024*1024))
+}
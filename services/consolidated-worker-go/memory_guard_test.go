@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+const testMB = 1024 * 1024
+
+func TestNewMemoryGuard_DisabledWithoutWatermark(t *testing.T) {
+	if g := NewMemoryGuard(0, 1, defaultHeavyJobKinds); g != nil {
+		t.Error("expected nil guard for a zero watermark")
+	}
+	if got := memoryWatermark(0); got != 0 {
+		t.Errorf("memoryWatermark(0) = %d, want 0 (disabled)", got)
+	}
+	if got := memoryWatermark(512); got != 512*testMB {
+		t.Errorf("memoryWatermark(512) = %d, want %d", got, 512*testMB)
+	}
+}
+
+func TestMemoryGuard_ObserveHysteresis(t *testing.T) {
+	g := NewMemoryGuard(1000*testMB, 1, defaultHeavyJobKinds)
+
+	steps := []struct {
+		mb            uint64
+		wantThrottled bool
+	}{
+		{600, false},
+		{1000, true}, // at the watermark
+		{900, true},  // below it, but above the resume level (850)
+		{1200, true}, // still the same throttle event
+		{849, false},
+		{1001, true},
+	}
+	for _, step := range steps {
+		g.observe(step.mb * testMB)
+		if got := g.Stats().Throttled; got != step.wantThrottled {
+			t.Fatalf("after %dMB: throttled = %v, want %v", step.mb, got, step.wantThrottled)
+		}
+	}
+
+	stats := g.Stats()
+	if stats.ThrottleEvents != 2 || stats.Recoveries != 1 {
+		t.Errorf("throttle_events=%d recoveries=%d, want 2 and 1", stats.ThrottleEvents, stats.Recoveries)
+	}
+	if stats.PeakBytes != 1200*testMB {
+		t.Errorf("peak = %s, want 1200MB", formatMB(stats.PeakBytes))
+	}
+}
+
+func TestMemoryGuard_WorkThrottlesHeavyKindsOnly(t *testing.T) {
+	g := NewMemoryGuard(1000*testMB, 1, []string{"thumbnail_generate"})
+	g.observe(1100 * testMB)
+
+	ran := 0
+	work := func(ctx context.Context) error {
+		ran++
+		return nil
+	}
+	heavy := &rivertype.JobRow{ID: 1, Kind: "thumbnail_generate"}
+	light := &rivertype.JobRow{ID: 2, Kind: "send_notification"}
+
+	// One heavy job may run while throttled; a second one is snoozed
+	err := g.Work(context.Background(), heavy, func(ctx context.Context) error {
+		var snooze *river.JobSnoozeError
+		if err := g.Work(ctx, heavy, work); !errors.As(err, &snooze) || snooze.Duration != memoryGuardSnooze {
+			t.Errorf("second heavy job: err = %v, want snooze of %s", err, memoryGuardSnooze)
+		}
+		if err := g.Work(ctx, light, work); err != nil {
+			t.Errorf("light job: err = %v, want it to run", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("first heavy job: err = %v", err)
+	}
+	if ran != 1 {
+		t.Errorf("inner work ran %d times, want 1 (the light job)", ran)
+	}
+
+	stats := g.Stats()
+	if stats.Snoozed != 1 || stats.HeavyRunning != 0 {
+		t.Errorf("snoozed=%d heavy_running=%d, want 1 and 0", stats.Snoozed, stats.HeavyRunning)
+	}
+
+	// Not throttled: no limit beyond the queue's own MaxWorkers
+	g.observe(100 * testMB)
+	for i := 0; i < 3; i++ {
+		if err := g.Work(context.Background(), heavy, work); err != nil {
+			t.Errorf("heavy job after recovery: err = %v", err)
+		}
+	}
+}
+
+func TestParseStatmRSS(t *testing.T) {
+	got, err := parseStatmRSS("262144 51200 1024 100 0 60000 0\n", 4096)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 200*testMB {
+		t.Errorf("rss = %s, want 200MB", formatMB(got))
+	}
+
+	if _, err := parseStatmRSS("garbage", 4096); err == nil {
+		t.Error("expected error for malformed statm")
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Prometheus Metrics
+//
+// workerMetrics collects the counters and histograms served on /metrics.
+// Queue depth and connection pool stats are read when scraped. The worker
+// exports a handful of series, so the Prometheus text format is written
+// directly rather than through the client library.
+//
+// The civic_os_jobs_*, civic_os_queue_jobs and civic_os_db_pool_* families
+// are shared with the payment worker, so one dashboard covers both.
+// ============================================================================
+
+var workerMetrics = NewMetrics()
+
+// Metrics holds the consolidated worker's Prometheus series
+type Metrics struct {
+	JobsTotal     *counterVec   // River jobs finished, by queue, kind and result
+	JobDuration   *histogramVec // River job run time, by queue and kind
+	S3Duration    *histogramVec // S3 API call latency (including retries), by operation
+	S3Errors      *counterVec   // S3 API calls that returned an error, by operation
+	S3Retries     *counterVec   // S3 attempts after the first, by operation
+	S3LimitWait   *histogramVec // Time S3 calls waited for a concurrency slot, by operation
+	SMTPDuration  *histogramVec // SMTP send latency (connect to QUIT), by result
+	SMTPFailovers *counterVec   // Emails sent on to another SMTP server after a failure, by that server
+}
+
+// NewMetrics creates an empty set of consolidated worker series
+func NewMetrics() *Metrics {
+	return &Metrics{
+		JobsTotal: newCounterVec("civic_os_jobs_total",
+			"River jobs finished.", "queue", "kind", "result"),
+		JobDuration: newHistogramVec("civic_os_job_duration_seconds",
+			"Time River jobs spent running.", []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}, "queue", "kind"),
+		S3Duration: newHistogramVec("civic_os_s3_operation_duration_seconds",
+			"Time S3 API calls took, including retries.", []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}, "operation"),
+		S3Errors: newCounterVec("civic_os_s3_operation_errors_total",
+			"S3 API calls that failed after retries.", "operation"),
+		S3Retries: newCounterVec("civic_os_s3_retries_total",
+			"S3 attempts retried after a throttling, server or network error.", "operation"),
+		S3LimitWait: newHistogramVec("civic_os_s3_limiter_wait_seconds",
+			"Time S3 calls waited for a slot under S3_MAX_CONCURRENCY.", []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 30}, "operation"),
+		SMTPDuration: newHistogramVec("civic_os_smtp_send_duration_seconds",
+			"Time sending one email took, from connecting to QUIT.", []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}, "result"),
+		SMTPFailovers: newCounterVec("civic_os_smtp_failovers_total",
+			"Emails sent on to the other SMTP server after one failed (SMTP_SECONDARY_HOST).", "server"),
+	}
+}
+
+// WriteTo writes every series in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	m.JobsTotal.write(&b)
+	m.JobDuration.write(&b)
+	m.S3Duration.write(&b)
+	m.S3Errors.write(&b)
+	m.S3Retries.write(&b)
+	m.S3LimitWait.write(&b)
+	m.SMTPDuration.write(&b)
+	m.SMTPFailovers.write(&b)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ObserveJobs records River job events until events is closed. Run it in a
+// goroutine with the channel from riverClient.Subscribe.
+func (m *Metrics) ObserveJobs(events <-chan *river.Event) {
+	for event := range events {
+		if event.Job == nil {
+			continue
+		}
+		result := strings.TrimPrefix(string(event.Kind), "job_")
+		m.JobsTotal.Inc(event.Job.Queue, event.Job.Kind, result)
+		if event.JobStats != nil {
+			m.JobDuration.Observe(event.JobStats.RunDuration.Seconds(), event.Job.Queue, event.Job.Kind)
+		}
+	}
+}
+
+// jobEventKinds are the River events ObserveJobs counts
+var jobEventKinds = []river.EventKind{
+	river.EventKindJobCompleted,
+	river.EventKindJobFailed,
+	river.EventKindJobCancelled,
+	river.EventKindJobSnoozed,
+}
+
+// ObserveSMTPSend records one email send that started at started
+func (m *Metrics) ObserveSMTPSend(started time.Time, err error) {
+	result := "sent"
+	if err != nil {
+		result = "error"
+	}
+	m.SMTPDuration.Observe(time.Since(started).Seconds(), result)
+}
+
+// s3MetricsMiddleware times each S3 API call. It sits after the SDK's
+// operation metadata in the initialize step, so the retry loop is inside it.
+func s3MetricsMiddleware(m *Metrics) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CivicOSMetrics",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				started := time.Now()
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				operation := awsmiddleware.GetOperationName(ctx)
+				m.S3Duration.Observe(time.Since(started).Seconds(), operation)
+				if err != nil {
+					m.S3Errors.Inc(operation)
+				}
+				if attempts, ok := retry.GetAttemptResults(metadata); ok && len(attempts.Results) > 1 {
+					m.S3Retries.Add(float64(len(attempts.Results)-1), operation)
+				}
+				return out, metadata, err
+			}), middleware.After)
+	}
+}
+
+// ============================================================================
+// Scrape-time gauges
+// ============================================================================
+
+// writeQueueDepth writes unfinished River jobs by queue and state
+func writeQueueDepth(ctx context.Context, b *strings.Builder, dbPool *pgxpool.Pool) error {
+	rows, err := dbPool.Query(ctx, `
+		SELECT queue, state::TEXT, COUNT(*)
+		FROM metadata.river_job
+		WHERE state IN ('available', 'scheduled', 'retryable', 'running')
+		GROUP BY queue, state
+	`)
+	if err != nil {
+		return fmt.Errorf("query river_job: %w", err)
+	}
+	defer rows.Close()
+
+	depth := make(map[string]float64)
+	for rows.Next() {
+		var queue, state string
+		var count int
+		if err := rows.Scan(&queue, &state, &count); err != nil {
+			return fmt.Errorf("scan river_job: %w", err)
+		}
+		depth[queue+"\x00"+state] = float64(count)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	writeGauge(b, "civic_os_queue_jobs",
+		"Unfinished River jobs, by queue and state.", []string{"queue", "state"}, depth)
+	return nil
+}
+
+// writeQueuePaused writes 1 for each paused River queue (admin pause or
+// tripped circuit breaker) and 0 for the others
+func writeQueuePaused(ctx context.Context, b *strings.Builder, dbPool *pgxpool.Pool) error {
+	rows, err := dbPool.Query(ctx, `SELECT name, paused_at IS NOT NULL FROM metadata.river_queue`)
+	if err != nil {
+		return fmt.Errorf("query river_queue: %w", err)
+	}
+	defer rows.Close()
+
+	paused := make(map[string]float64)
+	for rows.Next() {
+		var queue string
+		var isPaused bool
+		if err := rows.Scan(&queue, &isPaused); err != nil {
+			return fmt.Errorf("scan river_queue: %w", err)
+		}
+		paused[queue] = boolGauge(isPaused)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	writeGauge(b, "civic_os_queue_paused",
+		"Whether a River queue is paused (1), by an admin or its circuit breaker.", []string{"queue"}, paused)
+	return nil
+}
+
+// writePoolStats writes the pgx connection pool's gauges and counters
+func writePoolStats(b *strings.Builder, stat *pgxpool.Stat) {
+	writeGauge(b, "civic_os_db_pool_connections",
+		"Database pool connections, by state (max is the configured limit).", []string{"state"}, map[string]float64{
+			"acquired":     float64(stat.AcquiredConns()),
+			"idle":         float64(stat.IdleConns()),
+			"constructing": float64(stat.ConstructingConns()),
+			"total":        float64(stat.TotalConns()),
+			"max":          float64(stat.MaxConns()),
+		})
+	writeCounter(b, "civic_os_db_pool_acquires_total",
+		"Connections acquired from the pool.", float64(stat.AcquireCount()))
+	writeCounter(b, "civic_os_db_pool_empty_acquires_total",
+		"Acquires that waited because the pool had no idle connection.", float64(stat.EmptyAcquireCount()))
+	writeCounter(b, "civic_os_db_pool_canceled_acquires_total",
+		"Acquires canceled by their context before getting a connection.", float64(stat.CanceledAcquireCount()))
+	writeCounter(b, "civic_os_db_pool_acquire_wait_seconds_total",
+		"Total time spent acquiring connections.", stat.AcquireDuration().Seconds())
+}
+
+// ============================================================================
+// HTTP server
+// ============================================================================
+
+// metricsScrapeTimeout bounds the queue depth query on each scrape
+const metricsScrapeTimeout = 5 * time.Second
+
+// MetricsServer serves /metrics. Probes are on HealthServer, which has no token.
+type MetricsServer struct {
+	metrics *Metrics
+	dbPool  *pgxpool.Pool
+	token   string // Optional bearer token; empty = open
+	server  *http.Server
+}
+
+// NewMetricsServer creates a metrics server listening on port
+func NewMetricsServer(metrics *Metrics, dbPool *pgxpool.Pool, token, port string) *MetricsServer {
+	s := &MetricsServer{metrics: metrics, dbPool: dbPool, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	s.server = &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Start listens in a goroutine. A listen failure is logged, not fatal:
+// jobs keep running without metrics.
+func (s *MetricsServer) Start() {
+	go func() {
+		log.Printf("[Metrics] Serving Prometheus metrics on %s/metrics", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[Metrics] Server stopped: %v", err)
+		}
+	}()
+}
+
+// Stop shuts the server down, waiting for in-flight scrapes
+func (s *MetricsServer) Stop(ctx context.Context) {
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("[Metrics] Shutdown error: %v", err)
+	}
+}
+
+func (s *MetricsServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.token != "" && !bearerTokenMatches(r, s.token) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var b strings.Builder
+	s.metrics.WriteTo(&b)
+	if s.dbPool != nil {
+		writePoolStats(&b, s.dbPool.Stat())
+
+		ctx, cancel := context.WithTimeout(r.Context(), metricsScrapeTimeout)
+		defer cancel()
+		if err := writeQueueDepth(ctx, &b, s.dbPool); err != nil {
+			log.Printf("[Metrics] Queue depth query failed: %v", err)
+		}
+		if err := writeQueuePaused(ctx, &b, s.dbPool); err != nil {
+			log.Printf("[Metrics] Queue pause query failed: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	io.WriteString(w, b.String())
+}
+
+// bearerTokenMatches reports whether the request carries "Bearer <token>"
+func bearerTokenMatches(r *http.Request, token string) bool {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// ============================================================================
+// Text exposition format
+// ============================================================================
+
+// counterVec is a counter with labels
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by rendered label set
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// Inc adds one to the series for labelValues (in the order of the labels)
+func (c *counterVec) Inc(labelValues ...string) {
+	key := renderLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+// Add adds v to the series for labelValues
+func (c *counterVec) Add(v float64, labelValues ...string) {
+	key := renderLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the current count for labelValues
+func (c *counterVec) Value(labelValues ...string) float64 {
+	key := renderLabels(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *counterVec) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(b, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram with labels and fixed buckets
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64 // Upper bounds, ascending; +Inf is implied
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // Per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// Observe records a value for labelValues
+func (h *histogramVec) Observe(value float64, labelValues ...string) {
+	key := renderLabels(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: append([]string{}, labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+// Count returns how many values were observed for labelValues
+func (h *histogramVec) Count(labelValues ...string) uint64 {
+	key := renderLabels(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *histogramVec) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		names := append(append([]string{}, h.labels...), "le")
+		values := append(append([]string{}, s.labelValues...), "")
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			values[len(values)-1] = formatValue(upper)
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, renderLabels(names, values), cumulative)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, renderLabels(names, values), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.name, key, formatValue(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.name, key, s.count)
+	}
+}
+
+// writeGauge writes one gauge family. values is keyed by label values joined
+// with "\x00", in the order of labels.
+func writeGauge(b *strings.Builder, name, help string, labels []string, values map[string]float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(b, "%s%s %s\n", name, renderLabels(labels, strings.Split(key, "\x00")), formatValue(values[key]))
+	}
+}
+
+// writeCounter writes an unlabelled counter whose value is kept elsewhere
+// (e.g. by pgxpool)
+func writeCounter(b *strings.Builder, name, help string, value float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", name, help, name, name, formatValue(value))
+}
+
+// renderLabels renders {a="x",b="y"}, or "" when there are no labels
+func renderLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + labelEscaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func boolGauge(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
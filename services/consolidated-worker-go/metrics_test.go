@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestMetrics_WriteTo(t *testing.T) {
+	m := NewMetrics()
+	m.JobsTotal.Inc("thumbnails", "thumbnail_generate", "completed")
+	m.JobsTotal.Inc("thumbnails", "thumbnail_generate", "completed")
+	m.S3Errors.Inc(`Get"Object`)
+	m.JobDuration.Observe(0.2, "thumbnails", "thumbnail_generate")
+	m.JobDuration.Observe(400, "thumbnails", "thumbnail_generate")
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE civic_os_jobs_total counter\n",
+		`civic_os_jobs_total{queue="thumbnails",kind="thumbnail_generate",result="completed"} 2` + "\n",
+		`civic_os_s3_operation_errors_total{operation="Get\"Object"} 1` + "\n",
+		"# TYPE civic_os_job_duration_seconds histogram\n",
+		`civic_os_job_duration_seconds_bucket{queue="thumbnails",kind="thumbnail_generate",le="0.1"} 0` + "\n",
+		`civic_os_job_duration_seconds_bucket{queue="thumbnails",kind="thumbnail_generate",le="0.25"} 1` + "\n",
+		`civic_os_job_duration_seconds_bucket{queue="thumbnails",kind="thumbnail_generate",le="300"} 1` + "\n",
+		`civic_os_job_duration_seconds_bucket{queue="thumbnails",kind="thumbnail_generate",le="+Inf"} 2` + "\n",
+		`civic_os_job_duration_seconds_count{queue="thumbnails",kind="thumbnail_generate"} 2` + "\n",
+		"# TYPE civic_os_smtp_send_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestMetrics_ObserveJobs(t *testing.T) {
+	m := NewMetrics()
+	events := make(chan *river.Event, 3)
+	events <- &river.Event{Kind: river.EventKindJobCompleted, Job: &rivertype.JobRow{Queue: "notifications", Kind: "send_email"},
+		JobStats: &river.JobStatistics{RunDuration: 200 * time.Millisecond}}
+	events <- &river.Event{Kind: river.EventKindJobFailed, Job: &rivertype.JobRow{Queue: "notifications", Kind: "send_email"},
+		JobStats: &river.JobStatistics{RunDuration: time.Second}}
+	events <- &river.Event{Kind: river.EventKindQueuePaused}
+	close(events)
+
+	m.ObserveJobs(events)
+
+	if got := m.JobsTotal.Value("notifications", "send_email", "completed"); got != 1 {
+		t.Errorf("completed = %v, want 1", got)
+	}
+	if got := m.JobsTotal.Value("notifications", "send_email", "failed"); got != 1 {
+		t.Errorf("failed = %v, want 1", got)
+	}
+	if got := m.JobDuration.Count("notifications", "send_email"); got != 2 {
+		t.Errorf("duration count = %v, want 2", got)
+	}
+}
+
+func TestMetrics_ObserveSMTPSend(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveSMTPSend(time.Now(), nil)
+	m.ObserveSMTPSend(time.Now(), errors.New("connection refused"))
+
+	if got := m.SMTPDuration.Count("sent"); got != 1 {
+		t.Errorf("sent = %v, want 1", got)
+	}
+	if got := m.SMTPDuration.Count("error"); got != 1 {
+		t.Errorf("error = %v, want 1", got)
+	}
+}
+
+// statusDoer answers every S3 request with a fixed status
+type statusDoer int
+
+func (d statusDoer) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: int(d),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestS3MetricsMiddleware(t *testing.T) {
+	m := NewMetrics()
+	newClient := func(status int) *s3.Client {
+		return s3.New(s3.Options{
+			Region:           "us-east-1",
+			BaseEndpoint:     aws.String("http://s3.test"),
+			UsePathStyle:     true,
+			Credentials:      aws.AnonymousCredentials{},
+			HTTPClient:       statusDoer(status),
+			RetryMaxAttempts: 1,
+			APIOptions:       []func(*middleware.Stack) error{s3MetricsMiddleware(m)},
+		})
+	}
+
+	_, err := newClient(http.StatusNoContent).DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String("civic-os-files"), Key: aws.String("a.jpg"),
+	})
+	if err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	_, err = newClient(http.StatusForbidden).HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("civic-os-files"), Key: aws.String("a.jpg"),
+	})
+	if err == nil {
+		t.Fatal("HeadObject() expected error for 403")
+	}
+
+	if got := m.S3Duration.Count("DeleteObject"); got != 1 {
+		t.Errorf("DeleteObject observations = %v, want 1", got)
+	}
+	if got := m.S3Errors.Value("DeleteObject"); got != 0 {
+		t.Errorf("DeleteObject errors = %v, want 0", got)
+	}
+	if got := m.S3Errors.Value("HeadObject"); got != 1 {
+		t.Errorf("HeadObject errors = %v, want 1", got)
+	}
+}
+
+func TestMetricsServer_Token(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"token missing", "s3cret", "", http.StatusUnauthorized},
+		{"token wrong", "s3cret", "Bearer nope", http.StatusUnauthorized},
+		{"token correct", "s3cret", "Bearer s3cret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMetricsServer(NewMetrics(), nil, tt.token, "0")
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && !strings.Contains(rec.Body.String(), "# TYPE civic_os_jobs_total counter") {
+				t.Errorf("body missing job counter:\n%s", rec.Body.String())
+			}
+		})
+	}
+}
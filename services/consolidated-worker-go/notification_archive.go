@@ -0,0 +1,81 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Rendered Notification Archive
+//
+// For templates with archive_rendered (see migration
+// v0-118-0-notification-archive), the notification and send_email workers
+// copy what they sent into metadata.notification_archive: the rendered
+// subject, HTML and text of emails and the SMS body, as delivered
+// (engagement-tracked links included). Public records requests can then be
+// answered with the exact message, not a template that has changed since.
+//
+// Archive rows have no foreign key to metadata.notifications, so they outlive
+// notification cleanup, and a trigger rejects updates. Parts of a channel
+// that didn't go out are left NULL.
+// ============================================================================
+
+// NotificationArchiveEntry is one sent message
+type NotificationArchiveEntry struct {
+	NotificationID  *string // nil for send_email jobs
+	JobID           int64
+	TemplateName    string
+	EntityType      string
+	EntityID        string
+	Recipients      []string // addresses the message went to (email and/or phone)
+	CC              []string
+	ChannelsSent    []string
+	AttachmentNames []string
+	EmailServer     string // SMTP server that accepted the email, if one was sent
+	Rendered        *RenderedNotification
+}
+
+// archiveRendered writes the entry. A notification is archived once; the
+// first successful send wins. Errors are returned for the caller to log:
+// the message is already out, so retrying the job would send it twice.
+func archiveRendered(ctx context.Context, dbPool *pgxpool.Pool, entry NotificationArchiveEntry) error {
+	subject, htmlBody, textBody, smsBody := entry.archivedBodies()
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO metadata.notification_archive (
+			notification_id, river_job_id, template_name, entity_type, entity_id,
+			recipients, cc, channels_sent, attachment_names,
+			subject, html_body, text_body, sms_body, email_provider
+		)
+		VALUES ($1::BIGINT, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''))
+		ON CONFLICT (notification_id) WHERE notification_id IS NOT NULL DO NOTHING
+	`, entry.NotificationID, entry.JobID, entry.TemplateName, entry.EntityType, entry.EntityID,
+		nonNilStrings(entry.Recipients), nonNilStrings(entry.CC), nonNilStrings(entry.ChannelsSent),
+		nonNilStrings(entry.AttachmentNames), subject, htmlBody, textBody, smsBody, entry.EmailServer)
+	return err
+}
+
+// archivedBodies returns the rendered parts of the channels that were sent;
+// the parts of other channels are nil, stored as NULL
+func (entry NotificationArchiveEntry) archivedBodies() (subject, htmlBody, textBody, smsBody *string) {
+	for _, channel := range entry.ChannelsSent {
+		switch channel {
+		case "email":
+			subject, htmlBody, textBody = &entry.Rendered.Subject, &entry.Rendered.HTML, &entry.Rendered.Text
+		case "sms":
+			smsBody = &entry.Rendered.SMS
+		}
+	}
+	return subject, htmlBody, textBody, smsBody
+}
+
+// logArchiveError reports a failed archive write loudly; the records copy is
+// missing even though the message was delivered
+func logArchiveError(jobID int64, err error) {
+	if err != nil {
+		log.Printf("[Job %d] ⚠️  Failed to archive rendered notification: %v", jobID, err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestNotificationArchiveEntry_ArchivedBodies(t *testing.T) {
+	rendered := &RenderedNotification{Subject: "Permit approved", HTML: "<p>Approved</p>", Text: "Approved", SMS: "Permit approved"}
+	str := func(s *string) string {
+		if s == nil {
+			return "NULL"
+		}
+		return *s
+	}
+
+	tests := []struct {
+		name                     string
+		channelsSent             []string
+		subject, html, text, sms string
+	}{
+		{"email only", []string{"email"}, "Permit approved", "<p>Approved</p>", "Approved", "NULL"},
+		{"sms only", []string{"sms"}, "NULL", "NULL", "NULL", "Permit approved"},
+		{"both", []string{"email", "sms"}, "Permit approved", "<p>Approved</p>", "Approved", "Permit approved"},
+		{"nothing sent", nil, "NULL", "NULL", "NULL", "NULL"},
+		{"unknown channel", []string{"push"}, "NULL", "NULL", "NULL", "NULL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := NotificationArchiveEntry{ChannelsSent: tt.channelsSent, Rendered: rendered}
+			subject, html, text, sms := entry.archivedBodies()
+			if str(subject) != tt.subject || str(html) != tt.html || str(text) != tt.text || str(sms) != tt.sms {
+				t.Errorf("archivedBodies() = %q, %q, %q, %q; want %q, %q, %q, %q",
+					str(subject), str(html), str(text), str(sms), tt.subject, tt.html, tt.text, tt.sms)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Notification Send-Time SLA
+//
+// The notification worker stores each notification's queue latency (created
+// to first sent) in notification_log.queue_latency. Every five minutes the
+// notification_sla maintenance task rebuilds the current and previous hour
+// of metadata.notification_latency_stats (p50, p95 and max per template, see
+// migration v0-131-0-notification-sla) and alerts the roles in
+// NOTIFICATION_SLA_NOTIFY_ROLES about templates whose notifications went out
+// later than their SLA, or are still pending past it. The SLA is
+// NOTIFICATION_SLA_SECONDS unless the template sets latency_sla_seconds.
+// Each template alerts at most once an hour.
+// ============================================================================
+
+const (
+	notificationSLAInterval = 5 * time.Minute
+	// Hours before the current one to rebuild; a notification created long
+	// ago lands in the hour it was sent, so one is enough
+	notificationSLARollupLookback = time.Hour
+)
+
+// NotificationSLATask rolls up notification latency and sends SLA alerts
+type NotificationSLATask struct {
+	dbPool      *pgxpool.Pool
+	defaultSLA  time.Duration
+	notifyRoles []string // empty = stats only
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (n *NotificationSLATask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "notification_sla",
+		Description: "Roll notification queue latency up into hourly p50/p95 per template and alert ops about notifications later than their SLA",
+		Interval:    notificationSLAInterval,
+		Run:         n.run,
+	}
+}
+
+func (n *NotificationSLATask) run(ctx context.Context) (string, error) {
+	var rolledUp int
+	err := n.dbPool.QueryRow(ctx,
+		`SELECT metadata.rollup_notification_latency(NOW() - $1::interval, $2::interval)`,
+		intervalString(notificationSLARollupLookback), intervalString(n.defaultSLA),
+	).Scan(&rolledUp)
+	if err != nil {
+		return "", fmt.Errorf("rollup_notification_latency(): %w", err)
+	}
+
+	var alerted int
+	err = n.dbPool.QueryRow(ctx,
+		`SELECT metadata.notify_notification_sla_breaches($1, $2::interval)`,
+		n.notifyRoles, intervalString(n.defaultSLA),
+	).Scan(&alerted)
+	if err != nil {
+		return "", fmt.Errorf("notify_notification_sla_breaches(): %w", err)
+	}
+	if alerted > 0 {
+		log.Printf("[NotificationSLA] Alerted %v about %d template(s) over their SLA", n.notifyRoles, alerted)
+	}
+	return notificationSLASummary(rolledUp, alerted), nil
+}
+
+// notificationSLASummary describes a run for the maintenance log
+func notificationSLASummary(rolledUp, alerted int) string {
+	summary := fmt.Sprintf("Rolled up %d template-hour(s)", rolledUp)
+	if alerted > 0 {
+		summary += fmt.Sprintf(", alerted on %d template(s) over their SLA", alerted)
+	}
+	return summary
+}
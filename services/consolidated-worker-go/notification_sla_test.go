@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotificationSLASummary(t *testing.T) {
+	if got := notificationSLASummary(3, 0); got != "Rolled up 3 template-hour(s)" {
+		t.Errorf("no alerts: got %q", got)
+	}
+	if got := notificationSLASummary(4, 2); got != "Rolled up 4 template-hour(s), alerted on 2 template(s) over their SLA" {
+		t.Errorf("alerts: got %q", got)
+	}
+}
+
+func TestNotificationSLATaskDeclaration(t *testing.T) {
+	task := (&NotificationSLATask{defaultSLA: 15 * time.Minute}).MaintenanceTask()
+	if task.Name != "notification_sla" || task.Interval != 5*time.Minute || task.Run == nil {
+		t.Errorf("unexpected task: %+v", task)
+	}
+	if got := intervalString(15 * time.Minute); got != "900 seconds" {
+		t.Errorf("SLA interval = %q, want 900 seconds", got)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Notification Status Batcher
+//
+// markNotificationSent/markNotificationFailed used to issue one UPDATE per
+// notification. With 30 notification workers that is a steady stream of
+// single-row writes against metadata.notifications. The batcher buffers status
+// changes in memory and writes them as one multi-row UPDATE every flush
+// interval (or as soon as maxBatch rows are pending).
+//
+// GUARANTEES:
+//   - Stop() flushes everything still buffered before returning, so a graceful
+//     shutdown never drops a status change.
+//   - If the same notification is updated twice before a flush, only the most
+//     recent update is written (last write wins, matching the old behavior).
+//   - A failed flush re-queues its rows for the next attempt (bounded by
+//     maxPending) instead of silently dropping them.
+// ============================================================================
+
+const (
+	defaultStatusFlushInterval = 250 * time.Millisecond
+	defaultStatusMaxBatch      = 100
+	defaultStatusMaxPending    = 10000
+)
+
+// notificationStatusUpdate is a single buffered status change
+type notificationStatusUpdate struct {
+	ID             int64     `json:"id"`
+	Status         string    `json:"status"` // 'sent' or 'failed'
+	ChannelsSent   []string  `json:"channels_sent"`
+	ChannelsFailed []string  `json:"channels_failed"`
+	ErrorMessage   *string   `json:"error_message"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// statusFlushFunc writes a batch of updates to the database.
+// Swappable so tests can exercise batching without PostgreSQL.
+type statusFlushFunc func(ctx context.Context, updates []notificationStatusUpdate) error
+
+// NotificationStatusBatcher coalesces notification status updates into bulk UPDATEs
+type NotificationStatusBatcher struct {
+	flush         statusFlushFunc
+	flushInterval time.Duration
+	maxBatch      int
+	maxPending    int
+
+	mu      sync.Mutex
+	pending []notificationStatusUpdate
+
+	// flushMu serializes flushes so the ticker, a full batch, and Stop()
+	// never write overlapping batches out of order.
+	flushMu sync.Mutex
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewNotificationStatusBatcher creates a batcher that writes to metadata.notifications
+func NewNotificationStatusBatcher(dbPool *pgxpool.Pool) *NotificationStatusBatcher {
+	return newNotificationStatusBatcher(func(ctx context.Context, updates []notificationStatusUpdate) error {
+		return flushNotificationStatuses(ctx, dbPool, updates)
+	}, defaultStatusFlushInterval, defaultStatusMaxBatch)
+}
+
+func newNotificationStatusBatcher(flush statusFlushFunc, flushInterval time.Duration, maxBatch int) *NotificationStatusBatcher {
+	return &NotificationStatusBatcher{
+		flush:         flush,
+		flushInterval: flushInterval,
+		maxBatch:      maxBatch,
+		maxPending:    defaultStatusMaxPending,
+		kick:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start launches the background flush loop
+func (b *NotificationStatusBatcher) Start(ctx context.Context) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(b.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				b.flushPending(ctx)
+			case <-b.kick:
+				b.flushPending(ctx)
+			case <-b.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Printf("[StatusBatcher] Started - flushing every %v or every %d updates", b.flushInterval, b.maxBatch)
+}
+
+// Stop halts the flush loop and synchronously writes any buffered updates
+func (b *NotificationStatusBatcher) Stop(ctx context.Context) {
+	close(b.done)
+	b.wg.Wait()
+
+	// Final flush uses the caller's (shutdown) context, not the possibly-cancelled run context
+	remaining := b.pendingCount()
+	b.flushPending(ctx)
+	log.Printf("[StatusBatcher] Stopped (flushed %d pending updates)", remaining)
+}
+
+// MarkSent buffers a 'sent' status update
+func (b *NotificationStatusBatcher) MarkSent(notificationID string, channelsSent, channelsFailed []string) error {
+	return b.enqueue(notificationID, "sent", channelsSent, channelsFailed, nil)
+}
+
+// MarkFailed buffers a 'failed' status update
+func (b *NotificationStatusBatcher) MarkFailed(notificationID string, errorMsg string) error {
+	return b.enqueue(notificationID, "failed", nil, nil, &errorMsg)
+}
+
+func (b *NotificationStatusBatcher) enqueue(notificationID, status string, channelsSent, channelsFailed []string, errorMsg *string) error {
+	id, err := strconv.ParseInt(notificationID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid notification id %q: %w", notificationID, err)
+	}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, notificationStatusUpdate{
+		ID:             id,
+		Status:         status,
+		ChannelsSent:   channelsSent,
+		ChannelsFailed: channelsFailed,
+		ErrorMessage:   errorMsg,
+		UpdatedAt:      time.Now(),
+	})
+	full := len(b.pending) >= b.maxBatch
+	b.mu.Unlock()
+
+	if full {
+		// Non-blocking: a flush is already scheduled if the channel is full
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *NotificationStatusBatcher) pendingCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// flushPending drains the buffer and writes it in maxBatch-sized chunks
+func (b *NotificationStatusBatcher) flushPending(ctx context.Context) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	updates := coalesceStatusUpdates(batch)
+	for start := 0; start < len(updates); start += b.maxBatch {
+		end := start + b.maxBatch
+		if end > len(updates) {
+			end = len(updates)
+		}
+
+		if err := b.flush(ctx, updates[start:end]); err != nil {
+			log.Printf("[StatusBatcher] Failed to flush %d status updates, re-queueing: %v", len(updates)-start, err)
+			b.requeue(updates[start:])
+			return
+		}
+	}
+}
+
+// requeue puts unflushed updates back at the front of the buffer so newer
+// updates queued in the meantime still win during coalescing
+func (b *NotificationStatusBatcher) requeue(updates []notificationStatusUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	merged := append(append([]notificationStatusUpdate{}, updates...), b.pending...)
+	if len(merged) > b.maxPending {
+		dropped := len(merged) - b.maxPending
+		log.Printf("[StatusBatcher] ⚠️  Buffer over capacity, dropping %d oldest status updates", dropped)
+		merged = merged[dropped:]
+	}
+	b.pending = merged
+}
+
+// coalesceStatusUpdates keeps only the latest update per notification,
+// preserving first-seen order so the UPDATE touches rows in a stable order
+func coalesceStatusUpdates(updates []notificationStatusUpdate) []notificationStatusUpdate {
+	index := make(map[int64]int, len(updates))
+	result := make([]notificationStatusUpdate, 0, len(updates))
+
+	for _, u := range updates {
+		if i, ok := index[u.ID]; ok {
+			result[i] = u
+			continue
+		}
+		index[u.ID] = len(result)
+		result = append(result, u)
+	}
+	return result
+}
+
+// flushNotificationStatuses writes a batch of status updates with a single UPDATE.
+// sent_at is taken from the time the worker finished sending, not the flush time.
+func flushNotificationStatuses(ctx context.Context, dbPool *pgxpool.Pool, updates []notificationStatusUpdate) error {
+	payload, err := json.Marshal(updates)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status updates: %w", err)
+	}
+
+	_, err = dbPool.Exec(ctx, `
+		UPDATE metadata.notifications n
+		SET status = u.status,
+			sent_at = CASE WHEN u.status = 'sent' THEN u.updated_at ELSE n.sent_at END,
+			channels_sent = CASE WHEN u.status = 'sent' THEN u.channels_sent ELSE n.channels_sent END,
+			channels_failed = CASE WHEN u.status = 'sent' THEN u.channels_failed ELSE n.channels_failed END,
+			error_message = CASE WHEN u.status = 'failed' THEN u.error_message ELSE n.error_message END
+		FROM jsonb_to_recordset($1::JSONB) AS u(
+			id BIGINT,
+			status TEXT,
+			channels_sent TEXT[],
+			channels_failed TEXT[],
+			error_message TEXT,
+			updated_at TIMESTAMPTZ
+		)
+		WHERE n.id = u.id
+	`, payload)
+	return err
+}
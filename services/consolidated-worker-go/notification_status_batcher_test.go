@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Helper: recording flush func
+// ============================================================================
+
+// flushRecorder captures every batch passed to the flush func
+type flushRecorder struct {
+	mu      sync.Mutex
+	batches [][]notificationStatusUpdate
+	failN   int // fail this many calls before succeeding
+}
+
+func (r *flushRecorder) flush(ctx context.Context, updates []notificationStatusUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failN > 0 {
+		r.failN--
+		return errors.New("connection reset")
+	}
+	batch := make([]notificationStatusUpdate, len(updates))
+	copy(batch, updates)
+	r.batches = append(r.batches, batch)
+	return nil
+}
+
+// written returns the last written update per notification ID
+func (r *flushRecorder) written() map[int64]notificationStatusUpdate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make(map[int64]notificationStatusUpdate)
+	for _, batch := range r.batches {
+		for _, u := range batch {
+			result[u.ID] = u
+		}
+	}
+	return result
+}
+
+func (r *flushRecorder) batchCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.batches)
+}
+
+// ============================================================================
+// Tests: coalescing
+// ============================================================================
+
+func TestCoalesceStatusUpdates_LastWriteWins(t *testing.T) {
+	errMsg := "smtp timeout"
+	updates := []notificationStatusUpdate{
+		{ID: 1, Status: "failed", ErrorMessage: &errMsg},
+		{ID: 2, Status: "sent"},
+		{ID: 1, Status: "sent", ChannelsSent: []string{"email"}},
+	}
+
+	got := coalesceStatusUpdates(updates)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(got))
+	}
+	if got[0].ID != 1 || got[0].Status != "sent" {
+		t.Errorf("expected id 1 to coalesce to 'sent', got %+v", got[0])
+	}
+	if got[1].ID != 2 {
+		t.Errorf("expected first-seen order to be preserved, got id %d second", got[1].ID)
+	}
+}
+
+func TestNotificationStatusBatcher_InvalidID(t *testing.T) {
+	rec := &flushRecorder{}
+	b := newNotificationStatusBatcher(rec.flush, time.Hour, 10)
+
+	if err := b.MarkSent("not-a-number", nil, nil); err == nil {
+		t.Error("expected error for non-numeric notification id")
+	}
+	if b.pendingCount() != 0 {
+		t.Errorf("expected nothing buffered, got %d", b.pendingCount())
+	}
+}
+
+// ============================================================================
+// Tests: flush triggers
+// ============================================================================
+
+func TestNotificationStatusBatcher_FlushOnStop(t *testing.T) {
+	rec := &flushRecorder{}
+	// Interval long enough that only Stop() can flush
+	b := newNotificationStatusBatcher(rec.flush, time.Hour, 1000)
+	b.Start(context.Background())
+
+	b.MarkSent("1", []string{"email"}, nil)
+	b.MarkFailed("2", "invalid address")
+
+	b.Stop(context.Background())
+
+	written := rec.written()
+	if len(written) != 2 {
+		t.Fatalf("expected 2 updates flushed on stop, got %d", len(written))
+	}
+	if written[2].ErrorMessage == nil || *written[2].ErrorMessage != "invalid address" {
+		t.Errorf("expected error message to be flushed, got %+v", written[2])
+	}
+}
+
+func TestNotificationStatusBatcher_FlushOnInterval(t *testing.T) {
+	rec := &flushRecorder{}
+	b := newNotificationStatusBatcher(rec.flush, 10*time.Millisecond, 1000)
+	b.Start(context.Background())
+	defer b.Stop(context.Background())
+
+	b.MarkSent("1", []string{"email"}, nil)
+
+	deadline := time.Now().Add(time.Second)
+	for rec.batchCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if rec.batchCount() == 0 {
+		t.Fatal("expected ticker to flush pending update")
+	}
+}
+
+func TestNotificationStatusBatcher_FlushOnFullBatch(t *testing.T) {
+	rec := &flushRecorder{}
+	b := newNotificationStatusBatcher(rec.flush, time.Hour, 3)
+	b.Start(context.Background())
+	defer b.Stop(context.Background())
+
+	for i := 1; i <= 3; i++ {
+		b.MarkSent(fmt.Sprint(i), []string{"email"}, nil)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for rec.batchCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if rec.batchCount() == 0 {
+		t.Fatal("expected full batch to trigger an early flush")
+	}
+}
+
+func TestNotificationStatusBatcher_RequeueOnFailure(t *testing.T) {
+	rec := &flushRecorder{failN: 1}
+	b := newNotificationStatusBatcher(rec.flush, time.Hour, 10)
+
+	b.MarkSent("1", []string{"email"}, nil)
+	b.flushPending(context.Background())
+
+	if b.pendingCount() != 1 {
+		t.Fatalf("expected failed batch to be re-queued, got %d pending", b.pendingCount())
+	}
+
+	// A newer update queued after the failure must win over the re-queued one
+	b.MarkFailed("1", "bounced")
+	b.flushPending(context.Background())
+
+	written := rec.written()
+	if written[1].Status != "failed" {
+		t.Errorf("expected newer 'failed' update to win, got %q", written[1].Status)
+	}
+	if b.pendingCount() != 0 {
+		t.Errorf("expected empty buffer after successful flush, got %d", b.pendingCount())
+	}
+}
+
+func TestNotificationStatusBatcher_ChunksLargeFlush(t *testing.T) {
+	rec := &flushRecorder{}
+	b := newNotificationStatusBatcher(rec.flush, time.Hour, 4)
+
+	for i := 1; i <= 10; i++ {
+		b.MarkSent(fmt.Sprint(i), nil, nil)
+	}
+	b.flushPending(context.Background())
+
+	if rec.batchCount() != 3 {
+		t.Errorf("expected 10 updates in 3 chunks of <=4, got %d batches", rec.batchCount())
+	}
+	for _, batch := range rec.batches {
+		if len(batch) > 4 {
+			t.Errorf("batch exceeds maxBatch: %d rows", len(batch))
+		}
+	}
+}
+
+// ============================================================================
+// Tests: concurrency
+// ============================================================================
+
+// TestNotificationStatusBatcher_Concurrent simulates 30 notification workers
+// racing the flush loop; every notification must be written exactly with its
+// final status once Stop() returns. Run with -race.
+func TestNotificationStatusBatcher_Concurrent(t *testing.T) {
+	rec := &flushRecorder{}
+	b := newNotificationStatusBatcher(rec.flush, time.Millisecond, 7)
+	b.Start(context.Background())
+
+	const workers = 30
+	const perWorker = 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id := fmt.Sprint(w*perWorker + i + 1)
+				// Fail first, then succeed: the final write must be 'sent'
+				b.MarkFailed(id, "transient")
+				b.MarkSent(id, []string{"email"}, nil)
+			}
+		}(w)
+	}
+	wg.Wait()
+	b.Stop(context.Background())
+
+	written := rec.written()
+	if len(written) != workers*perWorker {
+		t.Fatalf("expected %d notifications written, got %d", workers*perWorker, len(written))
+	}
+	for id, u := range written {
+		if u.Status != "sent" {
+			t.Errorf("notification %d: expected final status 'sent', got %q", id, u.Status)
+		}
+	}
+}
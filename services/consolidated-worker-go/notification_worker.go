@@ -2,29 +2,49 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
-	"net"
+	"mime"
 	"net/smtp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riverqueue/river"
 )
 
 // NotificationArgs defines the job arguments structure
 type NotificationArgs struct {
-	NotificationID string          `json:"notification_id"`
-	UserID         string          `json:"user_id"`
-	TemplateName   string          `json:"template_name"`
-	EntityType     string          `json:"entity_type"`
-	EntityID       string          `json:"entity_id"`
-	EntityData     json.RawMessage `json:"entity_data"`
-	Channels       []string        `json:"channels"`
+	NotificationID string                   `json:"notification_id" river:"unique"`
+	UserID         string                   `json:"user_id"`
+	TemplateName   string                   `json:"template_name"`
+	EntityType     string                   `json:"entity_type"`
+	EntityID       string                   `json:"entity_id"`
+	EntityData     json.RawMessage          `json:"entity_data"`
+	Channels       []string                 `json:"channels"`
+	Attachments    []NotificationAttachment `json:"attachments,omitempty"`
+}
+
+// NotificationAttachment is a stored file attached to the email (v0.83.0)
+type NotificationAttachment struct {
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	S3Bucket    string `json:"s3_bucket"`
+	S3Key       string `json:"s3_key"`
+}
+
+// emailAttachment is an attachment with its content loaded
+type emailAttachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
 }
 
 // Kind returns the job type identifier
@@ -36,6 +56,47 @@ func (NotificationArgs) InsertOpts() river.InsertOpts {
 		Queue:       "notifications",
 		MaxAttempts: 5,
 		Priority:    1,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:  true,
+			ByState: notifyJobUniqueStates,
+		},
+	}
+}
+
+// notificationArgsQuery builds send_notification args from metadata.notifications
+const notificationArgsQuery = `
+	SELECT id::TEXT, user_id::TEXT, template_name, COALESCE(entity_type, ''), COALESCE(entity_id, ''),
+	       entity_data, channels, attachments
+	FROM metadata.notifications
+	WHERE status = 'pending'
+`
+
+func scanNotificationArgs(rows pgx.Rows) (river.JobArgs, error) {
+	var args NotificationArgs
+	err := rows.Scan(&args.NotificationID, &args.UserID, &args.TemplateName, &args.EntityType, &args.EntityID,
+		&args.EntityData, &args.Channels, &args.Attachments)
+	return args, err
+}
+
+// notificationCreatedChannel queues delivery of notifications that
+// enqueue_notification_job() announces on notification_created (payload:
+// notification ID). Resync covers notifications still pending; the worker
+// marks each one sent or failed when it runs.
+func notificationCreatedChannel(dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx]) NotifyChannel {
+	return NotifyChannel{
+		Name: "notification_created",
+		Handle: func(ctx context.Context, payload string) error {
+			id, err := strconv.ParseInt(payload, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid notification ID: %w", err)
+			}
+			_, err = insertJobsFromQuery(ctx, dbPool, riverClient, scanNotificationArgs,
+				notificationArgsQuery+" AND id = $1", id)
+			return err
+		},
+		Resync: func(ctx context.Context) error {
+			return resyncJobs(ctx, "notification_created", dbPool, riverClient, scanNotificationArgs, notificationArgsQuery)
+		},
 	}
 }
 
@@ -45,9 +106,39 @@ type SMTPConfig struct {
 	Port           string
 	Username       string
 	Password       string
-	From           string // RFC 5322 format supported: "Display Name" <email@example.com>
-	ReplyTo        string // Optional Reply-To address
-	SkipTestEmails bool   // Skip sending to test/dummy email addresses (e.g., @example.com)
+	From           string             // RFC 5322 format supported: "Display Name" <email@example.com>
+	ReplyTo        string             // Optional Reply-To address
+	SkipTestEmails bool               // Skip sending to test/dummy email addresses (e.g., @example.com)
+	DryRun         *DryRun            // Records sends instead of connecting when email is simulated
+	Suppressions   *EmailSuppressions // Addresses not to email; nil = no list
+
+	// Failover (see smtp_failover.go). Secondary only uses Host, Port,
+	// Username and Password.
+	Secondary         *SMTPConfig   // nil = no failover
+	FailoverThreshold int           // Consecutive primary failures before it is treated as down
+	FailoverCooldown  time.Duration // How long the secondary goes first once it is
+	failover          smtpFailover
+
+	// Guards Username and Password, which SetCredentials swaps on rotation
+	credentialsMu sync.RWMutex
+}
+
+// SetCredentials swaps in rotated SMTP credentials (see secrets.go)
+func (c *SMTPConfig) SetCredentials(username, password string) {
+	c.credentialsMu.Lock()
+	c.Username, c.Password = username, password
+	c.credentialsMu.Unlock()
+}
+
+// smtpAuth returns PLAIN auth with the current credentials, or nil when
+// none are configured
+func (c *SMTPConfig) smtpAuth() smtp.Auth {
+	c.credentialsMu.RLock()
+	defer c.credentialsMu.RUnlock()
+	if c.Username == "" || c.Password == "" {
+		return nil
+	}
+	return smtp.PlainAuth("", c.Username, c.Password, c.Host)
 }
 
 // NotificationWorker implements the River Worker interface
@@ -56,9 +147,13 @@ type NotificationWorker struct {
 	dbPool        *pgxpool.Pool
 	renderer      *Renderer
 	smtpConfig    *SMTPConfig
-	telnyxClient  *TelnyxClient // nil when SMS_ENABLED=false or SMS_FAKE_MODE=true
-	smsFakeMode   bool          // true = log to stdout instead of calling Telnyx
-	smsFromNumber string        // displayed in fake-mode logs
+	telnyxClient  *TelnyxClient              // nil when SMS_ENABLED=false or SMS_FAKE_MODE=true
+	smsFakeMode   bool                       // true = log to stdout instead of calling Telnyx
+	dryRun        *DryRun                    // records SMS sends when sms is simulated
+	smsFromNumber string                     // displayed in fake-mode logs
+	statusBatcher *NotificationStatusBatcher // nil = write status updates immediately
+	files         *OriginalStore             // loads attachments from S3
+	rateLimiter   *JobRateLimiter            // "channel:sms" paces Telnyx sends; nil = unlimited
 }
 
 // Work executes the notification job
@@ -91,11 +186,22 @@ func (w *NotificationWorker) Work(ctx context.Context, job *river.Job[Notificati
 		w.markNotificationFailed(ctx, job.Args.NotificationID, fmt.Sprintf("Rendering error: %v", err))
 		return nil // Don't retry
 	}
+	if template.TrackEngagement {
+		w.renderer.TrackEngagement(rendered, job.Args.NotificationID)
+	}
+
+	// Channels the user turned off for the template's category (v0.138.0)
+	categoryOff, err := w.categoryOptOuts(ctx, job.Args.UserID, template.Category, job.Args.Channels)
+	if err != nil {
+		log.Printf("[Job %d] Error fetching category preferences: %v", job.ID, err)
+		return fmt.Errorf("failed to fetch category preferences: %w", err)
+	}
 
 	// 4. Send via requested channels (respecting preferences)
 	var channelsSent []string
 	var channelsFailed []string
 	var lastError error
+	var emailServer string // SMTP server that accepted the email
 
 	for _, channel := range job.Args.Channels {
 		// Check if user has this channel enabled
@@ -103,15 +209,28 @@ func (w *NotificationWorker) Work(ctx context.Context, job *river.Job[Notificati
 			log.Printf("[Job %d] Skipping channel %s (disabled by user)", job.ID, channel)
 			continue
 		}
+		if categoryOff[channel] {
+			log.Printf("[Job %d] Skipping channel %s (category %s disabled by user)", job.ID, channel, template.Category)
+			continue
+		}
 
 		switch channel {
 		case "email":
-			if err := w.sendEmail(ctx, prefs.Email, rendered); err != nil {
+			attachments, err := w.loadAttachments(ctx, job.Args.Attachments)
+			if err != nil {
+				log.Printf("[Job %d] Failed to load attachments: %v", job.ID, err)
+				channelsFailed = append(channelsFailed, "email")
+				lastError = err
+				continue
+			}
+			server, err := w.sendEmail(ctx, prefs.Email, job.Args.EntityType, job.Args.EntityID, rendered, attachments)
+			if err != nil {
 				log.Printf("[Job %d] Failed to send email: %v", job.ID, err)
 				channelsFailed = append(channelsFailed, "email")
 				lastError = err
 			} else {
 				channelsSent = append(channelsSent, "email")
+				emailServer = server
 			}
 
 		case "sms":
@@ -131,7 +250,13 @@ func (w *NotificationWorker) Work(ctx context.Context, job *river.Job[Notificati
 		}
 	}
 
-	// 5. Update notification status
+	// 5. Snapshot what was sent for notification search (v0.84.0)
+	w.recordDelivery(ctx, job.Args, template.Version, prefs, rendered, channelsSent, channelsFailed, emailServer, lastError)
+	if template.ArchiveRendered && len(channelsSent) > 0 {
+		logArchiveError(job.ID, w.archive(ctx, job, prefs, rendered, channelsSent, emailServer))
+	}
+
+	// 6. Update notification status
 	if len(channelsSent) > 0 {
 		w.markNotificationSent(ctx, job.Args.NotificationID, channelsSent, channelsFailed)
 		duration := time.Since(startTime)
@@ -214,12 +339,59 @@ func (w *NotificationWorker) getUserPreferences(ctx context.Context, userID stri
 	return &prefs, nil
 }
 
+// categoryOptOuts returns the channels, of those requested, on which the
+// user turned off the category. A user without a preference row for a
+// channel gets the category's default.
+func (w *NotificationWorker) categoryOptOuts(ctx context.Context, userID, category string, channels []string) (map[string]bool, error) {
+	if category == "" {
+		return nil, nil
+	}
+	var defaultEnabled bool
+	var enabled map[string]bool
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT c.default_enabled,
+		       COALESCE(jsonb_object_agg(p.channel, p.enabled) FILTER (WHERE p.channel IS NOT NULL), '{}')
+		FROM metadata.notification_categories c
+		LEFT JOIN metadata.notification_category_preferences p
+		       ON p.user_id = $1 AND p.category = c.name
+		WHERE c.name = $2
+		GROUP BY c.default_enabled
+	`, userID, category).Scan(&defaultEnabled, &enabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil // Unknown category: nothing to turn off
+	}
+	if err != nil {
+		return nil, err
+	}
+	return optedOutChannels(channels, defaultEnabled, enabled), nil
+}
+
+// optedOutChannels applies a user's category preference rows (channel ->
+// enabled) to channels; a channel without a row follows defaultEnabled
+func optedOutChannels(channels []string, defaultEnabled bool, enabled map[string]bool) map[string]bool {
+	optedOut := make(map[string]bool)
+	for _, channel := range channels {
+		on, chosen := enabled[channel]
+		if !chosen {
+			on = defaultEnabled
+		}
+		if !on {
+			optedOut[channel] = true
+		}
+	}
+	return optedOut
+}
+
 // NotificationTemplate holds template data
 type NotificationTemplate struct {
-	Subject string
-	HTML    string
-	Text    string
-	SMS     string
+	Subject         string
+	HTML            string
+	Text            string
+	SMS             string
+	TrackEngagement bool   // Rewrite links and add an open pixel (v0.107.0)
+	ArchiveRendered bool   // Keep a copy of what was sent (v0.118.0)
+	Version         int    // active_version, recorded with each send (v0.136.0); 0 if unknown
+	Category        string // Users can turn it off per channel (v0.138.0); "" = no category
 }
 
 // loadTemplate fetches template from database.
@@ -228,12 +400,49 @@ func (w *NotificationWorker) loadTemplate(ctx context.Context, templateName stri
 	return loadTemplateFromDB(ctx, w.dbPool, templateName)
 }
 
-// sendEmail sends email via SMTP with STARTTLS
-func (w *NotificationWorker) sendEmail(ctx context.Context, toEmail string, rendered *RenderedNotification) error {
+// loadAttachments downloads the notification's attachments from S3
+func (w *NotificationWorker) loadAttachments(ctx context.Context, attachments []NotificationAttachment) ([]emailAttachment, error) {
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+	if w.files == nil {
+		return nil, fmt.Errorf("attachments unavailable: no file store configured")
+	}
+	loaded := make([]emailAttachment, 0, len(attachments))
+	for _, a := range attachments {
+		data, _, err := w.files.Fetch(ctx, a.S3Bucket, a.S3Key)
+		if err != nil {
+			// "unavailable" makes isTransientError retry the job
+			return nil, fmt.Errorf("attachment %s unavailable: %w", a.S3Key, err)
+		}
+		loaded = append(loaded, emailAttachment{FileName: a.FileName, ContentType: a.ContentType, Data: data})
+	}
+	return loaded, nil
+}
+
+// sendEmail sends email via SMTP with STARTTLS, threaded with earlier email
+// about the same record. Returns the SMTP server that accepted it, or ""
+// when nothing was sent.
+func (w *NotificationWorker) sendEmail(ctx context.Context, toEmail, entityType, entityID string, rendered *RenderedNotification, attachments []emailAttachment) (server string, err error) {
 	// Skip test/dummy email addresses if configured
 	if w.smtpConfig.SkipTestEmails && isTestEmail(toEmail) {
 		log.Printf("⚠️  Skipping test email: %s (SkipTestEmails=true)", toEmail)
-		return nil // Return success to mark notification as sent (prevents retries)
+		return "", nil // Return success to mark notification as sent (prevents retries)
+	}
+	suppressed, err := w.smtpConfig.Suppressions.Suppressed(ctx, []string{toEmail})
+	if err != nil {
+		return "", err
+	}
+	if reason, ok := suppressed[toEmail]; ok {
+		log.Printf("⚠️  Skipping suppressed email: %s (%s)", toEmail, reason)
+		return "", fmt.Errorf("%s (%s): %w", toEmail, reason, errEmailSuppressed)
+	}
+	if w.smtpConfig.DryRun.Simulates(dryRunEmail) {
+		w.smtpConfig.DryRun.Record(ctx, dryRunEmail, "email.send", toEmail, map[string]any{
+			"subject":     rendered.Subject,
+			"attachments": len(attachments),
+		})
+		return "", nil
 	}
 
 	// Parse RFC 5322 format for From header vs SMTP envelope
@@ -246,110 +455,37 @@ func (w *NotificationWorker) sendEmail(ctx context.Context, toEmail string, rend
 		domain = envelopeFrom[atIdx+1:]
 	}
 
-	// Generate unique values per message (v0.25.0)
-	boundary := generateBoundary()
 	messageID := generateMessageID(domain)
+	contentType, body := buildEmailBody(rendered, attachments)
 
-	// Build MIME email with multipart/alternative (HTML + plain text)
 	headers := make(map[string]string)
 	headers["From"] = headerFrom // Full RFC 5322 format with display name
 	headers["To"] = toEmail
 	headers["Subject"] = rendered.Subject
 	headers["Message-ID"] = messageID
 	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = fmt.Sprintf("multipart/alternative; boundary=\"%s\"", boundary)
+	headers["Content-Type"] = contentType
 	headers["Date"] = time.Now().Format(time.RFC1123Z)
+	setThreadHeaders(headers, entityType, entityID, domain)
 
 	// Add Reply-To header if configured
 	if w.smtpConfig.ReplyTo != "" {
 		headers["Reply-To"] = w.smtpConfig.ReplyTo
 	}
 
-	// Build email body
+	// Build email
 	var emailBody strings.Builder
 	for key, value := range headers {
 		emailBody.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
 	}
 	emailBody.WriteString("\r\n")
+	emailBody.WriteString(body)
 
-	// Plain text part
-	emailBody.WriteString("--" + boundary + "\r\n")
-	emailBody.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-	emailBody.WriteString("Content-Transfer-Encoding: 7bit\r\n\r\n")
-	emailBody.WriteString(rendered.Text)
-	emailBody.WriteString("\r\n\r\n")
-
-	// HTML part
-	emailBody.WriteString("--" + boundary + "\r\n")
-	emailBody.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-	emailBody.WriteString("Content-Transfer-Encoding: 7bit\r\n\r\n")
-	emailBody.WriteString(rendered.HTML)
-	emailBody.WriteString("\r\n\r\n")
-
-	emailBody.WriteString("--" + boundary + "--")
-
-	// Connect to SMTP server
-	serverAddr := net.JoinHostPort(w.smtpConfig.Host, w.smtpConfig.Port)
-	conn, err := net.DialTimeout("tcp", serverAddr, 10*time.Second)
-	if err != nil {
-		return fmt.Errorf("failed to connect to SMTP server: %w", err)
-	}
-
-	client, err := smtp.NewClient(conn, w.smtpConfig.Host)
-	if err != nil {
-		return fmt.Errorf("failed to create SMTP client: %w", err)
-	}
-	defer client.Close()
-
-	// Start TLS if supported (STARTTLS)
-	if ok, _ := client.Extension("STARTTLS"); ok {
-		tlsConfig := &tls.Config{
-			ServerName: w.smtpConfig.Host,
-			MinVersion: tls.VersionTLS12,
-		}
-		if err = client.StartTLS(tlsConfig); err != nil {
-			return fmt.Errorf("STARTTLS failed: %w", err)
-		}
-	}
-
-	// Authenticate if credentials provided
-	if w.smtpConfig.Username != "" && w.smtpConfig.Password != "" {
-		auth := smtp.PlainAuth("", w.smtpConfig.Username, w.smtpConfig.Password, w.smtpConfig.Host)
-		if err = client.Auth(auth); err != nil {
-			return fmt.Errorf("SMTP authentication failed: %w", err)
-		}
-	}
-
-	// Send email (SMTP envelope uses email-only, not display name)
-	if err = client.Mail(envelopeFrom); err != nil {
-		return fmt.Errorf("MAIL FROM failed: %w", err)
-	}
-
-	if err = client.Rcpt(toEmail); err != nil {
-		return fmt.Errorf("RCPT TO failed: %w", err)
-	}
-
-	writer, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("DATA command failed: %w", err)
-	}
-
-	_, err = writer.Write([]byte(emailBody.String()))
-	if err != nil {
-		writer.Close()
-		return fmt.Errorf("failed to write email body: %w", err)
-	}
-
-	err = writer.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close DATA writer: %w", err)
-	}
-
-	if err = client.Quit(); err != nil {
-		log.Printf("Warning: QUIT command failed: %v", err)
-	}
+	// Time the SMTP conversation (skipped test addresses aren't sends)
+	sendStarted := time.Now()
+	defer func() { workerMetrics.ObserveSMTPSend(sendStarted, err) }()
 
-	return nil
+	return w.smtpConfig.send(ctx, envelopeFrom, []string{toEmail}, []byte(emailBody.String()))
 }
 
 // isTestEmail detects RFC 2606 reserved test/documentation domains
@@ -385,6 +521,11 @@ func (w *NotificationWorker) sendSMS(ctx context.Context, jobID int64, userID st
 		return &TelnyxError{IsPermanent: true, Message: fmt.Sprintf("invalid phone number: %v", err)}
 	}
 
+	if w.dryRun.Simulates(dryRunSMS) {
+		w.dryRun.Record(ctx, dryRunSMS, "sms.send", phone, map[string]any{"length": len(rendered.SMS)})
+		return nil
+	}
+
 	if w.smsFakeMode {
 		// Dev mode: log to stdout instead of calling Telnyx
 		log.Printf("[Job %d] ╔══════════════════════════════════════════════╗", jobID)
@@ -405,6 +546,12 @@ func (w *NotificationWorker) sendSMS(ctx context.Context, jobID int64, userID st
 		return nil
 	}
 
+	// send_notification jobs also carry email, so SMS is paced here rather
+	// than by the job kind's limit
+	if err := w.rateLimiter.Wait(ctx, "channel:sms"); err != nil {
+		return fmt.Errorf("waiting for SMS rate limit: %w", err)
+	}
+
 	telnyxErr := w.telnyxClient.Send(phone, rendered.SMS)
 	if telnyxErr == nil {
 		return nil // success
@@ -434,8 +581,122 @@ func truncate(s string, maxLen int) string {
 	return s[:maxLen-1] + "…"
 }
 
+// archive copies the sent notification into metadata.notification_archive
+// (v0.118.0). Recipients are the addresses of the channels that went out.
+func (w *NotificationWorker) archive(ctx context.Context, job *river.Job[NotificationArgs], prefs *UserPreferences,
+	rendered *RenderedNotification, channelsSent []string, emailServer string) error {
+	var recipients []string
+	for _, channel := range channelsSent {
+		switch channel {
+		case "email":
+			recipients = append(recipients, prefs.Email)
+		case "sms":
+			recipients = append(recipients, prefs.Phone)
+		}
+	}
+	attachmentNames := make([]string, len(job.Args.Attachments))
+	for i, a := range job.Args.Attachments {
+		attachmentNames[i] = a.FileName
+	}
+	return archiveRendered(ctx, w.dbPool, NotificationArchiveEntry{
+		NotificationID:  &job.Args.NotificationID,
+		JobID:           job.ID,
+		TemplateName:    job.Args.TemplateName,
+		EntityType:      job.Args.EntityType,
+		EntityID:        job.Args.EntityID,
+		Recipients:      recipients,
+		ChannelsSent:    channelsSent,
+		AttachmentNames: attachmentNames,
+		EmailServer:     emailServer,
+		Rendered:        rendered,
+	})
+}
+
+// recordDelivery upserts the notification's metadata.notification_log row:
+// the addresses used, the rendered content, the channel results, the SMTP
+// server that took the email and, on the attempt that first sent something,
+// the queue latency (see notification_sla.go). A failure is logged, never
+// retried; the notification itself was handled.
+func (w *NotificationWorker) recordDelivery(ctx context.Context, args NotificationArgs, templateVersion int, prefs *UserPreferences,
+	rendered *RenderedNotification, channelsSent, channelsFailed []string, emailServer string, lastError error) {
+	email, phone, smsText, attachmentNames, errorMessage := deliveryColumns(args, prefs, rendered, lastError)
+	_, err := w.dbPool.Exec(ctx, `
+		INSERT INTO metadata.notification_log (
+			notification_id, recipient_name, recipient_email, recipient_phone,
+			subject, body_text, sms_text, attachment_names,
+			channels_sent, channels_failed, error_message, email_provider, queue_latency, template_version
+		)
+		SELECT $1, u.display_name, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''),
+		       CASE WHEN cardinality($9::TEXT[]) > 0 THEN NOW() - n.created_at END, NULLIF($13, 0)
+		FROM metadata.notifications n
+		LEFT JOIN metadata.civic_os_users u ON u.id = $2
+		WHERE n.id = $1
+		ON CONFLICT (notification_id) DO UPDATE SET
+			recipient_name = EXCLUDED.recipient_name,
+			recipient_email = EXCLUDED.recipient_email,
+			recipient_phone = EXCLUDED.recipient_phone,
+			subject = EXCLUDED.subject,
+			body_text = EXCLUDED.body_text,
+			sms_text = EXCLUDED.sms_text,
+			attachment_names = EXCLUDED.attachment_names,
+			channels_sent = EXCLUDED.channels_sent,
+			channels_failed = EXCLUDED.channels_failed,
+			error_message = EXCLUDED.error_message,
+			email_provider = COALESCE(EXCLUDED.email_provider, metadata.notification_log.email_provider),
+			queue_latency = COALESCE(metadata.notification_log.queue_latency, EXCLUDED.queue_latency),
+			template_version = EXCLUDED.template_version,
+			attempts = metadata.notification_log.attempts + 1,
+			delivered_at = NOW()
+	`, args.NotificationID, args.UserID, email, phone,
+		rendered.Subject, rendered.Text, smsText, attachmentNames,
+		nonNilStrings(channelsSent), nonNilStrings(channelsFailed), errorMessage, emailServer, templateVersion)
+	if err != nil {
+		log.Printf("Failed to record notification delivery: %v", err)
+	}
+}
+
+// deliveryColumns returns the notification_log values that depend on the
+// channels asked for: an address is recorded only for a requested channel the
+// user has one for, and the error only when the last attempt failed
+func deliveryColumns(args NotificationArgs, prefs *UserPreferences, rendered *RenderedNotification,
+	lastError error) (email, phone, smsText *string, attachmentNames []string, errorMessage *string) {
+	for _, channel := range args.Channels {
+		switch {
+		case channel == "email" && prefs.Email != "":
+			email = &prefs.Email
+		case channel == "sms" && prefs.Phone != "":
+			phone = &prefs.Phone
+			smsText = &rendered.SMS
+		}
+	}
+	attachmentNames = make([]string, len(args.Attachments))
+	for i, a := range args.Attachments {
+		attachmentNames[i] = a.FileName
+	}
+	if lastError != nil {
+		msg := lastError.Error()
+		errorMessage = &msg
+	}
+	return email, phone, smsText, attachmentNames, errorMessage
+}
+
+// nonNilStrings turns a nil slice into an empty one for NOT NULL array columns
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
 // markNotificationSent updates notification status to 'sent'
 func (w *NotificationWorker) markNotificationSent(ctx context.Context, notificationID string, channelsSent, channelsFailed []string) {
+	if w.statusBatcher != nil {
+		if err := w.statusBatcher.MarkSent(notificationID, channelsSent, channelsFailed); err != nil {
+			log.Printf("Failed to buffer notification status: %v", err)
+		}
+		return
+	}
+
 	_, err := w.dbPool.Exec(ctx, `
 		UPDATE metadata.notifications
 		SET status = 'sent',
@@ -452,6 +713,13 @@ func (w *NotificationWorker) markNotificationSent(ctx context.Context, notificat
 
 // markNotificationFailed updates notification status to 'failed'
 func (w *NotificationWorker) markNotificationFailed(ctx context.Context, notificationID string, errorMsg string) {
+	if w.statusBatcher != nil {
+		if err := w.statusBatcher.MarkFailed(notificationID, errorMsg); err != nil {
+			log.Printf("Failed to buffer notification status: %v", err)
+		}
+		return
+	}
+
 	_, err := w.dbPool.Exec(ctx, `
 		UPDATE metadata.notifications
 		SET status = 'failed',
@@ -469,6 +737,9 @@ func isTransientError(err error) bool {
 	if err == nil {
 		return false
 	}
+	if errors.Is(err, errEmailSuppressed) {
+		return false
+	}
 
 	// Network errors, timeouts, rate limits = retry
 	// Invalid email, template errors = don't retry
@@ -560,6 +831,63 @@ func generateMessageID(domain string) string {
 	return fmt.Sprintf("<%d.%d@%s>", timestamp, randomPart, domain)
 }
 
+// buildEmailBody returns the Content-Type header and MIME body of an email:
+// multipart/alternative (plain text + HTML), wrapped in multipart/mixed with
+// base64 parts when there are attachments (v0.83.0)
+func buildEmailBody(rendered *RenderedNotification, attachments []emailAttachment) (contentType, body string) {
+	boundary := generateBoundary()
+
+	var alt strings.Builder
+	// Plain text part
+	alt.WriteString("--" + boundary + "\r\n")
+	alt.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	alt.WriteString("Content-Transfer-Encoding: 7bit\r\n\r\n")
+	alt.WriteString(rendered.Text)
+	alt.WriteString("\r\n\r\n")
+
+	// HTML part
+	alt.WriteString("--" + boundary + "\r\n")
+	alt.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	alt.WriteString("Content-Transfer-Encoding: 7bit\r\n\r\n")
+	alt.WriteString(rendered.HTML)
+	alt.WriteString("\r\n\r\n")
+
+	alt.WriteString("--" + boundary + "--")
+
+	altContentType := fmt.Sprintf("multipart/alternative; boundary=\"%s\"", boundary)
+	if len(attachments) == 0 {
+		return altContentType, alt.String()
+	}
+
+	mixedBoundary := generateBoundary()
+	var mixed strings.Builder
+	mixed.WriteString("--" + mixedBoundary + "\r\n")
+	mixed.WriteString("Content-Type: " + altContentType + "\r\n\r\n")
+	mixed.WriteString(alt.String())
+	mixed.WriteString("\r\n\r\n")
+
+	for _, a := range attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		fileName := mime.QEncoding.Encode("UTF-8", a.FileName)
+		mixed.WriteString("--" + mixedBoundary + "\r\n")
+		mixed.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", contentType, fileName))
+		mixed.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", fileName))
+		mixed.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			mixed.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		mixed.WriteString(encoded + "\r\n\r\n")
+	}
+	mixed.WriteString("--" + mixedBoundary + "--")
+
+	return fmt.Sprintf("multipart/mixed; boundary=\"%s\"", mixedBoundary), mixed.String()
+}
+
 // generateBoundary creates a unique MIME boundary for multipart emails.
 func generateBoundary() string {
 	return fmt.Sprintf("----=_Part_%d_%d", time.Now().UnixNano(), rand.Int31())
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildEmailBody_WithoutAttachments(t *testing.T) {
+	contentType, body := buildEmailBody(&RenderedNotification{Text: "plain", HTML: "<p>html</p>"}, nil)
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q (%v), want multipart/alternative", contentType, err)
+	}
+	parts := readParts(t, body, params["boundary"])
+	if len(parts) != 2 || parts[0].contentType != "text/plain; charset=UTF-8" || parts[1].contentType != "text/html; charset=UTF-8" {
+		t.Errorf("parts = %+v, want text then HTML", parts)
+	}
+}
+
+func TestBuildEmailBody_WithAttachment(t *testing.T) {
+	pdf := bytes.Repeat([]byte("%PDF receipt "), 20) // long enough to wrap base64 lines
+	contentType, body := buildEmailBody(&RenderedNotification{Text: "plain", HTML: "<p>html</p>"}, []emailAttachment{
+		{FileName: "receipt-000042.pdf", ContentType: "application/pdf", Data: pdf},
+	})
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("content type = %q (%v), want multipart/mixed", contentType, err)
+	}
+	parts := readParts(t, body, params["boundary"])
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want alternative body + attachment", len(parts))
+	}
+	if !strings.HasPrefix(parts[0].contentType, "multipart/alternative") {
+		t.Errorf("first part = %q, want the alternative body", parts[0].contentType)
+	}
+
+	att := parts[1]
+	if att.disposition != `attachment; filename="receipt-000042.pdf"` {
+		t.Errorf("disposition = %q", att.disposition)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(att.body), "\r\n") {
+		if len(line) > 76 {
+			t.Fatalf("base64 line of %d chars, want <= 76", len(line))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(strings.TrimSpace(att.body), "\r\n", ""))
+	if err != nil || !bytes.Equal(decoded, pdf) {
+		t.Errorf("attachment does not round-trip (err %v)", err)
+	}
+}
+
+func TestDeliveryColumns(t *testing.T) {
+	args := NotificationArgs{
+		Channels:    []string{"email", "sms"},
+		Attachments: []NotificationAttachment{{FileName: "permit.pdf"}},
+	}
+	prefs := &UserPreferences{Email: "resident@example.com", Phone: "+15555550100"}
+	rendered := &RenderedNotification{SMS: "Permit approved"}
+
+	// Delivered: both addresses and the SMS text, no error
+	email, phone, smsText, attachmentNames, errorMessage := deliveryColumns(args, prefs, rendered, nil)
+	if email == nil || *email != prefs.Email || phone == nil || *phone != prefs.Phone {
+		t.Errorf("addresses = %v, %v, want both", email, phone)
+	}
+	if smsText == nil || *smsText != rendered.SMS {
+		t.Errorf("sms_text = %v, want the rendered SMS", smsText)
+	}
+	if !reflect.DeepEqual(attachmentNames, []string{"permit.pdf"}) {
+		t.Errorf("attachment_names = %v", attachmentNames)
+	}
+	if errorMessage != nil {
+		t.Errorf("error_message = %q, want NULL", *errorMessage)
+	}
+
+	// Failed: the error is kept; an email-only user has no phone or SMS text
+	args.Channels = []string{"email"}
+	args.Attachments = nil
+	email, phone, smsText, attachmentNames, errorMessage = deliveryColumns(args, prefs, rendered, errors.New("smtp: 550 mailbox unavailable"))
+	if email == nil || phone != nil || smsText != nil {
+		t.Errorf("email, phone, sms_text = %v, %v, %v, want only the email", email, phone, smsText)
+	}
+	if attachmentNames == nil || len(attachmentNames) != 0 {
+		t.Errorf("attachment_names = %#v, want empty, not NULL", attachmentNames)
+	}
+	if errorMessage == nil || *errorMessage != "smtp: 550 mailbox unavailable" {
+		t.Errorf("error_message = %v, want the last error", errorMessage)
+	}
+	if got := nonNilStrings(nil); got == nil || len(got) != 0 {
+		t.Errorf("channels_sent = %#v, want empty, not NULL", got)
+	}
+
+	// A requested channel the user has no address for records nothing
+	email, _, _, _, _ = deliveryColumns(args, &UserPreferences{}, rendered, nil)
+	if email != nil {
+		t.Errorf("recipient_email = %q, want NULL", *email)
+	}
+}
+
+type mimePart struct {
+	contentType, disposition, body string
+}
+
+func readParts(t *testing.T, body, boundary string) []mimePart {
+	t.Helper()
+	var parts []mimePart
+	r := multipart.NewReader(strings.NewReader(body), boundary)
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		data, _ := io.ReadAll(p)
+		parts = append(parts, mimePart{
+			contentType: p.Header.Get("Content-Type"),
+			disposition: p.Header.Get("Content-Disposition"),
+			body:        string(data),
+		})
+	}
+}
+
+func TestOptedOutChannels(t *testing.T) {
+	channels := []string{"email", "sms"}
+	tests := []struct {
+		name           string
+		defaultEnabled bool
+		enabled        map[string]bool
+		want           map[string]bool
+	}{
+		{"on by default, no rows", true, nil, map[string]bool{}},
+		{"off by default, no rows", false, nil, map[string]bool{"email": true, "sms": true}},
+		{"turned off for email", true, map[string]bool{"email": false}, map[string]bool{"email": true}},
+		{"turned on for sms", false, map[string]bool{"sms": true}, map[string]bool{"email": true}},
+		{"explicit rows match the default", true, map[string]bool{"email": true, "sms": true}, map[string]bool{}},
+		{"row for a channel not requested", true, map[string]bool{"push": false}, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := optedOutChannels(channels, tt.defaultEnabled, tt.enabled); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("optedOutChannels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategoryOptOuts_NoCategory(t *testing.T) {
+	// Templates without a category never query preferences
+	got, err := (&NotificationWorker{}).categoryOptOuts(context.Background(), "user", "", []string{"email"})
+	if err != nil || got != nil {
+		t.Errorf("categoryOptOuts() = %v, %v, want nil, nil", got, err)
+	}
+}
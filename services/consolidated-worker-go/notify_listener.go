@@ -0,0 +1,304 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// NOTIFY Listener
+// ============================================================================
+//
+// Database triggers announce work with pg_notify() instead of inserting
+// River jobs themselves, and NotifyListener turns each notification into a
+// job through the River client. One connection LISTENs on every registered
+// channel.
+//
+// NOTIFY is not durable: notifications sent while no worker is listening are
+// lost, and a Handle that fails is only logged. Each channel's Resync
+// enqueues a job for every row its table still shows as waiting, judged by
+// the row's own status columns. It runs after every (re)connect and as the
+// notify_resync maintenance task, so a missed or failed notification is
+// picked up within one task interval however old its row is. The jobs it
+// inserts must be unique by args while queued or running
+// (notifyJobUniqueStates), so rows whose job is still live aren't queued
+// twice.
+
+// NotifyChannel is a NOTIFY channel and how to turn its notifications into jobs
+type NotifyChannel struct {
+	Name string
+
+	// Debounce skips a notification arriving within Debounce of the last one
+	// handled with the same key; 0 handles every notification
+	Debounce time.Duration
+
+	// Key returns the debounce key for a payload and whether to handle it at
+	// all; nil handles every payload, keyed by the payload itself
+	Key func(payload string) (key string, ok bool)
+
+	// Handle enqueues the job for one notification
+	Handle func(ctx context.Context, payload string) error
+
+	// Resync, if set, enqueues jobs for work whose notification may have been
+	// missed or failed to enqueue
+	Resync func(ctx context.Context) error
+}
+
+// NotifyListener dispatches notifications on its registered channels
+type NotifyListener struct {
+	databaseURL string
+	channels    []*NotifyChannel
+
+	mu          sync.Mutex
+	lastHandled map[notifyDebounceKey]time.Time
+}
+
+type notifyDebounceKey struct {
+	channel string
+	key     string
+}
+
+// notifyDebouncePruneSize is how many debounce entries are kept before
+// expired ones are dropped
+const notifyDebouncePruneSize = 1024
+
+// NewNotifyListener creates a listener; register channels before Start
+func NewNotifyListener(databaseURL string) *NotifyListener {
+	return &NotifyListener{
+		databaseURL: databaseURL,
+		lastHandled: make(map[notifyDebounceKey]time.Time),
+	}
+}
+
+// Register adds a channel. Not safe to call after Start.
+func (l *NotifyListener) Register(channel NotifyChannel) {
+	l.channels = append(l.channels, &channel)
+}
+
+// Channels returns the registered channel names
+func (l *NotifyListener) Channels() []string {
+	names := make([]string, len(l.channels))
+	for i, channel := range l.channels {
+		names[i] = channel.Name
+	}
+	return names
+}
+
+// Start LISTENs in a goroutine until ctx is cancelled, reconnecting after errors
+func (l *NotifyListener) Start(ctx context.Context) {
+	if len(l.channels) == 0 {
+		return
+	}
+	go func() {
+		for {
+			err := l.listen(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[Listener] Reconnecting in 5s: %v", err)
+			time.Sleep(5 * time.Second)
+		}
+	}()
+}
+
+func (l *NotifyListener) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, l.databaseURL)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	for _, channel := range l.channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel.Name}.Sanitize()); err != nil {
+			return fmt.Errorf("listen %s: %w", channel.Name, err)
+		}
+		log.Printf("[Listener] Listening on channel: %s", channel.Name)
+	}
+
+	// LISTEN is in place, so anything the resync misses arrives as a notification
+	if err := l.resync(ctx); err != nil {
+		log.Printf("[Listener] %v", err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait: %w", err)
+		}
+		l.dispatch(ctx, notification.Channel, notification.Payload, time.Now())
+	}
+}
+
+// dispatch hands a notification to its channel unless filtered or debounced
+func (l *NotifyListener) dispatch(ctx context.Context, channelName, payload string, now time.Time) {
+	var channel *NotifyChannel
+	for _, c := range l.channels {
+		if c.Name == channelName {
+			channel = c
+			break
+		}
+	}
+	if channel == nil {
+		return
+	}
+
+	key, ok := payload, true
+	if channel.Key != nil {
+		key, ok = channel.Key(payload)
+	}
+	if !ok {
+		return
+	}
+	if l.debounced(channel, key, now) {
+		log.Printf("[Listener] Debounced %s notification (payload: %q)", channel.Name, payload)
+		return
+	}
+
+	if err := channel.Handle(ctx, payload); err != nil {
+		log.Printf("[Listener] Failed to handle %s notification (payload: %q): %v", channel.Name, payload, err)
+	}
+}
+
+// resync runs every channel's Resync, returning the failures joined
+func (l *NotifyListener) resync(ctx context.Context) error {
+	var errs []error
+	for _, channel := range l.channels {
+		if channel.Resync == nil {
+			continue
+		}
+		if err := channel.Resync(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to resync %s: %w", channel.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MaintenanceTask resyncs every channel on a schedule, so work isn't left
+// waiting for the next reconnect
+func (l *NotifyListener) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "notify_resync",
+		Description: "Queue jobs for work whose NOTIFY was missed or failed to enqueue",
+		Interval:    5 * time.Minute,
+		Jitter:      30 * time.Second,
+		Run: func(ctx context.Context) (string, error) {
+			if err := l.resync(ctx); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Resynced %d channel(s)", len(l.channels)), nil
+		},
+	}
+}
+
+// debounced reports whether key was handled on channel less than its
+// Debounce ago, and records now as its last handling otherwise
+func (l *NotifyListener) debounced(channel *NotifyChannel, key string, now time.Time) bool {
+	if channel.Debounce <= 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k := notifyDebounceKey{channel: channel.Name, key: key}
+	if last, ok := l.lastHandled[k]; ok && now.Sub(last) < channel.Debounce {
+		return true
+	}
+	l.lastHandled[k] = now
+
+	if len(l.lastHandled) > notifyDebouncePruneSize {
+		for k, last := range l.lastHandled {
+			if now.Sub(last) >= l.debounceFor(k.channel) {
+				delete(l.lastHandled, k)
+			}
+		}
+	}
+	return false
+}
+
+func (l *NotifyListener) debounceFor(channelName string) time.Duration {
+	for _, channel := range l.channels {
+		if channel.Name == channelName {
+			return channel.Debounce
+		}
+	}
+	return 0
+}
+
+// ============================================================================
+// Enqueue Helpers
+// ============================================================================
+
+// notifyJobUniqueStates deduplicates a job while an earlier one for the same
+// row is still queued or running, but not after it finished, so the row can
+// be processed again later
+var notifyJobUniqueStates = []rivertype.JobState{
+	rivertype.JobStateAvailable,
+	rivertype.JobStatePending,
+	rivertype.JobStateRetryable,
+	rivertype.JobStateRunning,
+	rivertype.JobStateScheduled,
+}
+
+// insertJobsFromQuery inserts one job per row of query, built by scan, and
+// returns how many were inserted rather than skipped as duplicates
+func insertJobsFromQuery(ctx context.Context, dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx],
+	scan func(pgx.Rows) (river.JobArgs, error), query string, args ...any) (int, error) {
+	rows, err := dbPool.Query(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var params []river.InsertManyParams
+	for rows.Next() {
+		jobArgs, err := scan(rows)
+		if err != nil {
+			return 0, err
+		}
+		params = append(params, river.InsertManyParams{Args: jobArgs})
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(params) == 0 {
+		return 0, nil
+	}
+
+	results, err := riverClient.InsertMany(ctx, params)
+	if err != nil {
+		return 0, err
+	}
+	inserted := 0
+	for _, result := range results {
+		if !result.UniqueSkippedAsDuplicate {
+			inserted++
+		}
+	}
+	return inserted, nil
+}
+
+// resyncJobs runs insertJobsFromQuery for a channel's Resync and logs the
+// jobs whose notification was missed
+func resyncJobs(ctx context.Context, channel string, dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx],
+	scan func(pgx.Rows) (river.JobArgs, error), query string) error {
+	inserted, err := insertJobsFromQuery(ctx, dbPool, riverClient, scan, query)
+	if err != nil {
+		return err
+	}
+	if inserted > 0 {
+		log.Printf("[Listener] Resync of %s queued %d missed job(s)", channel, inserted)
+	}
+	return nil
+}
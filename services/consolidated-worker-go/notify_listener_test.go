@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyListener_Dispatch(t *testing.T) {
+	var files, parses []string
+	l := NewNotifyListener("")
+	l.Register(NotifyChannel{
+		Name: "file_uploaded",
+		Handle: func(ctx context.Context, payload string) error {
+			files = append(files, payload)
+			return nil
+		},
+	})
+	l.Register(sourceCodeChannel(func(ctx context.Context) error {
+		parses = append(parses, "parse")
+		return nil
+	}))
+
+	ctx := context.Background()
+	start := time.Now()
+	l.dispatch(ctx, "file_uploaded", "a", start)
+	l.dispatch(ctx, "file_uploaded", "a", start) // no debounce on this channel
+	l.dispatch(ctx, "unknown", "b", start)
+	if len(files) != 2 {
+		t.Errorf("file_uploaded handled %d times, want 2", len(files))
+	}
+
+	l.dispatch(ctx, "pgrst", "reload schema", start)
+	l.dispatch(ctx, "pgrst", "", start.Add(time.Second))                // debounced
+	l.dispatch(ctx, "pgrst", "reload config", start.Add(2*time.Second)) // debounced, same key
+	l.dispatch(ctx, "pgrst", "something else", start.Add(10*time.Second))
+	l.dispatch(ctx, "pgrst", "", start.Add(6*time.Second))
+	if len(parses) != 2 {
+		t.Errorf("pgrst handled %d times, want 2", len(parses))
+	}
+
+	if got := l.Channels(); len(got) != 2 || got[0] != "file_uploaded" || got[1] != "pgrst" {
+		t.Errorf("Channels() = %v", got)
+	}
+}
+
+func TestNotifyListener_DebouncePerKey(t *testing.T) {
+	handled := map[string]int{}
+	l := NewNotifyListener("")
+	l.Register(NotifyChannel{
+		Name:     "series_changed",
+		Debounce: 2 * time.Second,
+		Handle: func(ctx context.Context, payload string) error {
+			handled[payload]++
+			return nil
+		},
+	})
+
+	ctx := context.Background()
+	start := time.Now()
+	l.dispatch(ctx, "series_changed", "1", start)
+	l.dispatch(ctx, "series_changed", "2", start)
+	l.dispatch(ctx, "series_changed", "1", start.Add(time.Second))
+	l.dispatch(ctx, "series_changed", "1", start.Add(3*time.Second))
+	if handled["1"] != 2 || handled["2"] != 1 {
+		t.Errorf("handled = %v, want series 1 twice and series 2 once", handled)
+	}
+}
+
+func TestNotifyListener_DebouncePrunesExpiredKeys(t *testing.T) {
+	l := NewNotifyListener("")
+	l.Register(NotifyChannel{Name: "series_changed", Debounce: time.Second, Handle: func(context.Context, string) error { return nil }})
+
+	start := time.Now()
+	for i := range notifyDebouncePruneSize {
+		l.dispatch(context.Background(), "series_changed", strconv.Itoa(i), start)
+	}
+	l.dispatch(context.Background(), "series_changed", "late", start.Add(time.Minute))
+	if len(l.lastHandled) > notifyDebouncePruneSize {
+		t.Errorf("lastHandled has %d entries after pruning", len(l.lastHandled))
+	}
+}
+
+func TestNotifyListener_ResyncTask(t *testing.T) {
+	var resynced []string
+	l := NewNotifyListener("")
+	for _, name := range []string{"file_uploaded", "notification_created"} {
+		l.Register(NotifyChannel{
+			Name:   name,
+			Handle: func(context.Context, string) error { return nil },
+			Resync: func(context.Context) error {
+				resynced = append(resynced, name)
+				if name == "file_uploaded" {
+					return errors.New("connection refused")
+				}
+				return nil
+			},
+		})
+	}
+	l.Register(sourceCodeChannel(func(context.Context) error { return nil })) // no Resync
+
+	task := l.MaintenanceTask()
+	if task.Name != "notify_resync" || task.Interval <= 0 {
+		t.Errorf("task = %+v", task)
+	}
+	_, err := task.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "file_uploaded") {
+		t.Errorf("Run() error = %v, want the file_uploaded failure", err)
+	}
+	if len(resynced) != 2 {
+		t.Errorf("resynced %v, want every channel with a Resync despite the failure", resynced)
+	}
+}
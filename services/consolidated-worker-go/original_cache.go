@@ -0,0 +1,378 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ============================================================================
+// Original File Cache
+//
+// Size- and age-bounded LRU cache of S3 originals on local disk, shared by
+// every worker that processes original files through one OriginalStore
+// (thumbnail generation today). Retries and repeated passes over the same
+// file skip the download.
+//
+// Entries are keyed by bucket + key + ETag, so an object overwritten in place
+// is never served stale: the store checks the current ETag with HeadObject
+// before looking in the cache. The index lives in memory: the cache directory
+// is cleared on startup rather than re-indexed.
+// ============================================================================
+
+// OriginalCache is a disk-backed LRU of original file bytes.
+// A nil *OriginalCache is valid and caches nothing.
+type OriginalCache struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration // 0 = entries never expire
+	now      func() time.Time
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List               // front = most recently used
+	entries map[string]*list.Element // cache key -> element holding *cacheEntry
+	stats   OriginalCacheStats
+}
+
+type cacheEntry struct {
+	key      string
+	size     int64
+	storedAt time.Time
+}
+
+// OriginalCacheStats are cumulative counters since startup plus current usage.
+type OriginalCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64 // removed to stay within the size limit
+	Expired   int64 // removed because they outlived the TTL
+	Entries   int
+	Bytes     int64
+}
+
+// NewOriginalCache prepares dir for use as a cache of at most maxBytes whose
+// entries expire after ttl (0 disables expiry).
+// Returns nil (caching disabled) when dir is empty or maxBytes <= 0.
+func NewOriginalCache(dir string, maxBytes int64, ttl time.Duration) (*OriginalCache, error) {
+	if dir == "" || maxBytes <= 0 {
+		return nil, nil
+	}
+
+	// Start empty: anything left from a previous run isn't in the index
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to clear cache directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &OriginalCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}, nil
+}
+
+// Get returns the cached bytes for bucket/key at the given ETag, if present
+// and not expired.
+func (c *OriginalCache) Get(bucket, key, etag string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	cacheKey := originalCacheKey(bucket, key, etag)
+
+	c.mu.Lock()
+	elem, ok := c.entries[cacheKey]
+	if ok && c.expiredLocked(elem.Value.(*cacheEntry)) {
+		c.removeElementLocked(elem)
+		c.stats.Expired++
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path(cacheKey))
+	if err != nil {
+		// File vanished underneath us (e.g., tmp cleaner); drop the entry
+		log.Printf("[OriginalCache] Dropping unreadable entry for %s/%s: %v", bucket, key, err)
+		c.mu.Lock()
+		if elem, ok := c.entries[cacheKey]; ok {
+			c.removeElementLocked(elem)
+		}
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	c.mu.Lock()
+	c.stats.Hits++
+	c.mu.Unlock()
+	return data, true
+}
+
+// Put stores data for bucket/key at the given ETag, evicting least recently
+// used entries to stay within the size limit. Files larger than the whole
+// cache are skipped. Failures are logged, never returned: the cache is an
+// optimization only.
+func (c *OriginalCache) Put(bucket, key, etag string, data []byte) {
+	if c == nil || int64(len(data)) > c.maxBytes {
+		return
+	}
+	cacheKey := originalCacheKey(bucket, key, etag)
+
+	// Write to a temp file and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(c.dir, "put-*")
+	if err != nil {
+		log.Printf("[OriginalCache] Failed to create temp file: %v", err)
+		return
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		log.Printf("[OriginalCache] Failed to write %s/%s: %v", bucket, key, firstErr(writeErr, closeErr))
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), c.path(cacheKey)); err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("[OriginalCache] Failed to store %s/%s: %v", bucket, key, err)
+		return
+	}
+
+	if elem, ok := c.entries[cacheKey]; ok {
+		// Replaced an existing entry; adjust its size
+		entry := elem.Value.(*cacheEntry)
+		c.size -= entry.size
+		entry.size = int64(len(data))
+		entry.storedAt = c.now()
+		c.order.MoveToFront(elem)
+	} else {
+		c.entries[cacheKey] = c.order.PushFront(&cacheEntry{key: cacheKey, size: int64(len(data)), storedAt: c.now()})
+	}
+	c.size += int64(len(data))
+
+	for c.size > c.maxBytes {
+		c.evictOldestLocked()
+	}
+}
+
+// Stats returns a snapshot of the cache counters. Zero for a nil cache.
+func (c *OriginalCache) Stats() OriginalCacheStats {
+	if c == nil {
+		return OriginalCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.size
+	return stats
+}
+
+// expiredLocked reports whether an entry has outlived the TTL. Caller holds mu.
+func (c *OriginalCache) expiredLocked(entry *cacheEntry) bool {
+	return c.ttl > 0 && c.now().Sub(entry.storedAt) > c.ttl
+}
+
+// evictOldestLocked removes the least recently used entry. Caller holds mu.
+func (c *OriginalCache) evictOldestLocked() {
+	if elem := c.order.Back(); elem != nil {
+		c.removeElementLocked(elem)
+		c.stats.Evictions++
+	}
+}
+
+func (c *OriginalCache) removeElementLocked(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.order.Remove(elem)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+	os.Remove(c.path(entry.key))
+}
+
+func (c *OriginalCache) path(cacheKey string) string {
+	return filepath.Join(c.dir, cacheKey)
+}
+
+// originalCacheKey hashes bucket/key/etag into a flat, filesystem-safe name
+func originalCacheKey(bucket, key, etag string) string {
+	sum := sha256.Sum256([]byte(bucket + "/" + key + "/" + etag))
+	return hex.EncodeToString(sum[:])
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================
+// Original Store
+// ============================================================================
+
+// originalObjectAPI is the subset of *s3.Client used to read originals
+type originalObjectAPI interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// OriginalStore reads original files from S3 through the local cache. One
+// instance is shared by all file-processing workers so they share hits.
+type OriginalStore struct {
+	s3Client originalObjectAPI
+	cache    *OriginalCache // nil when ORIGINAL_CACHE_DIR is unset
+}
+
+// NewOriginalStore returns a store reading from s3Client, caching in cache
+// (which may be nil).
+func NewOriginalStore(s3Client originalObjectAPI, cache *OriginalCache) *OriginalStore {
+	return &OriginalStore{s3Client: s3Client, cache: cache}
+}
+
+// Fetch returns the bytes of bucket/key and whether they came from the cache.
+func (s *OriginalStore) Fetch(ctx context.Context, bucket, key string) ([]byte, bool, error) {
+	if s.cache == nil {
+		data, _, err := s.download(ctx, bucket, key)
+		return data, false, err
+	}
+
+	// HeadObject is far cheaper than re-downloading and tells us whether the
+	// cached copy still matches the object in S3
+	head, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to head object in S3: %w", err)
+	}
+	etag := normalizeETag(aws.ToString(head.ETag))
+	if data, ok := s.cache.Get(bucket, key, etag); ok {
+		return data, true, nil
+	}
+
+	data, etag, err := s.download(ctx, bucket, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if etag != "" {
+		s.cache.Put(bucket, key, etag, data)
+	}
+	return data, false, nil
+}
+
+// download retrieves an object and its ETag from S3
+func (s *OriginalStore) download(ctx context.Context, bucket, key string) ([]byte, string, error) {
+	result, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get object from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read S3 object body: %w", err)
+	}
+
+	return data, normalizeETag(aws.ToString(result.ETag)), nil
+}
+
+// normalizeETag strips the quotes S3 wraps ETags in
+func normalizeETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}
+
+// ============================================================================
+// Stats Reporter
+// ============================================================================
+
+// OriginalCacheStatsReporter logs cache hit/miss counters periodically. It
+// stays quiet while the cache is idle so an unused worker doesn't spam logs.
+type OriginalCacheStatsReporter struct {
+	cache    *OriginalCache
+	interval time.Duration
+	done     chan bool
+}
+
+// Start launches the reporter goroutine. A nil cache starts nothing.
+func (r *OriginalCacheStatsReporter) Start(ctx context.Context) {
+	r.done = make(chan bool)
+	if r.cache == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		var last OriginalCacheStats
+		for {
+			select {
+			case <-ticker.C:
+				stats := r.cache.Stats()
+				if stats.Hits == last.Hits && stats.Misses == last.Misses {
+					continue
+				}
+				last = stats
+				log.Printf("[OriginalCache] %s", stats)
+			case <-r.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the reporter goroutine to exit and logs the final counters.
+func (r *OriginalCacheStatsReporter) Stop() {
+	if r.done != nil {
+		close(r.done)
+	}
+	if r.cache != nil {
+		log.Printf("[OriginalCache] Final: %s", r.cache.Stats())
+	}
+}
+
+// String formats the stats for logs
+func (s OriginalCacheStats) String() string {
+	hitRate := 0.0
+	if total := s.Hits + s.Misses; total > 0 {
+		hitRate = float64(s.Hits) / float64(total) * 100
+	}
+	return fmt.Sprintf("hits=%d misses=%d hit_rate=%.1f%% evictions=%d expired=%d entries=%d bytes=%d",
+		s.Hits, s.Misses, hitRate, s.Evictions, s.Expired, s.Entries, s.Bytes)
+}
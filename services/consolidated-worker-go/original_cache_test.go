@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// TestOriginalCacheEviction verifies least recently used entries are evicted
+// once the size limit is exceeded.
+func TestOriginalCacheEviction(t *testing.T) {
+	cache, err := NewOriginalCache(filepath.Join(t.TempDir(), "originals"), 10, 0)
+	if err != nil {
+		t.Fatalf("NewOriginalCache() error = %v", err)
+	}
+
+	cache.Put("bucket", "a", "e1", []byte("aaaa"))
+	cache.Put("bucket", "b", "e1", []byte("bbbb"))
+
+	// Touch "a" so "b" becomes the least recently used entry
+	if data, ok := cache.Get("bucket", "a", "e1"); !ok || !bytes.Equal(data, []byte("aaaa")) {
+		t.Fatalf("Get(a) = %q, %v; want cached bytes", data, ok)
+	}
+
+	cache.Put("bucket", "c", "e1", []byte("cccc"))
+
+	if _, ok := cache.Get("bucket", "b", "e1"); ok {
+		t.Error("Get(b) hit; want evicted")
+	}
+	if _, ok := cache.Get("bucket", "a", "e1"); !ok {
+		t.Error("Get(a) missed; want retained")
+	}
+	if _, ok := cache.Get("bucket", "c", "e1"); !ok {
+		t.Error("Get(c) missed; want retained")
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Evictions != 1 || stats.Entries != 2 || stats.Bytes != 8 {
+		t.Errorf("Stats() = %+v, want 3 hits, 1 miss, 1 eviction, 2 entries, 8 bytes", stats)
+	}
+}
+
+// TestOriginalCacheETag verifies a changed ETag misses instead of serving
+// the previous object's bytes.
+func TestOriginalCacheETag(t *testing.T) {
+	cache, err := NewOriginalCache(t.TempDir(), 1024, 0)
+	if err != nil {
+		t.Fatalf("NewOriginalCache() error = %v", err)
+	}
+
+	cache.Put("bucket", "a", "e1", []byte("old"))
+	if _, ok := cache.Get("bucket", "a", "e2"); ok {
+		t.Error("Get(a, e2) hit; want miss for a different ETag")
+	}
+}
+
+// TestOriginalCacheTTL verifies entries older than the TTL are dropped.
+func TestOriginalCacheTTL(t *testing.T) {
+	cache, err := NewOriginalCache(t.TempDir(), 1024, time.Hour)
+	if err != nil {
+		t.Fatalf("NewOriginalCache() error = %v", err)
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	cache.Put("bucket", "a", "e1", []byte("data"))
+
+	now = now.Add(30 * time.Minute)
+	if _, ok := cache.Get("bucket", "a", "e1"); !ok {
+		t.Error("Get() missed within TTL")
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := cache.Get("bucket", "a", "e1"); ok {
+		t.Error("Get() hit after TTL")
+	}
+	if stats := cache.Stats(); stats.Expired != 1 || stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Stats() = %+v, want 1 expired and an empty cache", stats)
+	}
+}
+
+// TestOriginalCacheSkipsOversized verifies files larger than the cache are
+// not stored.
+func TestOriginalCacheSkipsOversized(t *testing.T) {
+	cache, err := NewOriginalCache(t.TempDir(), 4, 0)
+	if err != nil {
+		t.Fatalf("NewOriginalCache() error = %v", err)
+	}
+
+	cache.Put("bucket", "big", "e1", []byte("too large"))
+	if _, ok := cache.Get("bucket", "big", "e1"); ok {
+		t.Error("Get(big) hit; want oversized file skipped")
+	}
+}
+
+// TestOriginalCacheDisabled verifies a nil cache is a no-op.
+func TestOriginalCacheDisabled(t *testing.T) {
+	cache, err := NewOriginalCache("", 1024, 0)
+	if err != nil || cache != nil {
+		t.Fatalf("NewOriginalCache(\"\") = %v, %v; want nil, nil", cache, err)
+	}
+
+	cache.Put("bucket", "a", "e1", []byte("data"))
+	if _, ok := cache.Get("bucket", "a", "e1"); ok {
+		t.Error("Get() on nil cache hit")
+	}
+	if stats := cache.Stats(); stats != (OriginalCacheStats{}) {
+		t.Errorf("Stats() on nil cache = %+v, want zero", stats)
+	}
+}
+
+// fakeObjectAPI serves one object and counts downloads
+type fakeObjectAPI struct {
+	data      []byte
+	etag      string
+	downloads int
+}
+
+func (f *fakeObjectAPI) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ETag: aws.String(`"` + f.etag + `"`)}, nil
+}
+
+func (f *fakeObjectAPI) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.downloads++
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader(f.data)),
+		ETag: aws.String(`"` + f.etag + `"`),
+	}, nil
+}
+
+// TestOriginalStoreFetch verifies repeat fetches are served from the cache
+// and that overwriting the object in S3 invalidates the cached copy.
+func TestOriginalStoreFetch(t *testing.T) {
+	cache, err := NewOriginalCache(t.TempDir(), 1024, 0)
+	if err != nil {
+		t.Fatalf("NewOriginalCache() error = %v", err)
+	}
+	api := &fakeObjectAPI{data: []byte("v1"), etag: "e1"}
+	store := NewOriginalStore(api, cache)
+	ctx := context.Background()
+
+	for i, wantCached := range []bool{false, true} {
+		data, cached, err := store.Fetch(ctx, "bucket", "key")
+		if err != nil {
+			t.Fatalf("Fetch() #%d error = %v", i, err)
+		}
+		if cached != wantCached || string(data) != "v1" {
+			t.Errorf("Fetch() #%d = %q, cached %v; want \"v1\", cached %v", i, data, cached, wantCached)
+		}
+	}
+
+	api.data, api.etag = []byte("v2"), "e2"
+	data, cached, err := store.Fetch(ctx, "bucket", "key")
+	if err != nil {
+		t.Fatalf("Fetch() after overwrite error = %v", err)
+	}
+	if cached || string(data) != "v2" {
+		t.Errorf("Fetch() after overwrite = %q, cached %v; want fresh \"v2\"", data, cached)
+	}
+	if api.downloads != 2 {
+		t.Errorf("downloads = %d, want 2", api.downloads)
+	}
+}
+
+// TestOriginalStoreWithoutCache verifies every fetch downloads when caching
+// is disabled.
+func TestOriginalStoreWithoutCache(t *testing.T) {
+	api := &fakeObjectAPI{data: []byte("v1"), etag: "e1"}
+	store := NewOriginalStore(api, nil)
+
+	for i := 0; i < 2; i++ {
+		if _, cached, err := store.Fetch(context.Background(), "bucket", "key"); err != nil || cached {
+			t.Fatalf("Fetch() #%d cached = %v, err = %v; want download", i, cached, err)
+		}
+	}
+	if api.downloads != 2 {
+		t.Errorf("downloads = %d, want 2", api.downloads)
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Transactional Outbox
+// ============================================================================
+//
+// A change that has to be followed by a call to an external system (a
+// Keycloak role assignment, an email) writes a metadata.outbox_messages row
+// in its own transaction, through metadata.enqueue_outbox_message() in SQL
+// or writeOutboxMessage in Go. Either both commit or neither does.
+//
+// The row's insert notifies outbox_message with the destination, and
+// outboxMessageChannel queues an outbox_dispatch job for it. The dispatcher
+// delivers the destination's pending messages one at a time in ID order:
+//
+//  1. lock the oldest pending message (the head); if another dispatcher
+//     holds it, or it is waiting out a retry delay, leave it to that one
+//  2. run the handler registered for its kind
+//  3. mark it delivered, or record the failure and its next attempt, in the
+//     transaction holding the lock
+//
+// A message is only marked delivered after its handler succeeded, and never
+// by two dispatchers at once. A crash between the call and the commit
+// redelivers it, so handlers must be idempotent or pass the message ID to
+// the destination as an idempotency key.
+
+// outboxMaxAttempts is how many times a message is tried before it is
+// marked failed and the destination moves on to the next one
+const outboxMaxAttempts = 10
+
+// outboxRetentionDays is how long delivered and failed messages are kept
+const outboxRetentionDays = 30
+
+// OutboxMessage is a metadata.outbox_messages row being delivered
+type OutboxMessage struct {
+	ID          int64
+	Destination string
+	Kind        string
+	Payload     json.RawMessage // includes "audit" with the writer's audit context
+	Attempts    int             // earlier failed attempts
+}
+
+// OutboxHandler delivers one message. job is the dispatch job, for logs and
+// audit records.
+type OutboxHandler func(ctx context.Context, job *rivertype.JobRow, msg OutboxMessage) error
+
+// errNoOutboxHandler fails a message whose kind has no handler at once
+var errNoOutboxHandler = errors.New("no handler registered for outbox message kind")
+
+// Outbox holds the handlers for each destination and message kind
+type Outbox struct {
+	handlers map[string]map[string]OutboxHandler
+}
+
+// NewOutbox creates an outbox with no handlers
+func NewOutbox() *Outbox {
+	return &Outbox{handlers: make(map[string]map[string]OutboxHandler)}
+}
+
+// Register sets the handler for kind messages to destination
+func (o *Outbox) Register(destination, kind string, handler OutboxHandler) {
+	if o.handlers[destination] == nil {
+		o.handlers[destination] = make(map[string]OutboxHandler)
+	}
+	o.handlers[destination][kind] = handler
+}
+
+// handler returns the handler for a message
+func (o *Outbox) handler(msg OutboxMessage) (OutboxHandler, bool) {
+	handler, ok := o.handlers[msg.Destination][msg.Kind]
+	return handler, ok
+}
+
+// outboxWorkerHandler delivers messages whose payload is the args of an
+// existing River worker by running that worker's Work, so the outbox and
+// the job it replaced share one implementation
+func outboxWorkerHandler[T river.JobArgs](worker river.Worker[T]) OutboxHandler {
+	return func(ctx context.Context, job *rivertype.JobRow, msg OutboxMessage) error {
+		var args T
+		if err := json.Unmarshal(msg.Payload, &args); err != nil {
+			return fmt.Errorf("invalid %s payload: %w", msg.Kind, err)
+		}
+		return worker.Work(ctx, &river.Job[T]{JobRow: job, Args: args})
+	}
+}
+
+// writeOutboxMessage writes a message in tx, to be delivered once tx commits
+func writeOutboxMessage(ctx context.Context, tx pgx.Tx, destination, kind string, payload any) (int64, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("marshal outbox payload: %w", err)
+	}
+	var id int64
+	err = tx.QueryRow(ctx, `SELECT metadata.enqueue_outbox_message($1, $2, $3::JSONB)`,
+		destination, kind, string(payloadJSON)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("write outbox message: %w", err)
+	}
+	return id, nil
+}
+
+// outboxRetryDelay is the wait after a message's attempts-th failure:
+// 2s, 4s, 8s ... capped at 15 minutes
+func outboxRetryDelay(attempts int) time.Duration {
+	if attempts > 10 {
+		return 15 * time.Minute
+	}
+	return min(time.Duration(1<<attempts)*time.Second, 15*time.Minute)
+}
+
+// ============================================================================
+// Dispatch Job
+// ============================================================================
+
+// OutboxDispatchArgs delivers the pending messages of one destination. The
+// jobs aren't unique: one inserted while another is running must still run,
+// in case the running one already found the queue empty. A dispatcher that
+// finds the head locked by another exits at once.
+type OutboxDispatchArgs struct {
+	Destination string `json:"destination"`
+}
+
+// Kind returns the job type identifier for River routing
+func (OutboxDispatchArgs) Kind() string { return "outbox_dispatch" }
+
+// InsertOpts specifies River job insertion options
+func (OutboxDispatchArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "outbox",
+		MaxAttempts: 5,
+		Priority:    1,
+	}
+}
+
+// OutboxDispatchWorker delivers outbox messages
+type OutboxDispatchWorker struct {
+	river.WorkerDefaults[OutboxDispatchArgs]
+	dbPool *pgxpool.Pool
+	outbox *Outbox
+}
+
+// Timeout bounds one dispatcher run; each delivery holds a row lock
+func (w *OutboxDispatchWorker) Timeout(*river.Job[OutboxDispatchArgs]) time.Duration {
+	return 10 * time.Minute
+}
+
+// Work delivers messages until the destination has none due
+func (w *OutboxDispatchWorker) Work(ctx context.Context, job *river.Job[OutboxDispatchArgs]) error {
+	delivered := 0
+	for {
+		result, err := w.deliverHead(ctx, job.JobRow, job.Args.Destination)
+		if err != nil {
+			return err
+		}
+		switch result.outcome {
+		case outboxDelivered, outboxGaveUp:
+			delivered++
+			continue
+		case outboxRetryLater:
+			// This job owns the retry; dispatchers arriving meanwhile exit
+			log.Printf("[Job %d] Outbox %s: message %d failed (attempt %d/%d), retrying in %v",
+				job.ID, job.Args.Destination, result.messageID, result.attempts, outboxMaxAttempts, result.retryIn)
+			return river.JobSnooze(result.retryIn)
+		}
+		if delivered > 0 {
+			log.Printf("[Job %d] Outbox %s: %d message(s) processed", job.ID, job.Args.Destination, delivered)
+		}
+		return nil
+	}
+}
+
+type outboxOutcome int
+
+const (
+	outboxIdle       outboxOutcome = iota // nothing due, or another dispatcher has the head
+	outboxDelivered                       // head delivered
+	outboxGaveUp                          // head failed its last attempt and was marked failed
+	outboxRetryLater                      // head failed and waits for its next attempt
+)
+
+type outboxDeliveryResult struct {
+	outcome   outboxOutcome
+	messageID int64
+	attempts  int
+	retryIn   time.Duration
+}
+
+// deliverHead delivers the oldest pending message of destination
+func (w *OutboxDispatchWorker) deliverHead(ctx context.Context, job *rivertype.JobRow, destination string) (outboxDeliveryResult, error) {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return outboxDeliveryResult{}, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Only ever the head: skipping a locked head to the next message would
+	// break the order. A head waiting out its retry delay is left to the
+	// job that snoozed until then.
+	var msg OutboxMessage
+	var nextAttemptAt time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT id, destination, kind, payload || jsonb_build_object('audit', audit), attempts, next_attempt_at
+		FROM metadata.outbox_messages
+		WHERE id = (
+			SELECT min(id) FROM metadata.outbox_messages
+			WHERE destination = $1 AND status = 'pending'
+		)
+		FOR UPDATE SKIP LOCKED
+	`, destination).Scan(&msg.ID, &msg.Destination, &msg.Kind, &msg.Payload, &msg.Attempts, &nextAttemptAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return outboxDeliveryResult{outcome: outboxIdle}, nil
+	}
+	if err != nil {
+		return outboxDeliveryResult{}, fmt.Errorf("lock head message: %w", err)
+	}
+	if time.Now().Before(nextAttemptAt) {
+		return outboxDeliveryResult{outcome: outboxIdle}, nil
+	}
+
+	deliveryErr := errNoOutboxHandler
+	if handler, ok := w.outbox.handler(msg); ok {
+		deliveryErr = handler(ctx, job, msg)
+	}
+
+	result := outboxDeliveryResult{messageID: msg.ID, attempts: msg.Attempts + 1}
+	if deliveryErr == nil {
+		result.outcome = outboxDelivered
+		_, err = tx.Exec(ctx, `
+			UPDATE metadata.outbox_messages
+			SET status = 'delivered', attempts = attempts + 1, last_error = NULL, delivered_at = NOW()
+			WHERE id = $1
+		`, msg.ID)
+	} else {
+		status := "pending"
+		result.outcome = outboxRetryLater
+		result.retryIn = outboxRetryDelay(result.attempts)
+		if result.attempts >= outboxMaxAttempts || errors.Is(deliveryErr, errNoOutboxHandler) {
+			status = "failed"
+			result.outcome = outboxGaveUp
+			log.Printf("[Job %d] Outbox %s: giving up on message %d (%s) after %d attempt(s): %v",
+				job.ID, destination, msg.ID, msg.Kind, result.attempts, deliveryErr)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE metadata.outbox_messages
+			SET status = $2, attempts = attempts + 1, last_error = $3,
+			    next_attempt_at = NOW() + $4::INTERVAL
+			WHERE id = $1
+		`, msg.ID, status, deliveryErr.Error(), intervalString(result.retryIn))
+	}
+	if err != nil {
+		return outboxDeliveryResult{}, fmt.Errorf("record delivery of message %d: %w", msg.ID, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return outboxDeliveryResult{}, fmt.Errorf("commit delivery of message %d: %w", msg.ID, err)
+	}
+	return result, nil
+}
+
+// ============================================================================
+// NOTIFY Channel and Cleanup
+// ============================================================================
+
+// outboxDispatchQuery returns one dispatch job per destination with a
+// pending message
+const outboxDispatchQuery = `
+	SELECT DISTINCT destination FROM metadata.outbox_messages WHERE status = 'pending'
+`
+
+func scanOutboxDispatch(rows pgx.Rows) (river.JobArgs, error) {
+	var args OutboxDispatchArgs
+	err := rows.Scan(&args.Destination)
+	return args, err
+}
+
+// outboxMessageChannel queues a dispatcher for destinations that
+// notify_outbox_message_trigger announces on outbox_message (payload:
+// destination). Resync covers every destination with pending messages.
+func outboxMessageChannel(dbPool *pgxpool.Pool, riverClient *river.Client[pgx.Tx]) NotifyChannel {
+	return NotifyChannel{
+		Name: "outbox_message",
+		Handle: func(ctx context.Context, payload string) error {
+			_, err := riverClient.Insert(ctx, OutboxDispatchArgs{Destination: payload}, nil)
+			return err
+		},
+		Resync: func(ctx context.Context) error {
+			return resyncJobs(ctx, "outbox_message", dbPool, riverClient, scanOutboxDispatch, outboxDispatchQuery)
+		},
+	}
+}
+
+// OutboxCleanupTask purges old delivered and failed messages, and queues a
+// dispatcher for destinations whose head message is long overdue, in case
+// the dispatcher that should have retried it is gone
+type OutboxCleanupTask struct {
+	dbPool *pgxpool.Pool
+	jobs   *JobEnqueuer
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (o *OutboxCleanupTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "outbox_cleanup",
+		Description: fmt.Sprintf("Delete delivered and failed outbox messages older than %d days and redispatch stalled destinations", outboxRetentionDays),
+		Interval:    15 * time.Minute,
+		Jitter:      time.Minute,
+		Run:         o.runCleanup,
+	}
+}
+
+func (o *OutboxCleanupTask) runCleanup(ctx context.Context) (string, error) {
+	result, err := o.dbPool.Exec(ctx, `
+		DELETE FROM metadata.outbox_messages
+		WHERE status IN ('delivered', 'failed')
+		  AND created_at < NOW() - make_interval(days => $1)
+	`, outboxRetentionDays)
+	if err != nil {
+		return "", fmt.Errorf("delete old outbox messages: %w", err)
+	}
+
+	rows, err := o.dbPool.Query(ctx, `
+		SELECT DISTINCT destination FROM metadata.outbox_messages
+		WHERE status = 'pending' AND next_attempt_at < NOW() - INTERVAL '5 minutes'
+	`)
+	if err != nil {
+		return "", fmt.Errorf("find stalled outbox destinations: %w", err)
+	}
+	destinations, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", fmt.Errorf("find stalled outbox destinations: %w", err)
+	}
+	for _, destination := range destinations {
+		if _, err := o.jobs.Insert(ctx, OutboxDispatchArgs{Destination: destination}, nil); err != nil {
+			return "", fmt.Errorf("redispatch %s: %w", destination, err)
+		}
+	}
+
+	return fmt.Sprintf("Deleted %d old outbox messages, redispatched %d stalled destination(s)",
+		result.RowsAffected(), len(destinations)), nil
+}
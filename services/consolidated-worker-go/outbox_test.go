@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// recordingWorker captures the args it is given
+type recordingWorker struct {
+	river.WorkerDefaults[AssignKeycloakRoleArgs]
+	got *AssignKeycloakRoleArgs
+}
+
+func (w *recordingWorker) Work(_ context.Context, job *river.Job[AssignKeycloakRoleArgs]) error {
+	w.got = &job.Args
+	return nil
+}
+
+func TestOutboxWorkerHandler(t *testing.T) {
+	worker := &recordingWorker{}
+	handler := outboxWorkerHandler[AssignKeycloakRoleArgs](worker)
+
+	// The dispatcher merges the message's audit column into the payload
+	msg := OutboxMessage{
+		ID:          7,
+		Destination: "keycloak",
+		Kind:        "assign_keycloak_role",
+		Payload:     json.RawMessage(`{"user_id": "u1", "role_name": "editor", "audit": {"db_user": "authenticator"}}`),
+	}
+	if err := handler(context.Background(), &rivertype.JobRow{ID: 1}, msg); err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if worker.got == nil {
+		t.Fatal("worker not called")
+	}
+	if worker.got.UserID != "u1" || worker.got.RoleName != "editor" {
+		t.Errorf("args = %+v, want user u1, role editor", worker.got)
+	}
+	if worker.got.Audit == nil {
+		t.Error("audit context not passed to the worker")
+	} else if worker.got.Audit.DBUser != "authenticator" {
+		t.Errorf("audit db_user = %q, want authenticator", worker.got.Audit.DBUser)
+	}
+
+	msg.Payload = json.RawMessage(`not json`)
+	if err := handler(context.Background(), &rivertype.JobRow{ID: 1}, msg); err == nil {
+		t.Error("handler() with invalid payload: want error")
+	}
+}
+
+func TestOutboxHandlerLookup(t *testing.T) {
+	outbox := NewOutbox()
+	outbox.Register("keycloak", "sync_keycloak_role", func(context.Context, *rivertype.JobRow, OutboxMessage) error { return nil })
+
+	if _, ok := outbox.handler(OutboxMessage{Destination: "keycloak", Kind: "sync_keycloak_role"}); !ok {
+		t.Error("registered handler not found")
+	}
+	if _, ok := outbox.handler(OutboxMessage{Destination: "keycloak", Kind: "revoke_keycloak_role"}); ok {
+		t.Error("unregistered kind found")
+	}
+	if _, ok := outbox.handler(OutboxMessage{Destination: "email", Kind: "sync_keycloak_role"}); ok {
+		t.Error("kind found under the wrong destination")
+	}
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{5, 32 * time.Second},
+		{9, 512 * time.Second},
+		{10, 15 * time.Minute},
+		{60, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := outboxRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("outboxRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxDispatchArgsNotUnique(t *testing.T) {
+	// A dispatch queued while another runs must not be skipped as a duplicate
+	opts := OutboxDispatchArgs{}.InsertOpts()
+	if opts.UniqueOpts.ByArgs || len(opts.UniqueOpts.ByState) > 0 {
+		t.Errorf("UniqueOpts = %+v, want none", opts.UniqueOpts)
+	}
+	if opts.Queue != "outbox" {
+		t.Errorf("Queue = %q, want outbox", opts.Queue)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ============================================================================
+// PDF Rendering Limits
+//
+// pdftoppm runs on whatever users upload, and a crafted PDF (deeply nested
+// content streams, a page tree of millions of pages, a page the size of a
+// building) can pin a core for minutes on every retry. Each poppler run
+// (pdfinfo, then pdftoppm) is now bounded:
+//
+//   - PDF_RENDER_CPU_SECONDS (default 30) and PDF_RENDER_MEMORY_MB (default
+//     1024) are set as RLIMIT_CPU and RLIMIT_AS through a `sh -c ulimit`
+//     wrapper, so the kernel stops the process however it spends them.
+//   - PDF_RENDER_TIMEOUT_SECONDS (default 60) is a wall-clock deadline on
+//     the job context.
+//   - Before rendering, pdfinfo reports the page count and first page size;
+//     PDFs over PDF_MAX_PAGES (default 5000) or with a first page longer
+//     than PDF_MAX_PAGE_INCHES (default 50) on a side are rejected.
+//
+// A rejected PDF, or one that runs out of CPU time or memory, fails the same
+// way on every attempt, so those errors are unsupportedFile and the job is
+// cancelled. A wall-clock timeout is retried: with CPU time bounded, it
+// means the worker was starved, not that the file is hostile. A limit of 0
+// turns that limit off. Up to pdfStderrMax bytes of stderr are kept in the
+// error.
+// ============================================================================
+
+// pdfStderrMax bounds the poppler output kept in an error; damaged PDFs can
+// print a syntax error per object
+const pdfStderrMax = 1024
+
+// sandboxSetupFailed is the exit status of the wrapper when ulimit fails,
+// kept apart from poppler's own exit codes
+const sandboxSetupFailed = 125
+
+// PDFRenderLimits bounds each poppler run on an uploaded PDF
+type PDFRenderLimits struct {
+	Timeout       time.Duration // PDF_RENDER_TIMEOUT_SECONDS; wall clock
+	CPUSeconds    int           // PDF_RENDER_CPU_SECONDS; RLIMIT_CPU
+	MemoryMB      int           // PDF_RENDER_MEMORY_MB; RLIMIT_AS
+	MaxPages      int           // PDF_MAX_PAGES
+	MaxPageInches int           // PDF_MAX_PAGE_INCHES; longer side of page 1
+}
+
+// loadPDFRenderLimits reads the PDF rendering limits from the environment
+//
+//   - PDF_RENDER_TIMEOUT_SECONDS (default 60)
+//   - PDF_RENDER_CPU_SECONDS (default 30)
+//   - PDF_RENDER_MEMORY_MB (default 1024)
+//   - PDF_MAX_PAGES (default 5000)
+//   - PDF_MAX_PAGE_INCHES (default 50)
+func loadPDFRenderLimits() PDFRenderLimits {
+	return PDFRenderLimits{
+		Timeout:       envSeconds("PDF_RENDER_TIMEOUT_SECONDS", 60*time.Second),
+		CPUSeconds:    max(getEnvInt("PDF_RENDER_CPU_SECONDS", 30), 0),
+		MemoryMB:      max(getEnvInt("PDF_RENDER_MEMORY_MB", 1024), 0),
+		MaxPages:      max(getEnvInt("PDF_MAX_PAGES", 5000), 0),
+		MaxPageInches: max(getEnvInt("PDF_MAX_PAGE_INCHES", 50), 0),
+	}
+}
+
+// String summarises the limits for the startup log
+func (l PDFRenderLimits) String() string {
+	limit := func(v int, unit string) string {
+		if v == 0 {
+			return "off"
+		}
+		return fmt.Sprintf("%d%s", v, unit)
+	}
+	return fmt.Sprintf("timeout=%s cpu=%s memory=%s max_pages=%s max_page=%s",
+		limit(int(l.Timeout/time.Second), "s"), limit(l.CPUSeconds, "s"), limit(l.MemoryMB, "MB"),
+		limit(l.MaxPages, ""), limit(l.MaxPageInches, "in"))
+}
+
+// pdfInfo is what pdfinfo reports about a PDF
+type pdfInfo struct {
+	Pages         int
+	Width, Height float64 // first page, in points (1/72 inch)
+}
+
+// parsePDFInfo reads the page count and first page size from pdfinfo output
+func parsePDFInfo(out []byte) (pdfInfo, error) {
+	var info pdfInfo
+	var havePages, haveSize bool
+	for _, line := range strings.Split(string(out), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(name) {
+		case "Pages":
+			pages, err := strconv.Atoi(value)
+			if err != nil {
+				return info, fmt.Errorf("invalid page count %q", value)
+			}
+			info.Pages, havePages = pages, true
+		case "Page size":
+			// "612 x 792 pts (letter)"
+			fields := strings.Fields(value)
+			if len(fields) < 4 || fields[1] != "x" || fields[3] != "pts" {
+				return info, fmt.Errorf("invalid page size %q", value)
+			}
+			width, errW := strconv.ParseFloat(fields[0], 64)
+			height, errH := strconv.ParseFloat(fields[2], 64)
+			if errW != nil || errH != nil {
+				return info, fmt.Errorf("invalid page size %q", value)
+			}
+			info.Width, info.Height, haveSize = width, height, true
+		}
+	}
+	if !havePages || !haveSize {
+		return info, errors.New("pdfinfo reported no page count or page size")
+	}
+	return info, nil
+}
+
+// Check rejects a PDF over the page count or page size limits
+func (l PDFRenderLimits) Check(info pdfInfo) error {
+	if l.MaxPages > 0 && info.Pages > l.MaxPages {
+		return unsupportedFile(fmt.Errorf("PDF has %d pages, more than PDF_MAX_PAGES (%d)", info.Pages, l.MaxPages))
+	}
+	if l.MaxPageInches > 0 {
+		longest := max(info.Width, info.Height) / 72
+		if longest > float64(l.MaxPageInches) {
+			return unsupportedFile(fmt.Errorf("PDF first page is %.0f x %.0f in, larger than PDF_MAX_PAGE_INCHES (%d)",
+				info.Width/72, info.Height/72, l.MaxPageInches))
+		}
+	}
+	return nil
+}
+
+// sandboxScript sets the resource limits and execs the real command, or is
+// empty when no limit applies
+func (l PDFRenderLimits) sandboxScript() string {
+	var limits []string
+	if l.CPUSeconds > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", l.CPUSeconds))
+	}
+	if l.MemoryMB > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", l.MemoryMB*1024))
+	}
+	if len(limits) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`%s || exit %d; exec "$@"`, strings.Join(limits, " && "), sandboxSetupFailed)
+}
+
+// Run runs a poppler tool under the limits and returns its standard output.
+// The error carries the tool's stderr; running out of CPU time or memory is
+// unsupportedFile, and so are the exit codes classifyPdftoppmError treats as
+// an unreadable PDF.
+func (l PDFRenderLimits) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	runCtx := ctx
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if script := l.sandboxScript(); script != "" {
+		cmd = exec.CommandContext(runCtx, "sh", append([]string{"-c", script, "pdf-sandbox", name}, args...)...)
+	} else {
+		cmd = exec.CommandContext(runCtx, name, args...)
+	}
+	// The process is killed on timeout; don't wait on pipes a child kept open
+	cmd.WaitDelay = 5 * time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return stdout.Bytes(), nil
+	}
+
+	msg := strings.TrimSpace(stderr.String())
+	if len(msg) > pdfStderrMax {
+		msg = msg[:pdfStderrMax] + "..."
+	}
+	if msg != "" {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		// The job itself was cancelled or timed out
+		return nil, fmt.Errorf("%s interrupted: %w", name, ctx.Err())
+	case runCtx.Err() != nil:
+		return nil, fmt.Errorf("%s timed out after %s: %w", name, l.Timeout, err)
+	case l.exceededCPU(cmd.ProcessState):
+		return nil, unsupportedFile(fmt.Errorf("%s exceeded PDF_RENDER_CPU_SECONDS (%ds): %w", name, l.CPUSeconds, err))
+	case l.MemoryMB > 0 && outOfMemory(stderr.String()):
+		return nil, unsupportedFile(fmt.Errorf("%s exceeded PDF_RENDER_MEMORY_MB (%d MB): %w", name, l.MemoryMB, err))
+	}
+	return nil, classifyPdftoppmError(fmt.Errorf("failed to run %s: %w", name, err))
+}
+
+// exceededCPU reports whether the process was killed for using its CPU time.
+// The kernel sends SIGKILL (or SIGXCPU) once RLIMIT_CPU is spent; checking
+// the CPU time used keeps an unrelated kill (the OOM killer) retryable.
+func (l PDFRenderLimits) exceededCPU(state *os.ProcessState) bool {
+	if l.CPUSeconds == 0 || state == nil {
+		return false
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+	used := state.UserTime() + state.SystemTime()
+	return used >= time.Duration(l.CPUSeconds)*time.Second-100*time.Millisecond
+}
+
+// outOfMemory reports whether poppler's output shows a failed allocation
+// (poppler's own "Out of memory", or an uncaught std::bad_alloc)
+func outOfMemory(stderr string) bool {
+	msg := strings.ToLower(stderr)
+	return strings.Contains(msg, "out of memory") || strings.Contains(msg, "bad_alloc")
+}
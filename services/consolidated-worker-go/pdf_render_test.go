@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const samplePDFInfo = `Title:           Permit Application
+Producer:        LibreOffice 7.6
+Tagged:          no
+Form:            AcroForm
+Pages:           3
+Encrypted:       no
+Page size:       595.276 x 841.89 pts (A4)
+Page rot:        0
+PDF version:     1.7
+`
+
+func TestParsePDFInfo(t *testing.T) {
+	info, err := parsePDFInfo([]byte(samplePDFInfo))
+	if err != nil {
+		t.Fatalf("parsePDFInfo: %v", err)
+	}
+	if info.Pages != 3 || info.Width != 595.276 || info.Height != 841.89 {
+		t.Errorf("info = %+v", info)
+	}
+
+	for name, out := range map[string]string{
+		"no size":  "Pages: 3\n",
+		"no pages": "Page size: 612 x 792 pts (letter)\n",
+		"bad size": "Pages: 3\nPage size: 612 by 792\n",
+	} {
+		if _, err := parsePDFInfo([]byte(out)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestPDFRenderLimitsCheck(t *testing.T) {
+	limits := PDFRenderLimits{MaxPages: 100, MaxPageInches: 50}
+	letter := pdfInfo{Pages: 3, Width: 612, Height: 792}
+
+	if err := limits.Check(letter); err != nil {
+		t.Errorf("letter page rejected: %v", err)
+	}
+	if err := limits.Check(pdfInfo{Pages: 101, Width: 612, Height: 792}); !isUnsupportedFile(err) {
+		t.Errorf("101 pages: err = %v, want unsupported", err)
+	}
+	// 200 x 11 in banner
+	if err := limits.Check(pdfInfo{Pages: 1, Width: 14400, Height: 792}); !isUnsupportedFile(err) {
+		t.Errorf("200 in page: err = %v, want unsupported", err)
+	}
+	if err := (PDFRenderLimits{}).Check(pdfInfo{Pages: 1 << 20, Width: 14400, Height: 14400}); err != nil {
+		t.Errorf("no limits: %v", err)
+	}
+}
+
+func TestLoadPDFRenderLimits(t *testing.T) {
+	if got := loadPDFRenderLimits().String(); got != "timeout=60s cpu=30s memory=1024MB max_pages=5000 max_page=50in" {
+		t.Errorf("defaults = %s", got)
+	}
+	t.Setenv("PDF_RENDER_MEMORY_MB", "0")
+	t.Setenv("PDF_MAX_PAGES", "-1")
+	if got := loadPDFRenderLimits().String(); got != "timeout=60s cpu=30s memory=off max_pages=off max_page=50in" {
+		t.Errorf("limits off = %s", got)
+	}
+}
+
+func TestPDFRenderLimitsRun(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh unavailable")
+	}
+	ctx := context.Background()
+	limits := PDFRenderLimits{Timeout: 10 * time.Second, CPUSeconds: 1, MemoryMB: 512}
+
+	out, err := limits.Run(ctx, "sh", "-c", "echo Pages: 1")
+	if err != nil || strings.TrimSpace(string(out)) != "Pages: 1" {
+		t.Errorf("out = %q, err = %v", out, err)
+	}
+
+	// Busy loop: stopped by RLIMIT_CPU, not retried
+	_, err = limits.Run(ctx, "sh", "-c", "while :; do :; done")
+	if !isUnsupportedFile(err) || !strings.Contains(err.Error(), "PDF_RENDER_CPU_SECONDS") {
+		t.Errorf("busy loop: err = %v, want CPU limit", err)
+	}
+
+	// Stderr is kept, and exit 1 is an unreadable PDF
+	_, err = limits.Run(ctx, "sh", "-c", "echo 'Syntax Error: Couldn'\\''t find trailer dictionary' >&2; exit 1")
+	if !isUnsupportedFile(err) || !strings.Contains(err.Error(), "trailer dictionary") {
+		t.Errorf("exit 1: err = %v", err)
+	}
+}
+
+func TestPDFRenderLimitsRun_Timeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep unavailable")
+	}
+	limits := PDFRenderLimits{Timeout: 200 * time.Millisecond, CPUSeconds: 5}
+	start := time.Now()
+	_, err := limits.Run(context.Background(), "sleep", "10")
+	if err == nil || isUnsupportedFile(err) || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("err = %v, want a retryable timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s to time out", elapsed)
+	}
+}
@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riverqueue/river"
 )
@@ -19,6 +24,13 @@ type PreviewArgs struct {
 	TextTemplate     string          `json:"text_template"`
 	SMSTemplate      string          `json:"sms_template"`
 	SampleEntityData json.RawMessage `json:"sample_entity_data"`
+
+	// Live preview (v0.108.0): render against this row instead of sample
+	// data, read with the requester's ID and roles
+	EntityType string   `json:"entity_type,omitempty"`
+	EntityID   string   `json:"entity_id,omitempty"`
+	UserID     string   `json:"user_id,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
 }
 
 // Kind returns the job type identifier
@@ -36,9 +48,10 @@ func (PreviewArgs) InsertOpts() river.InsertOpts {
 // PreviewWorker renders template parts with sample data
 type PreviewWorker struct {
 	river.WorkerDefaults[PreviewArgs]
-	dbPool   *pgxpool.Pool
-	renderer *Renderer
-	siteURL  string
+	dbPool         *pgxpool.Pool
+	renderer       *Renderer
+	siteURL        string
+	maxOutputBytes int // Cap on stored rendered output per part (0 = unlimited)
 }
 
 // Work executes the preview job
@@ -47,34 +60,48 @@ func (w *PreviewWorker) Work(ctx context.Context, job *river.Job[PreviewArgs]) e
 	log.Printf("[Job %d] Starting preview job (attempt %d/%d): validation_id=%s",
 		job.ID, job.Attempt, job.MaxAttempts, job.Args.ValidationID)
 
-	// Validate sample entity data is valid JSON
-	var entityData map[string]interface{}
-	if err := json.Unmarshal(job.Args.SampleEntityData, &entityData); err != nil {
-		log.Printf("[Job %d] Invalid sample entity data: %v", job.ID, err)
-		return fmt.Errorf("invalid sample entity data: %w", err)
-	}
-
-	// Preview each non-empty template part
-	results := []PreviewPartResult{}
-
-	if job.Args.SubjectTemplate != "" {
-		result := w.previewPart("subject", job.Args.SubjectTemplate, false, job.Args.SampleEntityData)
-		results = append(results, result)
-	}
-
-	if job.Args.HTMLTemplate != "" {
-		result := w.previewPart("html", job.Args.HTMLTemplate, true, job.Args.SampleEntityData)
-		results = append(results, result)
+	// Live preview: read the row as the requester
+	entityData := job.Args.SampleEntityData
+	var entityErr *previewEntityError
+	if job.Args.EntityType != "" {
+		data, err := loadLiveEntity(ctx, w.dbPool, job.Args.EntityType, job.Args.EntityID, job.Args.UserID, job.Args.Roles)
+		if err != nil && !errors.As(err, &entityErr) {
+			log.Printf("[Job %d] Failed to load %s %s: %v", job.ID, job.Args.EntityType, job.Args.EntityID, err)
+			return fmt.Errorf("failed to load entity: %w", err)
+		}
+		entityData = data
 	}
 
-	if job.Args.TextTemplate != "" {
-		result := w.previewPart("text", job.Args.TextTemplate, false, job.Args.SampleEntityData)
-		results = append(results, result)
+	// Validate entity data is valid JSON
+	if entityErr == nil {
+		var entity map[string]interface{}
+		if err := json.Unmarshal(entityData, &entity); err != nil {
+			log.Printf("[Job %d] Invalid sample entity data: %v", job.ID, err)
+			return fmt.Errorf("invalid sample entity data: %w", err)
+		}
 	}
 
-	if job.Args.SMSTemplate != "" {
-		result := w.previewPart("sms", job.Args.SMSTemplate, false, job.Args.SampleEntityData)
-		results = append(results, result)
+	// Preview each non-empty template part. A row that can't be read fails
+	// every part with the reason.
+	results := []PreviewPartResult{}
+	for _, part := range []struct {
+		name     string
+		template string
+		isHTML   bool
+	}{
+		{"subject", job.Args.SubjectTemplate, false},
+		{"html", job.Args.HTMLTemplate, true},
+		{"text", job.Args.TextTemplate, false},
+		{"sms", job.Args.SMSTemplate, false},
+	} {
+		if part.template == "" {
+			continue
+		}
+		if entityErr != nil {
+			results = append(results, PreviewPartResult{PartName: part.name, ErrorMessage: entityErr.Error()})
+			continue
+		}
+		results = append(results, w.previewPart(part.name, part.template, part.isHTML, entityData))
 	}
 
 	// Insert results into database
@@ -150,6 +177,7 @@ func (w *PreviewWorker) insertPreviewResult(ctx context.Context, validationID st
 		// Store error message for invalid templates
 		errorMessage = result.ErrorMessage
 	}
+	errorMessage = truncateStoredOutput(errorMessage, w.maxOutputBytes)
 
 	_, err := w.dbPool.Exec(ctx, `
 		INSERT INTO metadata.template_part_validation_results (validation_id, part_name, valid, error_message)
@@ -170,3 +198,187 @@ func (w *PreviewWorker) markValidationCompleted(ctx context.Context, validationI
 
 	return err
 }
+
+// ============================================================================
+// Live Entity Preview
+// ============================================================================
+
+// previewEntityError is a row the preview can't use (missing, hidden by RLS,
+// no readable key); it is shown on each part instead of retried
+type previewEntityError struct {
+	msg string
+}
+
+func (e *previewEntityError) Error() string { return e.msg }
+
+// previewColumn is a column of the previewed table the requester may read
+type previewColumn struct {
+	Name     string
+	Key      bool   // Single-column primary key
+	RefTable string // Referenced public table with a display_name (foreign keys only)
+	RefKey   string
+}
+
+// loadLiveEntity reads one row as entity data, as the given user: readable,
+// non-private columns, with <name>_id references embedded as
+// <name>: {id, display_name}
+func loadLiveEntity(ctx context.Context, dbPool *pgxpool.Pool, entityType, entityID, userID string, roles []string) (json.RawMessage, error) {
+	columns, err := loadPreviewColumns(ctx, dbPool, entityType)
+	if err != nil {
+		return nil, err
+	}
+	query, err := buildPreviewEntityQuery(entityType, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := beginAsUser(ctx, dbPool, userID, roles)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // read-only, nothing to keep
+
+	var data json.RawMessage
+	err = tx.QueryRow(ctx, query, entityID).Scan(&data)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, &previewEntityError{fmt.Sprintf("%s %s not found, or you can't see it", entityType, entityID)}
+	case errors.As(err, &pgErr) && pgErr.Code == "42501":
+		return nil, &previewEntityError{fmt.Sprintf("you can't read %s: %s", entityType, pgErr.Message)}
+	case err != nil:
+		return nil, err
+	}
+	return data, nil
+}
+
+// beginAsUser opens a read-only transaction as role authenticated with JWT
+// claims rebuilt from a user's ID and roles, so grants and RLS apply as they
+// would to that user's API requests. The caller rolls it back.
+func beginAsUser(ctx context.Context, dbPool *pgxpool.Pool, userID string, roles []string) (pgx.Tx, error) {
+	var email string
+	err := dbPool.QueryRow(ctx, `
+		SELECT COALESCE(email, '') FROM metadata.civic_os_users_private WHERE id = $1::TEXT::UUID
+	`, userID).Scan(&email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	claims, err := json.Marshal(map[string]any{
+		"sub":   userID,
+		"role":  "authenticated",
+		"email": email,
+		"roles": roles,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode claims: %w", err)
+	}
+
+	tx, err := dbPool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		SELECT set_config('request.jwt.claims', $1, true),
+		       set_config('statement_timeout', '30s', true),
+		       set_config('role', 'authenticated', true)
+	`, string(claims)); err != nil {
+		tx.Rollback(ctx) //nolint:errcheck // already failing
+		return nil, fmt.Errorf("failed to assume user: %w", err)
+	}
+	return tx, nil
+}
+
+// loadPreviewColumns lists the columns role authenticated may select, minus
+// private (metadata.column_privacy) and full-text search columns
+func loadPreviewColumns(ctx context.Context, dbPool *pgxpool.Pool, tableName string) ([]previewColumn, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT a.attname, COALESCE(pk.conkey = ARRAY[a.attnum], FALSE),
+		       COALESCE(ref.table_name, ''), COALESCE(ref.key_column, '')
+		FROM pg_attribute a
+		JOIN pg_type ty ON ty.oid = a.atttypid
+		LEFT JOIN pg_constraint pk ON pk.conrelid = a.attrelid AND pk.contype = 'p'
+		LEFT JOIN LATERAL (
+			SELECT c.relname::TEXT AS table_name, ka.attname::TEXT AS key_column
+			FROM pg_constraint fk
+			JOIN pg_class c ON c.oid = fk.confrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace AND n.nspname = 'public'
+			JOIN pg_attribute ka ON ka.attrelid = fk.confrelid AND ka.attnum = fk.confkey[1]
+			JOIN pg_attribute da ON da.attrelid = fk.confrelid AND da.attname = 'display_name' AND NOT da.attisdropped
+			WHERE fk.conrelid = a.attrelid AND fk.contype = 'f' AND fk.conkey = ARRAY[a.attnum]
+			  AND has_column_privilege('authenticated', fk.confrelid, ka.attnum, 'SELECT')
+			  AND has_column_privilege('authenticated', fk.confrelid, da.attnum, 'SELECT')
+			LIMIT 1
+		) ref ON TRUE
+		WHERE a.attrelid = to_regclass(format('public.%I', $1::TEXT))
+		  AND a.attnum > 0 AND NOT a.attisdropped
+		  AND ty.typname <> 'tsvector'
+		  AND has_column_privilege('authenticated', a.attrelid, a.attnum, 'SELECT')
+		  AND NOT metadata.is_column_private($1, a.attname)
+		ORDER BY a.attnum
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	columns, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (previewColumn, error) {
+		var c previewColumn
+		err := row.Scan(&c.Name, &c.Key, &c.RefTable, &c.RefKey)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	return columns, nil
+}
+
+// buildPreviewEntityQuery selects one row by its key (the primary key, or
+// id for views) as a JSON object
+func buildPreviewEntityQuery(tableName string, columns []previewColumn) (string, error) {
+	if len(columns) == 0 {
+		return "", &previewEntityError{fmt.Sprintf("%s has no columns you can read", tableName)}
+	}
+	key := ""
+	names := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		names[c.Name] = true
+		if c.Key {
+			key = c.Name
+		}
+	}
+	if key == "" && names["id"] {
+		key = "id"
+	}
+	if key == "" {
+		return "", &previewEntityError{fmt.Sprintf("%s has no readable primary key", tableName)}
+	}
+
+	selects := make([]string, 0, len(columns))
+	for _, c := range columns {
+		column := "t." + pgx.Identifier{c.Name}.Sanitize()
+		selects = append(selects, column)
+
+		embedded, ok := strings.CutSuffix(c.Name, "_id")
+		if !ok || embedded == "" || c.RefTable == "" || names[embedded] {
+			continue
+		}
+		refKey := pgx.Identifier{c.RefKey}.Sanitize()
+		selects = append(selects, fmt.Sprintf(
+			"(SELECT jsonb_build_object('id', r.%s, 'display_name', r.display_name) FROM %s r WHERE r.%s = %s) AS %s",
+			refKey, pgx.Identifier{"public", c.RefTable}.Sanitize(), refKey, column, pgx.Identifier{embedded}.Sanitize()))
+	}
+	return fmt.Sprintf("SELECT to_jsonb(s) FROM (SELECT %s FROM %s t WHERE t.%s::TEXT = $1) s",
+		strings.Join(selects, ", "), pgx.Identifier{"public", tableName}.Sanitize(), pgx.Identifier{key}.Sanitize()), nil
+}
+
+// truncateStoredOutput caps s at maxBytes (on a UTF-8 boundary) and appends a
+// marker saying how much was dropped. maxBytes <= 0 disables the cap.
+func truncateStoredOutput(s string, maxBytes int) string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s
+	}
+
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("\n\n[truncated: %d of %d bytes not stored]", len(s)-cut, len(s))
+}
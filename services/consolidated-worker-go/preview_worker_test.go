@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// truncateStoredOutput Tests
+// ============================================================================
+
+func TestTruncateStoredOutput(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		maxBytes   int
+		wantPrefix string
+		truncated  bool
+	}{
+		{"under cap", "hello", 10, "hello", false},
+		{"exactly at cap", "hello", 5, "hello", false},
+		{"cap disabled", strings.Repeat("x", 100), 0, strings.Repeat("x", 100), false},
+		{"ascii over cap", "hello world", 5, "hello", true},
+		// "é" is 2 bytes; cutting at byte 2 would split it
+		{"backs off to rune boundary", "aé", 2, "a", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateStoredOutput(tt.input, tt.maxBytes)
+
+			if !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("truncateStoredOutput(%q, %d) = %q, want prefix %q", tt.input, tt.maxBytes, got, tt.wantPrefix)
+			}
+			if hasMarker := strings.Contains(got, "[truncated:"); hasMarker != tt.truncated {
+				t.Errorf("truncation marker present = %v, want %v (got %q)", hasMarker, tt.truncated, got)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("result is not valid UTF-8: %q", got)
+			}
+		})
+	}
+}
+
+func TestTruncateStoredOutput_ReportsDroppedBytes(t *testing.T) {
+	got := truncateStoredOutput(strings.Repeat("a", 1000), 100)
+	if !strings.HasSuffix(got, "[truncated: 900 of 1000 bytes not stored]") {
+		t.Errorf("unexpected marker: %q", got[100:])
+	}
+}
+
+// ============================================================================
+// intervalString Tests
+// ============================================================================
+
+func TestIntervalString(t *testing.T) {
+	if got := intervalString(90 * time.Minute); got != "5400 seconds" {
+		t.Errorf("intervalString(90m) = %q, want %q", got, "5400 seconds")
+	}
+}
+
+// ============================================================================
+// Live Entity Preview Tests
+// ============================================================================
+
+func TestBuildPreviewEntityQuery(t *testing.T) {
+	columns := []previewColumn{
+		{Name: "id", Key: true},
+		{Name: "display_name"},
+		{Name: "status_id", RefTable: "statuses", RefKey: "id"},
+		{Name: "assigned_user_id"}, // no readable display_name: left as is
+		{Name: "ward_id", RefTable: "wards", RefKey: "code"},
+		{Name: "ward"}, // a real column wins over the embedding
+	}
+	query, err := buildPreviewEntityQuery("issues", columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SELECT to_jsonb(s) FROM (SELECT t."id", t."display_name", t."status_id", ` +
+		`(SELECT jsonb_build_object('id', r."id", 'display_name', r.display_name) FROM "public"."statuses" r WHERE r."id" = t."status_id") AS "status", ` +
+		`t."assigned_user_id", t."ward_id", t."ward" FROM "public"."issues" t WHERE t."id"::TEXT = $1) s`
+	if query != want {
+		t.Errorf("query =\n%s\nwant\n%s", query, want)
+	}
+}
+
+func TestBuildPreviewEntityQueryKey(t *testing.T) {
+	// Views have no primary key; id is used
+	query, err := buildPreviewEntityQuery("issue_summary", []previewColumn{{Name: "id"}, {Name: "title"}})
+	if err != nil || !strings.HasSuffix(query, `WHERE t."id"::TEXT = $1) s`) {
+		t.Errorf("view: query = %s, err = %v", query, err)
+	}
+
+	query, err = buildPreviewEntityQuery("permits", []previewColumn{{Name: "permit_no", Key: true}, {Name: "id"}})
+	if err != nil || !strings.HasSuffix(query, `WHERE t."permit_no"::TEXT = $1) s`) {
+		t.Errorf("primary key: query = %s, err = %v", query, err)
+	}
+
+	for _, columns := range [][]previewColumn{nil, {{Name: "title"}}} {
+		_, err := buildPreviewEntityQuery("secrets", columns)
+		var entityErr *previewEntityError
+		if !errors.As(err, &entityErr) {
+			t.Errorf("%v: err = %v, want a preview entity error", columns, err)
+		}
+	}
+}
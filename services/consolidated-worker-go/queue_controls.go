@@ -0,0 +1,118 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Queue Circuit Breaker Maintenance Task
+//
+// Admins pause and resume River queues with pause_queue()/resume_queue() (see
+// migration v0-89-0-queue-controls). Pausing goes through River's own
+// river_queue.paused_at and river_control notification, so this worker and the
+// payment worker stop fetching from the queue without any code here.
+//
+// This task runs metadata.evaluate_queue_circuit_breakers() every minute. It
+// resumes queues whose timed pause or breaker cooldown has ended, and pauses
+// queues whose failed-attempt rate reached their breaker threshold. The
+// counts come from river_job, so they cover every replica and both workers.
+// Scheduled by MaintenanceScheduler (task "queue_circuit_breakers").
+// ============================================================================
+
+const queueCircuitBreakerInterval = 1 * time.Minute
+
+// QueueCircuitBreakerTask trips and resets per-queue circuit breakers
+type QueueCircuitBreakerTask struct {
+	dbPool *pgxpool.Pool
+}
+
+// queueControlAction is one queue paused or resumed by an evaluation
+type queueControlAction struct {
+	Queue     string
+	Action    string   // "tripped" or "resumed"
+	ErrorRate *float64 // Set when tripped
+	Attempts  *int     // Set when tripped
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (q *QueueCircuitBreakerTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "queue_circuit_breakers",
+		Description: "Pause queues whose error rate reaches their circuit breaker threshold; resume them after the cooldown or a timed pause",
+		Interval:    queueCircuitBreakerInterval,
+		Run:         q.runEvaluation,
+	}
+}
+
+// runEvaluation calls metadata.evaluate_queue_circuit_breakers() and logs
+// each queue it paused or resumed
+func (q *QueueCircuitBreakerTask) runEvaluation(ctx context.Context) (string, error) {
+	rows, err := q.dbPool.Query(ctx,
+		"SELECT queue_name, action, error_rate::FLOAT8, attempts FROM metadata.evaluate_queue_circuit_breakers()")
+	if err != nil {
+		return "", fmt.Errorf("evaluate_queue_circuit_breakers(): %w", err)
+	}
+	defer rows.Close()
+
+	var actions []queueControlAction
+	for rows.Next() {
+		var a queueControlAction
+		if err := rows.Scan(&a.Queue, &a.Action, &a.ErrorRate, &a.Attempts); err != nil {
+			return "", fmt.Errorf("scan circuit breaker result: %w", err)
+		}
+		actions = append(actions, a)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("evaluate_queue_circuit_breakers(): %w", err)
+	}
+
+	for _, a := range actions {
+		if a.Action == "tripped" && a.ErrorRate != nil && a.Attempts != nil {
+			log.Printf("[QueueControls] ⚠ Circuit breaker tripped for queue %s: %.0f%% of %d attempts failed; queue paused",
+				a.Queue, *a.ErrorRate*100, *a.Attempts)
+		} else {
+			log.Printf("[QueueControls] Queue %s %s", a.Queue, a.Action)
+		}
+	}
+	return queueControlSummary(actions), nil
+}
+
+// queueControlSummary is the task's last_message, e.g. "Tripped notifications; resumed 1 queue"
+func queueControlSummary(actions []queueControlAction) string {
+	var tripped []string
+	resumed := 0
+	for _, a := range actions {
+		switch a.Action {
+		case "tripped":
+			tripped = append(tripped, a.Queue)
+		case "resumed":
+			resumed++
+		}
+	}
+
+	switch {
+	case len(tripped) == 0 && resumed == 0:
+		return "No changes"
+	case len(tripped) == 0:
+		return fmt.Sprintf("Resumed %s", pluralQueues(resumed))
+	case resumed == 0:
+		return fmt.Sprintf("Tripped %s", strings.Join(tripped, ", "))
+	default:
+		return fmt.Sprintf("Tripped %s; resumed %s", strings.Join(tripped, ", "), pluralQueues(resumed))
+	}
+}
+
+func pluralQueues(n int) string {
+	if n == 1 {
+		return "1 queue"
+	}
+	return fmt.Sprintf("%d queues", n)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestQueueControlSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []queueControlAction
+		want    string
+	}{
+		{"nothing", nil, "No changes"},
+		{"resumed", []queueControlAction{{Queue: "notifications", Action: "resumed"}}, "Resumed 1 queue"},
+		{"tripped", []queueControlAction{
+			{Queue: "notifications", Action: "tripped"},
+			{Queue: "thumbnails", Action: "tripped"},
+		}, "Tripped notifications, thumbnails"},
+		{"both", []queueControlAction{
+			{Queue: "notifications", Action: "resumed"},
+			{Queue: "s3_signer", Action: "resumed"},
+			{Queue: "thumbnails", Action: "tripped"},
+		}, "Tripped thumbnails; resumed 2 queues"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queueControlSummary(tt.actions); got != tt.want {
+				t.Errorf("queueControlSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
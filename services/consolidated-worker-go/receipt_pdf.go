@@ -0,0 +1,359 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Receipt PDF
+//
+// Receipts are a single page of text and rules, so they are written with a
+// small PDF 1.4 writer instead of a PDF library. It uses the standard
+// Helvetica fonts, which every viewer provides, so nothing is embedded and a
+// receipt is a few KB. Text is WinAnsi-encoded: characters outside Latin-1
+// (plus the usual typographic punctuation) print as "?".
+// ============================================================================
+
+// ReceiptData is everything printed on a receipt
+type ReceiptData struct {
+	Organization      string   // APP_TITLE, e.g. "City of Springfield"
+	HeaderLines       []string // RECEIPT_HEADER_LINES: address, phone, ...
+	ReceiptNumber     string
+	PaidAt            time.Time // already in the display timezone
+	PayerName         string
+	PayerEmail        string
+	Description       string
+	Reference         string // entity the payment is for, e.g. "Reservation #42"
+	PaymentMethod     string
+	TransactionID     string
+	ProviderPaymentID string // or the check / money order number of an offline payment
+	ReferenceLabel    string // label for ProviderPaymentID; "Provider reference" when empty
+	Currency          string
+	AmountCents       int64
+	FeeCents          int64
+	SiteURL           string
+}
+
+// Page geometry in points (US Letter)
+const (
+	receiptPageWidth  = 612.0
+	receiptPageHeight = 792.0
+	receiptMargin     = 54.0
+)
+
+// RenderReceiptPDF lays out a one-page receipt
+func RenderReceiptPDF(r ReceiptData) []byte {
+	p := &pdfPage{}
+	left, right := receiptMargin, receiptPageWidth-receiptMargin
+	y := receiptPageHeight - receiptMargin - 16
+
+	// Header: municipality on the left, receipt number and date on the right
+	p.Text(left, y, pdfFontBold, 18, r.Organization)
+	p.TextRight(right, y, pdfFontBold, 18, "RECEIPT")
+	headerY := y - 18
+	for _, line := range r.HeaderLines {
+		p.Text(left, headerY, pdfFontRegular, 9, line)
+		headerY -= 12
+	}
+	p.TextRight(right, y-18, pdfFontRegular, 10, "Receipt No. "+r.ReceiptNumber)
+	p.TextRight(right, y-31, pdfFontRegular, 10, r.PaidAt.Format("January 2, 2006 3:04 PM MST"))
+
+	y = min(headerY, y-44) - 10
+	p.Line(left, y, right, y, 1)
+	y -= 26
+
+	// Payer and payment details
+	details := [][2]string{
+		{"Paid by", r.PayerName},
+		{"Email", r.PayerEmail},
+		{"Reference", r.Reference},
+		{"Payment method", r.PaymentMethod},
+		{"Transaction ID", r.TransactionID},
+		{cmp.Or(r.ReferenceLabel, "Provider reference"), r.ProviderPaymentID},
+	}
+	for _, d := range details {
+		if d[1] == "" {
+			continue
+		}
+		p.Text(left, y, pdfFontBold, 10, d[0])
+		p.Text(left+120, y, pdfFontRegular, 10, d[1])
+		y -= 16
+	}
+	y -= 14
+
+	// Itemized amounts
+	p.FillRect(left, y-6, right-left, 20, 0.93)
+	p.Text(left+8, y, pdfFontBold, 10, "Item")
+	p.TextRight(right-8, y, pdfFontBold, 10, "Amount")
+	y -= 24
+
+	description := r.Description
+	if description == "" {
+		description = "Payment"
+	}
+	lines := wrapPDFText(description, pdfFontRegular, 10, right-left-140)
+	p.TextRight(right-8, y, pdfFontRegular, 10, formatMoney(r.AmountCents, r.Currency))
+	for _, line := range lines {
+		p.Text(left+8, y, pdfFontRegular, 10, line)
+		y -= 14
+	}
+	if r.FeeCents > 0 {
+		p.Text(left+8, y, pdfFontRegular, 10, "Processing fee")
+		p.TextRight(right-8, y, pdfFontRegular, 10, formatMoney(r.FeeCents, r.Currency))
+		y -= 14
+	}
+
+	y -= 2
+	p.Line(left, y, right, y, 0.5)
+	y -= 18
+	p.Text(left+8, y, pdfFontBold, 12, "Total paid")
+	p.TextRight(right-8, y, pdfFontBold, 12, formatMoney(r.AmountCents+r.FeeCents, r.Currency))
+
+	// Footer
+	footerY := receiptMargin + 12
+	p.Line(left, footerY+16, right, footerY+16, 0.5)
+	footer := "Thank you for your payment. Please keep this receipt for your records."
+	if r.SiteURL != "" {
+		p.Text(left, footerY-12, pdfFontRegular, 8, r.SiteURL)
+	}
+	p.Text(left, footerY, pdfFontRegular, 8, footer)
+
+	return p.Bytes(fmt.Sprintf("Receipt %s", r.ReceiptNumber))
+}
+
+// formatMoney formats cents as "$1,234.56" for USD and "1,234.56 EUR" otherwise
+func formatMoney(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	whole := fmt.Sprintf("%d", cents/100)
+	var grouped strings.Builder
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(c)
+	}
+	amount := fmt.Sprintf("%s.%02d", grouped.String(), cents%100)
+
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == "USD" {
+		return sign + "$" + amount
+	}
+	return sign + amount + " " + currency
+}
+
+// referenceLabel names the reference printed for a payment method: the
+// provider's payment ID online, the number staff entered for offline payments
+func referenceLabel(method string) string {
+	switch method {
+	case "cash":
+		return "Reference"
+	case "check":
+		return "Check number"
+	case "money_order":
+		return "Money order number"
+	default:
+		return "Provider reference"
+	}
+}
+
+// paymentMethodLabel describes payments.transactions.payment_method for payers
+func paymentMethodLabel(method string) string {
+	switch method {
+	case "card":
+		return "Card"
+	case "us_bank_account":
+		return "Bank account (ACH)"
+	case "cash":
+		return "Cash"
+	case "check":
+		return "Check"
+	case "money_order":
+		return "Money order"
+	default:
+		return method
+	}
+}
+
+// ============================================================================
+// Minimal PDF writer
+// ============================================================================
+
+type pdfFont int
+
+const (
+	pdfFontRegular pdfFont = iota // /F1 Helvetica
+	pdfFontBold                   // /F2 Helvetica-Bold
+)
+
+// pdfPage collects the content stream of a single page
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+// Text draws s with its baseline starting at (x, y)
+func (p *pdfPage) Text(x, y float64, font pdfFont, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		int(font)+1, size, x, y, pdfEscape(winAnsi(s)))
+}
+
+// TextRight draws s so that it ends at x
+func (p *pdfPage) TextRight(x, y float64, font pdfFont, size float64, s string) {
+	p.Text(x-pdfTextWidth(s, font, size), y, font, size, s)
+}
+
+// Line strokes a black line
+func (p *pdfPage) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+// FillRect fills a rectangle with a grey level (0 black, 1 white)
+func (p *pdfPage) FillRect(x, y, w, h, gray float64) {
+	fmt.Fprintf(&p.content, "%.2f g %.2f %.2f %.2f %.2f re f 0 g\n", gray, x, y, w, h)
+}
+
+// Bytes assembles a one-page US Letter document
+func (p *pdfPage) Bytes(title string) []byte {
+	return pdfDocument(title, receiptPageWidth, receiptPageHeight, []*pdfPage{p})
+}
+
+// pdfDocument assembles a document: catalog, page tree, two fonts, an info
+// dictionary and a page and content stream per page, followed by the
+// cross-reference table
+func pdfDocument(title string, width, height float64, pages []*pdfPage) []byte {
+	const firstPageObj = 6
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObj+2*i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title (%s) /Producer (Civic OS) >>", pdfEscape(winAnsi(title))),
+	}
+	for i, page := range pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Contents %d 0 R "+
+				"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> >>", width, height, firstPageObj+2*i+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// winAnsiExtras maps the non-Latin-1 characters WinAnsiEncoding has
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// winAnsi converts UTF-8 to WinAnsiEncoding bytes
+func winAnsi(s string) string {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			out = append(out, ' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		default:
+			if b, ok := winAnsiExtras[r]; ok {
+				out = append(out, b)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return string(out)
+}
+
+// pdfEscape escapes a PDF literal string
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
+
+// Glyph widths (1/1000 em) of printable ASCII, from the Adobe AFM files
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// pdfTextWidth returns the rendered width of s in points. Characters outside
+// ASCII use an average width, close enough for right alignment.
+func pdfTextWidth(s string, font pdfFont, size float64) float64 {
+	widths := &helveticaWidths
+	if font == pdfFontBold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, r := range s {
+		if r >= 0x20 && r < 0x7f {
+			total += widths[r-0x20]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// wrapPDFText breaks s into lines no wider than maxWidth, splitting on spaces
+// (a single word longer than the line is left whole)
+func wrapPDFText(s string, font pdfFont, size, maxWidth float64) []string {
+	var lines []string
+	var current string
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if current != "" && pdfTextWidth(candidate, font, size) > maxWidth {
+			lines = append(lines, current)
+			candidate = word
+		}
+		current = candidate
+	}
+	if current != "" || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReceiptData() ReceiptData {
+	return ReceiptData{
+		Organization:      "City of Springfield",
+		HeaderLines:       []string{"100 Main St, Springfield", "(555) 555-0100"},
+		ReceiptNumber:     "000042",
+		PaidAt:            time.Date(2026, 10, 16, 14, 5, 0, 0, time.UTC),
+		PayerName:         "Pat Doe",
+		PayerEmail:        "pat@example.org",
+		Description:       "Pavilion rental (Saturday)",
+		Reference:         "Reservations #17",
+		PaymentMethod:     "Card",
+		TransactionID:     "0192f3e4-0000-7000-8000-000000000001",
+		ProviderPaymentID: "pi_123",
+		Currency:          "USD",
+		AmountCents:       12500,
+		FeeCents:          392,
+	}
+}
+
+func TestRenderReceiptPDF_Structure(t *testing.T) {
+	pdf := RenderReceiptPDF(testReceiptData())
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("missing PDF header or trailer")
+	}
+
+	// startxref must point at the xref table, and every entry at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n0 8\n")) {
+		t.Fatalf("startxref %d does not point at an 8-entry xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) != 7 {
+		t.Fatalf("xref has %d objects, want 7", len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[off:], []byte(want)) {
+			t.Errorf("object %d: offset %d does not start %q", i+1, off, want)
+		}
+	}
+
+	// Stream length matches the content between stream and endstream
+	stream := regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)endstream`).FindSubmatch(pdf)
+	if stream == nil {
+		t.Fatal("no content stream")
+	}
+	if n, _ := strconv.Atoi(string(stream[1])); n != len(stream[2]) {
+		t.Errorf("/Length %d, stream is %d bytes", n, len(stream[2]))
+	}
+
+	content := string(stream[2])
+	for _, want := range []string{
+		"(City of Springfield)", "(Receipt No. 000042)", "(Pavilion rental \\(Saturday\\))",
+		"($125.00)", "(Processing fee)", "($3.92)", "(Total paid)", "($128.92)", "(Reservations #17)",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content stream missing %s", want)
+		}
+	}
+}
+
+func TestRenderReceiptPDF_OmitsZeroFee(t *testing.T) {
+	data := testReceiptData()
+	data.FeeCents = 0
+	if pdf := RenderReceiptPDF(data); bytes.Contains(pdf, []byte("(Processing fee)")) {
+		t.Error("fee line printed for a payment without a processing fee")
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		cents    int64
+		currency string
+		want     string
+	}{
+		{12500, "USD", "$125.00"},
+		{5, "usd", "$0.05"},
+		{123456789, "USD", "$1,234,567.89"},
+		{100000, "EUR", "1,000.00 EUR"},
+		{-250, "USD", "-$2.50"},
+	}
+	for _, tt := range tests {
+		if got := formatMoney(tt.cents, tt.currency); got != tt.want {
+			t.Errorf("formatMoney(%d, %q) = %q, want %q", tt.cents, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestWinAnsiAndEscape(t *testing.T) {
+	if got := winAnsi("Café – “quoted” 日本"); got != "Caf\xe9 \x96 \x93quoted\x94 ??" {
+		t.Errorf("winAnsi = %q", got)
+	}
+	if got := pdfEscape(`a(b)\c`); got != `a\(b\)\\c` {
+		t.Errorf("pdfEscape = %q", got)
+	}
+}
+
+func TestWrapPDFText(t *testing.T) {
+	// "Hello" is 22.78pt at 10pt Helvetica
+	lines := wrapPDFText("Hello Hello Hello", pdfFontRegular, 10, 50)
+	if len(lines) != 2 || lines[0] != "Hello Hello" || lines[1] != "Hello" {
+		t.Errorf("wrap = %q", lines)
+	}
+	if lines := wrapPDFText("", pdfFontRegular, 10, 50); len(lines) != 1 || lines[0] != "" {
+		t.Errorf("empty wrap = %q", lines)
+	}
+	if w := pdfTextWidth("Hello", pdfFontRegular, 10); w < 22.7 || w > 22.8 {
+		t.Errorf("width = %v, want 22.78", w)
+	}
+}
+
+func TestRenderReceiptPDF_OfflineReference(t *testing.T) {
+	data := testReceiptData()
+	data.PaymentMethod = paymentMethodLabel("check")
+	data.ProviderPaymentID = "1042"
+	data.ReferenceLabel = referenceLabel("check")
+
+	pdf := string(RenderReceiptPDF(data))
+	for _, want := range []string{"(Check)", "(Check number)", "(1042)"} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("receipt is missing %s", want)
+		}
+	}
+	if strings.Contains(pdf, "Provider reference") {
+		t.Error("offline receipts should label the check number, not a provider reference")
+	}
+}
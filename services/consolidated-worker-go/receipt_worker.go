@@ -0,0 +1,274 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Job Definition: Generate Payment Receipt
+// ============================================================================
+
+// GenerateReceiptArgs is inserted by payments.notify_payment_succeeded() when
+// a payment moves to succeeded
+type GenerateReceiptArgs struct {
+	TransactionID string `json:"transaction_id"`
+}
+
+func (GenerateReceiptArgs) Kind() string { return "generate_receipt" }
+
+func (GenerateReceiptArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "notifications",
+		MaxAttempts: 5,
+		Priority:    1,
+	}
+}
+
+// ReceiptWorker renders a PDF receipt, stores it in S3 and creates the
+// payment_succeeded notification with the receipt attached. On the last
+// attempt a failure still creates the notification, without the attachment.
+type ReceiptWorker struct {
+	river.WorkerDefaults[GenerateReceiptArgs]
+	dbPool       *pgxpool.Pool
+	s3Client     *s3.Client
+	bucket       string
+	organization string   // APP_TITLE
+	headerLines  []string // RECEIPT_HEADER_LINES
+	siteURL      string
+	timezone     *time.Location
+}
+
+// receiptTransaction is the payment as loaded for the receipt
+type receiptTransaction struct {
+	UserID            string
+	Status            string
+	ReceiptNumber     *int64
+	GeneratedAt       *time.Time
+	AmountCents       int64
+	FeeCents          int64
+	Amount            string // NUMERIC as text, for entity_data
+	Currency          string
+	Description       string
+	DisplayName       string
+	Reference         string
+	PaymentMethod     string
+	ProviderPaymentID string
+	PaidAt            time.Time
+	PayerName         string
+	PayerEmail        string
+}
+
+func (w *ReceiptWorker) Work(ctx context.Context, job *river.Job[GenerateReceiptArgs]) error {
+	log.Printf("[Job %d] Generating receipt for payment %s (attempt %d/%d)",
+		job.ID, job.Args.TransactionID, job.Attempt, job.MaxAttempts)
+
+	txn, err := w.loadTransaction(ctx, job.Args.TransactionID)
+	if err != nil {
+		return fmt.Errorf("failed to load payment: %w", err)
+	}
+	if txn.GeneratedAt != nil {
+		log.Printf("[Job %d] ✓ Receipt already generated, skipping", job.ID)
+		return nil
+	}
+	if txn.Status != "succeeded" {
+		log.Printf("[Job %d] ✓ Payment is %s, no receipt", job.ID, txn.Status)
+		return nil
+	}
+
+	s3Key, err := w.storeReceipt(ctx, job.Args.TransactionID, txn)
+	if err != nil {
+		if job.Attempt >= job.MaxAttempts {
+			log.Printf("[Job %d] Receipt failed on the last attempt, sending confirmation without it: %v", job.ID, err)
+			return w.notify(ctx, job.Args.TransactionID, txn, "")
+		}
+		return err
+	}
+
+	if err := w.notify(ctx, job.Args.TransactionID, txn, s3Key); err != nil {
+		return err
+	}
+	log.Printf("[Job %d] ✓ Receipt %s stored at %s", job.ID, receiptNumberLabel(txn.ReceiptNumber), s3Key)
+	return nil
+}
+
+func (w *ReceiptWorker) loadTransaction(ctx context.Context, transactionID string) (*receiptTransaction, error) {
+	var t receiptTransaction
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT t.user_id::text, t.status, t.receipt_number, t.receipt_generated_at,
+		       (t.amount * 100)::BIGINT, (t.processing_fee * 100)::BIGINT, t.amount::text,
+		       t.currency, COALESCE(t.description, ''), COALESCE(t.display_name, ''),
+		       CASE WHEN t.entity_type IS NULL THEN ''
+		            ELSE COALESCE(e.display_name, t.entity_type) || ' #' || COALESCE(t.entity_id, '')
+		       END,
+		       t.payment_method, COALESCE(t.provider_payment_id, t.offline_reference, ''),
+		       COALESCE(t.captured_at, t.received_at, t.updated_at),
+		       COALESCE(u.display_name, ''), COALESCE(u.email, '')
+		FROM payments.transactions t
+		LEFT JOIN metadata.entities e ON e.table_name = t.entity_type
+		LEFT JOIN metadata.civic_os_users_private u ON u.id = t.user_id
+		WHERE t.id = $1
+	`, transactionID).Scan(&t.UserID, &t.Status, &t.ReceiptNumber, &t.GeneratedAt,
+		&t.AmountCents, &t.FeeCents, &t.Amount,
+		&t.Currency, &t.Description, &t.DisplayName,
+		&t.Reference,
+		&t.PaymentMethod, &t.ProviderPaymentID,
+		&t.PaidAt,
+		&t.PayerName, &t.PayerEmail)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// storeReceipt renders the PDF and uploads it, returning the S3 key
+func (w *ReceiptWorker) storeReceipt(ctx context.Context, transactionID string, txn *receiptTransaction) (string, error) {
+	pdf := RenderReceiptPDF(ReceiptData{
+		Organization:      w.organization,
+		HeaderLines:       w.headerLines,
+		ReceiptNumber:     receiptNumberLabel(txn.ReceiptNumber),
+		PaidAt:            txn.PaidAt.In(w.timezone),
+		PayerName:         txn.PayerName,
+		PayerEmail:        txn.PayerEmail,
+		Description:       txn.Description,
+		Reference:         txn.Reference,
+		PaymentMethod:     paymentMethodLabel(txn.PaymentMethod),
+		TransactionID:     transactionID,
+		ProviderPaymentID: txn.ProviderPaymentID,
+		ReferenceLabel:    referenceLabel(txn.PaymentMethod),
+		Currency:          txn.Currency,
+		AmountCents:       txn.AmountCents,
+		FeeCents:          txn.FeeCents,
+		SiteURL:           w.siteURL,
+	})
+
+	s3Key := receiptS3Key(transactionID, txn.ReceiptNumber)
+	_, err := w.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(w.bucket),
+		Key:         aws.String(s3Key),
+		Body:        bytes.NewReader(pdf),
+		ContentType: aws.String("application/pdf"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload receipt: %w", err)
+	}
+	return s3Key, nil
+}
+
+// notify records the receipt and creates the payment_succeeded notification
+// in one transaction, so a retry after a crash can't email the payer twice.
+// An empty s3Key sends the confirmation without an attachment.
+func (w *ReceiptWorker) notify(ctx context.Context, transactionID string, txn *receiptTransaction, s3Key string) error {
+	receiptNumber := ""
+	if txn.ReceiptNumber != nil {
+		receiptNumber = receiptNumberLabel(txn.ReceiptNumber)
+	}
+	entityData, err := json.Marshal(map[string]any{
+		"id":               transactionID,
+		"amount":           txn.Amount,
+		"currency":         txn.Currency,
+		"description":      txn.Description,
+		"display_name":     txn.DisplayName,
+		"receipt_number":   receiptNumber,
+		"receipt_attached": s3Key != "",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification data: %w", err)
+	}
+
+	attachments := []NotificationAttachment{}
+	if s3Key != "" {
+		attachments = append(attachments, NotificationAttachment{
+			FileName:    receiptFileName(txn.ReceiptNumber),
+			ContentType: "application/pdf",
+			S3Bucket:    w.bucket,
+			S3Key:       s3Key,
+		})
+	}
+	attachmentsJSON, err := json.Marshal(attachments)
+	if err != nil {
+		return fmt.Errorf("failed to encode attachments: %w", err)
+	}
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE payments.transactions
+		SET receipt_s3_key = NULLIF($2, ''), receipt_generated_at = NOW()
+		WHERE id = $1 AND receipt_generated_at IS NULL
+	`, transactionID, s3Key)
+	if err != nil {
+		return fmt.Errorf("failed to record receipt: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil // another attempt got there first
+	}
+
+	// Insert trigger enqueues send_notification with the attachments
+	_, err = tx.Exec(ctx, `
+		INSERT INTO metadata.notifications (
+			user_id, template_name, entity_type, entity_id, entity_data, channels, attachments
+		) VALUES ($1, 'payment_succeeded', 'payments.transactions', $2, $3, '{email}', $4)
+	`, txn.UserID, transactionID, entityData, attachmentsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// receiptNumberLabel formats a receipt number for display, e.g. "000042".
+// Payments that succeeded before receipts were numbered fall back to "—".
+func receiptNumberLabel(n *int64) string {
+	if n == nil {
+		return "—"
+	}
+	return fmt.Sprintf("%06d", *n)
+}
+
+// receiptS3Key stores receipts beside the payment: payments.transactions/<id>/receipt-000042.pdf
+func receiptS3Key(transactionID string, n *int64) string {
+	if n == nil {
+		return fmt.Sprintf("payments.transactions/%s/receipt.pdf", transactionID)
+	}
+	return fmt.Sprintf("payments.transactions/%s/receipt-%06d.pdf", transactionID, *n)
+}
+
+// receiptFileName is the attachment name the payer sees
+func receiptFileName(n *int64) string {
+	if n == nil {
+		return "receipt.pdf"
+	}
+	return fmt.Sprintf("receipt-%06d.pdf", *n)
+}
+
+// parseReceiptHeaderLines splits RECEIPT_HEADER_LINES on "|" (addresses
+// contain commas), dropping empty lines
+func parseReceiptHeaderLines(value string) []string {
+	var lines []string
+	for _, line := range strings.Split(value, "|") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
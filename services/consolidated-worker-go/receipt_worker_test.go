@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReceiptNaming(t *testing.T) {
+	n := int64(42)
+	if got := receiptS3Key("abc", &n); got != "payments.transactions/abc/receipt-000042.pdf" {
+		t.Errorf("receiptS3Key = %q", got)
+	}
+	if got := receiptS3Key("abc", nil); got != "payments.transactions/abc/receipt.pdf" {
+		t.Errorf("receiptS3Key(nil) = %q", got)
+	}
+	if got := receiptFileName(&n); got != "receipt-000042.pdf" {
+		t.Errorf("receiptFileName = %q", got)
+	}
+	if got := receiptNumberLabel(&n); got != "000042" {
+		t.Errorf("receiptNumberLabel = %q", got)
+	}
+}
+
+func TestParseReceiptHeaderLines(t *testing.T) {
+	got := parseReceiptHeaderLines(" 100 Main St, Springfield | | (555) 555-0100 ")
+	want := []string{"100 Main St, Springfield", "(555) 555-0100"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := parseReceiptHeaderLines(""); got != nil {
+		t.Errorf("empty: got %q, want nil", got)
+	}
+}
@@ -19,8 +19,9 @@ type Renderer struct {
 	siteURL   string
 	siteName  string // e.g., "FFSC Staff Portal" — from APP_TITLE env var
 	timezone  *time.Location
-	dbPool    *pgxpool.Pool // For DB-backed template functions (staticAsset)
-	s3BaseURL string        // e.g., "https://s3.us-east-1.amazonaws.com/civic-os-files"
+	dbPool    *pgxpool.Pool      // For DB-backed template functions (staticAsset)
+	s3BaseURL string             // e.g., "https://s3.us-east-1.amazonaws.com/civic-os-files"
+	tracker   *EngagementTracker // nil = engagement tracking off (see SetEngagementTracker)
 }
 
 // NewRenderer creates a new Renderer instance
@@ -37,6 +38,12 @@ func NewRenderer(siteURL, siteName string, timezone *time.Location, dbPool *pgxp
 	}
 }
 
+// SetEngagementTracker turns on link and open tracking for templates with
+// track_engagement. Call before the workers start.
+func (r *Renderer) SetEngagementTracker(tracker *EngagementTracker) {
+	r.tracker = tracker
+}
+
 // RenderedNotification holds rendered template parts
 type RenderedNotification struct {
 	Subject string
@@ -142,7 +149,19 @@ func (r *Renderer) getTemplateFuncs() template.FuncMap {
 		"formatMoney":    r.formatMoney,
 		"formatPhone":    r.formatPhone,
 		"staticAsset":    r.staticAsset,
+		"toJSON":         toJSON,
+	}
+}
+
+// toJSON encodes a value as a JSON literal, for building JSON payloads
+// (entity webhooks) where strings need quoting and escaping.
+// Usage: {"description": {{toJSON .Entity.description}}}
+func toJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
 	}
+	return string(encoded), nil
 }
 
 // staticAsset resolves a static asset slug to a public S3 URL.
@@ -355,9 +374,16 @@ func formatE164(phone string) (string, error) {
 
 // renderText renders a text template (for subject, text body, SMS)
 func (r *Renderer) renderText(templateStr string, context map[string]interface{}) (string, error) {
+	return r.renderTextWith(templateStr, context, nil)
+}
+
+// renderTextWith renders a text template with extra functions on top of the
+// notification ones (e.g., secret for entity webhooks)
+func (r *Renderer) renderTextWith(templateStr string, context map[string]interface{}, extra textTemplate.FuncMap) (string, error) {
 	tmpl, err := textTemplate.New("text").
 		Option("missingkey=zero").
 		Funcs(textTemplate.FuncMap(r.getTemplateFuncs())).
+		Funcs(extra).
 		Parse(templateStr)
 	if err != nil {
 		return "", fmt.Errorf("template parse error: %w", err)
@@ -0,0 +1,529 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Role Audit
+// ============================================================================
+//
+// The role_audit maintenance task queues one role_audit job a day. The job
+// walks civic_os_users in ID order and compares each user's effective realm
+// roles in Keycloak with their user_roles rows. Only Civic OS roles are
+// compared: Keycloak system roles and roles with no metadata.roles row are
+// left out (the latter are the user sync's unknown_role conflicts). Each
+// difference is recorded in metadata.role_drift and, depending on
+// ROLE_AUDIT_HEAL, healed:
+//
+//	off          record only (default)
+//	to_database  add or remove the user_roles row, as the user sync would
+//	to_keycloak  queue an assign_keycloak_role or revoke_keycloak_role job
+//
+// A role the user inherits through a Keycloak group or composite role can't
+// be revoked from the user alone; its drift stays open with heal_error. Like
+// the user sync, the job works for about roleAuditBatchTime, saves its
+// cursor in role_audit_runs and snoozes, and a complete run resolves the
+// drift it no longer sees.
+
+const (
+	roleAuditPageSize  = 100
+	roleAuditBatchTime = 30 * time.Second
+)
+
+// ROLE_AUDIT_HEAL values
+const (
+	roleAuditHealOff        = "off"
+	roleAuditHealToDatabase = "to_database"
+	roleAuditHealToKeycloak = "to_keycloak"
+)
+
+// Drift types, from the point of view of user_roles
+const (
+	roleDriftMissingInKeycloak = "missing_in_keycloak"
+	roleDriftMissingInDatabase = "missing_in_database"
+)
+
+// parseRoleAuditHeal validates ROLE_AUDIT_HEAL
+func parseRoleAuditHeal(value string) (string, error) {
+	switch value {
+	case "", roleAuditHealOff:
+		return roleAuditHealOff, nil
+	case roleAuditHealToDatabase, roleAuditHealToKeycloak:
+		return value, nil
+	}
+	return "", fmt.Errorf("must be %s, %s or %s", roleAuditHealOff, roleAuditHealToDatabase, roleAuditHealToKeycloak)
+}
+
+// RoleAuditArgs is inserted by RoleAuditTask
+type RoleAuditArgs struct{}
+
+func (RoleAuditArgs) Kind() string { return "role_audit" }
+
+func (RoleAuditArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "user_provisioning",
+		MaxAttempts: 5,
+		Priority:    3,
+		// One audit at a time, including while it snoozes between batches
+		UniqueOpts: river.UniqueOpts{
+			ByState: notifyJobUniqueStates,
+		},
+	}
+}
+
+// roleAuditUser is one Civic OS user and their user_roles
+type roleAuditUser struct {
+	ID    string
+	Realm string
+	Roles []string // role_keys, Keycloak system roles left out
+}
+
+// roleAuditStats is what a page (or a whole batch) did
+type roleAuditStats struct {
+	Checked int
+	Skipped int
+	Found   int
+	Healed  int
+}
+
+func (s *roleAuditStats) add(o roleAuditStats) {
+	s.Checked += o.Checked
+	s.Skipped += o.Skipped
+	s.Found += o.Found
+	s.Healed += o.Healed
+}
+
+// RoleAuditWorker compares user_roles with Keycloak role mappings
+type RoleAuditWorker struct {
+	river.WorkerDefaults[RoleAuditArgs]
+	dbPool    *pgxpool.Pool
+	provider  IdentityProvider
+	jobs      *JobEnqueuer
+	heal      string // ROLE_AUDIT_HEAL
+	pageSize  int
+	batchTime time.Duration
+}
+
+func (w *RoleAuditWorker) Work(ctx context.Context, job *river.Job[RoleAuditArgs]) error {
+	runID, cursor, err := w.startRun(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Job %d] Auditing user roles (heal: %s, run %d, attempt %d/%d)",
+		job.ID, w.heal, runID, job.Attempt, job.MaxAttempts)
+
+	deadline := time.Now().Add(w.batchTime)
+	var batch roleAuditStats
+	for {
+		users, err := w.nextUsers(ctx, cursor)
+		if err != nil {
+			return w.failRun(ctx, job, runID, err)
+		}
+
+		page, err := w.auditPage(ctx, job.ID, users)
+		if err != nil {
+			return w.failRun(ctx, job, runID, err)
+		}
+		if len(users) > 0 {
+			cursor = users[len(users)-1].ID
+		}
+		if err := w.savePage(ctx, runID, cursor, page); err != nil {
+			return w.failRun(ctx, job, runID, err)
+		}
+		batch.add(page)
+
+		if len(users) < w.pageSize {
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Printf("[Job %d] Audited %d user(s) this batch (%d drift), continuing after %s",
+				job.ID, batch.Checked, batch.Found, cursor)
+			return river.JobSnooze(time.Second)
+		}
+	}
+
+	openDrift, err := w.finishRun(ctx, runID)
+	if err != nil {
+		return w.failRun(ctx, job, runID, err)
+	}
+	log.Printf("[Job %d] ✓ Role audit complete: %d open drift", job.ID, openDrift)
+	return nil
+}
+
+// startRun returns the run this job is working through and the last user it
+// audited, creating the run on the job's first attempt
+func (w *RoleAuditWorker) startRun(ctx context.Context, jobID int64) (int64, string, error) {
+	var runID int64
+	var cursor string
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT id, COALESCE(last_user_id::TEXT, '') FROM metadata.role_audit_runs
+		WHERE river_job_id = $1 AND status = 'running'
+		ORDER BY id DESC LIMIT 1
+	`, jobID).Scan(&runID, &cursor)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = w.dbPool.QueryRow(ctx, `
+			INSERT INTO metadata.role_audit_runs (river_job_id, heal_direction) VALUES ($1, $2) RETURNING id
+		`, jobID, w.heal).Scan(&runID)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to start role audit run: %w", err)
+	}
+	return runID, cursor, nil
+}
+
+// nextUsers returns the page of users after cursor ("" for the first page)
+func (w *RoleAuditWorker) nextUsers(ctx context.Context, cursor string) ([]roleAuditUser, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT u.id::TEXT, COALESCE(u.identity_realm, ''),
+		       ARRAY(
+		           SELECT r.role_key
+		           FROM metadata.user_roles ur
+		           JOIN metadata.roles r ON r.id = ur.role_id
+		           WHERE ur.user_id = u.id AND NOT metadata.is_keycloak_system_role(r.role_key)
+		           ORDER BY r.role_key
+		       )
+		FROM metadata.civic_os_users u
+		WHERE NULLIF($1, '') IS NULL OR u.id > $1::UUID
+		ORDER BY u.id
+		LIMIT $2
+	`, cursor, w.pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	users, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (roleAuditUser, error) {
+		var u roleAuditUser
+		err := row.Scan(&u.ID, &u.Realm, &u.Roles)
+		return u, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, nil
+}
+
+// auditPage compares one page of users with Keycloak
+func (w *RoleAuditWorker) auditPage(ctx context.Context, jobID int64, users []roleAuditUser) (roleAuditStats, error) {
+	var stats roleAuditStats
+	if len(users) == 0 {
+		return stats, nil
+	}
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	pending, err := usersWithPendingKeycloakChanges(ctx, w.dbPool, ids)
+	if err != nil {
+		return stats, err
+	}
+	known, err := w.civicOSRoles(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, u := range users {
+		if pending[u.ID] {
+			if err := w.keepDrift(ctx, u.ID); err != nil {
+				return stats, err
+			}
+			stats.Skipped++
+			continue
+		}
+
+		provider, err := providerForRealm(w.provider, u.Realm)
+		if errors.Is(err, errIdentityRealmNotServed) {
+			log.Printf("[Job %d] Skipping user %s: %v", jobID, u.ID, err)
+			if err := w.keepDrift(ctx, u.ID); err != nil {
+				return stats, err
+			}
+			stats.Skipped++
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		// Users missing from Keycloak are the user sync's missing_in_keycloak conflicts
+		keycloakRoles, err := provider.GetUserRoles(ctx, u.ID)
+		if errors.Is(err, errIdentityUserNotFound) {
+			if err := w.keepDrift(ctx, u.ID); err != nil {
+				return stats, err
+			}
+			stats.Skipped++
+			continue
+		}
+		if err != nil {
+			return stats, fmt.Errorf("user %s: %w", u.ID, err)
+		}
+		stats.Checked++
+
+		missingInKeycloak, missingInDatabase := roleDrift(keycloakRoles, u.Roles, known)
+		if err := w.auditUser(ctx, provider, u, missingInKeycloak, missingInDatabase, &stats); err != nil {
+			return stats, fmt.Errorf("user %s: %w", u.ID, err)
+		}
+	}
+	return stats, nil
+}
+
+// civicOSRoles returns the role_keys the audit compares
+func (w *RoleAuditWorker) civicOSRoles(ctx context.Context) (map[string]bool, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT role_key FROM metadata.roles WHERE NOT metadata.is_keycloak_system_role(role_key)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		known[key] = true
+	}
+	return known, nil
+}
+
+// roleDrift compares a user's effective Keycloak roles with their user_roles
+// role_keys. Keycloak roles that aren't in known (Civic OS roles) are left
+// out. Both results are sorted.
+func roleDrift(keycloakRoles, databaseRoles []string, known map[string]bool) (missingInKeycloak, missingInDatabase []string) {
+	inKeycloak := make(map[string]bool, len(keycloakRoles))
+	for _, name := range keycloakRoles {
+		inKeycloak[name] = true
+	}
+	inDatabase := make(map[string]bool, len(databaseRoles))
+	for _, key := range databaseRoles {
+		inDatabase[key] = true
+		if !inKeycloak[key] {
+			missingInKeycloak = append(missingInKeycloak, key)
+		}
+	}
+	for name := range inKeycloak {
+		if known[name] && !inDatabase[name] {
+			missingInDatabase = append(missingInDatabase, name)
+		}
+	}
+	slices.Sort(missingInKeycloak)
+	slices.Sort(missingInDatabase)
+	return missingInKeycloak, missingInDatabase
+}
+
+// auditUser records (and heals) one user's drift
+func (w *RoleAuditWorker) auditUser(ctx context.Context, provider IdentityProvider, u roleAuditUser, missingInKeycloak, missingInDatabase []string, stats *roleAuditStats) error {
+	// Read when a revoke is needed: only direct mappings can be revoked
+	var directRoles []string
+	directRead := false
+	for _, d := range []struct {
+		driftType string
+		roles     []string
+	}{
+		{roleDriftMissingInKeycloak, missingInKeycloak},
+		{roleDriftMissingInDatabase, missingInDatabase},
+	} {
+		for _, role := range d.roles {
+			stats.Found++
+			if w.heal == roleAuditHealToKeycloak && d.driftType == roleDriftMissingInDatabase && !directRead {
+				roles, err := provider.GetUserDirectRoles(ctx, u.ID)
+				if err != nil {
+					return err
+				}
+				directRoles, directRead = roles, true
+			}
+
+			resolution, healError, err := w.healDrift(ctx, u.ID, role, d.driftType, directRoles)
+			if err != nil {
+				return err
+			}
+			if resolution != "" {
+				stats.Healed++
+			}
+			if err := recordRoleDrift(ctx, w.dbPool, u.ID, u.Realm, role, d.driftType, resolution, healError); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// healDrift heals one difference in the configured direction, returning the
+// resolution for the drift row ("" when it stays open) and, when healing
+// isn't possible, why
+func (w *RoleAuditWorker) healDrift(ctx context.Context, userID, role, driftType string, directRoles []string) (string, string, error) {
+	switch w.heal {
+	case roleAuditHealToDatabase:
+		// The user_roles trigger queues an assign or revoke job that finds
+		// Keycloak already matching
+		var err error
+		if driftType == roleDriftMissingInKeycloak {
+			_, err = w.dbPool.Exec(ctx, `
+				DELETE FROM metadata.user_roles ur
+				USING metadata.roles r
+				WHERE ur.role_id = r.id AND ur.user_id = $1 AND r.role_key = $2
+			`, userID, role)
+		} else {
+			_, err = w.dbPool.Exec(ctx, `
+				INSERT INTO metadata.user_roles (user_id, role_id, synced_at)
+				SELECT $1, r.id, NOW() FROM metadata.roles r WHERE r.role_key = $2
+				ON CONFLICT (user_id, role_id) DO NOTHING
+			`, userID, role)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to heal %s role %s: %w", driftType, role, err)
+		}
+		return "healed_database", "", nil
+
+	case roleAuditHealToKeycloak:
+		var args river.JobArgs = AssignKeycloakRoleArgs{UserID: userID, RoleName: role}
+		if driftType == roleDriftMissingInDatabase {
+			if !slices.Contains(directRoles, role) {
+				return "", "Inherited through a Keycloak group or composite role; remove it there", nil
+			}
+			args = RevokeKeycloakRoleArgs{UserID: userID, RoleName: role}
+		}
+		if _, err := w.jobs.Insert(ctx, args, nil); err != nil {
+			return "", "", fmt.Errorf("failed to queue %s for role %s: %w", args.Kind(), role, err)
+		}
+		return "healed_keycloak", "", nil
+	}
+	return "", "", nil
+}
+
+// recordRoleDrift opens (or re-opens) a drift row and marks it seen now. A
+// non-empty resolution closes it at once: the difference was healed.
+func recordRoleDrift(ctx context.Context, db pgxExecer, userID, realm, role, driftType, resolution, healError string) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO metadata.role_drift (user_id, role_key, drift_type, realm, resolved_at, resolution, heal_error)
+		VALUES ($1, $2, $3, NULLIF($4, ''),
+		        CASE WHEN $5::TEXT = '' THEN NULL ELSE NOW() END, NULLIF($5, ''), NULLIF($6, ''))
+		ON CONFLICT (user_id, role_key, drift_type) DO UPDATE
+		SET realm = EXCLUDED.realm, last_seen_at = NOW(), resolved_at = EXCLUDED.resolved_at,
+		    resolution = EXCLUDED.resolution, heal_error = EXCLUDED.heal_error
+	`, userID, role, driftType, realm, resolution, healError)
+	if err != nil {
+		return fmt.Errorf("failed to record %s drift for role %s: %w", driftType, role, err)
+	}
+	return nil
+}
+
+// keepDrift keeps a skipped user's open drift open; it wasn't re-checked
+func (w *RoleAuditWorker) keepDrift(ctx context.Context, userID string) error {
+	if _, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.role_drift SET last_seen_at = NOW()
+		WHERE user_id = $1 AND resolved_at IS NULL
+	`, userID); err != nil {
+		return fmt.Errorf("failed to keep drift of user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// savePage adds a page's results to the run and moves its cursor past the page
+func (w *RoleAuditWorker) savePage(ctx context.Context, runID int64, cursor string, page roleAuditStats) error {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.role_audit_runs
+		SET last_user_id = NULLIF($2, '')::UUID,
+		    users_checked = users_checked + $3,
+		    users_skipped = users_skipped + $4,
+		    drift_found = drift_found + $5,
+		    drift_healed = drift_healed + $6,
+		    error_message = NULL
+		WHERE id = $1
+	`, runID, cursor, page.Checked, page.Skipped, page.Found, page.Healed)
+	if err != nil {
+		return fmt.Errorf("failed to save role audit progress: %w", err)
+	}
+	return nil
+}
+
+// finishRun resolves drift this run did not see again and closes the run
+func (w *RoleAuditWorker) finishRun(ctx context.Context, runID int64) (int, error) {
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE metadata.role_drift d
+		SET resolved_at = NOW(), resolution = 'converged'
+		FROM metadata.role_audit_runs r
+		WHERE r.id = $1 AND d.resolved_at IS NULL AND d.last_seen_at < r.started_at
+	`, runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve stale drift: %w", err)
+	}
+
+	var openDrift int
+	err = tx.QueryRow(ctx, `
+		UPDATE metadata.role_audit_runs
+		SET status = 'completed', finished_at = NOW(),
+		    open_drift = (SELECT COUNT(*) FROM metadata.role_drift WHERE resolved_at IS NULL)
+		WHERE id = $1
+		RETURNING open_drift
+	`, runID).Scan(&openDrift)
+	if err != nil {
+		return 0, fmt.Errorf("failed to finish role audit run: %w", err)
+	}
+
+	return openDrift, tx.Commit(ctx)
+}
+
+// failRun records the error on the run, marking it failed once River has no
+// attempts left, and returns the error for River to retry
+func (w *RoleAuditWorker) failRun(ctx context.Context, job *river.Job[RoleAuditArgs], runID int64, err error) error {
+	final := job.Attempt >= job.MaxAttempts
+	_, dbErr := w.dbPool.Exec(ctx, `
+		UPDATE metadata.role_audit_runs
+		SET error_message = $2,
+		    status = CASE WHEN $3 THEN 'failed' ELSE status END,
+		    finished_at = CASE WHEN $3 THEN NOW() ELSE finished_at END
+		WHERE id = $1
+	`, runID, err.Error(), final)
+	if dbErr != nil {
+		log.Printf("[Job %d] Failed to record role audit error on run %d: %v", job.ID, runID, dbErr)
+	}
+	return fmt.Errorf("role audit failed: %w", err)
+}
+
+// ============================================================================
+// Role Audit Maintenance Task
+// ============================================================================
+
+// RoleAuditTask enqueues the daily role_audit job
+type RoleAuditTask struct {
+	jobs *JobEnqueuer
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (r *RoleAuditTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "role_audit",
+		Description: "Enqueue a job that compares user_roles with Keycloak role mappings and records drift",
+		Interval:    24 * time.Hour,
+		Jitter:      30 * time.Minute,
+		Run:         r.runEnqueue,
+	}
+}
+
+// runEnqueue queues a role_audit job unless one is still pending
+func (r *RoleAuditTask) runEnqueue(ctx context.Context) (string, error) {
+	result, err := r.jobs.Insert(ctx, RoleAuditArgs{}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue role_audit: %w", err)
+	}
+	if result.UniqueSkippedAsDuplicate {
+		return "Previous audit still pending, nothing enqueued", nil
+	}
+	return "Enqueued role_audit", nil
+}
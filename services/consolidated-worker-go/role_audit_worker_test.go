@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRoleDrift(t *testing.T) {
+	known := map[string]bool{"admin": true, "editor": true, "user": true, "viewer": true}
+	keycloakRoles := []string{"user", "editor", "offline_access", "default-roles-civic-os", "realm-only"}
+	databaseRoles := []string{"admin", "user"}
+
+	missingInKeycloak, missingInDatabase := roleDrift(keycloakRoles, databaseRoles, known)
+	if fmt.Sprint(missingInKeycloak) != "[admin]" {
+		t.Errorf("missing in Keycloak = %v, want [admin]", missingInKeycloak)
+	}
+	// System roles and roles Civic OS doesn't have are not drift
+	if fmt.Sprint(missingInDatabase) != "[editor]" {
+		t.Errorf("missing in database = %v, want [editor]", missingInDatabase)
+	}
+
+	missingInKeycloak, missingInDatabase = roleDrift([]string{"viewer", "user"}, []string{"user", "viewer"}, known)
+	if missingInKeycloak != nil || missingInDatabase != nil {
+		t.Errorf("matching roles: drift = %v, %v", missingInKeycloak, missingInDatabase)
+	}
+}
+
+func TestParseRoleAuditHeal(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", roleAuditHealOff, false},
+		{"off", roleAuditHealOff, false},
+		{"to_database", roleAuditHealToDatabase, false},
+		{"to_keycloak", roleAuditHealToKeycloak, false},
+		{"both", "", true},
+	} {
+		got, err := parseRoleAuditHeal(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseRoleAuditHeal(%q) = %q, %v", tt.value, got, err)
+		}
+	}
+}
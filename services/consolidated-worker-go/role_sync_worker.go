@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -16,9 +17,10 @@ import (
 
 // SyncKeycloakRoleArgs defines the job arguments for role CRUD sync
 type SyncKeycloakRoleArgs struct {
-	RoleName    string `json:"role_name"`
-	Description string `json:"description"`
-	Action      string `json:"action"` // "create" or "delete"
+	RoleName    string           `json:"role_name"`
+	Description string           `json:"description"`
+	Action      string           `json:"action"`          // "create" or "delete"
+	Audit       *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger or enqueue_outbox_message()
 }
 
 func (SyncKeycloakRoleArgs) Kind() string { return "sync_keycloak_role" }
@@ -34,8 +36,8 @@ func (SyncKeycloakRoleArgs) InsertOpts() river.InsertOpts {
 // SyncKeycloakRoleWorker syncs role CRUD operations to Keycloak
 type SyncKeycloakRoleWorker struct {
 	river.WorkerDefaults[SyncKeycloakRoleArgs]
-	dbPool         *pgxpool.Pool
-	keycloakClient *KeycloakClient
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
 }
 
 func (w *SyncKeycloakRoleWorker) Work(ctx context.Context, job *river.Job[SyncKeycloakRoleArgs]) error {
@@ -43,20 +45,30 @@ func (w *SyncKeycloakRoleWorker) Work(ctx context.Context, job *river.Job[SyncKe
 	log.Printf("[Job %d] Starting role sync (attempt %d/%d): role=%s action=%s",
 		job.ID, job.Attempt, job.MaxAttempts, job.Args.RoleName, job.Args.Action)
 
-	var err error
-	switch job.Args.Action {
-	case "create":
-		err = w.keycloakClient.CreateRealmRole(ctx, job.Args.RoleName, job.Args.Description)
-	case "delete":
-		err = w.keycloakClient.DeleteRealmRole(ctx, job.Args.RoleName)
-	default:
+	if job.Args.Action != "create" && job.Args.Action != "delete" {
 		log.Printf("[Job %d] Unknown action '%s', skipping", job.ID, job.Args.Action)
 		return nil
 	}
 
+	// Every realm gets the same roles; both actions are idempotent, so a
+	// retry redoes the realms already done
+	providers, err := providerRealms(w.provider)
 	if err != nil {
-		return fmt.Errorf("role sync failed: %w", err)
+		return err
 	}
+	for _, provider := range providers {
+		if job.Args.Action == "create" {
+			err = provider.CreateRole(ctx, job.Args.RoleName, job.Args.Description)
+		} else {
+			err = provider.DeleteRole(ctx, job.Args.RoleName)
+		}
+		if err != nil {
+			return fmt.Errorf("role sync failed: %w", err)
+		}
+	}
+
+	recordIdentityAudit(ctx, w.dbPool, w.provider, job.JobRow, job.Args.Audit,
+		crudAuditEntry("role", job.Args.Action, job.Args.RoleName, job.Args.Description))
 
 	duration := time.Since(startTime)
 	log.Printf("[Job %d] Role '%s' %sd in Keycloak in %v", job.ID, job.Args.RoleName, job.Args.Action, duration)
@@ -69,8 +81,9 @@ func (w *SyncKeycloakRoleWorker) Work(ctx context.Context, job *river.Job[SyncKe
 
 // AssignKeycloakRoleArgs defines the job arguments for role assignment
 type AssignKeycloakRoleArgs struct {
-	UserID   string `json:"user_id"`
-	RoleName string `json:"role_name"`
+	UserID   string           `json:"user_id"`
+	RoleName string           `json:"role_name"`
+	Audit    *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger or enqueue_outbox_message()
 }
 
 func (AssignKeycloakRoleArgs) Kind() string { return "assign_keycloak_role" }
@@ -86,8 +99,8 @@ func (AssignKeycloakRoleArgs) InsertOpts() river.InsertOpts {
 // AssignKeycloakRoleWorker assigns realm roles to users in Keycloak
 type AssignKeycloakRoleWorker struct {
 	river.WorkerDefaults[AssignKeycloakRoleArgs]
-	dbPool         *pgxpool.Pool
-	keycloakClient *KeycloakClient
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
 }
 
 func (w *AssignKeycloakRoleWorker) Work(ctx context.Context, job *river.Job[AssignKeycloakRoleArgs]) error {
@@ -95,11 +108,30 @@ func (w *AssignKeycloakRoleWorker) Work(ctx context.Context, job *river.Job[Assi
 	log.Printf("[Job %d] Starting role assignment (attempt %d/%d): user=%s role=%s",
 		job.ID, job.Attempt, job.MaxAttempts, job.Args.UserID, job.Args.RoleName)
 
-	err := w.keycloakClient.AssignRealmRoles(ctx, job.Args.UserID, []string{job.Args.RoleName})
+	provider, err := providerForUser(ctx, w.dbPool, w.provider, job.Args.UserID)
+	if err != nil {
+		return err
+	}
+
+	before := userRolesState(ctx, provider, job.Args.UserID)
+	err = provider.AssignRoles(ctx, job.Args.UserID, []string{job.Args.RoleName})
 	if err != nil {
 		return fmt.Errorf("assign role failed: %w", err)
 	}
 
+	recordIdentityAudit(ctx, w.dbPool, provider, job.JobRow, job.Args.Audit, identityAuditEntry{
+		Operation:  "role.assign",
+		TargetType: "user",
+		TargetID:   job.Args.UserID,
+		Before:     before,
+		After:      userRolesState(ctx, provider, job.Args.UserID),
+	})
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "keycloak_role_assigned", map[string]interface{}{
+		"target_user_id": job.Args.UserID,
+		"role_name":      job.Args.RoleName,
+	})
+
 	duration := time.Since(startTime)
 	log.Printf("[Job %d] Assigned role '%s' to user %s in Keycloak in %v",
 		job.ID, job.Args.RoleName, job.Args.UserID, duration)
@@ -112,8 +144,9 @@ func (w *AssignKeycloakRoleWorker) Work(ctx context.Context, job *river.Job[Assi
 
 // RevokeKeycloakRoleArgs defines the job arguments for role revocation
 type RevokeKeycloakRoleArgs struct {
-	UserID   string `json:"user_id"`
-	RoleName string `json:"role_name"`
+	UserID   string           `json:"user_id"`
+	RoleName string           `json:"role_name"`
+	Audit    *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger or enqueue_outbox_message()
 }
 
 func (RevokeKeycloakRoleArgs) Kind() string { return "revoke_keycloak_role" }
@@ -129,8 +162,8 @@ func (RevokeKeycloakRoleArgs) InsertOpts() river.InsertOpts {
 // RevokeKeycloakRoleWorker revokes realm roles from users in Keycloak
 type RevokeKeycloakRoleWorker struct {
 	river.WorkerDefaults[RevokeKeycloakRoleArgs]
-	dbPool         *pgxpool.Pool
-	keycloakClient *KeycloakClient
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
 }
 
 func (w *RevokeKeycloakRoleWorker) Work(ctx context.Context, job *river.Job[RevokeKeycloakRoleArgs]) error {
@@ -138,13 +171,215 @@ func (w *RevokeKeycloakRoleWorker) Work(ctx context.Context, job *river.Job[Revo
 	log.Printf("[Job %d] Starting role revocation (attempt %d/%d): user=%s role=%s",
 		job.ID, job.Attempt, job.MaxAttempts, job.Args.UserID, job.Args.RoleName)
 
-	err := w.keycloakClient.RemoveRealmRoles(ctx, job.Args.UserID, []string{job.Args.RoleName})
+	provider, err := providerForUser(ctx, w.dbPool, w.provider, job.Args.UserID)
+	if err != nil {
+		return err
+	}
+
+	before := userRolesState(ctx, provider, job.Args.UserID)
+	err = provider.RemoveRoles(ctx, job.Args.UserID, []string{job.Args.RoleName})
 	if err != nil {
 		return fmt.Errorf("revoke role failed: %w", err)
 	}
 
+	recordIdentityAudit(ctx, w.dbPool, provider, job.JobRow, job.Args.Audit, identityAuditEntry{
+		Operation:  "role.revoke",
+		TargetType: "user",
+		TargetID:   job.Args.UserID,
+		Before:     before,
+		After:      userRolesState(ctx, provider, job.Args.UserID),
+	})
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "keycloak_role_revoked", map[string]interface{}{
+		"target_user_id": job.Args.UserID,
+		"role_name":      job.Args.RoleName,
+	})
+
 	duration := time.Since(startTime)
 	log.Printf("[Job %d] Revoked role '%s' from user %s in Keycloak in %v",
 		job.ID, job.Args.RoleName, job.Args.UserID, duration)
 	return nil
 }
+
+// ============================================================================
+// Group CRUD Sync Worker (sync_keycloak_group)
+// ============================================================================
+
+// SyncKeycloakGroupArgs defines the job arguments for group CRUD sync
+type SyncKeycloakGroupArgs struct {
+	GroupName   string           `json:"group_name"`
+	Description string           `json:"description"`
+	Action      string           `json:"action"`          // "create" or "delete"
+	Audit       *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger or enqueue_outbox_message()
+}
+
+func (SyncKeycloakGroupArgs) Kind() string { return "sync_keycloak_group" }
+
+func (SyncKeycloakGroupArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "user_provisioning",
+		MaxAttempts: 5,
+		Priority:    1,
+	}
+}
+
+// SyncKeycloakGroupWorker syncs group CRUD operations to Keycloak
+type SyncKeycloakGroupWorker struct {
+	river.WorkerDefaults[SyncKeycloakGroupArgs]
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
+}
+
+func (w *SyncKeycloakGroupWorker) Work(ctx context.Context, job *river.Job[SyncKeycloakGroupArgs]) error {
+	startTime := time.Now()
+	log.Printf("[Job %d] Starting group sync (attempt %d/%d): group=%s action=%s",
+		job.ID, job.Attempt, job.MaxAttempts, job.Args.GroupName, job.Args.Action)
+
+	if job.Args.Action != "create" && job.Args.Action != "delete" {
+		log.Printf("[Job %d] Unknown action '%s', skipping", job.ID, job.Args.Action)
+		return nil
+	}
+
+	// Every realm gets the same groups; both actions are idempotent, so a
+	// retry redoes the realms already done
+	providers, err := providerRealms(w.provider)
+	if err != nil {
+		return err
+	}
+	for _, provider := range providers {
+		if job.Args.Action == "create" {
+			err = provider.CreateGroup(ctx, job.Args.GroupName, job.Args.Description)
+		} else {
+			err = provider.DeleteGroup(ctx, job.Args.GroupName)
+		}
+		if err != nil {
+			return fmt.Errorf("group sync failed: %w", err)
+		}
+	}
+
+	recordIdentityAudit(ctx, w.dbPool, w.provider, job.JobRow, job.Args.Audit,
+		crudAuditEntry("group", job.Args.Action, job.Args.GroupName, job.Args.Description))
+
+	duration := time.Since(startTime)
+	log.Printf("[Job %d] Group '%s' %sd in Keycloak in %v", job.ID, job.Args.GroupName, job.Args.Action, duration)
+	return nil
+}
+
+// ============================================================================
+// Group Assignment Worker (assign_keycloak_group)
+// ============================================================================
+
+// AssignKeycloakGroupArgs defines the job arguments for group assignment
+type AssignKeycloakGroupArgs struct {
+	UserID    string           `json:"user_id"`
+	GroupName string           `json:"group_name"`
+	Audit     *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger or enqueue_outbox_message()
+}
+
+func (AssignKeycloakGroupArgs) Kind() string { return "assign_keycloak_group" }
+
+func (AssignKeycloakGroupArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "user_provisioning",
+		MaxAttempts: 5,
+		Priority:    1,
+	}
+}
+
+// AssignKeycloakGroupWorker adds users to groups in Keycloak
+type AssignKeycloakGroupWorker struct {
+	river.WorkerDefaults[AssignKeycloakGroupArgs]
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
+}
+
+func (w *AssignKeycloakGroupWorker) Work(ctx context.Context, job *river.Job[AssignKeycloakGroupArgs]) error {
+	startTime := time.Now()
+	log.Printf("[Job %d] Starting group assignment (attempt %d/%d): user=%s group=%s",
+		job.ID, job.Attempt, job.MaxAttempts, job.Args.UserID, job.Args.GroupName)
+
+	provider, err := providerForUser(ctx, w.dbPool, w.provider, job.Args.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = provider.AddUserToGroup(ctx, job.Args.UserID, job.Args.GroupName)
+	if err != nil {
+		return fmt.Errorf("assign group failed: %w", err)
+	}
+
+	recordIdentityAudit(ctx, w.dbPool, provider, job.JobRow, job.Args.Audit,
+		membershipAuditEntry("group.add_member", job.Args.UserID, job.Args.GroupName, true))
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "keycloak_group_assigned", map[string]interface{}{
+		"target_user_id": job.Args.UserID,
+		"group_name":     job.Args.GroupName,
+	})
+
+	duration := time.Since(startTime)
+	log.Printf("[Job %d] Added user %s to group '%s' in Keycloak in %v",
+		job.ID, job.Args.UserID, job.Args.GroupName, duration)
+	return nil
+}
+
+// ============================================================================
+// Group Revocation Worker (revoke_keycloak_group)
+// ============================================================================
+
+// RevokeKeycloakGroupArgs defines the job arguments for group revocation
+type RevokeKeycloakGroupArgs struct {
+	UserID    string           `json:"user_id"`
+	GroupName string           `json:"group_name"`
+	Audit     *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger or enqueue_outbox_message()
+}
+
+func (RevokeKeycloakGroupArgs) Kind() string { return "revoke_keycloak_group" }
+
+func (RevokeKeycloakGroupArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "user_provisioning",
+		MaxAttempts: 5,
+		Priority:    1,
+	}
+}
+
+// RevokeKeycloakGroupWorker removes users from groups in Keycloak
+type RevokeKeycloakGroupWorker struct {
+	river.WorkerDefaults[RevokeKeycloakGroupArgs]
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
+}
+
+func (w *RevokeKeycloakGroupWorker) Work(ctx context.Context, job *river.Job[RevokeKeycloakGroupArgs]) error {
+	startTime := time.Now()
+	log.Printf("[Job %d] Starting group revocation (attempt %d/%d): user=%s group=%s",
+		job.ID, job.Attempt, job.MaxAttempts, job.Args.UserID, job.Args.GroupName)
+
+	provider, err := providerForUser(ctx, w.dbPool, w.provider, job.Args.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = provider.RemoveUserFromGroup(ctx, job.Args.UserID, job.Args.GroupName)
+	if errors.Is(err, errIdentityGroupNotFound) {
+		// Deleted in Keycloak, so the membership is already gone
+		log.Printf("[Job %d] Group '%s' not in Keycloak, nothing to revoke", job.ID, job.Args.GroupName)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("revoke group failed: %w", err)
+	}
+
+	recordIdentityAudit(ctx, w.dbPool, provider, job.JobRow, job.Args.Audit,
+		membershipAuditEntry("group.remove_member", job.Args.UserID, job.Args.GroupName, false))
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "keycloak_group_revoked", map[string]interface{}{
+		"target_user_id": job.Args.UserID,
+		"group_name":     job.Args.GroupName,
+	})
+
+	duration := time.Since(startTime)
+	log.Printf("[Job %d] Removed user %s from group '%s' in Keycloak in %v",
+		job.ID, job.Args.UserID, job.Args.GroupName, duration)
+	return nil
+}
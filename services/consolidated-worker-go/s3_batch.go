@@ -0,0 +1,68 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ============================================================================
+// Batch Deletes
+//
+// The cleanup tasks, backup rotation and archival delete many objects at a
+// time. DeleteObjects removes up to 1000 keys in one request instead of one
+// request per key, which matters under S3_MAX_CONCURRENCY and on providers
+// that bill per request. The call succeeds as a whole and reports the keys it
+// couldn't delete; a key that doesn't exist counts as deleted, as with
+// DeleteObject.
+// ============================================================================
+
+// s3DeleteObjectsMax is the most keys one DeleteObjects call accepts
+const s3DeleteObjectsMax = 1000
+
+// batchObjectDeleter is the subset of *s3.Client deleteObjectsBatch uses
+type batchObjectDeleter interface {
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// deleteObjectsBatch deletes keys from bucket, s3DeleteObjectsMax per call.
+// It returns the deleted keys in the order given and the error of each key
+// that wasn't deleted; a failed call fails every key it carried.
+func deleteObjectsBatch(ctx context.Context, client batchObjectDeleter, bucket string, keys []string) ([]string, map[string]error) {
+	var deleted []string
+	failed := make(map[string]error)
+
+	for start := 0; start < len(keys); start += s3DeleteObjectsMax {
+		chunk := keys[start:min(start+s3DeleteObjectsMax, len(keys))]
+		objects := make([]types.ObjectIdentifier, len(chunk))
+		for i, key := range chunk {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+
+		// Quiet: the response lists only the keys that failed
+		out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			for _, key := range chunk {
+				failed[key] = err
+			}
+			continue
+		}
+		for _, e := range out.Errors {
+			failed[aws.ToString(e.Key)] = fmt.Errorf("%s: %s", aws.ToString(e.Code), aws.ToString(e.Message))
+		}
+		for _, key := range chunk {
+			if failed[key] == nil {
+				deleted = append(deleted, key)
+			}
+		}
+	}
+	return deleted, failed
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fakeBatchDeleter records DeleteObjects calls; keys in denied fail one by
+// one and the call numbered failCall fails as a whole
+type fakeBatchDeleter struct {
+	calls    [][]string
+	denied   map[string]bool
+	failCall int
+}
+
+func (f *fakeBatchDeleter) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	var keys []string
+	for _, object := range params.Delete.Objects {
+		keys = append(keys, aws.ToString(object.Key))
+	}
+	f.calls = append(f.calls, keys)
+	if len(f.calls) == f.failCall {
+		return nil, errors.New("SlowDown")
+	}
+	if !aws.ToBool(params.Delete.Quiet) {
+		return nil, errors.New("expected quiet mode")
+	}
+	out := &s3.DeleteObjectsOutput{}
+	for _, key := range keys {
+		if f.denied[key] {
+			out.Errors = append(out.Errors, types.Error{Key: aws.String(key), Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")})
+		}
+	}
+	return out, nil
+}
+
+func TestDeleteObjectsBatch_Chunks(t *testing.T) {
+	keys := make([]string, 2500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("exports/%04d.csv", i)
+	}
+	api := &fakeBatchDeleter{denied: map[string]bool{"exports/0007.csv": true}}
+
+	deleted, failed := deleteObjectsBatch(context.Background(), api, "files", keys)
+	if len(api.calls) != 3 || len(api.calls[0]) != 1000 || len(api.calls[2]) != 500 {
+		t.Fatalf("calls = %d, want 1000+1000+500 keys", len(api.calls))
+	}
+	if len(deleted) != 2499 || deleted[7] != "exports/0008.csv" {
+		t.Errorf("deleted %d keys (8th %s), want 2499 in order", len(deleted), deleted[7])
+	}
+	if err := failed["exports/0007.csv"]; err == nil || err.Error() != "AccessDenied: Access Denied" {
+		t.Errorf("failed = %v, want the denied key", failed)
+	}
+}
+
+func TestDeleteObjectsBatch_FailedCallFailsItsKeys(t *testing.T) {
+	keys := make([]string, 1200)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+	}
+	api := &fakeBatchDeleter{failCall: 1}
+
+	deleted, failed := deleteObjectsBatch(context.Background(), api, "files", keys)
+	if len(failed) != 1000 || len(deleted) != 200 {
+		t.Errorf("deleted %d, failed %d; want 200 and 1000", len(deleted), len(failed))
+	}
+	if !reflect.DeepEqual(deleted[:2], []string{"k1000", "k1001"}) {
+		t.Errorf("deleted = %v..., want the second chunk", deleted[:2])
+	}
+}
+
+func TestDeleteObjectsBatch_Empty(t *testing.T) {
+	api := &fakeBatchDeleter{}
+	deleted, failed := deleteObjectsBatch(context.Background(), api, "files", nil)
+	if len(api.calls) != 0 || deleted != nil || len(failed) != 0 {
+		t.Errorf("no keys: calls %d, deleted %v, failed %v", len(api.calls), deleted, failed)
+	}
+}
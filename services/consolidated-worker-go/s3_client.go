@@ -3,10 +3,10 @@ package main
 import (
 	"context"
 	"log"
+	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
@@ -14,6 +14,36 @@ import (
 type S3Clients struct {
 	S3Client        *s3.Client
 	S3PresignClient *s3.PresignClient
+
+	credentials *rotatingCredentials
+}
+
+// SetCredentials swaps in a rotated access key for both clients (see
+// secrets.go). Requests already signed keep the old key.
+func (c *S3Clients) SetCredentials(accessKey, secretKey string) {
+	c.credentials.Set(accessKey, secretKey)
+}
+
+// rotatingCredentials is a static key pair that can be replaced at runtime.
+// The SDK would cache a provider passed to LoadDefaultConfig forever, so it
+// is assigned to aws.Config.Credentials directly.
+type rotatingCredentials struct {
+	value atomic.Pointer[aws.Credentials]
+}
+
+func newRotatingCredentials(accessKey, secretKey string) *rotatingCredentials {
+	c := &rotatingCredentials{}
+	c.Set(accessKey, secretKey)
+	return c
+}
+
+func (c *rotatingCredentials) Set(accessKey, secretKey string) {
+	c.value.Store(&aws.Credentials{AccessKeyID: accessKey, SecretAccessKey: secretKey, Source: "S3Credentials"})
+}
+
+// Retrieve implements aws.CredentialsProvider
+func (c *rotatingCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	return *c.value.Load(), nil
 }
 
 // initializeS3Client creates AWS S3 clients with optional custom endpoint for presigning.
@@ -32,6 +62,7 @@ func initializeS3Client(ctx context.Context) *S3Clients {
 	s3Region := getS3Env("S3_REGION", "AWS_REGION", "us-east-1")
 	s3Endpoint := getS3Env("S3_ENDPOINT", "AWS_ENDPOINT_URL", "")
 	publicEndpoint := getEnv("S3_PUBLIC_ENDPOINT", "")
+	policy := loadS3Policy()
 
 	log.Printf("[S3] Initializing S3 client...")
 	log.Printf("[S3] Region: %s", s3Region)
@@ -41,19 +72,15 @@ func initializeS3Client(ctx context.Context) *S3Clients {
 	if publicEndpoint != "" {
 		log.Printf("[S3] Public Endpoint (presigning): %s", publicEndpoint)
 	}
+	log.Printf("[S3] Policy: %s", policy)
 
-	// Initialize AWS S3 client with explicit credentials
-	awsCfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(s3Region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-			s3AccessKey,
-			s3SecretKey,
-			"", // session token (not used)
-		)),
-	)
+	// Initialize AWS S3 client with explicit (rotatable) credentials
+	s3Credentials := newRotatingCredentials(s3AccessKey, s3SecretKey)
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(s3Region))
 	if err != nil {
 		log.Fatalf("[S3] Failed to load AWS SDK configuration: %v", err)
 	}
+	awsCfg.Credentials = s3Credentials
 
 	// Configure S3 client with custom endpoint (if provided) and path-style URLs
 	s3Client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
@@ -61,23 +88,20 @@ func initializeS3Client(ctx context.Context) *S3Clients {
 			o.BaseEndpoint = aws.String(s3Endpoint)
 		}
 		o.UsePathStyle = true // Required for MinIO and DigitalOcean Spaces
+		// Limiter and timeout first, so metrics time the call without the wait
+		policy.Apply(o, workerMetrics)
+		o.APIOptions = append(o.APIOptions, s3TracingMiddleware(), s3MetricsMiddleware(workerMetrics))
 	})
 
 	// For presigning, use public endpoint if configured (for local MinIO/Docker)
 	var s3PresignClient *s3.PresignClient
 	if publicEndpoint != "" {
 		// Create separate config with public endpoint for presigned URLs
-		publicCfg, err := config.LoadDefaultConfig(ctx,
-			config.WithRegion(s3Region),
-			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-				s3AccessKey,
-				s3SecretKey,
-				"",
-			)),
-		)
+		publicCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(s3Region))
 		if err != nil {
 			log.Fatalf("[S3] Failed to load AWS SDK configuration for presigning: %v", err)
 		}
+		publicCfg.Credentials = s3Credentials
 
 		publicS3Client := s3.NewFromConfig(publicCfg, func(o *s3.Options) {
 			o.BaseEndpoint = aws.String(publicEndpoint)
@@ -86,13 +110,17 @@ func initializeS3Client(ctx context.Context) *S3Clients {
 		s3PresignClient = s3.NewPresignClient(publicS3Client)
 		log.Println("[S3] ✓ S3 client initialized with public endpoint for presigning")
 	} else {
-		s3PresignClient = s3.NewPresignClient(s3Client)
+		// Presigning is local signing, not an S3 call, so it skips metrics and tracing
+		s3PresignClient = s3.NewPresignClient(s3Client, s3.WithPresignClientFromClientOptions(func(o *s3.Options) {
+			o.APIOptions = nil
+		}))
 		log.Println("[S3] ✓ S3 client initialized")
 	}
 
 	return &S3Clients{
 		S3Client:        s3Client,
 		S3PresignClient: s3PresignClient,
+		credentials:     s3Credentials,
 	}
 }
 
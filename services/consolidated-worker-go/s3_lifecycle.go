@@ -0,0 +1,255 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// ============================================================================
+// Bucket Lifecycle Rules
+//
+// On startup the worker makes sure the buckets it manages
+// (S3_LIFECYCLE_BUCKETS, default S3_BUCKET) carry its lifecycle rules:
+//
+//   - civic-os-abort-multipart aborts multipart uploads still incomplete
+//     S3_ABORT_MULTIPART_DAYS (default 1) days after they started. Large
+//     exports and browser uploads go up in parts, and an upload that dies
+//     leaves billed parts no object listing shows.
+//   - civic-os-originals-ia moves originals to STANDARD_IA
+//     S3_ORIGINALS_IA_DAYS days after upload (default 0: off). Lifecycle
+//     filters match prefixes and tags, not the original.{ext} name, so while
+//     the rule is on the file pipeline tags each verified original
+//     civic-os-object=original. Originals uploaded earlier stay untagged.
+//
+// The bucket's other rules are kept: its configuration is read, the managed
+// rules replaced, and the result written back only if it changed. A day
+// count of 0 removes its rule. Failures are logged and startup goes on;
+// a provider without lifecycle support, or without STANDARD_IA (MinIO
+// without a remote tier), only goes without the rule.
+// ============================================================================
+
+const (
+	lifecycleRuleAbortMultipart = "civic-os-abort-multipart"
+	lifecycleRuleOriginalsIA    = "civic-os-originals-ia"
+
+	// originalObjectTag marks originals for the civic-os-originals-ia rule
+	originalObjectTagKey   = "civic-os-object"
+	originalObjectTagValue = "original"
+
+	// STANDARD_IA bills at least 30 days, and AWS rejects earlier transitions
+	minOriginalsIADays = 30
+)
+
+// managedLifecycleRules are the rule IDs the worker owns
+var managedLifecycleRules = []string{lifecycleRuleAbortMultipart, lifecycleRuleOriginalsIA}
+
+// S3LifecycleConfig is the lifecycle rules the worker keeps on its buckets
+type S3LifecycleConfig struct {
+	Enabled            bool     // S3_MANAGE_LIFECYCLE; false leaves buckets alone
+	Buckets            []string // S3_LIFECYCLE_BUCKETS
+	AbortMultipartDays int      // S3_ABORT_MULTIPART_DAYS; 0 = no rule
+	OriginalsIADays    int      // S3_ORIGINALS_IA_DAYS; 0 = no rule
+}
+
+// loadS3LifecycleConfig reads the lifecycle settings from the environment
+//
+//   - S3_MANAGE_LIFECYCLE (default true)
+//   - S3_LIFECYCLE_BUCKETS (default S3_BUCKET): comma-separated
+//   - S3_ABORT_MULTIPART_DAYS (default 1)
+//   - S3_ORIGINALS_IA_DAYS (default 0: off; at least 30 on AWS)
+func loadS3LifecycleConfig(defaultBucket string) S3LifecycleConfig {
+	c := S3LifecycleConfig{
+		Enabled:            getEnvBool("S3_MANAGE_LIFECYCLE", true),
+		AbortMultipartDays: max(getEnvInt("S3_ABORT_MULTIPART_DAYS", 1), 0),
+		OriginalsIADays:    max(getEnvInt("S3_ORIGINALS_IA_DAYS", 0), 0),
+	}
+	for _, bucket := range strings.Split(getEnv("S3_LIFECYCLE_BUCKETS", defaultBucket), ",") {
+		if bucket = strings.TrimSpace(bucket); bucket != "" && !slices.Contains(c.Buckets, bucket) {
+			c.Buckets = append(c.Buckets, bucket)
+		}
+	}
+	if c.OriginalsIADays > 0 && c.OriginalsIADays < minOriginalsIADays {
+		log.Printf("⚠️  WARNING: S3_ORIGINALS_IA_DAYS=%d is below %d; AWS S3 rejects the rule", c.OriginalsIADays, minOriginalsIADays)
+	}
+	return c
+}
+
+// String summarises the settings for the startup log
+func (c S3LifecycleConfig) String() string {
+	if !c.Enabled || len(c.Buckets) == 0 {
+		return "unmanaged"
+	}
+	abort, ia := "off", "off"
+	if c.AbortMultipartDays > 0 {
+		abort = fmt.Sprintf("%dd", c.AbortMultipartDays)
+	}
+	if c.OriginalsIADays > 0 {
+		ia = fmt.Sprintf("%dd", c.OriginalsIADays)
+	}
+	return fmt.Sprintf("buckets=%s abort_multipart=%s originals_ia=%s", strings.Join(c.Buckets, ","), abort, ia)
+}
+
+// TagOriginals reports whether the file pipeline tags originals for the
+// STANDARD_IA transition
+func (c S3LifecycleConfig) TagOriginals() bool {
+	return c.Enabled && c.OriginalsIADays > 0
+}
+
+// Rules returns the managed rules the configuration asks for
+func (c S3LifecycleConfig) Rules() []types.LifecycleRule {
+	var rules []types.LifecycleRule
+	if c.AbortMultipartDays > 0 {
+		rules = append(rules, types.LifecycleRule{
+			ID:     aws.String(lifecycleRuleAbortMultipart),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{Prefix: aws.String("")},
+			AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int32(int32(c.AbortMultipartDays)),
+			},
+		})
+	}
+	if c.OriginalsIADays > 0 {
+		rules = append(rules, types.LifecycleRule{
+			ID:     aws.String(lifecycleRuleOriginalsIA),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{Tag: &types.Tag{
+				Key:   aws.String(originalObjectTagKey),
+				Value: aws.String(originalObjectTagValue),
+			}},
+			Transitions: []types.Transition{{
+				Days:         aws.Int32(int32(c.OriginalsIADays)),
+				StorageClass: types.TransitionStorageClassStandardIa,
+			}},
+		})
+	}
+	return rules
+}
+
+// bucketLifecycleAPI is the subset of *s3.Client used to manage lifecycle rules
+type bucketLifecycleAPI interface {
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	DeleteBucketLifecycle(ctx context.Context, params *s3.DeleteBucketLifecycleInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketLifecycleOutput, error)
+}
+
+// EnsureBucketLifecycles applies the managed rules to every configured
+// bucket, logging the outcome of each
+func EnsureBucketLifecycles(ctx context.Context, client bucketLifecycleAPI, config S3LifecycleConfig) {
+	if !config.Enabled {
+		return
+	}
+	rules := config.Rules()
+	for _, bucket := range config.Buckets {
+		changed, err := ensureBucketLifecycle(ctx, client, bucket, rules)
+		switch {
+		case err != nil:
+			log.Printf("⚠️  WARNING: [S3] Failed to apply lifecycle rules to %s: %v", bucket, err)
+		case changed:
+			log.Printf("[S3] ✓ Lifecycle rules of %s updated (%s)", bucket, describeLifecycleRules(rules))
+		default:
+			log.Printf("[S3] Lifecycle rules of %s up to date", bucket)
+		}
+	}
+}
+
+// ensureBucketLifecycle replaces the managed rules of bucket with rules,
+// keeping its other rules. It writes only when something changed.
+func ensureBucketLifecycle(ctx context.Context, client bucketLifecycleAPI, bucket string, rules []types.LifecycleRule) (bool, error) {
+	var existing []types.LifecycleRule
+	out, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration":
+		// No rules yet
+	case err != nil:
+		return false, fmt.Errorf("failed to read lifecycle configuration: %w", err)
+	default:
+		existing = out.Rules
+	}
+
+	merged, changed := mergeLifecycleRules(existing, rules)
+	if !changed {
+		return false, nil
+	}
+	if len(merged) == 0 {
+		// A configuration needs at least one rule
+		if _, err := client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucket)}); err != nil {
+			return false, fmt.Errorf("failed to remove lifecycle configuration: %w", err)
+		}
+		return true, nil
+	}
+	_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: merged},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to write lifecycle configuration: %w", err)
+	}
+	return true, nil
+}
+
+// mergeLifecycleRules returns existing with its managed rules replaced by
+// managed, and whether that differs from existing
+func mergeLifecycleRules(existing, managed []types.LifecycleRule) ([]types.LifecycleRule, bool) {
+	var merged []types.LifecycleRule
+	var current []string
+	for _, rule := range existing {
+		if slices.Contains(managedLifecycleRules, aws.ToString(rule.ID)) {
+			current = append(current, lifecycleRuleKey(rule))
+			continue
+		}
+		merged = append(merged, rule)
+	}
+	var wanted []string
+	for _, rule := range managed {
+		wanted = append(wanted, lifecycleRuleKey(rule))
+	}
+	slices.Sort(current)
+	slices.Sort(wanted)
+	return append(merged, managed...), !slices.Equal(current, wanted)
+}
+
+// lifecycleRuleKey describes the parts of a rule the worker sets, to compare
+// a bucket's managed rules with the configured ones
+func lifecycleRuleKey(rule types.LifecycleRule) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", aws.ToString(rule.ID), rule.Status)
+	if f := rule.Filter; f != nil {
+		fmt.Fprintf(&b, " prefix=%s", aws.ToString(f.Prefix))
+		if f.Tag != nil {
+			fmt.Fprintf(&b, " tag=%s:%s", aws.ToString(f.Tag.Key), aws.ToString(f.Tag.Value))
+		}
+	}
+	if a := rule.AbortIncompleteMultipartUpload; a != nil {
+		fmt.Fprintf(&b, " abort=%d", aws.ToInt32(a.DaysAfterInitiation))
+	}
+	for _, t := range rule.Transitions {
+		fmt.Fprintf(&b, " transition=%d:%s", aws.ToInt32(t.Days), t.StorageClass)
+	}
+	return b.String()
+}
+
+// describeLifecycleRules lists rule IDs for logs
+func describeLifecycleRules(rules []types.LifecycleRule) string {
+	if len(rules) == 0 {
+		return "managed rules removed"
+	}
+	ids := make([]string, len(rules))
+	for i, rule := range rules {
+		ids[i] = aws.ToString(rule.ID)
+	}
+	return strings.Join(ids, ", ")
+}
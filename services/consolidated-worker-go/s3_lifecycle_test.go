@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// fakeLifecycleAPI holds one bucket's rules; nil rules read as
+// NoSuchLifecycleConfiguration
+type fakeLifecycleAPI struct {
+	rules   []types.LifecycleRule
+	puts    int
+	deletes int
+}
+
+func (f *fakeLifecycleAPI) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if f.rules == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: f.rules}, nil
+}
+
+func (f *fakeLifecycleAPI) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	f.puts++
+	f.rules = params.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (f *fakeLifecycleAPI) DeleteBucketLifecycle(ctx context.Context, params *s3.DeleteBucketLifecycleInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketLifecycleOutput, error) {
+	f.deletes++
+	f.rules = nil
+	return &s3.DeleteBucketLifecycleOutput{}, nil
+}
+
+func ruleIDs(rules []types.LifecycleRule) []string {
+	var ids []string
+	for _, rule := range rules {
+		ids = append(ids, aws.ToString(rule.ID))
+	}
+	return ids
+}
+
+func TestLoadS3LifecycleConfig(t *testing.T) {
+	c := loadS3LifecycleConfig("civic-os-files")
+	if !c.Enabled || len(c.Buckets) != 1 || c.AbortMultipartDays != 1 || c.OriginalsIADays != 0 || c.TagOriginals() {
+		t.Errorf("defaults = %+v", c)
+	}
+
+	t.Setenv("S3_LIFECYCLE_BUCKETS", "files, exports,files")
+	t.Setenv("S3_ORIGINALS_IA_DAYS", "90")
+	c = loadS3LifecycleConfig("civic-os-files")
+	if got := c.String(); got != "buckets=files,exports abort_multipart=1d originals_ia=90d" {
+		t.Errorf("String() = %s", got)
+	}
+	if !c.TagOriginals() {
+		t.Error("TagOriginals() = false with an IA rule")
+	}
+
+	t.Setenv("S3_MANAGE_LIFECYCLE", "false")
+	if c := loadS3LifecycleConfig("civic-os-files"); c.String() != "unmanaged" || c.TagOriginals() {
+		t.Errorf("disabled: %s, tag originals %v", c, c.TagOriginals())
+	}
+}
+
+func TestEnsureBucketLifecycle_KeepsOtherRules(t *testing.T) {
+	api := &fakeLifecycleAPI{rules: []types.LifecycleRule{
+		{ID: aws.String("expire-logs"), Status: types.ExpirationStatusEnabled, Filter: &types.LifecycleRuleFilter{Prefix: aws.String("logs/")}},
+	}}
+	rules := S3LifecycleConfig{AbortMultipartDays: 1, OriginalsIADays: 90}.Rules()
+	ctx := context.Background()
+
+	changed, err := ensureBucketLifecycle(ctx, api, "files", rules)
+	if err != nil || !changed || api.puts != 1 {
+		t.Fatalf("first run: changed %v, err %v, puts %d", changed, err, api.puts)
+	}
+	if got := ruleIDs(api.rules); len(got) != 3 || got[0] != "expire-logs" {
+		t.Errorf("rules = %v, want expire-logs kept and both managed rules", got)
+	}
+
+	// Nothing to do the second time
+	if changed, err := ensureBucketLifecycle(ctx, api, "files", rules); err != nil || changed || api.puts != 1 {
+		t.Errorf("second run: changed %v, err %v, puts %d", changed, err, api.puts)
+	}
+
+	// A changed day count rewrites the rule
+	rules = S3LifecycleConfig{AbortMultipartDays: 3, OriginalsIADays: 90}.Rules()
+	if changed, _ := ensureBucketLifecycle(ctx, api, "files", rules); !changed || api.puts != 2 {
+		t.Errorf("changed days: changed %v, puts %d", changed, api.puts)
+	}
+
+	// Turning the rules off removes only them
+	if changed, _ := ensureBucketLifecycle(ctx, api, "files", nil); !changed {
+		t.Error("removing rules: not changed")
+	}
+	if got := ruleIDs(api.rules); len(got) != 1 || got[0] != "expire-logs" {
+		t.Errorf("rules = %v, want only expire-logs", got)
+	}
+}
+
+func TestEnsureBucketLifecycle_NoConfiguration(t *testing.T) {
+	api := &fakeLifecycleAPI{}
+	ctx := context.Background()
+
+	if changed, err := ensureBucketLifecycle(ctx, api, "files", nil); err != nil || changed || api.puts+api.deletes != 0 {
+		t.Errorf("nothing wanted: changed %v, err %v", changed, err)
+	}
+
+	rules := S3LifecycleConfig{AbortMultipartDays: 1}.Rules()
+	if changed, err := ensureBucketLifecycle(ctx, api, "files", rules); err != nil || !changed {
+		t.Fatalf("add: changed %v, err %v", changed, err)
+	}
+
+	// Removing the last rule deletes the configuration
+	if changed, err := ensureBucketLifecycle(ctx, api, "files", nil); err != nil || !changed || api.deletes != 1 {
+		t.Errorf("remove: changed %v, err %v, deletes %d", changed, err, api.deletes)
+	}
+}
+
+func TestEnsureBucketLifecycle_ReadError(t *testing.T) {
+	api := &errLifecycleAPI{}
+	_, err := ensureBucketLifecycle(context.Background(), api, "files", S3LifecycleConfig{AbortMultipartDays: 1}.Rules())
+	if err == nil || api.puts != 0 {
+		t.Errorf("err = %v, puts = %d; want the read error and no write", err, api.puts)
+	}
+}
+
+// errLifecycleAPI fails every read
+type errLifecycleAPI struct{ fakeLifecycleAPI }
+
+func (f *errLifecycleAPI) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	return nil, errors.New("AccessDenied")
+}
@@ -0,0 +1,233 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// ============================================================================
+// S3 Retry, Timeout and Concurrency Policy
+//
+// Every worker shares one S3 client (see s3_client.go), so the policy here
+// applies to thumbnails, originals, exports, receipts, archival and backups
+// alike. Presigning signs locally and makes no S3 call.
+//
+// The SDK's standard retryer gives up after 3 attempts and keeps a
+// client-wide retry quota: under sustained throttling (MinIO's SlowDown) the
+// quota drains and every call fails at once, so River jobs spend their
+// attempts in minutes. S3Policy raises the attempts, caps the backoff, lets
+// the quota be turned off, bounds each call with a timeout and limits how
+// many calls are in flight at once so the worker stops adding to the load.
+// ============================================================================
+
+const (
+	defaultS3MaxAttempts     = 5
+	defaultS3MaxBackoff      = 20 * time.Second
+	defaultS3Timeout         = 30 * time.Second
+	defaultS3TransferTimeout = 10 * time.Minute
+	defaultS3MaxConcurrency  = 16
+)
+
+// s3TransferOperations move object data and get S3_TRANSFER_TIMEOUT_SECONDS
+var s3TransferOperations = map[string]bool{
+	"GetObject":  true,
+	"PutObject":  true,
+	"CopyObject": true,
+	"UploadPart": true,
+}
+
+// S3Policy configures retries, timeouts and concurrency of S3 calls
+type S3Policy struct {
+	MaxAttempts     int           // Attempts per call, including the first
+	MaxBackoff      time.Duration // Longest wait between attempts
+	RetryQuota      int           // Client-wide retry token bucket; 0 = no quota
+	Timeout         time.Duration // Per call, retries included; 0 = none
+	TransferTimeout time.Duration // Same, for s3TransferOperations
+	MaxConcurrency  int           // Calls in flight at once; 0 = unlimited
+}
+
+// loadS3Policy reads the policy from the environment
+//
+//   - S3_MAX_ATTEMPTS (default 5)
+//   - S3_RETRY_MAX_BACKOFF_SECONDS (default 20)
+//   - S3_RETRY_QUOTA (default 0: no client-side quota; the SDK's is 500)
+//   - S3_TIMEOUT_SECONDS (default 30)
+//   - S3_TRANSFER_TIMEOUT_SECONDS (default 600): GetObject (body included),
+//     PutObject, CopyObject, UploadPart
+//   - S3_MAX_CONCURRENCY (default 16)
+func loadS3Policy() S3Policy {
+	return S3Policy{
+		MaxAttempts:     max(getEnvInt("S3_MAX_ATTEMPTS", defaultS3MaxAttempts), 1),
+		MaxBackoff:      envSeconds("S3_RETRY_MAX_BACKOFF_SECONDS", defaultS3MaxBackoff),
+		RetryQuota:      max(getEnvInt("S3_RETRY_QUOTA", 0), 0),
+		Timeout:         envSeconds("S3_TIMEOUT_SECONDS", defaultS3Timeout),
+		TransferTimeout: envSeconds("S3_TRANSFER_TIMEOUT_SECONDS", defaultS3TransferTimeout),
+		MaxConcurrency:  max(getEnvInt("S3_MAX_CONCURRENCY", defaultS3MaxConcurrency), 0),
+	}
+}
+
+// envSeconds reads a whole number of seconds; negative values mean 0
+func envSeconds(key string, defaultValue time.Duration) time.Duration {
+	return time.Duration(max(getEnvInt(key, int(defaultValue/time.Second)), 0)) * time.Second
+}
+
+// String summarises the policy for the startup log
+func (p S3Policy) String() string {
+	quota, limit := "off", "unlimited"
+	if p.RetryQuota > 0 {
+		quota = fmt.Sprint(p.RetryQuota)
+	}
+	if p.MaxConcurrency > 0 {
+		limit = fmt.Sprint(p.MaxConcurrency)
+	}
+	return fmt.Sprintf("attempts=%d max_backoff=%s retry_quota=%s timeout=%s transfer_timeout=%s concurrency=%s",
+		p.MaxAttempts, p.MaxBackoff, quota, p.Timeout, p.TransferTimeout, limit)
+}
+
+// Retryer builds the SDK retryer for the policy
+func (p S3Policy) Retryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = p.MaxAttempts
+		if p.MaxBackoff > 0 {
+			o.MaxBackoff = p.MaxBackoff
+		}
+		if p.RetryQuota > 0 {
+			o.RateLimiter = ratelimit.NewTokenRateLimit(uint(p.RetryQuota))
+		} else {
+			o.RateLimiter = ratelimit.None
+		}
+	})
+}
+
+// TimeoutFor returns the timeout of one S3 operation
+func (p S3Policy) TimeoutFor(operation string) time.Duration {
+	if s3TransferOperations[operation] {
+		return p.TransferTimeout
+	}
+	return p.Timeout
+}
+
+// Apply configures client options with the policy. The limiter is created
+// here, so clients built from the same options share it.
+func (p S3Policy) Apply(o *s3.Options, m *Metrics) {
+	o.Retryer = p.Retryer()
+	o.APIOptions = append(o.APIOptions,
+		s3LimiterMiddleware(newS3Limiter(p.MaxConcurrency), m),
+		s3TimeoutMiddleware(p),
+	)
+}
+
+// ============================================================================
+// Concurrency limiter
+// ============================================================================
+
+// s3Limiter hands out slots for S3 calls; a nil limiter never blocks
+type s3Limiter struct {
+	slots chan struct{}
+}
+
+func newS3Limiter(n int) *s3Limiter {
+	if n <= 0 {
+		return nil
+	}
+	return &s3Limiter{slots: make(chan struct{}, n)}
+}
+
+// acquire waits for a slot or for ctx to end
+func (l *s3Limiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *s3Limiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// s3LimiterMiddleware holds a slot while a call and its retries run. The slot
+// is returned when the call returns, before a GetObject body is read, so a
+// caller holding several bodies open can't starve the others.
+func s3LimiterMiddleware(l *s3Limiter, m *Metrics) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CivicOSConcurrencyLimit",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				started := time.Now()
+				if err := l.acquire(ctx); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, err
+				}
+				defer l.release()
+				if l != nil {
+					m.S3LimitWait.Observe(time.Since(started).Seconds(), awsmiddleware.GetOperationName(ctx))
+				}
+				return next.HandleInitialize(ctx, in)
+			}), middleware.After)
+	}
+}
+
+// ============================================================================
+// Per-operation timeouts
+// ============================================================================
+
+type s3NoTimeoutKey struct{}
+
+// withoutS3Timeout exempts calls made with ctx from the policy timeout, for
+// uploads bounded by their own deadline (database backups)
+func withoutS3Timeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, s3NoTimeoutKey{}, true)
+}
+
+// s3TimeoutMiddleware bounds each call, retries included. A GetObject body
+// is read after the call returns, so its timeout ends when the body is
+// closed instead.
+func s3TimeoutMiddleware(p S3Policy) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CivicOSTimeout",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				timeout := p.TimeoutFor(awsmiddleware.GetOperationName(ctx))
+				if timeout <= 0 || ctx.Value(s3NoTimeoutKey{}) != nil {
+					return next.HandleInitialize(ctx, in)
+				}
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if got, ok := out.Result.(*s3.GetObjectOutput); ok && err == nil && got.Body != nil {
+					got.Body = &cancelOnClose{ReadCloser: got.Body, cancel: cancel}
+					return out, metadata, err
+				}
+				cancel()
+				return out, metadata, err
+			}), middleware.After)
+	}
+}
+
+// cancelOnClose ends a call's context when its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(c.cancel)
+	return err
+}
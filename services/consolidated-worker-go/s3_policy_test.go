@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestLoadS3Policy(t *testing.T) {
+	p := loadS3Policy()
+	if p.MaxAttempts != defaultS3MaxAttempts || p.RetryQuota != 0 || p.MaxConcurrency != defaultS3MaxConcurrency {
+		t.Errorf("defaults = %+v", p)
+	}
+
+	t.Setenv("S3_MAX_ATTEMPTS", "0")
+	t.Setenv("S3_RETRY_QUOTA", "500")
+	t.Setenv("S3_TIMEOUT_SECONDS", "5")
+	t.Setenv("S3_TRANSFER_TIMEOUT_SECONDS", "-1")
+	t.Setenv("S3_MAX_CONCURRENCY", "0")
+	p = loadS3Policy()
+	if p.MaxAttempts != 1 || p.RetryQuota != 500 || p.Timeout != 5*time.Second || p.TransferTimeout != 0 || p.MaxConcurrency != 0 {
+		t.Errorf("from env = %+v", p)
+	}
+	if got := p.TimeoutFor("HeadObject"); got != 5*time.Second {
+		t.Errorf("HeadObject timeout = %v", got)
+	}
+	if got := p.TimeoutFor("GetObject"); got != 0 {
+		t.Errorf("GetObject timeout = %v, want the transfer timeout", got)
+	}
+}
+
+// contextDoer answers with 200 and keeps the last request's context
+type contextDoer struct {
+	ctx context.Context
+}
+
+func (d *contextDoer) Do(req *http.Request) (*http.Response, error) {
+	d.ctx = req.Context()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("data")),
+		Request:    req,
+	}, nil
+}
+
+func testS3Client(p S3Policy, m *Metrics, doer interface {
+	Do(*http.Request) (*http.Response, error)
+}) *s3.Client {
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String("http://s3.test"),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient:   doer,
+	}, func(o *s3.Options) {
+		p.Apply(o, m)
+		o.APIOptions = append(o.APIOptions, s3MetricsMiddleware(m))
+	})
+}
+
+func TestS3PolicyRetries(t *testing.T) {
+	m := NewMetrics()
+	p := S3Policy{MaxAttempts: 3, MaxBackoff: time.Millisecond, Timeout: time.Minute, MaxConcurrency: 2}
+	_, err := testS3Client(p, m, statusDoer(http.StatusServiceUnavailable)).HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("civic-os-files"), Key: aws.String("a.jpg"),
+	})
+	if err == nil {
+		t.Fatal("HeadObject() expected error for 503")
+	}
+	if got := m.S3Retries.Value("HeadObject"); got != 2 {
+		t.Errorf("retries = %v, want 2", got)
+	}
+	if got := m.S3LimitWait.Count("HeadObject"); got != 1 {
+		t.Errorf("limiter waits = %v, want one per call", got)
+	}
+}
+
+func TestS3PolicyTimeout(t *testing.T) {
+	doer := &contextDoer{}
+	client := testS3Client(S3Policy{MaxAttempts: 1, Timeout: time.Minute, TransferTimeout: time.Minute}, NewMetrics(), doer)
+	ctx := context.Background()
+
+	if _, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("b"), Key: aws.String("k")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doer.ctx.Deadline(); !ok || doer.ctx.Err() == nil {
+		t.Error("HeadObject: expected a deadline, released when the call returns")
+	}
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("b"), Key: aws.String("k")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doer.ctx.Err() != nil {
+		t.Fatal("GetObject: context ended before the body was read")
+	}
+	if data, _ := io.ReadAll(out.Body); string(data) != "data" {
+		t.Errorf("body = %q", data)
+	}
+	out.Body.Close()
+	if doer.ctx.Err() == nil {
+		t.Error("GetObject: context not released when the body was closed")
+	}
+
+	if _, err := client.HeadObject(withoutS3Timeout(ctx), &s3.HeadObjectInput{Bucket: aws.String("b"), Key: aws.String("k")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doer.ctx.Deadline(); ok {
+		t.Error("withoutS3Timeout: call still has a deadline")
+	}
+}
+
+func TestS3Limiter(t *testing.T) {
+	var unlimited *s3Limiter
+	if unlimited.acquire(context.Background()) != nil || newS3Limiter(0) != nil {
+		t.Error("a nil limiter should never block")
+	}
+	unlimited.release()
+
+	l := newS3Limiter(1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); err == nil {
+		t.Fatal("second acquire should wait for the slot and time out")
+	}
+	l.release()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Errorf("acquire after release: %v", err)
+	}
+}
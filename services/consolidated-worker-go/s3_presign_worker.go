@@ -18,6 +18,10 @@ import (
 // Job Definition: S3 Presign
 // ============================================================================
 
+// uploadURLTTL is how long a presigned upload URL is valid. Requests whose
+// URL was never used are expired by UploadRequestCleanupTask.
+const uploadURLTTL = 15 * time.Minute
+
 // S3PresignArgs defines the arguments for generating presigned S3 URLs
 type S3PresignArgs struct {
 	RequestID  string `json:"request_id"`
@@ -59,6 +63,24 @@ func (w *S3PresignWorker) Work(ctx context.Context, job *river.Job[S3PresignArgs
 	log.Printf("[Job %d] Starting S3 presign job (attempt %d/%d)", job.ID, job.Attempt, job.MaxAttempts)
 	log.Printf("[Job %d] Request: entity=%s/%s, file=%s", job.ID, job.Args.EntityType, job.Args.EntityID, job.Args.FileName)
 
+	// Refuse uploads that would exceed the entity type's storage quota; the
+	// frontend shows error_message to the uploader
+	rejection, err := checkStorageQuota(ctx, w.dbPool, job.Args.RequestID)
+	if err != nil {
+		return err
+	}
+	if rejection != "" {
+		if _, err := w.dbPool.Exec(ctx, `
+			UPDATE metadata.file_upload_requests
+			SET status = 'failed', error_message = $2
+			WHERE id = $1
+		`, job.Args.RequestID, rejection); err != nil {
+			return fmt.Errorf("failed to update database: %w", err)
+		}
+		log.Printf("[Job %d] Refused upload: %s", job.ID, rejection)
+		return nil
+	}
+
 	// Generate file ID and build S3 key
 	fileID, err := w.generateFileID(ctx)
 	if err != nil {
@@ -83,17 +105,22 @@ func (w *S3PresignWorker) Work(ctx context.Context, job *river.Job[S3PresignArgs
 		return fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
 
+	// Jobs enqueued later for this file (thumbnails) continue this job's trace
+	// via the traceparent saved here (see the river_job trigger in v0.88.0)
+	traceparent := traceparent(ctx)
+
 	// Update database with presigned URL, file_id, s3_key, and status
 	query := `
 		UPDATE metadata.file_upload_requests
 		SET presigned_url = $1,
 		    file_id = $2,
 		    s3_key = $3,
-		    status = 'completed'
+		    status = 'completed',
+		    traceparent = NULLIF($5, '')
 		WHERE id = $4
 	`
 
-	_, err = w.dbPool.Exec(ctx, query, presignedURL, fileID, s3Key, job.Args.RequestID)
+	_, err = w.dbPool.Exec(ctx, query, presignedURL, fileID, s3Key, job.Args.RequestID, traceparent)
 	if err != nil {
 		log.Printf("[Job %d] Error updating database: %v", job.ID, err)
 		return fmt.Errorf("failed to update database: %w", err)
@@ -117,14 +144,14 @@ func (w *S3PresignWorker) generateFileID(ctx context.Context) (string, error) {
 
 // generateUploadURL creates a presigned URL for uploading files to S3
 func (w *S3PresignWorker) generateUploadURL(ctx context.Context, bucket, key string) (string, error) {
-	// Create presigned PUT request for upload (15 minutes expiry).
+	// Create presigned PUT request for upload (expires after uploadURLTTL).
 	// ACL public-read ensures uploaded objects are publicly readable via unsigned GET,
 	// while the bucket itself remains private (no directory listing).
 	presignResult, err := w.s3PresignClient.PresignPutObject(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 		ACL:    types.ObjectCannedACLPublicRead,
-	}, s3.WithPresignExpires(15*time.Minute))
+	}, s3.WithPresignExpires(uploadURLTTL))
 
 	if err != nil {
 		return "", fmt.Errorf("failed to presign PUT object: %w", err)
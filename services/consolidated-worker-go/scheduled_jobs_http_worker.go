@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Job Definition: HTTP-target Scheduled Job
+// ============================================================================
+
+// ScheduledJobHTTPArgs defines the arguments for executing an HTTP-target
+// scheduled job. The request configuration (URL, method, headers, body) is
+// loaded from metadata.scheduled_jobs at run time so edits apply immediately.
+type ScheduledJobHTTPArgs struct {
+	JobID        int       `json:"job_id" river:"unique"`
+	JobName      string    `json:"job_name"`
+	ScheduledFor time.Time `json:"scheduled_for" river:"unique"`
+	TriggeredBy  string    `json:"triggered_by"` // "scheduler", "manual", "catchup"
+
+	Audit *JobAuditContext `json:"audit,omitempty"` // set when enqueued from a user request
+}
+
+// Kind returns the job type identifier for River routing
+func (ScheduledJobHTTPArgs) Kind() string {
+	return "scheduled_job_http"
+}
+
+// InsertOpts specifies River job insertion options (unique like
+// ScheduledJobExecuteArgs)
+func (ScheduledJobHTTPArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "scheduled_jobs",
+		MaxAttempts: 3,
+		Priority:    2,
+		UniqueOpts:  river.UniqueOpts{ByArgs: true},
+	}
+}
+
+// ============================================================================
+// HTTP Target Configuration
+// ============================================================================
+
+const (
+	// Response bodies are stored in scheduled_job_runs.details; cap them so a
+	// chatty endpoint can't bloat the run history table
+	maxHTTPResponseCapture = 64 * 1024
+
+	// Secret references in headers/body resolve only env vars with this prefix,
+	// so anyone who can edit scheduled_jobs can't exfiltrate DATABASE_URL etc.
+	scheduledJobSecretEnvPrefix = "SCHEDULED_JOB_SECRET_"
+
+	defaultHTTPTargetTimeout = 30 * time.Second
+)
+
+// httpTarget is the HTTP configuration of a scheduled job
+type httpTarget struct {
+	URL          string
+	Method       string
+	Headers      map[string]string // values are templates, e.g. "Bearer {{secret \"PARTNER_TOKEN\"}}"
+	BodyTemplate string
+	Timeout      time.Duration
+}
+
+// httpTargetData is the data available to header and body templates
+type httpTargetData struct {
+	JobID        int
+	JobName      string
+	ScheduledFor string // RFC3339
+	TriggeredBy  string
+	RunID        int64
+}
+
+// httpTargetResult captures the response for scheduled_job_runs
+type httpTargetResult struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+	Truncated   bool   `json:"truncated,omitempty"`
+}
+
+// Success reports whether the endpoint returned a 2xx status
+func (r *httpTargetResult) Success() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Retryable reports whether a failed response should be retried by River.
+// 5xx and 429 are typically transient; other 4xx mean the request itself is wrong.
+func (r *httpTargetResult) Retryable() bool {
+	return r.StatusCode >= 500 || r.StatusCode == http.StatusTooManyRequests
+}
+
+// lookupScheduledJobSecret resolves a {{secret "NAME"}} reference
+func lookupScheduledJobSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(scheduledJobSecretEnvPrefix + name)
+	if !ok {
+		return "", fmt.Errorf("secret %q not configured (set %s%s)", name, scheduledJobSecretEnvPrefix, name)
+	}
+	return value, nil
+}
+
+// renderHTTPTargetTemplate renders a header value or body template
+func renderHTTPTargetTemplate(name, text string, data httpTargetData) (string, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"secret": lookupScheduledJobSecret}).
+		Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// executeHTTPTarget builds and sends the request, capturing the response.
+// Returns an error only when no response was received (DNS, TLS, timeout, template).
+func executeHTTPTarget(ctx context.Context, client *http.Client, target httpTarget, data httpTargetData) (*httpTargetResult, error) {
+	var body io.Reader
+	if target.BodyTemplate != "" {
+		rendered, err := renderHTTPTargetTemplate("body", target.BodyTemplate, data)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(rendered)
+	}
+
+	timeout := target.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTargetTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, target.Method, target.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("User-Agent", "CivicOS-Scheduler/1.0")
+	for name, valueTemplate := range target.Headers {
+		value, err := renderHTTPTargetTemplate("header "+name, valueTemplate, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the cap to detect truncation
+	captured, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseCapture+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	result := &httpTargetResult{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if len(captured) > maxHTTPResponseCapture {
+		captured = captured[:maxHTTPResponseCapture]
+		result.Truncated = true
+	}
+	result.Body = string(captured)
+	return result, nil
+}
+
+// ============================================================================
+// Worker Implementation: HTTP-target Executor
+// ============================================================================
+
+// ScheduledJobHTTPWorker executes HTTP-target scheduled jobs
+type ScheduledJobHTTPWorker struct {
+	river.WorkerDefaults[ScheduledJobHTTPArgs]
+	dbPool     *pgxpool.Pool
+	httpClient *http.Client
+	alerts     *ScheduledJobAlerter // nil = failure alerting disabled
+}
+
+// Work sends the configured HTTP request and records the response
+func (w *ScheduledJobHTTPWorker) Work(ctx context.Context, job *river.Job[ScheduledJobHTTPArgs]) error {
+	startTime := time.Now()
+	args := job.Args
+
+	log.Printf("[Job %d] Executing HTTP scheduled job '%s' (scheduled_for: %s, triggered_by: %s, attempt %d/%d)",
+		job.ID, args.JobName, args.ScheduledFor.Format(time.RFC3339), args.TriggeredBy, job.Attempt, job.MaxAttempts)
+
+	target, err := w.loadHTTPTarget(ctx, args.JobID)
+	if err != nil {
+		return fmt.Errorf("failed to load HTTP target: %w", err)
+	}
+
+	// Create run record
+	var runID int64
+	err = w.dbPool.QueryRow(ctx, `
+		INSERT INTO metadata.scheduled_job_runs (job_id, started_at, scheduled_for, triggered_by, audit_context)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, args.JobID, startTime, args.ScheduledFor, args.TriggeredBy, args.Audit).Scan(&runID)
+	if err != nil {
+		return fmt.Errorf("failed to create run record: %w", err)
+	}
+
+	data := httpTargetData{
+		JobID:        args.JobID,
+		JobName:      args.JobName,
+		ScheduledFor: args.ScheduledFor.Format(time.RFC3339),
+		TriggeredBy:  args.TriggeredBy,
+		RunID:        runID,
+	}
+	result, err := executeHTTPTarget(ctx, w.httpClient, *target, data)
+
+	endTime := time.Now()
+	durationMs := int(endTime.Sub(startTime).Milliseconds())
+	updateScheduledJobLastRunAt(ctx, w.dbPool, args.JobID, startTime)
+
+	if err != nil {
+		// No response at all - record and let River retry
+		log.Printf("[Job %d] HTTP %s %s failed: %v", job.ID, target.Method, target.URL, err)
+		w.recordRun(ctx, job.ID, runID, endTime, durationMs, false, err.Error(), nil)
+		w.alerts.CheckFailureStreak(ctx, job.ID, args.JobID, args.JobName, target.URL, args.ScheduledFor, runID, err.Error())
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+
+	message := fmt.Sprintf("HTTP %d %s", result.StatusCode, http.StatusText(result.StatusCode))
+	w.recordRun(ctx, job.ID, runID, endTime, durationMs, result.Success(), message, result)
+
+	if result.Success() {
+		log.Printf("[Job %d] ✓ %s %s → %s (took %dms)", job.ID, target.Method, target.URL, message, durationMs)
+		return nil
+	}
+
+	log.Printf("[Job %d] ✗ %s %s → %s (took %dms)", job.ID, target.Method, target.URL, message, durationMs)
+	w.alerts.CheckFailureStreak(ctx, job.ID, args.JobID, args.JobName, target.URL, args.ScheduledFor, runID, message)
+
+	if result.Retryable() {
+		return fmt.Errorf("endpoint returned %s", message)
+	}
+	// 4xx: the request is wrong, retrying won't help - same as a SQL function reporting failure
+	return nil
+}
+
+// loadHTTPTarget reads the HTTP configuration for a scheduled job
+func (w *ScheduledJobHTTPWorker) loadHTTPTarget(ctx context.Context, jobID int) (*httpTarget, error) {
+	var target httpTarget
+	var headersJSON []byte
+	var bodyTemplate *string
+	var timeoutSeconds int
+
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT http_url, http_method, http_headers, http_body_template, http_timeout_seconds
+		FROM metadata.scheduled_jobs
+		WHERE id = $1 AND target_type = 'http'
+	`, jobID).Scan(&target.URL, &target.Method, &headersJSON, &bodyTemplate, &timeoutSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP scheduled job %d not found: %w", jobID, err)
+	}
+
+	if len(headersJSON) > 0 {
+		if err := json.Unmarshal(headersJSON, &target.Headers); err != nil {
+			return nil, fmt.Errorf("invalid http_headers: %w", err)
+		}
+	}
+	if bodyTemplate != nil {
+		target.BodyTemplate = *bodyTemplate
+	}
+	target.Timeout = time.Duration(timeoutSeconds) * time.Second
+
+	return &target, nil
+}
+
+// recordRun updates the run record with the HTTP outcome
+func (w *ScheduledJobHTTPWorker) recordRun(ctx context.Context, jobID int64, runID int64, endTime time.Time, durationMs int, success bool, message string, result *httpTargetResult) {
+	var statusCode *int
+	if result != nil {
+		statusCode = &result.StatusCode
+	}
+
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.scheduled_job_runs
+		SET completed_at = $1, duration_ms = $2, success = $3, message = $4, details = $5, http_status = $6
+		WHERE id = $7
+	`, endTime, durationMs, success, message, result, statusCode, runID)
+
+	if err != nil {
+		log.Printf("[Job %d] Failed to update run record: %v", jobID, err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Tests: template rendering and secrets
+// ============================================================================
+
+func TestRenderHTTPTargetTemplate_Fields(t *testing.T) {
+	data := httpTargetData{JobID: 7, JobName: "warm_cache", ScheduledFor: "2026-01-01T08:00:00Z", TriggeredBy: "scheduler", RunID: 42}
+
+	got, err := renderHTTPTargetTemplate("body", `{"job":"{{.JobName}}","run":{{.RunID}},"at":"{{.ScheduledFor}}"}`, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"job":"warm_cache","run":42,"at":"2026-01-01T08:00:00Z"}`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRenderHTTPTargetTemplate_Secret(t *testing.T) {
+	t.Setenv("SCHEDULED_JOB_SECRET_PARTNER_TOKEN", "s3cr3t")
+
+	got, err := renderHTTPTargetTemplate("header Authorization", `Bearer {{secret "PARTNER_TOKEN"}}`, httpTargetData{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "Bearer s3cr3t" {
+		t.Errorf("got %q, want %q", got, "Bearer s3cr3t")
+	}
+}
+
+func TestRenderHTTPTargetTemplate_SecretOutsidePrefixNotReadable(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://should-not-leak")
+
+	_, err := renderHTTPTargetTemplate("header X-Leak", `{{secret "DATABASE_URL"}}`, httpTargetData{})
+	if err == nil {
+		t.Fatal("expected error: secret lookup must be restricted to the SCHEDULED_JOB_SECRET_ prefix")
+	}
+}
+
+func TestRenderHTTPTargetTemplate_UnknownField(t *testing.T) {
+	_, err := renderHTTPTargetTemplate("body", `{{.NoSuchField}}`, httpTargetData{})
+	if err == nil {
+		t.Error("expected error for unknown template field")
+	}
+}
+
+// ============================================================================
+// Tests: request execution
+// ============================================================================
+
+func TestExecuteHTTPTarget_SendsConfiguredRequest(t *testing.T) {
+	t.Setenv("SCHEDULED_JOB_SECRET_TOKEN", "abc")
+
+	var gotMethod, gotAuth, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotAuth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	target := httpTarget{
+		URL:          server.URL,
+		Method:       "PUT",
+		Headers:      map[string]string{"Authorization": `Bearer {{secret "TOKEN"}}`},
+		BodyTemplate: `{"job":"{{.JobName}}"}`,
+		Timeout:      5 * time.Second,
+	}
+
+	result, err := executeHTTPTarget(context.Background(), server.Client(), target, httpTargetData{JobName: "ping"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotMethod != "PUT" || gotAuth != "Bearer abc" || gotBody != `{"job":"ping"}` {
+		t.Errorf("request mismatch: method=%s auth=%s body=%s", gotMethod, gotAuth, gotBody)
+	}
+	if !result.Success() || result.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 success, got %d", result.StatusCode)
+	}
+	if result.Body != `{"ok":true}` || result.ContentType != "application/json" {
+		t.Errorf("response not captured: %+v", result)
+	}
+}
+
+func TestExecuteHTTPTarget_TruncatesLargeResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", maxHTTPResponseCapture+100)))
+	}))
+	defer server.Close()
+
+	result, err := executeHTTPTarget(context.Background(), server.Client(), httpTarget{URL: server.URL, Method: "GET"}, httpTargetData{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Truncated || len(result.Body) != maxHTTPResponseCapture {
+		t.Errorf("expected body truncated to %d bytes, got %d (truncated=%v)", maxHTTPResponseCapture, len(result.Body), result.Truncated)
+	}
+}
+
+func TestExecuteHTTPTarget_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	target := httpTarget{URL: server.URL, Method: "GET", Timeout: 20 * time.Millisecond}
+	if _, err := executeHTTPTarget(context.Background(), server.Client(), target, httpTargetData{}); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestHTTPTargetResult_Classification(t *testing.T) {
+	tests := []struct {
+		status    int
+		success   bool
+		retryable bool
+	}{
+		{200, true, false},
+		{204, true, false},
+		{301, false, false},
+		{400, false, false},
+		{404, false, false},
+		{429, false, true},
+		{500, false, true},
+		{503, false, true},
+	}
+
+	for _, tt := range tests {
+		r := &httpTargetResult{StatusCode: tt.status}
+		if r.Success() != tt.success || r.Retryable() != tt.retryable {
+			t.Errorf("status %d: success=%v retryable=%v, want %v/%v", tt.status, r.Success(), r.Retryable(), tt.success, tt.retryable)
+		}
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riverqueue/river"
 	"github.com/robfig/cron/v3"
@@ -19,11 +21,13 @@ import (
 
 // ScheduledJobExecuteArgs defines the arguments for executing a scheduled job
 type ScheduledJobExecuteArgs struct {
-	JobID        int       `json:"job_id"`
+	JobID        int       `json:"job_id" river:"unique"`
 	JobName      string    `json:"job_name"`
 	FunctionName string    `json:"function_name"`
-	ScheduledFor time.Time `json:"scheduled_for"`
+	ScheduledFor time.Time `json:"scheduled_for" river:"unique"`
 	TriggeredBy  string    `json:"triggered_by"` // "scheduler", "manual", "catchup"
+
+	Audit *JobAuditContext `json:"audit,omitempty"` // set when enqueued from a user request
 }
 
 // Kind returns the job type identifier for River routing
@@ -31,12 +35,15 @@ func (ScheduledJobExecuteArgs) Kind() string {
 	return "scheduled_job_execute"
 }
 
-// InsertOpts specifies River job insertion options
+// InsertOpts specifies River job insertion options. Runs are also unique by
+// job ID and scheduled_for, including completed ones, as a backstop to the
+// scheduler's claim on last_queued_at.
 func (ScheduledJobExecuteArgs) InsertOpts() river.InsertOpts {
 	return river.InsertOpts{
 		Queue:       "scheduled_jobs",
 		MaxAttempts: 3,
 		Priority:    2,
+		UniqueOpts:  river.UniqueOpts{ByArgs: true},
 	}
 }
 
@@ -48,12 +55,16 @@ func (ScheduledJobExecuteArgs) InsertOpts() river.InsertOpts {
 type ScheduledJobRow struct {
 	ID           int
 	Name         string
-	FunctionName string
+	FunctionName string // empty for HTTP targets
+	TargetType   string // "sql", "http" or "backup"
 	Schedule     string
 	Timezone     string
 	Enabled      bool
 	LastRunAt    sql.NullTime
+	LastQueuedAt sql.NullTime // set by the scheduler when it queues a run
 	CreatedAt    time.Time
+
+	HolidayCalendarID *int // runs due on its holidays are skipped (v0.133.0)
 }
 
 // ============================================================================
@@ -62,16 +73,21 @@ type ScheduledJobRow struct {
 
 // ScheduledJobScheduler checks for due jobs using a Go ticker.
 //
-// ARCHITECTURE: This scheduler uses a Go time.Ticker instead of River periodic
-// jobs. This ensures only consolidated-worker runs the scheduler, avoiding the
-// issue where payment-worker could win River's leader election and fail to run
-// periodic jobs (since it didn't have them configured).
+// ARCHITECTURE: River periodic jobs run on River's elected leader, which can
+// be the payment worker, so this scheduler uses a Go ticker and elects its own
+// leader among consolidated-worker replicas (see scheduler_leader.go). Only
+// the leader checks for due jobs.
 //
-// CONSTRAINT: If you run multiple consolidated-worker instances, each will run
-// the scheduler independently. Duplicate job execution is prevented by unique_key
-// deduplication on River job insertion.
+// Each due run is queued in a transaction that first claims it by moving
+// last_queued_at forward from the value the check read. If another replica
+// (an old leader finishing its last tick) got there first, the claim updates
+// nothing and the run is skipped. The next due time counts from the later of
+// last_run_at and last_queued_at, so a queued run isn't due again while it
+// waits for a worker.
 type ScheduledJobScheduler struct {
 	dbPool *pgxpool.Pool
+	jobs   *JobEnqueuer
+	leader SchedulerLeader
 	ticker *time.Ticker
 	done   chan bool
 }
@@ -82,13 +98,13 @@ func (s *ScheduledJobScheduler) Start(ctx context.Context) {
 	s.done = make(chan bool)
 
 	// Run immediately on start to catch any missed jobs
-	s.checkDueJobs(ctx)
+	s.tick(ctx)
 
 	go func() {
 		for {
 			select {
 			case <-s.ticker.C:
-				s.checkDueJobs(ctx)
+				s.tick(ctx)
 			case <-s.done:
 				return
 			case <-ctx.Done():
@@ -97,10 +113,10 @@ func (s *ScheduledJobScheduler) Start(ctx context.Context) {
 		}
 	}()
 
-	log.Println("[Scheduler] Started - checking for due jobs every minute")
+	log.Println("[Scheduler] Started - checking for due jobs every minute while leading")
 }
 
-// Stop gracefully shuts down the scheduler
+// Stop gracefully shuts down the scheduler and hands the lead to another replica
 func (s *ScheduledJobScheduler) Stop() {
 	if s.ticker != nil {
 		s.ticker.Stop()
@@ -108,16 +124,26 @@ func (s *ScheduledJobScheduler) Stop() {
 	if s.done != nil {
 		s.done <- true
 	}
+	s.leader.Resign(context.Background())
 	log.Println("[Scheduler] Stopped")
 }
 
+// tick checks for due jobs if this replica leads
+func (s *ScheduledJobScheduler) tick(ctx context.Context) {
+	if !s.leader.Lead(ctx) {
+		return
+	}
+	s.checkDueJobs(ctx)
+}
+
 // checkDueJobs queries enabled scheduled jobs and queues any that are due
 func (s *ScheduledJobScheduler) checkDueJobs(ctx context.Context) {
 	log.Printf("[Scheduler] Checking for due scheduled jobs...")
 
 	// Query all enabled scheduled jobs
 	rows, err := s.dbPool.Query(ctx, `
-		SELECT id, name, function_name, schedule, timezone, enabled, last_run_at, created_at
+		SELECT id, name, COALESCE(function_name, ''), target_type, schedule, timezone, enabled,
+		       last_run_at, last_queued_at, created_at, holiday_calendar_id
 		FROM metadata.scheduled_jobs
 		WHERE enabled = true
 	`)
@@ -125,24 +151,27 @@ func (s *ScheduledJobScheduler) checkDueJobs(ctx context.Context) {
 		log.Printf("[Scheduler] Failed to query scheduled jobs: %v", err)
 		return
 	}
-	defer rows.Close()
+	scheduledJobs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ScheduledJobRow, error) {
+		var sj ScheduledJobRow
+		err := row.Scan(
+			&sj.ID, &sj.Name, &sj.FunctionName, &sj.TargetType, &sj.Schedule, &sj.Timezone,
+			&sj.Enabled, &sj.LastRunAt, &sj.LastQueuedAt, &sj.CreatedAt,
+			&sj.HolidayCalendarID,
+		)
+		return sj, err
+	})
+	if err != nil {
+		log.Printf("[Scheduler] Error reading scheduled jobs: %v", err)
+		return
+	}
 
 	now := time.Now()
 	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
 	jobsQueued := 0
 	jobsSkipped := 0
+	jobsHoliday := 0
 
-	for rows.Next() {
-		var sj ScheduledJobRow
-		err := rows.Scan(
-			&sj.ID, &sj.Name, &sj.FunctionName, &sj.Schedule,
-			&sj.Timezone, &sj.Enabled, &sj.LastRunAt, &sj.CreatedAt,
-		)
-		if err != nil {
-			log.Printf("[Scheduler] Error scanning job row: %v", err)
-			continue
-		}
-
+	for _, sj := range scheduledJobs {
 		// Load timezone
 		loc, err := time.LoadLocation(sj.Timezone)
 		if err != nil {
@@ -157,100 +186,167 @@ func (s *ScheduledJobScheduler) checkDueJobs(ctx context.Context) {
 			continue
 		}
 
-		// Determine base time for calculating next run
-		var baseTime time.Time
-		if sj.LastRunAt.Valid {
-			baseTime = sj.LastRunAt.Time
-		} else {
-			// Never run - use created_at or 24 hours ago, whichever is later
-			// This prevents running catch-up jobs from before the job was created
-			dayAgo := now.Add(-24 * time.Hour)
-			if sj.CreatedAt.After(dayAgo) {
-				baseTime = sj.CreatedAt
-			} else {
-				baseTime = dayAgo
-			}
+		nextDue, triggeredBy, due := nextScheduledRun(sj, schedule, loc, now)
+		if !due {
+			jobsSkipped++
+			continue
 		}
 
-		// Calculate when the job should have run next (after baseTime)
-		// Use the timezone for proper DST handling
-		nextDue := schedule.Next(baseTime.In(loc))
-
-		// If nextDue is in the past (or now), job is due/overdue
-		if !nextDue.After(now) {
-			triggeredBy := "scheduler"
-			if sj.LastRunAt.Valid && now.Sub(nextDue) > time.Hour {
-				triggeredBy = "catchup" // More than 1 hour overdue
-			}
-
-			// Queue the job for execution via direct SQL insert
-			// Use unique_key to prevent duplicate jobs for the same scheduled_for time
-			err := s.queueExecuteJob(ctx, sj, nextDue, triggeredBy)
+		if sj.HolidayCalendarID != nil {
+			holiday, err := holidayOn(ctx, s.dbPool, *sj.HolidayCalendarID, nextDue, loc)
 			if err != nil {
-				log.Printf("[Scheduler] Failed to queue job '%s': %v", sj.Name, err)
+				log.Printf("[Scheduler] Failed to check holidays for job '%s': %v", sj.Name, err)
+				continue
+			}
+			if holiday != "" {
+				claimed, err := s.skipRun(ctx, sj, now)
+				if err != nil {
+					log.Printf("[Scheduler] Failed to skip job '%s': %v", sj.Name, err)
+					continue
+				}
+				if claimed {
+					log.Printf("[Scheduler] Skipped job '%s' (scheduled_for: %s): %s",
+						sj.Name, nextDue.Format(time.RFC3339), holiday)
+					jobsHoliday++
+				}
 				continue
 			}
+		}
 
-			log.Printf("[Scheduler] Queued job '%s' (scheduled_for: %s, triggered_by: %s)",
-				sj.Name, nextDue.Format(time.RFC3339), triggeredBy)
-			jobsQueued++
-		} else {
+		queued, err := s.queueRun(ctx, sj, nextDue, triggeredBy, now)
+		if err != nil {
+			log.Printf("[Scheduler] Failed to queue job '%s': %v", sj.Name, err)
+			continue
+		}
+		if !queued {
+			log.Printf("[Scheduler] Job '%s' was already queued by another replica", sj.Name)
 			jobsSkipped++
+			continue
 		}
+
+		log.Printf("[Scheduler] Queued job '%s' (scheduled_for: %s, triggered_by: %s)",
+			sj.Name, nextDue.Format(time.RFC3339), triggeredBy)
+		jobsQueued++
 	}
 
-	if err := rows.Err(); err != nil {
-		log.Printf("[Scheduler] Error iterating scheduled jobs: %v", err)
-		return
+	log.Printf("[Scheduler] Check complete: %d jobs queued, %d jobs not yet due, %d skipped for holidays", jobsQueued, jobsSkipped, jobsHoliday)
+}
+
+// nextScheduledRun returns the job's next due time after its last run or
+// queueing, and whether that time has come. A run more than an hour late is
+// a "catchup".
+func nextScheduledRun(sj ScheduledJobRow, schedule cron.Schedule, loc *time.Location, now time.Time) (time.Time, string, bool) {
+	// Determine base time for calculating next run
+	var baseTime time.Time
+	switch {
+	case sj.LastRunAt.Valid || sj.LastQueuedAt.Valid:
+		if sj.LastRunAt.Valid {
+			baseTime = sj.LastRunAt.Time
+		}
+		if sj.LastQueuedAt.Valid && sj.LastQueuedAt.Time.After(baseTime) {
+			baseTime = sj.LastQueuedAt.Time
+		}
+	default:
+		// Never run - use created_at or 24 hours ago, whichever is later
+		// This prevents running catch-up jobs from before the job was created
+		dayAgo := now.Add(-24 * time.Hour)
+		if sj.CreatedAt.After(dayAgo) {
+			baseTime = sj.CreatedAt
+		} else {
+			baseTime = dayAgo
+		}
+	}
+
+	// Calculate when the job should have run next (after baseTime)
+	// Use the timezone for proper DST handling
+	nextDue := schedule.Next(baseTime.In(loc))
+	if nextDue.After(now) {
+		return nextDue, "", false
 	}
 
-	log.Printf("[Scheduler] Check complete: %d jobs queued, %d jobs not yet due", jobsQueued, jobsSkipped)
+	triggeredBy := "scheduler"
+	if sj.LastRunAt.Valid && now.Sub(nextDue) > time.Hour {
+		triggeredBy = "catchup" // More than 1 hour overdue
+	}
+	return nextDue, triggeredBy, true
 }
 
-// queueExecuteJob inserts a scheduled job execution into the River queue
-// Uses unique_key to prevent duplicate jobs for the same scheduled_for time
-func (s *ScheduledJobScheduler) queueExecuteJob(ctx context.Context, sj ScheduledJobRow, scheduledFor time.Time, triggeredBy string) error {
-	args := ScheduledJobExecuteArgs{
-		JobID:        sj.ID,
-		JobName:      sj.Name,
-		FunctionName: sj.FunctionName,
-		ScheduledFor: scheduledFor,
-		TriggeredBy:  triggeredBy,
+// queueRun claims the run and inserts its job in one transaction, and reports
+// whether it was queued; false means another replica claimed it first
+func (s *ScheduledJobScheduler) queueRun(ctx context.Context, sj ScheduledJobRow, scheduledFor time.Time, triggeredBy string, now time.Time) (bool, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return false, err
 	}
+	defer tx.Rollback(ctx)
 
-	argsJSON, err := json.Marshal(args)
+	tag, err := tx.Exec(ctx, `
+		UPDATE metadata.scheduled_jobs
+		SET last_queued_at = $2
+		WHERE id = $1 AND last_queued_at IS NOT DISTINCT FROM $3
+	`, sj.ID, now, sj.LastQueuedAt)
 	if err != nil {
-		return fmt.Errorf("failed to marshal job args: %w", err)
-	}
-
-	// Insert directly into River job table
-	// unique_key prevents duplicate jobs for the same job_id + scheduled_for combination
-	uniqueKey := fmt.Sprintf("scheduled_job:%d:%s", sj.ID, scheduledFor.Format(time.RFC3339))
-
-	_, err = s.dbPool.Exec(ctx, `
-		INSERT INTO metadata.river_job (
-			state,
-			queue,
-			kind,
-			args,
-			priority,
-			max_attempts,
-			scheduled_at,
-			unique_key
-		) VALUES (
-			'available',
-			'scheduled_jobs',
-			'scheduled_job_execute',
-			$1,
-			2,
-			3,
-			NOW(),
-			$2
-		)
-		ON CONFLICT (kind, unique_key) WHERE unique_key IS NOT NULL DO NOTHING
-	`, argsJSON, uniqueKey)
+		return false, fmt.Errorf("claim run: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
 
-	return err
+	result, err := s.jobs.InsertTx(ctx, tx, scheduledRunArgs(sj, scheduledFor, triggeredBy), nil)
+	if err != nil {
+		return false, err
+	}
+	if result.UniqueSkippedAsDuplicate {
+		// Claimed, but a job for this due time exists already; keep the claim
+		// so the time isn't due again
+		log.Printf("[Scheduler] Job '%s' already has a run for %s", sj.Name, scheduledFor.Format(time.RFC3339))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return !result.UniqueSkippedAsDuplicate, nil
+}
+
+// skipRun claims a run due on a holiday without queueing it, so it isn't due
+// again; false means another replica claimed it first
+func (s *ScheduledJobScheduler) skipRun(ctx context.Context, sj ScheduledJobRow, now time.Time) (bool, error) {
+	tag, err := s.dbPool.Exec(ctx, `
+		UPDATE metadata.scheduled_jobs
+		SET last_queued_at = $2
+		WHERE id = $1 AND last_queued_at IS NOT DISTINCT FROM $3
+	`, sj.ID, now, sj.LastQueuedAt)
+	if err != nil {
+		return false, fmt.Errorf("claim run: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// scheduledRunArgs returns the executor job for the job's target type
+func scheduledRunArgs(sj ScheduledJobRow, scheduledFor time.Time, triggeredBy string) river.JobArgs {
+	switch sj.TargetType {
+	case "http":
+		return ScheduledJobHTTPArgs{
+			JobID:        sj.ID,
+			JobName:      sj.Name,
+			ScheduledFor: scheduledFor,
+			TriggeredBy:  triggeredBy,
+		}
+	case "backup":
+		return DBBackupArgs{
+			JobID:        sj.ID,
+			JobName:      sj.Name,
+			ScheduledFor: scheduledFor,
+			TriggeredBy:  triggeredBy,
+		}
+	default:
+		return ScheduledJobExecuteArgs{
+			JobID:        sj.ID,
+			JobName:      sj.Name,
+			FunctionName: sj.FunctionName,
+			ScheduledFor: scheduledFor,
+			TriggeredBy:  triggeredBy,
+		}
+	}
 }
 
 // ============================================================================
@@ -261,6 +357,7 @@ func (s *ScheduledJobScheduler) queueExecuteJob(ctx context.Context, sj Schedule
 type ScheduledJobExecuteWorker struct {
 	river.WorkerDefaults[ScheduledJobExecuteArgs]
 	dbPool *pgxpool.Pool
+	alerts *ScheduledJobAlerter // nil = failure alerting disabled
 }
 
 // Work executes a scheduled SQL function and records the result
@@ -271,13 +368,13 @@ func (w *ScheduledJobExecuteWorker) Work(ctx context.Context, job *river.Job[Sch
 	log.Printf("[Job %d] Executing scheduled job '%s' (function: %s, scheduled_for: %s, triggered_by: %s)",
 		job.ID, args.JobName, args.FunctionName, args.ScheduledFor.Format(time.RFC3339), args.TriggeredBy)
 
-	// Create run record
+	// Create run record (audit_context attributes manual runs to the triggering user)
 	var runID int64
 	err := w.dbPool.QueryRow(ctx, `
-		INSERT INTO metadata.scheduled_job_runs (job_id, started_at, scheduled_for, triggered_by)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO metadata.scheduled_job_runs (job_id, started_at, scheduled_for, triggered_by, audit_context)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
-	`, args.JobID, startTime, args.ScheduledFor, args.TriggeredBy).Scan(&runID)
+	`, args.JobID, startTime, args.ScheduledFor, args.TriggeredBy, args.Audit).Scan(&runID)
 
 	if err != nil {
 		return fmt.Errorf("failed to create run record: %w", err)
@@ -311,6 +408,8 @@ func (w *ScheduledJobExecuteWorker) Work(ctx context.Context, job *river.Job[Sch
 		// Update last_run_at even on failure
 		w.updateLastRunAt(ctx, args.JobID, startTime)
 
+		w.alerts.CheckFailureStreak(ctx, job.ID, args.JobID, args.JobName, args.FunctionName, args.ScheduledFor, runID, err.Error())
+
 		return fmt.Errorf("function execution failed: %w", err)
 	}
 
@@ -347,6 +446,7 @@ func (w *ScheduledJobExecuteWorker) Work(ctx context.Context, job *river.Job[Sch
 		log.Printf("[Job %d] ✗ Completed with failure: %s (took %dms)", job.ID, result.Message, durationMs)
 		// Don't return error - the function ran but reported failure
 		// This is different from the function crashing
+		w.alerts.CheckFailureStreak(ctx, job.ID, args.JobID, args.JobName, args.FunctionName, args.ScheduledFor, runID, result.Message)
 	}
 
 	return nil
@@ -354,7 +454,12 @@ func (w *ScheduledJobExecuteWorker) Work(ctx context.Context, job *river.Job[Sch
 
 // updateLastRunAt updates the last_run_at field on a scheduled job
 func (w *ScheduledJobExecuteWorker) updateLastRunAt(ctx context.Context, jobID int, runTime time.Time) {
-	_, err := w.dbPool.Exec(ctx, `
+	updateScheduledJobLastRunAt(ctx, w.dbPool, jobID, runTime)
+}
+
+// updateScheduledJobLastRunAt is shared by the SQL and HTTP executors
+func updateScheduledJobLastRunAt(ctx context.Context, dbPool *pgxpool.Pool, jobID int, runTime time.Time) {
+	_, err := dbPool.Exec(ctx, `
 		UPDATE metadata.scheduled_jobs
 		SET last_run_at = $1, updated_at = NOW()
 		WHERE id = $2
@@ -364,3 +469,137 @@ func (w *ScheduledJobExecuteWorker) updateLastRunAt(ctx context.Context, jobID i
 		log.Printf("[Executor] Failed to update last_run_at for job %d: %v", jobID, err)
 	}
 }
+
+// ============================================================================
+// Failure Alerting
+// ============================================================================
+
+// shouldAlertScheduledJobFailure reports whether a failure streak has just
+// reached the alert threshold. Alerting only on the exact crossing (not on
+// every failure past it) sends one alert per streak; a successful run resets
+// the streak and re-arms the alert.
+func shouldAlertScheduledJobFailure(consecutiveFailures, threshold int) bool {
+	return threshold > 0 && consecutiveFailures == threshold
+}
+
+// ScheduledJobAlerter sends scheduled_job_failed notifications for repeated
+// failures. Shared by the SQL and HTTP executors.
+type ScheduledJobAlerter struct {
+	dbPool    *pgxpool.Pool
+	threshold int      // consecutive failures before alerting; 0 = disabled
+	role      string   // role_key whose members receive the alert
+	userIDs   []string // additional recipient user IDs
+	siteURL   string   // base URL for the run history link
+}
+
+// CheckFailureStreak counts consecutive failed runs for a job and sends a
+// scheduled_job_failed notification when the streak reaches the threshold.
+// This is non-blocking - failures are logged but don't affect the job result.
+// target is the function name or URL shown in the alert.
+func (w *ScheduledJobAlerter) CheckFailureStreak(ctx context.Context, jobID int64, scheduledJobID int, jobName, target string, scheduledFor time.Time, runID int64, lastError string) {
+	if w == nil || w.threshold <= 0 {
+		return
+	}
+
+	// Failed runs since the most recent successful run (in-flight runs excluded)
+	var consecutiveFailures int
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM metadata.scheduled_job_runs
+		WHERE job_id = $1
+		  AND success = false
+		  AND started_at > COALESCE(
+		      (SELECT MAX(started_at) FROM metadata.scheduled_job_runs
+		       WHERE job_id = $1 AND success = true),
+		      '-infinity'::TIMESTAMPTZ
+		  )
+	`, scheduledJobID).Scan(&consecutiveFailures)
+	if err != nil {
+		log.Printf("[Job %d] Failed to count consecutive failures: %v", jobID, err)
+		return
+	}
+
+	if !shouldAlertScheduledJobFailure(consecutiveFailures, w.threshold) {
+		return
+	}
+
+	log.Printf("[Job %d] Scheduled job '%s' failed %d consecutive times, sending alert", jobID, jobName, consecutiveFailures)
+	w.notifyScheduledJobFailed(ctx, jobID, scheduledJobID, jobName, target, scheduledFor, runID, consecutiveFailures, lastError)
+}
+
+// notifyScheduledJobFailed sends a scheduled_job_failed notification to every
+// member of role plus userIDs. Requires the 'scheduled_job_failed'
+// notification template to be configured in metadata.notification_templates.
+func (w *ScheduledJobAlerter) notifyScheduledJobFailed(ctx context.Context, jobID int64, scheduledJobID int, jobName, target string, scheduledFor time.Time, runID int64, consecutiveFailures int, lastError string) {
+	// Check if the notification template exists
+	var templateExists bool
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM metadata.notification_templates
+			WHERE name = 'scheduled_job_failed'
+		)
+	`).Scan(&templateExists)
+
+	if err != nil || !templateExists {
+		log.Printf("[Job %d] Failure alert skipped: template 'scheduled_job_failed' not configured", jobID)
+		return
+	}
+
+	// Build entity data for notification template
+	entityData := map[string]interface{}{
+		"job_id":               scheduledJobID,
+		"job_name":             jobName,
+		"function_name":        target,
+		"consecutive_failures": consecutiveFailures,
+		"last_error":           lastError,
+		"last_run_id":          runID,
+		"scheduled_for":        scheduledFor,
+		"run_history_url":      fmt.Sprintf("%s/view/scheduled_job_status/%d", strings.TrimRight(w.siteURL, "/"), scheduledJobID),
+	}
+	entityDataJSON, err := json.Marshal(entityData)
+	if err != nil {
+		log.Printf("[Job %d] Failure alert skipped: failed to marshal entity data: %v", jobID, err)
+		return
+	}
+
+	// One notification per recipient; enqueue_notification_job_trigger queues delivery.
+	// Explicit user IDs are filtered against civic_os_users so a stale ID in
+	// config can't fail the whole insert on the foreign key.
+	tag, err := w.dbPool.Exec(ctx, `
+		INSERT INTO metadata.notifications (user_id, template_name, entity_type, entity_id, entity_data, channels)
+		SELECT recipient.user_id, 'scheduled_job_failed', 'scheduled_jobs', $3::TEXT, $4::JSONB, ARRAY['email']
+		FROM (
+			SELECT ur.user_id
+			FROM metadata.user_roles ur
+			JOIN metadata.roles r ON r.id = ur.role_id
+			WHERE $1 <> '' AND r.role_key = $1
+			UNION
+			SELECT u.id
+			FROM metadata.civic_os_users u
+			WHERE u.id = ANY($2::UUID[])
+		) recipient
+	`, w.role, w.userIDs, scheduledJobID, entityDataJSON)
+
+	if err != nil {
+		log.Printf("[Job %d] Failure alert skipped: failed to queue notifications: %v", jobID, err)
+		return
+	}
+
+	if tag.RowsAffected() == 0 {
+		log.Printf("[Job %d] Failure alert skipped: no recipients (role '%s', %d user IDs)", jobID, w.role, len(w.userIDs))
+		return
+	}
+
+	log.Printf("[Job %d] Failure alert queued for %d recipients", jobID, tag.RowsAffected())
+}
+
+// parseUserIDList splits a comma-separated list of user IDs, dropping blanks
+func parseUserIDList(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/robfig/cron/v3"
+)
+
+// ============================================================================
+// Tests: run uniqueness
+// ============================================================================
+
+// TestScheduledJobArgsUnique verifies both executors' runs are unique by job
+// ID and scheduled_for only, so scheduler instances don't queue a due time twice
+func TestScheduledJobArgsUnique(t *testing.T) {
+	type argsWithOpts interface {
+		river.JobArgs
+		river.JobArgsWithInsertOpts
+	}
+	for _, args := range []argsWithOpts{ScheduledJobExecuteArgs{}, ScheduledJobHTTPArgs{}} {
+		if !args.InsertOpts().UniqueOpts.ByArgs {
+			t.Errorf("%s: UniqueOpts.ByArgs = false, want true", args.Kind())
+		}
+
+		var unique []string
+		argsType := reflect.TypeOf(args)
+		for i := 0; i < argsType.NumField(); i++ {
+			if argsType.Field(i).Tag.Get("river") == "unique" {
+				unique = append(unique, argsType.Field(i).Name)
+			}
+		}
+		if want := []string{"JobID", "ScheduledFor"}; !reflect.DeepEqual(unique, want) {
+			t.Errorf("%s: unique fields = %v, want %v", args.Kind(), unique, want)
+		}
+	}
+}
+
+// ============================================================================
+// Tests: due time and leadership
+// ============================================================================
+
+func TestNextScheduledRun(t *testing.T) {
+	daily8, _ := cron.ParseStandard("0 8 * * *")
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	at := func(day, hour, minute int) sql.NullTime {
+		return sql.NullTime{Time: time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC), Valid: true}
+	}
+
+	tests := []struct {
+		name        string
+		job         ScheduledJobRow
+		loc         string
+		wantDue     bool
+		wantFor     time.Time
+		triggeredBy string
+	}{
+		{
+			name:    "ran yesterday, due this morning",
+			job:     ScheduledJobRow{LastRunAt: at(15, 8, 0)},
+			loc:     "UTC",
+			wantDue: true, wantFor: at(16, 8, 0).Time, triggeredBy: "catchup",
+		},
+		{
+			name:    "ran this morning",
+			job:     ScheduledJobRow{LastRunAt: at(16, 8, 0)},
+			loc:     "UTC",
+			wantDue: false,
+		},
+		{
+			name:    "queued this morning, not yet run",
+			job:     ScheduledJobRow{LastRunAt: at(15, 8, 0), LastQueuedAt: at(16, 8, 1)},
+			loc:     "UTC",
+			wantDue: false,
+		},
+		{
+			name:    "queued before a run that finished later",
+			job:     ScheduledJobRow{LastRunAt: at(16, 8, 0), LastQueuedAt: at(15, 8, 0)},
+			loc:     "UTC",
+			wantDue: false,
+		},
+		{
+			name:    "never run, created an hour ago",
+			job:     ScheduledJobRow{CreatedAt: now.Add(-time.Hour)},
+			loc:     "UTC",
+			wantDue: false,
+		},
+		{
+			name:    "never run, created last week",
+			job:     ScheduledJobRow{CreatedAt: now.AddDate(0, 0, -7)},
+			loc:     "UTC",
+			wantDue: true, wantFor: at(16, 8, 0).Time, triggeredBy: "scheduler",
+		},
+		{
+			name:    "schedule in the job's timezone",
+			job:     ScheduledJobRow{LastRunAt: at(15, 12, 0)},
+			loc:     "America/New_York", // 08:00 EDT is 12:00 UTC
+			wantDue: true, wantFor: at(16, 12, 0).Time, triggeredBy: "scheduler",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.loc)
+			if err != nil {
+				t.Skipf("timezone data unavailable: %v", err)
+			}
+			scheduledFor, triggeredBy, due := nextScheduledRun(tt.job, daily8, loc, now)
+			if due != tt.wantDue {
+				t.Fatalf("due = %v (next %s), want %v", due, scheduledFor, tt.wantDue)
+			}
+			if !due {
+				return
+			}
+			if !scheduledFor.Equal(tt.wantFor) || triggeredBy != tt.triggeredBy {
+				t.Errorf("got %s %q, want %s %q", scheduledFor, triggeredBy, tt.wantFor, tt.triggeredBy)
+			}
+		})
+	}
+}
+
+type fakeSchedulerLeader struct {
+	leading  bool
+	resigned bool
+}
+
+func (l *fakeSchedulerLeader) Lead(ctx context.Context) bool { return l.leading }
+func (l *fakeSchedulerLeader) Resign(ctx context.Context)    { l.resigned = true }
+
+// TestSchedulerFollowerDoesNothing verifies a replica that doesn't lead never
+// reads scheduled jobs (the scheduler has no pool to read them with)
+func TestSchedulerFollowerDoesNothing(t *testing.T) {
+	leader := &fakeSchedulerLeader{}
+	s := &ScheduledJobScheduler{leader: leader}
+	s.tick(context.Background())
+	s.Stop()
+	if !leader.resigned {
+		t.Error("Stop() didn't resign the lead")
+	}
+}
+
+// ============================================================================
+// Tests: failure alert threshold
+// ============================================================================
+
+func TestShouldAlertScheduledJobFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		threshold int
+		want      bool
+	}{
+		{"below threshold", 2, 3, false},
+		{"reaches threshold", 3, 3, true},
+		{"past threshold (already alerted)", 4, 3, false},
+		{"threshold of one alerts on first failure", 1, 1, true},
+		{"disabled", 3, 0, false},
+		{"negative threshold disabled", 3, -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldAlertScheduledJobFailure(tt.failures, tt.threshold); got != tt.want {
+				t.Errorf("shouldAlertScheduledJobFailure(%d, %d) = %v, want %v", tt.failures, tt.threshold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUserIDList(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"a1b2", []string{"a1b2"}},
+		{"a1b2, c3d4 ,,e5f6", []string{"a1b2", "c3d4", "e5f6"}},
+	}
+
+	for _, tt := range tests {
+		if got := parseUserIDList(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseUserIDList(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
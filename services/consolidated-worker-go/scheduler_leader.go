@@ -0,0 +1,109 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============================================================================
+// Scheduler Leadership
+//
+// River elects one leader per database to run periodic jobs, and the payment
+// worker takes part in that election too: when it wins, periodic jobs only
+// the consolidated worker declares never run. So the scheduled-job scheduler
+// elects its own leader among consolidated-worker replicas with a Postgres
+// session advisory lock:
+//
+//   - each tick, a replica without the lock tries pg_try_advisory_lock; the
+//     one that gets it leads until it resigns or its connection drops
+//   - the leader checks its connection before each tick; a dead connection
+//     has already released the lock, so it stops leading at once
+//   - the lock lives on its own connection (like the NOTIFY listener), so
+//     holding it doesn't take a connection from the workers' pool
+//
+// A new leader can start while an old one's last tick is finishing, so
+// leadership keeps duplicates rare, not impossible; the claim in
+// ScheduledJobScheduler.queueRun is what keeps a due time from being queued
+// twice.
+// ============================================================================
+
+// SchedulerLeader decides whether this replica runs a scheduler
+type SchedulerLeader interface {
+	// Lead reports whether this replica leads, taking the lead if it is free
+	Lead(ctx context.Context) bool
+	// Resign gives up the lead so another replica can take it
+	Resign(ctx context.Context)
+}
+
+// schedulerLeaderTimeout bounds the lock and health queries of one tick
+const schedulerLeaderTimeout = 5 * time.Second
+
+// AdvisoryLeader leads while it holds the session advisory lock for name
+type AdvisoryLeader struct {
+	databaseURL string
+	name        string // hashed to the lock key, e.g. "metadata.scheduled_jobs"
+
+	mu   sync.Mutex
+	conn *pgx.Conn // holds the lock; nil when not leading
+}
+
+// NewAdvisoryLeader creates a leader election for name
+func NewAdvisoryLeader(databaseURL, name string) *AdvisoryLeader {
+	return &AdvisoryLeader{databaseURL: databaseURL, name: name}
+}
+
+// Lead keeps or takes the lead. Errors count as not leading; the next tick
+// tries again.
+func (l *AdvisoryLeader) Lead(ctx context.Context) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, schedulerLeaderTimeout)
+	defer cancel()
+
+	if l.conn != nil {
+		err := l.conn.Ping(ctx)
+		if err == nil {
+			return true
+		}
+		log.Printf("[Leader] Lost %s lock: %v", l.name, err)
+		l.conn.Close(context.Background())
+		l.conn = nil
+	}
+
+	conn, err := pgx.Connect(ctx, l.databaseURL)
+	if err != nil {
+		log.Printf("[Leader] Failed to connect for %s lock: %v", l.name, err)
+		return false
+	}
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, l.name).Scan(&locked); err != nil || !locked {
+		if err != nil {
+			log.Printf("[Leader] Failed to try %s lock: %v", l.name, err)
+		}
+		conn.Close(context.Background())
+		return false
+	}
+
+	l.conn = conn
+	log.Printf("[Leader] This replica now leads %s", l.name)
+	return true
+}
+
+// Resign releases the lock by closing its connection
+func (l *AdvisoryLeader) Resign(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return
+	}
+	l.conn.Close(ctx)
+	l.conn = nil
+	log.Printf("[Leader] Resigned %s", l.name)
+}
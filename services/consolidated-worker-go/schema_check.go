@@ -0,0 +1,59 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Schema Version Check
+//
+// The worker's tables (metadata.parsed_source_code, scheduled_job_runs, ...)
+// and River's own tables are created by the Sqitch migrations in
+// postgres/migrations, which the migrations container applies; the worker
+// doesn't create schema itself, so the two can't disagree about who owns a
+// table. At startup the worker looks for the newest migration of its release
+// in the Sqitch registry (metadata.changes). A worker deployed ahead of its
+// migrations then stops with one clear message instead of failing job by job
+// on a missing column.
+//
+// requiredSchemaChange is the last change in sqitch.plan; the worker and the
+// migrations image are released together, and TestRequiredSchemaChange fails
+// until a new migration is recorded here.
+// ============================================================================
+
+// requiredSchemaChange is the Sqitch change this build expects to be deployed
+const requiredSchemaChange = "v0-138-0-notification-categories"
+
+// sqitchProject is the %project name in sqitch.plan
+const sqitchProject = "civic_os"
+
+// checkSchemaVersion returns an error naming the missing change when the
+// database hasn't been migrated to requiredSchemaChange
+func checkSchemaVersion(ctx context.Context, db *pgxpool.Pool) error {
+	var deployed bool
+	var latest *string
+	err := db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM metadata.changes WHERE project = $1 AND change = $2),
+		       (SELECT change FROM metadata.changes WHERE project = $1 ORDER BY committed_at DESC LIMIT 1)
+	`, sqitchProject, requiredSchemaChange).Scan(&deployed, &latest)
+
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == "42P01": // undefined_table
+		return errors.New("database has no Sqitch registry (metadata.changes); run the migrations container before starting the worker")
+	case err != nil:
+		return fmt.Errorf("failed to read the Sqitch registry: %w", err)
+	case deployed:
+		return nil
+	case latest == nil:
+		return fmt.Errorf("no %s migrations are deployed; run the migrations container before starting the worker", sqitchProject)
+	}
+	return fmt.Errorf("database schema is at %s but this worker needs %s; run the migrations container for this release first", *latest, requiredSchemaChange)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequiredSchemaChange(t *testing.T) {
+	f, err := os.Open("../../sqitch.plan")
+	if err != nil {
+		t.Skipf("sqitch.plan not available: %v", err)
+	}
+	defer f.Close()
+
+	var project, last string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "%project="):
+			project = strings.TrimPrefix(line, "%project=")
+		case line == "", strings.HasPrefix(line, "%"), strings.HasPrefix(line, "#"), strings.HasPrefix(line, "@"):
+		default:
+			last = strings.Fields(line)[0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if project != sqitchProject {
+		t.Errorf("sqitch.plan project = %q, want %q", project, sqitchProject)
+	}
+	if last != requiredSchemaChange {
+		t.Errorf("requiredSchemaChange = %q, but the last change in sqitch.plan is %q", requiredSchemaChange, last)
+	}
+}
@@ -0,0 +1,465 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// ============================================================================
+// Secrets Providers
+//
+// Credentials (SMTP_PASSWORD, S3_SECRET_ACCESS_KEY, ...) normally come from
+// the environment. SECRETS_PROVIDER loads them from a secrets manager instead:
+//
+//   - vault: a HashiCorp Vault KV secret (VAULT_ADDR, VAULT_SECRET_PATH)
+//   - aws:   an AWS Secrets Manager secret holding a JSON object
+//   - file:  mounted secret files (Docker/Kubernetes secrets, or a SOPS file
+//     decrypted at deploy time)
+//
+// Each secret is a map of environment variable names to values. At startup
+// the values override the environment, like WORKER_CONFIG_FILE does. The
+// store then re-fetches them every SECRETS_REFRESH_SECONDS and on SIGHUP;
+// rotated credentials with a registered swap are handed to the running
+// clients, and any other changed key is logged as needing a restart.
+// ============================================================================
+
+const (
+	defaultSecretsRefreshInterval = 5 * time.Minute
+	secretsFetchTimeout           = 30 * time.Second
+)
+
+// SecretProvider fetches the current secret values, keyed by environment
+// variable name
+type SecretProvider interface {
+	Name() string
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// newSecretProviderFromEnv builds the provider selected by SECRETS_PROVIDER.
+// It returns nil when secrets come from the environment only.
+func newSecretProviderFromEnv(ctx context.Context) (SecretProvider, error) {
+	switch name := strings.ToLower(getEnv("SECRETS_PROVIDER", "")); name {
+	case "", "env":
+		return nil, nil
+	case "vault":
+		return newVaultSecretProvider(
+			getEnv("VAULT_ADDR", ""),
+			getEnv("VAULT_SECRET_PATH", ""),
+			getEnv("VAULT_TOKEN", ""),
+			getEnv("VAULT_TOKEN_FILE", ""),
+			getEnv("VAULT_NAMESPACE", ""),
+		)
+	case "aws":
+		return newAWSSecretsManagerProvider(ctx,
+			getEnv("AWS_SECRETS_MANAGER_SECRET_ID", ""),
+			getEnv("AWS_SECRETS_MANAGER_REGION", getEnv("AWS_REGION", "us-east-1")),
+			getEnv("AWS_SECRETS_MANAGER_ENDPOINT", ""),
+		)
+	case "file":
+		return newFileSecretProvider(getEnv("SECRETS_FILE", ""))
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q (expected vault, aws or file)", name)
+	}
+}
+
+// --- HashiCorp Vault ---
+
+// vaultSecretProvider reads one KV secret over Vault's HTTP API. Both KV
+// engine versions work: for v2 the path includes /data/
+// (secret/data/civic-os/worker).
+type vaultSecretProvider struct {
+	addr       string
+	path       string
+	token      string
+	tokenFile  string // re-read on every fetch, so a Vault Agent can renew it
+	namespace  string
+	httpClient *http.Client
+}
+
+func newVaultSecretProvider(addr, path, token, tokenFile, namespace string) (*vaultSecretProvider, error) {
+	if addr == "" || path == "" {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=vault requires VAULT_ADDR and VAULT_SECRET_PATH")
+	}
+	if token == "" && tokenFile == "" {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=vault requires VAULT_TOKEN or VAULT_TOKEN_FILE")
+	}
+	return &vaultSecretProvider{
+		addr:       strings.TrimRight(addr, "/"),
+		path:       strings.Trim(path, "/"),
+		token:      token,
+		tokenFile:  tokenFile,
+		namespace:  namespace,
+		httpClient: &http.Client{Timeout: secretsFetchTimeout},
+	}, nil
+}
+
+func (p *vaultSecretProvider) Name() string {
+	return "vault:" + p.path
+}
+
+func (p *vaultSecretProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	token := p.token
+	if p.tokenFile != "" {
+		data, err := os.ReadFile(p.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read VAULT_TOKEN_FILE: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.addr+"/v1/"+p.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d for %s", resp.StatusCode, p.path)
+	}
+
+	var result struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse vault response: %w", err)
+	}
+	// KV v2 nests the secret under data.data, next to data.metadata
+	if nested, ok := result.Data["data"]; ok {
+		if _, hasMetadata := result.Data["metadata"]; hasMetadata {
+			return parseSecretObject(nested)
+		}
+	}
+	raw, err := json.Marshal(result.Data)
+	if err != nil {
+		return nil, err
+	}
+	return parseSecretObject(raw)
+}
+
+// --- AWS Secrets Manager ---
+
+// secretsManagerAPI is the subset of *secretsmanager.Client the provider uses
+type secretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// awsSecretsManagerProvider calls GetSecretValue through the AWS SDK.
+// Credentials come from the AWS default chain (instance or task role, or
+// AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY), not the S3_* keys. The secret
+// string must be a JSON object.
+type awsSecretsManagerProvider struct {
+	secretID string
+	client   secretsManagerAPI
+}
+
+// newAWSSecretsManagerProvider loads the default AWS configuration for
+// region. An empty endpoint uses the regional Secrets Manager endpoint.
+func newAWSSecretsManagerProvider(ctx context.Context, secretID, region, endpoint string) (*awsSecretsManagerProvider, error) {
+	if secretID == "" {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=aws requires AWS_SECRETS_MANAGER_SECRET_ID")
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("load AWS configuration: %w", err)
+	}
+	client := secretsmanager.NewFromConfig(awsCfg, func(o *secretsmanager.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.HTTPClient = &http.Client{Timeout: secretsFetchTimeout}
+	})
+	return &awsSecretsManagerProvider{secretID: secretID, client: client}, nil
+}
+
+func (p *awsSecretsManagerProvider) Name() string {
+	return "aws:" + p.secretID
+}
+
+func (p *awsSecretsManagerProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(p.secretID)})
+	if err != nil {
+		return nil, fmt.Errorf("secrets manager request failed: %w", err)
+	}
+	if out.SecretString == nil {
+		return nil, fmt.Errorf("secret %s has no SecretString (binary secrets are not supported)", p.secretID)
+	}
+	return parseSecretObject([]byte(*out.SecretString))
+}
+
+// --- Mounted files ---
+
+// fileSecretProvider reads SECRETS_FILE on every fetch. A directory holds one
+// file per key, named after the variable (Docker and Kubernetes secrets); a
+// .json file holds an object; any other file holds KEY=VALUE lines. SOPS
+// files must be decrypted into the mount before the worker reads them
+// (e.g. by sops exec-file or an init container).
+type fileSecretProvider struct {
+	path string
+}
+
+func newFileSecretProvider(path string) (*fileSecretProvider, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=file requires SECRETS_FILE")
+	}
+	return &fileSecretProvider{path: path}, nil
+}
+
+func (p *fileSecretProvider) Name() string {
+	return "file:" + p.path
+}
+
+func (p *fileSecretProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if strings.EqualFold(filepath.Ext(p.path), ".json") {
+			data, err := os.ReadFile(p.path)
+			if err != nil {
+				return nil, err
+			}
+			return parseSecretObject(data)
+		}
+		return readConfigFile(p.path)
+	}
+
+	entries, err := os.ReadDir(p.path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, entry := range entries {
+		// Kubernetes mounts keep their data in ..data and timestamped dirs
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		filePath := filepath.Join(p.path, entry.Name())
+		info, err := os.Stat(filePath) // follows the Kubernetes symlinks
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		values[entry.Name()] = strings.TrimRight(string(data), "\r\n")
+	}
+	return values, nil
+}
+
+// parseSecretObject decodes a JSON object of variable names to values.
+// Numbers and booleans are kept as written; nested values are rejected.
+func parseSecretObject(data []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			values[key] = s
+			continue
+		}
+		trimmed := bytes.TrimSpace(value)
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return nil, fmt.Errorf("secret %s must be a string, not an object or array", key)
+		}
+		values[key] = string(trimmed)
+	}
+	return values, nil
+}
+
+// --- Store and hot swap ---
+
+// secretRotation is a swap and the keys that trigger it
+type secretRotation struct {
+	keys []string
+	swap func()
+}
+
+// SecretStore applies a provider's values to the environment and hands
+// rotated credentials to the running clients
+type SecretStore struct {
+	provider SecretProvider
+	interval time.Duration
+
+	mu        sync.Mutex
+	values    map[string]string
+	rotations []secretRotation
+}
+
+// NewSecretStore creates a store refreshing provider every interval
+func NewSecretStore(provider SecretProvider, interval time.Duration) *SecretStore {
+	if interval <= 0 {
+		interval = defaultSecretsRefreshInterval
+	}
+	return &SecretStore{provider: provider, interval: interval, values: map[string]string{}}
+}
+
+// OnRotate registers swap to run once when any of keys changes. swap
+// re-reads the keys with getEnv.
+func (s *SecretStore) OnRotate(swap func(), keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotations = append(s.rotations, secretRotation{keys: keys, swap: swap})
+}
+
+// Load fetches the secrets and copies them into the environment, returning
+// the keys set. Call it before any credential is read.
+func (s *SecretStore) Load(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, secretsFetchTimeout)
+	defer cancel()
+	values, err := s.provider.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changed []string
+	for key, value := range values {
+		if previous, ok := s.values[key]; ok && previous == value {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return nil, fmt.Errorf("set %s: %w", key, err)
+		}
+		s.values[key] = value
+		changed = append(changed, key)
+	}
+	// A key removed from the secret keeps its last value until restart
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// Refresh re-fetches the secrets and runs the swaps for rotated keys. Errors
+// are logged; the current credentials are kept.
+func (s *SecretStore) Refresh(ctx context.Context) {
+	changed, err := s.Load(ctx)
+	if err != nil {
+		log.Printf("[Secrets] Failed to refresh from %s, keeping current credentials: %v", s.provider.Name(), err)
+		return
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	swaps, restart := s.rotationsFor(changed)
+	for _, swap := range swaps {
+		swap()
+	}
+	if applied := len(changed) - len(restart); applied > 0 {
+		log.Printf("[Secrets] ✓ Rotated %d credential(s) from %s", applied, s.provider.Name())
+	}
+	if len(restart) > 0 {
+		log.Printf("[Secrets] ⚠ Changed but only applied on restart: %s", strings.Join(restart, ", "))
+	}
+}
+
+// rotationsFor returns the swaps to run for changed keys, each once, and the
+// changed keys no swap covers
+func (s *SecretStore) rotationsFor(changed []string) (swaps []func(), restart []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	covered := make(map[string]bool)
+	for _, rotation := range s.rotations {
+		triggered := false
+		for _, key := range rotation.keys {
+			covered[key] = true
+			if !triggered && slices.Contains(changed, key) {
+				triggered = true
+			}
+		}
+		if triggered {
+			swaps = append(swaps, rotation.swap)
+		}
+	}
+	for _, key := range changed {
+		if !covered[key] {
+			restart = append(restart, key)
+		}
+	}
+	return swaps, restart
+}
+
+// registerCredentialRotations swaps rotated SMTP, S3, Telnyx and identity
+// provider credentials into the running clients. telnyx and identity may be
+// nil. DATABASE_URL and DOCUSIGN_PRIVATE_KEY still need a restart.
+func registerCredentialRotations(store *SecretStore, smtpConfig *SMTPConfig, s3Clients *S3Clients, telnyx *TelnyxClient, identity IdentityProvider) {
+	store.OnRotate(func() {
+		smtpConfig.SetCredentials(getEnv("SMTP_USERNAME", ""), getEnv("SMTP_PASSWORD", ""))
+	}, "SMTP_USERNAME", "SMTP_PASSWORD")
+	if smtpConfig.Secondary != nil {
+		store.OnRotate(func() {
+			smtpConfig.Secondary.SetCredentials(getEnv("SMTP_SECONDARY_USERNAME", ""), getEnv("SMTP_SECONDARY_PASSWORD", ""))
+		}, "SMTP_SECONDARY_USERNAME", "SMTP_SECONDARY_PASSWORD")
+	}
+	store.OnRotate(func() {
+		s3Clients.SetCredentials(
+			getS3Env("S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID", ""),
+			getS3Env("S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", ""))
+	}, "S3_ACCESS_KEY_ID", "S3_SECRET_ACCESS_KEY", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY")
+	if telnyx != nil {
+		store.OnRotate(func() { telnyx.SetAPIKey(getEnv("TELNYX_API_KEY", "")) }, "TELNYX_API_KEY")
+	}
+	switch provider := identity.(type) {
+	case *KeycloakClient:
+		store.OnRotate(func() {
+			provider.SetClientSecret(getEnv("KEYCLOAK_SERVICE_CLIENT_SECRET", ""))
+		}, "KEYCLOAK_SERVICE_CLIENT_SECRET")
+	case *AuthentikClient:
+		store.OnRotate(func() {
+			provider.SetAPIToken(getEnv("AUTHENTIK_API_TOKEN", ""))
+		}, "AUTHENTIK_API_TOKEN")
+	}
+}
+
+// Run refreshes the secrets every interval until ctx is cancelled
+func (s *SecretStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh(ctx)
+		}
+	}
+}
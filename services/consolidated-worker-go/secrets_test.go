@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeSecretProvider struct {
+	values map[string]string
+	err    error
+}
+
+func (p *fakeSecretProvider) Name() string { return "fake" }
+
+func (p *fakeSecretProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	return p.values, p.err
+}
+
+func TestFileSecretProvider_Directory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "SMTP_PASSWORD"), []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := (&fileSecretProvider{path: dir}).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if want := map[string]string{"SMTP_PASSWORD": "hunter2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch = %v, want %v", got, want)
+	}
+}
+
+func TestFileSecretProvider_JSONAndEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "secrets.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"SMTP_PASSWORD":"a","SMTP_PORT":2525}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	envPath := filepath.Join(dir, "secrets.env")
+	if err := os.WriteFile(envPath, []byte("SMTP_PASSWORD='b'\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := (&fileSecretProvider{path: jsonPath}).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch json: %v", err)
+	}
+	if want := map[string]string{"SMTP_PASSWORD": "a", "SMTP_PORT": "2525"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch json = %v, want %v", got, want)
+	}
+
+	got, err = (&fileSecretProvider{path: envPath}).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch env: %v", err)
+	}
+	if want := map[string]string{"SMTP_PASSWORD": "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch env = %v, want %v", got, want)
+	}
+}
+
+func TestParseSecretObject_RejectsNestedValues(t *testing.T) {
+	if _, err := parseSecretObject([]byte(`{"SMTP": {"password": "x"}}`)); err == nil {
+		t.Error("expected an error for a nested object")
+	}
+	if _, err := parseSecretObject([]byte(`"just a string"`)); err == nil {
+		t.Error("expected an error for a non-object secret")
+	}
+}
+
+func TestVaultSecretProvider_KVVersions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/civic-os/worker":
+			w.Write([]byte(`{"data":{"data":{"SMTP_PASSWORD":"v2"},"metadata":{"version":3}}}`))
+		case "/v1/kv/civic-os/worker":
+			w.Write([]byte(`{"data":{"SMTP_PASSWORD":"v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s.token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{"secret/data/civic-os/worker": "v2", "/kv/civic-os/worker": "v1"} {
+		provider, err := newVaultSecretProvider(server.URL+"/", path, "", tokenFile, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := provider.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("Fetch(%s): %v", path, err)
+		}
+		if got["SMTP_PASSWORD"] != want {
+			t.Errorf("Fetch(%s) = %v, want SMTP_PASSWORD=%s", path, got, want)
+		}
+	}
+
+	provider, _ := newVaultSecretProvider(server.URL, "secret/data/missing", "s.token", "", "")
+	if _, err := provider.Fetch(context.Background()); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+}
+
+func TestAWSSecretsManagerProvider_Fetch(t *testing.T) {
+	// Credentials from the environment, the first link of the default chain
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Amz-Target"); got != "secretsmanager.GetSecretValue" {
+			t.Errorf("X-Amz-Target = %q", got)
+		}
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "Credential=AKIDTEST/") || !strings.Contains(auth, "/us-west-2/secretsmanager/") {
+			t.Errorf("Authorization = %q", auth)
+		}
+		var body struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.SecretId != "civic-os/worker" {
+			t.Errorf("SecretId = %q", body.SecretId)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write([]byte(`{"SecretString":"{\"SMTP_PASSWORD\":\"aws\"}"}`))
+	}))
+	defer server.Close()
+
+	provider, err := newAWSSecretsManagerProvider(context.Background(), "civic-os/worker", "us-west-2", server.URL)
+	if err != nil {
+		t.Fatalf("newAWSSecretsManagerProvider: %v", err)
+	}
+	got, err := provider.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if want := map[string]string{"SMTP_PASSWORD": "aws"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch = %v, want %v", got, want)
+	}
+}
+
+func TestSecretStore_RefreshRunsSwapsOnce(t *testing.T) {
+	t.Setenv("SMTP_USERNAME", "")
+	t.Setenv("SMTP_PASSWORD", "")
+	t.Setenv("DATABASE_URL", "")
+	provider := &fakeSecretProvider{values: map[string]string{"SMTP_USERNAME": "ses", "SMTP_PASSWORD": "old"}}
+	store := NewSecretStore(provider, 0)
+
+	keys, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if want := []string{"SMTP_PASSWORD", "SMTP_USERNAME"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Load = %v, want %v", keys, want)
+	}
+	if got := os.Getenv("SMTP_PASSWORD"); got != "old" {
+		t.Errorf("SMTP_PASSWORD = %q, want old", got)
+	}
+
+	smtpConfig := &SMTPConfig{Username: "ses", Password: "old"}
+	swaps := 0
+	store.OnRotate(func() {
+		swaps++
+		smtpConfig.SetCredentials(getEnv("SMTP_USERNAME", ""), getEnv("SMTP_PASSWORD", ""))
+	}, "SMTP_USERNAME", "SMTP_PASSWORD")
+
+	// Unchanged values don't swap
+	store.Refresh(context.Background())
+	if swaps != 0 {
+		t.Errorf("swaps = %d after an unchanged refresh, want 0", swaps)
+	}
+
+	provider.values = map[string]string{"SMTP_USERNAME": "ses2", "SMTP_PASSWORD": "new", "DATABASE_URL": "postgres://new"}
+	store.Refresh(context.Background())
+	if swaps != 1 {
+		t.Errorf("swaps = %d, want 1", swaps)
+	}
+	if smtpConfig.Password != "new" || smtpConfig.Username != "ses2" {
+		t.Errorf("SMTP credentials = %s/%s, want ses2/new", smtpConfig.Username, smtpConfig.Password)
+	}
+
+	swapFns, restart := store.rotationsFor([]string{"DATABASE_URL"})
+	if len(swapFns) != 0 || !reflect.DeepEqual(restart, []string{"DATABASE_URL"}) {
+		t.Errorf("rotationsFor(DATABASE_URL) = %d swaps, restart %v", len(swapFns), restart)
+	}
+}
+
+func TestSecretStore_RefreshErrorKeepsCredentials(t *testing.T) {
+	t.Setenv("SMTP_PASSWORD", "")
+	provider := &fakeSecretProvider{values: map[string]string{"SMTP_PASSWORD": "current"}}
+	store := NewSecretStore(provider, 0)
+	if _, err := store.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	provider.values, provider.err = nil, os.ErrDeadlineExceeded
+	store.Refresh(context.Background())
+	if got := os.Getenv("SMTP_PASSWORD"); got != "current" {
+		t.Errorf("SMTP_PASSWORD = %q after a failed refresh, want current", got)
+	}
+}
+
+func TestRotatingCredentials(t *testing.T) {
+	creds := newRotatingCredentials("AKID1", "secret1")
+	creds.Set("AKID2", "secret2")
+	got, err := creds.Retrieve(context.Background())
+	if err != nil || got.AccessKeyID != "AKID2" || got.SecretAccessKey != "secret2" {
+		t.Errorf("Retrieve = %+v, %v; want AKID2/secret2", got, err)
+	}
+}
+
+func TestNewSecretProviderFromEnv(t *testing.T) {
+	t.Setenv("SECRETS_PROVIDER", "")
+	if provider, err := newSecretProviderFromEnv(context.Background()); provider != nil || err != nil {
+		t.Errorf("no SECRETS_PROVIDER = %v, %v; want nil, nil", provider, err)
+	}
+	t.Setenv("SECRETS_PROVIDER", "vault")
+	t.Setenv("VAULT_ADDR", "")
+	if _, err := newSecretProviderFromEnv(context.Background()); err == nil {
+		t.Error("expected an error for vault without VAULT_ADDR")
+	}
+	t.Setenv("SECRETS_PROVIDER", "keychain")
+	if _, err := newSecretProviderFromEnv(context.Background()); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+}
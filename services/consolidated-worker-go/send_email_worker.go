@@ -2,12 +2,9 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
-	"net"
-	"net/smtp"
 	"strings"
 	"time"
 
@@ -76,7 +73,8 @@ func (w *SendEmailWorker) Work(ctx context.Context, job *river.Job[SendEmailArgs
 	}
 
 	// 4. Send email via SMTP with multi-recipient support
-	err = sendEmailSMTP(w.smtpConfig, job.Args.To, job.Args.CC, rendered, job.Args.ReplyTo)
+	server, err := sendEmailSMTP(ctx, w.smtpConfig, job.Args.To, job.Args.CC, rendered, job.Args.ReplyTo,
+		job.Args.EntityType, job.Args.EntityID)
 	if err != nil {
 		if isTransientError(err) {
 			log.Printf("[Job %d] Transient error, will retry: %v", job.ID, err)
@@ -86,6 +84,25 @@ func (w *SendEmailWorker) Work(ctx context.Context, job *river.Job[SendEmailArgs
 		return nil
 	}
 
+	if template.ArchiveRendered {
+		logArchiveError(job.ID, archiveRendered(ctx, w.dbPool, NotificationArchiveEntry{
+			JobID:        job.ID,
+			TemplateName: job.Args.TemplateName,
+			EntityType:   job.Args.EntityType,
+			EntityID:     job.Args.EntityID,
+			Recipients:   job.Args.To,
+			CC:           job.Args.CC,
+			ChannelsSent: []string{"email"},
+			EmailServer:  server,
+			Rendered:     rendered,
+		}))
+	}
+	if server != "" {
+		if err := river.RecordOutput(ctx, map[string]string{"email_provider": server}); err != nil {
+			log.Printf("[Job %d] Failed to record output: %v", job.ID, err)
+		}
+	}
+
 	duration := time.Since(startTime)
 	log.Printf("[Job %d] ✓ Email sent successfully to=%v cc=%v in %v",
 		job.ID, job.Args.To, job.Args.CC, duration)
@@ -101,10 +118,12 @@ func (w *SendEmailWorker) Work(ctx context.Context, job *river.Job[SendEmailArgs
 func loadTemplateFromDB(ctx context.Context, dbPool *pgxpool.Pool, templateName string) (*NotificationTemplate, error) {
 	var tmpl NotificationTemplate
 	err := dbPool.QueryRow(ctx, `
-		SELECT subject_template, html_template, text_template, COALESCE(sms_template, '')
+		SELECT subject_template, html_template, text_template, COALESCE(sms_template, ''), track_engagement, archive_rendered,
+		       COALESCE(active_version, 0), COALESCE(category, '')
 		FROM metadata.notification_templates
 		WHERE name = $1
-	`, templateName).Scan(&tmpl.Subject, &tmpl.HTML, &tmpl.Text, &tmpl.SMS)
+	`, templateName).Scan(&tmpl.Subject, &tmpl.HTML, &tmpl.Text, &tmpl.SMS, &tmpl.TrackEngagement, &tmpl.ArchiveRendered,
+		&tmpl.Version, &tmpl.Category)
 
 	if err != nil {
 		return nil, fmt.Errorf("template '%s' not found: %w", templateName, err)
@@ -119,8 +138,11 @@ func loadTemplateFromDB(ctx context.Context, dbPool *pgxpool.Pool, templateName
 
 // sendEmailSMTP sends an email via SMTP with support for multiple TO and CC recipients.
 // This is a standalone function (not a method) so it can be used by SendEmailWorker
-// without coupling to NotificationWorker.
-func sendEmailSMTP(smtpConfig *SMTPConfig, to []string, cc []string, rendered *RenderedNotification, replyToOverride string) error {
+// without coupling to NotificationWorker. With an entity type and ID, the email is
+// threaded with earlier email about that record. Returns the SMTP server that
+// accepted the message, or "" when nothing was sent.
+func sendEmailSMTP(ctx context.Context, smtpConfig *SMTPConfig, to []string, cc []string, rendered *RenderedNotification, replyToOverride string,
+	entityType, entityID string) (server string, err error) {
 	// Filter out test emails if configured
 	var realTo []string
 	for _, addr := range to {
@@ -140,10 +162,31 @@ func sendEmailSMTP(smtpConfig *SMTPConfig, to []string, cc []string, rendered *R
 		realCC = append(realCC, addr)
 	}
 
+	// Drop suppressed addresses (bounced, complained or blocked by an admin)
+	suppressed, err := smtpConfig.Suppressions.Suppressed(ctx, append(append([]string{}, realTo...), realCC...))
+	if err != nil {
+		return "", err
+	}
+	if len(suppressed) > 0 {
+		realTo = withoutSuppressed(realTo, suppressed, "TO")
+		realCC = withoutSuppressed(realCC, suppressed, "CC")
+		if len(realTo) == 0 {
+			return "", fmt.Errorf("every TO address: %w", errEmailSuppressed)
+		}
+	}
+
 	// If all TO addresses were filtered out, nothing to send
 	if len(realTo) == 0 {
 		log.Printf("⚠️  All TO addresses were test emails — skipping send")
-		return nil
+		return "", nil
+	}
+
+	if smtpConfig.DryRun.Simulates(dryRunEmail) {
+		smtpConfig.DryRun.Record(ctx, dryRunEmail, "email.send", strings.Join(realTo, ", "), map[string]any{
+			"cc":      realCC,
+			"subject": rendered.Subject,
+		})
+		return "", nil
 	}
 
 	// Parse RFC 5322 format for From header vs SMTP envelope
@@ -171,6 +214,7 @@ func sendEmailSMTP(smtpConfig *SMTPConfig, to []string, cc []string, rendered *R
 	headers["MIME-Version"] = "1.0"
 	headers["Content-Type"] = fmt.Sprintf("multipart/alternative; boundary=\"%s\"", boundary)
 	headers["Date"] = time.Now().Format(time.RFC1123Z)
+	setThreadHeaders(headers, entityType, entityID, domain)
 
 	// Add Reply-To header: per-call override takes precedence, then global config
 	replyTo := replyToOverride
@@ -204,71 +248,23 @@ func sendEmailSMTP(smtpConfig *SMTPConfig, to []string, cc []string, rendered *R
 
 	emailBody.WriteString("--" + boundary + "--")
 
-	// Connect to SMTP server
-	serverAddr := net.JoinHostPort(smtpConfig.Host, smtpConfig.Port)
-	conn, err := net.DialTimeout("tcp", serverAddr, 10*time.Second)
-	if err != nil {
-		return fmt.Errorf("failed to connect to SMTP server: %w", err)
-	}
-
-	client, err := smtp.NewClient(conn, smtpConfig.Host)
-	if err != nil {
-		return fmt.Errorf("failed to create SMTP client: %w", err)
-	}
-	defer client.Close()
-
-	// Start TLS if supported (STARTTLS)
-	if ok, _ := client.Extension("STARTTLS"); ok {
-		tlsConfig := &tls.Config{
-			ServerName: smtpConfig.Host,
-			MinVersion: tls.VersionTLS12,
-		}
-		if err = client.StartTLS(tlsConfig); err != nil {
-			return fmt.Errorf("STARTTLS failed: %w", err)
-		}
-	}
-
-	// Authenticate if credentials provided
-	if smtpConfig.Username != "" && smtpConfig.Password != "" {
-		auth := smtp.PlainAuth("", smtpConfig.Username, smtpConfig.Password, smtpConfig.Host)
-		if err = client.Auth(auth); err != nil {
-			return fmt.Errorf("SMTP authentication failed: %w", err)
-		}
-	}
-
-	// SMTP envelope: MAIL FROM
-	if err = client.Mail(envelopeFrom); err != nil {
-		return fmt.Errorf("MAIL FROM failed: %w", err)
-	}
+	// Time the SMTP conversation (skipped test addresses aren't sends)
+	sendStarted := time.Now()
+	defer func() { workerMetrics.ObserveSMTPSend(sendStarted, err) }()
 
 	// SMTP envelope: RCPT TO for all recipients (TO + CC)
-	allRecipients := append(realTo, realCC...)
-	for _, rcpt := range allRecipients {
-		if err = client.Rcpt(rcpt); err != nil {
-			return fmt.Errorf("RCPT TO failed for %s: %w", rcpt, err)
-		}
-	}
-
-	// Send DATA
-	writer, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("DATA command failed: %w", err)
-	}
-
-	_, err = writer.Write([]byte(emailBody.String()))
-	if err != nil {
-		writer.Close()
-		return fmt.Errorf("failed to write email body: %w", err)
-	}
-
-	err = writer.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close DATA writer: %w", err)
-	}
+	return smtpConfig.send(ctx, envelopeFrom, append(realTo, realCC...), []byte(emailBody.String()))
+}
 
-	if err = client.Quit(); err != nil {
-		log.Printf("Warning: QUIT command failed: %v", err)
+// withoutSuppressed drops the suppressed addresses from a recipient list
+func withoutSuppressed(addresses []string, suppressed map[string]string, field string) []string {
+	var kept []string
+	for _, addr := range addresses {
+		if reason, ok := suppressed[addr]; ok {
+			log.Printf("⚠️  Skipping suppressed email in %s: %s (%s)", field, addr, reason)
+			continue
+		}
+		kept = append(kept, addr)
 	}
-
-	return nil
+	return kept
 }
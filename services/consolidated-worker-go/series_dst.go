@@ -0,0 +1,123 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ============================================================================
+// DST Transition Handling (v0.134.0)
+// ============================================================================
+//
+// Series expand in wall-clock time, so an occurrence can name a local time
+// that doesn't exist (2:30 AM on spring-forward day) or exists twice (1:30 AM
+// on fall-back day). time.Date resolves both without saying so, and for gaps
+// it may move the time either way depending on the zone. The series group's
+// dst_policy decides instead:
+//
+//	Policy                  Time that doesn't exist     Time that occurs twice
+//	pick_first (default)    moved forward by the gap    the first one
+//	shift_forward           moved forward by the gap    the second one
+//	skip                    skipped                     the first one
+
+// DST policies of a series group (time_slot_series_groups.dst_policy)
+const (
+	dstPolicyPickFirst    = "pick_first"
+	dstPolicyShiftForward = "shift_forward"
+	dstPolicySkip         = "skip"
+)
+
+// dstAdjustment describes how a wall-clock time in a DST transition was
+// resolved, for logging
+type dstAdjustment struct {
+	Local   time.Time // requested wall-clock time (zone ignored)
+	Skipped bool
+	Message string
+}
+
+// resolveLocalTimes converts wall-clock times in loc to UTC instants,
+// resolving times in DST transitions by policy. Skipped times are left out;
+// every time the policy changed or dropped is reported.
+func resolveLocalTimes(times []time.Time, loc *time.Location, policy string) ([]time.Time, []dstAdjustment) {
+	result := make([]time.Time, 0, len(times))
+	var adjustments []dstAdjustment
+	for _, t := range times {
+		resolved, adj := resolveWallClock(t, loc, policy)
+		if adj != nil {
+			adjustments = append(adjustments, *adj)
+			if adj.Skipped {
+				continue
+			}
+		}
+		result = append(result, resolved)
+	}
+	return result, adjustments
+}
+
+// resolveWallClock returns the UTC instant of t's wall-clock time in loc. The
+// adjustment is nil unless the time falls in a DST gap or overlap.
+func resolveWallClock(t time.Time, loc *time.Location, policy string) (time.Time, *dstAdjustment) {
+	naive := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	plain := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc).UTC()
+
+	// Offsets on either side of any transition near t
+	before := zoneOffset(naive.Add(-24*time.Hour), loc)
+	after := zoneOffset(naive.Add(24*time.Hour), loc)
+	if before == after {
+		return plain, nil
+	}
+
+	var valid []time.Time
+	for _, offset := range []int{before, after} {
+		u := naive.Add(-time.Duration(offset) * time.Second)
+		if sameWallClock(u.In(loc), naive) {
+			valid = append(valid, u)
+		}
+	}
+	sort.Slice(valid, func(i, j int) bool { return valid[i].Before(valid[j]) })
+
+	local := naive.Format("2006-01-02 15:04")
+	switch len(valid) {
+	case 0:
+		// Gap: read with the offset in force before it, which lands as far
+		// past the gap's start as t is
+		if policy == dstPolicySkip {
+			return time.Time{}, &dstAdjustment{
+				Local:   naive,
+				Skipped: true,
+				Message: fmt.Sprintf("%s does not exist in %s; skipped", local, loc),
+			}
+		}
+		moved := naive.Add(-time.Duration(before) * time.Second)
+		return moved, &dstAdjustment{
+			Local:   naive,
+			Message: fmt.Sprintf("%s does not exist in %s; moved to %s", local, loc, moved.In(loc).Format("15:04 MST")),
+		}
+	case 2:
+		chosen, which := valid[0], "first"
+		if policy == dstPolicyShiftForward {
+			chosen, which = valid[1], "second"
+		}
+		return chosen, &dstAdjustment{
+			Local:   naive,
+			Message: fmt.Sprintf("%s occurs twice in %s; using the %s (%s)", local, loc, which, chosen.In(loc).Format("15:04 MST")),
+		}
+	default:
+		return valid[0], nil
+	}
+}
+
+// zoneOffset returns loc's UTC offset in seconds at t
+func zoneOffset(t time.Time, loc *time.Location) int {
+	_, offset := t.In(loc).Zone()
+	return offset
+}
+
+// sameWallClock reports whether a and b show the same date and time of day
+func sameWallClock(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day() &&
+		a.Hour() == b.Hour() && a.Minute() == b.Minute() && a.Second() == b.Second()
+}
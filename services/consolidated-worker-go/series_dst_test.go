@@ -0,0 +1,208 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+// wall builds a wall-clock time the way pgx reads series dtstart (UTC-tagged)
+func wall(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestResolveWallClock(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		local    time.Time
+		policy   string
+		want     time.Time // UTC; zero when skipped
+		adjusted bool
+		skipped  bool
+	}{
+		// US spring forward: 2026-03-08 02:00 EST -> 03:00 EDT
+		{"gap pick_first", "America/New_York", wall(2026, 3, 8, 2, 30), dstPolicyPickFirst, wall(2026, 3, 8, 7, 30), true, false},
+		{"gap shift_forward", "America/New_York", wall(2026, 3, 8, 2, 30), dstPolicyShiftForward, wall(2026, 3, 8, 7, 30), true, false},
+		{"gap skip", "America/New_York", wall(2026, 3, 8, 2, 30), dstPolicySkip, time.Time{}, true, true},
+		{"gap start", "America/New_York", wall(2026, 3, 8, 2, 0), dstPolicyPickFirst, wall(2026, 3, 8, 7, 0), true, false},
+		{"just before gap", "America/New_York", wall(2026, 3, 8, 1, 59), dstPolicySkip, wall(2026, 3, 8, 6, 59), false, false},
+		{"gap end", "America/New_York", wall(2026, 3, 8, 3, 0), dstPolicySkip, wall(2026, 3, 8, 7, 0), false, false},
+		{"afternoon of spring forward", "America/New_York", wall(2026, 3, 8, 14, 0), dstPolicySkip, wall(2026, 3, 8, 18, 0), false, false},
+
+		// US fall back: 2026-11-01 02:00 EDT -> 01:00 EST
+		{"overlap pick_first", "America/New_York", wall(2026, 11, 1, 1, 30), dstPolicyPickFirst, wall(2026, 11, 1, 5, 30), true, false},
+		{"overlap skip", "America/New_York", wall(2026, 11, 1, 1, 30), dstPolicySkip, wall(2026, 11, 1, 5, 30), true, false},
+		{"overlap shift_forward", "America/New_York", wall(2026, 11, 1, 1, 30), dstPolicyShiftForward, wall(2026, 11, 1, 6, 30), true, false},
+		{"overlap start", "America/New_York", wall(2026, 11, 1, 1, 0), dstPolicyPickFirst, wall(2026, 11, 1, 5, 0), true, false},
+		{"after overlap", "America/New_York", wall(2026, 11, 1, 2, 0), dstPolicyShiftForward, wall(2026, 11, 1, 7, 0), false, false},
+
+		// Southern hemisphere: Sydney springs forward 2026-10-04 02:00 AEST -> 03:00 AEDT
+		{"southern gap", "Australia/Sydney", wall(2026, 10, 4, 2, 15), dstPolicyPickFirst, wall(2026, 10, 3, 16, 15), true, false},
+		{"southern overlap second", "Australia/Sydney", wall(2026, 4, 5, 2, 30), dstPolicyShiftForward, wall(2026, 4, 4, 16, 30), true, false},
+
+		// Lord Howe Island moves its clocks by 30 minutes
+		{"half-hour gap", "Australia/Lord_Howe", wall(2026, 10, 4, 2, 15), dstPolicyPickFirst, wall(2026, 10, 3, 15, 45), true, false},
+		{"half-hour overlap first", "Australia/Lord_Howe", wall(2026, 4, 5, 1, 45), dstPolicyPickFirst, wall(2026, 4, 4, 14, 45), true, false},
+
+		// Zones without DST
+		{"no DST", "America/Phoenix", wall(2026, 3, 8, 2, 30), dstPolicySkip, wall(2026, 3, 8, 9, 30), false, false},
+		{"UTC", "UTC", wall(2026, 3, 29, 1, 30), dstPolicySkip, wall(2026, 3, 29, 1, 30), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := mustLoadLocation(t, tt.zone)
+			got, adj := resolveWallClock(tt.local, loc, tt.policy)
+
+			if (adj != nil) != tt.adjusted {
+				t.Fatalf("adjustment = %+v, want adjusted=%v", adj, tt.adjusted)
+			}
+			if adj != nil && adj.Skipped != tt.skipped {
+				t.Errorf("Skipped = %v, want %v (%s)", adj.Skipped, tt.skipped, adj.Message)
+			}
+			if tt.skipped {
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("resolveWallClock() = %v (%v local), want %v", got.UTC(), got.In(loc), tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveWallClock_GapMovesForwardOnlyByGap(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+
+	// Every minute of the gap lands the same distance past 03:00 EDT
+	for min := 0; min < 60; min += 15 {
+		got, _ := resolveWallClock(wall(2026, 3, 8, 2, min), loc, dstPolicyPickFirst)
+		local := got.In(loc)
+		if local.Hour() != 3 || local.Minute() != min {
+			t.Errorf("02:%02d resolved to %s, want 03:%02d", min, local.Format("15:04"), min)
+		}
+	}
+}
+
+func TestResolveLocalTimes_SkipDropsAndReports(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+	times := []time.Time{
+		wall(2026, 3, 7, 2, 30),
+		wall(2026, 3, 8, 2, 30),
+		wall(2026, 3, 9, 2, 30),
+	}
+
+	got, adjustments := resolveLocalTimes(times, loc, dstPolicySkip)
+	if len(got) != 2 {
+		t.Fatalf("got %d times, want 2", len(got))
+	}
+	if len(adjustments) != 1 || !adjustments[0].Skipped {
+		t.Fatalf("adjustments = %+v, want one skip", adjustments)
+	}
+	if !adjustments[0].Local.Equal(times[1]) {
+		t.Errorf("adjustment Local = %v, want %v", adjustments[0].Local, times[1])
+	}
+}
+
+func TestConvertToUTC_DSTSpringForwardGapMovesForward(t *testing.T) {
+	// time.Date reads 02:30 on spring-forward day as 01:30 EST in New York;
+	// the default policy moves it forward to 03:30 EDT instead
+	loc := mustLoadLocation(t, "America/New_York")
+	got := convertToUTC([]time.Time{wall(2026, 3, 8, 2, 30)}, loc)
+	if len(got) != 1 || got[0].In(loc).Format("15:04") != "03:30" {
+		t.Errorf("convertToUTC() = %v, want 03:30 EDT", got)
+	}
+}
+
+func TestGenerateOccurrences_DSTPolicies(t *testing.T) {
+	tz := "America/New_York"
+	loc := mustLoadLocation(t, tz)
+	until := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		dtstart time.Time
+		policy  string
+		count   int
+		check   func(t *testing.T, occurrences []time.Time)
+	}{
+		{
+			name:    "daily 2:30 AM across spring forward, skip",
+			dtstart: wall(2026, 3, 7, 2, 30),
+			policy:  dstPolicySkip,
+			count:   2,
+			check: func(t *testing.T, occurrences []time.Time) {
+				for _, occ := range occurrences {
+					if occ.In(loc).Day() == 8 {
+						t.Errorf("March 8 occurrence should be skipped, got %v", occ.In(loc))
+					}
+				}
+			},
+		},
+		{
+			name:    "daily 2:30 AM across spring forward, default",
+			dtstart: wall(2026, 3, 7, 2, 30),
+			policy:  "",
+			count:   3,
+			check: func(t *testing.T, occurrences []time.Time) {
+				if got := occurrences[1].In(loc).Format("01-02 15:04"); got != "03-08 03:30" {
+					t.Errorf("March 8 occurrence = %s, want 03-08 03:30", got)
+				}
+			},
+		},
+		{
+			name:    "daily 1:30 AM across fall back, shift_forward",
+			dtstart: wall(2026, 10, 31, 1, 30),
+			policy:  dstPolicyShiftForward,
+			count:   3,
+			check: func(t *testing.T, occurrences []time.Time) {
+				if got := occurrences[1].In(loc).Format("01-02 15:04 MST"); got != "11-01 01:30 EST" {
+					t.Errorf("November 1 occurrence = %s, want the second 01:30 (EST)", got)
+				}
+				if gap := occurrences[1].Sub(occurrences[0]); gap != 25*time.Hour {
+					t.Errorf("gap across fall back = %v, want 25h", gap)
+				}
+			},
+		},
+		{
+			name:    "daily 1:30 AM across fall back, pick_first",
+			dtstart: wall(2026, 10, 31, 1, 30),
+			policy:  dstPolicyPickFirst,
+			count:   3,
+			check: func(t *testing.T, occurrences []time.Time) {
+				if got := occurrences[1].In(loc).Format("01-02 15:04 MST"); got != "11-01 01:30 EDT" {
+					t.Errorf("November 1 occurrence = %s, want the first 01:30 (EDT)", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &ExpandRecurringSeriesWorker{}
+			series := &SeriesRecord{
+				ID:        1,
+				RRULE:     "FREQ=DAILY;COUNT=3",
+				Dtstart:   tt.dtstart,
+				Timezone:  &tz,
+				DSTPolicy: tt.policy,
+			}
+			occurrences, err := w.generateOccurrences(series, until)
+			if err != nil {
+				t.Fatalf("generateOccurrences failed: %v", err)
+			}
+			if len(occurrences) != tt.count {
+				t.Fatalf("got %d occurrences, want %d: %v", len(occurrences), tt.count, occurrences)
+			}
+			tt.check(t, occurrences)
+		})
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ============================================================================
+// Settings
+//
+// Every setting is read through the getEnv helpers below, which record the
+// key, its type, its default and the value in effect. A value that doesn't
+// parse (a word where a number belongs, a URL without a host, a port out of
+// range, an unknown timezone) or a required setting left unset is recorded
+// as an error, and
+// validateSettings() reports them all at once so startup fails with the full
+// list instead of running on a silently substituted default.
+//
+// Settings read after validation (SIGHUP reloads, secret rotation, clients
+// built later in startup) keep the old behavior: a warning is logged and
+// the default is used, so a bad reload never stops a running worker.
+//
+// The consolidated and payment workers are separate modules that share no
+// Go code, so each keeps a copy of this file. The copies are identical below
+// the package clause, and TestSettingsFileMatchesOtherService fails when one
+// is changed without the other.
+// ============================================================================
+
+// setting is one environment variable as last read
+type setting struct {
+	Key     string
+	Kind    string // string, int, bool, float, url, port, timezone or cidrs
+	Default string
+	Value   string // the value in effect: the default when unset or invalid
+	FromEnv bool
+	Err     error
+}
+
+// settingsRegistry holds every setting read, by key
+type settingsRegistry struct {
+	mu        sync.Mutex
+	byKey     map[string]*setting
+	validated bool
+}
+
+var settings = newSettingsRegistry()
+
+func newSettingsRegistry() *settingsRegistry {
+	return &settingsRegistry{byKey: make(map[string]*setting)}
+}
+
+// record stores a read of s.Key, replacing any earlier one
+func (r *settingsRegistry) record(s setting) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byKey[s.Key] = &s
+	if s.Err != nil && r.validated {
+		log.Printf("⚠️  WARNING: %v, using default: %s", s.Err, maskSettingValue(s.Key, s.Default))
+	}
+}
+
+// readSetting returns key's value, or defaultValue when it is unset or check
+// rejects it. check may be nil for free-form strings.
+func readSetting(key, kind, defaultValue string, check func(string) error) string {
+	s := setting{Key: key, Kind: kind, Default: defaultValue, Value: defaultValue}
+	if raw := os.Getenv(key); raw != "" {
+		if check != nil {
+			if err := check(raw); err != nil {
+				s.Err = fmt.Errorf("%s=%q: %w", key, maskSettingValue(key, raw), err)
+			}
+		}
+		if s.Err == nil {
+			s.Value, s.FromEnv = raw, true
+		}
+	}
+	settings.record(s)
+	return s.Value
+}
+
+// getEnv retrieves environment variable or returns default value
+func getEnv(key, defaultValue string) string {
+	return readSetting(key, "string", defaultValue, nil)
+}
+
+// requireEnv retrieves an environment variable that must be set; reason
+// completes "KEY is required when ..." in the startup error
+func requireEnv(key, reason string) string {
+	value := os.Getenv(key)
+	s := setting{Key: key, Kind: "string", Value: value, FromEnv: value != ""}
+	if value == "" {
+		s.Err = fmt.Errorf("%s is required when %s", key, reason)
+	}
+	settings.record(s)
+	return value
+}
+
+// getEnvInt retrieves environment variable as integer with fallback to default value
+func getEnvInt(key string, defaultValue int) int {
+	value := defaultValue
+	readSetting(key, "int", strconv.Itoa(defaultValue), func(raw string) error {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		value = v
+		return nil
+	})
+	return value
+}
+
+// getEnvBool retrieves environment variable as boolean with fallback to default value
+func getEnvBool(key string, defaultValue bool) bool {
+	value := defaultValue
+	readSetting(key, "bool", strconv.FormatBool(defaultValue), func(raw string) error {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("not a boolean (true or false)")
+		}
+		value = v
+		return nil
+	})
+	return value
+}
+
+// getEnvFloat retrieves environment variable as float64 with fallback to default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := defaultValue
+	readSetting(key, "float", strconv.FormatFloat(defaultValue, 'g', -1, 64), func(raw string) error {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		value = v
+		return nil
+	})
+	return value
+}
+
+// getEnvURL retrieves an absolute URL (scheme://host...); empty is allowed
+// when the default is empty
+func getEnvURL(key, defaultValue string) string {
+	return readSetting(key, "url", defaultValue, func(raw string) error {
+		if u, err := url.Parse(raw); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("not an absolute URL (scheme://host)")
+		}
+		return nil
+	})
+}
+
+// getEnvPort retrieves a TCP port number (1-65535)
+func getEnvPort(key, defaultValue string) string {
+	return readSetting(key, "port", defaultValue, func(raw string) error {
+		if n, err := strconv.Atoi(raw); err != nil || n < 1 || n > 65535 {
+			return errors.New("not a port number (1-65535)")
+		}
+		return nil
+	})
+}
+
+// getEnvListenPort retrieves the port of one of the worker's own optional
+// listeners: a port number as for getEnvPort, or 0 to turn the listener off
+func getEnvListenPort(key, defaultValue string) string {
+	return readSetting(key, "port", defaultValue, func(raw string) error {
+		if raw == "0" {
+			return nil
+		}
+		if n, err := strconv.Atoi(raw); err != nil || n < 1 || n > 65535 {
+			return errors.New("not a port number (1-65535), or 0 to turn the listener off")
+		}
+		return nil
+	})
+}
+
+// getEnvLocation retrieves an IANA timezone name and loads it. UTC is
+// returned with the error recorded when even the default can't be loaded.
+func getEnvLocation(key, defaultValue string) *time.Location {
+	name := readSetting(key, "timezone", defaultValue, func(raw string) error {
+		if _, err := time.LoadLocation(raw); err != nil {
+			return errors.New("not a known timezone (e.g. America/New_York)")
+		}
+		return nil
+	})
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		settings.record(setting{Key: key, Kind: "timezone", Default: defaultValue, Value: name,
+			Err: fmt.Errorf("%s: default timezone %q: %w", key, name, err)})
+		return time.UTC
+	}
+	return loc
+}
+
+// getEnvPrefixes retrieves a comma-separated list of IP addresses and CIDR
+// ranges (see parsePrefixes); empty means none
+func getEnvPrefixes(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	readSetting(key, "cidrs", "", func(raw string) error {
+		p, err := parsePrefixes(raw)
+		if err != nil {
+			return errors.New("not a list of IP addresses or CIDR ranges (e.g. 10.0.0.0/8, 3.18.12.63)")
+		}
+		prefixes = p
+		return nil
+	})
+	return prefixes
+}
+
+// parsePrefixes parses a comma-separated list of IP addresses and CIDR
+// ranges ("3.18.12.63, 10.0.0.0/8"); a bare address is a single host
+func parsePrefixes(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			p, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// parseKeyValueList parses "k1=v1,k2=v2" with URL-encoded values (the
+// format of the OTEL_* list variables)
+func parseKeyValueList(s string) map[string]string {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = decoded
+		}
+		out[key] = value
+	}
+	return out
+}
+
+// validateSettings returns every invalid or missing setting read so far,
+// one per line. Later invalid reads are logged and fall back to defaults.
+func validateSettings() error {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.validated = true
+
+	var errs []error
+	for _, key := range settings.sortedKeys() {
+		if err := settings.byKey[key].Err; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logSettings prints the effective configuration as a table sorted by key,
+// with secrets masked
+func logSettings() {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, key := range settings.sortedKeys() {
+		s := settings.byKey[key]
+		source := "default"
+		if s.FromEnv {
+			source = "env"
+		}
+		value := maskSettingValue(key, s.Value)
+		if value == "" {
+			value = "(empty)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key, value, source)
+	}
+	w.Flush()
+
+	log.Printf("[Init] Effective configuration (%d settings):", len(settings.byKey))
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		log.Printf("[Init]   %s", line)
+	}
+}
+
+// sortedKeys returns the recorded keys in order; callers hold r.mu
+func (r *settingsRegistry) sortedKeys() []string {
+	keys := make([]string, 0, len(r.byKey))
+	for key := range r.byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// secretSettingSuffixes mark keys whose values are never printed
+var secretSettingSuffixes = []string{
+	"_PASSWORD", "_SECRET", "_TOKEN", "_API_KEY", "_PRIVATE_KEY",
+	"_SIGNING_KEY", "_SIGNATURE_KEY", "_SECRET_ACCESS_KEY", "_HEADERS",
+}
+
+// isSecretSetting reports whether key names a credential
+func isSecretSetting(key string) bool {
+	for _, suffix := range secretSettingSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskSettingValue hides secrets entirely and passwords inside URLs
+func maskSettingValue(key, value string) string {
+	switch {
+	case value == "":
+		return ""
+	case isSecretSetting(key):
+		return "****"
+	case strings.HasSuffix(key, "DATABASE_URL") || strings.Contains(value, "://"):
+		return maskPassword(value)
+	}
+	return value
+}
+
+// maskPassword masks the password in a database URL for logging. Values
+// that aren't URLs, such as key=value connection strings, are hidden whole.
+func maskPassword(dbURL string) string {
+	parsedURL, err := url.Parse(dbURL)
+	if err != nil || parsedURL.Scheme == "" {
+		return "[unparsed, hidden]"
+	}
+
+	// If there's no user info, return as-is (no password to mask)
+	if parsedURL.User == nil {
+		return dbURL
+	}
+	if _, hasPassword := parsedURL.User.Password(); !hasPassword {
+		return dbURL
+	}
+
+	// Reconstruct the URL by hand so the asterisks aren't URL-encoded
+	result := parsedURL.Scheme + "://" + parsedURL.User.Username() + ":****@" + parsedURL.Host + parsedURL.Path
+	if parsedURL.RawQuery != "" {
+		result += "?" + parsedURL.RawQuery
+	}
+	if parsedURL.Fragment != "" {
+		result += "#" + parsedURL.Fragment
+	}
+	return result
+}
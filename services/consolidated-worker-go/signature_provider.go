@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ============================================================================
+// E-Signature Providers
+//
+// SignatureProvider abstracts the signing service behind the signature_send
+// and signature_complete jobs. SIGNATURE_PROVIDER selects the implementation:
+//   - docusign: DocuSign eSignature REST API (docusign_client.go)
+//   - fake:     in-memory, completes immediately (development only)
+// ============================================================================
+
+// Envelope states reported by providers, normalized across implementations
+const (
+	EnvelopeSent      = "sent"      // Waiting on the signer (includes "delivered"/"viewed")
+	EnvelopeCompleted = "completed" // Signed; the signed document can be downloaded
+	EnvelopeDeclined  = "declined"  // Signer declined to sign
+	EnvelopeVoided    = "voided"    // Cancelled at the provider
+)
+
+// SignatureDocument is one PDF to be signed by one signer
+type SignatureDocument struct {
+	RequestID    string // metadata.signature_requests.id, for provider-side correlation
+	FileName     string
+	PDF          []byte
+	SignerEmail  string
+	SignerName   string
+	EmailSubject string
+}
+
+// SignatureProvider sends documents for signature and reports their progress
+type SignatureProvider interface {
+	// Name identifies the provider in metadata.signature_requests.provider
+	Name() string
+	// Send creates and sends an envelope, returning the provider's envelope ID
+	Send(ctx context.Context, doc SignatureDocument) (string, error)
+	// Status returns one of the Envelope* states
+	Status(ctx context.Context, envelopeID string) (string, error)
+	// DownloadSigned returns the signed PDF of a completed envelope
+	DownloadSigned(ctx context.Context, envelopeID string) ([]byte, error)
+}
+
+// NewSignatureProvider builds the provider named by SIGNATURE_PROVIDER.
+// Returns nil when name is empty (signing disabled).
+func NewSignatureProvider(name string, docusign DocuSignConfig) (SignatureProvider, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "docusign":
+		return NewDocuSignClient(docusign)
+	case "fake":
+		return NewFakeSignatureProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown SIGNATURE_PROVIDER %q (expected docusign or fake)", name)
+	}
+}
+
+// ============================================================================
+// Fake Provider (development)
+// ============================================================================
+
+// FakeSignatureProvider "signs" documents instantly by returning them
+// unchanged. Envelopes live in memory, so a worker restart between send and
+// completion leaves the request to fail on download.
+type FakeSignatureProvider struct {
+	mu        sync.Mutex
+	next      int
+	envelopes map[string][]byte
+}
+
+// NewFakeSignatureProvider creates an empty fake provider
+func NewFakeSignatureProvider() *FakeSignatureProvider {
+	return &FakeSignatureProvider{envelopes: make(map[string][]byte)}
+}
+
+func (f *FakeSignatureProvider) Name() string { return "fake" }
+
+func (f *FakeSignatureProvider) Send(ctx context.Context, doc SignatureDocument) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	envelopeID := fmt.Sprintf("fake-%d", f.next)
+	f.envelopes[envelopeID] = doc.PDF
+	log.Printf("[Signature] FAKE MODE: envelope %s for %s <%s> (%s, %d bytes)",
+		envelopeID, doc.SignerName, doc.SignerEmail, doc.FileName, len(doc.PDF))
+	return envelopeID, nil
+}
+
+func (f *FakeSignatureProvider) Status(ctx context.Context, envelopeID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.envelopes[envelopeID]; !ok {
+		return "", fmt.Errorf("unknown fake envelope %s", envelopeID)
+	}
+	return EnvelopeCompleted, nil
+}
+
+func (f *FakeSignatureProvider) DownloadSigned(ctx context.Context, envelopeID string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pdf, ok := f.envelopes[envelopeID]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake envelope %s", envelopeID)
+	}
+	return pdf, nil
+}
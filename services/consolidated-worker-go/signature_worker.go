@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Document Signing Workers
+//
+// metadata.signature_requests rows move through:
+//   pending   → signature_send job sends the PDF to the provider      → sent
+//   sent      → SignaturePollTask or a signature_webhook job sees the
+//               envelope completed                                   → signed
+//   signed    → signature_complete job stores the signed PDF as a new
+//               file version and advances the entity status          → completed
+//   sent      → poll sees declined/voided (status advanced if set)     → declined/voided
+//
+// Final states and entity status changes go through
+// metadata.apply_signature_outcome() so the SQL owns the workflow rules.
+// ============================================================================
+
+// ============================================================================
+// Job Definition: Send for Signature
+// ============================================================================
+
+// SignatureSendArgs is inserted by the metadata.signature_requests trigger
+type SignatureSendArgs struct {
+	RequestID string `json:"request_id"`
+}
+
+func (SignatureSendArgs) Kind() string { return "signature_send" }
+
+func (SignatureSendArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "signatures",
+		MaxAttempts: 5,
+		Priority:    1,
+	}
+}
+
+// SignatureSendWorker uploads the source PDF to the signing provider
+type SignatureSendWorker struct {
+	river.WorkerDefaults[SignatureSendArgs]
+	dbPool    *pgxpool.Pool
+	provider  SignatureProvider
+	originals *OriginalStore
+}
+
+func (w *SignatureSendWorker) Work(ctx context.Context, job *river.Job[SignatureSendArgs]) error {
+	log.Printf("[Job %d] Sending signature request %s (attempt %d/%d)", job.ID, job.Args.RequestID, job.Attempt, job.MaxAttempts)
+
+	var status, signerEmail, signerName, bucket, key, fileName string
+	var emailSubject *string
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT r.status, r.signer_email, r.signer_name, r.email_subject,
+		       f.s3_bucket, f.s3_original_key, f.file_name
+		FROM metadata.signature_requests r
+		JOIN metadata.files f ON f.id = r.source_file_id
+		WHERE r.id = $1
+	`, job.Args.RequestID).Scan(&status, &signerEmail, &signerName, &emailSubject, &bucket, &key, &fileName)
+	if err != nil {
+		return fmt.Errorf("failed to load signature request: %w", err)
+	}
+
+	// A retry after a successful send must not create a second envelope
+	if status != "pending" {
+		log.Printf("[Job %d] ✓ Request already %s, skipping", job.ID, status)
+		return nil
+	}
+
+	pdf, _, err := w.originals.Fetch(ctx, bucket, key)
+	if err != nil {
+		return w.failOnLastAttempt(ctx, job, fmt.Errorf("failed to download document: %w", err))
+	}
+
+	envelopeID, err := w.provider.Send(ctx, SignatureDocument{
+		RequestID:    job.Args.RequestID,
+		FileName:     fileName,
+		PDF:          pdf,
+		SignerEmail:  signerEmail,
+		SignerName:   signerName,
+		EmailSubject: derefString(emailSubject),
+	})
+	if err != nil {
+		return w.failOnLastAttempt(ctx, job, fmt.Errorf("failed to send envelope: %w", err))
+	}
+
+	_, err = w.dbPool.Exec(ctx, `
+		UPDATE metadata.signature_requests
+		SET status = 'sent', provider = $2, envelope_id = $3, sent_at = NOW(), error_message = NULL
+		WHERE id = $1 AND status = 'pending'
+	`, job.Args.RequestID, w.provider.Name(), envelopeID)
+	if err != nil {
+		// The envelope exists at the provider; log its ID so it can be reconciled
+		log.Printf("[Job %d] Envelope %s sent but not recorded: %v", job.ID, envelopeID, err)
+		return fmt.Errorf("failed to record envelope: %w", err)
+	}
+
+	log.Printf("[Job %d] ✓ Envelope %s sent to %s", job.ID, envelopeID, signerEmail)
+	return nil
+}
+
+// failOnLastAttempt marks the request failed once River will stop retrying
+func (w *SignatureSendWorker) failOnLastAttempt(ctx context.Context, job *river.Job[SignatureSendArgs], err error) error {
+	if job.Attempt >= job.MaxAttempts {
+		if _, dbErr := w.dbPool.Exec(ctx, "SELECT metadata.apply_signature_outcome($1, 'failed', NULL, $2)",
+			job.Args.RequestID, err.Error()); dbErr != nil {
+			log.Printf("[Job %d] Failed to mark request failed: %v", job.ID, dbErr)
+		}
+	}
+	return err
+}
+
+// ============================================================================
+// Job Definition: Store Signed Document
+// ============================================================================
+
+// SignatureCompleteArgs is inserted by SignaturePollTask when an envelope completes
+type SignatureCompleteArgs struct {
+	RequestID string `json:"request_id"`
+}
+
+func (SignatureCompleteArgs) Kind() string { return "signature_complete" }
+
+func (SignatureCompleteArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "signatures",
+		MaxAttempts: 10,
+		Priority:    1,
+	}
+}
+
+// SignatureCompleteWorker downloads the signed PDF and stores it as a new
+// version of the source file
+type SignatureCompleteWorker struct {
+	river.WorkerDefaults[SignatureCompleteArgs]
+	dbPool   *pgxpool.Pool
+	s3Client *s3.Client
+	provider SignatureProvider
+}
+
+func (w *SignatureCompleteWorker) Work(ctx context.Context, job *river.Job[SignatureCompleteArgs]) error {
+	log.Printf("[Job %d] Storing signed document for request %s (attempt %d/%d)", job.ID, job.Args.RequestID, job.Attempt, job.MaxAttempts)
+
+	var status, entityType, entityID, envelopeID, bucket, fileName, sourceFileID string
+	var requestedBy *string
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT r.status, r.entity_type, r.entity_id, r.envelope_id, r.requested_by::text,
+		       f.id::text, f.s3_bucket, f.file_name
+		FROM metadata.signature_requests r
+		JOIN metadata.files f ON f.id = r.source_file_id
+		WHERE r.id = $1
+	`, job.Args.RequestID).Scan(&status, &entityType, &entityID, &envelopeID, &requestedBy, &sourceFileID, &bucket, &fileName)
+	if err != nil {
+		return fmt.Errorf("failed to load signature request: %w", err)
+	}
+
+	if status != "signed" {
+		log.Printf("[Job %d] ✓ Request already %s, skipping", job.ID, status)
+		return nil
+	}
+
+	pdf, err := w.provider.DownloadSigned(ctx, envelopeID)
+	if err != nil {
+		return fmt.Errorf("failed to download signed document: %w", err)
+	}
+
+	// Reserve the file ID first: it is part of the S3 key
+	var fileID string
+	if err := w.dbPool.QueryRow(ctx, "SELECT uuid_generate_v7()::text").Scan(&fileID); err != nil {
+		return fmt.Errorf("failed to generate file ID: %w", err)
+	}
+	s3Key := fmt.Sprintf("%s/%s/%s/original.pdf", entityType, entityID, fileID)
+
+	_, err = w.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(s3Key),
+		Body:        bytes.NewReader(pdf),
+		ContentType: aws.String("application/pdf"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload signed document: %w", err)
+	}
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// thumbnail_status defaults to 'pending', so the insert trigger queues
+	// thumbnail generation like any upload
+	_, err = tx.Exec(ctx, `
+		INSERT INTO metadata.files (
+			id, entity_type, entity_id, file_name, file_type, file_size,
+			s3_bucket, s3_original_key, created_by, previous_version_id
+		) VALUES ($1, $2, $3, $4, 'application/pdf', $5, $6, $7, $8, $9)
+	`, fileID, entityType, entityID, signedFileName(fileName), len(pdf), bucket, s3Key, requestedBy, sourceFileID)
+	if err != nil {
+		return fmt.Errorf("failed to insert signed file: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, "SELECT metadata.apply_signature_outcome($1, 'completed', $2)", job.Args.RequestID, fileID); err != nil {
+		return fmt.Errorf("failed to complete signature request: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+
+	log.Printf("[Job %d] ✓ Signed document stored as file %s (%d bytes)", job.ID, fileID, len(pdf))
+	return nil
+}
+
+// signedFileName derives the display name of the signed copy,
+// e.g. "Permit Application.pdf" → "Permit Application (signed).pdf"
+func signedFileName(original string) string {
+	base := strings.TrimSuffix(original, filepath.Ext(original))
+	if base == "" {
+		base = "document"
+	}
+	return base + " (signed).pdf"
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// ============================================================================
+// Signature Poll Maintenance Task
+//
+// Checks open envelopes with the provider. With DocuSign Connect webhooks
+// (DOCUSIGN_CONNECT_HMAC_KEYS) most envelopes are settled before the poll
+// gets to them; the poll still catches notifications that never arrived.
+// Signing takes hours or days, so a few minutes of latency is fine.
+// Scheduled by MaintenanceScheduler (task "signature_poll").
+// ============================================================================
+
+// signaturePollBatchSize caps provider API calls per run; the least recently
+// checked envelopes go first so every envelope is eventually checked
+const signaturePollBatchSize = 50
+
+// SignaturePollTask polls the provider for envelopes in the 'sent' state
+type SignaturePollTask struct {
+	dbPool   *pgxpool.Pool
+	jobs     *JobEnqueuer
+	provider SignatureProvider
+	interval time.Duration // default schedule (SIGNATURE_POLL_INTERVAL_MINUTES)
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (s *SignaturePollTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "signature_poll",
+		Description: fmt.Sprintf("Check open %s envelopes and record signed, declined or voided requests", s.provider.Name()),
+		Interval:    s.interval,
+		Jitter:      30 * time.Second,
+		Run:         s.poll,
+	}
+}
+
+// poll checks one batch of open envelopes and records state changes
+func (s *SignaturePollTask) poll(ctx context.Context) (string, error) {
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT id::text, envelope_id
+		FROM metadata.signature_requests
+		WHERE status = 'sent' AND provider = $1
+		ORDER BY last_checked_at NULLS FIRST
+		LIMIT $2
+	`, s.provider.Name(), signaturePollBatchSize)
+	if err != nil {
+		return "", fmt.Errorf("querying open requests: %w", err)
+	}
+	type openRequest struct{ id, envelopeID string }
+	requests, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (openRequest, error) {
+		var r openRequest
+		err := row.Scan(&r.id, &r.envelopeID)
+		return r, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("reading open requests: %w", err)
+	}
+
+	changed := 0
+	for _, r := range requests {
+		state, err := s.provider.Status(ctx, r.envelopeID)
+		if err != nil {
+			log.Printf("[SignaturePoll] Error checking envelope %s: %v", r.envelopeID, err)
+			state = EnvelopeSent // retry on a later run
+		}
+		if err := s.record(ctx, r.id, state); err != nil {
+			log.Printf("[SignaturePoll] Error recording %s for request %s: %v", state, r.id, err)
+			continue
+		}
+		if state != EnvelopeSent {
+			changed++
+			log.Printf("[SignaturePoll] ✓ Request %s envelope %s", r.id, state)
+		}
+	}
+	return fmt.Sprintf("Checked %d envelopes, %d changed", len(requests), changed), nil
+}
+
+// record applies one envelope state to its request
+func (s *SignaturePollTask) record(ctx context.Context, requestID, state string) error {
+	return applyEnvelopeState(ctx, s.dbPool, s.jobs, requestID, state)
+}
+
+// applyEnvelopeState records an envelope state reported by the poll or a
+// provider webhook for a request in the 'sent' state
+func applyEnvelopeState(ctx context.Context, dbPool *pgxpool.Pool, jobs *JobEnqueuer, requestID, state string) error {
+	switch state {
+	case EnvelopeSent:
+		_, err := dbPool.Exec(ctx,
+			"UPDATE metadata.signature_requests SET last_checked_at = NOW() WHERE id = $1", requestID)
+		return err
+
+	case EnvelopeCompleted:
+		// Move to 'signed' and queue the download in one transaction so a
+		// request is never stuck in 'signed' without a job
+		tx, err := dbPool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		tag, err := tx.Exec(ctx, `
+			UPDATE metadata.signature_requests
+			SET status = 'signed', last_checked_at = NOW()
+			WHERE id = $1 AND status = 'sent'
+		`, requestID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return nil
+		}
+		if _, err := jobs.InsertTx(ctx, tx, SignatureCompleteArgs{RequestID: requestID}, nil); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+
+	case EnvelopeDeclined, EnvelopeVoided:
+		_, err := dbPool.Exec(ctx, "SELECT metadata.apply_signature_outcome($1, $2)", requestID, state)
+		return err
+
+	default:
+		return fmt.Errorf("unknown envelope state %q", state)
+	}
+}
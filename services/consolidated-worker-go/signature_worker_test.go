@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSignedFileName(t *testing.T) {
+	tests := []struct {
+		original string
+		want     string
+	}{
+		{"Permit Application.pdf", "Permit Application (signed).pdf"},
+		{"lease.PDF", "lease (signed).pdf"},
+		{"no-extension", "no-extension (signed).pdf"},
+		{".pdf", "document (signed).pdf"},
+	}
+
+	for _, tt := range tests {
+		if got := signedFileName(tt.original); got != tt.want {
+			t.Errorf("signedFileName(%q) = %q, want %q", tt.original, got, tt.want)
+		}
+	}
+}
+
+func TestFakeSignatureProvider(t *testing.T) {
+	ctx := context.Background()
+	provider := NewFakeSignatureProvider()
+
+	envelopeID, err := provider.Send(ctx, SignatureDocument{FileName: "a.pdf", PDF: []byte("%PDF-1.7")})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if state, err := provider.Status(ctx, envelopeID); err != nil || state != EnvelopeCompleted {
+		t.Errorf("Status() = %q, %v; want completed", state, err)
+	}
+	if pdf, err := provider.DownloadSigned(ctx, envelopeID); err != nil || string(pdf) != "%PDF-1.7" {
+		t.Errorf("DownloadSigned() = %q, %v; want original bytes", pdf, err)
+	}
+	if _, err := provider.Status(ctx, "fake-unknown"); err == nil {
+		t.Error("Status() of unknown envelope: want error")
+	}
+}
+
+func TestNewSignatureProvider(t *testing.T) {
+	if provider, err := NewSignatureProvider("", DocuSignConfig{}); provider != nil || err != nil {
+		t.Errorf("NewSignatureProvider(\"\") = %v, %v; want disabled", provider, err)
+	}
+	if provider, err := NewSignatureProvider("fake", DocuSignConfig{}); err != nil || provider.Name() != "fake" {
+		t.Errorf("NewSignatureProvider(fake) = %v, %v", provider, err)
+	}
+	if _, err := NewSignatureProvider("adobe", DocuSignConfig{}); err == nil {
+		t.Error("NewSignatureProvider(adobe): want error")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// ============================================================================
+// SMS Segment Counting
+//
+// Carriers bill SMS per segment. A message that only uses the GSM 03.38
+// alphabet is sent as GSM-7: 160 characters in one segment, 153 per segment
+// once it's split (the rest of each segment is the concatenation header).
+// Characters from the GSM extension table ({ } [ ] ~ \ | ^ €) take two
+// septets. Any other character (curly quotes, accents outside the alphabet,
+// emoji) switches the whole message to UCS-2: 70 UTF-16 code units in one
+// segment, 67 per segment when split, with emoji taking two units.
+//
+// A split never cuts an escape sequence or surrogate pair in half, so a
+// segment can carry one unit less than the limit.
+// ============================================================================
+
+// Encodings reported in metadata.template_part_validation_results.sms_encoding
+const (
+	smsEncodingGSM7 = "GSM-7"
+	smsEncodingUCS2 = "UCS-2"
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet (one septet each)
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension is the GSM 03.38 extension table (escape + septet each)
+const gsm7Extension = "\f^{}\\[~]|€"
+
+// SMSSegments describes how a rendered SMS will be sent
+type SMSSegments struct {
+	Encoding string // smsEncodingGSM7 or smsEncodingUCS2
+	Length   int    // septets (GSM-7) or UTF-16 code units (UCS-2)
+	Segments int
+}
+
+// countSMSSegments returns the encoding, length and segment count of an SMS
+// body. An empty body is zero segments.
+func countSMSSegments(body string) SMSSegments {
+	widths, gsm := smsCharWidths(body)
+
+	result := SMSSegments{Encoding: smsEncodingGSM7}
+	single, multi := 160, 153
+	if !gsm {
+		result.Encoding = smsEncodingUCS2
+		single, multi = 70, 67
+	}
+	for _, w := range widths {
+		result.Length += w
+	}
+
+	switch {
+	case result.Length == 0:
+		return result
+	case result.Length <= single:
+		result.Segments = 1
+		return result
+	}
+
+	used := 0
+	result.Segments = 1
+	for _, w := range widths {
+		if used+w > multi {
+			result.Segments++
+			used = 0
+		}
+		used += w
+	}
+	return result
+}
+
+// smsCharWidths returns each character's width in the message's encoding and
+// whether the whole message fits GSM-7
+func smsCharWidths(body string) ([]int, bool) {
+	widths := make([]int, 0, len(body))
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			widths = append(widths, 1)
+		case strings.ContainsRune(gsm7Extension, r):
+			widths = append(widths, 2)
+		default:
+			return ucs2Widths(body), false
+		}
+	}
+	return widths, true
+}
+
+// ucs2Widths returns each character's width in UTF-16 code units
+func ucs2Widths(body string) []int {
+	widths := make([]int, 0, len(body))
+	for _, r := range body {
+		widths = append(widths, max(utf16.RuneLen(r), 1))
+	}
+	return widths
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountSMSSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		length   int
+		segments int
+	}{
+		{"empty", "", smsEncodingGSM7, 0, 0},
+		{"short GSM-7", "New issue: Pothole on Main St", smsEncodingGSM7, 29, 1},
+		{"GSM-7 at the single limit", strings.Repeat("a", 160), smsEncodingGSM7, 160, 1},
+		{"GSM-7 one over", strings.Repeat("a", 161), smsEncodingGSM7, 161, 2},
+		{"GSM-7 three full parts", strings.Repeat("a", 459), smsEncodingGSM7, 459, 3},
+		{"extension chars take two septets", strings.Repeat("€", 80), smsEncodingGSM7, 160, 1},
+		// 152 septets then an escape pair: the pair moves to the next part
+		{"escape pair isn't split", strings.Repeat("a", 152) + "{" + strings.Repeat("a", 10), smsEncodingGSM7, 164, 2},
+		{"accented letters in the alphabet", "Café à Zürich", smsEncodingGSM7, 13, 1},
+		{"curly quote switches to UCS-2", "It’s ready", smsEncodingUCS2, 10, 1},
+		{"UCS-2 at the single limit", strings.Repeat("ł", 70), smsEncodingUCS2, 70, 1},
+		{"UCS-2 one over", strings.Repeat("ł", 71), smsEncodingUCS2, 71, 2},
+		{"emoji take two units", strings.Repeat("🎉", 35), smsEncodingUCS2, 70, 1},
+		// 66 units then a surrogate pair: the pair moves to the next part
+		{"surrogate pair isn't split", strings.Repeat("ł", 66) + "🎉" + strings.Repeat("ł", 10), smsEncodingUCS2, 78, 2},
+		{"one em dash makes a reminder UCS-2", strings.Repeat("Reminder: your permit expires soon. ", 5) + "—", smsEncodingUCS2, 181, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := countSMSSegments(tt.body)
+			if got.Encoding != tt.encoding || got.Length != tt.length || got.Segments != tt.segments {
+				t.Errorf("countSMSSegments() = %+v, want {%s %d %d}", got, tt.encoding, tt.length, tt.segments)
+			}
+		})
+	}
+}
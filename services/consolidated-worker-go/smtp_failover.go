@@ -0,0 +1,197 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// SMTP Delivery and Failover
+//
+// Every email goes through SMTPConfig.send. With SMTP_SECONDARY_HOST set, a
+// message the primary server fails to take is sent through the secondary
+// straight away, unless the failure was about a recipient (a 5xx reply to
+// RCPT TO), which the secondary would refuse too. After
+// SMTP_FAILOVER_THRESHOLD such failures in a row the primary is treated as
+// down: messages go to the secondary first for SMTP_FAILOVER_COOLDOWN_SECONDS,
+// then the primary is tried again. The server that accepted each message is
+// recorded in notification_log.email_provider (send_notification), in the
+// archive, and in the job output (send_email).
+//
+// Transactional providers with an HTTP API (SES, SendGrid, Postmark,
+// Mailgun) all offer SMTP endpoints, which is how they are configured here.
+// ============================================================================
+
+// smtpFailover tracks the primary server's consecutive failures
+type smtpFailover struct {
+	mu        sync.Mutex
+	failures  int
+	downUntil time.Time
+}
+
+// smtpRecipientError is a rejected RCPT TO. A 5xx reply is about the
+// address, not the server, so it doesn't cause a failover.
+type smtpRecipientError struct {
+	Recipient string
+	Err       error
+}
+
+func (e *smtpRecipientError) Error() string {
+	return fmt.Sprintf("RCPT TO failed for %s: %v", e.Recipient, e.Err)
+}
+
+func (e *smtpRecipientError) Unwrap() error { return e.Err }
+
+// smtpServerFailure reports whether err says the server, not the message's
+// recipients, is the problem: connection, TLS, authentication and MAIL/DATA
+// errors, and 4xx replies to RCPT TO
+func smtpServerFailure(err error) bool {
+	if err == nil || errors.Is(err, errEmailSuppressed) {
+		return false
+	}
+	var rcptErr *smtpRecipientError
+	if !errors.As(err, &rcptErr) {
+		return true
+	}
+	var tpErr *textproto.Error
+	return errors.As(rcptErr.Err, &tpErr) && tpErr.Code < 500
+}
+
+// send delivers message to recipients through the primary server, or the
+// secondary when the primary is down or fails. Returns the host of the
+// server that accepted it.
+func (c *SMTPConfig) send(ctx context.Context, envelopeFrom string, recipients []string, message []byte) (string, error) {
+	servers := []*SMTPConfig{c}
+	if c.Secondary != nil {
+		if c.primaryDown() {
+			servers = []*SMTPConfig{c.Secondary, c}
+		} else {
+			servers = append(servers, c.Secondary)
+		}
+	}
+
+	var err error
+	for i, server := range servers {
+		if i > 0 {
+			log.Printf("[SMTP] %s failed (%v), sending through %s", servers[i-1].Host, err, server.Host)
+			workerMetrics.SMTPFailovers.Inc(server.Host)
+		}
+		err = deliverSMTP(ctx, server, envelopeFrom, recipients, message, c.Suppressions)
+		if server == c {
+			c.recordPrimaryResult(err)
+		}
+		if !smtpServerFailure(err) {
+			return server.Host, err
+		}
+	}
+	return "", err
+}
+
+// primaryDown reports whether the primary is within its failover cooldown
+func (c *SMTPConfig) primaryDown() bool {
+	c.failover.mu.Lock()
+	defer c.failover.mu.Unlock()
+	return time.Now().Before(c.failover.downUntil)
+}
+
+// recordPrimaryResult counts the primary's consecutive server failures and
+// starts a cooldown when they reach FailoverThreshold
+func (c *SMTPConfig) recordPrimaryResult(err error) {
+	if c.Secondary == nil {
+		return
+	}
+	c.failover.mu.Lock()
+	defer c.failover.mu.Unlock()
+	if !smtpServerFailure(err) {
+		if c.failover.failures >= c.FailoverThreshold {
+			log.Printf("[SMTP] %s is sending again; failing back from %s", c.Host, c.Secondary.Host)
+		}
+		c.failover.failures = 0
+		return
+	}
+	c.failover.failures++
+	if c.failover.failures >= c.FailoverThreshold {
+		c.failover.downUntil = time.Now().Add(c.FailoverCooldown)
+		log.Printf("[SMTP] %s failed %d times in a row; sending through %s first for %s",
+			c.Host, c.failover.failures, c.Secondary.Host, c.FailoverCooldown)
+	}
+}
+
+// deliverSMTP runs one SMTP conversation with server: STARTTLS when offered,
+// AUTH when configured, MAIL FROM, RCPT TO for each recipient and DATA.
+// Recipients rejected as unknown mailboxes are suppressed.
+func deliverSMTP(ctx context.Context, server *SMTPConfig, envelopeFrom string, recipients []string, message []byte, suppressions *EmailSuppressions) (err error) {
+	span := startSMTPSpan(ctx, server, len(recipients))
+	defer func() {
+		setSpanError(span, err)
+		span.End()
+	}()
+
+	// Connect to SMTP server
+	serverAddr := net.JoinHostPort(server.Host, server.Port)
+	conn, err := net.DialTimeout("tcp", serverAddr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, server.Host)
+	if err != nil {
+		return fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+	defer client.Close()
+
+	// Start TLS if supported (STARTTLS)
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := &tls.Config{
+			ServerName: server.Host,
+			MinVersion: tls.VersionTLS12,
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	// Authenticate if credentials provided
+	if auth := server.smtpAuth(); auth != nil {
+		if err = client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	// SMTP envelope uses email-only, not display name
+	if err = client.Mail(envelopeFrom); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range recipients {
+		if err = client.Rcpt(rcpt); err != nil {
+			return &smtpRecipientError{Recipient: rcpt, Err: suppressRejectedRecipient(ctx, suppressions, rcpt, err)}
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA command failed: %w", err)
+	}
+	if _, err = writer.Write(message); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write email body: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to close DATA writer: %w", err)
+	}
+
+	if err := client.Quit(); err != nil {
+		log.Printf("Warning: QUIT command failed: %v", err)
+	}
+	return nil
+}
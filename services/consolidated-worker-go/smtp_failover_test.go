@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts SMTP sessions without TLS or AUTH, answering RCPT TO with
+// rcptReply, and counts the messages it accepts
+func fakeSMTP(t *testing.T, rcptReply string) (host, port string, accepted *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	accepted = &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+				reply("220 fake ESMTP")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"), strings.HasPrefix(cmd, "MAIL"):
+						reply("250 OK")
+					case strings.HasPrefix(cmd, "RCPT"):
+						reply(rcptReply)
+					case cmd == "DATA":
+						reply("354 go ahead")
+						for {
+							dataLine, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if dataLine == ".\r\n" {
+								break
+							}
+						}
+						accepted.Add(1)
+						reply("250 queued")
+					case cmd == "QUIT":
+						reply("221 bye")
+						return
+					default:
+						reply("250 OK")
+					}
+				}
+			}()
+		}
+	}()
+	host, port, _ = net.SplitHostPort(ln.Addr().String())
+	return host, port, accepted
+}
+
+// closedPort returns a local address nothing listens on
+func closedPort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	return port
+}
+
+func TestSMTPFailover(t *testing.T) {
+	host, secondaryPort, accepted := fakeSMTP(t, "250 OK")
+	cfg := &SMTPConfig{
+		Host:              "127.0.0.1",
+		Port:              closedPort(t),
+		Secondary:         &SMTPConfig{Host: host, Port: secondaryPort},
+		FailoverThreshold: 2,
+		FailoverCooldown:  time.Minute,
+	}
+	ctx := context.Background()
+
+	for i := 1; i <= 2; i++ {
+		server, err := cfg.send(ctx, "noreply@example.org", []string{"resident@example.org"}, []byte("Subject: hi\r\n\r\nhello"))
+		if err != nil || server != host {
+			t.Fatalf("send %d = %q, %v; want the secondary", i, server, err)
+		}
+		if got := int(accepted.Load()); got != i {
+			t.Fatalf("secondary accepted %d messages, want %d", got, i)
+		}
+	}
+	if !cfg.primaryDown() {
+		t.Error("primary not marked down after reaching the threshold")
+	}
+
+	// A working primary resets the count when the cooldown is over
+	primaryHost, primaryPort, _ := fakeSMTP(t, "250 OK")
+	cfg.Host, cfg.Port = primaryHost, primaryPort
+	cfg.failover.downUntil = time.Time{}
+	if server, err := cfg.send(ctx, "noreply@example.org", []string{"resident@example.org"}, []byte("hello")); err != nil || server != primaryHost {
+		t.Errorf("send after cooldown = %q, %v; want the primary", server, err)
+	}
+	if cfg.failover.failures != 0 {
+		t.Errorf("failures = %d after a primary success, want 0", cfg.failover.failures)
+	}
+}
+
+func TestSMTPFailoverSkipsRecipientRejections(t *testing.T) {
+	primaryHost, primaryPort, _ := fakeSMTP(t, "550 5.1.1 user unknown")
+	secondaryHost, secondaryPort, accepted := fakeSMTP(t, "250 OK")
+	cfg := &SMTPConfig{
+		Host:              primaryHost,
+		Port:              primaryPort,
+		Secondary:         &SMTPConfig{Host: secondaryHost, Port: secondaryPort},
+		FailoverThreshold: 1,
+		FailoverCooldown:  time.Minute,
+	}
+
+	_, err := cfg.send(context.Background(), "noreply@example.org", []string{"gone@example.org"}, []byte("hello"))
+	if err == nil || accepted.Load() != 0 {
+		t.Fatalf("send = %v with %d sent through the secondary; want the rejection, no failover", err, accepted.Load())
+	}
+	if cfg.primaryDown() {
+		t.Error("a rejected recipient marked the primary down")
+	}
+}
+
+func TestSMTPServerFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}}, true},
+		{&smtpRecipientError{Recipient: "a@example.org", Err: &textproto.Error{Code: 451, Msg: "4.3.0 try later"}}, true},
+		{&smtpRecipientError{Recipient: "a@example.org", Err: &textproto.Error{Code: 550, Msg: "5.1.1 unknown"}}, false},
+		{&smtpRecipientError{Recipient: "a@example.org", Err: errEmailSuppressed}, false},
+	}
+	for _, tt := range tests {
+		if got := smtpServerFailure(tt.err); got != tt.want {
+			t.Errorf("smtpServerFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -3,15 +3,14 @@ package main
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	pgquery "github.com/pganalyze/pg_query_go/v6"
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/rivertype"
 )
@@ -20,7 +19,8 @@ import (
 // River Job: ParseAllSourceCode
 // ============================================================================
 
-// ParseAllSourceCodeArgs triggers a full re-parse of all public functions and views.
+// ParseAllSourceCodeArgs triggers a full re-parse of the functions, views and
+// RLS policies in the parsed schemas.
 type ParseAllSourceCodeArgs struct{}
 
 func (ParseAllSourceCodeArgs) Kind() string { return "parse_all_source_code" }
@@ -41,105 +41,226 @@ func (ParseAllSourceCodeArgs) InsertOpts() river.InsertOpts {
 	}
 }
 
-// ParseAllSourceCodeWorker parses all public functions and views into AST JSON.
+// ParseAllSourceCodeWorker parses database code into AST JSON. It covers
+// functions, trigger functions, views, materialized views and RLS policies in
+// each of schemas (SOURCE_PARSER_SCHEMAS, always including public), plus
+// trigger functions outside those schemas that fire on their tables.
 type ParseAllSourceCodeWorker struct {
 	river.WorkerDefaults[ParseAllSourceCodeArgs]
-	dbPool *pgxpool.Pool
+	dbPool      *pgxpool.Pool
+	schemas     []string
+	concurrency int // objects parsed at once (SOURCE_PARSER_CONCURRENCY)
 }
 
-func (w *ParseAllSourceCodeWorker) Work(ctx context.Context, job *river.Job[ParseAllSourceCodeArgs]) error {
-	log.Printf("[Job %d] Starting source code parsing...", job.ID)
+const (
+	defaultSourceParserConcurrency = 4
+	// Rows per INSERT ... ON CONFLICT; ASTs of large plpgsql functions run to
+	// hundreds of KB, so batches stay well below PostgreSQL's 1 GB value limit
+	sourceParserUpsertBatchSize = 100
+)
 
-	// 1. Query all public functions
-	functions, err := w.queryFunctions(ctx)
-	if err != nil {
-		return fmt.Errorf("query functions: %w", err)
-	}
+// Object types stored in metadata.parsed_source_code.object_type
+const (
+	sourceTypeFunction         = "function"
+	sourceTypeTriggerFunction  = "trigger_function"
+	sourceTypeView             = "view"
+	sourceTypeMaterializedView = "materialized_view"
+	sourceTypePolicy           = "policy"
+)
 
-	// 2. Query all public views
-	views, err := w.queryViews(ctx)
-	if err != nil {
-		return fmt.Errorf("query views: %w", err)
+func (w *ParseAllSourceCodeWorker) Work(ctx context.Context, job *river.Job[ParseAllSourceCodeArgs]) error {
+	schemas := w.schemas
+	if len(schemas) == 0 {
+		schemas = []string{"public"}
+	}
+	concurrency := max(w.concurrency, 1)
+	log.Printf("[Job %d] Starting source code parsing (schemas: %s, %d parsers)...", job.ID, strings.Join(schemas, ", "), concurrency)
+
+	var timings sourceParseTimings
+	phaseStart := time.Now()
+
+	// 1. Query every kind of code object
+	var objects []sourceObject
+	for _, q := range []struct {
+		what  string
+		query func(context.Context, []string) ([]sourceObject, error)
+	}{
+		{"functions", w.queryFunctions},
+		{"views", w.queryViews},
+		{"policies", w.queryPolicies},
+	} {
+		found, err := q.query(ctx, schemas)
+		if err != nil {
+			return fmt.Errorf("query %s: %w", q.what, err)
+		}
+		objects = append(objects, found...)
 	}
 
-	// 3. Get existing hashes to skip unchanged objects
+	timings.query = time.Since(phaseStart)
+
+	// 2. Get existing hashes to skip unchanged objects
+	phaseStart = time.Now()
 	existingHashes, err := w.getExistingHashes(ctx)
 	if err != nil {
 		return fmt.Errorf("get existing hashes: %w", err)
 	}
 
-	// 4. Parse and upsert each object
-	var parsed, skipped, failed int
+	var changed []parsedSource
 	currentObjects := make(map[string]bool)
-
-	for _, fn := range functions {
-		key := fmt.Sprintf("public:%s:function", fn.name)
+	for _, obj := range objects {
+		key := obj.key()
 		currentObjects[key] = true
 
-		hash := computeHash(fn.sourceCode)
+		hash := computeHash(obj.sourceCode)
 		if existingHashes[key] == hash {
-			skipped++
 			continue
 		}
-
-		astJSON, parseErr := parsePLpgSQL(fn.sourceCode, fn.language)
-		if err := w.upsertParsed(ctx, "public", fn.name, "function", fn.language, hash, astJSON, parseErr); err != nil {
-			log.Printf("[Job %d] Failed to upsert %s: %v", job.ID, fn.name, err)
-			failed++
-			continue
-		}
-		parsed++
+		changed = append(changed, parsedSource{obj: obj, hash: hash})
 	}
-
-	for _, v := range views {
-		key := fmt.Sprintf("public:%s:view", v.name)
-		currentObjects[key] = true
-
-		hash := computeHash(v.sourceCode)
-		if existingHashes[key] == hash {
-			skipped++
+	skipped := len(objects) - len(changed)
+	timings.hashes = time.Since(phaseStart)
+
+	// 3. Parse and lint changed objects concurrently
+	phaseStart = time.Now()
+	parseSources(changed, concurrency)
+	timings.parse = time.Since(phaseStart)
+
+	// 4. Upsert in batches; a failed batch doesn't stop the others
+	phaseStart = time.Now()
+	var parsed, failed, findings int
+	for start := 0; start < len(changed); start += sourceParserUpsertBatchSize {
+		batch := changed[start:min(start+sourceParserUpsertBatchSize, len(changed))]
+		if err := w.upsertParsed(ctx, batch); err != nil {
+			log.Printf("[Job %d] Failed to upsert %d objects (%s %s.%s ...): %v",
+				job.ID, len(batch), batch[0].obj.objectType, batch[0].obj.schema, batch[0].obj.name, err)
+			failed += len(batch)
 			continue
 		}
-
-		astJSON, parseErr := parseSQL(v.sourceCode)
-		if err := w.upsertParsed(ctx, "public", v.name, "view", "sql", hash, astJSON, parseErr); err != nil {
-			log.Printf("[Job %d] Failed to upsert view %s: %v", job.ID, v.name, err)
-			failed++
-			continue
+		parsed += len(batch)
+		for _, item := range batch {
+			findings += len(item.findings)
 		}
-		parsed++
 	}
+	timings.upsert = time.Since(phaseStart)
 
-	// 5. Delete stale entries (objects that no longer exist)
+	// 5. Delete stale entries (objects that no longer exist or are no longer parsed)
+	phaseStart = time.Now()
 	deleted, err := w.deleteStale(ctx, currentObjects)
 	if err != nil {
 		log.Printf("[Job %d] Failed to clean stale entries: %v", job.ID, err)
 	}
+	timings.cleanup = time.Since(phaseStart)
 
-	log.Printf("[Job %d] Source code parsing complete: %d parsed, %d skipped, %d failed, %d stale removed",
-		job.ID, parsed, skipped, failed, deleted)
+	log.Printf("[Job %d] Source code parsing complete: %d parsed, %d skipped, %d failed, %d stale removed, %d lint findings (%s)",
+		job.ID, parsed, skipped, failed, deleted, findings, timings)
 
 	return nil
 }
 
+// sourceParseTimings records how long each phase of a parse run took
+type sourceParseTimings struct {
+	query, hashes, parse, upsert, cleanup time.Duration
+}
+
+func (t sourceParseTimings) String() string {
+	return fmt.Sprintf("query %s, hashes %s, parse %s, upsert %s, cleanup %s",
+		t.query.Round(time.Millisecond), t.hashes.Round(time.Millisecond), t.parse.Round(time.Millisecond),
+		t.upsert.Round(time.Millisecond), t.cleanup.Round(time.Millisecond))
+}
+
+// parsedSource is an object whose source changed since it was last parsed,
+// with its parse result and lint findings once parseSources has run
+type parsedSource struct {
+	obj        sourceObject
+	hash       string
+	astJSON    *string
+	parseError *string
+	findings   []lintFinding
+}
+
+// parseSources parses and lints each item in place with at most concurrency
+// parsers at once. libpg_query keeps its memory contexts per thread, so
+// parses don't share state.
+func parseSources(items []parsedSource, concurrency int) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				items[i].astJSON, items[i].parseError = items[i].obj.parse()
+				items[i].findings = lintSource(items[i].obj, items[i].astJSON)
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
 // ============================================================================
 // Database Queries
 // ============================================================================
 
 type sourceObject struct {
+	schema     string
 	name       string
+	objectType string
+	table      string // the policy's table; "" for other object types
 	language   string
 	sourceCode string
+
+	// Function attributes from pg_proc, for the lint rules
+	securityDefiner bool
+	volatility      string   // provolatile: "i", "s" or "v"
+	config          []string // proconfig, e.g. "search_path=public"
+}
+
+// key identifies the object the way metadata.parsed_source_code's primary key does
+func (o sourceObject) key() string {
+	return sourceKey(o.schema, o.name, o.objectType, o.table)
+}
+
+func sourceKey(schema, name, objectType, table string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", schema, name, objectType, table)
+}
+
+// parse dispatches to the parser for the object's type
+func (o sourceObject) parse() (astJSON *string, parseError *string) {
+	switch o.objectType {
+	case sourceTypeFunction, sourceTypeTriggerFunction:
+		return parsePLpgSQL(o.sourceCode, o.language)
+	case sourceTypePolicy:
+		return parseStatement(o.sourceCode)
+	default:
+		return parseSQL(o.sourceCode)
+	}
 }
 
-func (w *ParseAllSourceCodeWorker) queryFunctions(ctx context.Context) ([]sourceObject, error) {
+// queryFunctions returns the plpgsql and sql functions in schemas, typed
+// trigger_function when they return trigger, plus the trigger functions
+// (in any schema) of triggers on tables in schemas
+func (w *ParseAllSourceCodeWorker) queryFunctions(ctx context.Context, schemas []string) ([]sourceObject, error) {
 	rows, err := w.dbPool.Query(ctx, `
-		SELECT p.proname::TEXT, l.lanname::TEXT, pg_get_functiondef(p.oid) AS source_code
+		SELECT n.nspname::TEXT, p.proname::TEXT,
+		       CASE WHEN p.prorettype = 'trigger'::regtype THEN 'trigger_function' ELSE 'function' END,
+		       l.lanname::TEXT, pg_get_functiondef(p.oid) AS source_code,
+		       p.prosecdef, p.provolatile::TEXT, COALESCE(p.proconfig, '{}')
 		FROM pg_proc p
-		JOIN pg_namespace n ON n.oid = p.pronamespace AND n.nspname = 'public'
+		JOIN pg_namespace n ON n.oid = p.pronamespace
 		JOIN pg_language l ON l.oid = p.prolang
 		WHERE p.prokind = 'f' AND l.lanname IN ('plpgsql', 'sql')
-	`)
+		  AND (n.nspname = ANY($1) OR p.oid IN (
+		      SELECT t.tgfoid
+		      FROM pg_trigger t
+		      JOIN pg_class c ON c.oid = t.tgrelid
+		      JOIN pg_namespace tn ON tn.oid = c.relnamespace
+		      WHERE tn.nspname = ANY($1) AND NOT t.tgisinternal
+		  ))
+	`, schemas)
 	if err != nil {
 		return nil, err
 	}
@@ -148,7 +269,8 @@ func (w *ParseAllSourceCodeWorker) queryFunctions(ctx context.Context) ([]source
 	var result []sourceObject
 	for rows.Next() {
 		var obj sourceObject
-		if err := rows.Scan(&obj.name, &obj.language, &obj.sourceCode); err != nil {
+		if err := rows.Scan(&obj.schema, &obj.name, &obj.objectType, &obj.language, &obj.sourceCode,
+			&obj.securityDefiner, &obj.volatility, &obj.config); err != nil {
 			return nil, err
 		}
 		result = append(result, obj)
@@ -156,11 +278,16 @@ func (w *ParseAllSourceCodeWorker) queryFunctions(ctx context.Context) ([]source
 	return result, rows.Err()
 }
 
-func (w *ParseAllSourceCodeWorker) queryViews(ctx context.Context) ([]sourceObject, error) {
+// queryViews returns the views and materialized views in schemas
+func (w *ParseAllSourceCodeWorker) queryViews(ctx context.Context, schemas []string) ([]sourceObject, error) {
 	rows, err := w.dbPool.Query(ctx, `
-		SELECT v.viewname::TEXT, pg_get_viewdef(v.viewname, true) AS source_code
-		FROM pg_views v WHERE v.schemaname = 'public'
-	`)
+		SELECT n.nspname::TEXT, c.relname::TEXT,
+		       CASE c.relkind WHEN 'm' THEN 'materialized_view' ELSE 'view' END,
+		       pg_get_viewdef(c.oid, true) AS source_code
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm') AND n.nspname = ANY($1)
+	`, schemas)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +296,7 @@ func (w *ParseAllSourceCodeWorker) queryViews(ctx context.Context) ([]sourceObje
 	var result []sourceObject
 	for rows.Next() {
 		var obj sourceObject
-		if err := rows.Scan(&obj.name, &obj.sourceCode); err != nil {
+		if err := rows.Scan(&obj.schema, &obj.name, &obj.objectType, &obj.sourceCode); err != nil {
 			return nil, err
 		}
 		obj.language = "sql"
@@ -178,9 +305,46 @@ func (w *ParseAllSourceCodeWorker) queryViews(ctx context.Context) ([]sourceObje
 	return result, rows.Err()
 }
 
+// queryPolicies returns the RLS policies on tables in schemas, each rebuilt
+// as a CREATE POLICY statement so its USING and WITH CHECK expressions parse
+// together with the command and roles they apply to
+func (w *ParseAllSourceCodeWorker) queryPolicies(ctx context.Context, schemas []string) ([]sourceObject, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT n.nspname::TEXT, pol.polname::TEXT, c.relname::TEXT,
+		       format('CREATE POLICY %I ON %I.%I AS %s FOR %s TO %s',
+		              pol.polname, n.nspname, c.relname,
+		              CASE WHEN pol.polpermissive THEN 'PERMISSIVE' ELSE 'RESTRICTIVE' END,
+		              CASE pol.polcmd WHEN 'r' THEN 'SELECT' WHEN 'a' THEN 'INSERT'
+		                              WHEN 'w' THEN 'UPDATE' WHEN 'd' THEN 'DELETE' ELSE 'ALL' END,
+		              COALESCE((SELECT string_agg(quote_ident(r.rolname), ', ' ORDER BY r.rolname)
+		                        FROM pg_roles r WHERE r.oid = ANY(pol.polroles)), 'PUBLIC'))
+		       || COALESCE(' USING (' || pg_get_expr(pol.polqual, pol.polrelid) || ')', '')
+		       || COALESCE(' WITH CHECK (' || pg_get_expr(pol.polwithcheck, pol.polrelid) || ')', '')
+		       AS source_code
+		FROM pg_policy pol
+		JOIN pg_class c ON c.oid = pol.polrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = ANY($1)
+	`, schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []sourceObject
+	for rows.Next() {
+		obj := sourceObject{objectType: sourceTypePolicy, language: "sql"}
+		if err := rows.Scan(&obj.schema, &obj.name, &obj.table, &obj.sourceCode); err != nil {
+			return nil, err
+		}
+		result = append(result, obj)
+	}
+	return result, rows.Err()
+}
+
 func (w *ParseAllSourceCodeWorker) getExistingHashes(ctx context.Context) (map[string]string, error) {
 	rows, err := w.dbPool.Query(ctx, `
-		SELECT schema_name, object_name, object_type, source_hash
+		SELECT schema_name, object_name, object_type, table_name, source_hash
 		FROM metadata.parsed_source_code
 	`)
 	if err != nil {
@@ -190,33 +354,107 @@ func (w *ParseAllSourceCodeWorker) getExistingHashes(ctx context.Context) (map[s
 
 	hashes := make(map[string]string)
 	for rows.Next() {
-		var schema, name, objType, hash string
-		if err := rows.Scan(&schema, &name, &objType, &hash); err != nil {
+		var schema, name, objType, table, hash string
+		if err := rows.Scan(&schema, &name, &objType, &table, &hash); err != nil {
 			return nil, err
 		}
-		hashes[fmt.Sprintf("%s:%s:%s", schema, name, objType)] = hash
+		hashes[sourceKey(schema, name, objType, table)] = hash
 	}
 	return hashes, rows.Err()
 }
 
-func (w *ParseAllSourceCodeWorker) upsertParsed(ctx context.Context, schema, name, objType, language, hash string, astJSON *string, parseError *string) error {
-	_, err := w.dbPool.Exec(ctx, `
+// sourceRow is one parsed_source_code row in an upsert or delete batch
+type sourceRow struct {
+	Schema     string          `json:"schema_name"`
+	Name       string          `json:"object_name"`
+	Type       string          `json:"object_type"`
+	Table      string          `json:"table_name"`
+	Language   string          `json:"language,omitempty"`
+	Hash       string          `json:"source_hash,omitempty"`
+	AST        json.RawMessage `json:"ast_json,omitempty"`
+	ParseError *string         `json:"parse_error,omitempty"`
+	Findings   []lintFinding   `json:"findings,omitempty"`
+}
+
+// upsertParsed writes a batch of parse results with a single INSERT and
+// replaces the batch's lint findings, in one transaction
+func (w *ParseAllSourceCodeWorker) upsertParsed(ctx context.Context, batch []parsedSource) error {
+	rows := make([]sourceRow, len(batch))
+	for i, item := range batch {
+		rows[i] = sourceRow{
+			Schema: item.obj.schema, Name: item.obj.name, Type: item.obj.objectType, Table: item.obj.table,
+			Language: item.obj.language, Hash: item.hash, ParseError: item.parseError, Findings: item.findings,
+		}
+		if item.astJSON != nil {
+			rows[i].AST = json.RawMessage(*item.astJSON)
+		}
+	}
+	payload, err := json.Marshal(rows)
+	if err != nil {
+		return fmt.Errorf("marshal batch: %w", err)
+	}
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
 		INSERT INTO metadata.parsed_source_code
-			(schema_name, object_name, object_type, language, source_hash, ast_json, parse_error, parsed_at)
-		VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, NOW())
-		ON CONFLICT (schema_name, object_name, object_type) DO UPDATE SET
+			(schema_name, object_name, object_type, table_name, language, source_hash, ast_json, parse_error, parsed_at)
+		SELECT r.schema_name, r.object_name, r.object_type, r.table_name, r.language, r.source_hash,
+		       r.ast_json, r.parse_error, NOW()
+		FROM jsonb_to_recordset($1::JSONB) AS r(
+			schema_name NAME,
+			object_name NAME,
+			object_type TEXT,
+			table_name NAME,
+			language TEXT,
+			source_hash TEXT,
+			ast_json JSONB,
+			parse_error TEXT
+		)
+		ON CONFLICT (schema_name, object_name, object_type, table_name) DO UPDATE SET
 			language = EXCLUDED.language,
 			source_hash = EXCLUDED.source_hash,
 			ast_json = EXCLUDED.ast_json,
 			parse_error = EXCLUDED.parse_error,
 			parsed_at = EXCLUDED.parsed_at
-	`, schema, name, objType, language, hash, astJSON, parseError)
-	return err
+	`, payload)
+	if err != nil {
+		return fmt.Errorf("upsert parsed source: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM metadata.source_lint_findings f
+		USING jsonb_to_recordset($1::JSONB) AS r(schema_name NAME, object_name NAME, object_type TEXT, table_name NAME)
+		WHERE f.schema_name = r.schema_name AND f.object_name = r.object_name
+		  AND f.object_type = r.object_type AND f.table_name = r.table_name
+	`, payload)
+	if err != nil {
+		return fmt.Errorf("clear lint findings: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO metadata.source_lint_findings
+			(schema_name, object_name, object_type, table_name, rule, severity, message, detail)
+		SELECT r.schema_name, r.object_name, r.object_type, r.table_name, f.rule, f.severity, f.message, f.detail
+		FROM jsonb_to_recordset($1::JSONB) AS r(
+			schema_name NAME, object_name NAME, object_type TEXT, table_name NAME, findings JSONB
+		),
+		jsonb_to_recordset(COALESCE(r.findings, '[]'::JSONB)) AS f(rule TEXT, severity TEXT, message TEXT, detail TEXT)
+	`, payload)
+	if err != nil {
+		return fmt.Errorf("insert lint findings: %w", err)
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (w *ParseAllSourceCodeWorker) deleteStale(ctx context.Context, currentObjects map[string]bool) (int, error) {
 	rows, err := w.dbPool.Query(ctx, `
-		SELECT schema_name, object_name, object_type
+		SELECT schema_name, object_name, object_type, table_name
 		FROM metadata.parsed_source_code
 	`)
 	if err != nil {
@@ -224,32 +462,51 @@ func (w *ParseAllSourceCodeWorker) deleteStale(ctx context.Context, currentObjec
 	}
 	defer rows.Close()
 
-	var toDelete [][]string
+	var toDelete []sourceRow
 	for rows.Next() {
-		var schema, name, objType string
-		if err := rows.Scan(&schema, &name, &objType); err != nil {
+		var r sourceRow
+		if err := rows.Scan(&r.Schema, &r.Name, &r.Type, &r.Table); err != nil {
 			return 0, err
 		}
-		key := fmt.Sprintf("%s:%s:%s", schema, name, objType)
-		if !currentObjects[key] {
-			toDelete = append(toDelete, []string{schema, name, objType})
+		if !currentObjects[sourceKey(r.Schema, r.Name, r.Type, r.Table)] {
+			toDelete = append(toDelete, r)
 		}
 	}
 	if err := rows.Err(); err != nil {
 		return 0, err
 	}
+	if len(toDelete) == 0 {
+		return 0, nil
+	}
 
-	for _, item := range toDelete {
-		_, err := w.dbPool.Exec(ctx, `
-			DELETE FROM metadata.parsed_source_code
-			WHERE schema_name = $1 AND object_name = $2 AND object_type = $3
-		`, item[0], item[1], item[2])
-		if err != nil {
-			return 0, err
-		}
+	payload, err := json.Marshal(toDelete)
+	if err != nil {
+		return 0, err
+	}
+	tag, err := w.dbPool.Exec(ctx, `
+		DELETE FROM metadata.parsed_source_code psc
+		USING jsonb_to_recordset($1::JSONB) AS r(schema_name NAME, object_name NAME, object_type TEXT, table_name NAME)
+		WHERE psc.schema_name = r.schema_name AND psc.object_name = r.object_name
+		  AND psc.object_type = r.object_type AND psc.table_name = r.table_name
+	`, payload)
+	if err != nil {
+		return 0, err
 	}
+	return int(tag.RowsAffected()), nil
+}
 
-	return len(toDelete), nil
+// parseSchemaList splits SOURCE_PARSER_SCHEMAS ("metadata,payments") into
+// schema names. public is always parsed, first.
+func parseSchemaList(value string) []string {
+	schemas := []string{"public"}
+	seen := map[string]bool{"public": true}
+	for _, schema := range strings.Split(value, ",") {
+		if schema = strings.TrimSpace(schema); schema != "" && !seen[schema] {
+			seen[schema] = true
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
 }
 
 // ============================================================================
@@ -263,11 +520,11 @@ func computeHash(source string) string {
 }
 
 // parsePLpgSQL parses a PL/pgSQL or SQL function definition into AST JSON.
-// For plpgsql functions, uses ParsePlPgSqlToJSON which understands DECLARE/BEGIN/END.
-// For sql functions, extracts the body and parses with ParseToJSON.
+// For plpgsql functions, uses parsePlPgSQLToJSON which understands DECLARE/BEGIN/END.
+// For sql functions, extracts the body and parses with parseSQLToJSON.
 func parsePLpgSQL(sourceCode string, language string) (astJSON *string, parseError *string) {
 	if language == "plpgsql" {
-		result, err := pgquery.ParsePlPgSqlToJSON(sourceCode)
+		result, err := parsePlPgSQLToJSON(sourceCode)
 		if err != nil {
 			errStr := err.Error()
 			return nil, &errStr
@@ -282,7 +539,18 @@ func parsePLpgSQL(sourceCode string, language string) (astJSON *string, parseErr
 		return nil, &errStr
 	}
 
-	result, err := pgquery.ParseToJSON(body)
+	result, err := parseSQLToJSON(body)
+	if err != nil {
+		errStr := err.Error()
+		return nil, &errStr
+	}
+	return &result, nil
+}
+
+// parseStatement parses a complete SQL statement (a rebuilt CREATE POLICY)
+// into AST JSON.
+func parseStatement(statement string) (astJSON *string, parseError *string) {
+	result, err := parseSQLToJSON(statement)
 	if err != nil {
 		errStr := err.Error()
 		return nil, &errStr
@@ -298,7 +566,7 @@ func parseSQL(viewDef string) (astJSON *string, parseError *string) {
 		query = "SELECT " + viewDef
 	}
 
-	result, err := pgquery.ParseToJSON(query)
+	result, err := parseSQLToJSON(query)
 	if err != nil {
 		errStr := err.Error()
 		return nil, &errStr
@@ -343,72 +611,24 @@ func extractFunctionBody(source string) string {
 }
 
 // ============================================================================
-// LISTEN Goroutine
+// pgrst Channel
 // ============================================================================
 
-// StartSourceCodeListener starts a goroutine that LISTENs on the pgrst channel
-// and enqueues parse jobs when schema changes are detected.
-// The insertJob callback is called to enqueue the parse job, decoupling the
-// listener from the River client type.
-func StartSourceCodeListener(ctx context.Context, databaseURL string, insertJob func(ctx context.Context) error) {
-	go func() {
-		for {
-			err := listenAndDispatch(ctx, databaseURL, insertJob)
-			if ctx.Err() != nil {
-				return
-			}
-			log.Printf("[Listener] Reconnecting in 5s: %v", err)
-			time.Sleep(5 * time.Second)
-		}
-	}()
-}
-
-// lastParseInsert tracks debounce timing for parse job insertion.
-var (
-	lastParseInsert   time.Time
-	lastParseInsertMu sync.Mutex
-)
-
-func listenAndDispatch(ctx context.Context, databaseURL string, insertJob func(ctx context.Context) error) error {
-	conn, err := pgx.Connect(ctx, databaseURL)
-	if err != nil {
-		return fmt.Errorf("connect: %w", err)
-	}
-	defer conn.Close(ctx)
-
-	_, err = conn.Exec(ctx, "LISTEN pgrst")
-	if err != nil {
-		return fmt.Errorf("listen: %w", err)
-	}
-
-	log.Println("[Listener] Listening on channel: pgrst")
-
-	for {
-		notification, err := conn.WaitForNotification(ctx)
-		if err != nil {
-			return fmt.Errorf("wait: %w", err)
-		}
-
-		payload := strings.TrimSpace(notification.Payload)
-		if payload != "" && payload != "reload schema" && payload != "reload config" {
-			continue
-		}
-
-		// Debounce: skip if last parse job was inserted < 5 seconds ago
-		lastParseInsertMu.Lock()
-		if time.Since(lastParseInsert) < 5*time.Second {
-			lastParseInsertMu.Unlock()
-			log.Println("[Listener] Debounced pgrst notification (< 5s since last parse)")
-			continue
-		}
-		lastParseInsert = time.Now()
-		lastParseInsertMu.Unlock()
-
-		log.Printf("[Listener] Received pgrst notification (payload: %q), enqueuing parse job", payload)
-
-		if err := insertJob(ctx); err != nil {
-			log.Printf("[Listener] Failed to insert parse job: %v", err)
-			continue
-		}
+// sourceCodeChannel re-parses on PostgREST's pgrst channel, which migrations
+// and DDL scripts notify with "reload schema" after schema changes. Bursts of
+// reloads collapse into one parse job per 5 seconds. No resync: main queues a
+// parse at startup.
+func sourceCodeChannel(insertJob func(ctx context.Context) error) NotifyChannel {
+	return NotifyChannel{
+		Name:     "pgrst",
+		Debounce: 5 * time.Second,
+		Key: func(payload string) (string, bool) {
+			payload = strings.TrimSpace(payload)
+			return "", payload == "" || payload == "reload schema" || payload == "reload config"
+		},
+		Handle: func(ctx context.Context, payload string) error {
+			log.Printf("[Listener] Received pgrst notification (payload: %q), enqueuing parse job", payload)
+			return insertJob(ctx)
+		},
 	}
 }
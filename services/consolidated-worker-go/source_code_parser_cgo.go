@@ -0,0 +1,18 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+//go:build cgo
+
+package main
+
+import pgquery "github.com/pganalyze/pg_query_go/v6"
+
+// sqlParserAvailable reports whether this binary links libpg_query (cgo)
+const sqlParserAvailable = true
+
+func parseSQLToJSON(query string) (string, error) {
+	return pgquery.ParseToJSON(query)
+}
+
+func parsePlPgSQLToJSON(source string) (string, error) {
+	return pgquery.ParsePlPgSqlToJSON(source)
+}
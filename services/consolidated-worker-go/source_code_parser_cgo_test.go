@@ -0,0 +1,59 @@
+//go:build cgo
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSourceObjectParse_Policy(t *testing.T) {
+	policy := sourceObject{
+		schema: "public", name: "Owners can update", objectType: sourceTypePolicy, table: "issues", language: "sql",
+		sourceCode: `CREATE POLICY "Owners can update" ON public.issues AS PERMISSIVE FOR UPDATE TO authenticated ` +
+			`USING (created_by = current_user_id()) WITH CHECK (created_by = current_user_id())`,
+	}
+	astJSON, parseErr := policy.parse()
+	if parseErr != nil {
+		t.Fatalf("parse error: %s", *parseErr)
+	}
+	if !strings.Contains(*astJSON, "CreatePolicyStmt") || !strings.Contains(*astJSON, "current_user_id") {
+		t.Errorf("policy AST missing the statement or its expressions: %.200s", *astJSON)
+	}
+}
+
+func TestSourceObjectParse_MaterializedView(t *testing.T) {
+	view := sourceObject{schema: "public", name: "issue_counts", objectType: sourceTypeMaterializedView, language: "sql",
+		sourceCode: " SELECT status_id,\n    count(*) AS n\n   FROM issues\n  GROUP BY status_id;"}
+	if _, parseErr := view.parse(); parseErr != nil {
+		t.Errorf("parse error: %s", *parseErr)
+	}
+}
+
+func TestParseSources_MatchesSerialParse(t *testing.T) {
+	var items []parsedSource
+	for i := range 50 {
+		items = append(items,
+			parsedSource{obj: sourceObject{name: fmt.Sprintf("f%d", i), objectType: sourceTypeFunction, language: "sql",
+				sourceCode: fmt.Sprintf("CREATE FUNCTION public.f%d() RETURNS int LANGUAGE sql AS $$ SELECT %d $$", i, i)}},
+			parsedSource{obj: sourceObject{name: fmt.Sprintf("v%d", i), objectType: sourceTypeView, language: "sql",
+				sourceCode: "SELECT * FROM WHERE"}}, // a parse error
+		)
+	}
+
+	parseSources(items, 8)
+	if items[1].parseError == nil {
+		t.Fatal("expected the broken view to fail parsing")
+	}
+
+	for _, item := range items {
+		wantAST, wantErr := item.obj.parse()
+		if (item.astJSON == nil) != (wantAST == nil) || (item.astJSON != nil && *item.astJSON != *wantAST) {
+			t.Errorf("%s: AST differs from a serial parse", item.obj.name)
+		}
+		if (item.parseError == nil) != (wantErr == nil) {
+			t.Errorf("%s: parse error = %v, want %v", item.obj.name, item.parseError, wantErr)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+//go:build !cgo
+
+package main
+
+import "errors"
+
+// sqlParserAvailable reports whether this binary links libpg_query (cgo).
+// Static CGO_ENABLED=0 builds don't, so main skips the parse_all_source_code
+// worker and metadata.parsed_source_code keeps its last contents.
+const sqlParserAvailable = false
+
+var errSQLParserUnavailable = errors.New("SQL parser not available (built with CGO_ENABLED=0)")
+
+func parseSQLToJSON(query string) (string, error) {
+	return "", errSQLParserUnavailable
+}
+
+func parsePlPgSQLToJSON(source string) (string, error) {
+	return "", errSQLParserUnavailable
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSchemaList(t *testing.T) {
+	cases := map[string][]string{
+		"":                           {"public"},
+		"metadata, payments":         {"public", "metadata", "payments"},
+		"public,metadata,,metadata ": {"public", "metadata"},
+	}
+	for value, want := range cases {
+		if got := parseSchemaList(value); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseSchemaList(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestSourceObjectKey(t *testing.T) {
+	// Policies are keyed by table too: the same policy name is used on many tables
+	a := sourceObject{schema: "public", name: "Authenticated users can read", objectType: sourceTypePolicy, table: "issues"}
+	b := sourceObject{schema: "public", name: "Authenticated users can read", objectType: sourceTypePolicy, table: "parks"}
+	if a.key() == b.key() {
+		t.Errorf("policies on different tables share key %q", a.key())
+	}
+
+	fn := sourceObject{schema: "metadata", name: "has_permission", objectType: sourceTypeFunction}
+	if got := fn.key(); got != "metadata:has_permission:function:" {
+		t.Errorf("function key = %q", got)
+	}
+	if fn.key() == (sourceObject{schema: "public", name: "has_permission", objectType: sourceTypeFunction}).key() {
+		t.Error("functions in different schemas share a key")
+	}
+}
+
+func TestExtractFunctionBody(t *testing.T) {
+	source := "CREATE OR REPLACE FUNCTION public.f()\n RETURNS integer\n LANGUAGE sql\nAS $function$\n  SELECT 1\n$function$\n"
+	if got := extractFunctionBody(source); got != "SELECT 1" {
+		t.Errorf("extractFunctionBody = %q, want %q", got, "SELECT 1")
+	}
+	if got := extractFunctionBody("CREATE FUNCTION f() RETURNS int"); got != "" {
+		t.Errorf("extractFunctionBody without a body = %q, want empty", got)
+	}
+}
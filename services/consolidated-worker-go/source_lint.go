@@ -0,0 +1,330 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ============================================================================
+// Source Lint: static checks over parsed source code
+// ============================================================================
+//
+// ParseAllSourceCodeWorker runs lintSource on every object it (re)parses and
+// stores the findings in metadata.source_lint_findings next to the AST, so
+// the admin UI can list them without parsing anything itself.
+
+// Severities stored in metadata.source_lint_findings.severity
+const (
+	lintSeverityError   = "error"
+	lintSeverityWarning = "warning"
+	lintSeverityInfo    = "info"
+)
+
+// Rules stored in metadata.source_lint_findings.rule
+const (
+	lintRuleSecurityDefinerSearchPath = "security_definer_search_path"
+	lintRuleDynamicSQLConcat          = "dynamic_sql_concat"
+	lintRuleSelectStar                = "select_star"
+	lintRuleMissingVolatility         = "missing_volatility"
+)
+
+// lintFinding is one problem found in an object's source
+type lintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// quoteFunctions make a value safe to concatenate into dynamic SQL
+var quoteFunctions = []string{"quote_ident", "quote_literal", "quote_nullable"}
+
+// lintSource runs the rules that apply to obj. astJSON is the object's parse
+// result; catalog-based rules still run when it failed to parse.
+func lintSource(obj sourceObject, astJSON *string) []lintFinding {
+	var findings []lintFinding
+	isFunction := obj.objectType == sourceTypeFunction || obj.objectType == sourceTypeTriggerFunction
+	if isFunction {
+		findings = append(findings, lintFunctionAttributes(obj)...)
+	}
+
+	if astJSON != nil {
+		var ast any
+		if err := json.Unmarshal([]byte(*astJSON), &ast); err == nil {
+			switch {
+			case isFunction && obj.language == "plpgsql":
+				findings = append(findings, lintPLpgSQL(ast)...)
+			case obj.objectType != sourceTypePolicy:
+				if stars := selectStars(ast); len(stars) > 0 {
+					findings = append(findings, selectStarFinding(stars))
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(findings, func(a, b lintFinding) int {
+		return strings.Compare(a.Rule+"\x00"+a.Detail, b.Rule+"\x00"+b.Detail)
+	})
+	return findings
+}
+
+// lintFunctionAttributes checks the pg_proc attributes of a function
+func lintFunctionAttributes(obj sourceObject) []lintFinding {
+	var findings []lintFinding
+
+	if obj.securityDefiner && !slices.ContainsFunc(obj.config, func(setting string) bool {
+		return strings.HasPrefix(setting, "search_path=")
+	}) {
+		findings = append(findings, lintFinding{
+			Rule:     lintRuleSecurityDefinerSearchPath,
+			Severity: lintSeverityError,
+			Message:  "SECURITY DEFINER function does not set search_path, so a caller can shadow the objects it uses with their own; add SET search_path = ...",
+		})
+	}
+
+	// Trigger functions have to be VOLATILE; pg_proc doesn't record whether
+	// VOLATILE was written out or defaulted, so only plain functions are flagged
+	if obj.objectType == sourceTypeFunction && obj.volatility == "v" {
+		findings = append(findings, lintFinding{
+			Rule:     lintRuleMissingVolatility,
+			Severity: lintSeverityInfo,
+			Message:  "function is VOLATILE (the default); declare it STABLE or IMMUTABLE if it does not modify the database",
+		})
+	}
+
+	return findings
+}
+
+// lintPLpgSQL checks the statements of a plpgsql function AST. Embedded SQL
+// is parsed again on its own, since the plpgsql AST keeps it as text.
+func lintPLpgSQL(ast any) []lintFinding {
+	var findings []lintFinding
+	var stars []string
+
+	walkAST(ast, func(nodeType string, fields map[string]any) bool {
+		switch nodeType {
+		case "PLpgSQL_stmt_dynexecute", "PLpgSQL_stmt_dynfors":
+			findings = append(findings, dynamicSQLFindings(fields, "query")...)
+		case "PLpgSQL_stmt_open":
+			findings = append(findings, dynamicSQLFindings(fields, "dynquery")...)
+		case "PLpgSQL_stmt_return_query":
+			findings = append(findings, dynamicSQLFindings(fields, "dynquery")...)
+			stars = append(stars, embeddedSelectStars(fields["query"])...)
+		case "PLpgSQL_stmt_execsql":
+			stars = append(stars, embeddedSelectStars(fields["sqlstmt"])...)
+		}
+		return true
+	})
+
+	if len(stars) > 0 {
+		findings = append(findings, selectStarFinding(stars))
+	}
+	return findings
+}
+
+// dynamicSQLFindings flags a dynamic query expression (fields[key]) that
+// concatenates unquoted values
+func dynamicSQLFindings(fields map[string]any, key string) []lintFinding {
+	query := plpgsqlExprQuery(fields[key])
+	if query == "" || !concatenatesUnquoted(query) {
+		return nil
+	}
+	line, _ := fields["lineno"].(float64)
+	return []lintFinding{{
+		Rule:     lintRuleDynamicSQLConcat,
+		Severity: lintSeverityWarning,
+		Message:  "dynamic SQL is built by string concatenation; use format() with %I/%L or EXECUTE ... USING",
+		Detail:   fmt.Sprintf("line %d: %s", int(line), query),
+	}}
+}
+
+// concatenatesUnquoted reports whether expr uses || on anything but
+// constants and quote_ident/quote_literal/quote_nullable calls
+func concatenatesUnquoted(expr string) bool {
+	ast, ok := parseEmbeddedSQL("SELECT " + expr)
+	if !ok {
+		return false
+	}
+
+	unquoted := false
+	walkAST(ast, func(nodeType string, fields map[string]any) bool {
+		if nodeType != "A_Expr" || !isConcatOperator(fields) {
+			return true
+		}
+		for _, operand := range []any{fields["lexpr"], fields["rexpr"]} {
+			if !isConcatExpr(operand) && !isSafeConcatOperand(operand) {
+				unquoted = true
+			}
+		}
+		return !unquoted
+	})
+	return unquoted
+}
+
+func isConcatOperator(fields map[string]any) bool {
+	name, _ := fields["name"].([]any)
+	return len(name) == 1 && stringNodeValue(name[0]) == "||"
+}
+
+func isConcatExpr(node any) bool {
+	fields, ok := astNodeFields(node, "A_Expr")
+	return ok && isConcatOperator(fields)
+}
+
+func isSafeConcatOperand(node any) bool {
+	if _, ok := astNodeFields(node, "A_Const"); ok {
+		return true
+	}
+	if cast, ok := astNodeFields(node, "TypeCast"); ok {
+		return isSafeConcatOperand(cast["arg"])
+	}
+	if call, ok := astNodeFields(node, "FuncCall"); ok {
+		name, _ := call["funcname"].([]any)
+		return len(name) > 0 && slices.Contains(quoteFunctions, stringNodeValue(name[len(name)-1]))
+	}
+	return false
+}
+
+// embeddedSelectStars parses the SQL statement of a plpgsql expression
+// (PLpgSQL_expr) and returns its SELECT * targets
+func embeddedSelectStars(expr any) []string {
+	query := plpgsqlExprQuery(expr)
+	if query == "" {
+		return nil
+	}
+	ast, ok := parseEmbeddedSQL(query)
+	if !ok {
+		return nil
+	}
+	return selectStars(ast)
+}
+
+// selectStars returns the * and alias.* entries of every SELECT list in a
+// SQL AST. EXISTS (SELECT * ...) returns no columns and is skipped.
+// PostgreSQL expands a top-level * when it stores a view, so view
+// definitions only show stars that survive deparsing.
+func selectStars(ast any) []string {
+	var stars []string
+	walkAST(ast, func(nodeType string, fields map[string]any) bool {
+		switch nodeType {
+		case "SubLink":
+			return fields["subLinkType"] != "EXISTS_SUBLINK"
+		case "SelectStmt":
+			targets, _ := fields["targetList"].([]any)
+			for _, target := range targets {
+				if star := targetStar(target); star != "" {
+					stars = append(stars, star)
+				}
+			}
+		}
+		return true
+	})
+	return stars
+}
+
+// targetStar returns "*" or "alias.*" when a ResTarget selects all columns
+func targetStar(target any) string {
+	resTarget, ok := astNodeFields(target, "ResTarget")
+	if !ok {
+		return ""
+	}
+	ref, ok := astNodeFields(resTarget["val"], "ColumnRef")
+	if !ok {
+		return ""
+	}
+	parts, _ := ref["fields"].([]any)
+	if len(parts) == 0 {
+		return ""
+	}
+	if _, ok := astNodeFields(parts[len(parts)-1], "A_Star"); !ok {
+		return ""
+	}
+	var names []string
+	for _, part := range parts[:len(parts)-1] {
+		names = append(names, stringNodeValue(part))
+	}
+	return strings.Join(append(names, "*"), ".")
+}
+
+func selectStarFinding(stars []string) lintFinding {
+	slices.Sort(stars)
+	return lintFinding{
+		Rule:     lintRuleSelectStar,
+		Severity: lintSeverityWarning,
+		Message:  "SELECT * ties the result to the current columns of the tables it reads; list the columns",
+		Detail:   "SELECT " + strings.Join(slices.Compact(stars), ", "),
+	}
+}
+
+// ============================================================================
+// AST Helpers
+// ============================================================================
+
+// walkAST calls visit for every node of a decoded pg_query JSON tree, where
+// a node is an object key naming its type ("SelectStmt", "PLpgSQL_expr")
+// with an object of fields. Returning false skips the node's children.
+func walkAST(node any, visit func(nodeType string, fields map[string]any) bool) {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if fields, ok := child.(map[string]any); ok && isNodeType(key) {
+				if !visit(key, fields) {
+					continue
+				}
+			}
+			walkAST(child, visit)
+		}
+	case []any:
+		for _, child := range v {
+			walkAST(child, visit)
+		}
+	}
+}
+
+// isNodeType tells node types (CamelCase) from fields (lowerCamelCase)
+func isNodeType(key string) bool {
+	return key != "" && key[0] >= 'A' && key[0] <= 'Z'
+}
+
+// astNodeFields returns the fields of node when it is a nodeType node
+func astNodeFields(node any, nodeType string) (map[string]any, bool) {
+	wrapper, ok := node.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	fields, ok := wrapper[nodeType].(map[string]any)
+	return fields, ok
+}
+
+// stringNodeValue returns the value of a {"String": {"sval": ...}} node
+func stringNodeValue(node any) string {
+	fields, _ := astNodeFields(node, "String")
+	value, _ := fields["sval"].(string)
+	return value
+}
+
+// plpgsqlExprQuery returns the SQL text of a {"PLpgSQL_expr": {"query": ...}} node
+func plpgsqlExprQuery(node any) string {
+	fields, _ := astNodeFields(node, "PLpgSQL_expr")
+	query, _ := fields["query"].(string)
+	return query
+}
+
+// parseEmbeddedSQL parses SQL found inside another object's AST. It fails
+// quietly: the object itself already parsed, so an unparseable fragment
+// (e.g. one referencing plpgsql-only syntax) just isn't linted.
+func parseEmbeddedSQL(query string) (any, bool) {
+	result, err := parseSQLToJSON(query)
+	if err != nil {
+		return nil, false
+	}
+	var ast any
+	if err := json.Unmarshal([]byte(result), &ast); err != nil {
+		return nil, false
+	}
+	return ast, true
+}
@@ -0,0 +1,61 @@
+//go:build cgo
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func lintFunction(t *testing.T, source string) map[string]lintFinding {
+	t.Helper()
+	obj := sourceObject{objectType: sourceTypeFunction, language: "plpgsql", volatility: "s", sourceCode: source}
+	astJSON, parseErr := obj.parse()
+	if parseErr != nil {
+		t.Fatalf("parse error: %s", *parseErr)
+	}
+	return lintRules(lintSource(obj, astJSON))
+}
+
+func TestLintPLpgSQL_DynamicSQL(t *testing.T) {
+	got := lintFunction(t, `CREATE FUNCTION public.purge(p_table text) RETURNS void LANGUAGE plpgsql AS $$
+BEGIN
+  EXECUTE 'DELETE FROM ' || p_table || ' WHERE archived';
+END $$`)
+	finding, ok := got[lintRuleDynamicSQLConcat]
+	if !ok || !strings.HasPrefix(finding.Detail, "line 3: ") {
+		t.Errorf("concatenated EXECUTE: findings = %v", got)
+	}
+
+	got = lintFunction(t, `CREATE FUNCTION public.purge(p_table text) RETURNS void LANGUAGE plpgsql AS $$
+BEGIN
+  EXECUTE 'DELETE FROM ' || quote_ident(p_table) || ' WHERE archived';
+  EXECUTE format('DELETE FROM %I WHERE id = $1', p_table) USING 1;
+END $$`)
+	if _, ok := got[lintRuleDynamicSQLConcat]; ok {
+		t.Errorf("quoted EXECUTE: findings = %v", got)
+	}
+}
+
+func TestLintPLpgSQL_SelectStar(t *testing.T) {
+	got := lintFunction(t, `CREATE FUNCTION public.latest() RETURNS SETOF issues LANGUAGE plpgsql AS $$
+DECLARE r issues;
+BEGIN
+  SELECT i.* INTO r FROM issues i LIMIT 1;
+  PERFORM * FROM issues;
+  IF EXISTS (SELECT * FROM issues) THEN
+    RETURN QUERY SELECT * FROM issues;
+  END IF;
+END $$`)
+	if finding := got[lintRuleSelectStar]; finding.Detail != "SELECT *, i.*" {
+		t.Errorf("select_star detail = %q, want %q", finding.Detail, "SELECT *, i.*")
+	}
+}
+
+func TestLintSource_ViewSelectStar(t *testing.T) {
+	obj := sourceObject{objectType: sourceTypeView, language: "sql", sourceCode: "SELECT id FROM (SELECT * FROM issues) sub"}
+	astJSON, _ := obj.parse()
+	if got := lintRules(lintSource(obj, astJSON)); got[lintRuleSelectStar].Detail != "SELECT *" {
+		t.Errorf("view findings = %v", got)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func lintRules(findings []lintFinding) map[string]lintFinding {
+	rules := make(map[string]lintFinding)
+	for _, f := range findings {
+		rules[f.Rule] = f
+	}
+	return rules
+}
+
+func TestLintFunctionAttributes(t *testing.T) {
+	definer := sourceObject{objectType: sourceTypeFunction, securityDefiner: true, volatility: "s"}
+	if got := lintRules(lintSource(definer, nil)); got[lintRuleSecurityDefinerSearchPath].Severity != lintSeverityError {
+		t.Errorf("SECURITY DEFINER without search_path: findings = %v", got)
+	}
+
+	definer.config = []string{"statement_timeout=5s", "search_path=metadata, public"}
+	if got := lintSource(definer, nil); len(got) != 0 {
+		t.Errorf("SECURITY DEFINER with search_path: findings = %v", got)
+	}
+
+	volatile := sourceObject{objectType: sourceTypeFunction, volatility: "v"}
+	if got := lintRules(lintSource(volatile, nil)); got[lintRuleMissingVolatility].Severity != lintSeverityInfo {
+		t.Errorf("VOLATILE function: findings = %v", got)
+	}
+
+	// Trigger functions must be VOLATILE
+	trigger := sourceObject{objectType: sourceTypeTriggerFunction, volatility: "v"}
+	if got := lintSource(trigger, nil); len(got) != 0 {
+		t.Errorf("trigger function: findings = %v", got)
+	}
+}
+
+func TestSelectStars(t *testing.T) {
+	// SELECT *, a.* FROM x a WHERE EXISTS (SELECT * FROM y)
+	var ast any
+	err := json.Unmarshal([]byte(`{"stmts":[{"stmt":{"SelectStmt":{
+		"targetList":[
+			{"ResTarget":{"val":{"ColumnRef":{"fields":[{"A_Star":{}}]}}}},
+			{"ResTarget":{"val":{"ColumnRef":{"fields":[{"String":{"sval":"a"}},{"A_Star":{}}]}}}},
+			{"ResTarget":{"val":{"ColumnRef":{"fields":[{"String":{"sval":"a"}},{"String":{"sval":"id"}}]}}}}
+		],
+		"whereClause":{"SubLink":{"subLinkType":"EXISTS_SUBLINK","subselect":{"SelectStmt":{
+			"targetList":[{"ResTarget":{"val":{"ColumnRef":{"fields":[{"A_Star":{}}]}}}}]
+		}}}}
+	}}}]}`), &ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stars := selectStars(ast)
+	if len(stars) != 2 || stars[0] != "*" || stars[1] != "a.*" {
+		t.Errorf("selectStars = %v, want [* a.*]", stars)
+	}
+}
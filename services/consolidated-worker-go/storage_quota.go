@@ -0,0 +1,111 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Storage Quotas
+//
+// metadata.storage_quotas caps the bytes of files attached to one entity
+// type. S3PresignWorker checks the cap before signing an upload URL and
+// fails the request with a message the uploader sees; StorageUsageTask
+// keeps metadata.storage_usage current for dashboards.
+// ============================================================================
+
+// checkStorageQuota returns why the upload request must be refused, or ""
+// when its entity type has no quota or the file fits. Uploads signed within
+// the last hour but not yet attached count as used, so parallel uploads
+// can't all squeeze into the remaining space.
+func checkStorageQuota(ctx context.Context, db *pgxpool.Pool, requestID string) (string, error) {
+	var entityType string
+	var maxBytes, usedBytes, fileSize int64
+	err := db.QueryRow(ctx, `
+		SELECT r.entity_type, q.max_bytes, COALESCE(r.file_size, 0),
+		       (SELECT COALESCE(SUM(f.file_size), 0) FROM metadata.files f
+		        WHERE f.entity_type = r.entity_type)
+		     + (SELECT COALESCE(SUM(p.file_size), 0) FROM metadata.file_upload_requests p
+		        WHERE p.entity_type = r.entity_type AND p.id <> r.id
+		          AND p.status = 'completed' AND p.uploaded_at IS NULL
+		          AND p.created_at > $2)
+		FROM metadata.file_upload_requests r
+		JOIN metadata.storage_quotas q ON q.entity_type = r.entity_type
+		WHERE r.id = $1
+	`, requestID, time.Now().Add(-(uploadURLTTL+uploadRequestGrace))).Scan(&entityType, &maxBytes, &fileSize, &usedBytes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check storage quota: %w", err)
+	}
+	return quotaRejection(entityType, maxBytes, usedBytes, fileSize), nil
+}
+
+// quotaRejection explains why a file of fileSize doesn't fit, or returns ""
+// if it does. A file of unknown size (0) is refused only once the quota is
+// used up.
+func quotaRejection(entityType string, maxBytes, usedBytes, fileSize int64) string {
+	switch {
+	case usedBytes >= maxBytes:
+		return fmt.Sprintf("Storage quota for %s is full (%s of %s used)",
+			entityType, formatStorageSize(usedBytes), formatStorageSize(maxBytes))
+	case usedBytes+fileSize > maxBytes:
+		return fmt.Sprintf("File is too large for the remaining storage quota for %s (%s free, file is %s)",
+			entityType, formatStorageSize(maxBytes-usedBytes), formatStorageSize(fileSize))
+	}
+	return ""
+}
+
+// formatStorageSize renders bytes with binary units, as the frontend does
+func formatStorageSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, suffix := float64(bytes)/unit, "KB"
+	for _, next := range []string{"MB", "GB", "TB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
+
+// ============================================================================
+// Storage Usage Maintenance Task
+// ============================================================================
+
+// StorageUsageTask runs metadata.refresh_storage_usage()
+type StorageUsageTask struct {
+	dbPool *pgxpool.Pool
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (s *StorageUsageTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "storage_usage",
+		Description: "Recompute file count and bytes per entity type in metadata.storage_usage",
+		Interval:    time.Hour,
+		Jitter:      5 * time.Minute,
+		Run:         s.runRefresh,
+	}
+}
+
+func (s *StorageUsageTask) runRefresh(ctx context.Context) (string, error) {
+	var entityTypes int
+	if err := s.dbPool.QueryRow(ctx, "SELECT metadata.refresh_storage_usage()").Scan(&entityTypes); err != nil {
+		return "", fmt.Errorf("refresh_storage_usage(): %w", err)
+	}
+	log.Printf("[Maintenance] storage_usage: refreshed usage of %d entity type(s)", entityTypes)
+	return fmt.Sprintf("Refreshed usage of %d entity type(s)", entityTypes), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestQuotaRejection(t *testing.T) {
+	const gb = 1 << 30
+	tests := []struct {
+		name           string
+		used, fileSize int64
+		want           string
+	}{
+		{"fits", gb, 100 << 20, ""},
+		{"fills exactly", 2*gb - 100<<20, 100 << 20, ""},
+		{"unknown size with room", gb, 0, ""},
+		{"too large", 2*gb - 50<<20, 100 << 20, "File is too large for the remaining storage quota for issues (50.0 MB free, file is 100.0 MB)"},
+		{"full", 2 * gb, 0, "Storage quota for issues is full (2.0 GB of 2.0 GB used)"},
+		{"over after quota lowered", 3 * gb, 1, "Storage quota for issues is full (3.0 GB of 2.0 GB used)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quotaRejection("issues", 2*gb, tt.used, tt.fileSize); got != tt.want {
+				t.Errorf("quotaRejection() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatStorageSize(t *testing.T) {
+	tests := map[int64]string{
+		0:         "0 B",
+		1023:      "1023 B",
+		1536:      "1.5 KB",
+		5 << 20:   "5.0 MB",
+		3 << 40:   "3.0 TB",
+		1<<30 + 1: "1.0 GB",
+	}
+	for bytes, want := range tests {
+		if got := formatStorageSize(bytes); got != want {
+			t.Errorf("formatStorageSize(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -17,6 +18,7 @@ func setTelnyxAPIURL(url string) { telnyxAPIURL = url }
 // TelnyxClient sends transactional SMS via the Telnyx REST API.
 // Uses stdlib net/http — no external dependencies.
 type TelnyxClient struct {
+	mu         sync.RWMutex
 	apiKey     string
 	fromNumber string
 	httpClient *http.Client
@@ -31,6 +33,13 @@ func NewTelnyxClient(apiKey, fromNumber string) *TelnyxClient {
 	}
 }
 
+// SetAPIKey swaps in a rotated API key (see secrets.go)
+func (c *TelnyxClient) SetAPIKey(apiKey string) {
+	c.mu.Lock()
+	c.apiKey = apiKey
+	c.mu.Unlock()
+}
+
 // TelnyxError classifies a Telnyx API error as opted-out, permanent, or transient.
 type TelnyxError struct {
 	// IsOptedOut is true when the recipient texted STOP (carrier-level opt-out).
@@ -83,7 +92,9 @@ func (c *TelnyxClient) Send(to, message string) *TelnyxError {
 	if err != nil {
 		return &TelnyxError{IsPermanent: true, Message: fmt.Sprintf("failed to create request: %v", err)}
 	}
+	c.mu.RLock()
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	c.mu.RUnlock()
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
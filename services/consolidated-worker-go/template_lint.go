@@ -0,0 +1,190 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	textTemplate "text/template"
+	"text/template/parse"
+)
+
+// ============================================================================
+// Template Lint Warnings
+//
+// Template validation reports two kinds of result. Syntax errors make a part
+// invalid. Warnings don't: the template parses and sends, but something in it
+// is probably a mistake. The validation worker reports these warnings:
+//   - {{.Entity.x}} references missing from the sample data (they render empty)
+//   - in rendered HTML:
+//       - <script> tags and javascript: URLs (email clients strip or block them)
+//       - images without alt text or loaded over plain http
+//       - absolute links outside SITE_URL
+//
+// HTML is scanned with regexps, the same way engagement tracking rewrites
+// links, rather than parsed into a DOM. That is enough for the tags and
+// attributes checked here.
+// ============================================================================
+
+var (
+	// scriptTag matches an opening <script> tag
+	scriptTag = regexp.MustCompile(`(?i)<script\b`)
+
+	// imgTag matches a whole <img> tag
+	imgTag = regexp.MustCompile(`(?is)<img\b[^>]*>`)
+
+	// tagAttribute matches one attribute of a tag, quoted either way or bare
+	tagAttribute = regexp.MustCompile(`(?is)\s([a-z][a-z0-9-]*)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+)
+
+// lintRenderedHTML returns warnings about a rendered HTML email. siteURL is
+// the instance's public URL; links outside it are flagged when it's set.
+func lintRenderedHTML(rendered, siteURL string) []string {
+	var warnings []string
+	if scriptTag.MatchString(rendered) {
+		warnings = append(warnings, "contains a <script> tag, which email clients strip")
+	}
+
+	for _, tag := range imgTag.FindAllString(rendered, -1) {
+		attrs := tagAttributes(tag)
+		src := attrs["src"]
+		if _, ok := attrs["alt"]; !ok {
+			warnings = append(warnings, fmt.Sprintf("image %s has no alt text", describeURL(src)))
+		}
+		if strings.HasPrefix(strings.ToLower(src), "http://") {
+			warnings = append(warnings, fmt.Sprintf("image %s is loaded over http; use https", src))
+		}
+	}
+
+	site := strings.TrimRight(siteURL, "/")
+	for _, m := range anchorHref.FindAllStringSubmatch(rendered, -1) {
+		target := strings.TrimSpace(html.UnescapeString(m[1][1 : len(m[1])-1]))
+		lower := strings.ToLower(target)
+		switch {
+		case strings.HasPrefix(lower, "javascript:"):
+			warnings = append(warnings, "link uses a javascript: URL, which email clients block")
+		case site != "" && isTrackableLink(target) && target != site && !strings.HasPrefix(target, site+"/") &&
+			!strings.HasPrefix(target, site+"?") && !strings.HasPrefix(target, site+"#"):
+			warnings = append(warnings, fmt.Sprintf("link to %s is outside SITE_URL (%s)", target, site))
+		}
+	}
+	return warnings
+}
+
+// tagAttributes returns a tag's attributes by lowercase name, unquoted and
+// unescaped
+func tagAttributes(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range tagAttribute.FindAllStringSubmatch(tag, -1) {
+		value := m[2]
+		if value[0] == '"' || value[0] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		attrs[strings.ToLower(m[1])] = strings.TrimSpace(html.UnescapeString(value))
+	}
+	return attrs
+}
+
+// describeURL names an image in a warning
+func describeURL(src string) string {
+	switch {
+	case src == "":
+		return "(no src)"
+	case strings.HasPrefix(src, "data:"):
+		return "(inline data)"
+	}
+	return src
+}
+
+// missingEntityReferences returns a warning for each {{.Entity.x}} reference
+// (or $.Entity.x) that isn't in the sample data and so renders empty.
+// References inside range and with blocks are skipped because dot no longer
+// means the template root there.
+func missingEntityReferences(templateStr string, funcs textTemplate.FuncMap, entity map[string]interface{}) ([]string, error) {
+	tmpl, err := textTemplate.New("lint").Funcs(funcs).Parse(templateStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	seen := make(map[string]bool)
+	check := func(path []string) {
+		if len(path) < 2 || path[0] != "Entity" {
+			return
+		}
+		ref := "." + strings.Join(path, ".")
+		if seen[ref] || hasEntityPath(entity, path[1:]) {
+			return
+		}
+		seen[ref] = true
+		warnings = append(warnings, fmt.Sprintf("{{%s}} is not in the sample data, so it renders empty", ref))
+	}
+
+	var walk func(node parse.Node, atRoot bool)
+	walk = func(node parse.Node, atRoot bool) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child, atRoot)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, atRoot)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				for _, arg := range cmd.Args {
+					walk(arg, atRoot)
+				}
+			}
+		case *parse.FieldNode:
+			if atRoot {
+				check(n.Ident)
+			}
+		case *parse.VariableNode:
+			if len(n.Ident) > 0 && n.Ident[0] == "$" {
+				check(n.Ident[1:])
+			}
+		case *parse.IfNode:
+			walk(n.Pipe, atRoot)
+			walk(n.List, atRoot)
+			walk(n.ElseList, atRoot)
+		case *parse.RangeNode:
+			walk(n.Pipe, atRoot)
+			walk(n.List, false)
+			walk(n.ElseList, atRoot)
+		case *parse.WithNode:
+			walk(n.Pipe, atRoot)
+			walk(n.List, false)
+			walk(n.ElseList, atRoot)
+		}
+	}
+	if tmpl.Tree != nil {
+		walk(tmpl.Tree.Root, true)
+	}
+	return warnings, nil
+}
+
+// hasEntityPath reports whether the nested keys exist in the sample data. A
+// value that isn't an object ends the check, since templates can't index it.
+func hasEntityPath(entity map[string]interface{}, path []string) bool {
+	current := entity
+	for _, key := range path {
+		value, ok := current[key]
+		if !ok {
+			return false
+		}
+		next, ok := value.(map[string]interface{})
+		if !ok {
+			return true
+		}
+		current = next
+	}
+	return true
+}
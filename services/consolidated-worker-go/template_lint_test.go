@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	textTemplate "text/template"
+)
+
+func TestLintRenderedHTML(t *testing.T) {
+	const site = "https://civic.example.org"
+	tests := []struct {
+		name string
+		html string
+		want []string // substrings, one per expected warning
+	}{
+		{"clean", `<p>Hi</p><img src="https://cdn.example.org/logo.png" alt="Logo"><a href="https://civic.example.org/view/issues/1">View</a>`, nil},
+		{"script tag", `<p>Hi</p><SCRIPT>alert(1)</SCRIPT>`, []string{"<script>"}},
+		{"javascript link", `<a href="javascript:void(0)">x</a>`, []string{"javascript:"}},
+		{"image without alt", `<img src="https://civic.example.org/a.png">`, []string{"https://civic.example.org/a.png has no alt text"}},
+		{"empty alt is fine", `<img src="https://civic.example.org/a.png" alt="">`, nil},
+		{"http image", `<img alt="x" src='http://example.org/a.png'>`, []string{"loaded over http"}},
+		{"external link", `<a href="https://example.com/x">x</a>`, []string{"https://example.com/x is outside SITE_URL"}},
+		{"look-alike host", `<a href="https://civic.example.org.evil.test/">x</a>`, []string{"outside SITE_URL"}},
+		{"relative and mailto links", `<a href="/view/1">x</a><a href="mailto:a@b.c">y</a>`, nil},
+		{"site root with query", `<a href="https://civic.example.org?x=1">x</a>`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lintRenderedHTML(tt.html, site)
+			if len(got) != len(tt.want) {
+				t.Fatalf("lintRenderedHTML() = %q, want %d warnings", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("warning %d = %q, want it to mention %q", i, got[i], want)
+				}
+			}
+		})
+	}
+
+	if got := lintRenderedHTML(`<a href="https://example.com/x">x</a>`, ""); len(got) != 0 {
+		t.Errorf("without SITE_URL, links aren't checked: %q", got)
+	}
+}
+
+func TestMissingEntityReferences(t *testing.T) {
+	funcs := textTemplate.FuncMap{"formatDate": func(string) string { return "" }}
+	entity := map[string]interface{}{
+		"display_name": "Pothole",
+		"status":       map[string]interface{}{"display_name": "Open"},
+		"notes":        nil,
+	}
+	tmpl := `{{.Entity.display_name}} {{.Entity.status.display_name}} {{.Entity.notes}}
+{{.Entity.missing}} {{formatDate .Entity.due_date}} {{.Entity.status.color}}
+{{if .Entity.flag}}{{.Entity.missing}}{{end}} {{$.Entity.other}} {{.Metadata.site_url}}
+{{range .Entity.items}}{{.name}}{{end}} {{with .Entity.status}}{{.anything}}{{end}}`
+
+	got, err := missingEntityReferences(tmpl, funcs, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".Entity.missing", ".Entity.due_date", ".Entity.status.color", ".Entity.flag", ".Entity.other", ".Entity.items"}
+	if len(got) != len(want) {
+		t.Fatalf("missingEntityReferences() = %q, want %v", got, want)
+	}
+	for i, ref := range want {
+		if !strings.Contains(got[i], "{{"+ref+"}}") {
+			t.Errorf("warning %d = %q, want %s", i, got[i], ref)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Template Versions (v0.136.0)
+//
+// Every edit of a notification template's parts is kept as a numbered row
+// in metadata.notification_template_versions, and active_version names the
+// one the template holds. Sends record the version they rendered in
+// notification_log.template_version.
+//
+// request_template_version_activation() queues activate_template_version to
+// roll a template back (or forward). The database can't parse Go templates,
+// so the worker checks every part of the version against its own template
+// functions first: a version written for a function since removed would
+// fail every send again. A version that doesn't parse, or no longer exists,
+// cancels the job with the reason.
+// ============================================================================
+
+// ActivateTemplateVersionArgs re-activates a saved template version
+type ActivateTemplateVersionArgs struct {
+	TemplateName string `json:"template_name"`
+	Version      int    `json:"version"`
+}
+
+// Kind returns the job type identifier
+func (ActivateTemplateVersionArgs) Kind() string { return "activate_template_version" }
+
+// InsertOpts returns job insertion options
+func (ActivateTemplateVersionArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "notifications",
+		MaxAttempts: 3,
+		Priority:    4, // Ahead of sends, which may be failing on the bad version
+	}
+}
+
+// TemplateVersionWorker activates template versions that parse
+type TemplateVersionWorker struct {
+	river.WorkerDefaults[ActivateTemplateVersionArgs]
+	dbPool   *pgxpool.Pool
+	renderer *Renderer
+}
+
+// Work checks the version's parts and makes it the template's active version
+func (w *TemplateVersionWorker) Work(ctx context.Context, job *river.Job[ActivateTemplateVersionArgs]) error {
+	startTime := time.Now()
+	name, version := job.Args.TemplateName, job.Args.Version
+	log.Printf("[Job %d] Activating version %d of template %s (attempt %d/%d)",
+		job.ID, version, name, job.Attempt, job.MaxAttempts)
+
+	var tmpl NotificationTemplate
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT v.subject_template, v.html_template, v.text_template, COALESCE(v.sms_template, '')
+		FROM metadata.notification_template_versions v
+		JOIN metadata.notification_templates t ON t.id = v.template_id
+		WHERE t.name = $1 AND v.version = $2
+	`, name, version).Scan(&tmpl.Subject, &tmpl.HTML, &tmpl.Text, &tmpl.SMS)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return river.JobCancel(fmt.Errorf("template %s has no version %d", name, version))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load template version: %w", err)
+	}
+
+	if problems := templatePartErrors(w.renderer, &tmpl); len(problems) > 0 {
+		log.Printf("[Job %d] Version %d of %s does not parse, not activating: %s",
+			job.ID, version, name, strings.Join(problems, "; "))
+		return river.JobCancel(fmt.Errorf("version %d of %s does not parse: %s", version, name, strings.Join(problems, "; ")))
+	}
+
+	var changed bool
+	err = w.dbPool.QueryRow(ctx, `SELECT metadata.activate_notification_template_version($1, $2)`,
+		name, version).Scan(&changed)
+	if err != nil {
+		return fmt.Errorf("failed to activate template version: %w", err)
+	}
+
+	if changed {
+		log.Printf("[Job %d] ✓ Template %s now at version %d in %v", job.ID, name, version, time.Since(startTime))
+	} else {
+		log.Printf("[Job %d] ✓ Version %d of template %s was already active", job.ID, version, name)
+	}
+	return nil
+}
+
+// templatePartErrors parses each non-empty part of tmpl with the renderer's
+// template functions and returns "part: error" for those that fail
+func templatePartErrors(r *Renderer, tmpl *NotificationTemplate) []string {
+	var problems []string
+	for _, part := range []struct {
+		name     string
+		template string
+		isHTML   bool
+	}{
+		{"subject", tmpl.Subject, false},
+		{"html", tmpl.HTML, true},
+		{"text", tmpl.Text, false},
+		{"sms", tmpl.SMS, false},
+	} {
+		if part.template == "" {
+			continue
+		}
+		if err := r.ValidateTemplate(part.template, part.isHTML); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", part.name, err))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplatePartErrors(t *testing.T) {
+	r := NewRenderer("https://city.example.gov", "Civic OS", time.UTC, nil, "")
+
+	good := &NotificationTemplate{
+		Subject: "Reservation {{.Entity.display_name}}",
+		HTML:    `<p>{{formatDateTime .Entity.starts_at}}</p>`,
+		Text:    "{{.Entity.display_name}}",
+	}
+	if problems := templatePartErrors(r, good); len(problems) != 0 {
+		t.Errorf("valid template: %v", problems)
+	}
+
+	// An unclosed action and a function the renderer doesn't have
+	bad := &NotificationTemplate{
+		Subject: "Reservation {{.Entity.display_name",
+		HTML:    `<p>{{formatLegacyDate .Entity.starts_at}}</p>`,
+		Text:    "ok",
+		SMS:     "ok",
+	}
+	problems := templatePartErrors(r, bad)
+	if len(problems) != 2 || !strings.HasPrefix(problems[0], "subject: ") || !strings.HasPrefix(problems[1], "html: ") {
+		t.Errorf("problems = %v, want subject and html", problems)
+	}
+}
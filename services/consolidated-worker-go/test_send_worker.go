@@ -0,0 +1,151 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Template Test Sends (v0.137.0)
+//
+// send_test_notification() queues test_send_notification so a template
+// author can see a template in their own mail client before it goes to
+// residents. The worker renders the saved template with sample data, or with
+// a record read as the author (the same way as live previews), puts
+// testSubjectPrefix in front of the subject and emails the address on the
+// author's account. Nothing else: no preferences, no dedup, no engagement
+// tracking, no notification_log or archive row.
+//
+// The job names the user, never an address, so it can't be aimed at anyone
+// else. A missing template or address, a rendering error or a suppressed
+// address cancels the job with the reason; SMTP trouble is retried.
+// ============================================================================
+
+// testSubjectPrefix marks test sends in the recipient's inbox
+const testSubjectPrefix = "[TEST] "
+
+// TestSendArgs renders a template and emails it to the requesting admin
+type TestSendArgs struct {
+	TemplateName     string          `json:"template_name"`
+	UserID           string          `json:"user_id"`
+	SampleEntityData json.RawMessage `json:"sample_entity_data,omitempty"`
+
+	// Render against this row instead, read with the requester's roles
+	EntityType string   `json:"entity_type,omitempty"`
+	EntityID   string   `json:"entity_id,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+}
+
+// Kind returns the job type identifier
+func (TestSendArgs) Kind() string { return "test_send_notification" }
+
+// InsertOpts returns job insertion options
+func (TestSendArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "notifications",
+		MaxAttempts: 3,
+		Priority:    4, // The author is waiting for it
+	}
+}
+
+// TestSendWorker emails test renders of templates to their authors
+type TestSendWorker struct {
+	river.WorkerDefaults[TestSendArgs]
+	dbPool     *pgxpool.Pool
+	renderer   *Renderer
+	smtpConfig *SMTPConfig
+}
+
+// Work renders the template and sends it to the requesting user's address
+func (w *TestSendWorker) Work(ctx context.Context, job *river.Job[TestSendArgs]) error {
+	startTime := time.Now()
+	log.Printf("[Job %d] Starting test send (attempt %d/%d): template=%s, user=%s",
+		job.ID, job.Attempt, job.MaxAttempts, job.Args.TemplateName, job.Args.UserID)
+
+	template, err := loadTemplateFromDB(ctx, w.dbPool, job.Args.TemplateName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return river.JobCancel(err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load template: %w", err)
+	}
+
+	toEmail, err := w.loadUserEmail(ctx, job.Args.UserID)
+	if err != nil {
+		return err
+	}
+
+	entityData := job.Args.SampleEntityData
+	if job.Args.EntityType != "" {
+		data, err := loadLiveEntity(ctx, w.dbPool, job.Args.EntityType, job.Args.EntityID, job.Args.UserID, job.Args.Roles)
+		var entityErr *previewEntityError
+		if errors.As(err, &entityErr) {
+			return river.JobCancel(entityErr)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load entity: %w", err)
+		}
+		entityData = data
+	}
+	if len(entityData) == 0 {
+		entityData = json.RawMessage(`{}`)
+	}
+
+	rendered, err := w.renderer.RenderTemplate(template, entityData)
+	if err != nil {
+		log.Printf("[Job %d] Rendering error: %v", job.ID, err)
+		return river.JobCancel(fmt.Errorf("rendering error: %w", err))
+	}
+	rendered.Subject = testSubject(rendered.Subject)
+
+	// Not threaded: a test shouldn't join the record's real thread
+	server, err := sendEmailSMTP(ctx, w.smtpConfig, []string{toEmail}, nil, rendered, "", "", "")
+	if err != nil {
+		if isTransientError(err) {
+			log.Printf("[Job %d] Transient error, will retry: %v", job.ID, err)
+			return err
+		}
+		log.Printf("[Job %d] Permanent error, not retrying: %v", job.ID, err)
+		return river.JobCancel(err)
+	}
+
+	if err := river.RecordOutput(ctx, map[string]string{"to": toEmail, "email_provider": server}); err != nil {
+		log.Printf("[Job %d] Failed to record output: %v", job.ID, err)
+	}
+	log.Printf("[Job %d] ✓ Test of %s sent to %s in %v", job.ID, job.Args.TemplateName, toEmail, time.Since(startTime))
+	return nil
+}
+
+// loadUserEmail returns the address on the user's account
+func (w *TestSendWorker) loadUserEmail(ctx context.Context, userID string) (string, error) {
+	var email string
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT COALESCE(email, '') FROM metadata.civic_os_users_private WHERE id = $1::TEXT::UUID
+	`, userID).Scan(&email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("failed to load user: %w", err)
+	}
+	if email == "" {
+		return "", river.JobCancel(fmt.Errorf("user %s has no email address", userID))
+	}
+	return email, nil
+}
+
+// testSubject marks a rendered subject as a test, once
+func testSubject(subject string) string {
+	if strings.HasPrefix(subject, testSubjectPrefix) {
+		return subject
+	}
+	return testSubjectPrefix + subject
+}
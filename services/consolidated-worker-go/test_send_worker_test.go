@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestTestSubject(t *testing.T) {
+	for subject, want := range map[string]string{
+		"Your permit was approved":        "[TEST] Your permit was approved",
+		"[TEST] Your permit was approved": "[TEST] Your permit was approved",
+		"":                                "[TEST] ",
+	} {
+		if got := testSubject(subject); got != want {
+			t.Errorf("testSubject(%q) = %q, want %q", subject, got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Job Definition: Thumbnail Backfill
+// ============================================================================
+
+// thumbnailBackfillBatchSize is the number of files checked per backfill job
+const thumbnailBackfillBatchSize = 500
+
+// ThumbnailBackfillArgs defines the arguments for one backfill batch.
+// Queued by public.queue_thumbnail_backfill() with an empty cursor; each batch
+// queues the next one after the last file it checked.
+type ThumbnailBackfillArgs struct {
+	AfterID string `json:"after_id,omitempty"` // metadata.files.id cursor (exclusive)
+}
+
+// Kind returns the job type identifier for River routing
+func (ThumbnailBackfillArgs) Kind() string {
+	return "thumbnail_backfill"
+}
+
+// InsertOpts specifies River job insertion options
+func (ThumbnailBackfillArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "thumbnails",
+		MaxAttempts: 5,
+		Priority:    4, // Below uploads (1) and the regeneration jobs it queues (3)
+	}
+}
+
+// ============================================================================
+// Worker Implementation: Thumbnail Backfill Worker
+// ============================================================================
+
+// ThumbnailBackfillWorker finds completed files whose thumbnail_params differ
+// from the current profile, or that haven't been analysed yet, and queues
+// thumbnail_generate for them. Comparing
+// here, instead of queuing every file, means an unchanged profile costs one
+// query per batch and no S3 traffic.
+type ThumbnailBackfillWorker struct {
+	river.WorkerDefaults[ThumbnailBackfillArgs]
+	dbPool *pgxpool.Pool
+	jobs   *JobEnqueuer
+	sizes  []ThumbnailSize
+}
+
+// Work checks one batch of files
+func (w *ThumbnailBackfillWorker) Work(ctx context.Context, job *river.Job[ThumbnailBackfillArgs]) error {
+	log.Printf("[Job %d] Thumbnail backfill batch (after: %q)", job.ID, job.Args.AfterID)
+
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT id::text, file_type, thumbnail_params,
+		       s3_thumbnail_small_key, s3_thumbnail_medium_key, s3_thumbnail_large_key,
+		       blurhash IS NOT NULL, perceptual_hash IS NOT NULL
+		FROM metadata.files
+		WHERE thumbnail_status = 'completed'
+		  AND ($1 = '' OR id > $1::uuid)
+		ORDER BY id
+		LIMIT $2
+	`, job.Args.AfterID, thumbnailBackfillBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		checked  int
+		lastID   string
+		outdated []string
+	)
+	for rows.Next() {
+		var id, fileType string
+		var rawParams []byte
+		var smallKey, mediumKey, largeKey *string
+		var hasPlaceholder, hasHash bool
+		if err := rows.Scan(&id, &fileType, &rawParams, &smallKey, &mediumKey, &largeKey, &hasPlaceholder, &hasHash); err != nil {
+			return fmt.Errorf("failed to scan file: %w", err)
+		}
+		checked++
+		lastID = id
+
+		pdf := isPDFType(fileType)
+		profile := thumbnailProfile(w.sizes, pdf)
+		if needsAnalysis(pdf, hasPlaceholder, hasHash) || len(outdatedSizes(w.sizes, profile, parseThumbnailParams(rawParams), thumbnailKeyMap(smallKey, mediumKey, largeKey))) > 0 {
+			outdated = append(outdated, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read files: %w", err)
+	}
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Same job as file_uploaded queues, at lower priority than uploads; files
+	// that already have a thumbnail job waiting are skipped as duplicates
+	params := make([]river.InsertManyParams, len(outdated))
+	for i, id := range outdated {
+		params[i] = river.InsertManyParams{
+			Args:       ThumbnailArgs{FileID: id},
+			InsertOpts: &river.InsertOpts{Priority: 3},
+		}
+	}
+	if _, err := w.jobs.InsertManyTx(ctx, tx, params); err != nil {
+		return fmt.Errorf("failed to queue thumbnail jobs: %w", err)
+	}
+
+	// A full batch means there may be more files after lastID
+	if checked == thumbnailBackfillBatchSize {
+		if _, err := w.jobs.InsertTx(ctx, tx, ThumbnailBackfillArgs{AfterID: lastID}, nil); err != nil {
+			return fmt.Errorf("failed to queue next backfill batch: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+
+	log.Printf("[Job %d] ✓ Checked %d files, queued %d for regeneration", job.ID, checked, len(outdated))
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// ============================================================================
+// Thumbnail Error Classification
+//
+// A thumbnail job used to retry every error, so a corrupt or truncated upload
+// spent all 25 attempts over several days before the file was marked failed.
+// Errors are now sorted where they happen:
+//
+//   - The original can't be decoded (image decoder, libvips loader, pdftoppm
+//     unable to open the PDF) or is over the PDF rendering limits (see
+//     pdf_render.go): retrying reads the same bytes, so the error is wrapped
+//     in unsupportedFileError. The job records thumbnail_status
+//     'unsupported' and is cancelled.
+//   - Anything else (S3, network, database, a pdftoppm that timed out or was
+//     killed from outside, libvips out of memory) stays a plain error and
+//     River retries it with backoff.
+// ============================================================================
+
+// unsupportedFileError marks an original that no retry can render
+type unsupportedFileError struct {
+	err error
+}
+
+func (e *unsupportedFileError) Error() string { return e.err.Error() }
+
+func (e *unsupportedFileError) Unwrap() error { return e.err }
+
+// unsupportedFile wraps err as permanent; nil stays nil
+func unsupportedFile(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &unsupportedFileError{err: err}
+}
+
+// isUnsupportedFile reports whether err, or an error it wraps, is permanent
+func isUnsupportedFile(err error) bool {
+	var unsupported *unsupportedFileError
+	return errors.As(err, &unsupported)
+}
+
+// vipsDecodeErrors are fragments of libvips and bimg messages for input that
+// can't be loaded. Other libvips errors (out of memory, cache, threads) are
+// retried.
+var vipsDecodeErrors = []string{
+	"unsupported image format",
+	"image buffer is empty",
+	"is not in a known format",
+	"not a known file format",
+	"premature end",
+	"corrupt",
+	"truncated",
+	"invalid",
+	"huffman",
+	"vipsforeignload",
+	"vipsjpeg",
+	"vipspng",
+	"gifload",
+	"heifload",
+	"webpload",
+	"tiff2vips",
+}
+
+// classifyVipsError wraps libvips load failures as unsupportedFile
+func classifyVipsError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range vipsDecodeErrors {
+		if strings.Contains(msg, fragment) {
+			return unsupportedFile(err)
+		}
+	}
+	return err
+}
+
+// pdftoppm (and pdfinfo) exit codes for a PDF it can't read: 1 is "error opening a PDF
+// file" (not a PDF, damaged beyond repair), 3 is a permissions error
+// (encrypted). 2 (output file) and 99 (other) may pass on a retry, and a
+// pdftoppm killed by a signal has no exit code.
+var pdftoppmUnreadableExitCodes = map[int]bool{1: true, 3: true}
+
+// classifyPdftoppmError wraps pdftoppm failures caused by the PDF itself as
+// unsupportedFile
+func classifyPdftoppmError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && pdftoppmUnreadableExitCodes[exitErr.ExitCode()] {
+		return unsupportedFile(err)
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestClassifyVipsError(t *testing.T) {
+	tests := []struct {
+		msg         string
+		unsupported bool
+	}{
+		{"Unsupported image format", true},
+		{"Image buffer is empty", true},
+		{"VipsForeignLoad: buffer is not in a known format", true},
+		{"VipsJpeg: Premature end of JPEG file", true},
+		{"vipspng: libpng read error: IDAT: invalid distance too far back", true},
+		{"out of memory -- size == 1073741824", false},
+		{"vips_image_get: field \"orientation\" not found", false},
+	}
+	for _, tt := range tests {
+		err := classifyVipsError(errors.New(tt.msg))
+		if got := isUnsupportedFile(err); got != tt.unsupported {
+			t.Errorf("classifyVipsError(%q) unsupported = %v, want %v", tt.msg, got, tt.unsupported)
+		}
+	}
+	if classifyVipsError(nil) != nil {
+		t.Error("classifyVipsError(nil) != nil")
+	}
+}
+
+func TestClassifyPdftoppmError(t *testing.T) {
+	exitErr := func(code int) error {
+		err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+		if err == nil {
+			t.Fatalf("exit %d: no error", code)
+		}
+		return fmt.Errorf("failed to run pdftoppm: %w", err)
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh unavailable")
+	}
+
+	for code, unsupported := range map[int]bool{1: true, 3: true, 2: false, 99: false} {
+		if got := isUnsupportedFile(classifyPdftoppmError(exitErr(code))); got != unsupported {
+			t.Errorf("exit %d: unsupported = %v, want %v", code, got, unsupported)
+		}
+	}
+	if isUnsupportedFile(classifyPdftoppmError(errors.New("exec: \"pdftoppm\": executable file not found"))) {
+		t.Error("a missing pdftoppm should be retried")
+	}
+}
+
+func TestUnsupportedFileWrapping(t *testing.T) {
+	base := errors.New("decode image: unexpected EOF")
+	err := fmt.Errorf("failed to generate small thumbnail: %w", unsupportedFile(base))
+	if !isUnsupportedFile(err) || !errors.Is(err, base) {
+		t.Errorf("wrapped error lost its class or cause: %v", err)
+	}
+	if unsupportedFile(nil) != nil {
+		t.Error("unsupportedFile(nil) != nil")
+	}
+}
@@ -3,11 +3,12 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -15,7 +16,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/h2non/bimg"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riverqueue/river"
 )
@@ -41,6 +41,10 @@ func (ThumbnailArgs) InsertOpts() river.InsertOpts {
 		Queue:       "thumbnails",
 		MaxAttempts: 25,
 		Priority:    1,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:  true,
+			ByState: notifyJobUniqueStates,
+		},
 	}
 }
 
@@ -56,12 +60,112 @@ type ThumbnailSize struct {
 	Quality int
 }
 
+// thumbnailSizes is the default profile; main.go applies THUMBNAIL_QUALITY_* overrides
 var thumbnailSizes = []ThumbnailSize{
 	{Name: "small", Width: 150, Height: 150, Quality: 80},
 	{Name: "medium", Width: 400, Height: 400, Quality: 85},
 	{Name: "large", Width: 800, Height: 800, Quality: 90},
 }
 
+// ThumbnailParams records how one thumbnail was generated. Stored per size in
+// metadata.files.thumbnail_params so a profile change only regenerates the
+// sizes it affects.
+type ThumbnailParams struct {
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Quality int    `json:"quality"`
+	Format  string `json:"format"` // "jpeg" for images, "png" for PDF first pages
+}
+
+// thumbnailProfile returns the parameters the given sizes produce for a file type
+func thumbnailProfile(sizes []ThumbnailSize, pdf bool) map[string]ThumbnailParams {
+	format := "jpeg"
+	if pdf {
+		format = "png"
+	}
+	profile := make(map[string]ThumbnailParams, len(sizes))
+	for _, size := range sizes {
+		profile[size.Name] = ThumbnailParams{Width: size.Width, Height: size.Height, Quality: size.Quality, Format: format}
+	}
+	return profile
+}
+
+// outdatedSizes returns the sizes whose stored parameters differ from the
+// profile or whose thumbnail key is missing
+func outdatedSizes(sizes []ThumbnailSize, profile, stored map[string]ThumbnailParams, existingKeys map[string]string) []ThumbnailSize {
+	var outdated []ThumbnailSize
+	for _, size := range sizes {
+		params, ok := stored[size.Name]
+		if !ok || params != profile[size.Name] || existingKeys[thumbnailKeyColumn(size.Name)] == "" {
+			outdated = append(outdated, size)
+		}
+	}
+	return outdated
+}
+
+// thumbnailObjectKey returns the S3 key of one thumbnail size, next to the
+// original: {entity_type}/{entity_id}/{file_id}/thumb-{size}.jpg (or .png)
+func thumbnailObjectKey(originalKey, sizeName string, params ThumbnailParams) string {
+	ext := "jpg"
+	if params.Format == "png" {
+		ext = "png"
+	}
+	return fmt.Sprintf("%s/thumb-%s.%s", filepath.Dir(originalKey), sizeName, ext)
+}
+
+// thumbnailObjectMetadata is stored on each uploaded thumbnail so a retry can
+// tell whether an earlier attempt already produced it from the same original
+// with the same parameters
+func thumbnailObjectMetadata(params ThumbnailParams, sourceSum string) map[string]string {
+	return map[string]string{
+		"thumbnail-params": fmt.Sprintf("%dx%d-q%d-%s", params.Width, params.Height, params.Quality, params.Format),
+		"source-sha256":    sourceSum,
+	}
+}
+
+// thumbnailObjectMatches reports whether an existing thumbnail's metadata
+// matches what this job would upload. Objects written before the metadata
+// was added never match.
+func thumbnailObjectMatches(metadata map[string]string, params ThumbnailParams, sourceSum string) bool {
+	want := thumbnailObjectMetadata(params, sourceSum)
+	for k, v := range want {
+		if metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// thumbnailKeyColumn maps a size name to its key in the thumbnail key map
+func thumbnailKeyColumn(sizeName string) string {
+	return fmt.Sprintf("thumbnail_%s_key", sizeName)
+}
+
+// parseThumbnailParams decodes metadata.files.thumbnail_params. NULL or
+// malformed values decode to nil, which marks every size as outdated.
+func parseThumbnailParams(raw []byte) map[string]ThumbnailParams {
+	if len(raw) == 0 {
+		return nil
+	}
+	var stored map[string]ThumbnailParams
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		log.Printf("[Thumbnail] Ignoring malformed thumbnail_params: %v", err)
+		return nil
+	}
+	return stored
+}
+
+// thumbnailKeyMap collects the non-NULL thumbnail key columns
+func thumbnailKeyMap(small, medium, large *string) map[string]string {
+	keys := make(map[string]string)
+	for name, key := range map[string]*string{"small": small, "medium": medium, "large": large} {
+		if key != nil && *key != "" {
+			keys[thumbnailKeyColumn(name)] = *key
+		}
+	}
+	return keys
+}
+
 // ============================================================================
 // Worker Implementation: Thumbnail Worker
 // ============================================================================
@@ -69,62 +173,175 @@ var thumbnailSizes = []ThumbnailSize{
 // ThumbnailWorker implements River's Worker interface for thumbnail generation
 type ThumbnailWorker struct {
 	river.WorkerDefaults[ThumbnailArgs]
-	s3Client *s3.Client
-	dbPool   *pgxpool.Pool
+	s3Client  *s3.Client
+	dbPool    *pgxpool.Pool
+	sizes     []ThumbnailSize
+	originals *OriginalStore  // shared with other workers that read originals
+	images    ImageProcessor  // libvips or pure Go (IMAGE_PROCESSOR)
+	jobs      *JobEnqueuer    // queues find_duplicate_files
+	cdn       *CDNURLs        // signs thumbnail URLs; nil = public-read thumbnails
+	pdfLimits PDFRenderLimits // bounds pdfinfo and pdftoppm (PDF_RENDER_*, PDF_MAX_*)
 }
 
 // Work executes the thumbnail generation job
+//
+// Files that already have completed thumbnails (re-queued by the backfill)
+// only regenerate the sizes whose stored parameters differ from the current
+// profile; if none differ and the file has been analysed (placeholder and,
+// for images, perceptual hash), the original isn't even downloaded.
+//
+// Thumbnails go to fixed keys and the database update sets every column
+// outright, so each step can safely run again. A retry (say, after the update
+// failed) reuses the thumbnails an earlier attempt uploaded when their object
+// metadata shows the same original and parameters, and only regenerates the
+// rest.
 func (w *ThumbnailWorker) Work(ctx context.Context, job *river.Job[ThumbnailArgs]) error {
 	startTime := time.Now()
 	log.Printf("[Job %d] Starting thumbnail generation job (attempt %d/%d)", job.ID, job.Attempt, job.MaxAttempts)
 
 	// Query database for file metadata (single source of truth)
-	var bucket, s3Key, fileType string
-	query := `SELECT s3_bucket, s3_original_key, file_type FROM metadata.files WHERE id = $1`
-	err := w.dbPool.QueryRow(ctx, query, job.Args.FileID).Scan(&bucket, &s3Key, &fileType)
+	var bucket, s3Key, fileType, status string
+	var rawParams []byte
+	var smallKey, mediumKey, largeKey *string
+	var entityType, entityID string
+	var hasPlaceholder, hasHash bool
+	query := `
+		SELECT s3_bucket, s3_original_key, file_type, COALESCE(thumbnail_status, 'pending'),
+		       thumbnail_params, s3_thumbnail_small_key, s3_thumbnail_medium_key, s3_thumbnail_large_key,
+		       entity_type, entity_id, blurhash IS NOT NULL, perceptual_hash IS NOT NULL
+		FROM metadata.files WHERE id = $1`
+	err := w.dbPool.QueryRow(ctx, query, job.Args.FileID).Scan(
+		&bucket, &s3Key, &fileType, &status, &rawParams, &smallKey, &mediumKey, &largeKey,
+		&entityType, &entityID, &hasPlaceholder, &hasHash)
 	if err != nil {
 		log.Printf("[Job %d] Error querying file metadata: %v", job.ID, err)
 		return fmt.Errorf("failed to query file metadata from database: %w", err)
 	}
 	log.Printf("[Job %d] File: %s (type: %s, bucket: %s)", job.ID, s3Key, fileType, bucket)
 
-	// Download original file from S3
-	log.Printf("[Job %d] Downloading original from S3...", job.ID)
-	fileData, err := w.downloadFromS3(ctx, bucket, s3Key)
+	isPDF := isPDFType(fileType)
+	profile := thumbnailProfile(w.sizes, isPDF)
+	existingKeys := thumbnailKeyMap(smallKey, mediumKey, largeKey)
+
+	sizes := w.sizes
+	if status == "completed" {
+		sizes = outdatedSizes(w.sizes, profile, parseThumbnailParams(rawParams), existingKeys)
+		switch {
+		case len(sizes) > 0:
+			log.Printf("[Job %d] Regenerating %d of %d thumbnail sizes", job.ID, len(sizes), len(w.sizes))
+		case !needsAnalysis(isPDF, hasPlaceholder, hasHash):
+			log.Printf("[Job %d] ✓ Thumbnails already match current profile, skipping", job.ID)
+			return nil
+		default:
+			log.Printf("[Job %d] Thumbnails current, analysing image only", job.ID)
+		}
+	}
+
+	fileData, err := w.getOriginal(ctx, job.ID, bucket, s3Key)
 	if err != nil {
 		log.Printf("[Job %d] Error downloading file: %v", job.ID, err)
 		return fmt.Errorf("failed to download file from S3: %w", err)
 	}
-	log.Printf("[Job %d] ✓ Downloaded %d bytes", job.ID, len(fileData))
 
-	// Generate thumbnails based on file type
+	sum := sha256.Sum256(fileData)
+	sourceSum := hex.EncodeToString(sum[:])
+
+	// An earlier attempt may have uploaded some sizes before failing
+	uploaded := make(map[string]string)
+	if job.Attempt > 1 && len(sizes) > 0 {
+		uploaded, sizes = w.uploadedThumbnails(ctx, bucket, s3Key, sizes, profile, sourceSum)
+		if len(uploaded) > 0 {
+			log.Printf("[Job %d] ✓ Reusing %d thumbnail(s) from an earlier attempt", job.ID, len(uploaded))
+		}
+	}
+
+	// Generate thumbnails based on file type; PDFs from their first page
 	var thumbnailKeys map[string]string
-	if isPDFType(fileType) {
-		thumbnailKeys, err = w.generatePDFThumbnails(ctx, job.ID, fileData, s3Key, bucket)
+	source := fileData
+	if isPDF {
+		source, err = renderPDFFirstPage(ctx, job.ID, fileData, w.pdfLimits)
+		if err == nil {
+			thumbnailKeys, err = w.generatePDFThumbnails(ctx, job.ID, source, s3Key, bucket, sizes, profile, sourceSum)
+		}
 	} else {
-		thumbnailKeys, err = w.generateImageThumbnails(ctx, job.ID, fileData, s3Key, bucket)
+		thumbnailKeys, err = w.generateImageThumbnails(ctx, job.ID, source, s3Key, bucket, sizes, profile, sourceSum)
 	}
 
+	if err != nil && isUnsupportedFile(err) {
+		// Retrying reads the same bytes: stop instead of spending the attempts
+		log.Printf("[Job %d] File cannot be rendered, not retrying: %v", job.ID, err)
+		if status != "completed" {
+			if updateErr := w.markThumbnailUnsupported(ctx, job.Args.FileID, err.Error()); updateErr != nil {
+				log.Printf("[Job %d] Error recording unsupported file: %v", job.ID, updateErr)
+				return fmt.Errorf("failed to record unsupported file: %w", updateErr)
+			}
+		}
+		return river.JobCancel(err)
+	}
 	if err != nil {
 		log.Printf("[Job %d] Error generating thumbnails: %v", job.ID, err)
-		// Update database with error status
-		w.updateThumbnailStatus(ctx, job.Args.FileID, "error", nil)
+		// A failed regeneration leaves the previous (still valid) thumbnails in place
+		if status != "completed" {
+			if updateErr := w.markThumbnailFailed(ctx, job.Args.FileID, err.Error()); updateErr != nil {
+				log.Printf("[Job %d] Error recording failure: %v", job.ID, updateErr)
+			}
+		}
 		return fmt.Errorf("failed to generate thumbnails: %w", err)
 	}
 
-	// Update database with thumbnail keys and completed status
-	err = w.updateThumbnailStatus(ctx, job.Args.FileID, "completed", thumbnailKeys)
+	// Keep keys for sizes uploaded by an earlier attempt or already current
+	for column, key := range uploaded {
+		if _, ok := thumbnailKeys[column]; !ok {
+			thumbnailKeys[column] = key
+		}
+	}
+	for column, key := range existingKeys {
+		if _, ok := thumbnailKeys[column]; !ok {
+			thumbnailKeys[column] = key
+		}
+	}
+
+	// A failed analysis only costs the blurred preview and duplicate checks
+	analysis, err := analyseImage(w.images, source)
+	if err != nil {
+		log.Printf("[Job %d] Warning: could not analyse image: %v", job.ID, err)
+	} else if isPDF {
+		// Forms and letters share first pages, so PDFs aren't compared
+		analysis.PerceptualHash = nil
+	}
+
+	// Update database with thumbnail keys, parameters, analysis, and completed
+	// status; a new hash also queues a duplicate scan of the file's record
+	var scan *FindDuplicateFilesArgs
+	if analysis != nil && analysis.PerceptualHash != nil {
+		scan = &FindDuplicateFilesArgs{EntityType: entityType, EntityID: entityID}
+	}
+	err = w.updateThumbnailStatus(ctx, job.Args.FileID, "completed", thumbnailKeys, profile, analysis, scan)
 	if err != nil {
 		log.Printf("[Job %d] Error updating database: %v", job.ID, err)
 		return fmt.Errorf("failed to update database: %w", err)
 	}
 
+	// Thumbnails behind a signing CDN aren't public; the refresh task signs
+	// any file missed here
+	if w.cdn.Serves(bucket) {
+		if err := w.cdn.SignFile(ctx, w.dbPool, job.Args.FileID, thumbnailKeys); err != nil {
+			log.Printf("[Job %d] Warning: could not sign CDN URLs: %v", job.ID, err)
+		}
+	}
+
 	duration := time.Since(startTime)
 	log.Printf("[Job %d] ✓ Completed successfully in %v", job.ID, duration)
 
 	return nil
 }
 
+// needsAnalysis reports whether a file lacks a placeholder or, for images,
+// a perceptual hash
+func needsAnalysis(pdf, hasPlaceholder, hasHash bool) bool {
+	return !hasPlaceholder || (!pdf && !hasHash)
+}
+
 // isPDFType checks if a file type string represents a PDF.
 // The database stores full MIME types from the browser (e.g., "application/pdf")
 // but we also handle the short name "pdf" for robustness.
@@ -133,47 +350,71 @@ func isPDFType(fileType string) bool {
 	return ft == "application/pdf" || ft == "application/x-pdf" || ft == "pdf"
 }
 
-// generateImageThumbnails creates thumbnails for image files using bimg (libvips)
-func (w *ThumbnailWorker) generateImageThumbnails(ctx context.Context, jobID int64, imageData []byte, originalKey, bucket string) (map[string]string, error) {
+// getOriginal returns the original file, from the local cache when possible
+func (w *ThumbnailWorker) getOriginal(ctx context.Context, jobID int64, bucket, key string) ([]byte, error) {
+	data, cached, err := w.originals.Fetch(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		log.Printf("[Job %d] ✓ Original served from local cache (%d bytes)", jobID, len(data))
+	} else {
+		log.Printf("[Job %d] ✓ Downloaded %d bytes", jobID, len(data))
+	}
+	return data, nil
+}
+
+// uploadedThumbnails splits sizes into those already in S3 with matching
+// metadata (returned as keys) and those still to generate. A failed lookup
+// just regenerates that size.
+func (w *ThumbnailWorker) uploadedThumbnails(ctx context.Context, bucket, originalKey string, sizes []ThumbnailSize, profile map[string]ThumbnailParams, sourceSum string) (map[string]string, []ThumbnailSize) {
+	uploaded := make(map[string]string)
+	var remaining []ThumbnailSize
+	for _, size := range sizes {
+		key := thumbnailObjectKey(originalKey, size.Name, profile[size.Name])
+		head, err := w.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err == nil && thumbnailObjectMatches(head.Metadata, profile[size.Name], sourceSum) {
+			uploaded[thumbnailKeyColumn(size.Name)] = key
+		} else {
+			remaining = append(remaining, size)
+		}
+	}
+	return uploaded, remaining
+}
+
+// generateImageThumbnails creates thumbnails for image files
+func (w *ThumbnailWorker) generateImageThumbnails(ctx context.Context, jobID int64, imageData []byte, originalKey, bucket string, sizes []ThumbnailSize, profile map[string]ThumbnailParams, sourceSum string) (map[string]string, error) {
 	thumbnailKeys := make(map[string]string)
-	basePath := filepath.Dir(originalKey)
 
-	for _, size := range thumbnailSizes {
+	for _, size := range sizes {
 		log.Printf("[Job %d] Generating %s thumbnail (%dx%d)...", jobID, size.Name, size.Width, size.Height)
 
-		// Generate thumbnail with proper centering and background handling
-		options := bimg.Options{
-			Width:      size.Width,
-			Height:     size.Height,
-			Embed:      true,                               // Maintain aspect ratio, center within dimensions
-			Gravity:    bimg.GravityCentre,                 // Center the image
-			Background: bimg.Color{R: 255, G: 255, B: 255}, // White background for transparent areas
-			Type:       bimg.JPEG,
-			Quality:    size.Quality,
-		}
-
-		thumbnail, err := bimg.NewImage(imageData).Process(options)
+		// Generate thumbnail centred on a white square (letterboxed)
+		thumbnail, err := w.images.Embed(imageData, size.Width, size.Height, size.Quality)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate %s thumbnail: %w", size.Name, err)
 		}
 
 		// Upload to S3
-		// Expected format: {entity_type}/{entity_id}/{file_id}/thumb-{size}.jpg
-		thumbnailKey := fmt.Sprintf("%s/thumb-%s.jpg", basePath, size.Name)
-		err = w.uploadToS3(ctx, bucket, thumbnailKey, thumbnail)
+		thumbnailKey := thumbnailObjectKey(originalKey, size.Name, profile[size.Name])
+		err = w.uploadToS3(ctx, bucket, thumbnailKey, thumbnail, thumbnailObjectMetadata(profile[size.Name], sourceSum))
 		if err != nil {
 			return nil, fmt.Errorf("failed to upload %s thumbnail: %w", size.Name, err)
 		}
 
-		thumbnailKeys[fmt.Sprintf("thumbnail_%s_key", size.Name)] = thumbnailKey
+		thumbnailKeys[thumbnailKeyColumn(size.Name)] = thumbnailKey
 		log.Printf("[Job %d] ✓ %s thumbnail uploaded: %s", jobID, size.Name, thumbnailKey)
 	}
 
 	return thumbnailKeys, nil
 }
 
-// generatePDFThumbnails creates thumbnails for PDF files (first page only)
-func (w *ThumbnailWorker) generatePDFThumbnails(ctx context.Context, jobID int64, pdfData []byte, originalKey, bucket string) (map[string]string, error) {
+// renderPDFFirstPage converts the first page of a PDF to a PNG image. pdfinfo
+// checks the PDF against the limits first, and both tools run under them.
+func renderPDFFirstPage(ctx context.Context, jobID int64, pdfData []byte, limits PDFRenderLimits) ([]byte, error) {
 	log.Printf("[Job %d] Converting PDF first page to image...", jobID)
 
 	// Write PDF to temp file
@@ -189,15 +430,28 @@ func (w *ThumbnailWorker) generatePDFThumbnails(ctx context.Context, jobID int64
 	}
 	tempPDF.Close()
 
+	// Page count and size, to reject PDFs too large to render
+	out, err := limits.Run(ctx, "pdfinfo", tempPDF.Name())
+	if err != nil {
+		return nil, err
+	}
+	info, err := parsePDFInfo(out)
+	if err != nil {
+		return nil, unsupportedFile(fmt.Errorf("failed to read PDF info: %w", err))
+	}
+	if err := limits.Check(info); err != nil {
+		return nil, err
+	}
+
 	// Use pdftoppm to convert first page to PNG image
 	// PNG is used instead of PPM because bimg/libvips on Alpine may not
-	// include a PPM loader, whereas PNG is universally supported.
+	// include a PPM loader (and the Go backend has none), whereas PNG is
+	// universally supported.
 	tempImage := tempPDF.Name() + ".png"
 	defer os.Remove(tempImage)
 
-	cmd := exec.Command("pdftoppm", "-png", "-f", "1", "-l", "1", "-singlefile", "-r", "300", tempPDF.Name(), tempPDF.Name())
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to run pdftoppm: %w", err)
+	if _, err := limits.Run(ctx, "pdftoppm", "-png", "-f", "1", "-l", "1", "-singlefile", "-r", "300", tempPDF.Name(), tempPDF.Name()); err != nil {
+		return nil, err
 	}
 
 	// Read the converted image
@@ -207,79 +461,64 @@ func (w *ThumbnailWorker) generatePDFThumbnails(ctx context.Context, jobID int64
 	}
 
 	log.Printf("[Job %d] ✓ PDF converted to image (%d bytes)", jobID, len(imageData))
+	return imageData, nil
+}
 
+// generatePDFThumbnails creates thumbnails for PDF files from their first
+// page, rendered by renderPDFFirstPage
+func (w *ThumbnailWorker) generatePDFThumbnails(ctx context.Context, jobID int64, imageData []byte, originalKey, bucket string, sizes []ThumbnailSize, profile map[string]ThumbnailParams, sourceSum string) (map[string]string, error) {
 	// Generate PDF thumbnails with proportional resize (no letterboxing).
 	// Unlike image thumbnails which use Embed (square with white background),
 	// PDF pages are typically portrait/landscape and look better without padding.
 	// Output as PNG to preserve transparency for non-white page backgrounds.
 	thumbnailKeys := make(map[string]string)
-	basePath := filepath.Dir(originalKey)
 
-	for _, size := range thumbnailSizes {
+	for _, size := range sizes {
 		log.Printf("[Job %d] Generating %s thumbnail (%dx%d)...", jobID, size.Name, size.Width, size.Height)
 
-		options := bimg.Options{
-			Width:   size.Width,
-			Height:  size.Height,
-			Type:    bimg.PNG,
-			Quality: size.Quality,
-		}
-
-		thumbnail, err := bimg.NewImage(imageData).Process(options)
+		thumbnail, err := w.images.Fit(imageData, size.Width, size.Height, size.Quality)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate %s thumbnail: %w", size.Name, err)
 		}
 
-		thumbnailKey := fmt.Sprintf("%s/thumb-%s.png", basePath, size.Name)
-		err = w.uploadToS3(ctx, bucket, thumbnailKey, thumbnail)
+		thumbnailKey := thumbnailObjectKey(originalKey, size.Name, profile[size.Name])
+		err = w.uploadToS3(ctx, bucket, thumbnailKey, thumbnail, thumbnailObjectMetadata(profile[size.Name], sourceSum))
 		if err != nil {
 			return nil, fmt.Errorf("failed to upload %s thumbnail: %w", size.Name, err)
 		}
 
-		thumbnailKeys[fmt.Sprintf("thumbnail_%s_key", size.Name)] = thumbnailKey
+		thumbnailKeys[thumbnailKeyColumn(size.Name)] = thumbnailKey
 		log.Printf("[Job %d] ✓ %s thumbnail uploaded: %s", jobID, size.Name, thumbnailKey)
 	}
 
 	return thumbnailKeys, nil
 }
 
-// downloadFromS3 retrieves a file from S3
-func (w *ThumbnailWorker) downloadFromS3(ctx context.Context, bucket, key string) ([]byte, error) {
-	result, err := w.s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get object from S3: %w", err)
-	}
-	defer result.Body.Close()
-
-	data, err := io.ReadAll(result.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read S3 object body: %w", err)
-	}
-
-	return data, nil
-}
-
-// uploadToS3 uploads data to S3 with content type derived from the key extension
-func (w *ThumbnailWorker) uploadToS3(ctx context.Context, bucket, key string, data []byte) error {
+// uploadToS3 uploads data to S3 with content type derived from the key
+// extension. Thumbnails are public-read unless a signing CDN serves the bucket.
+func (w *ThumbnailWorker) uploadToS3(ctx context.Context, bucket, key string, data []byte, metadata map[string]string) error {
 	contentType := "image/jpeg"
 	if strings.HasSuffix(key, ".png") {
 		contentType = "image/png"
 	}
-	_, err := w.s3Client.PutObject(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket:      aws.String(bucket),
 		Key:         aws.String(key),
 		Body:        bytes.NewReader(data),
 		ContentType: aws.String(contentType),
-		ACL:         types.ObjectCannedACLPublicRead,
-	})
+		Metadata:    metadata,
+	}
+	if !w.cdn.Serves(bucket) {
+		input.ACL = types.ObjectCannedACLPublicRead
+	}
+	_, err := w.s3Client.PutObject(ctx, input)
 	return err
 }
 
-// updateThumbnailStatus updates the database with thumbnail keys and status
-func (w *ThumbnailWorker) updateThumbnailStatus(ctx context.Context, fileID, status string, thumbnailKeys map[string]string) error {
+// updateThumbnailStatus updates the database with thumbnail keys, the
+// parameters they were generated with, the image analysis (kept if nil), and
+// status. A non-nil scan is queued in the same transaction.
+func (w *ThumbnailWorker) updateThumbnailStatus(ctx context.Context, fileID, status string, thumbnailKeys map[string]string, params map[string]ThumbnailParams, analysis *ImageAnalysis, scan *FindDuplicateFilesArgs) error {
 	var smallKey, mediumKey, largeKey *string
 
 	if thumbnailKeys != nil {
@@ -294,16 +533,74 @@ func (w *ThumbnailWorker) updateThumbnailStatus(ctx context.Context, fileID, sta
 		}
 	}
 
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal thumbnail params: %w", err)
+	}
+
+	var blurhash, placeholderColor *string
+	var perceptualHash *int64
+	if analysis != nil {
+		blurhash, placeholderColor = &analysis.Blurhash, &analysis.Color
+		if analysis.PerceptualHash != nil {
+			hash := int64(*analysis.PerceptualHash) // BIGINT holds the bits as signed
+			perceptualHash = &hash
+		}
+	}
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 		UPDATE metadata.files
 		SET thumbnail_status = $1,
 		    s3_thumbnail_small_key = $2,
 		    s3_thumbnail_medium_key = $3,
 		    s3_thumbnail_large_key = $4,
+		    thumbnail_params = $5,
+		    blurhash = COALESCE($6, blurhash),
+		    placeholder_color = COALESCE($7, placeholder_color),
+		    perceptual_hash = COALESCE($8, perceptual_hash),
+		    thumbnail_error = NULL,
 		    updated_at = NOW()
-		WHERE id = $5
+		WHERE id = $9
 	`
 
-	_, err := w.dbPool.Exec(ctx, query, status, smallKey, mediumKey, largeKey, fileID)
+	if _, err := tx.Exec(ctx, query, status, smallKey, mediumKey, largeKey, paramsJSON, blurhash, placeholderColor, perceptualHash, fileID); err != nil {
+		return err
+	}
+	if scan != nil {
+		if _, err := w.jobs.InsertTx(ctx, tx, *scan, &river.InsertOpts{ScheduledAt: time.Now().Add(duplicateScanDelay)}); err != nil {
+			return fmt.Errorf("failed to queue duplicate scan: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// markThumbnailFailed records a generation error without touching thumbnail keys
+func (w *ThumbnailWorker) markThumbnailFailed(ctx context.Context, fileID, errMsg string) error {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.files
+		SET thumbnail_status = 'failed',
+		    thumbnail_error = $1,
+		    updated_at = NOW()
+		WHERE id = $2
+	`, errMsg, fileID)
+	return err
+}
+
+// markThumbnailUnsupported records that the original can't be rendered, so
+// the file shows no thumbnail instead of a failure that is still retrying
+func (w *ThumbnailWorker) markThumbnailUnsupported(ctx context.Context, fileID, errMsg string) error {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.files
+		SET thumbnail_status = 'unsupported',
+		    thumbnail_error = $1,
+		    updated_at = NOW()
+		WHERE id = $2
+	`, errMsg, fileID)
 	return err
 }
@@ -44,3 +44,137 @@ func TestIsPDFType(t *testing.T) {
 		})
 	}
 }
+
+// ============================================================================
+// Differential Regeneration Tests
+// ============================================================================
+
+func sizeNames(sizes []ThumbnailSize) []string {
+	names := make([]string, len(sizes))
+	for i, size := range sizes {
+		names[i] = size.Name
+	}
+	return names
+}
+
+// TestOutdatedSizes verifies that only sizes whose stored parameters differ
+// from the profile (or whose thumbnail is missing) are regenerated.
+func TestOutdatedSizes(t *testing.T) {
+	profile := thumbnailProfile(thumbnailSizes, false)
+	allKeys := map[string]string{
+		"thumbnail_small_key":  "a/small.jpg",
+		"thumbnail_medium_key": "a/medium.jpg",
+		"thumbnail_large_key":  "a/large.jpg",
+	}
+
+	t.Run("nil params regenerates everything", func(t *testing.T) {
+		got := sizeNames(outdatedSizes(thumbnailSizes, profile, nil, allKeys))
+		if len(got) != 3 {
+			t.Errorf("outdatedSizes() = %v, want all sizes", got)
+		}
+	})
+
+	t.Run("matching params regenerate nothing", func(t *testing.T) {
+		got := outdatedSizes(thumbnailSizes, profile, thumbnailProfile(thumbnailSizes, false), allKeys)
+		if len(got) != 0 {
+			t.Errorf("outdatedSizes() = %v, want none", sizeNames(got))
+		}
+	})
+
+	t.Run("quality change regenerates one size", func(t *testing.T) {
+		stored := thumbnailProfile(thumbnailSizes, false)
+		medium := stored["medium"]
+		medium.Quality = 70
+		stored["medium"] = medium
+
+		got := sizeNames(outdatedSizes(thumbnailSizes, profile, stored, allKeys))
+		if len(got) != 1 || got[0] != "medium" {
+			t.Errorf("outdatedSizes() = %v, want [medium]", got)
+		}
+	})
+
+	t.Run("missing key regenerates that size", func(t *testing.T) {
+		keys := map[string]string{
+			"thumbnail_small_key":  "a/small.jpg",
+			"thumbnail_medium_key": "a/medium.jpg",
+		}
+		got := sizeNames(outdatedSizes(thumbnailSizes, profile, thumbnailProfile(thumbnailSizes, false), keys))
+		if len(got) != 1 || got[0] != "large" {
+			t.Errorf("outdatedSizes() = %v, want [large]", got)
+		}
+	})
+
+	t.Run("format change regenerates everything", func(t *testing.T) {
+		got := sizeNames(outdatedSizes(thumbnailSizes, profile, thumbnailProfile(thumbnailSizes, true), allKeys))
+		if len(got) != 3 {
+			t.Errorf("outdatedSizes() = %v, want all sizes", got)
+		}
+	})
+}
+
+// TestParseThumbnailParams verifies round-tripping and that malformed JSON is
+// treated as missing rather than failing the job.
+func TestParseThumbnailParams(t *testing.T) {
+	stored := parseThumbnailParams([]byte(`{"small": {"width": 150, "height": 150, "quality": 80, "format": "jpeg"}}`))
+	want := ThumbnailParams{Width: 150, Height: 150, Quality: 80, Format: "jpeg"}
+	if stored["small"] != want {
+		t.Errorf("parseThumbnailParams() small = %+v, want %+v", stored["small"], want)
+	}
+
+	if got := parseThumbnailParams(nil); got != nil {
+		t.Errorf("parseThumbnailParams(nil) = %v, want nil", got)
+	}
+	if got := parseThumbnailParams([]byte(`not json`)); got != nil {
+		t.Errorf("parseThumbnailParams(malformed) = %v, want nil", got)
+	}
+}
+
+func TestNeedsAnalysis(t *testing.T) {
+	tests := []struct {
+		pdf, hasPlaceholder, hasHash bool
+		want                         bool
+	}{
+		{false, true, true, false},
+		{false, true, false, true},
+		{false, false, true, true},
+		{true, true, false, false}, // PDFs are never hashed
+		{true, false, false, true},
+	}
+	for _, tt := range tests {
+		if got := needsAnalysis(tt.pdf, tt.hasPlaceholder, tt.hasHash); got != tt.want {
+			t.Errorf("needsAnalysis(pdf=%v, placeholder=%v, hash=%v) = %v, want %v", tt.pdf, tt.hasPlaceholder, tt.hasHash, got, tt.want)
+		}
+	}
+}
+
+// TestThumbnailObjectMatches verifies that a retry reuses an uploaded
+// thumbnail only when both the original and the parameters are unchanged.
+func TestThumbnailObjectMatches(t *testing.T) {
+	params := thumbnailProfile(thumbnailSizes, false)["medium"]
+	metadata := thumbnailObjectMetadata(params, "abc123")
+
+	if !thumbnailObjectMatches(metadata, params, "abc123") {
+		t.Error("same original and params should match")
+	}
+	if thumbnailObjectMatches(metadata, params, "def456") {
+		t.Error("a different original should not match")
+	}
+	changed := params
+	changed.Quality = 70
+	if thumbnailObjectMatches(metadata, changed, "abc123") {
+		t.Error("different params should not match")
+	}
+	if thumbnailObjectMatches(nil, params, "abc123") {
+		t.Error("an object without metadata should not match")
+	}
+}
+
+func TestThumbnailObjectKey(t *testing.T) {
+	original := "issues/42/0b6c/photo.heic"
+	if got := thumbnailObjectKey(original, "small", thumbnailProfile(thumbnailSizes, false)["small"]); got != "issues/42/0b6c/thumb-small.jpg" {
+		t.Errorf("image key = %q", got)
+	}
+	if got := thumbnailObjectKey(original, "large", thumbnailProfile(thumbnailSizes, true)["large"]); got != "issues/42/0b6c/thumb-large.png" {
+		t.Errorf("PDF key = %q", got)
+	}
+}
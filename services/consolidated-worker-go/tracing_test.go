@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentID    = "00f067aa0ba902b7"
+)
+
+func TestTracingConfigFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://otel-collector:4318/")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+
+	cfg := tracingConfigFromEnv("consolidated-worker")
+	if cfg.Endpoint != "http://otel-collector:4318/v1/traces" {
+		t.Errorf("Endpoint = %q", cfg.Endpoint)
+	}
+	if cfg.ServiceName != "consolidated-worker" || cfg.SampleRatio != 0.25 {
+		t.Errorf("ServiceName = %q, SampleRatio = %v", cfg.ServiceName, cfg.SampleRatio)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://tempo:4318/otlp/v1/traces")
+	if got := tracingConfigFromEnv("x").Endpoint; got != "http://tempo:4318/otlp/v1/traces" {
+		t.Errorf("traces endpoint = %q, want the signal-specific URL", got)
+	}
+
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	if got := tracingConfigFromEnv("x").Endpoint; got != "" {
+		t.Errorf("Endpoint = %q with OTEL_SDK_DISABLED, want empty", got)
+	}
+}
+
+func TestTracing_Disabled(t *testing.T) {
+	if tracingEnabled() {
+		t.Fatal("tracing enabled before initTracing")
+	}
+	ctx, span := tracer.Start(context.Background(), "job")
+	if span.IsRecording() {
+		t.Fatal("no-op tracer returned a recording span")
+	}
+	setSpanError(span, errors.New("boom"))
+	span.End()
+	if _, child := startSpan(ctx, "db SELECT", trace.SpanKindClient); child.IsRecording() {
+		t.Error("startSpan() outside a traced job returned a recording span")
+	}
+}
+
+func TestTracingSampler(t *testing.T) {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(tracingSampler(0)))
+	never := tp.Tracer("test")
+	if _, span := never.Start(context.Background(), "job"); span.IsRecording() {
+		t.Error("ratio 0 sampled a new trace")
+	}
+
+	// A sampled remote parent is always continued, an unsampled one never
+	ctx := jobTraceContext(context.Background(), []byte(`{"traceparent":"`+testTraceparent+`"}`))
+	if _, span := never.Start(ctx, "job"); !span.IsRecording() {
+		t.Error("sampled parent was not continued")
+	}
+	unsampled := strings.TrimSuffix(testTraceparent, "01") + "00"
+	ctx = jobTraceContext(context.Background(), []byte(`{"traceparent":"`+unsampled+`"}`))
+	always := sdktrace.NewTracerProvider(sdktrace.WithSampler(tracingSampler(1))).Tracer("test")
+	if _, span := always.Start(ctx, "job"); span.IsRecording() {
+		t.Error("unsampled parent was recorded")
+	}
+}
+
+// withTestTracer points the global tracer at an in-memory recorder
+func withTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	savedProvider, savedTracer := tracerProvider, tracer
+	setTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder),
+		sdktrace.WithSampler(tracingSampler(1)),
+	))
+	t.Cleanup(func() { tracerProvider, tracer = savedProvider, savedTracer })
+	return recorder
+}
+
+func TestJobTracingMiddleware_Work(t *testing.T) {
+	recorder := withTestTracer(t)
+
+	mw := &JobTracingMiddleware{}
+	job := &rivertype.JobRow{
+		ID: 42, Kind: "thumbnail_generate", Queue: "thumbnails", Attempt: 1,
+		Metadata: []byte(`{"traceparent":"` + testTraceparent + `"}`),
+	}
+
+	var inserted []*rivertype.JobInsertParams
+	err := mw.Work(context.Background(), job, func(ctx context.Context) error {
+		_, db := startSpan(ctx, "db UPDATE", trace.SpanKindClient)
+		db.End()
+
+		// Jobs inserted while this one runs continue its trace
+		inserted = []*rivertype.JobInsertParams{{Kind: "send_notification", Metadata: []byte(`{"source":"x"}`)}}
+		_, err := mw.InsertMany(ctx, inserted, func(context.Context) ([]*rivertype.JobInsertResult, error) { return nil, nil })
+		if err != nil {
+			return err
+		}
+		return errors.New("decode failed")
+	})
+	if err == nil || err.Error() != "decode failed" {
+		t.Fatalf("Work() error = %v, want the job's error", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	db, root := spans[0], spans[1]
+	if root.Name() != "thumbnail_generate" || root.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("root = %q kind %v", root.Name(), root.SpanKind())
+	}
+	if root.SpanContext().TraceID().String() != testTraceID || root.Parent().SpanID().String() != testParentID {
+		t.Errorf("root trace = %s parent = %s, want the job metadata's", root.SpanContext().TraceID(), root.Parent().SpanID())
+	}
+	if root.Status().Code != codes.Error || root.Status().Description != "decode failed" {
+		t.Errorf("root status = %+v, want error", root.Status())
+	}
+	if !hasAttribute(root.Attributes(), attribute.Int64("messaging.message.id", 42)) {
+		t.Errorf("root attributes = %v, want the job ID", root.Attributes())
+	}
+	if db.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("db span not a child of the job span")
+	}
+
+	got := jobTraceContext(context.Background(), inserted[0].Metadata)
+	if trace.SpanContextFromContext(got).TraceID().String() != testTraceID {
+		t.Errorf("inserted job metadata = %s, want the running job's trace", inserted[0].Metadata)
+	}
+	if !strings.Contains(string(inserted[0].Metadata), `"source":"x"`) {
+		t.Errorf("inserted job metadata lost existing keys: %s", inserted[0].Metadata)
+	}
+}
+
+func TestJobTracingMiddleware_SnoozeIsNotError(t *testing.T) {
+	recorder := withTestTracer(t)
+
+	job := &rivertype.JobRow{ID: 1, Kind: "thumbnail_generate", Queue: "thumbnails", Metadata: []byte(`{}`)}
+	(&JobTracingMiddleware{}).Work(context.Background(), job, func(context.Context) error {
+		return river.JobSnooze(time.Minute)
+	})
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	if spans[0].Status().Code != codes.Unset {
+		t.Errorf("snoozed job status = %+v, want unset", spans[0].Status())
+	}
+	if spans[0].Parent().IsValid() {
+		t.Errorf("job without traceparent has parent %s", spans[0].Parent().SpanID())
+	}
+}
+
+func TestWithJobTraceparent_KeepsExisting(t *testing.T) {
+	metadata := []byte(`{"traceparent":"` + testTraceparent + `"}`)
+	got := withJobTraceparent(metadata, "00-11111111111111111111111111111111-2222222222222222-01")
+	if string(got) != string(metadata) {
+		t.Errorf("withJobTraceparent() = %s, want unchanged", got)
+	}
+	ctx := jobTraceContext(context.Background(), withJobTraceparent(nil, testTraceparent))
+	if got := traceparent(ctx); got != testTraceparent {
+		t.Errorf("withJobTraceparent(nil) round trip = %q", got)
+	}
+}
+
+func TestTracingTransport(t *testing.T) {
+	recorder := withTestTracer(t)
+
+	var gotHeader string
+	keycloak := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer keycloak.Close()
+
+	ctx, span := tracer.Start(context.Background(), "provision_keycloak_user", trace.WithSpanKind(trace.SpanKindConsumer))
+	client := &http.Client{Transport: newTracingTransport(nil, "keycloak")}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, keycloak.URL+"/admin/realms/x/users", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	httpSpan := spans[0]
+	if httpSpan.Name() != "GET keycloak" || httpSpan.Status().Code != codes.Error {
+		t.Errorf("http span = %q status %+v, want GET keycloak with error status", httpSpan.Name(), httpSpan.Status())
+	}
+	if !strings.Contains(gotHeader, httpSpan.SpanContext().SpanID().String()) {
+		t.Errorf("traceparent header = %q, want the HTTP span", gotHeader)
+	}
+}
+
+func TestSQLOperation(t *testing.T) {
+	tests := map[string]string{
+		"SELECT 1":                        "SELECT",
+		"\n\t\tupdate metadata.files SET": "UPDATE",
+		"-- comment\nINSERT INTO x":       "INSERT",
+		"WITH x AS (SELECT 1) SELECT":     "WITH",
+		"":                                "QUERY",
+	}
+	for sql, want := range tests {
+		if got := sqlOperation(sql); got != want {
+			t.Errorf("sqlOperation(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
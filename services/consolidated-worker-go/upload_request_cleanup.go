@@ -0,0 +1,152 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Upload Request Cleanup Maintenance Task
+//
+// A file upload is a metadata.file_upload_requests row signed by the
+// s3_presign job, a PUT from the browser, then a metadata.files row created
+// with the request's file_id, which stamps the request's uploaded_at.
+// Requests never stamped were abandoned (tab closed, upload failed, the form
+// was cancelled):
+//
+//   - Requests older than the upload URL TTL plus a grace period are marked
+//     'expired', along with requests the presign job never picked up
+//   - The object at an expired request's s3_key is deleted, in case the PUT
+//     got that far, and s3_key is cleared
+//   - Finished requests are deleted after UPLOAD_REQUEST_RETENTION_DAYS, which
+//     bounds the window public.get_abandoned_upload_summary() reports on
+//
+// Scheduled by MaintenanceScheduler (task "upload_request_cleanup").
+// ============================================================================
+
+const (
+	// uploadRequestGrace is added to uploadURLTTL before a request counts as
+	// abandoned: S3 checks the URL's expiry when the PUT starts, so a large
+	// upload begun just before it can still be running
+	uploadRequestGrace = 45 * time.Minute
+
+	uploadRequestCleanupBatchSize = 500
+)
+
+// UploadRequestCleanupTask expires abandoned upload requests and deletes
+// their objects
+type UploadRequestCleanupTask struct {
+	dbPool    *pgxpool.Pool
+	s3Client  objectDeleter
+	bucket    string
+	retention time.Duration
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (u *UploadRequestCleanupTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "upload_request_cleanup",
+		Description: fmt.Sprintf("Expire upload requests unused after %s, delete their objects and purge requests older than %s", uploadURLTTL+uploadRequestGrace, u.retention),
+		Interval:    time.Hour,
+		Jitter:      5 * time.Minute,
+		Run:         u.runCleanup,
+	}
+}
+
+func (u *UploadRequestCleanupTask) runCleanup(ctx context.Context) (string, error) {
+	// Requests the presign job never signed, and signed requests whose file
+	// row never appeared
+	tag, err := u.dbPool.Exec(ctx, `
+		UPDATE metadata.file_upload_requests
+		SET status = 'expired', expired_at = NOW()
+		WHERE status IN ('pending', 'processing', 'completed')
+		  AND uploaded_at IS NULL
+		  AND created_at < $1
+	`, time.Now().Add(-(uploadURLTTL + uploadRequestGrace)))
+	if err != nil {
+		return "", fmt.Errorf("failed to expire upload requests: %w", err)
+	}
+	expired := tag.RowsAffected()
+
+	deleted, err := u.deleteObjects(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Expired requests keep their s3_key until the object is gone
+	tag, err = u.dbPool.Exec(ctx, `
+		DELETE FROM metadata.file_upload_requests
+		WHERE created_at < $1
+		  AND NOT (status = 'expired' AND s3_key IS NOT NULL)
+	`, time.Now().Add(-u.retention))
+	if err != nil {
+		return "", fmt.Errorf("failed to purge upload requests: %w", err)
+	}
+	purged := tag.RowsAffected()
+
+	if expired > 0 || deleted > 0 {
+		log.Printf("[Maintenance] upload_request_cleanup: expired %d request(s), cleaned up %d upload key(s)", expired, deleted)
+	}
+	return fmt.Sprintf("Expired %d upload request(s), cleaned up %d abandoned upload key(s), purged %d old request(s)", expired, deleted, purged), nil
+}
+
+// deleteObjects removes the objects of expired requests, a batch per run, in
+// one DeleteObjects call. A key counts as deleted whether or not the PUT ever
+// happened.
+func (u *UploadRequestCleanupTask) deleteObjects(ctx context.Context) (int, error) {
+	rows, err := u.dbPool.Query(ctx, `
+		SELECT id::text, s3_key FROM metadata.file_upload_requests
+		WHERE status = 'expired' AND s3_key IS NOT NULL
+		ORDER BY created_at
+		LIMIT $1
+	`, uploadRequestCleanupBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find abandoned uploads: %w", err)
+	}
+	type abandoned struct {
+		id    string
+		s3Key string
+	}
+	requests, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (abandoned, error) {
+		var a abandoned
+		err := row.Scan(&a.id, &a.s3Key)
+		return a, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find abandoned uploads: %w", err)
+	}
+
+	ids := make(map[string][]string, len(requests))
+	keys := make([]string, 0, len(requests))
+	for _, a := range requests {
+		if ids[a.s3Key] == nil {
+			keys = append(keys, a.s3Key)
+		}
+		ids[a.s3Key] = append(ids[a.s3Key], a.id)
+	}
+
+	deletedKeys, failed := deleteObjectsBatch(ctx, u.s3Client, u.bucket, keys)
+	for key, err := range failed {
+		log.Printf("[Maintenance] upload_request_cleanup: failed to delete %s: %v", key, err)
+	}
+	var cleared []string
+	for _, key := range deletedKeys {
+		cleared = append(cleared, ids[key]...)
+	}
+	if len(cleared) == 0 {
+		return 0, nil
+	}
+	if _, err := u.dbPool.Exec(ctx, `
+		UPDATE metadata.file_upload_requests SET s3_key = NULL WHERE id = ANY($1::UUID[])
+	`, cleared); err != nil {
+		return 0, fmt.Errorf("failed to clear keys of %d upload request(s): %w", len(cleared), err)
+	}
+	return len(cleared), nil
+}
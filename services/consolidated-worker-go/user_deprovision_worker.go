@@ -0,0 +1,195 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// User Deprovisioning (deprovision_user)
+// ============================================================================
+//
+// The inverse of UserProvisionWorker. request_user_deprovisioning() records a
+// metadata.user_deprovisioning row and queues this job, which:
+//
+//  1. disables the Keycloak account (and clears its profile under the
+//     anonymize policy), ends its sessions and removes its realm role mappings
+//  2. calls metadata.complete_user_deprovisioning() for the database side:
+//     owned records, PII, notification preferences and user_roles
+//
+// Every Keycloak step is safe to repeat, so a retry starts from the top. A
+// user already gone from Keycloak is deprovisioned in the database only.
+
+// DeprovisionUserArgs is inserted by public.request_user_deprovisioning()
+type DeprovisionUserArgs struct {
+	DeprovisionID int64            `json:"deprovision_id"`
+	Audit         *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger
+}
+
+func (DeprovisionUserArgs) Kind() string { return "deprovision_user" }
+
+func (DeprovisionUserArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       "user_provisioning",
+		MaxAttempts: 5,
+		Priority:    1,
+	}
+}
+
+// UserDeprovisionWorker offboards one user
+type UserDeprovisionWorker struct {
+	river.WorkerDefaults[DeprovisionUserArgs]
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
+}
+
+// deprovisionResult is returned by metadata.complete_user_deprovisioning()
+type deprovisionResult struct {
+	RecordsReassigned int `json:"records_reassigned"`
+	RecordsFlagged    int `json:"records_flagged"`
+}
+
+func (w *UserDeprovisionWorker) Work(ctx context.Context, job *river.Job[DeprovisionUserArgs]) error {
+	startTime := time.Now()
+	id := job.Args.DeprovisionID
+	log.Printf("[Job %d] Starting user deprovisioning (attempt %d/%d): deprovision_id=%d",
+		job.ID, job.Attempt, job.MaxAttempts, id)
+
+	var userID, piiPolicy, status, realm string
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT d.user_id::TEXT, d.pii_policy, d.status, COALESCE(u.identity_realm, '')
+		FROM metadata.user_deprovisioning d
+		LEFT JOIN metadata.civic_os_users u ON u.id = d.user_id
+		WHERE d.id = $1
+	`, id).Scan(&userID, &piiPolicy, &status, &realm)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("[Job %d] Deprovisioning request %d no longer exists, skipping", job.ID, id)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load deprovisioning request: %w", err)
+	}
+	if status == "completed" {
+		log.Printf("[Job %d] Deprovisioning request %d already completed", job.ID, id)
+		return nil
+	}
+
+	if _, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.user_deprovisioning SET status = 'processing', river_job_id = $2 WHERE id = $1
+	`, id, job.ID); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+
+	provider, err := providerForRealm(w.provider, realm)
+	if err != nil {
+		return w.fail(ctx, job, err)
+	}
+	keycloakDisabled, rolesRevoked, changes, err := w.deprovisionKeycloak(ctx, provider, userID, piiPolicy)
+	for _, change := range changes {
+		recordIdentityAudit(ctx, w.dbPool, provider, job.JobRow, job.Args.Audit, change)
+	}
+	if err != nil {
+		return w.fail(ctx, job, err)
+	}
+	if !keycloakDisabled {
+		log.Printf("[Job %d] User %s is not in Keycloak; deprovisioning in the database only", job.ID, userID)
+	}
+
+	var result deprovisionResult
+	err = w.dbPool.QueryRow(ctx,
+		`SELECT metadata.complete_user_deprovisioning($1, $2, $3)`,
+		id, keycloakDisabled, rolesRevoked,
+	).Scan(&result)
+	if err != nil {
+		return w.fail(ctx, job, fmt.Errorf("complete_user_deprovisioning: %w", err))
+	}
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "user_deprovisioned", map[string]interface{}{
+		"target_user_id":     userID,
+		"deprovision_id":     id,
+		"pii_policy":         piiPolicy,
+		"keycloak_disabled":  keycloakDisabled,
+		"roles_revoked":      rolesRevoked,
+		"records_reassigned": result.RecordsReassigned,
+		"records_flagged":    result.RecordsFlagged,
+	})
+
+	log.Printf("[Job %d] ✓ Deprovisioned user %s (%s) in %v: %d role(s) revoked, %d record(s) reassigned, %d flagged",
+		job.ID, userID, piiPolicy, time.Since(startTime), len(rolesRevoked), result.RecordsReassigned, result.RecordsFlagged)
+	return nil
+}
+
+// deprovisionKeycloak disables the account in provider (the user's realm),
+// ends its sessions and removes its direct realm role mappings. Returns false
+// when the user isn't in Keycloak.
+// The changes made are returned for the identity audit log, also on error.
+func (w *UserDeprovisionWorker) deprovisionKeycloak(ctx context.Context, provider IdentityProvider, userID, piiPolicy string) (bool, []string, []identityAuditEntry, error) {
+	user, err := provider.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errIdentityUserNotFound) {
+			return false, []string{}, nil, nil
+		}
+		return false, nil, nil, err
+	}
+	var changes []identityAuditEntry
+	changed := func(operation string, before, after interface{}) {
+		changes = append(changes, identityAuditEntry{
+			Operation: operation, TargetType: "user", TargetID: userID, Before: before, After: after,
+		})
+	}
+
+	// Disable first so no new session starts while the rest runs
+	operation := "user.disable"
+	if piiPolicy == "anonymize" {
+		operation = "user.anonymize"
+		err = provider.AnonymizeUser(ctx, userID)
+	} else {
+		err = provider.DisableUser(ctx, userID)
+	}
+	if err != nil {
+		return false, nil, changes, err
+	}
+	changed(operation, identityUserState(user), userProfileState(ctx, provider, userID))
+
+	if err := provider.LogoutUser(ctx, userID); err != nil {
+		return false, nil, changes, err
+	}
+	changed("user.logout", nil, nil)
+
+	roles, err := provider.GetUserDirectRoles(ctx, userID)
+	if err != nil {
+		return false, nil, changes, err
+	}
+	if len(roles) > 0 {
+		if err := provider.RemoveRoles(ctx, userID, roles); err != nil {
+			return false, nil, changes, err
+		}
+		changed("role.revoke", map[string]interface{}{"roles": roles}, userRolesState(ctx, provider, userID))
+	}
+	return true, roles, changes, nil
+}
+
+// fail records the error on the request, marking it failed once River has
+// no attempts left, and returns the error for River to retry
+func (w *UserDeprovisionWorker) fail(ctx context.Context, job *river.Job[DeprovisionUserArgs], err error) error {
+	final := job.Attempt >= job.MaxAttempts
+	_, dbErr := w.dbPool.Exec(ctx, `
+		UPDATE metadata.user_deprovisioning
+		SET error_message = $2,
+		    status = CASE WHEN $3 THEN 'failed' ELSE status END
+		WHERE id = $1
+	`, job.Args.DeprovisionID, err.Error(), final)
+	if dbErr != nil {
+		log.Printf("[Job %d] Failed to record deprovisioning error: %v", job.ID, dbErr)
+	}
+	return fmt.Errorf("deprovisioning failed: %w", err)
+}
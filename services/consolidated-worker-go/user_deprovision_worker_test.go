@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeprovisionKeycloak_AnonymizeDisablesLogsOutAndRevokes(t *testing.T) {
+	var calls []string
+	var put map[string]interface{}
+	var removed []keycloakRole
+	kc, _, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/admin/realms/test-realm")
+		calls = append(calls, r.Method+" "+path)
+		switch r.Method + " " + path {
+		case "GET /users/u1":
+			w.Write([]byte(`{"id":"u1","username":"jdoe","email":"jdoe@example.com","firstName":"Jane","lastName":"Doe","enabled":true,"attributes":{"phoneNumber":["5551234567"]}}`))
+		case "PUT /users/u1":
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &put)
+			w.WriteHeader(http.StatusNoContent)
+		case "POST /users/u1/logout":
+			w.WriteHeader(http.StatusNoContent)
+		case "GET /users/u1/role-mappings/realm":
+			w.Write([]byte(`[{"id":"r1","name":"editor"},{"id":"r2","name":"default-roles-test-realm"}]`))
+		case "GET /roles":
+			w.Write([]byte(`[{"id":"r1","name":"editor"},{"id":"r2","name":"default-roles-test-realm"},{"id":"r3","name":"admin"}]`))
+		case "DELETE /users/u1/role-mappings/realm":
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &removed)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	w := &UserDeprovisionWorker{provider: kc}
+
+	disabled, roles, changes, err := w.deprovisionKeycloak(context.Background(), kc, "u1", "anonymize")
+	if err != nil {
+		t.Fatalf("deprovisionKeycloak: %v", err)
+	}
+	if !disabled || !reflect.DeepEqual(roles, []string{"editor", "default-roles-test-realm"}) {
+		t.Errorf("got disabled=%v roles=%v", disabled, roles)
+	}
+
+	// Disabled (and cleared) before the sessions are ended and roles removed;
+	// the GETs after each change read the state for the identity audit log
+	want := []string{"GET /users/u1", "GET /users/u1", "PUT /users/u1", "GET /users/u1", "POST /users/u1/logout",
+		"GET /users/u1/role-mappings/realm", "GET /roles", "DELETE /users/u1/role-mappings/realm",
+		"GET /users/u1/role-mappings/realm"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v\nwant    %v", calls, want)
+	}
+	if put["enabled"] != false || put["email"] != "" || put["firstName"] != "" || put["username"] != "jdoe" {
+		t.Errorf("anonymize payload = %v", put)
+	}
+	if attrs, _ := put["attributes"].(map[string]interface{}); len(attrs) != 0 {
+		t.Errorf("attributes not cleared: %v", put["attributes"])
+	}
+	if len(removed) != 2 || removed[0].ID != "r1" || removed[1].ID != "r2" {
+		t.Errorf("removed roles = %+v", removed)
+	}
+
+	var operations []string
+	for _, c := range changes {
+		operations = append(operations, c.Operation)
+	}
+	if !reflect.DeepEqual(operations, []string{"user.anonymize", "user.logout", "role.revoke"}) {
+		t.Errorf("audited operations = %v", operations)
+	}
+	if before := changes[0].Before.(map[string]interface{}); before["email"] != "jdoe@example.com" || before["phone"] != "5551234567" {
+		t.Errorf("anonymize before state = %v", before)
+	}
+}
+
+func TestDeprovisionKeycloak_LockKeepsProfile(t *testing.T) {
+	var put map[string]interface{}
+	kc, _, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/users/u1"):
+			w.Write([]byte(`{"id":"u1","username":"jdoe","email":"jdoe@example.com","firstName":"Jane","lastName":"Doe","enabled":true}`))
+		case r.Method == "PUT":
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &put)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "POST":
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/role-mappings/realm"):
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	w := &UserDeprovisionWorker{provider: kc}
+
+	disabled, roles, _, err := w.deprovisionKeycloak(context.Background(), kc, "u1", "lock")
+	if err != nil {
+		t.Fatalf("deprovisionKeycloak: %v", err)
+	}
+	if !disabled || len(roles) != 0 {
+		t.Errorf("got disabled=%v roles=%v", disabled, roles)
+	}
+	if put["enabled"] != false || put["email"] != "jdoe@example.com" || put["lastName"] != "Doe" {
+		t.Errorf("disable payload = %v", put)
+	}
+}
+
+func TestDeprovisionKeycloak_UserMissingFromKeycloak(t *testing.T) {
+	var calls int
+	kc, _, _ := newTestKeycloak(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	})
+	w := &UserDeprovisionWorker{provider: kc}
+
+	disabled, roles, changes, err := w.deprovisionKeycloak(context.Background(), kc, "gone", "lock")
+	if err != nil {
+		t.Fatalf("deprovisionKeycloak: %v", err)
+	}
+	if disabled || roles == nil || len(roles) != 0 || calls != 1 || len(changes) != 0 {
+		t.Errorf("got disabled=%v roles=%v after %d call(s); want false, [], 1", disabled, roles, calls)
+	}
+}
+
+func TestDeprovisionUserArgsInsertOpts(t *testing.T) {
+	args := DeprovisionUserArgs{}
+	if args.Kind() != "deprovision_user" {
+		t.Errorf("expected kind=deprovision_user, got %s", args.Kind())
+	}
+	if opts := args.InsertOpts(); opts.Queue != "user_provisioning" || opts.MaxAttempts != 5 {
+		t.Errorf("unexpected insert opts %+v", opts)
+	}
+}
@@ -14,7 +14,9 @@ import (
 
 // ProvisionUserArgs defines the job arguments
 type ProvisionUserArgs struct {
-	ProvisionID int64 `json:"provision_id"`
+	ProvisionID int64            `json:"provision_id"`
+	Realm       string           `json:"realm,omitempty"` // overrides user_provisioning.realm; "" is the request's realm
+	Audit       *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger
 }
 
 func (ProvisionUserArgs) Kind() string { return "provision_keycloak_user" }
@@ -30,9 +32,9 @@ func (ProvisionUserArgs) InsertOpts() river.InsertOpts {
 // UserProvisionWorker provisions users in Keycloak
 type UserProvisionWorker struct {
 	river.WorkerDefaults[ProvisionUserArgs]
-	dbPool         *pgxpool.Pool
-	keycloakClient *KeycloakClient
-	siteURL        string
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
+	siteURL  string
 }
 
 // provisionRequest holds data from metadata.user_provisioning
@@ -48,6 +50,9 @@ type provisionRequest struct {
 	Status           string
 	KeycloakUserID   *string
 	RequestedBy      *string // UUID of admin who created the invite
+	Realm            *string // target realm (v0.126.0); NULL is the default realm
+
+	WelcomeNotificationID *int64 // set once the welcome has been queued (v0.96.0)
 }
 
 func (w *UserProvisionWorker) Work(ctx context.Context, job *river.Job[ProvisionUserArgs]) error {
@@ -73,9 +78,19 @@ func (w *UserProvisionWorker) Work(ctx context.Context, job *river.Job[Provision
 		return fmt.Errorf("failed to update status: %w", err)
 	}
 
+	// The realm the user is created in, and whose jobs later run against
+	realm := job.Args.Realm
+	if realm == "" && req.Realm != nil {
+		realm = *req.Realm
+	}
+	provider, err := providerForRealm(w.provider, realm)
+	if err != nil {
+		return w.handleError(ctx, provisionID, job.ID, "resolve realm", err)
+	}
+
 	// 3. Check Keycloak for existing user (idempotency for retries)
 	var keycloakUserID string
-	existingUser, err := w.keycloakClient.GetUserByEmail(ctx, req.Email)
+	existingUser, err := provider.GetUserByEmail(ctx, req.Email)
 	if err != nil {
 		return w.handleError(ctx, provisionID, job.ID, "search user", err)
 	}
@@ -90,23 +105,38 @@ func (w *UserProvisionWorker) Work(ctx context.Context, job *river.Job[Provision
 		if req.Phone != nil {
 			phone = *req.Phone
 		}
-		keycloakUserID, err = w.keycloakClient.CreateUser(ctx, req.Email, req.FirstName, req.LastName, phone)
+		keycloakUserID, err = provider.CreateUser(ctx, req.Email, req.FirstName, req.LastName, phone)
 		if err != nil {
 			return w.handleError(ctx, provisionID, job.ID, "create user", err)
 		}
 		log.Printf("[Job %d] Created user %s in Keycloak (ID: %s)", job.ID, req.Email, keycloakUserID)
+
+		recordIdentityAudit(ctx, w.dbPool, provider, job.JobRow, job.Args.Audit, identityAuditEntry{
+			Operation:  "user.create",
+			TargetType: "user",
+			TargetID:   keycloakUserID,
+			After:      userProfileState(ctx, provider, keycloakUserID),
+		})
 	}
 
 	// 5. Assign realm roles
 	if len(req.InitialRoles) > 0 {
-		if err := w.keycloakClient.AssignRealmRoles(ctx, keycloakUserID, req.InitialRoles); err != nil {
+		before := userRolesState(ctx, provider, keycloakUserID)
+		if err := provider.AssignRoles(ctx, keycloakUserID, req.InitialRoles); err != nil {
 			return w.handleError(ctx, provisionID, job.ID, "assign roles", err)
 		}
+		recordIdentityAudit(ctx, w.dbPool, provider, job.JobRow, job.Args.Audit, identityAuditEntry{
+			Operation:  "role.assign",
+			TargetType: "user",
+			TargetID:   keycloakUserID,
+			Before:     before,
+			After:      userRolesState(ctx, provider, keycloakUserID),
+		})
 		log.Printf("[Job %d] Assigned roles %v to user %s", job.ID, req.InitialRoles, keycloakUserID)
 	}
 
 	// 6. Insert into civic_os_users and civic_os_users_private
-	if err := w.insertUserRecords(ctx, keycloakUserID, req); err != nil {
+	if err := w.insertUserRecords(ctx, keycloakUserID, realm, req); err != nil {
 		return w.handleError(ctx, provisionID, job.ID, "insert user records", err)
 	}
 
@@ -115,13 +145,21 @@ func (w *UserProvisionWorker) Work(ctx context.Context, job *river.Job[Provision
 		return w.handleError(ctx, provisionID, job.ID, "insert user roles", err)
 	}
 
-	// 8. Send welcome notification if requested (via Civic OS notification system)
-	if req.SendWelcomeEmail || req.SendWelcomeSMS {
-		if err := w.sendWelcomeNotification(ctx, keycloakUserID, req); err != nil {
-			// Don't fail the whole job for welcome notification - log and continue
+	// 8. Send welcome notification if requested (via Civic OS notification system).
+	// A retried job skips it once it has been queued.
+	if (req.SendWelcomeEmail || req.SendWelcomeSMS) && req.WelcomeNotificationID == nil {
+		notificationID, err := w.sendWelcomeNotification(ctx, keycloakUserID, req)
+		if err != nil {
+			w.recordWelcomeFailure(ctx, provisionID, err)
+			// Retry the job for the welcome alone (the steps above are
+			// idempotent); on the last attempt complete the request with the
+			// failure recorded, since the user exists either way
+			if job.Attempt < job.MaxAttempts {
+				return fmt.Errorf("queue welcome notification: %w", err)
+			}
 			log.Printf("[Job %d] Warning: failed to send welcome notification: %v", job.ID, err)
 		} else {
-			log.Printf("[Job %d] Queued welcome notification for %s", job.ID, req.Email)
+			log.Printf("[Job %d] Queued welcome notification %d for %s", job.ID, notificationID, req.Email)
 		}
 	}
 
@@ -130,6 +168,13 @@ func (w *UserProvisionWorker) Work(ctx context.Context, job *river.Job[Provision
 		return fmt.Errorf("failed to mark completed: %w", err)
 	}
 
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "user_provisioned", map[string]interface{}{
+		"provision_id":     provisionID,
+		"keycloak_user_id": keycloakUserID,
+		"email":            req.Email,
+		"initial_roles":    req.InitialRoles,
+	})
+
 	duration := time.Since(startTime)
 	log.Printf("[Job %d] User %s provisioned successfully in %v (Keycloak ID: %s)",
 		job.ID, req.Email, duration, keycloakUserID)
@@ -146,14 +191,14 @@ func (w *UserProvisionWorker) fetchProvisionRequest(ctx context.Context, id int6
 		       to_json(initial_roles) AS initial_roles,
 		       send_welcome_email, send_welcome_sms,
 		       status, keycloak_user_id::TEXT,
-		       requested_by::TEXT
+		       requested_by::TEXT, welcome_notification_id, realm
 		FROM metadata.user_provisioning
 		WHERE id = $1
 	`, id).Scan(
 		&req.ID, &req.Email, &req.FirstName, &req.LastName, &req.Phone,
 		&rolesJSON, &req.SendWelcomeEmail, &req.SendWelcomeSMS,
 		&req.Status, &req.KeycloakUserID,
-		&req.RequestedBy,
+		&req.RequestedBy, &req.WelcomeNotificationID, &req.Realm,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("provision request %d not found: %w", id, err)
@@ -184,19 +229,20 @@ func (w *UserProvisionWorker) updateStatus(ctx context.Context, id int64, status
 	return err
 }
 
-func (w *UserProvisionWorker) insertUserRecords(ctx context.Context, keycloakUserID string, req *provisionRequest) error {
+func (w *UserProvisionWorker) insertUserRecords(ctx context.Context, keycloakUserID, realm string, req *provisionRequest) error {
 	// Format display name using the same logic as format_public_display_name()
 	displayName := formatPublicDisplayName(req.FirstName, req.LastName)
 	fullName := req.FirstName + " " + req.LastName
 
 	// Insert into civic_os_users (ON CONFLICT for idempotency)
 	_, err := w.dbPool.Exec(ctx, `
-		INSERT INTO metadata.civic_os_users (id, display_name)
-		VALUES ($1, $2)
+		INSERT INTO metadata.civic_os_users (id, display_name, identity_realm)
+		VALUES ($1, $2, NULLIF($3, ''))
 		ON CONFLICT (id) DO UPDATE SET
 		    display_name = EXCLUDED.display_name,
+		    identity_realm = EXCLUDED.identity_realm,
 		    updated_at = NOW()
-	`, keycloakUserID, displayName)
+	`, keycloakUserID, displayName, realm)
 	if err != nil {
 		return fmt.Errorf("insert civic_os_users failed: %w", err)
 	}
@@ -269,7 +315,9 @@ func (w *UserProvisionWorker) markCompleted(ctx context.Context, id int64, keycl
 // sendWelcomeNotification inserts a notification using the user_welcome template.
 // This replaces the Keycloak "set password" email with a Civic OS notification
 // that links to the login page (where social login buttons are visible).
-func (w *UserProvisionWorker) sendWelcomeNotification(ctx context.Context, keycloakUserID string, req *provisionRequest) error {
+// It returns the notification ID, which is stored on the provisioning request
+// in the same statement so delivery status can be copied back (v0.96.0).
+func (w *UserProvisionWorker) sendWelcomeNotification(ctx context.Context, keycloakUserID string, req *provisionRequest) (int64, error) {
 	// Look up invited_by display name
 	var invitedBy string
 	if req.RequestedBy != nil {
@@ -298,17 +346,11 @@ func (w *UserProvisionWorker) sendWelcomeNotification(ctx context.Context, keycl
 
 	entityDataJSON, err := json.Marshal(entityData)
 	if err != nil {
-		return fmt.Errorf("failed to marshal entity data: %w", err)
+		return 0, fmt.Errorf("failed to marshal entity data: %w", err)
 	}
 
-	// Build channels array based on which welcome options were selected
-	var channels []string
-	if req.SendWelcomeEmail {
-		channels = append(channels, "email")
-	}
+	channels := welcomeChannels(req)
 	if req.SendWelcomeSMS {
-		channels = append(channels, "sms")
-
 		// Force-enable SMS notification preference for new user.
 		// New users default to enabled=false, which would cause the
 		// NotificationWorker to silently skip the SMS. Since the admin
@@ -329,18 +371,55 @@ func (w *UserProvisionWorker) sendWelcomeNotification(ctx context.Context, keycl
 
 	// INSERT directly into metadata.notifications
 	// The enqueue_notification_job_trigger auto-enqueues the River job
-	_, err = w.dbPool.Exec(ctx, `
-		INSERT INTO metadata.notifications (
-			user_id, template_name, entity_data, channels
-		) VALUES (
-			$1, 'user_welcome', $2::JSONB, $3::TEXT[]
+	var notificationID int64
+	err = w.dbPool.QueryRow(ctx, `
+		WITH n AS (
+			INSERT INTO metadata.notifications (
+				user_id, template_name, entity_data, channels
+			) VALUES (
+				$1, 'user_welcome', $2::JSONB, $3::TEXT[]
+			)
+			RETURNING id
 		)
-	`, keycloakUserID, string(entityDataJSON), channelsLiteral)
+		UPDATE metadata.user_provisioning up
+		SET welcome_notification_id = n.id,
+		    welcome_status = 'queued',
+		    welcome_error = NULL
+		FROM n
+		WHERE up.id = $4
+		RETURNING n.id
+	`, keycloakUserID, string(entityDataJSON), channelsLiteral, req.ID).Scan(&notificationID)
 	if err != nil {
-		return fmt.Errorf("failed to insert welcome notification: %w", err)
+		return 0, fmt.Errorf("failed to insert welcome notification: %w", err)
 	}
 
-	return nil
+	return notificationID, nil
+}
+
+// welcomeChannels returns the notification channels for the welcome options
+// the admin selected
+func welcomeChannels(req *provisionRequest) []string {
+	var channels []string
+	if req.SendWelcomeEmail {
+		channels = append(channels, "email")
+	}
+	if req.SendWelcomeSMS {
+		channels = append(channels, "sms")
+	}
+	return channels
+}
+
+// recordWelcomeFailure notes on the provisioning request that the welcome
+// notification could not be queued
+func (w *UserProvisionWorker) recordWelcomeFailure(ctx context.Context, provisionID int64, cause error) {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE metadata.user_provisioning
+		SET welcome_status = 'failed', welcome_error = $2
+		WHERE id = $1
+	`, provisionID, cause.Error())
+	if err != nil {
+		log.Printf("[UserProvision] Warning: failed to record welcome failure for provision %d: %v", provisionID, err)
+	}
 }
 
 func (w *UserProvisionWorker) handleError(ctx context.Context, provisionID int64, jobID int64, step string, err error) error {
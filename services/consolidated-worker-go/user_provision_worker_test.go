@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -242,3 +243,21 @@ func TestProvisionUserArgsInsertOpts(t *testing.T) {
 		t.Errorf("expected priority=1, got %d", opts.Priority)
 	}
 }
+
+func TestWelcomeChannels(t *testing.T) {
+	cases := []struct {
+		email, sms bool
+		want       string
+	}{
+		{true, false, "[email]"},
+		{false, true, "[sms]"},
+		{true, true, "[email sms]"},
+		{false, false, "[]"},
+	}
+	for _, c := range cases {
+		got := welcomeChannels(&provisionRequest{SendWelcomeEmail: c.email, SendWelcomeSMS: c.sms})
+		if fmt.Sprint(got) != c.want {
+			t.Errorf("welcomeChannels(email=%v, sms=%v) = %v, want %s", c.email, c.sms, got, c.want)
+		}
+	}
+}
@@ -22,6 +22,8 @@ type UpdateKeycloakUserArgs struct {
 	Email     string `json:"email"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+
+	Audit *JobAuditContext `json:"audit,omitempty"` // stamped by river_job trigger
 }
 
 func (UpdateKeycloakUserArgs) Kind() string { return "update_keycloak_user" }
@@ -37,8 +39,8 @@ func (UpdateKeycloakUserArgs) InsertOpts() river.InsertOpts {
 // UpdateKeycloakUserWorker syncs user profile changes to Keycloak
 type UpdateKeycloakUserWorker struct {
 	river.WorkerDefaults[UpdateKeycloakUserArgs]
-	dbPool         *pgxpool.Pool
-	keycloakClient *KeycloakClient
+	dbPool   *pgxpool.Pool
+	provider IdentityProvider
 }
 
 func (w *UpdateKeycloakUserWorker) Work(ctx context.Context, job *river.Job[UpdateKeycloakUserArgs]) error {
@@ -46,13 +48,33 @@ func (w *UpdateKeycloakUserWorker) Work(ctx context.Context, job *river.Job[Upda
 	log.Printf("[Job %d] Starting user update (attempt %d/%d): user=%s name=%s %s",
 		job.ID, job.Attempt, job.MaxAttempts, job.Args.UserID, job.Args.FirstName, job.Args.LastName)
 
+	provider, err := providerForUser(ctx, w.dbPool, w.provider, job.Args.UserID)
+	if err != nil {
+		return err
+	}
+
+	before := userProfileState(ctx, provider, job.Args.UserID)
+
 	// Phone is always empty — database is the authority for phone, not Keycloak.
 	// This clears Keycloak's phoneNumber attribute to avoid stale data.
-	err := w.keycloakClient.UpdateUser(ctx, job.Args.UserID, job.Args.Email, job.Args.FirstName, job.Args.LastName, "")
+	err = provider.UpdateUser(ctx, job.Args.UserID, job.Args.Email, job.Args.FirstName, job.Args.LastName, "")
 	if err != nil {
 		return fmt.Errorf("update user failed: %w", err)
 	}
 
+	recordIdentityAudit(ctx, w.dbPool, provider, job.JobRow, job.Args.Audit, identityAuditEntry{
+		Operation:  "user.update",
+		TargetType: "user",
+		TargetID:   job.Args.UserID,
+		Before:     before,
+		After:      userProfileState(ctx, provider, job.Args.UserID),
+	})
+
+	recordJobAuditEvent(ctx, w.dbPool, job.ID, job.Args.Audit, "keycloak_user_updated", map[string]interface{}{
+		"target_user_id": job.Args.UserID,
+		"email":          job.Args.Email,
+	})
+
 	duration := time.Since(startTime)
 	log.Printf("[Job %d] Updated user %s in Keycloak in %v", job.ID, job.Args.UserID, duration)
 	return nil
@@ -0,0 +1,72 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Validation Result Cleanup Maintenance Task
+//
+// Runs every minute to purge template validation/preview results. Preview
+// rows hold templates rendered with sample entity data, so they should not
+// outlive the editor session that requested them:
+//   - results the UI has read (consumed_at set) are deleted after a short grace
+//   - everything else is deleted once older than the retention TTL
+//
+// The SQL lives in metadata.purge_validation_results() (hidden from PostgREST).
+// Scheduled by MaintenanceScheduler (task "validation_cleanup").
+// ============================================================================
+
+const (
+	validationCleanupInterval = 1 * time.Minute
+
+	// validationConsumedGrace covers UI polls still in flight when the first
+	// completed response arrives
+	validationConsumedGrace = 1 * time.Minute
+)
+
+// ValidationCleanupTask purges consumed and expired validation results.
+type ValidationCleanupTask struct {
+	dbPool    *pgxpool.Pool
+	retention time.Duration
+}
+
+// MaintenanceTask declares the task with its default schedule
+func (v *ValidationCleanupTask) MaintenanceTask() MaintenanceTask {
+	return MaintenanceTask{
+		Name:        "validation_cleanup",
+		Description: fmt.Sprintf("Purge template validation/preview results (consumed, or older than %s)", v.retention),
+		Interval:    validationCleanupInterval,
+		Run:         v.runCleanup,
+	}
+}
+
+// runCleanup calls metadata.purge_validation_results() and logs deletions.
+func (v *ValidationCleanupTask) runCleanup(ctx context.Context) (string, error) {
+	var deletedCount int
+	err := v.dbPool.QueryRow(ctx,
+		"SELECT metadata.purge_validation_results($1::interval, $2::interval)",
+		intervalString(v.retention), intervalString(validationConsumedGrace),
+	).Scan(&deletedCount)
+	if err != nil {
+		return "", fmt.Errorf("purge_validation_results(): %w", err)
+	}
+
+	// Runs every minute; only log when something was removed
+	if deletedCount > 0 {
+		log.Printf("[ValidationCleanup] Purged %d validation/preview results", deletedCount)
+	}
+	return fmt.Sprintf("Purged %d results", deletedCount), nil
+}
+
+// intervalString formats a duration as a PostgreSQL interval literal.
+func intervalString(d time.Duration) string {
+	return fmt.Sprintf("%d seconds", int64(d/time.Second))
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	textTemplate "text/template"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -17,6 +19,10 @@ type ValidationArgs struct {
 	HTMLTemplate    string `json:"html_template"`
 	TextTemplate    string `json:"text_template"`
 	SMSTemplate     string `json:"sms_template"`
+
+	// Renders the SMS part to count its segments (v0.116.0) and the parts
+	// checked for warnings (v0.117.0)
+	SampleEntityData json.RawMessage `json:"sample_entity_data,omitempty"`
 }
 
 // Kind returns the job type identifier
@@ -44,26 +50,34 @@ func (w *ValidationWorker) Work(ctx context.Context, job *river.Job[ValidationAr
 	log.Printf("[Job %d] Starting validation job (attempt %d/%d): validation_id=%s",
 		job.ID, job.Attempt, job.MaxAttempts, job.Args.ValidationID)
 
-	// Validate each non-empty template part
-	results := []ValidationPartResult{}
-
-	if job.Args.SubjectTemplate != "" {
-		result := w.validatePart("subject", job.Args.SubjectTemplate, false)
-		results = append(results, result)
-	}
-
-	if job.Args.HTMLTemplate != "" {
-		result := w.validatePart("html", job.Args.HTMLTemplate, true)
-		results = append(results, result)
-	}
-
-	if job.Args.TextTemplate != "" {
-		result := w.validatePart("text", job.Args.TextTemplate, false)
-		results = append(results, result)
+	sampleEntityData := job.Args.SampleEntityData
+	if len(sampleEntityData) == 0 {
+		sampleEntityData = json.RawMessage(`{}`)
 	}
 
-	if job.Args.SMSTemplate != "" {
-		result := w.validatePart("sms", job.Args.SMSTemplate, false)
+	// Validate each non-empty template part. Parts that parse are checked
+	// for warnings, which don't make them invalid.
+	results := []ValidationPartResult{}
+	for _, part := range []struct {
+		name     string
+		template string
+		isHTML   bool
+	}{
+		{"subject", job.Args.SubjectTemplate, false},
+		{"html", job.Args.HTMLTemplate, true},
+		{"text", job.Args.TextTemplate, false},
+		{"sms", job.Args.SMSTemplate, false},
+	} {
+		if part.template == "" {
+			continue
+		}
+		result := w.validatePart(part.name, part.template, part.isHTML)
+		if result.Valid {
+			result.Warnings = w.lintPart(job.ID, part.template, part.isHTML, sampleEntityData)
+			if part.name == "sms" {
+				result.SMS = w.measureSMS(job.ID, part.template, sampleEntityData)
+			}
+		}
 		results = append(results, result)
 	}
 
@@ -94,6 +108,8 @@ type ValidationPartResult struct {
 	PartName     string
 	Valid        bool
 	ErrorMessage string
+	Warnings     []string     // Likely mistakes in a valid part (see template_lint.go)
+	SMS          *SMSSegments // SMS part rendered with sample data; nil otherwise
 }
 
 // validatePart validates a single template part
@@ -116,12 +132,54 @@ func (w *ValidationWorker) validatePart(partName, template string, isHTML bool)
 	}
 }
 
+// lintPart returns warnings for a part that parsed: entity references the
+// sample data lacks and, for HTML, problems in the email rendered with it
+func (w *ValidationWorker) lintPart(jobID int64, template string, isHTML bool, sampleEntityData json.RawMessage) []string {
+	var entity map[string]interface{}
+	if err := json.Unmarshal(sampleEntityData, &entity); err != nil {
+		log.Printf("[Job %d] Skipping template warnings, invalid sample data: %v", jobID, err)
+		return nil
+	}
+	warnings, err := missingEntityReferences(template, textTemplate.FuncMap(w.renderer.getTemplateFuncs()), entity)
+	if err != nil {
+		log.Printf("[Job %d] Could not check entity references: %v", jobID, err)
+	}
+	if !isHTML {
+		return warnings
+	}
+
+	rendered, err := w.renderer.RenderTemplatePart(template, true, sampleEntityData)
+	if err != nil {
+		return append(warnings, fmt.Sprintf("does not render with the sample data: %v", err))
+	}
+	return append(warnings, lintRenderedHTML(rendered, w.renderer.siteURL)...)
+}
+
+// measureSMS renders the SMS template with the sample data and counts its
+// segments. A template that doesn't render with the sample data still passed
+// validation, so the count is just left out.
+func (w *ValidationWorker) measureSMS(jobID int64, template string, sampleEntityData json.RawMessage) *SMSSegments {
+	rendered, err := w.renderer.RenderTemplatePart(template, false, sampleEntityData)
+	if err != nil {
+		log.Printf("[Job %d] Could not render SMS with sample data: %v", jobID, err)
+		return nil
+	}
+	segments := countSMSSegments(rendered)
+	return &segments
+}
+
 // insertValidationResult inserts a validation result into the database
 func (w *ValidationWorker) insertValidationResult(ctx context.Context, validationID string, result ValidationPartResult) error {
+	var smsLength, smsSegments *int
+	var smsEncoding *string
+	if result.SMS != nil {
+		smsLength, smsSegments, smsEncoding = &result.SMS.Length, &result.SMS.Segments, &result.SMS.Encoding
+	}
 	_, err := w.dbPool.Exec(ctx, `
-		INSERT INTO metadata.template_part_validation_results (validation_id, part_name, valid, error_message)
-		VALUES ($1, $2, $3, $4)
-	`, validationID, result.PartName, result.Valid, result.ErrorMessage)
+		INSERT INTO metadata.template_part_validation_results
+			(validation_id, part_name, valid, error_message, warnings, sms_length, sms_segments, sms_encoding)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, validationID, result.PartName, result.Valid, result.ErrorMessage, nonNilStrings(result.Warnings), smsLength, smsSegments, smsEncoding)
 
 	return err
 }
@@ -0,0 +1,125 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Virus Scanning
+//
+// The file pipeline streams each upload to a FileScanner. The one scanner is
+// clamd (ClamAV's daemon) over TCP with the INSTREAM command, so the worker
+// needs no ClamAV libraries or temp files: the file is sent in length-
+// prefixed chunks and clamd answers "stream: OK" or "stream: <name> FOUND".
+// CLAMAV_ADDRESS (host:port, e.g. clamav:3310) enables it.
+// ============================================================================
+
+// clamdTimeout bounds one scan, including the upload to clamd
+const clamdTimeout = 5 * time.Minute
+
+// clamdChunkSize is the INSTREAM chunk size
+const clamdChunkSize = 64 * 1024
+
+// errScanTooLarge means the file exceeds the scanner's size limit
+// (clamd's StreamMaxLength); retrying won't help
+var errScanTooLarge = errors.New("file exceeds the scanner's size limit")
+
+// FileScanner scans file content for malware
+type FileScanner interface {
+	// Scan reads r and returns the signature found, or "" if it is clean
+	Scan(ctx context.Context, r io.Reader) (string, error)
+}
+
+// ClamdScanner scans through a clamd daemon
+type ClamdScanner struct {
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner returns a scanner for the clamd at address, or nil when
+// address is empty
+func NewClamdScanner(address string) *ClamdScanner {
+	if address == "" {
+		return nil
+	}
+	return &ClamdScanner{address: address, timeout: clamdTimeout}
+}
+
+func (c *ClamdScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline) //nolint:errcheck // a failed deadline surfaces as an I/O error
+
+	// clamd stops reading once a stream passes its limit and replies at
+	// once, so a write error may still have a reply behind it
+	writeErr := clamdSend(conn, r)
+	reply, readErr := bufio.NewReader(conn).ReadString(0)
+	if readErr != nil {
+		if writeErr != nil {
+			return "", writeErr
+		}
+		return "", fmt.Errorf("failed to read clamd reply: %w", readErr)
+	}
+	return parseClamdReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+// clamdSend writes an INSTREAM command with r as its chunks
+func clamdSend(conn net.Conn, r io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return fmt.Errorf("failed to send to clamd: %w", werr)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	return nil
+}
+
+// parseClamdReply turns clamd's INSTREAM reply into a signature or error
+func parseClamdReply(reply string) (string, error) {
+	reply = strings.TrimSpace(reply)
+	switch {
+	case reply == "stream: OK":
+		return "", nil
+	case strings.HasPrefix(reply, "stream: ") && strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND"), nil
+	case strings.Contains(reply, "size limit exceeded"):
+		return "", errScanTooLarge
+	default:
+		return "", fmt.Errorf("clamd: %s", reply)
+	}
+}
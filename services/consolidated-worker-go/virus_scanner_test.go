@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeClamd accepts one INSTREAM session per connection and replies with
+// reply(content)
+func fakeClamd(t *testing.T, reply func(content []byte) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+				var content bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, r, int64(size)); err != nil {
+						return
+					}
+				}
+				conn.Write([]byte(reply(content.Bytes()) + "\x00"))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamdScanner(t *testing.T) {
+	address := fakeClamd(t, func(content []byte) string {
+		switch {
+		case bytes.Contains(content, []byte("EICAR")):
+			return "stream: Eicar-Signature FOUND"
+		case len(content) > 100_000:
+			return "INSTREAM size limit exceeded. ERROR"
+		default:
+			return "stream: OK"
+		}
+	})
+	scanner := NewClamdScanner(address)
+
+	if signature, err := scanner.Scan(context.Background(), strings.NewReader("hello")); err != nil || signature != "" {
+		t.Errorf("clean file: Scan() = %q, %v", signature, err)
+	}
+	// Spans several INSTREAM chunks
+	infected := strings.Repeat("x", 2*clamdChunkSize) + "EICAR"
+	if signature, err := scanner.Scan(context.Background(), strings.NewReader(infected)); err != nil || signature != "Eicar-Signature" {
+		t.Errorf("infected file: Scan() = %q, %v", signature, err)
+	}
+	if _, err := scanner.Scan(context.Background(), bytes.NewReader(make([]byte, 200_000))); !errors.Is(err, errScanTooLarge) {
+		t.Errorf("large file: Scan() = %v, want errScanTooLarge", err)
+	}
+
+	if NewClamdScanner("") != nil {
+		t.Error("NewClamdScanner(\"\") should disable scanning")
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	for _, tt := range []struct {
+		reply     string
+		signature string
+		wantErr   bool
+	}{
+		{"stream: OK", "", false},
+		{"stream: Win.Test.EICAR_HDB-1 FOUND\n", "Win.Test.EICAR_HDB-1", false},
+		{"INSTREAM size limit exceeded. ERROR", "", true},
+		{"stream: Can't allocate memory ERROR", "", true},
+	} {
+		signature, err := parseClamdReply(tt.reply)
+		if signature != tt.signature || (err != nil) != tt.wantErr {
+			t.Errorf("parseClamdReply(%q) = %q, %v", tt.reply, signature, err)
+		}
+	}
+}
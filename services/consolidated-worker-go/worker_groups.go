@@ -0,0 +1,315 @@
+// Copyright (C) 2023-2026 Civic OS, L3C. Licensed under AGPL-3.0-or-later.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Worker Groups
+//
+// The worker's job kinds are split into groups that are enabled or disabled
+// together. WORKERS_ENABLED (comma-separated group names, empty = all) and
+// WORKERS_DISABLED choose the groups this process runs, so a deployment can
+// run thumbnails on a larger node or leave out groups whose services it
+// doesn't have. A disabled group's dependencies (pdftoppm, SMTP, Keycloak,
+// a signature provider) are never checked.
+//
+// A group owns its queues outright: River fails a job whose kind has no
+// registered worker, so a process polls a queue only when it registers every
+// kind on it. Jobs on a disabled group's queues wait for a process that runs
+// the group.
+//
+// Optional groups need something configured before they can run (an
+// identity provider, a signature provider, a cgo build). They stay off
+// without it unless named in WORKERS_ENABLED, which makes the missing
+// dependency a startup error.
+//
+// WORKER_PROFILE (cpu, io or all; default all) narrows the groups before
+// WORKERS_ENABLED and WORKERS_DISABLED apply. CPU-bound groups (thumbnails,
+// source parsing) make up the cpu profile and every other group the io
+// profile, so one image deploys as a CPU pool scaled on CPU use and an I/O
+// pool scaled on queue depth, each polling only its own queues.
+// ============================================================================
+
+// Worker profiles (WORKER_PROFILE)
+const (
+	workerProfileAll = "all"
+	workerProfileCPU = "cpu"
+	workerProfileIO  = "io"
+)
+
+// WorkerGroup describes a set of job kinds enabled and disabled together
+type WorkerGroup struct {
+	Name     string
+	Queues   map[string]int // queue → default MaxWorkers
+	Kinds    []string
+	Requires []string // what must be configured, for logs and errors
+	Optional bool
+	CPUBound bool // in the cpu profile rather than io
+}
+
+// Profile returns the WORKER_PROFILE that runs the group
+func (g WorkerGroup) Profile() string {
+	if g.CPUBound {
+		return workerProfileCPU
+	}
+	return workerProfileIO
+}
+
+// workerGroups lists every group; TestWorkerGroupsOwnTheirQueues checks the
+// kinds and queues against the job args
+var workerGroups = []WorkerGroup{
+	{
+		Name:     "uploads",
+		Queues:   map[string]int{"s3_signer": 20}, // I/O-bound, many workers
+		Kinds:    []string{"s3_presign", "file_pipeline"},
+		Requires: []string{"S3"},
+	},
+	{
+		Name:     "thumbnails",
+		Queues:   map[string]int{"thumbnails": 3}, // CPU-bound, THUMBNAIL_MAX_WORKERS
+		Kinds:    []string{"thumbnail_generate", "thumbnail_backfill", "find_duplicate_files"},
+		Requires: []string{"S3", "pdftoppm", "pdfinfo", "image processor"},
+		CPUBound: true,
+	},
+	{
+		Name:   "notifications",
+		Queues: map[string]int{"notifications": 30}, // I/O-bound (SMTP), many workers
+		Kinds: []string{"send_notification", "fan_out_notification", "broadcast_notification",
+			"generate_receipt", "send_email", "validate_template_parts", "preview_template_parts",
+			"activate_template_version", "test_send_notification"},
+		Requires: []string{"SMTP", "Telnyx when SMS_ENABLED"},
+	},
+	{
+		Name:   "recurring",
+		Queues: map[string]int{"recurring": 5}, // Series expansion jobs
+		Kinds:  []string{"expand_recurring_series"},
+	},
+	{
+		Name:     "scheduled_jobs",
+		Queues:   map[string]int{"scheduled_jobs": 5}, // Scheduled SQL function execution
+		Kinds:    []string{"scheduled_job_execute", "scheduled_job_http", "db_backup"},
+		Requires: []string{"pg_dump for backups"},
+	},
+	{
+		Name:   "webhooks",
+		Queues: map[string]int{"webhooks": 10}, // Outbound entity webhooks
+		Kinds:  []string{"entity_webhook_delivery"},
+	},
+	{
+		Name:   "inbound_webhooks",
+		Queues: map[string]int{"inbound_webhooks": 5}, // SMS and email delivery reports
+		Kinds:  []string{"sms_delivery_webhook", "email_event_webhook"},
+	},
+	{
+		Name:     "archival",
+		Queues:   map[string]int{"archival": 2}, // Entity archival (long DB batches)
+		Kinds:    []string{"archive_entities", "unarchive_entity"},
+		Requires: []string{"S3"},
+	},
+	{
+		Name:   "job_admin",
+		Queues: map[string]int{"job_admin": 1}, // Bulk retry/cancel, one run at a time
+		Kinds:  []string{"job_admin_retry_discarded", "job_admin_cancel_stuck"},
+	},
+	{
+		Name:     "outbox",
+		Queues:   map[string]int{"outbox": 5}, // Outbox dispatch, one destination per job
+		Kinds:    []string{"outbox_dispatch"},
+		Requires: []string{"identity provider for keycloak messages"},
+	},
+	{
+		Name:     "exports",
+		Queues:   map[string]int{"exports": 2}, // Entity exports (long queries, temp files)
+		Kinds:    []string{"export_generate"},
+		Requires: []string{"S3"},
+	},
+	{
+		Name:     "imports",
+		Queues:   map[string]int{"imports": 2}, // Entity imports (long transactions)
+		Kinds:    []string{"entity_import"},
+		Requires: []string{"S3"},
+	},
+	{
+		Name:   "audit",
+		Queues: map[string]int{"audit": 2}, // Entity change history capture
+		Kinds:  []string{"entity_audit_capture"},
+	},
+	{
+		Name:     "signatures",
+		Queues:   map[string]int{"signatures": 2}, // E-signature provider API calls
+		Kinds:    []string{"signature_send", "signature_complete", "signature_webhook"},
+		Requires: []string{"SIGNATURE_PROVIDER"},
+		Optional: true,
+	},
+	{
+		Name:     "source_parsing",
+		Queues:   map[string]int{"source_parsing": 1}, // Serial — one parse at a time
+		Kinds:    []string{"parse_all_source_code"},
+		Requires: []string{"cgo build (libpg_query)"},
+		Optional: true,
+		CPUBound: true,
+	},
+	{
+		Name:   "user_provisioning",
+		Queues: map[string]int{"user_provisioning": 5}, // Keycloak user provisioning + role sync
+		Kinds: []string{"provision_keycloak_user", "deprovision_user", "bulk_provision_users", "update_keycloak_user",
+			"sync_keycloak_role", "assign_keycloak_role", "revoke_keycloak_role",
+			"sync_keycloak_group", "assign_keycloak_group", "revoke_keycloak_group", "keycloak_user_sync", "role_audit"},
+		Requires: []string{"IDENTITY_PROVIDER or KEYCLOAK_ADMIN_URL"},
+		Optional: true,
+	},
+}
+
+// WorkerSelection is the set of worker groups this process runs
+type WorkerSelection struct {
+	profile string
+	enabled map[string]bool
+	named   map[string]bool // listed in WORKERS_ENABLED
+}
+
+// parseWorkerSelection reads WORKER_PROFILE, WORKERS_ENABLED and
+// WORKERS_DISABLED. An empty profile means all, and an empty enabled list
+// every group of the profile. Unknown names, and enabling a group outside
+// the profile, are errors so a typo doesn't silently leave a queue unworked.
+func parseWorkerSelection(profile, enabledList, disabledList string) (*WorkerSelection, error) {
+	profile = strings.ToLower(strings.TrimSpace(profile))
+	switch profile {
+	case "":
+		profile = workerProfileAll
+	case workerProfileAll, workerProfileCPU, workerProfileIO:
+	default:
+		return nil, fmt.Errorf("WORKER_PROFILE: unknown profile %q (known: cpu, io, all)", profile)
+	}
+
+	known := make(map[string]bool, len(workerGroups))
+	for _, g := range workerGroups {
+		known[g.Name] = true
+	}
+	parse := func(key, list string) (map[string]bool, error) {
+		names := make(map[string]bool)
+		for _, name := range strings.Split(list, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if !known[name] {
+				return nil, fmt.Errorf("%s: unknown worker group %q (known: %s)", key, name, strings.Join(workerGroupNames(), ", "))
+			}
+			names[name] = true
+		}
+		return names, nil
+	}
+
+	named, err := parse("WORKERS_ENABLED", enabledList)
+	if err != nil {
+		return nil, err
+	}
+	disabled, err := parse("WORKERS_DISABLED", disabledList)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &WorkerSelection{profile: profile, enabled: make(map[string]bool), named: named}
+	for _, g := range workerGroups {
+		inProfile := profile == workerProfileAll || g.Profile() == profile
+		if named[g.Name] && !inProfile {
+			return nil, fmt.Errorf("WORKERS_ENABLED includes %s, which is not in WORKER_PROFILE=%s", g.Name, profile)
+		}
+		if inProfile && (len(named) == 0 || named[g.Name]) && !disabled[g.Name] {
+			s.enabled[g.Name] = true
+		}
+	}
+	if len(s.enabled) == 0 {
+		return nil, fmt.Errorf("WORKER_PROFILE=%s, WORKERS_ENABLED and WORKERS_DISABLED leave no worker groups enabled", profile)
+	}
+	return s, nil
+}
+
+// Profile returns WORKER_PROFILE: cpu, io or all
+func (s *WorkerSelection) Profile() string {
+	return s.profile
+}
+
+// Enabled reports whether the group runs in this process
+func (s *WorkerSelection) Enabled(name string) bool {
+	return s.enabled[name]
+}
+
+// Configure settles an optional group once its dependency is known: it is
+// disabled when not configured, unless WORKERS_ENABLED names it, which is
+// an error
+func (s *WorkerSelection) Configure(name string, configured bool) error {
+	if !s.enabled[name] || configured {
+		return nil
+	}
+	if s.named[name] {
+		g := workerGroupByName(name)
+		return fmt.Errorf("WORKERS_ENABLED includes %s, which requires %s", name, strings.Join(g.Requires, ", "))
+	}
+	delete(s.enabled, name)
+	return nil
+}
+
+// Groups returns the enabled groups in declaration order
+func (s *WorkerSelection) Groups() []WorkerGroup {
+	var groups []WorkerGroup
+	for _, g := range workerGroups {
+		if s.enabled[g.Name] {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// Queues returns the River queue config for the enabled groups. maxWorkers
+// overrides a queue's default worker count.
+func (s *WorkerSelection) Queues(maxWorkers map[string]int) map[string]river.QueueConfig {
+	queues := make(map[string]river.QueueConfig)
+	for _, g := range s.Groups() {
+		for queue, workers := range g.Queues {
+			if n, ok := maxWorkers[queue]; ok {
+				workers = n
+			}
+			queues[queue] = river.QueueConfig{MaxWorkers: max(workers, 1)}
+		}
+	}
+	return queues
+}
+
+// String lists the enabled groups, for the startup log
+func (s *WorkerSelection) String() string {
+	if len(s.enabled) == len(workerGroups) {
+		return "all"
+	}
+	names := make([]string, 0, len(s.enabled))
+	for _, g := range s.Groups() {
+		names = append(names, g.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// workerGroupNames returns every group name, sorted
+func workerGroupNames() []string {
+	names := make([]string, len(workerGroups))
+	for i, g := range workerGroups {
+		names[i] = g.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func workerGroupByName(name string) WorkerGroup {
+	for _, g := range workerGroups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return WorkerGroup{Name: name}
+}
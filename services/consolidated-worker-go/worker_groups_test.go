@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/riverqueue/river"
+)
+
+// allJobArgs is one value of every job the worker registers
+var allJobArgs = []interface {
+	Kind() string
+	InsertOpts() river.InsertOpts
+}{
+	S3PresignArgs{}, FilePipelineArgs{}, ThumbnailArgs{}, ThumbnailBackfillArgs{}, FindDuplicateFilesArgs{},
+	NotificationArgs{}, FanOutNotificationArgs{}, BroadcastNotificationArgs{}, GenerateReceiptArgs{},
+	SendEmailArgs{}, ValidationArgs{}, PreviewArgs{}, ActivateTemplateVersionArgs{}, TestSendArgs{},
+	ExpandRecurringSeriesArgs{}, ScheduledJobExecuteArgs{}, ScheduledJobHTTPArgs{}, DBBackupArgs{},
+	EntityWebhookDeliveryArgs{}, ArchiveEntitiesArgs{}, UnarchiveEntityArgs{},
+	RetryDiscardedJobsArgs{}, CancelStuckJobsArgs{}, OutboxDispatchArgs{},
+	ExportGenerateArgs{}, EntityImportArgs{}, EntityAuditCaptureArgs{},
+	SignatureSendArgs{}, SignatureCompleteArgs{}, SignatureWebhookArgs{}, ParseAllSourceCodeArgs{},
+	SMSDeliveryWebhookArgs{}, EmailEventWebhookArgs{},
+	ProvisionUserArgs{}, DeprovisionUserArgs{}, BulkProvisionUsersArgs{}, UpdateKeycloakUserArgs{},
+	SyncKeycloakRoleArgs{}, AssignKeycloakRoleArgs{}, RevokeKeycloakRoleArgs{},
+	SyncKeycloakGroupArgs{}, AssignKeycloakGroupArgs{}, RevokeKeycloakGroupArgs{}, KeycloakUserSyncArgs{}, RoleAuditArgs{},
+}
+
+func TestWorkerGroupsOwnTheirQueues(t *testing.T) {
+	groupOfKind := make(map[string]WorkerGroup)
+	groupOfQueue := make(map[string]string)
+	for _, g := range workerGroups {
+		for _, kind := range g.Kinds {
+			if other, ok := groupOfKind[kind]; ok {
+				t.Errorf("kind %s is in both %s and %s", kind, other.Name, g.Name)
+			}
+			groupOfKind[kind] = g
+		}
+		for queue := range g.Queues {
+			if other, ok := groupOfQueue[queue]; ok {
+				t.Errorf("queue %s is in both %s and %s", queue, other, g.Name)
+			}
+			groupOfQueue[queue] = g.Name
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, args := range allJobArgs {
+		kind, queue := args.Kind(), args.InsertOpts().Queue
+		seen[kind] = true
+		g, ok := groupOfKind[kind]
+		if !ok {
+			t.Errorf("kind %s is in no worker group", kind)
+			continue
+		}
+		if _, ok := g.Queues[queue]; !ok {
+			t.Errorf("kind %s runs on queue %s, which group %s doesn't own", kind, queue, g.Name)
+		}
+	}
+	for kind := range groupOfKind {
+		if !seen[kind] {
+			t.Errorf("group kind %s has no job args in allJobArgs", kind)
+		}
+	}
+}
+
+func TestParseWorkerSelection(t *testing.T) {
+	all, err := parseWorkerSelection("", "", "")
+	if err != nil || len(all.Groups()) != len(workerGroups) || all.String() != "all" {
+		t.Fatalf("empty selection = %v, %v; want every group", all, err)
+	}
+
+	s, err := parseWorkerSelection("", " Thumbnails, notifications ,", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Enabled("thumbnails") || !s.Enabled("notifications") || s.Enabled("uploads") {
+		t.Errorf("selection = %s", s)
+	}
+	queues := s.Queues(map[string]int{"thumbnails": 8})
+	if len(queues) != 2 || queues["thumbnails"].MaxWorkers != 8 || queues["notifications"].MaxWorkers != 30 {
+		t.Errorf("queues = %v", queues)
+	}
+
+	s, err = parseWorkerSelection("", "", "thumbnails,user_provisioning")
+	if err != nil || s.Enabled("thumbnails") || s.Enabled("user_provisioning") || !s.Enabled("uploads") {
+		t.Errorf("disabled selection = %v, %v", s, err)
+	}
+
+	for _, lists := range [][2]string{{"thumbnail", ""}, {"", "smtp"}, {"uploads", "uploads"}} {
+		if _, err := parseWorkerSelection("", lists[0], lists[1]); err == nil {
+			t.Errorf("parseWorkerSelection(%q, %q) = nil error", lists[0], lists[1])
+		}
+	}
+}
+
+func TestWorkerSelectionConfigure(t *testing.T) {
+	// Enabled by default: a missing dependency quietly turns the group off
+	s, _ := parseWorkerSelection("", "", "")
+	if err := s.Configure("user_provisioning", false); err != nil || s.Enabled("user_provisioning") {
+		t.Errorf("Configure(default) = %v, enabled %v", err, s.Enabled("user_provisioning"))
+	}
+	if _, ok := s.Queues(nil)["user_provisioning"]; ok {
+		t.Error("a disabled group's queue should not be polled")
+	}
+
+	// Named in WORKERS_ENABLED: a missing dependency is an error
+	s, _ = parseWorkerSelection("", "user_provisioning", "")
+	err := s.Configure("user_provisioning", false)
+	if err == nil || !strings.Contains(err.Error(), "KEYCLOAK_ADMIN_URL") {
+		t.Errorf("Configure(named) = %v, want the requirement in the error", err)
+	}
+	if err := s.Configure("user_provisioning", true); err != nil || !s.Enabled("user_provisioning") {
+		t.Errorf("Configure(configured) = %v", err)
+	}
+}
+
+func TestParseWorkerSelection_Profile(t *testing.T) {
+	cpu, err := parseWorkerSelection("CPU", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cpu.String(); got != "thumbnails, source_parsing" {
+		t.Errorf("cpu profile = %s", got)
+	}
+
+	io, err := parseWorkerSelection("io", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if io.Enabled("thumbnails") || !io.Enabled("notifications") || !io.Enabled("uploads") || !io.Enabled("user_provisioning") {
+		t.Errorf("io profile = %s", io)
+	}
+	if len(cpu.Groups())+len(io.Groups()) != len(workerGroups) {
+		t.Errorf("cpu and io profiles cover %d of %d groups", len(cpu.Groups())+len(io.Groups()), len(workerGroups))
+	}
+
+	// WORKERS_ENABLED and WORKERS_DISABLED narrow the profile further
+	s, err := parseWorkerSelection("io", "", "archival,exports")
+	if err != nil || s.Enabled("archival") || !s.Enabled("imports") {
+		t.Errorf("io without archival = %v, %v", s, err)
+	}
+
+	for _, lists := range [][3]string{{"gpu", "", ""}, {"io", "thumbnails", ""}, {"cpu", "", "thumbnails,source_parsing"}} {
+		if _, err := parseWorkerSelection(lists[0], lists[1], lists[2]); err == nil {
+			t.Errorf("parseWorkerSelection(%q, %q, %q) = nil error", lists[0], lists[1], lists[2])
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Manual Capture Workers
+//
+// Payments created with capture_method = 'manual' stop at requires_capture
+// once the card is authorized. public.capture_payment() enqueues
+// capture_payment to charge the hold; public.void_payment() and the
+// expire_uncaptured_authorizations scheduled job enqueue cancel_payment_intent
+// to release it.
+// ============================================================================
+
+// CapturePaymentWorkerArgs matches the JSON args inserted by capture_payment()
+type CapturePaymentWorkerArgs struct {
+	PaymentID string `json:"payment_id"`
+}
+
+// Kind returns the job kind identifier for River
+func (CapturePaymentWorkerArgs) Kind() string {
+	return "capture_payment"
+}
+
+// CancelPaymentIntentWorkerArgs matches the JSON args inserted by
+// payments.enqueue_cancel_payment_intent()
+type CancelPaymentIntentWorkerArgs struct {
+	PaymentID string `json:"payment_id"`
+	Reason    string `json:"reason"` // "voided" (or a staff-supplied reason) or "expired"
+}
+
+// Kind returns the job kind identifier for River
+func (CancelPaymentIntentWorkerArgs) Kind() string {
+	return "cancel_payment_intent"
+}
+
+// CapturePaymentWorker charges authorized payments
+type CapturePaymentWorker struct {
+	river.WorkerDefaults[CapturePaymentWorkerArgs]
+	dbPool    *pgxpool.Pool
+	providers *ProviderRegistry
+}
+
+// NewCapturePaymentWorker creates a new CapturePaymentWorker
+func NewCapturePaymentWorker(dbPool *pgxpool.Pool, providers *ProviderRegistry) *CapturePaymentWorker {
+	return &CapturePaymentWorker{
+		dbPool:    dbPool,
+		providers: providers,
+	}
+}
+
+// Work captures one authorized payment
+func (w *CapturePaymentWorker) Work(ctx context.Context, job *river.Job[CapturePaymentWorkerArgs]) error {
+	paymentID := job.Args.PaymentID
+	log.Printf("[Capture] Processing job for payment %s", paymentID)
+
+	capturer, providerPaymentID, err := loadAuthorizedPayment(ctx, w.dbPool, w.providers, paymentID, "Capture")
+	if err != nil || capturer == nil {
+		return err
+	}
+
+	if err := capturer.CapturePayment(ctx, providerPaymentID); err != nil {
+		log.Printf("[Capture] Error capturing payment %s: %v", paymentID, err)
+		// Keep requires_capture so staff can retry or void; River retries too
+		if updateErr := recordCaptureError(ctx, w.dbPool, paymentID, err.Error()); updateErr != nil {
+			log.Printf("[Capture] Failed to record error: %v", updateErr)
+		}
+		return fmt.Errorf("capture error: %w", err)
+	}
+
+	// The payment_intent.succeeded webhook makes the same transition; the
+	// status guard means whichever arrives second is a no-op
+	_, err = w.dbPool.Exec(ctx, `
+		UPDATE payments.transactions
+		SET
+			status = 'succeeded',
+			captured_at = NOW(),
+			error_message = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'requires_capture'
+	`, paymentID)
+	if err != nil {
+		return fmt.Errorf("database update error: %w", err)
+	}
+
+	log.Printf("[Capture] ✓ Payment %s captured", paymentID)
+	return nil
+}
+
+// CancelPaymentIntentWorker releases authorized payments without charging them
+type CancelPaymentIntentWorker struct {
+	river.WorkerDefaults[CancelPaymentIntentWorkerArgs]
+	dbPool    *pgxpool.Pool
+	providers *ProviderRegistry
+}
+
+// NewCancelPaymentIntentWorker creates a new CancelPaymentIntentWorker
+func NewCancelPaymentIntentWorker(dbPool *pgxpool.Pool, providers *ProviderRegistry) *CancelPaymentIntentWorker {
+	return &CancelPaymentIntentWorker{
+		dbPool:    dbPool,
+		providers: providers,
+	}
+}
+
+// Work voids one authorized payment
+func (w *CancelPaymentIntentWorker) Work(ctx context.Context, job *river.Job[CancelPaymentIntentWorkerArgs]) error {
+	paymentID := job.Args.PaymentID
+	log.Printf("[Capture] Processing void for payment %s (reason=%s)", paymentID, job.Args.Reason)
+
+	capturer, providerPaymentID, err := loadAuthorizedPayment(ctx, w.dbPool, w.providers, paymentID, "Void")
+	if err != nil || capturer == nil {
+		return err
+	}
+
+	if err := capturer.CancelPayment(ctx, providerPaymentID); err != nil {
+		log.Printf("[Capture] Error voiding payment %s: %v", paymentID, err)
+		if updateErr := recordCaptureError(ctx, w.dbPool, paymentID, err.Error()); updateErr != nil {
+			log.Printf("[Capture] Failed to record error: %v", updateErr)
+		}
+		return fmt.Errorf("void error: %w", err)
+	}
+
+	_, err = w.dbPool.Exec(ctx, `
+		UPDATE payments.transactions
+		SET
+			status = 'canceled',
+			error_message = $2,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'requires_capture'
+	`, paymentID, voidMessage(job.Args.Reason))
+	if err != nil {
+		return fmt.Errorf("database update error: %w", err)
+	}
+
+	log.Printf("[Capture] ✓ Payment %s voided", paymentID)
+	return nil
+}
+
+// loadAuthorizedPayment fetches a payment and its provider for a capture or
+// void. Returns a nil capturer (and nil error) when there is nothing to do:
+// the payment already left requires_capture, or its provider can't capture.
+// Under DRY_RUN the job is cancelled and the payment keeps requires_capture.
+func loadAuthorizedPayment(ctx context.Context, dbPool *pgxpool.Pool, providers *ProviderRegistry, paymentID, action string) (manualCapturer, string, error) {
+	var payment struct {
+		Status            string
+		Provider          string
+		ProviderPaymentID *string
+	}
+	err := dbPool.QueryRow(ctx, `
+		SELECT status, provider, provider_payment_id
+		FROM payments.transactions
+		WHERE id = $1
+	`, paymentID).Scan(&payment.Status, &payment.Provider, &payment.ProviderPaymentID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			log.Printf("[Capture] Payment %s not found", paymentID)
+			return nil, "", fmt.Errorf("payment not found: %s", paymentID)
+		}
+		return nil, "", fmt.Errorf("database error: %w", err)
+	}
+
+	// Idempotent: a webhook or an earlier attempt already settled it
+	if payment.Status != "requires_capture" {
+		log.Printf("[Capture] %s skipped: payment %s is %s, not requires_capture", action, paymentID, payment.Status)
+		return nil, "", nil
+	}
+	if payment.ProviderPaymentID == nil {
+		return nil, "", fmt.Errorf("payment %s has no provider payment ID", paymentID)
+	}
+
+	provider, err := providers.Get(payment.Provider)
+	if err != nil {
+		return nil, "", err
+	}
+	capturer, ok := provider.(manualCapturer)
+	if !ok {
+		// Not retryable; the database only allows manual capture for Stripe
+		log.Printf("[Capture] Provider %s does not support manual capture, skipping payment %s", provider.Name(), paymentID)
+		return nil, "", nil
+	}
+	if providers.dryRun.Skip(ctx, provider.Name(), strings.ToLower(action)+"_payment", *payment.ProviderPaymentID,
+		map[string]any{"payment_id": paymentID}) {
+		return nil, "", river.JobCancel(errDryRun)
+	}
+	return capturer, *payment.ProviderPaymentID, nil
+}
+
+// recordCaptureError stores a failed capture or void attempt on the payment
+// without changing its status
+func recordCaptureError(ctx context.Context, dbPool *pgxpool.Pool, paymentID, errorMsg string) error {
+	_, err := dbPool.Exec(ctx, `
+		UPDATE payments.transactions
+		SET error_message = $1, updated_at = NOW()
+		WHERE id = $2
+	`, errorMsg, paymentID)
+	return err
+}
+
+// voidMessage explains a voided authorization in error_message
+func voidMessage(reason string) string {
+	switch reason {
+	case "", "voided":
+		return "Authorization voided"
+	case "expired":
+		return "Authorization expired before capture"
+	default:
+		return "Authorization voided: " + reason
+	}
+}
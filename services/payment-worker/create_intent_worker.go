@@ -18,6 +18,14 @@ type FeeConfig struct {
 	Percent    float64 // Fee percentage (e.g., 2.9 for 2.9%)
 	FlatCents  int     // Flat fee in cents (e.g., 30 for $0.30)
 	Refundable bool    // Whether the fee is refundable (default: false)
+
+	// ACH debits are priced differently from cards (Stripe: 0.8% capped at $5)
+	ACHPercent  float64 // ACH fee percentage (e.g., 0.8 for 0.8%)
+	ACHCapCents int     // Maximum ACH fee in cents (0 = no cap)
+
+	// Bounds on the computed fee for either method (fee schedules only)
+	MinCents int // Minimum fee in cents (0 = no minimum)
+	MaxCents int // Maximum fee in cents (0 = no maximum)
 }
 
 // CalculateFee calculates the processing fee needed to ensure the recipient
@@ -57,6 +65,47 @@ func (fc *FeeConfig) CalculateFee(baseAmountCents int64) int64 {
 	return int64(math.Ceil(feeCents))
 }
 
+// CalculateACHFee calculates the processing fee for an ACH debit using the
+// same gross-up as CalculateFee with ACHPercent and no flat fee. Once the
+// grossed-up fee reaches ACHCapCents the processor charges the cap, so the
+// cap is passed through as-is.
+func (fc *FeeConfig) CalculateACHFee(baseAmountCents int64) int64 {
+	if !fc.Enabled {
+		return 0
+	}
+
+	percent := fc.ACHPercent / 100.0
+	feeCents := int64(math.Ceil(float64(baseAmountCents)/(1.0-percent) - float64(baseAmountCents)))
+
+	if fc.ACHCapCents > 0 && feeCents > int64(fc.ACHCapCents) {
+		return int64(fc.ACHCapCents)
+	}
+	return feeCents
+}
+
+// FeeFor returns the processing fee for a payment method, within MinCents
+// and MaxCents
+func (fc *FeeConfig) FeeFor(paymentMethod string, baseAmountCents int64) int64 {
+	if !fc.Enabled {
+		return 0
+	}
+
+	var fee int64
+	if paymentMethod == PaymentMethodUSBankAccount {
+		fee = fc.CalculateACHFee(baseAmountCents)
+	} else {
+		fee = fc.CalculateFee(baseAmountCents)
+	}
+
+	if fc.MinCents > 0 && fee < int64(fc.MinCents) {
+		fee = int64(fc.MinCents)
+	}
+	if fc.MaxCents > 0 && fee > int64(fc.MaxCents) {
+		fee = int64(fc.MaxCents)
+	}
+	return fee
+}
+
 // CreateIntentWorkerArgs contains the arguments for CreateIntentWorker
 // This matches the JSON args inserted by the PostgreSQL trigger
 type CreateIntentWorkerArgs struct {
@@ -72,16 +121,16 @@ func (CreateIntentWorkerArgs) Kind() string {
 type CreateIntentWorker struct {
 	river.WorkerDefaults[CreateIntentWorkerArgs]
 	dbPool    *pgxpool.Pool
-	provider  PaymentProvider
-	feeConfig *FeeConfig
+	providers *ProviderRegistry
+	fees      *FeeSchedules
 }
 
 // NewCreateIntentWorker creates a new CreateIntentWorker
-func NewCreateIntentWorker(dbPool *pgxpool.Pool, provider PaymentProvider, feeConfig *FeeConfig) *CreateIntentWorker {
+func NewCreateIntentWorker(dbPool *pgxpool.Pool, providers *ProviderRegistry, fees *FeeSchedules) *CreateIntentWorker {
 	return &CreateIntentWorker{
 		dbPool:    dbPool,
-		provider:  provider,
-		feeConfig: feeConfig,
+		providers: providers,
+		fees:      fees,
 	}
 }
 
@@ -93,12 +142,17 @@ func (w *CreateIntentWorker) Work(ctx context.Context, job *river.Job[CreateInte
 
 	// 1. Fetch payment record from database
 	var payment struct {
-		ID          string
-		UserID      string
-		Amount      float64
-		Currency    string
-		Description *string
-		Status      string
+		ID            string
+		UserID        string
+		Amount        float64
+		Currency      string
+		Description   *string
+		Status        string
+		Provider      string
+		PaymentMethod string
+		CaptureMethod string
+		FeeCategory   string
+		EntityType    string
 	}
 
 	query := `
@@ -108,7 +162,12 @@ func (w *CreateIntentWorker) Work(ctx context.Context, job *river.Job[CreateInte
 			amount,
 			currency,
 			description,
-			status
+			status,
+			provider,
+			payment_method,
+			capture_method,
+			COALESCE(fee_category, ''),
+			COALESCE(entity_type, '')
 		FROM payments.transactions
 		WHERE id = $1
 	`
@@ -120,6 +179,11 @@ func (w *CreateIntentWorker) Work(ctx context.Context, job *river.Job[CreateInte
 		&payment.Currency,
 		&payment.Description,
 		&payment.Status,
+		&payment.Provider,
+		&payment.PaymentMethod,
+		&payment.CaptureMethod,
+		&payment.FeeCategory,
+		&payment.EntityType,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -130,8 +194,8 @@ func (w *CreateIntentWorker) Work(ctx context.Context, job *river.Job[CreateInte
 		return fmt.Errorf("database error: %w", err)
 	}
 
-	log.Printf("[CreateIntent] Fetched payment: id=%s, amount=%.2f %s, status=%s",
-		payment.ID, payment.Amount, payment.Currency, payment.Status)
+	log.Printf("[CreateIntent] Fetched payment: id=%s, amount=%.2f %s, status=%s, provider=%s, method=%s, capture=%s",
+		payment.ID, payment.Amount, payment.Currency, payment.Status, payment.Provider, payment.PaymentMethod, payment.CaptureMethod)
 
 	// 2. Validate payment is in correct state
 	if payment.Status != "pending_intent" {
@@ -139,37 +203,78 @@ func (w *CreateIntentWorker) Work(ctx context.Context, job *river.Job[CreateInte
 		return nil // Not an error - payment was already processed
 	}
 
-	// 3. Convert base amount to cents (Stripe uses smallest currency unit)
+	// 3. Resolve the provider this transaction was created for
+	provider, err := w.providers.Get(payment.Provider)
+	if err != nil {
+		log.Printf("[CreateIntent] Payment %s: %v", paymentID, err)
+		if updateErr := w.updatePaymentError(ctx, paymentID, err.Error()); updateErr != nil {
+			log.Printf("[CreateIntent] Failed to update payment error: %v", updateErr)
+		}
+		return err
+	}
+
+	// 4. Convert base amount to cents (providers use smallest currency unit)
 	baseAmountCents := int64(payment.Amount * 100)
 
-	// 4. Calculate processing fee
-	feeCents := w.feeConfig.CalculateFee(baseAmountCents)
+	// 5. Calculate processing fee from the payment's fee schedule (cards and
+	// ACH debits are priced differently)
+	feeConfig, scheduleID, err := w.fees.Resolve(ctx, payment.FeeCategory, payment.EntityType)
+	if err != nil {
+		log.Printf("[CreateIntent] Error loading fee schedules for payment %s: %v", paymentID, err)
+		return fmt.Errorf("failed to load fee schedules: %w", err)
+	}
+	feeCents := feeConfig.FeeFor(payment.PaymentMethod, baseAmountCents)
 	totalAmountCents := baseAmountCents + feeCents
 
-	if feeCents > 0 {
-		log.Printf("[CreateIntent] Fee calculation: base=%d cents, fee=%d cents (%.2f%% + %d flat), total=%d cents",
-			baseAmountCents, feeCents, w.feeConfig.Percent, w.feeConfig.FlatCents, totalAmountCents)
+	if feeCents > 0 && payment.PaymentMethod == PaymentMethodUSBankAccount {
+		log.Printf("[CreateIntent] ACH fee calculation (%s): base=%d cents, fee=%d cents (%.2f%%, cap %d), total=%d cents",
+			feeScheduleLabel(scheduleID), baseAmountCents, feeCents, feeConfig.ACHPercent, feeConfig.ACHCapCents, totalAmountCents)
+	} else if feeCents > 0 {
+		log.Printf("[CreateIntent] Fee calculation (%s): base=%d cents, fee=%d cents (%.2f%% + %d flat), total=%d cents",
+			feeScheduleLabel(scheduleID), baseAmountCents, feeCents, feeConfig.Percent, feeConfig.FlatCents, totalAmountCents)
 	}
 
-	// 5. Update payment record with fee details BEFORE calling Stripe
-	if err := w.updatePaymentFee(ctx, paymentID, feeCents); err != nil {
+	// 6. Update payment record with fee details BEFORE calling the provider
+	if err := w.updatePaymentFee(ctx, paymentID, payment.PaymentMethod, feeConfig, scheduleID, feeCents); err != nil {
 		log.Printf("[CreateIntent] Error updating fee for payment %s: %v", paymentID, err)
 		return fmt.Errorf("failed to update fee: %w", err)
 	}
 
+	// 7. Route the payment to its category's connected account, if any. The
+	// platform keeps the processing fee to cover the provider fees it pays.
+	route, err := resolvePayoutRoute(ctx, w.dbPool, payment.FeeCategory, payment.EntityType)
+	if err != nil {
+		log.Printf("[CreateIntent] Error resolving payout route for payment %s: %v", paymentID, err)
+		return fmt.Errorf("failed to resolve payout route: %w", err)
+	}
+	destination := ""
+	if route != nil {
+		destination = route.ProviderAccountID
+		log.Printf("[CreateIntent] Payment %s routed to connected account %s (%d)", paymentID, destination, route.ConnectedAccountID)
+		if err := w.updatePaymentDestination(ctx, paymentID, route.ConnectedAccountID); err != nil {
+			log.Printf("[CreateIntent] Error recording payout route for payment %s: %v", paymentID, err)
+			return fmt.Errorf("failed to record payout route: %w", err)
+		}
+	}
+
 	description := ""
 	if payment.Description != nil {
 		description = *payment.Description
 	}
 
-	// 6. Call Stripe to create PaymentIntent with TOTAL amount (base + fee)
-	result, err := w.provider.CreateIntent(ctx, CreateIntentParams{
-		Amount:      totalAmountCents,
-		Currency:    payment.Currency,
-		Description: description,
+	// 8. Call provider to create intent with TOTAL amount (base + fee)
+	result, err := provider.CreateIntent(ctx, CreateIntentParams{
+		PaymentID:           paymentID,
+		Amount:              totalAmountCents,
+		Currency:            payment.Currency,
+		Description:         description,
+		PaymentMethod:       payment.PaymentMethod,
+		CaptureMethod:       payment.CaptureMethod,
+		DestinationAccount:  destination,
+		ApplicationFeeCents: feeCents,
 	})
 	if err != nil {
-		log.Printf("[CreateIntent] Error creating Stripe intent for payment %s: %v", paymentID, err)
+		log.Printf("[CreateIntent] Error creating %s intent for payment %s: %v", provider.Name(), paymentID, err)
 
 		// Update payment with error
 		updateErr := w.updatePaymentError(ctx, paymentID, err.Error())
@@ -178,12 +283,12 @@ func (w *CreateIntentWorker) Work(ctx context.Context, job *river.Job[CreateInte
 		}
 
 		// Return error to trigger River retry
-		return fmt.Errorf("stripe error: %w", err)
+		return fmt.Errorf("%s error: %w", provider.Name(), err)
 	}
 
-	log.Printf("[CreateIntent] ✓ Stripe PaymentIntent created: %s", result.PaymentIntentID)
+	log.Printf("[CreateIntent] ✓ %s intent created: %s", provider.Name(), result.PaymentIntentID)
 
-	// 7. Update payment record with Stripe details
+	// 9. Update payment record with provider details
 	err = w.updatePaymentSuccess(ctx, paymentID, result)
 	if err != nil {
 		log.Printf("[CreateIntent] Error updating payment %s: %v", paymentID, err)
@@ -195,8 +300,8 @@ func (w *CreateIntentWorker) Work(ctx context.Context, job *river.Job[CreateInte
 }
 
 // updatePaymentFee updates the payment record with fee details
-// This is called BEFORE calling Stripe so we have an audit trail
-func (w *CreateIntentWorker) updatePaymentFee(ctx context.Context, paymentID string, feeCents int64) error {
+// This is called BEFORE calling the provider so we have an audit trail
+func (w *CreateIntentWorker) updatePaymentFee(ctx context.Context, paymentID string, paymentMethod string, feeConfig *FeeConfig, scheduleID *int64, feeCents int64) error {
 	// Convert fee cents to dollars for storage
 	feeDollars := float64(feeCents) / 100.0
 
@@ -205,9 +310,14 @@ func (w *CreateIntentWorker) updatePaymentFee(ctx context.Context, paymentID str
 	var feePercent *float64
 	var feeFlatCents *int
 
-	if w.feeConfig.Enabled {
-		feePercent = &w.feeConfig.Percent
-		feeFlatCents = &w.feeConfig.FlatCents
+	if feeConfig.Enabled && paymentMethod == PaymentMethodUSBankAccount {
+		// ACH has no flat fee; the cap isn't stored but is implied by processing_fee
+		noFlat := 0
+		feePercent = &feeConfig.ACHPercent
+		feeFlatCents = &noFlat
+	} else if feeConfig.Enabled {
+		feePercent = &feeConfig.Percent
+		feeFlatCents = &feeConfig.FlatCents
 	}
 
 	query := `
@@ -217,22 +327,36 @@ func (w *CreateIntentWorker) updatePaymentFee(ctx context.Context, paymentID str
 			fee_percent = $2,
 			fee_flat_cents = $3,
 			fee_refundable = $4,
+			fee_schedule_id = $5,
 			updated_at = NOW()
-		WHERE id = $5
+		WHERE id = $6
 	`
 
 	_, err := w.dbPool.Exec(ctx, query,
 		feeDollars,
 		feePercent,
 		feeFlatCents,
-		w.feeConfig.Refundable,
+		feeConfig.Refundable,
+		scheduleID,
 		paymentID,
 	)
 
 	return err
 }
 
-// updatePaymentSuccess updates the payment record with Stripe details
+// updatePaymentDestination records the connected account a payment is a
+// destination charge for
+func (w *CreateIntentWorker) updatePaymentDestination(ctx context.Context, paymentID string, connectedAccountID int64) error {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE payments.transactions
+		SET connected_account_id = $1, updated_at = NOW()
+		WHERE id = $2
+	`, connectedAccountID, paymentID)
+	return err
+}
+
+// updatePaymentSuccess updates the payment record with provider details. A
+// payment expired while the intent was being created stays expired.
 func (w *CreateIntentWorker) updatePaymentSuccess(ctx context.Context, paymentID string, result *PaymentIntentResult) error {
 	query := `
 		UPDATE payments.transactions
@@ -242,7 +366,7 @@ func (w *CreateIntentWorker) updatePaymentSuccess(ctx context.Context, paymentID
 			status = 'pending',
 			error_message = NULL,
 			updated_at = NOW()
-		WHERE id = $3
+		WHERE id = $3 AND status = 'pending_intent'
 	`
 
 	_, err := w.dbPool.Exec(ctx, query,
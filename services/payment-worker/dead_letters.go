@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// deadLetterRecorder copies discarded payment jobs into
+// metadata.job_dead_letters via metadata.capture_job_dead_letter() (migration
+// v0-91-0-job-dead-letters), which also alerts DEAD_LETTER_NOTIFY_ROLES.
+// Events are best-effort; the consolidated worker's dead_letter_sweep
+// captures anything missed here.
+type deadLetterRecorder struct {
+	dbPool      *pgxpool.Pool
+	notifyRoles []string
+
+	// capture records one job; tests replace it
+	capture func(ctx context.Context, jobID int64) error
+}
+
+const deadLetterCaptureTimeout = 10 * time.Second
+
+// deadLetterEventKinds are the River events Observe needs; a discarded job
+// arrives as a failed event with state discarded
+var deadLetterEventKinds = []river.EventKind{river.EventKindJobFailed}
+
+func newDeadLetterRecorder(dbPool *pgxpool.Pool, notifyRoles []string) *deadLetterRecorder {
+	r := &deadLetterRecorder{dbPool: dbPool, notifyRoles: notifyRoles}
+	r.capture = func(ctx context.Context, jobID int64) error {
+		_, err := r.dbPool.Exec(ctx, `SELECT metadata.capture_job_dead_letter($1, $2)`, jobID, r.notifyRoles)
+		return err
+	}
+	return r
+}
+
+// parseNotifyRoles splits DEAD_LETTER_NOTIFY_ROLES ("admin,ops") into role keys
+func parseNotifyRoles(value string) []string {
+	roles := []string{}
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Observe captures discarded jobs until events is closed
+func (r *deadLetterRecorder) Observe(events <-chan *river.Event) {
+	for event := range events {
+		if event.Job == nil || event.Job.State != rivertype.JobStateDiscarded {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), deadLetterCaptureTimeout)
+		if err := r.capture(ctx, event.Job.ID); err != nil {
+			log.Printf("[DeadLetter] Failed to capture discarded job %d (%s); the sweep will retry: %v",
+				event.Job.ID, event.Job.Kind, err)
+		} else {
+			log.Printf("[DeadLetter] Job %d (%s) discarded after %d attempt(s)",
+				event.Job.ID, event.Job.Kind, event.Job.Attempt)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestParseNotifyRoles(t *testing.T) {
+	if got, want := parseNotifyRoles(" admin, ops ,,"), []string{"admin", "ops"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNotifyRoles = %v, want %v", got, want)
+	}
+	if got := parseNotifyRoles(""); len(got) != 0 {
+		t.Errorf("parseNotifyRoles(\"\") = %v, want empty", got)
+	}
+}
+
+func TestDeadLetterRecorder_CapturesOnlyDiscardedJobs(t *testing.T) {
+	r := newDeadLetterRecorder(nil, []string{"admin"})
+	var captured []int64
+	r.capture = func(_ context.Context, jobID int64) error {
+		captured = append(captured, jobID)
+		return nil
+	}
+
+	events := make(chan *river.Event, 3)
+	events <- &river.Event{Kind: river.EventKindJobFailed, Job: &rivertype.JobRow{ID: 1, State: rivertype.JobStateRetryable}}
+	events <- &river.Event{Kind: river.EventKindJobFailed, Job: &rivertype.JobRow{ID: 2, State: rivertype.JobStateDiscarded}}
+	events <- &river.Event{Kind: river.EventKindJobFailed}
+	close(events)
+	r.Observe(events)
+
+	if want := []int64{2}; !reflect.DeepEqual(captured, want) {
+		t.Errorf("captured = %v, want %v", captured, want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// Dry Run
+//
+// DRY_RUN=true (or DRY_RUN_PAYMENTS=true, which overrides it) stops the worker
+// from making provider calls that move money: refunds, captures, voids,
+// expiry cancels, subscription cancels and PayPal approval captures. Each
+// skipped call is logged and recorded in metadata.simulated_operations, and
+// the payment is left as it was, so a staging install pointed at a copy of
+// production data can't refund or charge real customers. Checkout intents and
+// subscriptions are still created: nothing is charged until a payer confirms.
+// ============================================================================
+
+// errDryRun cancels jobs whose provider call was simulated
+var errDryRun = errors.New("provider call simulated (DRY_RUN)")
+
+// DryRun records skipped provider calls. A nil *DryRun skips nothing.
+type DryRun struct {
+	dbPool *pgxpool.Pool
+}
+
+// NewDryRun returns a DryRun when enabled, otherwise nil
+func NewDryRun(dbPool *pgxpool.Pool, enabled bool) *DryRun {
+	if !enabled {
+		return nil
+	}
+	return &DryRun{dbPool: dbPool}
+}
+
+// Skip reports whether the provider call should be skipped, recording it when
+// it is. Recording never fails the caller: the call is skipped either way.
+func (d *DryRun) Skip(ctx context.Context, provider, operation, target string, details map[string]any) bool {
+	if d == nil {
+		return false
+	}
+	log.Printf("[DryRun] SIMULATED %s.%s %s", provider, operation, target)
+
+	if details == nil {
+		details = map[string]any{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		log.Printf("[DryRun] Failed to marshal details of %s: %v", operation, err)
+		detailsJSON = []byte("{}")
+	}
+	_, err = d.dbPool.Exec(ctx, `
+		INSERT INTO metadata.simulated_operations (service, category, operation, target, details)
+		VALUES ('payment-worker', 'payments', $1, NULLIF($2, ''), $3)
+	`, provider+"."+operation, target, detailsJSON)
+	if err != nil {
+		log.Printf("[DryRun] Failed to record %s: %v", operation, err)
+	}
+	return true
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewDryRun(t *testing.T) {
+	if d := NewDryRun(nil, false); d != nil {
+		t.Errorf("NewDryRun(false) = %v, want nil", d)
+	}
+	if d := NewDryRun(nil, true); d == nil {
+		t.Error("NewDryRun(true) = nil, want a DryRun")
+	}
+
+	var d *DryRun
+	if d.Skip(context.Background(), "stripe", "create_refund", "pi_123", nil) {
+		t.Error("nil DryRun skipped a provider call")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FeeSchedule is a payments.fee_schedules row
+type FeeSchedule struct {
+	ID             int64
+	Category       string // empty for the default schedule
+	Config         FeeConfig
+	EffectiveFrom  time.Time
+	EffectiveUntil *time.Time
+}
+
+// activeAt reports whether the schedule is in effect at t
+func (s *FeeSchedule) activeAt(t time.Time) bool {
+	return !s.EffectiveFrom.After(t) && (s.EffectiveUntil == nil || s.EffectiveUntil.After(t))
+}
+
+// selectFeeSchedule picks the schedule for a payment: the payment's fee
+// category, then its entity type, then the default schedule. Among schedules
+// in effect for the same category, the one that took effect last wins.
+// Returns nil when none applies.
+func selectFeeSchedule(schedules []FeeSchedule, feeCategory, entityType string, at time.Time) *FeeSchedule {
+	var categories []string
+	for _, c := range []string{feeCategory, entityType} {
+		if c != "" {
+			categories = append(categories, c)
+		}
+	}
+	for _, category := range append(categories, "") {
+		var best *FeeSchedule
+		for i := range schedules {
+			s := &schedules[i]
+			if s.Category != category || !s.activeAt(at) {
+				continue
+			}
+			if best == nil || s.EffectiveFrom.After(best.EffectiveFrom) {
+				best = s
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return nil
+}
+
+// FeeSchedules loads payments.fee_schedules and caches them, so rate changes
+// reach the worker without a redeploy. Payments no schedule matches use the
+// PROCESSING_FEE_* configuration.
+type FeeSchedules struct {
+	dbPool   *pgxpool.Pool
+	fallback *FeeConfig
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	schedules []FeeSchedule
+	loadedAt  time.Time
+}
+
+// NewFeeSchedules creates a schedule cache refreshed every ttl
+func NewFeeSchedules(dbPool *pgxpool.Pool, fallback *FeeConfig, ttl time.Duration) *FeeSchedules {
+	return &FeeSchedules{
+		dbPool:   dbPool,
+		fallback: fallback,
+		ttl:      ttl,
+	}
+}
+
+// Resolve returns the fee configuration for a payment and the ID of the
+// schedule it came from (nil for the environment fallback)
+func (f *FeeSchedules) Resolve(ctx context.Context, feeCategory, entityType string) (*FeeConfig, *int64, error) {
+	schedules, err := f.current(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	schedule := selectFeeSchedule(schedules, feeCategory, entityType, time.Now())
+	if schedule == nil {
+		return f.fallback, nil, nil
+	}
+	config, id := schedule.Config, schedule.ID
+	return &config, &id, nil
+}
+
+// current returns the cached schedules, reloading them once the cache is
+// older than ttl. A failed reload keeps serving the previous schedules.
+func (f *FeeSchedules) current(ctx context.Context) ([]FeeSchedule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.loadedAt.IsZero() && time.Since(f.loadedAt) < f.ttl {
+		return f.schedules, nil
+	}
+
+	schedules, err := f.load(ctx)
+	if err != nil {
+		if f.loadedAt.IsZero() {
+			return nil, err
+		}
+		log.Printf("[FeeSchedules] Reload failed, using schedules loaded %s ago: %v",
+			time.Since(f.loadedAt).Round(time.Second), err)
+		return f.schedules, nil
+	}
+
+	f.schedules = schedules
+	f.loadedAt = time.Now()
+	return f.schedules, nil
+}
+
+// load reads the schedules that are in effect now or start later
+func (f *FeeSchedules) load(ctx context.Context) ([]FeeSchedule, error) {
+	rows, err := f.dbPool.Query(ctx, `
+		SELECT id, COALESCE(category, ''), enabled,
+		       percent::float8, flat_cents, COALESCE(min_fee_cents, 0), COALESCE(max_fee_cents, 0),
+		       ach_percent::float8, COALESCE(ach_cap_cents, 0), refundable,
+		       effective_from, effective_until
+		FROM payments.fee_schedules
+		WHERE effective_until IS NULL OR effective_until > NOW()
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query fee schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []FeeSchedule
+	for rows.Next() {
+		var s FeeSchedule
+		err := rows.Scan(&s.ID, &s.Category, &s.Config.Enabled,
+			&s.Config.Percent, &s.Config.FlatCents, &s.Config.MinCents, &s.Config.MaxCents,
+			&s.Config.ACHPercent, &s.Config.ACHCapCents, &s.Config.Refundable,
+			&s.EffectiveFrom, &s.EffectiveUntil)
+		if err != nil {
+			return nil, fmt.Errorf("scan fee schedule: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// feeScheduleLabel names the fee source in log lines
+func feeScheduleLabel(scheduleID *int64) string {
+	if scheduleID == nil {
+		return "env config"
+	}
+	return fmt.Sprintf("schedule %d", *scheduleID)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 func TestFeeConfig_CalculateFee(t *testing.T) {
@@ -243,6 +245,154 @@ func TestFeeConfig_HundredDollarScenario(t *testing.T) {
 	}
 }
 
+func TestFeeConfig_CalculateACHFee(t *testing.T) {
+	config := FeeConfig{
+		Enabled:     true,
+		Percent:     2.9,
+		FlatCents:   30,
+		ACHPercent:  0.8,
+		ACHCapCents: 500,
+	}
+
+	tests := []struct {
+		name            string
+		baseAmountCents int64
+		expectedFee     int64
+	}{
+		// Gross-up: 10000 / (1 - 0.008) = 10080.65 -> fee = 80.65 -> ceil = 81
+		{"$100 below cap", 10000, 81},
+		// Gross-up fee would be 2016.13; the processor charges the $5 cap
+		{"$2,500 permit hits cap", 250000, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if fee := config.CalculateACHFee(tt.baseAmountCents); fee != tt.expectedFee {
+				t.Errorf("CalculateACHFee(%d) = %d, want %d", tt.baseAmountCents, fee, tt.expectedFee)
+			}
+		})
+	}
+
+	t.Run("disabled returns zero", func(t *testing.T) {
+		disabled := config
+		disabled.Enabled = false
+		if fee := disabled.CalculateACHFee(10000); fee != 0 {
+			t.Errorf("expected 0 when fees disabled, got %d", fee)
+		}
+	})
+}
+
+func TestFeeConfig_FeeFor(t *testing.T) {
+	config := FeeConfig{
+		Enabled:     true,
+		Percent:     2.9,
+		FlatCents:   30,
+		ACHPercent:  0.8,
+		ACHCapCents: 500,
+	}
+
+	if fee := config.FeeFor(PaymentMethodCard, 10000); fee != 330 {
+		t.Errorf("card fee = %d, want 330", fee)
+	}
+	if fee := config.FeeFor(PaymentMethodUSBankAccount, 10000); fee != 81 {
+		t.Errorf("ACH fee = %d, want 81", fee)
+	}
+}
+
+func TestFeeConfig_FeeForBounds(t *testing.T) {
+	config := FeeConfig{
+		Enabled:     true,
+		Percent:     2.9,
+		FlatCents:   30,
+		ACHPercent:  0.8,
+		ACHCapCents: 500,
+		MinCents:    100,
+		MaxCents:    2500,
+	}
+
+	// $5.00 card payment: grossed-up fee is 46 cents, raised to the minimum
+	if fee := config.FeeFor(PaymentMethodCard, 500); fee != 100 {
+		t.Errorf("small card fee = %d, want 100 (minimum)", fee)
+	}
+	// $1,000 card payment: fee would be 3018 cents, capped at the maximum
+	if fee := config.FeeFor(PaymentMethodCard, 100000); fee != 2500 {
+		t.Errorf("large card fee = %d, want 2500 (maximum)", fee)
+	}
+	// $100 card payment is within bounds
+	if fee := config.FeeFor(PaymentMethodCard, 10000); fee != 330 {
+		t.Errorf("card fee = %d, want 330", fee)
+	}
+	// The minimum applies to ACH too
+	if fee := config.FeeFor(PaymentMethodUSBankAccount, 1000); fee != 100 {
+		t.Errorf("small ACH fee = %d, want 100 (minimum)", fee)
+	}
+
+	config.Enabled = false
+	if fee := config.FeeFor(PaymentMethodCard, 500); fee != 0 {
+		t.Errorf("disabled fee = %d, want 0 (minimum must not apply)", fee)
+	}
+}
+
+func TestSelectFeeSchedule(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-30 * 24 * time.Hour)
+	future := now.Add(30 * 24 * time.Hour)
+
+	schedules := []FeeSchedule{
+		{ID: 1, Category: "", EffectiveFrom: past},
+		{ID: 2, Category: "park_reservations", EffectiveFrom: past},
+		{ID: 3, Category: "park_reservations", EffectiveFrom: past.Add(time.Hour)}, // supersedes 2
+		{ID: 4, Category: "permits", EffectiveFrom: past, EffectiveUntil: &past},   // ended
+		{ID: 5, Category: "permits", EffectiveFrom: future},                        // not yet
+		{ID: 6, Category: "late_fees", EffectiveFrom: past},
+	}
+
+	tests := []struct {
+		name        string
+		feeCategory string
+		entityType  string
+		wantID      int64
+	}{
+		{"entity type match", "", "park_reservations", 3},
+		{"fee category wins over entity type", "late_fees", "park_reservations", 6},
+		{"unknown fee category falls back to entity type", "other", "park_reservations", 3},
+		{"no schedule in effect uses default", "", "permits", 1},
+		{"no category uses default", "", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectFeeSchedule(schedules, tt.feeCategory, tt.entityType, now)
+			if got == nil || got.ID != tt.wantID {
+				t.Errorf("selectFeeSchedule() = %+v, want schedule %d", got, tt.wantID)
+			}
+		})
+	}
+
+	if got := selectFeeSchedule(schedules[1:], "", "permits", now); got != nil {
+		t.Errorf("selectFeeSchedule() without a default = schedule %d, want nil", got.ID)
+	}
+}
+
+func TestFeeSchedules_ResolveFallback(t *testing.T) {
+	fallback := &FeeConfig{Enabled: true, Percent: 2.9, FlatCents: 30}
+	fees := NewFeeSchedules(nil, fallback, time.Hour)
+	// Pre-loaded cache: Resolve must not touch the database
+	fees.schedules = []FeeSchedule{
+		{ID: 7, Category: "permits", Config: FeeConfig{Enabled: false}, EffectiveFrom: time.Now().Add(-time.Hour)},
+	}
+	fees.loadedAt = time.Now()
+
+	config, id, err := fees.Resolve(context.Background(), "", "permits")
+	if err != nil || id == nil || *id != 7 || config.Enabled {
+		t.Errorf("Resolve(permits) = %+v, %v, %v; want schedule 7 with fees disabled", config, id, err)
+	}
+
+	config, id, err = fees.Resolve(context.Background(), "", "reservations")
+	if err != nil || id != nil || config != fallback {
+		t.Errorf("Resolve(reservations) = %+v, %v, %v; want the env fallback", config, id, err)
+	}
+}
+
 // Benchmark fee calculation performance
 func BenchmarkCalculateFee(b *testing.B) {
 	config := FeeConfig{
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Overall /health status
+const (
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"  // A provider API is unreachable; jobs for it fail and retry
+	HealthUnhealthy = "unhealthy" // The database is unreachable; nothing works
+)
+
+// providerCheckTTL is how long a provider API check is reused. Container
+// health checks poll every few seconds; the provider doesn't need to be.
+const providerCheckTTL = 30 * time.Second
+
+// paymentJobKinds are the River job kinds this worker runs, reported with
+// their queue depth
+var paymentJobKinds = []string{
+	CreateIntentWorkerArgs{}.Kind(),
+	RefundWorkerArgs{}.Kind(),
+	CapturePaymentWorkerArgs{}.Kind(),
+	CancelPaymentIntentWorkerArgs{}.Kind(),
+	CreateSubscriptionWorkerArgs{}.Kind(),
+	CancelSubscriptionWorkerArgs{}.Kind(),
+	StripeEventBackfillArgs{}.Kind(),
+	ReprocessWebhookArgs{}.Kind(),
+}
+
+// HealthCheck is the result of checking one dependency
+type HealthCheck struct {
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthReport is the /health response body
+type HealthReport struct {
+	Status    string                    `json:"status"`
+	Database  HealthCheck               `json:"database"`
+	Providers map[string]HealthCheck    `json:"providers"`
+	Queue     map[string]map[string]int `json:"queue"` // kind → state → jobs
+}
+
+// HealthChecker checks the worker's dependencies for /health and /metrics
+type HealthChecker struct {
+	dbPool    *pgxpool.Pool
+	providers *ProviderRegistry
+
+	mu             sync.Mutex
+	providerChecks map[string]HealthCheck
+	checkedAt      map[string]time.Time
+}
+
+// NewHealthChecker creates a health checker
+func NewHealthChecker(dbPool *pgxpool.Pool, providers *ProviderRegistry) *HealthChecker {
+	return &HealthChecker{
+		dbPool:         dbPool,
+		providers:      providers,
+		providerChecks: make(map[string]HealthCheck),
+		checkedAt:      make(map[string]time.Time),
+	}
+}
+
+// Check pings the database and provider APIs and reads the queue depth
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	report := HealthReport{
+		Database:  h.checkDatabase(ctx),
+		Providers: h.checkProviders(ctx),
+		Queue:     map[string]map[string]int{},
+	}
+
+	if report.Database.OK {
+		queue, err := h.queueDepth(ctx)
+		if err != nil {
+			log.Printf("[Health] Queue depth query failed: %v", err)
+		} else {
+			report.Queue = queue
+		}
+	}
+
+	report.Status = healthStatus(report)
+	return report
+}
+
+// healthStatus rolls the checks up. Only the database makes the worker
+// unhealthy: restarting the container doesn't fix a provider outage.
+func healthStatus(report HealthReport) string {
+	if !report.Database.OK {
+		return HealthUnhealthy
+	}
+	for _, check := range report.Providers {
+		if !check.OK {
+			return HealthDegraded
+		}
+	}
+	return HealthHealthy
+}
+
+func (h *HealthChecker) checkDatabase(ctx context.Context) HealthCheck {
+	started := time.Now()
+	err := h.dbPool.Ping(ctx)
+	return newHealthCheck(started, err)
+}
+
+// checkProviders checks providers that support it, reusing results younger
+// than providerCheckTTL
+func (h *HealthChecker) checkProviders(ctx context.Context) map[string]HealthCheck {
+	checks := make(map[string]HealthCheck)
+	for _, name := range h.providers.Names() {
+		provider, _ := h.providers.Get(name)
+		p, ok := provider.(healthPinger)
+		if !ok {
+			continue
+		}
+
+		h.mu.Lock()
+		check, cached := h.providerChecks[name]
+		fresh := cached && time.Since(h.checkedAt[name]) < providerCheckTTL
+		h.mu.Unlock()
+
+		if !fresh {
+			started := time.Now()
+			check = newHealthCheck(started, p.Ping(ctx))
+			h.mu.Lock()
+			h.providerChecks[name] = check
+			h.checkedAt[name] = time.Now()
+			h.mu.Unlock()
+		}
+		checks[name] = check
+	}
+	return checks
+}
+
+// queueDepth counts unfinished jobs of the payment kinds by state
+func (h *HealthChecker) queueDepth(ctx context.Context) (map[string]map[string]int, error) {
+	rows, err := h.dbPool.Query(ctx, `
+		SELECT kind, state::TEXT, COUNT(*)
+		FROM metadata.river_job
+		WHERE kind = ANY($1)
+		AND state IN ('available', 'scheduled', 'retryable', 'running')
+		GROUP BY kind, state
+	`, paymentJobKinds)
+	if err != nil {
+		return nil, fmt.Errorf("query river_job: %w", err)
+	}
+	defer rows.Close()
+
+	depth := make(map[string]map[string]int)
+	for rows.Next() {
+		var kind, state string
+		var count int
+		if err := rows.Scan(&kind, &state, &count); err != nil {
+			return nil, fmt.Errorf("scan river_job: %w", err)
+		}
+		if depth[kind] == nil {
+			depth[kind] = make(map[string]int)
+		}
+		depth[kind][state] = count
+	}
+	return depth, rows.Err()
+}
+
+// WriteMetrics writes the scrape-time series: dependency status, queue depth
+// and connection pool stats
+func (h *HealthChecker) WriteMetrics(ctx context.Context, b *strings.Builder) {
+	report := h.Check(ctx)
+	writePoolStats(b, h.dbPool.Stat())
+
+	up := map[string]float64{"database": boolGauge(report.Database.OK)}
+	for name, check := range report.Providers {
+		up[name] = boolGauge(check.OK)
+	}
+	writeGauge(b, "payment_worker_dependency_up",
+		"Whether the last check of a dependency succeeded (database, provider APIs).", []string{"dependency"}, up)
+
+	depth := make(map[string]float64)
+	for kind, states := range report.Queue {
+		for state, count := range states {
+			depth[kind+"\x00"+state] = float64(count)
+		}
+	}
+	writeGauge(b, "payment_worker_queue_jobs",
+		"Unfinished River jobs of the payment worker's kinds.", []string{"kind", "state"}, depth)
+}
+
+func newHealthCheck(started time.Time, err error) HealthCheck {
+	check := HealthCheck{OK: err == nil, LatencyMS: time.Since(started).Milliseconds()}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
+
+func boolGauge(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for in, want := range map[string]RateLimit{
+		"10/s": {Count: 10, Per: time.Second},
+		"25":   {Count: 25, Per: time.Second},
+		"90/m": {Count: 90, Per: time.Minute},
+	} {
+		got, err := parseRateLimit(in)
+		if err != nil || got != want {
+			t.Errorf("parseRateLimit(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0/s", "x/s", "1/week"} {
+		if _, err := parseRateLimit(in); err == nil {
+			t.Errorf("parseRateLimit(%q) should fail", in)
+		}
+	}
+}
+
+func TestJobRateLimiter_SnoozesPastMaxWait(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewJobRateLimiter(map[string]RateLimit{"process_refund": {Count: 1, Per: time.Minute}})
+	l.now = func() time.Time { return now }
+
+	ran := 0
+	work := func(context.Context) error { ran++; return nil }
+	job := &rivertype.JobRow{ID: 1, Kind: "process_refund", Queue: river.QueueDefault}
+
+	if err := l.Work(context.Background(), job, work); err != nil || ran != 1 {
+		t.Fatalf("first refund: err = %v, ran = %d", err, ran)
+	}
+	var snooze *river.JobSnoozeError
+	if err := l.Work(context.Background(), job, work); !errors.As(err, &snooze) || snooze.Duration != time.Minute {
+		t.Fatalf("second refund: err = %v, want a 1m snooze", err)
+	}
+	if ran != 1 {
+		t.Errorf("snoozed job ran")
+	}
+
+	// Other kinds aren't limited
+	other := &rivertype.JobRow{ID: 2, Kind: "capture_payment", Queue: river.QueueDefault}
+	if err := l.Work(context.Background(), other, work); err != nil || ran != 2 {
+		t.Errorf("capture: err = %v, ran = %d", err, ran)
+	}
+}
+
+func TestJobRateLimiter_SnoozeGivesBackOtherTokens(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewJobRateLimiter(map[string]RateLimit{
+		"process_refund":              {Count: 2, Per: time.Minute},
+		"queue:" + river.QueueDefault: {Count: 1, Per: time.Minute},
+	})
+	l.now = func() time.Time { return now }
+
+	work := func(context.Context) error { return nil }
+	ctx := context.Background()
+	if err := l.Work(ctx, &rivertype.JobRow{ID: 1, Kind: "capture_payment", Queue: river.QueueDefault}, work); err != nil {
+		t.Fatalf("first job: %v", err)
+	}
+
+	// The queue is exhausted and the kind is not: each snooze must hand the
+	// kind's token back instead of draining it
+	job := &rivertype.JobRow{ID: 2, Kind: "process_refund", Queue: river.QueueDefault}
+	var snooze *river.JobSnoozeError
+	for i := 0; i < 3; i++ {
+		if err := l.Work(ctx, job, work); !errors.As(err, &snooze) || snooze.Duration != time.Minute {
+			t.Fatalf("snooze %d: err = %v, want a 1m snooze for the queue", i, err)
+		}
+	}
+	if wait, ok := l.reserve("process_refund", 0); wait != 0 || !ok {
+		t.Errorf("kind bucket drained by snoozed jobs: wait = %s", wait)
+	}
+}
+
+func TestJobRateLimiter_WaitsWithinMaxWait(t *testing.T) {
+	l := NewJobRateLimiter(map[string]RateLimit{"create_payment_intent": {Count: 20, Per: time.Second}})
+	job := &rivertype.JobRow{ID: 1, Kind: "create_payment_intent", Queue: river.QueueDefault}
+
+	start := time.Now()
+	for i := 0; i < 22; i++ {
+		if err := l.Work(context.Background(), job, func(context.Context) error { return nil }); err != nil {
+			t.Fatalf("job %d: %v", i, err)
+		}
+	}
+	// 20 in the burst, then two more 50ms apart
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("22 jobs at 20/s took %v, want about 100ms", elapsed)
+	}
+	if stats := l.Stats(); stats.Waited != 2 || stats.Snoozed != 0 {
+		t.Errorf("stats = %s, want waited=2 snoozed=0", stats)
+	}
+}
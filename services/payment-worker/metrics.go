@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// workerMetrics collects the counters and histograms served on /metrics.
+// The worker exports a handful of series, so the Prometheus text format is
+// written directly rather than through the client library.
+//
+// The civic_os_jobs_* and civic_os_db_pool_* families match the consolidated
+// worker's, so one dashboard covers both; payment_worker_* are its own.
+var workerMetrics = NewMetrics()
+
+// Metrics holds the payment worker's Prometheus series
+type Metrics struct {
+	JobsTotal                *counterVec   // River jobs finished, by queue, kind and result
+	JobDuration              *histogramVec // River job run time, by queue and kind
+	WebhooksTotal            *counterVec   // Webhook requests, by provider and result
+	WebhookDuration          *histogramVec // Webhook request latency, by provider
+	WebhookSignatureFailures *counterVec   // Webhooks rejected for a bad signature, by provider
+	RefundErrors             *counterVec   // Refunds marked failed, by reason
+}
+
+// NewMetrics creates an empty set of payment worker series
+func NewMetrics() *Metrics {
+	return &Metrics{
+		JobsTotal: newCounterVec("civic_os_jobs_total",
+			"River jobs finished.", "queue", "kind", "result"),
+		JobDuration: newHistogramVec("civic_os_job_duration_seconds",
+			"Time River jobs spent running.", []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}, "queue", "kind"),
+		WebhooksTotal: newCounterVec("payment_worker_webhooks_total",
+			"Webhook requests received.", "provider", "result"),
+		WebhookDuration: newHistogramVec("payment_worker_webhook_duration_seconds",
+			"Time from receiving a webhook to responding.", []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 9}, "provider"),
+		WebhookSignatureFailures: newCounterVec("payment_worker_webhook_signature_failures_total",
+			"Webhooks rejected because signature verification failed.", "provider"),
+		RefundErrors: newCounterVec("payment_worker_refund_errors_total",
+			"Refunds marked failed: rejected by the provider, over the refundable balance, or failed after acceptance (async).", "reason"),
+	}
+}
+
+// Refund error reasons for RefundErrors
+const (
+	refundErrorProvider = "provider" // Provider rejected the refund request
+	refundErrorBalance  = "balance"  // Would exceed the refundable balance
+	refundErrorAsync    = "async"    // Provider failed a refund it had accepted
+)
+
+// WriteTo writes every series in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	m.JobsTotal.write(&b)
+	m.JobDuration.write(&b)
+	m.WebhooksTotal.write(&b)
+	m.WebhookDuration.write(&b)
+	m.WebhookSignatureFailures.write(&b)
+	m.RefundErrors.write(&b)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ObserveJobs records River job events until events is closed. Run it in a
+// goroutine with the channel from riverClient.Subscribe.
+func (m *Metrics) ObserveJobs(events <-chan *river.Event) {
+	for event := range events {
+		if event.Job == nil {
+			continue
+		}
+		result := strings.TrimPrefix(string(event.Kind), "job_")
+		m.JobsTotal.Inc(event.Job.Queue, event.Job.Kind, result)
+		if event.JobStats != nil {
+			m.JobDuration.Observe(event.JobStats.RunDuration.Seconds(), event.Job.Queue, event.Job.Kind)
+		}
+	}
+}
+
+// jobEventKinds are the River events ObserveJobs counts
+var jobEventKinds = []river.EventKind{
+	river.EventKindJobCompleted,
+	river.EventKindJobFailed,
+	river.EventKindJobCancelled,
+	river.EventKindJobSnoozed,
+}
+
+// counterVec is a counter with labels
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by rendered label set
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// Inc adds one to the series for labelValues (in the order of the labels)
+func (c *counterVec) Inc(labelValues ...string) {
+	key := renderLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+// Value returns the current count for labelValues
+func (c *counterVec) Value(labelValues ...string) float64 {
+	key := renderLabels(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *counterVec) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(b, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram with labels and fixed buckets
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64 // Upper bounds, ascending; +Inf is implied
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // Per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// Observe records a value for labelValues
+func (h *histogramVec) Observe(value float64, labelValues ...string) {
+	key := renderLabels(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: append([]string{}, labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *histogramVec) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		names := append(append([]string{}, h.labels...), "le")
+		values := append(append([]string{}, s.labelValues...), "")
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			values[len(values)-1] = formatValue(upper)
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, renderLabels(names, values), cumulative)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, renderLabels(names, values), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.name, key, formatValue(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.name, key, s.count)
+	}
+}
+
+// writeGauge writes one gauge family. values is keyed by label values joined
+// with "\x00", in the order of labels.
+func writeGauge(b *strings.Builder, name, help string, labels []string, values map[string]float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(b, "%s%s %s\n", name, renderLabels(labels, strings.Split(key, "\x00")), formatValue(values[key]))
+	}
+}
+
+// writeCounter writes an unlabelled counter whose value is kept elsewhere
+// (e.g. by pgxpool)
+func writeCounter(b *strings.Builder, name, help string, value float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", name, help, name, name, formatValue(value))
+}
+
+// writePoolStats writes the pgx connection pool's gauges and counters
+func writePoolStats(b *strings.Builder, stat *pgxpool.Stat) {
+	writeGauge(b, "civic_os_db_pool_connections",
+		"Database pool connections, by state (max is the configured limit).", []string{"state"}, map[string]float64{
+			"acquired":     float64(stat.AcquiredConns()),
+			"idle":         float64(stat.IdleConns()),
+			"constructing": float64(stat.ConstructingConns()),
+			"total":        float64(stat.TotalConns()),
+			"max":          float64(stat.MaxConns()),
+		})
+	writeCounter(b, "civic_os_db_pool_acquires_total",
+		"Connections acquired from the pool.", float64(stat.AcquireCount()))
+	writeCounter(b, "civic_os_db_pool_empty_acquires_total",
+		"Acquires that waited because the pool had no idle connection.", float64(stat.EmptyAcquireCount()))
+	writeCounter(b, "civic_os_db_pool_canceled_acquires_total",
+		"Acquires canceled by their context before getting a connection.", float64(stat.CanceledAcquireCount()))
+	writeCounter(b, "civic_os_db_pool_acquire_wait_seconds_total",
+		"Total time spent acquiring connections.", stat.AcquireDuration().Seconds())
+}
+
+// renderLabels renders {a="x",b="y"}, or "" when there are no labels
+func renderLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + labelEscaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
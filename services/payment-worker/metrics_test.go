@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestMetrics_WriteTo(t *testing.T) {
+	m := NewMetrics()
+	m.WebhooksTotal.Inc("stripe", "processed")
+	m.WebhooksTotal.Inc("stripe", "processed")
+	m.WebhookSignatureFailures.Inc(`pay"pal`)
+	m.WebhookDuration.Observe(0.03, "stripe")
+	m.WebhookDuration.Observe(12, "stripe")
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE payment_worker_webhooks_total counter\n",
+		`payment_worker_webhooks_total{provider="stripe",result="processed"} 2` + "\n",
+		`payment_worker_webhook_signature_failures_total{provider="pay\"pal"} 1` + "\n",
+		"# TYPE payment_worker_webhook_duration_seconds histogram\n",
+		`payment_worker_webhook_duration_seconds_bucket{provider="stripe",le="0.025"} 0` + "\n",
+		`payment_worker_webhook_duration_seconds_bucket{provider="stripe",le="0.05"} 1` + "\n",
+		`payment_worker_webhook_duration_seconds_bucket{provider="stripe",le="9"} 1` + "\n",
+		`payment_worker_webhook_duration_seconds_bucket{provider="stripe",le="+Inf"} 2` + "\n",
+		`payment_worker_webhook_duration_seconds_sum{provider="stripe"} 12.03` + "\n",
+		`payment_worker_webhook_duration_seconds_count{provider="stripe"} 2` + "\n",
+		"# TYPE payment_worker_refund_errors_total counter\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestMetrics_ObserveJobs(t *testing.T) {
+	m := NewMetrics()
+	events := make(chan *river.Event, 3)
+	events <- &river.Event{Kind: river.EventKindJobCompleted, Job: &rivertype.JobRow{Queue: "payments", Kind: "process_refund"},
+		JobStats: &river.JobStatistics{RunDuration: 200 * time.Millisecond}}
+	events <- &river.Event{Kind: river.EventKindJobFailed, Job: &rivertype.JobRow{Queue: "payments", Kind: "process_refund"},
+		JobStats: &river.JobStatistics{RunDuration: time.Second}}
+	events <- &river.Event{Kind: river.EventKindQueuePaused}
+	close(events)
+
+	m.ObserveJobs(events)
+
+	if got := m.JobsTotal.Value("payments", "process_refund", "completed"); got != 1 {
+		t.Errorf("completed = %v, want 1", got)
+	}
+	if got := m.JobsTotal.Value("payments", "process_refund", "failed"); got != 1 {
+		t.Errorf("failed = %v, want 1", got)
+	}
+}
+
+func TestHealthStatus(t *testing.T) {
+	up := HealthCheck{OK: true}
+	down := HealthCheck{OK: false, Error: "connection refused"}
+
+	tests := []struct {
+		name   string
+		report HealthReport
+		want   string
+	}{
+		{"all up", HealthReport{Database: up, Providers: map[string]HealthCheck{"stripe": up}}, HealthHealthy},
+		{"no pingable providers", HealthReport{Database: up}, HealthHealthy},
+		{"provider down", HealthReport{Database: up, Providers: map[string]HealthCheck{"stripe": down}}, HealthDegraded},
+		{"database down", HealthReport{Database: down, Providers: map[string]HealthCheck{"stripe": up}}, HealthUnhealthy},
+	}
+	for _, tt := range tests {
+		if got := healthStatus(tt.report); got != tt.want {
+			t.Errorf("%s: healthStatus() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookHTTPServer_SignatureFailureMetrics(t *testing.T) {
+	provider := &StripeProvider{webhookSecret: "whsec_test"}
+	server := NewWebhookHTTPServer(NewWebhookHandler(nil), NewProviderRegistry(provider), &reprocessInserter{}, nil, nil, "", "", "0")
+	before := workerMetrics.WebhookSignatureFailures.Value("stripe")
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", strings.NewReader(`{"id":"evt_1"}`))
+	req.Header.Set("Stripe-Signature", "t=1,v1=bad")
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if got := workerMetrics.WebhookSignatureFailures.Value("stripe"); got != before+1 {
+		t.Errorf("signature failures = %v, want %v", got, before+1)
+	}
+}
+
+func TestWebhookHTTPServer_MetricsToken(t *testing.T) {
+	server := NewWebhookHTTPServer(NewWebhookHandler(nil), NewProviderRegistry(), &reprocessInserter{}, nil, nil, "", "scrape-token", "0")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status without token = %d, want 401", rec.Code)
+	}
+}
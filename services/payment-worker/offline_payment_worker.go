@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Offline Payments
+//
+// public.record_offline_payment() inserts a cash, check or money order
+// payment taken at a counter as a pending transaction with provider
+// 'offline', then enqueues record_offline_payment. This worker validates it,
+// links it to the entity's payment column when asked, and moves it to
+// succeeded. From there it follows the same path as an online payment: the
+// receipt number trigger, the generate_receipt job and the payment_succeeded
+// email.
+//
+// A payment that fails validation is marked failed with the reason; staff
+// record it again with corrected details.
+// ============================================================================
+
+// Offline payment methods stored in payments.transactions.payment_method
+const (
+	PaymentMethodCash       = "cash"
+	PaymentMethodCheck      = "check"
+	PaymentMethodMoneyOrder = "money_order"
+)
+
+// offlinePaymentMaxAge is how far back a counter payment can be dated
+const offlinePaymentMaxAge = 90 * 24 * time.Hour
+
+// RecordOfflinePaymentArgs matches the JSON args inserted by
+// record_offline_payment()
+type RecordOfflinePaymentArgs struct {
+	PaymentID     string `json:"payment_id"`
+	PaymentColumn string `json:"payment_column,omitempty"` // Entity column to link the payment to
+}
+
+// Kind returns the job kind identifier for River
+func (RecordOfflinePaymentArgs) Kind() string {
+	return "record_offline_payment"
+}
+
+// RecordOfflinePaymentWorker settles offline payments
+type RecordOfflinePaymentWorker struct {
+	river.WorkerDefaults[RecordOfflinePaymentArgs]
+	dbPool *pgxpool.Pool
+}
+
+// NewRecordOfflinePaymentWorker creates a new RecordOfflinePaymentWorker
+func NewRecordOfflinePaymentWorker(dbPool *pgxpool.Pool) *RecordOfflinePaymentWorker {
+	return &RecordOfflinePaymentWorker{dbPool: dbPool}
+}
+
+// offlinePayment is the part of a transaction the worker checks
+type offlinePayment struct {
+	Status        string
+	Provider      string
+	PaymentMethod string
+	Reference     *string
+	ReceivedAt    *time.Time
+	EntityType    *string
+	EntityID      *string
+}
+
+// errOfflinePaymentRejected wraps validation failures, which end the payment
+// rather than being retried
+var errOfflinePaymentRejected = errors.New("offline payment rejected")
+
+// Work validates, links and settles one offline payment
+func (w *RecordOfflinePaymentWorker) Work(ctx context.Context, job *river.Job[RecordOfflinePaymentArgs]) error {
+	paymentID := job.Args.PaymentID
+	log.Printf("[Offline] Processing job for payment %s", paymentID)
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var p offlinePayment
+	err = tx.QueryRow(ctx, `
+		SELECT status, provider, payment_method, offline_reference, received_at, entity_type, entity_id
+		FROM payments.transactions
+		WHERE id = $1
+		FOR UPDATE
+	`, paymentID).Scan(&p.Status, &p.Provider, &p.PaymentMethod, &p.Reference, &p.ReceivedAt, &p.EntityType, &p.EntityID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			log.Printf("[Offline] Payment %s not found", paymentID)
+			return fmt.Errorf("payment not found: %s", paymentID)
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	// Idempotent: an earlier attempt already settled it
+	if p.Status != "pending" || p.Provider != "offline" {
+		log.Printf("[Offline] Payment %s skipped: %s payment is %s", paymentID, p.Provider, p.Status)
+		return nil
+	}
+
+	err = validateOfflinePayment(p, time.Now())
+	if err == nil && job.Args.PaymentColumn != "" {
+		err = linkOfflinePayment(ctx, tx, paymentID, p, job.Args.PaymentColumn)
+	}
+	if err != nil {
+		if !errors.Is(err, errOfflinePaymentRejected) {
+			return err
+		}
+		log.Printf("[Offline] Payment %s rejected: %v", paymentID, err)
+		tx.Rollback(ctx) // releases the row lock reject() needs
+		return w.reject(ctx, paymentID, err)
+	}
+
+	// The receipt number trigger and the payment_succeeded trigger fire here
+	_, err = tx.Exec(ctx, `
+		UPDATE payments.transactions
+		SET status = 'succeeded', error_message = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+	`, paymentID)
+	if err != nil {
+		return fmt.Errorf("database update error: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	log.Printf("[Offline] ✓ Payment %s recorded (%s)", paymentID, p.PaymentMethod)
+	return nil
+}
+
+// reject marks the payment failed with the validation error. Runs after the
+// job's transaction is rolled back, dropping any half-done link.
+func (w *RecordOfflinePaymentWorker) reject(ctx context.Context, paymentID string, reason error) error {
+	_, err := w.dbPool.Exec(ctx, `
+		UPDATE payments.transactions
+		SET status = 'failed', error_message = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+	`, paymentID, reason.Error())
+	if err != nil {
+		return fmt.Errorf("database update error: %w", err)
+	}
+	return nil
+}
+
+// validateOfflinePayment checks what staff entered: checks and money orders
+// need their number, and the payment date can't be in the future or older
+// than offlinePaymentMaxAge
+func validateOfflinePayment(p offlinePayment, now time.Time) error {
+	switch p.PaymentMethod {
+	case PaymentMethodCash:
+	case PaymentMethodCheck, PaymentMethodMoneyOrder:
+		if p.Reference == nil || *p.Reference == "" {
+			return fmt.Errorf("%w: a %s needs its number as the reference", errOfflinePaymentRejected, offlineMethodName(p.PaymentMethod))
+		}
+	default:
+		return fmt.Errorf("%w: unknown payment method %q", errOfflinePaymentRejected, p.PaymentMethod)
+	}
+
+	if p.ReceivedAt != nil {
+		// A few minutes of slack for clocks that disagree with the database
+		if p.ReceivedAt.After(now.Add(5 * time.Minute)) {
+			return fmt.Errorf("%w: received date %s is in the future", errOfflinePaymentRejected, p.ReceivedAt.Format(time.DateOnly))
+		}
+		if p.ReceivedAt.Before(now.Add(-offlinePaymentMaxAge)) {
+			return fmt.Errorf("%w: received date %s is more than %d days ago", errOfflinePaymentRejected,
+				p.ReceivedAt.Format(time.DateOnly), int(offlinePaymentMaxAge/(24*time.Hour)))
+		}
+	}
+	return nil
+}
+
+// linkOfflinePayment stores the payment in the entity's payment column, the
+// way create_and_link_payment() does for online payments. A record that is
+// already paid, or has an online checkout in progress, is rejected so the
+// payer isn't charged twice.
+func linkOfflinePayment(ctx context.Context, tx pgx.Tx, paymentID string, p offlinePayment, column string) error {
+	if p.EntityType == nil || p.EntityID == nil {
+		return fmt.Errorf("%w: payment column %s given without an entity", errOfflinePaymentRejected, column)
+	}
+	table := pgx.Identifier{*p.EntityType}.Sanitize()
+	col := pgx.Identifier{column}.Sanitize()
+
+	var existing *string
+	err := tx.QueryRow(ctx, fmt.Sprintf(`SELECT %s::TEXT FROM %s WHERE id::TEXT = $1 FOR UPDATE`, col, table),
+		*p.EntityID).Scan(&existing)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("%w: %s %s not found", errOfflinePaymentRejected, *p.EntityType, *p.EntityID)
+		}
+		// undefined_table, undefined_column
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && (pgErr.Code == "42P01" || pgErr.Code == "42703") {
+			return fmt.Errorf("%w: %s.%s does not exist", errOfflinePaymentRejected, *p.EntityType, column)
+		}
+		return fmt.Errorf("load entity: %w", err)
+	}
+
+	if existing != nil && *existing != paymentID {
+		var state string
+		if err := tx.QueryRow(ctx, `SELECT payments.check_existing_payment($1::UUID)`, *existing).Scan(&state); err != nil {
+			return fmt.Errorf("check existing payment: %w", err)
+		}
+		switch state {
+		case "duplicate":
+			return fmt.Errorf("%w: %s %s is already paid", errOfflinePaymentRejected, *p.EntityType, *p.EntityID)
+		case "reuse":
+			return fmt.Errorf("%w: %s %s has an online payment in progress", errOfflinePaymentRejected, *p.EntityType, *p.EntityID)
+		}
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET %s = $1 WHERE id::TEXT = $2`, table, col), paymentID, *p.EntityID)
+	if err != nil {
+		return fmt.Errorf("link payment: %w", err)
+	}
+	return nil
+}
+
+// offlineMethodName names a payment method in messages for staff
+func offlineMethodName(method string) string {
+	if method == PaymentMethodMoneyOrder {
+		return "money order"
+	}
+	return method
+}
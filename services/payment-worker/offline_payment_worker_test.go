@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateOfflinePayment(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	ref := func(s string) *string { return &s }
+	at := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name    string
+		payment offlinePayment
+		wantErr string // empty = valid
+	}{
+		{"cash without reference", offlinePayment{PaymentMethod: PaymentMethodCash}, ""},
+		{"check with number", offlinePayment{PaymentMethod: PaymentMethodCheck, Reference: ref("1042")}, ""},
+		{"check without number", offlinePayment{PaymentMethod: PaymentMethodCheck}, "a check needs its number"},
+		{"money order with empty number", offlinePayment{PaymentMethod: PaymentMethodMoneyOrder, Reference: ref("")}, "a money order needs its number"},
+		{"card is not offline", offlinePayment{PaymentMethod: PaymentMethodCard}, "unknown payment method"},
+		{"received yesterday", offlinePayment{PaymentMethod: PaymentMethodCash, ReceivedAt: at(now.Add(-24 * time.Hour))}, ""},
+		{"clock skew tolerated", offlinePayment{PaymentMethod: PaymentMethodCash, ReceivedAt: at(now.Add(time.Minute))}, ""},
+		{"received tomorrow", offlinePayment{PaymentMethod: PaymentMethodCash, ReceivedAt: at(now.Add(24 * time.Hour))}, "in the future"},
+		{"received last year", offlinePayment{PaymentMethod: PaymentMethodCash, ReceivedAt: at(now.AddDate(-1, 0, 0))}, "more than 90 days ago"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOfflinePayment(tt.payment, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateOfflinePayment() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateOfflinePayment() = %v, want error containing %q", err, tt.wantErr)
+			}
+			if !errors.Is(err, errOfflinePaymentRejected) {
+				t.Error("validation errors should wrap errOfflinePaymentRejected so the job doesn't retry them")
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Daily Financial Summary
+//
+// The payment_daily_summary job totals one calendar day in
+// PAYMENT_SUMMARY_TIMEZONE per payment category (fee_category, then
+// entity_type, the same category fee schedules and payout routes use):
+//   - payments that succeeded that day (succeeded_at), with processing fees
+//   - refunds that went through that day (processed_at)
+//   - disputes opened that day (see handleDisputeUpdated)
+//
+// It stores the rollup in payments.daily_summaries and sends the
+// payment_daily_summary email to PAYMENT_SUMMARY_NOTIFY_ROLES. The scheduler
+// enqueues it hourly; a run for a day already in payments.daily_summary_runs
+// does nothing, so the summary goes out once, in the first hour after
+// midnight, however many replicas are running.
+// ============================================================================
+
+// PaymentDailySummaryArgs are the args of the payment_daily_summary job.
+// Enqueue it by hand with a date to summarize (and email) that day again:
+//
+//	INSERT INTO metadata.river_job (kind, args, queue, max_attempts, state)
+//	VALUES ('payment_daily_summary', '{"date": "2026-10-15"}', 'default', 3, 'available');
+type PaymentDailySummaryArgs struct {
+	Date string `json:"date,omitempty"` // YYYY-MM-DD; empty = yesterday, once
+}
+
+// Kind returns the job kind identifier for River
+func (PaymentDailySummaryArgs) Kind() string {
+	return "payment_daily_summary"
+}
+
+// PaymentDailySummaryWorker writes and emails the daily summary
+type PaymentDailySummaryWorker struct {
+	river.WorkerDefaults[PaymentDailySummaryArgs]
+	dbPool      *pgxpool.Pool
+	location    *time.Location
+	notifyRoles []string
+	currency    string
+}
+
+// NewPaymentDailySummaryWorker creates a new PaymentDailySummaryWorker
+func NewPaymentDailySummaryWorker(dbPool *pgxpool.Pool, location *time.Location, notifyRoles []string, currency string) *PaymentDailySummaryWorker {
+	return &PaymentDailySummaryWorker{
+		dbPool:      dbPool,
+		location:    location,
+		notifyRoles: notifyRoles,
+		currency:    currency,
+	}
+}
+
+// dailySummaryRow is one category's totals, amounts in cents
+type dailySummaryRow struct {
+	Category      string
+	PaymentCount  int
+	GrossCents    int64
+	FeeCents      int64
+	RefundCount   int
+	RefundedCents int64
+	DisputeCount  int
+	DisputedCents int64
+	NetCents      int64
+}
+
+// Work summarizes the day and emails the summary in one transaction, so a
+// failed email leaves the day to be summarized again on retry
+func (w *PaymentDailySummaryWorker) Work(ctx context.Context, job *river.Job[PaymentDailySummaryArgs]) error {
+	day, err := summaryDay(job.Args.Date, time.Now(), w.location)
+	if err != nil {
+		log.Printf("[DailySummary] Job %d: %v", job.ID, err)
+		return river.JobCancel(err)
+	}
+	start := day
+	end := day.AddDate(0, 0, 1)
+	date := day.Format(time.DateOnly)
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Claim the day; a scheduled run leaves a day already summarized alone
+	result, err := tx.Exec(ctx, `
+		INSERT INTO payments.daily_summary_runs (summary_date, timezone)
+		VALUES ($1, $2)
+		ON CONFLICT (summary_date) DO UPDATE
+			SET timezone = EXCLUDED.timezone, generated_at = NOW()
+			WHERE $3
+	`, date, w.location.String(), job.Args.Date != "")
+	if err != nil {
+		return fmt.Errorf("claim summary date: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil
+	}
+
+	rows, err := w.summarize(ctx, tx, date, start, end)
+	if err != nil {
+		return err
+	}
+
+	recipients := 0
+	if len(w.notifyRoles) > 0 {
+		err = tx.QueryRow(ctx, `
+			SELECT metadata.send_notification_to_role($1, 'payment_daily_summary', 'daily_summaries', $2, $3)
+		`, w.notifyRoles, date, summaryEntityData(date, w.currency, rows)).Scan(&recipients)
+		if err != nil {
+			return fmt.Errorf("send summary: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE payments.daily_summary_runs SET recipient_count = $2 WHERE summary_date = $1
+		`, date, recipients); err != nil {
+			return fmt.Errorf("record recipients: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	log.Printf("[DailySummary] ✓ Summarized %s (%s): %d categories, sent to %d user(s)",
+		date, w.location, len(rows), recipients)
+	return nil
+}
+
+// summarize replaces the day's rows in payments.daily_summaries and returns
+// them by category
+func (w *PaymentDailySummaryWorker) summarize(ctx context.Context, tx pgx.Tx, date string, start, end time.Time) ([]dailySummaryRow, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM payments.daily_summaries WHERE summary_date = $1`, date); err != nil {
+		return nil, fmt.Errorf("clear summary: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		WITH activity AS (
+			SELECT COALESCE(t.fee_category, t.entity_type, 'uncategorized') AS category,
+				COUNT(*) AS payments, SUM(t.amount) AS gross, SUM(t.processing_fee) AS fees,
+				0 AS refunds, 0::NUMERIC AS refunded, 0 AS disputes, 0::NUMERIC AS disputed
+			FROM payments.transactions t
+			WHERE t.status = 'succeeded' AND t.succeeded_at >= $2 AND t.succeeded_at < $3
+			GROUP BY 1
+			UNION ALL
+			SELECT COALESCE(t.fee_category, t.entity_type, 'uncategorized'),
+				0, 0, 0, COUNT(*), SUM(r.amount), 0, 0
+			FROM payments.refunds r
+			JOIN payments.transactions t ON t.id = r.transaction_id
+			WHERE r.status = 'succeeded' AND r.processed_at >= $2 AND r.processed_at < $3
+			GROUP BY 1
+			UNION ALL
+			SELECT COALESCE(t.fee_category, t.entity_type, 'uncategorized'),
+				0, 0, 0, 0, 0, COUNT(*), SUM(d.amount_cents) / 100.0
+			FROM payments.disputes d
+			LEFT JOIN payments.transactions t ON t.id = d.transaction_id
+			WHERE d.opened_at >= $2 AND d.opened_at < $3
+			GROUP BY 1
+		)
+		INSERT INTO payments.daily_summaries (
+			summary_date, category, payment_count, gross_amount, processing_fees,
+			refund_count, refunded_amount, dispute_count, disputed_amount, net_amount
+		)
+		SELECT $1::DATE, category, SUM(payments), SUM(gross), SUM(fees),
+			SUM(refunds), SUM(refunded), SUM(disputes), SUM(disputed),
+			SUM(gross) + SUM(fees) - SUM(refunded)
+		FROM activity
+		GROUP BY category
+		RETURNING category, payment_count, (gross_amount * 100)::BIGINT, (processing_fees * 100)::BIGINT,
+			refund_count, (refunded_amount * 100)::BIGINT, dispute_count, (disputed_amount * 100)::BIGINT,
+			(net_amount * 100)::BIGINT
+	`, date, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("summarize %s: %w", date, err)
+	}
+
+	summary, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (dailySummaryRow, error) {
+		var r dailySummaryRow
+		err := row.Scan(&r.Category, &r.PaymentCount, &r.GrossCents, &r.FeeCents,
+			&r.RefundCount, &r.RefundedCents, &r.DisputeCount, &r.DisputedCents, &r.NetCents)
+		return r, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("summarize %s: %w", date, err)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Category < summary[j].Category })
+	return summary, nil
+}
+
+// summaryDay returns midnight of the day to summarize in loc: the given
+// YYYY-MM-DD, or the day before now
+func summaryDay(date string, now time.Time, loc *time.Location) (time.Time, error) {
+	if date != "" {
+		day, err := time.ParseInLocation(time.DateOnly, date, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD)", date)
+		}
+		return day, nil
+	}
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d-1, 0, 0, 0, 0, loc), nil
+}
+
+// summaryEntityData is the payment_daily_summary template's Entity: the
+// day's totals and one entry per category, amounts formatted in major units
+func summaryEntityData(date, currency string, rows []dailySummaryRow) map[string]interface{} {
+	var total dailySummaryRow
+	categories := make([]map[string]interface{}, 0, len(rows))
+	for _, r := range rows {
+		total.PaymentCount += r.PaymentCount
+		total.GrossCents += r.GrossCents
+		total.FeeCents += r.FeeCents
+		total.RefundCount += r.RefundCount
+		total.RefundedCents += r.RefundedCents
+		total.DisputeCount += r.DisputeCount
+		total.DisputedCents += r.DisputedCents
+		total.NetCents += r.NetCents
+
+		entry := summaryFields(r)
+		entry["category"] = r.Category
+		categories = append(categories, entry)
+	}
+
+	data := summaryFields(total)
+	data["summary_date"] = date
+	data["currency"] = currency
+	data["categories"] = categories
+	return data
+}
+
+// summaryFields renders one row's counts and amounts for the template
+func summaryFields(r dailySummaryRow) map[string]interface{} {
+	return map[string]interface{}{
+		"payment_count":   r.PaymentCount,
+		"gross_amount":    formatSignedMinorUnits(r.GrossCents),
+		"processing_fees": formatSignedMinorUnits(r.FeeCents),
+		"refund_count":    r.RefundCount,
+		"refunded_amount": formatSignedMinorUnits(r.RefundedCents),
+		"dispute_count":   r.DisputeCount,
+		"disputed_amount": formatSignedMinorUnits(r.DisputedCents),
+		"net_amount":      formatSignedMinorUnits(r.NetCents),
+	}
+}
+
+// formatSignedMinorUnits is formatMinorUnits for amounts that can be negative
+// (a day with more refunded than taken)
+func formatSignedMinorUnits(cents int64) string {
+	if cents < 0 {
+		return "-" + formatMinorUnits(-cents)
+	}
+	return formatMinorUnits(cents)
+}
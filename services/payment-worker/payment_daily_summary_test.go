@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummaryDay(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata")
+	}
+
+	// 02:30 UTC on the 16th is still the evening of the 15th in New York
+	now := time.Date(2026, 10, 16, 2, 30, 0, 0, time.UTC)
+	got, err := summaryDay("", now, ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 10, 14, 0, 0, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("summaryDay() = %v, want %v", got, want)
+	}
+
+	// The day a summary covers is a calendar day: 25 hours when DST ends
+	got, err = summaryDay("2026-11-01", now, ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hours := got.AddDate(0, 0, 1).Sub(got).Hours(); hours != 25 {
+		t.Errorf("2026-11-01 in New York is %v hours, want 25", hours)
+	}
+
+	if _, err := summaryDay("10/15/2026", now, ny); err == nil {
+		t.Error("summaryDay() accepted a date that isn't YYYY-MM-DD")
+	}
+}
+
+func TestSummaryEntityData(t *testing.T) {
+	rows := []dailySummaryRow{
+		{Category: "permits", PaymentCount: 3, GrossCents: 15000, FeeCents: 450, RefundCount: 1, RefundedCents: 5000, NetCents: 10450},
+		{Category: "park_reservations", RefundCount: 1, RefundedCents: 2500, DisputeCount: 1, DisputedCents: 4000, NetCents: -2500},
+	}
+
+	data := summaryEntityData("2026-10-15", "USD", rows)
+	if data["summary_date"] != "2026-10-15" || data["currency"] != "USD" {
+		t.Errorf("header = %v %v", data["summary_date"], data["currency"])
+	}
+	want := map[string]interface{}{
+		"payment_count": 3, "gross_amount": "150.00", "processing_fees": "4.50",
+		"refund_count": 2, "refunded_amount": "75.00",
+		"dispute_count": 1, "disputed_amount": "40.00", "net_amount": "79.50",
+	}
+	for key, value := range want {
+		if data[key] != value {
+			t.Errorf("total %s = %v, want %v", key, data[key], value)
+		}
+	}
+
+	categories := data["categories"].([]map[string]interface{})
+	if len(categories) != 2 || categories[1]["category"] != "park_reservations" || categories[1]["net_amount"] != "-25.00" {
+		t.Errorf("categories = %v", categories)
+	}
+
+	if empty := summaryEntityData("2026-10-15", "USD", nil); len(empty["categories"].([]map[string]interface{})) != 0 || empty["net_amount"] != "0.00" {
+		t.Errorf("empty day = %v", empty)
+	}
+}
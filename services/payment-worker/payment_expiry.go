@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Abandoned Payment Expiry
+//
+// A payer who closes the checkout form leaves the transaction in pending (or
+// pending_intent, if intent creation never finished), and the entity keeps
+// reusing it. The expire_abandoned_payments job finds one-off payments that
+// have not changed for PAYMENT_EXPIRY_HOURS, cancels the provider payment
+// where the provider supports it, and moves the row to 'expired'.
+// check_existing_payment() treats expired like canceled, so the entity can
+// start a new payment.
+//
+// Races with a payer finishing checkout at the last moment:
+//   - the provider refuses to cancel a payment that already succeeded, so the
+//     row is left for the success webhook (or the event backfill)
+//   - the status update only applies to rows still pending
+//   - a success webhook for an expired row (providers without cancel) still
+//     marks it succeeded; the payer was charged. See updatePaymentStatus.
+//
+// Subscription invoices are skipped: Stripe expires incomplete subscriptions
+// itself and reports it through customer.subscription.updated. So are
+// offline payments, which record_offline_payment settles.
+// ============================================================================
+
+// expireAbandonedPaymentsBatch caps the payments expired per run; the next
+// run picks up the rest
+const expireAbandonedPaymentsBatch = 200
+
+// ExpireAbandonedPaymentsArgs are the args of the expire_abandoned_payments
+// job. It can also be enqueued by hand with a different age:
+//
+//	INSERT INTO metadata.river_job (kind, args, queue, max_attempts, state)
+//	VALUES ('expire_abandoned_payments', '{"max_age_hours": 2}', 'default', 3, 'available');
+type ExpireAbandonedPaymentsArgs struct {
+	MaxAgeHours int `json:"max_age_hours,omitempty"` // 0 = worker default
+}
+
+// Kind returns the job kind identifier for River
+func (ExpireAbandonedPaymentsArgs) Kind() string {
+	return "expire_abandoned_payments"
+}
+
+// ExpireAbandonedPaymentsWorker expires payments left pending at checkout
+type ExpireAbandonedPaymentsWorker struct {
+	river.WorkerDefaults[ExpireAbandonedPaymentsArgs]
+	dbPool    *pgxpool.Pool
+	providers *ProviderRegistry
+	maxAge    time.Duration
+}
+
+// NewExpireAbandonedPaymentsWorker creates a new ExpireAbandonedPaymentsWorker
+func NewExpireAbandonedPaymentsWorker(dbPool *pgxpool.Pool, providers *ProviderRegistry, maxAge time.Duration) *ExpireAbandonedPaymentsWorker {
+	return &ExpireAbandonedPaymentsWorker{
+		dbPool:    dbPool,
+		providers: providers,
+		maxAge:    maxAge,
+	}
+}
+
+// abandonedPayment is a pending payment past the expiry age
+type abandonedPayment struct {
+	ID                string
+	Status            string
+	Provider          string
+	ProviderPaymentID *string
+}
+
+// Work expires one batch of abandoned payments. Failures are logged and left
+// for the next run rather than retried.
+func (w *ExpireAbandonedPaymentsWorker) Work(ctx context.Context, job *river.Job[ExpireAbandonedPaymentsArgs]) error {
+	maxAge := w.maxAge
+	if job.Args.MaxAgeHours > 0 {
+		maxAge = time.Duration(job.Args.MaxAgeHours) * time.Hour
+	}
+	if maxAge <= 0 {
+		log.Printf("[Expiry] PAYMENT_EXPIRY_HOURS is 0, skipping")
+		return nil
+	}
+
+	payments, err := w.abandonedPayments(ctx, time.Now().Add(-maxAge))
+	if err != nil {
+		return err
+	}
+	if len(payments) == 0 {
+		return nil
+	}
+
+	var expired, skipped int
+	for _, payment := range payments {
+		ok, err := w.expire(ctx, payment, maxAge)
+		switch {
+		case err != nil:
+			log.Printf("[Expiry] Payment %s not expired: %v", payment.ID, err)
+			skipped++
+		case ok:
+			expired++
+		default:
+			skipped++
+		}
+	}
+
+	log.Printf("[Expiry] Checked %d payments pending for over %s: %d expired, %d skipped",
+		len(payments), maxAge, expired, skipped)
+	return nil
+}
+
+// abandonedPayments returns one-off payments pending since before cutoff,
+// oldest first. Payments whose create_payment_intent job is still in flight
+// are left alone.
+func (w *ExpireAbandonedPaymentsWorker) abandonedPayments(ctx context.Context, cutoff time.Time) ([]abandonedPayment, error) {
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT t.id, t.status, t.provider, t.provider_payment_id
+		FROM payments.transactions t
+		WHERE t.status IN ('pending_intent', 'pending')
+		  AND t.subscription_id IS NULL
+		  AND t.provider != 'offline'
+		  AND t.updated_at < $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM metadata.river_job j
+		      WHERE j.kind = 'create_payment_intent'
+		        AND j.args->>'payment_id' = t.id::TEXT
+		        AND j.state IN ('available', 'scheduled', 'running', 'retryable')
+		  )
+		ORDER BY t.updated_at
+		LIMIT $2
+	`, cutoff, expireAbandonedPaymentsBatch)
+	if err != nil {
+		return nil, fmt.Errorf("query abandoned payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []abandonedPayment
+	for rows.Next() {
+		var p abandonedPayment
+		if err := rows.Scan(&p.ID, &p.Status, &p.Provider, &p.ProviderPaymentID); err != nil {
+			return nil, fmt.Errorf("scan payment: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query abandoned payments: %w", err)
+	}
+	return payments, nil
+}
+
+// expire cancels the provider payment, if there is one and the provider can,
+// then marks the row expired. Returns false when a webhook settled the
+// payment first.
+func (w *ExpireAbandonedPaymentsWorker) expire(ctx context.Context, payment abandonedPayment, maxAge time.Duration) (bool, error) {
+	if payment.ProviderPaymentID != nil {
+		provider, err := w.providers.Get(payment.Provider)
+		if err != nil {
+			return false, err
+		}
+		// Under DRY_RUN the row still expires; the provider payment is left open
+		if canceler, ok := provider.(paymentCanceler); ok && !w.providers.dryRun.Skip(ctx, provider.Name(), "cancel_payment",
+			*payment.ProviderPaymentID, map[string]any{"payment_id": payment.ID, "reason": "expired"}) {
+			// Fails if the payer completed checkout after all; the success
+			// webhook settles the row
+			if err := canceler.CancelPayment(ctx, *payment.ProviderPaymentID); err != nil {
+				return false, fmt.Errorf("cancel %s payment: %w", provider.Name(), err)
+			}
+		}
+	}
+
+	result, err := w.dbPool.Exec(ctx, `
+		UPDATE payments.transactions
+		SET
+			status = 'expired',
+			error_message = $2,
+			updated_at = NOW()
+		WHERE id = $1 AND status IN ('pending_intent', 'pending')
+	`, payment.ID, abandonedPaymentMessage(maxAge))
+	if err != nil {
+		return false, fmt.Errorf("database update error: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		log.Printf("[Expiry] Payment %s settled before it expired, skipping", payment.ID)
+		return false, nil
+	}
+
+	log.Printf("[Expiry] ✓ Payment %s expired (was %s)", payment.ID, payment.Status)
+	return true, nil
+}
+
+// abandonedPaymentMessage explains an expired payment in error_message
+func abandonedPaymentMessage(maxAge time.Duration) string {
+	if maxAge%(24*time.Hour) == 0 {
+		days := int(maxAge / (24 * time.Hour))
+		if days == 1 {
+			return "Checkout not completed within 1 day"
+		}
+		return fmt.Sprintf("Checkout not completed within %d days", days)
+	}
+	hours := int(maxAge / time.Hour)
+	if hours == 1 {
+		return "Checkout not completed within 1 hour"
+	}
+	return fmt.Sprintf("Checkout not completed within %d hours", hours)
+}
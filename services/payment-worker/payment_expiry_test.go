@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAbandonedPaymentMessage(t *testing.T) {
+	tests := []struct {
+		maxAge time.Duration
+		want   string
+	}{
+		{time.Hour, "Checkout not completed within 1 hour"},
+		{2 * time.Hour, "Checkout not completed within 2 hours"},
+		{24 * time.Hour, "Checkout not completed within 1 day"},
+		{36 * time.Hour, "Checkout not completed within 36 hours"},
+		{72 * time.Hour, "Checkout not completed within 3 days"},
+	}
+	for _, tt := range tests {
+		if got := abandonedPaymentMessage(tt.maxAge); got != tt.want {
+			t.Errorf("abandonedPaymentMessage(%v) = %q, want %q", tt.maxAge, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentCanceler_Providers(t *testing.T) {
+	// Stripe PaymentIntents are canceled; Square links and PayPal orders lapse on their own
+	if _, ok := PaymentProvider(&StripeProvider{}).(paymentCanceler); !ok {
+		t.Error("StripeProvider should implement paymentCanceler")
+	}
+	if _, ok := PaymentProvider(&SquareProvider{}).(paymentCanceler); ok {
+		t.Error("SquareProvider unexpectedly implements paymentCanceler")
+	}
+	if _, ok := PaymentProvider(&PayPalProvider{}).(paymentCanceler); ok {
+		t.Error("PayPalProvider unexpectedly implements paymentCanceler")
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// PaymentProvider defines the interface for payment processors
+//
+// Each payments.transactions row names its provider ('stripe', 'square',
+// 'paypal'); workers and the webhook server look the implementation up in a
+// ProviderRegistry by that name.
+type PaymentProvider interface {
+	// Name returns the provider key stored in payments.transactions.provider
+	// and metadata.webhooks.provider
+	Name() string
+	CreateIntent(ctx context.Context, params CreateIntentParams) (*PaymentIntentResult, error)
+	CreateRefund(ctx context.Context, params RefundParams) (*RefundResult, error)
+	// VerifyWebhook authenticates a raw webhook request and normalizes it.
+	// Returns an error if the signature is missing or invalid.
+	VerifyWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error)
+	// ParseWebhook normalizes a payload whose signature was already verified,
+	// e.g. a metadata.webhooks row being reprocessed
+	ParseWebhook(payload []byte) (*WebhookEvent, error)
+}
+
+// approvalCapturer is implemented by providers whose checkout flow only
+// approves a payment on the client; the server must capture it once the
+// approval webhook arrives (PayPal Orders).
+type approvalCapturer interface {
+	CaptureApproved(ctx context.Context, providerPaymentID string) error
+}
+
+// manualCapturer is implemented by providers that can authorize a payment at
+// checkout and charge or release it later (Stripe capture_method=manual).
+type manualCapturer interface {
+	// CapturePayment charges an authorized payment in full
+	CapturePayment(ctx context.Context, providerPaymentID string) error
+	// CancelPayment releases an authorization without charging it
+	CancelPayment(ctx context.Context, providerPaymentID string) error
+}
+
+// paymentCanceler is implemented by providers that can cancel a payment the
+// customer never completed (Stripe: a PaymentIntent not yet succeeded). The
+// expire_abandoned_payments job uses it; Square payment links and PayPal
+// orders expire on their own.
+type paymentCanceler interface {
+	CancelPayment(ctx context.Context, providerPaymentID string) error
+}
+
+// subscriptionBiller is implemented by providers that bill recurring
+// subscriptions themselves (Stripe Billing). The provider runs the schedule;
+// invoice webhooks report each renewal.
+type subscriptionBiller interface {
+	// CreateSubscription creates a subscription whose first invoice waits for
+	// the customer to confirm its PaymentIntent at checkout
+	CreateSubscription(ctx context.Context, params CreateSubscriptionParams) (*SubscriptionResult, error)
+	// CancelSubscription ends a subscription now, or stops renewing it after
+	// the current period when atPeriodEnd is true
+	CancelSubscription(ctx context.Context, providerSubscriptionID string, atPeriodEnd bool) error
+}
+
+// eventLister is implemented by providers whose API can list recent events
+// (Stripe Events API). The backfill job uses it to recover events whose
+// webhook delivery never succeeded.
+type eventLister interface {
+	// ListEvents returns handled events created in [since, until), oldest first
+	ListEvents(ctx context.Context, since, until time.Time) ([]*WebhookEvent, error)
+}
+
+// healthPinger is implemented by providers whose API can be checked cheaply
+// for /health (Stripe: retrieve the balance, which also validates the key)
+type healthPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Payment methods stored in payments.transactions.payment_method
+const (
+	PaymentMethodCard          = "card"
+	PaymentMethodUSBankAccount = "us_bank_account" // ACH debit; settles days after confirmation
+)
+
+// Capture methods stored in payments.transactions.capture_method
+const (
+	CaptureMethodAutomatic = "automatic"
+	CaptureMethodManual    = "manual" // Authorize at checkout, capture or void later
+)
+
+// CreateIntentParams contains parameters for creating a payment intent
+type CreateIntentParams struct {
+	PaymentID     string // payments.transactions.id (used as idempotency key)
+	Amount        int64  // Amount in cents (e.g., 1000 = $10.00)
+	Currency      string // Currency code (e.g., "usd")
+	Description   string // Payment description
+	PaymentMethod string // PaymentMethodCard or PaymentMethodUSBankAccount
+	CaptureMethod string // CaptureMethodAutomatic (or empty) or CaptureMethodManual
+
+	// Stripe Connect destination charge (empty = settle to the platform account)
+	DestinationAccount  string // Connected account ID (acct_...) from payments.payout_routes
+	ApplicationFeeCents int64  // Kept by the platform out of a destination charge
+}
+
+// PaymentIntentResult contains the result of creating a payment intent
+type PaymentIntentResult struct {
+	PaymentIntentID string // Provider payment ID (Stripe pi_..., Square order ID, PayPal order ID)
+	ClientSecret    string // Value the frontend needs to complete checkout (Stripe client_secret, Square payment link URL, PayPal order ID)
+	Status          string // Provider status (e.g., "requires_payment_method")
+}
+
+// CreateSubscriptionParams contains parameters for creating a subscription
+type CreateSubscriptionParams struct {
+	SubscriptionID string // payments.subscriptions.id (used as idempotency key)
+	CustomerID     string // Provider customer to reuse (the user's earlier subscriptions), or empty
+	Email          string // Customer email for a new customer
+	Name           string // Customer name for a new customer
+	Amount         int64  // Amount per period in cents
+	Currency       string // Currency code (e.g., "usd")
+	Description    string // Product name shown on invoices
+	Interval       string // "day", "week", "month" or "year"
+	IntervalCount  int64  // Periods between invoices (e.g., 3 with "month" = quarterly)
+}
+
+// SubscriptionResult contains the result of creating a subscription
+type SubscriptionResult struct {
+	SubscriptionID   string // Provider subscription ID (Stripe sub_...)
+	CustomerID       string // Provider customer ID (Stripe cus_...)
+	Status           string // Provider subscription status (normally "incomplete")
+	InvoiceID        string // First invoice (Stripe in_...)
+	PaymentIntentID  string // PaymentIntent paying the first invoice
+	ClientSecret     string // client_secret for confirming the first invoice at checkout
+	CurrentPeriodEnd int64  // Unix time the first period ends
+}
+
+// RefundParams contains parameters for creating a refund
+type RefundParams struct {
+	RefundID        string // payments.refunds.id (used as idempotency key)
+	PaymentIntentID string // Provider payment ID to refund (provider_payment_id)
+	AmountCents     int64  // Amount to refund in cents (partial refunds supported)
+	Currency        string // Currency code of the original payment
+	Reason          string // Reason for refund (shown in provider dashboard)
+
+	// Destination charges: pull the refund back from the connected account,
+	// and return the application fee in proportion when the fee is refundable
+	ReverseTransfer      bool
+	RefundApplicationFee bool
+}
+
+// RefundResult contains the result of creating a refund
+type RefundResult struct {
+	RefundID string // Provider refund ID (Stripe re_..., Square/PayPal refund ID)
+	Status   string // Refund status (e.g., "succeeded", "pending")
+}
+
+// WebhookEventKind is the provider-independent meaning of a webhook event
+type WebhookEventKind string
+
+const (
+	WebhookIgnored           WebhookEventKind = ""
+	WebhookPaymentApproved   WebhookEventKind = "payment_approved"
+	WebhookPaymentProcessing WebhookEventKind = "payment_processing" // Confirmed, awaiting settlement (ACH)
+	WebhookPaymentAuthorized WebhookEventKind = "payment_authorized" // Funds held, awaiting capture (manual capture)
+	WebhookPaymentSucceeded  WebhookEventKind = "payment_succeeded"
+	WebhookPaymentFailed     WebhookEventKind = "payment_failed"
+	WebhookPaymentCanceled   WebhookEventKind = "payment_canceled"
+	WebhookRefundSucceeded   WebhookEventKind = "refund_succeeded"
+	WebhookRefundFailed      WebhookEventKind = "refund_failed" // Provider failed a refund it had accepted (e.g. returned ACH refund)
+	WebhookMandateAccepted   WebhookEventKind = "mandate_accepted"
+
+	WebhookInvoicePaid          WebhookEventKind = "invoice_paid"           // Subscription invoice paid (first or renewal)
+	WebhookInvoicePaymentFailed WebhookEventKind = "invoice_payment_failed" // Subscription charge failed; provider retries
+	WebhookSubscriptionUpdated  WebhookEventKind = "subscription_updated"   // Status, period or cancellation changed
+
+	WebhookTransferUpdated WebhookEventKind = "transfer_updated" // Destination charge transfer created or reversed (Stripe Connect)
+	WebhookPayoutUpdated   WebhookEventKind = "payout_updated"   // Connected account payout created, paid, failed or canceled
+	WebhookAccountUpdated  WebhookEventKind = "account_updated"  // Connected account capabilities changed
+
+	WebhookDisputeUpdated WebhookEventKind = "dispute_updated" // Chargeback or inquiry opened, updated or closed
+)
+
+// WebhookEvent is a verified webhook normalized by its provider
+type WebhookEvent struct {
+	Provider          string           // Provider key (e.g., "stripe")
+	EventID           string           // Provider event ID, used for idempotency
+	EventType         string           // Provider's own event type, stored for auditing
+	Kind              WebhookEventKind // Normalized meaning used for routing
+	ProviderPaymentID string           // Matches payments.transactions.provider_payment_id
+	ProviderRefundID  string           // Matches payments.refunds.provider_refund_id (when known)
+	MandateID         string           // Debit mandate the payer accepted (ACH), stored on the transaction
+	Payload           []byte           // Raw request body, stored in metadata.webhooks
+
+	// Subscription events (Stripe Billing)
+	ProviderSubscriptionID string // Matches payments.subscriptions.provider_subscription_id
+	ProviderInvoiceID      string // Matches payments.transactions.provider_invoice_id
+	AmountCents            int64  // Invoice amount paid or due
+	FailureMessage         string // Why an invoice payment or refund failed
+	SubscriptionStatus     string // Provider subscription status
+	CurrentPeriodEnd       int64  // Unix time the current period ends (0 if unknown)
+	CancelAtPeriodEnd      bool   // Subscription stops renewing at CurrentPeriodEnd
+	CanceledAt             int64  // Unix time the subscription was canceled (0 if not)
+
+	// Stripe Connect events
+	ProviderAccountID   string // Connected account (acct_...) the event concerns
+	ProviderTransferID  string // Transfer to the connected account (tr_...)
+	TransferGroup       string // payments.transactions.id the transfer pays out
+	AmountReversedCents int64  // Part of the transfer reversed by refunds
+	ProviderPayoutID    string // Payout to the connected account's bank (po_...)
+	PayoutStatus        string // Stripe payout status
+	Currency            string // Payout currency
+	ArrivalDate         int64  // Unix time the payout is expected at the bank
+	ChargesEnabled      bool   // Account can receive destination charges
+	PayoutsEnabled      bool   // Account can pay out to its bank
+
+	// Dispute events (amount and currency in AmountCents and Currency)
+	ProviderDisputeID string // Provider dispute ID (Stripe dp_... or du_...)
+	DisputeStatus     string // Provider dispute status (e.g. needs_response, won, lost)
+	DisputeReason     string // Reason the payer's bank gave (e.g. fraudulent)
+	DisputeCreated    int64  // Unix time the dispute was opened
+}
+
+// ProviderRegistry holds the configured payment providers by name
+type ProviderRegistry struct {
+	providers map[string]PaymentProvider
+	dryRun    *DryRun // set under DRY_RUN; workers skip calls that move money
+}
+
+// NewProviderRegistry creates a registry from the configured providers
+func NewProviderRegistry(providers ...PaymentProvider) *ProviderRegistry {
+	r := &ProviderRegistry{providers: make(map[string]PaymentProvider, len(providers))}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// Get returns the provider for a transaction's provider column
+func (r *ProviderRegistry) Get(name string) (PaymentProvider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("payment provider %q is not configured", name)
+	}
+	return p, nil
+}
+
+// Names returns the configured provider names in sorted order
+func (r *ProviderRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatMinorUnits renders cents as a decimal string (1050 → "10.50")
+func formatMinorUnits(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
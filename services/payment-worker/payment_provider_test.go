@@ -0,0 +1,600 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+func TestProviderRegistry_Get(t *testing.T) {
+	registry := NewProviderRegistry(&SquareProvider{}, &PayPalProvider{})
+
+	if p, err := registry.Get("square"); err != nil || p.Name() != "square" {
+		t.Errorf("Get(square) = %v, %v; want square provider", p, err)
+	}
+	if _, err := registry.Get("stripe"); err == nil {
+		t.Error("Get(stripe) should fail when stripe is not configured")
+	}
+
+	names := registry.Names()
+	if len(names) != 2 || names[0] != "paypal" || names[1] != "square" {
+		t.Errorf("Names() = %v, want [paypal square]", names)
+	}
+}
+
+func TestFormatMinorUnits(t *testing.T) {
+	tests := map[int64]string{
+		1:      "0.01",
+		50:     "0.50",
+		1000:   "10.00",
+		154790: "1547.90",
+	}
+	for cents, want := range tests {
+		if got := formatMinorUnits(cents); got != want {
+			t.Errorf("formatMinorUnits(%d) = %q, want %q", cents, got, want)
+		}
+	}
+}
+
+func TestStripeProvider_VerifyWebhook_ACH(t *testing.T) {
+	provider := &StripeProvider{webhookSecret: "whsec_test"}
+
+	tests := []struct {
+		name        string
+		payload     string
+		wantKind    WebhookEventKind
+		wantPayment string
+		wantMandate string
+	}{
+		{
+			name:        "debit awaiting settlement",
+			payload:     `{"id":"evt_1","object":"event","type":"payment_intent.processing","data":{"object":{"id":"pi_1","object":"payment_intent","status":"processing"}}}`,
+			wantKind:    WebhookPaymentProcessing,
+			wantPayment: "pi_1",
+		},
+		{
+			name:        "pending ACH charge carries mandate",
+			payload:     `{"id":"evt_2","object":"event","type":"charge.pending","data":{"object":{"id":"py_1","object":"charge","payment_intent":"pi_1","payment_method_details":{"type":"us_bank_account","us_bank_account":{"mandate":"mandate_1"}}}}}`,
+			wantKind:    WebhookMandateAccepted,
+			wantPayment: "pi_1",
+			wantMandate: "mandate_1",
+		},
+		{
+			name:        "pending card charge is ignored",
+			payload:     `{"id":"evt_3","object":"event","type":"charge.pending","data":{"object":{"id":"ch_1","object":"charge","payment_intent":"pi_2","payment_method_details":{"type":"card"}}}}`,
+			wantKind:    WebhookIgnored,
+			wantPayment: "pi_2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+				Payload: []byte(tt.payload),
+				Secret:  provider.webhookSecret,
+			})
+			header := http.Header{}
+			header.Set("Stripe-Signature", signed.Header)
+
+			event, err := provider.VerifyWebhook(context.Background(), signed.Payload, header)
+			if err != nil {
+				t.Fatalf("VerifyWebhook() error = %v", err)
+			}
+			if event.Kind != tt.wantKind || event.ProviderPaymentID != tt.wantPayment || event.MandateID != tt.wantMandate {
+				t.Errorf("event = {kind:%q payment:%q mandate:%q}, want {kind:%q payment:%q mandate:%q}",
+					event.Kind, event.ProviderPaymentID, event.MandateID, tt.wantKind, tt.wantPayment, tt.wantMandate)
+			}
+		})
+	}
+}
+
+func TestProviders_RejectBankAccountOutsideStripe(t *testing.T) {
+	params := CreateIntentParams{PaymentID: "payment-1", Amount: 1000, PaymentMethod: PaymentMethodUSBankAccount}
+	for _, provider := range []PaymentProvider{&SquareProvider{}, &PayPalProvider{}} {
+		if _, err := provider.CreateIntent(context.Background(), params); err == nil {
+			t.Errorf("%s CreateIntent() should reject %s", provider.Name(), PaymentMethodUSBankAccount)
+		}
+	}
+}
+
+func TestStripeProvider_VerifyWebhook_ManualCapture(t *testing.T) {
+	provider := &StripeProvider{webhookSecret: "whsec_test"}
+	payload := `{"id":"evt_4","object":"event","type":"payment_intent.amount_capturable_updated","data":{"object":{"id":"pi_3","object":"payment_intent","status":"requires_capture","amount_capturable":5000}}}`
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: []byte(payload),
+		Secret:  provider.webhookSecret,
+	})
+	header := http.Header{}
+	header.Set("Stripe-Signature", signed.Header)
+
+	event, err := provider.VerifyWebhook(context.Background(), signed.Payload, header)
+	if err != nil {
+		t.Fatalf("VerifyWebhook() error = %v", err)
+	}
+	if event.Kind != WebhookPaymentAuthorized || event.ProviderPaymentID != "pi_3" {
+		t.Errorf("event = {kind:%q payment:%q}, want {kind:%q payment:%q}",
+			event.Kind, event.ProviderPaymentID, WebhookPaymentAuthorized, "pi_3")
+	}
+}
+
+func TestStripeProvider_VerifyWebhook_RefundUpdated(t *testing.T) {
+	provider := &StripeProvider{webhookSecret: "whsec_test"}
+
+	tests := []struct {
+		name        string
+		refund      string
+		wantKind    WebhookEventKind
+		wantFailure string
+	}{
+		{
+			name:     "succeeded",
+			refund:   `{"id":"re_1","object":"refund","payment_intent":"pi_9","status":"succeeded"}`,
+			wantKind: WebhookRefundSucceeded,
+		},
+		{
+			name:     "still pending",
+			refund:   `{"id":"re_1","object":"refund","payment_intent":"pi_9","status":"pending"}`,
+			wantKind: WebhookIgnored,
+		},
+		{
+			name:        "returned ACH refund",
+			refund:      `{"id":"re_1","object":"refund","payment_intent":"pi_9","status":"failed","failure_reason":"unknown"}`,
+			wantKind:    WebhookRefundFailed,
+			wantFailure: "Stripe refund failed: unknown",
+		},
+		{
+			name:        "canceled",
+			refund:      `{"id":"re_1","object":"refund","payment_intent":"pi_9","status":"canceled"}`,
+			wantKind:    WebhookRefundFailed,
+			wantFailure: "Stripe refund canceled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := `{"id":"evt_r","object":"event","type":"charge.refund.updated","data":{"object":` + tt.refund + `}}`
+			signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+				Payload: []byte(payload),
+				Secret:  provider.webhookSecret,
+			})
+			header := http.Header{}
+			header.Set("Stripe-Signature", signed.Header)
+
+			event, err := provider.VerifyWebhook(context.Background(), signed.Payload, header)
+			if err != nil {
+				t.Fatalf("VerifyWebhook() error = %v", err)
+			}
+			if event.Kind != tt.wantKind || event.ProviderRefundID != "re_1" || event.ProviderPaymentID != "pi_9" {
+				t.Errorf("event = {kind:%q refund:%q payment:%q}, want {kind:%q refund:re_1 payment:pi_9}",
+					event.Kind, event.ProviderRefundID, event.ProviderPaymentID, tt.wantKind)
+			}
+			if event.FailureMessage != tt.wantFailure {
+				t.Errorf("FailureMessage = %q, want %q", event.FailureMessage, tt.wantFailure)
+			}
+		})
+	}
+}
+
+func TestStripeProvider_VerifyWebhook_Dispute(t *testing.T) {
+	provider := &StripeProvider{webhookSecret: "whsec_test"}
+
+	payload := `{"id":"evt_d","object":"event","type":"charge.dispute.created","data":{"object":` +
+		`{"id":"dp_1","object":"dispute","amount":5000,"currency":"usd","payment_intent":"pi_9",` +
+		`"reason":"fraudulent","status":"needs_response","created":1760000000}}}`
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: []byte(payload),
+		Secret:  provider.webhookSecret,
+	})
+	header := http.Header{}
+	header.Set("Stripe-Signature", signed.Header)
+
+	event, err := provider.VerifyWebhook(context.Background(), signed.Payload, header)
+	if err != nil {
+		t.Fatalf("VerifyWebhook() error = %v", err)
+	}
+	if event.Kind != WebhookDisputeUpdated || event.ProviderDisputeID != "dp_1" || event.ProviderPaymentID != "pi_9" {
+		t.Errorf("event = {kind:%q dispute:%q payment:%q}, want {kind:%q dispute:dp_1 payment:pi_9}",
+			event.Kind, event.ProviderDisputeID, event.ProviderPaymentID, WebhookDisputeUpdated)
+	}
+	if event.AmountCents != 5000 || event.Currency != "usd" || event.DisputeStatus != "needs_response" ||
+		event.DisputeReason != "fraudulent" || event.DisputeCreated != 1760000000 {
+		t.Errorf("dispute details = %d %s %s %s %d", event.AmountCents, event.Currency,
+			event.DisputeStatus, event.DisputeReason, event.DisputeCreated)
+	}
+}
+
+func TestProviders_RejectUnsupportedManualCapture(t *testing.T) {
+	params := CreateIntentParams{PaymentID: "payment-1", Amount: 1000, PaymentMethod: PaymentMethodCard, CaptureMethod: CaptureMethodManual}
+	for _, provider := range []PaymentProvider{&SquareProvider{}, &PayPalProvider{}} {
+		if _, err := provider.CreateIntent(context.Background(), params); err == nil {
+			t.Errorf("%s CreateIntent() should reject manual capture", provider.Name())
+		}
+	}
+
+	// Stripe can't hold ACH debits; rejected before any API call
+	params.PaymentMethod = PaymentMethodUSBankAccount
+	if _, err := (&StripeProvider{}).CreateIntent(context.Background(), params); err == nil {
+		t.Error("stripe CreateIntent() should reject manual capture for bank debits")
+	}
+
+	// Only Stripe can capture or void later
+	if _, ok := PaymentProvider(&StripeProvider{}).(manualCapturer); !ok {
+		t.Error("StripeProvider should implement manualCapturer")
+	}
+}
+
+func TestStripeProvider_VerifyWebhook_Subscriptions(t *testing.T) {
+	provider := &StripeProvider{webhookSecret: "whsec_test"}
+
+	tests := []struct {
+		name    string
+		payload string
+		want    WebhookEvent
+	}{
+		{
+			name:    "renewal paid",
+			payload: `{"id":"evt_5","object":"event","type":"invoice.paid","data":{"object":{"id":"in_1","object":"invoice","subscription":"sub_1","payment_intent":"pi_4","amount_paid":2500,"amount_due":2500}}}`,
+			want:    WebhookEvent{Kind: WebhookInvoicePaid, ProviderSubscriptionID: "sub_1", ProviderInvoiceID: "in_1", ProviderPaymentID: "pi_4", AmountCents: 2500},
+		},
+		{
+			name:    "renewal failed",
+			payload: `{"id":"evt_6","object":"event","type":"invoice.payment_failed","data":{"object":{"id":"in_2","object":"invoice","subscription":"sub_1","payment_intent":"pi_5","amount_paid":0,"amount_due":2500,"attempt_count":2}}}`,
+			want: WebhookEvent{Kind: WebhookInvoicePaymentFailed, ProviderSubscriptionID: "sub_1", ProviderInvoiceID: "in_2", ProviderPaymentID: "pi_5", AmountCents: 2500,
+				FailureMessage: "Subscription payment failed (attempt 2)"},
+		},
+		{
+			name:    "one-off invoice is ignored",
+			payload: `{"id":"evt_7","object":"event","type":"invoice.paid","data":{"object":{"id":"in_3","object":"invoice","amount_paid":100}}}`,
+			want:    WebhookEvent{Kind: WebhookIgnored},
+		},
+		{
+			name:    "scheduled cancellation",
+			payload: `{"id":"evt_8","object":"event","type":"customer.subscription.updated","data":{"object":{"id":"sub_1","object":"subscription","status":"active","current_period_end":1790000000,"cancel_at_period_end":true}}}`,
+			want:    WebhookEvent{Kind: WebhookSubscriptionUpdated, ProviderSubscriptionID: "sub_1", SubscriptionStatus: "active", CurrentPeriodEnd: 1790000000, CancelAtPeriodEnd: true},
+		},
+		{
+			name:    "ended",
+			payload: `{"id":"evt_9","object":"event","type":"customer.subscription.deleted","data":{"object":{"id":"sub_1","object":"subscription","status":"canceled","canceled_at":1790000100}}}`,
+			want:    WebhookEvent{Kind: WebhookSubscriptionUpdated, ProviderSubscriptionID: "sub_1", SubscriptionStatus: "canceled", CanceledAt: 1790000100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+				Payload: []byte(tt.payload),
+				Secret:  provider.webhookSecret,
+			})
+			header := http.Header{}
+			header.Set("Stripe-Signature", signed.Header)
+
+			event, err := provider.VerifyWebhook(context.Background(), signed.Payload, header)
+			if err != nil {
+				t.Fatalf("VerifyWebhook() error = %v", err)
+			}
+			got := WebhookEvent{
+				Kind:                   event.Kind,
+				ProviderPaymentID:      event.ProviderPaymentID,
+				ProviderSubscriptionID: event.ProviderSubscriptionID,
+				ProviderInvoiceID:      event.ProviderInvoiceID,
+				AmountCents:            event.AmountCents,
+				FailureMessage:         event.FailureMessage,
+				SubscriptionStatus:     event.SubscriptionStatus,
+				CurrentPeriodEnd:       event.CurrentPeriodEnd,
+				CancelAtPeriodEnd:      event.CancelAtPeriodEnd,
+				CanceledAt:             event.CanceledAt,
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("event = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := PaymentProvider(provider).(subscriptionBiller); !ok {
+		t.Error("StripeProvider should implement subscriptionBiller")
+	}
+}
+
+func TestSubscriptionStatus(t *testing.T) {
+	tests := map[string]string{
+		"active":             "active",
+		"past_due":           "past_due",
+		"incomplete_expired": "incomplete_expired",
+		"canceled":           "canceled",
+		"trialing":           "active",
+		"paused":             "unpaid",
+		"something_new":      "incomplete",
+	}
+	for providerStatus, want := range tests {
+		if got := subscriptionStatus(providerStatus); got != want {
+			t.Errorf("subscriptionStatus(%q) = %q, want %q", providerStatus, got, want)
+		}
+	}
+}
+
+func signSquare(key, url string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(url))
+	mac.Write(payload)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSquareProvider_VerifyWebhook(t *testing.T) {
+	provider := &SquareProvider{
+		signatureKey: "sig-key",
+		webhookURL:   "https://api.example.com/webhooks/square",
+	}
+
+	tests := []struct {
+		name        string
+		payload     string
+		wantKind    WebhookEventKind
+		wantPayment string
+		wantRefund  string
+	}{
+		{
+			name:        "completed payment",
+			payload:     `{"event_id":"evt1","type":"payment.updated","data":{"object":{"payment":{"id":"pay1","order_id":"ord1","status":"COMPLETED"}}}}`,
+			wantKind:    WebhookPaymentSucceeded,
+			wantPayment: "ord1",
+		},
+		{
+			name:        "approved payment is not final",
+			payload:     `{"event_id":"evt2","type":"payment.updated","data":{"object":{"payment":{"id":"pay1","order_id":"ord1","status":"APPROVED"}}}}`,
+			wantKind:    WebhookIgnored,
+			wantPayment: "ord1",
+		},
+		{
+			name:        "completed refund",
+			payload:     `{"event_id":"evt3","type":"refund.updated","data":{"object":{"refund":{"id":"ref1","order_id":"ord1","status":"COMPLETED"}}}}`,
+			wantKind:    WebhookRefundSucceeded,
+			wantPayment: "ord1",
+			wantRefund:  "ref1",
+		},
+		{
+			name:        "rejected refund",
+			payload:     `{"event_id":"evt4","type":"refund.updated","data":{"object":{"refund":{"id":"ref2","order_id":"ord1","status":"REJECTED"}}}}`,
+			wantKind:    WebhookRefundFailed,
+			wantPayment: "ord1",
+			wantRefund:  "ref2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(tt.payload)
+			header := http.Header{}
+			header.Set("X-Square-Hmacsha256-Signature", signSquare("sig-key", provider.webhookURL, payload))
+
+			event, err := provider.VerifyWebhook(context.Background(), payload, header)
+			if err != nil {
+				t.Fatalf("VerifyWebhook() error = %v", err)
+			}
+			if event.Kind != tt.wantKind || event.ProviderPaymentID != tt.wantPayment || event.ProviderRefundID != tt.wantRefund {
+				t.Errorf("event = {kind:%q payment:%q refund:%q}, want {kind:%q payment:%q refund:%q}",
+					event.Kind, event.ProviderPaymentID, event.ProviderRefundID, tt.wantKind, tt.wantPayment, tt.wantRefund)
+			}
+			if event.Provider != "square" {
+				t.Errorf("Provider = %q, want square", event.Provider)
+			}
+		})
+	}
+
+	t.Run("rejects bad signature", func(t *testing.T) {
+		payload := []byte(tests[0].payload)
+		header := http.Header{}
+		header.Set("X-Square-Hmacsha256-Signature", signSquare("wrong-key", provider.webhookURL, payload))
+		if _, err := provider.VerifyWebhook(context.Background(), payload, header); err == nil {
+			t.Error("expected signature error")
+		}
+	})
+
+	t.Run("rejects missing signature", func(t *testing.T) {
+		if _, err := provider.VerifyWebhook(context.Background(), []byte(tests[0].payload), http.Header{}); err == nil {
+			t.Error("expected missing signature error")
+		}
+	})
+}
+
+// newPayPalTestServer fakes the PayPal endpoints the provider calls
+func newPayPalTestServer(t *testing.T, verification string) (*httptest.Server, map[string]int) {
+	t.Helper()
+	calls := map[string]int{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		calls["token"]++
+		if user, pass, ok := r.BasicAuth(); !ok || user != "client" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "tok", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v2/checkout/orders", func(w http.ResponseWriter, r *http.Request) {
+		calls["create"]++
+		if r.Header.Get("PayPal-Request-Id") != "payment-1" {
+			t.Errorf("PayPal-Request-Id = %q, want payment-1", r.Header.Get("PayPal-Request-Id"))
+		}
+		var body struct {
+			PurchaseUnits []struct {
+				Amount paypalAmount `json:"amount"`
+			} `json:"purchase_units"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if len(body.PurchaseUnits) != 1 || body.PurchaseUnits[0].Amount.Value != "25.30" || body.PurchaseUnits[0].Amount.CurrencyCode != "USD" {
+			t.Errorf("unexpected purchase units: %+v", body.PurchaseUnits)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": "ORDER1", "status": "CREATED"})
+	})
+	mux.HandleFunc("/v2/checkout/orders/ORDER1/capture", func(w http.ResponseWriter, r *http.Request) {
+		calls["capture"]++
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":    "UNPROCESSABLE_ENTITY",
+			"details": []map[string]string{{"issue": "ORDER_ALREADY_CAPTURED"}},
+		})
+	})
+	mux.HandleFunc("/v1/notifications/verify-webhook-signature", func(w http.ResponseWriter, r *http.Request) {
+		calls["verify"]++
+		json.NewEncoder(w).Encode(map[string]string{"verification_status": verification})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, calls
+}
+
+func TestPayPalProvider_CreateIntent(t *testing.T) {
+	server, calls := newPayPalTestServer(t, "SUCCESS")
+	provider := &PayPalProvider{clientID: "client", clientSecret: "secret", baseURL: server.URL, httpClient: server.Client()}
+
+	result, err := provider.CreateIntent(context.Background(), CreateIntentParams{
+		PaymentID: "payment-1",
+		Amount:    2530,
+		Currency:  "usd",
+	})
+	if err != nil {
+		t.Fatalf("CreateIntent() error = %v", err)
+	}
+	if result.PaymentIntentID != "ORDER1" || result.ClientSecret != "ORDER1" {
+		t.Errorf("result = %+v, want order ID in both fields", result)
+	}
+
+	// Already-captured orders are treated as success, and the token is reused
+	if err := provider.CaptureApproved(context.Background(), "ORDER1"); err != nil {
+		t.Errorf("CaptureApproved() error = %v", err)
+	}
+	if calls["token"] != 1 {
+		t.Errorf("token requested %d times, want 1", calls["token"])
+	}
+}
+
+func TestPayPalProvider_VerifyWebhook(t *testing.T) {
+	header := http.Header{}
+	header.Set("Paypal-Transmission-Sig", "sig")
+
+	t.Run("maps capture completed to order", func(t *testing.T) {
+		server, _ := newPayPalTestServer(t, "SUCCESS")
+		provider := &PayPalProvider{clientID: "client", clientSecret: "secret", webhookID: "WH", baseURL: server.URL, httpClient: server.Client()}
+
+		payload := []byte(`{"id":"WH-1","event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"id":"CAP1","supplementary_data":{"related_ids":{"order_id":"ORDER1"}}}}`)
+		event, err := provider.VerifyWebhook(context.Background(), payload, header)
+		if err != nil {
+			t.Fatalf("VerifyWebhook() error = %v", err)
+		}
+		if event.Kind != WebhookPaymentSucceeded || event.ProviderPaymentID != "ORDER1" || event.EventID != "WH-1" {
+			t.Errorf("event = %+v", event)
+		}
+	})
+
+	t.Run("maps refund by refund ID", func(t *testing.T) {
+		server, _ := newPayPalTestServer(t, "SUCCESS")
+		provider := &PayPalProvider{clientID: "client", clientSecret: "secret", webhookID: "WH", baseURL: server.URL, httpClient: server.Client()}
+
+		payload := []byte(`{"id":"WH-2","event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"id":"REF1"}}`)
+		event, err := provider.VerifyWebhook(context.Background(), payload, header)
+		if err != nil {
+			t.Fatalf("VerifyWebhook() error = %v", err)
+		}
+		if event.Kind != WebhookRefundSucceeded || event.ProviderRefundID != "REF1" || event.ProviderPaymentID != "" {
+			t.Errorf("event = %+v", event)
+		}
+	})
+
+	t.Run("rejects failed verification", func(t *testing.T) {
+		server, _ := newPayPalTestServer(t, "FAILURE")
+		provider := &PayPalProvider{clientID: "client", clientSecret: "secret", webhookID: "WH", baseURL: server.URL, httpClient: server.Client()}
+
+		if _, err := provider.VerifyWebhook(context.Background(), []byte(`{"id":"WH-3"}`), header); err == nil {
+			t.Error("expected verification error")
+		}
+	})
+}
+
+func TestProviders_RejectDestinationOutsideStripe(t *testing.T) {
+	params := CreateIntentParams{PaymentID: "payment-1", Amount: 1000, PaymentMethod: PaymentMethodCard, DestinationAccount: "acct_parks"}
+	for _, provider := range []PaymentProvider{&SquareProvider{}, &PayPalProvider{}} {
+		if _, err := provider.CreateIntent(context.Background(), params); err == nil {
+			t.Errorf("%s CreateIntent() should reject a destination account", provider.Name())
+		}
+	}
+}
+
+func TestStripeProvider_VerifyWebhook_Connect(t *testing.T) {
+	provider := &StripeProvider{webhookSecret: "whsec_test", connectWebhookSecret: "whsec_connect"}
+
+	tests := []struct {
+		name    string
+		secret  string
+		payload string
+		want    WebhookEvent
+	}{
+		{
+			name:    "destination charge transfer",
+			secret:  "whsec_test",
+			payload: `{"id":"evt_t1","object":"event","type":"transfer.reversed","data":{"object":{"id":"tr_1","object":"transfer","amount":15479,"amount_reversed":5000,"destination":"acct_parks","transfer_group":"0190-payment"}}}`,
+			want: WebhookEvent{Kind: WebhookTransferUpdated, ProviderTransferID: "tr_1", TransferGroup: "0190-payment",
+				ProviderAccountID: "acct_parks", AmountCents: 15479, AmountReversedCents: 5000},
+		},
+		{
+			name:    "connected account payout",
+			secret:  "whsec_connect",
+			payload: `{"id":"evt_p1","object":"event","type":"payout.failed","account":"acct_parks","data":{"object":{"id":"po_1","object":"payout","amount":20000,"currency":"usd","status":"failed","arrival_date":1790000000,"failure_message":"Account closed"}}}`,
+			want: WebhookEvent{Kind: WebhookPayoutUpdated, ProviderAccountID: "acct_parks", ProviderPayoutID: "po_1",
+				PayoutStatus: "failed", AmountCents: 20000, Currency: "usd", ArrivalDate: 1790000000, FailureMessage: "Account closed"},
+		},
+		{
+			name:    "platform payout is ignored",
+			secret:  "whsec_test",
+			payload: `{"id":"evt_p2","object":"event","type":"payout.paid","data":{"object":{"id":"po_2","object":"payout","amount":100,"currency":"usd","status":"paid"}}}`,
+			want:    WebhookEvent{Kind: WebhookIgnored},
+		},
+		{
+			name:    "account capabilities",
+			secret:  "whsec_connect",
+			payload: `{"id":"evt_a1","object":"event","type":"account.updated","account":"acct_clerk","data":{"object":{"id":"acct_clerk","object":"account","charges_enabled":true,"payouts_enabled":false}}}`,
+			want:    WebhookEvent{Kind: WebhookAccountUpdated, ProviderAccountID: "acct_clerk", ChargesEnabled: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+				Payload: []byte(tt.payload),
+				Secret:  tt.secret,
+			})
+			header := http.Header{}
+			header.Set("Stripe-Signature", signed.Header)
+
+			event, err := provider.VerifyWebhook(context.Background(), signed.Payload, header)
+			if err != nil {
+				t.Fatalf("VerifyWebhook() error = %v", err)
+			}
+			got := *event
+			got.Provider, got.EventID, got.EventType, got.Payload = "", "", "", nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("event = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Without a Connect secret, connected-account events fail verification
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: []byte(tests[1].payload),
+		Secret:  "whsec_connect",
+	})
+	header := http.Header{}
+	header.Set("Stripe-Signature", signed.Header)
+	if _, err := (&StripeProvider{webhookSecret: "whsec_test"}).VerifyWebhook(context.Background(), signed.Payload, header); err == nil {
+		t.Error("VerifyWebhook() accepted a Connect event without STRIPE_CONNECT_WEBHOOK_SECRET")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PayoutRoute is the connected account a payment category is paid out to
+type PayoutRoute struct {
+	ConnectedAccountID int64  // payments.connected_accounts.id
+	ProviderAccountID  string // Stripe account (acct_...)
+}
+
+// payoutRouteQuery finds a payment's route in the same order as fee
+// schedules: fee category, then entity type, then the default route. Empty
+// arguments never match, so a payment without a fee category still prefers
+// its entity type's route over the default.
+const payoutRouteQuery = `
+	SELECT a.id, a.provider_account_id
+	FROM payments.payout_routes r
+	JOIN payments.connected_accounts a ON a.id = r.connected_account_id
+	WHERE COALESCE(r.category, '') IN ($1, $2, '')
+	ORDER BY CASE COALESCE(r.category, '')
+		WHEN NULLIF($1, '') THEN 0
+		WHEN NULLIF($2, '') THEN 1
+		ELSE 2
+	END
+	LIMIT 1
+`
+
+// resolvePayoutRoute returns the route for a payment, or nil when its
+// category has none and the payment settles to the platform account
+func resolvePayoutRoute(ctx context.Context, dbPool *pgxpool.Pool, feeCategory, entityType string) (*PayoutRoute, error) {
+	var route PayoutRoute
+	err := dbPool.QueryRow(ctx, payoutRouteQuery, feeCategory, entityType).
+		Scan(&route.ConnectedAccountID, &route.ProviderAccountID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query payout route: %w", err)
+	}
+	return &route, nil
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	paypalProductionURL = "https://api-m.paypal.com"
+	paypalSandboxURL    = "https://api-m.sandbox.paypal.com"
+)
+
+// PayPalProvider implements PaymentProvider for PayPal Orders v2
+//
+// CreateIntent creates a CAPTURE-intent order whose ID is both the
+// provider_payment_id and the value the PayPal JS SDK needs. The buyer only
+// approves the order in the browser; CaptureApproved captures it when the
+// CHECKOUT.ORDER.APPROVED webhook arrives, and PAYMENT.CAPTURE.COMPLETED
+// then marks the transaction succeeded.
+type PayPalProvider struct {
+	clientID     string
+	clientSecret string
+	webhookID    string
+	baseURL      string
+	httpClient   *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// NewPayPalProvider creates a new PayPal payment provider
+func NewPayPalProvider(clientID, clientSecret, webhookID, environment string) *PayPalProvider {
+	if clientID == "" || clientSecret == "" {
+		log.Fatal("[PayPal] PAYPAL_CLIENT_ID and PAYPAL_CLIENT_SECRET are required")
+	}
+	if webhookID == "" {
+		log.Fatal("[PayPal] PAYPAL_WEBHOOK_ID is required")
+	}
+
+	baseURL := paypalSandboxURL
+	if environment == "production" {
+		baseURL = paypalProductionURL
+	}
+
+	log.Printf("[PayPal] Provider initialized (environment: %s, client: %s)",
+		environment, maskAPIKey(clientID))
+
+	return &PayPalProvider{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		webhookID:    webhookID,
+		baseURL:      baseURL,
+		httpClient:   &http.Client{Timeout: 30 * time.Second, Transport: newTracingTransport(nil, "paypal")},
+	}
+}
+
+// SetCredentials swaps in a rotated client ID and secret (see secrets.go)
+// and drops the cached access token, so the next call authenticates with
+// them. Empty values keep the current ones.
+func (p *PayPalProvider) SetCredentials(clientID, clientSecret string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if clientID != "" {
+		p.clientID = clientID
+	}
+	if clientSecret != "" {
+		p.clientSecret = clientSecret
+	}
+	p.accessToken = ""
+}
+
+// Name returns the provider key for PayPal transactions
+func (p *PayPalProvider) Name() string {
+	return "paypal"
+}
+
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+// CreateIntent creates a PayPal order for the buyer to approve
+func (p *PayPalProvider) CreateIntent(ctx context.Context, params CreateIntentParams) (*PaymentIntentResult, error) {
+	log.Printf("[PayPal] Creating order: amount=%d %s, description=%q",
+		params.Amount, params.Currency, params.Description)
+
+	if params.Amount <= 0 {
+		return nil, fmt.Errorf("invalid amount: %d (must be > 0)", params.Amount)
+	}
+	if params.PaymentMethod == PaymentMethodUSBankAccount {
+		return nil, fmt.Errorf("%s does not support %s payments", p.Name(), params.PaymentMethod)
+	}
+	if params.CaptureMethod == CaptureMethodManual {
+		return nil, fmt.Errorf("%s does not support manual capture", p.Name())
+	}
+	if params.DestinationAccount != "" {
+		return nil, fmt.Errorf("%s does not support payout routing to connected accounts", p.Name())
+	}
+	if params.Currency == "" {
+		params.Currency = "usd"
+	}
+
+	body := map[string]interface{}{
+		"intent": "CAPTURE",
+		"purchase_units": []map[string]interface{}{{
+			"reference_id": params.PaymentID,
+			"description":  params.Description,
+			"amount":       paypalAmount{CurrencyCode: strings.ToUpper(params.Currency), Value: formatMinorUnits(params.Amount)},
+		}},
+	}
+
+	var resp struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v2/checkout/orders", params.PaymentID, body, &resp); err != nil {
+		log.Printf("[PayPal] Error creating order: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[PayPal] ✓ Order created: id=%s, status=%s", resp.ID, resp.Status)
+
+	return &PaymentIntentResult{
+		PaymentIntentID: resp.ID,
+		ClientSecret:    resp.ID,
+		Status:          strings.ToLower(resp.Status),
+	}, nil
+}
+
+// CaptureApproved captures an order after the buyer approved it
+func (p *PayPalProvider) CaptureApproved(ctx context.Context, orderID string) error {
+	log.Printf("[PayPal] Capturing approved order %s", orderID)
+
+	var resp struct {
+		Status string `json:"status"`
+	}
+	err := p.do(ctx, http.MethodPost, "/v2/checkout/orders/"+orderID+"/capture", "capture-"+orderID, struct{}{}, &resp)
+	if err != nil {
+		// A redelivered approval webhook for an order we already captured
+		if strings.Contains(err.Error(), "ORDER_ALREADY_CAPTURED") {
+			log.Printf("[PayPal] Order %s already captured", orderID)
+			return nil
+		}
+		return fmt.Errorf("capture order: %w", err)
+	}
+
+	log.Printf("[PayPal] ✓ Order %s captured (status=%s)", orderID, resp.Status)
+	return nil
+}
+
+// CreateRefund refunds the capture attached to a PayPal order
+func (p *PayPalProvider) CreateRefund(ctx context.Context, params RefundParams) (*RefundResult, error) {
+	log.Printf("[PayPal] Creating Refund: order=%s, amount=%d cents",
+		params.PaymentIntentID, params.AmountCents)
+
+	if params.PaymentIntentID == "" {
+		return nil, fmt.Errorf("payment_intent_id is required")
+	}
+	if params.AmountCents <= 0 {
+		return nil, fmt.Errorf("invalid amount: %d (must be > 0)", params.AmountCents)
+	}
+	if params.Currency == "" {
+		params.Currency = "usd"
+	}
+
+	captureID, err := p.orderCaptureID(ctx, params.PaymentIntentID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"amount":        paypalAmount{CurrencyCode: strings.ToUpper(params.Currency), Value: formatMinorUnits(params.AmountCents)},
+		"note_to_payer": params.Reason,
+	}
+
+	var resp struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v2/payments/captures/"+captureID+"/refund", params.RefundID, body, &resp); err != nil {
+		log.Printf("[PayPal] Error creating Refund: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[PayPal] ✓ Refund created: id=%s, status=%s", resp.ID, resp.Status)
+
+	return &RefundResult{
+		RefundID: resp.ID,
+		Status:   strings.ToLower(resp.Status),
+	}, nil
+}
+
+// orderCaptureID returns the capture ID that settled an order
+func (p *PayPalProvider) orderCaptureID(ctx context.Context, orderID string) (string, error) {
+	var resp struct {
+		PurchaseUnits []struct {
+			Payments struct {
+				Captures []struct {
+					ID string `json:"id"`
+				} `json:"captures"`
+			} `json:"payments"`
+		} `json:"purchase_units"`
+	}
+	if err := p.do(ctx, http.MethodGet, "/v2/checkout/orders/"+orderID, "", nil, &resp); err != nil {
+		return "", fmt.Errorf("fetch order: %w", err)
+	}
+	for _, unit := range resp.PurchaseUnits {
+		if len(unit.Payments.Captures) > 0 {
+			return unit.Payments.Captures[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("order %s has no capture to refund", orderID)
+}
+
+// VerifyWebhook verifies the event with PayPal's verify-webhook-signature API
+// and maps it
+func (p *PayPalProvider) VerifyWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error) {
+	transmissionSig := header.Get("Paypal-Transmission-Sig")
+	if transmissionSig == "" {
+		return nil, fmt.Errorf("missing PAYPAL-TRANSMISSION-SIG header")
+	}
+
+	verifyReq := map[string]interface{}{
+		"auth_algo":         header.Get("Paypal-Auth-Algo"),
+		"cert_url":          header.Get("Paypal-Cert-Url"),
+		"transmission_id":   header.Get("Paypal-Transmission-Id"),
+		"transmission_sig":  transmissionSig,
+		"transmission_time": header.Get("Paypal-Transmission-Time"),
+		"webhook_id":        p.webhookID,
+		"webhook_event":     json.RawMessage(payload),
+	}
+	var verifyResp struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v1/notifications/verify-webhook-signature", "", verifyReq, &verifyResp); err != nil {
+		return nil, fmt.Errorf("verify signature: %w", err)
+	}
+	if verifyResp.VerificationStatus != "SUCCESS" {
+		return nil, fmt.Errorf("signature verification status %q", verifyResp.VerificationStatus)
+	}
+
+	return p.ParseWebhook(payload)
+}
+
+// ParseWebhook maps a PayPal event payload
+func (p *PayPalProvider) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	var event struct {
+		ID        string `json:"id"`
+		EventType string `json:"event_type"`
+		Resource  struct {
+			ID                string `json:"id"`
+			OrderID           string `json:"order_id"`
+			SupplementaryData struct {
+				RelatedIDs struct {
+					OrderID string `json:"order_id"`
+				} `json:"related_ids"`
+			} `json:"supplementary_data"`
+		} `json:"resource"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("unmarshal event: %w", err)
+	}
+
+	result := &WebhookEvent{
+		Provider:  p.Name(),
+		EventID:   event.ID,
+		EventType: event.EventType,
+		Payload:   payload,
+	}
+
+	switch event.EventType {
+	case "CHECKOUT.ORDER.APPROVED":
+		result.Kind = WebhookPaymentApproved
+		result.ProviderPaymentID = event.Resource.ID
+	case "PAYMENT.CAPTURE.COMPLETED":
+		result.Kind = WebhookPaymentSucceeded
+		result.ProviderPaymentID = event.Resource.SupplementaryData.RelatedIDs.OrderID
+	case "PAYMENT.CAPTURE.DENIED":
+		result.Kind = WebhookPaymentFailed
+		result.ProviderPaymentID = event.Resource.SupplementaryData.RelatedIDs.OrderID
+	case "CHECKOUT.PAYMENT-APPROVAL.REVERSED":
+		result.Kind = WebhookPaymentCanceled
+		result.ProviderPaymentID = event.Resource.OrderID
+	case "PAYMENT.CAPTURE.REFUNDED":
+		// The resource is the refund; it only links back to the capture,
+		// so the refund row is matched by its own ID
+		result.Kind = WebhookRefundSucceeded
+		result.ProviderRefundID = event.Resource.ID
+	}
+
+	return result, nil
+}
+
+// token returns a cached OAuth access token, refreshing it shortly before expiry
+func (p *PayPalProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken != "" && time.Now().Before(p.tokenExpiry) {
+		return p.accessToken, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("create token request: %w", err)
+	}
+	req.SetBasicAuth(p.clientID, p.clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("paypal token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("paypal token error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("decode token: %w", err)
+	}
+
+	p.accessToken = tokenResp.AccessToken
+	p.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn)*time.Second - time.Minute)
+	return p.accessToken, nil
+}
+
+// do sends an authenticated request to the PayPal API and decodes the response.
+// requestID sets PayPal-Request-Id, which makes POSTs idempotent.
+func (p *PayPalProvider) do(ctx context.Context, method, path, requestID string, body interface{}, out interface{}) error {
+	token, err := p.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	if requestID != "" {
+		req.Header.Set("PayPal-Request-Id", requestID)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("paypal API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Name    string `json:"name"`
+			Message string `json:"message"`
+			Details []struct {
+				Issue string `json:"issue"`
+			} `json:"details"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Name != "" {
+			if len(apiErr.Details) > 0 {
+				return fmt.Errorf("paypal API error (status %d): %s: %s", resp.StatusCode, apiErr.Name, apiErr.Details[0].Issue)
+			}
+			return fmt.Errorf("paypal API error (status %d): %s: %s", resp.StatusCode, apiErr.Name, apiErr.Message)
+		}
+		return fmt.Errorf("paypal API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return nil
+}
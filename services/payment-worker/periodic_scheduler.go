@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Periodic Job Scheduler
+//
+// The payment worker's periodic jobs (stripe_event_backfill,
+// expire_abandoned_payments, payment_daily_summary) are enqueued on a Go
+// ticker rather than as River periodic jobs: River elects one leader per
+// schema, and the leader is usually consolidated-worker, which doesn't know
+// these jobs. Unique-by-period insert options keep replicas from enqueuing a
+// job twice.
+// ============================================================================
+
+// jobInserter is the part of *river.Client the scheduler needs
+type jobInserter interface {
+	Insert(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error)
+}
+
+// PeriodicJobScheduler enqueues one job kind on an interval
+type PeriodicJobScheduler struct {
+	client   jobInserter
+	name     string // log prefix
+	args     river.JobArgs
+	interval time.Duration
+	done     chan bool
+	wg       sync.WaitGroup
+}
+
+// NewPeriodicJobScheduler creates a scheduler that enqueues args every interval
+func NewPeriodicJobScheduler(client jobInserter, name string, args river.JobArgs, interval time.Duration) *PeriodicJobScheduler {
+	return &PeriodicJobScheduler{
+		client:   client,
+		name:     name,
+		args:     args,
+		interval: interval,
+	}
+}
+
+// Start enqueues the first run immediately, catching up after downtime, then
+// one per interval
+func (s *PeriodicJobScheduler) Start(ctx context.Context) {
+	s.done = make(chan bool)
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		s.enqueue(ctx)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.enqueue(ctx)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	log.Printf("[%s] Scheduler started (every %s)", s.name, s.interval)
+}
+
+// Stop halts the scheduler goroutine
+func (s *PeriodicJobScheduler) Stop() {
+	if s.done != nil {
+		close(s.done)
+		s.wg.Wait()
+	}
+}
+
+func (s *PeriodicJobScheduler) enqueue(ctx context.Context) {
+	_, err := s.client.Insert(ctx, s.args, &river.InsertOpts{
+		MaxAttempts: 3,
+		UniqueOpts:  river.UniqueOpts{ByPeriod: s.interval},
+	})
+	if err != nil {
+		log.Printf("[%s] Failed to enqueue %s: %v", s.name, s.args.Kind(), err)
+	}
+}
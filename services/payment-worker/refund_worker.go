@@ -27,15 +27,15 @@ func (RefundWorkerArgs) Kind() string {
 // RefundWorker processes refund jobs
 type RefundWorker struct {
 	river.WorkerDefaults[RefundWorkerArgs]
-	dbPool   *pgxpool.Pool
-	provider PaymentProvider
+	dbPool    *pgxpool.Pool
+	providers *ProviderRegistry
 }
 
 // NewRefundWorker creates a new RefundWorker
-func NewRefundWorker(dbPool *pgxpool.Pool, provider PaymentProvider) *RefundWorker {
+func NewRefundWorker(dbPool *pgxpool.Pool, providers *ProviderRegistry) *RefundWorker {
 	return &RefundWorker{
-		dbPool:   dbPool,
-		provider: provider,
+		dbPool:    dbPool,
+		providers: providers,
 	}
 }
 
@@ -48,13 +48,39 @@ func (w *RefundWorker) Work(ctx context.Context, job *river.Job[RefundWorkerArgs
 	log.Printf("[Refund] Processing job for refund %s (payment_intent=%s, amount=%d cents)",
 		refundID, paymentIntentID, amountCents)
 
-	// 1. Fetch refund record to verify it's still pending
+	// 1. Lock the transaction so refunds of the same payment are checked and
+	// sent one at a time; the lock is held until the result is recorded
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // Auto-rollback if not committed
+
+	_, err = tx.Exec(ctx, `
+		SELECT t.id
+		FROM payments.transactions t
+		WHERE t.id = (SELECT transaction_id FROM payments.refunds WHERE id = $1)
+		FOR UPDATE
+	`, refundID)
+	if err != nil {
+		log.Printf("[Refund] Error locking transaction of refund %s: %v", refundID, err)
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	// 2. Fetch refund record to verify it's still pending
 	var refund struct {
-		ID            string
-		TransactionID string
-		Status        string
-		Reason        string
-		UserID        string
+		ID               string
+		TransactionID    string
+		Status           string
+		ProviderRefundID string
+		Reason           string
+		UserID           string
+		Provider         string
+		Currency         string
+		AmountCents      int64
+		Balance          refundBalance
+		Routed           bool // Destination charge to a connected account
+		FeeRefundable    bool
 	}
 
 	query := `
@@ -62,19 +88,43 @@ func (w *RefundWorker) Work(ctx context.Context, job *river.Job[RefundWorkerArgs
 			r.id,
 			r.transaction_id,
 			r.status,
+			COALESCE(r.provider_refund_id, ''),
 			r.reason,
-			t.user_id
+			t.user_id,
+			t.provider,
+			t.currency,
+			(r.amount * 100)::BIGINT,
+			(t.max_refundable * 100)::BIGINT,
+			t.refunded_amount_cents,
+			(
+				SELECT COALESCE(SUM(o.amount * 100), 0)::BIGINT
+				FROM payments.refunds o
+				WHERE o.transaction_id = r.transaction_id
+				AND o.status = 'pending'
+				AND o.id != r.id
+			),
+			t.connected_account_id IS NOT NULL,
+			COALESCE(t.fee_refundable, FALSE)
 		FROM payments.refunds r
 		JOIN payments.transactions t ON r.transaction_id = t.id
 		WHERE r.id = $1
 	`
 
-	err := w.dbPool.QueryRow(ctx, query, refundID).Scan(
+	err = tx.QueryRow(ctx, query, refundID).Scan(
 		&refund.ID,
 		&refund.TransactionID,
 		&refund.Status,
+		&refund.ProviderRefundID,
 		&refund.Reason,
 		&refund.UserID,
+		&refund.Provider,
+		&refund.Currency,
+		&refund.AmountCents,
+		&refund.Balance.MaxRefundableCents,
+		&refund.Balance.RefundedCents,
+		&refund.Balance.PendingCents,
+		&refund.Routed,
+		&refund.FeeRefundable,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -88,70 +138,146 @@ func (w *RefundWorker) Work(ctx context.Context, job *river.Job[RefundWorkerArgs
 	log.Printf("[Refund] Fetched refund: id=%s, status=%s, transaction_id=%s",
 		refund.ID, refund.Status, refund.TransactionID)
 
-	// 2. Validate refund is in correct state (idempotent - skip if already processed)
+	// 3. Validate refund is in correct state (idempotent - skip if already processed)
 	if refund.Status != "pending" {
 		log.Printf("[Refund] Refund %s already processed (status=%s), skipping", refundID, refund.Status)
 		return nil // Not an error - refund was already processed
 	}
+	if refund.ProviderRefundID != "" {
+		log.Printf("[Refund] Refund %s already sent as %s, waiting for the provider to confirm it", refundID, refund.ProviderRefundID)
+		return nil
+	}
 
-	// 3. Call Stripe to create refund
-	result, err := w.provider.CreateRefund(ctx, RefundParams{
-		PaymentIntentID: paymentIntentID,
-		AmountCents:     amountCents,
-		Reason:          refund.Reason,
-	})
+	// The refund row is authoritative; job args may have been written by hand
+	if amountCents != refund.AmountCents {
+		log.Printf("[Refund] ⚠ Job amount %d cents differs from refund amount %d cents, using the refund's",
+			amountCents, refund.AmountCents)
+		amountCents = refund.AmountCents
+	}
+
+	// 3b. Re-check the running balance. initiate_payment_refund enforces it
+	// when the refund is created; this catches refunds that bypassed the RPC.
+	if err := refund.Balance.check(amountCents); err != nil {
+		log.Printf("[Refund] Rejecting refund %s: %v", refundID, err)
+		workerMetrics.RefundErrors.Inc(refundErrorBalance)
+		if err := updateRefundError(ctx, tx, refundID, err.Error()); err != nil {
+			return fmt.Errorf("database update error: %w", err)
+		}
+		return tx.Commit(ctx) // Retrying won't change the balance
+	}
+
+	// 4. Call the transaction's provider to create refund
+	provider, err := w.providers.Get(refund.Provider)
+	if err == nil && w.providers.dryRun.Skip(ctx, refund.Provider, "create_refund", paymentIntentID,
+		map[string]any{"refund_id": refundID, "amount_cents": amountCents, "currency": refund.Currency}) {
+		return river.JobCancel(errDryRun) // The refund stays pending
+	}
+	var result *RefundResult
+	if err == nil {
+		result, err = provider.CreateRefund(ctx, RefundParams{
+			RefundID:        refundID,
+			PaymentIntentID: paymentIntentID,
+			AmountCents:     amountCents,
+			Currency:        refund.Currency,
+			Reason:          refund.Reason,
+			// Refunds of routed payments come out of the connected account
+			ReverseTransfer:      refund.Routed,
+			RefundApplicationFee: refund.Routed && refund.FeeRefundable,
+		})
+	}
 	if err != nil {
-		log.Printf("[Refund] Error creating Stripe refund for %s: %v", refundID, err)
+		log.Printf("[Refund] Error creating %s refund for %s: %v", refund.Provider, refundID, err)
+		workerMetrics.RefundErrors.Inc(refundErrorProvider)
 
-		// Update refund with error (don't retry Stripe errors - they're typically permanent)
-		updateErr := w.updateRefundError(ctx, refundID, err.Error())
-		if updateErr != nil {
-			log.Printf("[Refund] Failed to update refund error: %v", updateErr)
+		// Update refund with error (don't retry provider errors - they're typically permanent)
+		if err := updateRefundError(ctx, tx, refundID, err.Error()); err != nil {
+			return fmt.Errorf("database update error: %w", err)
 		}
 
-		// Return nil to not retry - Stripe errors are usually permanent (invalid payment, etc.)
+		// Don't retry - provider errors are usually permanent (invalid payment, etc.)
 		// The refund is marked as failed and admin can investigate
-		return nil
+		return tx.Commit(ctx)
 	}
 
-	log.Printf("[Refund] ✓ Stripe Refund created: %s", result.RefundID)
+	status := refundStatus(result.Status)
+	log.Printf("[Refund] ✓ %s refund created: %s (status=%s)", provider.Name(), result.RefundID, result.Status)
+	if status == "failed" {
+		workerMetrics.RefundErrors.Inc(refundErrorProvider)
+	}
 
-	// 4. Update refund record with Stripe details
-	err = w.updateRefundSuccess(ctx, refundID, result)
-	if err != nil {
+	// 5. Update refund record with provider details
+	if err := updateRefundResult(ctx, tx, refundID, result, status); err != nil {
 		log.Printf("[Refund] Error updating refund %s: %v", refundID, err)
 		return fmt.Errorf("database update error: %w", err)
 	}
-
-	// 5. Enqueue notification job for user
-	err = w.enqueueNotification(ctx, refund.UserID, refund.TransactionID, refundID)
-	if err != nil {
-		// Log but don't fail - notification is secondary
-		log.Printf("[Refund] Warning: Failed to enqueue notification: %v", err)
+	if err := tx.Commit(ctx); err != nil {
+		// The provider refund exists; the retry gets it back through the
+		// idempotency key instead of refunding twice
+		return fmt.Errorf("commit refund %s: %w", refundID, err)
 	}
 
-	log.Printf("[Refund] ✓ Refund %s completed successfully", refundID)
+	// The payment_refunded email is sent by payments.notify_refund_succeeded()
+	// when the refund reaches succeeded. A pending refund (e.g. ACH) gets
+	// there through the provider's refund-updated webhook.
+
+	log.Printf("[Refund] ✓ Refund %s recorded as %s", refundID, status)
+	return nil
+}
+
+// refundBalance is a transaction's refund position in cents, excluding the
+// refund being processed
+type refundBalance struct {
+	MaxRefundableCents int64 // payments.transactions.max_refundable
+	RefundedCents      int64 // Succeeded refunds (refunded_amount_cents)
+	PendingCents       int64 // Other refunds not yet processed
+}
+
+// check returns an error if refunding amountCents would take succeeded and
+// pending refunds past the refundable amount
+func (b refundBalance) check(amountCents int64) error {
+	if amountCents <= 0 {
+		return fmt.Errorf("invalid refund amount: %d cents", amountCents)
+	}
+	committed := b.RefundedCents + b.PendingCents
+	if committed+amountCents > b.MaxRefundableCents {
+		return fmt.Errorf("refund of %d cents exceeds refundable balance: %d of %d cents already refunded or pending",
+			amountCents, committed, b.MaxRefundableCents)
+	}
 	return nil
 }
 
-// updateRefundSuccess updates the refund record with Stripe details
-func (w *RefundWorker) updateRefundSuccess(ctx context.Context, refundID string, result *RefundResult) error {
+// refundStatus maps a provider's refund status onto payments.refunds.status.
+// Refunds the provider hasn't finished (Stripe pending or requires_action,
+// Square and PayPal PENDING) stay pending until the refund-updated webhook.
+func refundStatus(providerStatus string) string {
+	switch providerStatus {
+	case "succeeded", "completed":
+		return "succeeded"
+	case "failed", "canceled", "cancelled", "rejected":
+		return "failed"
+	default:
+		return "pending"
+	}
+}
+
+// updateRefundResult records the provider's refund ID and status
+func updateRefundResult(ctx context.Context, tx pgx.Tx, refundID string, result *RefundResult, status string) error {
 	query := `
 		UPDATE payments.refunds
 		SET
 			provider_refund_id = $1,
-			status = 'succeeded',
-			error_message = NULL,
-			processed_at = NOW()
-		WHERE id = $2
+			status = $2,
+			error_message = CASE WHEN $2 = 'failed' THEN $3 END,
+			processed_at = CASE WHEN $2 = 'pending' THEN processed_at ELSE NOW() END
+		WHERE id = $4
 	`
 
-	_, err := w.dbPool.Exec(ctx, query, result.RefundID, refundID)
+	_, err := tx.Exec(ctx, query, result.RefundID, status, "Refund "+result.Status+" by provider", refundID)
 	return err
 }
 
 // updateRefundError updates the refund record with error details
-func (w *RefundWorker) updateRefundError(ctx context.Context, refundID string, errorMsg string) error {
+func updateRefundError(ctx context.Context, tx pgx.Tx, refundID string, errorMsg string) error {
 	query := `
 		UPDATE payments.refunds
 		SET
@@ -161,91 +287,10 @@ func (w *RefundWorker) updateRefundError(ctx context.Context, refundID string, e
 		WHERE id = $2
 	`
 
-	_, err := w.dbPool.Exec(ctx, query, errorMsg, refundID)
+	_, err := tx.Exec(ctx, query, errorMsg, refundID)
 	return err
 }
 
-// enqueueNotification enqueues a notification job for the refund
-func (w *RefundWorker) enqueueNotification(ctx context.Context, userID, transactionID, refundID string) error {
-	// Build entity data for the notification template
-	entityData := map[string]interface{}{
-		"transaction_id": transactionID,
-		"refund_id":      refundID,
-	}
-
-	// Fetch additional data for the notification
-	var amount, refundAmount float64
-	var description, reason string
-
-	query := `
-		SELECT
-			t.amount,
-			t.description,
-			r.amount AS refund_amount,
-			r.reason
-		FROM payments.transactions t
-		JOIN payments.refunds r ON r.transaction_id = t.id
-		WHERE r.id = $1
-	`
-
-	err := w.dbPool.QueryRow(ctx, query, refundID).Scan(
-		&amount, &description, &refundAmount, &reason,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to fetch notification data: %w", err)
-	}
-
-	entityData["amount"] = amount
-	entityData["description"] = description
-	entityData["refund_amount"] = refundAmount
-	entityData["reason"] = reason
-
-	// Build notification args
-	entityDataJSON, _ := json.Marshal(entityData)
-	notificationArgs := map[string]interface{}{
-		"user_id":       userID,
-		"template_name": "payment_refunded",
-		"entity_type":   "payments.transactions",
-		"entity_id":     transactionID,
-		"entity_data":   json.RawMessage(entityDataJSON),
-		"channels":      []string{"email"},
-	}
-
-	argsJSON, err := json.Marshal(notificationArgs)
-	if err != nil {
-		return fmt.Errorf("failed to marshal notification args: %w", err)
-	}
-
-	// Enqueue notification job
-	insertQuery := `
-		INSERT INTO metadata.river_job (
-			kind,
-			args,
-			priority,
-			queue,
-			max_attempts,
-			scheduled_at,
-			state
-		) VALUES (
-			'send_notification',
-			$1,
-			2,
-			'default',
-			3,
-			NOW(),
-			'available'
-		)
-	`
-
-	_, err = w.dbPool.Exec(ctx, insertQuery, argsJSON)
-	if err != nil {
-		return fmt.Errorf("failed to enqueue notification: %w", err)
-	}
-
-	log.Printf("[Refund] ✓ Notification job enqueued for user %s", userID)
-	return nil
-}
-
 // MarshalJSON implements custom JSON marshaling for logging
 func (a RefundWorkerArgs) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]interface{}{
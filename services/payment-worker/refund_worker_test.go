@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestRefundBalance_Check(t *testing.T) {
+	// $100.00 payment, $30.00 already refunded
+	balance := refundBalance{MaxRefundableCents: 10000, RefundedCents: 3000}
+
+	tests := []struct {
+		name        string
+		pending     int64
+		amountCents int64
+		wantErr     bool
+	}{
+		{"partial", 0, 2500, false},
+		{"exactly the remainder", 0, 7000, false},
+		{"one cent over", 0, 7001, true},
+		{"fits with other refunds pending", 4000, 3000, false},
+		{"pending refunds use up the balance", 4000, 3001, true},
+		{"zero", 0, 0, true},
+		{"negative", 0, -500, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := balance
+			b.PendingCents = tt.pending
+			err := b.check(tt.amountCents)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("check(%d) with %d pending: error = %v, wantErr %v", tt.amountCents, tt.pending, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefundStatus(t *testing.T) {
+	tests := map[string]string{
+		"succeeded":       "succeeded", // Stripe
+		"completed":       "succeeded", // Square, PayPal (lowercased)
+		"pending":         "pending",   // ACH refunds settle later
+		"requires_action": "pending",
+		"":                "pending",
+		"failed":          "failed",
+		"canceled":        "failed",
+		"cancelled":       "failed",
+		"rejected":        "failed",
+	}
+	for providerStatus, want := range tests {
+		if got := refundStatus(providerStatus); got != want {
+			t.Errorf("refundStatus(%q) = %q, want %q", providerStatus, got, want)
+		}
+	}
+}
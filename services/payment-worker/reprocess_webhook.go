@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// ============================================================================
+// Webhook Reprocessing
+//
+// A webhook whose handler failed keeps its metadata.webhooks row with
+// processed = FALSE and the reason in error_message. Once the cause is fixed
+// (a bug, a missing transaction row), the reprocess_webhook job runs the
+// stored payload through the handler again. The signature was checked when
+// the webhook arrived, so the payload is only parsed.
+//
+// Enqueue it with SQL:
+//
+//	INSERT INTO metadata.river_job (kind, args, queue, max_attempts, state)
+//	VALUES ('reprocess_webhook', '{"webhook_id": "<metadata.webhooks.id>"}', 'default', 3, 'available');
+//
+// or through the webhook server's admin endpoint (WEBHOOK_ADMIN_TOKEN):
+//
+//	POST /admin/webhooks/{id}/reprocess[?force=true]
+// ============================================================================
+
+var (
+	errWebhookNotFound         = errors.New("webhook not found")
+	errWebhookAlreadyProcessed = errors.New("webhook already processed")
+)
+
+// webhookIDPattern matches a metadata.webhooks.id (UUID)
+var webhookIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ReprocessWebhookArgs are the args of the reprocess_webhook job
+type ReprocessWebhookArgs struct {
+	WebhookID string `json:"webhook_id"`
+	// Force re-runs a webhook that was already processed. Handlers are
+	// written for provider redelivery, but check what the event does first.
+	Force bool `json:"force,omitempty"`
+}
+
+// Kind returns the job kind identifier for River
+func (ReprocessWebhookArgs) Kind() string {
+	return "reprocess_webhook"
+}
+
+// InsertOpts allows one queued or running job per webhook. The consolidated
+// worker's inbound Stripe endpoint queues the same job; keep its copy of
+// these options (inbound_webhook_sources.go) in step.
+func (ReprocessWebhookArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Queue:       river.QueueDefault,
+		MaxAttempts: 3,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs: true,
+			// Not completed: a fixed webhook can be reprocessed again
+			ByState: []rivertype.JobState{
+				rivertype.JobStateAvailable,
+				rivertype.JobStatePending,
+				rivertype.JobStateRetryable,
+				rivertype.JobStateRunning,
+				rivertype.JobStateScheduled,
+			},
+		},
+	}
+}
+
+// ReprocessWebhookWorker re-runs stored webhooks through WebhookHandler
+type ReprocessWebhookWorker struct {
+	river.WorkerDefaults[ReprocessWebhookArgs]
+	handler   *WebhookHandler
+	providers *ProviderRegistry
+}
+
+// NewReprocessWebhookWorker creates a new ReprocessWebhookWorker
+func NewReprocessWebhookWorker(handler *WebhookHandler, providers *ProviderRegistry) *ReprocessWebhookWorker {
+	return &ReprocessWebhookWorker{
+		handler:   handler,
+		providers: providers,
+	}
+}
+
+// Work reprocesses one webhook. A failed run leaves the new error on the row.
+func (w *ReprocessWebhookWorker) Work(ctx context.Context, job *river.Job[ReprocessWebhookArgs]) error {
+	err := w.handler.ReprocessWebhook(ctx, w.providers, job.Args.WebhookID, job.Args.Force)
+	switch {
+	case errors.Is(err, errWebhookNotFound), errors.Is(err, errWebhookAlreadyProcessed):
+		// Nothing to retry
+		log.Printf("[Reprocess] Skipping webhook %s: %v", job.Args.WebhookID, err)
+		return nil
+	case err != nil:
+		return fmt.Errorf("reprocess webhook %s: %w", job.Args.WebhookID, err)
+	}
+	return nil
+}
+
+// ReprocessWebhook runs a stored webhook through its handler again. Unless
+// force is set, webhooks that were already processed are left alone.
+func (h *WebhookHandler) ReprocessWebhook(ctx context.Context, providers *ProviderRegistry, webhookID string, force bool) error {
+	if !webhookIDPattern.MatchString(webhookID) {
+		return errWebhookNotFound
+	}
+
+	tx, err := h.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // Auto-rollback if not committed
+
+	// Lock the row so a provider retry of the same event waits for us
+	var providerName string
+	var payload []byte
+	var processed bool
+	err = tx.QueryRow(ctx, `
+		SELECT provider, payload, processed
+		FROM metadata.webhooks
+		WHERE id = $1
+		FOR UPDATE
+	`, webhookID).Scan(&providerName, &payload, &processed)
+	if err == pgx.ErrNoRows {
+		return errWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("load webhook: %w", err)
+	}
+	if processed && !force {
+		return errWebhookAlreadyProcessed
+	}
+
+	provider, err := providers.Get(providerName)
+	if err != nil {
+		return err
+	}
+	event, err := provider.ParseWebhook(payload)
+	if err != nil {
+		return fmt.Errorf("parse stored payload: %w", err)
+	}
+
+	log.Printf("[Reprocess] Reprocessing webhook %s: provider=%s, id=%s, type=%s",
+		webhookID, event.Provider, event.EventID, event.EventType)
+	return h.process(ctx, tx, webhookID, provider, event)
+}
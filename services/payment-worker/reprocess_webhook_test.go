@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+const testWebhookID = "0b5e7a3c-2f1d-4c8e-9a6b-1d2e3f4a5b6c"
+
+// Stored payloads are re-read from JSONB, so key order and whitespace differ
+// from the original request; parsing must not depend on either
+func TestProviders_ParseWebhook(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    PaymentProvider
+		payload     string
+		wantID      string
+		wantKind    WebhookEventKind
+		wantPayment string
+	}{
+		{
+			name:        "stripe",
+			provider:    &StripeProvider{},
+			payload:     `{"data": {"object": {"id": "pi_1", "object": "payment_intent", "status": "succeeded"}}, "id": "evt_1", "object": "event", "type": "payment_intent.succeeded"}`,
+			wantID:      "evt_1",
+			wantKind:    WebhookPaymentSucceeded,
+			wantPayment: "pi_1",
+		},
+		{
+			name:        "square",
+			provider:    &SquareProvider{},
+			payload:     `{"data": {"object": {"payment": {"status": "FAILED", "order_id": "ORDER1"}}}, "type": "payment.updated", "event_id": "sq_1"}`,
+			wantID:      "sq_1",
+			wantKind:    WebhookPaymentFailed,
+			wantPayment: "ORDER1",
+		},
+		{
+			name:        "paypal",
+			provider:    &PayPalProvider{},
+			payload:     `{"resource": {"id": "ORDER2"}, "event_type": "CHECKOUT.ORDER.APPROVED", "id": "WH-1"}`,
+			wantID:      "WH-1",
+			wantKind:    WebhookPaymentApproved,
+			wantPayment: "ORDER2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := tt.provider.ParseWebhook([]byte(tt.payload))
+			if err != nil {
+				t.Fatalf("ParseWebhook() error = %v", err)
+			}
+			if event.EventID != tt.wantID || event.Kind != tt.wantKind || event.ProviderPaymentID != tt.wantPayment {
+				t.Errorf("event = {id:%q kind:%q payment:%q}, want {id:%q kind:%q payment:%q}",
+					event.EventID, event.Kind, event.ProviderPaymentID, tt.wantID, tt.wantKind, tt.wantPayment)
+			}
+			if event.Provider != tt.provider.Name() {
+				t.Errorf("Provider = %q, want %q", event.Provider, tt.provider.Name())
+			}
+		})
+	}
+}
+
+func TestReprocessWebhook_InvalidIDSkipped(t *testing.T) {
+	// No database needed: malformed IDs never reach a query
+	handler := NewWebhookHandler(nil)
+	err := handler.ReprocessWebhook(context.Background(), NewProviderRegistry(), "not-a-uuid", false)
+	if !errors.Is(err, errWebhookNotFound) {
+		t.Errorf("ReprocessWebhook() error = %v, want errWebhookNotFound", err)
+	}
+
+	worker := NewReprocessWebhookWorker(handler, NewProviderRegistry())
+	job := &river.Job[ReprocessWebhookArgs]{Args: ReprocessWebhookArgs{WebhookID: "not-a-uuid"}}
+	if err := worker.Work(context.Background(), job); err != nil {
+		t.Errorf("Work() error = %v, want nil (nothing to retry)", err)
+	}
+}
+
+type reprocessInserter struct {
+	args []ReprocessWebhookArgs
+}
+
+func (f *reprocessInserter) Insert(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error) {
+	f.args = append(f.args, args.(ReprocessWebhookArgs))
+	return &rivertype.JobInsertResult{Job: &rivertype.JobRow{ID: int64(len(f.args))}}, nil
+}
+
+func TestHandleReprocess(t *testing.T) {
+	inserter := &reprocessInserter{}
+	server := NewWebhookHTTPServer(NewWebhookHandler(nil), NewProviderRegistry(), inserter, nil, nil, "admin-token", "", "0")
+
+	send := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("/admin/webhooks/"+testWebhookID+"/reprocess", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token: status = %d, want 401", rec.Code)
+	}
+	if rec := send("/admin/webhooks/"+testWebhookID+"/reprocess", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status = %d, want 401", rec.Code)
+	}
+	if rec := send("/admin/webhooks/nope/reprocess", "admin-token"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad ID: status = %d, want 400", rec.Code)
+	}
+	if len(inserter.args) != 0 {
+		t.Fatalf("rejected requests enqueued %d jobs", len(inserter.args))
+	}
+
+	rec := send("/admin/webhooks/"+testWebhookID+"/reprocess?force=true", "admin-token")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", rec.Code)
+	}
+	var body struct {
+		Queued bool  `json:"queued"`
+		JobID  int64 `json:"job_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || !body.Queued || body.JobID != 1 {
+		t.Errorf("response = %+v (err %v), want queued job 1", body, err)
+	}
+	if len(inserter.args) != 1 || inserter.args[0] != (ReprocessWebhookArgs{WebhookID: testWebhookID, Force: true}) {
+		t.Errorf("enqueued %+v, want forced reprocess of %s", inserter.args, testWebhookID)
+	}
+}
+
+func TestHandleReprocess_DisabledWithoutToken(t *testing.T) {
+	server := NewWebhookHTTPServer(NewWebhookHandler(nil), NewProviderRegistry(), &reprocessInserter{}, nil, nil, "", "", "0")
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/webhooks/"+testWebhookID+"/reprocess", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 when WEBHOOK_ADMIN_TOKEN is unset", rec.Code)
+	}
+}
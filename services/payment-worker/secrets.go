@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Secrets providers: SECRETS_PROVIDER loads credentials (STRIPE_API_KEY,
+// SQUARE_ACCESS_TOKEN, ...) from HashiCorp Vault, AWS Secrets Manager or
+// mounted secret files instead of the environment. The variables and
+// behaviour match the consolidated worker's secrets.go: values override the
+// environment at startup and are re-fetched every SECRETS_REFRESH_SECONDS,
+// with rotated provider credentials swapped in without a restart.
+//
+// AWS credentials come from the SDK's default chain (environment, shared
+// config, or a task or instance role).
+
+const (
+	defaultSecretsRefreshInterval = 5 * time.Minute
+	secretsFetchTimeout           = 30 * time.Second
+)
+
+// SecretProvider fetches the current secret values, keyed by environment
+// variable name
+type SecretProvider interface {
+	Name() string
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// newSecretProviderFromEnv builds the provider selected by SECRETS_PROVIDER,
+// or returns nil when secrets come from the environment only
+func newSecretProviderFromEnv(ctx context.Context) (SecretProvider, error) {
+	switch name := strings.ToLower(getEnv("SECRETS_PROVIDER", "")); name {
+	case "", "env":
+		return nil, nil
+	case "vault":
+		addr, path := getEnv("VAULT_ADDR", ""), getEnv("VAULT_SECRET_PATH", "")
+		token, tokenFile := getEnv("VAULT_TOKEN", ""), getEnv("VAULT_TOKEN_FILE", "")
+		if addr == "" || path == "" {
+			return nil, fmt.Errorf("SECRETS_PROVIDER=vault requires VAULT_ADDR and VAULT_SECRET_PATH")
+		}
+		if token == "" && tokenFile == "" {
+			return nil, fmt.Errorf("SECRETS_PROVIDER=vault requires VAULT_TOKEN or VAULT_TOKEN_FILE")
+		}
+		return &vaultSecretProvider{
+			addr:       strings.TrimRight(addr, "/"),
+			path:       strings.Trim(path, "/"),
+			token:      token,
+			tokenFile:  tokenFile,
+			namespace:  getEnv("VAULT_NAMESPACE", ""),
+			httpClient: &http.Client{Timeout: secretsFetchTimeout},
+		}, nil
+	case "aws":
+		return newAWSSecretsManagerProvider(ctx,
+			getEnv("AWS_SECRETS_MANAGER_SECRET_ID", ""),
+			getEnv("AWS_SECRETS_MANAGER_REGION", getEnv("AWS_REGION", "us-east-1")),
+			getEnv("AWS_SECRETS_MANAGER_ENDPOINT", ""),
+		)
+	case "file":
+		path := getEnv("SECRETS_FILE", "")
+		if path == "" {
+			return nil, fmt.Errorf("SECRETS_PROVIDER=file requires SECRETS_FILE")
+		}
+		return &fileSecretProvider{path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q (expected vault, aws or file)", name)
+	}
+}
+
+// vaultSecretProvider reads one KV secret (v1, or v2 with /data/ in the path)
+type vaultSecretProvider struct {
+	addr       string
+	path       string
+	token      string
+	tokenFile  string // re-read on every fetch, so a Vault Agent can renew it
+	namespace  string
+	httpClient *http.Client
+}
+
+func (p *vaultSecretProvider) Name() string {
+	return "vault:" + p.path
+}
+
+func (p *vaultSecretProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	token := p.token
+	if p.tokenFile != "" {
+		data, err := os.ReadFile(p.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read VAULT_TOKEN_FILE: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.addr+"/v1/"+p.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	body, err := doSecretsRequest(p.httpClient, req, "vault")
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse vault response: %w", err)
+	}
+	// KV v2 nests the secret under data.data, next to data.metadata
+	if nested, ok := result.Data["data"]; ok {
+		if _, hasMetadata := result.Data["metadata"]; hasMetadata {
+			return parseSecretObject(nested)
+		}
+	}
+	raw, err := json.Marshal(result.Data)
+	if err != nil {
+		return nil, err
+	}
+	return parseSecretObject(raw)
+}
+
+// secretsManagerAPI is the subset of *secretsmanager.Client the provider uses
+type secretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// awsSecretsManagerProvider calls GetSecretValue; the secret string must be
+// a JSON object
+type awsSecretsManagerProvider struct {
+	secretID string
+	client   secretsManagerAPI
+}
+
+// newAWSSecretsManagerProvider loads the default AWS configuration for
+// region. An empty endpoint uses the regional Secrets Manager endpoint.
+func newAWSSecretsManagerProvider(ctx context.Context, secretID, region, endpoint string) (*awsSecretsManagerProvider, error) {
+	if secretID == "" {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=aws requires AWS_SECRETS_MANAGER_SECRET_ID")
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("load AWS configuration: %w", err)
+	}
+	client := secretsmanager.NewFromConfig(awsCfg, func(o *secretsmanager.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.HTTPClient = &http.Client{Timeout: secretsFetchTimeout}
+	})
+	return &awsSecretsManagerProvider{secretID: secretID, client: client}, nil
+}
+
+func (p *awsSecretsManagerProvider) Name() string {
+	return "aws:" + p.secretID
+}
+
+func (p *awsSecretsManagerProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(p.secretID)})
+	if err != nil {
+		return nil, fmt.Errorf("secrets manager request failed: %w", err)
+	}
+	if out.SecretString == nil {
+		return nil, fmt.Errorf("secret %s has no SecretString (binary secrets are not supported)", p.secretID)
+	}
+	return parseSecretObject([]byte(*out.SecretString))
+}
+
+// fileSecretProvider reads SECRETS_FILE on every fetch: a directory with one
+// file per key (Docker and Kubernetes secrets), a .json object, or KEY=VALUE
+// lines. SOPS files must be decrypted into the mount before the worker
+// reads them.
+type fileSecretProvider struct {
+	path string
+}
+
+func (p *fileSecretProvider) Name() string {
+	return "file:" + p.path
+}
+
+func (p *fileSecretProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(p.path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(filepath.Ext(p.path), ".json") {
+			return parseSecretObject(data)
+		}
+		return parseEnvSecrets(data)
+	}
+
+	entries, err := os.ReadDir(p.path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, entry := range entries {
+		// Kubernetes mounts keep their data in ..data and timestamped dirs
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		filePath := filepath.Join(p.path, entry.Name())
+		info, err := os.Stat(filePath) // follows the Kubernetes symlinks
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		values[entry.Name()] = strings.TrimRight(string(data), "\r\n")
+	}
+	return values, nil
+}
+
+// parseEnvSecrets parses KEY=VALUE lines, skipping blank lines, # comments
+// and an "export " prefix, and removing matching surrounding quotes
+func parseEnvSecrets(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// parseSecretObject decodes a JSON object of variable names to values.
+// Numbers and booleans are kept as written; nested values are rejected.
+func parseSecretObject(data []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			values[key] = s
+			continue
+		}
+		trimmed := bytes.TrimSpace(value)
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return nil, fmt.Errorf("secret %s must be a string, not an object or array", key)
+		}
+		values[key] = string(trimmed)
+	}
+	return values, nil
+}
+
+// doSecretsRequest sends req and returns the body of a 200 response
+func doSecretsRequest(client *http.Client, req *http.Request, service string) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", service, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("read %s response: %w", service, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d: %s", service, resp.StatusCode, truncateSecretsError(body))
+	}
+	return body, nil
+}
+
+// truncateSecretsError keeps error bodies short in logs
+func truncateSecretsError(body []byte) string {
+	const limit = 200
+	if len(body) > limit {
+		return string(body[:limit]) + "..."
+	}
+	return string(body)
+}
+
+// secretRotation is a swap and the keys that trigger it
+type secretRotation struct {
+	keys []string
+	swap func()
+}
+
+// SecretStore applies a provider's values to the environment and hands
+// rotated credentials to the payment providers
+type SecretStore struct {
+	provider SecretProvider
+	interval time.Duration
+
+	mu        sync.Mutex
+	values    map[string]string
+	rotations []secretRotation
+}
+
+// NewSecretStore creates a store refreshing provider every interval
+func NewSecretStore(provider SecretProvider, interval time.Duration) *SecretStore {
+	if interval <= 0 {
+		interval = defaultSecretsRefreshInterval
+	}
+	return &SecretStore{provider: provider, interval: interval, values: map[string]string{}}
+}
+
+// OnRotate registers swap to run once when any of keys changes
+func (s *SecretStore) OnRotate(swap func(), keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotations = append(s.rotations, secretRotation{keys: keys, swap: swap})
+}
+
+// Load fetches the secrets and copies changed values into the environment,
+// returning their keys sorted
+func (s *SecretStore) Load(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, secretsFetchTimeout)
+	defer cancel()
+	values, err := s.provider.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changed []string
+	for key, value := range values {
+		if previous, ok := s.values[key]; ok && previous == value {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return nil, fmt.Errorf("set %s: %w", key, err)
+		}
+		s.values[key] = value
+		changed = append(changed, key)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// Refresh re-fetches the secrets and runs the swaps for rotated keys,
+// keeping the current credentials on error
+func (s *SecretStore) Refresh(ctx context.Context) {
+	changed, err := s.Load(ctx)
+	if err != nil {
+		log.Printf("[Secrets] Failed to refresh from %s, keeping current credentials: %v", s.provider.Name(), err)
+		return
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	var swaps []func()
+	covered := make(map[string]bool)
+	for _, rotation := range s.rotations {
+		triggered := false
+		for _, key := range rotation.keys {
+			covered[key] = true
+			triggered = triggered || slices.Contains(changed, key)
+		}
+		if triggered {
+			swaps = append(swaps, rotation.swap)
+		}
+	}
+	s.mu.Unlock()
+
+	var restart []string
+	for _, key := range changed {
+		if !covered[key] {
+			restart = append(restart, key)
+		}
+	}
+	for _, swap := range swaps {
+		swap()
+	}
+	if applied := len(changed) - len(restart); applied > 0 {
+		log.Printf("[Secrets] ✓ Rotated %d credential(s) from %s", applied, s.provider.Name())
+	}
+	if len(restart) > 0 {
+		log.Printf("[Secrets] ⚠ Changed but only applied on restart: %s", strings.Join(restart, ", "))
+	}
+}
+
+// Run refreshes the secrets every interval until ctx is cancelled
+func (s *SecretStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh(ctx)
+		}
+	}
+}
+
+// registerCredentialRotations swaps rotated provider credentials into the
+// enabled providers. DATABASE_URL and the webhook admin and metrics tokens
+// still need a restart.
+func registerCredentialRotations(store *SecretStore, providers *ProviderRegistry) {
+	for _, name := range providers.Names() {
+		provider, _ := providers.Get(name)
+		switch p := provider.(type) {
+		case *StripeProvider:
+			store.OnRotate(func() {
+				p.SetCredentials(getEnv("STRIPE_API_KEY", ""), getEnv("STRIPE_WEBHOOK_SECRET", ""), getEnv("STRIPE_CONNECT_WEBHOOK_SECRET", ""))
+			}, "STRIPE_API_KEY", "STRIPE_WEBHOOK_SECRET", "STRIPE_CONNECT_WEBHOOK_SECRET")
+		case *SquareProvider:
+			store.OnRotate(func() {
+				p.SetCredentials(getEnv("SQUARE_ACCESS_TOKEN", ""), getEnv("SQUARE_WEBHOOK_SIGNATURE_KEY", ""))
+			}, "SQUARE_ACCESS_TOKEN", "SQUARE_WEBHOOK_SIGNATURE_KEY")
+		case *PayPalProvider:
+			store.OnRotate(func() {
+				p.SetCredentials(getEnv("PAYPAL_CLIENT_ID", ""), getEnv("PAYPAL_CLIENT_SECRET", ""))
+			}, "PAYPAL_CLIENT_ID", "PAYPAL_CLIENT_SECRET")
+		}
+	}
+}
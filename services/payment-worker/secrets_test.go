@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeSecretProvider struct {
+	values map[string]string
+}
+
+func (p *fakeSecretProvider) Name() string { return "fake" }
+
+func (p *fakeSecretProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	return p.values, nil
+}
+
+func TestAWSSecretsManagerProvider_Fetch(t *testing.T) {
+	// Credentials from the environment, the first link of the default chain
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.Contains(r.Header.Get("Authorization"), "Credential=AKIDTEST/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write([]byte(`{"SecretString":"{\"STRIPE_API_KEY\":\"sk_test_new\"}"}`))
+	}))
+	defer server.Close()
+
+	provider, err := newAWSSecretsManagerProvider(context.Background(), "civic-os/payments", "us-east-1", server.URL)
+	if err != nil {
+		t.Fatalf("newAWSSecretsManagerProvider: %v", err)
+	}
+	got, err := provider.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if want := map[string]string{"STRIPE_API_KEY": "sk_test_new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch = %v, want %v", got, want)
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "STRIPE_API_KEY"), []byte("sk_test_file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := (&fileSecretProvider{path: dir}).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch dir: %v", err)
+	}
+	if want := map[string]string{"STRIPE_API_KEY": "sk_test_file"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch dir = %v, want %v", got, want)
+	}
+
+	envPath := filepath.Join(dir, "..payments.env")
+	if err := os.WriteFile(envPath, []byte("# rotated\nexport SQUARE_ACCESS_TOKEN=\"sq0\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = (&fileSecretProvider{path: envPath}).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch env: %v", err)
+	}
+	if want := map[string]string{"SQUARE_ACCESS_TOKEN": "sq0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch env = %v, want %v", got, want)
+	}
+}
+
+func TestVaultSecretProvider_KVv2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/payments" || r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"PAYPAL_CLIENT_SECRET":"pp"},"metadata":{"version":1}}}`))
+	}))
+	defer server.Close()
+
+	provider := &vaultSecretProvider{addr: server.URL, path: "secret/data/payments", token: "s.token", httpClient: server.Client()}
+	got, err := provider.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if want := map[string]string{"PAYPAL_CLIENT_SECRET": "pp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fetch = %v, want %v", got, want)
+	}
+}
+
+func TestSecretStore_RotatesSquareCredentials(t *testing.T) {
+	t.Setenv("SQUARE_ACCESS_TOKEN", "")
+	t.Setenv("SQUARE_WEBHOOK_SIGNATURE_KEY", "")
+	provider := &fakeSecretProvider{values: map[string]string{"SQUARE_ACCESS_TOKEN": "old", "SQUARE_WEBHOOK_SIGNATURE_KEY": "key"}}
+	store := NewSecretStore(provider, 0)
+	if _, err := store.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	square := &SquareProvider{accessToken: "old", signatureKey: "key"}
+	registerCredentialRotations(store, NewProviderRegistry(square))
+
+	provider.values = map[string]string{"SQUARE_ACCESS_TOKEN": "new", "SQUARE_WEBHOOK_SIGNATURE_KEY": "key"}
+	store.Refresh(context.Background())
+	if square.accessToken != "new" || square.signatureKey != "key" {
+		t.Errorf("square credentials = %s/%s, want new/key", square.accessToken, square.signatureKey)
+	}
+}
+
+func TestPayPalSetCredentials_DropsToken(t *testing.T) {
+	p := &PayPalProvider{clientID: "id", clientSecret: "old", accessToken: "cached"}
+	p.SetCredentials("", "new")
+	if p.clientID != "id" || p.clientSecret != "new" || p.accessToken != "" {
+		t.Errorf("after SetCredentials: id=%s secret=%s token=%q", p.clientID, p.clientSecret, p.accessToken)
+	}
+}
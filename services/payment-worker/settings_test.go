@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSettingsValidation(t *testing.T) {
+	saved := settings
+	settings = newSettingsRegistry()
+	t.Cleanup(func() { settings = saved })
+
+	t.Setenv("PROCESSING_FEE_PERCENT", "2,9")
+	t.Setenv("PROCESSING_FEE_FLAT_CENTS", "30")
+	t.Setenv("WEBHOOK_PORT", "0")
+	t.Setenv("SQUARE_WEBHOOK_URL", "/webhooks/square")
+
+	if got := getEnvFloat("PROCESSING_FEE_PERCENT", 0); got != 0 {
+		t.Errorf("getEnvFloat = %v, want the default", got)
+	}
+	if got := getEnvInt("PROCESSING_FEE_FLAT_CENTS", 0); got != 30 {
+		t.Errorf("getEnvInt = %d, want 30", got)
+	}
+	if got := getEnvPort("WEBHOOK_PORT", "8080"); got != "8080" {
+		t.Errorf("getEnvPort = %q, want the default", got)
+	}
+	getEnvURL("SQUARE_WEBHOOK_URL", "")
+	requireEnv("PAYPAL_CLIENT_SECRET", "PAYPAL_CLIENT_ID is set")
+
+	err := validateSettings()
+	if err == nil {
+		t.Fatal("validateSettings() = nil, want every problem reported")
+	}
+	for _, want := range []string{"PROCESSING_FEE_PERCENT", "WEBHOOK_PORT", "SQUARE_WEBHOOK_URL", "PAYPAL_CLIENT_SECRET is required when PAYPAL_CLIENT_ID is set"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "PROCESSING_FEE_FLAT_CENTS") {
+		t.Errorf("valid setting reported:\n%v", err)
+	}
+}
+
+func TestMaskSettingValue(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+	}{
+		{"STRIPE_API_KEY", "sk_live_abc", "****"},
+		{"STRIPE_WEBHOOK_SECRET", "whsec_abc", "****"},
+		{"SQUARE_ACCESS_TOKEN", "EAAA", "****"},
+		{"SQUARE_WEBHOOK_SIGNATURE_KEY", "sig", "****"},
+		{"PAYPAL_CLIENT_ID", "client", "client"},
+		{"DATABASE_URL", "postgres://payment_worker:pw@db/civic_os", "postgres://payment_worker:****@db/civic_os"},
+		{"DATABASE_URL", "host=db password=pw", "[unparsed, hidden]"},
+	}
+	for _, tt := range tests {
+		if got := maskSettingValue(tt.key, tt.value); got != tt.want {
+			t.Errorf("maskSettingValue(%s, %q) = %q, want %q", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
+
+// settings.go is copied between the two workers (see its header); the copies
+// must not drift apart
+func TestSettingsFileMatchesOtherService(t *testing.T) {
+	other, err := os.ReadFile("../consolidated-worker-go/settings.go")
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skip("the consolidated worker isn't checked out next to this one")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := os.ReadFile("settings.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settingsFileBody(own) != settingsFileBody(other) {
+		t.Error("settings.go differs from ../consolidated-worker-go/settings.go; make the same change to both copies")
+	}
+}
+
+// settingsFileBody is a settings.go from its package clause on; the license
+// header differs between the services
+func settingsFileBody(src []byte) string {
+	s := string(src)
+	return s[strings.Index(s, "package main"):]
+}
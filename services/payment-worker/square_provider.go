@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	squareProductionURL = "https://connect.squareup.com"
+	squareSandboxURL    = "https://connect.squareupsandbox.com"
+
+	// squareAPIVersion pins the request/response shapes this provider parses
+	squareAPIVersion = "2024-10-17"
+)
+
+// SquareProvider implements PaymentProvider for Square
+//
+// Square has no client-secret flow like Stripe Elements, so CreateIntent
+// creates a quick-pay payment link. The link's order ID is stored as
+// provider_payment_id and the checkout URL is returned in place of the
+// client secret.
+type SquareProvider struct {
+	accessToken  string
+	locationID   string
+	signatureKey string
+	webhookURL   string // Notification URL registered in Square; part of the signed payload
+	baseURL      string
+	httpClient   *http.Client
+
+	// Guards accessToken and signatureKey, which SetCredentials swaps on rotation
+	credentialsMu sync.RWMutex
+}
+
+// NewSquareProvider creates a new Square payment provider
+func NewSquareProvider(accessToken, locationID, signatureKey, webhookURL, environment string) *SquareProvider {
+	if accessToken == "" || locationID == "" {
+		log.Fatal("[Square] SQUARE_ACCESS_TOKEN and SQUARE_LOCATION_ID are required")
+	}
+	if signatureKey == "" || webhookURL == "" {
+		log.Fatal("[Square] SQUARE_WEBHOOK_SIGNATURE_KEY and SQUARE_WEBHOOK_URL are required")
+	}
+
+	baseURL := squareSandboxURL
+	if environment == "production" {
+		baseURL = squareProductionURL
+	}
+
+	log.Printf("[Square] Provider initialized (environment: %s, location: %s, token: %s)",
+		environment, locationID, maskAPIKey(accessToken))
+
+	return &SquareProvider{
+		accessToken:  accessToken,
+		locationID:   locationID,
+		signatureKey: signatureKey,
+		webhookURL:   webhookURL,
+		baseURL:      baseURL,
+		httpClient:   &http.Client{Timeout: 30 * time.Second, Transport: newTracingTransport(nil, "square")},
+	}
+}
+
+// SetCredentials swaps in a rotated access token and webhook signature key
+// (see secrets.go). Empty values keep the current ones.
+func (s *SquareProvider) SetCredentials(accessToken, signatureKey string) {
+	s.credentialsMu.Lock()
+	defer s.credentialsMu.Unlock()
+	if accessToken != "" {
+		s.accessToken = accessToken
+	}
+	if signatureKey != "" {
+		s.signatureKey = signatureKey
+	}
+}
+
+// Name returns the provider key for Square transactions
+func (s *SquareProvider) Name() string {
+	return "square"
+}
+
+type squareMoney struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// CreateIntent creates a Square quick-pay payment link
+func (s *SquareProvider) CreateIntent(ctx context.Context, params CreateIntentParams) (*PaymentIntentResult, error) {
+	log.Printf("[Square] Creating payment link: amount=%d %s, description=%q",
+		params.Amount, params.Currency, params.Description)
+
+	if params.Amount <= 0 {
+		return nil, fmt.Errorf("invalid amount: %d (must be > 0)", params.Amount)
+	}
+	if params.PaymentMethod == PaymentMethodUSBankAccount {
+		return nil, fmt.Errorf("%s does not support %s payments", s.Name(), params.PaymentMethod)
+	}
+	if params.CaptureMethod == CaptureMethodManual {
+		return nil, fmt.Errorf("%s does not support manual capture", s.Name())
+	}
+	if params.DestinationAccount != "" {
+		return nil, fmt.Errorf("%s does not support payout routing to connected accounts", s.Name())
+	}
+	if params.Currency == "" {
+		params.Currency = "usd"
+	}
+
+	// quick_pay.name is required and shown on the checkout page
+	name := params.Description
+	if name == "" {
+		name = "Payment"
+	}
+
+	body := map[string]interface{}{
+		"idempotency_key": params.PaymentID,
+		"description":     params.Description,
+		"quick_pay": map[string]interface{}{
+			"name":        name,
+			"location_id": s.locationID,
+			"price_money": squareMoney{Amount: params.Amount, Currency: strings.ToUpper(params.Currency)},
+		},
+	}
+
+	var resp struct {
+		PaymentLink struct {
+			ID      string `json:"id"`
+			URL     string `json:"url"`
+			OrderID string `json:"order_id"`
+		} `json:"payment_link"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/v2/online-checkout/payment-links", body, &resp); err != nil {
+		log.Printf("[Square] Error creating payment link: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[Square] ✓ Payment link created: id=%s, order_id=%s", resp.PaymentLink.ID, resp.PaymentLink.OrderID)
+
+	return &PaymentIntentResult{
+		PaymentIntentID: resp.PaymentLink.OrderID,
+		ClientSecret:    resp.PaymentLink.URL,
+		Status:          "pending",
+	}, nil
+}
+
+// CreateRefund refunds the payment attached to a Square order
+func (s *SquareProvider) CreateRefund(ctx context.Context, params RefundParams) (*RefundResult, error) {
+	log.Printf("[Square] Creating Refund: order=%s, amount=%d cents",
+		params.PaymentIntentID, params.AmountCents)
+
+	if params.PaymentIntentID == "" {
+		return nil, fmt.Errorf("payment_intent_id is required")
+	}
+	if params.AmountCents <= 0 {
+		return nil, fmt.Errorf("invalid amount: %d (must be > 0)", params.AmountCents)
+	}
+	if params.Currency == "" {
+		params.Currency = "usd"
+	}
+
+	// Refunds are issued against the payment, not the order we stored
+	paymentID, err := s.orderPaymentID(ctx, params.PaymentIntentID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"idempotency_key": params.RefundID,
+		"payment_id":      paymentID,
+		"amount_money":    squareMoney{Amount: params.AmountCents, Currency: strings.ToUpper(params.Currency)},
+		"reason":          params.Reason,
+	}
+
+	var resp struct {
+		Refund struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"refund"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/v2/refunds", body, &resp); err != nil {
+		log.Printf("[Square] Error creating Refund: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[Square] ✓ Refund created: id=%s, status=%s", resp.Refund.ID, resp.Refund.Status)
+
+	return &RefundResult{
+		RefundID: resp.Refund.ID,
+		Status:   strings.ToLower(resp.Refund.Status),
+	}, nil
+}
+
+// orderPaymentID returns the payment ID of the tender that paid an order
+func (s *SquareProvider) orderPaymentID(ctx context.Context, orderID string) (string, error) {
+	var resp struct {
+		Order struct {
+			Tenders []struct {
+				ID        string `json:"id"`
+				PaymentID string `json:"payment_id"`
+			} `json:"tenders"`
+		} `json:"order"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/v2/orders/"+orderID, nil, &resp); err != nil {
+		return "", fmt.Errorf("fetch order: %w", err)
+	}
+	if len(resp.Order.Tenders) == 0 {
+		return "", fmt.Errorf("order %s has no payment to refund", orderID)
+	}
+
+	tender := resp.Order.Tenders[0]
+	if tender.PaymentID != "" {
+		return tender.PaymentID, nil
+	}
+	return tender.ID, nil
+}
+
+// VerifyWebhook checks x-square-hmacsha256-signature and maps the event
+//
+// Square signs the notification URL concatenated with the raw body, so
+// webhookURL must match the subscription URL exactly.
+func (s *SquareProvider) VerifyWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error) {
+	signature := header.Get("X-Square-Hmacsha256-Signature")
+	if signature == "" {
+		return nil, fmt.Errorf("missing x-square-hmacsha256-signature header")
+	}
+
+	s.credentialsMu.RLock()
+	signatureKey := s.signatureKey
+	s.credentialsMu.RUnlock()
+	mac := hmac.New(sha256.New, []byte(signatureKey))
+	mac.Write([]byte(s.webhookURL))
+	mac.Write(payload)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, fmt.Errorf("signature mismatch")
+	}
+
+	return s.ParseWebhook(payload)
+}
+
+// ParseWebhook maps a Square event payload
+func (s *SquareProvider) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	var event struct {
+		EventID string `json:"event_id"`
+		Type    string `json:"type"`
+		Data    struct {
+			Object struct {
+				Payment *struct {
+					OrderID string `json:"order_id"`
+					Status  string `json:"status"`
+				} `json:"payment"`
+				Refund *struct {
+					ID      string `json:"id"`
+					OrderID string `json:"order_id"`
+					Status  string `json:"status"`
+				} `json:"refund"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("unmarshal event: %w", err)
+	}
+
+	result := &WebhookEvent{
+		Provider:  s.Name(),
+		EventID:   event.EventID,
+		EventType: event.Type,
+		Payload:   payload,
+	}
+
+	switch {
+	case event.Data.Object.Payment != nil:
+		payment := event.Data.Object.Payment
+		result.ProviderPaymentID = payment.OrderID
+		switch payment.Status {
+		case "COMPLETED":
+			result.Kind = WebhookPaymentSucceeded
+		case "FAILED":
+			result.Kind = WebhookPaymentFailed
+		case "CANCELED":
+			result.Kind = WebhookPaymentCanceled
+		}
+	case event.Data.Object.Refund != nil:
+		refund := event.Data.Object.Refund
+		result.ProviderPaymentID = refund.OrderID
+		result.ProviderRefundID = refund.ID
+		switch refund.Status {
+		case "COMPLETED":
+			result.Kind = WebhookRefundSucceeded
+		case "FAILED", "REJECTED":
+			result.Kind = WebhookRefundFailed
+			result.FailureMessage = "Square refund " + strings.ToLower(refund.Status)
+		}
+	}
+
+	return result, nil
+}
+
+// do sends an authenticated request to the Square API and decodes the response
+func (s *SquareProvider) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	s.credentialsMu.RLock()
+	req.Header.Set("Authorization", "Bearer "+s.accessToken)
+	s.credentialsMu.RUnlock()
+	req.Header.Set("Square-Version", squareAPIVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("square API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Errors []struct {
+				Code   string `json:"code"`
+				Detail string `json:"detail"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && len(apiErr.Errors) > 0 {
+			return fmt.Errorf("square API error (status %d): %s: %s",
+				resp.StatusCode, apiErr.Errors[0].Code, apiErr.Errors[0].Detail)
+		}
+		return fmt.Errorf("square API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return nil
+}
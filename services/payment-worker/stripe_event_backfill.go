@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Stripe Event Backfill
+//
+// Webhooks are the only way provider events reach the database, so while the
+// webhook server is down (or unreachable) events are lost once Stripe's
+// retries give up. The stripe_event_backfill job lists recent events through
+// the Events API, skips those already processed in metadata.webhooks, and runs
+// the rest through WebhookHandler.ProcessWebhook exactly as if they had been
+// delivered.
+//
+// StripeEventBackfillScheduler enqueues the job on a Go ticker (see
+// periodic_scheduler.go).
+// ============================================================================
+
+const (
+	// stripeEventBackfillMinAge leaves the newest events to live delivery,
+	// which is still in progress or retrying
+	stripeEventBackfillMinAge = 5 * time.Minute
+	// stripeEventBackfillMaxLookback is how long Stripe keeps events
+	stripeEventBackfillMaxLookback = 30 * 24 * time.Hour
+)
+
+// StripeEventBackfillArgs are the args of the stripe_event_backfill job. It
+// can also be enqueued by hand, e.g. with a longer lookback after an outage:
+//
+//	INSERT INTO metadata.river_job (kind, args, queue, max_attempts, state)
+//	VALUES ('stripe_event_backfill', '{"lookback_hours": 168}', 'default', 3, 'available');
+type StripeEventBackfillArgs struct {
+	LookbackHours int `json:"lookback_hours,omitempty"` // 0 = worker default
+}
+
+// Kind returns the job kind identifier for River
+func (StripeEventBackfillArgs) Kind() string {
+	return "stripe_event_backfill"
+}
+
+// StripeEventBackfillWorker replays Stripe events missing from metadata.webhooks
+type StripeEventBackfillWorker struct {
+	river.WorkerDefaults[StripeEventBackfillArgs]
+	dbPool    *pgxpool.Pool
+	providers *ProviderRegistry
+	handler   *WebhookHandler
+	lookback  time.Duration
+}
+
+// NewStripeEventBackfillWorker creates a new StripeEventBackfillWorker
+func NewStripeEventBackfillWorker(dbPool *pgxpool.Pool, providers *ProviderRegistry, handler *WebhookHandler, lookback time.Duration) *StripeEventBackfillWorker {
+	return &StripeEventBackfillWorker{
+		dbPool:    dbPool,
+		providers: providers,
+		handler:   handler,
+		lookback:  lookback,
+	}
+}
+
+// Work lists recent Stripe events and processes the ones never received
+func (w *StripeEventBackfillWorker) Work(ctx context.Context, job *river.Job[StripeEventBackfillArgs]) error {
+	provider, err := w.providers.Get("stripe")
+	if err != nil {
+		log.Printf("[Backfill] Stripe is not configured, skipping")
+		return nil
+	}
+	lister, ok := provider.(eventLister)
+	if !ok {
+		return nil
+	}
+
+	lookback := w.lookback
+	if job.Args.LookbackHours > 0 {
+		lookback = time.Duration(job.Args.LookbackHours) * time.Hour
+	}
+	since, until := backfillWindow(time.Now(), lookback)
+
+	events, err := lister.ListEvents(ctx, since, until)
+	if err != nil {
+		return fmt.Errorf("list stripe events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	missing, err := w.missingEvents(ctx, provider.Name(), events)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, event := range missing {
+		log.Printf("[Backfill] Replaying missed event %s (%s)", event.EventID, event.EventType)
+		if err := w.handler.ProcessWebhook(ctx, provider, event); err != nil {
+			// The row keeps the error and stays unprocessed, so the next run tries again
+			log.Printf("[Backfill] Error processing event %s: %v", event.EventID, err)
+			failed++
+		}
+	}
+
+	log.Printf("[Backfill] Checked %d Stripe events since %s: %d missing, %d failed",
+		len(events), since.Format(time.RFC3339), len(missing), failed)
+	return nil
+}
+
+// missingEvents returns the events with no processed metadata.webhooks row,
+// in order
+func (w *StripeEventBackfillWorker) missingEvents(ctx context.Context, providerName string, events []*WebhookEvent) ([]*WebhookEvent, error) {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.EventID
+	}
+
+	rows, err := w.dbPool.Query(ctx, `
+		SELECT provider_event_id
+		FROM metadata.webhooks
+		WHERE provider = $1 AND provider_event_id = ANY($2) AND processed
+	`, providerName, ids)
+	if err != nil {
+		return nil, fmt.Errorf("query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool, len(ids))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		seen[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query webhooks: %w", err)
+	}
+
+	var missing []*WebhookEvent
+	for _, event := range events {
+		if !seen[event.EventID] {
+			missing = append(missing, event)
+		}
+	}
+	return missing, nil
+}
+
+// backfillWindow returns the [since, until) range of events to check. The
+// lookback is capped at Stripe's event retention.
+func backfillWindow(now time.Time, lookback time.Duration) (time.Time, time.Time) {
+	if lookback <= 0 || lookback > stripeEventBackfillMaxLookback {
+		lookback = stripeEventBackfillMaxLookback
+	}
+	until := now.Add(-stripeEventBackfillMinAge)
+	return now.Add(-lookback), until
+}
+
+// StripeEventBackfillScheduler enqueues stripe_event_backfill on an interval
+type StripeEventBackfillScheduler = PeriodicJobScheduler
+
+// NewStripeEventBackfillScheduler creates a scheduler for the backfill job
+func NewStripeEventBackfillScheduler(client jobInserter, interval time.Duration) *StripeEventBackfillScheduler {
+	return NewPeriodicJobScheduler(client, "Backfill", StripeEventBackfillArgs{}, interval)
+}
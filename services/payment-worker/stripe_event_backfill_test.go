@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestBackfillWindow(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		lookback  time.Duration
+		wantSince time.Time
+	}{
+		{"default lookback", 24 * time.Hour, now.Add(-24 * time.Hour)},
+		{"capped at event retention", 90 * 24 * time.Hour, now.Add(-30 * 24 * time.Hour)},
+		{"unset uses event retention", 0, now.Add(-30 * 24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			since, until := backfillWindow(now, tt.lookback)
+			if !since.Equal(tt.wantSince) {
+				t.Errorf("since = %v, want %v", since, tt.wantSince)
+			}
+			if want := now.Add(-5 * time.Minute); !until.Equal(want) {
+				t.Errorf("until = %v, want %v (recent events are left to live delivery)", until, want)
+			}
+		})
+	}
+}
+
+func TestStripeProvider_NormalizeListedEvent(t *testing.T) {
+	provider := &StripeProvider{}
+
+	// An event as returned by the Events API, re-encoded the way ListEvents stores it
+	var listed stripe.Event
+	raw := `{"id":"evt_9","object":"event","type":"invoice.paid","created":1760000000,"data":{"object":{"id":"in_9","object":"invoice","subscription":"sub_9","payment_intent":"pi_9","amount_paid":2500}}}`
+	if err := json.Unmarshal([]byte(raw), &listed); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	payload, err := json.Marshal(listed)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	event, err := provider.normalizeEvent(listed, payload)
+	if err != nil {
+		t.Fatalf("normalizeEvent: %v", err)
+	}
+	if event.Kind != WebhookInvoicePaid || event.ProviderInvoiceID != "in_9" ||
+		event.ProviderSubscriptionID != "sub_9" || event.ProviderPaymentID != "pi_9" || event.AmountCents != 2500 {
+		t.Errorf("normalizeEvent = %+v", event)
+	}
+
+	// The stored payload must still carry the object, like a delivered webhook
+	var stored struct {
+		ID   string `json:"id"`
+		Data struct {
+			Object struct {
+				ID string `json:"id"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(event.Payload, &stored); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if stored.ID != "evt_9" || stored.Data.Object.ID != "in_9" {
+		t.Errorf("stored payload = %s", event.Payload)
+	}
+}
+
+func TestStripeWebhookEventTypes_WithinListLimit(t *testing.T) {
+	// The Events API accepts at most 20 types per request
+	if len(stripeWebhookEventTypes) > 20 {
+		t.Errorf("%d event types, Stripe allows 20", len(stripeWebhookEventTypes))
+	}
+}
+
+type fakeInserter struct {
+	mu    sync.Mutex
+	calls []*river.InsertOpts
+}
+
+func (f *fakeInserter) Insert(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if args.Kind() != "stripe_event_backfill" {
+		panic("unexpected job kind " + args.Kind())
+	}
+	f.calls = append(f.calls, opts)
+	return &rivertype.JobInsertResult{}, nil
+}
+
+func TestStripeEventBackfillScheduler_EnqueuesOnStart(t *testing.T) {
+	inserter := &fakeInserter{}
+	scheduler := NewStripeEventBackfillScheduler(inserter, time.Hour)
+	scheduler.Start(context.Background())
+	scheduler.Stop()
+
+	if len(inserter.calls) != 1 {
+		t.Fatalf("Insert called %d times, want 1 (immediate catch-up run)", len(inserter.calls))
+	}
+	if got := inserter.calls[0].UniqueOpts.ByPeriod; got != time.Hour {
+		t.Errorf("UniqueOpts.ByPeriod = %v, want the interval so replicas don't double-enqueue", got)
+	}
+}
@@ -2,73 +2,94 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/balance"
+	"github.com/stripe/stripe-go/v81/customer"
+	"github.com/stripe/stripe-go/v81/event"
 	"github.com/stripe/stripe-go/v81/paymentintent"
+	"github.com/stripe/stripe-go/v81/product"
 	"github.com/stripe/stripe-go/v81/refund"
+	"github.com/stripe/stripe-go/v81/subscription"
+	"github.com/stripe/stripe-go/v81/webhook"
 )
 
-// PaymentProvider defines the interface for payment processors
-type PaymentProvider interface {
-	CreateIntent(ctx context.Context, params CreateIntentParams) (*PaymentIntentResult, error)
-	CreateRefund(ctx context.Context, params RefundParams) (*RefundResult, error)
-}
-
-// CreateIntentParams contains parameters for creating a payment intent
-type CreateIntentParams struct {
-	Amount      int64  // Amount in cents (e.g., 1000 = $10.00)
-	Currency    string // Currency code (e.g., "usd")
-	Description string // Payment description
-	// POC: No metadata, customer ID, or other fields yet
-}
-
-// PaymentIntentResult contains the result of creating a payment intent
-type PaymentIntentResult struct {
-	PaymentIntentID string // Stripe PaymentIntent ID (pi_...)
-	ClientSecret    string // client_secret for Stripe Elements
-	Status          string // Payment intent status (e.g., "requires_payment_method")
-}
-
-// RefundParams contains parameters for creating a refund
-type RefundParams struct {
-	PaymentIntentID string // Stripe PaymentIntent ID to refund (pi_...)
-	AmountCents     int64  // Amount to refund in cents (partial refunds supported)
-	Reason          string // Reason for refund (shown in Stripe dashboard)
-}
-
-// RefundResult contains the result of creating a refund
-type RefundResult struct {
-	RefundID string // Stripe Refund ID (re_...)
-	Status   string // Refund status (e.g., "succeeded", "pending")
-}
-
 // StripeProvider implements PaymentProvider for Stripe
 type StripeProvider struct {
-	apiKey string
+	apiKey        string
+	webhookSecret string
+
+	// Signing secret of the Connect webhook endpoint, which receives events
+	// from connected accounts (payouts, account updates). Optional.
+	connectWebhookSecret string
+
+	// Guards the secrets above, which SetCredentials swaps on rotation
+	credentialsMu sync.RWMutex
 }
 
 // NewStripeProvider creates a new Stripe payment provider
-func NewStripeProvider(apiKey string) *StripeProvider {
+func NewStripeProvider(apiKey, webhookSecret, connectWebhookSecret string) *StripeProvider {
 	if apiKey == "" {
 		log.Fatal("[Stripe] STRIPE_API_KEY is required")
 	}
+	if webhookSecret == "" {
+		log.Fatal("[Stripe] STRIPE_WEBHOOK_SECRET is required")
+	}
 
 	// Set global API key for Stripe SDK
 	stripe.Key = apiKey
 
+	// Calls made with a traced job's context (params.Context) get a client
+	// span; the timeout is the SDK's default
+	stripe.SetHTTPClient(&http.Client{Timeout: 80 * time.Second, Transport: newTracingTransport(nil, "stripe")})
+
 	log.Printf("[Stripe] Provider initialized (key: %s...)", maskAPIKey(apiKey))
 
+	if connectWebhookSecret != "" {
+		log.Println("[Stripe] Connect webhook endpoint enabled")
+	}
+
 	return &StripeProvider{
-		apiKey: apiKey,
+		apiKey:               apiKey,
+		webhookSecret:        webhookSecret,
+		connectWebhookSecret: connectWebhookSecret,
+	}
+}
+
+// SetCredentials swaps in a rotated API key and webhook signing secrets
+// (see secrets.go). Empty values keep the current ones. The SDK reads its
+// global key on every call, so calls already in flight finish with the old
+// key.
+func (s *StripeProvider) SetCredentials(apiKey, webhookSecret, connectWebhookSecret string) {
+	s.credentialsMu.Lock()
+	defer s.credentialsMu.Unlock()
+	if apiKey != "" {
+		s.apiKey = apiKey
+		stripe.Key = apiKey
 	}
+	if webhookSecret != "" {
+		s.webhookSecret = webhookSecret
+	}
+	if connectWebhookSecret != "" {
+		s.connectWebhookSecret = connectWebhookSecret
+	}
+}
+
+// Name returns the provider key for Stripe transactions
+func (s *StripeProvider) Name() string {
+	return "stripe"
 }
 
 // CreateIntent creates a Stripe PaymentIntent
 func (s *StripeProvider) CreateIntent(ctx context.Context, params CreateIntentParams) (*PaymentIntentResult, error) {
-	log.Printf("[Stripe] Creating PaymentIntent: amount=%d %s, description=%q",
-		params.Amount, params.Currency, params.Description)
+	log.Printf("[Stripe] Creating PaymentIntent: amount=%d %s, method=%s, capture=%s, description=%q",
+		params.Amount, params.Currency, params.PaymentMethod, params.CaptureMethod, params.Description)
 
 	// Validate params
 	if params.Amount <= 0 {
@@ -78,23 +99,62 @@ func (s *StripeProvider) CreateIntent(ctx context.Context, params CreateIntentPa
 		params.Currency = "usd"
 	}
 
+	// Manual capture only authorizes the card at checkout; CapturePayment or
+	// CancelPayment settles it later
+	captureMethod := CaptureMethodAutomatic
+	if params.CaptureMethod == CaptureMethodManual {
+		if params.PaymentMethod == PaymentMethodUSBankAccount {
+			return nil, fmt.Errorf("manual capture is not supported for %s payments", params.PaymentMethod)
+		}
+		captureMethod = CaptureMethodManual
+	}
+
 	// Create Stripe PaymentIntent
 	intentParams := &stripe.PaymentIntentParams{
-		Amount:      stripe.Int64(params.Amount),
-		Currency:    stripe.String(params.Currency),
-		Description: stripe.String(params.Description),
-
-		// POC: Immediate capture (default)
-		// Future: Support deferred capture with CaptureMethod: manual
-		CaptureMethod: stripe.String("automatic"),
+		Amount:        stripe.Int64(params.Amount),
+		Currency:      stripe.String(params.Currency),
+		Description:   stripe.String(params.Description),
+		CaptureMethod: stripe.String(captureMethod),
+	}
 
+	switch params.PaymentMethod {
+	case PaymentMethodUSBankAccount:
+		// ACH debit: the Payment Element collects the account through Financial
+		// Connections (falling back to microdeposits) and shows the mandate text.
+		// Stripe creates the mandate when the customer confirms.
+		intentParams.PaymentMethodTypes = stripe.StringSlice([]string{PaymentMethodUSBankAccount})
+		intentParams.PaymentMethodOptions = &stripe.PaymentIntentPaymentMethodOptionsParams{
+			USBankAccount: &stripe.PaymentIntentPaymentMethodOptionsUSBankAccountParams{
+				VerificationMethod: stripe.String("automatic"),
+				FinancialConnections: &stripe.PaymentIntentPaymentMethodOptionsUSBankAccountFinancialConnectionsParams{
+					Permissions: stripe.StringSlice([]string{"payment_method"}),
+				},
+			},
+		}
+	case PaymentMethodCard, "":
 		// Enable automatic payment methods (cards, etc.)
-		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
+		intentParams.AutomaticPaymentMethods = &stripe.PaymentIntentAutomaticPaymentMethodsParams{
 			Enabled: stripe.Bool(true),
-		},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported payment method: %s", params.PaymentMethod)
+	}
+
+	// Destination charge: the connected account receives the payment less the
+	// application fee. transfer_group carries the payment ID onto the transfer
+	// so transfer webhooks can be matched to the transaction.
+	if params.DestinationAccount != "" {
+		intentParams.TransferData = &stripe.PaymentIntentTransferDataParams{
+			Destination: stripe.String(params.DestinationAccount),
+		}
+		intentParams.TransferGroup = stripe.String(params.PaymentID)
+		if params.ApplicationFeeCents > 0 {
+			intentParams.ApplicationFeeAmount = stripe.Int64(params.ApplicationFeeCents)
+		}
 	}
 
 	// Call Stripe API
+	intentParams.Context = ctx
 	intent, err := paymentintent.New(intentParams)
 	if err != nil {
 		log.Printf("[Stripe] Error creating PaymentIntent: %v", err)
@@ -112,6 +172,189 @@ func (s *StripeProvider) CreateIntent(ctx context.Context, params CreateIntentPa
 	}, nil
 }
 
+// CapturePayment charges an authorized (requires_capture) PaymentIntent for
+// its full amount. Stripe then sends payment_intent.succeeded.
+func (s *StripeProvider) CapturePayment(ctx context.Context, providerPaymentID string) error {
+	log.Printf("[Stripe] Capturing PaymentIntent %s", providerPaymentID)
+
+	captureParams := &stripe.PaymentIntentCaptureParams{}
+	captureParams.Context = ctx
+	intent, err := paymentintent.Capture(providerPaymentID, captureParams)
+	if err != nil {
+		// A retried job whose earlier attempt captured the intent
+		if s.intentHasStatus(ctx, providerPaymentID, stripe.PaymentIntentStatusSucceeded) {
+			log.Printf("[Stripe] PaymentIntent %s already captured", providerPaymentID)
+			return nil
+		}
+		return fmt.Errorf("stripe API error: %w", err)
+	}
+
+	log.Printf("[Stripe] ✓ PaymentIntent %s captured (status=%s)", intent.ID, intent.Status)
+	return nil
+}
+
+// CancelPayment releases an uncaptured PaymentIntent. Stripe then sends
+// payment_intent.canceled.
+func (s *StripeProvider) CancelPayment(ctx context.Context, providerPaymentID string) error {
+	log.Printf("[Stripe] Canceling PaymentIntent %s", providerPaymentID)
+
+	cancelParams := &stripe.PaymentIntentCancelParams{}
+	cancelParams.Context = ctx
+	intent, err := paymentintent.Cancel(providerPaymentID, cancelParams)
+	if err != nil {
+		// Already canceled by a previous attempt, or by Stripe when the
+		// authorization window closed
+		if s.intentHasStatus(ctx, providerPaymentID, stripe.PaymentIntentStatusCanceled) {
+			log.Printf("[Stripe] PaymentIntent %s already canceled", providerPaymentID)
+			return nil
+		}
+		return fmt.Errorf("stripe API error: %w", err)
+	}
+
+	log.Printf("[Stripe] ✓ PaymentIntent %s canceled (status=%s)", intent.ID, intent.Status)
+	return nil
+}
+
+// intentHasStatus reports whether a PaymentIntent is currently in status.
+// Lookup errors report false so the caller returns its original error.
+func (s *StripeProvider) intentHasStatus(ctx context.Context, providerPaymentID string, status stripe.PaymentIntentStatus) bool {
+	getParams := &stripe.PaymentIntentParams{}
+	getParams.Context = ctx
+	intent, err := paymentintent.Get(providerPaymentID, getParams)
+	return err == nil && intent.Status == status
+}
+
+// CreateSubscription creates a Stripe Subscription with an inline price.
+// payment_behavior=default_incomplete leaves the first invoice open so the
+// customer confirms its PaymentIntent at checkout, which also saves the card
+// for renewals. Each Stripe call uses an idempotency key derived from the
+// subscription ID so a retried job never creates duplicates.
+func (s *StripeProvider) CreateSubscription(ctx context.Context, params CreateSubscriptionParams) (*SubscriptionResult, error) {
+	log.Printf("[Stripe] Creating Subscription: amount=%d %s every %d %s, description=%q",
+		params.Amount, params.Currency, params.IntervalCount, params.Interval, params.Description)
+
+	if params.Amount <= 0 {
+		return nil, fmt.Errorf("invalid amount: %d (must be > 0)", params.Amount)
+	}
+	if params.Currency == "" {
+		params.Currency = "usd"
+	}
+	if params.IntervalCount <= 0 {
+		params.IntervalCount = 1
+	}
+
+	customerID := params.CustomerID
+	if customerID == "" {
+		customerParams := &stripe.CustomerParams{
+			Email: stripe.String(params.Email),
+			Name:  stripe.String(params.Name),
+		}
+		customerParams.SetIdempotencyKey("customer-" + params.SubscriptionID)
+		customerParams.Context = ctx
+		cust, err := customer.New(customerParams)
+		if err != nil {
+			return nil, fmt.Errorf("stripe API error creating customer: %w", err)
+		}
+		customerID = cust.ID
+	}
+
+	// Subscription prices must reference a Product
+	productName := params.Description
+	if productName == "" {
+		productName = "Subscription"
+	}
+	productParams := &stripe.ProductParams{Name: stripe.String(productName)}
+	productParams.SetIdempotencyKey("product-" + params.SubscriptionID)
+	productParams.Context = ctx
+	prod, err := product.New(productParams)
+	if err != nil {
+		return nil, fmt.Errorf("stripe API error creating product: %w", err)
+	}
+
+	subParams := &stripe.SubscriptionParams{
+		Customer:    stripe.String(customerID),
+		Description: stripe.String(params.Description),
+		Items: []*stripe.SubscriptionItemsParams{{
+			PriceData: &stripe.SubscriptionItemPriceDataParams{
+				Currency:   stripe.String(params.Currency),
+				Product:    stripe.String(prod.ID),
+				UnitAmount: stripe.Int64(params.Amount),
+				Recurring: &stripe.SubscriptionItemPriceDataRecurringParams{
+					Interval:      stripe.String(params.Interval),
+					IntervalCount: stripe.Int64(params.IntervalCount),
+				},
+			},
+		}},
+		PaymentBehavior: stripe.String("default_incomplete"),
+		PaymentSettings: &stripe.SubscriptionPaymentSettingsParams{
+			SaveDefaultPaymentMethod: stripe.String("on_subscription"),
+		},
+	}
+	subParams.AddMetadata("civic_os_subscription_id", params.SubscriptionID)
+	subParams.AddExpand("latest_invoice.payment_intent")
+	subParams.SetIdempotencyKey("subscription-" + params.SubscriptionID)
+	subParams.Context = ctx
+
+	sub, err := subscription.New(subParams)
+	if err != nil {
+		log.Printf("[Stripe] Error creating Subscription: %v", err)
+		return nil, fmt.Errorf("stripe API error: %w", err)
+	}
+
+	result := &SubscriptionResult{
+		SubscriptionID:   sub.ID,
+		CustomerID:       customerID,
+		Status:           string(sub.Status),
+		CurrentPeriodEnd: sub.CurrentPeriodEnd,
+	}
+	if inv := sub.LatestInvoice; inv != nil {
+		result.InvoiceID = inv.ID
+		if inv.PaymentIntent != nil {
+			result.PaymentIntentID = inv.PaymentIntent.ID
+			result.ClientSecret = inv.PaymentIntent.ClientSecret
+		}
+	}
+	if result.PaymentIntentID == "" {
+		return nil, fmt.Errorf("subscription %s has no first invoice payment", sub.ID)
+	}
+
+	log.Printf("[Stripe] ✓ Subscription created: id=%s, status=%s, invoice=%s, payment_intent=%s",
+		sub.ID, sub.Status, result.InvoiceID, result.PaymentIntentID)
+	return result, nil
+}
+
+// CancelSubscription cancels a Stripe Subscription immediately or at the end
+// of the current period. Stripe then sends customer.subscription.updated or
+// customer.subscription.deleted.
+func (s *StripeProvider) CancelSubscription(ctx context.Context, providerSubscriptionID string, atPeriodEnd bool) error {
+	log.Printf("[Stripe] Canceling Subscription %s (at_period_end=%v)", providerSubscriptionID, atPeriodEnd)
+
+	if atPeriodEnd {
+		updateParams := &stripe.SubscriptionParams{CancelAtPeriodEnd: stripe.Bool(true)}
+		updateParams.Context = ctx
+		_, err := subscription.Update(providerSubscriptionID, updateParams)
+		if err != nil {
+			return fmt.Errorf("stripe API error: %w", err)
+		}
+		return nil
+	}
+
+	cancelParams := &stripe.SubscriptionCancelParams{}
+	cancelParams.Context = ctx
+	_, err := subscription.Cancel(providerSubscriptionID, cancelParams)
+	if err != nil {
+		// A retried job whose earlier attempt canceled it
+		getParams := &stripe.SubscriptionParams{}
+		getParams.Context = ctx
+		if sub, getErr := subscription.Get(providerSubscriptionID, getParams); getErr == nil && sub.Status == stripe.SubscriptionStatusCanceled {
+			log.Printf("[Stripe] Subscription %s already canceled", providerSubscriptionID)
+			return nil
+		}
+		return fmt.Errorf("stripe API error: %w", err)
+	}
+	return nil
+}
+
 // maskAPIKey masks API key for logging (show first 7 chars + ...)
 func maskAPIKey(apiKey string) string {
 	if len(apiKey) <= 10 {
@@ -120,6 +363,14 @@ func maskAPIKey(apiKey string) string {
 	return apiKey[:7] + "..." + apiKey[len(apiKey)-4:]
 }
 
+// Ping checks that the Stripe API is reachable and accepts the API key
+func (s *StripeProvider) Ping(ctx context.Context) error {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	_, err := balance.Get(params)
+	return err
+}
+
 // maskSecret masks client_secret for logging (show first 12 chars + ...)
 func maskSecret(secret string) string {
 	if len(secret) <= 15 {
@@ -153,7 +404,14 @@ func (s *StripeProvider) CreateRefund(ctx context.Context, params RefundParams)
 		refundParams.AddMetadata("reason", params.Reason)
 	}
 
+	if params.ReverseTransfer {
+		refundParams.ReverseTransfer = stripe.Bool(true)
+		refundParams.RefundApplicationFee = stripe.Bool(params.RefundApplicationFee)
+	}
+
 	// Call Stripe API
+	refundParams.Context = ctx
+	refundParams.SetIdempotencyKey("refund-" + params.RefundID)
 	stripeRefund, err := refund.New(refundParams)
 	if err != nil {
 		log.Printf("[Stripe] Error creating Refund: %v", err)
@@ -168,3 +426,274 @@ func (s *StripeProvider) CreateRefund(ctx context.Context, params RefundParams)
 		Status:   string(stripeRefund.Status),
 	}, nil
 }
+
+// VerifyWebhook verifies the Stripe-Signature header and maps the event
+func (s *StripeProvider) VerifyWebhook(ctx context.Context, payload []byte, header http.Header) (*WebhookEvent, error) {
+	signature := header.Get("Stripe-Signature")
+	if signature == "" {
+		return nil, fmt.Errorf("missing Stripe-Signature header")
+	}
+
+	// Note: IgnoreAPIVersionMismatch allows Stripe CLI to work with newer SDK versions
+	options := webhook.ConstructEventOptions{IgnoreAPIVersionMismatch: true}
+	s.credentialsMu.RLock()
+	webhookSecret, connectWebhookSecret := s.webhookSecret, s.connectWebhookSecret
+	s.credentialsMu.RUnlock()
+	event, err := webhook.ConstructEventWithOptions(payload, signature, webhookSecret, options)
+	if err != nil && connectWebhookSecret != "" {
+		// Both endpoints may point at the same URL
+		var connectErr error
+		event, connectErr = webhook.ConstructEventWithOptions(payload, signature, connectWebhookSecret, options)
+		if connectErr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.normalizeEvent(event, payload)
+}
+
+// ParseWebhook maps a stored Stripe event payload
+func (s *StripeProvider) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("unmarshal event: %w", err)
+	}
+	return s.normalizeEvent(event, payload)
+}
+
+// stripeWebhookEventTypes lists the event types normalizeEvent maps to a
+// WebhookEventKind. Backfill only lists these; the webhook endpoint in the
+// Stripe dashboard should subscribe to the same set. Connected-account events
+// (account.updated, payout.*) arrive on the separate Connect endpoint and are
+// not listed, since backfill only sees platform events.
+var stripeWebhookEventTypes = []string{
+	"payment_intent.processing",
+	"payment_intent.amount_capturable_updated",
+	"payment_intent.succeeded",
+	"payment_intent.payment_failed",
+	"payment_intent.canceled",
+	"charge.pending",
+	"charge.refunded",
+	"charge.refund.updated",
+	"invoice.paid",
+	"invoice.payment_failed",
+	"customer.subscription.updated",
+	"customer.subscription.deleted",
+	"transfer.created",
+	"transfer.updated",
+	"transfer.reversed",
+	"charge.dispute.created",
+	"charge.dispute.updated",
+	"charge.dispute.closed",
+}
+
+// ListEvents returns handled events created in [since, until), oldest first.
+// Payload is the event re-encoded as JSON, matching the webhook body shape.
+func (s *StripeProvider) ListEvents(ctx context.Context, since, until time.Time) ([]*WebhookEvent, error) {
+	params := &stripe.EventListParams{
+		CreatedRange: &stripe.RangeQueryParams{
+			GreaterThanOrEqual: since.Unix(),
+			LesserThan:         until.Unix(),
+		},
+		Types: stripe.StringSlice(stripeWebhookEventTypes),
+	}
+	params.Context = ctx
+	params.Limit = stripe.Int64(100)
+
+	var events []*WebhookEvent
+	iter := event.List(params)
+	for iter.Next() {
+		e := iter.Event()
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return nil, fmt.Errorf("encode event %s: %w", e.ID, err)
+		}
+		normalized, err := s.normalizeEvent(*e, payload)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w", e.ID, err)
+		}
+		events = append(events, normalized)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	// The API lists newest first; replay in the order Stripe sent them
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+// normalizeEvent maps a verified (or API-listed) Stripe event
+func (s *StripeProvider) normalizeEvent(event stripe.Event, payload []byte) (*WebhookEvent, error) {
+	result := &WebhookEvent{
+		Provider:  s.Name(),
+		EventID:   event.ID,
+		EventType: string(event.Type),
+		Payload:   payload,
+	}
+
+	switch event.Type {
+	case "payment_intent.processing", "payment_intent.amount_capturable_updated", "payment_intent.succeeded", "payment_intent.payment_failed", "payment_intent.canceled":
+		var paymentIntent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &paymentIntent); err != nil {
+			return nil, fmt.Errorf("unmarshal payment_intent: %w", err)
+		}
+		result.ProviderPaymentID = paymentIntent.ID
+		switch event.Type {
+		case "payment_intent.processing":
+			// ACH debits sit here until the bank settles (typically 4 business days)
+			result.Kind = WebhookPaymentProcessing
+		case "payment_intent.amount_capturable_updated":
+			// Manual capture: the card is authorized and funds are held
+			result.Kind = WebhookPaymentAuthorized
+		case "payment_intent.succeeded":
+			result.Kind = WebhookPaymentSucceeded
+		case "payment_intent.payment_failed":
+			result.Kind = WebhookPaymentFailed
+		default:
+			result.Kind = WebhookPaymentCanceled
+		}
+	case "charge.pending":
+		// ACH charges are pending while they settle; the charge carries the
+		// mandate the customer accepted at confirmation
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, fmt.Errorf("unmarshal charge: %w", err)
+		}
+		if charge.PaymentIntent != nil {
+			result.ProviderPaymentID = charge.PaymentIntent.ID
+		}
+		if details := charge.PaymentMethodDetails; details != nil && details.USBankAccount != nil && details.USBankAccount.Mandate != nil {
+			result.MandateID = details.USBankAccount.Mandate.ID
+			result.Kind = WebhookMandateAccepted
+		}
+	case "invoice.paid", "invoice.payment_failed":
+		var inv stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
+			return nil, fmt.Errorf("unmarshal invoice: %w", err)
+		}
+		if inv.Subscription == nil {
+			// One-off invoices aren't created by Civic OS
+			break
+		}
+		result.ProviderSubscriptionID = inv.Subscription.ID
+		result.ProviderInvoiceID = inv.ID
+		if inv.PaymentIntent != nil {
+			result.ProviderPaymentID = inv.PaymentIntent.ID
+		}
+		if event.Type == "invoice.paid" {
+			result.Kind = WebhookInvoicePaid
+			result.AmountCents = inv.AmountPaid
+		} else {
+			result.Kind = WebhookInvoicePaymentFailed
+			result.AmountCents = inv.AmountDue
+			result.FailureMessage = fmt.Sprintf("Subscription payment failed (attempt %d)", inv.AttemptCount)
+		}
+	case "customer.subscription.updated", "customer.subscription.deleted":
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return nil, fmt.Errorf("unmarshal subscription: %w", err)
+		}
+		result.Kind = WebhookSubscriptionUpdated
+		result.ProviderSubscriptionID = sub.ID
+		result.SubscriptionStatus = string(sub.Status)
+		result.CurrentPeriodEnd = sub.CurrentPeriodEnd
+		result.CancelAtPeriodEnd = sub.CancelAtPeriodEnd
+		result.CanceledAt = sub.CanceledAt
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, fmt.Errorf("unmarshal charge: %w", err)
+		}
+		if charge.PaymentIntent != nil {
+			result.ProviderPaymentID = charge.PaymentIntent.ID
+		}
+		// With several refunds in flight the charge can't say which one
+		// completed; refund-level events below carry the refund ID
+		result.Kind = WebhookRefundSucceeded
+	case "transfer.created", "transfer.updated", "transfer.reversed":
+		// Destination charges create the transfer when the charge succeeds;
+		// refunds with reverse_transfer reverse part of it
+		var tr stripe.Transfer
+		if err := json.Unmarshal(event.Data.Raw, &tr); err != nil {
+			return nil, fmt.Errorf("unmarshal transfer: %w", err)
+		}
+		result.Kind = WebhookTransferUpdated
+		result.ProviderTransferID = tr.ID
+		result.TransferGroup = tr.TransferGroup
+		result.AmountCents = tr.Amount
+		result.AmountReversedCents = tr.AmountReversed
+		if tr.Destination != nil {
+			result.ProviderAccountID = tr.Destination.ID
+		}
+	case "payout.created", "payout.updated", "payout.paid", "payout.failed", "payout.canceled":
+		var po stripe.Payout
+		if err := json.Unmarshal(event.Data.Raw, &po); err != nil {
+			return nil, fmt.Errorf("unmarshal payout: %w", err)
+		}
+		if event.Account == "" {
+			// The platform's own payouts aren't tracked
+			break
+		}
+		result.Kind = WebhookPayoutUpdated
+		result.ProviderAccountID = event.Account
+		result.ProviderPayoutID = po.ID
+		result.PayoutStatus = string(po.Status)
+		result.AmountCents = po.Amount
+		result.Currency = string(po.Currency)
+		result.ArrivalDate = po.ArrivalDate
+		result.FailureMessage = po.FailureMessage
+	case "account.updated":
+		var acct stripe.Account
+		if err := json.Unmarshal(event.Data.Raw, &acct); err != nil {
+			return nil, fmt.Errorf("unmarshal account: %w", err)
+		}
+		result.Kind = WebhookAccountUpdated
+		result.ProviderAccountID = acct.ID
+		result.ChargesEnabled = acct.ChargesEnabled
+		result.PayoutsEnabled = acct.PayoutsEnabled
+	case "charge.dispute.created", "charge.dispute.updated", "charge.dispute.closed":
+		var d stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &d); err != nil {
+			return nil, fmt.Errorf("unmarshal dispute: %w", err)
+		}
+		result.Kind = WebhookDisputeUpdated
+		result.ProviderDisputeID = d.ID
+		if d.PaymentIntent != nil {
+			result.ProviderPaymentID = d.PaymentIntent.ID
+		}
+		result.AmountCents = d.Amount
+		result.Currency = string(d.Currency)
+		result.DisputeStatus = string(d.Status)
+		result.DisputeReason = string(d.Reason)
+		result.DisputeCreated = d.Created
+	case "charge.refund.updated":
+		var r stripe.Refund
+		if err := json.Unmarshal(event.Data.Raw, &r); err != nil {
+			return nil, fmt.Errorf("unmarshal refund: %w", err)
+		}
+		result.ProviderRefundID = r.ID
+		if r.PaymentIntent != nil {
+			result.ProviderPaymentID = r.PaymentIntent.ID
+		}
+		switch r.Status {
+		case stripe.RefundStatusSucceeded:
+			result.Kind = WebhookRefundSucceeded
+		case stripe.RefundStatusFailed, stripe.RefundStatusCanceled:
+			// ACH refunds can fail days after Stripe accepted them, when the
+			// receiving bank returns the credit
+			result.Kind = WebhookRefundFailed
+			result.FailureMessage = fmt.Sprintf("Stripe refund %s", r.Status)
+			if r.FailureReason != "" {
+				result.FailureMessage += ": " + string(r.FailureReason)
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+)
+
+// ============================================================================
+// Subscription Workers
+//
+// payments.create_and_link_subscription() inserts a pending_setup
+// subscription plus a pending_intent transaction for its first invoice; the
+// insert trigger enqueues create_subscription. The worker creates the
+// provider subscription and stores the first invoice's PaymentIntent on that
+// transaction, so the existing checkout flow confirms it. Renewals arrive as
+// invoice webhooks (see webhook_handler.go). public.cancel_subscription()
+// enqueues cancel_subscription.
+// ============================================================================
+
+// CreateSubscriptionWorkerArgs matches the JSON args inserted by
+// payments.enqueue_create_subscription_job()
+type CreateSubscriptionWorkerArgs struct {
+	SubscriptionID string `json:"subscription_id"`
+}
+
+// Kind returns the job kind identifier for River
+func (CreateSubscriptionWorkerArgs) Kind() string {
+	return "create_subscription"
+}
+
+// CancelSubscriptionWorkerArgs matches the JSON args inserted by
+// public.cancel_subscription()
+type CancelSubscriptionWorkerArgs struct {
+	SubscriptionID string `json:"subscription_id"`
+	AtPeriodEnd    bool   `json:"at_period_end"`
+}
+
+// Kind returns the job kind identifier for River
+func (CancelSubscriptionWorkerArgs) Kind() string {
+	return "cancel_subscription"
+}
+
+// CreateSubscriptionWorker creates provider subscriptions
+type CreateSubscriptionWorker struct {
+	river.WorkerDefaults[CreateSubscriptionWorkerArgs]
+	dbPool    *pgxpool.Pool
+	providers *ProviderRegistry
+}
+
+// NewCreateSubscriptionWorker creates a new CreateSubscriptionWorker
+func NewCreateSubscriptionWorker(dbPool *pgxpool.Pool, providers *ProviderRegistry) *CreateSubscriptionWorker {
+	return &CreateSubscriptionWorker{
+		dbPool:    dbPool,
+		providers: providers,
+	}
+}
+
+// Work creates one provider subscription and prepares its first payment
+func (w *CreateSubscriptionWorker) Work(ctx context.Context, job *river.Job[CreateSubscriptionWorkerArgs]) error {
+	subscriptionID := job.Args.SubscriptionID
+	log.Printf("[Subscription] Processing create job for subscription %s", subscriptionID)
+
+	var sub struct {
+		UserID        string
+		Amount        float64
+		Currency      string
+		Interval      string
+		IntervalCount int64
+		Description   *string
+		Status        string
+		Provider      string
+	}
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT user_id, amount, currency, billing_interval, interval_count, description, status, provider
+		FROM payments.subscriptions
+		WHERE id = $1
+	`, subscriptionID).Scan(&sub.UserID, &sub.Amount, &sub.Currency, &sub.Interval,
+		&sub.IntervalCount, &sub.Description, &sub.Status, &sub.Provider)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			log.Printf("[Subscription] Subscription %s not found", subscriptionID)
+			return fmt.Errorf("subscription not found: %s", subscriptionID)
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	// Idempotent: an earlier attempt already created it
+	if sub.Status != "pending_setup" {
+		log.Printf("[Subscription] Subscription %s is %s, not pending_setup, skipping", subscriptionID, sub.Status)
+		return nil
+	}
+
+	provider, err := w.providers.Get(sub.Provider)
+	if err != nil {
+		return err
+	}
+	biller, ok := provider.(subscriptionBiller)
+	if !ok {
+		// Not retryable; the database only allows Stripe subscriptions
+		return w.fail(ctx, subscriptionID, fmt.Sprintf("provider %s does not support subscriptions", provider.Name()))
+	}
+
+	// Reuse the customer from the user's earlier subscriptions so their saved
+	// card and billing history stay together
+	var customerID *string
+	err = w.dbPool.QueryRow(ctx, `
+		SELECT provider_customer_id
+		FROM payments.subscriptions
+		WHERE user_id = $1 AND provider = $2 AND provider_customer_id IS NOT NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, sub.UserID, sub.Provider).Scan(&customerID)
+	if err != nil && err != pgx.ErrNoRows {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	var email, name *string
+	err = w.dbPool.QueryRow(ctx, `
+		SELECT email, display_name
+		FROM metadata.civic_os_users_private
+		WHERE id = $1
+	`, sub.UserID).Scan(&email, &name)
+	if err != nil && err != pgx.ErrNoRows {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	result, err := biller.CreateSubscription(ctx, CreateSubscriptionParams{
+		SubscriptionID: subscriptionID,
+		CustomerID:     derefString(customerID),
+		Email:          derefString(email),
+		Name:           derefString(name),
+		Amount:         int64(math.Round(sub.Amount * 100)),
+		Currency:       strings.ToLower(sub.Currency),
+		Description:    derefString(sub.Description),
+		Interval:       sub.Interval,
+		IntervalCount:  sub.IntervalCount,
+	})
+	if err != nil {
+		log.Printf("[Subscription] Error creating subscription %s: %v", subscriptionID, err)
+		if job.Attempt < job.MaxAttempts {
+			return fmt.Errorf("provider error: %w", err)
+		}
+		return w.fail(ctx, subscriptionID, err.Error())
+	}
+
+	tx, err := w.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE payments.subscriptions
+		SET
+			status = $2,
+			provider_subscription_id = $3,
+			provider_customer_id = $4,
+			current_period_end = to_timestamp(NULLIF($5::BIGINT, 0)),
+			error_message = NULL
+		WHERE id = $1 AND status = 'pending_setup'
+	`, subscriptionID, subscriptionStatus(result.Status), result.SubscriptionID, result.CustomerID, result.CurrentPeriodEnd)
+	if err != nil {
+		return fmt.Errorf("database update error: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE payments.transactions
+		SET
+			status = 'pending',
+			provider_payment_id = $2,
+			provider_client_secret = $3,
+			provider_invoice_id = $4,
+			updated_at = NOW()
+		WHERE subscription_id = $1 AND status = 'pending_intent'
+	`, subscriptionID, result.PaymentIntentID, result.ClientSecret, result.InvoiceID)
+	if err != nil {
+		return fmt.Errorf("database update error: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	log.Printf("[Subscription] ✓ Subscription %s created as %s (first payment %s)",
+		subscriptionID, result.SubscriptionID, result.PaymentIntentID)
+	return nil
+}
+
+// fail marks a subscription and its first payment as failed. Returns nil so
+// River doesn't retry: the user starts a new subscription instead.
+func (w *CreateSubscriptionWorker) fail(ctx context.Context, subscriptionID, errorMsg string) error {
+	_, err := w.dbPool.Exec(ctx, `
+		WITH sub AS (
+			UPDATE payments.subscriptions
+			SET status = 'failed', error_message = $2
+			WHERE id = $1 AND status = 'pending_setup'
+			RETURNING id
+		)
+		UPDATE payments.transactions
+		SET status = 'failed', error_message = $2, updated_at = NOW()
+		WHERE subscription_id IN (SELECT id FROM sub) AND status = 'pending_intent'
+	`, subscriptionID, errorMsg)
+	if err != nil {
+		return fmt.Errorf("database update error: %w", err)
+	}
+	log.Printf("[Subscription] ✗ Subscription %s failed: %s", subscriptionID, errorMsg)
+	return nil
+}
+
+// CancelSubscriptionWorker cancels provider subscriptions
+type CancelSubscriptionWorker struct {
+	river.WorkerDefaults[CancelSubscriptionWorkerArgs]
+	dbPool    *pgxpool.Pool
+	providers *ProviderRegistry
+}
+
+// NewCancelSubscriptionWorker creates a new CancelSubscriptionWorker
+func NewCancelSubscriptionWorker(dbPool *pgxpool.Pool, providers *ProviderRegistry) *CancelSubscriptionWorker {
+	return &CancelSubscriptionWorker{
+		dbPool:    dbPool,
+		providers: providers,
+	}
+}
+
+// Work cancels one subscription now or at the end of its period
+func (w *CancelSubscriptionWorker) Work(ctx context.Context, job *river.Job[CancelSubscriptionWorkerArgs]) error {
+	subscriptionID := job.Args.SubscriptionID
+	log.Printf("[Subscription] Processing cancel job for subscription %s (at_period_end=%v)", subscriptionID, job.Args.AtPeriodEnd)
+
+	var (
+		status                 string
+		providerName           string
+		providerSubscriptionID *string
+	)
+	err := w.dbPool.QueryRow(ctx, `
+		SELECT status, provider, provider_subscription_id
+		FROM payments.subscriptions
+		WHERE id = $1
+	`, subscriptionID).Scan(&status, &providerName, &providerSubscriptionID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("subscription not found: %s", subscriptionID)
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if status == "canceled" || status == "incomplete_expired" || status == "failed" {
+		log.Printf("[Subscription] Subscription %s already ended (%s), skipping", subscriptionID, status)
+		return nil
+	}
+	if providerSubscriptionID == nil {
+		return fmt.Errorf("subscription %s has no provider subscription ID", subscriptionID)
+	}
+
+	provider, err := w.providers.Get(providerName)
+	if err != nil {
+		return err
+	}
+	biller, ok := provider.(subscriptionBiller)
+	if !ok {
+		log.Printf("[Subscription] Provider %s does not support subscriptions, skipping %s", provider.Name(), subscriptionID)
+		return nil
+	}
+
+	if w.providers.dryRun.Skip(ctx, provider.Name(), "cancel_subscription", *providerSubscriptionID,
+		map[string]any{"subscription_id": subscriptionID, "at_period_end": job.Args.AtPeriodEnd}) {
+		return river.JobCancel(errDryRun)
+	}
+	if err := biller.CancelSubscription(ctx, *providerSubscriptionID, job.Args.AtPeriodEnd); err != nil {
+		log.Printf("[Subscription] Error canceling subscription %s: %v", subscriptionID, err)
+		return fmt.Errorf("cancel error: %w", err)
+	}
+
+	// The customer.subscription.* webhook makes the same change
+	if job.Args.AtPeriodEnd {
+		_, err = w.dbPool.Exec(ctx, `
+			UPDATE payments.subscriptions
+			SET cancel_at_period_end = TRUE
+			WHERE id = $1
+		`, subscriptionID)
+	} else {
+		_, err = w.dbPool.Exec(ctx, `
+			UPDATE payments.subscriptions
+			SET status = 'canceled', canceled_at = COALESCE(canceled_at, NOW())
+			WHERE id = $1
+		`, subscriptionID)
+	}
+	if err != nil {
+		return fmt.Errorf("database update error: %w", err)
+	}
+
+	log.Printf("[Subscription] ✓ Subscription %s canceled (at_period_end=%v)", subscriptionID, job.Args.AtPeriodEnd)
+	return nil
+}
+
+// subscriptionStatus maps a provider subscription status onto
+// payments.subscriptions.status. Trials count as active; a paused
+// subscription isn't billed, like unpaid.
+func subscriptionStatus(providerStatus string) string {
+	switch providerStatus {
+	case "incomplete", "incomplete_expired", "active", "past_due", "unpaid", "canceled":
+		return providerStatus
+	case "trialing":
+		return "active"
+	case "paused":
+		return "unpaid"
+	default:
+		return "incomplete"
+	}
+}
+
+// derefString returns the string or "" for NULL columns
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
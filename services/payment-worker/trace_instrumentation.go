@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ============================================================================
+// River jobs
+// ============================================================================
+
+// jobTraceparentKey is the river_job.metadata key holding the trace context
+// of whatever enqueued the job
+const jobTraceparentKey = "traceparent"
+
+// JobTracingMiddleware runs each job in a consumer span continuing the trace
+// in the job's metadata, and stamps the current span onto jobs inserted while
+// a job runs.
+type JobTracingMiddleware struct {
+	river.MiddlewareDefaults
+}
+
+// Work implements rivertype.WorkerMiddleware
+func (*JobTracingMiddleware) Work(ctx context.Context, job *rivertype.JobRow, doInner func(context.Context) error) error {
+	ctx, span := tracer.Start(jobTraceContext(ctx, job.Metadata), job.Kind, trace.WithSpanKind(trace.SpanKindConsumer))
+	if !span.IsRecording() {
+		return doInner(ctx)
+	}
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("messaging.system", "river"),
+		attribute.String("messaging.destination.name", job.Queue),
+		attribute.Int64("messaging.message.id", job.ID),
+		attribute.String("river.job.kind", job.Kind),
+		attribute.Int("river.job.attempt", job.Attempt),
+	)
+
+	err := doInner(ctx)
+
+	// Snoozing and cancelling are outcomes, not failures
+	var snooze *river.JobSnoozeError
+	var cancel *river.JobCancelError
+	switch {
+	case errors.As(err, &snooze):
+		span.SetAttributes(attribute.Bool("river.job.snoozed", true))
+	case errors.As(err, &cancel):
+		span.SetAttributes(attribute.Bool("river.job.cancelled", true))
+		setSpanError(span, err)
+	default:
+		setSpanError(span, err)
+	}
+	return err
+}
+
+// InsertMany implements rivertype.JobInsertMiddleware
+func (*JobTracingMiddleware) InsertMany(ctx context.Context, manyParams []*rivertype.JobInsertParams, doInner func(context.Context) ([]*rivertype.JobInsertResult, error)) ([]*rivertype.JobInsertResult, error) {
+	if traceparent := traceparent(ctx); traceparent != "" {
+		for _, params := range manyParams {
+			params.Metadata = withJobTraceparent(params.Metadata, traceparent)
+		}
+	}
+	return doInner(ctx)
+}
+
+// jobTraceContext returns ctx carrying the trace context from job metadata
+func jobTraceContext(ctx context.Context, metadata []byte) context.Context {
+	var m map[string]any
+	if err := json.Unmarshal(metadata, &m); err != nil {
+		return ctx
+	}
+	value, _ := m[jobTraceparentKey].(string)
+	return propagator.Extract(ctx, propagation.MapCarrier{jobTraceparentKey: value})
+}
+
+// withJobTraceparent adds traceparent to job metadata unless it has one
+func withJobTraceparent(metadata []byte, traceparent string) []byte {
+	m := map[string]any{}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &m); err != nil {
+			return metadata
+		}
+	}
+	if _, ok := m[jobTraceparentKey]; ok {
+		return metadata
+	}
+	m[jobTraceparentKey] = traceparent
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return metadata
+	}
+	return encoded
+}
+
+// ============================================================================
+// Database queries
+// ============================================================================
+
+// dbStatementMaxLen truncates db.statement; some queries are whole functions
+const dbStatementMaxLen = 1000
+
+// dbQueryTracer is a pgx.QueryTracer that records a client span per query
+// run inside a traced job
+type dbQueryTracer struct{}
+
+type dbSpanKey struct{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (dbQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := sqlOperation(data.SQL)
+	_, span := startSpan(ctx, "db "+operation, trace.SpanKindClient)
+	if !span.IsRecording() {
+		return ctx
+	}
+	statement := strings.TrimSpace(data.SQL)
+	if len(statement) > dbStatementMaxLen {
+		statement = statement[:dbStatementMaxLen] + "…"
+	}
+	span.SetAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", operation),
+		attribute.String("db.query.text", statement),
+	)
+	return context.WithValue(ctx, dbSpanKey{}, span)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (dbQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, _ := ctx.Value(dbSpanKey{}).(trace.Span)
+	if span == nil {
+		return
+	}
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		setSpanError(span, data.Err)
+	} else {
+		span.SetAttributes(attribute.Int64("db.response.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// sqlOperation returns a statement's first keyword ("SELECT", "UPDATE", ...)
+func sqlOperation(sql string) string {
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		return strings.ToUpper(strings.TrimRight(strings.Fields(line)[0], "(;"))
+	}
+	return "QUERY"
+}
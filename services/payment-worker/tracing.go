@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// ============================================================================
+// OpenTelemetry Tracing
+//
+// Every River job runs in a span, with child spans for database queries and
+// provider API calls. Spans are batched to an OTLP/HTTP collector by the
+// OpenTelemetry SDK.
+//
+// Trace context crosses process boundaries as a W3C traceparent: in River job
+// metadata (see JobTracingMiddleware and the v0.88.0 river_job trigger) and
+// in the header of outbound HTTP requests.
+//
+// Configured with the standard OTEL_* environment variables; with no
+// endpoint set, tracing is off and spans cost a context lookup.
+// ============================================================================
+
+// tracerName is the instrumentation scope of the worker's spans
+const tracerName = "civic-os/payment-worker"
+
+var (
+	// tracer is the process-wide tracer. It is a no-op until initTracing.
+	tracer trace.Tracer = noop.NewTracerProvider().Tracer(tracerName)
+
+	// tracerProvider exports the spans; nil = tracing off
+	tracerProvider *sdktrace.TracerProvider
+
+	// propagator reads and writes the W3C traceparent
+	propagator = propagation.TraceContext{}
+)
+
+// tracingEnabled reports whether spans are recorded
+func tracingEnabled() bool {
+	return tracerProvider != nil
+}
+
+// startSpan starts a child of the span in ctx. With no recording span in ctx
+// it does nothing: only work inside a traced job is traced, not River's own
+// polling.
+func startSpan(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, noop.Span{}
+	}
+	return tracer.Start(ctx, name, trace.WithSpanKind(kind))
+}
+
+// setSpanError records err on span and marks it failed. A nil err is ignored.
+func setSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// traceparent renders the W3C traceparent of the span in ctx, or ""
+func traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// ============================================================================
+// Configuration
+// ============================================================================
+
+// TracingConfig is read from the standard OpenTelemetry variables. The SDK
+// reads the rest (OTEL_EXPORTER_OTLP_HEADERS, OTEL_RESOURCE_ATTRIBUTES, ...)
+// itself.
+type TracingConfig struct {
+	Endpoint    string // Full /v1/traces URL; empty = tracing off
+	ServiceName string
+	SampleRatio float64 // Fraction of new traces recorded
+}
+
+// tracingConfigFromEnv reads OTEL_EXPORTER_OTLP_(TRACES_)ENDPOINT,
+// OTEL_SERVICE_NAME, OTEL_TRACES_SAMPLER_ARG and OTEL_SDK_DISABLED
+func tracingConfigFromEnv(defaultServiceName string) TracingConfig {
+	cfg := TracingConfig{
+		ServiceName: getEnv("OTEL_SERVICE_NAME", defaultServiceName),
+		SampleRatio: 1,
+	}
+	if getEnvBool("OTEL_SDK_DISABLED", false) {
+		return cfg
+	}
+
+	if endpoint := getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""); endpoint != "" {
+		cfg.Endpoint = endpoint
+	} else if endpoint := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""); endpoint != "" {
+		cfg.Endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+
+	if protocol := getEnv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf"); protocol == "grpc" {
+		log.Printf("[Tracing] OTEL_EXPORTER_OTLP_PROTOCOL=grpc is not supported, exporting http/protobuf")
+	}
+
+	if arg := getEnv("OTEL_TRACES_SAMPLER_ARG", ""); arg != "" {
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			log.Printf("[Tracing] Invalid OTEL_TRACES_SAMPLER_ARG %q, sampling every trace", arg)
+		} else {
+			cfg.SampleRatio = ratio
+		}
+	}
+	return cfg
+}
+
+// tracingSampler samples new traces at ratio and follows the sampling
+// decision of a remote parent
+func tracingSampler(ratio float64) sdktrace.Sampler {
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+}
+
+// initTracing installs the SDK tracer provider with an OTLP/HTTP exporter.
+// It returns false when no endpoint is configured or the exporter can't be
+// created.
+func initTracing(ctx context.Context, cfg TracingConfig) bool {
+	if cfg.Endpoint == "" {
+		return false
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		log.Printf("[Tracing] Failed to create OTLP exporter, tracing disabled: %v", err)
+		return false
+	}
+	// Attributes given here win over OTEL_RESOURCE_ATTRIBUTES
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("service.version", version),
+		),
+	)
+	if err != nil {
+		log.Printf("[Tracing] Incomplete resource: %v", err)
+	}
+	setTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(tracingSampler(cfg.SampleRatio)),
+	))
+	return true
+}
+
+// setTracerProvider makes tp the process-wide provider
+func setTracerProvider(tp *sdktrace.TracerProvider) {
+	tracerProvider = tp
+	tracer = tp.Tracer(tracerName, trace.WithInstrumentationVersion(version))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator)
+}
+
+// shutdownTracing flushes spans that haven't been exported yet
+func shutdownTracing(ctx context.Context) {
+	if !tracingEnabled() {
+		return
+	}
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		log.Printf("[Tracing] Failed to flush spans: %v", err)
+	}
+}
+
+// ============================================================================
+// Outbound HTTP
+// ============================================================================
+
+// tracingTransport wraps an http.RoundTripper with a client span per request
+// and sends the span as the traceparent header. Provider SDK calls are only
+// traced when the request carries the job's context.
+type tracingTransport struct {
+	base       http.RoundTripper
+	peerSystem string // e.g. "keycloak"; names the span
+}
+
+// newTracingTransport wraps base (nil = http.DefaultTransport)
+func newTracingTransport(base http.RoundTripper, peerSystem string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &tracingTransport{base: base, peerSystem: peerSystem}
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := startSpan(req.Context(), req.Method+" "+t.peerSystem, trace.SpanKindClient)
+	if !span.IsRecording() {
+		return t.base.RoundTrip(req)
+	}
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Hostname()),
+		attribute.String("url.path", req.URL.Path),
+		attribute.String("peer.service", t.peerSystem),
+	)
+
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		setSpanError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		setSpanError(span, errors.New(resp.Status))
+	}
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/riverqueue/river/rivertype"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentID    = "00f067aa0ba902b7"
+)
+
+// withTestTracer points the global tracer at an in-memory recorder
+func withTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	savedProvider, savedTracer := tracerProvider, tracer
+	setTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder),
+		sdktrace.WithSampler(tracingSampler(1)),
+	))
+	t.Cleanup(func() { tracerProvider, tracer = savedProvider, savedTracer })
+	return recorder
+}
+
+func TestJobTracingMiddleware_Work(t *testing.T) {
+	recorder := withTestTracer(t)
+
+	mw := &JobTracingMiddleware{}
+	job := &rivertype.JobRow{
+		ID: 42, Kind: "process_refund", Queue: "default", Attempt: 1,
+		Metadata: []byte(`{"traceparent":"` + testTraceparent + `"}`),
+	}
+
+	var inserted []*rivertype.JobInsertParams
+	err := mw.Work(context.Background(), job, func(ctx context.Context) error {
+		_, db := startSpan(ctx, "db UPDATE", trace.SpanKindClient)
+		db.End()
+
+		// Jobs inserted while this one runs continue its trace
+		inserted = []*rivertype.JobInsertParams{{Kind: "capture_payment", Metadata: []byte(`{"source":"x"}`)}}
+		_, err := mw.InsertMany(ctx, inserted, func(context.Context) ([]*rivertype.JobInsertResult, error) { return nil, nil })
+		if err != nil {
+			return err
+		}
+		return errors.New("stripe API error")
+	})
+	if err == nil || err.Error() != "stripe API error" {
+		t.Fatalf("Work() error = %v, want the job's error", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	db, root := spans[0], spans[1]
+	if root.Name() != "process_refund" || root.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("root = %q kind %v", root.Name(), root.SpanKind())
+	}
+	if root.SpanContext().TraceID().String() != testTraceID || root.Parent().SpanID().String() != testParentID {
+		t.Errorf("root trace = %s parent = %s, want the job metadata's", root.SpanContext().TraceID(), root.Parent().SpanID())
+	}
+	if root.Status().Code != codes.Error || root.Status().Description != "stripe API error" {
+		t.Errorf("root status = %+v, want error", root.Status())
+	}
+	if db.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("db span not a child of the job span")
+	}
+
+	got := jobTraceContext(context.Background(), inserted[0].Metadata)
+	if trace.SpanContextFromContext(got).TraceID().String() != testTraceID {
+		t.Errorf("inserted job metadata = %s, want the running job's trace", inserted[0].Metadata)
+	}
+	if !strings.Contains(string(inserted[0].Metadata), `"source":"x"`) {
+		t.Errorf("inserted job metadata lost existing keys: %s", inserted[0].Metadata)
+	}
+}
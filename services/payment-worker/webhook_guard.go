@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Webhook Request Guard
+//
+// The webhook endpoints are public, and every accepted request holds a
+// database connection from the pool the River workers share. WebhookGuard
+// turns junk away before the body is read or a signature checked:
+//   - 403 for a source outside the provider's allowlist
+//     (WEBHOOK_ALLOWED_IPS_<PROVIDER>; Stripe publishes its webhook IPs)
+//   - 429 when a source exceeds WEBHOOK_RATE_LIMIT_PER_MINUTE
+//   - 503 when WEBHOOK_MAX_IN_FLIGHT webhooks are already being processed
+//
+// Providers retry 429 and 503 responses, so a real event turned away under
+// load arrives again later (and the Stripe backfill covers the rest).
+//
+// The source is the connecting address, or, when that address is one of
+// WEBHOOK_TRUSTED_PROXIES, the nearest X-Forwarded-For entry that isn't a
+// trusted proxy. Without trusted proxies X-Forwarded-For is ignored, since
+// anyone can set it.
+// ============================================================================
+
+// WebhookGuardConfig configures a WebhookGuard; zero values disable a check
+type WebhookGuardConfig struct {
+	RatePerMinute  int                       // Requests per source per minute (0 = no limit)
+	Burst          int                       // Requests a source may send at once (default RatePerMinute/6)
+	MaxInFlight    int                       // Webhooks processed at once (0 = no limit)
+	Allowlists     map[string][]netip.Prefix // Sources accepted per provider (missing = any)
+	TrustedProxies []netip.Prefix            // Proxies whose X-Forwarded-For is believed
+}
+
+// WebhookGuard applies the allowlist, rate limit and in-flight cap. A nil
+// guard admits everything.
+type WebhookGuard struct {
+	config   WebhookGuardConfig
+	inFlight chan struct{} // nil when unlimited
+
+	mu        sync.Mutex
+	buckets   map[netip.Addr]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time // tests replace it
+}
+
+// tokenBucket is one source's remaining allowance
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitSweepInterval is how often idle sources are forgotten
+const rateLimitSweepInterval = time.Minute
+
+// NewWebhookGuard creates a guard from config
+func NewWebhookGuard(config WebhookGuardConfig) *WebhookGuard {
+	if config.RatePerMinute > 0 && config.Burst <= 0 {
+		config.Burst = max(1, config.RatePerMinute/6)
+	}
+	g := &WebhookGuard{
+		config:  config,
+		buckets: make(map[netip.Addr]*tokenBucket),
+		now:     time.Now,
+	}
+	if config.MaxInFlight > 0 {
+		g.inFlight = make(chan struct{}, config.MaxInFlight)
+	}
+	return g
+}
+
+// ClientIP returns the request's source address (see the file comment)
+func (g *WebhookGuard) ClientIP(r *http.Request) netip.Addr {
+	remote := parseAddr(r.RemoteAddr)
+	if g == nil || !remote.IsValid() || !containsAddr(g.config.TrustedProxies, remote) {
+		return remote
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseAddr(strings.TrimSpace(hops[i]))
+		if !hop.IsValid() {
+			break // a garbled entry; nothing before it can be trusted
+		}
+		remote = hop
+		if !containsAddr(g.config.TrustedProxies, hop) {
+			break
+		}
+	}
+	return remote
+}
+
+// Allowed reports whether provider accepts webhooks from ip
+func (g *WebhookGuard) Allowed(provider string, ip netip.Addr) bool {
+	if g == nil {
+		return true
+	}
+	allowlist, ok := g.config.Allowlists[provider]
+	return !ok || containsAddr(allowlist, ip)
+}
+
+// Allow takes one request from ip's allowance. When none is left it returns
+// false and how long until the next request would be allowed.
+func (g *WebhookGuard) Allow(ip netip.Addr) (bool, time.Duration) {
+	if g == nil || g.config.RatePerMinute <= 0 {
+		return true, 0
+	}
+	rate := float64(g.config.RatePerMinute) / 60 // tokens per second
+	burst := float64(g.config.Burst)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if now.Sub(g.lastSweep) >= rateLimitSweepInterval {
+		// A bucket that has refilled is the same as no bucket
+		for addr, b := range g.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+				delete(g.buckets, addr)
+			}
+		}
+		g.lastSweep = now
+	}
+
+	b, ok := g.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		g.buckets[ip] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Acquire reserves a processing slot without waiting. The caller must call
+// release when ok is true.
+func (g *WebhookGuard) Acquire() (release func(), ok bool) {
+	if g == nil || g.inFlight == nil {
+		return func() {}, true
+	}
+	select {
+	case g.inFlight <- struct{}{}:
+		return func() { <-g.inFlight }, true
+	default:
+		return nil, false
+	}
+}
+
+// requestIDPattern accepts a caller's X-Request-ID worth repeating in logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// requestID returns the request's X-Request-ID (set by a proxy in front of
+// the worker), or a new random one
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); requestIDPattern.MatchString(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// parseAddr parses an IP address with or without a port
+func parseAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// containsAddr reports whether any prefix contains addr
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookGuard_ClientIP(t *testing.T) {
+	proxies, _ := parsePrefixes("10.0.0.0/8")
+	guard := NewWebhookGuard(WebhookGuardConfig{TrustedProxies: proxies})
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"direct", "3.18.12.63:4431", "", "3.18.12.63"},
+		{"forwarded header from an untrusted peer is ignored", "3.18.12.63:4431", "1.2.3.4", "3.18.12.63"},
+		{"through the proxy", "10.1.2.3:80", "3.18.12.63", "3.18.12.63"},
+		{"spoofed entry before the real client", "10.1.2.3:80", "1.2.3.4, 3.18.12.63", "3.18.12.63"},
+		{"two proxies", "10.1.2.3:80", "3.18.12.63, 10.9.9.9", "3.18.12.63"},
+		{"garbled entry stops the walk", "10.1.2.3:80", "3.18.12.63, junk", "10.1.2.3"},
+		{"IPv4-mapped IPv6", "[::ffff:3.18.12.63]:4431", "", "3.18.12.63"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := guard.ClientIP(req); got.String() != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookGuard_Allow(t *testing.T) {
+	guard := NewWebhookGuard(WebhookGuardConfig{RatePerMinute: 60, Burst: 2})
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	guard.now = func() time.Time { return now }
+	a, b := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := guard.Allow(a); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := guard.Allow(a)
+	if ok || wait != time.Second {
+		t.Errorf("third request = %v (retry in %s), want refused with 1s", ok, wait)
+	}
+	if ok, _ := guard.Allow(b); !ok {
+		t.Error("another source shares the first one's allowance")
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	if ok, _ := guard.Allow(a); !ok {
+		t.Error("allowance didn't refill")
+	}
+
+	// Idle sources are forgotten once refilled
+	now = now.Add(rateLimitSweepInterval)
+	guard.Allow(b)
+	if len(guard.buckets) != 1 {
+		t.Errorf("%d buckets after the sweep, want 1", len(guard.buckets))
+	}
+
+	if ok, _ := (*WebhookGuard)(nil).Allow(a); !ok {
+		t.Error("a nil guard refused a request")
+	}
+}
+
+func TestWebhookGuard_Acquire(t *testing.T) {
+	guard := NewWebhookGuard(WebhookGuardConfig{MaxInFlight: 1})
+	release, ok := guard.Acquire()
+	if !ok {
+		t.Fatal("first slot refused")
+	}
+	if _, ok := guard.Acquire(); ok {
+		t.Error("second slot granted with MaxInFlight 1")
+	}
+	release()
+	if _, ok := guard.Acquire(); !ok {
+		t.Error("slot not returned by release")
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := parsePrefixes(" 3.18.12.63, 10.1.0.0/16 ,2001:db8::/32,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"3.18.12.63/32", "10.1.0.0/16", "2001:db8::/32"}
+	if len(got) != len(want) {
+		t.Fatalf("parsePrefixes() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if _, err := parsePrefixes("3.18.12"); err == nil {
+		t.Error("parsePrefixes accepted a partial address")
+	}
+}
+
+func TestWebhookHTTPServer_Guard(t *testing.T) {
+	allowlist, _ := parsePrefixes("3.18.12.63")
+	provider := &StripeProvider{webhookSecret: "whsec_test"}
+	newServer := func(config WebhookGuardConfig) *WebhookHTTPServer {
+		return NewWebhookHTTPServer(NewWebhookHandler(nil), NewProviderRegistry(provider), &reprocessInserter{},
+			nil, NewWebhookGuard(config), "", "", "0")
+	}
+	post := func(server *WebhookHTTPServer, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", strings.NewReader(`{"id":"evt_1"}`))
+		req.RemoteAddr = remote
+		req.Header.Set("X-Request-ID", "req-1")
+		rec := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	server := newServer(WebhookGuardConfig{Allowlists: map[string][]netip.Prefix{"stripe": allowlist}})
+	if rec := post(server, "192.0.2.1:5000"); rec.Code != http.StatusForbidden {
+		t.Errorf("outside the allowlist: status = %d, want 403", rec.Code)
+	}
+	// Allowed through to signature verification, which fails
+	rec := post(server, "3.18.12.63:5000")
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("X-Request-ID") != "req-1" {
+		t.Errorf("allowlisted: status = %d, request ID %q, want 400 and req-1", rec.Code, rec.Header().Get("X-Request-ID"))
+	}
+
+	server = newServer(WebhookGuardConfig{RatePerMinute: 60, Burst: 1})
+	post(server, "192.0.2.1:5000")
+	if rec := post(server, "192.0.2.1:5000"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("over the rate: status = %d, Retry-After %q, want 429 and 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	server = newServer(WebhookGuardConfig{MaxInFlight: 1})
+	release, _ := server.guard.Acquire()
+	defer release()
+	if rec := post(server, "192.0.2.1:5000"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("in-flight cap reached: status = %d, want 503", rec.Code)
+	}
+}
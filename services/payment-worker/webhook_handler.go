@@ -2,28 +2,27 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/stripe/stripe-go/v81"
 )
 
-// WebhookHandler processes Stripe webhook events with database transactions
+// WebhookHandler processes verified provider webhook events with database transactions
 type WebhookHandler struct {
 	dbPool *pgxpool.Pool
+	dryRun *DryRun // set under DRY_RUN; approved payments are not captured
 }
 
 func NewWebhookHandler(dbPool *pgxpool.Pool) *WebhookHandler {
 	return &WebhookHandler{dbPool: dbPool}
 }
 
-// ProcessStripeWebhook handles a verified Stripe webhook event
+// ProcessWebhook handles a webhook event already verified by its provider
 // Returns nil on success (including duplicates), error triggers HTTP 500
-func (h *WebhookHandler) ProcessStripeWebhook(ctx context.Context, event stripe.Event) error {
-	log.Printf("[Webhook] Processing event: id=%s, type=%s", event.ID, event.Type)
+func (h *WebhookHandler) ProcessWebhook(ctx context.Context, provider PaymentProvider, event *WebhookEvent) error {
+	log.Printf("[Webhook] Processing event: provider=%s, id=%s, type=%s", event.Provider, event.EventID, event.EventType)
 
 	// Begin transaction
 	tx, err := h.dbPool.Begin(ctx)
@@ -32,13 +31,8 @@ func (h *WebhookHandler) ProcessStripeWebhook(ctx context.Context, event stripe.
 	}
 	defer tx.Rollback(ctx) // Auto-rollback if not committed
 
-	// Serialize event to JSONB
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("marshal event: %w", err)
-	}
-
-	// Insert webhook with idempotency check
+	// Insert webhook with idempotency check. A row that failed before is
+	// claimed again, so provider retries (and backfill) can still process it.
 	var webhookID string
 	err = tx.QueryRow(ctx, `
 		INSERT INTO metadata.webhooks (
@@ -49,14 +43,16 @@ func (h *WebhookHandler) ProcessStripeWebhook(ctx context.Context, event stripe.
 			signature_verified,
 			processed
 		) VALUES ($1, $2, $3, $4, TRUE, FALSE)
-		ON CONFLICT (provider, provider_event_id) DO NOTHING
+		ON CONFLICT (provider, provider_event_id) DO UPDATE
+			SET signature_verified = TRUE
+			WHERE NOT webhooks.processed
 		RETURNING id
-	`, "stripe", event.ID, event.Type, eventJSON).Scan(&webhookID)
+	`, event.Provider, event.EventID, event.EventType, event.Payload).Scan(&webhookID)
 
 	if err == pgx.ErrNoRows {
 		// Duplicate webhook - already processed
-		log.Printf("[Webhook] Duplicate event %s, skipping", event.ID)
-		return nil // Return success (200 OK to Stripe)
+		log.Printf("[Webhook] Duplicate event %s, skipping", event.EventID)
+		return nil // Return success (200 OK to provider)
 	}
 	if err != nil {
 		return fmt.Errorf("insert webhook: %w", err)
@@ -64,27 +60,29 @@ func (h *WebhookHandler) ProcessStripeWebhook(ctx context.Context, event stripe.
 
 	log.Printf("[Webhook] Created webhook record: %s", webhookID)
 
-	// Route to handler based on event type
-	var processingErr error
-	switch event.Type {
-	case "payment_intent.succeeded":
-		processingErr = h.handlePaymentIntentSucceeded(ctx, tx, event)
-	case "payment_intent.payment_failed":
-		processingErr = h.handlePaymentIntentFailed(ctx, tx, event)
-	case "payment_intent.canceled":
-		processingErr = h.handlePaymentIntentCanceled(ctx, tx, event)
-	case "charge.refunded":
-		processingErr = h.handleChargeRefunded(ctx, tx, event)
-	default:
-		// Unknown event type - just mark as processed
-		log.Printf("[Webhook] Unknown event type '%s', marking as processed", event.Type)
-		processingErr = nil
+	return h.process(ctx, tx, webhookID, provider, event)
+}
+
+// process routes a stored webhook to its handler and commits tx. On failure
+// the handler's changes are rolled back to a savepoint and the webhook row
+// keeps the error, so it can be reprocessed later.
+func (h *WebhookHandler) process(ctx context.Context, tx pgx.Tx, webhookID string, provider PaymentProvider, event *WebhookEvent) error {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin savepoint: %w", err)
 	}
 
-	if processingErr != nil {
-		// Mark webhook with error
-		h.markWebhookError(ctx, tx, webhookID, processingErr.Error())
-		return processingErr // Rollback transaction, return 500 to Stripe
+	if processingErr := h.route(ctx, savepoint, provider, event); processingErr != nil {
+		savepoint.Rollback(ctx)
+		if err := h.markWebhookError(ctx, tx, webhookID, processingErr.Error()); err == nil {
+			if err := tx.Commit(ctx); err != nil {
+				log.Printf("[Webhook] Failed to record error for %s: %v", event.EventID, err)
+			}
+		}
+		return processingErr // Return 500 so the provider retries
+	}
+	if err := savepoint.Commit(ctx); err != nil {
+		return fmt.Errorf("release savepoint: %w", err)
 	}
 
 	// Mark webhook as processed
@@ -97,129 +95,229 @@ func (h *WebhookHandler) ProcessStripeWebhook(ctx context.Context, event stripe.
 		return fmt.Errorf("commit transaction: %w", err)
 	}
 
-	log.Printf("[Webhook] ✓ Event %s processed successfully", event.ID)
+	log.Printf("[Webhook] ✓ Event %s processed successfully", event.EventID)
 	return nil
 }
 
-// handlePaymentIntentSucceeded updates payment status to 'succeeded'
-func (h *WebhookHandler) handlePaymentIntentSucceeded(ctx context.Context, tx pgx.Tx, event stripe.Event) error {
-	var paymentIntent stripe.PaymentIntent
-	if err := json.Unmarshal(event.Data.Raw, &paymentIntent); err != nil {
-		return fmt.Errorf("unmarshal payment_intent: %w", err)
+// route dispatches an event to the handler for its normalized kind
+func (h *WebhookHandler) route(ctx context.Context, tx pgx.Tx, provider PaymentProvider, event *WebhookEvent) error {
+	switch event.Kind {
+	case WebhookPaymentApproved:
+		return h.handlePaymentApproved(ctx, provider, event)
+	case WebhookPaymentProcessing:
+		return h.handlePaymentProcessing(ctx, tx, event)
+	case WebhookPaymentAuthorized:
+		return h.handlePaymentAuthorized(ctx, tx, event)
+	case WebhookMandateAccepted:
+		return h.handleMandateAccepted(ctx, tx, event)
+	case WebhookPaymentSucceeded:
+		return h.updatePaymentStatus(ctx, tx, event, "succeeded")
+	case WebhookPaymentFailed:
+		return h.updatePaymentStatus(ctx, tx, event, "failed")
+	case WebhookPaymentCanceled:
+		return h.updatePaymentStatus(ctx, tx, event, "canceled")
+	case WebhookRefundSucceeded:
+		return h.handleRefundSucceeded(ctx, tx, event)
+	case WebhookRefundFailed:
+		return h.handleRefundFailed(ctx, tx, event)
+	case WebhookInvoicePaid:
+		return h.handleInvoicePaid(ctx, tx, event)
+	case WebhookInvoicePaymentFailed:
+		return h.handleInvoicePaymentFailed(ctx, tx, event)
+	case WebhookSubscriptionUpdated:
+		return h.handleSubscriptionUpdated(ctx, tx, event)
+	case WebhookTransferUpdated:
+		return h.handleTransferUpdated(ctx, tx, event)
+	case WebhookPayoutUpdated:
+		return h.handlePayoutUpdated(ctx, tx, event)
+	case WebhookAccountUpdated:
+		return h.handleAccountUpdated(ctx, tx, event)
+	case WebhookDisputeUpdated:
+		return h.handleDisputeUpdated(ctx, tx, event)
+	default:
+		// Unknown event type - just mark as processed
+		log.Printf("[Webhook] Unhandled event type '%s', marking as processed", event.EventType)
+		return nil
 	}
+}
 
-	log.Printf("[Webhook] Marking payment %s as succeeded", paymentIntent.ID)
+// handlePaymentApproved captures a payment the buyer approved client-side.
+// The provider's capture-completed webhook then marks it succeeded.
+func (h *WebhookHandler) handlePaymentApproved(ctx context.Context, provider PaymentProvider, event *WebhookEvent) error {
+	capturer, ok := provider.(approvalCapturer)
+	if !ok {
+		log.Printf("[Webhook] Provider %s does not capture on approval, ignoring", provider.Name())
+		return nil
+	}
+	if event.ProviderPaymentID == "" {
+		return fmt.Errorf("approval event %s has no payment ID", event.EventID)
+	}
+	if h.dryRun.Skip(ctx, provider.Name(), "capture_approved", event.ProviderPaymentID, map[string]any{"event_id": event.EventID}) {
+		return nil
+	}
+	return capturer.CaptureApproved(ctx, event.ProviderPaymentID)
+}
 
-	result, err := tx.Exec(ctx, `
-		UPDATE payments.transactions
-		SET status = 'succeeded', updated_at = NOW()
-		WHERE provider_payment_id = $1
-	`, paymentIntent.ID)
+// updatePaymentStatus moves the transaction for a provider payment to a
+// terminal status ('succeeded', 'failed', or 'canceled'). An expired payment
+// (see payment_expiry.go) only leaves 'expired' for 'succeeded': the cancel
+// the expiry job requested is reported back as canceled, but a payer who
+// completed checkout anyway was charged.
+func (h *WebhookHandler) updatePaymentStatus(ctx context.Context, tx pgx.Tx, event *WebhookEvent, status string) error {
+	if event.ProviderPaymentID == "" {
+		log.Printf("[Webhook] ⚠ Event %s has no payment ID, skipping", event.EventID)
+		return nil
+	}
 
+	var previous string
+	err := tx.QueryRow(ctx, `
+		SELECT status
+		FROM payments.transactions
+		WHERE provider = $1 AND provider_payment_id = $2
+		FOR UPDATE
+	`, event.Provider, event.ProviderPaymentID).Scan(&previous)
+	if err == pgx.ErrNoRows {
+		// Payment not found - likely an orphaned intent from a retry
+		// When users retry failed payments, we create a new transaction and new intent
+		// Old intents may still complete if user had the form open
+		// This is safe to ignore - the new transaction is what matters
+		log.Printf("[Webhook] ⚠ Payment %s not found (likely orphaned from retry), marking webhook as processed", event.ProviderPaymentID)
+		return nil // Return success to avoid provider retries
+	}
 	if err != nil {
-		return fmt.Errorf("update payment: %w", err)
+		return fmt.Errorf("query payment: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
-		// Payment not found - likely an orphaned PaymentIntent from a retry
-		// When users retry failed payments, we create a new transaction and new PaymentIntent
-		// Old PaymentIntents may still complete if user had the form open
-		// This is safe to ignore - the new transaction is what matters
-		log.Printf("[Webhook] ⚠ Payment %s not found (likely orphaned from retry), marking webhook as processed", paymentIntent.ID)
-		return nil // Return success to avoid Stripe retries
+	var errorMessage *string
+	if previous == "expired" {
+		if status != "succeeded" {
+			log.Printf("[Webhook] Payment %s already expired, ignoring %s", event.ProviderPaymentID, status)
+			return nil
+		}
+		// The entity may have started a new payment since; flag a possible duplicate
+		msg := "Completed after checkout expired; check for a second payment for the same record"
+		errorMessage = &msg
+		log.Printf("[Webhook] ⚠ Payment %s succeeded after it expired", event.ProviderPaymentID)
+	}
+
+	log.Printf("[Webhook] Marking payment %s as %s", event.ProviderPaymentID, status)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE payments.transactions
+		SET status = $1, error_message = COALESCE($4, error_message), updated_at = NOW()
+		WHERE provider = $2 AND provider_payment_id = $3
+	`, status, event.Provider, event.ProviderPaymentID, errorMessage)
+
+	if err != nil {
+		return fmt.Errorf("update payment: %w", err)
 	}
 
-	log.Printf("[Webhook] ✓ Payment %s marked as succeeded", paymentIntent.ID)
+	log.Printf("[Webhook] ✓ Payment %s marked as %s", event.ProviderPaymentID, status)
 	return nil
 }
 
-// handlePaymentIntentFailed updates payment status to 'failed'
-func (h *WebhookHandler) handlePaymentIntentFailed(ctx context.Context, tx pgx.Tx, event stripe.Event) error {
-	var paymentIntent stripe.PaymentIntent
-	if err := json.Unmarshal(event.Data.Raw, &paymentIntent); err != nil {
-		return fmt.Errorf("unmarshal payment_intent: %w", err)
+// handlePaymentProcessing marks a confirmed payment that has not settled yet
+// (ACH debits). Providers don't guarantee event order, so a processing event
+// that arrives after succeeded/failed must not move the payment back.
+func (h *WebhookHandler) handlePaymentProcessing(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	if event.ProviderPaymentID == "" {
+		log.Printf("[Webhook] ⚠ Event %s has no payment ID, skipping", event.EventID)
+		return nil
 	}
 
-	log.Printf("[Webhook] Marking payment %s as failed", paymentIntent.ID)
-
 	result, err := tx.Exec(ctx, `
 		UPDATE payments.transactions
-		SET status = 'failed', updated_at = NOW()
-		WHERE provider_payment_id = $1
-	`, paymentIntent.ID)
-
+		SET status = 'processing', updated_at = NOW()
+		WHERE provider = $1 AND provider_payment_id = $2
+		AND status IN ('pending_intent', 'pending')
+	`, event.Provider, event.ProviderPaymentID)
 	if err != nil {
 		return fmt.Errorf("update payment: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
-		// Payment not found - likely an orphaned PaymentIntent from a retry
-		log.Printf("[Webhook] ⚠ Payment %s not found (likely orphaned from retry), marking webhook as processed", paymentIntent.ID)
-		return nil // Return success to avoid Stripe retries
+		log.Printf("[Webhook] Payment %s not pending (already final or orphaned), ignoring processing event", event.ProviderPaymentID)
+		return nil
 	}
 
-	log.Printf("[Webhook] ✓ Payment %s marked as failed", paymentIntent.ID)
+	log.Printf("[Webhook] ✓ Payment %s marked as processing", event.ProviderPaymentID)
 	return nil
 }
 
-// handlePaymentIntentCanceled updates payment status to 'canceled'
-func (h *WebhookHandler) handlePaymentIntentCanceled(ctx context.Context, tx pgx.Tx, event stripe.Event) error {
-	var paymentIntent stripe.PaymentIntent
-	if err := json.Unmarshal(event.Data.Raw, &paymentIntent); err != nil {
-		return fmt.Errorf("unmarshal payment_intent: %w", err)
+// handlePaymentAuthorized marks a manual-capture payment whose card was
+// authorized. The hold lasts about 7 days for online card payments, which
+// becomes capture_before; payments.expire_uncaptured_authorizations voids
+// anything still uncaptured then. Like processing, it only applies to
+// payments that haven't reached a later status.
+func (h *WebhookHandler) handlePaymentAuthorized(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	if event.ProviderPaymentID == "" {
+		log.Printf("[Webhook] ⚠ Event %s has no payment ID, skipping", event.EventID)
+		return nil
 	}
 
-	log.Printf("[Webhook] Marking payment %s as canceled", paymentIntent.ID)
-
 	result, err := tx.Exec(ctx, `
 		UPDATE payments.transactions
-		SET status = 'canceled', updated_at = NOW()
-		WHERE provider_payment_id = $1
-	`, paymentIntent.ID)
-
+		SET
+			status = 'requires_capture',
+			authorized_at = NOW(),
+			capture_before = NOW() + INTERVAL '7 days',
+			updated_at = NOW()
+		WHERE provider = $1 AND provider_payment_id = $2
+		AND status IN ('pending_intent', 'pending')
+	`, event.Provider, event.ProviderPaymentID)
 	if err != nil {
 		return fmt.Errorf("update payment: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
-		// Payment not found - likely an orphaned PaymentIntent from a retry
-		log.Printf("[Webhook] ⚠ Payment %s not found (likely orphaned from retry), marking webhook as processed", paymentIntent.ID)
-		return nil // Return success to avoid Stripe retries
+		log.Printf("[Webhook] Payment %s not pending (already final or orphaned), ignoring authorization event", event.ProviderPaymentID)
+		return nil
 	}
 
-	log.Printf("[Webhook] ✓ Payment %s marked as canceled", paymentIntent.ID)
+	log.Printf("[Webhook] ✓ Payment %s authorized, awaiting capture", event.ProviderPaymentID)
 	return nil
 }
 
-// handleChargeRefunded updates refund status based on Stripe webhook
-// This serves as confirmation that Stripe processed the refund
-//
-// Design note: With 1:M refund support, there could be multiple refunds per payment.
-// However, the initiate_payment_refund RPC blocks concurrent refunds (only one pending
-// at a time), so this handler should only ever update one refund per webhook.
-// The RefundWorker is the primary mechanism for updating refund status; this webhook
-// is belt-and-suspenders confirmation.
-func (h *WebhookHandler) handleChargeRefunded(ctx context.Context, tx pgx.Tx, event stripe.Event) error {
-	var charge stripe.Charge
-	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
-		return fmt.Errorf("unmarshal charge: %w", err)
+// handleMandateAccepted records the debit mandate the payer accepted so the
+// authorization can be produced if the debit is disputed
+func (h *WebhookHandler) handleMandateAccepted(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	if event.ProviderPaymentID == "" || event.MandateID == "" {
+		log.Printf("[Webhook] ⚠ Mandate event %s has no payment or mandate ID, skipping", event.EventID)
+		return nil
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE payments.transactions
+		SET mandate_id = $1, updated_at = NOW()
+		WHERE provider = $2 AND provider_payment_id = $3
+		AND mandate_id IS DISTINCT FROM $1
+	`, event.MandateID, event.Provider, event.ProviderPaymentID)
+	if err != nil {
+		return fmt.Errorf("update mandate: %w", err)
 	}
 
-	// Get the payment intent ID from the charge
-	paymentIntentID := ""
-	if charge.PaymentIntent != nil {
-		paymentIntentID = charge.PaymentIntent.ID
+	if result.RowsAffected() > 0 {
+		log.Printf("[Webhook] ✓ Recorded mandate %s for payment %s", event.MandateID, event.ProviderPaymentID)
 	}
+	return nil
+}
 
-	log.Printf("[Webhook] Processing refund for charge %s (payment_intent=%s)", charge.ID, paymentIntentID)
+// handleRefundSucceeded updates refund status based on a provider webhook
+// This serves as confirmation that the provider processed the refund
+//
+// Design note: several refunds can be pending for one payment at a time, so the
+// refund row is matched by provider_refund_id only. Payment-level events (Stripe
+// charge.refunded) can't say which refund completed and are only logged.
+// The RefundWorker is the primary mechanism for updating refund status; this webhook
+// is belt-and-suspenders confirmation.
+func (h *WebhookHandler) handleRefundSucceeded(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	log.Printf("[Webhook] Processing refund (payment=%s, refund=%s)", event.ProviderPaymentID, event.ProviderRefundID)
 
-	if paymentIntentID == "" {
-		log.Printf("[Webhook] ⚠ Charge %s has no payment_intent, skipping", charge.ID)
+	if event.ProviderRefundID == "" {
+		log.Printf("[Webhook] Refund event %s doesn't identify the refund, leaving confirmation to the RefundWorker", event.EventID)
 		return nil
 	}
 
-	// Update any pending refunds for this payment to succeeded
-	// With the concurrent refund block in the RPC, there should be at most one pending refund
 	result, err := tx.Exec(ctx, `
 		UPDATE payments.refunds r
 		SET
@@ -227,26 +325,352 @@ func (h *WebhookHandler) handleChargeRefunded(ctx context.Context, tx pgx.Tx, ev
 			processed_at = COALESCE(r.processed_at, NOW())
 		FROM payments.transactions t
 		WHERE r.transaction_id = t.id
-		AND t.provider_payment_id = $1
+		AND t.provider = $1
+		AND r.provider_refund_id = $2
 		AND r.status = 'pending'
-	`, paymentIntentID)
-
+	`, event.Provider, event.ProviderRefundID)
 	if err != nil {
 		return fmt.Errorf("update refund status: %w", err)
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected > 0 {
-		log.Printf("[Webhook] ✓ Updated %d pending refund(s) to succeeded for payment %s", rowsAffected, paymentIntentID)
-		if rowsAffected > 1 {
-			// This shouldn't happen with the RPC's concurrent refund block
-			log.Printf("[Webhook] ⚠ WARNING: Multiple pending refunds updated. This indicates a possible race condition.")
-		}
+	if result.RowsAffected() > 0 {
+		log.Printf("[Webhook] ✓ Refund %s updated to succeeded", event.ProviderRefundID)
 	} else {
-		// No pending refunds found - either already processed by RefundWorker or refund initiated externally
-		log.Printf("[Webhook] No pending refunds found for payment %s (already processed or refund initiated externally)", paymentIntentID)
+		// Already processed by RefundWorker or refund initiated externally
+		log.Printf("[Webhook] No pending refund %s found (already processed or refund initiated externally)", event.ProviderRefundID)
+	}
+
+	return nil
+}
+
+// handleRefundFailed marks a refund failed after the provider accepted it,
+// e.g. an ACH refund the customer's bank returned. The refund_balance trigger
+// takes it back out of the transaction's refunded_amount_cents.
+func (h *WebhookHandler) handleRefundFailed(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	log.Printf("[Webhook] Processing failed refund (payment=%s, refund=%s)", event.ProviderPaymentID, event.ProviderRefundID)
+
+	if event.ProviderRefundID == "" {
+		log.Printf("[Webhook] ⚠ Failed refund event %s has no refund ID, skipping", event.EventID)
+		return nil
+	}
+
+	var previousStatus string
+	err := tx.QueryRow(ctx, `
+		UPDATE payments.refunds r
+		SET
+			status = 'failed',
+			error_message = $3,
+			processed_at = NOW()
+		FROM payments.refunds prev, payments.transactions t
+		WHERE prev.id = r.id
+		AND r.transaction_id = t.id
+		AND t.provider = $1
+		AND r.provider_refund_id = $2
+		AND r.status != 'failed'
+		RETURNING prev.status
+	`, event.Provider, event.ProviderRefundID, event.FailureMessage).Scan(&previousStatus)
+	if err == nil {
+		log.Printf("[Webhook] ✓ Refund %s marked failed (was %s): %s", event.ProviderRefundID, previousStatus, event.FailureMessage)
+		workerMetrics.RefundErrors.Inc(refundErrorAsync)
+		return nil
+	}
+	if err != pgx.ErrNoRows {
+		return fmt.Errorf("mark refund failed: %w", err)
+	}
+
+	// The RefundWorker records provider_refund_id after the provider call
+	// returns. If a refund for this payment is still pending, the event may
+	// have beaten it; fail so the provider redelivers.
+	if event.ProviderPaymentID != "" {
+		var unrecorded bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM payments.refunds r
+				JOIN payments.transactions t ON r.transaction_id = t.id
+				WHERE t.provider = $1
+				AND t.provider_payment_id = $2
+				AND r.status = 'pending'
+				AND r.provider_refund_id IS NULL
+			)
+		`, event.Provider, event.ProviderPaymentID).Scan(&unrecorded)
+		if err != nil {
+			return fmt.Errorf("check pending refunds: %w", err)
+		}
+		if unrecorded {
+			return fmt.Errorf("refund %s not recorded yet for payment %s", event.ProviderRefundID, event.ProviderPaymentID)
+		}
+	}
+
+	log.Printf("[Webhook] No refund %s found (already failed or refund initiated externally)", event.ProviderRefundID)
+	return nil
+}
+
+// handleInvoicePaid records a paid subscription invoice. The first invoice
+// already has a transaction (created with the subscription); renewals get a
+// new one copied from the subscription. Either way the subscription becomes
+// active once an invoice is paid.
+func (h *WebhookHandler) handleInvoicePaid(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	subscriptionID, err := h.lookupSubscription(ctx, tx, event)
+	if err != nil || subscriptionID == "" {
+		return err
+	}
+
+	if err := h.recordInvoicePayment(ctx, tx, subscriptionID, event, "succeeded", ""); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE payments.subscriptions
+		SET
+			last_payment_at = NOW(),
+			status = CASE WHEN status IN ('incomplete', 'past_due', 'unpaid') THEN 'active' ELSE status END
+		WHERE id = $1
+	`, subscriptionID)
+	if err != nil {
+		return fmt.Errorf("update subscription: %w", err)
+	}
+
+	log.Printf("[Webhook] ✓ Invoice %s paid for subscription %s", event.ProviderInvoiceID, subscriptionID)
+	return nil
+}
+
+// handleInvoicePaymentFailed records a failed subscription charge and marks
+// the subscription past_due. The provider keeps retrying per its dunning
+// settings and sends customer.subscription.updated if it gives up.
+func (h *WebhookHandler) handleInvoicePaymentFailed(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	subscriptionID, err := h.lookupSubscription(ctx, tx, event)
+	if err != nil || subscriptionID == "" {
+		return err
+	}
+
+	if err := h.recordInvoicePayment(ctx, tx, subscriptionID, event, "failed", event.FailureMessage); err != nil {
+		return err
+	}
+
+	// The first invoice failing leaves the subscription incomplete; the
+	// customer can retry it at checkout
+	_, err = tx.Exec(ctx, `
+		UPDATE payments.subscriptions
+		SET status = 'past_due'
+		WHERE id = $1 AND status = 'active'
+	`, subscriptionID)
+	if err != nil {
+		return fmt.Errorf("update subscription: %w", err)
+	}
+
+	log.Printf("[Webhook] ✓ Invoice %s payment failed for subscription %s", event.ProviderInvoiceID, subscriptionID)
+	return nil
+}
+
+// handleSubscriptionUpdated syncs status, period and cancellation from the
+// provider's copy of the subscription
+func (h *WebhookHandler) handleSubscriptionUpdated(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	subscriptionID, err := h.lookupSubscription(ctx, tx, event)
+	if err != nil || subscriptionID == "" {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE payments.subscriptions
+		SET
+			status = $2,
+			current_period_end = COALESCE(to_timestamp(NULLIF($3::BIGINT, 0)), current_period_end),
+			cancel_at_period_end = $4,
+			canceled_at = COALESCE(to_timestamp(NULLIF($5::BIGINT, 0)), canceled_at)
+		WHERE id = $1
+	`, subscriptionID, subscriptionStatus(event.SubscriptionStatus), event.CurrentPeriodEnd,
+		event.CancelAtPeriodEnd, event.CanceledAt)
+	if err != nil {
+		return fmt.Errorf("update subscription: %w", err)
+	}
+
+	log.Printf("[Webhook] ✓ Subscription %s synced (status=%s)", subscriptionID, event.SubscriptionStatus)
+	return nil
+}
+
+// handleTransferUpdated records the transfer a destination charge created,
+// and how much of it refunds have reversed. The transfer group is the
+// payment ID set when the intent was created.
+func (h *WebhookHandler) handleTransferUpdated(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	if event.TransferGroup == "" {
+		log.Printf("[Webhook] Transfer %s has no transfer group, not a Civic OS destination charge", event.ProviderTransferID)
+		return nil
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE payments.transactions
+		SET provider_transfer_id = $1, transfer_reversed_cents = $2, updated_at = NOW()
+		WHERE id::TEXT = $3 AND provider = $4 AND connected_account_id IS NOT NULL
+	`, event.ProviderTransferID, event.AmountReversedCents, event.TransferGroup, event.Provider)
+	if err != nil {
+		return fmt.Errorf("update transfer: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		log.Printf("[Webhook] ⚠ No routed payment %s for transfer %s", event.TransferGroup, event.ProviderTransferID)
+		return nil
 	}
+	log.Printf("[Webhook] ✓ Transfer %s to %s recorded for payment %s (%d of %d cents reversed)",
+		event.ProviderTransferID, event.ProviderAccountID, event.TransferGroup, event.AmountReversedCents, event.AmountCents)
+	return nil
+}
+
+// handlePayoutUpdated upserts a connected account's payout. Payout events can
+// arrive out of order, so a final status (paid, failed, canceled) is never
+// replaced by an earlier one.
+func (h *WebhookHandler) handlePayoutUpdated(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO payments.payouts (
+			connected_account_id, provider_account_id, provider_payout_id,
+			amount_cents, currency, status, arrival_date, failure_message
+		) VALUES (
+			(SELECT id FROM payments.connected_accounts WHERE provider_account_id = $1),
+			$1, $2, $3, $4, $5, to_timestamp(NULLIF($6::BIGINT, 0)), NULLIF($7, '')
+		)
+		ON CONFLICT (provider_payout_id) DO UPDATE SET
+			amount_cents = EXCLUDED.amount_cents,
+			status = CASE
+				WHEN payouts.status IN ('paid', 'failed', 'canceled')
+				 AND EXCLUDED.status NOT IN ('paid', 'failed', 'canceled')
+				THEN payouts.status
+				ELSE EXCLUDED.status
+			END,
+			arrival_date = COALESCE(EXCLUDED.arrival_date, payouts.arrival_date),
+			failure_message = COALESCE(EXCLUDED.failure_message, payouts.failure_message),
+			updated_at = NOW()
+	`, event.ProviderAccountID, event.ProviderPayoutID, event.AmountCents, event.Currency,
+		event.PayoutStatus, event.ArrivalDate, event.FailureMessage)
+	if err != nil {
+		return fmt.Errorf("upsert payout: %w", err)
+	}
+
+	log.Printf("[Webhook] ✓ Payout %s for %s: %s (%d cents)",
+		event.ProviderPayoutID, event.ProviderAccountID, event.PayoutStatus, event.AmountCents)
+	return nil
+}
+
+// handleAccountUpdated syncs a connected account's capabilities
+func (h *WebhookHandler) handleAccountUpdated(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	result, err := tx.Exec(ctx, `
+		UPDATE payments.connected_accounts
+		SET charges_enabled = $2, payouts_enabled = $3, updated_at = NOW()
+		WHERE provider_account_id = $1
+	`, event.ProviderAccountID, event.ChargesEnabled, event.PayoutsEnabled)
+	if err != nil {
+		return fmt.Errorf("update connected account: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		log.Printf("[Webhook] Account %s is not a configured connected account, ignoring", event.ProviderAccountID)
+		return nil
+	}
+	log.Printf("[Webhook] ✓ Connected account %s synced (charges=%t, payouts=%t)",
+		event.ProviderAccountID, event.ChargesEnabled, event.PayoutsEnabled)
+	return nil
+}
+
+// handleDisputeUpdated upserts a dispute against one of our payments. Disputes
+// on payments Civic OS didn't create are kept with no transaction, so the
+// daily summary still counts them.
+func (h *WebhookHandler) handleDisputeUpdated(ctx context.Context, tx pgx.Tx, event *WebhookEvent) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO payments.disputes (
+			transaction_id, provider, provider_dispute_id, provider_payment_id,
+			amount_cents, currency, reason, status, opened_at, closed_at
+		) VALUES (
+			(SELECT id FROM payments.transactions WHERE provider = $1 AND provider_payment_id = NULLIF($3, '')),
+			$1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7,
+			COALESCE(to_timestamp(NULLIF($8::BIGINT, 0)), NOW()),
+			CASE WHEN $7 IN ('won', 'lost') THEN NOW() END
+		)
+		ON CONFLICT (provider, provider_dispute_id) DO UPDATE SET
+			amount_cents = EXCLUDED.amount_cents,
+			reason = COALESCE(EXCLUDED.reason, disputes.reason),
+			status = EXCLUDED.status,
+			closed_at = COALESCE(disputes.closed_at, EXCLUDED.closed_at),
+			updated_at = NOW()
+	`, event.Provider, event.ProviderDisputeID, event.ProviderPaymentID, event.AmountCents, event.Currency,
+		event.DisputeReason, event.DisputeStatus, event.DisputeCreated)
+	if err != nil {
+		return fmt.Errorf("upsert dispute: %w", err)
+	}
+
+	log.Printf("[Webhook] ✓ Dispute %s on payment %s: %s (%d cents, %s)",
+		event.ProviderDisputeID, event.ProviderPaymentID, event.DisputeStatus, event.AmountCents, event.DisputeReason)
+	return nil
+}
+
+// lookupSubscription finds the Civic OS subscription for a provider
+// subscription. Returns "" (and nil error) for subscriptions created outside
+// Civic OS, which are ignored.
+func (h *WebhookHandler) lookupSubscription(ctx context.Context, tx pgx.Tx, event *WebhookEvent) (string, error) {
+	if event.ProviderSubscriptionID == "" {
+		log.Printf("[Webhook] ⚠ Event %s has no subscription ID, skipping", event.EventID)
+		return "", nil
+	}
+
+	var subscriptionID string
+	err := tx.QueryRow(ctx, `
+		SELECT id
+		FROM payments.subscriptions
+		WHERE provider = $1 AND provider_subscription_id = $2
+	`, event.Provider, event.ProviderSubscriptionID).Scan(&subscriptionID)
+	if err == pgx.ErrNoRows {
+		log.Printf("[Webhook] ⚠ Subscription %s not found, skipping", event.ProviderSubscriptionID)
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("lookup subscription: %w", err)
+	}
+	return subscriptionID, nil
+}
 
+// recordInvoicePayment sets the status of the transaction for a subscription
+// invoice, inserting a renewal transaction the first time an invoice is seen.
+// A paid invoice never moves back to failed.
+func (h *WebhookHandler) recordInvoicePayment(ctx context.Context, tx pgx.Tx, subscriptionID string, event *WebhookEvent, status, errorMsg string) error {
+	result, err := tx.Exec(ctx, `
+		UPDATE payments.transactions
+		SET
+			status = $3,
+			error_message = NULLIF($4, ''),
+			provider_invoice_id = COALESCE(provider_invoice_id, $5),
+			provider_payment_id = COALESCE(provider_payment_id, NULLIF($6, '')),
+			updated_at = NOW()
+		WHERE subscription_id = $1
+		AND provider = $2
+		AND (provider_invoice_id = $5 OR (provider_invoice_id IS NULL AND provider_payment_id = $6))
+		AND status <> 'succeeded'
+	`, subscriptionID, event.Provider, status, errorMsg, event.ProviderInvoiceID, event.ProviderPaymentID)
+	if err != nil {
+		return fmt.Errorf("update invoice payment: %w", err)
+	}
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	// Renewal invoice (or one already marked succeeded, which the conflict
+	// clause leaves alone)
+	_, err = tx.Exec(ctx, `
+		INSERT INTO payments.transactions (
+			user_id, amount, currency, status, error_message, description,
+			provider, provider_payment_id, provider_invoice_id,
+			entity_type, entity_id, subscription_id
+		)
+		SELECT
+			s.user_id, $3::NUMERIC / 100, s.currency, $4, NULLIF($5, ''), s.description,
+			s.provider, NULLIF($6, ''), $7,
+			s.entity_type, s.entity_id, s.id
+		FROM payments.subscriptions s
+		WHERE s.id = $1 AND s.provider = $2
+		ON CONFLICT (provider, provider_invoice_id) WHERE provider_invoice_id IS NOT NULL DO UPDATE
+		SET status = EXCLUDED.status, error_message = EXCLUDED.error_message, updated_at = NOW()
+		WHERE payments.transactions.status <> 'succeeded'
+	`, subscriptionID, event.Provider, event.AmountCents, status, errorMsg, event.ProviderPaymentID, event.ProviderInvoiceID)
+	if err != nil {
+		return fmt.Errorf("insert renewal payment: %w", err)
+	}
 	return nil
 }
 
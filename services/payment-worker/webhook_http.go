@@ -2,33 +2,52 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
-
-	"github.com/stripe/stripe-go/v81/webhook"
 )
 
 // WebhookHTTPServer handles HTTP webhook requests
 type WebhookHTTPServer struct {
-	handler       *WebhookHandler
-	webhookSecret string
-	server        *http.Server
+	handler      *WebhookHandler
+	providers    *ProviderRegistry
+	jobs         jobInserter
+	health       *HealthChecker
+	guard        *WebhookGuard // Allowlist, rate limit and in-flight cap (nil = none)
+	adminToken   string        // Bearer token for /admin endpoints ("" disables them)
+	metricsToken string        // Bearer token for /metrics ("" leaves it open)
+	server       *http.Server
 }
 
-func NewWebhookHTTPServer(handler *WebhookHandler, webhookSecret string, port string) *WebhookHTTPServer {
+func NewWebhookHTTPServer(handler *WebhookHandler, providers *ProviderRegistry, jobs jobInserter, health *HealthChecker, guard *WebhookGuard, adminToken, metricsToken, port string) *WebhookHTTPServer {
 	mux := http.NewServeMux()
 
 	s := &WebhookHTTPServer{
-		handler:       handler,
-		webhookSecret: webhookSecret,
+		handler:      handler,
+		providers:    providers,
+		jobs:         jobs,
+		health:       health,
+		guard:        guard,
+		adminToken:   adminToken,
+		metricsToken: metricsToken,
 	}
 
-	// Register routes
-	mux.HandleFunc("/webhooks/stripe", s.HandleStripeWebhook)
+	// Register routes (one webhook endpoint per configured provider)
+	for _, name := range providers.Names() {
+		provider, _ := providers.Get(name)
+		mux.HandleFunc("/webhooks/"+name, s.HandleWebhook(provider))
+	}
 	mux.HandleFunc("/health", s.HandleHealth)
+	mux.HandleFunc("GET /metrics", s.HandleMetrics)
+	if adminToken != "" {
+		mux.HandleFunc("POST /admin/webhooks/{id}/reprocess", s.HandleReprocess)
+	}
 
 	// Create HTTP server with security settings
 	s.server = &http.Server{
@@ -46,7 +65,13 @@ func NewWebhookHTTPServer(handler *WebhookHandler, webhookSecret string, port st
 // Start begins listening for HTTP requests
 func (s *WebhookHTTPServer) Start() error {
 	log.Printf("[HTTP] Starting webhook server on %s", s.server.Addr)
-	log.Printf("[HTTP] Webhook endpoint: http://localhost%s/webhooks/stripe", s.server.Addr)
+	for _, name := range s.providers.Names() {
+		log.Printf("[HTTP] Webhook endpoint: http://localhost%s/webhooks/%s", s.server.Addr, name)
+	}
+	log.Printf("[HTTP] Health: http://localhost%s/health, metrics: http://localhost%s/metrics", s.server.Addr, s.server.Addr)
+	if s.adminToken != "" {
+		log.Printf("[HTTP] Admin endpoint: http://localhost%s/admin/webhooks/{id}/reprocess", s.server.Addr)
+	}
 	return s.server.ListenAndServe()
 }
 
@@ -56,70 +81,181 @@ func (s *WebhookHTTPServer) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
-// HandleStripeWebhook processes incoming Stripe webhook requests
-func (s *WebhookHTTPServer) HandleStripeWebhook(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// HandleWebhook returns the handler for a provider's webhook endpoint
+func (s *WebhookHTTPServer) HandleWebhook(provider PaymentProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-	// Limit request body size (64KB max)
-	const MaxBodyBytes = 65536
-	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+		// Tag the request for the logs (and the proxy's, via the response)
+		reqID := requestID(r)
+		w.Header().Set("X-Request-ID", reqID)
 
-	// Read request body
-	payload, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("[Webhook] Failed to read body: %v", err)
-		http.Error(w, "Request body too large", http.StatusBadRequest)
+		// Turn away unknown sources, floods and overload before touching the
+		// body or the database (see webhook_guard.go)
+		clientIP := s.guard.ClientIP(r)
+		if !s.guard.Allowed(provider.Name(), clientIP) {
+			workerMetrics.WebhooksTotal.Inc(provider.Name(), "forbidden")
+			log.Printf("[Webhook] [%s] Rejected %s webhook from %s: not in the allowlist", reqID, provider.Name(), clientIP)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if ok, wait := s.guard.Allow(clientIP); !ok {
+			workerMetrics.WebhooksTotal.Inc(provider.Name(), "rate_limited")
+			log.Printf("[Webhook] [%s] Rate limited %s webhook from %s", reqID, provider.Name(), clientIP)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		release, ok := s.guard.Acquire()
+		if !ok {
+			workerMetrics.WebhooksTotal.Inc(provider.Name(), "overloaded")
+			log.Printf("[Webhook] [%s] Too many webhooks in flight, asking %s to retry", reqID, provider.Name())
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Busy, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+
+		// Limit request body size (64KB max)
+		const MaxBodyBytes = 65536
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+
+		started := time.Now()
+		defer func() {
+			workerMetrics.WebhookDuration.Observe(time.Since(started).Seconds(), provider.Name())
+		}()
+
+		// Read request body
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			workerMetrics.WebhooksTotal.Inc(provider.Name(), "bad_request")
+			log.Printf("[Webhook] [%s] Failed to read body: %v", reqID, err)
+			http.Error(w, "Request body too large", http.StatusBadRequest)
+			return
+		}
+
+		// Process webhook with timeout context (stays under the server's 10s
+		// WriteTimeout; PayPal verification and capture are remote calls)
+		ctx, cancel := context.WithTimeout(r.Context(), 9*time.Second)
+		defer cancel()
+
+		// Verify signature and normalize event
+		event, err := provider.VerifyWebhook(ctx, payload, r.Header)
+		if err != nil {
+			log.Printf("[Webhook] [%s] %s signature verification failed (from %s): %v", reqID, provider.Name(), clientIP, err)
+			workerMetrics.WebhooksTotal.Inc(provider.Name(), "invalid_signature")
+			workerMetrics.WebhookSignatureFailures.Inc(provider.Name())
+			http.Error(w, "Invalid signature", http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("[Webhook] [%s] Received verified event: provider=%s, id=%s, type=%s",
+			reqID, event.Provider, event.EventID, event.EventType)
+
+		if err := s.handler.ProcessWebhook(ctx, provider, event); err != nil {
+			log.Printf("[Webhook] [%s] Processing failed: %v", reqID, err)
+			workerMetrics.WebhooksTotal.Inc(provider.Name(), "error")
+			http.Error(w, "Webhook processing failed", http.StatusInternalServerError)
+			return
+		}
+
+		workerMetrics.WebhooksTotal.Inc(provider.Name(), "processed")
+
+		// Return success response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]bool{"received": true})
+	}
+}
+
+// HandleReprocess enqueues a reprocess_webhook job for a stored webhook
+// (see reprocess_webhook.go). The job runs asynchronously; check the
+// metadata.webhooks row for the outcome.
+func (s *WebhookHTTPServer) HandleReprocess(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Get Stripe signature header
-	signature := r.Header.Get("Stripe-Signature")
-	if signature == "" {
-		log.Printf("[Webhook] Missing Stripe-Signature header")
-		http.Error(w, "Missing Stripe-Signature header", http.StatusBadRequest)
+	webhookID := r.PathValue("id")
+	if !webhookIDPattern.MatchString(webhookID) {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
 		return
 	}
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
 
-	// Verify signature and construct event
-	// Note: IgnoreAPIVersionMismatch allows Stripe CLI to work with newer SDK versions
-	event, err := webhook.ConstructEventWithOptions(
-		payload,
-		signature,
-		s.webhookSecret,
-		webhook.ConstructEventOptions{
-			IgnoreAPIVersionMismatch: true,
-		},
-	)
+	result, err := s.jobs.Insert(r.Context(), ReprocessWebhookArgs{WebhookID: webhookID, Force: force}, nil)
 	if err != nil {
-		log.Printf("[Webhook] Signature verification failed: %v", err)
-		http.Error(w, "Invalid signature", http.StatusBadRequest)
+		log.Printf("[HTTP] Failed to enqueue reprocess_webhook for %s: %v", webhookID, err)
+		http.Error(w, "Failed to enqueue job", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("[Webhook] Received verified event: id=%s, type=%s", event.ID, event.Type)
+	if result.UniqueSkippedAsDuplicate {
+		log.Printf("[HTTP] reprocess_webhook for %s already queued as job %d", webhookID, result.Job.ID)
+	} else {
+		log.Printf("[HTTP] Queued reprocess_webhook for %s (force=%v)", webhookID, force)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queued":     true,
+		"job_id":     result.Job.ID,
+		"webhook_id": webhookID,
+	})
+}
+
+// authorizeAdmin checks the request's bearer token against adminToken
+func (s *WebhookHTTPServer) authorizeAdmin(r *http.Request) bool {
+	return bearerTokenMatches(r, s.adminToken)
+}
+
+// bearerTokenMatches checks the request's bearer token against want ("" never
+// matches)
+func bearerTokenMatches(r *http.Request, want string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || want == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
 
-	// Process webhook with timeout context
+// HandleHealth checks the database, provider APIs and job queue. Returns 503
+// only when the database is unreachable; a provider outage is reported as
+// "degraded" with 200 so the container isn't restarted for it.
+func (s *WebhookHTTPServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := s.handler.ProcessStripeWebhook(ctx, event); err != nil {
-		log.Printf("[Webhook] Processing failed: %v", err)
-		http.Error(w, "Webhook processing failed", http.StatusInternalServerError)
-		return
-	}
+	report := s.health.Check(ctx)
 
-	// Return success response
+	status := http.StatusOK
+	if report.Status == HealthUnhealthy {
+		status = http.StatusServiceUnavailable
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]bool{"received": true})
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
 }
 
-// HandleHealth provides a health check endpoint
-func (s *WebhookHTTPServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+// HandleMetrics serves Prometheus metrics: counters and histograms since
+// startup, plus dependency status and queue depth read at scrape time
+func (s *WebhookHTTPServer) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.metricsToken != "" && !bearerTokenMatches(r, s.metricsToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var b strings.Builder
+	s.health.WriteMetrics(ctx, &b)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	workerMetrics.WriteTo(w)
+	io.WriteString(w, b.String())
 }
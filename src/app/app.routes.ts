@@ -91,6 +91,20 @@ export const routes: Routes = [
                 canActivate: [schemaVersionGuard, authGuard],
                 data: { titleKey: 'sidebar.functions' }
             },
+            {
+                path: 'system/maintenance',
+                loadComponent: () => import('./pages/system-maintenance/system-maintenance.page')
+                    .then(m => m.SystemMaintenancePage),
+                canActivate: [schemaVersionGuard, authGuard],
+                data: { titleKey: 'sidebar.maintenance_tasks' }
+            },
+            {
+                path: 'system/queues',
+                loadComponent: () => import('./pages/system-queues/system-queues.page')
+                    .then(m => m.SystemQueuesPage),
+                canActivate: [schemaVersionGuard, authGuard],
+                data: { titleKey: 'sidebar.job_queues' }
+            },
             {
                 path: 'system/entity-code/:tableName',
                 loadComponent: () => import('./pages/entity-code/entity-code.page')
@@ -29,6 +29,7 @@ import { PaymentBadgeComponent } from '../payment-badge/payment-badge.component'
 import { GalleryLightboxComponent } from '../gallery-lightbox/gallery-lightbox.component';
 import { FileThumbnailComponent } from '../file-thumbnail/file-thumbnail.component';
 import { getS3Config } from '../../config/runtime';
+import { getFileDisplayUrl } from '../../utils/file-url.utils';
 import { getContrastTextColor } from '../../utils/color.utils';
 import { TranslatePipe } from '../../pipes/translate.pipe';
 
@@ -162,8 +163,7 @@ export class DisplayPropertyComponent {
    */
   getGalleryThumbUrl(image: GalleryImage): string {
     if (!image.file) return '';
-    const key = image.file.s3_thumbnail_medium_key || image.file.s3_original_key;
-    return this.getS3Url(key);
+    return getFileDisplayUrl(image.file, ['medium']) ?? '';
   }
 
   /**
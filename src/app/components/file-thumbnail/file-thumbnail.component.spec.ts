@@ -133,6 +133,15 @@ describe('FileThumbnailComponent', () => {
     expect(component.thumbnailUrl()).toContain('original.jpg');
   });
 
+  it('should paint the placeholder colour behind the image', () => {
+    fixture.componentRef.setInput('file', { ...mockFile, placeholder_color: '#3a6b2f' });
+    fixture.detectChanges();
+
+    const img: HTMLImageElement = fixture.nativeElement.querySelector('img');
+    expect(component.placeholderColor()).toBe('#3a6b2f');
+    expect(img.style.backgroundColor).toBe('rgb(58, 107, 47)');
+  });
+
   it('should return null thumbnailUrl when file is null', () => {
     fixture.componentRef.setInput('file', null);
     fixture.detectChanges();
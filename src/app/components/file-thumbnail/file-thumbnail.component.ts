@@ -16,7 +16,7 @@ import { interval } from 'rxjs';
 import { takeWhile, switchMap } from 'rxjs/operators';
 import { FileReference } from '../../interfaces/entity';
 import { FileUploadService } from '../../services/file-upload.service';
-import { getS3Config } from '../../config/runtime';
+import { getFileDisplayUrl } from '../../utils/file-url.utils';
 
 /**
  * Shared thumbnail display component for file references.
@@ -24,6 +24,7 @@ import { getS3Config } from '../../config/runtime';
  * Handles the full thumbnail lifecycle:
  * - Shows optimized thumbnail when available (medium by default)
  * - Falls back to original image as preview when thumbnail isn't generated yet
+ * - Fills the box with the file's placeholder colour while the image loads (v0.111.0)
  * - Shows spinner when no image keys are available yet
  * - Shows broken-image icon on failure
  * - Optionally polls for thumbnail completion and emits updated FileReference
@@ -56,6 +57,7 @@ import { LoadingIndicatorComponent } from '../loading-indicator/loading-indicato
         [src]="thumbnailUrl()"
         [alt]="alt()"
         class="not-prose w-full h-full"
+        [style.background-color]="placeholderColor()"
         [class.object-cover]="objectFit() === 'cover'"
         [class.object-contain]="objectFit() === 'contain'"
       />
@@ -115,34 +117,26 @@ export class FileThumbnailComponent {
       && !f.s3_thumbnail_medium_key && !f.s3_original_key;
   });
 
-  /** Computed: did thumbnail generation fail? */
+  /** Computed: did thumbnail generation fail (or the original can't be rendered)? */
   isFailed = computed(() => {
     const f = this.displayFile();
     if (!f) return false;
-    return f.thumbnail_status === 'failed'
+    return (f.thumbnail_status === 'failed' || f.thumbnail_status === 'unsupported')
       && !f.s3_thumbnail_medium_key && !f.s3_original_key;
   });
 
+  /** Computed: average colour from the thumbnail worker, if it has run */
+  placeholderColor = computed(() => this.displayFile()?.placeholder_color ?? null);
+
   /** Computed: the best available URL to display */
   thumbnailUrl = computed(() => {
     const f = this.displayFile();
     if (!f) return null;
 
     const size = this.preferredSize();
-    let key: string | undefined;
-
-    if (size === 'small') {
-      key = f.s3_thumbnail_small_key || f.s3_thumbnail_medium_key || f.s3_original_key;
-    } else if (size === 'medium') {
-      key = f.s3_thumbnail_medium_key || f.s3_original_key;
-    } else {
-      key = f.s3_original_key;
-    }
-
-    if (!key) return null;
-
-    const s3Config = getS3Config();
-    return `${s3Config.endpoint}/${s3Config.bucket}/${key}`;
+    if (size === 'small') return getFileDisplayUrl(f, ['small', 'medium']);
+    if (size === 'medium') return getFileDisplayUrl(f, ['medium']);
+    return getFileDisplayUrl(f, []);
   });
 
   constructor() {
@@ -181,7 +175,8 @@ export class FileThumbnailComponent {
       next: (updatedFile) => {
         if (!updatedFile || this.pollingFileId !== fileId) return;
 
-        if (updatedFile.thumbnail_status === 'completed' || updatedFile.thumbnail_status === 'failed') {
+        if (updatedFile.thumbnail_status === 'completed' || updatedFile.thumbnail_status === 'failed'
+          || updatedFile.thumbnail_status === 'unsupported') {
           this.displayFile.set(updatedFile);
           this.fileUpdated.emit(updatedFile);
           this.pollingFileId = null;
@@ -37,9 +37,12 @@ interface FilterOption {
 const PAYMENT_STATUS_OPTIONS: FilterOption[] = [
   { id: 'pending_intent', display_name: 'Pending Intent' },
   { id: 'pending', display_name: 'Pending' },
+  { id: 'processing', display_name: 'Processing' },
+  { id: 'requires_capture', display_name: 'Authorized' },
   { id: 'succeeded', display_name: 'Succeeded' },
   { id: 'failed', display_name: 'Failed' },
   { id: 'canceled', display_name: 'Canceled' },
+  { id: 'expired', display_name: 'Expired' },
   { id: 'refunded', display_name: 'Refunded' },
   { id: 'partially_refunded', display_name: 'Partially Refunded' },
 ];
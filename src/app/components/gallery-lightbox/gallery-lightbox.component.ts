@@ -10,6 +10,7 @@
 import { Component, ChangeDetectionStrategy, input, output, signal, computed, effect, HostListener, inject, ElementRef, viewChild } from '@angular/core';
 import { GalleryImage } from '../../interfaces/entity';
 import { getS3Config } from '../../config/runtime';
+import { getFileDisplayUrl } from '../../utils/file-url.utils';
 import { LocaleService } from '../../services/locale.service';
 import { TranslatePipe } from '../../pipes/translate.pipe';
 
@@ -177,9 +178,7 @@ export class GalleryLightboxComponent {
   /** Get thumbnail URL for navigation strip */
   getThumbUrl(image: GalleryImage): string {
     if (!image.file) return '';
-    const s3Config = getS3Config();
-    const key = image.file.s3_thumbnail_small_key || image.file.s3_thumbnail_medium_key || image.file.s3_original_key;
-    return `${s3Config.endpoint}/${s3Config.bucket}/${key}`;
+    return getFileDisplayUrl(image.file, ['small', 'medium']) ?? '';
   }
 
   /** Stop click propagation (prevent backdrop close when clicking image) */
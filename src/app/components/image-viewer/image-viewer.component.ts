@@ -5,6 +5,7 @@
 import { Component, signal } from '@angular/core';
 import { FileReference } from '../../interfaces/entity';
 import { getS3Config } from '../../config/runtime';
+import { getFileDisplayUrl } from '../../utils/file-url.utils';
 import { CosModalComponent } from '../cos-modal/cos-modal.component';
 import { TranslatePipe } from '../../pipes/translate.pipe';
 
@@ -99,9 +100,7 @@ export class ImageViewerComponent {
     }
 
     // For fit view, use large thumbnail if available
-    return img.s3_thumbnail_large_key
-      ? this.getS3Url(img.s3_thumbnail_large_key)
-      : this.getS3Url(img.s3_original_key);
+    return getFileDisplayUrl(img, ['large']) ?? '';
   }
 
   /**
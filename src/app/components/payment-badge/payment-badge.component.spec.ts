@@ -143,6 +143,66 @@ describe('PaymentBadgeComponent', () => {
       const icon = badge.query(By.css('.material-symbols-outlined'));
       expect(icon.nativeElement.textContent.trim()).toBe('schedule');
     });
+
+    it('should render yellow badge with clock icon for processing (ACH settling) payment', () => {
+      const payment = createPayment({
+        id: 'pay_ach',
+        status: 'processing',
+        amount: 2500.00,
+        display_name: '$2500.00 - PROCESSING'
+      });
+
+      fixture.componentRef.setInput('payment', payment);
+      fixture.detectChanges();
+
+      const badge = fixture.debugElement.query(By.css('.badge'));
+      expect(badge.nativeElement.classList.contains('badge-warning')).toBe(true);
+
+      const icon = badge.query(By.css('.material-symbols-outlined'));
+      expect(icon.nativeElement.textContent.trim()).toBe('schedule');
+
+      expect(badge.nativeElement.textContent.trim()).toContain('$2,500.00 - Processing');
+    });
+
+    it('should render yellow badge with card-clock icon for authorized (manual capture) payment', () => {
+      const payment = createPayment({
+        id: 'pay_hold',
+        status: 'requires_capture',
+        amount: 100.00,
+        display_name: '$100.00 - REQUIRES_CAPTURE'
+      });
+
+      fixture.componentRef.setInput('payment', payment);
+      fixture.detectChanges();
+
+      const badge = fixture.debugElement.query(By.css('.badge'));
+      expect(badge.nativeElement.classList.contains('badge-warning')).toBe(true);
+
+      const icon = badge.query(By.css('.material-symbols-outlined'));
+      expect(icon.nativeElement.textContent.trim()).toBe('credit_card_clock');
+
+      expect(badge.nativeElement.textContent.trim()).toContain('$100.00 - Authorized');
+    });
+
+    it('should render ghost badge with timer-off icon for expired (abandoned checkout) payment', () => {
+      const payment = createPayment({
+        id: 'pay_abandoned',
+        status: 'expired',
+        amount: 40.00,
+        display_name: '$40.00 - EXPIRED'
+      });
+
+      fixture.componentRef.setInput('payment', payment);
+      fixture.detectChanges();
+
+      const badge = fixture.debugElement.query(By.css('.badge'));
+      expect(badge.nativeElement.classList.contains('badge-ghost')).toBe(true);
+
+      const icon = badge.query(By.css('.material-symbols-outlined'));
+      expect(icon.nativeElement.textContent.trim()).toBe('timer_off');
+
+      expect(badge.nativeElement.textContent.trim()).toContain('$40.00 - Expired');
+    });
   });
 
   describe('Failed Status', () => {
@@ -461,7 +521,7 @@ describe('PaymentBadgeComponent', () => {
 
     it('should handle all effective_status values correctly', () => {
       const effectiveStatuses: Array<PaymentValue['effective_status']> = [
-        'pending_intent', 'pending', 'succeeded', 'failed', 'canceled', 'refunded', 'partially_refunded', 'refund_pending'
+        'pending_intent', 'pending', 'processing', 'requires_capture', 'succeeded', 'failed', 'canceled', 'refunded', 'partially_refunded', 'refund_pending'
       ];
 
       effectiveStatuses.forEach(effectiveStatus => {
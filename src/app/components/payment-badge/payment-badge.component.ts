@@ -104,6 +104,20 @@ export class PaymentBadgeComponent {
       case 'refund_pending':
         // Refund is being processed
         return 'Refund Pending';
+      case 'processing':
+        // ACH debit confirmed but not yet settled
+        const totalFormatted = this.currencyPipe.transform(p.total_amount, p.currency, 'symbol', '1.2-2') || `$${p.total_amount}`;
+        return `${totalFormatted} - Processing`;
+      case 'requires_capture': {
+        // Card authorized (manual capture) - funds held, not yet charged
+        const heldFormatted = this.currencyPipe.transform(p.total_amount, p.currency, 'symbol', '1.2-2') || `$${p.total_amount}`;
+        return `${heldFormatted} - Authorized`;
+      }
+      case 'expired': {
+        // Checkout abandoned; the payment worker expired it
+        const expiredFormatted = this.currencyPipe.transform(p.total_amount, p.currency, 'symbol', '1.2-2') || `$${p.total_amount}`;
+        return `${expiredFormatted} - Expired`;
+      }
       default:
         // Use the database-generated display_name for other statuses
         return p.display_name || 'No payment';
@@ -242,8 +242,8 @@ export class PaymentCheckoutComponent {
         // Payment failed
         this.error.set(error.message || 'Payment failed');
         this.processing.set(false);
-      } else if (paymentIntent && paymentIntent.status === 'succeeded') {
-        // Payment succeeded in Stripe - now poll for database update
+      } else if (paymentIntent && (paymentIntent.status === 'succeeded' || paymentIntent.status === 'processing' || paymentIntent.status === 'requires_capture')) {
+        // Payment succeeded in Stripe (or, for ACH debits, is settling; for manual capture, is authorized) - now poll for database update
         // Webhook processing is async, so we need to wait for status change
         this.pollForPaymentSuccess();
       } else {
@@ -282,7 +282,7 @@ export class PaymentCheckoutComponent {
         if (payment.status !== 'pending' && payment.status !== 'pending_intent') {
           // Status changed! Wait 500ms to ensure database views are consistent,
           // then close modal and reload parent record
-          // Could be: succeeded, failed, or canceled
+          // Could be: succeeded, processing (ACH settling), requires_capture (authorized), failed, or canceled
           console.log('[PaymentCheckout] Payment status changed, emitting paymentSuccess after 500ms', { status: payment.status, paymentId: this.paymentId() });
           setTimeout(() => {
             console.log('[PaymentCheckout] Emitting paymentSuccess event', { paymentId: this.paymentId() });
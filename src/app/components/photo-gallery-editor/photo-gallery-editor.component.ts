@@ -19,6 +19,7 @@ import { FileThumbnailComponent } from '../file-thumbnail/file-thumbnail.compone
 import { TranslatePipe } from '../../pipes/translate.pipe';
 import { TranslationService } from '../../services/translation.service';
 import { getS3Config } from '../../config/runtime';
+import { getFileDisplayUrl } from '../../utils/file-url.utils';
 
 /**
  * Editor component for photo galleries — drag-drop upload, reorder, remove.
@@ -364,8 +365,7 @@ export class PhotoGalleryEditorComponent {
   /** Get the medium thumbnail URL for an image */
   getThumbUrl(image: GalleryImage): string {
     if (!image.file) return '';
-    const key = image.file.s3_thumbnail_medium_key || image.file.s3_original_key;
-    return this.getS3Url(key);
+    return getFileDisplayUrl(image.file, ['medium']) ?? '';
   }
 
   /** Update a gallery image's embedded file reference when polling detects thumbnail completion */
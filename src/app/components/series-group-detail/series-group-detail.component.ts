@@ -944,7 +944,7 @@ export class SeriesGroupDetailComponent implements OnChanges {
   }
 
   getInstanceIcon(instance: SeriesInstanceSummary): string {
-    if (instance.exception_type === 'cancelled') return 'event_busy';
+    if (instance.exception_type === 'cancelled' || instance.exception_type === 'holiday_skipped') return 'event_busy';
     if (instance.exception_type === 'rescheduled') return 'event_repeat';
     if (instance.exception_type === 'insert_failed') return 'error_outline';
     if (instance.is_exception) return 'edit_calendar';
@@ -958,6 +958,7 @@ export class SeriesGroupDetailComponent implements OnChanges {
       case 'modified': return 'Modified';
       case 'conflict_skipped': return 'Skipped';
       case 'insert_failed': return 'Failed';
+      case 'holiday_skipped': return 'Holiday';
       default: return 'Exception';
     }
   }
@@ -189,8 +189,16 @@ export class TemplateEditorComponent implements OnInit, OnChanges, OnDestroy {
     const parts: any = {};
     parts[fieldName] = value;
 
+    // Sample data only feeds warnings and SMS counts, so bad JSON isn't fatal here
+    let sampleEntityData;
+    try {
+      sampleEntityData = JSON.parse(this.sampleData());
+    } catch {
+      sampleEntityData = undefined;
+    }
+
     // Call validation service
-    this.notificationService.validateTemplateParts(parts).subscribe({
+    this.notificationService.validateTemplateParts(parts, sampleEntityData).subscribe({
       next: (results) => {
         // Store validation results
         const resultsMap = new Map(this.validationResults());
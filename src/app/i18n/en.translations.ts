@@ -177,6 +177,8 @@ export const EN_TRANSLATIONS: Record<string, string> = {
   'sidebar.notifications': 'Notifications',
   'sidebar.functions': 'Functions & RPCs',
   'sidebar.policies': 'Security Policies',
+  'sidebar.maintenance_tasks': 'Maintenance Tasks',
+  'sidebar.job_queues': 'Job Queues',
   'sidebar.users': 'Users',
   'sidebar.static_assets': 'Static Assets',
   'sidebar.files': 'Files',
@@ -302,6 +304,9 @@ export const EN_TRANSLATIONS: Record<string, string> = {
   'form.sign_in_message': 'Sign in to create and edit records.',
   'form.no_create_permission': "You don't have permission to create records for this entity.",
   'form.no_edit_permission': "You don't have permission to edit this record.",
+  'form.also_editing': '{{name}} is also editing this record. Your changes will overwrite theirs if you both save.',
+  'form.another_user': 'Another user',
+  'form.series_skipped_editing': '{{count}} occurrence(s) were not updated because someone else is editing them.',
 
   'settings.title': 'Settings',
   'settings.preferences': 'Preferences',
@@ -317,6 +322,10 @@ export const EN_TRANSLATIONS: Record<string, string> = {
   'settings.sms_consent': 'By enabling SMS notifications, you consent to receive transactional text messages from {{appTitle}}. Msg & data rates may apply. Reply STOP to unsubscribe, HELP for help.',
   'settings.no_preferences': 'No notification preferences found. They will be created on your next login.',
   'settings.loading_preferences': 'Loading preferences...',
+  'settings.notification_categories': 'Notify me about',
+  'settings.category': 'Category',
+  'settings.email': 'Email',
+  'settings.sms': 'SMS',
 
   'profile.title': 'My Profile',
   'profile.my_profile': 'My Profile',
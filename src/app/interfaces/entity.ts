@@ -76,9 +76,15 @@ export interface FileReference {
     s3_thumbnail_small_key?: string;
     s3_thumbnail_medium_key?: string;
     s3_thumbnail_large_key?: string;
-    thumbnail_status: 'pending' | 'processing' | 'completed' | 'failed' | 'not_applicable';
+    thumbnail_status: 'pending' | 'processing' | 'completed' | 'failed' | 'not_applicable' | 'unsupported';
     thumbnail_error?: string;
     property_name?: string;  // Column name of entity property referencing this file (v0.39.0)
+    blurhash?: string;  // BlurHash of the image, set with the thumbnails (v0.111.0)
+    placeholder_color?: string;  // Average colour as #rrggbb, shown while the thumbnail loads (v0.111.0)
+    cdn_thumbnail_small_url?: string | null;  // Signed CDN URLs, set when the worker signs thumbnails (v0.113.0)
+    cdn_thumbnail_medium_url?: string | null;
+    cdn_thumbnail_large_url?: string | null;
+    cdn_urls_expire_at?: string | null;  // When the signed CDN URLs stop working (v0.113.0)
     created_at: string;
     updated_at: string;
 }
@@ -283,8 +289,8 @@ export interface EntityNote {
  */
 export interface PaymentValue {
     id: string;  // UUID
-    status: 'pending_intent' | 'pending' | 'succeeded' | 'failed' | 'canceled';
-    effective_status: 'pending_intent' | 'pending' | 'succeeded' | 'failed' | 'canceled' | 'refunded' | 'partially_refunded' | 'refund_pending';
+    status: 'pending_intent' | 'pending' | 'processing' | 'requires_capture' | 'succeeded' | 'failed' | 'canceled' | 'expired';
+    effective_status: 'pending_intent' | 'pending' | 'processing' | 'requires_capture' | 'succeeded' | 'failed' | 'canceled' | 'expired' | 'refunded' | 'partially_refunded' | 'refund_pending';
     amount: number;           // Base amount (original pricing)
     processing_fee: number;   // Processing fee amount
     total_amount: number;     // Total charged to Stripe (amount + processing_fee)
@@ -884,7 +890,7 @@ export interface SeriesInstance {
     entity_table: string;
     entity_id?: number | null;
     is_exception: boolean;
-    exception_type?: 'modified' | 'rescheduled' | 'cancelled' | 'conflict_skipped' | 'insert_failed' | null;
+    exception_type?: 'modified' | 'rescheduled' | 'cancelled' | 'conflict_skipped' | 'insert_failed' | 'holiday_skipped' | null;
     original_time_slot?: string | null;
     exception_reason?: string | null;
     exception_at?: string | null;
@@ -113,7 +113,9 @@ export interface EntitySourceCodeResponse {
 export interface ParsedSourceCode {
   schema_name: string;
   object_name: string;
-  object_type: 'function' | 'view';
+  object_type: 'function' | 'trigger_function' | 'view' | 'materialized_view' | 'policy';
+  /** Table a policy is defined on; empty for other object types (v0.98.0+) */
+  table_name: string;
   language: string;
   ast_json: any | null;
   parse_error: string | null;
@@ -133,3 +135,21 @@ export interface SchemaRlsPolicy {
   using_expression: string | null;
   with_check_expression: string | null;
 }
+
+/**
+ * A lint finding from source_lint_findings view (admin-only, v0.99.0+).
+ * Written by the Go worker when it re-parses an object.
+ */
+export interface SourceLintFinding {
+  id: number;
+  schema_name: string;
+  object_name: string;
+  object_type: ParsedSourceCode['object_type'];
+  /** Table a policy is defined on; empty for other object types */
+  table_name: string;
+  rule: 'security_definer_search_path' | 'dynamic_sql_concat' | 'select_star' | 'missing_volatility';
+  severity: 'error' | 'warning' | 'info';
+  message: string;
+  detail: string | null;
+  found_at: string;
+}
@@ -58,6 +58,11 @@ interface PaymentTransaction {
   entity_type: string | null;
   entity_id: string | null;
   entity_display_name: string | null;
+  // Manual capture (authorize now, charge later)
+  capture_method: 'automatic' | 'manual';
+  capture_before: string | null;
+  // Recurring payments: set on every invoice of a subscription
+  subscription_id: string | null;
 }
 
 /**
@@ -115,6 +120,11 @@ export class AdminPaymentsPage {
 
   canCreateRefunds = computed(() => this.auth.hasPermission('payment_refunds', 'create'));
 
+  canUpdatePayments = computed(() => this.auth.hasPermission('payment_transactions', 'update'));
+
+  // Payment ID with a capture/void request in flight
+  captureLoadingId = signal<string | undefined>(undefined);
+
   // UI state
   loading = signal(true);
   error = signal<string | undefined>(undefined);
@@ -212,8 +222,11 @@ export class AdminPaymentsPage {
     { value: 'succeeded', label: 'Paid' },
     { value: 'pending', label: 'Awaiting Payment' },
     { value: 'pending_intent', label: 'Processing' },
+    { value: 'processing', label: 'Settling' },
+    { value: 'requires_capture', label: 'Authorized' },
     { value: 'failed', label: 'Failed' },
     { value: 'canceled', label: 'Canceled' },
+    { value: 'expired', label: 'Expired' },
     { value: 'refund_pending', label: 'Refund Pending' },
     { value: 'refunded', label: 'Fully Refunded' },
     { value: 'partially_refunded', label: 'Partially Refunded' },
@@ -467,16 +480,59 @@ export class AdminPaymentsPage {
    * Requirements:
    * - Payment must have succeeded
    * - Payment cannot be fully refunded (effective_status !== 'refunded')
-   * - No pending refunds (only one refund at a time)
    * - User must have permission to create refunds
+   * Other refunds may still be pending; the RPC counts them against the balance.
    */
   canRefund(payment: PaymentTransaction): boolean {
     return payment.status === 'succeeded' &&
            payment.effective_status !== 'refunded' &&
-           payment.pending_refund_count === 0 &&
            this.canCreateRefunds();
   }
 
+  /**
+   * Check if an authorized (manual capture) payment can be captured or voided
+   */
+  canCapture(payment: PaymentTransaction): boolean {
+    return payment.status === 'requires_capture' && this.canUpdatePayments();
+  }
+
+  /**
+   * Charge an authorized payment via the capture_payment RPC
+   */
+  capturePayment(payment: PaymentTransaction) {
+    if (!confirm(`Charge ${payment.display_name} to the payer's card?`)) return;
+    this.submitCaptureAction(payment, 'capture_payment', { p_payment_id: payment.id }, 'Capture requested');
+  }
+
+  /**
+   * Release an authorized payment without charging it via the void_payment RPC
+   */
+  voidPayment(payment: PaymentTransaction) {
+    if (!confirm('Release this authorization without charging the payer?')) return;
+    this.submitCaptureAction(payment, 'void_payment', { p_payment_id: payment.id }, 'Void requested');
+  }
+
+  private submitCaptureAction(payment: PaymentTransaction, rpc: string, body: object, successMessage: string) {
+    this.captureLoadingId.set(payment.id);
+    this.error.set(undefined);
+
+    this.http.post(`${getPostgrestUrl()}rpc/${rpc}`, body).subscribe({
+      next: () => {
+        this.captureLoadingId.set(undefined);
+        this.successMessage.set(successMessage);
+
+        // The worker updates the status asynchronously; reload to pick it up
+        this.reloadTrigger.next();
+        setTimeout(() => this.dismissSuccess(), 5000);
+      },
+      error: (err) => {
+        this.captureLoadingId.set(undefined);
+        this.error.set(err.error?.message || err.error?.details || `Failed to ${rpc.replace('_payment', '')} payment`);
+        console.error(`${rpc} error:`, err);
+      }
+    });
+  }
+
   /**
    * Get badge class for effective status
    */
@@ -486,10 +542,14 @@ export class AdminPaymentsPage {
         return 'badge-success';
       case 'pending':
       case 'pending_intent':
+      case 'processing':
+        return 'badge-warning';
+      case 'requires_capture':
         return 'badge-warning';
       case 'failed':
         return 'badge-error';
       case 'canceled':
+      case 'expired':
         return 'badge-ghost';
       case 'refunded':
         return 'badge-info';
@@ -509,11 +569,16 @@ export class AdminPaymentsPage {
         return 'check_circle';
       case 'pending':
       case 'pending_intent':
+      case 'processing':
         return 'schedule';
+      case 'requires_capture':
+        return 'credit_card_clock';
       case 'failed':
         return 'error';
       case 'canceled':
         return 'cancel';
+      case 'expired':
+        return 'timer_off';
       case 'refund_pending':
         return 'hourglass_top';
       case 'refunded':
@@ -535,10 +600,16 @@ export class AdminPaymentsPage {
         return 'Awaiting Payment';
       case 'pending_intent':
         return 'Processing';
+      case 'processing':
+        return 'Settling';
+      case 'requires_capture':
+        return 'Authorized';
       case 'failed':
         return 'Failed';
       case 'canceled':
         return 'Canceled';
+      case 'expired':
+        return 'Expired';
       case 'refund_pending':
         return 'Refund Pending';
       case 'refunded':
@@ -423,9 +423,9 @@ export class DetailPage {
 
       // If payment exists, check if it's completed
       if (isPaymentValue(paymentValue)) {
-        // Hide button if payment succeeded (completed)
+        // Hide button if payment succeeded (completed), is settling (ACH), or is authorized (manual capture)
         // Show button if payment is pending/pending_intent/failed (allow retry)
-        if (paymentValue.status === 'succeeded') {
+        if (paymentValue.status === 'succeeded' || paymentValue.status === 'processing' || paymentValue.status === 'requires_capture') {
           return false;
         }
         // For pending/pending_intent/failed/canceled, allow retry
@@ -31,6 +31,7 @@ import { BehaviorSubject, of } from 'rxjs';
 import { MOCK_ENTITIES, MOCK_PROPERTIES, createMockProperty } from '../../testing';
 import { EntityPropertyType } from '../../interfaces/entity';
 import { GuidedFormService } from '../../services/guided-form.service';
+import { EntityLockService, EntityLockResult } from '../../services/entity-lock.service';
 import { GuidedFormContext, GuidedFormStep } from '../../interfaces/guided-form';
 import Keycloak from 'keycloak-js';
 
@@ -45,6 +46,7 @@ describe('EditPage', () => {
   let mockKeycloak: jasmine.SpyObj<Keycloak>;
   let mockNavigationService: jasmine.SpyObj<NavigationService>;
   let mockGuidedFormService: jasmine.SpyObj<GuidedFormService>;
+  let mockEntityLockService: jasmine.SpyObj<EntityLockService>;
   let routeParams: BehaviorSubject<any>;
 
   beforeEach(async () => {
@@ -69,6 +71,8 @@ describe('EditPage', () => {
     ]);
     mockGuidedFormService.getEffectiveSteps.and.returnValue([]);
     mockGuidedFormService.getLockedFields.and.returnValue(new Set());
+    mockEntityLockService = jasmine.createSpyObj('EntityLockService', ['hold', 'release']);
+    mockEntityLockService.hold.and.returnValue(of({ success: true } as EntityLockResult));
 
     // Setup updateToken to return resolved promise by default (for form submission)
     mockKeycloak.updateToken.and.returnValue(Promise.resolve(true));
@@ -90,7 +94,8 @@ describe('EditPage', () => {
         { provide: Router, useValue: mockRouter },
         { provide: Keycloak, useValue: mockKeycloak },
         { provide: NavigationService, useValue: mockNavigationService },
-        { provide: GuidedFormService, useValue: mockGuidedFormService }
+        { provide: GuidedFormService, useValue: mockGuidedFormService },
+        { provide: EntityLockService, useValue: mockEntityLockService }
       ]
     })
     .compileComponents();
@@ -423,6 +428,34 @@ describe('EditPage', () => {
     });
   });
 
+  describe('Entity Soft Lock', () => {
+    beforeEach(() => {
+      mockSchemaService.getEntity.and.returnValue(of(MOCK_ENTITIES.issue));
+      mockSchemaService.getPropsForEdit.and.returnValue(of([MOCK_PROPERTIES.textShort]));
+      mockDataService.getData.and.returnValue(of([{ id: 42, name: 'Test' }] as any));
+    });
+
+    it('should hold a lease on the record once data loads and release it on destroy', (done) => {
+      component.data$.subscribe(() => {
+        expect(mockEntityLockService.hold).toHaveBeenCalledOnceWith('Issue', '42');
+        expect(component.otherEditor()).toBeNull();
+
+        component.ngOnDestroy();
+        expect(mockEntityLockService.release).toHaveBeenCalledWith('Issue', '42');
+        done();
+      });
+    });
+
+    it('should show who else is editing', (done) => {
+      mockEntityLockService.hold.and.returnValue(of({ success: false, locked_by_display_name: 'Jordan' } as EntityLockResult));
+
+      component.data$.subscribe(() => {
+        expect(component.otherEditor()).toBe('Jordan');
+        done();
+      });
+    });
+  });
+
   describe('goBack()', () => {
     it('should delegate to NavigationService with fallback URL including entityId', () => {
       component.entityKey = 'Issue';
@@ -26,6 +26,7 @@ import { DataService } from '../../services/data.service';
 import { AuthService } from '../../services/auth.service';
 import { NavigationService } from '../../services/navigation.service';
 import { RecurringService } from '../../services/recurring.service';
+import { EntityLockService } from '../../services/entity-lock.service';
 import {
   SchemaEntityProperty,
   SchemaEntityTable,
@@ -88,6 +89,7 @@ export class EditPage implements OnDestroy {
   private keycloak = inject(Keycloak);
   private analytics = inject(AnalyticsService);
   private recurringService = inject(RecurringService);
+  private entityLock = inject(EntityLockService);
   private navigation = inject(NavigationService);
   private profileService = inject(ProfileService);
   private titleService = inject(Title);
@@ -202,6 +204,9 @@ export class EditPage implements OnDestroy {
         // Check if this entity is part of a recurring series
         this.checkSeriesMembership();
 
+        // Hold off batch operations on this row while it's open
+        this.holdEntityLock();
+
         // Guided form mode: trigger context loading (handled by guidedFormContextEffect)
         this.initGuidedFormMode(this.currentEntity, data);
 
@@ -261,6 +266,12 @@ export class EditPage implements OnDestroy {
   public showScopeDialog = signal(false);
   private pendingFormData: any = null;
 
+  // v0.79.0: Soft lock lease while the record is open
+  private entityLockSub?: Subscription;
+  private lockedEntity?: { key: string; id: string };
+  public otherEditor = signal<string | null>(null);  // Another user holding the lease
+  public seriesSkippedCount = signal(0);  // "Edit all" instances skipped because someone else was editing them
+
   // Signal-based modal state (replaces ViewChild DialogComponent)
   showSuccessModal = signal(false);
   showErrorModal = signal(false);
@@ -269,6 +280,34 @@ export class EditPage implements OnDestroy {
   ngOnDestroy(): void {
     this.cancelAutoSave();
     this.statusChangesSub?.unsubscribe();
+    this.releaseEntityLock();
+  }
+
+  /**
+   * Takes (and keeps renewing) a soft lock on the open record so batch
+   * operations skip it. Never blocks editing; another user's lease only
+   * shows a notice.
+   * @since v0.79.0
+   */
+  private holdEntityLock(): void {
+    if (!this.entityKey || !this.entityId) return;
+    if (this.lockedEntity?.key === this.entityKey && this.lockedEntity?.id === this.entityId) return;
+
+    this.releaseEntityLock();
+    this.lockedEntity = { key: this.entityKey, id: this.entityId };
+    this.entityLockSub = this.entityLock.hold(this.entityKey, this.entityId).subscribe(result => {
+      this.otherEditor.set(result.success ? null : (result.locked_by_display_name || this.translation.get('form.another_user')));
+    });
+  }
+
+  private releaseEntityLock(): void {
+    this.entityLockSub?.unsubscribe();
+    this.entityLockSub = undefined;
+    if (this.lockedEntity) {
+      this.entityLock.release(this.lockedEntity.key, this.lockedEntity.id);
+    }
+    this.lockedEntity = undefined;
+    this.otherEditor.set(null);
   }
 
   submitForm(event: any) {
@@ -512,6 +551,7 @@ export class EditPage implements OnDestroy {
                 if (this.entityKey) {
                   this.analytics.trackEvent('Entity', 'EditSeriesAll', this.entityKey);
                 }
+                this.seriesSkippedCount.set(result.instances_skipped ?? 0);
 
                 this.handleSaveSuccess();
               } else {
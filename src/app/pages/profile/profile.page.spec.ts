@@ -12,7 +12,7 @@ import { of, Subject, BehaviorSubject } from 'rxjs';
 import { convertToParamMap, ParamMap } from '@angular/router';
 import { ProfilePage } from './profile.page';
 import { ProfileService, ProfileExtension, UserPrivateRecord } from '../../services/profile.service';
-import { NotificationService, NotificationPreference } from '../../services/notification.service';
+import { NotificationService, NotificationPreference, NotificationCategory } from '../../services/notification.service';
 import { AuthService } from '../../services/auth.service';
 import { SchemaService } from '../../services/schema.service';
 import { DataService } from '../../services/data.service';
@@ -73,7 +73,10 @@ describe('ProfilePage', () => {
     ]);
     mockNotificationService = jasmine.createSpyObj('NotificationService', [
       'getUserPreferences',
-      'updatePreference'
+      'updatePreference',
+      'getNotificationCategories',
+      'getCategoryPreferences',
+      'updateCategoryPreference'
     ]);
     mockSchemaService = jasmine.createSpyObj('SchemaService', [
       'getEntity',
@@ -131,6 +134,9 @@ describe('ProfilePage', () => {
     mockProfileService.getUserProfileRecord.and.returnValue(of(mockUser));
     mockNotificationService.getUserPreferences.and.returnValue(of([mockEmailPref]));
     mockNotificationService.updatePreference.and.returnValue(of({ success: true }));
+    mockNotificationService.getNotificationCategories.and.returnValue(of([]));
+    mockNotificationService.getCategoryPreferences.and.returnValue(of([]));
+    mockNotificationService.updateCategoryPreference.and.returnValue(of({ success: true }));
     mockSchemaService.getEntities.and.returnValue(of([]));
     mockSchemaService.getEntitiesForMenu.and.returnValue(of([]));
     mockSchemaService.getInverseRelationships.and.returnValue(of([]));
@@ -302,6 +308,27 @@ describe('ProfilePage', () => {
       component.onEmailToggle(false);
       expect(mockNotificationService.updatePreference).toHaveBeenCalledWith('email', false);
     });
+
+    it('should default categories and toggle one per channel', async () => {
+      const announcements: NotificationCategory = {
+        name: 'announcements', display_name: 'Announcements', default_enabled: true, sort_order: 40
+      };
+      mockNotificationService.getNotificationCategories.and.returnValue(of([announcements]));
+      mockNotificationService.getCategoryPreferences.and.returnValue(of([{
+        user_id: 'user-123', category: 'announcements', channel: 'email', enabled: true,
+        created_at: '2026-10-16T00:00:00Z', updated_at: '2026-10-16T00:00:00Z'
+      }]));
+      fixture = TestBed.createComponent(ProfilePage);
+      component = fixture.componentInstance;
+      await fixture.whenStable();
+
+      expect(mockNotificationService.getCategoryPreferences).toHaveBeenCalledWith('user-123');
+      expect(component.isCategoryEnabled(announcements, 'sms')).toBeTrue();
+
+      component.onCategoryToggle('announcements', 'email', false);
+      expect(mockNotificationService.updateCategoryPreference).toHaveBeenCalledWith('user-123', 'announcements', 'email', false);
+      expect(component.isCategoryEnabled(announcements, 'email')).toBeFalse();
+    });
   });
 
   describe('Profile Extensions', () => {
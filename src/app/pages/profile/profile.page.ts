@@ -11,7 +11,7 @@ import { Router, ActivatedRoute } from '@angular/router';
 import { combineLatest, forkJoin, of, take } from 'rxjs';
 import { filter, switchMap } from 'rxjs/operators';
 import { ProfileService, ProfileExtension, UserPrivateRecord } from '../../services/profile.service';
-import { NotificationService, NotificationPreference } from '../../services/notification.service';
+import { NotificationService, NotificationPreference, NotificationCategory, NotificationCategoryPreference } from '../../services/notification.service';
 import { AuthService } from '../../services/auth.service';
 import { SchemaService } from '../../services/schema.service';
 import { DataService } from '../../services/data.service';
@@ -70,6 +70,8 @@ export class ProfilePage {
   preferencesLoading = signal(false);
   emailPreference = signal<NotificationPreference | undefined>(undefined);
   smsPreference = signal<NotificationPreference | undefined>(undefined);
+  notificationCategories = signal<NotificationCategory[]>([]);
+  categoryPreferences = signal<NotificationCategoryPreference[]>([]);
 
   // ─── Profile extensions ──────────────────────────────────────────
   extensions = signal<ProfileExtension[]>([]);
@@ -155,7 +157,8 @@ export class ProfilePage {
     forkJoin({
       user: this.profileService.getCurrentUserPrivateRecord(),
       extensions: this.profileService.getProfileExtensions(),
-      prefs: this.notificationService.getUserPreferences()
+      prefs: this.notificationService.getUserPreferences(),
+      categories: this.notificationService.getNotificationCategories()
     }).pipe(
       takeUntilDestroyed(this.destroyRef)
     ).subscribe(result => {
@@ -164,6 +167,10 @@ export class ProfilePage {
 
       this.emailPreference.set(result.prefs.find(p => p.channel === 'email'));
       this.smsPreference.set(result.prefs.find(p => p.channel === 'sms'));
+      this.notificationCategories.set(result.categories);
+      if (result.user?.id && result.categories.length > 0) {
+        this.loadCategoryPreferences(result.user.id);
+      }
 
       this.loading.set(false);
 
@@ -479,6 +486,32 @@ export class ProfilePage {
     });
   }
 
+  private loadCategoryPreferences(userId: string): void {
+    this.notificationService.getCategoryPreferences(userId).pipe(
+      takeUntilDestroyed(this.destroyRef)
+    ).subscribe(prefs => this.categoryPreferences.set(prefs));
+  }
+
+  /** Whether a category is on for a channel; the category default until the user chooses */
+  isCategoryEnabled(category: NotificationCategory, channel: 'email' | 'sms'): boolean {
+    const pref = this.categoryPreferences().find(p => p.category === category.name && p.channel === channel);
+    return pref ? pref.enabled : category.default_enabled;
+  }
+
+  onCategoryToggle(category: string, channel: 'email' | 'sms', enabled: boolean): void {
+    const userId = this.userRecord()?.id;
+    if (!userId) return;
+    this.notificationService.updateCategoryPreference(userId, category, channel, enabled).pipe(
+      takeUntilDestroyed(this.destroyRef)
+    ).subscribe(result => {
+      if (result.success) {
+        this.categoryPreferences.update(prefs =>
+          prefs.map(p => p.category === category && p.channel === channel ? { ...p, enabled } : p)
+        );
+      }
+    });
+  }
+
   // ─── Extension navigation ───────────────────────────────────────
 
   navigateToEditExtension(tableName: string, recordId: string): void {
@@ -0,0 +1,138 @@
+/**
+ * Copyright (C) 2023-2026 Civic OS, L3C
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ */
+
+import { ComponentFixture, TestBed } from '@angular/core/testing';
+import { provideHttpClient } from '@angular/common/http';
+import { HttpTestingController, provideHttpClientTesting } from '@angular/common/http/testing';
+import { provideZonelessChangeDetection } from '@angular/core';
+import { SystemMaintenancePage, MaintenanceTask } from './system-maintenance.page';
+import { AuthService } from '../../services/auth.service';
+
+function createMockTask(overrides: Partial<MaintenanceTask> = {}): MaintenanceTask {
+  return {
+    name: 'validation_cleanup',
+    description: 'Purge template validation/preview results',
+    enabled: true,
+    interval_seconds: 60,
+    jitter_seconds: 0,
+    next_run_at: '2026-10-16T12:01:00Z',
+    last_started_at: '2026-10-16T12:00:00Z',
+    last_finished_at: '2026-10-16T12:00:00Z',
+    last_duration_ms: 12,
+    last_success: true,
+    last_message: 'Purged 0 results',
+    run_count: 10,
+    failure_count: 0,
+    registered_at: '2026-10-16T11:00:00Z',
+    ...overrides
+  };
+}
+
+describe('SystemMaintenancePage', () => {
+  let component: SystemMaintenancePage;
+  let fixture: ComponentFixture<SystemMaintenancePage>;
+  let httpMock: HttpTestingController;
+
+  const mockAuthService = {
+    isAdmin: () => true,
+  };
+
+  beforeEach(async () => {
+    await TestBed.configureTestingModule({
+      imports: [SystemMaintenancePage],
+      providers: [
+        provideZonelessChangeDetection(),
+        provideHttpClient(),
+        provideHttpClientTesting(),
+        { provide: AuthService, useValue: mockAuthService },
+      ]
+    }).compileComponents();
+
+    httpMock = TestBed.inject(HttpTestingController);
+    fixture = TestBed.createComponent(SystemMaintenancePage);
+    component = fixture.componentInstance;
+    fixture.detectChanges();
+
+    httpMock.expectOne(req => req.url.endsWith('rpc/get_maintenance_tasks')).flush([
+      createMockTask(),
+      createMockTask({ name: 'gallery_cleanup', interval_seconds: 86400, jitter_seconds: 3600, last_success: false })
+    ]);
+  });
+
+  afterEach(() => {
+    httpMock.verify();
+  });
+
+  it('should load tasks', () => {
+    expect(component.tasks().length).toBe(2);
+    expect(component.loading()).toBeFalse();
+  });
+
+  it('should count failing tasks', () => {
+    expect(component.failingCount()).toBe(1);
+  });
+
+  it('should format seconds as the largest whole unit', () => {
+    expect(component.formatSeconds(0)).toBe('none');
+    expect(component.formatSeconds(45)).toBe('45 s');
+    expect(component.formatSeconds(300)).toBe('5 min');
+    expect(component.formatSeconds(3600)).toBe('1 h');
+    expect(component.formatSeconds(86400)).toBe('1 d');
+  });
+
+  it('should track schedule edits as drafts', () => {
+    const task = component.tasks()[0];
+    expect(component.isDirty(task)).toBeFalse();
+
+    component.updateDraft(task, 'interval_seconds', 120);
+    expect(component.isDirty(task)).toBeTrue();
+    expect(component.draftFor(task).interval_seconds).toBe(120);
+    expect(component.draftFor(task).jitter_seconds).toBe(0);
+  });
+
+  it('should reject non-positive intervals and negative jitter', () => {
+    const task = component.tasks()[0];
+    component.updateDraft(task, 'interval_seconds', 0);
+    expect(component.isDraftValid(task)).toBeFalse();
+
+    component.updateDraft(task, 'interval_seconds', 60);
+    component.updateDraft(task, 'jitter_seconds', -1);
+    expect(component.isDraftValid(task)).toBeFalse();
+  });
+
+  it('should save interval and jitter through update_maintenance_task', () => {
+    const task = component.tasks()[0];
+    component.updateDraft(task, 'interval_seconds', 120);
+    component.saveSchedule(task);
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/update_maintenance_task'));
+    expect(req.request.body).toEqual({ p_name: 'validation_cleanup', p_interval_seconds: 120, p_jitter_seconds: 0 });
+    req.flush({ success: true });
+
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_maintenance_tasks')).flush([createMockTask({ interval_seconds: 120 })]);
+    expect(component.isDirty(component.tasks()[0])).toBeFalse();
+  });
+
+  it('should toggle enabled', () => {
+    component.toggleEnabled(component.tasks()[0]);
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/update_maintenance_task'));
+    expect(req.request.body).toEqual({ p_name: 'validation_cleanup', p_enabled: false });
+    req.flush({ success: true });
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_maintenance_tasks')).flush([]);
+  });
+
+  it('should show the message when run now is refused', () => {
+    component.runNow(component.tasks()[0]);
+
+    httpMock.expectOne(r => r.url.endsWith('rpc/run_maintenance_task_now'))
+      .flush({ success: false, message: 'Task is disabled; enable it to run' });
+    expect(component.error()).toBe('Task is disabled; enable it to run');
+  });
+});
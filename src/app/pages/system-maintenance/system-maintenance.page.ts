@@ -0,0 +1,186 @@
+/**
+ * Copyright (C) 2023-2026 Civic OS, L3C
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ */
+
+import { Component, ChangeDetectionStrategy, inject, signal, computed, OnInit } from '@angular/core';
+import { CommonModule, DatePipe } from '@angular/common';
+import { FormsModule } from '@angular/forms';
+import { HttpClient } from '@angular/common/http';
+import { AuthService } from '../../services/auth.service';
+import { getPostgrestUrl } from '../../config/runtime';
+
+export interface MaintenanceTask {
+  name: string;
+  description: string | null;
+  enabled: boolean;
+  interval_seconds: number;
+  jitter_seconds: number;
+  next_run_at: string;
+  last_started_at: string | null;
+  last_finished_at: string | null;
+  last_duration_ms: number | null;
+  last_success: boolean | null;
+  last_message: string | null;
+  run_count: number;
+  failure_count: number;
+  registered_at: string | null;
+}
+
+/** Unsaved interval/jitter edits for one task, in seconds */
+interface ScheduleDraft {
+  interval_seconds: number;
+  jitter_seconds: number;
+}
+
+/**
+ * Maintenance Tasks page.
+ *
+ * Lists the consolidated worker's built-in maintenance tasks from
+ * metadata.maintenance_tasks (via get_maintenance_tasks()) with their last
+ * run, and lets admins enable/disable a task, change its interval and jitter,
+ * or make it due immediately.
+ *
+ * Permission-gated: requires admin role (RPCs check is_admin()).
+ *
+ * @since v0.77.0
+ */
+@Component({
+  selector: 'app-system-maintenance',
+  standalone: true,
+  imports: [CommonModule, FormsModule, DatePipe],
+  templateUrl: './system-maintenance.page.html',
+  changeDetection: ChangeDetectionStrategy.OnPush
+})
+export class SystemMaintenancePage implements OnInit {
+  private http = inject(HttpClient);
+  private auth = inject(AuthService);
+  private readonly apiUrl = getPostgrestUrl();
+
+  canView = computed(() => this.auth.isAdmin());
+
+  loading = signal(true);
+  error = signal<string | undefined>(undefined);
+  success = signal<string | undefined>(undefined);
+  tasks = signal<MaintenanceTask[]>([]);
+  drafts = signal<Record<string, ScheduleDraft>>({});
+  savingName = signal<string | null>(null);
+
+  failingCount = computed(() => this.tasks().filter(t => t.last_success === false).length);
+
+  ngOnInit() {
+    if (this.canView()) {
+      this.loadTasks();
+    } else {
+      this.loading.set(false);
+    }
+  }
+
+  loadTasks() {
+    this.loading.set(true);
+    this.http.get<MaintenanceTask[]>(`${this.apiUrl}rpc/get_maintenance_tasks`).subscribe({
+      next: (tasks) => {
+        this.tasks.set(tasks || []);
+        this.drafts.set({});
+        this.loading.set(false);
+      },
+      error: (err) => {
+        this.error.set('Failed to load maintenance tasks');
+        this.loading.set(false);
+        console.error('Maintenance tasks load error:', err);
+      }
+    });
+  }
+
+  // --- Schedule editing ---
+
+  draftFor(task: MaintenanceTask): ScheduleDraft {
+    return this.drafts()[task.name] ?? {
+      interval_seconds: task.interval_seconds,
+      jitter_seconds: task.jitter_seconds
+    };
+  }
+
+  updateDraft(task: MaintenanceTask, field: keyof ScheduleDraft, value: number) {
+    this.drafts.update(d => ({
+      ...d,
+      [task.name]: { ...this.draftFor(task), [field]: value }
+    }));
+  }
+
+  isDirty(task: MaintenanceTask): boolean {
+    const draft = this.drafts()[task.name];
+    return !!draft && (draft.interval_seconds !== task.interval_seconds ||
+      draft.jitter_seconds !== task.jitter_seconds);
+  }
+
+  isDraftValid(task: MaintenanceTask): boolean {
+    const draft = this.draftFor(task);
+    return Number.isInteger(draft.interval_seconds) && draft.interval_seconds > 0 &&
+      Number.isInteger(draft.jitter_seconds) && draft.jitter_seconds >= 0;
+  }
+
+  saveSchedule(task: MaintenanceTask) {
+    const draft = this.draftFor(task);
+    this.submit(task, 'update_maintenance_task', {
+      p_name: task.name,
+      p_interval_seconds: draft.interval_seconds,
+      p_jitter_seconds: draft.jitter_seconds
+    }, `Schedule for ${task.name} saved`);
+  }
+
+  toggleEnabled(task: MaintenanceTask) {
+    this.submit(task, 'update_maintenance_task', {
+      p_name: task.name,
+      p_enabled: !task.enabled
+    }, `${task.name} ${task.enabled ? 'disabled' : 'enabled'}`);
+  }
+
+  runNow(task: MaintenanceTask) {
+    this.submit(task, 'run_maintenance_task_now', { p_name: task.name });
+  }
+
+  private submit(task: MaintenanceTask, rpc: string, body: object, successMessage?: string) {
+    this.savingName.set(task.name);
+    this.error.set(undefined);
+    this.success.set(undefined);
+
+    this.http.post<{ success: boolean; message?: string }>(`${this.apiUrl}rpc/${rpc}`, body).subscribe({
+      next: (result) => {
+        this.savingName.set(null);
+        if (result && result.success === false) {
+          this.error.set(result.message || 'Request failed');
+          return;
+        }
+        this.success.set(result?.message || successMessage);
+        this.loadTasks();
+      },
+      error: (err) => {
+        this.savingName.set(null);
+        this.error.set(err.error?.message || 'Request failed');
+      }
+    });
+  }
+
+  // --- Helpers ---
+
+  /** Formats a number of seconds as the largest whole unit (e.g., "5 min", "24 h") */
+  formatSeconds(seconds: number): string {
+    if (seconds <= 0) return 'none';
+    if (seconds % 86400 === 0) return `${seconds / 86400} d`;
+    if (seconds % 3600 === 0) return `${seconds / 3600} h`;
+    if (seconds % 60 === 0) return `${seconds / 60} min`;
+    return `${seconds} s`;
+  }
+
+  /** Status badge class for the last run */
+  lastRunBadge(task: MaintenanceTask): string {
+    if (task.last_success === true) return 'badge-success';
+    if (task.last_success === false) return 'badge-error';
+    return 'badge-ghost';
+  }
+}
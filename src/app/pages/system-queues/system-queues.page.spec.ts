@@ -0,0 +1,257 @@
+/**
+ * Copyright (C) 2023-2026 Civic OS, L3C
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ */
+
+import { ComponentFixture, TestBed } from '@angular/core/testing';
+import { provideHttpClient } from '@angular/common/http';
+import { HttpTestingController, provideHttpClientTesting } from '@angular/common/http/testing';
+import { provideZonelessChangeDetection } from '@angular/core';
+import { SystemQueuesPage, QueueControl, JobKindSummary, JobDeadLetter } from './system-queues.page';
+import { AuthService } from '../../services/auth.service';
+
+function createMockQueue(overrides: Partial<QueueControl> = {}): QueueControl {
+  return {
+    queue_name: 'notifications',
+    paused_at: null,
+    paused_by: null,
+    pause_reason: null,
+    resume_at: null,
+    breaker_enabled: false,
+    breaker_error_rate: 0.5,
+    breaker_min_attempts: 20,
+    breaker_window_seconds: 300,
+    breaker_cooldown_seconds: 600,
+    last_error_rate: null,
+    last_attempts: null,
+    last_evaluated_at: null,
+    last_tripped_at: null,
+    trip_count: 0,
+    available_jobs: 3,
+    running_jobs: 1,
+    ...overrides
+  };
+}
+
+function createMockJobKind(overrides: Partial<JobKindSummary> = {}): JobKindSummary {
+  return {
+    kind: 'send_notification',
+    queue: 'notifications',
+    discarded_jobs: 12,
+    last_discarded_at: '2026-10-16T11:00:00Z',
+    running_jobs: 2,
+    stuck_jobs: 1,
+    oldest_attempted_at: '2026-10-16T09:00:00Z',
+    ...overrides
+  };
+}
+
+function createMockDeadLetter(overrides: Partial<JobDeadLetter> = {}): JobDeadLetter {
+  return {
+    id: 7,
+    river_job_id: 4821,
+    kind: 'send_notification',
+    queue: 'notifications',
+    args: { user_id: 'abc', template_name: 'appointment_reminder' },
+    last_error: 'smtp: 421 service not available',
+    attempt: 25,
+    max_attempts: 25,
+    discarded_at: '2026-10-16T11:00:00Z',
+    captured_at: '2026-10-16T11:00:01Z',
+    notified_at: null,
+    resolved_at: null,
+    resolution: null,
+    ...overrides
+  };
+}
+
+describe('SystemQueuesPage', () => {
+  let component: SystemQueuesPage;
+  let fixture: ComponentFixture<SystemQueuesPage>;
+  let httpMock: HttpTestingController;
+
+  const mockAuthService = {
+    isAdmin: () => true,
+  };
+
+  beforeEach(async () => {
+    await TestBed.configureTestingModule({
+      imports: [SystemQueuesPage],
+      providers: [
+        provideZonelessChangeDetection(),
+        provideHttpClient(),
+        provideHttpClientTesting(),
+        { provide: AuthService, useValue: mockAuthService },
+      ]
+    }).compileComponents();
+
+    httpMock = TestBed.inject(HttpTestingController);
+    fixture = TestBed.createComponent(SystemQueuesPage);
+    component = fixture.componentInstance;
+    fixture.detectChanges();
+
+    httpMock.expectOne(req => req.url.endsWith('rpc/get_queue_controls')).flush([
+      createMockQueue(),
+      createMockQueue({
+        queue_name: 'thumbnails',
+        paused_at: '2026-10-16T12:00:00Z',
+        paused_by: 'circuit_breaker',
+        pause_reason: 'Circuit breaker: 18 of 20 attempts failed in the last 300 seconds',
+        resume_at: '2026-10-16T12:10:00Z',
+        breaker_enabled: true,
+        trip_count: 1
+      })
+    ]);
+    httpMock.expectOne(req => req.url.endsWith('rpc/get_job_kind_summary')).flush([createMockJobKind()]);
+    httpMock.expectOne(req => req.url.endsWith('rpc/get_job_admin_runs')).flush([]);
+    httpMock.expectOne(req => req.url.endsWith('rpc/get_job_dead_letters')).flush([createMockDeadLetter()]);
+  });
+
+  afterEach(() => {
+    httpMock.verify();
+  });
+
+  it('should load queues', () => {
+    expect(component.queues().length).toBe(2);
+    expect(component.loading()).toBeFalse();
+  });
+
+  it('should count paused queues', () => {
+    expect(component.pausedCount()).toBe(1);
+  });
+
+  it('should label running, paused and tripped queues', () => {
+    const [running, tripped] = component.queues();
+    expect(component.statusLabel(running)).toBe('running');
+    expect(component.statusLabel(tripped)).toBe('tripped');
+    expect(component.statusLabel({ ...tripped, paused_by: 'admin' })).toBe('paused');
+    expect(component.statusBadge(tripped)).toBe('badge-error');
+  });
+
+  it('should pause with a reason and duration', () => {
+    const queue = component.queues()[0];
+    component.openPause(queue);
+    component.pauseReason.set('  SMTP outage ');
+    component.pauseMinutes.set(30);
+    component.confirmPause(queue);
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/pause_queue'));
+    expect(req.request.body).toEqual({ p_queue: 'notifications', p_reason: 'SMTP outage', p_resume_after_minutes: 30 });
+    req.flush({ success: true, message: 'Queue notifications paused' });
+
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_queue_controls')).flush([]);
+    expect(component.success()).toBe('Queue notifications paused');
+    expect(component.pausingName()).toBeNull();
+  });
+
+  it('should reject a non-positive pause duration', () => {
+    component.pauseMinutes.set(0);
+    expect(component.isPauseValid()).toBeFalse();
+    component.pauseMinutes.set(null);
+    expect(component.isPauseValid()).toBeTrue();
+  });
+
+  it('should show the message when resume is refused', () => {
+    component.resume(component.queues()[1]);
+
+    httpMock.expectOne(r => r.url.endsWith('rpc/resume_queue'))
+      .flush({ success: false, message: 'Queue thumbnails is not paused' });
+    expect(component.error()).toBe('Queue thumbnails is not paused');
+  });
+
+  it('should save breaker settings with the threshold as a fraction', () => {
+    const queue = component.queues()[0];
+    expect(component.draftFor(queue).error_rate_percent).toBe(50);
+
+    component.updateDraft(queue, 'error_rate_percent', 25);
+    expect(component.isDirty(queue)).toBeTrue();
+    component.saveBreaker(queue);
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/update_queue_circuit_breaker'));
+    expect(req.request.body).toEqual({
+      p_queue: 'notifications',
+      p_error_rate: 0.25,
+      p_min_attempts: 20,
+      p_window_seconds: 300,
+      p_cooldown_seconds: 600
+    });
+    req.flush({ success: true });
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_queue_controls')).flush([]);
+  });
+
+  it('should reject thresholds outside 1-100%', () => {
+    const queue = component.queues()[0];
+    component.updateDraft(queue, 'error_rate_percent', 0);
+    expect(component.isDraftValid(queue)).toBeFalse();
+    component.updateDraft(queue, 'error_rate_percent', 101);
+    expect(component.isDraftValid(queue)).toBeFalse();
+  });
+
+  it('should toggle the breaker', () => {
+    component.toggleBreaker(component.queues()[0]);
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/update_queue_circuit_breaker'));
+    expect(req.request.body).toEqual({ p_queue: 'notifications', p_enabled: true });
+    req.flush({ success: true });
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_queue_controls')).flush([]);
+  });
+
+  it('should load job kinds with the stuck threshold', () => {
+    expect(component.jobKinds().length).toBe(1);
+    component.stuckMinutes.set(30);
+    component.loadJobAdmin();
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/get_job_kind_summary'));
+    expect(req.request.params.get('p_stuck_minutes')).toBe('30');
+    req.flush([]);
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_job_admin_runs')).flush([]);
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_job_dead_letters')).flush([]);
+    expect(component.jobKinds().length).toBe(0);
+  });
+
+  it('should request a retry of discarded jobs', () => {
+    component.retryDiscarded(component.jobKinds()[0]);
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/request_retry_discarded_jobs'));
+    expect(req.request.body).toEqual({ p_kind: 'send_notification' });
+    req.flush({ success: true, message: 'Retrying 12 discarded send_notification job(s)' });
+
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_job_kind_summary')).flush([]);
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_job_admin_runs')).flush([]);
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_job_dead_letters')).flush([]);
+    expect(component.success()).toBe('Retrying 12 discarded send_notification job(s)');
+    expect(component.jobActionKey()).toBeNull();
+  });
+
+  it('should cancel stuck jobs of a kind', () => {
+    component.cancelStuck(component.jobKinds()[0]);
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/request_cancel_stuck_jobs'));
+    expect(req.request.body).toEqual({ p_running_minutes: 60, p_kind: 'send_notification' });
+    req.flush({ success: false, message: 'No jobs running longer than 60 minutes' });
+    expect(component.error()).toBe('No jobs running longer than 60 minutes');
+  });
+
+  it('should load unresolved dead letters', () => {
+    expect(component.deadLetters().length).toBe(1);
+    expect(component.deadLetters()[0].kind).toBe('send_notification');
+  });
+
+  it('should dismiss a dead letter', () => {
+    component.dismissDeadLetter(component.deadLetters()[0]);
+
+    const req = httpMock.expectOne(r => r.url.endsWith('rpc/dismiss_job_dead_letters'));
+    expect(req.request.body).toEqual({ p_ids: [7] });
+    req.flush({ success: true, dismissed: 1, message: 'Dismissed 1 dead letter(s)' });
+
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_job_kind_summary')).flush([]);
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_job_admin_runs')).flush([]);
+    httpMock.expectOne(r => r.url.endsWith('rpc/get_job_dead_letters')).flush([]);
+    expect(component.success()).toBe('Dismissed 1 dead letter(s)');
+    expect(component.deadLetters().length).toBe(0);
+  });
+});
@@ -0,0 +1,365 @@
+/**
+ * Copyright (C) 2023-2026 Civic OS, L3C
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ */
+
+import { Component, ChangeDetectionStrategy, inject, signal, computed, OnInit } from '@angular/core';
+import { CommonModule, DatePipe } from '@angular/common';
+import { FormsModule } from '@angular/forms';
+import { HttpClient } from '@angular/common/http';
+import { AuthService } from '../../services/auth.service';
+import { getPostgrestUrl } from '../../config/runtime';
+
+export interface QueueControl {
+  queue_name: string;
+  paused_at: string | null;
+  paused_by: 'admin' | 'circuit_breaker' | null;
+  pause_reason: string | null;
+  resume_at: string | null;
+  breaker_enabled: boolean;
+  breaker_error_rate: number;
+  breaker_min_attempts: number;
+  breaker_window_seconds: number;
+  breaker_cooldown_seconds: number;
+  last_error_rate: number | null;
+  last_attempts: number | null;
+  last_evaluated_at: string | null;
+  last_tripped_at: string | null;
+  trip_count: number;
+  available_jobs: number;
+  running_jobs: number;
+}
+
+/** Discarded and running jobs of one kind (get_job_kind_summary) */
+export interface JobKindSummary {
+  kind: string;
+  queue: string;
+  discarded_jobs: number;
+  last_discarded_at: string | null;
+  running_jobs: number;
+  stuck_jobs: number;
+  oldest_attempted_at: string | null;
+}
+
+/** A purge, bulk retry or bulk cancel (metadata.job_admin_runs) */
+export interface JobAdminRun {
+  id: number;
+  action: 'purge' | 'retry_discarded' | 'cancel_stuck';
+  job_kind: string | null;
+  parameters: Record<string, unknown>;
+  status: 'running' | 'completed' | 'failed';
+  jobs_affected: number;
+  jobs_remaining: number;
+  requested_by: string | null;
+  river_job_id: number | null;
+  error_message: string | null;
+  started_at: string;
+  finished_at: string | null;
+}
+
+/** A discarded job captured by the workers (metadata.job_dead_letters) */
+export interface JobDeadLetter {
+  id: number;
+  river_job_id: number;
+  kind: string;
+  queue: string;
+  args: Record<string, unknown>;
+  last_error: string | null;
+  attempt: number;
+  max_attempts: number;
+  discarded_at: string;
+  captured_at: string;
+  notified_at: string | null;
+  resolved_at: string | null;
+  resolution: 'retried' | 'dismissed' | null;
+}
+
+/** Unsaved circuit breaker edits for one queue (error rate as a percentage) */
+interface BreakerDraft {
+  error_rate_percent: number;
+  min_attempts: number;
+  window_seconds: number;
+  cooldown_seconds: number;
+}
+
+/**
+ * Job Queues page.
+ *
+ * Lists River queues (via get_queue_controls()) with their pause state and
+ * circuit breaker, and lets admins pause a queue (optionally for a set time),
+ * resume it, and configure its breaker. Pausing takes effect on every worker
+ * within a second; running jobs finish and queued jobs wait.
+ *
+ * Below the queues, job kinds with discarded or long-running jobs can be
+ * bulk-retried or cancelled (queued as job_admin jobs), and recent purges,
+ * retries and cancellations are listed from get_job_admin_runs() (v0.90.0).
+ *
+ * Permission-gated: requires admin role (RPCs check is_admin()).
+ *
+ * @since v0.89.0
+ */
+@Component({
+  selector: 'app-system-queues',
+  standalone: true,
+  imports: [CommonModule, FormsModule, DatePipe],
+  templateUrl: './system-queues.page.html',
+  changeDetection: ChangeDetectionStrategy.OnPush
+})
+export class SystemQueuesPage implements OnInit {
+  private http = inject(HttpClient);
+  private auth = inject(AuthService);
+  private readonly apiUrl = getPostgrestUrl();
+
+  canView = computed(() => this.auth.isAdmin());
+
+  loading = signal(true);
+  error = signal<string | undefined>(undefined);
+  success = signal<string | undefined>(undefined);
+  queues = signal<QueueControl[]>([]);
+  drafts = signal<Record<string, BreakerDraft>>({});
+  savingName = signal<string | null>(null);
+
+  /** Queue whose pause form is open, with its reason and optional duration */
+  pausingName = signal<string | null>(null);
+  pauseReason = signal('');
+  pauseMinutes = signal<number | null>(null);
+
+  pausedCount = computed(() => this.queues().filter(q => q.paused_at !== null).length);
+
+  /** Job kinds with discarded or running jobs, and recent job admin runs */
+  jobKinds = signal<JobKindSummary[]>([]);
+  jobRuns = signal<JobAdminRun[]>([]);
+  /** Unresolved dead letters, newest first */
+  deadLetters = signal<JobDeadLetter[]>([]);
+  /** Jobs running longer than this count as stuck */
+  stuckMinutes = signal(60);
+  jobActionKey = signal<string | null>(null);
+
+  ngOnInit() {
+    if (this.canView()) {
+      this.loadQueues();
+      this.loadJobAdmin();
+    } else {
+      this.loading.set(false);
+    }
+  }
+
+  loadQueues() {
+    this.loading.set(true);
+    this.http.get<QueueControl[]>(`${this.apiUrl}rpc/get_queue_controls`).subscribe({
+      next: (queues) => {
+        this.queues.set(queues || []);
+        this.drafts.set({});
+        this.loading.set(false);
+      },
+      error: (err) => {
+        this.error.set('Failed to load job queues');
+        this.loading.set(false);
+        console.error('Job queues load error:', err);
+      }
+    });
+  }
+
+  loadJobAdmin() {
+    this.http.get<JobKindSummary[]>(`${this.apiUrl}rpc/get_job_kind_summary`, {
+      params: { p_stuck_minutes: this.stuckMinutes() }
+    }).subscribe({
+      next: (kinds) => this.jobKinds.set(kinds || []),
+      error: (err) => console.error('Job kind summary load error:', err)
+    });
+    this.http.get<JobAdminRun[]>(`${this.apiUrl}rpc/get_job_admin_runs`, {
+      params: { p_limit: 20 }
+    }).subscribe({
+      next: (runs) => this.jobRuns.set(runs || []),
+      error: (err) => console.error('Job admin runs load error:', err)
+    });
+    this.http.get<JobDeadLetter[]>(`${this.apiUrl}rpc/get_job_dead_letters`, {
+      params: { p_limit: 50 }
+    }).subscribe({
+      next: (letters) => this.deadLetters.set(letters || []),
+      error: (err) => console.error('Dead letters load error:', err)
+    });
+  }
+
+  // --- Pause / resume ---
+
+  openPause(queue: QueueControl) {
+    this.pausingName.set(queue.queue_name);
+    this.pauseReason.set('');
+    this.pauseMinutes.set(null);
+  }
+
+  cancelPause() {
+    this.pausingName.set(null);
+  }
+
+  isPauseValid(): boolean {
+    const minutes = this.pauseMinutes();
+    return minutes === null || (Number.isInteger(minutes) && minutes > 0);
+  }
+
+  confirmPause(queue: QueueControl) {
+    this.pausingName.set(null);
+    this.submit(queue, 'pause_queue', {
+      p_queue: queue.queue_name,
+      p_reason: this.pauseReason().trim() || null,
+      p_resume_after_minutes: this.pauseMinutes()
+    });
+  }
+
+  resume(queue: QueueControl) {
+    this.submit(queue, 'resume_queue', { p_queue: queue.queue_name });
+  }
+
+  // --- Circuit breaker editing ---
+
+  draftFor(queue: QueueControl): BreakerDraft {
+    return this.drafts()[queue.queue_name] ?? {
+      error_rate_percent: Math.round(queue.breaker_error_rate * 100),
+      min_attempts: queue.breaker_min_attempts,
+      window_seconds: queue.breaker_window_seconds,
+      cooldown_seconds: queue.breaker_cooldown_seconds
+    };
+  }
+
+  updateDraft(queue: QueueControl, field: keyof BreakerDraft, value: number) {
+    this.drafts.update(d => ({
+      ...d,
+      [queue.queue_name]: { ...this.draftFor(queue), [field]: value }
+    }));
+  }
+
+  isDirty(queue: QueueControl): boolean {
+    const draft = this.drafts()[queue.queue_name];
+    return !!draft && (draft.error_rate_percent !== Math.round(queue.breaker_error_rate * 100) ||
+      draft.min_attempts !== queue.breaker_min_attempts ||
+      draft.window_seconds !== queue.breaker_window_seconds ||
+      draft.cooldown_seconds !== queue.breaker_cooldown_seconds);
+  }
+
+  isDraftValid(queue: QueueControl): boolean {
+    const draft = this.draftFor(queue);
+    return Number.isInteger(draft.error_rate_percent) && draft.error_rate_percent > 0 && draft.error_rate_percent <= 100 &&
+      Number.isInteger(draft.min_attempts) && draft.min_attempts > 0 &&
+      Number.isInteger(draft.window_seconds) && draft.window_seconds > 0 &&
+      Number.isInteger(draft.cooldown_seconds) && draft.cooldown_seconds > 0;
+  }
+
+  saveBreaker(queue: QueueControl) {
+    const draft = this.draftFor(queue);
+    this.submit(queue, 'update_queue_circuit_breaker', {
+      p_queue: queue.queue_name,
+      p_error_rate: draft.error_rate_percent / 100,
+      p_min_attempts: draft.min_attempts,
+      p_window_seconds: draft.window_seconds,
+      p_cooldown_seconds: draft.cooldown_seconds
+    }, `Circuit breaker for ${queue.queue_name} saved`);
+  }
+
+  toggleBreaker(queue: QueueControl) {
+    this.submit(queue, 'update_queue_circuit_breaker', {
+      p_queue: queue.queue_name,
+      p_enabled: !queue.breaker_enabled
+    }, `Circuit breaker for ${queue.queue_name} ${queue.breaker_enabled ? 'disabled' : 'enabled'}`);
+  }
+
+  // --- Bulk retry / cancel ---
+
+  retryDiscarded(summary: JobKindSummary) {
+    this.submitJobAction(`retry:${summary.kind}`, 'request_retry_discarded_jobs', { p_kind: summary.kind });
+  }
+
+  cancelStuck(summary: JobKindSummary) {
+    this.submitJobAction(`cancel:${summary.kind}`, 'request_cancel_stuck_jobs', {
+      p_running_minutes: this.stuckMinutes(),
+      p_kind: summary.kind
+    });
+  }
+
+  dismissDeadLetter(letter: JobDeadLetter) {
+    this.submitJobAction(`dismiss:${letter.id}`, 'dismiss_job_dead_letters', { p_ids: [letter.id] });
+  }
+
+  isStuckMinutesValid(): boolean {
+    const minutes = this.stuckMinutes();
+    return Number.isInteger(minutes) && minutes > 0;
+  }
+
+  private submitJobAction(key: string, rpc: string, body: object) {
+    this.jobActionKey.set(key);
+    this.error.set(undefined);
+    this.success.set(undefined);
+
+    this.http.post<{ success: boolean; message?: string }>(`${this.apiUrl}rpc/${rpc}`, body).subscribe({
+      next: (result) => {
+        this.jobActionKey.set(null);
+        if (result && result.success === false) {
+          this.error.set(result.message || 'Request failed');
+          return;
+        }
+        this.success.set(result?.message);
+        this.loadJobAdmin();
+      },
+      error: (err) => {
+        this.jobActionKey.set(null);
+        this.error.set(err.error?.message || 'Request failed');
+      }
+    });
+  }
+
+  private submit(queue: QueueControl, rpc: string, body: object, successMessage?: string) {
+    this.savingName.set(queue.queue_name);
+    this.error.set(undefined);
+    this.success.set(undefined);
+
+    this.http.post<{ success: boolean; message?: string }>(`${this.apiUrl}rpc/${rpc}`, body).subscribe({
+      next: (result) => {
+        this.savingName.set(null);
+        if (result && result.success === false) {
+          this.error.set(result.message || 'Request failed');
+          return;
+        }
+        this.success.set(result?.message || successMessage);
+        this.loadQueues();
+      },
+      error: (err) => {
+        this.savingName.set(null);
+        this.error.set(err.error?.message || 'Request failed');
+      }
+    });
+  }
+
+  // --- Helpers ---
+
+  /** Status badge class: paused by the breaker, by an admin, or running */
+  statusBadge(queue: QueueControl): string {
+    if (queue.paused_at === null) return 'badge-success';
+    return queue.paused_by === 'circuit_breaker' ? 'badge-error' : 'badge-warning';
+  }
+
+  statusLabel(queue: QueueControl): string {
+    if (queue.paused_at === null) return 'running';
+    return queue.paused_by === 'circuit_breaker' ? 'tripped' : 'paused';
+  }
+
+  actionLabel(run: JobAdminRun): string {
+    switch (run.action) {
+      case 'purge': return 'Purge';
+      case 'retry_discarded': return 'Retry discarded';
+      case 'cancel_stuck': return 'Cancel stuck';
+    }
+  }
+
+  runBadge(run: JobAdminRun): string {
+    if (run.status === 'failed') return 'badge-error';
+    return run.status === 'running' ? 'badge-info' : 'badge-success';
+  }
+
+  formatPercent(rate: number | null): string {
+    return rate === null ? '–' : `${Math.round(rate * 100)}%`;
+  }
+}
@@ -21,6 +21,7 @@ import { of, Subject } from 'rxjs';
 import { UserManagementPage } from './user-management.page';
 import { UserManagementService, ManagedUser } from '../../services/user-management.service';
 import { ImportExportService } from '../../services/import-export.service';
+import { FileUploadService } from '../../services/file-upload.service';
 import { provideTranslationTesting } from '../../testing/translation-testing';
 import { ApiResponse } from '../../interfaces/api';
 
@@ -29,6 +30,7 @@ describe('UserManagementPage', () => {
   let fixture: ComponentFixture<UserManagementPage>;
   let mockUserService: jasmine.SpyObj<UserManagementService>;
   let mockImportExportService: jasmine.SpyObj<ImportExportService>;
+  let mockFileUploadService: jasmine.SpyObj<FileUploadService>;
 
   beforeEach(async () => {
     mockUserService = jasmine.createSpyObj('UserManagementService', [
@@ -43,13 +45,16 @@ describe('UserManagementPage', () => {
       'hasUserManagementAccess',
       'updateUserInfo',
       'getNotificationPreferences',
-      'updateNotificationPreference'
+      'updateNotificationPreference',
+      'requestUserImport',
+      'getUserImportBatches'
     ]);
     mockImportExportService = jasmine.createSpyObj('ImportExportService', [
       'validateFileSize',
       'parseExcelFile',
       'generateUserImportTemplate'
     ]);
+    mockFileUploadService = jasmine.createSpyObj('FileUploadService', ['uploadFile']);
 
     // Default mocks
     mockUserService.getManagedUsers.and.returnValue(of([]));
@@ -60,6 +65,7 @@ describe('UserManagementPage', () => {
     mockUserService.createUser.and.returnValue(of({ success: true }));
     mockUserService.assignUserRole.and.returnValue(of({ success: true }));
     mockUserService.revokeUserRole.and.returnValue(of({ success: true }));
+    mockUserService.getUserImportBatches.and.returnValue(of([]));
 
     await TestBed.configureTestingModule({
       imports: [UserManagementPage],
@@ -67,7 +73,8 @@ describe('UserManagementPage', () => {
         provideZonelessChangeDetection(),
         provideTranslationTesting(),
         { provide: UserManagementService, useValue: mockUserService },
-        { provide: ImportExportService, useValue: mockImportExportService }
+        { provide: ImportExportService, useValue: mockImportExportService },
+        { provide: FileUploadService, useValue: mockFileUploadService }
       ]
     }).compileComponents();
 
@@ -514,4 +521,44 @@ describe('UserManagementPage', () => {
       expect(mockUserService.getManagedUsers).toHaveBeenCalled();
     });
   });
+
+  describe('onBackgroundImportFile()', () => {
+    function fileEvent(name: string): Event {
+      const file = new File(['email,first_name,last_name\n'], name, { type: 'text/csv' });
+      return { target: { files: [file], value: name } } as unknown as Event;
+    }
+
+    it('should upload the CSV and request a background import', async () => {
+      mockFileUploadService.uploadFile.and.resolveTo({ id: 'file-1' } as any);
+      mockUserService.requestUserImport.and.returnValue(of({ success: true, body: { batch_id: 3 } }));
+
+      await component.onBackgroundImportFile(fileEvent('staff.csv'));
+
+      expect(mockFileUploadService.uploadFile).toHaveBeenCalledWith(jasmine.any(File), 'user_imports', 'csv');
+      expect(mockUserService.requestUserImport).toHaveBeenCalledWith('file-1');
+      expect(component.successMessage()).toContain('staff.csv queued for import');
+      expect(component.backgroundImportLoading()).toBe(false);
+      expect(mockUserService.getUserImportBatches).toHaveBeenCalledTimes(2);
+    });
+
+    it('should reject non-CSV files without uploading', async () => {
+      await component.onBackgroundImportFile(fileEvent('staff.xlsx'));
+
+      expect(mockFileUploadService.uploadFile).not.toHaveBeenCalled();
+      expect(component.errorMessage()).toContain('must be CSV files');
+    });
+
+    it('should show the RPC error when the import is rejected', async () => {
+      mockFileUploadService.uploadFile.and.resolveTo({ id: 'file-1' } as any);
+      mockUserService.requestUserImport.and.returnValue(of(<ApiResponse>{
+        success: false,
+        error: { message: 'Permission denied', humanMessage: 'Permission denied' }
+      }));
+
+      await component.onBackgroundImportFile(fileEvent('staff.csv'));
+
+      expect(component.errorMessage()).toBe('Permission denied');
+      expect(component.backgroundImportLoading()).toBe(false);
+    });
+  });
 });
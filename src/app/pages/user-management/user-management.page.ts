@@ -21,8 +21,9 @@ import { CommonModule, DatePipe } from '@angular/common';
 import { FormsModule } from '@angular/forms';
 import { RouterModule } from '@angular/router';
 import { Subject, switchMap, of, debounceTime, startWith, combineLatest, Observable, map } from 'rxjs';
-import { UserManagementService, ManagedUser, ManageableRole, ProvisionUserRequest } from '../../services/user-management.service';
+import { UserManagementService, ManagedUser, ManageableRole, ProvisionUserRequest, UserImportBatch } from '../../services/user-management.service';
 import { ImportExportService } from '../../services/import-export.service';
+import { FileUploadService } from '../../services/file-upload.service';
 import { getSmsConfig } from '../../config/runtime';
 import { ImportModalComponent } from '../../components/import-modal/import-modal.component';
 import { CustomImportConfig, ImportColumn, CustomImportResult } from '../../interfaces/import';
@@ -45,6 +46,18 @@ import { TranslatePipe } from '../../pipes/translate.pipe';
             <span class="material-symbols-outlined" aria-hidden="true">upload</span>
             Import Users
           </button>
+          <label class="btn btn-outline" [class.btn-disabled]="backgroundImportLoading()"
+                 title="Upload a large CSV; users are provisioned in the background and you get an email summary">
+            @if (backgroundImportLoading()) {
+              <span class="loading loading-spinner loading-sm"></span>
+            } @else {
+              <span class="material-symbols-outlined" aria-hidden="true">cloud_upload</span>
+            }
+            Background Import
+            <input type="file" accept=".csv,text/csv" class="hidden"
+                   [disabled]="backgroundImportLoading()"
+                   (change)="onBackgroundImportFile($event)">
+          </label>
           <button type="button" class="btn btn-primary" (click)="openCreateModal()">
             <span class="material-symbols-outlined" aria-hidden="true">person_add</span>
             Create User
@@ -197,6 +210,46 @@ import { TranslatePipe } from '../../pipes/translate.pipe';
         </div>
       }
 
+      <!-- Background Imports -->
+      @if (importBatches().length > 0) {
+        <div class="mt-6">
+          <h2 class="text-lg font-semibold mb-2">Recent Background Imports</h2>
+          <div class="overflow-x-auto">
+            <table class="table table-sm">
+              <thead>
+                <tr>
+                  <th>File</th>
+                  <th>Status</th>
+                  <th>Rows</th>
+                  <th>Created</th>
+                  <th>Already Existed</th>
+                  <th>Invalid</th>
+                  <th>Failed</th>
+                  <th>Started</th>
+                </tr>
+              </thead>
+              <tbody>
+                @for (batch of importBatches(); track batch.id) {
+                  <tr>
+                    <td>{{ batch.file_name }}</td>
+                    <td>
+                      <span class="badge badge-sm" [class]="getImportStatusClass(batch.status)"
+                            [title]="batch.error_message || ''">{{ batch.status }}</span>
+                    </td>
+                    <td>{{ batch.total_rows }}</td>
+                    <td>{{ batch.completed_rows }}</td>
+                    <td>{{ batch.skipped_rows }}</td>
+                    <td>{{ batch.invalid_rows }}</td>
+                    <td>{{ batch.failed_rows }}</td>
+                    <td>{{ batch.created_at | date:'short' }}</td>
+                  </tr>
+                }
+              </tbody>
+            </table>
+          </div>
+        </div>
+      }
+
       <!-- Error Alert -->
       @if (errorMessage()) {
         <div class="alert alert-error mt-4">
@@ -382,6 +435,7 @@ import { TranslatePipe } from '../../pipes/translate.pipe';
 export class UserManagementPage {
   private userService = inject(UserManagementService);
   private importExportService = inject(ImportExportService);
+  private fileUploadService = inject(FileUploadService);
 
   // Search and filter state
   searchTerm = signal('');
@@ -401,6 +455,10 @@ export class UserManagementPage {
 
   // Import modal state
   showImportModal = signal(false);
+
+  // Background (CSV) import state
+  backgroundImportLoading = signal(false);
+  importBatches = signal<UserImportBatch[]>([]);
   createLoading = signal(false);
   createError = signal<string | undefined>(undefined);
   newUser: ProvisionUserRequest = this.emptyUser();
@@ -434,6 +492,11 @@ export class UserManagementPage {
 
     // Initial load
     this.loadUsers();
+    this.loadImportBatches();
+  }
+
+  private loadImportBatches(): void {
+    this.userService.getUserImportBatches().subscribe(batches => this.importBatches.set(batches));
   }
 
   private loadUsers(): void {
@@ -683,6 +746,50 @@ export class UserManagementPage {
     );
   }
 
+  /**
+   * Upload a CSV and queue it for the bulk_provision_users job. Counts on the
+   * batch fill in as the worker progresses; the importer is emailed a summary.
+   */
+  async onBackgroundImportFile(event: Event): Promise<void> {
+    const input = event.target as HTMLInputElement;
+    const file = input.files?.[0];
+    input.value = '';
+    if (!file) {
+      return;
+    }
+    if (!file.name.toLowerCase().endsWith('.csv')) {
+      this.errorMessage.set('Background imports must be CSV files. Save the spreadsheet as CSV and try again.');
+      return;
+    }
+
+    this.backgroundImportLoading.set(true);
+    try {
+      const uploaded = await this.fileUploadService.uploadFile(file, 'user_imports', 'csv');
+      this.userService.requestUserImport(uploaded.id).subscribe(response => {
+        this.backgroundImportLoading.set(false);
+        if (response.success) {
+          this.successMessage.set(`${file.name} queued for import. You will receive an email summary when it finishes.`);
+          this.loadImportBatches();
+        } else {
+          this.errorMessage.set(response.error?.humanMessage || 'Failed to start import');
+        }
+      });
+    } catch (error: any) {
+      this.backgroundImportLoading.set(false);
+      this.errorMessage.set(error?.message || 'Failed to upload file');
+    }
+  }
+
+  getImportStatusClass(status: string): string {
+    switch (status) {
+      case 'completed': return 'badge-success';
+      case 'provisioning': return 'badge-info';
+      case 'pending': return 'badge-warning';
+      case 'failed': return 'badge-error';
+      default: return 'badge-ghost';
+    }
+  }
+
   onImportSuccess(count: number): void {
     this.showImportModal.set(false);
     this.successMessage.set(`${count} users submitted for provisioning.`);
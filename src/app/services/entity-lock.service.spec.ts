@@ -0,0 +1,91 @@
+/**
+ * Copyright (C) 2023-2026 Civic OS, L3C
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import { TestBed } from '@angular/core/testing';
+import { provideZonelessChangeDetection } from '@angular/core';
+import { HttpTestingController, provideHttpClientTesting } from '@angular/common/http/testing';
+import { provideHttpClient } from '@angular/common/http';
+import { EntityLockService, EntityLockResult, ENTITY_LOCK_RENEW_MS } from './entity-lock.service';
+
+describe('EntityLockService', () => {
+  let service: EntityLockService;
+  let httpMock: HttpTestingController;
+  const testPostgrestUrl = 'http://test-api.example.com/';
+
+  beforeEach(() => {
+    (window as any).civicOsConfig = {
+      postgrestUrl: testPostgrestUrl
+    };
+
+    TestBed.configureTestingModule({
+      providers: [
+        provideZonelessChangeDetection(),
+        provideHttpClient(),
+        provideHttpClientTesting()
+      ]
+    });
+    service = TestBed.inject(EntityLockService);
+    httpMock = TestBed.inject(HttpTestingController);
+    jasmine.clock().install();
+  });
+
+  afterEach(() => {
+    jasmine.clock().uninstall();
+    httpMock.verify();
+    delete (window as any).civicOsConfig;
+  });
+
+  it('should acquire a lease and renew it until unsubscribed', () => {
+    const results: EntityLockResult[] = [];
+    const sub = service.hold('issues', '42').subscribe(r => results.push(r));
+
+    jasmine.clock().tick(0);
+    const first = httpMock.expectOne(`${testPostgrestUrl}rpc/acquire_entity_lock`);
+    expect(first.request.body).toEqual({ p_entity_type: 'issues', p_entity_id: '42', p_ttl_seconds: 120 });
+    first.flush({ success: true, expires_at: '2026-10-16T12:02:00Z' });
+
+    jasmine.clock().tick(ENTITY_LOCK_RENEW_MS);
+    httpMock.expectOne(`${testPostgrestUrl}rpc/acquire_entity_lock`)
+      .flush({ success: false, locked_by_display_name: 'Jordan' });
+
+    expect(results.map(r => r.success)).toEqual([true, false]);
+
+    sub.unsubscribe();
+    jasmine.clock().tick(ENTITY_LOCK_RENEW_MS);
+    httpMock.expectNone(`${testPostgrestUrl}rpc/acquire_entity_lock`);
+  });
+
+  it('should swallow acquire errors', () => {
+    const results: EntityLockResult[] = [];
+    const sub = service.hold('issues', '42').subscribe(r => results.push(r));
+
+    jasmine.clock().tick(0);
+    httpMock.expectOne(`${testPostgrestUrl}rpc/acquire_entity_lock`)
+      .flush({ message: 'Permission denied' }, { status: 400, statusText: 'Bad Request' });
+
+    expect(results).toEqual([]);
+    sub.unsubscribe();
+  });
+
+  it('should release the lease', () => {
+    service.release('issues', '42');
+
+    const req = httpMock.expectOne(`${testPostgrestUrl}rpc/release_entity_lock`);
+    expect(req.request.body).toEqual({ p_entity_type: 'issues', p_entity_id: '42' });
+    req.flush(null);
+  });
+});
@@ -0,0 +1,85 @@
+/**
+ * Copyright (C) 2023-2026 Civic OS, L3C
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import { Injectable, inject } from '@angular/core';
+import { HttpClient } from '@angular/common/http';
+import { Observable, catchError, filter, of, switchMap, timer } from 'rxjs';
+import { getPostgrestUrl } from '../config/runtime';
+
+/**
+ * Result of acquire_entity_lock(). success=false means another user's
+ * lease is live; the caller can still edit (leases only hold off batch
+ * operations) but should say so.
+ */
+export interface EntityLockResult {
+  success: boolean;
+  expires_at?: string;
+  batch_in_progress?: boolean;
+  locked_by?: string;
+  locked_by_display_name?: string | null;
+}
+
+/** Lease length requested from the server, in seconds */
+export const ENTITY_LOCK_TTL_SECONDS = 120;
+
+/** How often a held lease is renewed (half the TTL) */
+export const ENTITY_LOCK_RENEW_MS = ENTITY_LOCK_TTL_SECONDS * 500;
+
+/**
+ * Entity soft locks (v0.79.0).
+ *
+ * While a record is open for editing, the Edit page holds a short lease on it
+ * so batch operations (series template updates, schedule regeneration) skip
+ * the row instead of changing it underneath the user. Skipped rows are
+ * reported back by those operations.
+ */
+@Injectable({
+  providedIn: 'root'
+})
+export class EntityLockService {
+  private http = inject(HttpClient);
+
+  /**
+   * Acquires a lease now and renews it until unsubscribed. Emits each
+   * acquire result. Errors (e.g., no update permission) emit nothing; the
+   * lease is best-effort and must never block editing.
+   */
+  hold(entityType: string, entityId: string): Observable<EntityLockResult> {
+    return timer(0, ENTITY_LOCK_RENEW_MS).pipe(
+      switchMap(() => this.acquire(entityType, entityId).pipe(
+        catchError(() => of(null))
+      )),
+      filter((result): result is EntityLockResult => result !== null)
+    );
+  }
+
+  acquire(entityType: string, entityId: string): Observable<EntityLockResult> {
+    return this.http.post<EntityLockResult>(`${getPostgrestUrl()}rpc/acquire_entity_lock`, {
+      p_entity_type: entityType,
+      p_entity_id: entityId,
+      p_ttl_seconds: ENTITY_LOCK_TTL_SECONDS
+    });
+  }
+
+  /** Releases the caller's lease. Fire-and-forget; an unreleased lease expires on its own. */
+  release(entityType: string, entityId: string): void {
+    this.http.post(`${getPostgrestUrl()}rpc/release_entity_lock`, {
+      p_entity_type: entityType,
+      p_entity_id: entityId
+    }).pipe(catchError(() => of(null))).subscribe();
+  }
+}
@@ -201,6 +201,7 @@ describe('FileUploadService', () => {
       // Step 1: Request presigned URL
       const reqUrl = httpMock.expectOne(r => r.url.includes('request_upload_url'));
       expect(reqUrl.request.method).toBe('POST');
+      expect(reqUrl.request.body.p_file_size).toBe(file.size);
       reqUrl.flush(requestId);
 
       // Small delay to let polling start
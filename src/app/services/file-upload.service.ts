@@ -26,6 +26,7 @@ interface UploadUrlRequest {
   p_entity_id: string;
   p_file_name: string;
   p_file_type: string;
+  p_file_size: number;  // Checked against the entity type's storage quota (v0.115.0)
 }
 
 interface UploadUrlResponse {
@@ -100,7 +101,7 @@ export class FileUploadService {
     propertyName?: string
   ): Promise<FileReference> {
     // Step 1: Request presigned upload URL
-    const requestId = await this.requestUploadUrl(file.name, file.type, entityType, entityId);
+    const requestId = await this.requestUploadUrl(file.name, file.type, file.size, entityType, entityId);
 
     // Step 2: Poll for presigned URL (max 10 seconds)
     const { url, file_id } = await this.pollForUrl(requestId);
@@ -129,6 +130,7 @@ export class FileUploadService {
   private async requestUploadUrl(
     fileName: string,
     fileType: string,
+    fileSize: number,
     entityType: string,
     entityId: string
   ): Promise<string> {
@@ -136,7 +138,8 @@ export class FileUploadService {
       p_entity_type: entityType,
       p_entity_id: entityId,
       p_file_name: fileName,
-      p_file_type: fileType
+      p_file_type: fileType,
+      p_file_size: fileSize
     };
 
     const response = await firstValueFrom(
@@ -270,7 +273,7 @@ export class FileUploadService {
           if (status === 'completed') {
             subscription.unsubscribe();
             resolve();
-          } else if (status === 'failed') {
+          } else if (status === 'failed' || status === 'unsupported') {
             subscription.unsubscribe();
             resolve();  // Resolve anyway - thumbnail failure shouldn't block upload
           } else if (attempt >= maxAttempts) {
@@ -165,7 +165,7 @@ export class GalleryService {
    */
   getGalleryImages(galleryId: string): Observable<GalleryImage[]> {
     return this.http.get<GalleryImage[]>(
-      getPostgrestUrl() + `photo_gallery_files?gallery_id=eq.${galleryId}&order=sort_order&select=file_id,sort_order,caption,alt_text,created_at,file:files!file_id(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status)`
+      getPostgrestUrl() + `photo_gallery_files?gallery_id=eq.${galleryId}&order=sort_order&select=file_id,sort_order,caption,alt_text,created_at,file:files!file_id(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status,placeholder_color,cdn_thumbnail_small_url,cdn_thumbnail_medium_url,cdn_thumbnail_large_url,cdn_urls_expire_at)`
     );
   }
 
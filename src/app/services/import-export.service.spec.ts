@@ -18,7 +18,8 @@
 import { TestBed } from '@angular/core/testing';
 import { provideZonelessChangeDetection } from '@angular/core';
 import { of, throwError } from 'rxjs';
-import { ImportExportService } from './import-export.service';
+import { utils } from 'xlsx';
+import { ImportExportService, ExportRedaction } from './import-export.service';
 import { DataService } from './data.service';
 import { SchemaService } from './schema.service';
 import {
@@ -82,8 +83,11 @@ describe('ImportExportService', () => {
     // Create spy objects for dependencies
     mockDataService = jasmine.createSpyObj('DataService', [
       'getData',
-      'getDataPaginated'
+      'getDataPaginated',
+      'callRpc'
     ]);
+    // No private columns by default; log_data_export succeeds
+    mockDataService.callRpc.and.returnValue(of([]));
     mockSchemaService = jasmine.createSpyObj('SchemaService', ['getPropsForCreate']);
 
     TestBed.configureTestingModule({
@@ -1376,6 +1380,201 @@ describe('ImportExportService', () => {
     });
   });
 
+  describe('Column privacy redaction', () => {
+    const titleProp = createMockProperty({
+      column_name: 'title',
+      display_name: 'Title',
+      sort_order: 1,
+      type: EntityPropertyType.TextShort
+    });
+
+    const ssnProp = createMockProperty({
+      column_name: 'ssn',
+      display_name: 'SSN',
+      sort_order: 2,
+      type: EntityPropertyType.TextShort
+    });
+
+    const assigneeProp = createMockProperty({
+      column_name: 'assigned_to',
+      display_name: 'Assigned To',
+      sort_order: 3,
+      type: EntityPropertyType.User
+    });
+
+    const requesterProp = createMockProperty({
+      column_name: 'requester_id',
+      display_name: 'Requester',
+      sort_order: 4,
+      type: EntityPropertyType.ForeignKeyName,
+      data_type: 'int4',
+      udt_name: 'int4',
+      join_schema: 'public',
+      join_table: 'requesters',
+      join_column: 'id'
+    });
+
+    const row = {
+      id: 1,
+      title: 'Pothole',
+      ssn: '123-45-6789',
+      assigned_to: { id: 'u1', display_name: 'Jane D.', full_name: 'Jane Doe' },
+      requester_id: { id: 7, display_name: 'John Q. Public' }
+    };
+
+    // Routes callRpc by function name; returns the log_data_export params
+    const mockRpc = (redactions: ExportRedaction[]) => {
+      mockDataService.callRpc.and.callFake((fn: string) =>
+        fn === 'get_export_redactions' ? of(redactions) : of({ success: true })
+      );
+    };
+
+    const auditParams = () =>
+      mockDataService.callRpc.calls.all()
+        .find(c => c.args[0] === 'log_data_export')?.args[1];
+
+    const exportedRows = () => {
+      const workbook = saveWorkbookSpy.calls.mostRecent().args[0];
+      const sheet = workbook.Sheets[workbook.SheetNames[0]];
+      // Row 1 = hint, Row 2 = headers
+      return utils.sheet_to_json<any>(sheet, { range: 1 });
+    };
+
+    beforeEach(() => {
+      mockDataService.getDataPaginated.and.returnValue(of({ data: [], totalCount: 1 }));
+      mockDataService.getData.and.returnValue(of([row]));
+    });
+
+    it('should ask for redactions on the entity and every embedded table', async () => {
+      mockRpc([]);
+
+      await service.exportToExcel(mockEntity, [titleProp, assigneeProp, requesterProp]);
+
+      expect(mockDataService.callRpc).toHaveBeenCalledWith('get_export_redactions', {
+        p_table_names: ['issues', 'civic_os_users', 'requesters']
+      });
+    });
+
+    it('should not select or write private columns', async () => {
+      mockRpc([{ table_name: 'issues', column_name: 'ssn' }]);
+      mockDataService.getData.and.returnValue(of([{ id: 1, title: 'Pothole' }]));
+
+      const result = await service.exportToExcel(mockEntity, [titleProp, ssnProp]);
+
+      expect(result.success).toBe(true);
+      const fields: string[] = mockDataService.getData.calls.mostRecent().args[0].fields;
+      expect(fields).toContain('title');
+      expect(fields).not.toContain('ssn');
+      expect(Object.keys(exportedRows()[0])).toEqual(['Title']);
+    });
+
+    it('should fall back to display_name when user full_name is private', async () => {
+      mockRpc([{ table_name: 'civic_os_users', column_name: 'full_name' }]);
+
+      await service.exportToExcel(mockEntity, [titleProp, assigneeProp]);
+
+      expect(exportedRows()[0]['Assigned To (Name)']).toBe('Jane D.');
+    });
+
+    it('should drop FK name columns when the target display_name is private', async () => {
+      mockRpc([{ table_name: 'requesters', column_name: 'display_name' }]);
+
+      await service.exportToExcel(mockEntity, [titleProp, requesterProp]);
+
+      const exported = exportedRows()[0];
+      expect(exported['Requester']).toBe(7);
+      expect('Requester (Name)' in exported).toBe(false);
+    });
+
+    it('should ignore private columns registered for other tables', async () => {
+      mockRpc([{ table_name: 'other_table', column_name: 'ssn' }]);
+
+      await service.exportToExcel(mockEntity, [titleProp, ssnProp]);
+
+      expect(exportedRows()[0]['SSN']).toBe('123-45-6789');
+    });
+
+    it('should block the export when redactions cannot be loaded', async () => {
+      mockDataService.callRpc.and.returnValue(throwError(() => new Error('Network error')));
+
+      const result = await service.exportToExcel(mockEntity, [titleProp, ssnProp]);
+
+      expect(result.success).toBe(false);
+      expect(result.error).toContain('column privacy');
+      expect(mockDataService.getData).not.toHaveBeenCalled();
+      expect(saveWorkbookSpy).not.toHaveBeenCalled();
+    });
+
+    it('should audit every export with exported and withheld columns', async () => {
+      mockRpc([
+        { table_name: 'issues', column_name: 'ssn' },
+        { table_name: 'requesters', column_name: 'display_name' }
+      ]);
+
+      await service.exportToExcel(mockEntity, [titleProp, ssnProp, requesterProp]);
+
+      expect(auditParams()).toEqual({
+        p_table_name: 'issues',
+        p_row_count: 1,
+        p_columns: ['title', 'requester_id'],
+        p_withheld_columns: ['ssn', 'requester_id.display_name'],
+        p_export_type: 'excel'
+      });
+    });
+
+    it('should audit with an empty withheld list when nothing is private', async () => {
+      mockRpc([]);
+
+      await service.exportToExcel(mockEntity, [titleProp]);
+
+      expect(auditParams().p_withheld_columns).toEqual([]);
+    });
+
+    it('should not write the file when the audit call fails', async () => {
+      mockDataService.callRpc.and.callFake((fn: string) =>
+        fn === 'get_export_redactions' ? of([]) : throwError(() => new Error('Audit failed'))
+      );
+
+      const result = await service.exportToExcel(mockEntity, [titleProp]);
+
+      expect(result.success).toBe(false);
+      expect(saveWorkbookSpy).not.toHaveBeenCalled();
+    });
+
+    it('should use display_name for note authors when full_name is private', () => {
+      const notes = [{
+        id: 1,
+        entity_type: 'issues',
+        entity_id: '1',
+        author_id: 'u1',
+        author: { id: 'u1', display_name: 'Jane D.', full_name: 'Jane Doe' },
+        content: 'Called back',
+        note_type: 'note' as const,
+        is_internal: false,
+        created_at: '2025-01-15T10:30:00Z',
+        updated_at: '2025-01-15T10:30:00Z'
+      }];
+
+      const result = service.transformNotesForExport(notes, [
+        { table_name: 'civic_os_users', column_name: 'full_name' }
+      ]);
+
+      expect(result[0]['Author']).toBe('Jane D.');
+    });
+
+    it('should list IDs only in template reference sheets with private names', async () => {
+      mockRpc([{ table_name: 'civic_os_users', column_name: 'display_name' }]);
+      mockDataService.getData.and.returnValue(of([{ id: 'u1' }]));
+
+      await service.downloadTemplate(mockEntity, [titleProp, assigneeProp]);
+
+      expect(mockDataService.getData.calls.mostRecent().args[0].fields).toEqual(['id']);
+      const workbook = saveWorkbookSpy.calls.mostRecent().args[0];
+      const refRows = utils.sheet_to_json<any>(workbook.Sheets['Assigned To Options']);
+      expect(refRows[0]).toEqual({ ID: 'u1' });
+    });
+  });
+
   describe('M:M Import Support', () => {
     const m2mProp = createMockProperty({
       column_name: 'service_categories',
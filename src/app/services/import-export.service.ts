@@ -33,6 +33,15 @@ import {
 import { stripMarkdown } from '../pipes/simple-markdown.pipe';
 import { FilterCriteria } from '../interfaces/query';
 
+/**
+ * A private column from metadata.column_privacy (v0.80.0). Exports withhold
+ * these columns, including when they come from an embedded table.
+ */
+export interface ExportRedaction {
+  table_name: string;
+  column_name: string;
+}
+
 /**
  * Service for Excel import/export functionality.
  * Handles data transformation, FK lookup, validation, and SheetJS operations.
@@ -105,13 +114,30 @@ export class ImportExportService {
         })
         .sort((a, b) => a.sort_order - b.sort_order);
 
-      // 3. Fetch ALL data (remove pagination)
-      const columns = exportProperties.map(p => SchemaService.propertyToSelectString(p));
+      // 3. Withhold private columns (metadata.column_privacy). If the registry
+      // can't be read the export stops rather than risk leaking them.
+      let redactions: ExportRedaction[];
+      try {
+        redactions = await this.getExportRedactions(
+          this.getRedactionTables(entity.table_name, exportProperties, !!notesService)
+        );
+      } catch (error) {
+        console.error('Failed to load column privacy settings:', error);
+        return {
+          success: false,
+          error: 'Export blocked: column privacy settings could not be loaded. Please try again.'
+        };
+      }
+      const withheldColumns = this.getWithheldColumns(entity.table_name, exportProperties, redactions);
+      const visibleProperties = exportProperties.filter(p => !withheldColumns.includes(p.column_name));
+
+      // 4. Fetch ALL data (remove pagination)
+      const columns = visibleProperties.map(p => SchemaService.propertyToSelectString(p));
 
       // Build order field
       let orderField: string | undefined = undefined;
       if (sortColumn && sortDirection) {
-        const sortProperty = exportProperties.find(p => p.column_name === sortColumn);
+        const sortProperty = visibleProperties.find(p => p.column_name === sortColumn);
         if (sortProperty) {
           orderField = this.buildOrderField(sortProperty);
         }
@@ -127,10 +153,10 @@ export class ImportExportService {
         isSummaryView
       }).toPromise() || [];
 
-      // 4. Transform data for export (add FK display columns)
-      const exportData = this.transformForExport(allData, exportProperties);
+      // 5. Transform data for export (add FK display columns)
+      const exportData = this.transformForExport(allData, visibleProperties, redactions);
 
-      // 5. Generate Excel workbook
+      // 6. Generate Excel workbook
       // Row 1 = entity info/hint, Row 2 = column headers, Row 3+ = data
       // (matches parseExcelFile range:1 convention for re-import compatibility)
       const headers = exportData.length > 0 ? Object.keys(exportData[0]) : [];
@@ -144,7 +170,7 @@ export class ImportExportService {
       const workbook = utils.book_new();
       utils.book_append_sheet(workbook, worksheet, entity.display_name);
 
-      // 6. If notes service provided, fetch notes and add as second worksheet
+      // 7. If notes service provided, fetch notes and add as second worksheet
       if (notesService && allData.length > 0 && allData[0]?.id != null) {
         try {
           // Extract entity IDs from exported data
@@ -157,7 +183,7 @@ export class ImportExportService {
 
           if (notes && notes.length > 0) {
             // Transform notes for export
-            const notesExportData = this.transformNotesForExport(notes);
+            const notesExportData = this.transformNotesForExport(notes, redactions);
             const notesWorksheet = utils.json_to_sheet(notesExportData);
             utils.book_append_sheet(workbook, notesWorksheet, 'Notes');
           }
@@ -167,7 +193,16 @@ export class ImportExportService {
         }
       }
 
-      // 7. Trigger download
+      // 8. Audit the export (admin_audit_log). No audit row, no file.
+      await firstValueFrom(this.data.callRpc('log_data_export', {
+        p_table_name: entity.table_name,
+        p_row_count: allData.length,
+        p_columns: visibleProperties.map(p => p.column_name),
+        p_withheld_columns: withheldColumns,
+        p_export_type: 'excel'
+      }));
+
+      // 9. Trigger download
       const timestamp = this.getTimestamp();
       const filename = `${entity.display_name}_${timestamp}.xlsx`;
       this.saveWorkbook(workbook, filename);
@@ -182,6 +217,84 @@ export class ImportExportService {
     }
   }
 
+  /**
+   * Load private columns for the given tables from metadata.column_privacy.
+   * Throws when the registry can't be read; callers must fail closed.
+   */
+  private async getExportRedactions(tableNames: string[]): Promise<ExportRedaction[]> {
+    const redactions = await firstValueFrom(
+      this.data.callRpc('get_export_redactions', { p_table_names: tableNames })
+    );
+    return redactions || [];
+  }
+
+  /**
+   * Tables an export reads: the entity, FK targets whose display names are
+   * exported, and civic_os_users for user columns and note authors.
+   */
+  private getRedactionTables(tableName: string, properties: SchemaEntityProperty[], includeNotes: boolean): string[] {
+    const tables = new Set<string>([tableName]);
+    properties.forEach(p => {
+      if (p.type === EntityPropertyType.ForeignKeyName && p.join_table) {
+        tables.add(p.join_table);
+      } else if (p.type === EntityPropertyType.User) {
+        tables.add('civic_os_users');
+      }
+    });
+    if (includeNotes) {
+      tables.add('civic_os_users');
+    }
+    return Array.from(tables);
+  }
+
+  /**
+   * Names of everything the export leaves out, for the audit log: the
+   * entity's own private columns, plus "column.embedded_column" for display
+   * names withheld from FK and user columns.
+   */
+  private getWithheldColumns(
+    tableName: string,
+    properties: SchemaEntityProperty[],
+    redactions: ExportRedaction[]
+  ): string[] {
+    const withheld: string[] = [];
+    properties.forEach(p => {
+      if (this.isRedacted(redactions, tableName, p.column_name)) {
+        withheld.push(p.column_name);
+      } else if (p.type === EntityPropertyType.ForeignKeyName &&
+                 this.isRedacted(redactions, p.join_table, 'display_name')) {
+        withheld.push(`${p.column_name}.display_name`);
+      } else if (p.type === EntityPropertyType.User) {
+        ['display_name', 'full_name']
+          .filter(c => this.isRedacted(redactions, 'civic_os_users', c))
+          .forEach(c => withheld.push(`${p.column_name}.${c}`));
+      }
+    });
+    return withheld;
+  }
+
+  private isRedacted(redactions: ExportRedaction[], tableName: string, columnName: string): boolean {
+    return redactions.some(r => r.table_name === tableName && r.column_name === columnName);
+  }
+
+  /**
+   * Name shown for an embedded user: full_name when available and exportable,
+   * otherwise display_name (unless that is private too).
+   */
+  private exportableUserName(
+    user: { display_name?: string; full_name?: string | null } | undefined,
+    redactions: ExportRedaction[]
+  ): string | undefined {
+    if (!user) return undefined;
+    if (user.full_name && !this.isRedacted(redactions, 'civic_os_users', 'full_name')) {
+      return user.full_name;
+    }
+    if (!this.isRedacted(redactions, 'civic_os_users', 'display_name')) {
+      return user.display_name;
+    }
+    return undefined;
+  }
+
   /**
    * Build PostgREST order field for sorting.
    * Note: For User columns, we sort by display_name (not full_name) since
@@ -206,7 +319,7 @@ export class ImportExportService {
   /**
    * Transform data for export by adding FK display columns.
    */
-  private transformForExport(data: any[], properties: SchemaEntityProperty[]): any[] {
+  private transformForExport(data: any[], properties: SchemaEntityProperty[], redactions: ExportRedaction[] = []): any[] {
     return data.map(row => {
       const exportRow: any = {};
 
@@ -218,7 +331,9 @@ export class ImportExportService {
         if (prop.type === EntityPropertyType.ForeignKeyName) {
           if (value && typeof value === 'object' && 'id' in value) {
             exportRow[prop.display_name] = value.id;
-            exportRow[prop.display_name + ' (Name)'] = value.display_name;
+            if (!this.isRedacted(redactions, prop.join_table, 'display_name')) {
+              exportRow[prop.display_name + ' (Name)'] = value.display_name;
+            }
           } else {
             exportRow[prop.display_name] = value; // Just the ID
           }
@@ -228,7 +343,10 @@ export class ImportExportService {
           if (value && typeof value === 'object' && 'id' in value) {
             exportRow[prop.display_name] = value.id;
             // Prefer full_name if available (may be null for privacy reasons)
-            exportRow[prop.display_name + ' (Name)'] = value.full_name || value.display_name;
+            const name = this.exportableUserName(value, redactions);
+            if (name !== undefined) {
+              exportRow[prop.display_name + ' (Name)'] = name;
+            }
           } else {
             exportRow[prop.display_name] = value;
           }
@@ -466,8 +584,20 @@ export class ImportExportService {
       p.type === EntityPropertyType.ManyToMany
     );
 
+    // Reference sheets list names from other tables; leave out names that are
+    // private, and all names if the privacy registry can't be read
+    const referenceTables = referenceProps.map(p => this.getReferenceTable(p));
+    const redactions = referenceTables.length > 0
+      ? await this.getExportRedactions(referenceTables).catch(error => {
+          console.error('Failed to load column privacy settings:', error);
+          return null;
+        })
+      : [];
+
     for (const prop of referenceProps) {
-      const refData = await this.fetchReferenceData(prop);
+      const includeNames = redactions !== null &&
+        !this.isRedacted(redactions, this.getReferenceTable(prop), 'display_name');
+      const refData = await this.fetchReferenceData(prop, includeNames);
       const refSheet = utils.json_to_sheet(refData);
       utils.book_append_sheet(workbook, refSheet, `${prop.display_name} Options`);
     }
@@ -526,10 +656,29 @@ export class ImportExportService {
     }
   }
 
+  /**
+   * Table a reference sheet reads for FK, User, Status, Category or M:M fields.
+   */
+  private getReferenceTable(prop: SchemaEntityProperty): string {
+    switch (prop.type) {
+      case EntityPropertyType.ManyToMany:
+        return prop.many_to_many_meta!.targetTable;
+      case EntityPropertyType.User:
+        return 'civic_os_users';
+      case EntityPropertyType.Status:
+        return 'statuses';
+      case EntityPropertyType.Category:
+        return 'categories';
+      default:
+        return prop.join_table;
+    }
+  }
+
   /**
    * Fetch reference data for FK, User, or Status field.
+   * With includeNames false the sheet lists IDs only (private display names).
    */
-  private async fetchReferenceData(prop: SchemaEntityProperty): Promise<any[]> {
+  private async fetchReferenceData(prop: SchemaEntityProperty, includeNames = true): Promise<any[]> {
     try {
       let tableName: string;
       let columnName: string;
@@ -566,10 +715,14 @@ export class ImportExportService {
 
       const data = await this.data.getData({
         key: tableName,
-        fields: [columnName, 'display_name'],
+        fields: includeNames ? [columnName, 'display_name'] : [columnName],
         filters: filters
       }).toPromise() || [];
 
+      if (!includeNames) {
+        return data.map(item => ({ 'ID': (item as any)[columnName] }));
+      }
+
       return data.map(item => ({
         'ID': (item as any)[columnName],
         'Name': item.display_name
@@ -934,11 +1087,11 @@ export class ImportExportService {
    * @param notes Array of notes to transform
    * @returns Array of objects for Excel export
    */
-  transformNotesForExport(notes: EntityNote[]): any[] {
+  transformNotesForExport(notes: EntityNote[], redactions: ExportRedaction[] = []): any[] {
     return notes.map(note => ({
       'Record ID': note.entity_id,
       'Note ID': note.id,
-      'Author': note.author?.full_name || note.author?.display_name || 'System',
+      'Author': this.exportableUserName(note.author, redactions) || 'System',
       'Date': this.formatDateForExport(note.created_at),
       'Type': note.note_type === 'system' ? 'System' : 'Note',
       'Content': stripMarkdown(note.content)
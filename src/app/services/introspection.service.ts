@@ -24,7 +24,8 @@ import {
   SchemaTrigger,
   EntitySourceCodeResponse,
   SchemaRlsPolicy,
-  ParsedSourceCode
+  ParsedSourceCode,
+  SourceLintFinding
 } from '../interfaces/introspection';
 
 @Injectable({
@@ -87,4 +88,16 @@ export class IntrospectionService {
     }
     return this.http.get<SchemaRlsPolicy[]>(url);
   }
+
+  /**
+   * Fetch source lint findings (admin-only) from the Go worker's lint pass.
+   * Optionally filter by object name.
+   */
+  getSourceLintFindings(objectName?: string): Observable<SourceLintFinding[]> {
+    let url = getPostgrestUrl() + 'source_lint_findings?order=severity,schema_name,object_name,rule';
+    if (objectName) {
+      url += `&object_name=eq.${objectName}`;
+    }
+    return this.http.get<SourceLintFinding[]>(url);
+  }
 }
@@ -32,6 +32,12 @@ export interface ValidationResult {
   part_name: string;
   valid: boolean;
   error_message?: string;
+  /** Likely mistakes in a part that parsed; don't make it invalid (v0.117.0+) */
+  warnings?: string[];
+  /** SMS part rendered with sample data (v0.116.0+) */
+  sms_length?: number;
+  sms_segments?: number;
+  sms_encoding?: 'GSM-7' | 'UCS-2';
 }
 
 export interface ValidationResponse {
@@ -43,6 +49,10 @@ export interface ValidationStatusResponse {
   part_name?: string;
   valid?: boolean;
   error_message?: string;
+  warnings?: string[] | null;
+  sms_length?: number | null;
+  sms_segments?: number | null;
+  sms_encoding?: 'GSM-7' | 'UCS-2' | null;
 }
 
 export interface PreviewResult {
@@ -81,6 +91,29 @@ export interface NotificationPreference {
   updated_at: string;
 }
 
+/**
+ * A kind of notification users can turn off per channel (v0.138.0)
+ */
+export interface NotificationCategory {
+  name: string;
+  display_name: string;
+  description?: string;
+  default_enabled: boolean;
+  sort_order: number;
+}
+
+/**
+ * One cell of a user's category × channel preference matrix (v0.138.0)
+ */
+export interface NotificationCategoryPreference {
+  user_id: string;
+  category: string;
+  channel: 'email' | 'sms';
+  enabled: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
 // ============================================================================
 // Service
 // ============================================================================
@@ -216,8 +249,9 @@ export class NotificationService {
    * Validate template parts (subject, HTML, text, SMS)
    * Returns validation result for each part provided.
    * This is asynchronous - enqueues job and polls for results.
+   * Sample data is used for SMS segment counts and warnings.
    */
-  validateTemplateParts(parts: TemplateParts): Observable<ValidationResult[]> {
+  validateTemplateParts(parts: TemplateParts, sampleEntityData?: any): Observable<ValidationResult[]> {
     // Step 1: Enqueue validation job
     return this.http.post<ValidationResponse[]>(
       `${this.baseUrl}rpc/validate_template_parts`,
@@ -225,7 +259,8 @@ export class NotificationService {
         p_subject_template: parts.subject_template || null,
         p_html_template: parts.html_template || null,
         p_text_template: parts.text_template || null,
-        p_sms_template: parts.sms_template || null
+        p_sms_template: parts.sms_template || null,
+        p_sample_entity_data: sampleEntityData ?? null
       }
     ).pipe(
       map(response => response[0].validation_id),
@@ -283,7 +318,11 @@ export class NotificationService {
           return results.filter(r => r.part_name != null).map(r => ({
             part_name: r.part_name!,
             valid: r.valid!,
-            error_message: r.error_message
+            error_message: r.error_message,
+            warnings: r.warnings ?? undefined,
+            sms_length: r.sms_length ?? undefined,
+            sms_segments: r.sms_segments ?? undefined,
+            sms_encoding: r.sms_encoding ?? undefined
           }));
         }
         return null; // Pending - don't emit yet
@@ -462,6 +501,65 @@ export class NotificationService {
     );
   }
 
+  /**
+   * Get the notification categories, in display order
+   */
+  getNotificationCategories(): Observable<NotificationCategory[]> {
+    return this.http.get<NotificationCategory[]>(
+      `${this.baseUrl}notification_categories?select=*&order=sort_order.asc,display_name.asc`
+    ).pipe(
+      catchError((error) => {
+        console.error('Error fetching notification categories:', error);
+        return of([]);
+      })
+    );
+  }
+
+  /**
+   * Get a user's category × channel preferences. Filtered by user because
+   * admins can read everyone's.
+   */
+  getCategoryPreferences(userId: string): Observable<NotificationCategoryPreference[]> {
+    return this.http.get<NotificationCategoryPreference[]>(
+      `${this.baseUrl}notification_category_preferences?select=*&user_id=eq.${userId}`
+    ).pipe(
+      catchError((error) => {
+        console.error('Error fetching notification category preferences:', error);
+        return of([]);
+      })
+    );
+  }
+
+  /**
+   * Turn a category on or off for one channel
+   */
+  updateCategoryPreference(userId: string, category: string, channel: 'email' | 'sms', enabled: boolean): Observable<ApiResponse> {
+    return this.http.patch(
+      `${this.baseUrl}notification_category_preferences?user_id=eq.${userId}&category=eq.${encodeURIComponent(category)}&channel=eq.${channel}`,
+      { enabled },
+      {
+        headers: {
+          'Prefer': 'return=representation'
+        }
+      }
+    ).pipe(
+      map((response: any) => ({
+        success: true,
+        body: response
+      } as ApiResponse)),
+      catchError((error) => {
+        console.error('Error updating notification category preference:', error);
+        return of({
+          success: false,
+          error: {
+            message: error.message,
+            humanMessage: this.getHumanErrorMessage(error)
+          }
+        } as ApiResponse);
+      })
+    );
+  }
+
   // ==========================================================================
   // Helpers
   // ==========================================================================
@@ -719,7 +719,7 @@ export class SchemaService {
 
     // File types: Embed file metadata from files table (system type - see METADATA_SYSTEM_TABLES)
     if ([EntityPropertyType.File, EntityPropertyType.FileImage, EntityPropertyType.FilePDF].includes(prop.type)) {
-      return `${prop.column_name}:files!${prop.column_name}(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status,thumbnail_error,created_at)`;
+      return `${prop.column_name}:files!${prop.column_name}(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status,thumbnail_error,placeholder_color,cdn_thumbnail_small_url,cdn_thumbnail_medium_url,cdn_thumbnail_large_url,cdn_urls_expire_at,created_at)`;
     }
 
     // Payment type: Embed payment data from payment_transactions view (system type)
@@ -743,7 +743,7 @@ export class SchemaService {
 
     // PhotoGallery: Embed gallery with nested files and file metadata (v0.47.0)
     if (prop.type === EntityPropertyType.PhotoGallery) {
-      return `${prop.column_name}:photo_galleries!${prop.column_name}(id,created_at,photo_gallery_files(file_id,sort_order,caption,alt_text,file:files!file_id(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status)))`;
+      return `${prop.column_name}:photo_galleries!${prop.column_name}(id,created_at,photo_gallery_files(file_id,sort_order,caption,alt_text,file:files!file_id(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status,placeholder_color,cdn_thumbnail_small_url,cdn_thumbnail_medium_url,cdn_thumbnail_large_url,cdn_urls_expire_at)))`;
     }
 
     // User type: Embed user data from civic_os_users table (system type - see METADATA_SYSTEM_TABLES)
@@ -773,7 +773,7 @@ export class SchemaService {
 
     // File types: Need full file data to show current file and allow replacement
     if ([EntityPropertyType.File, EntityPropertyType.FileImage, EntityPropertyType.FilePDF].includes(prop.type)) {
-      return `${prop.column_name}:files!${prop.column_name}(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status,thumbnail_error,created_at)`;
+      return `${prop.column_name}:files!${prop.column_name}(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status,thumbnail_error,placeholder_color,cdn_thumbnail_small_url,cdn_thumbnail_medium_url,cdn_thumbnail_large_url,cdn_urls_expire_at,created_at)`;
     }
 
     // For FK fields in edit forms, we only need the raw ID value
@@ -811,7 +811,7 @@ export class SchemaService {
     // PhotoGallery: Need full gallery data with files for edit form (same as detail view)
     // Editor component shows current images and allows add/remove/reorder
     if (prop.type === EntityPropertyType.PhotoGallery) {
-      return `${prop.column_name}:photo_galleries!${prop.column_name}(id,created_at,photo_gallery_files(file_id,sort_order,caption,alt_text,file:files!file_id(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status)))`;
+      return `${prop.column_name}:photo_galleries!${prop.column_name}(id,created_at,photo_gallery_files(file_id,sort_order,caption,alt_text,file:files!file_id(id,file_name,file_type,file_size,s3_key_prefix,s3_original_key,s3_thumbnail_small_key,s3_thumbnail_medium_key,s3_thumbnail_large_key,thumbnail_status,placeholder_color,cdn_thumbnail_small_url,cdn_thumbnail_medium_url,cdn_thumbnail_large_url,cdn_urls_expire_at)))`;
     }
 
     // Everything else uses the column name directly
@@ -253,6 +253,45 @@ describe('UserManagementService', () => {
     });
   });
 
+  describe('requestUserImport()', () => {
+    it('should POST the file id and default roles to rpc/request_user_import', (done) => {
+      service.requestUserImport('file-123', ['editor']).subscribe(response => {
+        expect(response.success).toBe(true);
+        expect(response.body.batch_id).toBe(7);
+        done();
+      });
+
+      const req = httpMock.expectOne(testPostgrestUrl + 'rpc/request_user_import');
+      expect(req.request.method).toBe('POST');
+      expect(req.request.body).toEqual({ p_file_id: 'file-123', p_default_roles: ['editor'] });
+      req.flush({ success: true, batch_id: 7 });
+    });
+
+    it('should return the RPC error when the import is rejected', (done) => {
+      service.requestUserImport('file-123').subscribe(response => {
+        expect(response.success).toBe(false);
+        expect(response.error?.humanMessage).toBe('User imports must be CSV files');
+        done();
+      });
+
+      const req = httpMock.expectOne(testPostgrestUrl + 'rpc/request_user_import');
+      req.flush({ success: false, error: 'User imports must be CSV files' });
+    });
+  });
+
+  describe('getUserImportBatches()', () => {
+    it('should return an empty list on error', (done) => {
+      service.getUserImportBatches().subscribe(batches => {
+        expect(batches).toEqual([]);
+        done();
+      });
+
+      const req = httpMock.expectOne(testPostgrestUrl + 'rpc/get_user_import_batches');
+      expect(req.request.body).toEqual({ p_limit: 10 });
+      req.flush({ message: 'Permission denied' }, { status: 400, statusText: 'Bad Request' });
+    });
+  });
+
   describe('retryProvisioning()', () => {
     it('should POST to retry_user_provisioning RPC', (done) => {
       service.retryProvisioning(42).subscribe(response => {
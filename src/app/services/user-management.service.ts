@@ -82,6 +82,21 @@ export interface BulkProvisionResult {
   errors: { index: number; email: string; error: string }[];
 }
 
+export interface UserImportBatch {
+  id: number;
+  file_id: string;
+  file_name: string;
+  status: 'pending' | 'provisioning' | 'completed' | 'failed';
+  total_rows: number;
+  invalid_rows: number;
+  skipped_rows: number;
+  completed_rows: number;
+  failed_rows: number;
+  error_message: string | null;
+  created_at: string;
+  completed_at: string | null;
+}
+
 @Injectable({
   providedIn: 'root'
 })
@@ -166,6 +181,47 @@ export class UserManagementService {
     );
   }
 
+  /**
+   * Queue a background import of an uploaded CSV (metadata.files id) via
+   * request_user_import. The bulk_provision_users job validates and provisions
+   * the rows and emails the importer a summary when done.
+   */
+  requestUserImport(fileId: string, defaultRoles: string[] = ['user']): Observable<ApiResponse> {
+    return this.http.post<any>(
+      getPostgrestUrl() + 'rpc/request_user_import',
+      { p_file_id: fileId, p_default_roles: defaultRoles }
+    ).pipe(
+      map(response => {
+        if (response?.success === false) {
+          return <ApiResponse>{
+            success: false,
+            error: { message: response.error, humanMessage: response.error }
+          };
+        }
+        return <ApiResponse>{ success: true, body: { batch_id: response.batch_id } };
+      }),
+      catchError(error => {
+        const message = error.error?.message || error.error?.details || error.message || 'Failed to start import';
+        return of(<ApiResponse>{
+          success: false,
+          error: { message, humanMessage: message }
+        });
+      })
+    );
+  }
+
+  getUserImportBatches(limit = 10): Observable<UserImportBatch[]> {
+    return this.http.post<UserImportBatch[]>(
+      getPostgrestUrl() + 'rpc/get_user_import_batches',
+      { p_limit: limit }
+    ).pipe(
+      catchError(error => {
+        console.error('Error fetching user imports:', error);
+        return of([]);
+      })
+    );
+  }
+
   createUser(user: ProvisionUserRequest): Observable<ApiResponse> {
     return this.http.post<any>(
       getPostgrestUrl() + 'rpc/create_provisioned_user',
@@ -0,0 +1,70 @@
+/**
+ * Copyright (C) 2023-2026 Civic OS, L3C
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import { FileReference } from '../interfaces/entity';
+import { getS3Config } from '../config/runtime';
+import { getCdnThumbnailUrl, getFileDisplayUrl, getS3ObjectUrl } from './file-url.utils';
+
+describe('file URL utils', () => {
+  const now = Date.parse('2026-03-04T12:00:00Z');
+  const file: FileReference = {
+    id: 'f1',
+    entity_type: 'issues',
+    entity_id: '42',
+    file_name: 'photo.jpg',
+    file_type: 'image/jpeg',
+    file_size: 1024,
+    s3_bucket: 'civic-os-files',
+    s3_key_prefix: 'issues/42/f1',
+    s3_original_key: 'issues/42/f1/original.jpg',
+    s3_thumbnail_small_key: 'issues/42/f1/thumb-small.jpg',
+    s3_thumbnail_medium_key: 'issues/42/f1/thumb-medium.jpg',
+    thumbnail_status: 'completed',
+    created_at: '2026-03-01T00:00:00Z',
+    updated_at: '2026-03-01T00:00:00Z'
+  };
+  const signed: FileReference = {
+    ...file,
+    cdn_thumbnail_small_url: 'https://cdn.test/issues/42/f1/thumb-small.jpg?verify=1-a',
+    cdn_thumbnail_medium_url: 'https://cdn.test/issues/42/f1/thumb-medium.jpg?verify=1-b',
+    cdn_urls_expire_at: '2026-03-05T12:00:00+00:00'
+  };
+
+  it('should build S3 object URLs from the runtime config', () => {
+    const s3 = getS3Config();
+    expect(getS3ObjectUrl('a/b.jpg')).toBe(`${s3.endpoint}/${s3.bucket}/a/b.jpg`);
+  });
+
+  it('should return a signed URL only until it expires', () => {
+    expect(getCdnThumbnailUrl(signed, 'small', now)).toBe(signed.cdn_thumbnail_small_url!);
+    expect(getCdnThumbnailUrl(signed, 'small', Date.parse('2026-03-05T12:00:01Z'))).toBeNull();
+    expect(getCdnThumbnailUrl(signed, 'large', now)).toBeNull();
+    expect(getCdnThumbnailUrl(file, 'small', now)).toBeNull();
+  });
+
+  it('should prefer the signed URL of the first available size', () => {
+    expect(getFileDisplayUrl(signed, ['small', 'medium'], now)).toBe(signed.cdn_thumbnail_small_url!);
+    expect(getFileDisplayUrl(signed, ['medium'], now)).toBe(signed.cdn_thumbnail_medium_url!);
+  });
+
+  it('should fall back to S3 thumbnails and then the original', () => {
+    expect(getFileDisplayUrl(file, ['small', 'medium'], now)).toBe(getS3ObjectUrl('issues/42/f1/thumb-small.jpg'));
+    expect(getFileDisplayUrl(file, ['large'], now)).toBe(getS3ObjectUrl('issues/42/f1/original.jpg'));
+    expect(getFileDisplayUrl(file, [], now)).toBe(getS3ObjectUrl('issues/42/f1/original.jpg'));
+    expect(getFileDisplayUrl({ ...file, s3_original_key: '' }, ['large'], now)).toBeNull();
+  });
+});
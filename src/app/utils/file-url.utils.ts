@@ -0,0 +1,72 @@
+/**
+ * Copyright (C) 2023-2026 Civic OS, L3C
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published
+ * by the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+/**
+ * URL helpers for file thumbnails.
+ *
+ * When the worker signs CDN URLs (CDN_URL_SIGNER, v0.113.0) thumbnails are no
+ * longer public-read, so the signed URL from public.files must be used while
+ * it is valid. Without signing, or for files not yet signed, thumbnails are
+ * loaded straight from S3 as before.
+ */
+
+import { FileReference } from '../interfaces/entity';
+import { getS3Config } from '../config/runtime';
+
+export type ThumbnailSize = 'small' | 'medium' | 'large';
+
+const THUMBNAIL_FIELDS = {
+  small: { key: 's3_thumbnail_small_key', cdnUrl: 'cdn_thumbnail_small_url' },
+  medium: { key: 's3_thumbnail_medium_key', cdnUrl: 'cdn_thumbnail_medium_url' },
+  large: { key: 's3_thumbnail_large_key', cdnUrl: 'cdn_thumbnail_large_url' }
+} as const satisfies Record<ThumbnailSize, { key: keyof FileReference; cdnUrl: keyof FileReference }>;
+
+/**
+ * Build the S3 URL for an object key.
+ */
+export function getS3ObjectUrl(s3Key: string): string {
+  const s3Config = getS3Config();
+  return `${s3Config.endpoint}/${s3Config.bucket}/${s3Key}`;
+}
+
+/**
+ * Signed CDN URL for one thumbnail size, or null if the file has none or it
+ * has expired.
+ */
+export function getCdnThumbnailUrl(file: FileReference, size: ThumbnailSize, now: number = Date.now()): string | null {
+  const url = file[THUMBNAIL_FIELDS[size].cdnUrl];
+  if (!url || !file.cdn_urls_expire_at) return null;
+  return new Date(file.cdn_urls_expire_at).getTime() > now ? url : null;
+}
+
+/**
+ * Best URL for displaying a file: the first of `sizes` that has a thumbnail,
+ * preferring its signed CDN URL, then the original.
+ *
+ * @example
+ * // Small thumbnail, falling back to medium and then the original
+ * getFileDisplayUrl(file, ['small', 'medium']);
+ */
+export function getFileDisplayUrl(file: FileReference, sizes: ThumbnailSize[], now: number = Date.now()): string | null {
+  for (const size of sizes) {
+    const cdnUrl = getCdnThumbnailUrl(file, size, now);
+    if (cdnUrl) return cdnUrl;
+    const key = file[THUMBNAIL_FIELDS[size].key];
+    if (key) return getS3ObjectUrl(key);
+  }
+  return file.s3_original_key ? getS3ObjectUrl(file.s3_original_key) : null;
+}